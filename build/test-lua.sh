@@ -31,8 +31,25 @@ resty \
   --shdict "certificate_data 16M" \
   --shdict "certificate_servers 1M" \
   --shdict "ocsp_response_cache 1M" \
+  --shdict "ocsp_must_staple 1M" \
   --shdict "balancer_ewma 1M" \
   --shdict "balancer_ewma_last_touched_at 1M" \
   --shdict "balancer_ewma_locks 512k" \
   --shdict "global_throttle_cache 5M" \
+  --shdict "global_throttle_local 1M" \
+  --shdict "global_throttle_deltas 1M" \
+  --shdict "upstream_keepalive_stats 1M" \
+  --shdict "bot_detection 1M" \
+  --shdict "inflight_requests 1M" \
+  --shdict "connections_per_key 1M" \
+  --shdict "websocket_connections 1M" \
+  --shdict "backend_bandwidth 1M" \
+  --shdict "idempotency_responses 1M" \
+  --shdict "no_sni_handshakes 1M" \
+  --shdict "warm_up 1M" \
+  --shdict "circuit_breaker 1M" \
+  --shdict "health_check 1M" \
+  --shdict "auth_jwt_jwks 1M" \
+  --shdict "backend_health 1M" \
+  --shdict "drain 1M" \
   ./rootfs/etc/nginx/lua/test/run.lua ${BUSTED_ARGS} ./rootfs/etc/nginx/lua/test/ ./rootfs/etc/nginx/lua/plugins/**/test
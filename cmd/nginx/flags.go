@@ -20,18 +20,24 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/class"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/controller"
 	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+	"k8s.io/ingress-nginx/internal/ingress/notifier"
 	"k8s.io/ingress-nginx/internal/ingress/status"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/logging"
 	ing_net "k8s.io/ingress-nginx/internal/net"
 	"k8s.io/ingress-nginx/internal/nginx"
 )
@@ -65,6 +71,13 @@ If this parameter is not set, or set to the default value of "nginx", it will ha
 		configMap = flags.String("configmap", "",
 			`Name of the ConfigMap containing custom global configurations for the controller.`)
 
+		configMapOverlays = flags.StringSlice("configmap-overlays", []string{},
+			`Comma separated list of ConfigMaps, in the form "namespace/name", layered over the
+ConfigMap of the flag --configmap. The configurations are applied in order, the
+values of a ConfigMap override the values of the ConfigMaps before it. A ConfigMap
+in the form "class=namespace/name" is only layered by the controllers of the
+class of the flag --ingress-class.`)
+
 		publishSvc = flags.String("publish-service", "",
 			`Service fronting the Ingress controller.
 Takes the form "namespace/name". When used together with update-status, the
@@ -116,6 +129,10 @@ Requires setting the publish-service parameter to a valid Service reference.`)
 			`Update the load-balancer status of Ingress objects when the controller shuts down.
 Requires the update-status parameter.`)
 
+		updateConfigurationStatus = flags.Bool("update-configuration-status", false,
+			`Write the status of the configuration of each Ingress, whether it is live and any warnings,
+in the annotation nginx.ingress.kubernetes.io/configuration-status. Requires the update-status parameter.`)
+
 		useNodeInternalIP = flags.Bool("report-node-internal-ip-address", false,
 			`Set the load-balancer status of Ingress objects to internal Node addresses instead of external.
 Requires the update-status parameter.`)
@@ -147,16 +164,48 @@ Requires the update-status parameter.`)
 			`Export metrics per-host`)
 		monitorMaxBatchSize = flags.Int("monitor-max-batch-size", 10000, "Max batch size of NGINX metrics")
 
+		enableAccounting = flags.Bool("enable-accounting", false,
+			`Enables the accounting of the requests and bytes by tenant. Requires the enable-metrics parameter.`)
+		accountingTenantAnnotation = flags.String("accounting-tenant-annotation", "",
+			`Annotation of the Ingresses with the tenant of their requests.
+The tenant is the namespace of the Ingress when empty or when the Ingress does not have the annotation.`)
+		accountingReportPath = flags.String("accounting-report-path", "",
+			`Path of the file with the periodic JSON report of the requests and bytes by tenant. Disabled when empty.`)
+		accountingReportInterval = flags.Duration("accounting-report-interval", 1*time.Hour,
+			`Period of time covered by each accounting report.`)
+
 		httpPort  = flags.Int("http-port", 80, `Port to use for servicing HTTP traffic.`)
 		httpsPort = flags.Int("https-port", 443, `Port to use for servicing HTTPS traffic.`)
 
-		sslProxyPort  = flags.Int("ssl-passthrough-proxy-port", 442, `Port to use internally for SSL Passthrough.`)
-		defServerPort = flags.Int("default-server-port", 8181, `Port to use for exposing the default server (catch-all).`)
-		healthzPort   = flags.Int("healthz-port", 10254, "Port to use for the healthz endpoint.")
+		sslProxyPort      = flags.Int("ssl-passthrough-proxy-port", 442, `Port to use internally for SSL Passthrough.`)
+		http1SSLProxyPort = flags.Int("http1-ssl-proxy-port", ngx_config.DefaultHTTP1SSLProxyPort, `Port to use internally for the HTTPS servers with HTTP/2 disabled.`)
+		defServerPort     = flags.Int("default-server-port", 8181, `Port to use for exposing the default server (catch-all).`)
+		healthzPort       = flags.Int("healthz-port", 10254, "Port to use for the healthz endpoint.")
+
+		mixedProtocolPort = flags.Int("mixed-protocol-port", 0,
+			`Port accepting both plaintext HTTP and TLS connections, told apart by their first bytes, for load balancers that cannot split the traffic in two ports.
+The TLS connections are served like the ones of --https-port and the HTTP requests are redirected to HTTPS on the same port. The value 0 disables the port.`)
+		mixedProtocolRedirectPort = flags.Int("mixed-protocol-redirect-port", 440, `Port to use internally for redirecting to HTTPS the plaintext HTTP requests of --mixed-protocol-port.`)
+
+		introspectionTokenFile = flags.String("introspection-token-file", "",
+			`Path of the file with the bearer token required by the endpoints /introspection/configuration,
+/introspection/certificates, /introspection/configuration-diff, /introspection/nginx.conf,
+/introspection/configuration-snapshots and /introspection/backend-health of the healthz port, which return the running
+configuration and the served certificates as JSON, the diff of the pending NGINX configuration, the running NGINX
+configuration with its secrets redacted, the snapshots of the configuration and the health scores of the backends. The
+endpoints are disabled when empty.`)
 
 		disableCatchAll = flags.Bool("disable-catch-all", false,
 			`Disable support for catch-all Ingresses`)
 
+		enableEchoBackend = flags.Bool("enable-echo-backend", false,
+			`Enable the built-in echo backend. The locations with the annotation "echo-backend"
+are answered by NGINX with the details of the request instead of the service.`)
+
+		enableEdgeFunctions = flags.Bool("enable-edge-functions", false,
+			`Enable the sandboxed Lua functions of the annotation "lua-edge-function", run by NGINX
+to change the requests and the responses of the locations.`)
+
 		validationWebhook = flags.String("validating-webhook", "",
 			`The address to start an admission controller on to validate incoming ingresses.
 Takes the form "<host>:port". If not provided, no admission controller is started.`)
@@ -173,6 +222,49 @@ Takes the form "<host>:port". If not provided, no admission controller is starte
 		statusUpdateInterval = flags.Int("status-update-interval", status.UpdateInterval, "Time interval in seconds in which the status should check if an update is required. Default is 60 seconds")
 
 		shutdownGracePeriod = flags.Int("shutdown-grace-period", 0, "Seconds to wait after receiving the shutdown signal, before stopping the nginx process.")
+
+		syncWatchdogTimeout = flags.Duration("sync-watchdog-timeout", 0,
+			`Time without a successful synchronization of the configuration, while events are pending, after which the synchronization is considered stalled.
+A stall is logged with the state of the controller, the goroutines are dumped to a file of the temporary directory and the nginx_ingress_controller_sync_stalls metric is incremented.
+The value 0 disables the watchdog.`)
+		syncWatchdogRestart = flags.Bool("sync-watchdog-restart", false,
+			`Exit the controller when the watchdog detects a stall, after the goroutines are dumped, so the kubelet restarts the pod.`)
+
+		configurationSnapshots = flags.Int("configuration-snapshots", 0,
+			`Number of snapshots of the NGINX configurations of the last reloads kept on disk, with the generations of their Ingresses.
+The snapshots are listed, compared and used to roll back the configuration by the endpoints /introspection/configuration-snapshots of the healthz port, which require --introspection-token-file.
+The value 0 disables the snapshots.`)
+
+		watchGlobalRateLimitPolicies = flags.Bool("watch-global-rate-limit-policies", false,
+			`Watch the GlobalRateLimitPolicy custom resources referenced by the global-rate-limit-policy annotation.
+Requires the GlobalRateLimitPolicy custom resource definition and the permission to list and watch globalratelimitpolicies.`)
+
+		notificationWebhookURLs = flags.StringSlice("notification-webhook-urls", []string{},
+			`Comma separated list of URLs receiving the events of the controller as JSON documents in POST requests:
+the reloads of NGINX, completed or failed, the certificates about to expire and the conflicts between Ingresses.
+The notifications are disabled when empty.`)
+		notificationWebhookEvents = flags.StringSlice("notification-webhook-events", []string{},
+			`Comma separated list of the types of the events sent to the notification webhooks, all the types when empty.
+Valid types are ReloadCompleted, ReloadFailed, CertificateExpiring and ConflictDetected.`)
+		notificationWebhookTimeout = flags.Duration("notification-webhook-timeout", notifier.DefaultTimeout,
+			`Timeout of the requests to the notification webhooks.`)
+		notificationCertificateExpiry = flags.Duration("notification-certificate-expiry", notifier.DefaultCertificateExpiry,
+			`Time before the expiration of a certificate from which the CertificateExpiring event is sent to the notification webhooks.`)
+
+		configMapRolloutSelector = flags.String("configmap-rollout-selector", "",
+			`Label selector of the replicas of the controller applying the changes of the configuration ConfigMap first.
+The other replicas apply them once every selected replica is healthy with the new configuration for the soak period.
+The changes are applied to all the replicas at once when empty.`)
+		configMapRolloutSoakPeriod = flags.Duration("configmap-rollout-soak-period", 10*time.Minute,
+			`Time the replicas selected by --configmap-rollout-selector must be healthy with a new configuration before it is applied to the other replicas.`)
+
+		shadowMode = flags.Bool("shadow-mode", false,
+			`Render and test the NGINX configuration of the Ingresses on every change without starting NGINX, taking part in the leader election or updating the Ingresses.
+The results and the Ingresses whose configuration state differs from the nginx.ingress.kubernetes.io/configuration-status annotation of the serving controllers are exported as metrics, to trial a version of the controller or a template against the live objects.`)
+
+		logFormat = flags.String("log-format", logging.TextFormat,
+			`Format of the logs of the controller, text or json.
+The verbosity of each subsystem can be changed at runtime with the log-level-overrides setting of the configuration ConfigMap.`)
 	)
 
 	flags.StringVar(&nginx.MaxmindMirror, "maxmind-mirror", "", `Maxmind mirror url (example: http://geoip.local/databases`)
@@ -189,6 +281,10 @@ https://blog.maxmind.com/2019/12/18/significant-changes-to-accessing-and-using-g
 	// https://github.com/kubernetes/kubernetes/issues/17162
 	flag.CommandLine.Parse([]string{})
 
+	if err := logging.SetFormat(*logFormat); err != nil {
+		return false, nil, err
+	}
+
 	pflag.VisitAll(func(flag *pflag.Flag) {
 		klog.V(2).InfoS("FLAG", flag.Name, flag.Value)
 	})
@@ -243,9 +339,54 @@ https://blog.maxmind.com/2019/12/18/significant-changes-to-accessing-and-using-g
 		return false, nil, fmt.Errorf("port %v is already in use. Please check the flag --profiler-port", *profilerPort)
 	}
 
+	if *mixedProtocolPort > 0 {
+		if *enableSSLPassthrough {
+			return false, nil, fmt.Errorf("flags --mixed-protocol-port and --enable-ssl-passthrough are mutually exclusive")
+		}
+
+		if !ing_net.IsPortAvailable(*mixedProtocolPort) {
+			return false, nil, fmt.Errorf("port %v is already in use. Please check the flag --mixed-protocol-port", *mixedProtocolPort)
+		}
+
+		if !ing_net.IsPortAvailable(*mixedProtocolRedirectPort) {
+			return false, nil, fmt.Errorf("port %v is already in use. Please check the flag --mixed-protocol-redirect-port", *mixedProtocolRedirectPort)
+		}
+
+		if *mixedProtocolPort == *mixedProtocolRedirectPort {
+			return false, nil, fmt.Errorf("flags --mixed-protocol-port and --mixed-protocol-redirect-port use the same port %v", *mixedProtocolPort)
+		}
+
+		// the connections of the mixed protocol port are proxied to the
+		// internal ports of the HTTPS servers
+		ports := []struct {
+			flag string
+			port int
+		}{
+			{"--http-port", *httpPort},
+			{"--https-port", *httpsPort},
+			{"--status-port", *statusPort},
+			{"--stream-port", *streamPort},
+			{"--default-server-port", *defServerPort},
+			{"--healthz-port", *healthzPort},
+			{"--profiler-port", *profilerPort},
+			{"--ssl-passthrough-proxy-port", *sslProxyPort},
+			{"--http1-ssl-proxy-port", *http1SSLProxyPort},
+		}
+		for _, p := range ports {
+			if p.port == *mixedProtocolPort {
+				return false, nil, fmt.Errorf("flags --mixed-protocol-port and %v use the same port %v", p.flag, p.port)
+			}
+
+			if p.port == *mixedProtocolRedirectPort {
+				return false, nil, fmt.Errorf("flags --mixed-protocol-redirect-port and %v use the same port %v", p.flag, p.port)
+			}
+		}
+	}
+
 	nginx.StatusPort = *statusPort
 	nginx.StreamPort = *streamPort
 	nginx.ProfilerPort = *profilerPort
+	nginx.HealthzPort = *healthzPort
 
 	if *enableSSLPassthrough && !ing_net.IsPortAvailable(*sslProxyPort) {
 		return false, nil, fmt.Errorf("port %v is already in use. Please check the flag --ssl-passthrough-proxy-port", *sslProxyPort)
@@ -255,6 +396,50 @@ https://blog.maxmind.com/2019/12/18/significant-changes-to-accessing-and-using-g
 		return false, nil, fmt.Errorf("flags --publish-service and --publish-status-address are mutually exclusive")
 	}
 
+	if *syncWatchdogTimeout < 0 {
+		return false, nil, fmt.Errorf("flag --sync-watchdog-timeout must not be negative")
+	}
+
+	if *configurationSnapshots < 0 {
+		return false, nil, fmt.Errorf("flag --configuration-snapshots must not be negative")
+	}
+
+	if *configMap == "" && len(*configMapOverlays) > 0 {
+		return false, nil, fmt.Errorf("flag --configmap-overlays requires --configmap")
+	}
+
+	overlays, err := classConfigMapOverlays(*configMapOverlays, class.IngressClass)
+	if err != nil {
+		return false, nil, err
+	}
+
+	notifications := notifier.Config{
+		URLs:              *notificationWebhookURLs,
+		Events:            *notificationWebhookEvents,
+		Timeout:           *notificationWebhookTimeout,
+		CertificateExpiry: *notificationCertificateExpiry,
+	}
+	if err := notifications.Validate(); err != nil {
+		return false, nil, fmt.Errorf("invalid notification webhooks: %v", err)
+	}
+
+	rolloutSelector, err := labels.Parse(*configMapRolloutSelector)
+	if err != nil {
+		return false, nil, fmt.Errorf("invalid --configmap-rollout-selector: %v", err)
+	}
+
+	if *configMapRolloutSoakPeriod <= 0 {
+		return false, nil, fmt.Errorf("flag --configmap-rollout-soak-period must be greater than 0")
+	}
+
+	if *enableAccounting && !*enableMetrics {
+		return false, nil, fmt.Errorf("flag --enable-accounting requires --enable-metrics")
+	}
+
+	if *accountingReportPath != "" && *accountingReportInterval <= 0 {
+		return false, nil, fmt.Errorf("flag --accounting-report-interval must be greater than zero")
+	}
+
 	nginx.HealthPath = *defHealthzURL
 
 	if *defHealthCheckTimeout > 0 {
@@ -264,39 +449,62 @@ https://blog.maxmind.com/2019/12/18/significant-changes-to-accessing-and-using-g
 	ngx_config.EnableSSLChainCompletion = *enableSSLChainCompletion
 
 	config := &controller.Configuration{
-		APIServerHost:          *apiserverHost,
-		KubeConfigFile:         *kubeConfigFile,
-		UpdateStatus:           *updateStatus,
-		ElectionID:             *electionID,
-		EnableProfiling:        *profiling,
-		EnableMetrics:          *enableMetrics,
-		MetricsPerHost:         *metricsPerHost,
-		MonitorMaxBatchSize:    *monitorMaxBatchSize,
-		EnableSSLPassthrough:   *enableSSLPassthrough,
-		ResyncPeriod:           *resyncPeriod,
-		DefaultService:         *defaultSvc,
-		Namespace:              *watchNamespace,
-		ConfigMapName:          *configMap,
-		TCPConfigMapName:       *tcpConfigMapName,
-		UDPConfigMapName:       *udpConfigMapName,
-		DefaultSSLCertificate:  *defSSLCertificate,
-		PublishService:         *publishSvc,
-		PublishStatusAddress:   *publishStatusAddress,
-		UpdateStatusOnShutdown: *updateStatusOnShutdown,
-		ShutdownGracePeriod:    *shutdownGracePeriod,
-		UseNodeInternalIP:      *useNodeInternalIP,
-		SyncRateLimit:          *syncRateLimit,
+		APIServerHost:   *apiserverHost,
+		KubeConfigFile:  *kubeConfigFile,
+		UpdateStatus:    *updateStatus,
+		ElectionID:      *electionID,
+		EnableProfiling: *profiling,
+		EnableMetrics:   *enableMetrics,
+		MetricsPerHost:  *metricsPerHost,
+		Accounting: collectors.AccountingConfig{
+			Enabled:          *enableAccounting,
+			TenantAnnotation: *accountingTenantAnnotation,
+			ReportPath:       *accountingReportPath,
+			ReportInterval:   *accountingReportInterval,
+		},
+		MonitorMaxBatchSize:          *monitorMaxBatchSize,
+		EnableSSLPassthrough:         *enableSSLPassthrough,
+		ResyncPeriod:                 *resyncPeriod,
+		DefaultService:               *defaultSvc,
+		Namespace:                    *watchNamespace,
+		ConfigMapName:                *configMap,
+		ConfigMapOverlays:            overlays,
+		TCPConfigMapName:             *tcpConfigMapName,
+		UDPConfigMapName:             *udpConfigMapName,
+		DefaultSSLCertificate:        *defSSLCertificate,
+		PublishService:               *publishSvc,
+		PublishStatusAddress:         *publishStatusAddress,
+		UpdateStatusOnShutdown:       *updateStatusOnShutdown,
+		UpdateConfigurationStatus:    *updateConfigurationStatus,
+		ShutdownGracePeriod:          *shutdownGracePeriod,
+		SyncWatchdogTimeout:          *syncWatchdogTimeout,
+		SyncWatchdogRestart:          *syncWatchdogRestart,
+		ConfigurationSnapshots:       *configurationSnapshots,
+		WatchGlobalRateLimitPolicies: *watchGlobalRateLimitPolicies,
+		UseNodeInternalIP:            *useNodeInternalIP,
+		SyncRateLimit:                *syncRateLimit,
 		ListenPorts: &ngx_config.ListenPorts{
-			Default:  *defServerPort,
-			Health:   *healthzPort,
-			HTTP:     *httpPort,
-			HTTPS:    *httpsPort,
-			SSLProxy: *sslProxyPort,
+			Default:       *defServerPort,
+			Health:        *healthzPort,
+			HTTP:          *httpPort,
+			HTTPS:         *httpsPort,
+			SSLProxy:      *sslProxyPort,
+			HTTP1SSLProxy: *http1SSLProxyPort,
+
+			MixedProtocol:         *mixedProtocolPort,
+			MixedProtocolRedirect: *mixedProtocolRedirectPort,
 		},
-		DisableCatchAll:           *disableCatchAll,
-		ValidationWebhook:         *validationWebhook,
-		ValidationWebhookCertPath: *validationWebhookCert,
-		ValidationWebhookKeyPath:  *validationWebhookKey,
+		DisableCatchAll:            *disableCatchAll,
+		EnableEchoBackend:          *enableEchoBackend,
+		EnableEdgeFunctions:        *enableEdgeFunctions,
+		ValidationWebhook:          *validationWebhook,
+		ValidationWebhookCertPath:  *validationWebhookCert,
+		ValidationWebhookKeyPath:   *validationWebhookKey,
+		IntrospectionTokenFile:     *introspectionTokenFile,
+		Notifications:              notifications,
+		ConfigMapRolloutSelector:   rolloutSelector,
+		ConfigMapRolloutSoakPeriod: *configMapRolloutSoakPeriod,
+		ShadowMode:                 *shadowMode,
 	}
 
 	if *apiserverHost != "" {
@@ -316,3 +524,26 @@ https://blog.maxmind.com/2019/12/18/significant-changes-to-accessing-and-using-g
 
 	return false, config, nil
 }
+
+// classConfigMapOverlays returns the ConfigMaps of the flag --configmap-overlays
+// layered by the controllers of the ingress class, the ones in the form
+// "class=namespace/name" are only layered by the controllers of the class
+func classConfigMapOverlays(overlays []string, ingressClass string) ([]string, error) {
+	keys := []string{}
+	for _, overlay := range overlays {
+		class, key := "", overlay
+		if i := strings.Index(overlay, "="); i >= 0 {
+			class, key = overlay[:i], overlay[i+1:]
+		}
+
+		if _, _, err := k8s.ParseNameNS(key); err != nil {
+			return nil, fmt.Errorf("invalid ConfigMap %q in the flag --configmap-overlays: %v", overlay, err)
+		}
+
+		if class == "" || class == ingressClass {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
@@ -18,7 +18,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"net"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -105,3 +108,63 @@ func TestMaxmindMirror(t *testing.T) {
 		t.Fatalf("Expected an error parsing flags but none returned")
 	}
 }
+
+func TestMixedProtocolPorts(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("unexpected error listening: %v", err)
+	}
+	defer listener.Close()
+	inUse := fmt.Sprintf("%v", listener.Addr().(*net.TCPAddr).Port)
+
+	testCases := []struct {
+		name      string
+		args      []string
+		expectErr bool
+	}{
+		{"valid ports", []string{"--mixed-protocol-port", "18443", "--mixed-protocol-redirect-port", "18440"}, false},
+		{"redirect port in use", []string{"--mixed-protocol-port", "18443", "--mixed-protocol-redirect-port", inUse}, true},
+		{"same mixed and redirect ports", []string{"--mixed-protocol-port", "18443", "--mixed-protocol-redirect-port", "18443"}, true},
+		{"mixed port of the healthz port", []string{"--mixed-protocol-port", "10254"}, true},
+		{"mixed port of the https port", []string{"--mixed-protocol-port", "18443", "--https-port", "18443"}, true},
+		{"redirect port of the stream port", []string{"--mixed-protocol-port", "18443", "--mixed-protocol-redirect-port", "10247"}, true},
+		{"redirect port of the default server port", []string{"--mixed-protocol-port", "18443", "--mixed-protocol-redirect-port", "8181"}, true},
+		{"redirect port without mixed port", []string{"--mixed-protocol-redirect-port", "8181"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resetForTesting(func() { t.Fatal("Parsing failed") })
+
+			oldArgs := os.Args
+			defer func() { os.Args = oldArgs }()
+			os.Args = append([]string{"cmd", "--http-port", "0", "--https-port", "0"}, tc.args...)
+
+			_, _, err := parseFlags()
+			if tc.expectErr && err == nil {
+				t.Errorf("expected an error parsing flags but none returned")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error parsing flags: %v", err)
+			}
+		})
+	}
+}
+
+func TestClassConfigMapOverlays(t *testing.T) {
+	overlays := []string{"ingress-nginx/base", "internal=ingress-nginx/internal", "external=ingress-nginx/external"}
+
+	keys, err := classConfigMapOverlays(overlays, "internal")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"ingress-nginx/base", "ingress-nginx/internal"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v but got %v", expected, keys)
+	}
+
+	if _, err := classConfigMapOverlays([]string{"external=invalid"}, "internal"); err == nil {
+		t.Errorf("expected an error with an invalid ConfigMap of another class")
+	}
+}
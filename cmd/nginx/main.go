@@ -31,11 +31,13 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	discovery "k8s.io/apimachinery/pkg/version"
 	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -73,7 +75,7 @@ func main() {
 		klog.Fatal(err)
 	}
 
-	kubeClient, err := createApiserverClient(conf.APIServerHost, conf.RootCAFile, conf.KubeConfigFile)
+	kubeClient, dynamicClient, err := createApiserverClient(conf.APIServerHost, conf.RootCAFile, conf.KubeConfigFile)
 	if err != nil {
 		handleFatalInitError(err)
 	}
@@ -106,15 +108,14 @@ func main() {
 
 	var isNetworkingIngressAvailable bool
 
-	isNetworkingIngressAvailable, k8s.IsIngressV1Beta1Ready, _ = k8s.NetworkingIngressAvailable(kubeClient)
+	isNetworkingIngressAvailable, k8s.IsIngressV1Beta1Ready, k8s.IsIngressV1Ready = k8s.NetworkingIngressAvailable(kubeClient)
 	if !isNetworkingIngressAvailable {
 		klog.Fatalf("ingress-nginx requires Kubernetes v1.14.0 or higher")
 	}
 
 	if k8s.IsIngressV1Beta1Ready {
 		klog.InfoS("Enabling new Ingress features available since Kubernetes v1.18")
-		k8s.IngressClass, err = kubeClient.NetworkingV1beta1().IngressClasses().
-			Get(context.TODO(), class.IngressClass, metav1.GetOptions{})
+		k8s.IngressClass, err = getIngressClass(kubeClient, class.IngressClass)
 		if err != nil {
 			if !errors.IsNotFound(err) {
 				if !errors.IsUnauthorized(err) && !errors.IsForbidden(err) {
@@ -134,9 +135,24 @@ func main() {
 			klog.Errorf(`Invalid IngressClass (Spec.Controller) value "%v". Should be "%v"`, k8s.IngressClass.Spec.Controller, k8s.IngressNGINXController)
 			klog.Fatalf("IngressClass with name %v is not valid for ingress-nginx (invalid Spec.Controller)", class.IngressClass)
 		}
+
+		if k8s.IngressClass != nil {
+			// the ConfigMap of the parameters overlays the configuration ConfigMap
+			// and is overlaid by the ones of the flag --configmap-overlays
+			overlay, err := k8s.IngressClassParametersConfigMap(k8s.IngressClass, os.Getenv("POD_NAMESPACE"))
+			if err != nil {
+				klog.Fatalf("IngressClass with name %v is not valid for ingress-nginx: %v", class.IngressClass, err)
+			}
+
+			if overlay != "" {
+				klog.InfoS("Using the parameters of the IngressClass", "class", class.IngressClass, "configmap", overlay)
+				conf.ConfigMapOverlays = append([]string{overlay}, conf.ConfigMapOverlays...)
+			}
+		}
 	}
 
 	conf.Client = kubeClient
+	conf.DynamicClient = dynamicClient
 
 	err = k8s.GetIngressPod(kubeClient)
 	if err != nil {
@@ -153,7 +169,7 @@ func main() {
 
 	mc := metric.NewDummyCollector()
 	if conf.EnableMetrics {
-		mc, err = metric.NewCollector(conf.MetricsPerHost, reg)
+		mc, err = metric.NewCollector(conf.MetricsPerHost, conf.Accounting, reg)
 		if err != nil {
 			klog.Fatalf("Error creating prometheus collector:  %v", err)
 		}
@@ -169,6 +185,10 @@ func main() {
 	mux := http.NewServeMux()
 	registerHealthz(nginx.HealthPath, ngx, mux)
 	registerMetrics(reg, mux)
+	mux.Handle(controller.GlobalRateLimitSyncPath, ngx.GlobalRateLimitSyncHandler())
+	if conf.IntrospectionTokenFile != "" {
+		registerIntrospection(conf.IntrospectionTokenFile, ngx, mux)
+	}
 
 	go startHTTPServer(conf.ListenPorts.Health, mux)
 	go ngx.Start()
@@ -199,7 +219,8 @@ func handleSigterm(ngx *controller.NGINXController, exit exiter) {
 	exit(exitCode)
 }
 
-// createApiserverClient creates a new Kubernetes REST client. apiserverHost is
+// createApiserverClient creates a new Kubernetes REST client, and a dynamic
+// client for the custom resources. apiserverHost is
 // the URL of the API server in the format protocol://address:port/pathPrefix,
 // kubeConfig is the location of a kubeconfig file. If defined, the kubeconfig
 // file is loaded first, the URL of the API server read from the file is then
@@ -207,10 +228,10 @@ func handleSigterm(ngx *controller.NGINXController, exit exiter) {
 // If neither apiserverHost nor kubeConfig is passed in, we assume the
 // controller runs inside Kubernetes and fallback to the in-cluster config. If
 // the in-cluster config is missing or fails, we fallback to the default config.
-func createApiserverClient(apiserverHost, rootCAFile, kubeConfig string) (*kubernetes.Clientset, error) {
+func createApiserverClient(apiserverHost, rootCAFile, kubeConfig string) (*kubernetes.Clientset, dynamic.Interface, error) {
 	cfg, err := clientcmd.BuildConfigFromFlags(apiserverHost, kubeConfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// TODO: remove after k8s v1.22
@@ -242,7 +263,12 @@ func createApiserverClient(apiserverHost, rootCAFile, kubeConfig string) (*kuber
 
 	client, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	var v *discovery.Info
@@ -274,7 +300,7 @@ func createApiserverClient(apiserverHost, rootCAFile, kubeConfig string) (*kuber
 
 	// err is returned in case of timeout in the exponential backoff (ErrWaitTimeout)
 	if err != nil {
-		return nil, lastErr
+		return nil, nil, lastErr
 	}
 
 	// this should not happen, warn the user
@@ -291,7 +317,7 @@ func createApiserverClient(apiserverHost, rootCAFile, kubeConfig string) (*kuber
 		"platform", v.Platform,
 	)
 
-	return client, nil
+	return client, dynamicClient, nil
 }
 
 // Handler for fatal init errors. Prints a verbose error message and exits.
@@ -323,6 +349,18 @@ func registerMetrics(reg *prometheus.Registry, mux *http.ServeMux) {
 	)
 }
 
+func registerIntrospection(tokenFile string, ic *controller.NGINXController, mux *http.ServeMux) {
+	mux.Handle(controller.IntrospectionPath, ic.IntrospectionHandler(tokenFile))
+	mux.Handle(controller.CertificatesIntrospectionPath, ic.CertificatesIntrospectionHandler(tokenFile))
+	mux.Handle(controller.ConfigurationDiffPath, ic.ConfigurationDiffHandler(tokenFile))
+	mux.Handle(controller.ConfigurationDumpPath, ic.ConfigurationDumpHandler(tokenFile))
+	mux.Handle(controller.ConfigurationSnapshotsPath, ic.ConfigurationSnapshotsHandler(tokenFile))
+	mux.Handle(controller.ConfigurationSnapshotsDiffPath, ic.ConfigurationSnapshotsDiffHandler(tokenFile))
+	mux.Handle(controller.ConfigurationRollbackPath, ic.ConfigurationRollbackHandler(tokenFile))
+	mux.Handle(controller.ConfigurationReleasePath, ic.ConfigurationReleaseHandler(tokenFile))
+	mux.Handle(controller.BackendHealthPath, ic.BackendHealthHandler(tokenFile))
+}
+
 func registerProfiler() {
 	mux := http.NewServeMux()
 
@@ -377,3 +415,18 @@ func checkService(key string, kubeClient *kubernetes.Clientset) error {
 
 	return nil
 }
+
+// getIngressClass returns the IngressClass of the controller, converted to
+// networking.k8s.io/v1 in the clusters older than v1.19
+func getIngressClass(kubeClient kubernetes.Interface, name string) (*networking.IngressClass, error) {
+	if k8s.IsIngressV1Ready {
+		return kubeClient.NetworkingV1().IngressClasses().Get(context.TODO(), name, metav1.GetOptions{})
+	}
+
+	ic, err := kubeClient.NetworkingV1beta1().IngressClasses().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return k8s.FromIngressClassV1Beta1(ic), nil
+}
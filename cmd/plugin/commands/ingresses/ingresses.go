@@ -22,7 +22,7 @@ import (
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 
 	"k8s.io/ingress-nginx/cmd/plugin/request"
@@ -155,12 +155,7 @@ func getIngressRows(ingresses *[]networking.Ingress) []ingressRow {
 			}
 		}
 
-		defaultBackendService := ""
-		defaultBackendPort := ""
-		if ing.Spec.Backend != nil {
-			defaultBackendService = ing.Spec.Backend.ServiceName
-			defaultBackendPort = ing.Spec.Backend.ServicePort.String()
-		}
+		defaultBackendService, defaultBackendPort := serviceToNameAndPort(ing.Spec.DefaultBackend)
 
 		// Handle catch-all ingress
 		if len(ing.Spec.Rules) == 0 && len(defaultBackendService) > 0 {
@@ -197,14 +192,15 @@ func getIngressRows(ingresses *[]networking.Ingress) []ingressRow {
 			}
 
 			for _, path := range rule.HTTP.Paths {
+				serviceName, servicePort := serviceToNameAndPort(&path.Backend)
 				row := ingressRow{
 					Namespace:   ing.Namespace,
 					IngressName: ing.Name,
 					Host:        rule.Host,
 					Path:        path.Path,
 					TLS:         hasTLS,
-					ServiceName: path.Backend.ServiceName,
-					ServicePort: path.Backend.ServicePort.String(),
+					ServiceName: serviceName,
+					ServicePort: servicePort,
 					Address:     address,
 				}
 
@@ -215,3 +211,17 @@ func getIngressRows(ingresses *[]networking.Ingress) []ingressRow {
 
 	return rows
 }
+
+// serviceToNameAndPort returns the name and the port of the service of a
+// backend, empty for the backends referencing a resource
+func serviceToNameAndPort(backend *networking.IngressBackend) (string, string) {
+	if backend == nil || backend.Service == nil {
+		return "", ""
+	}
+
+	if backend.Service.Port.Name != "" {
+		return backend.Service.Name, backend.Service.Port.Name
+	}
+
+	return backend.Service.Name, fmt.Sprintf("%d", backend.Service.Port.Number)
+}
@@ -31,6 +31,8 @@ export YAML_CPP_VERSION=yaml-cpp-0.6.3
 export JAEGER_VERSION=0.7.0
 export MSGPACK_VERSION=3.2.1
 export DATADOG_CPP_VERSION=7b560e5c13324c0581476dad3bd8ac4ac5f64045
+export OPENTELEMETRY_CPP_VERSION=1.2.0
+export OPENTELEMETRY_CONTRIB_COMMIT=aaa51e2297bcb34297f3c7aa44fa790497d2f7f3
 export MODSECURITY_VERSION=22e53aba4e3ae8c7d59a3672d6727e49246afe96
 export MODSECURITY_LIB_VERSION=v3.0.4
 export OWASP_MODSECURITY_CRS_VERSION=v3.3.0
@@ -57,6 +59,8 @@ export LUA_RESTY_MEMCACHED_VERSION=0.15
 export LUA_RESTY_REDIS_VERSION=0.29
 export LUA_RESTY_IPMATCHER_VERSION=1a0a1c58fd085b15eedee58de8b5f45c27aff7bc
 export LUA_RESTY_GLOBAL_THROTTLE_VERSION=0.2.0
+export LUA_RESTY_OPENSSL_VERSION=0.7.2
+export LUA_RESTY_JWT_VERSION=0.2.3
 
 export BUILD_PATH=/tmp/build
 
@@ -113,6 +117,8 @@ apk add \
   unzip \
   dos2unix \
   yaml-cpp \
+  grpc-dev \
+  protobuf-dev \
   coreutils
 
 mkdir -p /etc/nginx
@@ -566,6 +572,38 @@ make
 make modules
 make install
 
+# build the OpenTelemetry module, it is built against the NGINX binary installed above
+cd "$BUILD_PATH"
+git clone --depth=1 -b v$OPENTELEMETRY_CPP_VERSION https://github.com/open-telemetry/opentelemetry-cpp
+cd opentelemetry-cpp
+mkdir .build
+cd .build
+
+cmake -DCMAKE_BUILD_TYPE=Release \
+      -DCMAKE_POSITION_INDEPENDENT_CODE:BOOL=true \
+      -DBUILD_TESTING=OFF \
+      -DWITH_EXAMPLES=OFF \
+      -DWITH_OTLP=ON \
+      ..
+
+make
+make install
+
+cd "$BUILD_PATH"
+git clone https://github.com/open-telemetry/opentelemetry-cpp-contrib
+cd opentelemetry-cpp-contrib
+git reset --hard $OPENTELEMETRY_CONTRIB_COMMIT
+cd instrumentation/nginx
+mkdir .build
+cd .build
+
+cmake -DCMAKE_BUILD_TYPE=Release \
+      -DNGINX_BIN=/usr/local/nginx/sbin/nginx \
+      ..
+
+make
+cp otel_ngx_module.so /etc/nginx/modules/otel_ngx_module.so
+
 cd "$BUILD_PATH/lua-resty-core-$LUA_RESTY_CORE"
 make install
 
@@ -615,6 +653,16 @@ INST_LUADIR=/usr/local/lib/lua make install
 cd "$BUILD_PATH/lua-resty-global-throttle-$LUA_RESTY_GLOBAL_THROTTLE_VERSION"
 make install
 
+# required by the auth-jwt annotations
+cd "$BUILD_PATH"
+git clone --depth=1 -b $LUA_RESTY_OPENSSL_VERSION https://github.com/fffonion/lua-resty-openssl
+cd lua-resty-openssl
+make install
+
+cd "$BUILD_PATH"
+git clone --depth=1 -b v$LUA_RESTY_JWT_VERSION https://github.com/cdbattags/lua-resty-jwt
+cp -r lua-resty-jwt/lib/resty/* $LUA_LIB_DIR/resty/
+
 # mimalloc
 cd "$BUILD_PATH"
 git clone --depth=1 -b v1.6.7 https://github.com/microsoft/mimalloc
@@ -22,13 +22,16 @@ import (
 
 	admissionv1 "k8s.io/api/admission/v1"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
-	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/logging"
 )
 
 // Checker must return an error if the ingress provided as argument
@@ -45,6 +48,12 @@ type IngressAdmission struct {
 
 var (
 	ingressResource = metav1.GroupVersionKind{
+		Group:   networking.GroupName,
+		Version: "v1",
+		Kind:    "Ingress",
+	}
+
+	ingressResourceV1Beta1 = metav1.GroupVersionKind{
 		Group:   networking.GroupName,
 		Version: "v1beta1",
 		Kind:    "Ingress",
@@ -70,7 +79,8 @@ func (ia *IngressAdmission) HandleAdmission(obj runtime.Object) (runtime.Object,
 		convertV1beta1AdmissionReviewToAdmissionAdmissionReview(reviewv1beta1, review)
 	}
 
-	if !apiequality.Semantic.DeepEqual(review.Request.Kind, ingressResource) {
+	if !apiequality.Semantic.DeepEqual(review.Request.Kind, ingressResource) &&
+		!apiequality.Semantic.DeepEqual(review.Request.Kind, ingressResourceV1Beta1) {
 		return nil, fmt.Errorf("rejecting admission review because the request does not contain an Ingress resource but %s with name %s in namespace %s",
 			review.Request.Kind.String(), review.Request.Name, review.Request.Namespace)
 	}
@@ -78,15 +88,9 @@ func (ia *IngressAdmission) HandleAdmission(obj runtime.Object) (runtime.Object,
 	status := &admissionv1.AdmissionResponse{}
 	status.UID = review.Request.UID
 
-	ingress := networking.Ingress{}
-
-	codec := json.NewSerializerWithOptions(json.DefaultMetaFactory, scheme, scheme, json.SerializerOptions{
-		Pretty: true,
-	})
-	codec.Decode(review.Request.Object.Raw, nil, nil)
-	_, _, err := codec.Decode(review.Request.Object.Raw, nil, &ingress)
+	ingress, err := decodeIngress(review.Request.Kind, review.Request.Object.Raw)
 	if err != nil {
-		klog.ErrorS(err, "failed to decode ingress")
+		logging.Webhook.ErrorS(err, "failed to decode ingress")
 		status.Allowed = false
 		status.Result = &metav1.Status{
 			Status: metav1.StatusFailure, Code: http.StatusBadRequest, Reason: metav1.StatusReasonBadRequest,
@@ -97,8 +101,8 @@ func (ia *IngressAdmission) HandleAdmission(obj runtime.Object) (runtime.Object,
 		return convertResponse(review, outputVersion), nil
 	}
 
-	if err := ia.Checker.CheckIngress(&ingress); err != nil {
-		klog.ErrorS(err, "invalid ingress configuration", "ingress", fmt.Sprintf("%v/%v", review.Request.Name, review.Request.Namespace))
+	if err := ia.Checker.CheckIngress(ingress); err != nil {
+		logging.Webhook.ErrorS(err, "invalid ingress configuration", "ingress", fmt.Sprintf("%v/%v", review.Request.Name, review.Request.Namespace))
 		status.Allowed = false
 		status.Result = &metav1.Status{
 			Status: metav1.StatusFailure, Code: http.StatusBadRequest, Reason: metav1.StatusReasonBadRequest,
@@ -109,13 +113,37 @@ func (ia *IngressAdmission) HandleAdmission(obj runtime.Object) (runtime.Object,
 		return convertResponse(review, outputVersion), nil
 	}
 
-	klog.InfoS("successfully validated configuration, accepting", "ingress", fmt.Sprintf("%v/%v", review.Request.Name, review.Request.Namespace))
+	logging.Webhook.InfoS("successfully validated configuration, accepting", "ingress", fmt.Sprintf("%v/%v", review.Request.Name, review.Request.Namespace))
 	status.Allowed = true
 	review.Response = status
 
 	return convertResponse(review, outputVersion), nil
 }
 
+// decodeIngress returns the networking.k8s.io/v1 Ingress of an admission
+// request, converting the ones of networking.k8s.io/v1beta1
+func decodeIngress(kind metav1.GroupVersionKind, raw []byte) (*networking.Ingress, error) {
+	codec := json.NewSerializerWithOptions(json.DefaultMetaFactory, scheme, scheme, json.SerializerOptions{
+		Pretty: true,
+	})
+
+	if kind.Version == ingressResourceV1Beta1.Version {
+		ingress := networkingv1beta1.Ingress{}
+		if _, _, err := codec.Decode(raw, nil, &ingress); err != nil {
+			return nil, err
+		}
+
+		return k8s.FromIngressV1Beta1(&ingress), nil
+	}
+
+	ingress := networking.Ingress{}
+	if _, _, err := codec.Decode(raw, nil, &ingress); err != nil {
+		return nil, err
+	}
+
+	return &ingress, nil
+}
+
 func convertResponse(review *admissionv1.AdmissionReview, outputVersion schema.GroupVersion) runtime.Object {
 	// reply v1
 	if outputVersion.Version == admissionv1.SchemeGroupVersion.Version {
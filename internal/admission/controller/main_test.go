@@ -21,7 +21,8 @@ import (
 	"testing"
 
 	admissionv1 "k8s.io/api/admission/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/json"
@@ -71,7 +72,7 @@ func TestHandleAdmission(t *testing.T) {
 
 	result, err = adm.HandleAdmission(&admissionv1.AdmissionReview{
 		Request: &admissionv1.AdmissionRequest{
-			Kind: v1.GroupVersionKind{Group: networking.GroupName, Version: "v1beta1", Kind: "Ingress"},
+			Kind: v1.GroupVersionKind{Group: networking.GroupName, Version: "v1", Kind: "Ingress"},
 			Object: runtime.RawExtension{
 				Raw: []byte{0xff},
 			},
@@ -117,3 +118,34 @@ func TestHandleAdmission(t *testing.T) {
 		t.Fatalf("when the checker returns no error, the request should be allowed")
 	}
 }
+
+func TestHandleAdmissionV1Beta1Ingress(t *testing.T) {
+	adm := &IngressAdmission{
+		Checker: testChecker{t: t},
+	}
+
+	raw, err := json.Marshal(networkingv1beta1.Ingress{
+		ObjectMeta: v1.ObjectMeta{Name: testIngressName},
+		Spec: networkingv1beta1.IngressSpec{
+			Backend: &networkingv1beta1.IngressBackend{ServiceName: "http-svc"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to prepare test ingress data: %v", err.Error())
+	}
+
+	result, err := adm.HandleAdmission(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			Kind:   v1.GroupVersionKind{Group: networking.GroupName, Version: "v1beta1", Kind: "Ingress"},
+			Object: runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	review := result.(*admissionv1.AdmissionReview)
+	if !review.Response.Allowed {
+		t.Fatalf("a networking.k8s.io/v1beta1 Ingress should be allowed, got %v", review.Response.Result)
+	}
+}
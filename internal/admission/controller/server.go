@@ -24,7 +24,8 @@ import (
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
-	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/logging"
 )
 
 var (
@@ -63,7 +64,7 @@ func (acs *AdmissionControllerServer) ServeHTTP(w http.ResponseWriter, req *http
 
 	data, err := ioutil.ReadAll(req.Body)
 	if err != nil {
-		klog.ErrorS(err, "Failed to read request body")
+		logging.Webhook.ErrorS(err, "Failed to read request body")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -74,20 +75,20 @@ func (acs *AdmissionControllerServer) ServeHTTP(w http.ResponseWriter, req *http
 
 	obj, _, err := codec.Decode(data, nil, nil)
 	if err != nil {
-		klog.ErrorS(err, "Failed to decode request body")
+		logging.Webhook.ErrorS(err, "Failed to decode request body")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	result, err := acs.AdmissionController.HandleAdmission(obj)
 	if err != nil {
-		klog.ErrorS(err, "failed to process webhook request")
+		logging.Webhook.ErrorS(err, "failed to process webhook request")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	if err := codec.Encode(result, w); err != nil {
-		klog.ErrorS(err, "failed to encode response body")
+		logging.Webhook.ErrorS(err, "failed to encode response body")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,211 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accesslogfields
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	accessLogFieldsAnnotation = "enable-access-log-fields"
+
+	// TypeString renders the value of the field as a JSON string
+	TypeString = "string"
+	// TypeNumber renders the value of the field as is, for the variables
+	// containing numbers like $status or $request_time
+	TypeNumber = "number"
+)
+
+var (
+	// fieldNameRegex matches the names of the fields of the JSON logs
+	fieldNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*$`)
+	// fieldValueRegex matches the values rendered in the log_format: NGINX
+	// variables and text without quotes or backslashes
+	fieldValueRegex = regexp.MustCompile(`^([^'"\\$\r\n]|\$[a-zA-Z_][a-zA-Z0-9_]*|\$\{[a-zA-Z_][a-zA-Z0-9_]*\})+$`)
+	// variableRegex matches a single NGINX variable
+	variableRegex = regexp.MustCompile(`^\$([a-zA-Z_][a-zA-Z0-9_]*|\{[a-zA-Z_][a-zA-Z0-9_]*\})$`)
+)
+
+// Field is a field of the JSON access logs
+type Field struct {
+	// Name is the key of the field in the JSON object
+	Name string `json:"name"`
+	// Value is the value of the field, usually a NGINX variable
+	Value string `json:"value"`
+	// Type defines how the value is rendered, string or number
+	Type string `json:"type"`
+}
+
+// Config contains the fields added to the access logs of an Ingress
+type Config struct {
+	Fields []Field `json:"fields,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if len(c1.Fields) != len(c2.Fields) {
+		return false
+	}
+
+	for i := range c1.Fields {
+		if c1.Fields[i] != c2.Fields[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseFields parses a JSON object with the fields of the access logs. The
+// value of a field is a string, like "$request_uri", or an object with the
+// value and the type, like {"value": "$status", "type": "number"}. The
+// fields are sorted by name.
+func ParseFields(value string) ([]Field, error) {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, err
+	}
+
+	fields := make([]Field, 0, len(raw))
+	for name, rawField := range raw {
+		field := Field{Name: name, Type: TypeString}
+		if err := json.Unmarshal(rawField, &field.Value); err != nil {
+			if err := json.Unmarshal(rawField, &field); err != nil {
+				return nil, fmt.Errorf("invalid field %q: %v", name, err)
+			}
+			field.Name = name
+			if field.Type == "" {
+				field.Type = TypeString
+			}
+		}
+
+		if err := validate(field); err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields in %q", value)
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+
+	return fields, nil
+}
+
+func validate(field Field) error {
+	if !fieldNameRegex.MatchString(field.Name) {
+		return fmt.Errorf("invalid field name %q", field.Name)
+	}
+
+	switch field.Type {
+	case TypeString:
+		if !fieldValueRegex.MatchString(field.Value) {
+			return fmt.Errorf("invalid value %q of the field %q", field.Value, field.Name)
+		}
+	case TypeNumber:
+		// the value is not quoted, only a variable is allowed
+		if !variableRegex.MatchString(field.Value) {
+			return fmt.Errorf("invalid value %q of the number field %q, a variable is expected", field.Value, field.Name)
+		}
+	default:
+		return fmt.Errorf("invalid type %q of the field %q", field.Type, field.Name)
+	}
+
+	return nil
+}
+
+// Merge returns the fields with the overrides, the overrides replacing the
+// fields with the same name
+func Merge(fields, overrides []Field) []Field {
+	byName := make(map[string]Field, len(fields)+len(overrides))
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+	for _, field := range overrides {
+		byName[field.Name] = field
+	}
+
+	merged := make([]Field, 0, len(byName))
+	for _, field := range byName {
+		merged = append(merged, field)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Name < merged[j].Name
+	})
+
+	return merged
+}
+
+// IsValidEscape returns true if the escaping of the log_format is known
+func IsValidEscape(escape string) bool {
+	switch escape {
+	case "json", "default", "none":
+		return true
+	}
+
+	return false
+}
+
+type accessLogFields struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new access log fields annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return accessLogFields{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the
+// fields added to the JSON access logs of its locations
+func (a accessLogFields) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	value, err := parser.GetStringAnnotation(accessLogFieldsAnnotation, ing)
+	if err != nil {
+		return config, nil
+	}
+
+	config.Fields, err = ParseFields(value)
+	if err != nil {
+		return Config{}, ing_errors.LocationDenied{
+			Reason: fmt.Errorf("invalid %v annotation: %v", accessLogFieldsAnnotation, err),
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package accesslogfields
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	tests := []struct {
+		title    string
+		value    string
+		expected []Field
+		expErr   bool
+	}{
+		{"variables", `{"uri": "$request_uri", "host": "$host"}`, []Field{
+			{Name: "host", Value: "$host", Type: TypeString},
+			{Name: "uri", Value: "$request_uri", Type: TypeString},
+		}, false},
+		{"typed fields", `{"status": {"value": "$status", "type": "number"}, "upstream": {"value": "${proxy_upstream_name}"}}`, []Field{
+			{Name: "status", Value: "$status", Type: TypeNumber},
+			{Name: "upstream", Value: "${proxy_upstream_name}", Type: TypeString},
+		}, false},
+		{"text and variables", `{"request": "$request_method $uri"}`, []Field{
+			{Name: "request", Value: "$request_method $uri", Type: TypeString},
+		}, false},
+		{"invalid JSON", `{"uri": "$request_uri"`, nil, true},
+		{"no fields", `{}`, nil, true},
+		{"invalid name", `{"the uri": "$request_uri"}`, nil, true},
+		{"invalid variable", `{"uri": "$1uri"}`, nil, true},
+		{"quote in the value", `{"uri": "$request_uri'"}`, nil, true},
+		{"number with text", `{"status": {"value": "$status ms", "type": "number"}}`, nil, true},
+		{"unknown type", `{"status": {"value": "$status", "type": "boolean"}}`, nil, true},
+		{"invalid value type", `{"status": 200}`, nil, true},
+	}
+
+	for _, test := range tests {
+		fields, err := ParseFields(test.value)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(fields, test.expected) {
+			t.Errorf("%v: expected %+v but got %+v", test.title, test.expected, fields)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	fields := []Field{
+		{Name: "status", Value: "$status", Type: TypeNumber},
+		{Name: "uri", Value: "$uri", Type: TypeString},
+	}
+	overrides := []Field{
+		{Name: "tenant", Value: "$http_x_tenant", Type: TypeString},
+		{Name: "uri", Value: "$request_uri", Type: TypeString},
+	}
+
+	expected := []Field{
+		{Name: "status", Value: "$status", Type: TypeNumber},
+		{Name: "tenant", Value: "$http_x_tenant", Type: TypeString},
+		{Name: "uri", Value: "$request_uri", Type: TypeString},
+	}
+
+	merged := Merge(fields, overrides)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %+v but got %+v", expected, merged)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	ing := buildIngress()
+
+	config, err := NewParser(&resolver.Mock{}).Parse(ing)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(config, Config{}) {
+		t.Errorf("expected an empty Config but got %+v", config)
+	}
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("enable-access-log-fields"): `{"tenant": "$http_x_tenant"}`,
+	})
+
+	config, err = NewParser(&resolver.Mock{}).Parse(ing)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := Config{Fields: []Field{{Name: "tenant", Value: "$http_x_tenant", Type: TypeString}}}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v but got %+v", expected, config)
+	}
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("enable-access-log-fields"): `{"tenant": "\\"}`,
+	})
+
+	_, err = NewParser(&resolver.Mock{}).Parse(ing)
+	if err == nil {
+		t.Errorf("expected an error but returned nil")
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package adaptiveconcurrency
+
+import (
+	"strconv"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	defaultMinLimit  = 5
+	defaultMaxLimit  = 200
+	defaultTolerance = 1.5
+)
+
+// Config contains the bounds of the concurrency limit adapted to the
+// latency of the backend
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// MinLimit is the lowest number of requests in flight allowed
+	MinLimit int `json:"minLimit"`
+	// MaxLimit is the highest number of requests in flight allowed
+	MaxLimit int `json:"maxLimit"`
+	// Tolerance is the ratio between the current and the baseline latency
+	// of the backend over which the concurrency limit is decreased
+	Tolerance float64 `json:"tolerance"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type adaptiveConcurrency struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new adaptive concurrency annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return adaptiveConcurrency{r}
+}
+
+// Parse parses the annotations contained in the ingress to adapt the
+// number of requests in flight to the latency of the backends
+func (a adaptiveConcurrency) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	enabled, err := parser.GetBoolAnnotation("adaptive-concurrency", ing)
+	if err != nil || !enabled {
+		return config, nil
+	}
+
+	minLimit, err := parser.GetIntAnnotation("adaptive-concurrency-min-limit", ing)
+	if err != nil {
+		minLimit = defaultMinLimit
+	}
+	if minLimit <= 0 {
+		return config, ing_errors.NewInvalidAnnotationContent("adaptive-concurrency-min-limit", minLimit)
+	}
+
+	maxLimit, err := parser.GetIntAnnotation("adaptive-concurrency-max-limit", ing)
+	if err != nil {
+		maxLimit = defaultMaxLimit
+	}
+	if maxLimit < minLimit {
+		return config, ing_errors.NewInvalidAnnotationContent("adaptive-concurrency-max-limit", maxLimit)
+	}
+
+	tolerance := defaultTolerance
+	rawTolerance, err := parser.GetStringAnnotation("adaptive-concurrency-latency-tolerance", ing)
+	if err == nil {
+		tolerance, err = strconv.ParseFloat(rawTolerance, 64)
+		if err != nil || tolerance < 1 {
+			return config, ing_errors.NewInvalidAnnotationContent("adaptive-concurrency-latency-tolerance", rawTolerance)
+		}
+	}
+
+	config.Enabled = true
+	config.MinLimit = minLimit
+	config.MaxLimit = maxLimit
+	config.Tolerance = tolerance
+
+	return config, nil
+}
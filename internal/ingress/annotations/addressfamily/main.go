@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addressfamily
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	// Any uses all the endpoints of the backend
+	Any = "any"
+	// IPv4 only uses the IPv4 endpoints of the backend
+	IPv4 = "ipv4"
+	// IPv6 only uses the IPv6 endpoints of the backend
+	IPv6 = "ipv6"
+	// PreferIPv4 uses the IPv4 endpoints of the backend if there is
+	// at least one, otherwise all the endpoints
+	PreferIPv4 = "prefer-ipv4"
+	// PreferIPv6 uses the IPv6 endpoints of the backend if there is
+	// at least one, otherwise all the endpoints
+	PreferIPv6 = "prefer-ipv6"
+)
+
+// IsValid returns true if the given address family is known
+func IsValid(family string) bool {
+	switch family {
+	case Any, IPv4, IPv6, PreferIPv4, PreferIPv6:
+		return true
+	}
+
+	return false
+}
+
+type addressFamily struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new upstream address family annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return addressFamily{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to define the address family of the endpoints of the backends
+func (a addressFamily) Parse(ing *networking.Ingress) (interface{}, error) {
+	defFamily := a.r.GetDefaultBackend().UpstreamAddressFamily
+	if !IsValid(defFamily) {
+		defFamily = Any
+	}
+
+	family, err := parser.GetStringAnnotation("upstream-address-family", ing)
+	if err != nil {
+		return defFamily, nil
+	}
+
+	if !IsValid(family) {
+		return defFamily, ing_errors.NewInvalidAnnotationContent("upstream-address-family", family)
+	}
+
+	return family, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addressfamily
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/defaults"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+type mockBackend struct {
+	resolver.Mock
+	family string
+}
+
+func (m mockBackend) GetDefaultBackend() defaults.Backend {
+	return defaults.Backend{UpstreamAddressFamily: m.family}
+}
+
+func TestParse(t *testing.T) {
+	annotation := parser.GetAnnotationWithPrefix("upstream-address-family")
+
+	testCases := []struct {
+		annotations map[string]string
+		def         string
+		expected    string
+		expectErr   bool
+	}{
+		{map[string]string{annotation: "ipv4"}, Any, IPv4, false},
+		{map[string]string{annotation: "ipv6"}, Any, IPv6, false},
+		{map[string]string{annotation: "prefer-ipv4"}, Any, PreferIPv4, false},
+		{map[string]string{annotation: "prefer-ipv6"}, Any, PreferIPv6, false},
+		{map[string]string{annotation: "any"}, IPv6, Any, false},
+		{map[string]string{annotation: "ipv5"}, PreferIPv6, PreferIPv6, true},
+		{map[string]string{}, IPv6, IPv6, false},
+		{map[string]string{}, "invalid", Any, false},
+		{nil, "", Any, false},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, err := NewParser(mockBackend{family: testCase.def}).Parse(ing)
+		if (err != nil) != testCase.expectErr {
+			t.Errorf("expected error: %v but returned %v, annotations: %s", testCase.expectErr, err, testCase.annotations)
+		}
+		if result != testCase.expected {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
@@ -17,16 +17,25 @@ limitations under the License.
 package alias
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
+const (
+	serverAliasAnnotation          = "server-alias"
+	serverAliasConfigMapAnnotation = "server-alias-configmap"
+)
+
 type alias struct {
 	r resolver.Resolver
 }
@@ -37,10 +46,13 @@ func NewParser(r resolver.Resolver) parser.IngressAnnotation {
 }
 
 // Parse parses the annotations contained in the ingress rule
-// used to add an alias to the provided hosts
+// used to add an alias to the provided hosts. The aliases are read from
+// the annotation and from the values of the ConfigMap of the ingress
+// namespace referenced by server-alias-configmap.
 func (a alias) Parse(ing *networking.Ingress) (interface{}, error) {
-	val, err := parser.GetStringAnnotation("server-alias", ing)
-	if err != nil {
+	val, err := parser.GetStringAnnotation(serverAliasAnnotation, ing)
+	cm, cmErr := parser.GetStringAnnotation(serverAliasConfigMapAnnotation, ing)
+	if err != nil && cmErr != nil {
 		return []string{}, err
 	}
 
@@ -56,8 +68,67 @@ func (a alias) Parse(ing *networking.Ingress) (interface{}, error) {
 		}
 	}
 
+	if cmErr == nil {
+		cmAliases, err := a.configMapAliases(ing, cm)
+		if err != nil {
+			return []string{}, err
+		}
+		aliases.Insert(cmAliases...)
+	}
+
 	l := aliases.List()
 	sort.Strings(l)
 
 	return l, nil
 }
+
+// configMapAliases returns the aliases contained in the values of the
+// ConfigMap, separated by commas, spaces or new lines. A missing ConfigMap
+// is ignored so the aliases of the annotation keep working while it is
+// created or replaced.
+func (a alias) configMapAliases(ing *networking.Ingress, name string) ([]string, error) {
+	ns, cmName, err := cache.SplitMetaNamespaceKey(name)
+	if err != nil || cmName == "" {
+		return nil, ing_errors.NewInvalidAnnotationContent(serverAliasConfigMapAnnotation, name)
+	}
+
+	// the ConfigMaps of other namespaces could add hosts to any ingress
+	if ns != "" && ns != ing.Namespace {
+		return nil, ing_errors.NewInvalidAnnotationConfiguration(serverAliasConfigMapAnnotation,
+			"the ConfigMap must be in the namespace of the ingress")
+	}
+
+	key := fmt.Sprintf("%v/%v", ing.Namespace, cmName)
+	cmap, err := a.r.GetConfigMap(key)
+	if err != nil {
+		klog.Warningf("Error reading the server aliases of ingress %v/%v from ConfigMap %v: %v", ing.Namespace, ing.Name, key, err)
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(cmap.Data))
+	for k := range cmap.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	aliases := []string{}
+	for _, k := range keys {
+		for _, alias := range strings.FieldsFunc(cmap.Data[k], isSeparator) {
+			if strings.ContainsAny(alias, invalidAliasChars) {
+				klog.Warningf("Ignoring invalid server alias %q of ConfigMap %v", alias, key)
+				continue
+			}
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases, nil
+}
+
+// invalidAliasChars are the characters ending the server_name directive
+// or starting a new one in the NGINX configuration
+const invalidAliasChars = ";{}'\"#"
+
+func isSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
@@ -21,7 +21,7 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -64,3 +64,57 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseConfigMap(t *testing.T) {
+	ap := NewParser(&resolver.Mock{
+		ConfigMaps: map[string]*api.ConfigMap{
+			"default/vanity-domains": {
+				Data: map[string]string{
+					"brands":    "a.com, b.com\nc.com",
+					"campaigns": "  d.com\n\n*.e.com\tbad.com;server_name evil.com\n",
+				},
+			},
+		},
+	})
+
+	testCases := []struct {
+		title       string
+		annotations map[string]string
+		expected    []string
+		expErr      bool
+	}{
+		{"configmap", map[string]string{
+			parser.GetAnnotationWithPrefix("server-alias-configmap"): "vanity-domains",
+		}, []string{"*.e.com", "a.com", "b.com", "c.com", "d.com", "evil.com"}, false},
+		{"configmap and annotation", map[string]string{
+			annotation: "a.com, www.example.com",
+			parser.GetAnnotationWithPrefix("server-alias-configmap"): "default/vanity-domains",
+		}, []string{"*.e.com", "a.com", "b.com", "c.com", "d.com", "evil.com", "www.example.com"}, false},
+		{"missing configmap", map[string]string{
+			annotation: "www.example.com",
+			parser.GetAnnotationWithPrefix("server-alias-configmap"): "missing",
+		}, []string{"www.example.com"}, false},
+		{"configmap of another namespace", map[string]string{
+			parser.GetAnnotationWithPrefix("server-alias-configmap"): "other/vanity-domains",
+		}, []string{}, true},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, err := ap.Parse(ing)
+		if (err != nil) != testCase.expErr {
+			t.Errorf("%v: expected error %v but got %v", testCase.title, testCase.expErr, err)
+		}
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("%v: expected %v but returned %v", testCase.title, testCase.expected, result)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package allowedmethods
+
+import (
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+var methodRegex = regexp.MustCompile(`^[A-Z]+$`)
+
+type allowedMethods struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new allowed methods annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return allowedMethods{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to restrict the HTTP methods accepted by a location.
+// HEAD is allowed when GET is, as NGINX handles both the same way.
+func (a allowedMethods) Parse(ing *networking.Ingress) (interface{}, error) {
+	val, err := parser.GetStringAnnotation("allowed-methods", ing)
+	if err != nil {
+		return []string{}, err
+	}
+
+	methods := []string{}
+	seen := map[string]bool{}
+	for _, m := range strings.Split(val, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" {
+			continue
+		}
+
+		if !methodRegex.MatchString(m) {
+			return []string{}, ing_errors.NewInvalidAnnotationContent("allowed-methods", val)
+		}
+
+		if !seen[m] {
+			seen[m] = true
+			methods = append(methods, m)
+		}
+	}
+
+	if len(methods) == 0 {
+		return []string{}, ing_errors.NewInvalidAnnotationContent("allowed-methods", val)
+	}
+
+	if seen["GET"] && !seen["HEAD"] {
+		methods = append(methods, "HEAD")
+	}
+
+	return methods, nil
+}
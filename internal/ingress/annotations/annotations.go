@@ -17,52 +17,112 @@ limitations under the License.
 package annotations
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/imdario/mergo"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/canary"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/circuitbreaker"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/externalnamesrv"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/modsecurity"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/noendpoints"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/pathpriority"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/proxyssl"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/requestid"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/sslcipher"
 	"k8s.io/klog/v2"
 
 	apiv1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"k8s.io/ingress-nginx/internal/ingress/annotations/accesslogfields"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/adaptiveconcurrency"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/addressfamily"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/alias"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/allowedmethods"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/anonymizeclientip"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/auth"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/authexcludepaths"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/authjwt"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/authreq"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/authreqglobal"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/authtls"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/backendalias"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/backendbandwidth"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/backendprotocol"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/bodyfiltersnippet"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/botdetection"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/clientbodybuffersize"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/connection"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/connectionlimit"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/cors"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/cspnonce"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/customendpoints"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/customhttperrors"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/defaultbackend"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/draintimeout"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/echobackend"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/edgefunction"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/failover"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/fallback"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/fastcgi"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/georouting"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/globalratelimit"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/grpcfallback"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/grpcmetadata"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/healthcheck"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/http2"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/http2pushpreload"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/idempotency"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/inflight"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/influxdb"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/ipwhitelist"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/loadbalancing"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/log"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/maxrequestduration"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/mirror"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/ocspmuststaple"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/openapivalidation"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/opentelemetry"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/opentracing"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/pluginflags"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/portinredirect"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/precompressed"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/preloadlinks"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/proxy"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/proxycache"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/ratelimit"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/ratelimitexemption"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/redirect"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/requestheaders"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/rewrite"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/routeif"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/satisfy"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/secureupstream"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/serversnippet"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/serversnippetowner"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/serviceupstream"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/sessionaffinity"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/setvariables"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/snippet"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/snippetfragments"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/snippetpositions"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/sslpassthrough"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticfiles"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticresponse"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/timewindows"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/trailingslash"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamcompression"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamhashby"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamhostheader"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamkeepalive"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamprefix"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamvhost"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/urinormalization"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/warmup"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/websocketlimit"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/xforwardedprefix"
 	"k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -86,35 +146,190 @@ type Ingress struct {
 	CustomHTTPErrors     []int
 	DefaultBackend       *apiv1.Service
 	//TODO: Change this back into an error when https://github.com/imdario/mergo/issues/100 is resolved
-	FastCGI            fastcgi.Config
-	Denied             *string
-	ExternalAuth       authreq.Config
-	EnableGlobalAuth   bool
-	HTTP2PushPreload   bool
-	Opentracing        opentracing.Config
-	Proxy              proxy.Config
-	ProxySSL           proxyssl.Config
-	RateLimit          ratelimit.Config
-	GlobalRateLimit    globalratelimit.Config
-	Redirect           redirect.Config
-	Rewrite            rewrite.Config
-	Satisfy            string
-	SecureUpstream     secureupstream.Config
-	ServerSnippet      string
-	ServiceUpstream    bool
-	SessionAffinity    sessionaffinity.Config
-	SSLPassthrough     bool
-	UsePortInRedirects bool
-	UpstreamHashBy     upstreamhashby.Config
-	LoadBalancing      string
-	UpstreamVhost      string
-	Whitelist          ipwhitelist.SourceRange
-	XForwardedPrefix   string
-	SSLCipher          sslcipher.Config
-	Logs               log.Config
-	InfluxDB           influxdb.Config
-	ModSecurity        modsecurity.Config
-	Mirror             mirror.Config
+	FastCGI                fastcgi.Config
+	Denied                 *string
+	ExternalAuth           authreq.Config
+	EnableGlobalAuth       bool
+	HTTP2PushPreload       bool
+	Opentelemetry          opentelemetry.Config
+	Opentracing            opentracing.Config
+	Proxy                  proxy.Config
+	ProxySSL               proxyssl.Config
+	RateLimit              ratelimit.Config
+	GlobalRateLimit        globalratelimit.Config
+	RateLimitExemption     ratelimitexemption.Config
+	ConnectionLimit        connectionlimit.Config
+	WebSocketLimit         websocketlimit.Config
+	BackendBandwidth       backendbandwidth.Config
+	Redirect               redirect.Config
+	Rewrite                rewrite.Config
+	Satisfy                string
+	SecureUpstream         secureupstream.Config
+	ServerSnippet          string
+	ServiceUpstream        serviceupstream.Config
+	SessionAffinity        sessionaffinity.Config
+	SSLPassthrough         bool
+	UsePortInRedirects     bool
+	UpstreamHashBy         upstreamhashby.Config
+	LoadBalancing          string
+	UpstreamVhost          string
+	Whitelist              ipwhitelist.SourceRange
+	XForwardedPrefix       string
+	UpstreamPrefix         string
+	SSLCipher              sslcipher.Config
+	Logs                   log.Config
+	InfluxDB               influxdb.Config
+	ModSecurity            modsecurity.Config
+	Mirror                 mirror.Config
+	CSPNonce               cspnonce.Config
+	ProxyCache             proxycache.Config
+	ServerSnippetOwner     bool
+	BackendAlias           string
+	AllowedMethods         []string
+	URINormalizationPolicy string
+	TrailingSlash          trailingslash.Config
+	UpstreamHostHeader     string
+	UpstreamCompression    string
+	GRPCHTTP1Fallback      bool
+	AnonymizeClientIP      bool
+	UpstreamAddressFamily  string
+	OpenAPIValidation      openapivalidation.Config
+	HTTP2                  http2.Config
+	SetVariables           setvariables.Config
+	Fallback               fallback.Config
+	GeoRouting             georouting.Config
+	RouteIf                routeif.Config
+	FailoverEndpoints      []failover.Endpoint
+	CustomEndpoints        []customendpoints.Endpoint
+	GRPCMetadata           grpcmetadata.Config
+	BotDetection           bool
+	MaxInflight            inflight.Config
+	AdaptiveConcurrency    adaptiveconcurrency.Config
+	AllowedTimeWindows     *timewindows.Config
+	WarmUp                 warmup.Config
+	CircuitBreaker         circuitbreaker.Config
+	HealthCheck            healthcheck.Config
+	ExternalNameSRV        bool
+	Precompressed          precompressed.Config
+	PreloadLinks           []string
+	RequestID              requestid.Config
+	AuthJWT                authjwt.Config
+	EchoBackend            echobackend.Config
+	AccessLogFields        accesslogfields.Config
+	StaticFiles            staticfiles.Config
+	StaticResponse         staticresponse.Config
+	SnippetFragments       []string
+	SnippetPositions       snippetpositions.Config
+	UpstreamKeepalive      upstreamkeepalive.Config
+	NoEndpoints            noendpoints.Config
+	PathPriority           int
+	EdgeFunction           string
+	BodyFilterSnippet      string
+	Idempotency            idempotency.Config
+	RequestHeaders         requestheaders.Config
+	OCSPMustStaple         bool
+	DrainTimeout           int
+	MaxRequestDuration     int
+	AuthExcludePaths       []string
+	PluginFlags            map[string]string
+	// Errors contains the errors of the parsers that rejected the value of
+	// their annotations, by annotation key
+	Errors map[string]string
+}
+
+// validatedAnnotations are the parsers run by the admission webhook, the ones
+// with values only validated when the locations are denied at sync time
+var validatedAnnotations = []string{
+	"AccessLogFields",
+	"AdaptiveConcurrency",
+	"AuthExcludePaths",
+	"AuthJWT",
+	"BackendBandwidth",
+	"BodyFilterSnippet",
+	"CircuitBreaker",
+	"ConnectionLimit",
+	"CustomEndpoints",
+	"DrainTimeout",
+	"EchoBackend",
+	"EdgeFunction",
+	"GlobalRateLimit",
+	"HealthCheck",
+	"Idempotency",
+	"MaxInflight",
+	"MaxRequestDuration",
+	"NoEndpoints",
+	"Opentelemetry",
+	"Opentracing",
+	"PluginFlags",
+	"Proxy",
+	"ProxyCache",
+	"RateLimit",
+	"RateLimitExemption",
+	"ServiceUpstream",
+	"StaticResponse",
+	"TrailingSlash",
+	"UpstreamCompression",
+	"UpstreamHostHeader",
+	"UpstreamKeepalive",
+	"UpstreamPrefix",
+	"WarmUp",
+	"WebSocketLimit",
+	"Whitelist",
+}
+
+// intAnnotations are the annotations with an integer value, ignored by their
+// parsers when the value is not a number
+var intAnnotations = []string{
+	"adaptive-concurrency-max-limit",
+	"adaptive-concurrency-min-limit",
+	"auth-tls-verify-depth",
+	"canary-analysis-interval",
+	"canary-analysis-max-error-rate",
+	"canary-analysis-max-latency",
+	"canary-analysis-min-requests",
+	"canary-weight",
+	"circuit-breaker-consecutive-errors",
+	"circuit-breaker-error-rate",
+	"circuit-breaker-min-requests",
+	"cors-max-age",
+	"drain-timeout",
+	"echo-backend-status",
+	"global-rate-limit",
+	"global-rate-limit-burst",
+	"global-rate-limit-delay",
+	"http2-max-concurrent-streams",
+	"limit-backend-bandwidth",
+	"limit-backend-bandwidth-burst",
+	"limit-burst-multiplier",
+	"limit-connections",
+	"limit-connections-per-key",
+	"limit-rate",
+	"limit-rate-after",
+	"limit-rpm",
+	"limit-rps",
+	"limit-upload-rate",
+	"limit-websocket-connections-per-backend",
+	"limit-websocket-connections-per-client",
+	"max-inflight-queue-size",
+	"max-inflight-requests",
+	"max-inflight-retry-after",
+	"max-request-duration",
+	"no-endpoints-retry-after",
+	"path-priority",
+	"proxy-buffers-number",
+	"proxy-connect-timeout",
+	"proxy-next-upstream-timeout",
+	"proxy-next-upstream-tries",
+	"proxy-read-timeout",
+	"proxy-send-timeout",
+	"proxy-ssl-handshake-timeout",
+	"proxy-ssl-verify-depth",
+	"snippet-order",
+	"upstream-hash-by-subset-size",
+	"upstream-keepalive-connections",
+	"upstream-keepalive-requests",
+	"upstream-keepalive-timeout",
+	"warm-up-status",
 }
 
 // Extractor defines the annotation parsers to be used in the extraction of annotations
@@ -126,45 +341,102 @@ type Extractor struct {
 func NewAnnotationExtractor(cfg resolver.Resolver) Extractor {
 	return Extractor{
 		map[string]parser.IngressAnnotation{
-			"Aliases":              alias.NewParser(cfg),
-			"BasicDigestAuth":      auth.NewParser(auth.AuthDirectory, cfg),
-			"Canary":               canary.NewParser(cfg),
-			"CertificateAuth":      authtls.NewParser(cfg),
-			"ClientBodyBufferSize": clientbodybuffersize.NewParser(cfg),
-			"ConfigurationSnippet": snippet.NewParser(cfg),
-			"Connection":           connection.NewParser(cfg),
-			"CorsConfig":           cors.NewParser(cfg),
-			"CustomHTTPErrors":     customhttperrors.NewParser(cfg),
-			"DefaultBackend":       defaultbackend.NewParser(cfg),
-			"FastCGI":              fastcgi.NewParser(cfg),
-			"ExternalAuth":         authreq.NewParser(cfg),
-			"EnableGlobalAuth":     authreqglobal.NewParser(cfg),
-			"HTTP2PushPreload":     http2pushpreload.NewParser(cfg),
-			"Opentracing":          opentracing.NewParser(cfg),
-			"Proxy":                proxy.NewParser(cfg),
-			"ProxySSL":             proxyssl.NewParser(cfg),
-			"RateLimit":            ratelimit.NewParser(cfg),
-			"GlobalRateLimit":      globalratelimit.NewParser(cfg),
-			"Redirect":             redirect.NewParser(cfg),
-			"Rewrite":              rewrite.NewParser(cfg),
-			"Satisfy":              satisfy.NewParser(cfg),
-			"SecureUpstream":       secureupstream.NewParser(cfg),
-			"ServerSnippet":        serversnippet.NewParser(cfg),
-			"ServiceUpstream":      serviceupstream.NewParser(cfg),
-			"SessionAffinity":      sessionaffinity.NewParser(cfg),
-			"SSLPassthrough":       sslpassthrough.NewParser(cfg),
-			"UsePortInRedirects":   portinredirect.NewParser(cfg),
-			"UpstreamHashBy":       upstreamhashby.NewParser(cfg),
-			"LoadBalancing":        loadbalancing.NewParser(cfg),
-			"UpstreamVhost":        upstreamvhost.NewParser(cfg),
-			"Whitelist":            ipwhitelist.NewParser(cfg),
-			"XForwardedPrefix":     xforwardedprefix.NewParser(cfg),
-			"SSLCipher":            sslcipher.NewParser(cfg),
-			"Logs":                 log.NewParser(cfg),
-			"InfluxDB":             influxdb.NewParser(cfg),
-			"BackendProtocol":      backendprotocol.NewParser(cfg),
-			"ModSecurity":          modsecurity.NewParser(cfg),
-			"Mirror":               mirror.NewParser(cfg),
+			"Aliases":                alias.NewParser(cfg),
+			"BasicDigestAuth":        auth.NewParser(auth.AuthDirectory, cfg),
+			"Canary":                 canary.NewParser(cfg),
+			"CertificateAuth":        authtls.NewParser(cfg),
+			"ClientBodyBufferSize":   clientbodybuffersize.NewParser(cfg),
+			"ConfigurationSnippet":   snippet.NewParser(cfg),
+			"Connection":             connection.NewParser(cfg),
+			"CorsConfig":             cors.NewParser(cfg),
+			"CustomHTTPErrors":       customhttperrors.NewParser(cfg),
+			"DefaultBackend":         defaultbackend.NewParser(cfg),
+			"FastCGI":                fastcgi.NewParser(cfg),
+			"ExternalAuth":           authreq.NewParser(cfg),
+			"EnableGlobalAuth":       authreqglobal.NewParser(cfg),
+			"HTTP2PushPreload":       http2pushpreload.NewParser(cfg),
+			"Opentelemetry":          opentelemetry.NewParser(cfg),
+			"Opentracing":            opentracing.NewParser(cfg),
+			"Proxy":                  proxy.NewParser(cfg),
+			"ProxySSL":               proxyssl.NewParser(cfg),
+			"RateLimit":              ratelimit.NewParser(cfg),
+			"GlobalRateLimit":        globalratelimit.NewParser(cfg),
+			"RateLimitExemption":     ratelimitexemption.NewParser(cfg),
+			"ConnectionLimit":        connectionlimit.NewParser(cfg),
+			"WebSocketLimit":         websocketlimit.NewParser(cfg),
+			"BackendBandwidth":       backendbandwidth.NewParser(cfg),
+			"Redirect":               redirect.NewParser(cfg),
+			"Rewrite":                rewrite.NewParser(cfg),
+			"Satisfy":                satisfy.NewParser(cfg),
+			"SecureUpstream":         secureupstream.NewParser(cfg),
+			"ServerSnippet":          serversnippet.NewParser(cfg),
+			"ServiceUpstream":        serviceupstream.NewParser(cfg),
+			"SessionAffinity":        sessionaffinity.NewParser(cfg),
+			"SSLPassthrough":         sslpassthrough.NewParser(cfg),
+			"UsePortInRedirects":     portinredirect.NewParser(cfg),
+			"UpstreamHashBy":         upstreamhashby.NewParser(cfg),
+			"LoadBalancing":          loadbalancing.NewParser(cfg),
+			"UpstreamVhost":          upstreamvhost.NewParser(cfg),
+			"Whitelist":              ipwhitelist.NewParser(cfg),
+			"XForwardedPrefix":       xforwardedprefix.NewParser(cfg),
+			"UpstreamPrefix":         upstreamprefix.NewParser(cfg),
+			"SSLCipher":              sslcipher.NewParser(cfg),
+			"Logs":                   log.NewParser(cfg),
+			"InfluxDB":               influxdb.NewParser(cfg),
+			"BackendProtocol":        backendprotocol.NewParser(cfg),
+			"ModSecurity":            modsecurity.NewParser(cfg),
+			"Mirror":                 mirror.NewParser(cfg),
+			"CSPNonce":               cspnonce.NewParser(cfg),
+			"ProxyCache":             proxycache.NewParser(cfg),
+			"ServerSnippetOwner":     serversnippetowner.NewParser(cfg),
+			"BackendAlias":           backendalias.NewParser(cfg),
+			"AllowedMethods":         allowedmethods.NewParser(cfg),
+			"URINormalizationPolicy": urinormalization.NewParser(cfg),
+			"TrailingSlash":          trailingslash.NewParser(cfg),
+			"UpstreamHostHeader":     upstreamhostheader.NewParser(cfg),
+			"UpstreamCompression":    upstreamcompression.NewParser(cfg),
+			"GRPCHTTP1Fallback":      grpcfallback.NewParser(cfg),
+			"AnonymizeClientIP":      anonymizeclientip.NewParser(cfg),
+			"UpstreamAddressFamily":  addressfamily.NewParser(cfg),
+			"OpenAPIValidation":      openapivalidation.NewParser(cfg),
+			"HTTP2":                  http2.NewParser(cfg),
+			"SetVariables":           setvariables.NewParser(cfg),
+			"Fallback":               fallback.NewParser(cfg),
+			"GeoRouting":             georouting.NewParser(cfg),
+			"RouteIf":                routeif.NewParser(cfg),
+			"FailoverEndpoints":      failover.NewParser(cfg),
+			"CustomEndpoints":        customendpoints.NewParser(cfg),
+			"GRPCMetadata":           grpcmetadata.NewParser(cfg),
+			"BotDetection":           botdetection.NewParser(cfg),
+			"MaxInflight":            inflight.NewParser(cfg),
+			"AdaptiveConcurrency":    adaptiveconcurrency.NewParser(cfg),
+			"AllowedTimeWindows":     timewindows.NewParser(cfg),
+			"WarmUp":                 warmup.NewParser(cfg),
+			"CircuitBreaker":         circuitbreaker.NewParser(cfg),
+			"HealthCheck":            healthcheck.NewParser(cfg),
+			"ExternalNameSRV":        externalnamesrv.NewParser(cfg),
+			"Precompressed":          precompressed.NewParser(cfg),
+			"PreloadLinks":           preloadlinks.NewParser(cfg),
+			"RequestID":              requestid.NewParser(cfg),
+			"AuthJWT":                authjwt.NewParser(cfg),
+			"EchoBackend":            echobackend.NewParser(cfg),
+			"AccessLogFields":        accesslogfields.NewParser(cfg),
+			"StaticFiles":            staticfiles.NewParser(cfg),
+			"StaticResponse":         staticresponse.NewParser(cfg),
+			"SnippetFragments":       snippetfragments.NewParser(cfg),
+			"SnippetPositions":       snippetpositions.NewParser(cfg),
+			"UpstreamKeepalive":      upstreamkeepalive.NewParser(cfg),
+			"NoEndpoints":            noendpoints.NewParser(cfg),
+			"PathPriority":           pathpriority.NewParser(cfg),
+			"EdgeFunction":           edgefunction.NewParser(cfg),
+			"BodyFilterSnippet":      bodyfiltersnippet.NewParser(cfg),
+			"Idempotency":            idempotency.NewParser(cfg),
+			"RequestHeaders":         requestheaders.NewParser(cfg),
+			"OCSPMustStaple":         ocspmuststaple.NewParser(cfg),
+			"DrainTimeout":           draintimeout.NewParser(cfg),
+			"MaxRequestDuration":     maxrequestduration.NewParser(cfg),
+			"AuthExcludePaths":       authexcludepaths.NewParser(cfg),
+			"PluginFlags":            pluginflags.NewParser(cfg),
 		},
 	}
 }
@@ -176,6 +448,16 @@ func (e Extractor) Extract(ing *networking.Ingress) *Ingress {
 	}
 
 	data := make(map[string]interface{})
+	parseErrors := make(map[string]string)
+
+	ing, err := parser.MergeConfigAnnotation(ing)
+	if err != nil {
+		errString := err.Error()
+		data[DeniedKeyName] = &errString
+		parseErrors[parser.GetAnnotationWithPrefix(parser.ConfigAnnotation)] = errString
+		klog.ErrorS(err, "error reading Ingress annotation", "name", parser.ConfigAnnotation, "ingress", klog.KObj(ing))
+	}
+
 	for name, annotationParser := range e.annotations {
 		val, err := annotationParser.Parse(ing)
 		klog.V(5).InfoS("Parsing Ingress annotation", "name", name, "ingress", klog.KObj(ing), "value", val)
@@ -184,6 +466,8 @@ func (e Extractor) Extract(ing *networking.Ingress) *Ingress {
 				continue
 			}
 
+			parseErrors[rejectedAnnotation(ing, name, err)] = err.Error()
+
 			if !errors.IsLocationDenied(err) {
 				continue
 			}
@@ -212,10 +496,78 @@ func (e Extractor) Extract(ing *networking.Ingress) *Ingress {
 		}
 	}
 
-	err := mergo.MapWithOverwrite(pia, data)
+	err = mergo.MapWithOverwrite(pia, data)
 	if err != nil {
 		klog.ErrorS(err, "unexpected error merging extracted annotations")
 	}
 
+	if len(parseErrors) > 0 {
+		pia.Errors = parseErrors
+	}
+
 	return pia
 }
+
+// rejectedAnnotation returns the key of the annotation of the ingress with
+// the value rejected by the parser name: the annotation named by the error
+// or, for the errors not naming it, the longest annotation of the ingress
+// mentioned by the error message. The parser name is returned when no
+// annotation is found.
+func rejectedAnnotation(ing *networking.Ingress, name string, err error) string {
+	if annotation := errors.AnnotationName(err); annotation != "" {
+		return parser.GetAnnotationWithPrefix(annotation)
+	}
+
+	prefix := parser.GetAnnotationWithPrefix("")
+	keys := make([]string, 0, len(ing.GetAnnotations()))
+	for key := range ing.GetAnnotations() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	message := err.Error()
+	rejected := ""
+	for _, key := range keys {
+		if len(key) > len(rejected) && strings.Contains(message, strings.TrimPrefix(key, prefix)) {
+			rejected = key
+		}
+	}
+
+	if rejected == "" {
+		return name
+	}
+
+	return rejected
+}
+
+// Validate returns an error when the integer annotations of the ingress are
+// not numbers or when the rate limit and duration annotations are invalid,
+// to reject the ingress in the admission webhook instead of denying its
+// locations at sync time
+func (e Extractor) Validate(ing *networking.Ingress) error {
+	ing, err := parser.MergeConfigAnnotation(ing)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range intAnnotations {
+		if _, err := parser.GetIntAnnotation(name, ing); errors.IsInvalidContent(err) {
+			return errors.Errorf("%v, an integer is expected", err)
+		}
+	}
+
+	for _, name := range validatedAnnotations {
+		annotationParser, ok := e.annotations[name]
+		if !ok {
+			continue
+		}
+
+		if _, err := annotationParser.Parse(ing); err != nil && !errors.IsMissingAnnotations(err) {
+			return errors.Errorf("invalid annotations: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -20,9 +20,8 @@ import (
 	"testing"
 
 	apiv1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/defaults"
@@ -76,8 +75,12 @@ func (m mockCfg) GetAuthCertificate(name string) (*resolver.AuthSSLCert, error)
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -86,9 +89,13 @@ func buildIngress() *networking.Ingress {
 			Namespace: apiv1.NamespaceDefault,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -236,6 +243,73 @@ func TestCors(t *testing.T) {
 
 	}
 }
+func TestConfigAnnotation(t *testing.T) {
+	ec := NewAnnotationExtractor(mockCfg{})
+	ing := buildIngress()
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("config"):                 "enable-cors: true\ncors-allow-credentials: true",
+		parser.GetAnnotationWithPrefix("cors-allow-credentials"): "false",
+	})
+
+	r := ec.Extract(ing)
+	if !r.CorsConfig.CorsEnabled {
+		t.Errorf("expected CORS to be enabled by the config annotation")
+	}
+	if r.CorsConfig.CorsAllowCredentials {
+		t.Errorf("expected the individual annotation to take precedence over the config annotation")
+	}
+	if r.Denied != nil {
+		t.Errorf("expected the locations to be allowed but got %v", *r.Denied)
+	}
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("config"): "enable-cors: {}",
+	})
+
+	r = ec.Extract(ing)
+	if r.Denied == nil {
+		t.Errorf("expected the locations to be denied with an invalid config annotation")
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	ec := NewAnnotationExtractor(mockCfg{})
+	ing := buildIngress()
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("enable-cors"): "true",
+	})
+
+	r := ec.Extract(ing)
+	if r.Errors != nil {
+		t.Errorf("expected no errors but got %v", r.Errors)
+	}
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("max-request-duration"): "-1",
+		parser.GetAnnotationWithPrefix("auth-exclude-paths"):   "healthz",
+	})
+
+	r = ec.Extract(ing)
+	for _, annotation := range []string{"max-request-duration", "auth-exclude-paths"} {
+		if _, ok := r.Errors[parser.GetAnnotationWithPrefix(annotation)]; !ok {
+			t.Errorf("expected an error of the annotation %v but got %v", annotation, r.Errors)
+		}
+	}
+
+	// the errors of the denied locations do not name the annotation
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("global-rate-limit"):        "10",
+		parser.GetAnnotationWithPrefix("global-rate-limit-window"): "1 minute",
+	})
+
+	r = ec.Extract(ing)
+	if _, ok := r.Errors[parser.GetAnnotationWithPrefix("global-rate-limit-window")]; !ok {
+		t.Errorf("expected an error of the annotation global-rate-limit-window but got %v", r.Errors)
+	}
+}
+
 func TestCustomHTTPErrors(t *testing.T) {
 	ec := NewAnnotationExtractor(mockCfg{})
 	ing := buildIngress()
@@ -316,3 +390,54 @@ func TestMergeLocationAnnotations(t *testing.T) {
 	}
 }
 */
+
+func TestValidate(t *testing.T) {
+	ec := NewAnnotationExtractor(mockCfg{})
+
+	testCases := map[string]struct {
+		annotations map[string]string
+		expectError bool
+	}{
+		"without annotations": {map[string]string{}, false},
+		"with valid rate limits": {map[string]string{
+			parser.GetAnnotationWithPrefix("limit-rps"):                "10",
+			parser.GetAnnotationWithPrefix("global-rate-limit"):        "100",
+			parser.GetAnnotationWithPrefix("global-rate-limit-window"): "1m",
+		}, false},
+		"with a malformed integer": {map[string]string{
+			parser.GetAnnotationWithPrefix("limit-rps"): "ten",
+		}, true},
+		"with a malformed duration": {map[string]string{
+			parser.GetAnnotationWithPrefix("global-rate-limit"):        "100",
+			parser.GetAnnotationWithPrefix("global-rate-limit-window"): "1 minute",
+		}, true},
+		"with an invalid circuit breaker cooldown": {map[string]string{
+			parser.GetAnnotationWithPrefix("circuit-breaker-consecutive-errors"): "5",
+			parser.GetAnnotationWithPrefix("circuit-breaker-cooldown"):           "10ms",
+		}, true},
+		"with a mixed IPv4 and IPv6 whitelist": {map[string]string{
+			parser.GetAnnotationWithPrefix("whitelist-source-range"): "10.0.0.0/8, 2001:db8::/32, ::1",
+		}, false},
+		"with a malformed IPv6 network in the whitelist": {map[string]string{
+			parser.GetAnnotationWithPrefix("whitelist-source-range"): "10.0.0.0/8,2001:db8::/129",
+		}, true},
+		"with a malformed integer in the config annotation": {map[string]string{
+			parser.GetAnnotationWithPrefix("config"): "proxy-read-timeout: 1m",
+		}, true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ing := buildIngress()
+			ing.SetAnnotations(tc.annotations)
+
+			err := ec.Validate(ing)
+			if tc.expectError && err == nil {
+				t.Errorf("expected an error but none returned")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authexcludepaths
+
+import (
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const authExcludePathsAnnotation = "auth-exclude-paths"
+
+// pathRegex matches an absolute path without the characters interpreted
+// in the NGINX configuration, like quotes, variables or spaces
+var pathRegex = regexp.MustCompile(`^(/[A-Za-z0-9._~%@:+-]+)+/?$`)
+
+type authExcludePaths struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new auth exclude paths annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return authExcludePaths{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the
+// paths, and the paths below them, that skip the basic and the external
+// authentication of the locations
+func (a authExcludePaths) Parse(ing *networking.Ingress) (interface{}, error) {
+	val, err := parser.GetStringAnnotation(authExcludePathsAnnotation, ing)
+	if err != nil {
+		return []string{}, err
+	}
+
+	paths := []string{}
+	for _, path := range strings.Split(val, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		if !pathRegex.MatchString(path) {
+			return []string{}, ing_errors.NewInvalidAnnotationContent(authExcludePathsAnnotation, val)
+		}
+
+		paths = append(paths, strings.TrimSuffix(path, "/"))
+	}
+
+	if len(paths) == 0 {
+		return []string{}, ing_errors.NewInvalidAnnotationContent(authExcludePathsAnnotation, val)
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authexcludepaths
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		expected    []string
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, []string{}, true},
+		{"paths", map[string]string{"auth-exclude-paths": "/healthz, /metrics"}, []string{"/healthz", "/metrics"}, false},
+		{"trailing slash", map[string]string{"auth-exclude-paths": "/api/v1/status/"}, []string{"/api/v1/status"}, false},
+		{"empty paths", map[string]string{"auth-exclude-paths": " , "}, []string{}, true},
+		{"relative path", map[string]string{"auth-exclude-paths": "healthz"}, []string{}, true},
+		{"root path", map[string]string{"auth-exclude-paths": "/"}, []string{}, true},
+		{"regular expression", map[string]string{"auth-exclude-paths": "/health.*"}, []string{}, true},
+		{"variable", map[string]string{"auth-exclude-paths": "/$uri"}, []string{}, true},
+		{"quote", map[string]string{"auth-exclude-paths": `/healthz"`}, []string{}, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+		}
+
+		if !reflect.DeepEqual(i, test.expected) {
+			t.Errorf("%v: expected %v but got %v", test.title, test.expected, i)
+		}
+	}
+}
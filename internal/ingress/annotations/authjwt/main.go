@@ -0,0 +1,196 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authjwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	jwksURLAnnotation        = "auth-jwt-jwks-url"
+	issuerAnnotation         = "auth-jwt-issuer"
+	audienceAnnotation       = "auth-jwt-audience"
+	requiredClaimsAnnotation = "auth-jwt-required-claims"
+	claimHeadersAnnotation   = "auth-jwt-claim-headers"
+)
+
+var (
+	claimNameRegex  = regexp.MustCompile(`^[a-zA-Z0-9_:.-]+$`)
+	headerNameRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+	// the values are rendered as Lua strings
+	valueRegex = regexp.MustCompile(`^[^"\\\x00-\x1f\x7f-\x{10ffff}]+$`)
+)
+
+// Claim is a claim the tokens must contain with the given value, or with
+// any value when the value is empty
+type Claim struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ClaimHeader is a header sent to the backend with the value of a claim
+type ClaimHeader struct {
+	Header string `json:"header"`
+	Claim  string `json:"claim"`
+}
+
+// Config contains the settings used to validate the JSON Web Tokens of the
+// requests without an external authentication service
+type Config struct {
+	// JWKSURL is the URL of the JSON Web Key Set with the public keys used
+	// to verify the signature of the tokens
+	JWKSURL        string        `json:"jwksURL,omitempty"`
+	Issuer         string        `json:"issuer,omitempty"`
+	Audiences      []string      `json:"audiences,omitempty"`
+	RequiredClaims []Claim       `json:"requiredClaims,omitempty"`
+	ClaimHeaders   []ClaimHeader `json:"claimHeaders,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if c1.JWKSURL != c2.JWKSURL || c1.Issuer != c2.Issuer {
+		return false
+	}
+	if len(c1.Audiences) != len(c2.Audiences) ||
+		len(c1.RequiredClaims) != len(c2.RequiredClaims) ||
+		len(c1.ClaimHeaders) != len(c2.ClaimHeaders) {
+		return false
+	}
+
+	for i := range c1.Audiences {
+		if c1.Audiences[i] != c2.Audiences[i] {
+			return false
+		}
+	}
+	for i := range c1.RequiredClaims {
+		if c1.RequiredClaims[i] != c2.RequiredClaims[i] {
+			return false
+		}
+	}
+	for i := range c1.ClaimHeaders {
+		if c1.ClaimHeaders[i] != c2.ClaimHeaders[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type authJWT struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new JWT authentication annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return authJWT{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to validate the JSON Web Tokens of the requests
+func (a authJWT) Parse(ing *networking.Ingress) (interface{}, error) {
+	jwksURL, err := parser.GetStringAnnotation(jwksURLAnnotation, ing)
+	if err != nil {
+		return &Config{}, err
+	}
+
+	u, err := parser.StringToURL(jwksURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !valueRegex.MatchString(jwksURL) {
+		return &Config{}, ing_errors.NewLocationDenied(fmt.Sprintf("invalid %v value %q", jwksURLAnnotation, jwksURL))
+	}
+
+	config := &Config{JWKSURL: jwksURL}
+
+	issuer, err := parser.GetStringAnnotation(issuerAnnotation, ing)
+	if err == nil {
+		if !valueRegex.MatchString(issuer) {
+			return &Config{}, ing_errors.NewLocationDenied(fmt.Sprintf("invalid %v value %q", issuerAnnotation, issuer))
+		}
+		config.Issuer = issuer
+	}
+
+	audience, err := parser.GetStringAnnotation(audienceAnnotation, ing)
+	if err == nil {
+		for _, aud := range strings.Split(audience, ",") {
+			aud = strings.TrimSpace(aud)
+			if !valueRegex.MatchString(aud) {
+				return &Config{}, ing_errors.NewLocationDenied(fmt.Sprintf("invalid audience %q in %v", aud, audienceAnnotation))
+			}
+			config.Audiences = append(config.Audiences, aud)
+		}
+	}
+
+	requiredClaims, err := parseMap(requiredClaimsAnnotation, ing)
+	if err != nil {
+		return &Config{}, err
+	}
+	for name, value := range requiredClaims {
+		if !claimNameRegex.MatchString(name) || (value != "" && !valueRegex.MatchString(value)) {
+			return &Config{}, ing_errors.NewLocationDenied(fmt.Sprintf("invalid claim %q in %v", name, requiredClaimsAnnotation))
+		}
+		config.RequiredClaims = append(config.RequiredClaims, Claim{Name: name, Value: value})
+	}
+	sort.Slice(config.RequiredClaims, func(i, j int) bool {
+		return config.RequiredClaims[i].Name < config.RequiredClaims[j].Name
+	})
+
+	claimHeaders, err := parseMap(claimHeadersAnnotation, ing)
+	if err != nil {
+		return &Config{}, err
+	}
+	for header, claim := range claimHeaders {
+		if !headerNameRegex.MatchString(header) || !claimNameRegex.MatchString(claim) {
+			return &Config{}, ing_errors.NewLocationDenied(fmt.Sprintf("invalid header %q in %v", header, claimHeadersAnnotation))
+		}
+		config.ClaimHeaders = append(config.ClaimHeaders, ClaimHeader{Header: header, Claim: claim})
+	}
+	sort.Slice(config.ClaimHeaders, func(i, j int) bool {
+		return config.ClaimHeaders[i].Header < config.ClaimHeaders[j].Header
+	})
+
+	return config, nil
+}
+
+// parseMap returns the JSON object of string values of the annotation
+func parseMap(name string, ing *networking.Ingress) (map[string]string, error) {
+	val, err := parser.GetStringAnnotation(name, ing)
+	if err != nil {
+		return nil, nil
+	}
+
+	values := map[string]string{}
+	if err := json.Unmarshal([]byte(val), &values); err != nil {
+		return nil, ing_errors.NewLocationDenied(fmt.Sprintf("invalid %v value, a JSON object of strings is expected", name))
+	}
+
+	return values, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authjwt
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	jwksURL := parser.GetAnnotationWithPrefix("auth-jwt-jwks-url")
+	issuer := parser.GetAnnotationWithPrefix("auth-jwt-issuer")
+	audience := parser.GetAnnotationWithPrefix("auth-jwt-audience")
+	requiredClaims := parser.GetAnnotationWithPrefix("auth-jwt-required-claims")
+	claimHeaders := parser.GetAnnotationWithPrefix("auth-jwt-claim-headers")
+
+	url := "https://example.com/.well-known/jwks.json"
+
+	testCases := map[string]struct {
+		annotations map[string]string
+		expected    *Config
+		expectErr   bool
+	}{
+		"without annotations":    {nil, &Config{}, true},
+		"with only the JWKS URL": {map[string]string{jwksURL: url}, &Config{JWKSURL: url}, false},
+		"with all the annotations": {map[string]string{
+			jwksURL:        url,
+			issuer:         "https://example.com/",
+			audience:       "orders, payments",
+			requiredClaims: `{"sub": "", "email_verified": "true"}`,
+			claimHeaders:   `{"X-User-ID": "sub", "X-Email": "email"}`,
+		}, &Config{
+			JWKSURL:        url,
+			Issuer:         "https://example.com/",
+			Audiences:      []string{"orders", "payments"},
+			RequiredClaims: []Claim{{"email_verified", "true"}, {"sub", ""}},
+			ClaimHeaders:   []ClaimHeader{{"X-Email", "email"}, {"X-User-ID", "sub"}},
+		}, false},
+		"with an invalid JWKS URL":       {map[string]string{jwksURL: "ftp://example.com/jwks"}, &Config{}, true},
+		"with a quote in the JWKS URL":   {map[string]string{jwksURL: `https://example.com/"jwks`}, &Config{}, true},
+		"with an invalid issuer":         {map[string]string{jwksURL: url, issuer: `a"b`}, &Config{}, true},
+		"with an empty audience":         {map[string]string{jwksURL: url, audience: "orders,"}, &Config{}, true},
+		"with invalid required claims":   {map[string]string{jwksURL: url, requiredClaims: `["sub"]`}, &Config{}, true},
+		"with an invalid claim name":     {map[string]string{jwksURL: url, requiredClaims: `{"sub ject": ""}`}, &Config{}, true},
+		"with an invalid header":         {map[string]string{jwksURL: url, claimHeaders: `{"X-User ID": "sub"}`}, &Config{}, true},
+		"with an invalid header's claim": {map[string]string{jwksURL: url, claimHeaders: `{"X-User-ID": ""}`}, &Config{}, true},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ing.SetAnnotations(tc.annotations)
+			result, err := NewParser(&resolver.Mock{}).Parse(ing)
+			if (err != nil) != tc.expectErr {
+				t.Errorf("expected error: %v but returned %v", tc.expectErr, err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("expected %v but returned %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	c1 := &Config{JWKSURL: "https://example.com/jwks", ClaimHeaders: []ClaimHeader{{"X-User-ID", "sub"}}}
+	c2 := &Config{JWKSURL: "https://example.com/jwks", ClaimHeaders: []ClaimHeader{{"X-User-ID", "sub"}}}
+	if !c1.Equal(c2) {
+		t.Errorf("expected the configurations to be equal")
+	}
+
+	c2.ClaimHeaders[0].Claim = "email"
+	if c1.Equal(c2) {
+		t.Errorf("expected the configurations to be different")
+	}
+}
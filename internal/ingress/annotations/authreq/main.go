@@ -23,7 +23,7 @@ import (
 
 	"k8s.io/klog/v2"
 
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
@@ -164,7 +164,7 @@ func (a authReq) Parse(ing *networking.Ingress) (interface{}, error) {
 
 	authURL, err := parser.StringToURL(urlString)
 	if err != nil {
-		return nil, ing_errors.InvalidContent{Name: err.Error()}
+		return nil, ing_errors.InvalidContent{Name: err.Error(), Annotation: "auth-url"}
 	}
 
 	authMethod, _ := parser.GetStringAnnotation("auth-method", ing)
@@ -18,7 +18,7 @@ package authtls
 
 import (
 	"github.com/pkg/errors"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 
 	"regexp"
 
@@ -31,10 +31,18 @@ import (
 const (
 	defaultAuthTLSDepth     = 1
 	defaultAuthVerifyClient = "on"
+
+	// PassCertFormatPEM passes the URL encoded PEM certificate in the ssl-client-cert header
+	PassCertFormatPEM = "pem"
+	// PassCertFormatDER passes the base64 encoded DER certificate in the ssl-client-cert header
+	PassCertFormatDER = "der"
+	// PassCertFormatXFCC passes the certificate in the X-Forwarded-Client-Cert header used by Envoy
+	PassCertFormatXFCC = "xfcc"
 )
 
 var (
 	authVerifyClientRegex = regexp.MustCompile(`on|off|optional|optional_no_ca`)
+	passCertFormatRegex   = regexp.MustCompile(`^(pem|der|xfcc)$`)
 )
 
 // Config contains the AuthSSLCert used for mutual authentication
@@ -45,6 +53,7 @@ type Config struct {
 	ValidationDepth    int    `json:"validationDepth"`
 	ErrorPage          string `json:"errorPage"`
 	PassCertToUpstream bool   `json:"passCertToUpstream"`
+	PassCertFormat     string `json:"passCertFormat"`
 	AuthTLSError       string
 }
 
@@ -71,6 +80,9 @@ func (assl1 *Config) Equal(assl2 *Config) bool {
 	if assl1.PassCertToUpstream != assl2.PassCertToUpstream {
 		return false
 	}
+	if assl1.PassCertFormat != assl2.PassCertFormat {
+		return false
+	}
 
 	return true
 }
@@ -127,5 +139,16 @@ func (a authTLS) Parse(ing *networking.Ingress) (interface{}, error) {
 		config.PassCertToUpstream = false
 	}
 
+	config.PassCertFormat, err = parser.GetStringAnnotation("auth-tls-pass-certificate-format", ing)
+	if err != nil {
+		config.PassCertFormat = PassCertFormatPEM
+	} else if !passCertFormatRegex.MatchString(config.PassCertFormat) {
+		// the location is denied rather than served without the
+		// authentication or with another format of the certificate
+		return config, ing_errors.LocationDenied{
+			Reason: ing_errors.NewInvalidAnnotationContent("auth-tls-pass-certificate-format", config.PassCertFormat),
+		}
+	}
+
 	return config, nil
 }
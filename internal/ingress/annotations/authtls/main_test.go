@@ -20,9 +20,8 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -30,8 +29,12 @@ import (
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -40,9 +43,13 @@ func buildIngress() *networking.Ingress {
 			Namespace: api.NamespaceDefault,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -91,6 +98,7 @@ func TestAnnotations(t *testing.T) {
 	data[parser.GetAnnotationWithPrefix("auth-tls-verify-depth")] = "1"
 	data[parser.GetAnnotationWithPrefix("auth-tls-error-page")] = "ok.com/error"
 	data[parser.GetAnnotationWithPrefix("auth-tls-pass-certificate-to-upstream")] = "true"
+	data[parser.GetAnnotationWithPrefix("auth-tls-pass-certificate-format")] = "xfcc"
 
 	ing.SetAnnotations(data)
 
@@ -125,6 +133,9 @@ func TestAnnotations(t *testing.T) {
 	if u.PassCertToUpstream != true {
 		t.Errorf("expected %v but got %v", true, u.PassCertToUpstream)
 	}
+	if u.PassCertFormat != PassCertFormatXFCC {
+		t.Errorf("expected %v but got %v", PassCertFormatXFCC, u.PassCertFormat)
+	}
 }
 
 func TestInvalidAnnotations(t *testing.T) {
@@ -159,6 +170,7 @@ func TestInvalidAnnotations(t *testing.T) {
 	data[parser.GetAnnotationWithPrefix("auth-tls-verify-client")] = "w00t"
 	data[parser.GetAnnotationWithPrefix("auth-tls-verify-depth")] = "abcd"
 	data[parser.GetAnnotationWithPrefix("auth-tls-pass-certificate-to-upstream")] = "nahh"
+	delete(data, parser.GetAnnotationWithPrefix("auth-tls-pass-certificate-format"))
 	ing.SetAnnotations(data)
 
 	i, err := NewParser(fakeSecret).Parse(ing)
@@ -179,7 +191,21 @@ func TestInvalidAnnotations(t *testing.T) {
 	if u.PassCertToUpstream != false {
 		t.Errorf("expected %v but got %v", false, u.PassCertToUpstream)
 	}
+	if u.PassCertFormat != PassCertFormatPEM {
+		t.Errorf("expected %v but got %v", PassCertFormatPEM, u.PassCertFormat)
+	}
+
+	// Invalid certificate format
+	data[parser.GetAnnotationWithPrefix("auth-tls-pass-certificate-format")] = "xfc"
+	ing.SetAnnotations(data)
 
+	_, err = NewParser(fakeSecret).Parse(ing)
+	if !errors.IsLocationDenied(err) {
+		t.Errorf("expected the location to be denied but got %v", err)
+	}
+	if !errors.IsInvalidContent(err.(errors.LocationDenied).Reason) {
+		t.Errorf("expected an invalid content error but got %v", err)
+	}
 }
 
 func TestEquals(t *testing.T) {
@@ -253,6 +279,15 @@ func TestEquals(t *testing.T) {
 	}
 	cfg2.PassCertToUpstream = true
 
+	// Different Pass Certificate Format
+	cfg1.PassCertFormat = PassCertFormatPEM
+	cfg2.PassCertFormat = PassCertFormatDER
+	result = cfg1.Equal(cfg2)
+	if result != false {
+		t.Errorf("Expected false")
+	}
+	cfg2.PassCertFormat = PassCertFormatPEM
+
 	// Equal Configs
 	result = cfg1.Equal(cfg2)
 	if result != true {
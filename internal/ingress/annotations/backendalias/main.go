@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backendalias
+
+import (
+	"regexp"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+var aliasRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:/\-]*$`)
+
+type backendAlias struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new backend alias annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return backendAlias{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to set an explicit name for the backend in logs and metrics
+func (a backendAlias) Parse(ing *networking.Ingress) (interface{}, error) {
+	alias, err := parser.GetStringAnnotation("backend-alias", ing)
+	if err != nil {
+		return "", err
+	}
+
+	if !aliasRegex.MatchString(alias) {
+		return "", ing_errors.NewInvalidAnnotationContent("backend-alias", alias)
+	}
+
+	return alias, nil
+}
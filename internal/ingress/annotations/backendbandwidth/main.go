@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backendbandwidth
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	rateAnnotation  = "limit-backend-bandwidth"
+	burstAnnotation = "limit-backend-bandwidth-burst"
+)
+
+// Config contains the cap of the aggregate bandwidth of the responses of
+// the backend of the locations, shared by all the requests to the backend
+type Config struct {
+	// Rate is the number of kilobytes per second the backend can send, zero
+	// disables the limit
+	Rate int `json:"rate"`
+	// Burst is the number of kilobytes the backend can send over the rate
+	// after being idle
+	Burst int `json:"burst"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type backendbandwidth struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new backend bandwidth annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return backendbandwidth{r}
+}
+
+// Parse parses the annotations contained in the ingress to cap the
+// aggregate bandwidth of the responses of the backend
+func (a backendbandwidth) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	rate, err := parser.GetIntAnnotation(rateAnnotation, ing)
+	if err != nil {
+		return config, nil
+	}
+	if rate <= 0 {
+		return config, ing_errors.NewInvalidAnnotationContent(rateAnnotation, rate)
+	}
+
+	// one second of traffic by default
+	burst := rate
+	if b, err := parser.GetIntAnnotation(burstAnnotation, ing); err == nil {
+		if b < 0 {
+			return config, ing_errors.NewInvalidAnnotationContent(burstAnnotation, b)
+		}
+		burst = b
+	}
+
+	config.Rate = rate
+	config.Burst = burst
+
+	return config, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bodyfiltersnippet
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	bodyFilterSnippetAnnotation = "body-filter-snippet"
+
+	// maxCodeSize is the maximum size, in bytes, of the code of the snippets
+	maxCodeSize = 16 * 1024
+)
+
+type bodyFilterSnippet struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new body filter snippet annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return bodyFilterSnippet{r}
+}
+
+// Parse parses the annotations contained in the ingress to return the Lua
+// code run in a sandbox by the body_filter plugin to transform the response
+// bodies of the locations
+func (a bodyFilterSnippet) Parse(ing *networking.Ingress) (interface{}, error) {
+	code, err := parser.GetStringAnnotation(bodyFilterSnippetAnnotation, ing)
+	if err != nil {
+		return "", nil
+	}
+
+	if len(code) > maxCodeSize {
+		return "", ing_errors.LocationDenied{
+			Reason: fmt.Errorf("the snippet of %v is larger than %v bytes", bodyFilterSnippetAnnotation, maxCodeSize),
+		}
+	}
+
+	// the precompiled chunks start with the escape character
+	if strings.HasPrefix(code, "\x1b") {
+		return "", ing_errors.LocationDenied{
+			Reason: fmt.Errorf("the snippet of %v must be Lua source code", bodyFilterSnippetAnnotation),
+		}
+	}
+
+	return code, nil
+}
+
+// Checksum returns the checksum of the code of a snippet, referencing it in
+// the locations. The code is delivered to the body_filter plugin with the
+// dynamic configuration, it can be larger than the parameters of the NGINX
+// directives.
+func Checksum(code string) string {
+	checksum := sha1.Sum([]byte(code))
+	return hex.EncodeToString(checksum[:])
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package botdetection
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+type botDetection struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new bot detection annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return botDetection{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to apply the bot detection rules to the requests of the locations
+func (a botDetection) Parse(ing *networking.Ingress) (interface{}, error) {
+	return parser.GetBoolAnnotation("enable-bot-detection", ing)
+}
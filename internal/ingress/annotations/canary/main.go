@@ -17,13 +17,40 @@ limitations under the License.
 package canary
 
 import (
-	networking "k8s.io/api/networking/v1beta1"
+	"fmt"
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
+var (
+	// grpcMethodRegex matches a full gRPC method name, like
+	// /helloworld.Greeter/SayHello, or all the methods of a service with *
+	grpcMethodRegex = regexp.MustCompile(`^/?[A-Za-z_][\w.]*/(\*|[A-Za-z_]\w*)$`)
+	// contentTypeRegex matches a media type, like application/grpc, or all
+	// the subtypes of a type with *
+	contentTypeRegex = regexp.MustCompile(`^[\w.+-]+/(\*|[\w.+-]+)$`)
+)
+
+const (
+	// MatchModeOr redirects the requests matching any of the canary rules
+	MatchModeOr = "or"
+	// MatchModeAnd redirects the requests matching all the canary rules
+	MatchModeAnd = "and"
+
+	// defAnalysisInterval is the default period of time, in seconds, of the
+	// requests checked by each analysis of the canary
+	defAnalysisInterval = 60
+	// defAnalysisMinRequests is the default minimum number of requests in
+	// an interval to check the thresholds
+	defAnalysisMinRequests = 10
+)
+
 type canary struct {
 	r resolver.Resolver
 }
@@ -34,8 +61,30 @@ type Config struct {
 	Weight        int
 	Header        string
 	HeaderValue   string
+	HeaderValues  []string
 	HeaderPattern string
 	Cookie        string
+	CookieValue   string
+	GRPCMethods   []string
+	ContentTypes  []string
+	MatchMode     string
+	// Analysis contains the thresholds of the automatic rollback of the
+	// canary, nil when the rollback is disabled
+	Analysis *Analysis
+}
+
+// Analysis configures the rollback of the canary, its weight is set to zero
+// when the requests it receives breach one of the thresholds
+type Analysis struct {
+	// MaxErrorRate is the maximum percentage of 5xx responses
+	MaxErrorRate int `json:"maxErrorRate"`
+	// MaxLatency is the maximum average response time in milliseconds
+	MaxLatency int `json:"maxLatency"`
+	// Interval is the period of time, in seconds, of each analysis
+	Interval int `json:"interval"`
+	// MinRequests is the minimum number of requests in an interval to
+	// check the thresholds
+	MinRequests int `json:"minRequests"`
 }
 
 // NewParser parses the ingress for canary related annotations
@@ -69,6 +118,15 @@ func (c canary) Parse(ing *networking.Ingress) (interface{}, error) {
 		config.HeaderValue = ""
 	}
 
+	headerValues, err := parser.GetStringAnnotation("canary-by-header-values", ing)
+	if err == nil {
+		for _, v := range strings.Split(headerValues, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				config.HeaderValues = append(config.HeaderValues, v)
+			}
+		}
+	}
+
 	config.HeaderPattern, err = parser.GetStringAnnotation("canary-by-header-pattern", ing)
 	if err != nil {
 		config.HeaderPattern = ""
@@ -79,10 +137,122 @@ func (c canary) Parse(ing *networking.Ingress) (interface{}, error) {
 		config.Cookie = ""
 	}
 
-	if !config.Enabled && (config.Weight > 0 || len(config.Header) > 0 || len(config.HeaderValue) > 0 || len(config.Cookie) > 0 ||
-		len(config.HeaderPattern) > 0) {
+	config.CookieValue, err = parser.GetStringAnnotation("canary-by-cookie-value", ing)
+	if err == nil {
+		if err := parser.CheckPortableRegex(config.CookieValue); err != nil {
+			return nil, errors.NewInvalidAnnotationContent("canary-by-cookie-value", config.CookieValue)
+		}
+	} else {
+		config.CookieValue = ""
+	}
+
+	config.MatchMode, err = parser.GetStringAnnotation("canary-match-mode", ing)
+	if err == nil {
+		config.MatchMode = strings.ToLower(config.MatchMode)
+		if config.MatchMode != MatchModeOr && config.MatchMode != MatchModeAnd {
+			return nil, errors.NewInvalidAnnotationContent("canary-match-mode", config.MatchMode)
+		}
+	} else {
+		config.MatchMode = ""
+	}
+
+	grpcMethods, err := parser.GetStringAnnotation("canary-by-grpc-method", ing)
+	if err == nil {
+		config.GRPCMethods, err = parseList(grpcMethods, grpcMethodRegex)
+		if err != nil {
+			return nil, errors.NewInvalidAnnotationContent("canary-by-grpc-method", grpcMethods)
+		}
+
+		for i, method := range config.GRPCMethods {
+			if !strings.HasPrefix(method, "/") {
+				config.GRPCMethods[i] = "/" + method
+			}
+		}
+	}
+
+	contentTypes, err := parser.GetStringAnnotation("canary-by-content-type", ing)
+	if err == nil {
+		config.ContentTypes, err = parseList(strings.ToLower(contentTypes), contentTypeRegex)
+		if err != nil {
+			return nil, errors.NewInvalidAnnotationContent("canary-by-content-type", contentTypes)
+		}
+	}
+
+	config.Analysis, err = parseAnalysis(ing)
+	if err != nil {
+		return nil, err
+	}
+
+	if !config.Enabled && (config.Analysis != nil || config.Weight > 0 || len(config.Header) > 0 || len(config.HeaderValue) > 0 || len(config.HeaderValues) > 0 ||
+		len(config.Cookie) > 0 || len(config.HeaderPattern) > 0 || len(config.CookieValue) > 0 || len(config.GRPCMethods) > 0 || len(config.ContentTypes) > 0) {
 		return nil, errors.NewInvalidAnnotationConfiguration("canary", "configured but not enabled")
 	}
 
 	return config, nil
 }
+
+// parseAnalysis returns the configuration of the automatic rollback, nil
+// without thresholds
+func parseAnalysis(ing *networking.Ingress) (*Analysis, error) {
+	analysis := &Analysis{
+		Interval:    defAnalysisInterval,
+		MinRequests: defAnalysisMinRequests,
+	}
+
+	values := []struct {
+		name  string
+		value *int
+		min   int
+		max   int
+	}{
+		{"canary-analysis-max-error-rate", &analysis.MaxErrorRate, 1, 100},
+		{"canary-analysis-max-latency", &analysis.MaxLatency, 1, 0},
+		{"canary-analysis-interval", &analysis.Interval, 1, 0},
+		{"canary-analysis-min-requests", &analysis.MinRequests, 1, 0},
+	}
+
+	for _, v := range values {
+		value, err := parser.GetIntAnnotation(v.name, ing)
+		if err != nil {
+			if errors.IsMissingAnnotations(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if value < v.min || (v.max > 0 && value > v.max) {
+			return nil, errors.NewInvalidAnnotationContent(v.name, value)
+		}
+
+		*v.value = value
+	}
+
+	if analysis.MaxErrorRate == 0 && analysis.MaxLatency == 0 {
+		return nil, nil
+	}
+
+	return analysis, nil
+}
+
+// parseList returns the comma separated values, each of them matching regex
+func parseList(value string, regex *regexp.Regexp) ([]string, error) {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !regex.MatchString(v) {
+			return nil, fmt.Errorf("invalid value %q", v)
+		}
+
+		values = append(values, v)
+	}
+
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values in %q", value)
+	}
+
+	return values, nil
+}
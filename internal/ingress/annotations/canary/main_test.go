@@ -20,11 +20,11 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 
+	"reflect"
 	"strconv"
 
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -32,8 +32,12 @@ import (
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -42,9 +46,13 @@ func buildIngress() *networking.Ingress {
 			Namespace: api.NamespaceDefault,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -150,3 +158,177 @@ func TestAnnotations(t *testing.T) {
 		}
 	}
 }
+
+func TestCanaryByGRPCMethodAndContentType(t *testing.T) {
+	ing := buildIngress()
+
+	tests := []struct {
+		title           string
+		enabled         bool
+		grpcMethod      string
+		contentType     string
+		expGRPCMethods  []string
+		expContentTypes []string
+		expErr          bool
+	}{
+		{"canary disabled and grpc method", false, "helloworld.Greeter/SayHello", "", nil, nil, true},
+		{"canary disabled and content type", false, "", "application/grpc", nil, nil, true},
+		{"canary by grpc method", true, "helloworld.Greeter/SayHello, /helloworld.Greeter/*", "",
+			[]string{"/helloworld.Greeter/SayHello", "/helloworld.Greeter/*"}, nil, false},
+		{"canary by content type", true, "", "application/GRPC, application/*", nil,
+			[]string{"application/grpc", "application/*"}, false},
+		{"invalid grpc method", true, "helloworld.Greeter", "", nil, nil, true},
+		{"invalid content type", true, "", "application", nil, nil, true},
+	}
+
+	for _, test := range tests {
+		data := map[string]string{
+			parser.GetAnnotationWithPrefix("canary"): strconv.FormatBool(test.enabled),
+		}
+		if test.grpcMethod != "" {
+			data[parser.GetAnnotationWithPrefix("canary-by-grpc-method")] = test.grpcMethod
+		}
+		if test.contentType != "" {
+			data[parser.GetAnnotationWithPrefix("canary-by-content-type")] = test.contentType
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if test.expErr {
+			if err == nil {
+				t.Errorf("%v: expected error but returned nil", test.title)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: expected nil but returned error %v", test.title, err)
+			continue
+		}
+
+		canaryConfig := i.(*Config)
+		if !reflect.DeepEqual(canaryConfig.GRPCMethods, test.expGRPCMethods) {
+			t.Errorf("%v: expected %v but %v was returned", test.title, test.expGRPCMethods, canaryConfig.GRPCMethods)
+		}
+		if !reflect.DeepEqual(canaryConfig.ContentTypes, test.expContentTypes) {
+			t.Errorf("%v: expected %v but %v was returned", test.title, test.expContentTypes, canaryConfig.ContentTypes)
+		}
+	}
+}
+
+func TestCanaryMatchRules(t *testing.T) {
+	ing := buildIngress()
+
+	tests := []struct {
+		title           string
+		annotations     map[string]string
+		expHeaderValues []string
+		expCookieValue  string
+		expMatchMode    string
+		expErr          bool
+	}{
+		{"header value with commas", map[string]string{"canary-by-header-value": "foo,bar"}, nil, "", "", false},
+		{"single header value", map[string]string{"canary-by-header-values": "foo"}, []string{"foo"}, "", "", false},
+		{"list of header values", map[string]string{"canary-by-header-values": "foo, bar,,baz"},
+			[]string{"foo", "bar", "baz"}, "", "", false},
+		{"cookie value", map[string]string{"canary-by-cookie-value": "^(beta|canary)-.*$"}, nil, "^(beta|canary)-.*$", "", false},
+		{"invalid cookie value", map[string]string{"canary-by-cookie-value": "(beta"}, nil, "", "", true},
+		{"non portable cookie value", map[string]string{"canary-by-cookie-value": `^(?i)beta\d`}, nil, "", "", true},
+		{"nested repetition cookie value", map[string]string{"canary-by-cookie-value": "^(a+)+$"}, nil, "", "", true},
+		{"match mode", map[string]string{"canary-match-mode": "AND"}, nil, "", MatchModeAnd, false},
+		{"invalid match mode", map[string]string{"canary-match-mode": "xor"}, nil, "", "", true},
+	}
+
+	for _, test := range tests {
+		data := map[string]string{
+			parser.GetAnnotationWithPrefix("canary"): "true",
+		}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if test.expErr {
+			if err == nil {
+				t.Errorf("%v: expected error but returned nil", test.title)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: expected nil but returned error %v", test.title, err)
+			continue
+		}
+
+		canaryConfig := i.(*Config)
+		if !reflect.DeepEqual(canaryConfig.HeaderValues, test.expHeaderValues) {
+			t.Errorf("%v: expected %v but %v was returned", test.title, test.expHeaderValues, canaryConfig.HeaderValues)
+		}
+		if canaryConfig.CookieValue != test.expCookieValue {
+			t.Errorf("%v: expected %v but %v was returned", test.title, test.expCookieValue, canaryConfig.CookieValue)
+		}
+		if canaryConfig.MatchMode != test.expMatchMode {
+			t.Errorf("%v: expected %v but %v was returned", test.title, test.expMatchMode, canaryConfig.MatchMode)
+		}
+	}
+}
+
+func TestCanaryAnalysis(t *testing.T) {
+	ing := buildIngress()
+
+	tests := []struct {
+		title       string
+		enabled     bool
+		annotations map[string]string
+		expAnalysis *Analysis
+		expErr      bool
+	}{
+		{"without thresholds", true, map[string]string{"canary-analysis-interval": "30"}, nil, false},
+		{"error rate", true, map[string]string{"canary-analysis-max-error-rate": "5"},
+			&Analysis{MaxErrorRate: 5, Interval: 60, MinRequests: 10}, false},
+		{"latency", true, map[string]string{
+			"canary-analysis-max-latency":  "250",
+			"canary-analysis-interval":     "30",
+			"canary-analysis-min-requests": "100",
+		}, &Analysis{MaxLatency: 250, Interval: 30, MinRequests: 100}, false},
+		{"invalid error rate", true, map[string]string{"canary-analysis-max-error-rate": "101"}, nil, true},
+		{"invalid interval", true, map[string]string{
+			"canary-analysis-max-latency": "250",
+			"canary-analysis-interval":    "0",
+		}, nil, true},
+		{"not a number", true, map[string]string{"canary-analysis-max-latency": "fast"}, nil, true},
+		{"canary disabled", false, map[string]string{"canary-analysis-max-error-rate": "5"}, nil, true},
+	}
+
+	for _, test := range tests {
+		data := map[string]string{
+			parser.GetAnnotationWithPrefix("canary"): strconv.FormatBool(test.enabled),
+		}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if test.expErr {
+			if err == nil {
+				t.Errorf("%v: expected error but returned nil", test.title)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: expected nil but returned error %v", test.title, err)
+			continue
+		}
+
+		canaryConfig := i.(*Config)
+		if !reflect.DeepEqual(canaryConfig.Analysis, test.expAnalysis) {
+			t.Errorf("%v: expected %+v but %+v was returned", test.title, test.expAnalysis, canaryConfig.Analysis)
+		}
+	}
+}
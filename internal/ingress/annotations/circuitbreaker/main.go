@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package circuitbreaker
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	consecutiveErrorsAnnotation = "circuit-breaker-consecutive-errors"
+	errorRateAnnotation         = "circuit-breaker-error-rate"
+	windowAnnotation            = "circuit-breaker-window"
+	minRequestsAnnotation       = "circuit-breaker-min-requests"
+	cooldownAnnotation          = "circuit-breaker-cooldown"
+
+	defaultWindow      = 10 * time.Second
+	defaultMinRequests = 10
+	defaultCooldown    = 30 * time.Second
+)
+
+// Config contains the thresholds used to eject the unhealthy endpoints of
+// a backend from the load balancing for a while
+type Config struct {
+	// ConsecutiveErrors is the number of consecutive 5xx responses of an
+	// endpoint that ejects it, 0 disables the threshold
+	ConsecutiveErrors int `json:"consecutiveErrors"`
+	// ErrorRate is the percentage of 5xx responses of an endpoint in the
+	// window that ejects it, 0 disables the threshold
+	ErrorRate int `json:"errorRate"`
+	// Window is the duration, in seconds, of the window of the error rate
+	Window int `json:"window"`
+	// MinRequests is the minimum number of requests to an endpoint in the
+	// window before the error rate is applied
+	MinRequests int `json:"minRequests"`
+	// Cooldown is the time, in seconds, an endpoint stays ejected
+	Cooldown int `json:"cooldown"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type circuitBreaker struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new circuit breaker annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return circuitBreaker{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the
+// thresholds used to eject the unhealthy endpoints of the backends
+func (a circuitBreaker) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	consecutiveErrors, err := parser.GetIntAnnotation(consecutiveErrorsAnnotation, ing)
+	if err != nil {
+		consecutiveErrors = 0
+	}
+	if consecutiveErrors < 0 {
+		return config, ing_errors.NewInvalidAnnotationContent(consecutiveErrorsAnnotation, consecutiveErrors)
+	}
+
+	errorRate, err := parser.GetIntAnnotation(errorRateAnnotation, ing)
+	if err != nil {
+		errorRate = 0
+	}
+	if errorRate < 0 || errorRate > 100 {
+		return config, ing_errors.NewInvalidAnnotationContent(errorRateAnnotation, errorRate)
+	}
+
+	if consecutiveErrors == 0 && errorRate == 0 {
+		return config, nil
+	}
+
+	window, err := parseDuration(windowAnnotation, defaultWindow, ing)
+	if err != nil {
+		return config, err
+	}
+
+	minRequests, err := parser.GetIntAnnotation(minRequestsAnnotation, ing)
+	if err != nil {
+		minRequests = defaultMinRequests
+	}
+	if minRequests < 1 {
+		return config, ing_errors.NewInvalidAnnotationContent(minRequestsAnnotation, minRequests)
+	}
+
+	cooldown, err := parseDuration(cooldownAnnotation, defaultCooldown, ing)
+	if err != nil {
+		return config, err
+	}
+
+	config.ConsecutiveErrors = consecutiveErrors
+	config.ErrorRate = errorRate
+	config.Window = int(window.Seconds())
+	config.MinRequests = minRequests
+	config.Cooldown = int(cooldown.Seconds())
+
+	return config, nil
+}
+
+// parseDuration returns the duration of the annotation, of at least one
+// second as the counters of the endpoints expire in seconds
+func parseDuration(name string, def time.Duration, ing *networking.Ingress) (time.Duration, error) {
+	raw, err := parser.GetStringAnnotation(name, ing)
+	if err != nil {
+		return def, nil
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return def, ing_errors.LocationDenied{
+			Reason: errors.Wrapf(err, "failed to parse '%v' value", name),
+		}
+	}
+	if duration < time.Second {
+		return def, ing_errors.NewInvalidAnnotationContent(name, raw)
+	}
+
+	return duration, nil
+}
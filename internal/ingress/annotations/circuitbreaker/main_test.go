@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package circuitbreaker
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		expected    Config
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, Config{}, false},
+		{"consecutive errors only", map[string]string{"circuit-breaker-consecutive-errors": "5"},
+			Config{ConsecutiveErrors: 5, Window: 10, MinRequests: 10, Cooldown: 30}, false},
+		{"error rate with window, min requests and cooldown", map[string]string{
+			"circuit-breaker-error-rate":   "50",
+			"circuit-breaker-window":       "1m",
+			"circuit-breaker-min-requests": "20",
+			"circuit-breaker-cooldown":     "2m",
+		}, Config{ErrorRate: 50, Window: 60, MinRequests: 20, Cooldown: 120}, false},
+		{"window without threshold", map[string]string{"circuit-breaker-window": "1m"}, Config{}, false},
+		{"negative consecutive errors", map[string]string{"circuit-breaker-consecutive-errors": "-1"}, Config{}, true},
+		{"error rate over 100", map[string]string{"circuit-breaker-error-rate": "101"}, Config{}, true},
+		{"invalid window", map[string]string{"circuit-breaker-error-rate": "50", "circuit-breaker-window": "10"}, Config{}, true},
+		{"window under a second", map[string]string{"circuit-breaker-error-rate": "50", "circuit-breaker-window": "500ms"}, Config{}, true},
+		{"invalid min requests", map[string]string{"circuit-breaker-error-rate": "50", "circuit-breaker-min-requests": "0"}, Config{}, true},
+		{"invalid cooldown", map[string]string{"circuit-breaker-consecutive-errors": "5", "circuit-breaker-cooldown": "-30s"}, Config{}, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		config, ok := i.(Config)
+		if !ok {
+			t.Errorf("%v: expected a Config type but got %T", test.title, i)
+			continue
+		}
+
+		if config != test.expected {
+			t.Errorf("%v: expected %+v but got %+v", test.title, test.expected, config)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package connectionlimit
+
+import (
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/globalratelimit"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const defaultKey = "$remote_addr"
+
+// Config contains the limit of concurrent connections of each key, like
+// the client address, to the locations
+type Config struct {
+	// Namespace separates the counters of the Ingress from the other ones
+	Namespace string `json:"namespace"`
+	// Limit is the maximum number of concurrent connections of a key, zero
+	// disables the limit
+	Limit int `json:"limit"`
+	// Key is composed of NGINX variables, with the syntax of the
+	// global-rate-limit-key annotation
+	Key string `json:"key"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type connectionlimit struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new connection limit per key annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return connectionlimit{r}
+}
+
+// Parse parses the annotations contained in the ingress to limit the
+// concurrent connections of each key
+func (a connectionlimit) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	limit, err := parser.GetIntAnnotation("limit-connections-per-key", ing)
+	if err != nil {
+		return config, nil
+	}
+	if limit <= 0 {
+		return config, ing_errors.NewInvalidAnnotationContent("limit-connections-per-key", limit)
+	}
+
+	key, _ := parser.GetStringAnnotation("limit-connections-key", ing)
+	if len(key) == 0 {
+		key = defaultKey
+	}
+	if err := globalratelimit.ValidateKey("limit-connections-key", key); err != nil {
+		return config, err
+	}
+
+	config.Namespace = strings.Replace(string(ing.UID), "-", "", -1)
+	config.Limit = limit
+	config.Key = key
+
+	return config, nil
+}
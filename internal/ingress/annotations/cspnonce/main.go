@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cspnonce
+
+import (
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	// NonceVariable is the nginx variable that holds the per-request nonce
+	NonceVariable = "$csp_nonce"
+
+	defaultHeader = "X-CSP-Nonce"
+	defaultPolicy = "script-src 'nonce-$csp_nonce' 'strict-dynamic'; object-src 'none'; base-uri 'none'"
+)
+
+var (
+	// headerRegex matches the valid names of the request header passing the nonce
+	headerRegex = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	// policyRegex matches the printable policies without quotes or backslashes,
+	// which could break out of the quoted add_header value
+	policyRegex = regexp.MustCompile(`^[^"\\\x00-\x1f\x7f]+$`)
+)
+
+// Config contains the Content-Security-Policy nonce configuration for a location
+type Config struct {
+	Enabled bool   `json:"enabled"`
+	Policy  string `json:"policy"`
+	Header  string `json:"header"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if c1.Enabled != c2.Enabled {
+		return false
+	}
+	if c1.Policy != c2.Policy {
+		return false
+	}
+	if c1.Header != c2.Header {
+		return false
+	}
+
+	return true
+}
+
+type cspNonce struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new CSP nonce annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return cspNonce{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to generate a per-request Content-Security-Policy nonce
+func (a cspNonce) Parse(ing *networking.Ingress) (interface{}, error) {
+	enabled, err := parser.GetBoolAnnotation("enable-csp-nonce", ing)
+	if err != nil || !enabled {
+		return &Config{}, nil
+	}
+
+	policy, err := parser.GetStringAnnotation("csp-nonce-policy", ing)
+	if err != nil {
+		policy = defaultPolicy
+	}
+
+	if !policyRegex.MatchString(policy) {
+		return &Config{}, ing_errors.NewInvalidAnnotationContent("csp-nonce-policy", policy)
+	}
+
+	if !strings.Contains(policy, NonceVariable) {
+		return &Config{}, ing_errors.NewInvalidAnnotationConfiguration("csp-nonce-policy",
+			"the policy must reference the "+NonceVariable+" variable")
+	}
+
+	header, err := parser.GetStringAnnotation("csp-nonce-header", ing)
+	if err != nil {
+		header = defaultHeader
+	}
+
+	if !headerRegex.MatchString(header) {
+		return &Config{}, ing_errors.NewInvalidAnnotationContent("csp-nonce-header", header)
+	}
+
+	return &Config{
+		Enabled: true,
+		Policy:  policy,
+		Header:  header,
+	}, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cspnonce
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	enable := parser.GetAnnotationWithPrefix("enable-csp-nonce")
+	policy := parser.GetAnnotationWithPrefix("csp-nonce-policy")
+	header := parser.GetAnnotationWithPrefix("csp-nonce-header")
+
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    *Config
+		expectErr   bool
+	}{
+		{map[string]string{enable: "true"}, &Config{Enabled: true, Policy: defaultPolicy, Header: defaultHeader}, false},
+		{map[string]string{enable: "true", policy: "default-src 'self'; script-src 'nonce-$csp_nonce'", header: "X-Nonce"},
+			&Config{Enabled: true, Policy: "default-src 'self'; script-src 'nonce-$csp_nonce'", Header: "X-Nonce"}, false},
+		{map[string]string{enable: "true", policy: "default-src 'self'"}, &Config{}, true},
+		{map[string]string{enable: "true", policy: "script-src 'nonce-$csp_nonce'\"; return 200"}, &Config{}, true},
+		{map[string]string{enable: "true", policy: "script-src 'nonce-$csp_nonce'\n"}, &Config{}, true},
+		{map[string]string{enable: "true", header: "X-Nonce $host; more_set_headers"}, &Config{}, true},
+		{map[string]string{enable: "true", header: "X-Nonce\r\nX-Other"}, &Config{}, true},
+		{map[string]string{enable: "false", policy: "script-src 'nonce-$csp_nonce'"}, &Config{}, false},
+		{map[string]string{}, &Config{}, false},
+		{nil, &Config{}, false},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		i, err := ap.Parse(ing)
+		if testCase.expectErr && err == nil {
+			t.Errorf("expected error but returned nil, annotations: %s", testCase.annotations)
+		}
+		if !testCase.expectErr && err != nil {
+			t.Errorf("unexpected error %v, annotations: %s", err, testCase.annotations)
+		}
+
+		p, _ := i.(*Config)
+		if !p.Equal(testCase.expected) {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, p, testCase.annotations)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customendpoints
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+	ing_net "k8s.io/ingress-nginx/internal/net"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+const customEndpointsAnnotation = "custom-endpoints"
+
+// Endpoint is an endpoint outside of the cluster used instead of the
+// endpoints of the service
+type Endpoint struct {
+	Address string `json:"address"`
+	Port    string `json:"port"`
+}
+
+type customEndpoints struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new custom endpoints annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return customEndpoints{r}
+}
+
+// Parse parses the annotations contained in the ingress rule used to route
+// the backends to a static list of endpoints outside of the cluster.
+// The value is a comma separated list of <IP address>:<port>. The loopback
+// and link-local addresses, like the cloud metadata services, the ports of
+// the controller and the addresses outside of custom-endpoints-allowed-cidrs
+// are rejected.
+func (a customEndpoints) Parse(ing *networking.Ingress) (interface{}, error) {
+	s, err := parser.GetStringAnnotation(customEndpointsAnnotation, ing)
+	if err != nil {
+		return []Endpoint{}, nil
+	}
+
+	ipnets, ips, err := ing_net.ParseIPNets(a.r.GetDefaultBackend().CustomEndpointsAllowedCIDRs...)
+	if err != nil {
+		return []Endpoint{}, ing_errors.LocationDenied{
+			Reason: fmt.Errorf("invalid custom-endpoints-allowed-cidrs: %v", err),
+		}
+	}
+
+	endpoints := []Endpoint{}
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+
+		endpoint, err := parseEndpoint(e, ipnets, ips)
+		if err != nil {
+			return []Endpoint{}, ing_errors.LocationDenied{
+				Reason: fmt.Errorf("invalid endpoint %q in %v: %v", e, customEndpointsAnnotation, err),
+			}
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, nil
+}
+
+func parseEndpoint(s string, ipnets ing_net.IPNet, ips ing_net.IP) (Endpoint, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	// the endpoints are used by the balancer without DNS resolution
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return Endpoint{}, fmt.Errorf("%v is not an IP address", host)
+	}
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return Endpoint{}, fmt.Errorf("%v is a loopback, link-local, unspecified or multicast address", host)
+	}
+
+	if !isAllowed(ip, ipnets, ips) {
+		return Endpoint{}, fmt.Errorf("%v is not in custom-endpoints-allowed-cidrs", host)
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil || len(validation.IsValidPortNum(p)) != 0 {
+		return Endpoint{}, fmt.Errorf("%v is not a valid port", port)
+	}
+
+	if isControllerPort(p) {
+		return Endpoint{}, fmt.Errorf("%v is a port of the ingress controller", port)
+	}
+
+	return Endpoint{Address: host, Port: port}, nil
+}
+
+// isAllowed returns true when the allowlist is empty or contains the address
+func isAllowed(ip net.IP, ipnets ing_net.IPNet, ips ing_net.IP) bool {
+	if len(ipnets) == 0 && len(ips) == 0 {
+		return true
+	}
+
+	if _, ok := ips[ip.String()]; ok {
+		return true
+	}
+
+	for _, ipnet := range ipnets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isControllerPort returns true for the ports of the internal servers of the
+// ingress controller and NGINX, like the status and the healthz ports
+func isControllerPort(port int) bool {
+	for _, p := range []int{nginx.ProfilerPort, nginx.StatusPort, nginx.StreamPort, nginx.HealthzPort} {
+		if port == p {
+			return true
+		}
+	}
+
+	return false
+}
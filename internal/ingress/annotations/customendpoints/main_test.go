@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customendpoints
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/defaults"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+type mockBackend struct {
+	resolver.Mock
+	backend defaults.Backend
+}
+
+func (m mockBackend) GetDefaultBackend() defaults.Backend {
+	return m.backend
+}
+
+func TestParse(t *testing.T) {
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	annotation := parser.GetAnnotationWithPrefix(customEndpointsAnnotation)
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    []Endpoint
+		expErr      bool
+	}{
+		{map[string]string{}, []Endpoint{}, false},
+		{map[string]string{annotation: "10.0.0.1:8080"}, []Endpoint{{"10.0.0.1", "8080"}}, false},
+		{map[string]string{annotation: "10.0.0.1:8080, 10.0.0.2:8080,"}, []Endpoint{
+			{"10.0.0.1", "8080"},
+			{"10.0.0.2", "8080"},
+		}, false},
+		{map[string]string{annotation: "[fd00::1]:80"}, []Endpoint{{"fd00::1", "80"}}, false},
+		{map[string]string{annotation: "10.0.0.1"}, []Endpoint{}, true},
+		{map[string]string{annotation: "10.0.0.1:0"}, []Endpoint{}, true},
+		{map[string]string{annotation: "10.0.0.1:http"}, []Endpoint{}, true},
+		{map[string]string{annotation: "legacy.example.com:80"}, []Endpoint{}, true},
+		{map[string]string{annotation: "127.0.0.1:8080"}, []Endpoint{}, true},
+		{map[string]string{annotation: "[::1]:8080"}, []Endpoint{}, true},
+		{map[string]string{annotation: "169.254.169.254:80"}, []Endpoint{}, true},
+		{map[string]string{annotation: "[fe80::1]:80"}, []Endpoint{}, true},
+		{map[string]string{annotation: "0.0.0.0:80"}, []Endpoint{}, true},
+		{map[string]string{annotation: "10.0.0.1:10246"}, []Endpoint{}, true},
+		{map[string]string{annotation: "10.0.0.1:10254"}, []Endpoint{}, true},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, err := ap.Parse(ing)
+		if (err != nil) != testCase.expErr {
+			t.Errorf("expected error %v but got %v for annotations %v", testCase.expErr, err, testCase.annotations)
+		}
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("expected %v but got %v for annotations %v", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
+
+func TestParseAllowedCIDRs(t *testing.T) {
+	annotation := parser.GetAnnotationWithPrefix(customEndpointsAnnotation)
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	testCases := []struct {
+		cidrs    []string
+		value    string
+		expected []Endpoint
+		expErr   bool
+	}{
+		{[]string{"192.0.2.0/24"}, "192.0.2.10:8080", []Endpoint{{"192.0.2.10", "8080"}}, false},
+		{[]string{"192.0.2.0/24", "198.51.100.1"}, "198.51.100.1:8080", []Endpoint{{"198.51.100.1", "8080"}}, false},
+		{[]string{"192.0.2.0/24"}, "10.0.0.1:8080", []Endpoint{}, true},
+		{[]string{"192.0.2.0/24"}, "192.0.2.10:8080, 10.0.0.1:8080", []Endpoint{}, true},
+		{[]string{"invalid"}, "192.0.2.10:8080", []Endpoint{}, true},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(map[string]string{annotation: testCase.value})
+		ap := NewParser(mockBackend{backend: defaults.Backend{CustomEndpointsAllowedCIDRs: testCase.cidrs}})
+		result, err := ap.Parse(ing)
+		if (err != nil) != testCase.expErr {
+			t.Errorf("expected error %v but got %v for %v", testCase.expErr, err, testCase.value)
+		}
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("expected %v but got %v for %v", testCase.expected, result, testCase.value)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package draintimeout
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const drainTimeoutAnnotation = "drain-timeout"
+
+type drainTimeout struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new drain timeout annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return drainTimeout{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the time,
+// in seconds, the endpoints removed from the backends keep serving their
+// sessions. The setting of the ConfigMap is used when the annotation is missing.
+func (a drainTimeout) Parse(ing *networking.Ingress) (interface{}, error) {
+	timeout, err := parser.GetIntAnnotation(drainTimeoutAnnotation, ing)
+	if err != nil {
+		return a.r.GetDefaultBackend().DrainTimeout, nil
+	}
+
+	if timeout < 0 {
+		return 0, ing_errors.NewInvalidAnnotationContent(drainTimeoutAnnotation, timeout)
+	}
+
+	return timeout, nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package draintimeout
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/defaults"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+type mockBackend struct {
+	resolver.Mock
+	backend defaults.Backend
+}
+
+func (m mockBackend) GetDefaultBackend() defaults.Backend {
+	return m.backend
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		defaults    defaults.Backend
+		expected    int
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, defaults.Backend{}, 0, false},
+		{"default timeout", map[string]string{}, defaults.Backend{DrainTimeout: 30}, 30, false},
+		{"annotation", map[string]string{"drain-timeout": "120"}, defaults.Backend{DrainTimeout: 30}, 120, false},
+		{"disabled by the annotation", map[string]string{"drain-timeout": "0"}, defaults.Backend{DrainTimeout: 30}, 0, false},
+		{"negative timeout", map[string]string{"drain-timeout": "-1"}, defaults.Backend{}, 0, true},
+		{"non numeric timeout", map[string]string{"drain-timeout": "1m"}, defaults.Backend{DrainTimeout: 30}, 30, false},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(mockBackend{backend: test.defaults}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+		}
+
+		if timeout, ok := i.(int); !ok || timeout != test.expected {
+			t.Errorf("%v: expected %v but got %v", test.title, test.expected, i)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package echobackend
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	echoBackendAnnotation              = "echo-backend"
+	echoBackendStatusAnnotation        = "echo-backend-status"
+	echoBackendLatencyAnnotation       = "echo-backend-latency"
+	echoBackendLatencyJitterAnnotation = "echo-backend-latency-jitter"
+)
+
+// Config contains the settings of the built-in echo backend answering the
+// requests of a location instead of the service
+type Config struct {
+	// Enabled answers the requests with the echo backend
+	Enabled bool `json:"enabled"`
+	// Status is the HTTP status code of the responses
+	Status int `json:"status"`
+	// Latency is the time, in milliseconds, added to the responses
+	Latency int `json:"latency"`
+	// LatencyJitter is the maximum random time, in milliseconds, added to
+	// the latency
+	LatencyJitter int `json:"latencyJitter"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type echoBackend struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new echo backend annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return echoBackend{r}
+}
+
+// Parse parses the annotations contained in the ingress to answer the
+// requests of the locations with the echo backend
+func (a echoBackend) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	enabled, err := parser.GetBoolAnnotation(echoBackendAnnotation, ing)
+	if err != nil || !enabled {
+		return config, nil
+	}
+
+	status, err := parser.GetIntAnnotation(echoBackendStatusAnnotation, ing)
+	if err != nil {
+		status = http.StatusOK
+	}
+	if status < 200 || status > 599 {
+		return config, ing_errors.NewInvalidAnnotationContent(echoBackendStatusAnnotation, status)
+	}
+
+	latency, err := parseDuration(echoBackendLatencyAnnotation, ing)
+	if err != nil {
+		return config, err
+	}
+
+	jitter, err := parseDuration(echoBackendLatencyJitterAnnotation, ing)
+	if err != nil {
+		return config, err
+	}
+
+	config.Enabled = true
+	config.Status = status
+	config.Latency = int(latency / time.Millisecond)
+	config.LatencyJitter = int(jitter / time.Millisecond)
+
+	return config, nil
+}
+
+// parseDuration returns the duration of an annotation, zero when it is not
+// present
+func parseDuration(name string, ing *networking.Ingress) (time.Duration, error) {
+	raw, err := parser.GetStringAnnotation(name, ing)
+	if err != nil {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, ing_errors.LocationDenied{
+			Reason: errors.Wrapf(err, "failed to parse '%v' value", name),
+		}
+	}
+	if duration < 0 {
+		return 0, ing_errors.NewInvalidAnnotationContent(name, raw)
+	}
+
+	return duration, nil
+}
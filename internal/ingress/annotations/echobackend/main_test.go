@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package echobackend
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		expected    Config
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, Config{}, false},
+		{"disabled", map[string]string{"echo-backend": "false", "echo-backend-status": "503"}, Config{}, false},
+		{"enabled", map[string]string{"echo-backend": "true"}, Config{Enabled: true, Status: 200}, false},
+		{"with status and latency", map[string]string{
+			"echo-backend":                "true",
+			"echo-backend-status":         "503",
+			"echo-backend-latency":        "250ms",
+			"echo-backend-latency-jitter": "1s",
+		}, Config{Enabled: true, Status: 503, Latency: 250, LatencyJitter: 1000}, false},
+		{"invalid status", map[string]string{"echo-backend": "true", "echo-backend-status": "101"}, Config{}, true},
+		{"invalid latency", map[string]string{"echo-backend": "true", "echo-backend-latency": "250"}, Config{}, true},
+		{"negative jitter", map[string]string{"echo-backend": "true", "echo-backend-latency-jitter": "-1s"}, Config{}, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		config, ok := i.(Config)
+		if !ok {
+			t.Errorf("%v: expected a Config type but got %T", test.title, i)
+			continue
+		}
+
+		if config != test.expected {
+			t.Errorf("%v: expected %+v but got %+v", test.title, test.expected, config)
+		}
+	}
+}
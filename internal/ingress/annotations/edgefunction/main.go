@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package edgefunction
+
+import (
+	"fmt"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	edgeFunctionAnnotation = "lua-edge-function"
+
+	// maxCodeSize is the maximum size, in bytes, of the code of the functions
+	maxCodeSize = 16 * 1024
+)
+
+type edgeFunction struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new edge function annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return edgeFunction{r}
+}
+
+// Parse parses the annotations contained in the ingress to return the Lua
+// code run in a sandbox by the locations, with the functions on_request and
+// on_response called for the requests and the responses
+func (a edgeFunction) Parse(ing *networking.Ingress) (interface{}, error) {
+	code, err := parser.GetStringAnnotation(edgeFunctionAnnotation, ing)
+	if err != nil {
+		return "", nil
+	}
+
+	if len(code) > maxCodeSize {
+		return "", ing_errors.LocationDenied{
+			Reason: fmt.Errorf("the code of %v is larger than %v bytes", edgeFunctionAnnotation, maxCodeSize),
+		}
+	}
+
+	// the precompiled chunks start with the escape character
+	if strings.HasPrefix(code, "\x1b") {
+		return "", ing_errors.LocationDenied{
+			Reason: fmt.Errorf("the code of %v must be Lua source code", edgeFunctionAnnotation),
+		}
+	}
+
+	return code, nil
+}
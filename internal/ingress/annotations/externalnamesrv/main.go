@@ -0,0 +1,40 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package externalnamesrv
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+type externalNameSRV struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new ExternalName SRV annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return externalNameSRV{r}
+}
+
+// Parse parses the annotation contained in the ingress to resolve the
+// ExternalName of the services of the backends as SRV records, with the
+// targets and the ports of the records as endpoints
+func (s externalNameSRV) Parse(ing *networking.Ingress) (interface{}, error) {
+	return parser.GetBoolAnnotation("external-name-srv", ing)
+}
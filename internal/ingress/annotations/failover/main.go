@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failover
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	failoverEndpointsAnnotation = "failover-endpoints"
+
+	defaultWeight = 1
+	maxWeight     = 100
+)
+
+// Endpoint is an endpoint outside of the cluster used only when
+// none of the endpoints of the service are available
+type Endpoint struct {
+	// Address is an IP address or a DNS name, resolved by NGINX
+	Address string `json:"address"`
+	Port    string `json:"port"`
+	// Weight of the endpoint relative to the other failover endpoints
+	Weight int `json:"weight"`
+}
+
+// Equal tests for equality between two Endpoint types
+func (e1 *Endpoint) Equal(e2 *Endpoint) bool {
+	if e1 == e2 {
+		return true
+	}
+	if e1 == nil || e2 == nil {
+		return false
+	}
+
+	return *e1 == *e2
+}
+
+type failover struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new failover endpoints annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return failover{r}
+}
+
+// Parse parses the annotations contained in the ingress rule used to
+// define the endpoints outside of the cluster of the backends.
+// The value is a comma separated list of <address>:<port> [weight=<weight>]
+func (a failover) Parse(ing *networking.Ingress) (interface{}, error) {
+	s, err := parser.GetStringAnnotation(failoverEndpointsAnnotation, ing)
+	if err != nil {
+		return []Endpoint{}, nil
+	}
+
+	endpoints := []Endpoint{}
+	for _, e := range strings.Split(s, ",") {
+		if strings.TrimSpace(e) == "" {
+			continue
+		}
+
+		endpoint, err := parseEndpoint(e)
+		if err != nil {
+			return []Endpoint{}, err
+		}
+
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, nil
+}
+
+func parseEndpoint(s string) (Endpoint, error) {
+	invalid := ing_errors.NewInvalidAnnotationContent(failoverEndpointsAnnotation, s)
+
+	fields := strings.Fields(s)
+	if len(fields) > 2 {
+		return Endpoint{}, invalid
+	}
+
+	host, port, err := net.SplitHostPort(fields[0])
+	if err != nil {
+		return Endpoint{}, invalid
+	}
+
+	if net.ParseIP(host) == nil && len(validation.IsDNS1123Subdomain(host)) != 0 {
+		return Endpoint{}, invalid
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || len(validation.IsValidPortNum(p)) != 0 {
+		return Endpoint{}, invalid
+	}
+
+	weight := defaultWeight
+	if len(fields) == 2 {
+		if !strings.HasPrefix(fields[1], "weight=") {
+			return Endpoint{}, invalid
+		}
+
+		weight, err = strconv.Atoi(strings.TrimPrefix(fields[1], "weight="))
+		if err != nil || weight < 1 || weight > maxWeight {
+			return Endpoint{}, invalid
+		}
+	}
+
+	return Endpoint{Address: host, Port: port, Weight: weight}, nil
+}
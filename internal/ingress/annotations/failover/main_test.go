@@ -0,0 +1,76 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failover
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	annotation := parser.GetAnnotationWithPrefix(failoverEndpointsAnnotation)
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    []Endpoint
+		expErr      bool
+	}{
+		{map[string]string{}, []Endpoint{}, false},
+		{map[string]string{annotation: "10.0.0.1:8080"}, []Endpoint{{"10.0.0.1", "8080", 1}}, false},
+		{map[string]string{annotation: "10.0.0.1:8080 weight=3, backup.example.com:443"}, []Endpoint{
+			{"10.0.0.1", "8080", 3},
+			{"backup.example.com", "443", 1},
+		}, false},
+		{map[string]string{annotation: "[fd00::1]:80"}, []Endpoint{{"fd00::1", "80", 1}}, false},
+		{map[string]string{annotation: "10.0.0.1"}, []Endpoint{}, true},
+		{map[string]string{annotation: "10.0.0.1:0"}, []Endpoint{}, true},
+		{map[string]string{annotation: "backup_example.com:80"}, []Endpoint{}, true},
+		{map[string]string{annotation: "10.0.0.1:80 weight=0"}, []Endpoint{}, true},
+		{map[string]string{annotation: "10.0.0.1:80 max_fails=3"}, []Endpoint{}, true},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, err := ap.Parse(ing)
+		if (err != nil) != testCase.expErr {
+			t.Errorf("expected error %v but got %v for annotations %v", testCase.expErr, err, testCase.annotations)
+		}
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("expected %v but got %v for annotations %v", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fallback
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+var (
+	// DefaultStatusCodes are the status codes of the backend that trigger
+	// the use of the fallback service when none are configured
+	DefaultStatusCodes = []int{502, 503, 504}
+
+	// status codes supported by the directive proxy_next_upstream
+	validStatusCodes = map[int]bool{
+		403: true,
+		404: true,
+		429: true,
+		500: true,
+		502: true,
+		503: true,
+		504: true,
+	}
+)
+
+// Config contains the service used when the backend of a location fails
+type Config struct {
+	// Service is the fallback service, in the namespace of the ingress
+	Service *apiv1.Service `json:"-"`
+	// StatusCodes returned by the backend that trigger the use of the fallback service,
+	// in addition to connection errors and timeouts
+	StatusCodes []int `json:"statusCodes,omitempty"`
+	// Backend is the name of the upstream of the fallback service.
+	// It is set by the controller only if the service has endpoints
+	Backend string `json:"backend,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if (c1.Service == nil) != (c2.Service == nil) {
+		return false
+	}
+	if c1.Service != nil && (c1.Service.Namespace != c2.Service.Namespace || c1.Service.Name != c2.Service.Name) {
+		return false
+	}
+	if len(c1.StatusCodes) != len(c2.StatusCodes) {
+		return false
+	}
+	for i, code := range c1.StatusCodes {
+		if code != c2.StatusCodes[i] {
+			return false
+		}
+	}
+	if c1.Backend != c2.Backend {
+		return false
+	}
+
+	return true
+}
+
+// NextUpstream returns the conditions of the directive proxy_next_upstream
+// required to retry the request against the fallback service
+func (c Config) NextUpstream() []string {
+	conditions := []string{"error", "timeout"}
+	for _, code := range c.StatusCodes {
+		conditions = append(conditions, fmt.Sprintf("http_%v", code))
+	}
+
+	return conditions
+}
+
+type fallback struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new fallback service annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return fallback{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to retry the failed requests against a fallback service
+func (f fallback) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	s, err := parser.GetStringAnnotation("fallback-service", ing)
+	if err != nil {
+		return config, nil
+	}
+
+	name := fmt.Sprintf("%v/%v", ing.Namespace, s)
+	svc, err := f.r.GetService(name)
+	if err != nil {
+		return config, errors.Wrapf(err, "unexpected error reading service %v", name)
+	}
+
+	codes := DefaultStatusCodes
+	c, err := parser.GetStringAnnotation("fallback-status-codes", ing)
+	if err == nil {
+		codes, err = parseStatusCodes(c)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	config.Service = svc
+	config.StatusCodes = codes
+
+	return config, nil
+}
+
+func parseStatusCodes(s string) ([]int, error) {
+	codes := []int{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		code, err := strconv.Atoi(c)
+		if err != nil || !validStatusCodes[code] {
+			return nil, ing_errors.NewInvalidAnnotationContent("fallback-status-codes", c)
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fallback
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+type mockService struct {
+	resolver.Mock
+}
+
+// GetService mocks the GetService call from the fallback package
+func (m mockService) GetService(name string) (*api.Service, error) {
+	if name != "default/maintenance" {
+		return nil, errors.Errorf("there is no service with name %v", name)
+	}
+
+	return &api.Service{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Namespace: api.NamespaceDefault,
+			Name:      "maintenance",
+		},
+	}, nil
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		service     string
+		codes       []int
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, "", nil, false},
+		{"default status codes", map[string]string{"fallback-service": "maintenance"}, "maintenance", DefaultStatusCodes, false},
+		{"custom status codes", map[string]string{"fallback-service": "maintenance", "fallback-status-codes": "500, 429"}, "maintenance", []int{500, 429}, false},
+		{"invalid status code", map[string]string{"fallback-service": "maintenance", "fallback-status-codes": "502,418"}, "", nil, true},
+		{"unknown service", map[string]string{"fallback-service": "unknown"}, "", nil, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&mockService{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		config, ok := i.(Config)
+		if !ok {
+			t.Errorf("%v: expected a Config type but got %T", test.title, i)
+			continue
+		}
+
+		service := ""
+		if config.Service != nil {
+			service = config.Service.Name
+		}
+		if service != test.service {
+			t.Errorf("%v: expected service %q but got %q", test.title, test.service, service)
+		}
+		if !reflect.DeepEqual(config.StatusCodes, test.codes) {
+			t.Errorf("%v: expected status codes %v but got %v", test.title, test.codes, config.StatusCodes)
+		}
+	}
+}
+
+func TestNextUpstream(t *testing.T) {
+	config := Config{StatusCodes: []int{502, 504}}
+
+	expected := []string{"error", "timeout", "http_502", "http_504"}
+	if actual := config.NextUpstream(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
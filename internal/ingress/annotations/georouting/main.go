@@ -0,0 +1,247 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package georouting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	// ScopeCountry routes the requests of a country, by ISO 3166-1 alpha-2 code
+	ScopeCountry = "country"
+	// ScopeContinent routes the requests of a continent, by GeoIP2 continent code
+	ScopeContinent = "continent"
+)
+
+var (
+	countryCodeRegex = regexp.MustCompile(`^[A-Z]{2}$`)
+
+	// continent codes of the GeoIP2 databases
+	continentCodes = map[string]bool{
+		"AF": true,
+		"AN": true,
+		"AS": true,
+		"EU": true,
+		"NA": true,
+		"OC": true,
+		"SA": true,
+	}
+)
+
+// Rule routes the requests of a country or a continent to a service
+type Rule struct {
+	// Scope is either country or continent
+	Scope string `json:"scope"`
+	// Code is the code of the country or the continent
+	Code string `json:"code"`
+	// Service receiving the requests, in the namespace of the ingress
+	Service *apiv1.Service `json:"-"`
+	// Backend is the name of the upstream of the service.
+	// It is set by the controller only if the service has endpoints
+	Backend string `json:"backend,omitempty"`
+}
+
+// Equal tests for equality between two Rule types
+func (r1 *Rule) Equal(r2 *Rule) bool {
+	if r1 == r2 {
+		return true
+	}
+	if r1 == nil || r2 == nil {
+		return false
+	}
+	if r1.Scope != r2.Scope || r1.Code != r2.Code {
+		return false
+	}
+	if !equalServices(r1.Service, r2.Service) {
+		return false
+	}
+	if r1.Backend != r2.Backend {
+		return false
+	}
+
+	return true
+}
+
+// Config contains the services receiving the requests of the clients
+// depending on their location
+type Config struct {
+	// Rules are the services of the countries and continents. The rule of
+	// the country of a client takes precedence over the one of its continent
+	Rules []Rule `json:"rules,omitempty"`
+	// DefaultService receives the requests of the clients matching no rule.
+	// The backend of the location is used when it is not set
+	DefaultService *apiv1.Service `json:"-"`
+	// DefaultBackend is the name of the upstream of the default service.
+	// It is set by the controller only if the service has endpoints
+	DefaultBackend string `json:"defaultBackend,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if len(c1.Rules) != len(c2.Rules) {
+		return false
+	}
+	for i := range c1.Rules {
+		if !(&c1.Rules[i]).Equal(&c2.Rules[i]) {
+			return false
+		}
+	}
+	if !equalServices(c1.DefaultService, c2.DefaultService) {
+		return false
+	}
+	if c1.DefaultBackend != c2.DefaultBackend {
+		return false
+	}
+
+	return true
+}
+
+func equalServices(s1, s2 *apiv1.Service) bool {
+	if (s1 == nil) != (s2 == nil) {
+		return false
+	}
+	if s1 != nil && (s1.Namespace != s2.Namespace || s1.Name != s2.Name) {
+		return false
+	}
+
+	return true
+}
+
+type geoRouting struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new geo routing annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return geoRouting{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to route the requests to a service depending on the country or the
+// continent of the client
+func (g geoRouting) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	s, err := parser.GetStringAnnotation("geo-routing", ing)
+	if err != nil {
+		return config, nil
+	}
+
+	rules, services, err := parseRules(s)
+	if err != nil {
+		return config, err
+	}
+
+	for i := range rules {
+		rules[i].Service, err = g.getService(ing, services[i])
+		if err != nil {
+			return config, err
+		}
+	}
+
+	config.Rules = rules
+
+	d, err := parser.GetStringAnnotation("geo-routing-default-service", ing)
+	if err == nil {
+		config.DefaultService, err = g.getService(ing, d)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	return config, nil
+}
+
+func (g geoRouting) getService(ing *networking.Ingress, name string) (*apiv1.Service, error) {
+	key := fmt.Sprintf("%v/%v", ing.Namespace, name)
+	svc, err := g.r.GetService(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unexpected error reading service %v", key)
+	}
+
+	return svc, nil
+}
+
+// parseRules parses a comma separated list of <scope>:<code>=<service>
+// rules, like continent:EU=eu-service,country:US=us-service, and returns
+// the rules with the names of their services
+func parseRules(s string) ([]Rule, []string, error) {
+	rules := []Rule{}
+	services := []string{}
+	seen := map[string]bool{}
+
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		invalid := ing_errors.NewInvalidAnnotationContent("geo-routing", r)
+
+		parts := strings.SplitN(r, "=", 2)
+		if len(parts) != 2 {
+			return nil, nil, invalid
+		}
+
+		region := strings.SplitN(strings.TrimSpace(parts[0]), ":", 2)
+		if len(region) != 2 {
+			return nil, nil, invalid
+		}
+
+		scope := strings.ToLower(strings.TrimSpace(region[0]))
+		code := strings.ToUpper(strings.TrimSpace(region[1]))
+		switch scope {
+		case ScopeCountry:
+			if !countryCodeRegex.MatchString(code) {
+				return nil, nil, invalid
+			}
+		case ScopeContinent:
+			if !continentCodes[code] {
+				return nil, nil, invalid
+			}
+		default:
+			return nil, nil, invalid
+		}
+
+		service := strings.TrimSpace(parts[1])
+		if service == "" || seen[scope+":"+code] {
+			return nil, nil, invalid
+		}
+		seen[scope+":"+code] = true
+
+		rules = append(rules, Rule{Scope: scope, Code: code})
+		services = append(services, service)
+	}
+
+	return rules, services, nil
+}
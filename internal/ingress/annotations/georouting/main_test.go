@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package georouting
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+type mockService struct {
+	resolver.Mock
+}
+
+// GetService mocks the GetService call from the georouting package
+func (m mockService) GetService(name string) (*api.Service, error) {
+	switch name {
+	case "default/eu-service", "default/us-service", "default/global-service":
+		return &api.Service{
+			ObjectMeta: meta_v1.ObjectMeta{
+				Namespace: api.NamespaceDefault,
+				Name:      name[len("default/"):],
+			},
+		}, nil
+	}
+
+	return nil, errors.Errorf("there is no service with name %v", name)
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title          string
+		annotations    map[string]string
+		rules          []string
+		defaultService string
+		expErr         bool
+	}{
+		{"no annotation", map[string]string{}, nil, "", false},
+		{"continent and country", map[string]string{"geo-routing": "continent:EU=eu-service, country:us=us-service"}, []string{"continent:EU:eu-service", "country:US:us-service"}, "", false},
+		{"default service", map[string]string{"geo-routing": "continent:EU=eu-service", "geo-routing-default-service": "global-service"}, []string{"continent:EU:eu-service"}, "global-service", false},
+		{"unknown continent", map[string]string{"geo-routing": "continent:XX=eu-service"}, nil, "", true},
+		{"invalid country", map[string]string{"geo-routing": "country:USA=us-service"}, nil, "", true},
+		{"unknown scope", map[string]string{"geo-routing": "city:Paris=eu-service"}, nil, "", true},
+		{"missing service", map[string]string{"geo-routing": "continent:EU="}, nil, "", true},
+		{"duplicated region", map[string]string{"geo-routing": "continent:EU=eu-service,continent:eu=us-service"}, nil, "", true},
+		{"unknown service", map[string]string{"geo-routing": "continent:EU=unknown"}, nil, "", true},
+		{"unknown default service", map[string]string{"geo-routing": "continent:EU=eu-service", "geo-routing-default-service": "unknown"}, nil, "", true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&mockService{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		config, ok := i.(Config)
+		if !ok {
+			t.Errorf("%v: expected a Config type but got %T", test.title, i)
+			continue
+		}
+
+		var rules []string
+		for _, r := range config.Rules {
+			rules = append(rules, r.Scope+":"+r.Code+":"+r.Service.Name)
+		}
+		if !reflect.DeepEqual(rules, test.rules) {
+			t.Errorf("%v: expected rules %v but got %v", test.title, test.rules, rules)
+		}
+
+		defaultService := ""
+		if config.DefaultService != nil {
+			defaultService = config.DefaultService.Name
+		}
+		if defaultService != test.defaultService {
+			t.Errorf("%v: expected default service %q but got %q", test.title, test.defaultService, defaultService)
+		}
+	}
+}
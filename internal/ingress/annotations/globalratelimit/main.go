@@ -17,11 +17,15 @@ limitations under the License.
 package globalratelimit
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
@@ -32,13 +36,89 @@ import (
 
 const defaultKey = "$remote_addr"
 
+// keyVariableRegex matches the NGINX variables of the global-rate-limit-key
+// annotation, like $remote_addr or ${http_x_api_key}
+var keyVariableRegex = regexp.MustCompile(`\$(\{[^}]*\}?|[0-9a-zA-Z_]*)`)
+
+// keyVariableNameRegex matches the name of a variable of the key
+var keyVariableNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// keyVariables are the NGINX variables accepted in the key, besides the
+// headers, cookies and arguments of the request
+var keyVariables = map[string]bool{
+	"remote_addr":            true,
+	"binary_remote_addr":     true,
+	"remote_user":            true,
+	"host":                   true,
+	"server_name":            true,
+	"scheme":                 true,
+	"request_method":         true,
+	"uri":                    true,
+	"request_uri":            true,
+	"ssl_client_s_dn":        true,
+	"ssl_client_fingerprint": true,
+	"ssl_server_name":        true,
+	"namespace":              true,
+	"ingress_name":           true,
+	"service_name":           true,
+}
+
+// keyVariablePrefixes are the prefixes of the variables of the headers,
+// cookies and arguments of the request accepted in the key
+var keyVariablePrefixes = []string{"http_", "cookie_", "arg_"}
+
+// headerNameRegex matches the names of the headers of the
+// global-rate-limit-ignored-headers annotation
+var headerNameRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// validStores are the stores a GlobalRateLimitPolicy can override
+// global-rate-limit-store with, empty to keep it
+var validStores = map[string]bool{"": true, "memcached": true, "redis": true}
+
+// bucketRegex matches the buckets of the global-rate-limit-config
+// annotation, like login: 10/1m
+var bucketRegex = regexp.MustCompile(`^([a-zA-Z0-9_-]+)\s*:\s*([0-9]+)\s*/\s*([0-9a-z.]+)$`)
+
 // Config encapsulates all global rate limit attributes
 type Config struct {
-	Namespace    string   `json:"namespace"`
-	Limit        int      `json:"limit"`
-	WindowSize   int      `json:"window-size"`
-	Key          string   `json:"key"`
+	Namespace  string `json:"namespace"`
+	Limit      int    `json:"limit"`
+	WindowSize int    `json:"window-size"`
+	Key        string `json:"key"`
+	// KeyHash replaces the value of the key by its HMAC before it is sent to
+	// the store, to avoid storing personal data in plain text
+	KeyHash      bool     `json:"key-hash"`
 	IgnoredCIDRs []string `json:"ignored-cidrs"`
+	// IgnoredHeaders contains the headers exempting the requests with
+	// their value from the limit, like the token of a trusted partner
+	IgnoredHeaders []IgnoredHeader `json:"ignored-headers,omitempty"`
+	// Burst is the number of requests over the limit accepted in the window,
+	// delayed to the rate of the limit instead of being rejected
+	Burst int `json:"burst"`
+	// Delay is the number of requests of the burst accepted without delay
+	Delay int `json:"delay"`
+	// Headers adds the X-RateLimit-Limit, X-RateLimit-Remaining and
+	// Retry-After headers to the responses
+	Headers bool `json:"headers"`
+	// Store overrides the store of the counters of global-rate-limit-store,
+	// set by the GlobalRateLimitPolicy of the global-rate-limit-policy annotation
+	Store string `json:"store,omitempty"`
+
+	// Name is the name of a bucket of the global-rate-limit-config annotation
+	Name string `json:"name,omitempty"`
+	// Paths contains the paths of the Ingress counted in the bucket
+	Paths []string `json:"paths,omitempty"`
+	// Buckets contains the limits with independent counters of the
+	// global-rate-limit-config annotation. The paths of the Ingress not
+	// included in any bucket use the limit of the global-rate-limit annotation
+	Buckets []Config `json:"buckets,omitempty"`
+}
+
+// IgnoredHeader is a request header exempting the requests from the limit
+type IgnoredHeader struct {
+	// Name is the lowercase name of the header
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // Equal tests for equality between two Config types
@@ -55,9 +135,46 @@ func (l *Config) Equal(r *Config) bool {
 	if l.Key != r.Key {
 		return false
 	}
+	if l.KeyHash != r.KeyHash {
+		return false
+	}
 	if len(l.IgnoredCIDRs) != len(r.IgnoredCIDRs) || !sets.StringElementsMatch(l.IgnoredCIDRs, r.IgnoredCIDRs) {
 		return false
 	}
+	if len(l.IgnoredHeaders) != len(r.IgnoredHeaders) {
+		return false
+	}
+	for i := range l.IgnoredHeaders {
+		if l.IgnoredHeaders[i] != r.IgnoredHeaders[i] {
+			return false
+		}
+	}
+	if l.Burst != r.Burst {
+		return false
+	}
+	if l.Delay != r.Delay {
+		return false
+	}
+	if l.Headers != r.Headers {
+		return false
+	}
+	if l.Store != r.Store {
+		return false
+	}
+	if l.Name != r.Name {
+		return false
+	}
+	if len(l.Paths) != len(r.Paths) || !sets.StringElementsMatch(l.Paths, r.Paths) {
+		return false
+	}
+	if len(l.Buckets) != len(r.Buckets) {
+		return false
+	}
+	for i := range l.Buckets {
+		if !(&l.Buckets[i]).Equal(&r.Buckets[i]) {
+			return false
+		}
+	}
 
 	return true
 }
@@ -76,17 +193,28 @@ func NewParser(r resolver.Resolver) parser.IngressAnnotation {
 func (a globalratelimit) Parse(ing *networking.Ingress) (interface{}, error) {
 	config := &Config{}
 
+	policy, _ := parser.GetStringAnnotation("global-rate-limit-policy", ing)
+	if len(policy) != 0 {
+		return a.parsePolicy(ing, policy)
+	}
+
 	limit, _ := parser.GetIntAnnotation("global-rate-limit", ing)
 	rawWindowSize, _ := parser.GetStringAnnotation("global-rate-limit-window", ing)
+	rawBuckets, _ := parser.GetStringAnnotation("global-rate-limit-config", ing)
 
-	if limit == 0 || len(rawWindowSize) == 0 {
+	hasLimit := limit != 0 && len(rawWindowSize) != 0
+	if !hasLimit && len(rawBuckets) == 0 {
 		return config, nil
 	}
 
-	windowSize, err := time.ParseDuration(rawWindowSize)
-	if err != nil {
-		return config, ing_errors.LocationDenied{
-			Reason: errors.Wrap(err, "failed to parse 'global-rate-limit-window' value"),
+	var windowSize time.Duration
+	if hasLimit {
+		var err error
+		windowSize, err = time.ParseDuration(rawWindowSize)
+		if err != nil {
+			return config, ing_errors.LocationDenied{
+				Reason: errors.Wrap(err, "failed to parse 'global-rate-limit-window' value"),
+			}
 		}
 	}
 
@@ -101,11 +229,287 @@ func (a globalratelimit) Parse(ing *networking.Ingress) (interface{}, error) {
 		return nil, err
 	}
 
+	rawIgnoredHeaders, _ := parser.GetStringAnnotation("global-rate-limit-ignored-headers", ing)
+	ignoredHeaders, err := parseIgnoredHeaders(rawIgnoredHeaders)
+	if err != nil {
+		return config, err
+	}
+
+	burst, err := parser.GetIntAnnotation("global-rate-limit-burst", ing)
+	if err != nil {
+		burst = 0
+	}
+	if burst < 0 {
+		return config, ing_errors.NewLocationDenied("global-rate-limit-burst cannot be negative")
+	}
+
+	delay, err := parser.GetIntAnnotation("global-rate-limit-delay", ing)
+	if err != nil {
+		delay = 0
+	}
+	if delay < 0 || delay > burst {
+		return config, ing_errors.NewLocationDenied("global-rate-limit-delay has to be between 0 and global-rate-limit-burst")
+	}
+
+	namespace := strings.Replace(string(ing.UID), "-", "", -1)
+
+	buckets, err := parseBuckets(rawBuckets)
+	if err != nil {
+		return config, err
+	}
+
+	rawPaths, _ := parser.GetStringAnnotation("global-rate-limit-paths", ing)
+	err = assignPaths(buckets, rawPaths)
+	if err != nil {
+		return config, err
+	}
+
+	for i := range buckets {
+		buckets[i].Namespace = bucketNamespace(namespace, buckets[i].Name)
+		buckets[i].Key = key
+		buckets[i].IgnoredCIDRs = ignoredCIDRs
+		buckets[i].IgnoredHeaders = ignoredHeaders
+		buckets[i].Burst = burst
+		buckets[i].Delay = delay
+	}
+
+	if hasLimit {
+		config.Namespace = namespace
+		config.Limit = limit
+		config.WindowSize = int(windowSize.Seconds())
+	}
+	config.Key = key
+	config.KeyHash, _ = parser.GetBoolAnnotation("global-rate-limit-key-hash", ing)
+	config.IgnoredCIDRs = ignoredCIDRs
+	config.IgnoredHeaders = ignoredHeaders
+	config.Burst = burst
+	config.Delay = delay
+	config.Headers, _ = parser.GetBoolAnnotation("global-rate-limit-headers", ing)
+	config.Buckets = buckets
+
+	return config, nil
+}
+
+// parsePolicy returns the configuration of the GlobalRateLimitPolicy of the
+// global-rate-limit-policy annotation, in the namespace of the Ingress. The
+// other global-rate-limit annotations are ignored.
+func (a globalratelimit) parsePolicy(ing *networking.Ingress, name string) (*Config, error) {
+	config := &Config{}
+
+	if strings.Contains(name, "/") {
+		return config, ing_errors.NewLocationDenied(fmt.Sprintf("invalid GlobalRateLimitPolicy %q in global-rate-limit-policy, the policy has to be in the namespace of the Ingress", name))
+	}
+
+	key := fmt.Sprintf("%v/%v", ing.Namespace, name)
+	policy, err := a.r.GetGlobalRateLimitPolicy(key)
+	if err != nil {
+		return config, ing_errors.LocationDenied{
+			Reason: errors.Wrapf(err, "unexpected error reading GlobalRateLimitPolicy %v", key),
+		}
+	}
+
+	if policy.Limit <= 0 {
+		return config, ing_errors.NewLocationDenied(fmt.Sprintf("invalid limit of GlobalRateLimitPolicy %v", key))
+	}
+
+	windowSize, err := time.ParseDuration(policy.Window)
+	if err != nil || windowSize < time.Second {
+		return config, ing_errors.NewLocationDenied(fmt.Sprintf("invalid window of GlobalRateLimitPolicy %v", key))
+	}
+
+	rateLimitKey := policy.Key
+	if len(rateLimitKey) == 0 {
+		rateLimitKey = defaultKey
+	}
+	err = ValidateKey(fmt.Sprintf("the key of GlobalRateLimitPolicy %v", key), rateLimitKey)
+	if err != nil {
+		return config, err
+	}
+
+	ignoredCIDRs, err := net.ParseCIDRs(strings.Join(policy.Exemptions.CIDRs, ","))
+	if err != nil {
+		return config, ing_errors.LocationDenied{
+			Reason: errors.Wrapf(err, "invalid exempted CIDRs of GlobalRateLimitPolicy %v", key),
+		}
+	}
+
+	var ignoredHeaders []IgnoredHeader
+	for _, header := range policy.Exemptions.Headers {
+		if !headerNameRegex.MatchString(header.Name) || header.Value == "" {
+			return config, ing_errors.NewLocationDenied(fmt.Sprintf("invalid exempted header %q of GlobalRateLimitPolicy %v", header.Name, key))
+		}
+
+		ignoredHeaders = append(ignoredHeaders, IgnoredHeader{
+			Name:  strings.ToLower(header.Name),
+			Value: header.Value,
+		})
+	}
+
+	if !validStores[policy.Store] {
+		return config, ing_errors.NewLocationDenied(fmt.Sprintf("invalid store %q of GlobalRateLimitPolicy %v, expected memcached or redis", policy.Store, key))
+	}
+
 	config.Namespace = strings.Replace(string(ing.UID), "-", "", -1)
-	config.Limit = limit
+	config.Limit = policy.Limit
 	config.WindowSize = int(windowSize.Seconds())
-	config.Key = key
+	config.Key = rateLimitKey
 	config.IgnoredCIDRs = ignoredCIDRs
+	config.IgnoredHeaders = ignoredHeaders
+	config.Store = policy.Store
 
 	return config, nil
 }
+
+// ValidateKey checks the variables of a key like the one of a
+// GlobalRateLimitPolicy, composed of several variables like
+// ${remote_addr}:${http_x_api_key}. The global-rate-limit-key annotation is
+// not checked, to keep accepting the keys configured before the check
+func ValidateKey(annotation, key string) error {
+	for _, match := range keyVariableRegex.FindAllStringSubmatch(key, -1) {
+		name := match[1]
+		if strings.HasPrefix(name, "{") {
+			name = strings.TrimSuffix(strings.TrimPrefix(name, "{"), "}")
+			if !strings.HasSuffix(match[1], "}") {
+				name = ""
+			}
+		}
+		if !keyVariableNameRegex.MatchString(name) || !isKeyVariable(name) {
+			return ing_errors.NewLocationDenied(fmt.Sprintf("variable %q is not allowed in %v", match[0], annotation))
+		}
+	}
+
+	return nil
+}
+
+func isKeyVariable(name string) bool {
+	if keyVariables[name] {
+		return true
+	}
+
+	for _, prefix := range keyVariablePrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseIgnoredHeaders returns the headers of the
+// global-rate-limit-ignored-headers annotation, a comma separated list of
+// <header>: <value>
+func parseIgnoredHeaders(value string) ([]IgnoredHeader, error) {
+	var headers []IgnoredHeader
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		i := strings.Index(item, ":")
+		if i == -1 {
+			return nil, ing_errors.NewLocationDenied(fmt.Sprintf("invalid header %q in global-rate-limit-ignored-headers, expected <header>: <value>", item))
+		}
+
+		name, headerValue := strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		if !headerNameRegex.MatchString(name) || headerValue == "" {
+			return nil, ing_errors.NewLocationDenied(fmt.Sprintf("invalid header %q in global-rate-limit-ignored-headers, expected <header>: <value>", item))
+		}
+
+		headers = append(headers, IgnoredHeader{
+			Name:  strings.ToLower(name),
+			Value: headerValue,
+		})
+	}
+
+	return headers, nil
+}
+
+// parseBuckets returns the buckets of the global-rate-limit-config annotation,
+// a comma separated list of <name>: <limit>/<window>
+func parseBuckets(value string) ([]Config, error) {
+	var buckets []Config
+	names := map[string]bool{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		match := bucketRegex.FindStringSubmatch(item)
+		if match == nil {
+			return nil, ing_errors.NewLocationDenied(fmt.Sprintf("invalid bucket %q in global-rate-limit-config, expected <name>: <limit>/<window>", item))
+		}
+
+		name := match[1]
+		if names[name] {
+			return nil, ing_errors.NewLocationDenied(fmt.Sprintf("duplicated bucket %v in global-rate-limit-config", name))
+		}
+		names[name] = true
+
+		limit, err := strconv.Atoi(match[2])
+		if err != nil || limit == 0 {
+			return nil, ing_errors.NewLocationDenied(fmt.Sprintf("invalid limit of the bucket %v in global-rate-limit-config", name))
+		}
+
+		windowSize, err := time.ParseDuration(match[3])
+		if err != nil || windowSize < time.Second {
+			return nil, ing_errors.NewLocationDenied(fmt.Sprintf("invalid window of the bucket %v in global-rate-limit-config", name))
+		}
+
+		buckets = append(buckets, Config{
+			Name:       name,
+			Limit:      limit,
+			WindowSize: int(windowSize.Seconds()),
+		})
+	}
+
+	return buckets, nil
+}
+
+// assignPaths adds the paths of the global-rate-limit-paths annotation, a
+// comma separated list of <path>: <bucket name>, to their buckets
+func assignPaths(buckets []Config, value string) error {
+	assigned := map[string]bool{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		i := strings.LastIndex(item, ":")
+		if i == -1 {
+			return ing_errors.NewLocationDenied(fmt.Sprintf("invalid path %q in global-rate-limit-paths, expected <path>: <bucket name>", item))
+		}
+
+		path, name := strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		if !strings.HasPrefix(path, "/") || assigned[path] {
+			return ing_errors.NewLocationDenied(fmt.Sprintf("invalid or duplicated path %q in global-rate-limit-paths", path))
+		}
+		assigned[path] = true
+
+		found := false
+		for j := range buckets {
+			if buckets[j].Name == name {
+				buckets[j].Paths = append(buckets[j].Paths, path)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return ing_errors.NewLocationDenied(fmt.Sprintf("unknown bucket %v of the path %v in global-rate-limit-paths", name, path))
+		}
+	}
+
+	return nil
+}
+
+// bucketNamespace returns the namespace of the counters of a bucket, with
+// the length of the namespace of the Ingress supported by lua-resty-global-throttle
+func bucketNamespace(namespace, name string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(namespace+"/"+name)))[:32]
+}
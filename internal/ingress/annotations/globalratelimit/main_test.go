@@ -23,10 +23,9 @@ import (
 
 	"github.com/pkg/errors"
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -37,8 +36,12 @@ const expectedUID = "31285d47b1504dcfbd6f12c46d769f6e"
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -48,9 +51,13 @@ func buildIngress() *networking.Ingress {
 			UID:       UID,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -81,7 +88,14 @@ func TestGlobalRateLimiting(t *testing.T) {
 	annRateLimit := parser.GetAnnotationWithPrefix("global-rate-limit")
 	annRateLimitWindow := parser.GetAnnotationWithPrefix("global-rate-limit-window")
 	annRateLimitKey := parser.GetAnnotationWithPrefix("global-rate-limit-key")
+	annRateLimitKeyHash := parser.GetAnnotationWithPrefix("global-rate-limit-key-hash")
 	annRateLimitIgnoredCIDRs := parser.GetAnnotationWithPrefix("global-rate-limit-ignored-cidrs")
+	annRateLimitIgnoredHeaders := parser.GetAnnotationWithPrefix("global-rate-limit-ignored-headers")
+	annRateLimitConfig := parser.GetAnnotationWithPrefix("global-rate-limit-config")
+	annRateLimitPaths := parser.GetAnnotationWithPrefix("global-rate-limit-paths")
+	annRateLimitHeaders := parser.GetAnnotationWithPrefix("global-rate-limit-headers")
+	annRateLimitBurst := parser.GetAnnotationWithPrefix("global-rate-limit-burst")
+	annRateLimitDelay := parser.GetAnnotationWithPrefix("global-rate-limit-delay")
 
 	testCases := []struct {
 		title          string
@@ -143,6 +157,204 @@ func TestGlobalRateLimiting(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"global-rate-limit-headers annotation",
+			map[string]string{
+				annRateLimit:        "100",
+				annRateLimitWindow:  "2m",
+				annRateLimitHeaders: "true",
+			},
+			&Config{
+				Namespace:    expectedUID,
+				Limit:        100,
+				WindowSize:   120,
+				Key:          "$remote_addr",
+				IgnoredCIDRs: make([]string, 0),
+				Headers:      true,
+			},
+			nil,
+		},
+		{
+			"global-rate-limit-burst and global-rate-limit-delay annotations",
+			map[string]string{
+				annRateLimit:       "100",
+				annRateLimitWindow: "2m",
+				annRateLimitBurst:  "20",
+				annRateLimitDelay:  "5",
+			},
+			&Config{
+				Namespace:    expectedUID,
+				Limit:        100,
+				WindowSize:   120,
+				Key:          "$remote_addr",
+				IgnoredCIDRs: make([]string, 0),
+				Burst:        20,
+				Delay:        5,
+			},
+			nil,
+		},
+		{
+			"global-rate-limit-delay over the burst",
+			map[string]string{
+				annRateLimit:       "100",
+				annRateLimitWindow: "2m",
+				annRateLimitBurst:  "5",
+				annRateLimitDelay:  "10",
+			},
+			&Config{},
+			ing_errors.NewLocationDenied("global-rate-limit-delay has to be between 0 and global-rate-limit-burst"),
+		},
+		{
+			"negative global-rate-limit-burst",
+			map[string]string{
+				annRateLimit:       "100",
+				annRateLimitWindow: "2m",
+				annRateLimitBurst:  "-1",
+			},
+			&Config{},
+			ing_errors.NewLocationDenied("global-rate-limit-burst cannot be negative"),
+		},
+		{
+			"global-rate-limit-config and global-rate-limit-paths annotations",
+			map[string]string{
+				annRateLimit:       "100",
+				annRateLimitWindow: "2m",
+				annRateLimitConfig: "login: 10/1m, api: 100/1s",
+				annRateLimitPaths:  "/login: login, /api: api, /api/v2: api",
+			},
+			&Config{
+				Namespace:    expectedUID,
+				Limit:        100,
+				WindowSize:   120,
+				Key:          "$remote_addr",
+				IgnoredCIDRs: make([]string, 0),
+				Buckets: []Config{
+					{
+						Name:         "login",
+						Namespace:    bucketNamespace(expectedUID, "login"),
+						Limit:        10,
+						WindowSize:   60,
+						Key:          "$remote_addr",
+						IgnoredCIDRs: make([]string, 0),
+						Paths:        []string{"/login"},
+					},
+					{
+						Name:         "api",
+						Namespace:    bucketNamespace(expectedUID, "api"),
+						Limit:        100,
+						WindowSize:   1,
+						Key:          "$remote_addr",
+						IgnoredCIDRs: make([]string, 0),
+						Paths:        []string{"/api", "/api/v2"},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"global-rate-limit-config annotation without global-rate-limit",
+			map[string]string{
+				annRateLimitConfig: "login: 10/1m",
+				annRateLimitPaths:  "/login: login",
+			},
+			&Config{
+				Key:          "$remote_addr",
+				IgnoredCIDRs: make([]string, 0),
+				Buckets: []Config{
+					{
+						Name:         "login",
+						Namespace:    bucketNamespace(expectedUID, "login"),
+						Limit:        10,
+						WindowSize:   60,
+						Key:          "$remote_addr",
+						IgnoredCIDRs: make([]string, 0),
+						Paths:        []string{"/login"},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			"invalid bucket",
+			map[string]string{
+				annRateLimitConfig: "login 10/1m",
+			},
+			&Config{},
+			ing_errors.NewLocationDenied(`invalid bucket "login 10/1m" in global-rate-limit-config, expected <name>: <limit>/<window>`),
+		},
+		{
+			"path of an unknown bucket",
+			map[string]string{
+				annRateLimitConfig: "login: 10/1m",
+				annRateLimitPaths:  "/api: api",
+			},
+			&Config{},
+			ing_errors.NewLocationDenied("unknown bucket api of the path /api in global-rate-limit-paths"),
+		},
+		{
+			"composed global-rate-limit-key annotation with hash",
+			map[string]string{
+				annRateLimit:        "100",
+				annRateLimitWindow:  "2m",
+				annRateLimitKey:     "${remote_addr}:${http_x_api_key}",
+				annRateLimitKeyHash: "true",
+			},
+			&Config{
+				Namespace:    expectedUID,
+				Limit:        100,
+				WindowSize:   120,
+				Key:          "${remote_addr}:${http_x_api_key}",
+				KeyHash:      true,
+				IgnoredCIDRs: make([]string, 0),
+			},
+			nil,
+		},
+		{
+			"global-rate-limit-key annotation with any variable",
+			map[string]string{
+				annRateLimit:       "100",
+				annRateLimitWindow: "2m",
+				annRateLimitKey:    "${remote_addr}:$upstream_addr",
+			},
+			&Config{
+				Namespace:    expectedUID,
+				Limit:        100,
+				WindowSize:   120,
+				Key:          "${remote_addr}:$upstream_addr",
+				IgnoredCIDRs: make([]string, 0),
+			},
+			nil,
+		},
+		{
+			"global-rate-limit-ignored-headers annotation",
+			map[string]string{
+				annRateLimit:               "100",
+				annRateLimitWindow:         "2m",
+				annRateLimitIgnoredHeaders: "X-Partner-Token: s3cr3t, X-Health-Check: true",
+			},
+			&Config{
+				Namespace:    expectedUID,
+				Limit:        100,
+				WindowSize:   120,
+				Key:          "$remote_addr",
+				IgnoredCIDRs: make([]string, 0),
+				IgnoredHeaders: []IgnoredHeader{
+					{Name: "x-partner-token", Value: "s3cr3t"},
+					{Name: "x-health-check", Value: "true"},
+				},
+			},
+			nil,
+		},
+		{
+			"global-rate-limit-ignored-headers annotation without value",
+			map[string]string{
+				annRateLimit:               "100",
+				annRateLimitWindow:         "2m",
+				annRateLimitIgnoredHeaders: "X-Partner-Token",
+			},
+			&Config{},
+			ing_errors.NewLocationDenied(`invalid header "X-Partner-Token" in global-rate-limit-ignored-headers, expected <header>: <value>`),
+		},
 		{
 			"incorrect duration for window",
 			map[string]string{
@@ -177,3 +389,129 @@ func TestGlobalRateLimiting(t *testing.T) {
 		}
 	}
 }
+
+func TestGlobalRateLimitPolicy(t *testing.T) {
+	ing := buildIngress()
+
+	annRateLimit := parser.GetAnnotationWithPrefix("global-rate-limit")
+	annRateLimitWindow := parser.GetAnnotationWithPrefix("global-rate-limit-window")
+	annRateLimitPolicy := parser.GetAnnotationWithPrefix("global-rate-limit-policy")
+
+	backend := mockBackend{resolver.Mock{
+		GlobalRateLimitPolicies: map[string]*resolver.GlobalRateLimitPolicy{
+			"default/api": {
+				Limit:  100,
+				Window: "1m",
+				Key:    "${http_x_api_key}",
+				Exemptions: resolver.GlobalRateLimitExemptions{
+					CIDRs:   []string{"10.0.0.0/8"},
+					Headers: []resolver.GlobalRateLimitExemptedHeader{{Name: "X-Partner-Token", Value: "s3cr3t"}},
+				},
+				Store: "redis",
+			},
+			"default/defaults":       {Limit: 10, Window: "10s"},
+			"default/invalid-window": {Limit: 10, Window: "10ms"},
+			"default/invalid-key":    {Limit: 10, Window: "10s", Key: "$request_body"},
+			"default/invalid-store":  {Limit: 10, Window: "10s", Store: "etcd"},
+		},
+	}}
+
+	testCases := []struct {
+		title          string
+		annotations    map[string]string
+		expectedConfig *Config
+		expectedErr    error
+	}{
+		{
+			"policy",
+			map[string]string{annRateLimitPolicy: "api"},
+			&Config{
+				Namespace:      expectedUID,
+				Limit:          100,
+				WindowSize:     60,
+				Key:            "${http_x_api_key}",
+				IgnoredCIDRs:   []string{"10.0.0.0/8"},
+				IgnoredHeaders: []IgnoredHeader{{Name: "x-partner-token", Value: "s3cr3t"}},
+				Store:          "redis",
+			},
+			nil,
+		},
+		{
+			"policy with the default values ignoring the other annotations",
+			map[string]string{
+				annRateLimitPolicy: "defaults",
+				annRateLimit:       "100",
+				annRateLimitWindow: "2m",
+			},
+			&Config{
+				Namespace:    expectedUID,
+				Limit:        10,
+				WindowSize:   10,
+				Key:          "$remote_addr",
+				IgnoredCIDRs: make([]string, 0),
+			},
+			nil,
+		},
+		{
+			"missing policy",
+			map[string]string{annRateLimitPolicy: "missing"},
+			&Config{},
+			ing_errors.LocationDenied{
+				Reason: errors.Wrap(fmt.Errorf("no global rate limit policy"), "unexpected error reading GlobalRateLimitPolicy default/missing"),
+			},
+		},
+		{
+			"policy of another namespace",
+			map[string]string{annRateLimitPolicy: "other/api"},
+			&Config{},
+			ing_errors.NewLocationDenied(`invalid GlobalRateLimitPolicy "other/api" in global-rate-limit-policy, the policy has to be in the namespace of the Ingress`),
+		},
+		{
+			"policy with an invalid window",
+			map[string]string{annRateLimitPolicy: "invalid-window"},
+			&Config{},
+			ing_errors.NewLocationDenied("invalid window of GlobalRateLimitPolicy default/invalid-window"),
+		},
+		{
+			"policy with an invalid key",
+			map[string]string{annRateLimitPolicy: "invalid-key"},
+			&Config{},
+			ing_errors.NewLocationDenied(`variable "$request_body" is not allowed in the key of GlobalRateLimitPolicy default/invalid-key`),
+		},
+		{
+			"policy with an invalid store",
+			map[string]string{annRateLimitPolicy: "invalid-store"},
+			&Config{},
+			ing_errors.NewLocationDenied(`invalid store "etcd" of GlobalRateLimitPolicy default/invalid-store, expected memcached or redis`),
+		},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+
+		i, actualErr := NewParser(backend).Parse(ing)
+		if (testCase.expectedErr == nil || actualErr == nil) && testCase.expectedErr != actualErr {
+			t.Errorf("%v: expected error '%v' but got '%v'", testCase.title, testCase.expectedErr, actualErr)
+		} else if testCase.expectedErr != nil && actualErr != nil &&
+			testCase.expectedErr.Error() != actualErr.Error() {
+			t.Errorf("%v: expected error '%v' but got '%v'", testCase.title, testCase.expectedErr, actualErr)
+		}
+
+		actualConfig := i.(*Config)
+		if !testCase.expectedConfig.Equal(actualConfig) {
+			expectedJSON, _ := json.Marshal(testCase.expectedConfig)
+			actualJSON, _ := json.Marshal(actualConfig)
+			t.Errorf("%v: expected config '%s' but got '%s'", testCase.title, expectedJSON, actualJSON)
+		}
+	}
+}
+
+func TestBucketNamespace(t *testing.T) {
+	login := bucketNamespace(expectedUID, "login")
+	if len(login) != len(expectedUID) {
+		t.Errorf("expected a namespace of %v characters but got %v", len(expectedUID), login)
+	}
+	if login == bucketNamespace(expectedUID, "api") || login == expectedUID {
+		t.Errorf("expected the buckets to have independent namespaces")
+	}
+}
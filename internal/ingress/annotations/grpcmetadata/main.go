@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcmetadata
+
+import (
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+// gRPC metadata keys are lowercase, the ones starting with grpc- are
+// reserved and the ones ending with -bin contain binary values
+var metadataKeyRegex = regexp.MustCompile(`^[0-9a-z_.-]+$`)
+
+// Config contains the names of the gRPC metadata used to send
+// information about the client to gRPC backends
+type Config struct {
+	// ClientIP is the name of the metadata containing the address of the client
+	ClientIP string `json:"clientIP,omitempty"`
+	// RequestID is the name of the metadata containing the ID of the request
+	RequestID string `json:"requestID,omitempty"`
+	// TLSPrefix is the prefix of the names of the metadata containing
+	// the details of the TLS connection of the client
+	TLSPrefix string `json:"tlsPrefix,omitempty"`
+}
+
+type grpcMetadata struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new gRPC metadata annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return grpcMetadata{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to send information about the client as gRPC metadata
+func (a grpcMetadata) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	annotations := []struct {
+		name  string
+		value *string
+	}{
+		{"grpc-client-ip-metadata", &config.ClientIP},
+		{"grpc-request-id-metadata", &config.RequestID},
+		{"grpc-tls-metadata-prefix", &config.TLSPrefix},
+	}
+
+	for _, annotation := range annotations {
+		s, err := parser.GetStringAnnotation(annotation.name, ing)
+		if err != nil {
+			continue
+		}
+
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !isValidMetadataKey(s) {
+			return Config{}, ing_errors.NewInvalidAnnotationContent(annotation.name, s)
+		}
+
+		*annotation.value = s
+	}
+
+	return config, nil
+}
+
+func isValidMetadataKey(key string) bool {
+	if !metadataKeyRegex.MatchString(key) {
+		return false
+	}
+
+	return !strings.HasPrefix(key, "grpc-") && !strings.HasSuffix(key, "-bin")
+}
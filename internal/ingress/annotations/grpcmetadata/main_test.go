@@ -0,0 +1,72 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcmetadata
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	clientIP := parser.GetAnnotationWithPrefix("grpc-client-ip-metadata")
+	requestID := parser.GetAnnotationWithPrefix("grpc-request-id-metadata")
+	tlsPrefix := parser.GetAnnotationWithPrefix("grpc-tls-metadata-prefix")
+
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    Config
+		expErr      bool
+	}{
+		{map[string]string{}, Config{}, false},
+		{map[string]string{clientIP: "x-client-ip"}, Config{ClientIP: "x-client-ip"}, false},
+		{map[string]string{clientIP: "X-Client-IP", requestID: "x-request-id", tlsPrefix: "x-tls-"},
+			Config{ClientIP: "x-client-ip", RequestID: "x-request-id", TLSPrefix: "x-tls-"}, false},
+		{map[string]string{clientIP: "grpc-client-ip"}, Config{}, true},
+		{map[string]string{requestID: "request-id-bin"}, Config{}, true},
+		{map[string]string{tlsPrefix: "x tls"}, Config{}, true},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, err := ap.Parse(ing)
+		if (err != nil) != testCase.expErr {
+			t.Errorf("expected error %v but got %v for annotations %v", testCase.expErr, err, testCase.annotations)
+		}
+		if result != testCase.expected {
+			t.Errorf("expected %v but got %v for annotations %v", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthcheck
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	pathAnnotation        = "health-check-path"
+	intervalAnnotation    = "health-check-interval"
+	grpcServiceAnnotation = "health-check-grpc-service"
+	protocolAnnotation    = "health-check-protocol"
+	// the gRPC backends are checked with the gRPC health checking protocol
+	backendProtocolAnnotation = "backend-protocol"
+
+	protocolHTTP = "http"
+	protocolGRPC = "grpc"
+
+	defaultInterval = 10 * time.Second
+	maxTimeout      = 5 * time.Second
+)
+
+var (
+	// pathRegex matches the paths of the HTTP checks, without the spaces and
+	// the control characters ending the request line
+	pathRegex = regexp.MustCompile(`^/[!-~]*$`)
+	// grpcServiceRegex matches the fully-qualified names of the gRPC services
+	grpcServiceRegex = regexp.MustCompile(`^[A-Za-z0-9_.]*$`)
+)
+
+// Config contains the active health check of the endpoints of a backend
+type Config struct {
+	// Path is the path requested to the endpoints by the HTTP checks
+	Path string `json:"path,omitempty"`
+	// GRPC enables the checks using the gRPC health checking protocol
+	GRPC bool `json:"grpc,omitempty"`
+	// GRPCService is the name of the service checked, empty to check the
+	// overall health of the server
+	GRPCService string `json:"grpcService,omitempty"`
+	// GRPCTLS enables TLS for the gRPC checks of the GRPCS backends
+	GRPCTLS bool `json:"grpcTLS,omitempty"`
+	// TLS enables TLS for the HTTP checks of the HTTPS backends
+	TLS bool `json:"tls,omitempty"`
+	// Interval is the time, in seconds, between two checks of an endpoint
+	Interval int `json:"interval,omitempty"`
+	// Timeout is the maximum time, in milliseconds, of a check
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type healthCheck struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new health check annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return healthCheck{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the
+// active health check of the endpoints of the backends. The settings of the
+// ConfigMap are used when the annotations are missing. The endpoints of the
+// GRPC and GRPCS backends are checked with the gRPC health checking protocol,
+// unless the health-check-protocol annotation is http.
+func (a healthCheck) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+	defBackend := a.r.GetDefaultBackend()
+
+	path, err := parser.GetStringAnnotation(pathAnnotation, ing)
+	if err != nil {
+		path = defBackend.HealthCheckPath
+	}
+
+	// an empty service name checks the overall health of the server
+	service, err := parser.GetStringAnnotation(grpcServiceAnnotation, ing)
+	grpcService := err == nil || ing_errors.IsInvalidContent(err)
+	if !grpcService && defBackend.HealthCheckGRPCService != "" {
+		grpcService = true
+		service = defBackend.HealthCheckGRPCService
+	}
+
+	backendProtocol, _ := parser.GetStringAnnotation(backendProtocolAnnotation, ing)
+	backendProtocol = strings.ToUpper(strings.TrimSpace(backendProtocol))
+	grpcBackend := backendProtocol == "GRPC" || backendProtocol == "GRPCS"
+
+	grpc := grpcService || (grpcBackend && path != "")
+
+	protocol, _ := parser.GetStringAnnotation(protocolAnnotation, ing)
+	switch strings.ToLower(strings.TrimSpace(protocol)) {
+	case "":
+	case protocolGRPC:
+		grpc = true
+	case protocolHTTP:
+		grpc = false
+	default:
+		return config, ing_errors.NewInvalidAnnotationContent(protocolAnnotation, protocol)
+	}
+
+	if path == "" && !grpc {
+		return config, nil
+	}
+
+	if !grpc && !pathRegex.MatchString(path) {
+		return config, ing_errors.NewInvalidAnnotationContent(pathAnnotation, path)
+	}
+
+	if grpc && !grpcServiceRegex.MatchString(service) {
+		return config, ing_errors.NewInvalidAnnotationContent(grpcServiceAnnotation, service)
+	}
+
+	interval := defaultInterval
+	rawInterval, err := parser.GetStringAnnotation(intervalAnnotation, ing)
+	if err != nil {
+		rawInterval = defBackend.HealthCheckInterval
+	}
+	if rawInterval != "" {
+		interval, err = time.ParseDuration(rawInterval)
+		if err != nil {
+			return config, ing_errors.LocationDenied{
+				Reason: errors.Wrap(err, "failed to parse 'health-check-interval' value"),
+			}
+		}
+		if interval < time.Second {
+			return config, ing_errors.NewInvalidAnnotationContent(intervalAnnotation, rawInterval)
+		}
+	}
+
+	timeout := interval
+	if timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+
+	if grpc {
+		config.GRPC = true
+		config.GRPCService = service
+		config.GRPCTLS = backendProtocol == "GRPCS"
+	} else {
+		config.Path = path
+		config.TLS = backendProtocol == "HTTPS"
+	}
+	config.Interval = int(interval.Seconds())
+	config.Timeout = int(timeout / time.Millisecond)
+
+	return config, nil
+}
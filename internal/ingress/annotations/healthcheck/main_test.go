@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthcheck
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/defaults"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+type mockBackend struct {
+	resolver.Mock
+	backend defaults.Backend
+}
+
+func (m mockBackend) GetDefaultBackend() defaults.Backend {
+	return m.backend
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		defaults    defaults.Backend
+		expected    Config
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, defaults.Backend{}, Config{}, false},
+		{"path only", map[string]string{"health-check-path": "/healthz"}, defaults.Backend{},
+			Config{Path: "/healthz", Interval: 10, Timeout: 5000}, false},
+		{"path with a short interval", map[string]string{"health-check-path": "/healthz", "health-check-interval": "2s"}, defaults.Backend{},
+			Config{Path: "/healthz", Interval: 2, Timeout: 2000}, false},
+		{"gRPC service", map[string]string{"health-check-grpc-service": "helloworld.Greeter"}, defaults.Backend{},
+			Config{GRPC: true, GRPCService: "helloworld.Greeter", Interval: 10, Timeout: 5000}, false},
+		{"gRPC server", map[string]string{"health-check-grpc-service": ""}, defaults.Backend{},
+			Config{GRPC: true, Interval: 10, Timeout: 5000}, false},
+		{"gRPC takes precedence over the path", map[string]string{"health-check-grpc-service": "helloworld.Greeter"},
+			defaults.Backend{HealthCheckPath: "/healthz"},
+			Config{GRPC: true, GRPCService: "helloworld.Greeter", Interval: 10, Timeout: 5000}, false},
+		{"ConfigMap settings", map[string]string{}, defaults.Backend{HealthCheckPath: "/healthz", HealthCheckInterval: "30s"},
+			Config{Path: "/healthz", Interval: 30, Timeout: 5000}, false},
+		{"annotations override the ConfigMap", map[string]string{"health-check-path": "/ready", "health-check-interval": "5s"},
+			defaults.Backend{HealthCheckPath: "/healthz", HealthCheckInterval: "30s"},
+			Config{Path: "/ready", Interval: 5, Timeout: 5000}, false},
+		{"gRPC backend", map[string]string{"health-check-path": "/healthz", "backend-protocol": "GRPC"}, defaults.Backend{},
+			Config{GRPC: true, Interval: 10, Timeout: 5000}, false},
+		{"gRPC backend with the ConfigMap path", map[string]string{"backend-protocol": "grpcs"},
+			defaults.Backend{HealthCheckPath: "/healthz"},
+			Config{GRPC: true, GRPCTLS: true, Interval: 10, Timeout: 5000}, false},
+		{"gRPC backend without health check", map[string]string{"backend-protocol": "GRPC"}, defaults.Backend{}, Config{}, false},
+		{"gRPC backend checked with HTTP", map[string]string{"health-check-path": "/healthz", "backend-protocol": "GRPC", "health-check-protocol": "http"},
+			defaults.Backend{}, Config{Path: "/healthz", Interval: 10, Timeout: 5000}, false},
+		{"gRPC protocol", map[string]string{"health-check-protocol": "grpc"}, defaults.Backend{},
+			Config{GRPC: true, Interval: 10, Timeout: 5000}, false},
+		{"HTTP protocol without path", map[string]string{"health-check-protocol": "http", "health-check-grpc-service": "helloworld.Greeter"},
+			defaults.Backend{}, Config{}, false},
+		{"invalid protocol", map[string]string{"health-check-protocol": "tcp"}, defaults.Backend{}, Config{}, true},
+		{"HTTPS backend", map[string]string{"health-check-path": "/healthz", "backend-protocol": "HTTPS"},
+			defaults.Backend{}, Config{Path: "/healthz", TLS: true, Interval: 10, Timeout: 5000}, false},
+		{"relative path", map[string]string{"health-check-path": "healthz"}, defaults.Backend{}, Config{}, true},
+		{"path with CR/LF", map[string]string{"health-check-path": "/healthz\r\nX-Injected: true"}, defaults.Backend{}, Config{}, true},
+		{"path with spaces", map[string]string{"health-check-path": "/healthz HTTP/1.0"}, defaults.Backend{}, Config{}, true},
+		{"ConfigMap path with CR/LF", map[string]string{}, defaults.Backend{HealthCheckPath: "/healthz\r\n"}, Config{}, true},
+		{"invalid gRPC service", map[string]string{"health-check-grpc-service": "helloworld.Greeter\n"}, defaults.Backend{}, Config{}, true},
+		{"invalid interval", map[string]string{"health-check-path": "/healthz", "health-check-interval": "10"}, defaults.Backend{}, Config{}, true},
+		{"interval under a second", map[string]string{"health-check-path": "/healthz", "health-check-interval": "500ms"}, defaults.Backend{}, Config{}, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(mockBackend{backend: test.defaults}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+		}
+
+		config, ok := i.(Config)
+		if !ok {
+			t.Errorf("%v: expected a Config type but %T was returned", test.title, i)
+			continue
+		}
+		if config != test.expected {
+			t.Errorf("%v: expected %+v but got %+v", test.title, test.expected, config)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http2
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+	"k8s.io/klog/v2"
+)
+
+type http2 struct {
+	r resolver.Resolver
+}
+
+// Config contains the HTTP/2 configuration of a server
+type Config struct {
+	// Disabled indicates the server only accepts HTTP/1.x connections
+	// even if HTTP/2 is enabled in the configuration
+	Disabled bool `json:"disabled"`
+	// MaxConcurrentStreams sets the maximum number of concurrent HTTP/2
+	// streams in a connection. 0 uses the value of the configuration
+	MaxConcurrentStreams int `json:"maxConcurrentStreams"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if c1.Disabled != c2.Disabled {
+		return false
+	}
+	if c1.MaxConcurrentStreams != c2.MaxConcurrentStreams {
+		return false
+	}
+
+	return true
+}
+
+// NewParser creates a new HTTP/2 annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return http2{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to configure HTTP/2 in the server
+func (h http2) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := &Config{}
+
+	enabled, err := parser.GetBoolAnnotation("enable-http2", ing)
+	if err == nil {
+		config.Disabled = !enabled
+	}
+
+	streams, err := parser.GetIntAnnotation("http2-max-concurrent-streams", ing)
+	if err != nil {
+		return config, nil
+	}
+
+	if streams <= 0 {
+		klog.Warningf("Annotation http2-max-concurrent-streams contains an invalid value: %v", streams)
+		return config, nil
+	}
+
+	config.MaxConcurrentStreams = streams
+
+	return config, nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http2
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	annotationEnableHTTP2 := parser.GetAnnotationWithPrefix("enable-http2")
+	annotationMaxConcurrentStreams := parser.GetAnnotationWithPrefix("http2-max-concurrent-streams")
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    Config
+	}{
+		{map[string]string{annotationEnableHTTP2: "false"}, Config{Disabled: true}},
+		{map[string]string{annotationEnableHTTP2: "true"}, Config{}},
+		{map[string]string{annotationEnableHTTP2: "no"}, Config{}},
+		{map[string]string{annotationMaxConcurrentStreams: "16"}, Config{MaxConcurrentStreams: 16}},
+		{map[string]string{annotationMaxConcurrentStreams: "0"}, Config{}},
+		{map[string]string{annotationMaxConcurrentStreams: "-1"}, Config{}},
+		{map[string]string{annotationEnableHTTP2: "false", annotationMaxConcurrentStreams: "invalid"}, Config{Disabled: true}},
+		{map[string]string{}, Config{}},
+		{nil, Config{}},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, _ := ap.Parse(ing)
+		if !reflect.DeepEqual(result, &testCase.expected) {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
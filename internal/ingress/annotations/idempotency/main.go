@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package idempotency
+
+import (
+	"regexp"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	idempotencyAnnotation       = "idempotency"
+	idempotencyHeaderAnnotation = "idempotency-key-header"
+	idempotencyTTLAnnotation    = "idempotency-key-ttl"
+
+	defaultHeader = "Idempotency-Key"
+	// defaultTTL is the time, in seconds, the responses are replayed
+	defaultTTL = 86400
+)
+
+// headerRegex matches the names of the headers usable as NGINX variables
+var headerRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// Config contains the deduplication of the requests of the locations by
+// idempotency key
+type Config struct {
+	Enabled bool `json:"enabled"`
+	// Header is the name of the header of the requests with the key
+	Header string `json:"header"`
+	// TTL is the time, in seconds, the response of the first request of a
+	// key is replayed to the duplicates
+	TTL int `json:"ttl"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type idempotency struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new idempotency annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return idempotency{r}
+}
+
+// Parse parses the annotations contained in the ingress to deduplicate the
+// requests with the same idempotency key
+func (a idempotency) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	enabled, err := parser.GetBoolAnnotation(idempotencyAnnotation, ing)
+	if err != nil || !enabled {
+		return config, nil
+	}
+
+	header, err := parser.GetStringAnnotation(idempotencyHeaderAnnotation, ing)
+	if err != nil {
+		header = defaultHeader
+	}
+	if !headerRegex.MatchString(header) {
+		return config, ing_errors.NewInvalidAnnotationContent(idempotencyHeaderAnnotation, header)
+	}
+
+	ttl, err := parser.GetIntAnnotation(idempotencyTTLAnnotation, ing)
+	if err != nil {
+		ttl = defaultTTL
+	}
+	if ttl <= 0 {
+		return config, ing_errors.NewInvalidAnnotationContent(idempotencyTTLAnnotation, ttl)
+	}
+
+	config.Enabled = true
+	config.Header = header
+	config.TTL = ttl
+
+	return config, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inflight
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	defaultQueueTimeout = 5 * time.Second
+	defaultRetryAfter   = 1
+)
+
+// Config contains the limit of requests in flight to the backend and the
+// queue of the requests waiting for a slot
+type Config struct {
+	// Limit is the maximum number of requests in flight, zero disables the limit
+	Limit int `json:"limit"`
+	// QueueSize is the number of requests waiting for a slot, the rest are rejected
+	QueueSize int `json:"queueSize"`
+	// QueueTimeout is the maximum time, in milliseconds, a request waits in the queue
+	QueueTimeout int `json:"queueTimeout"`
+	// RetryAfter is the value, in seconds, of the Retry-After header of rejected requests
+	RetryAfter int `json:"retryAfter"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type inflight struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new max in-flight requests annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return inflight{r}
+}
+
+// Parse parses the annotations contained in the ingress to limit the
+// requests in flight to the backends
+func (a inflight) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	limit, err := parser.GetIntAnnotation("max-inflight-requests", ing)
+	if err != nil {
+		return config, nil
+	}
+	if limit <= 0 {
+		return config, ing_errors.NewInvalidAnnotationContent("max-inflight-requests", limit)
+	}
+
+	queueSize, err := parser.GetIntAnnotation("max-inflight-queue-size", ing)
+	if err != nil {
+		queueSize = 0
+	}
+	if queueSize < 0 {
+		return config, ing_errors.NewInvalidAnnotationContent("max-inflight-queue-size", queueSize)
+	}
+
+	queueTimeout := defaultQueueTimeout
+	rawQueueTimeout, err := parser.GetStringAnnotation("max-inflight-queue-timeout", ing)
+	if err == nil {
+		queueTimeout, err = time.ParseDuration(rawQueueTimeout)
+		if err != nil {
+			return config, ing_errors.LocationDenied{
+				Reason: errors.Wrap(err, "failed to parse 'max-inflight-queue-timeout' value"),
+			}
+		}
+		if queueTimeout <= 0 {
+			return config, ing_errors.NewInvalidAnnotationContent("max-inflight-queue-timeout", rawQueueTimeout)
+		}
+	}
+
+	retryAfter, err := parser.GetIntAnnotation("max-inflight-retry-after", ing)
+	if err != nil {
+		retryAfter = defaultRetryAfter
+	}
+	if retryAfter < 0 {
+		return config, ing_errors.NewInvalidAnnotationContent("max-inflight-retry-after", retryAfter)
+	}
+
+	config.Limit = limit
+	config.QueueSize = queueSize
+	config.QueueTimeout = int(queueTimeout / time.Millisecond)
+	config.RetryAfter = retryAfter
+
+	return config, nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package maxrequestduration
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const maxRequestDurationAnnotation = "max-request-duration"
+
+type maxRequestDuration struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new max request duration annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return maxRequestDuration{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the hard
+// limit, in seconds, of the duration of the requests of the location, from
+// the reception of the request to the end of the response. 0 disables it.
+func (a maxRequestDuration) Parse(ing *networking.Ingress) (interface{}, error) {
+	duration, err := parser.GetIntAnnotation(maxRequestDurationAnnotation, ing)
+	if err != nil {
+		return 0, nil
+	}
+
+	if duration < 0 {
+		return 0, ing_errors.NewInvalidAnnotationContent(maxRequestDurationAnnotation, duration)
+	}
+
+	return duration, nil
+}
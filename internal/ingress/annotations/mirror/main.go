@@ -18,18 +18,37 @@ package mirror
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
+// targetRegex matches the targets of the mirror-targets annotation, rendered
+// in the proxy_pass directive of the mirror locations
+var targetRegex = regexp.MustCompile(`^https?://[^\s;{}'"\\]+$`)
+
 // Config returns the mirror to use in a given location
 type Config struct {
 	Source      string `json:"source"`
 	RequestBody string `json:"requestBody"`
 	Target      string `json:"target"`
+	// Targets contains the mirror backends of the mirror-targets annotation
+	Targets []Target `json:"targets,omitempty"`
+}
+
+// Target is a mirror backend receiving a sample of the requests
+type Target struct {
+	// Source is the internal location of the mirror backend
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Percentage is the percentage of the requests mirrored to the backend
+	Percentage int `json:"percentage"`
 }
 
 // Equal tests for equality between two Configuration types
@@ -54,6 +73,16 @@ func (m1 *Config) Equal(m2 *Config) bool {
 		return false
 	}
 
+	if len(m1.Targets) != len(m2.Targets) {
+		return false
+	}
+
+	for i := range m1.Targets {
+		if m1.Targets[i] != m2.Targets[i] {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -85,5 +114,51 @@ func (a mirror) Parse(ing *networking.Ingress) (interface{}, error) {
 		config.Source = ""
 	}
 
+	rawTargets, err := parser.GetStringAnnotation("mirror-targets", ing)
+	if err != nil {
+		return config, nil
+	}
+
+	targets, err := parseTargets(rawTargets, ing)
+	if err != nil {
+		return config, err
+	}
+	config.Targets = targets
+
 	return config, nil
 }
+
+// parseTargets returns the targets of the mirror-targets annotation, a comma
+// separated list of URLs optionally followed by a percentage of the requests,
+// like https://staging.example.com$request_uri 10%
+func parseTargets(value string, ing *networking.Ingress) ([]Target, error) {
+	var targets []Target
+
+	for _, item := range strings.Split(value, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) > 2 || !targetRegex.MatchString(fields[0]) {
+			return nil, ing_errors.NewInvalidAnnotationContent("mirror-targets", value)
+		}
+
+		percentage := 100
+		if len(fields) == 2 {
+			var err error
+			percentage, err = strconv.Atoi(strings.TrimSuffix(fields[1], "%"))
+			if err != nil || percentage < 1 || percentage > 100 {
+				return nil, ing_errors.NewInvalidAnnotationContent("mirror-targets", value)
+			}
+		}
+
+		targets = append(targets, Target{
+			Source:     fmt.Sprintf("/_mirror-%v-%v", ing.UID, len(targets)+1),
+			Target:     fields[0],
+			Percentage: percentage,
+		})
+	}
+
+	return targets, nil
+}
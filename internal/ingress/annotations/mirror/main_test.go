@@ -21,7 +21,7 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -30,6 +30,7 @@ import (
 func TestParse(t *testing.T) {
 	requestBody := parser.GetAnnotationWithPrefix("mirror-request-body")
 	backendURL := parser.GetAnnotationWithPrefix("mirror-target")
+	backendURLs := parser.GetAnnotationWithPrefix("mirror-targets")
 
 	ap := NewParser(&resolver.Mock{})
 	if ap == nil {
@@ -51,6 +52,33 @@ func TestParse(t *testing.T) {
 			RequestBody: "off",
 			Target:      "",
 		}},
+		{map[string]string{backendURLs: "https://staging.env.com$request_uri, http://load-test.env.com$request_uri 10%"}, &Config{
+			Source:      "",
+			RequestBody: "on",
+			Target:      "",
+			Targets: []Target{
+				{Source: ngxURI + "-1", Target: "https://staging.env.com$request_uri", Percentage: 100},
+				{Source: ngxURI + "-2", Target: "http://load-test.env.com$request_uri", Percentage: 10},
+			},
+		}},
+		{map[string]string{backendURL: "https://test.env.com/$request_uri", backendURLs: "https://staging.env.com 50"}, &Config{
+			Source:      ngxURI,
+			RequestBody: "on",
+			Target:      "https://test.env.com/$request_uri",
+			Targets: []Target{
+				{Source: ngxURI + "-1", Target: "https://staging.env.com", Percentage: 50},
+			},
+		}},
+		{map[string]string{backendURLs: "https://staging.env.com 0%"}, &Config{
+			Source:      "",
+			RequestBody: "on",
+			Target:      "",
+		}},
+		{map[string]string{backendURLs: "https://staging.env.com; return 200"}, &Config{
+			Source:      "",
+			RequestBody: "on",
+			Target:      "",
+		}},
 	}
 
 	ing := &networking.Ingress{
@@ -17,11 +17,20 @@ limitations under the License.
 package modsecurity
 
 import (
-	networking "k8s.io/api/networking/v1beta1"
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/klog/v2"
+
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
+	"k8s.io/ingress-nginx/internal/sets"
 )
 
+// ruleIDRegex matches a rule ID or a range of rule IDs
+var ruleIDRegex = regexp.MustCompile(`^[0-9]+(-[0-9]+)?$`)
+
 // Config contains ModSecurity Configuration items
 type Config struct {
 	Enable        bool   `json:"enable-modsecurity"`
@@ -29,6 +38,9 @@ type Config struct {
 	OWASPRules    bool   `json:"enable-owasp-core-rules"`
 	TransactionID string `json:"modsecurity-transaction-id"`
 	Snippet       string `json:"modsecurity-snippet"`
+	// RemoveRules contains the IDs, or ranges of IDs, of the rules
+	// removed in the location
+	RemoveRules []string `json:"modsecurity-remove-rules,omitempty"`
 }
 
 // Equal tests for equality between two Config types
@@ -54,6 +66,9 @@ func (modsec1 *Config) Equal(modsec2 *Config) bool {
 	if modsec1.Snippet != modsec2.Snippet {
 		return false
 	}
+	if len(modsec1.RemoveRules) != len(modsec2.RemoveRules) || !sets.StringElementsMatch(modsec1.RemoveRules, modsec2.RemoveRules) {
+		return false
+	}
 
 	return true
 }
@@ -95,5 +110,30 @@ func (a modSecurity) Parse(ing *networking.Ingress) (interface{}, error) {
 		config.Snippet = ""
 	}
 
+	removeRules, err := parser.GetStringAnnotation("modsecurity-remove-rules", ing)
+	if err == nil {
+		config.RemoveRules = parseRuleIDs(removeRules)
+	}
+
 	return config, nil
 }
+
+// parseRuleIDs returns the valid rule IDs of a comma separated list
+func parseRuleIDs(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		if !ruleIDRegex.MatchString(id) {
+			klog.Warningf("%v is not a valid ModSecurity rule ID, ignoring it", id)
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids
+}
@@ -20,7 +20,7 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -31,6 +31,7 @@ func TestParse(t *testing.T) {
 	owasp := parser.GetAnnotationWithPrefix("enable-owasp-core-rules")
 	transID := parser.GetAnnotationWithPrefix("modsecurity-transaction-id")
 	snippet := parser.GetAnnotationWithPrefix("modsecurity-snippet")
+	removeRules := parser.GetAnnotationWithPrefix("modsecurity-remove-rules")
 
 	ap := NewParser(&resolver.Mock{})
 	if ap == nil {
@@ -41,22 +42,26 @@ func TestParse(t *testing.T) {
 		annotations map[string]string
 		expected    Config
 	}{
-		{map[string]string{enable: "true"}, Config{true, true, false, "", ""}},
-		{map[string]string{enable: "false"}, Config{false, true, false, "", ""}},
-		{map[string]string{enable: ""}, Config{false, false, false, "", ""}},
+		{map[string]string{enable: "true"}, Config{true, true, false, "", "", nil}},
+		{map[string]string{enable: "false"}, Config{false, true, false, "", "", nil}},
+		{map[string]string{enable: ""}, Config{false, false, false, "", "", nil}},
 
-		{map[string]string{owasp: "true"}, Config{false, false, true, "", ""}},
-		{map[string]string{owasp: "false"}, Config{false, false, false, "", ""}},
-		{map[string]string{owasp: ""}, Config{false, false, false, "", ""}},
+		{map[string]string{owasp: "true"}, Config{false, false, true, "", "", nil}},
+		{map[string]string{owasp: "false"}, Config{false, false, false, "", "", nil}},
+		{map[string]string{owasp: ""}, Config{false, false, false, "", "", nil}},
 
-		{map[string]string{transID: "ok"}, Config{false, false, false, "ok", ""}},
-		{map[string]string{transID: ""}, Config{false, false, false, "", ""}},
+		{map[string]string{transID: "ok"}, Config{false, false, false, "ok", "", nil}},
+		{map[string]string{transID: ""}, Config{false, false, false, "", "", nil}},
 
-		{map[string]string{snippet: "ModSecurity Rule"}, Config{false, false, false, "", "ModSecurity Rule"}},
-		{map[string]string{snippet: ""}, Config{false, false, false, "", ""}},
+		{map[string]string{snippet: "ModSecurity Rule"}, Config{false, false, false, "", "ModSecurity Rule", nil}},
+		{map[string]string{snippet: ""}, Config{false, false, false, "", "", nil}},
 
-		{map[string]string{}, Config{false, false, false, "", ""}},
-		{nil, Config{false, false, false, "", ""}},
+		{map[string]string{removeRules: "942100, 920350,930000-930999"}, Config{false, false, false, "", "", []string{"942100", "920350", "930000-930999"}}},
+		{map[string]string{removeRules: "942100,REQUEST-942,;"}, Config{false, false, false, "", "", []string{"942100"}}},
+		{map[string]string{removeRules: ""}, Config{false, false, false, "", "", nil}},
+
+		{map[string]string{}, Config{false, false, false, "", "", nil}},
+		{nil, Config{false, false, false, "", "", nil}},
 	}
 
 	ing := &networking.Ingress{
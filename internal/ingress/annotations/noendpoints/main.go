@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package noendpoints
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	actionAnnotation     = "no-endpoints-action"
+	retryAfterAnnotation = "no-endpoints-retry-after"
+	pageAnnotation       = "no-endpoints-page"
+
+	// ActionBadGateway responds with the status code 502
+	ActionBadGateway = "502"
+	// ActionServiceUnavailable responds with the status code 503, the default
+	ActionServiceUnavailable = "503"
+	// ActionPage serves the page of the no-endpoints-page annotation with the
+	// status code 503
+	ActionPage = "page"
+	// ActionFallback routes the requests to the service of the
+	// fallback-service annotation
+	ActionFallback = "fallback"
+)
+
+// Config contains the response of a location when its backend has no ready
+// endpoints
+type Config struct {
+	// Action is one of 502, 503, page or fallback, empty means 503
+	Action string `json:"action,omitempty"`
+	// RetryAfter is the value, in seconds, of the Retry-After header of the
+	// 503 responses
+	RetryAfter int `json:"retryAfter,omitempty"`
+	// Page is the HTML page served by the page action
+	Page string `json:"page,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type noEndpoints struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new no endpoints annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return noEndpoints{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the
+// response of the locations when the backend has no ready endpoints
+func (a noEndpoints) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	action, err := parser.GetStringAnnotation(actionAnnotation, ing)
+	if err != nil {
+		return config, nil
+	}
+
+	switch action {
+	case ActionBadGateway, ActionServiceUnavailable:
+	case ActionPage:
+		page, err := parser.GetStringAnnotation(pageAnnotation, ing)
+		if err != nil {
+			return config, ing_errors.NewLocationDenied("no-endpoints-page is required by the page action of no-endpoints-action")
+		}
+		config.Page = page
+	case ActionFallback:
+		if _, err := parser.GetStringAnnotation("fallback-service", ing); err != nil {
+			return config, ing_errors.NewLocationDenied("fallback-service is required by the fallback action of no-endpoints-action")
+		}
+	default:
+		return config, ing_errors.NewInvalidAnnotationContent(actionAnnotation, action)
+	}
+
+	if action != ActionBadGateway {
+		retryAfter, err := parser.GetIntAnnotation(retryAfterAnnotation, ing)
+		if err == nil {
+			if retryAfter <= 0 {
+				return config, ing_errors.NewInvalidAnnotationContent(retryAfterAnnotation, retryAfter)
+			}
+			config.RetryAfter = retryAfter
+		}
+	}
+
+	config.Action = action
+
+	return config, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package noendpoints
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		expected    Config
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, Config{}, false},
+		{"bad gateway", map[string]string{"no-endpoints-action": "502"}, Config{Action: "502"}, false},
+		{"bad gateway ignores retry after", map[string]string{
+			"no-endpoints-action":      "502",
+			"no-endpoints-retry-after": "30",
+		}, Config{Action: "502"}, false},
+		{"service unavailable with retry after", map[string]string{
+			"no-endpoints-action":      "503",
+			"no-endpoints-retry-after": "30",
+		}, Config{Action: "503", RetryAfter: 30}, false},
+		{"page", map[string]string{
+			"no-endpoints-action": "page",
+			"no-endpoints-page":   "<h1>Maintenance</h1>",
+		}, Config{Action: "page", Page: "<h1>Maintenance</h1>"}, false},
+		{"page without page", map[string]string{"no-endpoints-action": "page"}, Config{}, true},
+		{"fallback", map[string]string{
+			"no-endpoints-action": "fallback",
+			"fallback-service":    "maintenance",
+		}, Config{Action: "fallback"}, false},
+		{"fallback without service", map[string]string{"no-endpoints-action": "fallback"}, Config{}, true},
+		{"invalid action", map[string]string{"no-endpoints-action": "404"}, Config{}, true},
+		{"invalid retry after", map[string]string{
+			"no-endpoints-action":      "503",
+			"no-endpoints-retry-after": "-1",
+		}, Config{}, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		config, ok := i.(Config)
+		if !ok {
+			t.Errorf("%v: expected a Config type but got %T", test.title, i)
+			continue
+		}
+
+		if config != test.expected {
+			t.Errorf("%v: expected %+v but got %+v", test.title, test.expected, config)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapivalidation
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	schemaRefPrefix = "#/components/schemas/"
+	// maxRefDepth avoids infinite expansion of recursive schemas.
+	// Deeper schemas accept any value
+	maxRefDepth = 10
+)
+
+var (
+	// specKeys contains the keys of the ConfigMap that can contain the specification
+	specKeys = []string{"openapi.yaml", "openapi.yml", "openapi.json"}
+
+	httpMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+	pathParameterRegex = regexp.MustCompile(`\{[^{}/]+\}`)
+)
+
+// Config contains the OpenAPI specification used to validate the requests of a location
+type Config struct {
+	Enabled      bool   `json:"enabled"`
+	ConfigMap    string `json:"configMap"`
+	ValidateBody bool   `json:"validateBody"`
+	// Spec contains the operations extracted from the specification, as JSON.
+	// It is delivered to Lua with the dynamic configuration, the locations
+	// only reference its checksum
+	Spec     string `json:"spec"`
+	Checksum string `json:"checksum"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if c1.Enabled != c2.Enabled {
+		return false
+	}
+	if c1.ConfigMap != c2.ConfigMap {
+		return false
+	}
+	if c1.ValidateBody != c2.ValidateBody {
+		return false
+	}
+	if c1.Checksum != c2.Checksum {
+		return false
+	}
+
+	return true
+}
+
+// Operation describes a request accepted by the specification
+type Operation struct {
+	Method string `json:"method"`
+	// Path is a regular expression matching the path of the operation
+	Path         string      `json:"path"`
+	ContentTypes []string    `json:"content_types,omitempty"`
+	BodyRequired bool        `json:"body_required"`
+	Schema       interface{} `json:"schema,omitempty"`
+
+	parameters int
+}
+
+type document struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]interface{} `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema interface{} `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type openAPIValidation struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new OpenAPI validation annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return openAPIValidation{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to validate the requests against an OpenAPI specification
+func (a openAPIValidation) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	cm, err := parser.GetStringAnnotation("openapi-validation-configmap", ing)
+	if err != nil {
+		return config, nil
+	}
+
+	cmns, cmn, err := cache.SplitMetaNamespaceKey(cm)
+	if err != nil {
+		return config, ing_errors.LocationDenied{
+			Reason: errors.Wrap(err, "error reading configmap name from annotation"),
+		}
+	}
+
+	if cmns == "" {
+		cmns = ing.Namespace
+	}
+
+	cm = fmt.Sprintf("%v/%v", cmns, cmn)
+	cmap, err := a.r.GetConfigMap(cm)
+	if err != nil {
+		return config, ing_errors.LocationDenied{
+			Reason: errors.Wrapf(err, "unexpected error reading configmap %v", cm),
+		}
+	}
+
+	var spec string
+	for _, key := range specKeys {
+		if v, ok := cmap.Data[key]; ok {
+			spec = v
+			break
+		}
+	}
+
+	if spec == "" {
+		return config, ing_errors.LocationDenied{
+			Reason: errors.Errorf("configmap %v does not contain an OpenAPI specification (%v)", cm, strings.Join(specKeys, ", ")),
+		}
+	}
+
+	operations, err := ParseSpec([]byte(spec))
+	if err != nil {
+		return config, ing_errors.LocationDenied{
+			Reason: errors.Wrapf(err, "invalid OpenAPI specification in configmap %v", cm),
+		}
+	}
+
+	data, err := json.Marshal(operations)
+	if err != nil {
+		return config, ing_errors.LocationDenied{
+			Reason: errors.Wrap(err, "unexpected error encoding the OpenAPI operations"),
+		}
+	}
+
+	validateBody, err := parser.GetBoolAnnotation("openapi-validation-body", ing)
+	if err != nil {
+		validateBody = false
+	}
+
+	checksum := sha1.Sum(data)
+
+	config.Enabled = true
+	config.ConfigMap = cm
+	config.ValidateBody = validateBody
+	config.Spec = string(data)
+	config.Checksum = hex.EncodeToString(checksum[:])
+
+	return config, nil
+}
+
+// ParseSpec extracts the operations of an OpenAPI 3 specification, in YAML or JSON format.
+// Operations with fewer path parameters are returned first, as concrete paths have
+// precedence over templated paths.
+func ParseSpec(spec []byte) ([]Operation, error) {
+	data, err := yaml.YAMLToJSON(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := document{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, errors.Errorf("unsupported OpenAPI version %q", doc.OpenAPI)
+	}
+
+	if len(doc.Paths) == 0 {
+		return nil, errors.New("the specification does not contain paths")
+	}
+
+	operations := []Operation{}
+	for path, item := range doc.Paths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, errors.Errorf("invalid path %q", path)
+		}
+
+		for _, method := range httpMethods {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+
+			op := operation{}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, errors.Wrapf(err, "invalid operation %v %v", method, path)
+			}
+
+			compiled := Operation{
+				Method:     strings.ToUpper(method),
+				Path:       pathRegex(path),
+				parameters: len(pathParameterRegex.FindAllString(path, -1)),
+			}
+
+			if op.RequestBody != nil {
+				compiled.BodyRequired = op.RequestBody.Required
+
+				for contentType := range op.RequestBody.Content {
+					compiled.ContentTypes = append(compiled.ContentTypes, strings.ToLower(contentType))
+				}
+				sort.Strings(compiled.ContentTypes)
+
+				contentType := jsonContentType(compiled.ContentTypes)
+				if contentType != "" {
+					for ct, content := range op.RequestBody.Content {
+						if strings.ToLower(ct) != contentType || content.Schema == nil {
+							continue
+						}
+
+						schema, err := resolveRefs(content.Schema, doc.Components.Schemas, 0)
+						if err != nil {
+							return nil, errors.Wrapf(err, "invalid request body schema of %v %v", method, path)
+						}
+
+						compiled.Schema = schema
+					}
+				}
+			}
+
+			operations = append(operations, compiled)
+		}
+	}
+
+	sort.SliceStable(operations, func(i, j int) bool {
+		if operations[i].parameters != operations[j].parameters {
+			return operations[i].parameters < operations[j].parameters
+		}
+		if operations[i].Path != operations[j].Path {
+			return operations[i].Path < operations[j].Path
+		}
+		return operations[i].Method < operations[j].Method
+	})
+
+	return operations, nil
+}
+
+// pathRegex returns a regular expression matching the given path template
+func pathRegex(path string) string {
+	var out strings.Builder
+	out.WriteString("^")
+
+	last := 0
+	for _, loc := range pathParameterRegex.FindAllStringIndex(path, -1) {
+		out.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		out.WriteString("[^/]+")
+		last = loc[1]
+	}
+
+	out.WriteString(regexp.QuoteMeta(path[last:]))
+	out.WriteString("$")
+
+	return out.String()
+}
+
+// jsonContentType returns the JSON content type used to validate the request body
+func jsonContentType(contentTypes []string) string {
+	for _, ct := range contentTypes {
+		if ct == "application/json" {
+			return ct
+		}
+	}
+
+	for _, ct := range contentTypes {
+		if strings.HasSuffix(ct, "+json") {
+			return ct
+		}
+	}
+
+	return ""
+}
+
+// resolveRefs replaces the references to the schemas defined in the components
+// section with the referenced schema
+func resolveRefs(value interface{}, schemas map[string]interface{}, depth int) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if !strings.HasPrefix(ref, schemaRefPrefix) {
+				return nil, errors.Errorf("unsupported reference %q", ref)
+			}
+
+			schema, ok := schemas[strings.TrimPrefix(ref, schemaRefPrefix)]
+			if !ok {
+				return nil, errors.Errorf("undefined schema %q", ref)
+			}
+
+			if depth >= maxRefDepth {
+				return map[string]interface{}{}, nil
+			}
+
+			return resolveRefs(schema, schemas, depth+1)
+		}
+
+		out := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			resolved, err := resolveRefs(val, schemas, depth)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = resolved
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			resolved, err := resolveRefs(val, schemas, depth)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	}
+
+	return value, nil
+}
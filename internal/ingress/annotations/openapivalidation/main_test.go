@@ -0,0 +1,213 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openapivalidation
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const petstore = `
+openapi: 3.0.0
+info:
+  title: Petstore
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          description: pets
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/Pet"
+      responses:
+        "201":
+          description: created
+  /pets/{petId}:
+    get:
+      responses:
+        "200":
+          description: pet
+  /pets/mine:
+    delete:
+      responses:
+        "204":
+          description: deleted
+components:
+  schemas:
+    Pet:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+`
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+}
+
+func buildResolver() resolver.Mock {
+	return resolver.Mock{
+		ConfigMaps: map[string]*api.ConfigMap{
+			"default/petstore": {
+				Data: map[string]string{"openapi.yaml": petstore},
+			},
+			"default/empty": {
+				Data: map[string]string{"README": "no spec"},
+			},
+			"default/invalid": {
+				Data: map[string]string{"openapi.json": `{"swagger": "2.0"}`},
+			},
+		},
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	operations, err := ParseSpec([]byte(petstore))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Operation{
+		{Method: "GET", Path: "^/pets$"},
+		{
+			Method:       "POST",
+			Path:         "^/pets$",
+			ContentTypes: []string{"application/json"},
+			BodyRequired: true,
+			Schema: map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"name"},
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+		{Method: "DELETE", Path: "^/pets/mine$"},
+		{Method: "GET", Path: "^/pets/[^/]+$", parameters: 1},
+	}
+
+	if !reflect.DeepEqual(operations, expected) {
+		t.Errorf("expected %+v but returned %+v", expected, operations)
+	}
+}
+
+func TestParseSpecErrors(t *testing.T) {
+	testCases := map[string]string{
+		"swagger 2":      `{"swagger": "2.0", "paths": {"/": {}}}`,
+		"no paths":       `{"openapi": "3.0.0"}`,
+		"relative path":  `{"openapi": "3.0.0", "paths": {"pets": {"get": {}}}}`,
+		"undefined ref":  `{"openapi": "3.0.0", "paths": {"/": {"post": {"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}}}}`,
+		"external ref":   `{"openapi": "3.0.0", "paths": {"/": {"post": {"requestBody": {"content": {"application/json": {"schema": {"$ref": "pet.yaml"}}}}}}}}`,
+		"invalid format": `openapi: [3.0.0`,
+	}
+
+	for name, spec := range testCases {
+		if _, err := ParseSpec([]byte(spec)); err == nil {
+			t.Errorf("%v: expected an error parsing the specification", name)
+		}
+	}
+}
+
+func TestParseSpecRecursiveSchema(t *testing.T) {
+	spec := `{"openapi": "3.0.1", "paths": {"/nodes": {"post": {"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Node"}}}}}}},
+		"components": {"schemas": {"Node": {"type": "object", "properties": {"child": {"$ref": "#/components/schemas/Node"}}}}}}`
+
+	if _, err := ParseSpec([]byte(spec)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	ing := buildIngress()
+	r := buildResolver()
+
+	i, err := NewParser(r).Parse(ing)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if i.(Config).Enabled {
+		t.Errorf("expected validation to be disabled without annotations")
+	}
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("openapi-validation-configmap"): "petstore",
+		parser.GetAnnotationWithPrefix("openapi-validation-body"):      "true",
+	})
+
+	i, err = NewParser(r).Parse(ing)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	config := i.(Config)
+	if !config.Enabled || !config.ValidateBody || config.ConfigMap != "default/petstore" || config.Checksum == "" {
+		t.Errorf("unexpected configuration %+v", config)
+	}
+
+	operations := []Operation{}
+	if err := json.Unmarshal([]byte(config.Spec), &operations); err != nil {
+		t.Fatalf("unexpected error decoding the specification: %v", err)
+	}
+	if len(operations) != 4 {
+		t.Errorf("expected 4 operations but returned %v", len(operations))
+	}
+
+	for _, cm := range []string{"missing", "empty", "invalid", "a/b/c"} {
+		ing.SetAnnotations(map[string]string{
+			parser.GetAnnotationWithPrefix("openapi-validation-configmap"): cm,
+		})
+
+		_, err = NewParser(r).Parse(ing)
+		if !ing_errors.IsLocationDenied(err) {
+			t.Errorf("%v: expected a location denied error but returned %v", cm, err)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	c1 := &Config{Enabled: true, ConfigMap: "default/petstore", Checksum: "abc"}
+	c2 := &Config{Enabled: true, ConfigMap: "default/petstore", Checksum: "abc"}
+	if !c1.Equal(c2) {
+		t.Errorf("expected equal configurations")
+	}
+
+	c2.Checksum = "def"
+	if c1.Equal(c2) {
+		t.Errorf("expected different configurations")
+	}
+}
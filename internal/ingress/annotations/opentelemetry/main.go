@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opentelemetry
+
+import (
+	"regexp"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+// values are quoted in the NGINX configuration and may contain variables
+var valueRegex = regexp.MustCompile(`^[^"\\\r\n]+$`)
+
+type opentelemetry struct {
+	r resolver.Resolver
+}
+
+// Config contains the configuration to be used in the Ingress
+type Config struct {
+	Enabled       bool   `json:"enabled"`
+	Set           bool   `json:"set"`
+	TrustEnabled  bool   `json:"trustEnabled"`
+	TrustSet      bool   `json:"trustSet"`
+	OperationName string `json:"operationName,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (bd1 *Config) Equal(bd2 *Config) bool {
+	if bd1.Set != bd2.Set {
+		return false
+	}
+
+	if bd1.Enabled != bd2.Enabled {
+		return false
+	}
+
+	if bd1.TrustSet != bd2.TrustSet {
+		return false
+	}
+
+	if bd1.TrustEnabled != bd2.TrustEnabled {
+		return false
+	}
+
+	return bd1.OperationName == bd2.OperationName
+}
+
+// NewParser creates a new opentelemetry annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return opentelemetry{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to enable or disable the OpenTelemetry traces of a location
+func (s opentelemetry) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := &Config{}
+
+	enabled, err := parser.GetBoolAnnotation("enable-opentelemetry", ing)
+	if err == nil {
+		config.Set = true
+		config.Enabled = enabled
+	}
+
+	trust, err := parser.GetBoolAnnotation("opentelemetry-trust-incoming-span", ing)
+	if err == nil {
+		config.TrustSet = true
+		config.TrustEnabled = trust
+	}
+
+	operationName, err := parser.GetStringAnnotation("opentelemetry-operation-name", ing)
+	if err == nil {
+		if !valueRegex.MatchString(operationName) {
+			return config, ing_errors.NewInvalidAnnotationContent("opentelemetry-operation-name", operationName)
+		}
+		config.OperationName = operationName
+	}
+
+	return config, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opentelemetry
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestIngressAnnotationOpentelemetry(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		expected    Config
+		expectErr   bool
+	}{
+		{"unset", map[string]string{}, Config{}, false},
+		{"enabled", map[string]string{"enable-opentelemetry": "true"}, Config{Set: true, Enabled: true}, false},
+		{"disabled", map[string]string{"enable-opentelemetry": "false"}, Config{Set: true}, false},
+		{"trust incoming span", map[string]string{"enable-opentelemetry": "true", "opentelemetry-trust-incoming-span": "false"}, Config{Set: true, Enabled: true, TrustSet: true}, false},
+		{"operation name", map[string]string{"opentelemetry-operation-name": "orders $request_method"}, Config{OperationName: "orders $request_method"}, false},
+		{"invalid operation name", map[string]string{"opentelemetry-operation-name": `orders";`}, Config{}, true},
+	}
+
+	for _, tc := range testCases {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for name, value := range tc.annotations {
+			data[parser.GetAnnotationWithPrefix(name)] = value
+		}
+		ing.SetAnnotations(data)
+
+		val, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if tc.expectErr {
+			if err == nil {
+				t.Errorf("%v: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.name, err)
+		}
+
+		config, ok := val.(*Config)
+		if !ok {
+			t.Fatalf("%v: expected a Config type", tc.name)
+		}
+
+		if !config.Equal(&tc.expected) {
+			t.Errorf("%v: expected %+v but got %+v", tc.name, tc.expected, *config)
+		}
+	}
+}
@@ -17,20 +17,33 @@ limitations under the License.
 package opentracing
 
 import (
-	networking "k8s.io/api/networking/v1beta1"
+	"reflect"
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
+var (
+	// values are quoted in the NGINX configuration and may contain variables
+	valueRegex  = regexp.MustCompile(`^[^"\\\r\n]+$`)
+	tagKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+$`)
+)
+
 type opentracing struct {
 	r resolver.Resolver
 }
 
 // Config contains the configuration to be used in the Ingress
 type Config struct {
-	Enabled bool `json:"enabled"`
-	Set     bool `json:"set"`
+	Enabled       bool              `json:"enabled"`
+	Set           bool              `json:"set"`
+	OperationName string            `json:"operationName,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
 }
 
 // Equal tests for equality between two Config types
@@ -43,6 +56,16 @@ func (bd1 *Config) Equal(bd2 *Config) bool {
 		return false
 	}
 
+	if bd1.OperationName != bd2.OperationName {
+		return false
+	}
+
+	if len(bd1.Tags) != 0 || len(bd2.Tags) != 0 {
+		if !reflect.DeepEqual(bd1.Tags, bd2.Tags) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -51,11 +74,58 @@ func NewParser(r resolver.Resolver) parser.IngressAnnotation {
 	return opentracing{r}
 }
 
+// Parse parses the annotations contained in the ingress rule
+// used to enable opentracing and customize the spans of a location
 func (s opentracing) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := &Config{}
+
 	enabled, err := parser.GetBoolAnnotation("enable-opentracing", ing)
-	if err != nil {
-		return &Config{Set: false, Enabled: false}, nil
+	if err == nil {
+		config.Set = true
+		config.Enabled = enabled
+	}
+
+	operationName, err := parser.GetStringAnnotation("opentracing-operation-name", ing)
+	if err == nil {
+		if !valueRegex.MatchString(operationName) {
+			return config, ing_errors.NewInvalidAnnotationContent("opentracing-operation-name", operationName)
+		}
+		config.OperationName = operationName
+	}
+
+	tags, err := parser.GetStringAnnotation("opentracing-tags", ing)
+	if err == nil {
+		config.Tags, err = parseTags(tags)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	return config, nil
+}
+
+// parseTags parses a comma separated list of key=value span tags
+func parseTags(tags string) (map[string]string, error) {
+	res := map[string]string{}
+
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 {
+			return nil, ing_errors.NewInvalidAnnotationContent("opentracing-tags", tags)
+		}
+
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if !tagKeyRegex.MatchString(key) || !valueRegex.MatchString(value) {
+			return nil, ing_errors.NewInvalidAnnotationContent("opentracing-tags", tags)
+		}
+
+		res[key] = value
 	}
 
-	return &Config{Set: true, Enabled: enabled}, nil
+	return res, nil
 }
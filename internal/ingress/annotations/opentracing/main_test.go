@@ -17,20 +17,24 @@ limitations under the License.
 package opentracing
 
 import (
+	"reflect"
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -39,9 +43,13 @@ func buildIngress() *networking.Ingress {
 			Namespace: api.NamespaceDefault,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -112,3 +120,50 @@ func TestIngressAnnotationOpentracingUnset(t *testing.T) {
 		t.Errorf("expected a Config type")
 	}
 }
+
+func TestIngressAnnotationOpentracingSpanSettings(t *testing.T) {
+	ing := buildIngress()
+
+	data := map[string]string{}
+	data[parser.GetAnnotationWithPrefix("opentracing-operation-name")] = "orders $request_method"
+	data[parser.GetAnnotationWithPrefix("opentracing-tags")] = "team=checkout, namespace=$namespace"
+	ing.SetAnnotations(data)
+
+	val, err := NewParser(&resolver.Mock{}).Parse(ing)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	openTracing, ok := val.(*Config)
+	if !ok {
+		t.Errorf("expected a Config type")
+	}
+
+	if openTracing.Set {
+		t.Errorf("expected enable-opentracing to be unset")
+	}
+	if openTracing.OperationName != "orders $request_method" {
+		t.Errorf("expected operation name 'orders $request_method', got '%v'", openTracing.OperationName)
+	}
+	expected := map[string]string{"team": "checkout", "namespace": "$namespace"}
+	if !reflect.DeepEqual(openTracing.Tags, expected) {
+		t.Errorf("expected tags %v, got %v", expected, openTracing.Tags)
+	}
+}
+
+func TestIngressAnnotationOpentracingInvalidSpanSettings(t *testing.T) {
+	ing := buildIngress()
+
+	for _, data := range []map[string]string{
+		{parser.GetAnnotationWithPrefix("opentracing-operation-name"): `orders";`},
+		{parser.GetAnnotationWithPrefix("opentracing-tags"): "team"},
+		{parser.GetAnnotationWithPrefix("opentracing-tags"): "team name=checkout"},
+		{parser.GetAnnotationWithPrefix("opentracing-tags"): `team=check"out`},
+	} {
+		ing.SetAnnotations(data)
+
+		_, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if err == nil {
+			t.Errorf("expected error for annotations %v", data)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigAnnotation is the name, without prefix, of the annotation with a YAML
+// or JSON document that maps annotation names to their values
+const ConfigAnnotation = "config"
+
+var configKeyRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// MergeConfigAnnotation returns a copy of the Ingress with the entries of the
+// config annotation added as individual annotations. The individual
+// annotations take precedence over the entries of the document. The Ingress
+// is returned as is when it does not contain the config annotation
+func MergeConfigAnnotation(ing *networking.Ingress) (*networking.Ingress, error) {
+	key := GetAnnotationWithPrefix(ConfigAnnotation)
+
+	document, ok := ing.GetAnnotations()[key]
+	if !ok {
+		return ing, nil
+	}
+
+	entries, err := parseConfigDocument(document)
+	if err != nil {
+		return ing, fmt.Errorf("invalid %v annotation: %v", key, err)
+	}
+
+	merged := make(map[string]string, len(ing.GetAnnotations())+len(entries))
+	for name, value := range entries {
+		merged[GetAnnotationWithPrefix(name)] = value
+	}
+	for name, value := range ing.GetAnnotations() {
+		merged[name] = value
+	}
+
+	copyIng := ing.DeepCopy()
+	copyIng.SetAnnotations(merged)
+
+	return copyIng, nil
+}
+
+// parseConfigDocument returns the annotations of the document with their
+// values formatted as the values of individual annotations
+func parseConfigDocument(document string) (map[string]string, error) {
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(document), &raw); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	// report the errors in a stable order
+	sort.Strings(names)
+
+	entries := make(map[string]string, len(raw))
+	for _, name := range names {
+		if !configKeyRegex.MatchString(name) || name == ConfigAnnotation {
+			return nil, fmt.Errorf("invalid annotation name %q, names must not contain the prefix", name)
+		}
+
+		value, err := formatConfigValue(raw[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %v: %v", name, err)
+		}
+
+		entries[name] = value
+	}
+
+	return entries, nil
+}
+
+// formatConfigValue converts strings, booleans, numbers and lists of them
+// to the format of the annotations, lists are comma separated
+func formatConfigValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+
+			s, err := formatConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+
+			items = append(items, s)
+		}
+
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", fmt.Errorf("null values are not supported")
+	default:
+		return "", fmt.Errorf("objects are not supported")
+	}
+}
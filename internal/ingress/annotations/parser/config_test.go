@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeConfigAnnotation(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		exp         map[string]string
+		expErr      bool
+	}{
+		{"no config annotation", map[string]string{"enable-cors": "true"}, map[string]string{"enable-cors": "true"}, false},
+		{"typed values", map[string]string{
+			"config": `
+enable-cors: true
+proxy-read-timeout: 120
+proxy-body-size: 8m
+limit-rps: 0.5
+whitelist-source-range:
+- 10.0.0.0/8
+- 192.168.0.0/16
+`,
+		}, map[string]string{
+			"enable-cors":            "true",
+			"proxy-read-timeout":     "120",
+			"proxy-body-size":        "8m",
+			"limit-rps":              "0.5",
+			"whitelist-source-range": "10.0.0.0/8,192.168.0.0/16",
+		}, false},
+		{"json document", map[string]string{"config": `{"ssl-redirect": false}`}, map[string]string{"ssl-redirect": "false"}, false},
+		{"individual annotations take precedence", map[string]string{
+			"config":          "proxy-body-size: 8m\nenable-cors: true",
+			"proxy-body-size": "1m",
+		}, map[string]string{"proxy-body-size": "1m", "enable-cors": "true"}, false},
+		{"invalid document", map[string]string{"config": "enable-cors: [true"}, nil, true},
+		{"prefixed name", map[string]string{"config": "nginx.ingress.kubernetes.io/enable-cors: true"}, nil, true},
+		{"nested config", map[string]string{"config": "config: 'enable-cors: true'"}, nil, true},
+		{"object value", map[string]string{"config": "enable-cors:\n  enabled: true"}, nil, true},
+		{"null value", map[string]string{"config": "enable-cors:"}, nil, true},
+		{"nested lists", map[string]string{"config": "whitelist-source-range: [[10.0.0.0/8]]"}, nil, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngressWithAnnotations(test.annotations)
+
+		merged, err := MergeConfigAnnotation(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+		if test.expErr {
+			continue
+		}
+
+		exp := map[string]string{}
+		for k, v := range test.exp {
+			exp[GetAnnotationWithPrefix(k)] = v
+		}
+		if _, ok := test.annotations[ConfigAnnotation]; ok {
+			exp[GetAnnotationWithPrefix(ConfigAnnotation)] = test.annotations[ConfigAnnotation]
+		}
+
+		if !reflect.DeepEqual(merged.GetAnnotations(), exp) {
+			t.Errorf("%v: expected %v but got %v", test.title, exp, merged.GetAnnotations())
+		}
+	}
+}
+
+func TestMergeConfigAnnotationDoesNotModifyIngress(t *testing.T) {
+	ing := buildIngressWithAnnotations(map[string]string{"config": "enable-cors: true"})
+
+	if _, err := MergeConfigAnnotation(ing); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ing.GetAnnotations()) != 1 {
+		t.Errorf("expected the annotations of the Ingress to be unchanged but got %v", ing.GetAnnotations())
+	}
+}
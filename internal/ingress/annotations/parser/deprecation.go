@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"sort"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+)
+
+// DeprecatedAnnotation describes an annotation replaced by a new one. The
+// value of the deprecated annotation is used when the Ingress does not
+// contain the new annotation
+type DeprecatedAnnotation struct {
+	// Name is the name of the deprecated annotation, without prefix
+	Name string
+	// ReplacedBy is the name of the annotation that replaces it, without prefix
+	ReplacedBy string
+	// Values maps the values of the deprecated annotation to the values of
+	// the new annotation, the values not present are ignored. When nil, the
+	// value is used as is
+	Values map[string]string
+}
+
+// deprecatedAnnotations contains the annotations renamed across releases.
+// New entries must be documented in the deprecated annotations section of
+// the annotations documentation
+var deprecatedAnnotations = []DeprecatedAnnotation{
+	{Name: "secure-backends", ReplacedBy: "backend-protocol", Values: map[string]string{"true": "HTTPS"}},
+	{Name: "grpc-backend", ReplacedBy: "backend-protocol", Values: map[string]string{"true": "GRPC"}},
+}
+
+// replacements indexes the deprecated annotations by the name of the new
+// annotation, in order of declaration
+var replacements = buildReplacements(deprecatedAnnotations)
+
+func buildReplacements(deprecated []DeprecatedAnnotation) map[string][]DeprecatedAnnotation {
+	r := map[string][]DeprecatedAnnotation{}
+	for _, d := range deprecated {
+		r[d.ReplacedBy] = append(r[d.ReplacedBy], d)
+	}
+
+	return r
+}
+
+// value returns the value of the new annotation from the value of the
+// deprecated annotation, if the Ingress contains it
+func (d DeprecatedAnnotation) value(anns ingAnnotations) (string, bool) {
+	val, ok := anns[GetAnnotationWithPrefix(d.Name)]
+	if !ok {
+		return "", false
+	}
+
+	if d.Values == nil {
+		return val, true
+	}
+
+	val, ok = d.Values[strings.ToLower(strings.TrimSpace(val))]
+	return val, ok
+}
+
+// annotationsWithAliases returns the annotations of the Ingress used to read
+// the annotation name. When the Ingress does not contain it, the value of the
+// first deprecated annotation replaced by name is used
+func annotationsWithAliases(name string, ing *networking.Ingress) ingAnnotations {
+	anns := ingAnnotations(ing.GetAnnotations())
+
+	key := GetAnnotationWithPrefix(name)
+	if _, ok := anns[key]; ok {
+		return anns
+	}
+
+	for _, d := range replacements[name] {
+		if val, ok := d.value(anns); ok {
+			return ingAnnotations{key: val}
+		}
+	}
+
+	return anns
+}
+
+// DeprecatedAnnotationsInUse returns the deprecated annotations contained in
+// the Ingress, sorted by name
+func DeprecatedAnnotationsInUse(ing *networking.Ingress) []DeprecatedAnnotation {
+	if ing == nil || len(ing.GetAnnotations()) == 0 {
+		return nil
+	}
+
+	var inUse []DeprecatedAnnotation
+	for _, d := range deprecatedAnnotations {
+		if _, ok := ing.GetAnnotations()[GetAnnotationWithPrefix(d.Name)]; ok {
+			inUse = append(inUse, d)
+		}
+	}
+
+	sort.Slice(inUse, func(i, j int) bool {
+		return inUse[i].Name < inUse[j].Name
+	})
+
+	return inUse
+}
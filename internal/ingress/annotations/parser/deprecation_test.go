@@ -0,0 +1,114 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func buildIngressWithAnnotations(annotations map[string]string) *networking.Ingress {
+	data := map[string]string{}
+	for k, v := range annotations {
+		data[GetAnnotationWithPrefix(k)] = v
+	}
+
+	return &networking.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   api.NamespaceDefault,
+			Annotations: data,
+		},
+	}
+}
+
+func TestDeprecatedAnnotationAliases(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		exp         string
+		expErr      bool
+	}{
+		{"new annotation", map[string]string{"backend-protocol": "GRPCS"}, "GRPCS", false},
+		{"deprecated annotation", map[string]string{"secure-backends": "true"}, "HTTPS", false},
+		{"deprecated annotation with a different case", map[string]string{"grpc-backend": " True"}, "GRPC", false},
+		{"new annotation takes precedence", map[string]string{"backend-protocol": "AJP", "secure-backends": "true"}, "AJP", false},
+		{"first deprecated annotation takes precedence", map[string]string{"grpc-backend": "true", "secure-backends": "true"}, "HTTPS", false},
+		{"value without replacement", map[string]string{"secure-backends": "false"}, "", true},
+		{"no annotations", map[string]string{"other": "true"}, "", true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngressWithAnnotations(test.annotations)
+
+		val, err := GetStringAnnotation("backend-protocol", ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+		}
+		if val != test.exp {
+			t.Errorf("%v: expected %q but got %q", test.title, test.exp, val)
+		}
+	}
+}
+
+func TestDeprecatedAnnotationWithoutValues(t *testing.T) {
+	defer func(d []DeprecatedAnnotation) {
+		replacements = buildReplacements(d)
+	}(deprecatedAnnotations)
+
+	replacements = buildReplacements([]DeprecatedAnnotation{
+		{Name: "old-timeout", ReplacedBy: "new-timeout"},
+	})
+
+	ing := buildIngressWithAnnotations(map[string]string{"old-timeout": "30"})
+
+	val, err := GetIntAnnotation("new-timeout", ing)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if val != 30 {
+		t.Errorf("expected 30 but got %v", val)
+	}
+}
+
+func TestDeprecatedAnnotationsInUse(t *testing.T) {
+	if inUse := DeprecatedAnnotationsInUse(nil); inUse != nil {
+		t.Errorf("expected no deprecated annotations but got %v", inUse)
+	}
+
+	ing := buildIngressWithAnnotations(map[string]string{
+		"secure-backends":  "true",
+		"grpc-backend":     "false",
+		"backend-protocol": "HTTP",
+	})
+
+	inUse := DeprecatedAnnotationsInUse(ing)
+
+	names := []string{}
+	for _, d := range inUse {
+		names = append(names, d.Name)
+	}
+
+	expected := []string{"grpc-backend", "secure-backends"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v but got %v", expected, names)
+	}
+}
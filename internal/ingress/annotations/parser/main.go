@@ -22,7 +22,7 @@ import (
 	"strconv"
 	"strings"
 
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"k8s.io/ingress-nginx/internal/ingress/errors"
@@ -98,7 +98,7 @@ func GetBoolAnnotation(name string, ing *networking.Ingress) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return ingAnnotations(ing.GetAnnotations()).parseBool(v)
+	return annotationsWithAliases(name, ing).parseBool(v)
 }
 
 // GetStringAnnotation extracts a string from an Ingress annotation
@@ -109,7 +109,7 @@ func GetStringAnnotation(name string, ing *networking.Ingress) (string, error) {
 		return "", err
 	}
 
-	return ingAnnotations(ing.GetAnnotations()).parseString(v)
+	return annotationsWithAliases(name, ing).parseString(v)
 }
 
 // GetIntAnnotation extracts an int from an Ingress annotation
@@ -119,7 +119,7 @@ func GetIntAnnotation(name string, ing *networking.Ingress) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return ingAnnotations(ing.GetAnnotations()).parseInt(v)
+	return annotationsWithAliases(name, ing).parseInt(v)
 }
 
 // GetAnnotationWithPrefix returns the prefix of ingress annotations
@@ -136,9 +136,13 @@ func normalizeString(input string) string {
 	return strings.Join(trimmedContent, "\n")
 }
 
+// configmapAnnotations are the annotations referencing a configmap, without
+// the prefix of the annotations
 var configmapAnnotations = sets.NewString(
-	"auth-proxy-set-header",
+	"auth-proxy-set-headers",
 	"fastcgi-params-configmap",
+	"openapi-validation-configmap",
+	"static-response-configmap",
 )
 
 // AnnotationsReferencesConfigmap checks if at least one annotation in the Ingress rule
@@ -148,8 +152,8 @@ func AnnotationsReferencesConfigmap(ing *networking.Ingress) bool {
 		return false
 	}
 
-	for name := range ing.GetAnnotations() {
-		if configmapAnnotations.Has(name) {
+	for _, name := range configmapAnnotations.List() {
+		if _, ok := ing.GetAnnotations()[GetAnnotationWithPrefix(name)]; ok {
 			return true
 		}
 	}
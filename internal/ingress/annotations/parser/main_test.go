@@ -21,7 +21,7 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -200,3 +200,28 @@ func TestStringToURL(t *testing.T) {
 		}
 	}
 }
+
+func TestAnnotationsReferencesConfigmap(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		expected    bool
+	}{
+		{"no annotations", nil, false},
+		{"unrelated annotation", map[string]string{GetAnnotationWithPrefix("rewrite-target"): "/"}, false},
+		{"unprefixed annotation", map[string]string{"fastcgi-params-configmap": "fastcgi-params"}, false},
+		{"auth-proxy-set-headers", map[string]string{GetAnnotationWithPrefix("auth-proxy-set-headers"): "auth-headers"}, true},
+		{"fastcgi-params-configmap", map[string]string{GetAnnotationWithPrefix("fastcgi-params-configmap"): "fastcgi-params"}, true},
+		{"static-response-configmap", map[string]string{GetAnnotationWithPrefix("static-response-configmap"): "maintenance"}, true},
+		{"openapi-validation-configmap", map[string]string{GetAnnotationWithPrefix("openapi-validation-configmap"): "orders-api"}, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+		ing.SetAnnotations(test.annotations)
+
+		if result := AnnotationsReferencesConfigmap(ing); result != test.expected {
+			t.Errorf("%v: expected %v but %v was returned", test.title, test.expected, result)
+		}
+	}
+}
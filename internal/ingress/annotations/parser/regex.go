@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+)
+
+// maxPortableRegexLength is the maximum length of the regular expressions
+// matched by Lua against the values sent by the clients
+const maxPortableRegexLength = 256
+
+// portableRegexEscapes are the escape sequences with the same meaning in RE2
+// and PCRE
+const portableRegexEscapes = `dDwWsSbB.\-/^$*+?()[]{}|`
+
+// CheckPortableRegex returns an error when the regular expression is not in
+// the subset of the syntax with the same meaning in RE2, used to validate
+// it, and in PCRE, used by ngx.re in Lua to match it against the values sent
+// by the clients. The groups other than (?:...) and the flags, the escape
+// sequences other than the character classes, anchors and escaped
+// metacharacters, and the nested repetitions, which backtrack exponentially
+// in PCRE, are rejected.
+func CheckPortableRegex(expr string) error {
+	if len(expr) > maxPortableRegexLength {
+		return fmt.Errorf("the regular expression is longer than %v characters", maxPortableRegexLength)
+	}
+
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			if i+1 == len(expr) || !strings.ContainsRune(portableRegexEscapes, rune(expr[i+1])) {
+				return fmt.Errorf("unsupported escape sequence at position %v", i)
+			}
+			i++
+		case '(':
+			if strings.HasPrefix(expr[i+1:], "?") && !strings.HasPrefix(expr[i+1:], "?:") {
+				return fmt.Errorf("unsupported group or flag at position %v", i)
+			}
+		}
+	}
+
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return err
+	}
+
+	return checkRepetitions(re, false)
+}
+
+// checkRepetitions returns an error when a repetition contains another
+// repetition or an alternation, repeated is true within a repetition
+func checkRepetitions(re *syntax.Regexp, repeated bool) error {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if repeated {
+			return fmt.Errorf("nested repetitions are not supported: %v", re)
+		}
+		repeated = true
+	case syntax.OpAlternate:
+		if repeated {
+			return fmt.Errorf("repeated alternations are not supported: %v", re)
+		}
+	}
+
+	for _, sub := range re.Sub {
+		if err := checkRepetitions(sub, repeated); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parser
+
+import "testing"
+
+func TestCheckPortableRegex(t *testing.T) {
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{`^([a-z0-9-]+)\.example\.com$`, true},
+		{`^(?:canary|beta)-\d+$`, true},
+		{`^[\w.-]+@example\.org$`, true},
+		{`^v[0-9]{1,3}$`, true},
+		{`(`, false},
+		{`^\p{Greek}+$`, false},
+		{`^\Qa.b\E$`, false},
+		{`\z`, false},
+		{`(?i)canary`, false},
+		{`(?P<tenant>[a-z]+)`, false},
+		{`^(a+)+$`, false},
+		{`^(\w*)*$`, false},
+		{`^(a|ab)*$`, false},
+		{`^(?:[a-z]+\.)+example\.com$`, false},
+		{`a\`, false},
+		{`^` + string(make([]byte, maxPortableRegexLength)) + `$`, false},
+	}
+
+	for _, test := range tests {
+		err := CheckPortableRegex(test.expr)
+		if test.valid && err != nil {
+			t.Errorf("expected %q to be valid but got %v", test.expr, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("expected %q to be invalid", test.expr)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pathpriority
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+type pathPriority struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new path priority annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return pathPriority{r}
+}
+
+// Parse parses the annotations contained in the ingress rule used to order
+// the locations of the paths of the ingress. The locations with a higher
+// priority are written first and win the regular expression matching.
+func (a pathPriority) Parse(ing *networking.Ingress) (interface{}, error) {
+	priority, err := parser.GetIntAnnotation("path-priority", ing)
+	if err != nil {
+		return 0, nil
+	}
+
+	return priority, nil
+}
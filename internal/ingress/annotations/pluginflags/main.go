@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pluginflags
+
+import (
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const pluginFlagsAnnotation = "plugin-flags"
+
+// nameRegex matches the names of the flags, like hello_world.greeting
+var nameRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+type pluginFlags struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new plugin flags annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return pluginFlags{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the flags
+// of the ingress delivered to the Lua plugins. The flags are separated by
+// commas or new lines, in the form name=value, a flag without value is
+// "true".
+func (p pluginFlags) Parse(ing *networking.Ingress) (interface{}, error) {
+	val, err := parser.GetStringAnnotation(pluginFlagsAnnotation, ing)
+	if err != nil {
+		return map[string]string(nil), err
+	}
+
+	flags := map[string]string{}
+	for _, flag := range strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == '\n' }) {
+		flag = strings.TrimSpace(flag)
+		if flag == "" {
+			continue
+		}
+
+		name, value := flag, "true"
+		if i := strings.Index(flag, "="); i >= 0 {
+			name, value = strings.TrimSpace(flag[:i]), strings.TrimSpace(flag[i+1:])
+		}
+
+		if !nameRegex.MatchString(name) {
+			return map[string]string(nil), ing_errors.NewInvalidAnnotationContent(pluginFlagsAnnotation, val)
+		}
+
+		if _, ok := flags[name]; ok {
+			return map[string]string(nil), ing_errors.NewInvalidAnnotationContent(pluginFlagsAnnotation, val)
+		}
+
+		flags[name] = value
+	}
+
+	if len(flags) == 0 {
+		return map[string]string(nil), ing_errors.NewInvalidAnnotationContent(pluginFlagsAnnotation, val)
+	}
+
+	return flags, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package precompressed
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+// Config describes the precompressed variants of the responses of a location.
+// When enabled, NGINX serves the .gz or .br files next to the requested one
+// and the responses of the backend are not compressed again by NGINX
+type Config struct {
+	// Gzip enables gzip_static and disables gzip in the location
+	Gzip bool `json:"gzip"`
+	// Brotli enables brotli_static and disables brotli in the location
+	Brotli bool `json:"brotli"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type precompressed struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new precompressed assets annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return precompressed{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to serve precompressed assets instead of compressing the responses
+func (p precompressed) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	gzip, err := parser.GetBoolAnnotation("gzip-static", ing)
+	if err == nil {
+		config.Gzip = gzip
+	}
+
+	brotli, err := parser.GetBoolAnnotation("brotli-static", ing)
+	if err == nil {
+		config.Brotli = brotli
+	}
+
+	return config, nil
+}
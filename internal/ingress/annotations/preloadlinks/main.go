@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preloadlinks
+
+import (
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+// linkRegex matches a link of the Link header, like
+// </app.css>; rel=preload; as=style. Quotes and variables are not
+// allowed in the links as they are rendered in the NGINX configuration
+var linkRegex = regexp.MustCompile(`^<[^<>\s'"$\\]+>(\s*;\s*[a-zA-Z*-]+(=[^;,<>\s'"$\\]+)?)*$`)
+
+type preloadLinks struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new preload links annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return preloadLinks{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to announce the assets the clients can preload
+func (a preloadLinks) Parse(ing *networking.Ingress) (interface{}, error) {
+	val, err := parser.GetStringAnnotation("preload-links", ing)
+	if err != nil {
+		return []string{}, err
+	}
+
+	links := []string{}
+	for _, link := range strings.Split(val, ",") {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+
+		if !linkRegex.MatchString(link) {
+			return []string{}, ing_errors.NewInvalidAnnotationContent("preload-links", val)
+		}
+
+		links = append(links, link)
+	}
+
+	if len(links) == 0 {
+		return []string{}, ing_errors.NewInvalidAnnotationContent("preload-links", val)
+	}
+
+	return links, nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preloadlinks
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	annotation := parser.GetAnnotationWithPrefix("preload-links")
+
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    []string
+	}{
+		{map[string]string{annotation: "</app.css>; rel=preload; as=style"}, []string{"</app.css>; rel=preload; as=style"}},
+		{map[string]string{annotation: "</app.js>;rel=preload;as=script, </font.woff2>; rel=preload; as=font; type=font/woff2; crossorigin"},
+			[]string{"</app.js>;rel=preload;as=script", "</font.woff2>; rel=preload; as=font; type=font/woff2; crossorigin"}},
+		{map[string]string{annotation: "<https://cdn.example.com>; rel=preconnect"}, []string{"<https://cdn.example.com>; rel=preconnect"}},
+		{map[string]string{annotation: "/app.css; rel=preload"}, []string{}},
+		{map[string]string{annotation: "</app.css>; rel=preload'; return 200 '"}, []string{}},
+		{map[string]string{annotation: "</$request_uri>; rel=preload"}, []string{}},
+		{map[string]string{annotation: ","}, []string{}},
+		{map[string]string{}, []string{}},
+		{nil, []string{}},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, _ := ap.Parse(ing)
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
@@ -17,16 +17,26 @@ limitations under the License.
 package proxy
 
 import (
-	networking "k8s.io/api/networking/v1beta1"
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
+// cookieRewriteRegex matches a rewrite of the proxy_cookie_domain and
+// proxy_cookie_path directives, the text to replace and its replacement,
+// with the characters of the regular expressions escaped by a backslash
+var cookieRewriteRegex = regexp.MustCompile(`^(?:[^\s;{}'"\\,]|\\[^\s;{}'"\\,])+ (?:[^\s;{}'"\\,]|\\[^\s;{}'"\\,])+$`)
+
 // Config returns the proxy timeout to use in the upstream server/s
 type Config struct {
 	BodySize             string `json:"bodySize"`
 	ConnectTimeout       int    `json:"connectTimeout"`
+	SSLHandshakeTimeout  int    `json:"sslHandshakeTimeout"`
 	SendTimeout          int    `json:"sendTimeout"`
 	ReadTimeout          int    `json:"readTimeout"`
 	BuffersNumber        int    `json:"buffersNumber"`
@@ -58,6 +68,9 @@ func (l1 *Config) Equal(l2 *Config) bool {
 	if l1.ConnectTimeout != l2.ConnectTimeout {
 		return false
 	}
+	if l1.SSLHandshakeTimeout != l2.SSLHandshakeTimeout {
+		return false
+	}
 	if l1.SendTimeout != l2.SendTimeout {
 		return false
 	}
@@ -130,6 +143,11 @@ func (a proxy) Parse(ing *networking.Ingress) (interface{}, error) {
 		config.ConnectTimeout = defBackend.ProxyConnectTimeout
 	}
 
+	config.SSLHandshakeTimeout, err = parser.GetIntAnnotation("proxy-ssl-handshake-timeout", ing)
+	if err != nil {
+		config.SSLHandshakeTimeout = defBackend.ProxySSLHandshakeTimeout
+	}
+
 	config.SendTimeout, err = parser.GetIntAnnotation("proxy-send-timeout", ing)
 	if err != nil {
 		config.SendTimeout = defBackend.ProxySendTimeout
@@ -150,16 +168,6 @@ func (a proxy) Parse(ing *networking.Ingress) (interface{}, error) {
 		config.BufferSize = defBackend.ProxyBufferSize
 	}
 
-	config.CookiePath, err = parser.GetStringAnnotation("proxy-cookie-path", ing)
-	if err != nil {
-		config.CookiePath = defBackend.ProxyCookiePath
-	}
-
-	config.CookieDomain, err = parser.GetStringAnnotation("proxy-cookie-domain", ing)
-	if err != nil {
-		config.CookieDomain = defBackend.ProxyCookieDomain
-	}
-
 	config.BodySize, err = parser.GetStringAnnotation("proxy-body-size", ing)
 	if err != nil {
 		config.BodySize = defBackend.ProxyBodySize
@@ -210,5 +218,56 @@ func (a proxy) Parse(ing *networking.Ingress) (interface{}, error) {
 		config.ProxyMaxTempFileSize = defBackend.ProxyMaxTempFileSize
 	}
 
+	// the locations with invalid rewrites are denied, their other settings
+	// are kept
+	config.CookiePath, err = parseCookieRewrites("proxy-cookie-path", defBackend.ProxyCookiePath, ing)
+	if err != nil {
+		return config, ing_errors.LocationDenied{Reason: err}
+	}
+
+	config.CookieDomain, err = parseCookieRewrites("proxy-cookie-domain", defBackend.ProxyCookieDomain, ing)
+	if err != nil {
+		return config, ing_errors.LocationDenied{Reason: err}
+	}
+
 	return config, nil
 }
+
+// parseCookieRewrites returns the normalized value of the annotation name, a
+// comma separated list of rewrites of the Set-Cookie attributes, each one is
+// a text to replace and its replacement, or "off" alone to disable the
+// rewrites. def is returned when the annotation is not defined.
+func parseCookieRewrites(name, def string, ing *networking.Ingress) (string, error) {
+	value, err := parser.GetStringAnnotation(name, ing)
+	if err != nil {
+		return def, nil
+	}
+
+	rewrites := []string{}
+	for _, rewrite := range strings.Split(value, ",") {
+		rewrite = strings.Join(strings.Fields(rewrite), " ")
+		if rewrite == "" {
+			continue
+		}
+
+		if rewrite != "off" && !cookieRewriteRegex.MatchString(rewrite) {
+			return def, ing_errors.NewInvalidAnnotationContent(name, value)
+		}
+
+		rewrites = append(rewrites, rewrite)
+	}
+
+	if len(rewrites) == 0 {
+		return def, ing_errors.NewInvalidAnnotationContent(name, value)
+	}
+
+	if len(rewrites) > 1 {
+		for _, rewrite := range rewrites {
+			if rewrite == "off" {
+				return def, ing_errors.NewInvalidAnnotationContent(name, value)
+			}
+		}
+	}
+
+	return strings.Join(rewrites, ", "), nil
+}
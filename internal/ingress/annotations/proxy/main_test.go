@@ -20,19 +20,23 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/defaults"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -41,9 +45,13 @@ func buildIngress() *networking.Ingress {
 			Namespace: api.NamespaceDefault,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -91,6 +99,7 @@ func TestProxy(t *testing.T) {
 
 	data := map[string]string{}
 	data[parser.GetAnnotationWithPrefix("proxy-connect-timeout")] = "1"
+	data[parser.GetAnnotationWithPrefix("proxy-ssl-handshake-timeout")] = "30"
 	data[parser.GetAnnotationWithPrefix("proxy-send-timeout")] = "2"
 	data[parser.GetAnnotationWithPrefix("proxy-read-timeout")] = "3"
 	data[parser.GetAnnotationWithPrefix("proxy-buffers-number")] = "8"
@@ -116,6 +125,9 @@ func TestProxy(t *testing.T) {
 	if p.ConnectTimeout != 1 {
 		t.Errorf("expected 1 as connect-timeout but returned %v", p.ConnectTimeout)
 	}
+	if p.SSLHandshakeTimeout != 30 {
+		t.Errorf("expected 30 as ssl-handshake-timeout but returned %v", p.SSLHandshakeTimeout)
+	}
 	if p.SendTimeout != 2 {
 		t.Errorf("expected 2 as send-timeout but returned %v", p.SendTimeout)
 	}
@@ -154,6 +166,53 @@ func TestProxy(t *testing.T) {
 	}
 }
 
+func TestProxyCookieRewrites(t *testing.T) {
+	testCases := []struct {
+		title     string
+		path      string
+		domain    string
+		expPath   string
+		expDomain string
+		expErr    bool
+	}{
+		{"single rewrites", "/one/ /", "internal.local example.com", "/one/ /", "internal.local example.com", false},
+		{"multiple rewrites", "/one/  /, ~^/two/(.*)$ /$1", "a.local a.example.com,b.local b.example.com", "/one/ /, ~^/two/(.*)$ /$1", "a.local a.example.com, b.local b.example.com", false},
+		{"escaped regex characters", `~^/v\d+/ /`, `~\.internal$ example.com`, `~^/v\d+/ /`, `~\.internal$ example.com`, false},
+		{"off", "off", " off ", "off", "off", false},
+		{"missing replacement", "/one/", "internal.local example.com", "", "", true},
+		{"off with rewrites", "/one/ /", "off,a.local a.example.com", "", "", true},
+		{"directive injection", "/one/ /; return 200", "a.local a.example.com", "", "", true},
+		{"escaped quote", `/one/ /\"`, "a.local a.example.com", "", "", true},
+		{"no rewrites", "/one/ /", " , ", "", "", true},
+	}
+
+	for _, testCase := range testCases {
+		ing := buildIngress()
+		ing.SetAnnotations(map[string]string{
+			parser.GetAnnotationWithPrefix("proxy-cookie-path"):   testCase.path,
+			parser.GetAnnotationWithPrefix("proxy-cookie-domain"): testCase.domain,
+		})
+
+		i, err := NewParser(mockBackend{}).Parse(ing)
+		if testCase.expErr {
+			if !ing_errors.IsLocationDenied(err) {
+				t.Errorf("%v: expected the location to be denied but returned %v", testCase.title, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", testCase.title, err)
+		}
+		p := i.(*Config)
+		if p.CookiePath != testCase.expPath {
+			t.Errorf("%v: expected %q as cookie-path but returned %q", testCase.title, testCase.expPath, p.CookiePath)
+		}
+		if p.CookieDomain != testCase.expDomain {
+			t.Errorf("%v: expected %q as cookie-domain but returned %q", testCase.title, testCase.expDomain, p.CookieDomain)
+		}
+	}
+}
+
 func TestProxyWithNoAnnotation(t *testing.T) {
 	ing := buildIngress()
 
@@ -171,6 +230,9 @@ func TestProxyWithNoAnnotation(t *testing.T) {
 	if p.ConnectTimeout != 10 {
 		t.Errorf("expected 10 as connect-timeout but returned %v", p.ConnectTimeout)
 	}
+	if p.SSLHandshakeTimeout != 0 {
+		t.Errorf("expected 0 as ssl-handshake-timeout but returned %v", p.SSLHandshakeTimeout)
+	}
 	if p.SendTimeout != 15 {
 		t.Errorf("expected 15 as send-timeout but returned %v", p.SendTimeout)
 	}
@@ -0,0 +1,458 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxycache
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/authreq"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+	sliceSets "k8s.io/ingress-nginx/internal/sets"
+)
+
+const (
+	// DefaultKey is the cache key used when no custom key is configured.
+	// It always contains the scheme and the host to avoid serving cached
+	// responses across virtual hosts.
+	DefaultKey = "$scheme$host$request_uri"
+
+	// DefaultValid is the fallback value if no cache validity is provided
+	DefaultValid = "200 301 302 10m"
+
+	// updatingCondition serves a stale response while it is updated
+	updatingCondition = "updating"
+)
+
+var (
+	variableRegex = regexp.MustCompile(`\$\{?([a-zA-Z0-9_]+)\}?`)
+	headerRegex   = regexp.MustCompile(`^[a-zA-Z0-9\-_]+$`)
+	nameRegex     = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+	// variables that are known to be available when the cache key is evaluated
+	allowedVariables = sets.NewString(
+		"args",
+		"binary_remote_addr",
+		"content_type",
+		"document_uri",
+		"host",
+		"http_host",
+		"is_args",
+		"proxy_host",
+		"query_string",
+		"remote_addr",
+		"request_method",
+		"request_uri",
+		"scheme",
+		"server_name",
+		"server_port",
+		"uri",
+	)
+
+	// prefixes of variables generated from the request
+	allowedVariablePrefixes = []string{"arg_", "cookie_", "http_"}
+
+	// conditions of proxy_cache_use_stale
+	staleConditions = sets.NewString(
+		"error",
+		"timeout",
+		"invalid_header",
+		updatingCondition,
+		"http_500",
+		"http_502",
+		"http_503",
+		"http_504",
+		"http_403",
+		"http_404",
+		"http_429",
+	)
+
+	// errorConditions are the conditions of proxy_cache_use_stale enabled
+	// by the proxy-cache-stale-if-error annotation
+	errorConditions = []string{"error", "timeout", "http_500", "http_502", "http_503", "http_504"}
+)
+
+// Config contains the proxy cache configuration of a location
+type Config struct {
+	Enabled bool     `json:"enabled"`
+	Key     string   `json:"key"`
+	Valid   []string `json:"valid"`
+	// Bypass contains the variables of the request that, when not empty and
+	// not equal to "0", skip the cache and the caching of the response
+	Bypass []string `json:"bypass,omitempty"`
+	// NoCache contains the variables of the response of the backend that,
+	// when not empty and not equal to "0", skip the caching of the response
+	NoCache []string `json:"noCache,omitempty"`
+	// UseStale contains the conditions in which a stale cached response is
+	// served instead of the response of the backend
+	UseStale []string `json:"useStale,omitempty"`
+	// BackgroundUpdate updates the expired responses in a subrequest, the
+	// stale response is returned to the client in the meantime
+	BackgroundUpdate bool `json:"backgroundUpdate,omitempty"`
+	// StaleWhileRevalidate and StaleIfError are the durations, in seconds,
+	// advertised to the clients in the Cache-Control header of the responses
+	StaleWhileRevalidate int `json:"staleWhileRevalidate,omitempty"`
+	StaleIfError         int `json:"staleIfError,omitempty"`
+	// Lock allows a single request at a time to populate a new cache entry,
+	// the other requests of the same key wait for the response to be cached
+	Lock bool `json:"lock,omitempty"`
+	// LockTimeout is the time, in seconds, the requests wait for the cache
+	// entry before being sent to the backend, not cached
+	LockTimeout int `json:"lockTimeout,omitempty"`
+	// LockAge is the time, in seconds, after which another request is sent
+	// to the backend when the one populating the entry did not complete
+	LockAge int `json:"lockAge,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if c1.Enabled != c2.Enabled {
+		return false
+	}
+	if c1.Key != c2.Key {
+		return false
+	}
+
+	if !sliceSets.StringElementsMatch(c1.Bypass, c2.Bypass) {
+		return false
+	}
+	if !sliceSets.StringElementsMatch(c1.NoCache, c2.NoCache) {
+		return false
+	}
+	if !sliceSets.StringElementsMatch(c1.UseStale, c2.UseStale) {
+		return false
+	}
+	if c1.BackgroundUpdate != c2.BackgroundUpdate {
+		return false
+	}
+	if c1.StaleWhileRevalidate != c2.StaleWhileRevalidate {
+		return false
+	}
+	if c1.StaleIfError != c2.StaleIfError {
+		return false
+	}
+	if c1.Lock != c2.Lock {
+		return false
+	}
+	if c1.LockTimeout != c2.LockTimeout {
+		return false
+	}
+	if c1.LockAge != c2.LockAge {
+		return false
+	}
+
+	return sliceSets.StringElementsMatch(c1.Valid, c2.Valid)
+}
+
+// ValidateKey checks all the nginx variables referenced in a cache key
+// are known to be available when the key is evaluated
+func ValidateKey(key string) error {
+	if strings.TrimSpace(key) == "" {
+		return fmt.Errorf("cache key cannot be empty")
+	}
+
+	for _, match := range variableRegex.FindAllStringSubmatch(key, -1) {
+		if !isAllowedVariable(match[1]) {
+			return fmt.Errorf("variable $%v cannot be used in a cache key", match[1])
+		}
+	}
+
+	return nil
+}
+
+func isAllowedVariable(name string) bool {
+	if allowedVariables.Has(name) {
+		return true
+	}
+
+	for _, prefix := range allowedVariablePrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type proxyCache struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new proxy cache annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return proxyCache{r}
+}
+
+// Parse parses the annotations contained in the ingress
+// rule used to configure caching of the backend responses
+func (a proxyCache) Parse(ing *networking.Ingress) (interface{}, error) {
+	enabled, err := parser.GetBoolAnnotation("enable-proxy-cache", ing)
+	if err != nil || !enabled {
+		return &Config{}, nil
+	}
+
+	key, err := parser.GetStringAnnotation("proxy-cache-key", ing)
+	if err != nil {
+		key = DefaultKey
+	}
+
+	if err := ValidateKey(key); err != nil {
+		return &Config{}, ing_errors.NewInvalidAnnotationConfiguration("proxy-cache-key", err.Error())
+	}
+
+	key = withSchemeAndHost(key)
+
+	varyHeaders, _ := parser.GetStringAnnotation("proxy-cache-key-vary-headers", ing)
+	varyCookies, _ := parser.GetStringAnnotation("proxy-cache-key-vary-cookies", ing)
+	varyArgs, _ := parser.GetStringAnnotation("proxy-cache-key-vary-args", ing)
+
+	for _, vary := range []struct {
+		annotation string
+		value      string
+		prefix     string
+	}{
+		{"proxy-cache-key-vary-headers", varyHeaders, "http_"},
+		{"proxy-cache-key-vary-cookies", varyCookies, "cookie_"},
+		{"proxy-cache-key-vary-args", varyArgs, "arg_"},
+	} {
+		variables, err := buildVaryVariables(vary.value, vary.prefix)
+		if err != nil {
+			return &Config{}, ing_errors.NewInvalidAnnotationConfiguration(vary.annotation, err.Error())
+		}
+
+		for _, v := range variables {
+			key = fmt.Sprintf("%v|%v", key, v)
+		}
+	}
+
+	valid := []string{}
+	rawValid, _ := parser.GetStringAnnotation("proxy-cache-valid", ing)
+	for _, v := range strings.Split(rawValid, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) == 0 {
+			continue
+		}
+
+		if !authreq.ValidCacheDuration(v) {
+			return &Config{}, ing_errors.NewInvalidAnnotationContent("proxy-cache-valid", v)
+		}
+
+		valid = append(valid, v)
+	}
+
+	if len(valid) == 0 {
+		valid = append(valid, DefaultValid)
+	}
+
+	bypass, err := buildBypassVariables(ing)
+	if err != nil {
+		return &Config{}, err
+	}
+
+	var noCache []string
+	noCacheHeaders, _ := parser.GetStringAnnotation("proxy-cache-no-cache-upstream-headers", ing)
+	if noCacheHeaders != "" {
+		noCache, err = buildVaryVariables(noCacheHeaders, "upstream_http_")
+		if err != nil {
+			return &Config{}, ing_errors.NewInvalidAnnotationConfiguration("proxy-cache-no-cache-upstream-headers", err.Error())
+		}
+	}
+
+	config := &Config{
+		Enabled: true,
+		Key:     key,
+		Valid:   valid,
+		Bypass:  bypass,
+		NoCache: noCache,
+	}
+
+	if err := parseStale(ing, config); err != nil {
+		return &Config{}, err
+	}
+
+	if err := parseLock(ing, config); err != nil {
+		return &Config{}, err
+	}
+
+	return config, nil
+}
+
+// parseLock configures the coalescing of the requests populating the same
+// cache entry into a single request to the backend
+func parseLock(ing *networking.Ingress, config *Config) error {
+	lock, err := parser.GetBoolAnnotation("proxy-cache-lock", ing)
+	if err != nil || !lock {
+		return nil
+	}
+
+	config.Lock = true
+
+	config.LockTimeout, err = parseStaleDuration("proxy-cache-lock-timeout", ing)
+	if err != nil {
+		return err
+	}
+
+	config.LockAge, err = parseStaleDuration("proxy-cache-lock-age", ing)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseStale configures the use of the stale cached responses when the
+// backend fails or while they are updated
+func parseStale(ing *networking.Ingress, config *Config) error {
+	var err error
+
+	config.StaleWhileRevalidate, err = parseStaleDuration("proxy-cache-stale-while-revalidate", ing)
+	if err != nil {
+		return err
+	}
+
+	config.StaleIfError, err = parseStaleDuration("proxy-cache-stale-if-error", ing)
+	if err != nil {
+		return err
+	}
+
+	useStale, _ := parser.GetStringAnnotation("proxy-cache-use-stale", ing)
+	conditions := sets.NewString()
+	for _, condition := range strings.FieldsFunc(useStale, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if !staleConditions.Has(condition) {
+			return ing_errors.NewInvalidAnnotationContent("proxy-cache-use-stale", condition)
+		}
+		conditions.Insert(condition)
+	}
+
+	// the durations are enforced by the conditions they stand for
+	if config.StaleIfError > 0 {
+		conditions.Insert(errorConditions...)
+	}
+
+	if config.StaleWhileRevalidate > 0 {
+		conditions.Insert(updatingCondition)
+	}
+
+	if conditions.Len() > 0 {
+		config.UseStale = conditions.List()
+		config.BackgroundUpdate = conditions.Has(updatingCondition)
+	}
+
+	return nil
+}
+
+// parseStaleDuration returns the number of seconds of a duration annotation
+// like 30s or 5m, 0 when it is not defined
+func parseStaleDuration(name string, ing *networking.Ingress) (int, error) {
+	raw, err := parser.GetStringAnnotation(name, ing)
+	if err != nil {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil || duration < time.Second {
+		return 0, ing_errors.NewInvalidAnnotationContent(name, raw)
+	}
+
+	return int(duration.Seconds()), nil
+}
+
+// buildBypassVariables returns the variables of the request headers, cookies
+// and Authorization header defined in the proxy-cache-bypass-* annotations
+func buildBypassVariables(ing *networking.Ingress) ([]string, error) {
+	bypassHeaders, _ := parser.GetStringAnnotation("proxy-cache-bypass-headers", ing)
+	bypassCookies, _ := parser.GetStringAnnotation("proxy-cache-bypass-cookies", ing)
+
+	var bypass []string
+	for _, b := range []struct {
+		annotation string
+		value      string
+		prefix     string
+	}{
+		{"proxy-cache-bypass-headers", bypassHeaders, "http_"},
+		{"proxy-cache-bypass-cookies", bypassCookies, "cookie_"},
+	} {
+		if b.value == "" {
+			continue
+		}
+
+		variables, err := buildVaryVariables(b.value, b.prefix)
+		if err != nil {
+			return nil, ing_errors.NewInvalidAnnotationConfiguration(b.annotation, err.Error())
+		}
+
+		bypass = append(bypass, variables...)
+	}
+
+	authorization, err := parser.GetBoolAnnotation("proxy-cache-bypass-authorization", ing)
+	if err == nil && authorization && !sets.NewString(bypass...).Has("$http_authorization") {
+		bypass = append(bypass, "$http_authorization")
+	}
+
+	return bypass, nil
+}
+
+// withSchemeAndHost prefixes the key with the scheme and host when they
+// are not referenced, so responses are never shared between virtual hosts
+func withSchemeAndHost(key string) string {
+	prefix := ""
+	if !strings.Contains(key, "$scheme") {
+		prefix = "$scheme"
+	}
+
+	if !strings.Contains(key, "$host") && !strings.Contains(key, "$http_host") && !strings.Contains(key, "$server_name") {
+		prefix = prefix + "$host"
+	}
+
+	return prefix + key
+}
+
+// buildVaryVariables converts a comma separated list of names into nginx variables
+func buildVaryVariables(input, prefix string) ([]string, error) {
+	variables := []string{}
+	for _, name := range strings.Split(input, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+
+		if strings.HasSuffix(prefix, "http_") && headerRegex.MatchString(name) {
+			name = strings.ToLower(strings.Replace(name, "-", "_", -1))
+		}
+
+		if !nameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid name %v", name)
+		}
+
+		variables = append(variables, fmt.Sprintf("$%v%v", prefix, name))
+	}
+
+	return variables, nil
+}
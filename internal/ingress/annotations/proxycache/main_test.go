@@ -0,0 +1,145 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package proxycache
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	enable := parser.GetAnnotationWithPrefix("enable-proxy-cache")
+	key := parser.GetAnnotationWithPrefix("proxy-cache-key")
+	valid := parser.GetAnnotationWithPrefix("proxy-cache-valid")
+	headers := parser.GetAnnotationWithPrefix("proxy-cache-key-vary-headers")
+	cookies := parser.GetAnnotationWithPrefix("proxy-cache-key-vary-cookies")
+	args := parser.GetAnnotationWithPrefix("proxy-cache-key-vary-args")
+	bypassHeaders := parser.GetAnnotationWithPrefix("proxy-cache-bypass-headers")
+	bypassCookies := parser.GetAnnotationWithPrefix("proxy-cache-bypass-cookies")
+	bypassAuthorization := parser.GetAnnotationWithPrefix("proxy-cache-bypass-authorization")
+	noCacheHeaders := parser.GetAnnotationWithPrefix("proxy-cache-no-cache-upstream-headers")
+	useStale := parser.GetAnnotationWithPrefix("proxy-cache-use-stale")
+	staleWhileRevalidate := parser.GetAnnotationWithPrefix("proxy-cache-stale-while-revalidate")
+	staleIfError := parser.GetAnnotationWithPrefix("proxy-cache-stale-if-error")
+	lock := parser.GetAnnotationWithPrefix("proxy-cache-lock")
+	lockTimeout := parser.GetAnnotationWithPrefix("proxy-cache-lock-timeout")
+	lockAge := parser.GetAnnotationWithPrefix("proxy-cache-lock-age")
+
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    *Config
+		expectErr   bool
+	}{
+		{map[string]string{enable: "true"}, &Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid}}, false},
+		{map[string]string{enable: "true", key: "$request_uri", valid: "200 1h, 404 1m"},
+			&Config{Enabled: true, Key: "$scheme$host$request_uri", Valid: []string{"200 1h", "404 1m"}}, false},
+		{map[string]string{enable: "true", key: "$scheme$http_host$uri$is_args$args"},
+			&Config{Enabled: true, Key: "$scheme$http_host$uri$is_args$args", Valid: []string{DefaultValid}}, false},
+		{map[string]string{enable: "true", headers: "Accept-Language, X-Tenant", cookies: "lang", args: "page"},
+			&Config{Enabled: true, Key: DefaultKey + "|$http_accept_language|$http_x_tenant|$cookie_lang|$arg_page", Valid: []string{DefaultValid}}, false},
+		{map[string]string{enable: "true", bypassHeaders: "Cache-Control, X-Preview", bypassCookies: "session", bypassAuthorization: "true", noCacheHeaders: "X-No-Cache"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid},
+				Bypass:  []string{"$http_cache_control", "$http_x_preview", "$cookie_session", "$http_authorization"},
+				NoCache: []string{"$upstream_http_x_no_cache"}}, false},
+		{map[string]string{enable: "true", bypassHeaders: "Authorization", bypassAuthorization: "true"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid}, Bypass: []string{"$http_authorization"}}, false},
+		{map[string]string{enable: "true", useStale: "error, timeout http_503"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid}, UseStale: []string{"error", "http_503", "timeout"}}, false},
+		{map[string]string{enable: "true", useStale: "updating"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid}, UseStale: []string{"updating"}, BackgroundUpdate: true}, false},
+		{map[string]string{enable: "true", staleWhileRevalidate: "30s", staleIfError: "5m"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid},
+				UseStale:         []string{"error", "http_500", "http_502", "http_503", "http_504", "timeout", "updating"},
+				BackgroundUpdate: true, StaleWhileRevalidate: 30, StaleIfError: 300}, false},
+		{map[string]string{enable: "true", useStale: "http_502", staleIfError: "1h"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid}, UseStale: []string{"error", "http_500", "http_502", "http_503", "http_504", "timeout"}, StaleIfError: 3600}, false},
+		{map[string]string{enable: "true", useStale: "http_418"}, &Config{}, true},
+		{map[string]string{enable: "true", staleIfError: "300"}, &Config{}, true},
+		{map[string]string{enable: "true", staleWhileRevalidate: "500ms"}, &Config{}, true},
+		{map[string]string{enable: "true", lock: "true"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid}, Lock: true}, false},
+		{map[string]string{enable: "true", lock: "true", lockTimeout: "10s", lockAge: "1m"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid}, Lock: true, LockTimeout: 10, LockAge: 60}, false},
+		{map[string]string{enable: "true", lock: "false", lockTimeout: "10s"},
+			&Config{Enabled: true, Key: DefaultKey, Valid: []string{DefaultValid}}, false},
+		{map[string]string{enable: "true", lock: "true", lockTimeout: "10"}, &Config{}, true},
+		{map[string]string{enable: "true", bypassCookies: "my-cookie"}, &Config{}, true},
+		{map[string]string{enable: "true", noCacheHeaders: "X No Cache"}, &Config{}, true},
+		{map[string]string{enable: "true", key: "$request_uri$upstream_addr"}, &Config{}, true},
+		{map[string]string{enable: "true", cookies: "my-cookie"}, &Config{}, true},
+		{map[string]string{enable: "true", valid: "10m 200"}, &Config{}, true},
+		{map[string]string{enable: "false", key: "$request_uri"}, &Config{}, false},
+		{map[string]string{}, &Config{}, false},
+		{nil, &Config{}, false},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		i, err := ap.Parse(ing)
+		if testCase.expectErr && err == nil {
+			t.Errorf("expected error but returned nil, annotations: %s", testCase.annotations)
+		}
+		if !testCase.expectErr && err != nil {
+			t.Errorf("unexpected error %v, annotations: %s", err, testCase.annotations)
+		}
+
+		p, _ := i.(*Config)
+		if !p.Equal(testCase.expected) {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, p, testCase.annotations)
+		}
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	testCases := map[string]bool{
+		"$scheme$host$request_uri":        true,
+		"${host}${request_uri}":           true,
+		"$host$uri|$cookie_session":       true,
+		"static$host$arg_id$http_accept":  true,
+		"$host$request_uri$upstream_addr": false,
+		"$http_":                          false,
+		"":                                false,
+	}
+
+	for key, expected := range testCases {
+		err := ValidateKey(key)
+		if expected && err != nil {
+			t.Errorf("expected key %q to be valid but returned %v", key, err)
+		}
+		if !expected && err == nil {
+			t.Errorf("expected key %q to be invalid", key)
+		}
+	}
+}
@@ -17,12 +17,14 @@ limitations under the License.
 package proxyssl
 
 import (
+	"encoding/json"
+	"fmt"
 	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -35,11 +37,15 @@ const (
 	defaultProxySSLVerify      = "off"
 	defaultProxySSLVerifyDepth = 1
 	defaultProxySSLServerName  = "off"
+
+	proxySSLPathSecretsAnnotation = "proxy-ssl-path-secrets"
 )
 
 var (
 	proxySSLOnOffRegex    = regexp.MustCompile(`^(on|off)$`)
 	proxySSLProtocolRegex = regexp.MustCompile(`^(SSLv2|SSLv3|TLSv1|TLSv1\.1|TLSv1\.2|TLSv1\.3)$`)
+	// proxySSLCiphersRegex matches the characters of the OpenSSL cipher strings
+	proxySSLCiphersRegex = regexp.MustCompile(`^[A-Za-z0-9_:+!@=-]+$`)
 )
 
 // Config contains the AuthSSLCert used for mutual authentication
@@ -52,6 +58,9 @@ type Config struct {
 	Verify             string `json:"verify"`
 	VerifyDepth        int    `json:"verifyDepth"`
 	ProxySSLServerName string `json:"proxySSLServerName"`
+	// PathCertificates contains the client certificates used by the locations
+	// of each path instead of the one of the proxy-ssl-secret annotation
+	PathCertificates map[string]resolver.AuthSSLCert `json:"pathCertificates,omitempty"`
 }
 
 // Equal tests for equality between two Config types
@@ -80,9 +89,71 @@ func (pssl1 *Config) Equal(pssl2 *Config) bool {
 	if pssl1.ProxySSLServerName != pssl2.ProxySSLServerName {
 		return false
 	}
+	if len(pssl1.PathCertificates) != len(pssl2.PathCertificates) {
+		return false
+	}
+	for path, cert1 := range pssl1.PathCertificates {
+		cert2, ok := pssl2.PathCertificates[path]
+		if !ok || !(&cert1).Equal(&cert2) {
+			return false
+		}
+	}
 	return true
 }
 
+// ForPath returns the configuration of the location of a path, using the
+// client certificate of the path when defined in the proxy-ssl-path-secrets
+// annotation. The CA of the path secret, if any, replaces the one of the
+// proxy-ssl-secret annotation.
+func (pssl1 *Config) ForPath(path string) Config {
+	config := *pssl1
+	config.PathCertificates = nil
+
+	cert, ok := pssl1.PathCertificates[path]
+	if !ok {
+		return config
+	}
+
+	config.Secret = cert.Secret
+	config.PemFileName = cert.PemFileName
+	if cert.CAFileName != "" {
+		config.CAFileName = cert.CAFileName
+		config.CASHA = cert.CASHA
+		config.CRLFileName = cert.CRLFileName
+		config.CRLSHA = cert.CRLSHA
+	}
+
+	return config
+}
+
+// ParsePathSecrets returns the secrets, in namespace/name format, with the
+// client certificate of each path defined in the proxy-ssl-path-secrets annotation
+func ParsePathSecrets(ing *networking.Ingress) (map[string]string, error) {
+	value, err := parser.GetStringAnnotation(proxySSLPathSecretsAnnotation, ing)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := map[string]string{}
+	err = json.Unmarshal([]byte(value), &secrets)
+	if err != nil {
+		return nil, ing_errors.NewLocationDenied(fmt.Sprintf("invalid %v annotation: %v", proxySSLPathSecretsAnnotation, err))
+	}
+
+	for path, secret := range secrets {
+		if !strings.HasPrefix(path, "/") {
+			return nil, ing_errors.NewLocationDenied(fmt.Sprintf("invalid path %q in %v annotation", path, proxySSLPathSecretsAnnotation))
+		}
+
+		_, _, err = k8s.ParseNameNS(secret)
+		if err != nil {
+			return nil, ing_errors.NewLocationDenied(err.Error())
+		}
+	}
+
+	return secrets, nil
+}
+
 // NewParser creates a new TLS authentication annotation parser
 func NewParser(resolver resolver.Resolver) parser.IngressAnnotation {
 	return proxySSL{resolver}
@@ -120,24 +191,34 @@ func (p proxySSL) Parse(ing *networking.Ingress) (interface{}, error) {
 	var err error
 	config := &Config{}
 
-	proxysslsecret, err := parser.GetStringAnnotation("proxy-ssl-secret", ing)
-	if err != nil {
+	config.PathCertificates, err = p.pathCertificates(ing)
+	if err != nil && !ing_errors.IsMissingAnnotations(err) {
 		return &Config{}, err
 	}
 
-	_, _, err = k8s.ParseNameNS(proxysslsecret)
-	if err != nil {
-		return &Config{}, ing_errors.NewLocationDenied(err.Error())
+	proxysslsecret, err := parser.GetStringAnnotation("proxy-ssl-secret", ing)
+	if err != nil && len(config.PathCertificates) == 0 {
+		return parseProtocolsAndCiphers(ing, err)
 	}
 
-	proxyCert, err := p.r.GetAuthCertificate(proxysslsecret)
-	if err != nil {
-		e := errors.Wrap(err, "error obtaining certificate")
-		return &Config{}, ing_errors.LocationDenied{Reason: e}
+	if proxysslsecret != "" {
+		_, _, err = k8s.ParseNameNS(proxysslsecret)
+		if err != nil {
+			return &Config{}, ing_errors.NewLocationDenied(err.Error())
+		}
+
+		proxyCert, err := p.r.GetAuthCertificate(proxysslsecret)
+		if err != nil {
+			e := errors.Wrap(err, "error obtaining certificate")
+			return &Config{}, ing_errors.LocationDenied{Reason: e}
+		}
+		config.AuthSSLCert = *proxyCert
 	}
-	config.AuthSSLCert = *proxyCert
 
-	config.Ciphers, err = parser.GetStringAnnotation("proxy-ssl-ciphers", ing)
+	config.Ciphers, err = parseCiphers(ing)
+	if ing_errors.IsInvalidContent(err) {
+		return &Config{}, err
+	}
 	if err != nil {
 		config.Ciphers = defaultProxySSLCiphers
 	}
@@ -171,3 +252,62 @@ func (p proxySSL) Parse(ing *networking.Ingress) (interface{}, error) {
 
 	return config, nil
 }
+
+// parseProtocolsAndCiphers returns the configuration of an ingress without
+// client certificates, where only the protocols and ciphers used to connect
+// to legacy HTTPS backends are defined. The error is returned when neither
+// is defined.
+func parseProtocolsAndCiphers(ing *networking.Ingress, err error) (interface{}, error) {
+	ciphers, cerr := parseCiphers(ing)
+	if ing_errors.IsInvalidContent(cerr) {
+		return &Config{}, cerr
+	}
+
+	protocols, perr := parser.GetStringAnnotation("proxy-ssl-protocols", ing)
+	if cerr != nil && perr != nil {
+		return &Config{}, err
+	}
+
+	config := &Config{Ciphers: ciphers}
+	if perr == nil {
+		config.Protocols = sortProtocols(protocols)
+	}
+
+	return config, nil
+}
+
+// parseCiphers returns the value of the proxy-ssl-ciphers annotation, which
+// is rendered as is in the configuration
+func parseCiphers(ing *networking.Ingress) (string, error) {
+	ciphers, err := parser.GetStringAnnotation("proxy-ssl-ciphers", ing)
+	if err != nil {
+		return "", err
+	}
+
+	if !proxySSLCiphersRegex.MatchString(ciphers) {
+		return "", ing_errors.NewInvalidAnnotationContent("proxy-ssl-ciphers", ciphers)
+	}
+
+	return ciphers, nil
+}
+
+// pathCertificates returns the client certificates of the paths
+// defined in the proxy-ssl-path-secrets annotation
+func (p proxySSL) pathCertificates(ing *networking.Ingress) (map[string]resolver.AuthSSLCert, error) {
+	secrets, err := ParsePathSecrets(ing)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make(map[string]resolver.AuthSSLCert, len(secrets))
+	for path, secret := range secrets {
+		cert, err := p.r.GetAuthCertificate(secret)
+		if err != nil {
+			e := errors.Wrapf(err, "error obtaining certificate of path %v", path)
+			return nil, ing_errors.LocationDenied{Reason: e}
+		}
+		certs[path] = *cert
+	}
+
+	return certs, nil
+}
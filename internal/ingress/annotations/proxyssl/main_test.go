@@ -20,9 +20,8 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -30,8 +29,12 @@ import (
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -40,9 +43,13 @@ func buildIngress() *networking.Ingress {
 			Namespace: api.NamespaceDefault,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -70,6 +77,13 @@ type mockSecret struct {
 
 // GetAuthCertificate from mockSecret mocks the GetAuthCertificate for backend certificate authentication
 func (m mockSecret) GetAuthCertificate(name string) (*resolver.AuthSSLCert, error) {
+	if name == "default/mesh-client" {
+		return &resolver.AuthSSLCert{
+			Secret:      "default/mesh-client",
+			PemFileName: "/ssl/mesh-client.pem",
+		}, nil
+	}
+
 	if name != "default/demo-secret" {
 		return nil, errors.Errorf("there is no secret with name %v", name)
 	}
@@ -196,6 +210,118 @@ func TestInvalidAnnotations(t *testing.T) {
 	}
 }
 
+func TestProtocolsAndCiphersWithoutSecret(t *testing.T) {
+	ing := buildIngress()
+	data := map[string]string{}
+	data[parser.GetAnnotationWithPrefix("proxy-ssl-protocols")] = "TLSv1.2 TLSv1"
+	ing.SetAnnotations(data)
+
+	i, err := NewParser(&mockSecret{}).Parse(ing)
+	if err != nil {
+		t.Errorf("Unexpected error with ingress: %v", err)
+	}
+	u, ok := i.(*Config)
+	if !ok {
+		t.Fatalf("expected *Config but got %v", i)
+	}
+
+	if u.Protocols != "TLSv1 TLSv1.2" {
+		t.Errorf("expected %v but got %v", "TLSv1 TLSv1.2", u.Protocols)
+	}
+	if u.Ciphers != "" {
+		t.Errorf("expected no ciphers but got %v", u.Ciphers)
+	}
+	if u.Verify != "" || u.CAFileName != "" {
+		t.Errorf("expected no verification of the proxied HTTPS server but got %v", u)
+	}
+
+	data[parser.GetAnnotationWithPrefix("proxy-ssl-ciphers")] = "DEFAULT:@SECLEVEL=0"
+	ing.SetAnnotations(data)
+
+	i, err = NewParser(&mockSecret{}).Parse(ing)
+	if err != nil {
+		t.Errorf("Unexpected error with ingress: %v", err)
+	}
+	u = i.(*Config)
+	if u.Ciphers != "DEFAULT:@SECLEVEL=0" {
+		t.Errorf("expected %v but got %v", "DEFAULT:@SECLEVEL=0", u.Ciphers)
+	}
+
+	data[parser.GetAnnotationWithPrefix("proxy-ssl-ciphers")] = "HIGH; return 200"
+	ing.SetAnnotations(data)
+
+	_, err = NewParser(&mockSecret{}).Parse(ing)
+	if !errors.IsInvalidContent(err) {
+		t.Errorf("expected an invalid content error for ciphers with a directive but got %v", err)
+	}
+
+	data[parser.GetAnnotationWithPrefix("proxy-ssl-secret")] = "default/demo-secret"
+	ing.SetAnnotations(data)
+
+	_, err = NewParser(&mockSecret{}).Parse(ing)
+	if !errors.IsInvalidContent(err) {
+		t.Errorf("expected an invalid content error for ciphers with a directive but got %v", err)
+	}
+}
+
+func TestPathSecrets(t *testing.T) {
+	ing := buildIngress()
+	fakeSecret := &mockSecret{}
+
+	data := map[string]string{}
+	data[parser.GetAnnotationWithPrefix("proxy-ssl-path-secrets")] = `{"/foo": "default/mesh-client"}`
+	ing.SetAnnotations(data)
+
+	i, err := NewParser(fakeSecret).Parse(ing)
+	if err != nil {
+		t.Fatalf("Unexpected error with ingress: %v", err)
+	}
+	u := i.(*Config)
+
+	foo := u.ForPath("/foo")
+	if foo.PemFileName != "/ssl/mesh-client.pem" || foo.CAFileName != "" {
+		t.Errorf("expected the client certificate of the path but got %+v", foo.AuthSSLCert)
+	}
+	if foo.PathCertificates != nil {
+		t.Errorf("expected no path certificates in the configuration of the location")
+	}
+	if other := u.ForPath("/other"); other.PemFileName != "" {
+		t.Errorf("expected no client certificate but got %v", other.PemFileName)
+	}
+
+	data[parser.GetAnnotationWithPrefix("proxy-ssl-secret")] = "default/demo-secret"
+	ing.SetAnnotations(data)
+
+	i, err = NewParser(fakeSecret).Parse(ing)
+	if err != nil {
+		t.Fatalf("Unexpected error with ingress: %v", err)
+	}
+	u = i.(*Config)
+
+	foo = u.ForPath("/foo")
+	if foo.Secret != "default/mesh-client" || foo.PemFileName != "/ssl/mesh-client.pem" || foo.CAFileName != "/ssl/ca.crt" {
+		t.Errorf("expected the client certificate of the path and the CA of proxy-ssl-secret but got %+v", foo.AuthSSLCert)
+	}
+	if other := u.ForPath("/other"); other.Secret != "default/demo-secret" {
+		t.Errorf("expected the proxy-ssl-secret certificate but got %v", other.Secret)
+	}
+
+	for _, value := range []string{
+		`["default/mesh-client"]`,
+		`{"foo": "default/mesh-client"}`,
+		`{"/foo": "mesh-client"}`,
+		`{"/foo": "default/invalid-secret"}`,
+	} {
+		data[parser.GetAnnotationWithPrefix("proxy-ssl-path-secrets")] = value
+		ing.SetAnnotations(data)
+
+		_, err = NewParser(fakeSecret).Parse(ing)
+		if err == nil {
+			t.Errorf("Expected error with the annotation %v but got nil", value)
+		}
+	}
+}
+
 func TestEquals(t *testing.T) {
 	cfg1 := &Config{}
 	cfg2 := &Config{}
@@ -258,6 +384,15 @@ func TestEquals(t *testing.T) {
 	}
 	cfg2.Verify = "off"
 
+	// Different PathCertificates
+	cfg1.PathCertificates = map[string]resolver.AuthSSLCert{"/foo": sslCert1}
+	cfg2.PathCertificates = map[string]resolver.AuthSSLCert{"/foo": sslCert2}
+	result = cfg1.Equal(cfg2)
+	if result != false {
+		t.Errorf("Expected false")
+	}
+	cfg2.PathCertificates = map[string]resolver.AuthSSLCert{"/foo": sslCert1}
+
 	// Different VerifyDepth
 	cfg1.VerifyDepth = 1
 	cfg2.VerifyDepth = 2
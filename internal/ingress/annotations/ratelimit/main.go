@@ -21,9 +21,10 @@ import (
 	"fmt"
 	"strings"
 
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 	"k8s.io/ingress-nginx/internal/net"
 	"k8s.io/ingress-nginx/internal/sets"
@@ -54,6 +55,10 @@ type Config struct {
 
 	LimitRateAfter int `json:"limit-rate-after"`
 
+	// LimitUploadRate is the number of kilobytes per second allowed to be
+	// received from a given connection
+	LimitUploadRate int `json:"limit-upload-rate"`
+
 	Name string `json:"name"`
 
 	ID string `json:"id"`
@@ -84,6 +89,9 @@ func (rt1 *Config) Equal(rt2 *Config) bool {
 	if rt1.LimitRateAfter != rt2.LimitRateAfter {
 		return false
 	}
+	if rt1.LimitUploadRate != rt2.LimitUploadRate {
+		return false
+	}
 	if rt1.ID != rt2.ID {
 		return false
 	}
@@ -152,6 +160,10 @@ func (a ratelimit) Parse(ing *networking.Ingress) (interface{}, error) {
 	if err != nil {
 		lra = defBackend.LimitRateAfter
 	}
+	lur, _ := parser.GetIntAnnotation("limit-upload-rate", ing)
+	if lur < 0 {
+		return nil, ing_errors.NewInvalidAnnotationContent("limit-upload-rate", lur)
+	}
 
 	rpm, _ := parser.GetIntAnnotation("limit-rpm", ing)
 	rps, _ := parser.GetIntAnnotation("limit-rps", ing)
@@ -170,11 +182,12 @@ func (a ratelimit) Parse(ing *networking.Ingress) (interface{}, error) {
 
 	if rpm == 0 && rps == 0 && conn == 0 {
 		return &Config{
-			Connections:    Zone{},
-			RPS:            Zone{},
-			RPM:            Zone{},
-			LimitRate:      lr,
-			LimitRateAfter: lra,
+			Connections:     Zone{},
+			RPS:             Zone{},
+			RPM:             Zone{},
+			LimitRate:       lr,
+			LimitRateAfter:  lra,
+			LimitUploadRate: lur,
 		}, nil
 	}
 
@@ -199,11 +212,12 @@ func (a ratelimit) Parse(ing *networking.Ingress) (interface{}, error) {
 			Burst:      rpm * burstMultiplier,
 			SharedSize: defSharedSize,
 		},
-		LimitRate:      lr,
-		LimitRateAfter: lra,
-		Name:           zoneName,
-		ID:             encode(zoneName),
-		Whitelist:      cidrs,
+		LimitRate:       lr,
+		LimitRateAfter:  lra,
+		LimitUploadRate: lur,
+		Name:            zoneName,
+		ID:              encode(zoneName),
+		Whitelist:       cidrs,
 	}, nil
 }
 
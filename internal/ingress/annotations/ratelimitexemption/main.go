@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ratelimitexemption
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+	"k8s.io/ingress-nginx/internal/sets"
+)
+
+const (
+	clientCertCNsAnnotation = "limit-exempt-client-cert-cns"
+	jwtIssuerAnnotation     = "limit-exempt-jwt-issuer"
+)
+
+var (
+	// the common names are compared with the unescaped subject of the
+	// certificates, they cannot contain the special characters of RFC 2253
+	commonNameRegex = regexp.MustCompile(`^[^,+"\\<>;=#\x00-\x1f\x7f]+$`)
+	// the issuers are rendered as Lua strings
+	issuerRegex = regexp.MustCompile(`^[^"\\\x00-\x1f\x7f-\x{10ffff}]+$`)
+)
+
+// Config contains the credentials exempting the requests from the rate
+// limits of the location, the global rate limit and limit-req
+type Config struct {
+	// ClientCertCNs are the common names of the client certificates, verified
+	// by auth-tls, exempted from the rate limits
+	ClientCertCNs []string `json:"clientCertCNs,omitempty"`
+	// JWTIssuer is the issuer of the JSON Web Tokens, verified by auth-jwt,
+	// exempted from the rate limits
+	JWTIssuer string `json:"jwtIssuer,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if c1.JWTIssuer != c2.JWTIssuer {
+		return false
+	}
+
+	return sets.StringElementsMatch(c1.ClientCertCNs, c2.ClientCertCNs)
+}
+
+type rateLimitExemption struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new rate limit exemption annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return rateLimitExemption{r}
+}
+
+// Parse parses the annotations contained in the ingress to exempt the
+// requests with a valid credential from the rate limits
+func (a rateLimitExemption) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	cns, err := parser.GetStringAnnotation(clientCertCNsAnnotation, ing)
+	if err == nil {
+		for _, cn := range strings.Split(cns, ",") {
+			cn = strings.TrimSpace(cn)
+			if !commonNameRegex.MatchString(cn) {
+				return Config{}, ing_errors.NewLocationDenied(fmt.Sprintf("invalid common name %q in %v", cn, clientCertCNsAnnotation))
+			}
+			config.ClientCertCNs = append(config.ClientCertCNs, cn)
+		}
+	}
+
+	issuer, err := parser.GetStringAnnotation(jwtIssuerAnnotation, ing)
+	if err == nil {
+		if !issuerRegex.MatchString(issuer) {
+			return Config{}, ing_errors.NewLocationDenied(fmt.Sprintf("invalid %v value %q", jwtIssuerAnnotation, issuer))
+		}
+		config.JWTIssuer = issuer
+	}
+
+	return config, nil
+}
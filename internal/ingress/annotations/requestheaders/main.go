@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package requestheaders
+
+import (
+	"regexp"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+// buffersRegex matches the number and the size of the buffers, like 4 16k
+var buffersRegex = regexp.MustCompile(`^[1-9][0-9]{0,2} [1-9][0-9]*[km]?$`)
+
+type requestHeaders struct {
+	r resolver.Resolver
+}
+
+// Config contains the limits of the request headers of a server
+type Config struct {
+	// LargeClientHeaderBuffers sets the number and the size of the buffers
+	// used to read the large request headers. Empty uses the value of the
+	// configuration
+	LargeClientHeaderBuffers string `json:"largeClientHeaderBuffers,omitempty"`
+	// MaxHeaderCount is the maximum number of headers of a request, the
+	// requests with more headers are rejected with the status code 431.
+	// 0 disables the limit
+	MaxHeaderCount int `json:"maxHeaderCount,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if c1.LargeClientHeaderBuffers != c2.LargeClientHeaderBuffers {
+		return false
+	}
+	if c1.MaxHeaderCount != c2.MaxHeaderCount {
+		return false
+	}
+
+	return true
+}
+
+// NewParser creates a new request headers annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return requestHeaders{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to limit the size and the number of the request headers of the server
+func (rh requestHeaders) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := &Config{}
+
+	buffers, err := parser.GetStringAnnotation("large-client-header-buffers", ing)
+	if err == nil {
+		if buffersRegex.MatchString(buffers) {
+			config.LargeClientHeaderBuffers = buffers
+		} else {
+			klog.Warningf("Annotation large-client-header-buffers contains an invalid value: %v", buffers)
+		}
+	}
+
+	count, err := parser.GetIntAnnotation("max-header-count", ing)
+	if err != nil {
+		return config, nil
+	}
+
+	if count <= 0 {
+		klog.Warningf("Annotation max-header-count contains an invalid value: %v", count)
+		return config, nil
+	}
+
+	config.MaxHeaderCount = count
+
+	return config, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package requestheaders
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	annotationBuffers := parser.GetAnnotationWithPrefix("large-client-header-buffers")
+	annotationMaxHeaderCount := parser.GetAnnotationWithPrefix("max-header-count")
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    Config
+	}{
+		{map[string]string{annotationBuffers: "4 32k"}, Config{LargeClientHeaderBuffers: "4 32k"}},
+		{map[string]string{annotationBuffers: "8 1m"}, Config{LargeClientHeaderBuffers: "8 1m"}},
+		{map[string]string{annotationBuffers: "32k"}, Config{}},
+		{map[string]string{annotationBuffers: "0 32k"}, Config{}},
+		{map[string]string{annotationBuffers: "4 32k; return 200"}, Config{}},
+		{map[string]string{annotationMaxHeaderCount: "100"}, Config{MaxHeaderCount: 100}},
+		{map[string]string{annotationMaxHeaderCount: "0"}, Config{}},
+		{map[string]string{annotationMaxHeaderCount: "-1"}, Config{}},
+		{map[string]string{annotationBuffers: "4 32k", annotationMaxHeaderCount: "invalid"}, Config{LargeClientHeaderBuffers: "4 32k"}},
+		{map[string]string{}, Config{}},
+		{nil, Config{}},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, _ := ap.Parse(ing)
+		if !reflect.DeepEqual(result, &testCase.expected) {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
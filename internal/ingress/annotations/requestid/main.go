@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package requestid
+
+import (
+	"regexp"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	// Trust uses the X-Request-ID header of the request as is
+	Trust = "trust"
+	// Regenerate ignores the X-Request-ID header of the request and
+	// always uses a random value
+	Regenerate = "regenerate"
+	// Prefix uses the X-Request-ID header of the request with a prefix,
+	// to tell the IDs sent by the clients from the generated ones
+	Prefix = "prefix"
+)
+
+// prefixRegex matches the prefixes rendered in the NGINX configuration
+var prefixRegex = regexp.MustCompile(`^[a-zA-Z0-9._:-]+$`)
+
+// Config describes how the X-Request-ID header of the requests is handled
+type Config struct {
+	Policy string `json:"policy"`
+	Prefix string `json:"prefix"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+// IsValid returns true if the given policy is known
+func IsValid(policy string) bool {
+	switch policy {
+	case Trust, Regenerate, Prefix:
+		return true
+	}
+
+	return false
+}
+
+// IsValidPrefix returns true if the given prefix can be rendered in the
+// NGINX configuration
+func IsValidPrefix(prefix string) bool {
+	return prefixRegex.MatchString(prefix)
+}
+
+type requestID struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new request ID annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return requestID{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to define how the X-Request-ID header of the requests is handled
+func (a requestID) Parse(ing *networking.Ingress) (interface{}, error) {
+	defBackend := a.r.GetDefaultBackend()
+	config := Config{
+		Policy: defBackend.RequestIDPolicy,
+		Prefix: defBackend.RequestIDPrefix,
+	}
+	if !IsValid(config.Policy) {
+		config.Policy = Trust
+	}
+
+	policy, err := parser.GetStringAnnotation("request-id-policy", ing)
+	if err == nil {
+		if !IsValid(policy) {
+			return config, ing_errors.NewInvalidAnnotationContent("request-id-policy", policy)
+		}
+		config.Policy = policy
+	}
+
+	prefix, err := parser.GetStringAnnotation("request-id-prefix", ing)
+	if err == nil {
+		if !IsValidPrefix(prefix) {
+			return config, ing_errors.NewInvalidAnnotationContent("request-id-prefix", prefix)
+		}
+		config.Prefix = prefix
+	}
+
+	return config, nil
+}
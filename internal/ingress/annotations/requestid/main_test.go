@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package requestid
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/defaults"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+type mockBackend struct {
+	resolver.Mock
+	policy string
+}
+
+func (m mockBackend) GetDefaultBackend() defaults.Backend {
+	return defaults.Backend{RequestIDPolicy: m.policy, RequestIDPrefix: "client-"}
+}
+
+func TestParse(t *testing.T) {
+	policy := parser.GetAnnotationWithPrefix("request-id-policy")
+	prefix := parser.GetAnnotationWithPrefix("request-id-prefix")
+
+	testCases := []struct {
+		annotations map[string]string
+		def         string
+		expected    Config
+		expectErr   bool
+	}{
+		{map[string]string{policy: "regenerate"}, Trust, Config{Regenerate, "client-"}, false},
+		{map[string]string{policy: "trust"}, Regenerate, Config{Trust, "client-"}, false},
+		{map[string]string{policy: "prefix", prefix: "edge."}, Trust, Config{Prefix, "edge."}, false},
+		{map[string]string{policy: "spoof"}, Regenerate, Config{Regenerate, "client-"}, true},
+		{map[string]string{policy: "prefix", prefix: "edge\";"}, Trust, Config{Prefix, "client-"}, true},
+		{map[string]string{}, Prefix, Config{Prefix, "client-"}, false},
+		{map[string]string{}, "invalid", Config{Trust, "client-"}, false},
+		{nil, "", Config{Trust, "client-"}, false},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, err := NewParser(mockBackend{policy: testCase.def}).Parse(ing)
+		if (err != nil) != testCase.expectErr {
+			t.Errorf("expected error: %v but returned %v, annotations: %s", testCase.expectErr, err, testCase.annotations)
+		}
+		if result != testCase.expected {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
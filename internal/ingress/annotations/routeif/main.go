@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routeif
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	routeIfAnnotation        = "route-if"
+	routeIfServiceAnnotation = "route-if-service"
+)
+
+// Config contains the service receiving the requests matching a predicate
+type Config struct {
+	// Predicate is the compiled expression of the route-if annotation
+	Predicate *Predicate `json:"predicate,omitempty"`
+	// Service receiving the requests matching the predicate, in the
+	// namespace of the ingress
+	Service *apiv1.Service `json:"-"`
+	// Backend is the name of the upstream of the service.
+	// It is set by the controller only if the service has endpoints
+	Backend string `json:"backend,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if !c1.Predicate.Equal(c2.Predicate) {
+		return false
+	}
+	if (c1.Service == nil) != (c2.Service == nil) {
+		return false
+	}
+	if c1.Service != nil && (c1.Service.Namespace != c2.Service.Namespace || c1.Service.Name != c2.Service.Name) {
+		return false
+	}
+	if c1.Backend != c2.Backend {
+		return false
+	}
+
+	return true
+}
+
+type routeIf struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new conditional routing annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return routeIf{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to route the requests matching a predicate to another service
+func (a routeIf) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	expression, err := parser.GetStringAnnotation(routeIfAnnotation, ing)
+	if err != nil {
+		return config, nil
+	}
+
+	predicate, err := Compile(expression)
+	if err != nil {
+		return config, ing_errors.NewLocationDenied(fmt.Sprintf("invalid %v expression: %v", routeIfAnnotation, err))
+	}
+
+	s, err := parser.GetStringAnnotation(routeIfServiceAnnotation, ing)
+	if err != nil {
+		return config, ing_errors.NewLocationDenied(fmt.Sprintf("the %v annotation requires %v", routeIfAnnotation, routeIfServiceAnnotation))
+	}
+
+	name := fmt.Sprintf("%v/%v", ing.Namespace, s)
+	svc, err := a.r.GetService(name)
+	if err != nil {
+		return config, errors.Wrapf(err, "unexpected error reading service %v", name)
+	}
+
+	config.Predicate = predicate
+	config.Service = svc
+
+	return config, nil
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routeif
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+type mockService struct {
+	resolver.Mock
+}
+
+// GetService mocks the GetService call from the routeif package
+func (m mockService) GetService(name string) (*api.Service, error) {
+	if name != "default/qa" {
+		return nil, errors.Errorf("there is no service with name %v", name)
+	}
+
+	return &api.Service{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Namespace: api.NamespaceDefault,
+			Name:      "qa",
+		},
+	}, nil
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		service     string
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, "", false},
+		{"predicate and service", map[string]string{"route-if": "header('X-Env') == 'qa'", "route-if-service": "qa"}, "qa", false},
+		{"invalid predicate", map[string]string{"route-if": "header('X-Env') = 'qa'", "route-if-service": "qa"}, "", true},
+		{"missing service", map[string]string{"route-if": "header('X-Env') == 'qa'"}, "", true},
+		{"unknown service", map[string]string{"route-if": "header('X-Env') == 'qa'", "route-if-service": "unknown"}, "", true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(mockService{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		config, ok := i.(Config)
+		if !ok {
+			t.Errorf("%v: expected a Config type but got %T", test.title, i)
+			continue
+		}
+
+		if test.service == "" {
+			if config.Service != nil || config.Predicate != nil {
+				t.Errorf("%v: expected no route but got %+v", test.title, config)
+			}
+			continue
+		}
+
+		if config.Service == nil || config.Service.Name != test.service {
+			t.Errorf("%v: expected service %v but got %v", test.title, test.service, config.Service)
+		}
+		if config.Predicate == nil {
+			t.Errorf("%v: expected a predicate", test.title)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	eq := func(variable, value string) *Predicate {
+		return &Predicate{Op: OpEqual, Variable: variable, Value: value}
+	}
+
+	tests := []struct {
+		expression string
+		expected   *Predicate
+	}{
+		{`header('X-Env') == 'qa'`, eq("http_x_env", "qa")},
+		{`header('X-Env')=='qa' && cookie('beta')=='1'`,
+			&Predicate{Op: OpAnd, Operands: []*Predicate{eq("http_x_env", "qa"), eq("cookie_beta", "1")}}},
+		{`query("v") != "2" || method() == 'POST' && path() =~ '^/api/'`,
+			&Predicate{Op: OpOr, Operands: []*Predicate{
+				{Op: OpNotEqual, Variable: "arg_v", Value: "2"},
+				{Op: OpAnd, Operands: []*Predicate{
+					eq("request_method", "POST"),
+					{Op: OpMatch, Variable: "uri", Value: "^/api/"},
+				}},
+			}}},
+		{`!(host() == 'a.example.com' || host() == 'b.example.com')`,
+			&Predicate{Op: OpNot, Operands: []*Predicate{
+				{Op: OpOr, Operands: []*Predicate{eq("host", "a.example.com"), eq("host", "b.example.com")}},
+			}}},
+		{`header('X-Name') == 'O\'Brien' && header('X-Path') == "C:\\"`,
+			&Predicate{Op: OpAnd, Operands: []*Predicate{eq("http_x_name", "O'Brien"), eq("http_x_path", `C:\`)}}},
+	}
+
+	for _, test := range tests {
+		predicate, err := Compile(test.expression)
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.expression, err)
+			continue
+		}
+
+		if !predicate.Equal(test.expected) {
+			t.Errorf("%v: expected %+v but got %+v", test.expression, test.expected, predicate)
+		}
+	}
+
+	invalid := []string{
+		``,
+		`header('X-Env')`,
+		`header('X-Env') = 'qa'`,
+		`header('X-Env') == qa`,
+		`header('X Env') == 'qa'`,
+		`cookie('beta;') == '1'`,
+		`body() == 'qa'`,
+		`method('GET') == 'GET'`,
+		`header('X-Env') == 'qa' &&`,
+		`(header('X-Env') == 'qa'`,
+		`header('X-Env') == 'qa')`,
+		`header('X-Env') == 'qa`,
+		`path() =~ '^/api/(v1'`,
+		`header('X-Id') =~ '^(a+)+$'`,
+		`path() =~ '^/(?i)api'`,
+		`header('X-Env') == 'qa' ; return 200`,
+	}
+
+	for _, expression := range invalid {
+		if _, err := Compile(expression); err == nil {
+			t.Errorf("%v: expected an error", expression)
+		}
+	}
+}
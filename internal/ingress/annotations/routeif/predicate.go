@@ -0,0 +1,397 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package routeif
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+)
+
+const (
+	// OpAnd matches when all the operands match
+	OpAnd = "and"
+	// OpOr matches when one of the operands matches
+	OpOr = "or"
+	// OpNot matches when its operand does not match
+	OpNot = "not"
+	// OpEqual matches when the variable is equal to the value
+	OpEqual = "eq"
+	// OpNotEqual matches when the variable is not equal to the value
+	OpNotEqual = "ne"
+	// OpMatch matches when the variable matches the regular expression of
+	// the value
+	OpMatch = "match"
+)
+
+// maxExpressionLength limits the size of the expressions evaluated for each
+// request
+const maxExpressionLength = 1024
+
+var (
+	headerNameRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+	// the names of the cookies and the arguments are part of the names of
+	// the NGINX variables
+	variableNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// Predicate is a node of a compiled route-if expression, a logical operator
+// with its operands or a comparison of an NGINX variable with a value
+type Predicate struct {
+	Op string `json:"op"`
+	// Operands of the and, or and not operators
+	Operands []*Predicate `json:"operands,omitempty"`
+	// Variable is the NGINX variable of the comparisons, like http_x_env
+	Variable string `json:"variable,omitempty"`
+	// Value is compared with the variable
+	Value string `json:"value,omitempty"`
+}
+
+// Equal tests for equality between two Predicate types
+func (p1 *Predicate) Equal(p2 *Predicate) bool {
+	if p1 == p2 {
+		return true
+	}
+	if p1 == nil || p2 == nil {
+		return false
+	}
+	if p1.Op != p2.Op || p1.Variable != p2.Variable || p1.Value != p2.Value {
+		return false
+	}
+	if len(p1.Operands) != len(p2.Operands) {
+		return false
+	}
+	for i := range p1.Operands {
+		if !p1.Operands[i].Equal(p2.Operands[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// accessors are the functions of the expressions returning a property of
+// the request, with the variable of NGINX returning it
+var accessors = map[string]func(string) (string, error){
+	"header": func(name string) (string, error) {
+		if !headerNameRegex.MatchString(name) {
+			return "", fmt.Errorf("invalid header name %q", name)
+		}
+		return "http_" + strings.ToLower(strings.Replace(name, "-", "_", -1)), nil
+	},
+	"cookie": func(name string) (string, error) {
+		if !variableNameRegex.MatchString(name) {
+			return "", fmt.Errorf("invalid cookie name %q", name)
+		}
+		return "cookie_" + name, nil
+	},
+	"query": func(name string) (string, error) {
+		if !variableNameRegex.MatchString(name) {
+			return "", fmt.Errorf("invalid query argument name %q", name)
+		}
+		return "arg_" + name, nil
+	},
+}
+
+// properties are the functions of the expressions without argument
+var properties = map[string]string{
+	"method": "request_method",
+	"path":   "uri",
+	"host":   "host",
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenEqual
+	tokenNotEqual
+	tokenMatch
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []struct {
+	text string
+	kind tokenKind
+}{
+	{"&&", tokenAnd},
+	{"||", tokenOr},
+	{"==", tokenEqual},
+	{"!=", tokenNotEqual},
+	{"=~", tokenMatch},
+	{"!", tokenNot},
+	{"(", tokenLParen},
+	{")", tokenRParen},
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// tokenize splits the expression in tokens, the strings are quoted with
+// single or double quotes and accept backslash escaped characters
+func tokenize(s string) ([]token, error) {
+	tokens := []token{}
+
+	i := 0
+next:
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '\'' || c == '"':
+			start := i
+			var value strings.Builder
+			for i++; i < len(s); i++ {
+				switch s[i] {
+				case c:
+					tokens = append(tokens, token{tokenString, value.String(), start})
+					i++
+					continue next
+				case '\\':
+					i++
+					if i == len(s) {
+						return nil, fmt.Errorf("unterminated string at position %v", start)
+					}
+				}
+				value.WriteByte(s[i])
+			}
+			return nil, fmt.Errorf("unterminated string at position %v", start)
+		case isIdentChar(c):
+			start := i
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, s[start:i], start})
+			continue
+		}
+
+		for _, op := range operators {
+			if strings.HasPrefix(s[i:], op.text) {
+				tokens = append(tokens, token{op.kind, op.text, i})
+				i += len(op.text)
+				continue next
+			}
+		}
+
+		return nil, fmt.Errorf("unexpected character %q at position %v", c, i)
+	}
+
+	return append(tokens, token{tokenEOF, "", len(s)}), nil
+}
+
+type compiler struct {
+	tokens []token
+	pos    int
+}
+
+func (c *compiler) peek() token {
+	return c.tokens[c.pos]
+}
+
+func (c *compiler) next() token {
+	t := c.tokens[c.pos]
+	if t.kind != tokenEOF {
+		c.pos++
+	}
+	return t
+}
+
+func (c *compiler) expect(kind tokenKind, description string) (token, error) {
+	t := c.next()
+	if t.kind != kind {
+		return t, unexpected(t, description)
+	}
+	return t, nil
+}
+
+func unexpected(t token, expected string) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of expression, expected %v", expected)
+	}
+	return fmt.Errorf("unexpected %q at position %v, expected %v", t.text, t.pos, expected)
+}
+
+// logical parses the operands separated by the operator, with the operands
+// parsed by operand
+func (c *compiler) logical(op string, kind tokenKind, operand func() (*Predicate, error)) (*Predicate, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	predicate := &Predicate{Op: op, Operands: []*Predicate{first}}
+	for c.peek().kind == kind {
+		c.next()
+		p, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		predicate.Operands = append(predicate.Operands, p)
+	}
+
+	if len(predicate.Operands) == 1 {
+		return first, nil
+	}
+	return predicate, nil
+}
+
+func (c *compiler) or() (*Predicate, error) {
+	return c.logical(OpOr, tokenOr, c.and)
+}
+
+func (c *compiler) and() (*Predicate, error) {
+	return c.logical(OpAnd, tokenAnd, c.unary)
+}
+
+func (c *compiler) unary() (*Predicate, error) {
+	switch c.peek().kind {
+	case tokenNot:
+		c.next()
+		p, err := c.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Predicate{Op: OpNot, Operands: []*Predicate{p}}, nil
+	case tokenLParen:
+		c.next()
+		p, err := c.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.expect(tokenRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	return c.comparison()
+}
+
+// variable parses a function call, like header('X-Env'), and returns the
+// NGINX variable returning its value
+func (c *compiler) variable() (string, error) {
+	name, err := c.expect(tokenIdent, "a function")
+	if err != nil {
+		return "", err
+	}
+	if _, err := c.expect(tokenLParen, "'('"); err != nil {
+		return "", err
+	}
+
+	if variable, ok := properties[name.text]; ok {
+		if _, err := c.expect(tokenRParen, "')'"); err != nil {
+			return "", err
+		}
+		return variable, nil
+	}
+
+	accessor, ok := accessors[name.text]
+	if !ok {
+		return "", fmt.Errorf("unknown function %q at position %v", name.text, name.pos)
+	}
+
+	arg, err := c.expect(tokenString, "a string")
+	if err != nil {
+		return "", err
+	}
+	if _, err := c.expect(tokenRParen, "')'"); err != nil {
+		return "", err
+	}
+
+	return accessor(arg.text)
+}
+
+func (c *compiler) comparison() (*Predicate, error) {
+	variable, err := c.variable()
+	if err != nil {
+		return nil, err
+	}
+
+	var op string
+	switch t := c.next(); t.kind {
+	case tokenEqual:
+		op = OpEqual
+	case tokenNotEqual:
+		op = OpNotEqual
+	case tokenMatch:
+		op = OpMatch
+	default:
+		return nil, unexpected(t, "'==', '!=' or '=~'")
+	}
+
+	value, err := c.expect(tokenString, "a string")
+	if err != nil {
+		return nil, err
+	}
+
+	// the regular expressions are matched by ngx.re against the values sent
+	// by the clients
+	if op == OpMatch {
+		if err := parser.CheckPortableRegex(value.text); err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", value.text, err)
+		}
+	}
+
+	return &Predicate{Op: op, Variable: variable, Value: value.text}, nil
+}
+
+// Compile validates a route-if expression, like
+// header('X-Env') == 'qa' && cookie('beta') == '1', and returns its
+// predicate. The expressions compare the functions header, cookie and query,
+// with the name of the header, cookie or query argument, and method, path
+// and host, without argument, with strings using the operators ==, != and
+// =~, a regular expression. The comparisons are combined with the operators
+// &&, || and ! and the parentheses.
+func Compile(expression string) (*Predicate, error) {
+	if len(expression) > maxExpressionLength {
+		return nil, fmt.Errorf("the expression is longer than %v characters", maxExpressionLength)
+	}
+
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{tokens: tokens}
+	predicate, err := c.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := c.peek(); t.kind != tokenEOF {
+		return nil, unexpected(t, "'&&', '||' or the end of the expression")
+	}
+
+	return predicate, nil
+}
@@ -17,12 +17,48 @@ limitations under the License.
 package serviceupstream
 
 import (
-	networking "k8s.io/api/networking/v1beta1"
+	"strconv"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
+const (
+	serviceUpstreamAnnotation   = "service-upstream"
+	portAnnotation              = "service-upstream-port"
+	minReadyEndpointsAnnotation = "service-upstream-min-ready-endpoints"
+	affinityAnnotation          = "affinity"
+)
+
+// Config contains the settings of the service-upstream mode, proxying the
+// requests to the ClusterIP of the service instead of its endpoints
+type Config struct {
+	// Enabled uses the ClusterIP of the service as the only endpoint
+	Enabled bool `json:"enabled"`
+	// Port of the service, by number or name, used instead of the port of
+	// the backend of the Ingress
+	Port string `json:"port,omitempty"`
+	// MinReadyEndpoints is the number of ready endpoints the service needs
+	// for its ClusterIP to be used. The zero value always uses the ClusterIP
+	MinReadyEndpoints int `json:"minReadyEndpoints,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
 type serviceUpstream struct {
 	r resolver.Resolver
 }
@@ -32,6 +68,49 @@ func NewParser(r resolver.Resolver) parser.IngressAnnotation {
 	return serviceUpstream{r}
 }
 
+// Parse parses the annotations contained in the ingress rule
+// used to proxy the requests to the ClusterIP of the services
 func (s serviceUpstream) Parse(ing *networking.Ingress) (interface{}, error) {
-	return parser.GetBoolAnnotation("service-upstream", ing)
+	config := Config{}
+
+	enabled, err := parser.GetBoolAnnotation(serviceUpstreamAnnotation, ing)
+	if err != nil || !enabled {
+		return config, err
+	}
+
+	// the cookie session affinity pins the clients to the endpoints of the
+	// pods, the ClusterIP would spread them again
+	if affinity, _ := parser.GetStringAnnotation(affinityAnnotation, ing); affinity == "cookie" {
+		return Config{}, ing_errors.NewInvalidAnnotationConfiguration(serviceUpstreamAnnotation,
+			"cookie session affinity requires the endpoints of the pods")
+	}
+
+	config.Enabled = true
+
+	port, err := parser.GetStringAnnotation(portAnnotation, ing)
+	if err == nil {
+		if !isValidPort(port) {
+			return Config{}, ing_errors.NewInvalidAnnotationContent(portAnnotation, port)
+		}
+		config.Port = port
+	}
+
+	minReady, err := parser.GetIntAnnotation(minReadyEndpointsAnnotation, ing)
+	if err == nil {
+		if minReady < 0 {
+			return Config{}, ing_errors.NewInvalidAnnotationContent(minReadyEndpointsAnnotation, minReady)
+		}
+		config.MinReadyEndpoints = minReady
+	}
+
+	return config, nil
+}
+
+// isValidPort returns true if the port is a port number or the name of a port
+func isValidPort(port string) bool {
+	if number, err := strconv.Atoi(port); err == nil {
+		return len(validation.IsValidPortNum(number)) == 0
+	}
+
+	return len(validation.IsValidPortName(port)) == 0
 }
@@ -20,17 +20,20 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -39,9 +42,13 @@ func buildIngress() *networking.Ingress {
 			Namespace: api.NamespaceDefault,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -70,12 +77,12 @@ func TestIngressAnnotationServiceUpstreamEnabled(t *testing.T) {
 	ing.SetAnnotations(data)
 
 	val, _ := NewParser(&resolver.Mock{}).Parse(ing)
-	enabled, ok := val.(bool)
+	config, ok := val.(Config)
 	if !ok {
-		t.Errorf("expected a bool type")
+		t.Errorf("expected a Config type")
 	}
 
-	if !enabled {
+	if !config.Enabled {
 		t.Errorf("expected annotation value to be true, got false")
 	}
 }
@@ -89,12 +96,12 @@ func TestIngressAnnotationServiceUpstreamSetFalse(t *testing.T) {
 	ing.SetAnnotations(data)
 
 	val, _ := NewParser(&resolver.Mock{}).Parse(ing)
-	enabled, ok := val.(bool)
+	config, ok := val.(Config)
 	if !ok {
-		t.Errorf("expected a bool type")
+		t.Errorf("expected a Config type")
 	}
 
-	if enabled {
+	if config.Enabled {
 		t.Errorf("expected annotation value to be false, got true")
 	}
 
@@ -103,12 +110,50 @@ func TestIngressAnnotationServiceUpstreamSetFalse(t *testing.T) {
 	ing.SetAnnotations(data)
 
 	val, _ = NewParser(&resolver.Mock{}).Parse(ing)
-	enabled, ok = val.(bool)
+	config, ok = val.(Config)
 	if !ok {
-		t.Errorf("expected a bool type")
+		t.Errorf("expected a Config type")
 	}
 
-	if enabled {
+	if config.Enabled {
 		t.Errorf("expected annotation value to be false, got true")
 	}
 }
+
+func TestIngressAnnotationServiceUpstreamSettings(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		expected    Config
+		expErr      bool
+	}{
+		{"port number", map[string]string{"service-upstream": "true", "service-upstream-port": "8443"}, Config{Enabled: true, Port: "8443"}, false},
+		{"port name", map[string]string{"service-upstream": "true", "service-upstream-port": "metrics"}, Config{Enabled: true, Port: "metrics"}, false},
+		{"invalid port number", map[string]string{"service-upstream": "true", "service-upstream-port": "70000"}, Config{}, true},
+		{"invalid port name", map[string]string{"service-upstream": "true", "service-upstream-port": "web_port"}, Config{}, true},
+		{"min ready endpoints", map[string]string{"service-upstream": "true", "service-upstream-min-ready-endpoints": "2"}, Config{Enabled: true, MinReadyEndpoints: 2}, false},
+		{"negative min ready endpoints", map[string]string{"service-upstream": "true", "service-upstream-min-ready-endpoints": "-1"}, Config{}, true},
+		{"service upstream disabled", map[string]string{"service-upstream": "false", "service-upstream-port": "8443"}, Config{}, false},
+		{"cookie session affinity", map[string]string{"service-upstream": "true", "affinity": "cookie"}, Config{}, true},
+		{"service upstream disabled with cookie session affinity", map[string]string{"service-upstream": "false", "affinity": "cookie"}, Config{}, false},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		val, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+		}
+
+		if config, ok := val.(Config); !ok || config != test.expected {
+			t.Errorf("%v: expected %+v but got %+v", test.title, test.expected, val)
+		}
+	}
+}
@@ -18,8 +18,10 @@ package sessionaffinity
 
 import (
 	"regexp"
+	"strings"
 
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
@@ -54,6 +56,19 @@ const (
 
 	// This is used to control the cookie change after request failure
 	annotationAffinityCookieChangeOnFailure = "session-cookie-change-on-failure"
+
+	// This is used to set the Secure attribute of the cookie also in plain HTTP requests,
+	// like the ones received from a load balancer terminating TLS
+	annotationAffinityCookieSecure = "session-cookie-secure"
+
+	// This is used to control the HttpOnly attribute of the cookie
+	annotationAffinityCookieHTTPOnly = "session-cookie-httponly"
+
+	// This is used to control the Domain attribute of the cookie
+	annotationAffinityCookieDomain = "session-cookie-domain"
+
+	// This is used to set the cookie only when the backend has more than one endpoint
+	annotationAffinityCookieConditionalSet = "session-cookie-conditional-set"
 )
 
 var (
@@ -85,6 +100,14 @@ type Cookie struct {
 	SameSite string `json:"samesite"`
 	// Flag that conditionally applies SameSite=None attribute on cookie if user agent accepts it.
 	ConditionalSameSiteNone bool `json:"conditional-samesite-none"`
+	// Flag that sets the Secure attribute also in plain HTTP requests
+	Secure bool `json:"secure"`
+	// HttpOnly attribute value
+	HTTPOnly bool `json:"httponly"`
+	// Domain attribute value
+	Domain string `json:"domain"`
+	// Flag that sets the cookie only when the backend has more than one endpoint
+	ConditionalSet bool `json:"conditional-set"`
 }
 
 // cookieAffinityParse gets the annotation values related to Cookie Affinity
@@ -132,6 +155,28 @@ func (a affinity) cookieAffinityParse(ing *networking.Ingress) *Cookie {
 		klog.V(3).InfoS("Invalid or no annotation value found. Ignoring", "ingress", klog.KObj(ing), "annotation", annotationAffinityCookieChangeOnFailure)
 	}
 
+	cookie.Secure, err = parser.GetBoolAnnotation(annotationAffinityCookieSecure, ing)
+	if err != nil {
+		klog.V(3).InfoS("Invalid or no annotation value found. Ignoring", "ingress", klog.KObj(ing), "annotation", annotationAffinityCookieSecure)
+	}
+
+	cookie.HTTPOnly, err = parser.GetBoolAnnotation(annotationAffinityCookieHTTPOnly, ing)
+	if err != nil {
+		klog.V(3).InfoS("Invalid or no annotation value found. Ignoring", "ingress", klog.KObj(ing), "annotation", annotationAffinityCookieHTTPOnly, "default", true)
+		cookie.HTTPOnly = true
+	}
+
+	cookie.Domain, err = parser.GetStringAnnotation(annotationAffinityCookieDomain, ing)
+	if err != nil || len(validation.IsDNS1123Subdomain(strings.TrimPrefix(cookie.Domain, "."))) > 0 {
+		klog.V(3).InfoS("Invalid or no annotation value found. Ignoring", "ingress", klog.KObj(ing), "annotation", annotationAffinityCookieDomain)
+		cookie.Domain = ""
+	}
+
+	cookie.ConditionalSet, err = parser.GetBoolAnnotation(annotationAffinityCookieConditionalSet, ing)
+	if err != nil {
+		klog.V(3).InfoS("Invalid or no annotation value found. Ignoring", "ingress", klog.KObj(ing), "annotation", annotationAffinityCookieConditionalSet)
+	}
+
 	return cookie
 }
 
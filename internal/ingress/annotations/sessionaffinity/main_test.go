@@ -20,17 +20,20 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
 )
 
 func buildIngress() *networking.Ingress {
 	defaultBackend := networking.IngressBackend{
-		ServiceName: "default-backend",
-		ServicePort: intstr.FromInt(80),
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{
+				Number: 80,
+			},
+		},
 	}
 
 	return &networking.Ingress{
@@ -39,9 +42,13 @@ func buildIngress() *networking.Ingress {
 			Namespace: api.NamespaceDefault,
 		},
 		Spec: networking.IngressSpec{
-			Backend: &networking.IngressBackend{
-				ServiceName: "default-backend",
-				ServicePort: intstr.FromInt(80),
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
+				},
 			},
 			Rules: []networking.IngressRule{
 				{
@@ -109,3 +116,53 @@ func TestIngressAffinityCookieConfig(t *testing.T) {
 		t.Errorf("expected change of failure parameter set to true but returned %v", nginxAffinity.Cookie.ChangeOnFailure)
 	}
 }
+
+func TestIngressAffinityCookieAttributes(t *testing.T) {
+	ing := buildIngress()
+
+	data := map[string]string{}
+	data[parser.GetAnnotationWithPrefix(annotationAffinityType)] = "cookie"
+	ing.SetAnnotations(data)
+
+	affin, _ := NewParser(&resolver.Mock{}).Parse(ing)
+	nginxAffinity := affin.(*Config)
+
+	if nginxAffinity.Cookie.Secure || !nginxAffinity.Cookie.HTTPOnly || nginxAffinity.Cookie.Domain != "" || nginxAffinity.Cookie.ConditionalSet {
+		t.Errorf("expected the default cookie attributes but returned %+v", nginxAffinity.Cookie)
+	}
+
+	data[parser.GetAnnotationWithPrefix(annotationAffinityCookieSecure)] = "true"
+	data[parser.GetAnnotationWithPrefix(annotationAffinityCookieHTTPOnly)] = "false"
+	data[parser.GetAnnotationWithPrefix(annotationAffinityCookieDomain)] = ".example.com"
+	data[parser.GetAnnotationWithPrefix(annotationAffinityCookieConditionalSet)] = "true"
+	ing.SetAnnotations(data)
+
+	affin, _ = NewParser(&resolver.Mock{}).Parse(ing)
+	nginxAffinity = affin.(*Config)
+
+	if !nginxAffinity.Cookie.Secure {
+		t.Errorf("expected session-cookie-secure set to true but returned %v", nginxAffinity.Cookie.Secure)
+	}
+
+	if nginxAffinity.Cookie.HTTPOnly {
+		t.Errorf("expected session-cookie-httponly set to false but returned %v", nginxAffinity.Cookie.HTTPOnly)
+	}
+
+	if nginxAffinity.Cookie.Domain != ".example.com" {
+		t.Errorf("expected .example.com as session-cookie-domain but returned %v", nginxAffinity.Cookie.Domain)
+	}
+
+	if !nginxAffinity.Cookie.ConditionalSet {
+		t.Errorf("expected session-cookie-conditional-set set to true but returned %v", nginxAffinity.Cookie.ConditionalSet)
+	}
+
+	data[parser.GetAnnotationWithPrefix(annotationAffinityCookieDomain)] = "invalid_domain"
+	ing.SetAnnotations(data)
+
+	affin, _ = NewParser(&resolver.Mock{}).Parse(ing)
+	nginxAffinity = affin.(*Config)
+
+	if nginxAffinity.Cookie.Domain != "" {
+		t.Errorf("expected invalid session-cookie-domain to be ignored but returned %v", nginxAffinity.Cookie.Domain)
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package setvariables
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+var (
+	variableNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	// references to variables in the form $name or ${name}
+	variableRefRegex = regexp.MustCompile(`\$(?:\{([a-zA-Z0-9_]*)\}|([a-zA-Z0-9_]*))`)
+	// literal text cannot escape the quoted value of the set directive
+	literalRegex = regexp.MustCompile(`^[^"'\\;{}$\x00-\x1f\x7f]*$`)
+
+	// allowedVariables nginx variables that can be used in the expressions
+	allowedVariables = map[string]bool{
+		"args":               true,
+		"binary_remote_addr": true,
+		"content_length":     true,
+		"content_type":       true,
+		"host":               true,
+		"is_args":            true,
+		"msec":               true,
+		"query_string":       true,
+		"remote_addr":        true,
+		"remote_port":        true,
+		"remote_user":        true,
+		"request_id":         true,
+		"request_method":     true,
+		"request_uri":        true,
+		"scheme":             true,
+		"server_name":        true,
+		"server_port":        true,
+		"server_protocol":    true,
+		"ssl_client_s_dn":    true,
+		"ssl_client_verify":  true,
+		"ssl_protocol":       true,
+		"ssl_server_name":    true,
+		"time_iso8601":       true,
+		"uri":                true,
+	}
+
+	// allowedVariablePrefixes prefixes of the nginx variables with the
+	// request headers, cookies and arguments
+	allowedVariablePrefixes = []string{"http_", "cookie_", "arg_"}
+
+	// reservedVariables nginx variables or variables used in the
+	// template that cannot be overwritten
+	reservedVariables = map[string]bool{
+		"auth_cookie":                 true,
+		"balancer_ewma_score":         true,
+		"best_http_host":              true,
+		"body_bytes_sent":             true,
+		"bytes_sent":                  true,
+		"cache_key":                   true,
+		"connection":                  true,
+		"connection_requests":         true,
+		"connection_upgrade":          true,
+		"csp_nonce":                   true,
+		"document_root":               true,
+		"document_uri":                true,
+		"fallback_upstream_name":      true,
+		"full_x_forwarded_for":        true,
+		"global_rate_limit_exceeding": true,
+		"hostname":                    true,
+		"https":                       true,
+		"ingress_name":                true,
+		"limit_rate":                  true,
+		"location_path":               true,
+		"loggable":                    true,
+		"namespace":                   true,
+		"nginx_version":               true,
+		"pid":                         true,
+		"pipe":                        true,
+		"realpath_root":               true,
+		"req_id":                      true,
+		"request":                     true,
+		"request_body":                true,
+		"request_body_file":           true,
+		"request_completion":          true,
+		"request_filename":            true,
+		"request_length":              true,
+		"request_time":                true,
+		"server_addr":                 true,
+		"service_name":                true,
+		"service_port":                true,
+		"status":                      true,
+		"target":                      true,
+		"time_local":                  true,
+		"tmp_cache_key":               true,
+	}
+
+	// reservedVariablePrefixes prefixes of nginx variables or variables
+	// used in the template
+	reservedVariablePrefixes = []string{
+		"http_", "cookie_", "arg_", "sent_http_", "sent_trailer_", "upstream_",
+		"ssl_", "proxy_", "pass_", "limit_", "realip_", "geoip", "openapi_",
+		"block_", "tcpinfo_", "jwt_",
+	}
+)
+
+// Variable defines a nginx variable set in a location
+type Variable struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Config contains the variables to set in the location
+type Config struct {
+	Variables []Variable `json:"variables,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if len(c1.Variables) != len(c2.Variables) {
+		return false
+	}
+
+	for i := range c1.Variables {
+		if c1.Variables[i] != c2.Variables[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type setVariables struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new set-variables annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return setVariables{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to set nginx variables from attributes of the request
+func (sv setVariables) Parse(ing *networking.Ingress) (interface{}, error) {
+	val, err := parser.GetStringAnnotation("set-variables", ing)
+	if err != nil {
+		return &Config{}, err
+	}
+
+	variables := map[string]string{}
+	err = json.Unmarshal([]byte(val), &variables)
+	if err != nil {
+		return &Config{}, ing_errors.NewInvalidAnnotationContent("set-variables", val)
+	}
+
+	config := &Config{}
+	for name, value := range variables {
+		err := validate(name, value)
+		if err != nil {
+			return &Config{}, ing_errors.NewInvalidAnnotationContent("set-variables", err)
+		}
+
+		config.Variables = append(config.Variables, Variable{Name: name, Value: value})
+	}
+
+	sort.Slice(config.Variables, func(i, j int) bool {
+		return config.Variables[i].Name < config.Variables[j].Name
+	})
+
+	return config, nil
+}
+
+func validate(name, value string) error {
+	if !variableNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+
+	if reservedVariables[name] || allowedVariables[name] || hasPrefix(name, reservedVariablePrefixes) {
+		return fmt.Errorf("variable %q is reserved", name)
+	}
+
+	for _, ref := range variableRefRegex.FindAllStringSubmatch(value, -1) {
+		variable := ref[1] + ref[2]
+		if !isAllowed(variable) {
+			return fmt.Errorf("variable %q is not allowed in the value of %q", variable, name)
+		}
+	}
+
+	if !literalRegex.MatchString(variableRefRegex.ReplaceAllString(value, "")) {
+		return fmt.Errorf("invalid characters in the value of %q", name)
+	}
+
+	return nil
+}
+
+func isAllowed(variable string) bool {
+	if allowedVariables[variable] {
+		return true
+	}
+
+	for _, prefix := range allowedVariablePrefixes {
+		if strings.HasPrefix(variable, prefix) && len(variable) > len(prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasPrefix(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package setvariables
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	annotation := parser.GetAnnotationWithPrefix("set-variables")
+
+	testCases := []struct {
+		name      string
+		value     string
+		expected  *Config
+		expectErr bool
+	}{
+		{"valid variables", `{"tenant": "$http_x_tenant", "client": "${remote_addr}:$remote_port", "env": "production"}`,
+			&Config{Variables: []Variable{
+				{Name: "client", Value: "${remote_addr}:$remote_port"},
+				{Name: "env", Value: "production"},
+				{Name: "tenant", Value: "$http_x_tenant"},
+			}}, false},
+		{"empty map", `{}`, &Config{}, false},
+		{"invalid json", `tenant=$http_x_tenant`, &Config{}, true},
+		{"invalid name", `{"Tenant-ID": "$http_x_tenant"}`, &Config{}, true},
+		{"builtin variable", `{"host": "example.com"}`, &Config{}, true},
+		{"template variable", `{"proxy_upstream_name": "default-echo-80"}`, &Config{}, true},
+		{"header variable", `{"http_x_tenant": "acme"}`, &Config{}, true},
+		{"variable not allowed", `{"tenant": "$request_body"}`, &Config{}, true},
+		{"empty prefix", `{"tenant": "$http_"}`, &Config{}, true},
+		{"dangling dollar", `{"tenant": "$"}`, &Config{}, true},
+		{"unterminated brace", `{"tenant": "${http_x_tenant"}`, &Config{}, true},
+		{"quote injection", `{"tenant": "acme\"; return 200 \"ok"}`, &Config{}, true},
+		{"directive injection", `{"tenant": "acme; deny all"}`, &Config{}, true},
+		{"block injection", `{"tenant": "acme } location / {"}`, &Config{}, true},
+		{"newline", `{"tenant": "acme\nreturn 200"}`, &Config{}, true},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(map[string]string{annotation: testCase.value})
+		result, err := ap.Parse(ing)
+		if testCase.expectErr && err == nil {
+			t.Errorf("%v: expected an error but none returned", testCase.name)
+		}
+		if !testCase.expectErr && err != nil {
+			t.Errorf("%v: unexpected error: %v", testCase.name, err)
+		}
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("%v: expected %v but returned %v", testCase.name, testCase.expected, result)
+		}
+	}
+
+	ing.SetAnnotations(nil)
+	if _, err := ap.Parse(ing); err == nil {
+		t.Errorf("expected an error without annotation")
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snippetfragments
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+// nameRegex matches the names of the fragments, used as names of files
+var nameRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// IsValidName returns true if the name of a fragment is valid
+func IsValidName(name string) bool {
+	return nameRegex.MatchString(name)
+}
+
+// ParseFragments parses a JSON object with the fragments of configuration
+// by name
+func ParseFragments(value string) (map[string]string, error) {
+	fragments := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &fragments); err != nil {
+		return nil, err
+	}
+
+	for name := range fragments {
+		if !IsValidName(name) {
+			return nil, fmt.Errorf("invalid fragment name %q", name)
+		}
+	}
+
+	return fragments, nil
+}
+
+type snippetFragments struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new snippet fragments annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return snippetFragments{r}
+}
+
+// Parse parses the annotations contained in the ingress rule used to
+// include the snippet fragments of the configuration in the locations,
+// in the order of the annotation
+func (s snippetFragments) Parse(ing *networking.Ingress) (interface{}, error) {
+	value, err := parser.GetStringAnnotation("snippet-fragments", ing)
+	if err != nil {
+		return []string{}, nil
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !IsValidName(name) {
+			klog.Warningf("Annotation snippet-fragments contains an invalid fragment name %q", name)
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snippetfragments
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParseFragments(t *testing.T) {
+	fragments, err := ParseFragments(`{"cors": "add_header Access-Control-Allow-Origin *;", "no-cache": "expires -1;"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{"cors": "add_header Access-Control-Allow-Origin *;", "no-cache": "expires -1;"}
+	if !reflect.DeepEqual(fragments, expected) {
+		t.Errorf("expected %v but returned %v", expected, fragments)
+	}
+
+	for _, value := range []string{`{"../cors": "expires -1;"}`, `{"cors": 1}`, `cors`} {
+		if _, err := ParseFragments(value); err == nil {
+			t.Errorf("expected an error parsing %v", value)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	annotation := parser.GetAnnotationWithPrefix("snippet-fragments")
+
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    []string
+	}{
+		{map[string]string{annotation: "cors"}, []string{"cors"}},
+		{map[string]string{annotation: "cors, cache-static"}, []string{"cors", "cache-static"}},
+		{map[string]string{annotation: "cors,../nginx,Cache"}, []string{"cors"}},
+		{map[string]string{annotation: ""}, []string{}},
+		{map[string]string{}, []string{}},
+		{nil, []string{}},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, _ := ap.Parse(ing)
+		if !reflect.DeepEqual(result, testCase.expected) {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, result, testCase.annotations)
+		}
+	}
+}
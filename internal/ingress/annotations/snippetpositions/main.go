@@ -0,0 +1,67 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snippetpositions
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+// Config contains the snippets of configuration rendered at fixed positions
+// of the servers and locations of the Ingress
+type Config struct {
+	// ServerTop is rendered at the beginning of the server, before the
+	// directives generated by the controller
+	ServerTop string `json:"serverTop,omitempty"`
+	// LocationPreProxy is rendered in the locations before the directives
+	// generated by the controller for the proxied requests
+	LocationPreProxy string `json:"locationPreProxy,omitempty"`
+	// LocationPostProxy is rendered at the end of the locations, after the
+	// directive passing the requests to the backend
+	LocationPostProxy string `json:"locationPostProxy,omitempty"`
+	// Order sorts the server snippets of the Ingresses of the same host, the
+	// lowest first
+	Order int `json:"order,omitempty"`
+}
+
+type snippetPositions struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new snippet positions annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return snippetPositions{r}
+}
+
+// Parse parses the annotations contained in the ingress rule used to render
+// snippets of configuration at fixed positions of the servers and locations
+func (a snippetPositions) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	config.ServerTop, _ = parser.GetStringAnnotation("snippet-server-top", ing)
+	config.LocationPreProxy, _ = parser.GetStringAnnotation("snippet-location-pre-proxy", ing)
+	config.LocationPostProxy, _ = parser.GetStringAnnotation("snippet-location-post-proxy", ing)
+
+	order, err := parser.GetIntAnnotation("snippet-order", ing)
+	if err == nil {
+		config.Order = order
+	}
+
+	return config, nil
+}
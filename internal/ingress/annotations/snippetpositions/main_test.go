@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snippetpositions
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestParse(t *testing.T) {
+	serverTop := parser.GetAnnotationWithPrefix("snippet-server-top")
+	preProxy := parser.GetAnnotationWithPrefix("snippet-location-pre-proxy")
+	postProxy := parser.GetAnnotationWithPrefix("snippet-location-post-proxy")
+	order := parser.GetAnnotationWithPrefix("snippet-order")
+
+	ap := NewParser(&resolver.Mock{})
+	if ap == nil {
+		t.Fatalf("expected a parser.IngressAnnotation but returned nil")
+	}
+
+	testCases := []struct {
+		title       string
+		annotations map[string]string
+		expected    Config
+	}{
+		{"no annotations", nil, Config{}},
+		{"all the positions", map[string]string{
+			serverTop: "set $tenant acme;",
+			preProxy:  "rewrite ^/old/(.*)$ /new/$1 break;",
+			postProxy: "proxy_redirect off;",
+			order:     "-10",
+		}, Config{
+			ServerTop:         "set $tenant acme;",
+			LocationPreProxy:  "rewrite ^/old/(.*)$ /new/$1 break;",
+			LocationPostProxy: "proxy_redirect off;",
+			Order:             -10,
+		}},
+		{"invalid order", map[string]string{
+			serverTop: "set $tenant acme;",
+			order:     "first",
+		}, Config{
+			ServerTop: "set $tenant acme;",
+		}},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, err := ap.Parse(ing)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", testCase.title, err)
+		}
+		if result != testCase.expected {
+			t.Errorf("%v: expected %+v but returned %+v", testCase.title, testCase.expected, result)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package staticfiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	staticFilesAnnotation = "static-files"
+
+	// DefaultContentType is the content type of the files without type
+	DefaultContentType = "text/plain"
+
+	// maxQuotedContentSize is the maximum size of the quoted content of a
+	// file, rendered as a parameter of the return directive. NGINX rejects
+	// the parameters not fitting in its buffer of 4096 bytes.
+	maxQuotedContentSize = 4000
+)
+
+var (
+	// pathRegex matches the paths served from NGINX, without the characters
+	// interpreted in the location directive
+	pathRegex = regexp.MustCompile(`^/[a-zA-Z0-9._~/-]*$`)
+	// contentTypeRegex matches a media type with an optional charset
+	contentTypeRegex = regexp.MustCompile(`^[a-z0-9.+-]+/[a-z0-9.+-]+(; ?charset=[a-zA-Z0-9_-]+)?$`)
+	// contentReplacer escapes the content of a file in a quoted string of
+	// the NGINX configuration
+	contentReplacer = strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+		`$`, `${literal_dollar}`,
+	)
+)
+
+// File is a file served directly from NGINX
+type File struct {
+	// Path is the exact path of the file, like /robots.txt
+	Path string `json:"path"`
+	// Content is the body of the responses
+	Content string `json:"content"`
+	// ContentType is the Content-Type of the responses
+	ContentType string `json:"type"`
+}
+
+// Config contains the files served from NGINX in a server
+type Config struct {
+	Files []File `json:"files,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+	if len(c1.Files) != len(c2.Files) {
+		return false
+	}
+
+	for i := range c1.Files {
+		if c1.Files[i] != c2.Files[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseFiles parses a JSON object with the files served from NGINX by path.
+// The value of a file is its content, or an object with the content and
+// the type, like {"content": "{}", "type": "application/json"}. The files
+// are sorted by path.
+func ParseFiles(value string) ([]File, error) {
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, err
+	}
+
+	files := make([]File, 0, len(raw))
+	for path, rawFile := range raw {
+		file := File{Path: path, ContentType: DefaultContentType}
+		if err := json.Unmarshal(rawFile, &file.Content); err != nil {
+			if err := json.Unmarshal(rawFile, &file); err != nil {
+				return nil, fmt.Errorf("invalid file %q: %v", path, err)
+			}
+			file.Path = path
+			if file.ContentType == "" {
+				file.ContentType = DefaultContentType
+			}
+		}
+
+		if err := validate(file); err != nil {
+			return nil, err
+		}
+
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files in %q", value)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+func validate(file File) error {
+	if !pathRegex.MatchString(file.Path) {
+		return fmt.Errorf("invalid path %q", file.Path)
+	}
+
+	if len(QuoteContent(file.Content)) > maxQuotedContentSize {
+		return fmt.Errorf("the content of %q is larger than %v bytes once quoted", file.Path, maxQuotedContentSize)
+	}
+
+	if !contentTypeRegex.MatchString(file.ContentType) {
+		return fmt.Errorf("invalid type %q of %q", file.ContentType, file.Path)
+	}
+
+	return nil
+}
+
+// QuoteContent returns the content of a file as a quoted string of the NGINX
+// configuration, the dollar signs replaced by the $literal_dollar variable
+func QuoteContent(content string) string {
+	return `"` + contentReplacer.Replace(content) + `"`
+}
+
+// Merge returns the files with the overrides, the overrides replacing the
+// files with the same path
+func Merge(files, overrides []File) []File {
+	byPath := make(map[string]File, len(files)+len(overrides))
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+	for _, file := range overrides {
+		byPath[file.Path] = file
+	}
+
+	merged := make([]File, 0, len(byPath))
+	for _, file := range byPath {
+		merged = append(merged, file)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Path < merged[j].Path
+	})
+
+	return merged
+}
+
+type staticFiles struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new static files annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return staticFiles{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the
+// files served from NGINX in the servers of its hosts
+func (s staticFiles) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	value, err := parser.GetStringAnnotation(staticFilesAnnotation, ing)
+	if err != nil {
+		return config, nil
+	}
+
+	config.Files, err = ParseFiles(value)
+	if err != nil {
+		return Config{}, ing_errors.NewInvalidAnnotationContent(staticFilesAnnotation, value)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package staticfiles
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	tests := []struct {
+		title    string
+		value    string
+		expected []File
+		expErr   bool
+	}{
+		{"contents", `{"/robots.txt": "User-agent: *\nDisallow: /*.pdf$", "/.well-known/security.txt": "Contact: mailto:security@example.com"}`, []File{
+			{Path: "/.well-known/security.txt", Content: "Contact: mailto:security@example.com", ContentType: DefaultContentType},
+			{Path: "/robots.txt", Content: "User-agent: *\nDisallow: /*.pdf$", ContentType: DefaultContentType},
+		}, false},
+		{"typed files", `{"/.well-known/assetlinks.json": {"content": "[]", "type": "application/json"}, "/humans.txt": {"content": "Team"}}`, []File{
+			{Path: "/.well-known/assetlinks.json", Content: "[]", ContentType: "application/json"},
+			{Path: "/humans.txt", Content: "Team", ContentType: DefaultContentType},
+		}, false},
+		{"charset", `{"/robots.txt": {"content": "", "type": "text/plain; charset=utf-8"}}`, []File{
+			{Path: "/robots.txt", Content: "", ContentType: "text/plain; charset=utf-8"},
+		}, false},
+		{"invalid JSON", `{"/robots.txt": ""`, nil, true},
+		{"no files", `{}`, nil, true},
+		{"relative path", `{"robots.txt": ""}`, nil, true},
+		{"path with spaces", `{"/robots.txt { }": ""}`, nil, true},
+		{"invalid type", `{"/robots.txt": {"content": "", "type": "text/plain;\nreturn 200"}}`, nil, true},
+		{"content too large", `{"/robots.txt": "` + strings.Repeat("a", maxQuotedContentSize) + `"}`, nil, true},
+		{"quoted content too large", `{"/robots.txt": "` + strings.Repeat("$", maxQuotedContentSize/10) + `"}`, nil, true},
+		{"invalid content", `{"/robots.txt": 200}`, nil, true},
+	}
+
+	for _, test := range tests {
+		files, err := ParseFiles(test.value)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(files, test.expected) {
+			t.Errorf("%v: expected %+v but got %+v", test.title, test.expected, files)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	files := []File{
+		{Path: "/.well-known/security.txt", Content: "Contact: mailto:security@example.com", ContentType: DefaultContentType},
+		{Path: "/robots.txt", Content: "User-agent: *\nDisallow: /", ContentType: DefaultContentType},
+	}
+	overrides := []File{
+		{Path: "/robots.txt", Content: "User-agent: *\nAllow: /", ContentType: DefaultContentType},
+	}
+
+	expected := []File{
+		{Path: "/.well-known/security.txt", Content: "Contact: mailto:security@example.com", ContentType: DefaultContentType},
+		{Path: "/robots.txt", Content: "User-agent: *\nAllow: /", ContentType: DefaultContentType},
+	}
+
+	merged := Merge(files, overrides)
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("expected %+v but got %+v", expected, merged)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	ing := buildIngress()
+
+	config, err := NewParser(&resolver.Mock{}).Parse(ing)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(config, Config{}) {
+		t.Errorf("expected an empty Config but got %+v", config)
+	}
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("static-files"): `{"/robots.txt": "User-agent: *\nDisallow: /"}`,
+	})
+
+	config, err = NewParser(&resolver.Mock{}).Parse(ing)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	expected := Config{Files: []File{{Path: "/robots.txt", Content: "User-agent: *\nDisallow: /", ContentType: DefaultContentType}}}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("expected %+v but got %+v", expected, config)
+	}
+
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("static-files"): `{"robots.txt": ""}`,
+	})
+
+	_, err = NewParser(&resolver.Mock{}).Parse(ing)
+	if err == nil {
+		t.Errorf("expected an error with an invalid path")
+	}
+}
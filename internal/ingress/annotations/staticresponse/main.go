@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package staticresponse
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	staticResponseAnnotation             = "static-response"
+	staticResponseStatusAnnotation       = "static-response-status"
+	staticResponseBodyAnnotation         = "static-response-body"
+	staticResponseContentTypeAnnotation  = "static-response-content-type"
+	staticResponseConfigMapAnnotation    = "static-response-configmap"
+	staticResponseConfigMapKeyAnnotation = "static-response-configmap-key"
+
+	defaultContentType  = "text/plain"
+	defaultConfigMapKey = "body"
+)
+
+var contentTypeRegex = regexp.MustCompile(`^[\w.+-]+/[\w.+-]+(\s*;\s*[\w.+-]+=[\w.+-]+)*$`)
+
+// Config contains the static response answering the requests of a location
+// instead of the service
+type Config struct {
+	// Enabled answers the requests with the static response
+	Enabled bool `json:"enabled"`
+	// Status is the HTTP status code of the response
+	Status int `json:"status"`
+	// ContentType is the value of the Content-Type header of the response
+	ContentType string `json:"contentType"`
+	// Body is the body of the response
+	Body string `json:"body"`
+	// ConfigMap is the ConfigMap, in namespace/name format, containing the
+	// body of the response
+	ConfigMap string `json:"configMap,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type staticResponse struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new static response annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return staticResponse{r}
+}
+
+// Parse parses the annotations contained in the ingress to answer the
+// requests of the locations with a static response
+func (a staticResponse) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	enabled, err := parser.GetBoolAnnotation(staticResponseAnnotation, ing)
+	if err != nil || !enabled {
+		return config, nil
+	}
+
+	status, err := parser.GetIntAnnotation(staticResponseStatusAnnotation, ing)
+	if err != nil {
+		status = http.StatusOK
+	}
+	if status < 200 || status > 599 {
+		return config, ing_errors.NewInvalidAnnotationContent(staticResponseStatusAnnotation, status)
+	}
+
+	contentType, err := parser.GetStringAnnotation(staticResponseContentTypeAnnotation, ing)
+	if err != nil {
+		contentType = defaultContentType
+	}
+	if !contentTypeRegex.MatchString(contentType) {
+		return config, ing_errors.NewInvalidAnnotationContent(staticResponseContentTypeAnnotation, contentType)
+	}
+
+	body, err := parser.GetStringAnnotation(staticResponseBodyAnnotation, ing)
+	if err != nil {
+		body = ""
+	}
+
+	cm, err := parser.GetStringAnnotation(staticResponseConfigMapAnnotation, ing)
+	if err == nil {
+		if body != "" {
+			return config, ing_errors.LocationDenied{
+				Reason: errors.Errorf("only one of %v and %v can be set", staticResponseBodyAnnotation, staticResponseConfigMapAnnotation),
+			}
+		}
+
+		cm, body, err = a.configMapBody(cm, ing)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	config.Enabled = true
+	config.Status = status
+	config.ContentType = contentType
+	config.Body = body
+	config.ConfigMap = cm
+
+	return config, nil
+}
+
+// configMapBody returns the key, in namespace/name format, of the ConfigMap
+// and the body of the response it contains. The ConfigMap must be in the
+// namespace of the Ingress.
+func (a staticResponse) configMapBody(cm string, ing *networking.Ingress) (string, string, error) {
+	cmns, cmn, err := cache.SplitMetaNamespaceKey(cm)
+	if err != nil {
+		return "", "", ing_errors.LocationDenied{
+			Reason: errors.Wrap(err, "error reading configmap name from annotation"),
+		}
+	}
+
+	if cmns == "" {
+		cmns = ing.Namespace
+	}
+
+	// the body is served publicly, the ConfigMaps of other namespaces are
+	// not readable by the authors of the Ingress
+	if cmns != ing.Namespace {
+		return "", "", ing_errors.NewInvalidAnnotationContent(staticResponseConfigMapAnnotation, cm)
+	}
+
+	cm = fmt.Sprintf("%v/%v", cmns, cmn)
+	cmap, err := a.r.GetConfigMap(cm)
+	if err != nil {
+		return "", "", ing_errors.LocationDenied{
+			Reason: errors.Wrapf(err, "unexpected error reading configmap %v", cm),
+		}
+	}
+
+	key, err := parser.GetStringAnnotation(staticResponseConfigMapKeyAnnotation, ing)
+	if err != nil {
+		key = defaultConfigMapKey
+	}
+
+	body, ok := cmap.Data[key]
+	if !ok {
+		return "", "", ing_errors.LocationDenied{
+			Reason: errors.Errorf("configmap %v does not contain the key %v", cm, key),
+		}
+	}
+
+	return cm, body, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package staticresponse
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+type mockConfigMap struct {
+	resolver.Mock
+}
+
+func (m mockConfigMap) GetConfigMap(name string) (*api.ConfigMap, error) {
+	if name != "default/legal" && name != "kube-system/legal" {
+		return nil, errors.Errorf("there is no configmap with name %v", name)
+	}
+
+	return &api.ConfigMap{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Namespace: api.NamespaceDefault,
+			Name:      "legal",
+		},
+		Data: map[string]string{"body": "<h1>Terms</h1>", "privacy.html": "<h1>Privacy</h1>"},
+	}, nil
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		expected    Config
+		expErr      bool
+	}{
+		{"no annotation", map[string]string{}, Config{}, false},
+		{"disabled", map[string]string{"static-response": "false", "static-response-body": "ok"}, Config{}, false},
+		{"enabled", map[string]string{"static-response": "true"}, Config{Enabled: true, Status: 200, ContentType: "text/plain"}, false},
+		{"with status, body and content type", map[string]string{
+			"static-response":              "true",
+			"static-response-status":       "202",
+			"static-response-body":         `{"version": "1.2.3"}`,
+			"static-response-content-type": "application/json; charset=utf-8",
+		}, Config{Enabled: true, Status: 202, ContentType: "application/json; charset=utf-8", Body: `{"version": "1.2.3"}`}, false},
+		{"body from a configmap", map[string]string{
+			"static-response":              "true",
+			"static-response-configmap":    "legal",
+			"static-response-content-type": "text/html",
+		}, Config{Enabled: true, Status: 200, ContentType: "text/html", Body: "<h1>Terms</h1>", ConfigMap: "default/legal"}, false},
+		{"body from a key of a configmap", map[string]string{
+			"static-response":               "true",
+			"static-response-configmap":     "default/legal",
+			"static-response-configmap-key": "privacy.html",
+		}, Config{Enabled: true, Status: 200, ContentType: "text/plain", Body: "<h1>Privacy</h1>", ConfigMap: "default/legal"}, false},
+		{"invalid status", map[string]string{"static-response": "true", "static-response-status": "101"}, Config{}, true},
+		{"invalid content type", map[string]string{"static-response": "true", "static-response-content-type": `text/html"; x`}, Config{}, true},
+		{"body and configmap", map[string]string{
+			"static-response":           "true",
+			"static-response-body":      "ok",
+			"static-response-configmap": "legal",
+		}, Config{}, true},
+		{"configmap of another namespace", map[string]string{
+			"static-response":           "true",
+			"static-response-configmap": "kube-system/legal",
+		}, Config{}, true},
+		{"missing configmap", map[string]string{"static-response": "true", "static-response-configmap": "missing"}, Config{}, true},
+		{"missing key", map[string]string{
+			"static-response":               "true",
+			"static-response-configmap":     "legal",
+			"static-response-configmap-key": "missing",
+		}, Config{}, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&mockConfigMap{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		config, ok := i.(Config)
+		if !ok {
+			t.Errorf("%v: expected a Config type but got %T", test.title, i)
+			continue
+		}
+
+		if config != test.expected {
+			t.Errorf("%v: expected %+v but got %+v", test.title, test.expected, config)
+		}
+	}
+}
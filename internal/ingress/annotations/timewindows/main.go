@@ -0,0 +1,237 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timewindows
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	// the controller image does not contain the timezone database
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	timeWindowsAnnotation = "allowed-time-windows"
+	timezoneAnnotation    = "allowed-time-windows-timezone"
+
+	defaultTimezone = "UTC"
+)
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Window contains the values matched by each field of a cron-like
+// expression. A minute is inside the window when all the fields match.
+type Window struct {
+	Minutes  []int `json:"minutes"`
+	Hours    []int `json:"hours"`
+	Days     []int `json:"days"`
+	Months   []int `json:"months"`
+	Weekdays []int `json:"weekdays"`
+}
+
+// Config contains the time windows during which the requests are allowed
+type Config struct {
+	Windows []Window `json:"windows"`
+	// Timezone is the name, in the IANA Time Zone database, of the timezone
+	// the windows are evaluated in
+	Timezone string `json:"timezone"`
+}
+
+type timeWindows struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new allowed time windows annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return timeWindows{r}
+}
+
+// Parse parses the annotations contained in the ingress to restrict the
+// access to the time windows defined with cron-like expressions
+func (a timeWindows) Parse(ing *networking.Ingress) (interface{}, error) {
+	expressions, err := parser.GetStringAnnotation(timeWindowsAnnotation, ing)
+	if err != nil {
+		return nil, err
+	}
+
+	timezone, err := parser.GetStringAnnotation(timezoneAnnotation, ing)
+	if err != nil {
+		timezone = defaultTimezone
+	}
+
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return nil, ing_errors.LocationDenied{
+			Reason: errors.Wrapf(err, "invalid value in '%v' annotation", timezoneAnnotation),
+		}
+	}
+
+	config := &Config{Timezone: timezone}
+	for _, expression := range strings.Split(expressions, ";") {
+		expression = strings.TrimSpace(expression)
+		if expression == "" {
+			continue
+		}
+
+		window, err := ParseWindow(expression)
+		if err != nil {
+			return nil, ing_errors.LocationDenied{
+				Reason: errors.Wrapf(err, "invalid expression %q in '%v' annotation", expression, timeWindowsAnnotation),
+			}
+		}
+
+		config.Windows = append(config.Windows, window)
+	}
+
+	if len(config.Windows) == 0 {
+		return nil, ing_errors.NewInvalidAnnotationContent(timeWindowsAnnotation, expressions)
+	}
+
+	return config, nil
+}
+
+// ParseWindow parses a cron-like expression with the minute, hour, day of
+// month, month and day of week fields. Each field accepts *, values, ranges,
+// steps and lists of them, months and days of week also accept their names.
+func ParseWindow(expression string) (Window, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return Window{}, fmt.Errorf("expected 5 fields but %v were found", len(fields))
+	}
+
+	var err error
+	window := Window{}
+
+	if window.Minutes, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return Window{}, errors.Wrap(err, "minute")
+	}
+	if window.Hours, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return Window{}, errors.Wrap(err, "hour")
+	}
+	if window.Days, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return Window{}, errors.Wrap(err, "day of month")
+	}
+	if window.Months, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return Window{}, errors.Wrap(err, "month")
+	}
+	// 7 is accepted as Sunday
+	if window.Weekdays, err = parseField(fields[4], 0, 7, weekdayNames); err != nil {
+		return Window{}, errors.Wrap(err, "day of week")
+	}
+	window.Weekdays = normalizeWeekdays(window.Weekdays)
+
+	return window, nil
+}
+
+// parseField returns the sorted values matched by a field of an expression
+func parseField(field string, min, max int, names map[string]int) ([]int, error) {
+	matched := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			part = part[:i]
+		}
+
+		first, last := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			first, err = parseValue(bounds[0], min, max, names)
+			if err != nil {
+				return nil, err
+			}
+
+			last = first
+			if len(bounds) == 2 {
+				last, err = parseValue(bounds[1], min, max, names)
+				if err != nil {
+					return nil, err
+				}
+			} else if step != 1 {
+				// a single value with a step matches every step until the maximum
+				last = max
+			}
+
+			if first > last {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		}
+
+		for value := first; value <= last; value += step {
+			matched[value] = true
+		}
+	}
+
+	values := make([]int, 0, len(matched))
+	for value := range matched {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+
+	return values, nil
+}
+
+func parseValue(s string, min, max int, names map[string]int) (int, error) {
+	if value, ok := names[strings.ToLower(s)]; ok {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if value < min || value > max {
+		return 0, fmt.Errorf("value %v out of range [%v-%v]", value, min, max)
+	}
+
+	return value, nil
+}
+
+func normalizeWeekdays(weekdays []int) []int {
+	if len(weekdays) == 0 || weekdays[len(weekdays)-1] != 7 {
+		return weekdays
+	}
+
+	weekdays = weekdays[:len(weekdays)-1]
+	if len(weekdays) == 0 || weekdays[0] != 0 {
+		weekdays = append([]int{0}, weekdays...)
+	}
+
+	return weekdays
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timewindows
+
+import (
+	"reflect"
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+func values(first, last, step int) []int {
+	v := []int{}
+	for i := first; i <= last; i += step {
+		v = append(v, i)
+	}
+	return v
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   Window
+		expErr     bool
+	}{
+		{"* * * * *", Window{values(0, 59, 1), values(0, 23, 1), values(1, 31, 1), values(1, 12, 1), values(0, 6, 1)}, false},
+		{"0,30 9-17 * * mon-fri", Window{[]int{0, 30}, values(9, 17, 1), values(1, 31, 1), values(1, 12, 1), values(1, 5, 1)}, false},
+		{"*/15 */6 1-15/7 JAN,dec sat-7", Window{values(0, 59, 15), values(0, 23, 6), []int{1, 8, 15}, []int{1, 12}, []int{0, 6}}, false},
+		{"5/20 0 1 1 0", Window{[]int{5, 25, 45}, []int{0}, []int{1}, []int{1}, []int{0}}, false},
+		{"* * * *", Window{}, true},
+		{"60 * * * *", Window{}, true},
+		{"* 17-9 * * *", Window{}, true},
+		{"* * 0 * *", Window{}, true},
+		{"* * * * */0", Window{}, true},
+		{"* * * foo *", Window{}, true},
+	}
+
+	for _, test := range tests {
+		window, err := ParseWindow(test.expression)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.expression, test.expErr, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(window, test.expected) {
+			t.Errorf("%v: expected %v but got %v", test.expression, test.expected, window)
+		}
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title       string
+		annotations map[string]string
+		expected    *Config
+		expErr      bool
+		denied      bool
+	}{
+		{"no annotation", map[string]string{}, nil, true, false},
+		{"default timezone", map[string]string{timeWindowsAnnotation: "* 9-17 * * 1-5"}, &Config{
+			Windows:  []Window{{values(0, 59, 1), values(9, 17, 1), values(1, 31, 1), values(1, 12, 1), values(1, 5, 1)}},
+			Timezone: "UTC",
+		}, false, false},
+		{"several windows", map[string]string{
+			timeWindowsAnnotation: "* 9-17 * * 1-5; * 10-12 * * 6;",
+			timezoneAnnotation:    "Europe/Berlin",
+		}, &Config{
+			Windows: []Window{
+				{values(0, 59, 1), values(9, 17, 1), values(1, 31, 1), values(1, 12, 1), values(1, 5, 1)},
+				{values(0, 59, 1), values(10, 12, 1), values(1, 31, 1), values(1, 12, 1), []int{6}},
+			},
+			Timezone: "Europe/Berlin",
+		}, false, false},
+		{"empty windows", map[string]string{timeWindowsAnnotation: " ; "}, nil, true, false},
+		{"invalid expression", map[string]string{timeWindowsAnnotation: "* 25 * * *"}, nil, true, true},
+		{"invalid timezone", map[string]string{
+			timeWindowsAnnotation: "* * * * *",
+			timezoneAnnotation:    "Mars/Olympus_Mons",
+		}, nil, true, true},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+
+		data := map[string]string{}
+		for k, v := range test.annotations {
+			data[parser.GetAnnotationWithPrefix(k)] = v
+		}
+		ing.SetAnnotations(data)
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+		if ing_errors.IsLocationDenied(err) != test.denied {
+			t.Errorf("%v: expected the location to be denied %v but got %v", test.title, test.denied, err)
+		}
+		if err != nil {
+			continue
+		}
+
+		config, ok := i.(*Config)
+		if !ok {
+			t.Errorf("%v: expected a *Config type", test.title)
+			continue
+		}
+
+		if !reflect.DeepEqual(config, test.expected) {
+			t.Errorf("%v: expected %v but got %v", test.title, test.expected, config)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trailingslash
+
+import (
+	"net/http"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	// PolicyOff does not redirect the requests
+	PolicyOff = "off"
+	// PolicyAdd redirects the requests of paths without trailing slash, like
+	// /foo, to the path with the slash, /foo/. The paths whose last segment
+	// contains a dot, like /app.js, are not redirected.
+	PolicyAdd = "add"
+	// PolicyRemove redirects the requests of paths with a trailing slash,
+	// like /foo/, to the path without the slash, /foo
+	PolicyRemove = "remove"
+)
+
+const (
+	trailingSlashAnnotation     = "trailing-slash"
+	trailingSlashCodeAnnotation = "trailing-slash-redirect-code"
+)
+
+// Config contains the redirection of the requests of the locations to the
+// paths with or without trailing slash
+type Config struct {
+	Policy string `json:"policy"`
+	// Code is the status code of the redirections, zero uses the
+	// http-redirect-code of the configuration
+	Code int `json:"code"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+// IsValid returns true if the given policy is known
+func IsValid(policy string) bool {
+	return policy == PolicyOff || policy == PolicyAdd || policy == PolicyRemove
+}
+
+func isValidCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+type trailingSlash struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new trailing slash annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return trailingSlash{r}
+}
+
+// Parse parses the annotations contained in the ingress to redirect the
+// requests to the paths with or without trailing slash
+func (a trailingSlash) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{Policy: PolicyOff}
+
+	policy, err := parser.GetStringAnnotation(trailingSlashAnnotation, ing)
+	if err != nil {
+		return config, nil
+	}
+	if !IsValid(policy) {
+		return config, ing_errors.NewInvalidAnnotationContent(trailingSlashAnnotation, policy)
+	}
+
+	code, err := parser.GetIntAnnotation(trailingSlashCodeAnnotation, ing)
+	if err == nil && !isValidCode(code) {
+		return config, ing_errors.NewInvalidAnnotationContent(trailingSlashCodeAnnotation, code)
+	}
+
+	if policy == PolicyOff {
+		return config, nil
+	}
+
+	config.Policy = policy
+	config.Code = code
+
+	return config, nil
+}
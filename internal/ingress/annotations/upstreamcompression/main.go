@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upstreamcompression
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	// Passthrough sends the Accept-Encoding header of the clients to the backend
+	Passthrough = "passthrough"
+	// Strip removes the Accept-Encoding header, the backend sends uncompressed responses
+	Strip = "strip"
+	// Gzip requests gzip compressed responses from the backend, decompressed
+	// by NGINX for the clients not accepting them
+	Gzip = "gzip"
+)
+
+type upstreamCompression struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new upstream compression annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return upstreamCompression{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to control the compression of the responses of the upstream
+func (a upstreamCompression) Parse(ing *networking.Ingress) (interface{}, error) {
+	mode, err := parser.GetStringAnnotation("upstream-compression", ing)
+	if err != nil {
+		return "", err
+	}
+
+	switch mode {
+	case Passthrough, Strip, Gzip:
+		return mode, nil
+	default:
+		return "", ing_errors.NewInvalidAnnotationContent("upstream-compression", mode)
+	}
+}
@@ -17,7 +17,10 @@ limitations under the License.
 package upstreamhashby
 
 import (
-	networking "k8s.io/api/networking/v1beta1"
+	"strconv"
+
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/klog/v2"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -29,9 +32,11 @@ type upstreamhashby struct {
 
 // Config contains the Consistent hash configuration to be used in the Ingress
 type Config struct {
-	UpstreamHashBy           string `json:"upstream-hash-by,omitempty"`
-	UpstreamHashBySubset     bool   `json:"upstream-hash-by-subset,omitempty"`
-	UpstreamHashBySubsetSize int    `json:"upstream-hash-by-subset-size,omitempty"`
+	UpstreamHashBy              string  `json:"upstream-hash-by,omitempty"`
+	UpstreamHashBySubset        bool    `json:"upstream-hash-by-subset,omitempty"`
+	UpstreamHashBySubsetSize    int     `json:"upstream-hash-by-subset-size,omitempty"`
+	UpstreamHashByFallback      string  `json:"upstream-hash-by-fallback,omitempty"`
+	UpstreamHashByBalanceFactor float64 `json:"upstream-hash-by-balance-factor,omitempty"`
 }
 
 // NewParser creates a new UpstreamHashBy annotation parser
@@ -44,10 +49,21 @@ func (a upstreamhashby) Parse(ing *networking.Ingress) (interface{}, error) {
 	upstreamHashBy, _ := parser.GetStringAnnotation("upstream-hash-by", ing)
 	upstreamHashBySubset, _ := parser.GetBoolAnnotation("upstream-hash-by-subset", ing)
 	upstreamHashbySubsetSize, _ := parser.GetIntAnnotation("upstream-hash-by-subset-size", ing)
+	upstreamHashByFallback, _ := parser.GetStringAnnotation("upstream-hash-by-fallback", ing)
 
 	if upstreamHashbySubsetSize == 0 {
 		upstreamHashbySubsetSize = 3
 	}
 
-	return &Config{upstreamHashBy, upstreamHashBySubset, upstreamHashbySubsetSize}, nil
+	var balanceFactor float64
+	if val, err := parser.GetStringAnnotation("upstream-hash-by-balance-factor", ing); err == nil {
+		balanceFactor, err = strconv.ParseFloat(val, 64)
+		// a factor of 1 or less leaves the endpoints without spare capacity
+		if err != nil || balanceFactor <= 1 {
+			klog.Warningf("%v is not a valid balance factor for the consistent hashing, it must be greater than 1", val)
+			balanceFactor = 0
+		}
+	}
+
+	return &Config{upstreamHashBy, upstreamHashBySubset, upstreamHashbySubsetSize, upstreamHashByFallback, balanceFactor}, nil
 }
@@ -20,7 +20,7 @@ import (
 	"testing"
 
 	api "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
@@ -66,3 +66,64 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFallback(t *testing.T) {
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+	ing.SetAnnotations(map[string]string{
+		parser.GetAnnotationWithPrefix("upstream-hash-by"):          "$http_x_user_id",
+		parser.GetAnnotationWithPrefix("upstream-hash-by-fallback"): "$remote_addr",
+	})
+
+	result, _ := NewParser(&resolver.Mock{}).Parse(ing)
+	uc, ok := result.(*Config)
+	if !ok {
+		t.Fatalf("expected a Config type")
+	}
+
+	if uc.UpstreamHashByFallback != "$remote_addr" {
+		t.Errorf("expected $remote_addr but returned %v", uc.UpstreamHashByFallback)
+	}
+}
+
+func TestParseBalanceFactor(t *testing.T) {
+	annotation := parser.GetAnnotationWithPrefix("upstream-hash-by-balance-factor")
+
+	testCases := []struct {
+		annotations map[string]string
+		expected    float64
+	}{
+		{map[string]string{annotation: "1.25"}, 1.25},
+		{map[string]string{annotation: "2"}, 2},
+		{map[string]string{annotation: "1"}, 0},
+		{map[string]string{annotation: "0.5"}, 0},
+		{map[string]string{annotation: "high"}, 0},
+		{map[string]string{}, 0},
+	}
+
+	ing := &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{},
+	}
+
+	for _, testCase := range testCases {
+		ing.SetAnnotations(testCase.annotations)
+		result, _ := NewParser(&resolver.Mock{}).Parse(ing)
+		uc, ok := result.(*Config)
+		if !ok {
+			t.Fatalf("expected a Config type")
+		}
+
+		if uc.UpstreamHashByBalanceFactor != testCase.expected {
+			t.Errorf("expected %v but returned %v, annotations: %s", testCase.expected, uc.UpstreamHashByBalanceFactor, testCase.annotations)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upstreamhostheader
+
+import (
+	"fmt"
+	"regexp"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+var (
+	variableRegex = regexp.MustCompile(`\$\{?([a-zA-Z0-9_]+)\}?`)
+	hostRegex     = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.\-]*[a-zA-Z0-9])?(:[0-9]+)?$`)
+
+	// allowedVariables contains the NGINX variables that can be used
+	// to build the Host header
+	allowedVariables = map[string]bool{
+		"host":           true,
+		"best_http_host": true,
+		"server_name":    true,
+		"namespace":      true,
+		"ingress_name":   true,
+		"service_name":   true,
+		"service_port":   true,
+	}
+)
+
+type upstreamHostHeader struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new upstream host header annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return upstreamHostHeader{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to set the Host header sent to the upstream
+func (a upstreamHostHeader) Parse(ing *networking.Ingress) (interface{}, error) {
+	host, err := parser.GetStringAnnotation("upstream-host-header", ing)
+	if err != nil {
+		return "", err
+	}
+
+	if vhost, err := parser.GetStringAnnotation("upstream-vhost", ing); err == nil && vhost != "" {
+		return "", ing_errors.NewInvalidAnnotationConfiguration("upstream-host-header", "can not be used together with upstream-vhost")
+	}
+
+	if err := Validate(host); err != nil {
+		return "", ing_errors.NewInvalidAnnotationConfiguration("upstream-host-header", err.Error())
+	}
+
+	return host, nil
+}
+
+// Validate checks the given value is a valid host, optionally with a port,
+// where only the allowed NGINX variables are used
+func Validate(host string) error {
+	for _, match := range variableRegex.FindAllStringSubmatch(host, -1) {
+		if !allowedVariables[match[1]] {
+			return fmt.Errorf("variable $%v is not allowed", match[1])
+		}
+	}
+
+	// variables are replaced with a valid value to validate the rest of the host
+	if !hostRegex.MatchString(variableRegex.ReplaceAllString(host, "0")) {
+		return fmt.Errorf("%q is not a valid host", host)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upstreamkeepalive
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	connectionsAnnotation = "upstream-keepalive-connections"
+	requestsAnnotation    = "upstream-keepalive-requests"
+	timeoutAnnotation     = "upstream-keepalive-timeout"
+)
+
+// Config contains the size of the pool of idle keepalive connections to the
+// endpoints of a backend. The zero values use the settings of the ConfigMap.
+type Config struct {
+	// Connections is the maximum number of idle connections kept by each worker
+	Connections int `json:"connections,omitempty"`
+	// Requests is the maximum number of requests served through a connection
+	Requests int `json:"requests,omitempty"`
+	// Timeout is the time, in seconds, an idle connection stays open
+	Timeout int `json:"timeout,omitempty"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type upstreamKeepalive struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new upstream keepalive annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return upstreamKeepalive{r}
+}
+
+// Parse parses the annotations contained in the ingress to size the
+// keepalive pool of the backends independently of the ConfigMap
+func (a upstreamKeepalive) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	for _, setting := range []struct {
+		annotation string
+		value      *int
+	}{
+		{connectionsAnnotation, &config.Connections},
+		{requestsAnnotation, &config.Requests},
+		{timeoutAnnotation, &config.Timeout},
+	} {
+		value, err := parser.GetIntAnnotation(setting.annotation, ing)
+		if err != nil {
+			continue
+		}
+		if value <= 0 {
+			return Config{}, ing_errors.NewInvalidAnnotationContent(setting.annotation, value)
+		}
+
+		*setting.value = value
+	}
+
+	return config, nil
+}
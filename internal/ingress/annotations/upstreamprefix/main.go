@@ -0,0 +1,61 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upstreamprefix
+
+import (
+	"regexp"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const upstreamPrefixAnnotation = "upstream-prefix"
+
+// prefixRegex matches the absolute paths of non empty segments, with an
+// optional trailing slash, made of unreserved and sub-delims characters or
+// percent-encoded octets. The characters with a meaning for NGINX, like $,
+// ; or quotes, must be percent-encoded.
+var prefixRegex = regexp.MustCompile(`^(/([A-Za-z0-9._~!&'()*+,=:@-]|%[0-9A-Fa-f]{2})+)+/?$`)
+
+type upstreamPrefix struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new upstream prefix annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return upstreamPrefix{r}
+}
+
+// Parse parses the annotations contained in the ingress to prepend a path
+// to the URI of the requests sent to the backend. The trailing slash of the
+// prefix is removed, the URIs of the requests already start with one.
+func (a upstreamPrefix) Parse(ing *networking.Ingress) (interface{}, error) {
+	prefix, err := parser.GetStringAnnotation(upstreamPrefixAnnotation, ing)
+	if err != nil {
+		return "", nil
+	}
+
+	if !prefixRegex.MatchString(prefix) {
+		return "", ing_errors.NewInvalidAnnotationContent(upstreamPrefixAnnotation, prefix)
+	}
+
+	return strings.TrimSuffix(prefix, "/"), nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upstreamprefix
+
+import (
+	"testing"
+
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func buildIngress() *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:      "foo",
+			Namespace: api.NamespaceDefault,
+		},
+		Spec: networking.IngressSpec{
+			DefaultBackend: &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "default-backend",
+				},
+			},
+		},
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		title    string
+		prefix   *string
+		expected string
+		expErr   bool
+	}{
+		{"no annotation", nil, "", false},
+		{"prefix", strPtr("/api"), "/api", false},
+		{"trailing slash", strPtr("/api/v2/"), "/api/v2", false},
+		{"percent-encoded", strPtr("/my%20api"), "/my%20api", false},
+		{"sub-delims", strPtr("/api;v=1"), "", true},
+		{"root", strPtr("/"), "", true},
+		{"relative", strPtr("api"), "", true},
+		{"empty segment", strPtr("/api//v2"), "", true},
+		{"variable", strPtr("/$host"), "", true},
+		{"query", strPtr("/api?x=1"), "", true},
+		{"invalid percent-encoding", strPtr("/api%2"), "", true},
+		{"empty", strPtr(""), "", false},
+	}
+
+	for _, test := range tests {
+		ing := buildIngress()
+		if test.prefix != nil {
+			ing.SetAnnotations(map[string]string{
+				parser.GetAnnotationWithPrefix("upstream-prefix"): *test.prefix,
+			})
+		}
+
+		i, err := NewParser(&resolver.Mock{}).Parse(ing)
+		if (err != nil) != test.expErr {
+			t.Errorf("%v: expected error %v but got %v", test.title, test.expErr, err)
+			continue
+		}
+
+		if i.(string) != test.expected {
+			t.Errorf("%v: expected %q but got %q", test.title, test.expected, i)
+		}
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
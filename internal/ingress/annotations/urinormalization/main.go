@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package urinormalization
+
+import (
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	// PolicyOff sends the original request URI to the upstream
+	PolicyOff = "off"
+	// PolicyReject rejects requests containing encoded slashes or dots,
+	// double encoding or dot segments in the path
+	PolicyReject = "reject"
+	// PolicyNormalize sends the normalized URI to the upstream
+	PolicyNormalize = "normalize"
+)
+
+// IsValid returns true if the given policy is known
+func IsValid(policy string) bool {
+	return policy == PolicyOff || policy == PolicyReject || policy == PolicyNormalize
+}
+
+type uriNormalization struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new URI normalization annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return uriNormalization{r}
+}
+
+// Parse parses the annotations contained in the ingress rule
+// used to define how the URI of the requests is normalized
+func (a uriNormalization) Parse(ing *networking.Ingress) (interface{}, error) {
+	defPolicy := a.r.GetDefaultBackend().URINormalizationPolicy
+	if !IsValid(defPolicy) {
+		defPolicy = PolicyOff
+	}
+
+	policy, err := parser.GetStringAnnotation("uri-normalization-policy", ing)
+	if err != nil {
+		return defPolicy, nil
+	}
+
+	if !IsValid(policy) {
+		return defPolicy, ing_errors.NewInvalidAnnotationContent("uri-normalization-policy", policy)
+	}
+
+	return policy, nil
+}
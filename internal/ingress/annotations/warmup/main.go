@@ -0,0 +1,112 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package warmup
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	warmUpPathAnnotation    = "warm-up-path"
+	warmUpStatusAnnotation  = "warm-up-status"
+	warmUpTimeoutAnnotation = "warm-up-timeout"
+
+	defaultTimeout = 5 * time.Second
+)
+
+// Config contains the warm-up check new endpoints of a backend must pass
+// before receiving traffic
+type Config struct {
+	// Path is the path requested to the endpoints, empty disables the check
+	Path string `json:"path"`
+	// Status is the HTTP status code of a successful check
+	Status int `json:"status"`
+	// Timeout is the maximum time, in milliseconds, of a check
+	Timeout int `json:"timeout"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type warmup struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new warm-up annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return warmup{r}
+}
+
+// Parse parses the annotations contained in the ingress to define the
+// warm-up check of the endpoints of the backends
+func (a warmup) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	path, err := parser.GetStringAnnotation(warmUpPathAnnotation, ing)
+	if err != nil {
+		return config, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return config, ing_errors.NewInvalidAnnotationContent(warmUpPathAnnotation, path)
+	}
+
+	status, err := parser.GetIntAnnotation(warmUpStatusAnnotation, ing)
+	if err != nil {
+		status = http.StatusOK
+	}
+	if status < 100 || status > 599 {
+		return config, ing_errors.NewInvalidAnnotationContent(warmUpStatusAnnotation, status)
+	}
+
+	timeout := defaultTimeout
+	rawTimeout, err := parser.GetStringAnnotation(warmUpTimeoutAnnotation, ing)
+	if err == nil {
+		timeout, err = time.ParseDuration(rawTimeout)
+		if err != nil {
+			return config, ing_errors.LocationDenied{
+				Reason: errors.Wrap(err, "failed to parse 'warm-up-timeout' value"),
+			}
+		}
+		if timeout <= 0 {
+			return config, ing_errors.NewInvalidAnnotationContent(warmUpTimeoutAnnotation, rawTimeout)
+		}
+	}
+
+	config.Path = path
+	config.Status = status
+	config.Timeout = int(timeout / time.Millisecond)
+
+	return config, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package websocketlimit
+
+import (
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	ing_errors "k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+const (
+	perClientAnnotation  = "limit-websocket-connections-per-client"
+	perBackendAnnotation = "limit-websocket-connections-per-backend"
+)
+
+// Config contains the limits of concurrent upgraded (WebSocket) connections
+// to the locations, counted separately from the regular requests
+type Config struct {
+	// Namespace separates the counters of the Ingress from the other ones
+	Namespace string `json:"namespace"`
+	// PerClient is the maximum number of concurrent WebSockets of a client
+	// address, zero disables the limit
+	PerClient int `json:"perClient"`
+	// PerBackend is the maximum number of concurrent WebSockets to the
+	// backend of the location, zero disables the limit
+	PerBackend int `json:"perBackend"`
+}
+
+// Equal tests for equality between two Config types
+func (c1 *Config) Equal(c2 *Config) bool {
+	if c1 == c2 {
+		return true
+	}
+	if c1 == nil || c2 == nil {
+		return false
+	}
+
+	return *c1 == *c2
+}
+
+type websocketlimit struct {
+	r resolver.Resolver
+}
+
+// NewParser creates a new WebSocket connection limit annotation parser
+func NewParser(r resolver.Resolver) parser.IngressAnnotation {
+	return websocketlimit{r}
+}
+
+func parseLimit(name string, ing *networking.Ingress) (int, error) {
+	limit, err := parser.GetIntAnnotation(name, ing)
+	if ing_errors.IsMissingAnnotations(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 {
+		return 0, ing_errors.NewInvalidAnnotationContent(name, limit)
+	}
+
+	return limit, nil
+}
+
+// Parse parses the annotations contained in the ingress to limit the
+// concurrent WebSocket connections per client and per backend
+func (a websocketlimit) Parse(ing *networking.Ingress) (interface{}, error) {
+	config := Config{}
+
+	perClient, err := parseLimit(perClientAnnotation, ing)
+	if err != nil {
+		return config, err
+	}
+
+	perBackend, err := parseLimit(perBackendAnnotation, ing)
+	if err != nil {
+		return config, err
+	}
+
+	if perClient == 0 && perBackend == 0 {
+		return config, nil
+	}
+
+	config.Namespace = strings.Replace(string(ing.UID), "-", "", -1)
+	config.PerClient = perClient
+	config.PerBackend = perBackend
+
+	return config, nil
+}
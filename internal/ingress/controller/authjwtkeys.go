@@ -0,0 +1,404 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+const (
+	// authJWTKeysSyncPeriod is the interval between the updates of the key
+	// sets of the auth-jwt annotations sent to NGINX
+	authJWTKeysSyncPeriod = 1 * time.Second
+
+	// authJWTKeysRefreshInterval is the interval between two fetches of a
+	// key set
+	authJWTKeysRefreshInterval = 5 * time.Minute
+
+	// authJWTKeysMinRefreshInterval is the minimum time between two fetches
+	// of a key set requested by NGINX, when a token is signed with an unknown
+	// key id because the keys were rotated
+	authJWTKeysMinRefreshInterval = 10 * time.Second
+
+	// authJWTKeysMaxBackoff is the maximum time before fetching again a key
+	// set that could not be fetched, the delay starts at
+	// authJWTKeysMinRefreshInterval and doubles after each failure
+	authJWTKeysMaxBackoff = 5 * time.Minute
+
+	authJWTKeysTimeout = 5 * time.Second
+
+	// authJWTKeysMaxSize is the maximum size of a key set
+	authJWTKeysMaxSize = 1 << 20
+)
+
+// authJWTKeySet is a JSON Web Key Set fetched by the controller
+type authJWTKeySet struct {
+	// keys is the last valid key set, nil until it is fetched
+	keys json.RawMessage
+	etag string
+	// fetched is the time of the last fetch, successful or not
+	fetched  time.Time
+	next     time.Time
+	failures int
+	// pushed is true when NGINX has the last valid key set
+	pushed bool
+}
+
+// authJWTKeysUpdate is the update of the key sets sent to NGINX
+type authJWTKeysUpdate struct {
+	// Keys contains the key sets NGINX does not have yet, by URL, null for
+	// the key sets not used anymore
+	Keys map[string]json.RawMessage `json:"keys"`
+	// URLs contains the URLs of the key sets used by the locations
+	URLs []string `json:"urls"`
+}
+
+// authJWTKeyCache fetches the JSON Web Key Sets of the auth-jwt annotations
+// for all the NGINX workers, which would otherwise fetch them on their own.
+// The last valid key set is kept when a fetch fails.
+type authJWTKeyCache struct {
+	mu      sync.Mutex
+	client  *http.Client
+	sets    map[string]*authJWTKeySet
+	removed []string
+	// sentURLs and sent are the URLs and the time of the last update NGINX
+	// received
+	sentURLs []string
+	sent     time.Time
+}
+
+func newAuthJWTKeyCache() *authJWTKeyCache {
+	return &authJWTKeyCache{
+		client: &http.Client{Timeout: authJWTKeysTimeout},
+		sets:   map[string]*authJWTKeySet{},
+	}
+}
+
+// authJWTKeyURLs returns the sorted URLs of the key sets of the locations
+func authJWTKeyURLs(servers []*ingress.Server) []string {
+	found := map[string]bool{}
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			if location.AuthJWT.JWKSURL != "" {
+				found[location.AuthJWT.JWKSURL] = true
+			}
+		}
+	}
+
+	urls := make([]string, 0, len(found))
+	for url := range found {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	return urls
+}
+
+// setURLs sets the URLs of the key sets used by the locations, the new key
+// sets are fetched by the next refresh
+func (c *authJWTKeyCache) setURLs(urls []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	used := map[string]bool{}
+	for _, url := range urls {
+		used[url] = true
+		if _, ok := c.sets[url]; !ok {
+			c.sets[url] = &authJWTKeySet{}
+		}
+	}
+
+	for url := range c.sets {
+		if !used[url] {
+			delete(c.sets, url)
+			c.removed = append(c.removed, url)
+		}
+	}
+
+	removed := c.removed[:0]
+	for _, url := range c.removed {
+		if !used[url] {
+			removed = append(removed, url)
+		}
+	}
+	c.removed = removed
+}
+
+// requestRefresh sends the key set to NGINX again and fetches it as soon
+// as allowed by authJWTKeysMinRefreshInterval, or by the backoff after a
+// failure
+func (c *authJWTKeyCache) requestRefresh(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set, ok := c.sets[url]
+	if !ok {
+		return
+	}
+
+	set.pushed = false
+	if set.failures > 0 {
+		return
+	}
+
+	if earliest := set.fetched.Add(authJWTKeysMinRefreshInterval); earliest.Before(set.next) {
+		set.next = earliest
+	}
+}
+
+// refresh fetches the key sets whose next fetch is due
+func (c *authJWTKeyCache) refresh(now time.Time) {
+	c.mu.Lock()
+	etags := map[string]string{}
+	for url, set := range c.sets {
+		if !now.Before(set.next) {
+			etags[url] = set.etag
+		}
+	}
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for url, etag := range etags {
+		wg.Add(1)
+		go func(url, etag string) {
+			defer wg.Done()
+
+			keys, etag, err := c.fetch(url, etag)
+			c.update(url, keys, etag, err, now)
+		}(url, etag)
+	}
+	wg.Wait()
+}
+
+// update records the result of a fetch of the key set, keys is nil when the
+// key set was not modified
+func (c *authJWTKeyCache) update(url string, keys json.RawMessage, etag string, err error, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	set, ok := c.sets[url]
+	if !ok {
+		return
+	}
+
+	set.fetched = now
+	if err != nil {
+		set.failures++
+		backoff := authJWTKeysMinRefreshInterval << uint(set.failures-1)
+		if backoff <= 0 || backoff > authJWTKeysMaxBackoff {
+			backoff = authJWTKeysMaxBackoff
+		}
+		set.next = now.Add(backoff)
+
+		klog.ErrorS(err, "Error fetching the JSON Web Key Set", "url", url, "failures", set.failures, "retry", backoff)
+		return
+	}
+
+	set.failures = 0
+	set.next = now.Add(authJWTKeysRefreshInterval)
+	set.etag = etag
+	if keys != nil && !bytes.Equal(keys, set.keys) {
+		klog.V(2).InfoS("JSON Web Key Set updated", "url", url)
+		set.keys = keys
+		set.pushed = false
+	}
+}
+
+// fetch returns the key set of the URL and its ETag, or no key set when it
+// was not modified since the ETag
+func (c *authJWTKeyCache) fetch(url, etag string) (json.RawMessage, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && etag != "" {
+		return nil, etag, nil
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, authJWTKeysMaxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) > authJWTKeysMaxSize {
+		return nil, "", fmt.Errorf("JSON Web Key Set larger than %v bytes", authJWTKeysMaxSize)
+	}
+
+	jwks := struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{}
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return nil, "", fmt.Errorf("invalid JSON Web Key Set: %v", err)
+	}
+	if len(jwks.Keys) == 0 {
+		return nil, "", fmt.Errorf("invalid JSON Web Key Set: no keys")
+	}
+
+	keys, err := json.Marshal(jwks)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return keys, res.Header.Get("ETag"), nil
+}
+
+// pending returns the update with the key sets NGINX does not have yet
+func (c *authJWTKeyCache) pending() authJWTKeysUpdate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	update := authJWTKeysUpdate{
+		Keys: map[string]json.RawMessage{},
+		URLs: make([]string, 0, len(c.sets)),
+	}
+
+	for url, set := range c.sets {
+		update.URLs = append(update.URLs, url)
+		if set.keys != nil && !set.pushed {
+			update.Keys[url] = set.keys
+		}
+	}
+	sort.Strings(update.URLs)
+
+	for _, url := range c.removed {
+		update.Keys[url] = json.RawMessage("null")
+	}
+
+	return update
+}
+
+// due returns true when the update must be sent to NGINX, because it
+// contains key sets or the URLs changed. The same URLs are sent again every
+// authJWTKeysMinRefreshInterval to get the key sets NGINX requests, which are
+// not fetched more often.
+func (c *authJWTKeyCache) due(update authJWTKeysUpdate, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(update.Keys) > 0 || !reflect.DeepEqual(update.URLs, c.sentURLs) {
+		return true
+	}
+
+	return !now.Before(c.sent.Add(authJWTKeysMinRefreshInterval))
+}
+
+// pushed records the key sets of the update NGINX received
+func (c *authJWTKeyCache) pushed(update authJWTKeysUpdate, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sentURLs = update.URLs
+	c.sent = now
+
+	for url, keys := range update.Keys {
+		if set, ok := c.sets[url]; ok && bytes.Equal(set.keys, keys) {
+			set.pushed = true
+		}
+	}
+
+	removed := c.removed[:0]
+	for _, url := range c.removed {
+		if _, ok := update.Keys[url]; !ok {
+			removed = append(removed, url)
+		}
+	}
+	c.removed = removed
+}
+
+// send sends the key sets NGINX does not have yet and fetches again the
+// key sets requested by NGINX, because a token was signed with an unknown
+// key id or because the key set is missing
+func (c *authJWTKeyCache) send(now time.Time) error {
+	update := c.pending()
+	if len(update.URLs) == 0 && len(update.Keys) == 0 {
+		return nil
+	}
+
+	if !c.due(update, now) {
+		return nil
+	}
+
+	statusCode, body, err := nginx.NewPostStatusRequest("/configuration/auth-jwt-keys", "application/json", update)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	c.pushed(update, now)
+
+	requested := []string{}
+	if err := json.Unmarshal(body, &requested); err != nil {
+		return err
+	}
+
+	for _, url := range requested {
+		c.requestRefresh(url)
+	}
+
+	return nil
+}
+
+// syncAuthJWTKeys fetches periodically the key sets of the auth-jwt
+// annotations and sends them to NGINX, until stopCh is closed
+func (n *NGINXController) syncAuthJWTKeys(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(authJWTKeysSyncPeriod):
+		}
+
+		now := time.Now()
+		n.authJWTKeys.setURLs(authJWTKeyURLs(n.getRunningConfig().Servers))
+		n.authJWTKeys.refresh(now)
+
+		if err := n.authJWTKeys.send(now); err != nil {
+			klog.ErrorS(err, "Error sending the JSON Web Key Sets to NGINX")
+		}
+	}
+}
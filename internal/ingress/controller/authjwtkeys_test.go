@@ -0,0 +1,203 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/authjwt"
+)
+
+func TestAuthJWTKeyURLs(t *testing.T) {
+	servers := []*ingress.Server{
+		{Locations: []*ingress.Location{
+			{AuthJWT: authjwt.Config{JWKSURL: "https://b.example.com/jwks"}},
+			{},
+		}},
+		{Locations: []*ingress.Location{
+			{AuthJWT: authjwt.Config{JWKSURL: "https://a.example.com/jwks"}},
+			{AuthJWT: authjwt.Config{JWKSURL: "https://b.example.com/jwks"}},
+		}},
+	}
+
+	urls := authJWTKeyURLs(servers)
+	expected := []string{"https://a.example.com/jwks", "https://b.example.com/jwks"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expected %v but got %v", expected, urls)
+	}
+}
+
+func TestAuthJWTKeyCacheRefresh(t *testing.T) {
+	var requests int32
+	status := int32(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if s := int(atomic.LoadInt32(&status)); s != http.StatusOK {
+			w.WriteHeader(s)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"keys": [{"kty": "RSA", "kid": "k1", "n": "AQAB", "e": "AQAB"}], "extra": true}`))
+	}))
+	defer server.Close()
+
+	c := newAuthJWTKeyCache()
+	c.setURLs([]string{server.URL})
+
+	now := time.Now()
+	c.refresh(now)
+
+	update := c.pending()
+	keys := string(update.Keys[server.URL])
+	if keys != `{"keys":[{"kty":"RSA","kid":"k1","n":"AQAB","e":"AQAB"}]}` {
+		t.Fatalf("unexpected key set %v", keys)
+	}
+	c.pushed(update, now)
+	if update = c.pending(); len(update.Keys) != 0 || !reflect.DeepEqual(update.URLs, []string{server.URL}) {
+		t.Errorf("expected no key set to send but got %v", update)
+	}
+
+	// the key set is not fetched again before the refresh interval
+	c.refresh(now.Add(time.Minute))
+	if r := atomic.LoadInt32(&requests); r != 1 {
+		t.Errorf("expected 1 request but got %v", r)
+	}
+
+	// NGINX requests the key set after the minimum refresh interval
+	c.requestRefresh(server.URL)
+	c.refresh(now.Add(authJWTKeysMinRefreshInterval))
+	if r := atomic.LoadInt32(&requests); r != 2 {
+		t.Errorf("expected 2 requests but got %v", r)
+	}
+	if update = c.pending(); update.Keys[server.URL] == nil {
+		t.Errorf("expected the key set to be sent again")
+	}
+	c.pushed(update, now)
+
+	// the key set was not modified
+	now = now.Add(authJWTKeysMinRefreshInterval + authJWTKeysRefreshInterval)
+	c.refresh(now)
+	if update = c.pending(); len(update.Keys) != 0 {
+		t.Errorf("expected no key set to send but got %v", update.Keys)
+	}
+
+	// the last valid key set is kept when the fetches fail, with a backoff
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	now = now.Add(authJWTKeysRefreshInterval)
+	c.refresh(now)
+	set := c.sets[server.URL]
+	if set.failures != 1 || !set.next.Equal(now.Add(authJWTKeysMinRefreshInterval)) || set.keys == nil {
+		t.Errorf("unexpected key set after a failure %+v", set)
+	}
+
+	c.requestRefresh(server.URL)
+	if !set.next.Equal(now.Add(authJWTKeysMinRefreshInterval)) {
+		t.Errorf("expected the backoff to be kept")
+	}
+
+	now = now.Add(authJWTKeysMinRefreshInterval)
+	c.refresh(now)
+	if set.failures != 2 || !set.next.Equal(now.Add(2*authJWTKeysMinRefreshInterval)) {
+		t.Errorf("unexpected key set after two failures %+v", set)
+	}
+
+	for i := 0; i < 10; i++ {
+		now = set.next
+		c.refresh(now)
+	}
+	if !set.next.Equal(now.Add(authJWTKeysMaxBackoff)) {
+		t.Errorf("expected the maximum backoff but got %v", set.next.Sub(now))
+	}
+}
+
+func TestAuthJWTKeyCacheInvalidKeySets(t *testing.T) {
+	for _, body := range []string{`{"keys": []}`, `[`, `{"keys": {}}`} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+
+		if _, _, err := newAuthJWTKeyCache().fetch(server.URL, ""); err == nil {
+			t.Errorf("expected an error with the key set %v", body)
+		}
+
+		server.Close()
+	}
+}
+
+func TestAuthJWTKeyCacheDue(t *testing.T) {
+	c := newAuthJWTKeyCache()
+	c.setURLs([]string{"https://a.example.com/jwks"})
+	c.sets["https://a.example.com/jwks"].keys = json.RawMessage(`{"keys":[{}]}`)
+
+	now := time.Now()
+	update := c.pending()
+	if !c.due(update, now) {
+		t.Errorf("expected the key set to be sent")
+	}
+	c.pushed(update, now)
+
+	// the same URLs are only sent again to get the requests of NGINX
+	update = c.pending()
+	if c.due(update, now.Add(time.Second)) {
+		t.Errorf("expected the unchanged update not to be sent")
+	}
+	if !c.due(update, now.Add(authJWTKeysMinRefreshInterval)) {
+		t.Errorf("expected the unchanged update to be sent after the minimum refresh interval")
+	}
+
+	c.setURLs([]string{"https://a.example.com/jwks", "https://b.example.com/jwks"})
+	if !c.due(c.pending(), now.Add(time.Second)) {
+		t.Errorf("expected the new URLs to be sent")
+	}
+}
+
+func TestAuthJWTKeyCacheRemovedURLs(t *testing.T) {
+	c := newAuthJWTKeyCache()
+	c.setURLs([]string{"https://a.example.com/jwks", "https://b.example.com/jwks"})
+	c.sets["https://a.example.com/jwks"].keys = json.RawMessage(`{"keys":[{}]}`)
+
+	c.setURLs([]string{"https://b.example.com/jwks"})
+
+	update := c.pending()
+	if string(update.Keys["https://a.example.com/jwks"]) != "null" {
+		t.Errorf("expected the removed key set to be deleted but got %v", update.Keys)
+	}
+
+	c.pushed(update, time.Now())
+	if update = c.pending(); len(update.Keys) != 0 {
+		t.Errorf("expected no key set to send but got %v", update.Keys)
+	}
+
+	// a key set used again is not deleted
+	c.setURLs([]string{"https://a.example.com/jwks"})
+	c.setURLs([]string{"https://b.example.com/jwks"})
+	c.setURLs([]string{"https://a.example.com/jwks", "https://b.example.com/jwks"})
+	if update = c.pending(); len(update.Keys) != 0 {
+		t.Errorf("expected no key set to send but got %v", update.Keys)
+	}
+}
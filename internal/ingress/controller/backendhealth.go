@@ -0,0 +1,169 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"k8s.io/ingress-nginx/internal/logging"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+// backendHealthStatusPath is the path of the Lua endpoint that returns the
+// load of the backends
+const backendHealthStatusPath = "/configuration/backend-health"
+
+// backendLoads is the load of the backends observed by NGINX, the requests
+// and errors are counted in the last window seconds
+type backendLoads struct {
+	Window   float64                 `json:"window"`
+	Backends map[string]*backendLoad `json:"backends"`
+}
+
+type backendLoad struct {
+	InFlight         int     `json:"inFlight"`
+	Requests         float64 `json:"requests"`
+	Errors           float64 `json:"errors"`
+	Endpoints        int     `json:"endpoints"`
+	EjectedEndpoints int     `json:"ejectedEndpoints"`
+}
+
+// BackendHealth describes the health and the pressure of a backend observed
+// by NGINX, to scale it on the load it receives
+type BackendHealth struct {
+	// InFlight is the number of requests sent to the backend waiting for
+	// their response
+	InFlight int `json:"inFlight"`
+	// RequestRate is the number of requests per second in the last minute
+	RequestRate float64 `json:"requestRate"`
+	// ErrorRate is the ratio, between 0 and 1, of the 5xx responses in the
+	// last minute
+	ErrorRate float64 `json:"errorRate"`
+	// Endpoints is the number of endpoints of the backend
+	Endpoints int `json:"endpoints"`
+	// EjectedEndpoints is the number of endpoints removed from the load
+	// balancing by the circuit breaker or the health checks
+	EjectedEndpoints int `json:"ejectedEndpoints"`
+	// Health is the score, between 0 and 1, of the backend, the ratio of
+	// the successful responses weighted by the ratio of the available
+	// endpoints
+	Health float64 `json:"health"`
+	// Pressure is the number of requests in flight per available endpoint
+	Pressure float64 `json:"pressure"`
+}
+
+// BackendsHealthIntrospection describes the health of the backends
+type BackendsHealthIntrospection struct {
+	Backends map[string]*BackendHealth `json:"backends"`
+}
+
+// newBackendHealth returns the scores of the load of a backend counted in
+// the last window seconds
+func newBackendHealth(load *backendLoad, window float64) *BackendHealth {
+	health := &BackendHealth{
+		InFlight:         load.InFlight,
+		Endpoints:        load.Endpoints,
+		EjectedEndpoints: load.EjectedEndpoints,
+	}
+
+	if window > 0 {
+		health.RequestRate = roundScore(load.Requests / window)
+	}
+	if load.Requests > 0 {
+		health.ErrorRate = roundScore(math.Min(load.Errors/load.Requests, 1))
+	}
+
+	available := load.Endpoints - load.EjectedEndpoints
+	if available < 0 {
+		available = 0
+	}
+
+	if load.Endpoints > 0 {
+		health.Health = roundScore((1 - health.ErrorRate) * float64(available) / float64(load.Endpoints))
+	}
+
+	// the requests in flight of a backend without available endpoints are
+	// all waiting on a single one
+	health.Pressure = roundScore(float64(load.InFlight) / math.Max(float64(available), 1))
+
+	return health
+}
+
+func roundScore(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+// getBackendsHealth returns the health of the backends from the load
+// observed by NGINX
+func getBackendsHealth() (map[string]*BackendHealth, error) {
+	status, data, err := nginx.NewGetStatusRequest(backendHealthStatusPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", status)
+	}
+
+	loads := &backendLoads{}
+	if err := json.Unmarshal(data, loads); err != nil {
+		return nil, err
+	}
+
+	backends := make(map[string]*BackendHealth, len(loads.Backends))
+	for name, load := range loads.Backends {
+		backends[name] = newBackendHealth(load, loads.Window)
+	}
+
+	return backends, nil
+}
+
+// BackendHealthHandler returns the handler of the endpoint that returns, as
+// JSON, the health and pressure scores of the backends, computed from the
+// requests in flight, the 5xx responses and the ejected endpoints observed
+// by NGINX, for the autoscalers to scale the backends on their actual load.
+// With the query parameter backend=<name> it returns only the scores of
+// that backend.
+// The requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) BackendHealthHandler(tokenFile string) http.Handler {
+	return introspectionHandler(tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		backends, err := getBackendsHealth()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading the load of the backends: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		var model interface{} = BackendsHealthIntrospection{Backends: backends}
+		if name := r.URL.Query().Get("backend"); name != "" {
+			backend, ok := backends[name]
+			if !ok {
+				http.Error(w, fmt.Sprintf("backend %v not found", name), http.StatusNotFound)
+				return
+			}
+
+			model = backend
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(model); err != nil {
+			logging.Sync.ErrorS(err, "Encoding the health of the backends")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+func TestNewBackendHealth(t *testing.T) {
+	testCases := map[string]struct {
+		load     *backendLoad
+		expected *BackendHealth
+	}{
+		"without requests": {
+			&backendLoad{Endpoints: 2},
+			&BackendHealth{Endpoints: 2, Health: 1},
+		},
+		"with errors and ejected endpoints": {
+			&backendLoad{InFlight: 42, Requests: 7230, Errors: 144.6, Endpoints: 4, EjectedEndpoints: 1},
+			&BackendHealth{InFlight: 42, RequestRate: 120.5, ErrorRate: 0.02, Endpoints: 4, EjectedEndpoints: 1, Health: 0.735, Pressure: 14},
+		},
+		"without available endpoints": {
+			&backendLoad{InFlight: 3, Requests: 60, Endpoints: 2, EjectedEndpoints: 2},
+			&BackendHealth{InFlight: 3, RequestRate: 1, Endpoints: 2, EjectedEndpoints: 2, Health: 0, Pressure: 3},
+		},
+		"without endpoints": {
+			&backendLoad{Requests: 30, Errors: 30},
+			&BackendHealth{RequestRate: 0.5, ErrorRate: 1},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			health := newBackendHealth(tc.load, 60)
+			if !reflect.DeepEqual(health, tc.expected) {
+				t.Errorf("expected %+v but %+v returned", tc.expected, health)
+			}
+		})
+	}
+}
+
+func TestBackendHealthHandler(t *testing.T) {
+	tokenFile, err := ioutil.TempFile("", "introspection-token")
+	if err != nil {
+		t.Fatalf("unexpected error creating the token file: %v", err)
+	}
+	defer os.Remove(tokenFile.Name())
+
+	if _, err := tokenFile.WriteString("s3cr3t"); err != nil {
+		t.Fatalf("unexpected error writing the token file: %v", err)
+	}
+	tokenFile.Close()
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", nginx.StatusPort))
+	if err != nil {
+		t.Fatalf("creating tcp listener: %s", err)
+	}
+	defer listener.Close()
+
+	server := &httptest.Server{
+		Listener: listener,
+		Config: &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != backendHealthStatusPath {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				fmt.Fprint(w, `{"window":60,"backends":{"default-app-80":{"inFlight":4,"requests":120,"errors":0,"endpoints":2,"ejectedEndpoints":0}}}`)
+			}),
+		},
+	}
+	defer server.Close()
+	server.Start()
+
+	handler := (&NGINXController{}).BackendHealthHandler(tokenFile.Name())
+
+	testCases := map[string]struct {
+		path           string
+		authorization  string
+		expectedStatus int
+	}{
+		"without token":     {BackendHealthPath, "", http.StatusUnauthorized},
+		"all the backends":  {BackendHealthPath, "Bearer s3cr3t", http.StatusOK},
+		"a backend":         {BackendHealthPath + "?backend=default-app-80", "Bearer s3cr3t", http.StatusOK},
+		"a missing backend": {BackendHealthPath + "?backend=default-other-80", "Bearer s3cr3t", http.StatusNotFound},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("expected status %v but %v returned", tc.expectedStatus, w.Code)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, BackendHealthPath+"?backend=default-app-80", nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	health := &BackendHealth{}
+	if err := json.Unmarshal(w.Body.Bytes(), health); err != nil {
+		t.Fatalf("unexpected error decoding the response: %v", err)
+	}
+
+	expected := &BackendHealth{InFlight: 4, RequestRate: 2, Endpoints: 2, Health: 1, Pressure: 2}
+	if !reflect.DeepEqual(health, expected) {
+		t.Errorf("expected %+v but %+v returned", expected, health)
+	}
+}
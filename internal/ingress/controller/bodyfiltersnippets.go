@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/bodyfiltersnippet"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+// getBodyFilterSnippets returns, by checksum, the code of the
+// body-filter-snippet annotations of the Ingresses
+func getBodyFilterSnippets(ingresses []*ingress.Ingress) map[string]string {
+	var snippets map[string]string
+
+	for _, ing := range ingresses {
+		if ing.ParsedAnnotations == nil || ing.ParsedAnnotations.BodyFilterSnippet == "" {
+			continue
+		}
+
+		if snippets == nil {
+			snippets = map[string]string{}
+		}
+
+		code := ing.ParsedAnnotations.BodyFilterSnippet
+		snippets[bodyfiltersnippet.Checksum(code)] = code
+	}
+
+	return snippets
+}
+
+// configureBodyFilterSnippets JSON encodes the code of the body filter
+// snippets and POSTs it to an internal HTTP endpoint that is handled by Lua.
+// The code can be larger than the parameters of the NGINX directives, the
+// locations only reference it by checksum.
+func configureBodyFilterSnippets(snippets map[string]string) error {
+	if snippets == nil {
+		snippets = map[string]string{}
+	}
+
+	statusCode, _, err := nginx.NewPostStatusRequest("/configuration/body-filter-snippets", "application/json", snippets)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	return nil
+}
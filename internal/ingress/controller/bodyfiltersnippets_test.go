@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/bodyfiltersnippet"
+)
+
+func TestGetBodyFilterSnippets(t *testing.T) {
+	// larger than the parameters of the NGINX directives
+	code := `body = "` + strings.Repeat("a", 8192) + `"`
+
+	ingresses := []*ingress.Ingress{
+		{
+			Ingress:           networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api"}},
+			ParsedAnnotations: &annotations.Ingress{BodyFilterSnippet: code},
+		},
+		{
+			Ingress:           networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "api"}},
+			ParsedAnnotations: &annotations.Ingress{BodyFilterSnippet: code},
+		},
+		{
+			Ingress:           networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shop"}},
+			ParsedAnnotations: &annotations.Ingress{},
+		},
+	}
+
+	expected := map[string]string{bodyfiltersnippet.Checksum(code): code}
+	if snippets := getBodyFilterSnippets(ingresses); !reflect.DeepEqual(snippets, expected) {
+		t.Errorf("expected %v but got %v", expected, snippets)
+	}
+
+	if snippets := getBodyFilterSnippets(ingresses[2:]); snippets != nil {
+		t.Errorf("expected no snippets but got %v", snippets)
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+const (
+	// botDetectionRulesKey is the key of the ConfigMap with the bot detection rules
+	botDetectionRulesKey = "rules"
+	// botDetectionSecretKey is the key of the Secret with the key signing the
+	// cookies of the challenge action
+	botDetectionSecretKey = "secret"
+	// minBotDetectionSecretLength is the minimum length of the signing key
+	minBotDetectionSecretLength = 32
+
+	botDetectionBlock     = "block"
+	botDetectionTag       = "tag"
+	botDetectionRateLimit = "rate-limit"
+	botDetectionChallenge = "challenge"
+)
+
+var botDetectionRuleNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// botDetectionSecret is used to sign the cookies of the challenge action
+// when the bot-detection-secret setting is not defined. The cookies are
+// invalidated when the controller restarts
+var botDetectionSecret = newBotDetectionSecret()
+
+type botDetectionRuleset struct {
+	Rules []ingress.BotDetectionRule `json:"rules"`
+}
+
+type botDetectionConfiguration struct {
+	Rules  []ingress.BotDetectionRule `json:"rules"`
+	Secret string                     `json:"secret"`
+}
+
+func newBotDetectionSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		klog.Fatalf("unexpected error generating the bot detection secret: %v", err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// getBotDetectionRules returns the valid rules of the ConfigMap configured in
+// the bot-detection-configmap setting
+func (n *NGINXController) getBotDetectionRules() []ingress.BotDetectionRule {
+	key := n.store.GetBackendConfiguration().BotDetectionConfigMap
+	if key == "" {
+		return nil
+	}
+
+	cm, err := n.store.GetConfigMap(key)
+	if err != nil {
+		klog.Warningf("Error getting bot detection ConfigMap %q: %v", key, err)
+		return nil
+	}
+
+	data, ok := cm.Data[botDetectionRulesKey]
+	if !ok {
+		klog.Warningf("Bot detection ConfigMap %q does not contain the key %q", key, botDetectionRulesKey)
+		return nil
+	}
+
+	rules, err := parseBotDetectionRules(data)
+	if err != nil {
+		klog.Warningf("Error reading bot detection rules of ConfigMap %q: %v", key, err)
+		return nil
+	}
+
+	return rules
+}
+
+// getBotDetectionSecret returns the key of the Secret configured in the
+// bot-detection-secret setting, or the key generated by the controller
+func (n *NGINXController) getBotDetectionSecret() string {
+	key := n.store.GetBackendConfiguration().BotDetectionSecret
+	if key == "" {
+		return botDetectionSecret
+	}
+
+	secret, err := n.store.GetSecret(key)
+	if err != nil {
+		klog.Warningf("Error getting bot detection Secret %q, using a generated key: %v", key, err)
+		return botDetectionSecret
+	}
+
+	data, ok := secret.Data[botDetectionSecretKey]
+	if !ok || len(data) < minBotDetectionSecretLength {
+		klog.Warningf("Bot detection Secret %q does not contain a key %q of at least %v bytes, using a generated key",
+			key, botDetectionSecretKey, minBotDetectionSecretLength)
+		return botDetectionSecret
+	}
+
+	return string(data)
+}
+
+// parseBotDetectionRules parses the YAML or JSON rules, invalid rules are ignored
+func parseBotDetectionRules(data string) ([]ingress.BotDetectionRule, error) {
+	ruleset := botDetectionRuleset{}
+	if err := yaml.Unmarshal([]byte(data), &ruleset); err != nil {
+		return nil, err
+	}
+
+	rules := []ingress.BotDetectionRule{}
+	for _, rule := range ruleset.Rules {
+		rule, err := normalizeBotDetectionRule(rule)
+		if err != nil {
+			klog.Warningf("Ignoring bot detection rule %q: %v", rule.Name, err)
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func normalizeBotDetectionRule(rule ingress.BotDetectionRule) (ingress.BotDetectionRule, error) {
+	if !botDetectionRuleNameRegex.MatchString(rule.Name) {
+		return rule, fmt.Errorf("invalid name")
+	}
+
+	if rule.UserAgent == "" && len(rule.Headers) == 0 && len(rule.MissingHeaders) == 0 {
+		return rule, fmt.Errorf("the rule has no conditions")
+	}
+
+	if rule.UserAgent != "" {
+		if _, err := regexp.Compile(rule.UserAgent); err != nil {
+			return rule, errors.Wrap(err, "invalid userAgent")
+		}
+	}
+
+	headers := map[string]string{}
+	for header, expr := range rule.Headers {
+		if _, err := regexp.Compile(expr); err != nil {
+			return rule, errors.Wrapf(err, "invalid expression of header %v", header)
+		}
+		headers[strings.ToLower(header)] = expr
+	}
+	if len(headers) > 0 {
+		rule.Headers = headers
+	}
+
+	for i, header := range rule.MissingHeaders {
+		rule.MissingHeaders[i] = strings.ToLower(header)
+	}
+
+	switch rule.Action {
+	case botDetectionBlock, botDetectionTag, botDetectionChallenge:
+	case botDetectionRateLimit:
+		if rule.Limit <= 0 || rule.Window <= 0 {
+			return rule, fmt.Errorf("the rate-limit action requires a limit and a window greater than zero")
+		}
+	default:
+		return rule, fmt.Errorf("invalid action %q", rule.Action)
+	}
+
+	return rule, nil
+}
+
+// configureBotDetection JSON encodes the bot detection rules and POSTs them
+// to an internal HTTP endpoint that is handled by Lua
+func configureBotDetection(rules []ingress.BotDetectionRule, secret string) error {
+	if rules == nil {
+		rules = []ingress.BotDetectionRule{}
+	}
+
+	configuration := &botDetectionConfiguration{
+		Rules:  rules,
+		Secret: secret,
+	}
+
+	statusCode, _, err := nginx.NewPostStatusRequest("/configuration/bot-detection", "application/json", configuration)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	return nil
+}
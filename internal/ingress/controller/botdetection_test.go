@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+)
+
+type fakeBotDetectionStore struct {
+	fakeIngressStore
+	secretKey string
+	secrets   map[string]*corev1.Secret
+}
+
+func (fs fakeBotDetectionStore) GetBackendConfiguration() ngx_config.Configuration {
+	return ngx_config.Configuration{BotDetectionSecret: fs.secretKey}
+}
+
+func (fs fakeBotDetectionStore) GetSecret(key string) (*corev1.Secret, error) {
+	secret, ok := fs.secrets[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %v was not found", key)
+	}
+	return secret, nil
+}
+
+func TestGetBotDetectionSecret(t *testing.T) {
+	key := strings.Repeat("k", minBotDetectionSecretLength)
+	secrets := map[string]*corev1.Secret{
+		"ingress-nginx/bot-detection": {Data: map[string][]byte{"secret": []byte(key)}},
+		"ingress-nginx/short":         {Data: map[string][]byte{"secret": []byte("short")}},
+		"ingress-nginx/other-key":     {Data: map[string][]byte{"key": []byte(key)}},
+	}
+
+	testCases := []struct {
+		secretKey string
+		expected  string
+	}{
+		{"", botDetectionSecret},
+		{"ingress-nginx/bot-detection", key},
+		{"ingress-nginx/short", botDetectionSecret},
+		{"ingress-nginx/other-key", botDetectionSecret},
+		{"ingress-nginx/missing", botDetectionSecret},
+	}
+
+	for _, tc := range testCases {
+		n := &NGINXController{store: fakeBotDetectionStore{secretKey: tc.secretKey, secrets: secrets}}
+		if secret := n.getBotDetectionSecret(); secret != tc.expected {
+			t.Errorf("expected %q for the Secret %q but got %q", tc.expected, tc.secretKey, secret)
+		}
+	}
+}
+
+func TestParseBotDetectionRules(t *testing.T) {
+	data := `
+rules:
+- name: bad-crawler
+  userAgent: (?i)badcrawler
+  action: block
+- name: no-accept
+  headers:
+    User-Agent: Mozilla
+  missingHeaders:
+  - Accept
+  action: tag
+- name: scraper
+  userAgent: python-requests
+  action: rate-limit
+  limit: 10
+  window: 60
+- name: invalid-regex
+  userAgent: "("
+  action: block
+- name: no-conditions
+  action: block
+- name: invalid-action
+  userAgent: curl
+  action: drop
+- name: rate-limit-without-window
+  userAgent: curl
+  action: rate-limit
+  limit: 10
+- userAgent: wget
+  action: block
+`
+
+	expected := []ingress.BotDetectionRule{
+		{Name: "bad-crawler", UserAgent: "(?i)badcrawler", Action: "block"},
+		{Name: "no-accept", Headers: map[string]string{"user-agent": "Mozilla"}, MissingHeaders: []string{"accept"}, Action: "tag"},
+		{Name: "scraper", UserAgent: "python-requests", Action: "rate-limit", Limit: 10, Window: 60},
+	}
+
+	rules, err := parseBotDetectionRules(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("expected %v but got %v", expected, rules)
+	}
+
+	if _, err := parseBotDetectionRules("rules: {"); err == nil {
+		t.Errorf("expected an error parsing invalid rules")
+	}
+}
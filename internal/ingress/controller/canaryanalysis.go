@@ -0,0 +1,323 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/hashstructure"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/canary"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/task"
+)
+
+// canaryAnalysisPeriod is the period of the checks of the canary analyses,
+// each of them is evaluated once its own interval elapsed
+const canaryAnalysisPeriod = 10 * time.Second
+
+// canaryAnalyzer contains the state of the analyses of the canary ingresses.
+// The rollbacks are stored in the rollback ConfigMap, keeping the canaries
+// rolled back after a restart of the controller.
+type canaryAnalyzer struct {
+	client    clientset.Interface
+	namespace string
+	name      string
+
+	mu sync.Mutex
+	// analyses contains the current interval of the analysis of each canary
+	// ingress with the canary-analysis annotations
+	analyses map[string]*canaryAnalysis
+	// rollbacks contains the canary ingresses with a weight set to zero by
+	// their analysis
+	rollbacks map[string]canaryRollback
+}
+
+// canaryAnalysis contains the totals of the requests of a canary ingress at
+// the start of the current interval
+type canaryAnalysis struct {
+	start time.Time
+	stats collectors.CanaryStats
+}
+
+// canaryRollback contains the reason of the rollback of a canary ingress.
+// The rollback is kept until the ingress is updated.
+type canaryRollback struct {
+	Generation int64 `json:"generation"`
+	// Annotations is the checksum of the annotations of the ingress
+	Annotations string `json:"annotations"`
+	Reason      string `json:"reason"`
+}
+
+// annotationsChecksum returns the checksum of the annotations of an ingress
+func annotationsChecksum(ing *ingress.Ingress) string {
+	hash, _ := hashstructure.Hash(ing.Annotations, nil)
+	return fmt.Sprintf("%v", hash)
+}
+
+// matches returns true when the ingress was not updated since the rollback
+func (r canaryRollback) matches(ing *ingress.Ingress) bool {
+	return r.Generation == ing.Generation && r.Annotations == annotationsChecksum(ing)
+}
+
+// rollbackConfigMapKey returns the key of the rollback of a canary ingress
+// in the rollback ConfigMap, the namespaces do not contain dots
+func rollbackConfigMapKey(key string) string {
+	return strings.Replace(key, "/", ".", 1)
+}
+
+func newCanaryAnalyzer(client clientset.Interface, electionID string) *canaryAnalyzer {
+	a := &canaryAnalyzer{}
+	if client == nil || k8s.IngressPodDetails == nil {
+		return a
+	}
+
+	a.client = client
+	a.namespace = k8s.IngressPodDetails.Namespace
+	a.name = fmt.Sprintf("%v-canary-rollbacks", electionID)
+
+	cm, err := client.CoreV1().ConfigMaps(a.namespace).Get(context.TODO(), a.name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			klog.Warningf("Error reading the canary rollback ConfigMap %v/%v: %v", a.namespace, a.name, err)
+		}
+		return a
+	}
+
+	a.rollbacks = loadCanaryRollbacks(cm.Data)
+	return a
+}
+
+// loadCanaryRollbacks returns the rollbacks stored in the data of the
+// rollback ConfigMap by ingress
+func loadCanaryRollbacks(data map[string]string) map[string]canaryRollback {
+	rollbacks := map[string]canaryRollback{}
+	for cmKey, raw := range data {
+		var rollback canaryRollback
+		if err := json.Unmarshal([]byte(raw), &rollback); err != nil {
+			klog.Warningf("Error reading the canary rollback %v: %v", cmKey, err)
+			continue
+		}
+
+		rollbacks[strings.Replace(cmKey, ".", "/", 1)] = rollback
+	}
+
+	return rollbacks
+}
+
+// storeRollbacks replaces the rollbacks of the rollback ConfigMap
+func (a *canaryAnalyzer) storeRollbacks(rollbacks map[string]canaryRollback) {
+	if a.client == nil {
+		return
+	}
+
+	data := map[string]string{}
+	for key, rollback := range rollbacks {
+		raw, err := json.Marshal(rollback)
+		if err != nil {
+			klog.Warningf("Error encoding the canary rollback of %v: %v", key, err)
+			continue
+		}
+		data[rollbackConfigMapKey(key)] = string(raw)
+	}
+
+	err := updateConfigMap(a.client, a.namespace, a.name, func(current map[string]string) {
+		for cmKey := range current {
+			if _, ok := data[cmKey]; !ok {
+				delete(current, cmKey)
+			}
+		}
+		for cmKey, raw := range data {
+			current[cmKey] = raw
+		}
+	})
+	if err != nil {
+		klog.Warningf("Error storing the canary rollbacks in the ConfigMap %v/%v: %v", a.namespace, a.name, err)
+	}
+}
+
+// ingressBackends returns the names of the backends of an ingress
+func ingressBackends(ing *ingress.Ingress) []string {
+	var backends []string
+	if ing.Spec.DefaultBackend != nil {
+		backends = append(backends, upstreamName(ing.Namespace, ing.Spec.DefaultBackend))
+	}
+
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+
+		for _, path := range rule.HTTP.Paths {
+			backends = append(backends, upstreamName(ing.Namespace, &path.Backend))
+		}
+	}
+
+	return backends
+}
+
+// canaryIngressStats returns the totals of the requests of the backends of
+// a canary ingress
+func canaryIngressStats(ing *ingress.Ingress, stats map[string]collectors.CanaryStats) collectors.CanaryStats {
+	var total collectors.CanaryStats
+
+	seen := map[string]bool{}
+	for _, backend := range ingressBackends(ing) {
+		if seen[backend] {
+			continue
+		}
+		seen[backend] = true
+
+		s := stats[backend]
+		total.Requests += s.Requests
+		total.Errors += s.Errors
+		total.ResponseTimeCount += s.ResponseTimeCount
+		total.ResponseTimeSum += s.ResponseTimeSum
+	}
+
+	return total
+}
+
+// evaluateCanary returns the reason of the rollback of a canary when the
+// requests of the interval between previous and current breach one of the
+// thresholds of the analysis, an empty string otherwise
+func evaluateCanary(analysis *canary.Analysis, previous, current collectors.CanaryStats) string {
+	// the totals are reset when the collector is restarted
+	if current.Requests < previous.Requests {
+		previous = collectors.CanaryStats{}
+	}
+
+	requests := current.Requests - previous.Requests
+	if requests == 0 || requests < uint64(analysis.MinRequests) {
+		return ""
+	}
+
+	if analysis.MaxErrorRate > 0 {
+		errorRate := float64(current.Errors-previous.Errors) * 100 / float64(requests)
+		if errorRate > float64(analysis.MaxErrorRate) {
+			return fmt.Sprintf("error rate of %.1f%% over %d requests exceeds %d%%", errorRate, requests, analysis.MaxErrorRate)
+		}
+	}
+
+	responses := current.ResponseTimeCount - previous.ResponseTimeCount
+	if analysis.MaxLatency > 0 && responses > 0 {
+		latency := (current.ResponseTimeSum - previous.ResponseTimeSum) * 1000 / float64(responses)
+		if latency > float64(analysis.MaxLatency) {
+			return fmt.Sprintf("average latency of %.0fms over %d requests exceeds %dms", latency, responses, analysis.MaxLatency)
+		}
+	}
+
+	return ""
+}
+
+// analyzeCanaries checks the requests of the canary ingresses with the
+// canary-analysis annotations and sets the weight of the canaries breaching
+// their thresholds to zero
+func (n *NGINXController) analyzeCanaries() {
+	stats := n.metricCollector.CanaryStats()
+	now := time.Now()
+
+	a := n.canaryAnalyzer
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	analyses := map[string]*canaryAnalysis{}
+	rollbacks := map[string]canaryRollback{}
+	changed := false
+
+	for _, ing := range n.store.ListIngresses() {
+		anns := ing.ParsedAnnotations
+		if anns == nil || !anns.Canary.Enabled || anns.Canary.Analysis == nil {
+			continue
+		}
+
+		key := k8s.MetaNamespaceKey(ing)
+		if rollback, ok := a.rollbacks[key]; ok && rollback.matches(ing) {
+			rollbacks[key] = rollback
+			continue
+		}
+
+		current := canaryIngressStats(ing, stats)
+
+		analysis, ok := a.analyses[key]
+		if ok && now.Sub(analysis.start) < time.Duration(anns.Canary.Analysis.Interval)*time.Second {
+			analyses[key] = analysis
+			continue
+		}
+
+		analyses[key] = &canaryAnalysis{start: now, stats: current}
+		if !ok {
+			continue
+		}
+
+		reason := evaluateCanary(anns.Canary.Analysis, analysis.stats, current)
+		if reason == "" {
+			continue
+		}
+
+		klog.Warningf("Rolling back canary ingress %q: %v", key, reason)
+		n.recordIngressEvent(ing, apiv1.EventTypeWarning, "CanaryRollback", fmt.Sprintf("Canary weight set to 0: %v", reason))
+
+		rollbacks[key] = canaryRollback{
+			Generation:  ing.Generation,
+			Annotations: annotationsChecksum(ing),
+			Reason:      reason,
+		}
+		changed = true
+	}
+
+	// the rollbacks of the updated or deleted ingresses are discarded
+	if len(rollbacks) != len(a.rollbacks) {
+		changed = true
+	}
+
+	a.analyses = analyses
+	a.rollbacks = rollbacks
+
+	if changed {
+		a.storeRollbacks(rollbacks)
+		n.syncQueue.EnqueueTask(task.GetDummyObject("canary-rollback"))
+	}
+}
+
+// weight returns the weight of a canary ingress, zero after its rollback
+func (a *canaryAnalyzer) weight(ing *ingress.Ingress, weight int) int {
+	if a == nil {
+		return weight
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if rollback, ok := a.rollbacks[k8s.MetaNamespaceKey(ing)]; ok && rollback.matches(ing) {
+		return 0
+	}
+
+	return weight
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/canary"
+	"k8s.io/ingress-nginx/internal/ingress/metric"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/task"
+)
+
+type fakeCanaryCollector struct {
+	metric.DummyCollector
+	stats map[string]collectors.CanaryStats
+}
+
+func (f *fakeCanaryCollector) CanaryStats() map[string]collectors.CanaryStats {
+	return f.stats
+}
+
+func TestEvaluateCanary(t *testing.T) {
+	analysis := &canary.Analysis{MaxErrorRate: 5, MaxLatency: 200, Interval: 60, MinRequests: 10}
+
+	testCases := []struct {
+		title    string
+		previous collectors.CanaryStats
+		current  collectors.CanaryStats
+		rollback bool
+	}{
+		{"healthy", collectors.CanaryStats{Requests: 100, Errors: 10},
+			collectors.CanaryStats{Requests: 200, Errors: 12, ResponseTimeCount: 100, ResponseTimeSum: 10}, false},
+		{"error rate", collectors.CanaryStats{Requests: 100, Errors: 10},
+			collectors.CanaryStats{Requests: 200, Errors: 20}, true},
+		{"latency", collectors.CanaryStats{},
+			collectors.CanaryStats{Requests: 100, ResponseTimeCount: 100, ResponseTimeSum: 30}, true},
+		{"not enough requests", collectors.CanaryStats{},
+			collectors.CanaryStats{Requests: 5, Errors: 5}, false},
+		{"reset totals", collectors.CanaryStats{Requests: 1000},
+			collectors.CanaryStats{Requests: 20, Errors: 20}, true},
+	}
+
+	for _, tc := range testCases {
+		reason := evaluateCanary(analysis, tc.previous, tc.current)
+		if (reason != "") != tc.rollback {
+			t.Errorf("%v: expected rollback %v but returned %q", tc.title, tc.rollback, reason)
+		}
+	}
+}
+
+func TestAnalyzeCanaries(t *testing.T) {
+	ing := &ingress.Ingress{
+		Ingress: networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web-canary",
+				Namespace:   "default",
+				Generation:  1,
+				Annotations: map[string]string{"nginx.ingress.kubernetes.io/canary": "true"},
+			},
+			Spec: networking.IngressSpec{
+				Rules: []networking.IngressRule{
+					{
+						IngressRuleValue: networking.IngressRuleValue{
+							HTTP: &networking.HTTPIngressRuleValue{
+								Paths: []networking.HTTPIngressPath{
+									{
+										Path: "/",
+										Backend: networking.IngressBackend{
+											Service: &networking.IngressServiceBackend{
+												Name: "web-canary",
+												Port: networking.ServiceBackendPort{
+													Number: 80,
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		ParsedAnnotations: &annotations.Ingress{
+			Canary: canary.Config{
+				Enabled: true,
+				Weight:  20,
+				Analysis: &canary.Analysis{
+					MaxErrorRate: 5,
+					Interval:     60,
+					MinRequests:  10,
+				},
+			},
+		},
+	}
+
+	mc := &fakeCanaryCollector{stats: map[string]collectors.CanaryStats{
+		"default-web-canary-80": {Requests: 100},
+	}}
+	n := &NGINXController{
+		store:           fakeIngressStore{ingresses: []*ingress.Ingress{ing}},
+		metricCollector: mc,
+		canaryAnalyzer:  &canaryAnalyzer{},
+		syncQueue:       task.NewTaskQueue(func(interface{}) error { return nil }),
+	}
+
+	// the first check starts the interval
+	n.analyzeCanaries()
+	if weight := n.canaryAnalyzer.weight(ing, 20); weight != 20 {
+		t.Fatalf("expected weight 20 but returned %v", weight)
+	}
+
+	// the interval has not elapsed yet
+	mc.stats["default-web-canary-80"] = collectors.CanaryStats{Requests: 200, Errors: 50}
+	n.analyzeCanaries()
+	if weight := n.canaryAnalyzer.weight(ing, 20); weight != 20 {
+		t.Fatalf("expected weight 20 before the end of the interval but returned %v", weight)
+	}
+
+	n.canaryAnalyzer.analyses["default/web-canary"].start = time.Now().Add(-time.Minute)
+	n.analyzeCanaries()
+	if weight := n.canaryAnalyzer.weight(ing, 20); weight != 0 {
+		t.Fatalf("expected weight 0 after the rollback but returned %v", weight)
+	}
+
+	// the rollback is kept until the ingress is updated
+	n.analyzeCanaries()
+	if weight := n.canaryAnalyzer.weight(ing, 20); weight != 0 {
+		t.Fatalf("expected weight 0 after the rollback but returned %v", weight)
+	}
+
+	ing.Generation = 2
+	if weight := n.canaryAnalyzer.weight(ing, 20); weight != 20 {
+		t.Errorf("expected weight 20 after an update but returned %v", weight)
+	}
+
+	n.analyzeCanaries()
+	if len(n.canaryAnalyzer.rollbacks) != 0 {
+		t.Errorf("expected the rollback to be discarded but got %v", n.canaryAnalyzer.rollbacks)
+	}
+}
+
+func TestCanaryRollbackPersistence(t *testing.T) {
+	k8s.IngressPodDetails = &k8s.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingress-1", Namespace: "ingress"},
+	}
+	defer func() {
+		k8s.IngressPodDetails = nil
+	}()
+
+	ing := &ingress.Ingress{
+		Ingress: networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web-canary",
+				Namespace:   "default",
+				Generation:  1,
+				Annotations: map[string]string{"nginx.ingress.kubernetes.io/canary": "true"},
+			},
+		},
+	}
+
+	client := fake.NewSimpleClientset()
+	a := newCanaryAnalyzer(client, "leader-nginx")
+	a.storeRollbacks(map[string]canaryRollback{
+		"default/web-canary": {Generation: 1, Annotations: annotationsChecksum(ing), Reason: "error rate"},
+	})
+
+	// a restarted controller keeps the rollback
+	restarted := newCanaryAnalyzer(client, "leader-nginx")
+	if weight := restarted.weight(ing, 20); weight != 0 {
+		t.Errorf("expected weight 0 after a restart but returned %v", weight)
+	}
+
+	ing.Annotations["nginx.ingress.kubernetes.io/canary-weight"] = "30"
+	if weight := restarted.weight(ing, 30); weight != 30 {
+		t.Errorf("expected weight 30 after an update but returned %v", weight)
+	}
+
+	a.storeRollbacks(map[string]canaryRollback{})
+	cm, err := client.CoreV1().ConfigMaps("ingress").Get(context.TODO(), "leader-nginx-canary-rollbacks", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cm.Data) != 0 {
+		t.Errorf("expected the discarded rollbacks to be removed but got %v", cm.Data)
+	}
+}
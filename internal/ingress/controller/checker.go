@@ -40,6 +40,11 @@ func (n *NGINXController) Check(_ *http.Request) error {
 		return fmt.Errorf("the ingress controller is shutting down")
 	}
 
+	// NGINX is not started in shadow mode
+	if n.cfg.ShadowMode {
+		return nil
+	}
+
 	// check the nginx master process is running
 	fs, err := proc.NewFS("/proc", false)
 	if err != nil {
@@ -25,6 +25,8 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/accesslogfields"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticfiles"
 	"k8s.io/ingress-nginx/internal/ingress/defaults"
 	"k8s.io/ingress-nginx/internal/runtime"
 )
@@ -34,6 +36,11 @@ var (
 	EnableSSLChainCompletion = false
 )
 
+var defBodyFilterSandboxAllowlist = []string{
+	"assert", "error", "ipairs", "next", "pairs", "select", "tonumber",
+	"tostring", "type", "unpack", "string", "table", "math", "cjson",
+}
+
 const (
 	// http://nginx.org/en/docs/http/ngx_http_core_module.html#client_max_body_size
 	// Sets the maximum allowed size of the client request body
@@ -89,6 +96,93 @@ const (
 	defaultLimitConnZoneVariable = "$binary_remote_addr"
 )
 
+const (
+	// ServerSnippetMergeFirst only uses the server-snippet of the oldest ingress of a host
+	ServerSnippetMergeFirst = "first"
+	// ServerSnippetMergeByCreation concatenates the server-snippets ordered by creation time
+	ServerSnippetMergeByCreation = "creation-timestamp"
+	// ServerSnippetMergeByName concatenates the server-snippets ordered by namespace and name
+	ServerSnippetMergeByName = "name"
+)
+
+const (
+	// UpstreamAliasModeUpstream uses the generated upstream name as alias
+	UpstreamAliasModeUpstream = "upstream"
+	// UpstreamAliasModeService uses <namespace>/<service>:<port number> as alias
+	UpstreamAliasModeService = "service"
+)
+
+const (
+	// GlobalRateLimitFailPolicyAllow lets the requests through when the
+	// global rate limit store is not available
+	GlobalRateLimitFailPolicyAllow = "allow"
+	// GlobalRateLimitFailPolicyDeny rejects the requests when the global
+	// rate limit store is not available
+	GlobalRateLimitFailPolicyDeny = "deny"
+)
+
+const (
+	// GlobalRateLimitStoreMemcached keeps the counters of the global rate
+	// limits in memcached
+	GlobalRateLimitStoreMemcached = "memcached"
+	// GlobalRateLimitStoreRedis keeps the counters of the global rate
+	// limits in Redis
+	GlobalRateLimitStoreRedis = "redis"
+)
+
+const (
+	// GlobalRateLimitModeStore counts the requests of the global rate limits
+	// in the store of global-rate-limit-store
+	GlobalRateLimitModeStore = "store"
+	// GlobalRateLimitModeLocalSync counts the requests of the global rate
+	// limits in each controller pod and replicates the counters to the
+	// other pods, without an external store
+	GlobalRateLimitModeLocalSync = "local-sync"
+)
+
+const (
+	// NoSNIActionDefaultCertificate serves the default certificate to the
+	// TLS clients without SNI
+	NoSNIActionDefaultCertificate = "default-certificate"
+	// NoSNIActionReject refuses the TLS handshakes without SNI
+	NoSNIActionReject = "reject"
+	// NoSNIActionServer serves the certificate of the server of no-sni-server
+	// to the TLS clients without SNI
+	NoSNIActionServer = "server"
+)
+
+const (
+	// OtelSamplerAlwaysOn samples all the traces
+	OtelSamplerAlwaysOn = "AlwaysOn"
+	// OtelSamplerAlwaysOff does not sample the traces
+	OtelSamplerAlwaysOff = "AlwaysOff"
+	// OtelSamplerTraceIDRatioBased samples the ratio of the traces
+	// configured in otel-sampler-ratio
+	OtelSamplerTraceIDRatioBased = "TraceIdRatioBased"
+)
+
+const (
+	// EdgeContextFormatJSON encodes the edge context as a JSON object
+	EdgeContextFormatJSON = "json"
+	// EdgeContextFormatStructuredField encodes the edge context as a
+	// structured field dictionary (RFC 8941)
+	EdgeContextFormatStructuredField = "structured-field"
+)
+
+const (
+	defErrorResponseHTMLTemplate = "<html>\n<head><title>{status} {reason}</title></head>\n<body>\n<center><h1>{status} {reason}</h1></center>\n</body>\n</html>\n"
+	defErrorResponseJSONTemplate = `{"status":{status},"error":"{reason}","request_id":"{request_id}"}`
+)
+
+const (
+	// ListenAddressFamilyDualStack listens on IPv4 and, when available, IPv6 addresses
+	ListenAddressFamilyDualStack = "dual-stack"
+	// ListenAddressFamilyIPv4 only listens on IPv4 addresses
+	ListenAddressFamilyIPv4 = "ipv4"
+	// ListenAddressFamilyIPv6 only listens on IPv6 addresses when IPv6 is available
+	ListenAddressFamilyIPv6 = "ipv6"
+)
+
 // Configuration represents the content of nginx.conf file
 type Configuration struct {
 	defaults.Backend `json:",squash"`
@@ -262,10 +356,24 @@ type Configuration struct {
 	// http://nginx.org/en/docs/http/ngx_http_log_module.html#log_format
 	LogFormatUpstream string `json:"log-format-upstream,omitempty"`
 
+	// LogFormatJSON contains the fields of the JSON access logs, replacing
+	// LogFormatUpstream when it is not empty
+	LogFormatJSON []accesslogfields.Field `json:"log-format-json,omitempty"`
+
+	// LogFormatJSONEscape is the escaping of the JSON access logs: json,
+	// default or none
+	// http://nginx.org/en/docs/http/ngx_http_log_module.html#log_format
+	LogFormatJSONEscape string `json:"log-format-json-escape,omitempty"`
+
 	// Customize stream log_format
 	// http://nginx.org/en/docs/http/ngx_http_log_module.html#log_format
 	LogFormatStream string `json:"log-format-stream,omitempty"`
 
+	// AnonymizeClientIPInLogs replaces the address of the clients in the access
+	// logs with the address without its last octet, or its last 80 bits for IPv6
+	// Default: false
+	AnonymizeClientIPInLogs bool `json:"anonymize-client-ip-in-logs"`
+
 	// If disabled, a worker process will accept one new connection at a time.
 	// Otherwise, a worker process will accept all new connections at a time.
 	// http://nginx.org/en/docs/ngx_core_module.html#multi_accept
@@ -379,6 +487,15 @@ type Configuration struct {
 	// https://www.igvita.com/2013/12/16/optimizing-nginx-tls-time-to-first-byte/
 	SSLBufferSize string `json:"ssl-buffer-size,omitempty"`
 
+	// NoSNIAction defines how the TLS handshakes of the clients without SNI
+	// (Server Name Indication) are handled: default-certificate, reject or
+	// server
+	NoSNIAction string `json:"no-sni-action,omitempty"`
+
+	// NoSNIServer is the hostname of the server whose certificate is served
+	// to the clients without SNI when no-sni-action is server
+	NoSNIServer string `json:"no-sni-server,omitempty"`
+
 	// Enables or disables the use of the PROXY protocol to receive client connection
 	// (real IP address) information passed through proxy servers and load balancers
 	// such as HAproxy and Amazon Elastic Load Balancer (ELB).
@@ -460,6 +577,14 @@ type Configuration struct {
 	// http://nginx.org/en/docs/http/ngx_http_upstream_module.html#keepalive_requests
 	UpstreamKeepaliveRequests int `json:"upstream-keepalive-requests,omitempty"`
 
+	// UpstreamKeepaliveGRPCConnections, UpstreamKeepaliveGRPCTimeout and
+	// UpstreamKeepaliveGRPCRequests are the settings of the keepalive pool of
+	// the locations proxied with grpc_pass, separated from the pool of the
+	// HTTP/1.1 upstreams
+	UpstreamKeepaliveGRPCConnections int `json:"upstream-keepalive-grpc-connections,omitempty"`
+	UpstreamKeepaliveGRPCTimeout     int `json:"upstream-keepalive-grpc-timeout,omitempty"`
+	UpstreamKeepaliveGRPCRequests    int `json:"upstream-keepalive-grpc-requests,omitempty"`
+
 	// Sets the maximum size of the variables hash table.
 	// http://nginx.org/en/docs/http/ngx_http_map_module.html#variables_hash_max_size
 	LimitConnZoneVariable string `json:"limit-conn-zone-variable,omitempty"`
@@ -500,6 +625,15 @@ type Configuration struct {
 	// Sets the ipv6 addresses on which the server will accept requests.
 	BindAddressIpv6 []string `json:"bind-address-ipv6,omitempty"`
 
+	// AdditionalHTTPPorts are the ports NGINX listens on for HTTP requests
+	// in addition to the port of the flag --http-port
+	AdditionalHTTPPorts []int `json:"additional-http-ports,omitempty"`
+
+	// AdditionalHTTPSPorts are the ports NGINX listens on for HTTPS requests
+	// in addition to the port of the flag --https-port. They are not served
+	// by the SSL passthrough proxy
+	AdditionalHTTPSPorts []int `json:"additional-https-ports,omitempty"`
+
 	// Sets whether to use incoming X-Forwarded headers.
 	UseForwardedHeaders bool `json:"use-forwarded-headers"`
 
@@ -628,6 +762,45 @@ type Configuration struct {
 	// Default: 1.0
 	DatadogSampleRate float32 `json:"datadog-sample-rate"`
 
+	// EnableOpentelemetry enables the nginx OpenTelemetry extension
+	// https://github.com/open-telemetry/opentelemetry-cpp-contrib/tree/main/instrumentation/nginx
+	// By default this is disabled
+	EnableOpentelemetry bool `json:"enable-opentelemetry"`
+
+	// OpentelemetryOperationName specifies a custom name for the spans
+	OpentelemetryOperationName string `json:"opentelemetry-operation-name"`
+
+	// OpentelemetryTrustIncomingSpan continues the traces of the traceparent
+	// header of the requests instead of starting new ones
+	// Default: true
+	OpentelemetryTrustIncomingSpan bool `json:"opentelemetry-trust-incoming-span"`
+
+	// OtlpCollectorHost specifies the host of the OTLP gRPC collector to use when uploading traces
+	OtlpCollectorHost string `json:"otlp-collector-host"`
+
+	// OtlpCollectorPort specifies the port of the OTLP gRPC collector
+	// Default: 4317
+	OtlpCollectorPort int `json:"otlp-collector-port"`
+
+	// OtelServiceName specifies the service name to use for any traces created
+	// Default: nginx
+	OtelServiceName string `json:"otel-service-name"`
+
+	// OtelSampler specifies the sampler of the traces.
+	// The available samplers are: AlwaysOn, AlwaysOff, TraceIdRatioBased
+	// Default: AlwaysOn
+	OtelSampler string `json:"otel-sampler"`
+
+	// OtelSamplerRatio specifies the ratio of the traces sampled by the
+	// TraceIdRatioBased sampler
+	// Default: 0.01
+	OtelSamplerRatio float32 `json:"otel-sampler-ratio"`
+
+	// OtelSamplerParentBased samples the traces of the requests with a
+	// traceparent header as their parent span was
+	// Default: false
+	OtelSamplerParentBased bool `json:"otel-sampler-parent-based"`
+
 	// MainSnippet adds custom configuration to the main section of the nginx configuration
 	MainSnippet string `json:"main-snippet"`
 
@@ -637,6 +810,15 @@ type Configuration struct {
 	// ServerSnippet adds custom configuration to all the servers in the nginx configuration
 	ServerSnippet string `json:"server-snippet"`
 
+	// StaticFiles contains the files served from NGINX in all the servers,
+	// like /robots.txt. The static-files annotation replaces the files with
+	// the same path in the servers of the Ingress
+	StaticFiles []staticfiles.File `json:"static-files,omitempty"`
+
+	// SnippetFragments contains fragments of configuration by name, included
+	// in the locations of the Ingresses with the snippet-fragments annotation
+	SnippetFragments map[string]string `json:"snippet-fragments,omitempty"`
+
 	// LocationSnippet adds custom configuration to all the locations in the nginx configuration
 	LocationSnippet string `json:"location-snippet"`
 
@@ -739,6 +921,264 @@ type Configuration struct {
 	// GlobalRateLimitStatucCode determines the HTTP status code to return
 	// when limit is exceeding during global rate limiting.
 	GlobalRateLimitStatucCode int `json:"global-rate-limit-status-code"`
+
+	// GlobalRateLimitFailPolicy defines what happens to the requests when
+	// memcached cannot be reached during global rate limiting.
+	// "allow" lets the requests through (default) and "deny" rejects them
+	// with the status code of global-rate-limit-status-code
+	GlobalRateLimitFailPolicy string `json:"global-rate-limit-fail-policy"`
+
+	// GlobalRateLimitStore is the store of the counters of the global rate
+	// limits, "memcached" (default) or "redis"
+	GlobalRateLimitStore string `json:"global-rate-limit-store"`
+
+	// GlobalRateLimitRedisHost configures Redis host.
+	GlobalRateLimitRedisHost string `json:"global-rate-limit-redis-host"`
+
+	// GlobalRateLimitRedisPort configures Redis port.
+	GlobalRateLimitRedisPort int `json:"global-rate-limit-redis-port"`
+
+	// GlobalRateLimitRedisConnectTimeout configures timeout when connecting to Redis.
+	// The unit is millisecond.
+	GlobalRateLimitRedisConnectTimeout int `json:"global-rate-limit-redis-connect-timeout"`
+
+	// GlobalRateLimitRedisMaxIdleTimeout configures how long connections
+	// should be kept alive in idle state. The unit is millisecond.
+	GlobalRateLimitRedisMaxIdleTimeout int `json:"global-rate-limit-redis-max-idle-timeout"`
+
+	// GlobalRateLimitRedisPoolSize configures how many connections
+	// should be kept alive in the pool, per NGINX worker.
+	GlobalRateLimitRedisPoolSize int `json:"global-rate-limit-redis-pool-size"`
+
+	// GlobalRateLimitRedisPasswordSecret is the Secret, in namespace/name
+	// format, with the password sent to Redis with the AUTH command in the
+	// key "password". Changes of the password do not require a reload
+	GlobalRateLimitRedisPasswordSecret string `json:"global-rate-limit-redis-password-secret"`
+
+	// GlobalRateLimitKeyHashSecret is the Secret, in namespace/name format,
+	// with the key of the HMAC of the global-rate-limit-key-hash annotation
+	// in the key "secret". Changes of the key do not require a reload
+	GlobalRateLimitKeyHashSecret string `json:"global-rate-limit-key-hash-secret"`
+
+	// GlobalRateLimitMode is how the requests of the global rate limits are
+	// counted, "store" (default) uses the store of GlobalRateLimitStore and
+	// "local-sync" keeps the counters in each controller pod, replicated to
+	// the other pods of the controller
+	GlobalRateLimitMode string `json:"global-rate-limit-mode"`
+
+	// GlobalRateLimitSyncMaxStaleness is, with the "local-sync" mode, how old
+	// the counters replicated from the other pods can be. The counters are
+	// sent every half of it and the ones received later are discarded.
+	// The unit is millisecond.
+	GlobalRateLimitSyncMaxStaleness int `json:"global-rate-limit-sync-max-staleness"`
+
+	// ProxyCacheZoneSize sets the size of the shared memory zone used to store
+	// the keys of the responses cached with the enable-proxy-cache annotation
+	// http://nginx.org/en/docs/http/ngx_http_proxy_module.html#proxy_cache_path
+	ProxyCacheZoneSize string `json:"proxy-cache-zone-size"`
+
+	// ProxyCacheMaxSize sets the maximum size of the cached responses on disk
+	ProxyCacheMaxSize string `json:"proxy-cache-max-size"`
+
+	// ProxyCacheInactive sets the time after which cached responses that
+	// are not accessed are removed from the cache
+	ProxyCacheInactive string `json:"proxy-cache-inactive"`
+
+	// ServerSnippetMergePolicy defines how the server-snippet annotations of
+	// multiple ingresses sharing a host are combined.
+	// "first" uses only the snippet of the oldest ingress (default),
+	// "creation-timestamp" concatenates all the snippets ordered by creation time and
+	// "name" concatenates all the snippets ordered by namespace and name.
+	// The server-snippet-owner annotation always takes precedence over this setting.
+	ServerSnippetMergePolicy string `json:"server-snippet-merge-policy"`
+
+	// UpstreamAliasMode defines how the value of the $proxy_upstream_alias
+	// variable is built for locations without a backend-alias annotation.
+	// Valid values are "upstream" (same as $proxy_upstream_name) and
+	// "service" (<namespace>/<service>:<service port number>)
+	UpstreamAliasMode string `json:"upstream-alias-mode"`
+
+	// EnableSharedState stores sticky sessions and passive failure marks of
+	// endpoints in the memcached server configured with the
+	// global-rate-limit-memcached-* settings, so they are shared between
+	// all the controller replicas
+	EnableSharedState bool `json:"enable-shared-state"`
+
+	// SharedStateFailureTimeout is the time, in seconds, an endpoint that failed
+	// is avoided by sticky sessions of all the replicas
+	SharedStateFailureTimeout int `json:"shared-state-failure-timeout"`
+
+	// SharedStateSessionTimeout is the time, in seconds, the endpoint of a
+	// sticky session is kept in the shared state
+	SharedStateSessionTimeout int `json:"shared-state-session-timeout"`
+
+	// MergeSlashes enables or disables compression of two or more adjacent
+	// slashes in the URI into a single slash
+	// http://nginx.org/en/docs/http/ngx_http_core_module.html#merge_slashes
+	MergeSlashes bool `json:"merge-slashes"`
+
+	// ListenAddressFamily defines the address families of the listen directives.
+	// "dual-stack" listens on IPv4 and, when available, IPv6 addresses, "ipv4" only
+	// listens on IPv4 addresses and "ipv6" only listens on IPv6 addresses
+	ListenAddressFamily string `json:"listen-address-family"`
+
+	// LimitConnPerSNI limits the number of concurrent TLS connections per SNI host name.
+	// When greater than zero the HTTPS port is served by a stream server that reads the
+	// host name from the TLS Client Hello before passing the connection to the HTTP servers.
+	// Not available when SSL Passthrough is enabled
+	// http://nginx.org/en/docs/stream/ngx_stream_limit_conn_module.html
+	LimitConnPerSNI int `json:"limit-conn-per-sni"`
+
+	// LimitConnPerSNIZoneSize sets the size of the shared memory zone used to
+	// keep the number of connections per SNI host name
+	LimitConnPerSNIZoneSize string `json:"limit-conn-per-sni-zone-size"`
+
+	// StrictRequestParsing rejects requests with ambiguous Transfer-Encoding and
+	// Content-Length combinations, used to smuggle requests, or abnormal headers
+	StrictRequestParsing bool `json:"strict-request-parsing"`
+
+	// EnableTenantIsolation renders the servers of each namespace in a separate
+	// include file. When the configuration of a namespace is invalid its servers
+	// are excluded from the configuration instead of blocking the reload of the
+	// servers of the other namespaces
+	EnableTenantIsolation bool `json:"enable-tenant-isolation"`
+
+	// EnableIngressQuarantine looks for the ingresses that generate an invalid
+	// configuration when the validation of the configuration fails, and reloads
+	// NGINX without them instead of stopping all the configuration updates
+	EnableIngressQuarantine bool `json:"enable-ingress-quarantine"`
+
+	// MaxConfigurationSize is the maximum size, in bytes, of the configuration
+	// files. A configuration exceeding it is not applied and NGINX keeps serving
+	// the last valid one
+	// Default: 0, no limit
+	MaxConfigurationSize int `json:"max-configuration-size"`
+
+	// MaxServers is the maximum number of servers of the configuration. A
+	// configuration exceeding it is not applied and NGINX keeps serving the
+	// last valid one
+	// Default: 0, no limit
+	MaxServers int `json:"max-servers"`
+
+	// TelemetryIngressLabels maps the keys of the Ingress labels to the names of
+	// the span tags and of the labels of the ingress_labels metric they are exposed as
+	// Default: empty
+	TelemetryIngressLabels map[string]string `json:"telemetry-ingress-labels"`
+
+	// BotDetectionConfigMap is the ConfigMap, in namespace/name format, with the
+	// rules applied to the requests of the locations with bot detection enabled.
+	// Changes of the rules do not require a reload
+	BotDetectionConfigMap string `json:"bot-detection-configmap"`
+
+	// BotDetectionSecret is the Secret, in namespace/name format, with the key
+	// signing the cookies of the challenge action of the bot detection rules.
+	// The replicas of the controller must share the key to accept the cookies
+	// of each other. A random key is generated by each controller when empty
+	BotDetectionSecret string `json:"bot-detection-secret"`
+
+	// TLSHostSecretsConfigMap is the ConfigMap, in namespace/name format,
+	// mapping hosts, including wildcards, to the TLS Secrets used for the
+	// hosts listed in the TLS section of an Ingress without a secretName
+	// Default: ""
+	TLSHostSecretsConfigMap string `json:"tls-host-secrets-configmap"`
+
+	// DefaultBackendTiers maps wildcard hosts, like *.staging.example.com, to
+	// the service, in namespace/name format, used as default backend for the
+	// hosts matching them that are not defined by any Ingress
+	// Default: empty
+	DefaultBackendTiers map[string]string `json:"default-backend-tiers"`
+
+	// LogLevelOverrides sets the verbosity of the logs of subsystems of the
+	// controller (store, sync, ssl and webhook) instead of the flag -v
+	// Default: empty
+	LogLevelOverrides map[string]int `json:"log-level-overrides"`
+
+	// TenantIDHeader is the header with the tenant of the requests, exposed
+	// in the $tenant_id variable
+	TenantIDHeader string `json:"tenant-id-header"`
+
+	// TenantIDJWTClaim is the claim, or path of nested claims separated by
+	// dots, of the bearer token of the Authorization header with the tenant
+	// of the requests. The signature of the token is not verified
+	TenantIDJWTClaim string `json:"tenant-id-jwt-claim"`
+
+	// TenantIDHostRegex is the regular expression applied to the host of the
+	// requests. The first capture group, or the whole match when it has no
+	// groups, is the tenant of the requests
+	TenantIDHostRegex string `json:"tenant-id-host-regex"`
+
+	// TenantIDMetricsAllowlist are the tenants counted on their own in the
+	// metrics, the requests of the other tenants are counted as "other"
+	TenantIDMetricsAllowlist []string `json:"tenant-id-metrics-allowlist"`
+
+	// ErrorResponseNegotiation renders the errors generated by NGINX, like
+	// the 404 of the default backend or the 413 and 429 of the limits, with
+	// the JSON template when the client accepts application/json and with
+	// the HTML template otherwise
+	// Default: false
+	ErrorResponseNegotiation bool `json:"error-response-negotiation"`
+
+	// ErrorResponseHTMLTemplate is the body of the HTML errors. The
+	// placeholders {status}, {reason} and {request_id} are replaced with the
+	// status code, its reason phrase and the ID of the request
+	ErrorResponseHTMLTemplate string `json:"error-response-html-template"`
+
+	// ErrorResponseJSONTemplate is the body of the JSON errors, with the same
+	// placeholders as ErrorResponseHTMLTemplate
+	ErrorResponseJSONTemplate string `json:"error-response-json-template"`
+
+	// EdgeFunctionMaxInstructions is the number of Lua instructions after
+	// which the functions of the annotation lua-edge-function are stopped
+	// Default: 100000
+	EdgeFunctionMaxInstructions int `json:"edge-function-max-instructions"`
+
+	// EdgeFunctionMaxMemory is the memory, in kilobytes, the functions of
+	// the annotation lua-edge-function can allocate
+	// Default: 1024
+	EdgeFunctionMaxMemory int `json:"edge-function-max-memory"`
+
+	// BodyFilterSandboxAllowlist are the Lua globals, like pairs, string or
+	// string.format, the snippets of the annotation body-filter-snippet can
+	// use. The name cjson gives access to the JSON encoding functions
+	BodyFilterSandboxAllowlist []string `json:"body-filter-sandbox-allowlist"`
+
+	// BodyFilterMaxInstructions is the number of Lua instructions after
+	// which the snippets of the annotation body-filter-snippet are stopped
+	// Default: 1000000
+	BodyFilterMaxInstructions int `json:"body-filter-max-instructions"`
+
+	// BodyFilterMaxMemory is the memory, in kilobytes, the snippets of the
+	// annotation body-filter-snippet can allocate
+	// Default: 4096
+	BodyFilterMaxMemory int `json:"body-filter-max-memory"`
+
+	// BodyFilterMaxBodySize is the size, in bytes, of the largest response
+	// body transformed by the annotation body-filter-snippet. The larger
+	// bodies are sent unchanged
+	// Default: 1048576
+	BodyFilterMaxBodySize int `json:"body-filter-max-body-size"`
+
+	// UnixSocketBackendDirs are the directories, mounted from the node, of
+	// the Unix domain sockets the services can proxy to with the annotation
+	// unix-socket. The annotation is ignored when no directory is set
+	UnixSocketBackendDirs []string `json:"unix-socket-backend-dirs"`
+
+	// EdgeContextHeader is the header, sent to the upstreams, with the values
+	// of the variables of edge-context-fields. The header sent by the clients
+	// is removed. Disabled when empty
+	// Default: ""
+	EdgeContextHeader string `json:"edge-context-header"`
+
+	// EdgeContextFields maps the names of the fields of the edge context to
+	// the NGINX variables, like geoip2_city_country_code or ssl_protocol,
+	// with their values. The variables without a value are omitted
+	// Default: empty
+	EdgeContextFields map[string]string `json:"edge-context-fields"`
+
+	// EdgeContextFormat is the encoding of the edge context, json or
+	// structured-field
+	// Default: json
+	EdgeContextFormat string `json:"edge-context-format"`
 }
 
 // NewDefault returns the default nginx configuration
@@ -799,6 +1239,7 @@ func NewDefault() Configuration {
 		LogFormatEscapeJSON:              false,
 		LogFormatStream:                  logFormatStream,
 		LogFormatUpstream:                logFormatUpstream,
+		LogFormatJSONEscape:              "json",
 		EnableMultiAccept:                true,
 		MaxWorkerConnections:             16384,
 		MaxWorkerOpenFiles:               0,
@@ -822,6 +1263,7 @@ func NewDefault() Configuration {
 		SSLSessionCacheSize:              sslSessionCacheSize,
 		SSLSessionTickets:                false,
 		SSLSessionTimeout:                sslSessionTimeout,
+		NoSNIAction:                      NoSNIActionDefaultCertificate,
 		EnableBrotli:                     false,
 		UseGzip:                          false,
 		UseGeoIP:                         true,
@@ -836,36 +1278,47 @@ func NewDefault() Configuration {
 		ProxyStreamNextUpstreamTimeout:   "600s",
 		ProxyStreamNextUpstreamTries:     3,
 		Backend: defaults.Backend{
-			ProxyBodySize:            bodySize,
-			ProxyConnectTimeout:      5,
-			ProxyReadTimeout:         60,
-			ProxySendTimeout:         60,
-			ProxyBuffersNumber:       4,
-			ProxyBufferSize:          "4k",
-			ProxyCookieDomain:        "off",
-			ProxyCookiePath:          "off",
-			ProxyNextUpstream:        "error timeout",
-			ProxyNextUpstreamTimeout: 0,
-			ProxyNextUpstreamTries:   3,
-			ProxyRequestBuffering:    "on",
-			ProxyRedirectFrom:        "off",
-			ProxyRedirectTo:          "off",
-			SSLRedirect:              true,
-			CustomHTTPErrors:         []int{},
-			WhitelistSourceRange:     []string{},
-			SkipAccessLogURLs:        []string{},
-			LimitRate:                0,
-			LimitRateAfter:           0,
-			ProxyBuffering:           "off",
-			ProxyHTTPVersion:         "1.1",
-			ProxyMaxTempFileSize:     "1024m",
+			ProxyBodySize:               bodySize,
+			ProxyConnectTimeout:         5,
+			ProxyReadTimeout:            60,
+			ProxySendTimeout:            60,
+			ProxyBuffersNumber:          4,
+			ProxyBufferSize:             "4k",
+			ProxyCookieDomain:           "off",
+			ProxyCookiePath:             "off",
+			ProxyNextUpstream:           "error timeout",
+			ProxyNextUpstreamTimeout:    0,
+			ProxyNextUpstreamTries:      3,
+			ProxyRequestBuffering:       "on",
+			ProxyRedirectFrom:           "off",
+			ProxyRedirectTo:             "off",
+			SSLRedirect:                 true,
+			CustomHTTPErrors:            []int{},
+			WhitelistSourceRange:        []string{},
+			CustomEndpointsAllowedCIDRs: []string{},
+			SkipAccessLogURLs:           []string{},
+			LimitRate:                   0,
+			LimitRateAfter:              0,
+			ProxyBuffering:              "off",
+			ProxyHTTPVersion:            "1.1",
+			ProxyMaxTempFileSize:        "1024m",
+			URINormalizationPolicy:      "off",
+			UpstreamAddressFamily:       "any",
+			RequestIDPolicy:             "trust",
+			RequestIDPrefix:             "client-",
+			HealthCheckInterval:         "10s",
 		},
 		UpstreamKeepaliveConnections:           320,
 		UpstreamKeepaliveTimeout:               60,
 		UpstreamKeepaliveRequests:              10000,
+		UpstreamKeepaliveGRPCConnections:       320,
+		UpstreamKeepaliveGRPCTimeout:           60,
+		UpstreamKeepaliveGRPCRequests:          10000,
 		LimitConnZoneVariable:                  defaultLimitConnZoneVariable,
 		BindAddressIpv4:                        defBindAddress,
 		BindAddressIpv6:                        defBindAddress,
+		AdditionalHTTPPorts:                    []int{},
+		AdditionalHTTPSPorts:                   []int{},
 		ZipkinCollectorPort:                    9411,
 		ZipkinServiceName:                      "nginx",
 		ZipkinSampleRate:                       1.0,
@@ -882,6 +1335,11 @@ func NewDefault() Configuration {
 		DatadogOperationNameOverride:           "nginx.handle",
 		DatadogSampleRate:                      1.0,
 		DatadogPrioritySampling:                true,
+		OpentelemetryTrustIncomingSpan:         true,
+		OtlpCollectorPort:                      4317,
+		OtelServiceName:                        "nginx",
+		OtelSampler:                            OtelSamplerAlwaysOn,
+		OtelSamplerRatio:                       0.01,
 		LimitReqStatusCode:                     503,
 		LimitConnStatusCode:                    503,
 		SyslogPort:                             514,
@@ -895,6 +1353,42 @@ func NewDefault() Configuration {
 		GlobalRateLimitMemcachedMaxIdleTimeout: 10000,
 		GlobalRateLimitMemcachedPoolSize:       50,
 		GlobalRateLimitStatucCode:              429,
+		GlobalRateLimitFailPolicy:              GlobalRateLimitFailPolicyAllow,
+		GlobalRateLimitStore:                   GlobalRateLimitStoreMemcached,
+		GlobalRateLimitRedisPort:               6379,
+		GlobalRateLimitRedisConnectTimeout:     50,
+		GlobalRateLimitRedisMaxIdleTimeout:     10000,
+		GlobalRateLimitRedisPoolSize:           50,
+		GlobalRateLimitMode:                    GlobalRateLimitModeStore,
+		GlobalRateLimitSyncMaxStaleness:        2000,
+		ProxyCacheZoneSize:                     "10m",
+		ProxyCacheMaxSize:                      "1g",
+		ProxyCacheInactive:                     "10m",
+		ServerSnippetMergePolicy:               ServerSnippetMergeFirst,
+		UpstreamAliasMode:                      UpstreamAliasModeUpstream,
+		EnableSharedState:                      false,
+		SharedStateFailureTimeout:              10,
+		SharedStateSessionTimeout:              3600,
+		MergeSlashes:                           true,
+		ListenAddressFamily:                    ListenAddressFamilyDualStack,
+		LimitConnPerSNI:                        0,
+		LimitConnPerSNIZoneSize:                "5m",
+		StrictRequestParsing:                   false,
+		EnableTenantIsolation:                  false,
+		EnableIngressQuarantine:                false,
+		MaxConfigurationSize:                   0,
+		MaxServers:                             0,
+		ErrorResponseNegotiation:               false,
+		ErrorResponseHTMLTemplate:              defErrorResponseHTMLTemplate,
+		ErrorResponseJSONTemplate:              defErrorResponseJSONTemplate,
+		EdgeFunctionMaxInstructions:            100000,
+		EdgeFunctionMaxMemory:                  1024,
+		BodyFilterSandboxAllowlist:             defBodyFilterSandboxAllowlist,
+		BodyFilterMaxInstructions:              1000000,
+		BodyFilterMaxMemory:                    4096,
+		BodyFilterMaxBodySize:                  1048576,
+		UnixSocketBackendDirs:                  []string{},
+		EdgeContextFormat:                      EdgeContextFormatJSON,
 	}
 
 	if klog.V(5).Enabled() {
@@ -917,7 +1411,15 @@ type TemplateConfig struct {
 	HealthzURI               string
 	Cfg                      Configuration
 	IsIPV6Enabled            bool
+	IsIPV6Only               bool
 	IsSSLPassthroughEnabled  bool
+	IsEchoBackendEnabled     bool
+	IsEdgeFunctionsEnabled   bool
+	IsSNIConnLimitEnabled    bool
+	IsSSLPrereadEnabled      bool
+	HTTP2DisabledHosts       []string
+	Tenants                  []Tenant
+	SnippetFragmentsDir      string
 	NginxStatusIpv4Whitelist []string
 	NginxStatusIpv6Whitelist []string
 	RedirectServers          interface{}
@@ -926,6 +1428,9 @@ type TemplateConfig struct {
 	EnableMetrics            bool
 	MaxmindEditionFiles      []string
 	MonitorMaxBatchSize      int
+	// OpenSSLVersion is the version of the OpenSSL library used by NGINX,
+	// empty when unknown
+	OpenSSLVersion string
 
 	PID        string
 	StatusPath string
@@ -933,14 +1438,32 @@ type TemplateConfig struct {
 	StreamPort int
 }
 
+// Tenant contains the servers of a namespace rendered
+// in a separate include file
+type Tenant struct {
+	Namespace string
+	Include   string
+	Servers   []*ingress.Server
+}
+
+// DefaultHTTP1SSLProxyPort is the default internal port of the HTTPS servers
+// with HTTP/2 disabled
+const DefaultHTTP1SSLProxyPort = 441
+
 // ListenPorts describe the ports required to run the
 // NGINX Ingress controller
 type ListenPorts struct {
-	HTTP     int
-	HTTPS    int
-	Health   int
-	Default  int
-	SSLProxy int
+	HTTP          int
+	HTTPS         int
+	Health        int
+	Default       int
+	SSLProxy      int
+	HTTP1SSLProxy int
+	// MixedProtocol accepts both plaintext HTTP and TLS, disabled when zero
+	MixedProtocol int
+	// MixedProtocolRedirect redirects to HTTPS the plaintext requests of
+	// MixedProtocol
+	MixedProtocolRedirect int
 }
 
 // GlobalExternalAuth describe external authentication configuration for the
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/status"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+// setConfigurationStatus updates the status of the configuration of the
+// ingresses after a sync. When the sync failed, the ingresses that changed
+// since their last status are marked as failed and the rest keep their status
+func (n *NGINXController) setConfigurationStatus(ings []*ingress.Ingress, checksum string, syncErr error) {
+	if n.syncStatus == nil || !n.cfg.UpdateConfigurationStatus {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	statuses := make(map[string]status.ConfigurationStatus, len(ings))
+	for _, ing := range ings {
+		key := k8s.MetaNamespaceKey(ing)
+		previous, hasPrevious := n.configurationStatus[key]
+
+		var cs status.ConfigurationStatus
+		if syncErr != nil && hasPrevious && previous.ObservedGeneration == ing.Generation {
+			cs = previous
+		} else {
+			cs = n.ingressConfigurationStatus(ing, checksum, syncErr)
+		}
+
+		cs.LastTransitionTime = now
+		if hasPrevious && previous.Equal(cs) {
+			cs.LastTransitionTime = previous.LastTransitionTime
+		}
+
+		statuses[key] = cs
+	}
+
+	n.runningConfigLock.Lock()
+	n.configurationStatus = statuses
+	n.runningConfigLock.Unlock()
+
+	n.syncStatus.SetConfigurationStatus(statuses)
+}
+
+// ingressConfigurationStatus returns the status of the configuration of an ingress
+func (n *NGINXController) ingressConfigurationStatus(ing *ingress.Ingress, checksum string, syncErr error) status.ConfigurationStatus {
+	cs := status.ConfigurationStatus{
+		State:                 status.ConfigurationApplied,
+		ObservedGeneration:    ing.Generation,
+		ConfigurationChecksum: checksum,
+	}
+
+	for _, d := range parser.DeprecatedAnnotationsInUse(&ing.Ingress) {
+		cs.Warnings = append(cs.Warnings, fmt.Sprintf("annotation %v is deprecated, use %v instead",
+			parser.GetAnnotationWithPrefix(d.Name), parser.GetAnnotationWithPrefix(d.ReplacedBy)))
+	}
+
+	if ing.ParsedAnnotations != nil && ing.ParsedAnnotations.Denied != nil {
+		cs.State = status.ConfigurationDenied
+		cs.Warnings = append(cs.Warnings, fmt.Sprintf("locations denied: %v", *ing.ParsedAnnotations.Denied))
+	}
+
+	if reason, ok := n.quarantinedIngresses[k8s.MetaNamespaceKey(ing)]; ok {
+		cs.State = status.ConfigurationQuarantined
+		cs.ConfigurationChecksum = ""
+		cs.Warnings = append(cs.Warnings, fmt.Sprintf("excluded from the NGINX configuration: %v", reason))
+	}
+
+	if syncErr != nil {
+		cs.State = status.ConfigurationFailed
+		cs.ConfigurationChecksum = ""
+		cs.Warnings = append(cs.Warnings, fmt.Sprintf("error updating the configuration: %v", nginxTestError(syncErr)))
+	}
+
+	return cs
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/status"
+)
+
+type fakeStatusSyncer struct {
+	statuses map[string]status.ConfigurationStatus
+}
+
+func (f *fakeStatusSyncer) Run(chan struct{}) {}
+
+func (f *fakeStatusSyncer) Shutdown() {}
+
+func (f *fakeStatusSyncer) SetConfigurationStatus(statuses map[string]status.ConfigurationStatus) {
+	f.statuses = statuses
+}
+
+func buildStatusIngress(name string, generation int64, annotations map[string]string, parsed *annotations.Ingress) *ingress.Ingress {
+	return &ingress.Ingress{
+		Ingress: networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Generation:  generation,
+				Annotations: annotations,
+			},
+		},
+		ParsedAnnotations: parsed,
+	}
+}
+
+func TestSetConfigurationStatus(t *testing.T) {
+	syncer := &fakeStatusSyncer{}
+	n := &NGINXController{
+		cfg:               &Configuration{UpdateConfigurationStatus: true},
+		syncStatus:        syncer,
+		runningConfigLock: &sync.RWMutex{},
+	}
+
+	denied := "invalid annotation"
+	ings := []*ingress.Ingress{
+		buildStatusIngress("valid", 1, nil, &annotations.Ingress{}),
+		buildStatusIngress("deprecated", 1, map[string]string{"nginx.ingress.kubernetes.io/secure-backends": "true"}, &annotations.Ingress{}),
+		buildStatusIngress("denied", 1, nil, &annotations.Ingress{Denied: &denied}),
+		buildStatusIngress("quarantined", 1, nil, &annotations.Ingress{}),
+	}
+
+	n.quarantinedIngresses = map[string]string{"default/quarantined": "invalid directive"}
+	n.setConfigurationStatus(ings, "1234", nil)
+
+	expected := map[string]string{
+		"default/valid":       status.ConfigurationApplied,
+		"default/deprecated":  status.ConfigurationApplied,
+		"default/denied":      status.ConfigurationDenied,
+		"default/quarantined": status.ConfigurationQuarantined,
+	}
+	for key, state := range expected {
+		if syncer.statuses[key].State != state {
+			t.Errorf("expected state %v for %v but got %v", state, key, syncer.statuses[key].State)
+		}
+	}
+
+	if syncer.statuses["default/valid"].ConfigurationChecksum != "1234" {
+		t.Errorf("expected the checksum of the configuration but got %v", syncer.statuses["default/valid"].ConfigurationChecksum)
+	}
+	if len(syncer.statuses["default/deprecated"].Warnings) != 1 {
+		t.Errorf("expected a warning about the deprecated annotation but got %v", syncer.statuses["default/deprecated"].Warnings)
+	}
+
+	transition := syncer.statuses["default/valid"].LastTransitionTime
+
+	// a failed sync marks the ingresses changed since the last status
+	n.quarantinedIngresses = map[string]string{}
+	ings[0] = buildStatusIngress("valid", 2, nil, &annotations.Ingress{})
+	n.setConfigurationStatus(ings, "5678", fmt.Errorf("reload failed"))
+
+	if syncer.statuses["default/valid"].State != status.ConfigurationFailed {
+		t.Errorf("expected the changed ingress to fail but got %v", syncer.statuses["default/valid"].State)
+	}
+	if syncer.statuses["default/valid"].ObservedGeneration != 2 {
+		t.Errorf("expected generation 2 but got %v", syncer.statuses["default/valid"].ObservedGeneration)
+	}
+	if syncer.statuses["default/deprecated"].State != status.ConfigurationApplied {
+		t.Errorf("expected the unchanged ingress to keep its status but got %v", syncer.statuses["default/deprecated"].State)
+	}
+	if syncer.statuses["default/deprecated"].ConfigurationChecksum != "1234" {
+		t.Errorf("expected the unchanged ingress to keep its checksum but got %v", syncer.statuses["default/deprecated"].ConfigurationChecksum)
+	}
+
+	// the transition time does not change without changes of the status
+	n.setConfigurationStatus(ings[1:], "1234", nil)
+	if syncer.statuses["default/deprecated"].LastTransitionTime != transition {
+		t.Errorf("expected the transition time %v but got %v", transition, syncer.statuses["default/deprecated"].LastTransitionTime)
+	}
+	if _, ok := syncer.statuses["default/valid"]; ok {
+		t.Errorf("expected no status for removed ingresses")
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package controller
 
 import (
+	"crypto/sha1"
 	"fmt"
 	"sort"
 	"strconv"
@@ -25,11 +26,13 @@ import (
 
 	"github.com/mitchellh/hashstructure"
 	apiv1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/ingress-nginx/internal/ingress"
 	"k8s.io/ingress-nginx/internal/ingress/annotations"
@@ -40,7 +43,10 @@ import (
 	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
 	"k8s.io/ingress-nginx/internal/ingress/controller/store"
 	"k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+	"k8s.io/ingress-nginx/internal/ingress/notifier"
 	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/logging"
 	"k8s.io/ingress-nginx/internal/nginx"
 	"k8s.io/klog/v2"
 )
@@ -59,10 +65,15 @@ type Configuration struct {
 	KubeConfigFile string
 
 	Client clientset.Interface
+	// DynamicClient is used to watch the GlobalRateLimitPolicies
+	DynamicClient dynamic.Interface
 
 	ResyncPeriod time.Duration
 
-	ConfigMapName  string
+	ConfigMapName string
+	// +optional
+	ConfigMapOverlays []string
+
 	DefaultService string
 
 	Namespace string
@@ -83,14 +94,28 @@ type Configuration struct {
 	ElectionID             string
 	UpdateStatusOnShutdown bool
 
+	UpdateConfigurationStatus bool
+
+	// ShadowMode renders and tests the NGINX configuration of the Ingresses
+	// without starting NGINX or updating the Ingresses, and exports the
+	// divergences with the serving controllers as metrics
+	ShadowMode bool
+
 	ListenPorts *ngx_config.ListenPorts
 
 	EnableSSLPassthrough bool
 
+	EnableEchoBackend bool
+
+	EnableEdgeFunctions bool
+
 	EnableProfiling bool
 
+	IntrospectionTokenFile string
+
 	EnableMetrics  bool
 	MetricsPerHost bool
+	Accounting     collectors.AccountingConfig
 
 	FakeCertificate *ingress.SSLCert
 
@@ -108,6 +133,24 @@ type Configuration struct {
 	MonitorMaxBatchSize int
 
 	ShutdownGracePeriod int
+
+	SyncWatchdogTimeout time.Duration
+	SyncWatchdogRestart bool
+
+	// ConfigurationSnapshots is the number of snapshots of the
+	// configurations of the last reloads kept, disabled when zero
+	ConfigurationSnapshots int
+
+	WatchGlobalRateLimitPolicies bool
+
+	Notifications notifier.Config
+
+	// ConfigMapRolloutSelector selects the canary replicas applying the
+	// changes of the configuration ConfigMaps first, disabled when empty
+	ConfigMapRolloutSelector labels.Selector
+	// ConfigMapRolloutSoakPeriod is the time the canary replicas must be
+	// healthy before the changes are applied to the other replicas
+	ConfigMapRolloutSoakPeriod time.Duration
 }
 
 // GetPublishService returns the Service used to set the load-balancer status of Ingresses.
@@ -126,6 +169,9 @@ func (n NGINXController) GetPublishService() *apiv1.Service {
 func (n *NGINXController) syncIngress(interface{}) error {
 	n.syncRateLimiter.Accept()
 
+	n.syncLock.Lock()
+	defer n.syncLock.Unlock()
+
 	if n.syncQueue.IsShuttingDown() {
 		return nil
 	}
@@ -134,16 +180,27 @@ func (n *NGINXController) syncIngress(interface{}) error {
 	hosts, servers, pcfg := n.getConfiguration(ings)
 
 	n.metricCollector.SetSSLExpireTime(servers)
-
-	if n.runningConfig.Equal(pcfg) {
-		klog.V(3).Infof("No configuration change detected, skipping backend reload")
+	n.metricCollector.SetAccountingTenants(ings)
+	n.metricCollector.SetIngressLabels(ings, n.store.GetBackendConfiguration().TelemetryIngressLabels)
+	n.metricCollector.SetDeprecatedAnnotations(ings)
+	n.metricCollector.ObserveAnnotationErrors(ings)
+	n.reportIgnoredIngresses(ings, pcfg)
+
+	if n.runningConfig.Equal(pcfg) && !n.snapshots.isOutdated() {
+		logging.Sync.V(3).Infof("No configuration change detected, skipping backend reload")
+		n.setConfigurationStatus(ings, n.runningConfig.ConfigurationChecksum, nil)
 		return nil
 	}
 
 	n.metricCollector.SetHosts(hosts)
 
-	if !n.IsDynamicConfigurationEnough(pcfg) {
-		klog.InfoS("Configuration changes detected, backend reload required")
+	if snapshot := n.snapshots.rolledBackTo(); snapshot != "" {
+		// the upstreams of the snapshot are still updated without reload,
+		// with the endpoints of the cluster
+		logging.Sync.InfoS("Configuration changes detected, backend reload suspended by the rollback of the configuration", "snapshot", snapshot)
+		pcfg = n.snapshots.withRolledBackUpstreams(pcfg)
+	} else if n.snapshots.isOutdated() || !n.IsDynamicConfigurationEnough(pcfg) {
+		logging.Sync.InfoS("Configuration changes detected, backend reload required", "namespaces", changedTenants(n.runningConfig, pcfg))
 
 		hash, _ := hashstructure.Hash(pcfg, &hashstructure.HashOptions{
 			TagName: "json",
@@ -151,27 +208,53 @@ func (n *NGINXController) syncIngress(interface{}) error {
 
 		pcfg.ConfigurationChecksum = fmt.Sprintf("%v", hash)
 
+		n.runningConfigLock.Lock()
+		n.quarantinedIngresses = map[string]string{}
+		n.runningConfigLock.Unlock()
+
 		err := n.OnUpdate(*pcfg)
+		if limitErr, ok := err.(*configurationLimitError); ok {
+			// the configuration is not applied, NGINX keeps serving the last valid one
+			n.recordConfigurationLimit(limitErr, changedIngresses(n.runningConfig, ings))
+			n.setConfigurationStatus(ings, pcfg.ConfigurationChecksum, err)
+			return err
+		}
+		if err != nil && n.store.GetBackendConfiguration().EnableIngressQuarantine {
+			err = n.updateWithoutInvalidIngresses(ings, pcfg.ConfigurationChecksum, err)
+		}
 		if err != nil {
 			n.metricCollector.IncReloadErrorCount()
 			n.metricCollector.ConfigSuccess(hash, false)
-			klog.Errorf("Unexpected failure reloading the backend:\n%v", err)
+			logging.Sync.Errorf("Unexpected failure reloading the backend:\n%v", err)
 			n.recorder.Eventf(k8s.IngressPodDetails, apiv1.EventTypeWarning, "RELOAD", fmt.Sprintf("Error reloading NGINX: %v", err))
+			changed := changedIngresses(n.runningConfig, ings)
+			for _, ing := range changed {
+				n.recordIngressEvent(ing, apiv1.EventTypeWarning, "ReloadFailed",
+					fmt.Sprintf("Configuration of the Ingress not applied, error reloading NGINX: %v", nginxTestError(err)))
+			}
+			n.notifyReloadFailed(pcfg.ConfigurationChecksum, changed, err)
+			n.setConfigurationStatus(ings, pcfg.ConfigurationChecksum, err)
 			return err
 		}
 
-		klog.InfoS("Backend successfully reloaded")
+		logging.Sync.InfoS("Backend successfully reloaded")
 		n.metricCollector.ConfigSuccess(hash, true)
 		n.metricCollector.IncReloadCount()
 
 		n.recorder.Eventf(k8s.IngressPodDetails, apiv1.EventTypeNormal, "RELOAD", "NGINX reload triggered due to a change in configuration")
+		n.notifier.Notify(notifier.Event{
+			Type:     notifier.ReloadCompleted,
+			Message:  "NGINX reloaded with a new configuration",
+			Checksum: pcfg.ConfigurationChecksum,
+		})
+		n.notifyExpiringCertificates(pcfg.Servers)
 	}
 
 	isFirstSync := n.runningConfig.Equal(&ingress.Configuration{})
 	if isFirstSync {
 		// For the initial sync it always takes some time for NGINX to start listening
 		// For large configurations it might take a while so we loop and back off
-		klog.InfoS("Initial sync, sleeping for 1 second")
+		logging.Sync.InfoS("Initial sync, sleeping for 1 second")
 		time.Sleep(1 * time.Second)
 	}
 
@@ -185,15 +268,16 @@ func (n *NGINXController) syncIngress(interface{}) error {
 	err := wait.ExponentialBackoff(retry, func() (bool, error) {
 		err := n.configureDynamically(pcfg)
 		if err == nil {
-			klog.V(2).Infof("Dynamic reconfiguration succeeded.")
+			logging.Sync.V(2).Infof("Dynamic reconfiguration succeeded.")
 			return true, nil
 		}
 
-		klog.Warningf("Dynamic reconfiguration failed: %v", err)
+		logging.Sync.Warningf("Dynamic reconfiguration failed: %v", err)
 		return false, err
 	})
 	if err != nil {
-		klog.Errorf("Unexpected failure reconfiguring NGINX:\n%v", err)
+		logging.Sync.Errorf("Unexpected failure reconfiguring NGINX:\n%v", err)
+		n.setConfigurationStatus(ings, pcfg.ConfigurationChecksum, err)
 		return err
 	}
 
@@ -201,7 +285,9 @@ func (n *NGINXController) syncIngress(interface{}) error {
 	re := getRemovedHosts(n.runningConfig, pcfg)
 	n.metricCollector.RemoveMetrics(ri, re)
 
-	n.runningConfig = pcfg
+	n.setRunningConfig(pcfg)
+
+	n.setConfigurationStatus(ings, pcfg.ConfigurationChecksum, nil)
 
 	return nil
 }
@@ -224,8 +310,8 @@ func (n *NGINXController) CheckIngress(ing *networking.Ingress) error {
 		return nil
 	}
 
-	if n.cfg.DisableCatchAll && ing.Spec.Backend != nil {
-		return fmt.Errorf("This deployment is trying to create a catch-all ingress while DisableCatchAll flag is set to true. Remove '.spec.backend' or set DisableCatchAll flag to false.")
+	if n.cfg.DisableCatchAll && ing.Spec.DefaultBackend != nil {
+		return fmt.Errorf("This deployment is trying to create a catch-all ingress while DisableCatchAll flag is set to true. Remove '.spec.defaultBackend' or set DisableCatchAll flag to false.")
 	}
 
 	if parser.AnnotationsPrefix != parser.DefaultAnnotationsPrefix {
@@ -241,14 +327,22 @@ func (n *NGINXController) CheckIngress(ing *networking.Ingress) error {
 	cfg := n.store.GetBackendConfiguration()
 	cfg.Resolver = n.resolver
 
-	if len(cfg.GlobalRateLimitMemcachedHost) == 0 {
+	if setting, host := globalRateLimitStoreHost(cfg); cfg.GlobalRateLimitMode != ngx_config.GlobalRateLimitModeLocalSync && len(host) == 0 {
 		for key := range ing.ObjectMeta.GetAnnotations() {
 			if strings.HasPrefix(key, fmt.Sprintf("%s/%s", parser.AnnotationsPrefix, "global-rate-limit")) {
-				return fmt.Errorf("'global-rate-limit*' annotations require 'global-rate-limit-memcached-host' settings configured in the global configmap")
+				return fmt.Errorf("'global-rate-limit*' annotations require '%s' settings configured in the global configmap", setting)
 			}
 		}
 	}
 
+	if err := annotations.NewAnnotationExtractor(n.store).Validate(ing); err != nil {
+		return err
+	}
+
+	if err := n.checkServicePortNames(ing); err != nil {
+		return err
+	}
+
 	allIngresses := n.store.ListIngresses()
 
 	filter := func(toCheck *ingress.Ingress) bool {
@@ -261,7 +355,14 @@ func (n *NGINXController) CheckIngress(ing *networking.Ingress) error {
 		ParsedAnnotations: annotations.NewAnnotationExtractor(n.store).Extract(ing),
 	})
 
-	_, servers, pcfg := n.getConfiguration(ings)
+	// the checked ingress is not applied yet, its conflicts are neither
+	// recorded in the Ingresses nor notified, and the servers of the SSL
+	// Passthrough proxy are updated by the template
+	dryRun := *n
+	dryRun.recorder = nil
+	dryRun.notifier = nil
+	dryRun.Proxy = &TCPProxy{}
+	_, servers, pcfg := dryRun.getConfiguration(ings)
 
 	err := checkOverlap(ing, allIngresses, servers)
 	if err != nil {
@@ -269,13 +370,15 @@ func (n *NGINXController) CheckIngress(ing *networking.Ingress) error {
 		return err
 	}
 
-	content, err := n.generateTemplate(cfg, *pcfg)
-	if err != nil {
-		n.metricCollector.IncCheckErrorCount(ing.ObjectMeta.Namespace, ing.Name)
-		return err
+	if cfg.EnableTenantIsolation {
+		// only the errors in the servers of the namespace of the ingress
+		// are relevant, the other tenants are quarantined during the reload
+		_, err = dryRun.quarantineTenants(cfg, *pcfg, func(namespace string, _ []*ingress.Ingress, _ string) bool {
+			return namespace != ing.Namespace
+		})
+	} else {
+		err = dryRun.testConfiguration(cfg, *pcfg)
 	}
-
-	err = n.testTemplate(content)
 	if err != nil {
 		n.metricCollector.IncCheckErrorCount(ing.ObjectMeta.Namespace, ing.Name)
 		return err
@@ -285,6 +388,46 @@ func (n *NGINXController) CheckIngress(ing *networking.Ingress) error {
 	return nil
 }
 
+// globalRateLimitStoreHost returns the setting and the host of the store of
+// the counters of the global rate limits
+func globalRateLimitStoreHost(cfg ngx_config.Configuration) (string, string) {
+	if cfg.GlobalRateLimitStore == ngx_config.GlobalRateLimitStoreRedis {
+		return "global-rate-limit-redis-host", cfg.GlobalRateLimitRedisHost
+	}
+
+	return "global-rate-limit-memcached-host", cfg.GlobalRateLimitMemcachedHost
+}
+
+// parseStreamProxyProtocol returns the PROXY protocol configuration of the
+// optional decode and encode fields of a stream service reference. The
+// encode field accepts PROXY for the version 1 of the protocol, PROXY_V2 for
+// the version 2 and PROXY_V2_TLV for the version 2 with the TLVs received
+// from the client.
+func parseStreamProxyProtocol(fields []string) ingress.ProxyProtocol {
+	var pp ingress.ProxyProtocol
+	if len(fields) >= 1 && strings.ToUpper(fields[0]) == "PROXY" {
+		pp.Decode = true
+	}
+	if len(fields) != 2 {
+		return pp
+	}
+
+	switch strings.ToUpper(fields[1]) {
+	case "PROXY":
+		pp.Encode = true
+		pp.EncodeVersion = 1
+	case "PROXY_V2":
+		pp.Encode = true
+		pp.EncodeVersion = 2
+	case "PROXY_V2_TLV":
+		pp.Encode = true
+		pp.EncodeVersion = 2
+		pp.EncodeTLVs = true
+	}
+
+	return pp
+}
+
 func (n *NGINXController) getStreamServices(configmapName string, proto apiv1.Protocol) []ingress.L4Service {
 	if configmapName == "" {
 		return []ingress.L4Service{}
@@ -302,7 +445,6 @@ func (n *NGINXController) getStreamServices(configmapName string, proto apiv1.Pr
 	}
 
 	var svcs []ingress.L4Service
-	var svcProxyProtocol ingress.ProxyProtocol
 
 	rp := []int{
 		n.cfg.ListenPorts.HTTP,
@@ -316,7 +458,7 @@ func (n *NGINXController) getStreamServices(configmapName string, proto apiv1.Pr
 	}
 
 	reservedPorts := sets.NewInt(rp...)
-	// svcRef format: <(str)namespace>/<(str)service>:<(intstr)port>[:<("PROXY")decode>:<("PROXY")encode>]
+	// svcRef format: <(str)namespace>/<(str)service>:<(intstr)port>[:<("PROXY")decode>:<("PROXY"|"PROXY_V2"|"PROXY_V2_TLV")encode>]
 	for port, svcRef := range configmap.Data {
 		externalPort, err := strconv.Atoi(port) // #nosec
 		if err != nil {
@@ -334,15 +476,13 @@ func (n *NGINXController) getStreamServices(configmapName string, proto apiv1.Pr
 		}
 		nsName := nsSvcPort[0]
 		svcPort := nsSvcPort[1]
-		svcProxyProtocol.Decode = false
-		svcProxyProtocol.Encode = false
+		var svcProxyProtocol ingress.ProxyProtocol
 		// Proxy Protocol is only compatible with TCP Services
 		if len(nsSvcPort) >= 3 && proto == apiv1.ProtocolTCP {
-			if len(nsSvcPort) >= 3 && strings.ToUpper(nsSvcPort[2]) == "PROXY" {
-				svcProxyProtocol.Decode = true
-			}
-			if len(nsSvcPort) == 4 && strings.ToUpper(nsSvcPort[3]) == "PROXY" {
-				svcProxyProtocol.Encode = true
+			svcProxyProtocol = parseStreamProxyProtocol(nsSvcPort[2:])
+			if svcProxyProtocol.EncodeTLVs && !svcProxyProtocol.Decode {
+				klog.Warningf("The TLVs of TCP port %d cannot be forwarded without decoding the PROXY protocol", externalPort)
+				svcProxyProtocol.EncodeTLVs = false
 			}
 		}
 		svcNs, svcName, err := k8s.ParseNameNS(nsName)
@@ -382,6 +522,15 @@ func (n *NGINXController) getStreamServices(configmapName string, proto apiv1.Pr
 				}
 			}
 		}
+		// the Unix domain socket of the service replaces its endpoints, only
+		// for TCP as the sockets of the node are stream sockets
+		var unixSocket string
+		if proto == apiv1.ProtocolTCP {
+			unixSocket = n.serviceUnixSocket(nsName)
+			if unixSocket != "" {
+				endps = []ingress.Endpoint{unixSocketEndpoint(unixSocket)}
+			}
+		}
 		// stream services cannot contain empty upstreams and there is
 		// no default backend equivalent
 		if len(endps) == 0 {
@@ -396,6 +545,7 @@ func (n *NGINXController) getStreamServices(configmapName string, proto apiv1.Pr
 				Port:          intstr.FromString(svcPort),
 				Protocol:      proto,
 				ProxyProtocol: svcProxyProtocol,
+				UnixSocket:    unixSocket,
 			},
 			Endpoints: endps,
 			Service:   svc,
@@ -491,13 +641,22 @@ func (n *NGINXController) getConfiguration(ingresses []*ingress.Ingress) (sets.S
 	}
 
 	return hosts, servers, &ingress.Configuration{
-		Backends:              upstreams,
-		Servers:               servers,
-		TCPEndpoints:          n.getStreamServices(n.cfg.TCPConfigMapName, apiv1.ProtocolTCP),
-		UDPEndpoints:          n.getStreamServices(n.cfg.UDPConfigMapName, apiv1.ProtocolUDP),
-		PassthroughBackends:   passUpstreams,
-		BackendConfigChecksum: n.store.GetBackendConfiguration().Checksum,
-		DefaultSSLCertificate: n.getDefaultSSLCertificate(),
+		Backends:                     upstreams,
+		Servers:                      servers,
+		TCPEndpoints:                 n.getStreamServices(n.cfg.TCPConfigMapName, apiv1.ProtocolTCP),
+		UDPEndpoints:                 n.getStreamServices(n.cfg.UDPConfigMapName, apiv1.ProtocolUDP),
+		PassthroughBackends:          passUpstreams,
+		BackendConfigChecksum:        n.store.GetBackendConfiguration().Checksum,
+		SSLDHParamChecksum:           n.getSSLDHParamChecksum(),
+		DefaultSSLCertificate:        n.getDefaultSSLCertificate(),
+		BotDetectionRules:            n.getBotDetectionRules(),
+		BotDetectionSecret:           n.getBotDetectionSecret(),
+		GlobalRateLimitRedisPassword: n.getGlobalRateLimitRedisPassword(),
+		GlobalRateLimitKeyHashSecret: n.getGlobalRateLimitKeyHashSecret(),
+		TimeWindows:                  getTimeWindows(ingresses),
+		PluginFlags:                  getPluginFlags(ingresses),
+		OpenAPISpecs:                 getOpenAPISpecs(ingresses),
+		BodyFilterSnippets:           getBodyFilterSnippets(ingresses),
 	}
 }
 
@@ -566,7 +725,7 @@ func (n *NGINXController) getBackendServers(ingresses []*ingress.Ingress) ([]*in
 			}
 
 			for _, path := range rule.HTTP.Paths {
-				upsName := upstreamName(ing.Namespace, path.Backend.ServiceName, path.Backend.ServicePort)
+				upsName := upstreamName(ing.Namespace, &path.Backend)
 
 				ups := upstreams[upsName]
 
@@ -597,6 +756,10 @@ func (n *NGINXController) getBackendServers(ingresses []*ingress.Ingress) ([]*in
 					if !loc.IsDefBackend {
 						klog.V(3).Infof("Location %q already configured for server %q with upstream %q (Ingress %q)",
 							loc.Path, server.Hostname, loc.Backend, ingKey)
+						if loc.Ingress != nil && loc.Ingress != ing {
+							n.reportConflict(ing, "LocationDropped", server.Hostname,
+								fmt.Sprintf("Path %q of host %q ignored, already defined by Ingress %v", nginxPath, server.Hostname, k8s.MetaNamespaceKey(loc.Ingress)))
+						}
 						break
 					}
 
@@ -660,6 +823,10 @@ func (n *NGINXController) getBackendServers(ingresses []*ingress.Ingress) ([]*in
 					ups.SessionAffinity.CookieSessionAffinity.SameSite = anns.SessionAffinity.Cookie.SameSite
 					ups.SessionAffinity.CookieSessionAffinity.ConditionalSameSiteNone = anns.SessionAffinity.Cookie.ConditionalSameSiteNone
 					ups.SessionAffinity.CookieSessionAffinity.ChangeOnFailure = anns.SessionAffinity.Cookie.ChangeOnFailure
+					ups.SessionAffinity.CookieSessionAffinity.Secure = anns.SessionAffinity.Cookie.Secure
+					ups.SessionAffinity.CookieSessionAffinity.HTTPOnly = anns.SessionAffinity.Cookie.HTTPOnly
+					ups.SessionAffinity.CookieSessionAffinity.Domain = anns.SessionAffinity.Cookie.Domain
+					ups.SessionAffinity.CookieSessionAffinity.ConditionalSet = anns.SessionAffinity.Cookie.ConditionalSet
 
 					locs := ups.SessionAffinity.CookieSessionAffinity.Locations
 					if _, ok := locs[host]; !ok {
@@ -726,7 +893,7 @@ func (n *NGINXController) getBackendServers(ingresses []*ingress.Ingress) ([]*in
 					aUpstreams = append(aUpstreams, nb)
 					location.DefaultBackendUpstreamName = name
 
-					if len(upstream.Endpoints) == 0 {
+					if len(upstream.Endpoints) == 0 && len(upstream.FailoverEndpoints) == 0 {
 						klog.V(3).Infof("Upstream %q has no active Endpoint, so using custom default backend for location %q in server %q (Service \"%v/%v\")",
 							upstream.Name, location.Path, server.Hostname, location.DefaultBackend.Namespace, location.DefaultBackend.Name)
 
@@ -751,17 +918,28 @@ func (n *NGINXController) getBackendServers(ingresses []*ingress.Ingress) ([]*in
 		}
 	}
 
+	aUpstreams = append(aUpstreams, n.createDefaultBackendTiers(servers)...)
+	aUpstreams = append(aUpstreams, n.createFallbackUpstreams(servers)...)
+	aUpstreams = append(aUpstreams, n.createGeoRoutingUpstreams(servers)...)
+	aUpstreams = append(aUpstreams, n.createRouteIfUpstreams(servers)...)
+
+	if labels := n.store.GetBackendConfiguration().TelemetryIngressLabels; len(labels) > 0 {
+		for _, server := range servers {
+			for _, location := range server.Locations {
+				addTelemetryTags(location, labels)
+			}
+		}
+	}
+
 	aServers := make([]*ingress.Server, 0, len(servers))
+	var pathPriorityConflicts []pathPriorityConflict
 	for _, value := range servers {
-		sort.SliceStable(value.Locations, func(i, j int) bool {
-			return value.Locations[i].Path > value.Locations[j].Path
-		})
+		sortLocations(value.Locations)
+		pathPriorityConflicts = append(pathPriorityConflicts, findPathPriorityConflicts(value)...)
 
-		sort.SliceStable(value.Locations, func(i, j int) bool {
-			return len(value.Locations[i].Path) > len(value.Locations[j].Path)
-		})
 		aServers = append(aServers, value)
 	}
+	n.reportPathPriorityConflicts(pathPriorityConflicts)
 
 	sort.SliceStable(aUpstreams, func(a, b int) bool {
 		return aUpstreams[a].Name < aUpstreams[b].Name
@@ -774,6 +952,363 @@ func (n *NGINXController) getBackendServers(ingresses []*ingress.Ingress) ([]*in
 	return aUpstreams, aServers
 }
 
+// sortLocations sorts the locations of a server in a total order, so the same
+// locations always produce the same configuration. NGINX uses the first
+// regular expression location matching the request, the path-priority
+// annotation takes precedence over the length of the paths
+func sortLocations(locations []*ingress.Location) {
+	pathType := func(location *ingress.Location) string {
+		if location.PathType == nil {
+			return ""
+		}
+		return string(*location.PathType)
+	}
+	ingressKey := func(location *ingress.Location) string {
+		if location.Ingress == nil {
+			return ""
+		}
+		return k8s.MetaNamespaceKey(location.Ingress)
+	}
+
+	sort.SliceStable(locations, func(i, j int) bool {
+		li, lj := locations[i], locations[j]
+		if li.PathPriority != lj.PathPriority {
+			return li.PathPriority > lj.PathPriority
+		}
+		if len(li.Path) != len(lj.Path) {
+			return len(li.Path) > len(lj.Path)
+		}
+		if li.Path != lj.Path {
+			return li.Path > lj.Path
+		}
+		if pathType(li) != pathType(lj) {
+			return pathType(li) < pathType(lj)
+		}
+		return ingressKey(li) < ingressKey(lj)
+	})
+}
+
+// pathPriorityConflict is a location with the same path-priority as a
+// location of another ingress of its server, their order then depends on the
+// length of the paths
+type pathPriorityConflict struct {
+	ingress *ingress.Ingress
+	host    string
+	path    string
+	message string
+}
+
+// findPathPriorityConflicts returns the locations of a server with the same
+// path-priority as the first location of their priority, when it belongs to
+// another ingress. The locations must be sorted by priority.
+func findPathPriorityConflicts(server *ingress.Server) []pathPriorityConflict {
+	var conflicts []pathPriorityConflict
+	var first *ingress.Location
+	for _, location := range server.Locations {
+		if location.PathPriority == 0 || location.Ingress == nil {
+			continue
+		}
+		if first == nil || first.PathPriority != location.PathPriority {
+			first = location
+			continue
+		}
+		if location.Ingress == first.Ingress {
+			continue
+		}
+
+		conflicts = append(conflicts, pathPriorityConflict{
+			ingress: location.Ingress,
+			host:    server.Hostname,
+			path:    location.Path,
+			message: fmt.Sprintf("Path %q of host %q has the same path-priority %v as the path %q of Ingress %v",
+				location.Path, server.Hostname, location.PathPriority, first.Path, k8s.MetaNamespaceKey(first.Ingress)),
+		})
+	}
+
+	return conflicts
+}
+
+// reportPathPriorityConflicts records an event for the path-priority
+// conflicts not reported by the previous sync, indexed by host and path.
+func (n *NGINXController) reportPathPriorityConflicts(conflicts []pathPriorityConflict) {
+	reported := make(map[string]bool, len(conflicts))
+	for _, conflict := range conflicts {
+		key := fmt.Sprintf("%v%v/%v", conflict.host, conflict.path, k8s.MetaNamespaceKey(conflict.ingress))
+		reported[key] = true
+		if n.pathPriorityConflicts[key] {
+			continue
+		}
+
+		klog.Warning(conflict.message)
+		n.reportConflict(conflict.ingress, "PathPriorityConflict", conflict.host, conflict.message)
+	}
+
+	n.pathPriorityConflicts = reported
+}
+
+// addTelemetryTags adds to the span tags of the location the labels of its ingress
+// selected in the telemetry-ingress-labels setting. The tags of the
+// opentracing-tags annotation take precedence
+func addTelemetryTags(location *ingress.Location, labels map[string]string) {
+	if location.Ingress == nil {
+		return
+	}
+
+	tags := map[string]string{}
+	for key, name := range labels {
+		if value, ok := location.Ingress.Labels[key]; ok {
+			tags[name] = value
+		}
+	}
+
+	if len(tags) == 0 {
+		return
+	}
+
+	for name, value := range location.Opentracing.Tags {
+		tags[name] = value
+	}
+
+	location.Opentracing.Tags = tags
+}
+
+// createDefaultBackendTiers creates the servers of the wildcard hosts of the
+// default-backend-tiers setting not defined by any Ingress, and the upstreams of
+// the services used as their default backend. Services without active endpoints
+// are ignored and the requests of their hosts go to the default server.
+func (n *NGINXController) createDefaultBackendTiers(servers map[string]*ingress.Server) []*ingress.Backend {
+	tiers := n.store.GetBackendConfiguration().DefaultBackendTiers
+	if len(tiers) == 0 {
+		return nil
+	}
+
+	hosts := make([]string, 0, len(tiers))
+	for host := range tiers {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	upstreams := map[string]*ingress.Backend{}
+	tierUpstreams := []*ingress.Backend{}
+	defLoc := servers[defServerName].Locations[0]
+
+	for _, host := range hosts {
+		if _, ok := servers[host]; ok {
+			klog.V(3).Infof("Host %q is defined by an Ingress, ignoring its default backend tier", host)
+			continue
+		}
+
+		svcKey := tiers[host]
+		name := fmt.Sprintf("default-backend-tier-%v", strings.Replace(svcKey, "/", "-", -1))
+
+		upstream, ok := upstreams[name]
+		if !ok {
+			svc, err := n.store.GetService(svcKey)
+			if err != nil {
+				klog.Warningf("Error getting default backend tier %q: %v", svcKey, err)
+				upstreams[name] = nil
+				continue
+			}
+
+			if len(svc.Spec.Ports) == 0 {
+				klog.Errorf("Default backend tier service %q has no ports. Ignoring", svcKey)
+				upstreams[name] = nil
+				continue
+			}
+
+			sp := svc.Spec.Ports[0]
+			endps := getEndpoints(svc, &sp, apiv1.ProtocolTCP, n.store.GetServiceEndpoints)
+			if len(endps) > 0 {
+				klog.V(3).Infof("Creating %q upstream for the default backend tier %q", name, host)
+
+				upstream = &ingress.Backend{
+					Name:      name,
+					Service:   svc,
+					Port:      intstr.FromInt(int(sp.Port)),
+					Endpoints: endps,
+				}
+				tierUpstreams = append(tierUpstreams, upstream)
+			} else {
+				klog.Warningf("Default backend tier service %q does not have any active Endpoint. Ignoring", svcKey)
+			}
+
+			upstreams[name] = upstream
+		}
+
+		if upstream == nil {
+			continue
+		}
+
+		pathTypePrefix := networking.PathTypePrefix
+		servers[host] = &ingress.Server{
+			Hostname: host,
+			SSLCert:  n.getDefaultSSLCertificate(),
+			Locations: []*ingress.Location{
+				{
+					Path:         rootLocation,
+					PathType:     &pathTypePrefix,
+					IsDefBackend: true,
+					Backend:      upstream.Name,
+					Proxy:        defLoc.Proxy,
+					Service:      upstream.Service,
+					Logs:         defLoc.Logs,
+				},
+			},
+		}
+	}
+
+	return tierUpstreams
+}
+
+// createFallbackUpstreams creates the upstreams of the services configured with
+// the fallback-service annotation and sets them in the locations using them.
+// Fallback services without active endpoints are ignored.
+func (n *NGINXController) createFallbackUpstreams(servers map[string]*ingress.Server) []*ingress.Backend {
+	upstreams := map[string]*ingress.Backend{}
+	fallbacks := []*ingress.Backend{}
+
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			svc := location.Fallback.Service
+			if svc == nil {
+				continue
+			}
+
+			name := fmt.Sprintf("fallback-%v-%v", svc.Namespace, svc.Name)
+			upstream, ok := upstreams[name]
+			if !ok {
+				upstream = n.createAnnotationUpstream(name, "fallback-service", svc)
+				if upstream != nil {
+					fallbacks = append(fallbacks, upstream)
+				}
+
+				upstreams[name] = upstream
+			}
+
+			if upstream != nil {
+				location.Fallback.Backend = name
+			}
+		}
+	}
+
+	return fallbacks
+}
+
+// createGeoRoutingUpstreams creates the upstreams of the services configured with
+// the geo-routing annotations and sets them in the rules of the locations using
+// them. Services without active endpoints are ignored, as well as the annotations
+// when no GeoIP2 database with the country of the clients is loaded.
+func (n *NGINXController) createGeoRoutingUpstreams(servers map[string]*ingress.Server) []*ingress.Backend {
+	upstreams := map[string]*ingress.Backend{}
+	geoUpstreams := []*ingress.Backend{}
+
+	backendName := func(svc *apiv1.Service) string {
+		name := fmt.Sprintf("geo-%v-%v", svc.Namespace, svc.Name)
+		upstream, ok := upstreams[name]
+		if !ok {
+			upstream = n.createAnnotationUpstream(name, "geo-routing", svc)
+			if upstream != nil {
+				geoUpstreams = append(geoUpstreams, upstream)
+			}
+
+			upstreams[name] = upstream
+		}
+
+		if upstream == nil {
+			return ""
+		}
+
+		return name
+	}
+
+	enabled := n.store.GetBackendConfiguration().UseGeoIP2 && nginx.GeoIP2CountryDB(n.cfg.MaxmindEditionFiles) != ""
+
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			geoRouting := &location.GeoRouting
+			if len(geoRouting.Rules) == 0 {
+				continue
+			}
+
+			if !enabled {
+				klog.Warningf("Location %q of server %q uses geo-routing but the GeoIP2 country or city databases are not available. Ignoring", location.Path, server.Hostname)
+				continue
+			}
+
+			for i := range geoRouting.Rules {
+				geoRouting.Rules[i].Backend = backendName(geoRouting.Rules[i].Service)
+			}
+
+			if geoRouting.DefaultService != nil {
+				geoRouting.DefaultBackend = backendName(geoRouting.DefaultService)
+			}
+		}
+	}
+
+	return geoUpstreams
+}
+
+// createRouteIfUpstreams creates the upstreams of the services configured with
+// the route-if-service annotation and sets them in the locations using them.
+// Services without active endpoints are ignored, the requests matching the
+// predicate are then sent to the backend of the location.
+func (n *NGINXController) createRouteIfUpstreams(servers map[string]*ingress.Server) []*ingress.Backend {
+	upstreams := map[string]*ingress.Backend{}
+	routeIfUpstreams := []*ingress.Backend{}
+
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			svc := location.RouteIf.Service
+			if svc == nil {
+				continue
+			}
+
+			name := fmt.Sprintf("route-if-%v-%v", svc.Namespace, svc.Name)
+			upstream, ok := upstreams[name]
+			if !ok {
+				upstream = n.createAnnotationUpstream(name, "route-if-service", svc)
+				if upstream != nil {
+					routeIfUpstreams = append(routeIfUpstreams, upstream)
+				}
+
+				upstreams[name] = upstream
+			}
+
+			if upstream != nil {
+				location.RouteIf.Backend = name
+			}
+		}
+	}
+
+	return routeIfUpstreams
+}
+
+// createAnnotationUpstream creates the upstream of the first port of a service
+// referenced by an annotation. It returns nil when the service has no ports or
+// no active endpoints.
+func (n *NGINXController) createAnnotationUpstream(name, annotation string, svc *apiv1.Service) *ingress.Backend {
+	if len(svc.Spec.Ports) == 0 {
+		klog.Errorf("Service %v/%v of annotation %v has no ports. Ignoring", svc.Namespace, svc.Name, annotation)
+		return nil
+	}
+
+	sp := svc.Spec.Ports[0]
+	endps := getEndpoints(svc, &sp, apiv1.ProtocolTCP, n.store.GetServiceEndpoints)
+	if len(endps) == 0 {
+		klog.Warningf("Service %v/%v of annotation %v does not have any active Endpoint. Ignoring", svc.Namespace, svc.Name, annotation)
+		return nil
+	}
+
+	klog.V(3).Infof("Creating %q upstream based on %v annotation", name, annotation)
+
+	return &ingress.Backend{
+		Name:      name,
+		Service:   svc,
+		Port:      intstr.FromInt(int(sp.Port)),
+		Endpoints: endps,
+	}
+}
+
 // createUpstreams creates the NGINX upstreams (Endpoints) for each Service
 // referenced in Ingress rules.
 func (n *NGINXController) createUpstreams(data []*ingress.Ingress, du *ingress.Backend) map[string]*ingress.Backend {
@@ -784,8 +1319,8 @@ func (n *NGINXController) createUpstreams(data []*ingress.Ingress, du *ingress.B
 		anns := ing.ParsedAnnotations
 
 		var defBackend string
-		if ing.Spec.Backend != nil {
-			defBackend = upstreamName(ing.Namespace, ing.Spec.Backend.ServiceName, ing.Spec.Backend.ServicePort)
+		if ing.Spec.DefaultBackend != nil {
+			defBackend = upstreamName(ing.Namespace, ing.Spec.DefaultBackend)
 
 			klog.V(3).Infof("Creating upstream %q", defBackend)
 			upstreams[defBackend] = newUpstream(defBackend)
@@ -793,46 +1328,70 @@ func (n *NGINXController) createUpstreams(data []*ingress.Ingress, du *ingress.B
 			upstreams[defBackend].UpstreamHashBy.UpstreamHashBy = anns.UpstreamHashBy.UpstreamHashBy
 			upstreams[defBackend].UpstreamHashBy.UpstreamHashBySubset = anns.UpstreamHashBy.UpstreamHashBySubset
 			upstreams[defBackend].UpstreamHashBy.UpstreamHashBySubsetSize = anns.UpstreamHashBy.UpstreamHashBySubsetSize
+			upstreams[defBackend].UpstreamHashBy.UpstreamHashByFallback = anns.UpstreamHashBy.UpstreamHashByFallback
+			upstreams[defBackend].UpstreamHashBy.UpstreamHashByBalanceFactor = anns.UpstreamHashBy.UpstreamHashByBalanceFactor
 
 			upstreams[defBackend].LoadBalancing = anns.LoadBalancing
 			if upstreams[defBackend].LoadBalancing == "" {
 				upstreams[defBackend].LoadBalancing = n.store.GetBackendConfiguration().LoadBalancing
 			}
 
-			svcKey := fmt.Sprintf("%v/%v", ing.Namespace, ing.Spec.Backend.ServiceName)
+			upstreams[defBackend].FailoverEndpoints = anns.FailoverEndpoints
+			upstreams[defBackend].WarmUp = anns.WarmUp
+			upstreams[defBackend].CircuitBreaker = anns.CircuitBreaker
+			upstreams[defBackend].HealthCheck = anns.HealthCheck
+			upstreams[defBackend].ExternalNameSRV = anns.ExternalNameSRV
+			upstreams[defBackend].DrainTimeout = anns.DrainTimeout
+
+			svcKey := fmt.Sprintf("%v/%v", ing.Namespace, k8s.BackendServiceName(ing.Spec.DefaultBackend))
 
 			// add the service ClusterIP as a single Endpoint instead of individual Endpoints
-			if anns.ServiceUpstream {
-				endpoint, err := n.getServiceClusterEndpoint(svcKey, ing.Spec.Backend)
-				if err != nil {
-					klog.Errorf("Failed to determine a suitable ClusterIP Endpoint for Service %q: %v", svcKey, err)
-				} else {
-					upstreams[defBackend].Endpoints = []ingress.Endpoint{endpoint}
-				}
+			endpoints, serviceUpstream := n.serviceUpstreamEndpoints(ing, svcKey, ing.Spec.DefaultBackend)
+			if serviceUpstream {
+				upstreams[defBackend].Endpoints = endpoints
+			}
+
+			// the endpoints outside of the cluster replace the ones of the service
+			if len(anns.CustomEndpoints) > 0 {
+				upstreams[defBackend].Endpoints = customEndpoints(anns.CustomEndpoints)
+			}
+
+			// the Unix domain socket of the service replaces its endpoints
+			if socket := n.serviceUnixSocket(svcKey); socket != "" {
+				upstreams[defBackend].UnixSocket = socket
+				upstreams[defBackend].Endpoints = []ingress.Endpoint{unixSocketEndpoint(socket)}
 			}
 
 			// configure traffic shaping for canary
 			if anns.Canary.Enabled {
 				upstreams[defBackend].NoServer = true
 				upstreams[defBackend].TrafficShapingPolicy = ingress.TrafficShapingPolicy{
-					Weight:        anns.Canary.Weight,
+					Weight:        n.canaryAnalyzer.weight(ing, anns.Canary.Weight),
 					Header:        anns.Canary.Header,
 					HeaderValue:   anns.Canary.HeaderValue,
+					HeaderValues:  anns.Canary.HeaderValues,
 					HeaderPattern: anns.Canary.HeaderPattern,
 					Cookie:        anns.Canary.Cookie,
+					CookieValue:   anns.Canary.CookieValue,
+					GRPCMethods:   anns.Canary.GRPCMethods,
+					ContentTypes:  anns.Canary.ContentTypes,
+					MatchMode:     anns.Canary.MatchMode,
 				}
 			}
 
-			if len(upstreams[defBackend].Endpoints) == 0 {
-				endps, err := n.serviceEndpoints(svcKey, ing.Spec.Backend.ServicePort.String())
+			if len(upstreams[defBackend].Endpoints) == 0 && !serviceUpstream {
+				port := k8s.BackendServicePort(ing.Spec.DefaultBackend)
+				endps, err := n.serviceEndpoints(svcKey, port.String())
 				upstreams[defBackend].Endpoints = append(upstreams[defBackend].Endpoints, endps...)
 				if err != nil {
 					klog.Warningf("Error creating upstream %q: %v", defBackend, err)
 				}
 			}
 
+			upstreams[defBackend].Endpoints = filterEndpointsByAddressFamily(upstreams[defBackend].Endpoints, anns.UpstreamAddressFamily)
+
 			s, err := n.store.GetService(svcKey)
-			if err != nil {
+			if err != nil && len(anns.CustomEndpoints) == 0 {
 				klog.Warningf("Error obtaining Service %q: %v", svcKey, err)
 			}
 			upstreams[defBackend].Service = s
@@ -844,7 +1403,7 @@ func (n *NGINXController) createUpstreams(data []*ingress.Ingress, du *ingress.B
 			}
 
 			for _, path := range rule.HTTP.Paths {
-				name := upstreamName(ing.Namespace, path.Backend.ServiceName, path.Backend.ServicePort)
+				name := upstreamName(ing.Namespace, &path.Backend)
 
 				if _, ok := upstreams[name]; ok {
 					continue
@@ -852,43 +1411,64 @@ func (n *NGINXController) createUpstreams(data []*ingress.Ingress, du *ingress.B
 
 				klog.V(3).Infof("Creating upstream %q", name)
 				upstreams[name] = newUpstream(name)
-				upstreams[name].Port = path.Backend.ServicePort
+				upstreams[name].Port = k8s.BackendServicePort(&path.Backend)
 
 				upstreams[name].UpstreamHashBy.UpstreamHashBy = anns.UpstreamHashBy.UpstreamHashBy
 				upstreams[name].UpstreamHashBy.UpstreamHashBySubset = anns.UpstreamHashBy.UpstreamHashBySubset
 				upstreams[name].UpstreamHashBy.UpstreamHashBySubsetSize = anns.UpstreamHashBy.UpstreamHashBySubsetSize
+				upstreams[name].UpstreamHashBy.UpstreamHashByFallback = anns.UpstreamHashBy.UpstreamHashByFallback
+				upstreams[name].UpstreamHashBy.UpstreamHashByBalanceFactor = anns.UpstreamHashBy.UpstreamHashByBalanceFactor
 
 				upstreams[name].LoadBalancing = anns.LoadBalancing
 				if upstreams[name].LoadBalancing == "" {
 					upstreams[name].LoadBalancing = n.store.GetBackendConfiguration().LoadBalancing
 				}
 
-				svcKey := fmt.Sprintf("%v/%v", ing.Namespace, path.Backend.ServiceName)
+				upstreams[name].FailoverEndpoints = anns.FailoverEndpoints
+				upstreams[name].WarmUp = anns.WarmUp
+				upstreams[name].CircuitBreaker = anns.CircuitBreaker
+				upstreams[name].HealthCheck = anns.HealthCheck
+				upstreams[name].ExternalNameSRV = anns.ExternalNameSRV
+				upstreams[name].DrainTimeout = anns.DrainTimeout
+
+				svcKey := fmt.Sprintf("%v/%v", ing.Namespace, k8s.BackendServiceName(&path.Backend))
 
 				// add the service ClusterIP as a single Endpoint instead of individual Endpoints
-				if anns.ServiceUpstream {
-					endpoint, err := n.getServiceClusterEndpoint(svcKey, &path.Backend)
-					if err != nil {
-						klog.Errorf("Failed to determine a suitable ClusterIP Endpoint for Service %q: %v", svcKey, err)
-					} else {
-						upstreams[name].Endpoints = []ingress.Endpoint{endpoint}
-					}
+				endpoints, serviceUpstream := n.serviceUpstreamEndpoints(ing, svcKey, &path.Backend)
+				if serviceUpstream {
+					upstreams[name].Endpoints = endpoints
+				}
+
+				// the endpoints outside of the cluster replace the ones of the service
+				if len(anns.CustomEndpoints) > 0 {
+					upstreams[name].Endpoints = customEndpoints(anns.CustomEndpoints)
+				}
+
+				// the Unix domain socket of the service replaces its endpoints
+				if socket := n.serviceUnixSocket(svcKey); socket != "" {
+					upstreams[name].UnixSocket = socket
+					upstreams[name].Endpoints = []ingress.Endpoint{unixSocketEndpoint(socket)}
 				}
 
 				// configure traffic shaping for canary
 				if anns.Canary.Enabled {
 					upstreams[name].NoServer = true
 					upstreams[name].TrafficShapingPolicy = ingress.TrafficShapingPolicy{
-						Weight:        anns.Canary.Weight,
+						Weight:        n.canaryAnalyzer.weight(ing, anns.Canary.Weight),
 						Header:        anns.Canary.Header,
 						HeaderValue:   anns.Canary.HeaderValue,
+						HeaderValues:  anns.Canary.HeaderValues,
 						HeaderPattern: anns.Canary.HeaderPattern,
 						Cookie:        anns.Canary.Cookie,
+						CookieValue:   anns.Canary.CookieValue,
+						GRPCMethods:   anns.Canary.GRPCMethods,
+						ContentTypes:  anns.Canary.ContentTypes,
+						MatchMode:     anns.Canary.MatchMode,
 					}
 				}
 
-				if len(upstreams[name].Endpoints) == 0 {
-					endp, err := n.serviceEndpoints(svcKey, path.Backend.ServicePort.String())
+				if len(upstreams[name].Endpoints) == 0 && !serviceUpstream {
+					endp, err := n.serviceEndpoints(svcKey, upstreams[name].Port.String())
 					if err != nil {
 						klog.Warningf("Error obtaining Endpoints for Service %q: %v", svcKey, err)
 						continue
@@ -896,9 +1476,14 @@ func (n *NGINXController) createUpstreams(data []*ingress.Ingress, du *ingress.B
 					upstreams[name].Endpoints = endp
 				}
 
+				upstreams[name].Endpoints = filterEndpointsByAddressFamily(upstreams[name].Endpoints, anns.UpstreamAddressFamily)
+
 				s, err := n.store.GetService(svcKey)
 				if err != nil {
-					klog.Warningf("Error obtaining Service %q: %v", svcKey, err)
+					// the custom endpoints do not require a service
+					if len(anns.CustomEndpoints) == 0 {
+						klog.Warningf("Error obtaining Service %q: %v", svcKey, err)
+					}
 					continue
 				}
 
@@ -910,9 +1495,102 @@ func (n *NGINXController) createUpstreams(data []*ingress.Ingress, du *ingress.B
 	return upstreams
 }
 
+// serviceUnixSocket returns the path of the Unix domain socket of a service
+// with the annotation unix-socket, or an empty string
+func (n *NGINXController) serviceUnixSocket(svcKey string) string {
+	svc, err := n.store.GetService(svcKey)
+	if err != nil {
+		return ""
+	}
+
+	path, err := unixSocketPath(svc, n.store.GetBackendConfiguration().UnixSocketBackendDirs)
+	if err != nil {
+		klog.Warningf("Ignoring the Unix socket of Service %q: %v", svcKey, err)
+		return ""
+	}
+
+	return path
+}
+
+// checkServicePortNames returns an error if a backend of the Ingress references
+// by name a port that does not exist in its Service. Services that do not exist
+// yet are not checked.
+func (n *NGINXController) checkServicePortNames(ing *networking.Ingress) error {
+	backends := []*networking.IngressBackend{}
+	if ing.Spec.DefaultBackend != nil {
+		backends = append(backends, ing.Spec.DefaultBackend)
+	}
+
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+
+		for i := range rule.HTTP.Paths {
+			backends = append(backends, &rule.HTTP.Paths[i].Backend)
+		}
+	}
+
+	for _, backend := range backends {
+		if backend.Service == nil || backend.Service.Port.Name == "" {
+			continue
+		}
+
+		svcKey := fmt.Sprintf("%v/%v", ing.Namespace, backend.Service.Name)
+		svc, err := n.store.GetService(svcKey)
+		if err != nil {
+			continue
+		}
+
+		if _, err := n.store.GetServicePort(svc, backend.Service.Port.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // getServiceClusterEndpoint returns an Endpoint corresponding to the ClusterIP
 // field of a Service.
-func (n *NGINXController) getServiceClusterEndpoint(svcKey string, backend *networking.IngressBackend) (endpoint ingress.Endpoint, err error) {
+// serviceUpstreamEndpoints returns the ClusterIP of the Service as the only
+// Endpoint of the backend when the service-upstream annotation is enabled.
+// The second value reports whether the Endpoints of the backend are decided:
+// when the Service has less ready Endpoints than required, no Endpoint is
+// returned so the backend behaves as a Service without Endpoints.
+func (n *NGINXController) serviceUpstreamEndpoints(ing *ingress.Ingress, svcKey string, backend *networking.IngressBackend) ([]ingress.Endpoint, bool) {
+	cfg := ing.ParsedAnnotations.ServiceUpstream
+	if !cfg.Enabled {
+		return nil, false
+	}
+
+	endpoint, err := n.getServiceClusterEndpoint(svcKey, backend, cfg.Port)
+	if err != nil {
+		klog.Errorf("Failed to determine a suitable ClusterIP Endpoint for Service %q: %v", svcKey, err)
+		return nil, false
+	}
+
+	if cfg.MinReadyEndpoints > 0 {
+		// the ready Endpoints are the ones of the port the ClusterIP forwards to
+		port := k8s.BackendServicePort(backend)
+		if cfg.Port != "" {
+			port = intstr.Parse(cfg.Port)
+		}
+		ready, err := n.serviceEndpoints(svcKey, port.String())
+		if err != nil {
+			klog.Warningf("Error obtaining Endpoints for Service %q: %v", svcKey, err)
+		}
+		if len(ready) < cfg.MinReadyEndpoints {
+			klog.Warningf("Service %q has %d ready Endpoints, at least %d are required to use its ClusterIP", svcKey, len(ready), cfg.MinReadyEndpoints)
+			return []ingress.Endpoint{}, true
+		}
+	}
+
+	return []ingress.Endpoint{endpoint}, true
+}
+
+// getServiceClusterEndpoint returns the ClusterIP of the Service with the port
+// of the backend, or with the port override when it is not empty.
+func (n *NGINXController) getServiceClusterEndpoint(svcKey string, backend *networking.IngressBackend, portOverride string) (endpoint ingress.Endpoint, err error) {
 	svc, err := n.store.GetService(svcKey)
 	if err != nil {
 		return endpoint, fmt.Errorf("service %q does not exist", svcKey)
@@ -926,25 +1604,38 @@ func (n *NGINXController) getServiceClusterEndpoint(svcKey string, backend *netw
 
 	// if the Service port is referenced by name in the Ingress, lookup the
 	// actual port in the service spec
-	if backend.ServicePort.Type == intstr.String {
-		var port int32 = -1
-		for _, svcPort := range svc.Spec.Ports {
-			if svcPort.Name == backend.ServicePort.String() {
-				port = svcPort.Port
-				break
-			}
-		}
-		if port == -1 {
-			return endpoint, fmt.Errorf("service %q does not have a port named %q", svc.Name, backend.ServicePort)
+	servicePort := k8s.BackendServicePort(backend)
+	if portOverride != "" {
+		servicePort = intstr.Parse(portOverride)
+	}
+
+	if servicePort.Type == intstr.String {
+		port, err := n.store.GetServicePort(svc, servicePort.String())
+		if err != nil {
+			return endpoint, err
 		}
-		endpoint.Port = fmt.Sprintf("%d", port)
+		endpoint.Port = fmt.Sprintf("%d", port.Port)
 	} else {
-		endpoint.Port = backend.ServicePort.String()
+		// the ClusterIP only forwards the ports of the Service
+		if portOverride != "" && !hasServicePort(svc, servicePort.IntVal) {
+			return endpoint, fmt.Errorf("port %v is not exposed by Service %q", servicePort.IntVal, svcKey)
+		}
+		endpoint.Port = servicePort.String()
 	}
 
 	return endpoint, err
 }
 
+// hasServicePort returns true if the Service exposes the port
+func hasServicePort(svc *apiv1.Service, port int32) bool {
+	for i := range svc.Spec.Ports {
+		if svc.Spec.Ports[i].Port == port {
+			return true
+		}
+	}
+	return false
+}
+
 // serviceEndpoints returns the upstream servers (Endpoints) associated with a Service.
 func (n *NGINXController) serviceEndpoints(svcKey, backendPort string) ([]ingress.Endpoint, error) {
 	var upstreams []ingress.Endpoint
@@ -969,6 +1660,23 @@ func (n *NGINXController) serviceEndpoints(svcKey, backendPort string) ([]ingres
 		return upstreams, nil
 	}
 
+	// the Service port is referenced by name in the Ingress
+	if _, err := strconv.Atoi(backendPort); err != nil {
+		servicePort, err := n.store.GetServicePort(svc, backendPort)
+		if err != nil {
+			klog.Warningf("Error obtaining port %q of Service %q: %v", backendPort, svcKey, err)
+			return upstreams, nil
+		}
+
+		endps := getEndpoints(svc, servicePort, apiv1.ProtocolTCP, n.store.GetServiceEndpoints)
+		if len(endps) == 0 {
+			klog.Warningf("Service %q does not have any active Endpoint.", svcKey)
+		}
+
+		upstreams = append(upstreams, endps...)
+		return upstreams, nil
+	}
+
 	for i := range svc.Spec.Ports {
 		servicePort := svc.Spec.Ports[i]
 		// targetPort could be a string, use either the port name or number (int)
@@ -998,11 +1706,33 @@ func (n *NGINXController) getDefaultSSLCertificate() *ingress.SSLCert {
 		}
 
 		klog.Warningf("Error loading custom default certificate, falling back to generated default:\n%v", err)
+		if n.recorder != nil && k8s.IngressPodDetails != nil {
+			n.recorder.Eventf(k8s.IngressPodDetails, apiv1.EventTypeWarning, "CertificateFallback",
+				"Error loading the default certificate %v, using the generated certificate: %v", n.cfg.DefaultSSLCertificate, err)
+		}
 	}
 
 	return n.cfg.FakeCertificate
 }
 
+// getSSLDHParamChecksum returns the checksum of the DH parameters of the
+// Secret of the ssl-dh-param setting. The name of the file of the parameters
+// does not change with the content of the Secret, a reload is only required
+// when the checksum changes.
+func (n *NGINXController) getSSLDHParamChecksum() string {
+	key := n.store.GetBackendConfiguration().SSLDHParam
+	if key == "" {
+		return ""
+	}
+
+	secret, err := n.store.GetSecret(key)
+	if err != nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%x", sha1.Sum(secret.Data["dhparam.pem"])) // #nosec
+}
+
 // createServers builds a map of host name to Server structs from a map of
 // already computed Upstream structs. Each Server is configured with at least
 // one root location, which uses a default backend if left unspecified.
@@ -1017,6 +1747,7 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 	ngxProxy := proxy.Config{
 		BodySize:             bdef.ProxyBodySize,
 		ConnectTimeout:       bdef.ProxyConnectTimeout,
+		SSLHandshakeTimeout:  bdef.ProxySSLHandshakeTimeout,
 		SendTimeout:          bdef.ProxySendTimeout,
 		ReadTimeout:          bdef.ProxyReadTimeout,
 		BuffersNumber:        bdef.ProxyBuffersNumber,
@@ -1066,8 +1797,8 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 			continue
 		}
 
-		if ing.Spec.Backend != nil {
-			defUpstream := upstreamName(ing.Namespace, ing.Spec.Backend.ServiceName, ing.Spec.Backend.ServicePort)
+		if ing.Spec.DefaultBackend != nil {
+			defUpstream := upstreamName(ing.Namespace, ing.Spec.DefaultBackend)
 
 			if backendUpstream, ok := upstreams[defUpstream]; ok {
 				// use backend specified in Ingress as the default backend for all its rules
@@ -1129,6 +1860,11 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 		}
 	}
 
+	// ingresses defining a server-snippet for each host
+	serverSnippets := make(map[string][]*ingress.Ingress)
+	// ingresses defining a snippet-server-top for each host
+	topSnippets := make(map[string][]*ingress.Ingress)
+
 	// configure default location, alias, and SSL
 	for _, ing := range data {
 		ingKey := k8s.MetaNamespaceKey(ing)
@@ -1154,13 +1890,12 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 				klog.Warningf("Aliases already configured for server %q, skipping (Ingress %q)", host, ingKey)
 			}
 
-			if anns.ServerSnippet != "" {
-				if servers[host].ServerSnippet == "" {
-					servers[host].ServerSnippet = anns.ServerSnippet
-				} else {
-					klog.Warningf("Server snippet already configured for server %q, skipping (Ingress %q)",
-						host, ingKey)
-				}
+			if anns.ServerSnippet != "" && !containsIngress(serverSnippets[host], ing) {
+				serverSnippets[host] = append(serverSnippets[host], ing)
+			}
+
+			if anns.SnippetPositions.ServerTop != "" && !containsIngress(topSnippets[host], ing) {
+				topSnippets[host] = append(topSnippets[host], ing)
 			}
 
 			// only add SSL ciphers if the server does not have them previously configured
@@ -1173,6 +1908,34 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 				servers[host].SSLPreferServerCiphers = anns.SSLCipher.SSLPreferServerCiphers
 			}
 
+			// HTTP/2 is disabled if any Ingress of the server disables it
+			if anns.HTTP2.Disabled {
+				servers[host].HTTP2.Disabled = true
+			}
+
+			// only add the maximum number of HTTP/2 streams if the server does not have it previously configured
+			if servers[host].HTTP2.MaxConcurrentStreams == 0 && anns.HTTP2.MaxConcurrentStreams > 0 {
+				servers[host].HTTP2.MaxConcurrentStreams = anns.HTTP2.MaxConcurrentStreams
+			}
+
+			// only add the static files if the server does not have them previously configured
+			if len(servers[host].StaticFiles.Files) == 0 && len(anns.StaticFiles.Files) > 0 {
+				servers[host].StaticFiles = anns.StaticFiles
+			}
+
+			// only add the limits of the request headers if the server does not have them previously configured
+			if servers[host].RequestHeaders.LargeClientHeaderBuffers == "" && anns.RequestHeaders.LargeClientHeaderBuffers != "" {
+				servers[host].RequestHeaders.LargeClientHeaderBuffers = anns.RequestHeaders.LargeClientHeaderBuffers
+			}
+			if servers[host].RequestHeaders.MaxHeaderCount == 0 && anns.RequestHeaders.MaxHeaderCount > 0 {
+				servers[host].RequestHeaders.MaxHeaderCount = anns.RequestHeaders.MaxHeaderCount
+			}
+
+			// OCSP must-staple is enforced if any Ingress of the server enforces it
+			if anns.OCSPMustStaple {
+				servers[host].OCSPMustStaple = true
+			}
+
 			// only add a certificate if the server does not have one previously configured
 			if servers[host].SSLCert != nil {
 				continue
@@ -1184,16 +1947,27 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 			}
 
 			tlsSecretName := extractTLSSecretName(host, ing, n.store.GetLocalSSLCert)
+			secrKey := fmt.Sprintf("%v/%v", ing.Namespace, tlsSecretName)
 			if tlsSecretName == "" {
-				klog.V(3).Infof("Host %q is listed in the TLS section but secretName is empty. Using default certificate", host)
-				servers[host].SSLCert = n.getDefaultSSLCertificate()
-				continue
+				secrKey = ""
+				if isTLSHost(host, ing) {
+					secrKey = n.store.GetTLSHostSecret(host)
+				}
+
+				if secrKey == "" {
+					klog.V(3).Infof("Host %q is listed in the TLS section but secretName is empty. Using default certificate", host)
+					servers[host].SSLCert = n.getDefaultSSLCertificate()
+					continue
+				}
+
+				klog.V(3).Infof("Host %q is listed in the TLS section but secretName is empty. Using the SSL certificate %q of the TLS host Secrets", host, secrKey)
 			}
 
-			secrKey := fmt.Sprintf("%v/%v", ing.Namespace, tlsSecretName)
 			cert, err := n.store.GetLocalSSLCert(secrKey)
 			if err != nil {
 				klog.Warningf("Error getting SSL certificate %q: %v. Using default certificate", secrKey, err)
+				n.recordIngressEvent(ing, apiv1.EventTypeWarning, "CertificateFallback",
+					fmt.Sprintf("Using the default certificate for host %q, error getting SSL certificate %q: %v", host, secrKey, err))
 				servers[host].SSLCert = n.getDefaultSSLCertificate()
 				continue
 			}
@@ -1201,6 +1975,8 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 			if cert.Certificate == nil {
 				klog.Warningf("SSL certificate %q does not contain a valid SSL certificate for server %q", secrKey, host)
 				klog.Warningf("Using default certificate")
+				n.recordIngressEvent(ing, apiv1.EventTypeWarning, "CertificateFallback",
+					fmt.Sprintf("Using the default certificate for host %q, SSL certificate %q is not valid", host, secrKey))
 				servers[host].SSLCert = n.getDefaultSSLCertificate()
 				continue
 			}
@@ -1215,6 +1991,8 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 				if err != nil {
 					klog.Warningf("SSL certificate %q does not contain a Common Name or Subject Alternative Name for server %q: %v", secrKey, host, err)
 					klog.Warningf("Using default certificate")
+					n.recordIngressEvent(ing, apiv1.EventTypeWarning, "CertificateFallback",
+						fmt.Sprintf("Using the default certificate for host %q, SSL certificate %q does not contain the host", host, secrKey))
 					servers[host].SSLCert = n.getDefaultSSLCertificate()
 					continue
 				}
@@ -1228,6 +2006,15 @@ func (n *NGINXController) createServers(data []*ingress.Ingress,
 		}
 	}
 
+	serverSnippetMergePolicy := n.store.GetBackendConfiguration().ServerSnippetMergePolicy
+	for host, ings := range serverSnippets {
+		servers[host].ServerSnippet = n.mergeServerSnippets(host, ings, serverSnippetMergePolicy)
+	}
+
+	for host, ings := range topSnippets {
+		servers[host].TopSnippet = n.mergeTopSnippets(host, ings, serverSnippetMergePolicy)
+	}
+
 	for host, hostAliases := range allAliases {
 		if _, ok := servers[host]; !ok {
 			continue
@@ -1260,21 +2047,30 @@ func locationApplyAnnotations(loc *ingress.Location, anns *annotations.Ingress)
 	loc.BasicDigestAuth = anns.BasicDigestAuth
 	loc.ClientBodyBufferSize = anns.ClientBodyBufferSize
 	loc.ConfigurationSnippet = anns.ConfigurationSnippet
+	loc.PreProxySnippet = anns.SnippetPositions.LocationPreProxy
+	loc.PostProxySnippet = anns.SnippetPositions.LocationPostProxy
+	loc.SnippetFragments = anns.SnippetFragments
 	loc.CorsConfig = anns.CorsConfig
 	loc.ExternalAuth = anns.ExternalAuth
 	loc.EnableGlobalAuth = anns.EnableGlobalAuth
 	loc.HTTP2PushPreload = anns.HTTP2PushPreload
 	loc.Opentracing = anns.Opentracing
+	loc.Opentelemetry = anns.Opentelemetry
 	loc.Proxy = anns.Proxy
-	loc.ProxySSL = anns.ProxySSL
+	loc.ProxySSL = anns.ProxySSL.ForPath(loc.Path)
 	loc.RateLimit = anns.RateLimit
 	loc.GlobalRateLimit = anns.GlobalRateLimit
+	loc.RateLimitExemption = anns.RateLimitExemption
+	loc.ConnectionLimit = anns.ConnectionLimit
+	loc.WebSocketLimit = anns.WebSocketLimit
+	loc.BackendBandwidth = anns.BackendBandwidth
 	loc.Redirect = anns.Redirect
 	loc.Rewrite = anns.Rewrite
 	loc.UpstreamVhost = anns.UpstreamVhost
 	loc.Whitelist = anns.Whitelist
 	loc.Denied = anns.Denied
 	loc.XForwardedPrefix = anns.XForwardedPrefix
+	loc.UpstreamPrefix = anns.UpstreamPrefix
 	loc.UsePortInRedirects = anns.UsePortInRedirects
 	loc.Connection = anns.Connection
 	loc.Logs = anns.Logs
@@ -1286,10 +2082,199 @@ func locationApplyAnnotations(loc *ingress.Location, anns *annotations.Ingress)
 	loc.ModSecurity = anns.ModSecurity
 	loc.Satisfy = anns.Satisfy
 	loc.Mirror = anns.Mirror
+	loc.CSPNonce = anns.CSPNonce
+	loc.ProxyCache = anns.ProxyCache
+	loc.BackendAlias = anns.BackendAlias
+	loc.AllowedMethods = anns.AllowedMethods
+	loc.URINormalizationPolicy = anns.URINormalizationPolicy
+	loc.TrailingSlash = anns.TrailingSlash
+	loc.UpstreamHostHeader = anns.UpstreamHostHeader
+	loc.UpstreamCompression = anns.UpstreamCompression
+	loc.GRPCHTTP1Fallback = anns.GRPCHTTP1Fallback
+	loc.AnonymizeClientIP = anns.AnonymizeClientIP
+	loc.OpenAPIValidation = anns.OpenAPIValidation
+	loc.SetVariables = anns.SetVariables
+	loc.Fallback = anns.Fallback
+	loc.GeoRouting = anns.GeoRouting
+	loc.RouteIf = anns.RouteIf
+	loc.GRPCMetadata = anns.GRPCMetadata
+	loc.BotDetection = anns.BotDetection
+	loc.MaxInflight = anns.MaxInflight
+	loc.AdaptiveConcurrency = anns.AdaptiveConcurrency
+	loc.Precompressed = anns.Precompressed
+	loc.PreloadLinks = anns.PreloadLinks
+	loc.RequestID = anns.RequestID
+	loc.AuthJWT = anns.AuthJWT
+	loc.EchoBackend = anns.EchoBackend
+	loc.StaticResponse = anns.StaticResponse
+	loc.EdgeFunction = anns.EdgeFunction
+	loc.BodyFilterSnippet = anns.BodyFilterSnippet
+	loc.Idempotency = anns.Idempotency
+	loc.AccessLogFields = anns.AccessLogFields
+	loc.UpstreamKeepalive = anns.UpstreamKeepalive
+	loc.NoEndpoints = anns.NoEndpoints
+	loc.PathPriority = anns.PathPriority
+	loc.MaxRequestDuration = anns.MaxRequestDuration
+	loc.AuthExcludePaths = anns.AuthExcludePaths
 
 	loc.DefaultBackendUpstreamName = defUpstreamName
 }
 
+// snippetOwner returns the ingress whose server snippet is the only one used
+// for a host, according to the server-snippet-merge-policy setting, or nil
+// when the snippets of the ingresses are merged. When at least one of the
+// ingresses is annotated with server-snippet-owner, the oldest owner is used.
+func snippetOwner(ings []*ingress.Ingress, policy string) *ingress.Ingress {
+	owners := []*ingress.Ingress{}
+	for _, ing := range ings {
+		if ing.ParsedAnnotations.ServerSnippetOwner {
+			owners = append(owners, ing)
+		}
+	}
+
+	merge := policy == ngx_config.ServerSnippetMergeByCreation || policy == ngx_config.ServerSnippetMergeByName
+	if len(owners) == 0 && merge {
+		return nil
+	}
+
+	candidates := ings
+	if len(owners) > 0 {
+		candidates = owners
+	}
+
+	sortIngressesByCreation(candidates)
+	return candidates[0]
+}
+
+// sortIngressesBySnippetPolicy sorts the ingresses with merged server
+// snippets according to the server-snippet-merge-policy setting
+func sortIngressesBySnippetPolicy(ings []*ingress.Ingress, policy string) {
+	if policy == ngx_config.ServerSnippetMergeByName {
+		sort.SliceStable(ings, func(i, j int) bool {
+			return k8s.MetaNamespaceKey(ings[i]) < k8s.MetaNamespaceKey(ings[j])
+		})
+	} else {
+		sortIngressesByCreation(ings)
+	}
+}
+
+// mergeServerSnippets returns the server-snippet of a host built from the
+// ingresses defining one, according to the server-snippet-merge-policy setting
+// and the server-snippet-owner annotation, see snippetOwner.
+func (n *NGINXController) mergeServerSnippets(host string, ings []*ingress.Ingress, policy string) string {
+	if owner := snippetOwner(ings, policy); owner != nil {
+		for _, ing := range ings {
+			if ing == owner {
+				continue
+			}
+
+			klog.Warningf("Server snippet already configured for server %q by Ingress %q, skipping (Ingress %q)",
+				host, k8s.MetaNamespaceKey(owner), k8s.MetaNamespaceKey(ing))
+			n.reportConflict(ing, "ServerSnippetConflict", host,
+				fmt.Sprintf("server-snippet for host %q ignored, it is already configured by Ingress %v", host, k8s.MetaNamespaceKey(owner)))
+		}
+
+		return owner.ParsedAnnotations.ServerSnippet
+	}
+
+	sortIngressesBySnippetPolicy(ings, policy)
+
+	snippets := make([]string, 0, len(ings))
+	for _, ing := range ings {
+		snippets = append(snippets, ing.ParsedAnnotations.ServerSnippet)
+	}
+
+	return strings.Join(snippets, "\n")
+}
+
+// mergeTopSnippets returns the snippets of the beginning of a server of the
+// ingresses defining one, with the owner and merge rules of the server
+// snippets, see snippetOwner. The merged snippets are sorted by the
+// snippet-order annotation and then according to the merge policy.
+func (n *NGINXController) mergeTopSnippets(host string, ings []*ingress.Ingress, policy string) string {
+	if owner := snippetOwner(ings, policy); owner != nil {
+		for _, ing := range ings {
+			if ing == owner {
+				continue
+			}
+
+			klog.Warningf("Server top snippet already configured for server %q by Ingress %q, skipping (Ingress %q)",
+				host, k8s.MetaNamespaceKey(owner), k8s.MetaNamespaceKey(ing))
+			n.reportConflict(ing, "ServerSnippetConflict", host,
+				fmt.Sprintf("snippet-server-top for host %q ignored, it is already configured by Ingress %v", host, k8s.MetaNamespaceKey(owner)))
+		}
+
+		return owner.ParsedAnnotations.SnippetPositions.ServerTop
+	}
+
+	sortIngressesBySnippetPolicy(ings, policy)
+	sort.SliceStable(ings, func(i, j int) bool {
+		return ings[i].ParsedAnnotations.SnippetPositions.Order < ings[j].ParsedAnnotations.SnippetPositions.Order
+	})
+
+	snippets := make([]string, 0, len(ings))
+	for _, ing := range ings {
+		snippets = append(snippets, ing.ParsedAnnotations.SnippetPositions.ServerTop)
+	}
+
+	return strings.Join(snippets, "\n")
+}
+
+// sortIngressesByCreation sorts ingresses by creation timestamp, using the
+// namespace and name to break ties
+func sortIngressesByCreation(ings []*ingress.Ingress) {
+	sort.SliceStable(ings, func(i, j int) bool {
+		ir := ings[i].CreationTimestamp
+		jr := ings[j].CreationTimestamp
+		if ir.Equal(&jr) {
+			return k8s.MetaNamespaceKey(ings[i]) < k8s.MetaNamespaceKey(ings[j])
+		}
+		return ir.Before(&jr)
+	})
+}
+
+func containsIngress(ings []*ingress.Ingress, ing *ingress.Ingress) bool {
+	for _, i := range ings {
+		if i == ing {
+			return true
+		}
+	}
+
+	return false
+}
+
+// changedIngresses returns the ingresses not present in the running
+// configuration with the same generation
+func changedIngresses(running *ingress.Configuration, ings []*ingress.Ingress) []*ingress.Ingress {
+	generations := map[string]int64{}
+	for _, server := range running.Servers {
+		for _, location := range server.Locations {
+			if location.Ingress != nil {
+				generations[k8s.MetaNamespaceKey(location.Ingress)] = location.Ingress.Generation
+			}
+		}
+	}
+
+	var changed []*ingress.Ingress
+	for _, ing := range ings {
+		generation, ok := generations[k8s.MetaNamespaceKey(ing)]
+		if !ok || generation != ing.Generation {
+			changed = append(changed, ing)
+		}
+	}
+
+	return changed
+}
+
+// recordIngressEvent emits an Event for the given ingress
+func (n *NGINXController) recordIngressEvent(ing *ingress.Ingress, eventType, reason, message string) {
+	if n.recorder == nil {
+		return
+	}
+
+	n.recorder.Event(&ing.Ingress, eventType, reason, message)
+}
+
 // OK to merge canary ingresses iff there exists one or more ingresses to potentially merge into
 func nonCanaryIngressExists(ingresses []*ingress.Ingress, canaryIngresses []*ingress.Ingress) bool {
 	return len(ingresses)-len(canaryIngresses) > 0
@@ -1332,8 +2317,8 @@ func mergeAlternativeBackends(ing *ingress.Ingress, upstreams map[string]*ingres
 	servers map[string]*ingress.Server) {
 
 	// merge catch-all alternative backends
-	if ing.Spec.Backend != nil {
-		upsName := upstreamName(ing.Namespace, ing.Spec.Backend.ServiceName, ing.Spec.Backend.ServicePort)
+	if ing.Spec.DefaultBackend != nil {
+		upsName := upstreamName(ing.Namespace, ing.Spec.DefaultBackend)
 
 		altUps := upstreams[upsName]
 
@@ -1370,7 +2355,7 @@ func mergeAlternativeBackends(ing *ingress.Ingress, upstreams map[string]*ingres
 
 	for _, rule := range ing.Spec.Rules {
 		for _, path := range rule.HTTP.Paths {
-			upsName := upstreamName(ing.Namespace, path.Backend.ServiceName, path.Backend.ServicePort)
+			upsName := upstreamName(ing.Namespace, &path.Backend)
 
 			altUps := upstreams[upsName]
 
@@ -1417,6 +2402,20 @@ func mergeAlternativeBackends(ing *ingress.Ingress, upstreams map[string]*ingres
 	}
 }
 
+// isTLSHost returns true if the host is listed in the TLS section of the Ingress
+func isTLSHost(host string, ing *ingress.Ingress) bool {
+	lowercaseHost := toLowerCaseASCII(host)
+	for _, tls := range ing.Spec.TLS {
+		for _, tlsHost := range tls.Hosts {
+			if toLowerCaseASCII(tlsHost) == lowercaseHost {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // extractTLSSecretName returns the name of the Secret containing a SSL
 // certificate for the given host name, or an empty string.
 func extractTLSSecretName(host string, ing *ingress.Ingress,
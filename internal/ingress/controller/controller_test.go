@@ -23,9 +23,11 @@ import (
 	"encoding/asn1"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -33,10 +35,11 @@ import (
 	"github.com/eapache/channels"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 
 	"k8s.io/ingress-nginx/internal/file"
 	"k8s.io/ingress-nginx/internal/ingress"
@@ -44,6 +47,9 @@ import (
 	"k8s.io/ingress-nginx/internal/ingress/annotations/canary"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/proxyssl"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/rewrite"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/serviceupstream"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/snippetpositions"
 	"k8s.io/ingress-nginx/internal/ingress/controller/config"
 	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
 	"k8s.io/ingress-nginx/internal/ingress/controller/store"
@@ -74,6 +80,10 @@ func (fakeIngressStore) GetService(key string) (*corev1.Service, error) {
 	return nil, fmt.Errorf("test error")
 }
 
+func (fakeIngressStore) GetServicePort(svc *corev1.Service, name string) (*corev1.ServicePort, error) {
+	return nil, fmt.Errorf("test error")
+}
+
 func (fakeIngressStore) GetServiceEndpoints(key string) (*corev1.Endpoints, error) {
 	return nil, fmt.Errorf("test error")
 }
@@ -90,6 +100,10 @@ func (fakeIngressStore) GetLocalSSLCert(name string) (*ingress.SSLCert, error) {
 	return nil, fmt.Errorf("test error")
 }
 
+func (fakeIngressStore) GetTLSHostSecret(host string) string {
+	return ""
+}
+
 func (fakeIngressStore) ListLocalSSLCerts() []*ingress.SSLCert {
 	return nil
 }
@@ -98,10 +112,18 @@ func (fakeIngressStore) GetAuthCertificate(string) (*resolver.AuthSSLCert, error
 	return nil, fmt.Errorf("test error")
 }
 
+func (fakeIngressStore) GetGlobalRateLimitPolicy(string) (*resolver.GlobalRateLimitPolicy, error) {
+	return nil, fmt.Errorf("test error")
+}
+
 func (fakeIngressStore) GetDefaultBackend() defaults.Backend {
 	return defaults.Backend{}
 }
 
+func (fakeIngressStore) SetConfigMapGate(func(map[string]string) map[string]string) {}
+
+func (fakeIngressStore) ApplyConfigMaps() {}
+
 func (fakeIngressStore) Run(stopCh chan struct{}) {}
 
 type testNginxTestCommand struct {
@@ -134,6 +156,10 @@ func (ntc testNginxTestCommand) Test(cfg string) ([]byte, error) {
 
 type fakeTemplate struct{}
 
+func (fakeTemplate) WriteTenant(conf config.TemplateConfig, tenant config.Tenant) ([]byte, error) {
+	return fakeTemplate{}.Write(config.TemplateConfig{Servers: tenant.Servers})
+}
+
 func (fakeTemplate) Write(conf config.TemplateConfig) ([]byte, error) {
 	r := []byte{}
 	for _, s := range conf.Servers {
@@ -232,6 +258,48 @@ func TestCheckIngress(t *testing.T) {
 			}
 		})
 
+		t.Run("When the ingress conflicts with another one", func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			nginx.recorder = recorder
+			defer func() {
+				nginx.recorder = nil
+				nginx.store = fakeIngressStore{
+					ingresses: []*ingress.Ingress{
+						{
+							Ingress:           *ing,
+							ParsedAnnotations: &annotations.Ingress{},
+						},
+					},
+				}
+				delete(ing.ObjectMeta.Annotations, "nginx.ingress.kubernetes.io/server-snippet")
+			}()
+
+			existing := ing.DeepCopy()
+			existing.Name = "existing-ingress"
+			nginx.store = fakeIngressStore{
+				ingresses: []*ingress.Ingress{
+					{
+						Ingress:           *existing,
+						ParsedAnnotations: &annotations.Ingress{ServerSnippet: "return 200;"},
+					},
+				},
+			}
+			ing.ObjectMeta.Annotations["nginx.ingress.kubernetes.io/server-snippet"] = "return 204;"
+			nginx.command = testNginxTestCommand{
+				t:        t,
+				err:      nil,
+				expected: "_,test.example.com",
+			}
+			if nginx.CheckIngress(ing) != nil {
+				t.Errorf("with a new ingress without error, no error should be returned")
+			}
+
+			// the ingress is not applied yet, the conflicts are recorded by the sync
+			if len(recorder.Events) != 0 {
+				t.Errorf("expected no event but got %v", <-recorder.Events)
+			}
+		})
+
 		t.Run("When nginx test returns an error", func(t *testing.T) {
 			nginx.command = testNginxTestCommand{
 				t:        t,
@@ -244,6 +312,32 @@ func TestCheckIngress(t *testing.T) {
 			}
 		})
 
+		t.Run("When the upstream-host-header annotation is invalid", func(t *testing.T) {
+			nginx.command = testNginxTestCommand{
+				t:        t,
+				err:      nil,
+				expected: "_,test.example.com",
+			}
+			ing.ObjectMeta.Annotations["nginx.ingress.kubernetes.io/upstream-host-header"] = "$http_x_host"
+			if nginx.CheckIngress(ing) == nil {
+				t.Errorf("with an invalid upstream-host-header annotation, an error should be returned")
+			}
+			delete(ing.ObjectMeta.Annotations, "nginx.ingress.kubernetes.io/upstream-host-header")
+		})
+
+		t.Run("When an integer annotation is malformed", func(t *testing.T) {
+			nginx.command = testNginxTestCommand{
+				t:        t,
+				err:      nil,
+				expected: "_,test.example.com",
+			}
+			ing.ObjectMeta.Annotations["nginx.ingress.kubernetes.io/limit-rps"] = "10r/s"
+			if nginx.CheckIngress(ing) == nil {
+				t.Errorf("with a malformed limit-rps annotation, an error should be returned")
+			}
+			delete(ing.ObjectMeta.Annotations, "nginx.ingress.kubernetes.io/limit-rps")
+		})
+
 		t.Run("When the default annotation prefix is used despite an override", func(t *testing.T) {
 			parser.AnnotationsPrefix = "ingress.kubernetes.io"
 			ing.ObjectMeta.Annotations["nginx.ingress.kubernetes.io/backend-protocol"] = "GRPC"
@@ -257,7 +351,7 @@ func TestCheckIngress(t *testing.T) {
 		})
 
 		t.Run("When a new catch-all ingress is being created despite catch-alls being disabled ", func(t *testing.T) {
-			backendBefore := ing.Spec.Backend
+			backendBefore := ing.Spec.DefaultBackend
 			disableCatchAllBefore := nginx.cfg.DisableCatchAll
 
 			nginx.command = testNginxTestCommand{
@@ -266,10 +360,12 @@ func TestCheckIngress(t *testing.T) {
 			}
 			nginx.cfg.DisableCatchAll = true
 
-			ing.Spec.Backend = &networking.IngressBackend{
-				ServiceName: "http-svc",
-				ServicePort: intstr.IntOrString{
-					IntVal: 80,
+			ing.Spec.DefaultBackend = &networking.IngressBackend{
+				Service: &networking.IngressServiceBackend{
+					Name: "http-svc",
+					Port: networking.ServiceBackendPort{
+						Number: 80,
+					},
 				},
 			}
 
@@ -278,7 +374,7 @@ func TestCheckIngress(t *testing.T) {
 			}
 
 			// reset backend and catch-all flag
-			ing.Spec.Backend = backendBefore
+			ing.Spec.DefaultBackend = backendBefore
 			nginx.cfg.DisableCatchAll = disableCatchAllBefore
 		})
 
@@ -296,6 +392,241 @@ func TestCheckIngress(t *testing.T) {
 	})
 }
 
+type fakeServiceStore struct {
+	fakeIngressStore
+	services map[string]*corev1.Service
+}
+
+func (fss fakeServiceStore) GetService(key string) (*corev1.Service, error) {
+	svc, ok := fss.services[key]
+	if !ok {
+		return nil, fmt.Errorf("service %v was not found", key)
+	}
+	return svc, nil
+}
+
+func (fss fakeServiceStore) GetServicePort(svc *corev1.Service, name string) (*corev1.ServicePort, error) {
+	key := k8s.MetaNamespaceKey(svc)
+
+	port, ok := store.NewServicePortMap().Lookup(key, svc, name)
+	if !ok {
+		return nil, fmt.Errorf("service %q does not have a port named %q", key, name)
+	}
+	return &port, nil
+}
+
+func TestCheckServicePortNames(t *testing.T) {
+	nginx := &NGINXController{
+		store: fakeServiceStore{
+			services: map[string]*corev1.Service{
+				"default/http-svc": {
+					Spec: corev1.ServiceSpec{
+						Ports: []corev1.ServicePort{
+							{Name: "http", Port: 80, TargetPort: intstr.FromString("web")},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		serviceName string
+		servicePort networking.ServiceBackendPort
+		expectErr   bool
+	}{
+		"port referenced by number": {"http-svc", networking.ServiceBackendPort{Number: 8080}, false},
+		"port referenced by name":   {"http-svc", networking.ServiceBackendPort{Name: "http"}, false},
+		"target port referenced":    {"http-svc", networking.ServiceBackendPort{Name: "web"}, false},
+		"port name not defined":     {"http-svc", networking.ServiceBackendPort{Name: "https"}, true},
+		"service not created yet":   {"echo-svc", networking.ServiceBackendPort{Name: "https"}, false},
+	}
+
+	for title, tc := range testCases {
+		t.Run(title, func(t *testing.T) {
+			ing := &networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-ingress",
+					Namespace: "default",
+				},
+				Spec: networking.IngressSpec{
+					Rules: []networking.IngressRule{
+						{
+							Host: "example.com",
+							IngressRuleValue: networking.IngressRuleValue{
+								HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{
+										{
+											Path: "/",
+											Backend: networking.IngressBackend{
+												Service: &networking.IngressServiceBackend{
+													Name: tc.serviceName,
+													Port: tc.servicePort,
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+
+			err := nginx.checkServicePortNames(ing)
+			if tc.expectErr && err == nil {
+				t.Errorf("expected an error but none returned")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetServiceClusterEndpoint(t *testing.T) {
+	nginx := &NGINXController{
+		store: fakeServiceStore{
+			services: map[string]*corev1.Service{
+				"default/http-svc": {
+					Spec: corev1.ServiceSpec{
+						ClusterIP: "10.0.0.10",
+						Ports: []corev1.ServicePort{
+							{Name: "http", Port: 80},
+							{Name: "admin", Port: 9090},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	backend := &networking.IngressBackend{
+		Service: &networking.IngressServiceBackend{
+			Name: "http-svc",
+			Port: networking.ServiceBackendPort{Name: "http"},
+		},
+	}
+
+	testCases := map[string]struct {
+		portOverride string
+		expPort      string
+		expectErr    bool
+	}{
+		"port of the backend":        {"", "80", false},
+		"port override by number":    {"9090", "9090", false},
+		"port override by name":      {"admin", "9090", false},
+		"port override not exposed":  {"8080", "", true},
+		"port override name unknown": {"metrics", "", true},
+	}
+
+	for title, tc := range testCases {
+		t.Run(title, func(t *testing.T) {
+			endpoint, err := nginx.getServiceClusterEndpoint("default/http-svc", backend, tc.portOverride)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if endpoint.Address != "10.0.0.10" || endpoint.Port != tc.expPort {
+				t.Errorf("expected 10.0.0.10:%v but got %v:%v", tc.expPort, endpoint.Address, endpoint.Port)
+			}
+		})
+	}
+}
+
+type fakeEndpointsStore struct {
+	fakeServiceStore
+	endpoints map[string]*corev1.Endpoints
+}
+
+func (fes fakeEndpointsStore) GetServiceEndpoints(key string) (*corev1.Endpoints, error) {
+	ep, ok := fes.endpoints[key]
+	if !ok {
+		return nil, fmt.Errorf("endpoints %v were not found", key)
+	}
+	return ep, nil
+}
+
+func TestServiceUpstreamMinReadyEndpoints(t *testing.T) {
+	nginx := &NGINXController{
+		store: fakeEndpointsStore{
+			fakeServiceStore: fakeServiceStore{
+				services: map[string]*corev1.Service{
+					"default/http-svc": {
+						ObjectMeta: metav1.ObjectMeta{Name: "http-svc", Namespace: "default"},
+						Spec: corev1.ServiceSpec{
+							ClusterIP: "10.0.0.10",
+							Ports: []corev1.ServicePort{
+								{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt(8080)},
+								{Name: "mesh", Port: 15001, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromInt(15001)},
+							},
+						},
+					},
+				},
+			},
+			endpoints: map[string]*corev1.Endpoints{
+				"default/http-svc": {
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{{IP: "10.1.0.1"}},
+							Ports:     []corev1.EndpointPort{{Name: "http", Port: 8080, Protocol: corev1.ProtocolTCP}},
+						},
+						{
+							Addresses: []corev1.EndpointAddress{{IP: "10.1.0.1"}, {IP: "10.1.0.2"}},
+							Ports:     []corev1.EndpointPort{{Name: "mesh", Port: 15001, Protocol: corev1.ProtocolTCP}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	backend := &networking.IngressBackend{
+		Service: &networking.IngressServiceBackend{
+			Name: "http-svc",
+			Port: networking.ServiceBackendPort{Name: "http"},
+		},
+	}
+
+	testCases := map[string]struct {
+		config       serviceupstream.Config
+		expEndpoints []ingress.Endpoint
+	}{
+		"enough ready endpoints of the port": {
+			serviceupstream.Config{Enabled: true, MinReadyEndpoints: 1},
+			[]ingress.Endpoint{{Address: "10.0.0.10", Port: "80"}},
+		},
+		"not enough ready endpoints of the port": {
+			serviceupstream.Config{Enabled: true, MinReadyEndpoints: 2},
+			[]ingress.Endpoint{},
+		},
+		"enough ready endpoints of the port override": {
+			serviceupstream.Config{Enabled: true, Port: "mesh", MinReadyEndpoints: 2},
+			[]ingress.Endpoint{{Address: "10.0.0.10", Port: "15001"}},
+		},
+	}
+
+	for title, tc := range testCases {
+		t.Run(title, func(t *testing.T) {
+			ing := &ingress.Ingress{}
+			ing.ParsedAnnotations = &annotations.Ingress{ServiceUpstream: tc.config}
+
+			endpoints, ok := nginx.serviceUpstreamEndpoints(ing, "default/http-svc", backend)
+			if !ok {
+				t.Fatalf("expected the endpoints of the service-upstream mode")
+			}
+			if !reflect.DeepEqual(endpoints, tc.expEndpoints) {
+				t.Errorf("expected %v but got %v", tc.expEndpoints, endpoints)
+			}
+		})
+	}
+}
+
 func TestMergeAlternativeBackends(t *testing.T) {
 	testCases := map[string]struct {
 		ingress      *ingress.Ingress
@@ -321,10 +652,11 @@ func TestMergeAlternativeBackends(t *testing.T) {
 												Path:     "/",
 												PathType: &pathTypePrefix,
 												Backend: networking.IngressBackend{
-													ServiceName: "http-svc-canary",
-													ServicePort: intstr.IntOrString{
-														Type:   intstr.Int,
-														IntVal: 80,
+													Service: &networking.IngressServiceBackend{
+														Name: "http-svc-canary",
+														Port: networking.ServiceBackendPort{
+															Number: 80,
+														},
 													},
 												},
 											},
@@ -405,10 +737,11 @@ func TestMergeAlternativeBackends(t *testing.T) {
 												Path:     "/",
 												PathType: &pathTypePrefix,
 												Backend: networking.IngressBackend{
-													ServiceName: "foo-http-svc-canary",
-													ServicePort: intstr.IntOrString{
-														Type:   intstr.Int,
-														IntVal: 80,
+													Service: &networking.IngressServiceBackend{
+														Name: "foo-http-svc-canary",
+														Port: networking.ServiceBackendPort{
+															Number: 80,
+														},
 													},
 												},
 											},
@@ -425,10 +758,11 @@ func TestMergeAlternativeBackends(t *testing.T) {
 												Path:     "/",
 												PathType: &pathTypePrefix,
 												Backend: networking.IngressBackend{
-													ServiceName: "http-svc-canary",
-													ServicePort: intstr.IntOrString{
-														Type:   intstr.Int,
-														IntVal: 80,
+													Service: &networking.IngressServiceBackend{
+														Name: "http-svc-canary",
+														Port: networking.ServiceBackendPort{
+															Number: 80,
+														},
 													},
 												},
 											},
@@ -543,10 +877,11 @@ func TestMergeAlternativeBackends(t *testing.T) {
 												Path:     "/",
 												PathType: &pathTypePrefix,
 												Backend: networking.IngressBackend{
-													ServiceName: "http-svc-canary",
-													ServicePort: intstr.IntOrString{
-														Type:   intstr.Int,
-														IntVal: 80,
+													Service: &networking.IngressServiceBackend{
+														Name: "http-svc-canary",
+														Port: networking.ServiceBackendPort{
+															Number: 80,
+														},
 													},
 												},
 											},
@@ -578,10 +913,12 @@ func TestMergeAlternativeBackends(t *testing.T) {
 						Namespace: "example",
 					},
 					Spec: networking.IngressSpec{
-						Backend: &networking.IngressBackend{
-							ServiceName: "http-svc-canary",
-							ServicePort: intstr.IntOrString{
-								IntVal: 80,
+						DefaultBackend: &networking.IngressBackend{
+							Service: &networking.IngressServiceBackend{
+								Name: "http-svc-canary",
+								Port: networking.ServiceBackendPort{
+									Number: 80,
+								},
 							},
 						},
 					},
@@ -646,10 +983,12 @@ func TestMergeAlternativeBackends(t *testing.T) {
 						Namespace: "example",
 					},
 					Spec: networking.IngressSpec{
-						Backend: &networking.IngressBackend{
-							ServiceName: "http-svc-canary",
-							ServicePort: intstr.IntOrString{
-								IntVal: 80,
+						DefaultBackend: &networking.IngressBackend{
+							Service: &networking.IngressServiceBackend{
+								Name: "http-svc-canary",
+								Port: networking.ServiceBackendPort{
+									Number: 80,
+								},
 							},
 						},
 					},
@@ -909,10 +1248,12 @@ func TestGetBackendServers(t *testing.T) {
 							Namespace: "example",
 						},
 						Spec: networking.IngressSpec{
-							Backend: &networking.IngressBackend{
-								ServiceName: "http-svc-canary",
-								ServicePort: intstr.IntOrString{
-									IntVal: 80,
+							DefaultBackend: &networking.IngressBackend{
+								Service: &networking.IngressServiceBackend{
+									Name: "http-svc-canary",
+									Port: networking.ServiceBackendPort{
+										Number: 80,
+									},
 								},
 							},
 						},
@@ -952,10 +1293,12 @@ func TestGetBackendServers(t *testing.T) {
 							Namespace: "example",
 						},
 						Spec: networking.IngressSpec{
-							Backend: &networking.IngressBackend{
-								ServiceName: "http-svc-canary",
-								ServicePort: intstr.IntOrString{
-									IntVal: 80,
+							DefaultBackend: &networking.IngressBackend{
+								Service: &networking.IngressServiceBackend{
+									Name: "http-svc-canary",
+									Port: networking.ServiceBackendPort{
+										Number: 80,
+									},
 								},
 							},
 						},
@@ -972,10 +1315,12 @@ func TestGetBackendServers(t *testing.T) {
 							Namespace: "example",
 						},
 						Spec: networking.IngressSpec{
-							Backend: &networking.IngressBackend{
-								ServiceName: "http-svc",
-								ServicePort: intstr.IntOrString{
-									IntVal: 80,
+							DefaultBackend: &networking.IngressBackend{
+								Service: &networking.IngressServiceBackend{
+									Name: "http-svc",
+									Port: networking.ServiceBackendPort{
+										Number: 80,
+									},
 								},
 							},
 						},
@@ -1025,10 +1370,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc-canary",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc-canary",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1085,10 +1431,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1122,10 +1469,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc-canary",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc-canary",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1191,10 +1539,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/a",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc-1",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc-1",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1228,10 +1577,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/a",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc-2",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc-2",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1265,10 +1615,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/b",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc-2",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc-2",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1302,10 +1653,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/b",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc-1",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc-1",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1339,10 +1691,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/c",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc-1",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc-1",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1376,10 +1729,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/c",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "http-svc-2",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "http-svc-2",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1461,10 +1815,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/path1",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "path1-svc",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "path1-svc",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1501,10 +1856,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/path2",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "path2-svc",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "path2-svc",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1566,10 +1922,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/path1",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "path1-svc",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "path1-svc",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1606,10 +1963,11 @@ func TestGetBackendServers(t *testing.T) {
 													Path:     "/path2",
 													PathType: &pathTypePrefix,
 													Backend: networking.IngressBackend{
-														ServiceName: "path2-svc",
-														ServicePort: intstr.IntOrString{
-															Type:   intstr.Int,
-															IntVal: 80,
+														Service: &networking.IngressServiceBackend{
+															Name: "path2-svc",
+															Port: networking.ServiceBackendPort{
+																Number: 80,
+															},
 														},
 													},
 												},
@@ -1671,6 +2029,121 @@ func TestGetBackendServers(t *testing.T) {
 	}
 }
 
+func TestGetBackendServersPathPriority(t *testing.T) {
+	buildIngress := func(name, path string, priority int) *ingress.Ingress {
+		return &ingress.Ingress{
+			Ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "example",
+				},
+				Spec: networking.IngressSpec{
+					Rules: []networking.IngressRule{
+						{
+							Host: "example.com",
+							IngressRuleValue: networking.IngressRuleValue{
+								HTTP: &networking.HTTPIngressRuleValue{
+									Paths: []networking.HTTPIngressPath{
+										{
+											Path:     path,
+											PathType: &pathTypePrefix,
+											Backend: networking.IngressBackend{
+												Service: &networking.IngressServiceBackend{
+													Name: name,
+													Port: networking.ServiceBackendPort{
+														Number: 80,
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			ParsedAnnotations: &annotations.Ingress{
+				Rewrite:      rewrite.Config{UseRegex: true},
+				PathPriority: priority,
+			},
+		}
+	}
+
+	ingresses := []*ingress.Ingress{
+		buildIngress("users", "/api/v1/users", 0),
+		buildIngress("catch-all", "/api/.*", 10),
+		buildIngress("legacy", "/api/v1/legacy/.*", -1),
+	}
+
+	nginxController := newDynamicNginxController(t, testConfigMap)
+	_, servers := nginxController.getBackendServers(ingresses)
+
+	var paths []string
+	for _, server := range servers {
+		if server.Hostname != "example.com" {
+			continue
+		}
+
+		for _, location := range server.Locations {
+			paths = append(paths, location.Path)
+		}
+	}
+
+	expected := []string{"/api/.*", "/api/v1/users", "/", "/api/v1/legacy/.*"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected the locations %v but got %v", expected, paths)
+	}
+}
+
+func TestReportPathPriorityConflicts(t *testing.T) {
+	buildLocation := func(name, path string) *ingress.Location {
+		return &ingress.Location{
+			Path:         path,
+			PathPriority: 10,
+			Ingress: &ingress.Ingress{
+				Ingress: networking.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "example"}},
+			},
+		}
+	}
+
+	server := &ingress.Server{
+		Hostname: "example.com",
+		Locations: []*ingress.Location{
+			buildLocation("catch-all", "/api/.*"),
+			buildLocation("users", "/api/v1/users/.*"),
+			buildLocation("orders", "/api/v1/orders/.*"),
+		},
+	}
+
+	conflicts := findPathPriorityConflicts(server)
+	if len(conflicts) != 2 || conflicts[0].path != "/api/v1/users/.*" || conflicts[1].path != "/api/v1/orders/.*" {
+		t.Fatalf("expected the conflicts of the users and orders paths but got %v", conflicts)
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	n := &NGINXController{recorder: recorder}
+
+	n.reportPathPriorityConflicts(conflicts)
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected 2 events but got %v", len(recorder.Events))
+	}
+
+	// the conflicts already reported by the previous sync are not recorded again
+	<-recorder.Events
+	<-recorder.Events
+	n.reportPathPriorityConflicts(conflicts)
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event but got %v", <-recorder.Events)
+	}
+
+	n.reportPathPriorityConflicts(nil)
+	n.reportPathPriorityConflicts(conflicts[:1])
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected an event for the conflict reported again but got %v", len(recorder.Events))
+	}
+}
+
 func testConfigMap(ns string) *v1.ConfigMap {
 	return &v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
@@ -1710,11 +2183,13 @@ func newNGINXController(t *testing.T) *NGINXController {
 	storer := store.New(
 		ns,
 		fmt.Sprintf("%v/config", ns),
+		nil,
 		fmt.Sprintf("%v/tcp", ns),
 		fmt.Sprintf("%v/udp", ns),
 		"",
 		10*time.Minute,
 		clientSet,
+		nil,
 		channels.NewRingChannel(10),
 		false)
 
@@ -1768,11 +2243,13 @@ func newDynamicNginxController(t *testing.T, setConfigMap func(string) *v1.Confi
 	storer := store.New(
 		ns,
 		fmt.Sprintf("%v/config", ns),
+		nil,
 		fmt.Sprintf("%v/tcp", ns),
 		fmt.Sprintf("%v/udp", ns),
 		"",
 		10*time.Minute,
 		clientSet,
+		nil,
 		channels.NewRingChannel(10),
 		false)
 
@@ -1790,3 +2267,253 @@ func newDynamicNginxController(t *testing.T, setConfigMap func(string) *v1.Confi
 		command: NewNginxCommand(),
 	}
 }
+
+func TestMergeServerSnippets(t *testing.T) {
+	newIngress := func(name string, created int64, snippet string, owner bool) *ingress.Ingress {
+		return &ingress.Ingress{
+			Ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					Namespace:         "default",
+					CreationTimestamp: metav1.NewTime(time.Unix(created, 0)),
+				},
+			},
+			ParsedAnnotations: &annotations.Ingress{
+				ServerSnippet:      snippet,
+				ServerSnippetOwner: owner,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		ings     []*ingress.Ingress
+		policy   string
+		expected string
+	}{
+		{
+			"first uses the oldest ingress",
+			[]*ingress.Ingress{newIngress("b", 2, "b;", false), newIngress("a", 1, "a;", false)},
+			ngx_config.ServerSnippetMergeFirst,
+			"a;",
+		},
+		{
+			"unknown policies behave like first",
+			[]*ingress.Ingress{newIngress("b", 2, "b;", false), newIngress("a", 1, "a;", false)},
+			"invalid",
+			"a;",
+		},
+		{
+			"merge by creation timestamp",
+			[]*ingress.Ingress{newIngress("a", 2, "a;", false), newIngress("b", 1, "b;", false)},
+			ngx_config.ServerSnippetMergeByCreation,
+			"b;\na;",
+		},
+		{
+			"merge by name",
+			[]*ingress.Ingress{newIngress("b", 1, "b;", false), newIngress("a", 2, "a;", false)},
+			ngx_config.ServerSnippetMergeByName,
+			"a;\nb;",
+		},
+		{
+			"owner takes precedence over the merge policy",
+			[]*ingress.Ingress{newIngress("a", 1, "a;", false), newIngress("b", 2, "b;", true), newIngress("c", 3, "c;", true)},
+			ngx_config.ServerSnippetMergeByName,
+			"b;",
+		},
+	}
+
+	n := &NGINXController{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snippet := n.mergeServerSnippets("example.com", tc.ings, tc.policy)
+			if snippet != tc.expected {
+				t.Errorf("expected %q but returned %q", tc.expected, snippet)
+			}
+		})
+	}
+}
+
+func TestMergeTopSnippets(t *testing.T) {
+	newIngress := func(namespace, name string, created int64, order int, snippet string, owner bool) *ingress.Ingress {
+		return &ingress.Ingress{
+			Ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					Namespace:         namespace,
+					CreationTimestamp: metav1.NewTime(time.Unix(created, 0)),
+				},
+			},
+			ParsedAnnotations: &annotations.Ingress{
+				ServerSnippetOwner: owner,
+				SnippetPositions: snippetpositions.Config{
+					ServerTop: snippet,
+					Order:     order,
+				},
+			},
+		}
+	}
+
+	ings := func(owner bool) []*ingress.Ingress {
+		return []*ingress.Ingress{
+			newIngress("team-b", "app", 1, 0, "b;", false),
+			newIngress("team-a", "app", 2, 0, "a;", false),
+			newIngress("team-c", "app", 3, 10, "c;", owner),
+			newIngress("platform", "security", 4, -10, "platform;", false),
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		ings     []*ingress.Ingress
+		policy   string
+		expected string
+	}{
+		{"first uses the oldest ingress", ings(false), ngx_config.ServerSnippetMergeFirst, "b;"},
+		{"merge by name", ings(false), ngx_config.ServerSnippetMergeByName, "platform;\na;\nb;\nc;"},
+		{"merge by creation timestamp", ings(false), ngx_config.ServerSnippetMergeByCreation, "platform;\nb;\na;\nc;"},
+		{"owner takes precedence over the merge policy", ings(true), ngx_config.ServerSnippetMergeByName, "c;"},
+	}
+
+	n := &NGINXController{}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if snippet := n.mergeTopSnippets("example.com", tc.ings, tc.policy); snippet != tc.expected {
+				t.Errorf("expected %q but returned %q", tc.expected, snippet)
+			}
+		})
+	}
+}
+
+func TestAddTelemetryTags(t *testing.T) {
+	ing := &ingress.Ingress{
+		Ingress: networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "example",
+				Namespace: "default",
+				Labels:    map[string]string{"team": "payments", "app.kubernetes.io/name": "checkout"},
+			},
+		},
+	}
+
+	labels := map[string]string{"team": "team", "app.kubernetes.io/name": "service", "tier": "tier"}
+
+	location := &ingress.Location{Ingress: ing}
+	location.Opentracing.Tags = map[string]string{"service": "checkout-api"}
+	addTelemetryTags(location, labels)
+
+	expected := map[string]string{"team": "payments", "service": "checkout-api"}
+	if !reflect.DeepEqual(location.Opentracing.Tags, expected) {
+		t.Errorf("expected tags %v but got %v", expected, location.Opentracing.Tags)
+	}
+
+	location = &ingress.Location{}
+	addTelemetryTags(location, labels)
+	if location.Opentracing.Tags != nil {
+		t.Errorf("expected no tags but got %v", location.Opentracing.Tags)
+	}
+}
+
+func TestSortLocations(t *testing.T) {
+	exact := pathTypeExact
+	prefix := pathTypePrefix
+	location := func(path string, pathType *networking.PathType, priority int, name string) *ingress.Location {
+		return &ingress.Location{
+			Path:         path,
+			PathType:     pathType,
+			PathPriority: priority,
+			Ingress: &ingress.Ingress{
+				Ingress: networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}},
+			},
+		}
+	}
+
+	locations := []*ingress.Location{
+		location("/", &prefix, 0, "root"),
+		location("/api", &prefix, 0, "api"),
+		location("/api", &exact, 0, "api-exact"),
+		location("/web", &prefix, 0, "web"),
+		location("/static", &prefix, 0, "static"),
+		location("/a", &prefix, 10, "priority"),
+	}
+
+	expected := []string{"priority", "static", "web", "api-exact", "api", "root"}
+	for i := 0; i < 10; i++ {
+		shuffled := make([]*ingress.Location, len(locations))
+		for j, k := range rand.Perm(len(locations)) {
+			shuffled[j] = locations[k]
+		}
+		sortLocations(shuffled)
+
+		var names []string
+		for _, l := range shuffled {
+			names = append(names, l.Ingress.Name)
+		}
+
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("expected %v but returned %v", expected, names)
+		}
+	}
+}
+
+func TestChangedIngresses(t *testing.T) {
+	newIngress := func(name string, generation int64) *ingress.Ingress {
+		return &ingress.Ingress{
+			Ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       name,
+					Namespace:  "default",
+					Generation: generation,
+				},
+			},
+		}
+	}
+
+	running := &ingress.Configuration{
+		Servers: []*ingress.Server{
+			{
+				Hostname: "example.com",
+				Locations: []*ingress.Location{
+					{Path: "/", Ingress: newIngress("same", 1)},
+					{Path: "/updated", Ingress: newIngress("updated", 1)},
+					{Path: "/default-backend"},
+				},
+			},
+		},
+	}
+
+	ings := []*ingress.Ingress{newIngress("same", 1), newIngress("updated", 2), newIngress("new", 1)}
+
+	var names []string
+	for _, ing := range changedIngresses(running, ings) {
+		names = append(names, ing.Name)
+	}
+
+	expected := []string{"updated", "new"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v but returned %v", expected, names)
+	}
+}
+
+func TestParseStreamProxyProtocol(t *testing.T) {
+	testCases := []struct {
+		fields   []string
+		expected ingress.ProxyProtocol
+	}{
+		{[]string{""}, ingress.ProxyProtocol{}},
+		{[]string{"PROXY"}, ingress.ProxyProtocol{Decode: true}},
+		{[]string{"", "proxy"}, ingress.ProxyProtocol{Encode: true, EncodeVersion: 1}},
+		{[]string{"PROXY", "PROXY"}, ingress.ProxyProtocol{Decode: true, Encode: true, EncodeVersion: 1}},
+		{[]string{"PROXY", "PROXY_V2"}, ingress.ProxyProtocol{Decode: true, Encode: true, EncodeVersion: 2}},
+		{[]string{"PROXY", "PROXY_V2_TLV"}, ingress.ProxyProtocol{Decode: true, Encode: true, EncodeVersion: 2, EncodeTLVs: true}},
+		{[]string{"PROXY", "PROXY_V3"}, ingress.ProxyProtocol{Decode: true}},
+		{[]string{"PROXY", "PROXY", "PROXY"}, ingress.ProxyProtocol{Decode: true}},
+	}
+
+	for _, tc := range testCases {
+		pp := parseStreamProxyProtocol(tc.fields)
+		if pp != tc.expected {
+			t.Errorf("%v: expected %+v but returned %+v", tc.fields, tc.expected, pp)
+		}
+	}
+}
@@ -19,6 +19,7 @@ package controller
 import (
 	"fmt"
 	"net"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
@@ -29,6 +30,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/addressfamily"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/customendpoints"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/ingress-nginx/internal/k8s"
 )
 
@@ -119,3 +123,98 @@ func getEndpoints(s *corev1.Service, port *corev1.ServicePort, proto corev1.Prot
 	klog.V(3).Infof("Endpoints found for Service %q: %v", svcKey, upsServers)
 	return upsServers
 }
+
+// filterEndpointsByAddressFamily returns the endpoints matching the given address family.
+// Endpoints without an IP address (like ExternalName services) are always kept.
+func filterEndpointsByAddressFamily(endpoints []ingress.Endpoint, family string) []ingress.Endpoint {
+	var wantIPv6 bool
+	switch family {
+	case addressfamily.IPv4, addressfamily.PreferIPv4:
+		wantIPv6 = false
+	case addressfamily.IPv6, addressfamily.PreferIPv6:
+		wantIPv6 = true
+	default:
+		return endpoints
+	}
+
+	filtered := []ingress.Endpoint{}
+	matches := 0
+	for _, ep := range endpoints {
+		ip := net.ParseIP(ep.Address)
+		if ip == nil {
+			filtered = append(filtered, ep)
+			continue
+		}
+
+		if (ip.To4() == nil) == wantIPv6 {
+			filtered = append(filtered, ep)
+			matches++
+		}
+	}
+
+	if matches == 0 && (family == addressfamily.PreferIPv4 || family == addressfamily.PreferIPv6) {
+		return endpoints
+	}
+
+	return filtered
+}
+
+// customEndpoints returns the endpoints of the annotation custom-endpoints,
+// used instead of the endpoints of the service
+func customEndpoints(endpoints []customendpoints.Endpoint) []ingress.Endpoint {
+	upsServers := make([]ingress.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		upsServers = append(upsServers, ingress.Endpoint{
+			Address: ep.Address,
+			Port:    ep.Port,
+		})
+	}
+
+	return upsServers
+}
+
+// unixSocketAnnotation is the annotation of the services proxied to a Unix
+// domain socket of the node, like the one of PHP-FPM, mounted in the pod
+const unixSocketAnnotation = "unix-socket"
+
+// unixSocketPath returns the path of the Unix domain socket of a service, or
+// an empty string when the service does not use one. The socket must be in
+// one of the directories dirs.
+func unixSocketPath(s *corev1.Service, dirs []string) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+
+	path, ok := s.Annotations[parser.GetAnnotationWithPrefix(unixSocketAnnotation)]
+	if !ok {
+		return "", nil
+	}
+
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("the Unix socket backends are disabled, no directory is set in unix-socket-backend-dirs")
+	}
+
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+		return "", fmt.Errorf("%q is not a clean absolute path", path)
+	}
+
+	if strings.ContainsAny(path, " \t\n;{}'\"$") {
+		return "", fmt.Errorf("%q contains invalid characters", path)
+	}
+
+	for _, dir := range dirs {
+		if strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/") {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("%q is not in one of the directories %v", path, strings.Join(dirs, ", "))
+}
+
+// unixSocketEndpoint returns the endpoint of a backend proxied to a Unix
+// domain socket, so the backend is not considered without endpoints
+func unixSocketEndpoint(path string) ingress.Endpoint {
+	return ingress.Endpoint{
+		Address: "unix:" + path,
+	}
+}
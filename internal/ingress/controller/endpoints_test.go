@@ -18,11 +18,15 @@ package controller
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/customendpoints"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 )
 
 func TestGetEndpoints(t *testing.T) {
@@ -469,3 +473,100 @@ func TestGetEndpoints(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterEndpointsByAddressFamily(t *testing.T) {
+	v4 := ingress.Endpoint{Address: "10.0.0.1", Port: "8080"}
+	v6 := ingress.Endpoint{Address: "fd00::1", Port: "8080"}
+	name := ingress.Endpoint{Address: "example.com", Port: "80"}
+
+	tests := []struct {
+		name      string
+		endpoints []ingress.Endpoint
+		family    string
+		result    []ingress.Endpoint
+	}{
+		{"any should return all the endpoints", []ingress.Endpoint{v4, v6}, "any", []ingress.Endpoint{v4, v6}},
+		{"empty should return all the endpoints", []ingress.Endpoint{v4, v6}, "", []ingress.Endpoint{v4, v6}},
+		{"ipv4 should only return IPv4 endpoints", []ingress.Endpoint{v4, v6}, "ipv4", []ingress.Endpoint{v4}},
+		{"ipv6 should only return IPv6 endpoints", []ingress.Endpoint{v4, v6}, "ipv6", []ingress.Endpoint{v6}},
+		{"ipv6 without IPv6 endpoints should return 0 endpoints", []ingress.Endpoint{v4}, "ipv6", []ingress.Endpoint{}},
+		{"prefer-ipv6 should return IPv6 endpoints", []ingress.Endpoint{v4, v6}, "prefer-ipv6", []ingress.Endpoint{v6}},
+		{"prefer-ipv6 without IPv6 endpoints should return all the endpoints", []ingress.Endpoint{v4}, "prefer-ipv6", []ingress.Endpoint{v4}},
+		{"prefer-ipv4 without IPv4 endpoints should return all the endpoints", []ingress.Endpoint{v6}, "prefer-ipv4", []ingress.Endpoint{v6}},
+		{"endpoints without IP address should be kept", []ingress.Endpoint{name, v4}, "ipv6", []ingress.Endpoint{name}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			result := filterEndpointsByAddressFamily(testCase.endpoints, testCase.family)
+			if len(testCase.result) != len(result) {
+				t.Fatalf("Expected %d Endpoints but got %d", len(testCase.result), len(result))
+			}
+
+			for i := range testCase.result {
+				if !testCase.result[i].Equal(&result[i]) {
+					t.Errorf("Expected %v but got %v", testCase.result[i], result[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCustomEndpoints(t *testing.T) {
+	endpoints := customEndpoints([]customendpoints.Endpoint{
+		{Address: "10.0.0.1", Port: "8080"},
+		{Address: "fd00::1", Port: "80"},
+	})
+
+	expected := []ingress.Endpoint{
+		{Address: "10.0.0.1", Port: "8080"},
+		{Address: "fd00::1", Port: "80"},
+	}
+	if !reflect.DeepEqual(endpoints, expected) {
+		t.Errorf("Expected %v but got %v", expected, endpoints)
+	}
+}
+
+func TestUnixSocketPath(t *testing.T) {
+	annotation := parser.GetAnnotationWithPrefix("unix-socket")
+	dirs := []string{"/var/run/php", "/run/agent/"}
+
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		dirs        []string
+		path        string
+		expectErr   bool
+	}{
+		{"without annotation", map[string]string{}, dirs, "", false},
+		{"socket", map[string]string{annotation: "/var/run/php/php-fpm.sock"}, dirs, "/var/run/php/php-fpm.sock", false},
+		{"socket of directory with trailing slash", map[string]string{annotation: "/run/agent/agent.sock"}, dirs, "/run/agent/agent.sock", false},
+		{"disabled", map[string]string{annotation: "/var/run/php/php-fpm.sock"}, nil, "", true},
+		{"relative path", map[string]string{annotation: "php/php-fpm.sock"}, dirs, "", true},
+		{"path leaving the directory", map[string]string{annotation: "/var/run/php/../../../tmp/nginx.sock"}, dirs, "", true},
+		{"directory with the same prefix", map[string]string{annotation: "/var/run/php-other/php-fpm.sock"}, dirs, "", true},
+		{"directory itself", map[string]string{annotation: "/var/run/php"}, dirs, "", true},
+		{"invalid characters", map[string]string{annotation: "/var/run/php/fpm.sock; return 200"}, dirs, "", true},
+	}
+
+	for _, tc := range testCases {
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "php",
+				Namespace:   "default",
+				Annotations: tc.annotations,
+			},
+		}
+
+		path, err := unixSocketPath(svc, tc.dirs)
+		if tc.expectErr && err == nil {
+			t.Errorf("%v: expected an error", tc.name)
+		}
+		if !tc.expectErr && err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.name, err)
+		}
+		if path != tc.path {
+			t.Errorf("%v: expected %q but got %q", tc.name, tc.path, path)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/ingress/status"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+const (
+	// GlobalRateLimitSyncPath is the path of the endpoint receiving the
+	// requests of the global rate limits counted by the other pods of the
+	// controller, with the local-sync mode
+	GlobalRateLimitSyncPath = "/global-rate-limit/deltas"
+
+	// globalRateLimitPeersInterval is the interval of the discovery of the
+	// other pods of the controller
+	globalRateLimitPeersInterval = 30 * time.Second
+
+	// globalRateLimitMaxBodySize is the maximum size of the deltas received
+	// from a pod
+	globalRateLimitMaxBodySize = 16 << 20
+
+	// globalRateLimitRedisPasswordKey is the key of the Secret with the
+	// password of Redis
+	globalRateLimitRedisPasswordKey = "password"
+
+	// globalRateLimitKeyHashSecretKey is the key of the Secret with the key
+	// of the HMAC of the global-rate-limit-key-hash annotation
+	globalRateLimitKeyHashSecretKey = "secret"
+	// minGlobalRateLimitKeyHashSecretLength is the minimum length of the key
+	// of the HMAC
+	minGlobalRateLimitKeyHashSecretLength = 32
+)
+
+// globalRateLimitKeyHashSecret is the key of the HMAC of the keys of the
+// global rate limits when the global-rate-limit-key-hash-secret setting is
+// not defined. Each pod of the controller generates a different key, so the
+// requests are counted by pod in the store
+var globalRateLimitKeyHashSecret = newBotDetectionSecret()
+
+// globalRateLimitDelta is the number of requests of a counter of a global
+// rate limit, with the remaining time to live of the counter in seconds
+type globalRateLimitDelta struct {
+	Count int64   `json:"count"`
+	TTL   float64 `json:"ttl"`
+}
+
+// globalRateLimitDeltas contains the requests counted by a pod since the
+// previous replication, by counter
+type globalRateLimitDeltas struct {
+	// Sent is the time the deltas were sent, in milliseconds since the epoch
+	Sent     int64                           `json:"sent"`
+	Counters map[string]globalRateLimitDelta `json:"counters"`
+}
+
+// globalRateLimitPeers contains the addresses of the other Running and
+// Ready pods of the controller, refreshed periodically
+type globalRateLimitPeers struct {
+	mu        sync.Mutex
+	client    clientset.Interface
+	addresses []string
+	refreshed time.Time
+}
+
+// get returns the addresses of the peers, listing the pods of the
+// controller again when the list is too old
+func (p *globalRateLimitPeers) get() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.refreshed) < globalRateLimitPeersInterval {
+		return p.addresses
+	}
+
+	pods, err := status.RunningPods(p.client)
+	if err != nil {
+		klog.ErrorS(err, "Error listing the pods of the controller for the global rate limits")
+		return p.addresses
+	}
+
+	self := ""
+	if k8s.IngressPodDetails != nil {
+		self = k8s.IngressPodDetails.Name
+	}
+
+	p.addresses = peerAddresses(pods, self)
+	p.refreshed = time.Now()
+
+	return p.addresses
+}
+
+// contains returns true when the address is the one of a peer
+func (p *globalRateLimitPeers) contains(address string) bool {
+	for _, peer := range p.get() {
+		if peer == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// peerAddresses returns the IP addresses of the pods, except the one named self
+func peerAddresses(pods []apiv1.Pod, self string) []string {
+	addresses := []string{}
+	for _, pod := range pods {
+		if pod.Name == self || pod.Status.PodIP == "" {
+			continue
+		}
+
+		addresses = append(addresses, pod.Status.PodIP)
+	}
+
+	return addresses
+}
+
+// getGlobalRateLimitRedisPassword returns the password of the Secret
+// configured in the global-rate-limit-redis-password-secret setting, empty
+// when no AUTH command has to be sent to Redis
+func (n *NGINXController) getGlobalRateLimitRedisPassword() string {
+	key := n.store.GetBackendConfiguration().GlobalRateLimitRedisPasswordSecret
+	if key == "" {
+		return ""
+	}
+
+	secret, err := n.store.GetSecret(key)
+	if err != nil {
+		klog.Warningf("Error getting the Redis password Secret %q: %v", key, err)
+		return ""
+	}
+
+	data, ok := secret.Data[globalRateLimitRedisPasswordKey]
+	if !ok || len(data) == 0 {
+		klog.Warningf("Redis password Secret %q does not contain the key %q", key, globalRateLimitRedisPasswordKey)
+		return ""
+	}
+
+	return string(data)
+}
+
+// getGlobalRateLimitKeyHashSecret returns the key of the Secret configured
+// in the global-rate-limit-key-hash-secret setting, or the key generated by
+// the controller
+func (n *NGINXController) getGlobalRateLimitKeyHashSecret() string {
+	key := n.store.GetBackendConfiguration().GlobalRateLimitKeyHashSecret
+	if key == "" {
+		return globalRateLimitKeyHashSecret
+	}
+
+	secret, err := n.store.GetSecret(key)
+	if err != nil {
+		klog.Warningf("Error getting the global rate limit key hash Secret %q, using a generated key: %v", key, err)
+		return globalRateLimitKeyHashSecret
+	}
+
+	data, ok := secret.Data[globalRateLimitKeyHashSecretKey]
+	if !ok || len(data) < minGlobalRateLimitKeyHashSecretLength {
+		klog.Warningf("Global rate limit key hash Secret %q does not contain a key %q of at least %v bytes, using a generated key",
+			key, globalRateLimitKeyHashSecretKey, minGlobalRateLimitKeyHashSecretLength)
+		return globalRateLimitKeyHashSecret
+	}
+
+	return string(data)
+}
+
+// configureGlobalRateLimitRedis POSTs the password of Redis to an internal
+// HTTP endpoint that is handled by Lua
+func configureGlobalRateLimitRedis(password string) error {
+	statusCode, _, err := nginx.NewPostStatusRequest("/configuration/global-rate-limit-redis", "application/json",
+		map[string]string{"password": password})
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	return nil
+}
+
+// configureGlobalRateLimitKeyHash POSTs the key of the HMAC of the keys of
+// the global rate limits to an internal HTTP endpoint that is handled by Lua
+func configureGlobalRateLimitKeyHash(secret string) error {
+	statusCode, _, err := nginx.NewPostStatusRequest("/configuration/global-rate-limit-key-hash", "application/json",
+		map[string]string{"secret": secret})
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	return nil
+}
+
+// globalRateLimitStaleness returns the maximum age of the deltas of the
+// peers of the configuration
+func globalRateLimitStaleness(cfg config.Configuration) time.Duration {
+	staleness := time.Duration(cfg.GlobalRateLimitSyncMaxStaleness) * time.Millisecond
+	if staleness <= 0 {
+		staleness = 2 * time.Second
+	}
+
+	return staleness
+}
+
+// syncGlobalRateLimits sends periodically, with the local-sync mode, the
+// requests of the global rate limits counted by NGINX to the other pods of
+// the controller, until stopCh is closed
+func (n *NGINXController) syncGlobalRateLimits(stopCh <-chan struct{}) {
+	for {
+		cfg := n.store.GetBackendConfiguration()
+		staleness := globalRateLimitStaleness(cfg)
+
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(staleness / 2):
+		}
+
+		if cfg.GlobalRateLimitMode != config.GlobalRateLimitModeLocalSync {
+			continue
+		}
+
+		if err := n.sendGlobalRateLimitDeltas(staleness); err != nil {
+			klog.ErrorS(err, "Error replicating the global rate limits")
+		}
+	}
+}
+
+// sendGlobalRateLimitDeltas takes the requests counted by NGINX since the
+// previous call and POSTs them to the peers. The requests are not sent
+// again to the peers that cannot be reached.
+func (n *NGINXController) sendGlobalRateLimitDeltas(timeout time.Duration) error {
+	statusCode, body, err := nginx.NewPostStatusRequest("/configuration/global-rate-limit/deltas", "application/json", nil)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	deltas := globalRateLimitDeltas{}
+	if err := json.Unmarshal(body, &deltas.Counters); err != nil {
+		return err
+	}
+
+	if len(deltas.Counters) == 0 {
+		return nil
+	}
+
+	deltas.Sent = time.Now().UnixNano() / int64(time.Millisecond)
+	buf, err := json.Marshal(deltas)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: timeout}
+	port := strconv.Itoa(n.cfg.ListenPorts.Health)
+
+	var wg sync.WaitGroup
+	for _, peer := range n.globalRateLimitPeers.get() {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+
+			url := fmt.Sprintf("http://%v%v", net.JoinHostPort(peer, port), GlobalRateLimitSyncPath)
+			res, err := client.Post(url, "application/json", bytes.NewReader(buf))
+			if err != nil {
+				klog.V(2).ErrorS(err, "Error sending the global rate limits", "peer", peer)
+				return
+			}
+			res.Body.Close()
+
+			if res.StatusCode != http.StatusNoContent {
+				klog.V(2).InfoS("Unexpected status sending the global rate limits", "peer", peer, "status", res.StatusCode)
+			}
+		}(peer)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// GlobalRateLimitSyncHandler returns the handler of the endpoint receiving
+// the requests of the global rate limits counted by the other pods, with
+// the local-sync mode. Only the pods of the controller are allowed and the
+// deltas older than global-rate-limit-sync-max-staleness are discarded.
+func (n *NGINXController) GlobalRateLimitSyncHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		cfg := n.store.GetBackendConfiguration()
+		if cfg.GlobalRateLimitMode != config.GlobalRateLimitModeLocalSync {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !n.globalRateLimitPeers.contains(host) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		deltas := globalRateLimitDeltas{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, globalRateLimitMaxBodySize)).Decode(&deltas); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		age := time.Since(time.Unix(0, deltas.Sent*int64(time.Millisecond)))
+		if age > globalRateLimitStaleness(cfg) {
+			klog.V(2).InfoS("Discarding stale global rate limits", "peer", host, "age", age)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		statusCode, _, err := nginx.NewPostStatusRequest("/configuration/global-rate-limit/peers", "application/json", deltas.Counters)
+		if err != nil || statusCode != http.StatusCreated {
+			klog.ErrorS(err, "Error adding the global rate limits of a peer", "peer", host, "status", statusCode)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
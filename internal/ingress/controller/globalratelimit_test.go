@@ -0,0 +1,181 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+)
+
+type fakeGlobalRateLimitStore struct {
+	fakeIngressStore
+	cfg     ngx_config.Configuration
+	secrets map[string]*apiv1.Secret
+}
+
+func (s fakeGlobalRateLimitStore) GetBackendConfiguration() ngx_config.Configuration {
+	return s.cfg
+}
+
+func (s fakeGlobalRateLimitStore) GetSecret(key string) (*apiv1.Secret, error) {
+	secret, ok := s.secrets[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %v was not found", key)
+	}
+	return secret, nil
+}
+
+func TestPeerAddresses(t *testing.T) {
+	pods := []apiv1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "self"}, Status: apiv1.PodStatus{PodIP: "10.0.0.1"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "peer"}, Status: apiv1.PodStatus{PodIP: "10.0.0.2"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "pending"}},
+	}
+
+	addresses := peerAddresses(pods, "self")
+	if !reflect.DeepEqual(addresses, []string{"10.0.0.2"}) {
+		t.Errorf("expected the address of the peer but got %v", addresses)
+	}
+}
+
+func TestGlobalRateLimitSyncHandler(t *testing.T) {
+	cfg := ngx_config.NewDefault()
+
+	testCases := []struct {
+		name   string
+		mode   string
+		method string
+		remote string
+		body   string
+		status int
+	}{
+		{"only POST requests", ngx_config.GlobalRateLimitModeLocalSync, http.MethodGet, "10.0.0.2:1234", "", http.StatusMethodNotAllowed},
+		{"store mode", ngx_config.GlobalRateLimitModeStore, http.MethodPost, "10.0.0.2:1234", "{}", http.StatusNotFound},
+		{"unknown peer", ngx_config.GlobalRateLimitModeLocalSync, http.MethodPost, "10.0.0.3:1234", "{}", http.StatusForbidden},
+		{"invalid deltas", ngx_config.GlobalRateLimitModeLocalSync, http.MethodPost, "10.0.0.2:1234", "[", http.StatusBadRequest},
+		{"stale deltas", ngx_config.GlobalRateLimitModeLocalSync, http.MethodPost, "10.0.0.2:1234", `{"sent": 1000, "counters": {}}`, http.StatusNoContent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg.GlobalRateLimitMode = tc.mode
+			n := &NGINXController{
+				store: fakeGlobalRateLimitStore{cfg: cfg},
+				globalRateLimitPeers: &globalRateLimitPeers{
+					addresses: []string{"10.0.0.2"},
+					refreshed: time.Now(),
+				},
+			}
+
+			r := httptest.NewRequest(tc.method, GlobalRateLimitSyncPath, strings.NewReader(tc.body))
+			r.RemoteAddr = tc.remote
+			w := httptest.NewRecorder()
+
+			n.GlobalRateLimitSyncHandler().ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Errorf("expected status %v but got %v", tc.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestGlobalRateLimitStoreHost(t *testing.T) {
+	cfg := ngx_config.NewDefault()
+	cfg.GlobalRateLimitMemcachedHost = "memcached.default.svc"
+
+	setting, host := globalRateLimitStoreHost(cfg)
+	if setting != "global-rate-limit-memcached-host" || host != "memcached.default.svc" {
+		t.Errorf("unexpected store host %v=%q", setting, host)
+	}
+
+	cfg.GlobalRateLimitStore = ngx_config.GlobalRateLimitStoreRedis
+	setting, host = globalRateLimitStoreHost(cfg)
+	if setting != "global-rate-limit-redis-host" || host != "" {
+		t.Errorf("unexpected store host %v=%q", setting, host)
+	}
+
+	cfg.GlobalRateLimitRedisHost = "redis.default.svc"
+	if _, host = globalRateLimitStoreHost(cfg); host != "redis.default.svc" {
+		t.Errorf("expected the host of redis but got %q", host)
+	}
+}
+
+func TestGetGlobalRateLimitRedisPassword(t *testing.T) {
+	secrets := map[string]*apiv1.Secret{
+		"ingress-nginx/redis":     {Data: map[string][]byte{"password": []byte("secret")}},
+		"ingress-nginx/other-key": {Data: map[string][]byte{"key": []byte("secret")}},
+	}
+
+	testCases := []struct {
+		secretKey string
+		expected  string
+	}{
+		{"", ""},
+		{"ingress-nginx/redis", "secret"},
+		{"ingress-nginx/other-key", ""},
+		{"ingress-nginx/missing", ""},
+	}
+
+	for _, tc := range testCases {
+		n := &NGINXController{store: fakeGlobalRateLimitStore{
+			cfg:     ngx_config.Configuration{GlobalRateLimitRedisPasswordSecret: tc.secretKey},
+			secrets: secrets,
+		}}
+		if password := n.getGlobalRateLimitRedisPassword(); password != tc.expected {
+			t.Errorf("expected %q for the Secret %q but got %q", tc.expected, tc.secretKey, password)
+		}
+	}
+}
+
+func TestGetGlobalRateLimitKeyHashSecret(t *testing.T) {
+	key := strings.Repeat("k", minGlobalRateLimitKeyHashSecretLength)
+	secrets := map[string]*apiv1.Secret{
+		"ingress-nginx/key-hash":  {Data: map[string][]byte{"secret": []byte(key)}},
+		"ingress-nginx/too-short": {Data: map[string][]byte{"secret": []byte("secret")}},
+	}
+
+	testCases := []struct {
+		secretKey string
+		expected  string
+	}{
+		{"", globalRateLimitKeyHashSecret},
+		{"ingress-nginx/key-hash", key},
+		{"ingress-nginx/too-short", globalRateLimitKeyHashSecret},
+		{"ingress-nginx/missing", globalRateLimitKeyHashSecret},
+	}
+
+	for _, tc := range testCases {
+		n := &NGINXController{store: fakeGlobalRateLimitStore{
+			cfg:     ngx_config.Configuration{GlobalRateLimitKeyHashSecret: tc.secretKey},
+			secrets: secrets,
+		}}
+		if secret := n.getGlobalRateLimitKeyHashSecret(); secret != tc.expected {
+			t.Errorf("expected %q for the Secret %q but got %q", tc.expected, tc.secretKey, secret)
+		}
+	}
+}
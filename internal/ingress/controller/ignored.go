@@ -0,0 +1,198 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+// reasons of the ingresses that do not route any request to their backends,
+// used in the Events and the ignored_ingresses metric
+const (
+	ignoredNoRules         = "NoRules"
+	ignoredCanaryNotMerged = "CanaryNotMerged"
+	ignoredPathConflict    = "PathConflict"
+	ignoredServiceNotFound = "ServiceNotFound"
+	ignoredNoConfiguration = "NoConfiguration"
+)
+
+// ignoredIngress is an ingress of the class of the controller that does not
+// route any request to its backends
+type ignoredIngress struct {
+	ing     *ingress.Ingress
+	reason  string
+	message string
+}
+
+// serviceBackends returns the backends of the ingress referencing a Service
+func serviceBackends(ing *ingress.Ingress) []*networking.IngressBackend {
+	backends := []*networking.IngressBackend{}
+	if ing.Spec.DefaultBackend != nil && ing.Spec.DefaultBackend.Service != nil {
+		backends = append(backends, ing.Spec.DefaultBackend)
+	}
+
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+
+		for i := range rule.HTTP.Paths {
+			if rule.HTTP.Paths[i].Backend.Service != nil {
+				backends = append(backends, &rule.HTTP.Paths[i].Backend)
+			}
+		}
+	}
+
+	return backends
+}
+
+// getIgnoredIngresses returns the ingresses without any location in the
+// configuration, or whose Services do not exist, with the reason
+func (n *NGINXController) getIgnoredIngresses(ings []*ingress.Ingress, pcfg *ingress.Configuration) []ignoredIngress {
+	configured := sets.NewString()
+	// ingress defining each path of the servers
+	owners := map[string]string{}
+	for _, server := range pcfg.Servers {
+		for _, loc := range server.Locations {
+			if loc.Ingress == nil {
+				continue
+			}
+
+			key := k8s.MetaNamespaceKey(loc.Ingress)
+			configured.Insert(key)
+			owners[fmt.Sprintf("%v%v", server.Hostname, loc.Path)] = key
+		}
+	}
+
+	alternatives := sets.NewString()
+	for _, backend := range pcfg.Backends {
+		alternatives.Insert(backend.AlternativeBackends...)
+	}
+
+	ignored := []ignoredIngress{}
+	for _, ing := range ings {
+		key := k8s.MetaNamespaceKey(ing)
+		backends := serviceBackends(ing)
+
+		if len(ing.Spec.Rules) == 0 && ing.Spec.DefaultBackend == nil {
+			ignored = append(ignored, ignoredIngress{ing, ignoredNoRules, "The Ingress does not define any rule or default backend"})
+			continue
+		}
+
+		isCanary := ing.ParsedAnnotations != nil && ing.ParsedAnnotations.Canary.Enabled
+		if isCanary {
+			merged := false
+			for _, backend := range backends {
+				if alternatives.Has(upstreamName(ing.Namespace, backend)) {
+					merged = true
+					break
+				}
+			}
+
+			if !merged {
+				ignored = append(ignored, ignoredIngress{ing, ignoredCanaryNotMerged,
+					"No Ingress without the canary annotation defines the hosts and paths of the canary Ingress"})
+				continue
+			}
+		} else if !configured.Has(key) {
+			conflicts := sets.NewString()
+			for _, rule := range ing.Spec.Rules {
+				host := rule.Host
+				if host == "" {
+					host = defServerName
+				}
+
+				if rule.HTTP == nil {
+					continue
+				}
+
+				for _, path := range rule.HTTP.Paths {
+					nginxPath := rootLocation
+					if path.Path != "" {
+						nginxPath = path.Path
+					}
+
+					if owner, ok := owners[fmt.Sprintf("%v%v", host, nginxPath)]; ok && owner != key {
+						conflicts.Insert(owner)
+					}
+				}
+			}
+
+			if conflicts.Len() > 0 {
+				ignored = append(ignored, ignoredIngress{ing, ignoredPathConflict,
+					fmt.Sprintf("The paths of the Ingress are already defined by the Ingresses %v", strings.Join(conflicts.List(), ", "))})
+				continue
+			}
+
+			ignored = append(ignored, ignoredIngress{ing, ignoredNoConfiguration, "The Ingress does not produce any NGINX configuration"})
+			continue
+		}
+
+		services := sets.NewString()
+		missing := sets.NewString()
+		for _, backend := range backends {
+			svcKey := fmt.Sprintf("%v/%v", ing.Namespace, backend.Service.Name)
+			services.Insert(svcKey)
+			if _, err := n.store.GetService(svcKey); err != nil {
+				missing.Insert(svcKey)
+			}
+		}
+
+		// the locations of the ingress only return 503
+		if services.Len() > 0 && missing.Len() == services.Len() {
+			ignored = append(ignored, ignoredIngress{ing, ignoredServiceNotFound,
+				fmt.Sprintf("The Services %v of the Ingress do not exist", strings.Join(missing.List(), ", "))})
+		}
+	}
+
+	return ignored
+}
+
+// reportIgnoredIngresses exposes the ingresses that do not route any request
+// to their backends in the ignored_ingresses metric, and marks each of them
+// with an Event when it starts being ignored or its reason changes
+func (n *NGINXController) reportIgnoredIngresses(ings []*ingress.Ingress, pcfg *ingress.Configuration) {
+	ignored := n.getIgnoredIngresses(ings, pcfg)
+
+	current := make(map[string]string, len(ignored))
+	metrics := make([]collectors.IgnoredIngress, 0, len(ignored))
+	for _, i := range ignored {
+		key := k8s.MetaNamespaceKey(i.ing)
+		current[key] = i.reason
+		metrics = append(metrics, collectors.IgnoredIngress{Namespace: i.ing.Namespace, Name: i.ing.Name, Reason: i.reason})
+
+		if n.ignoredIngresses[key] == i.reason {
+			continue
+		}
+
+		klog.Warningf("Ingress %v does not route any request to its backends: %v", key, i.message)
+		n.recordIngressEvent(i.ing, apiv1.EventTypeWarning, i.reason, i.message)
+	}
+
+	n.ignoredIngresses = current
+	n.metricCollector.SetIgnoredIngresses(metrics)
+}
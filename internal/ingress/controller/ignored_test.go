@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/canary"
+)
+
+func TestGetIgnoredIngresses(t *testing.T) {
+	backend := func(name string) networking.IngressBackend {
+		return networking.IngressBackend{
+			Service: &networking.IngressServiceBackend{Name: name, Port: networking.ServiceBackendPort{Number: 80}},
+		}
+	}
+	rule := func(host, path, service string) networking.IngressRule {
+		return networking.IngressRule{
+			Host: host,
+			IngressRuleValue: networking.IngressRuleValue{
+				HTTP: &networking.HTTPIngressRuleValue{
+					Paths: []networking.HTTPIngressPath{{Path: path, Backend: backend(service)}},
+				},
+			},
+		}
+	}
+	newIngress := func(name string, rules ...networking.IngressRule) *ingress.Ingress {
+		return &ingress.Ingress{
+			Ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+				Spec:       networking.IngressSpec{Rules: rules},
+			},
+			ParsedAnnotations: &annotations.Ingress{},
+		}
+	}
+
+	empty := newIngress("empty")
+	hostOnly := newIngress("host-only", networking.IngressRule{Host: "bar.baz"})
+	current := newIngress("current", rule("foo.bar", "/api", "web"))
+	old := newIngress("old", rule("foo.bar", "/api", "legacy"))
+	canaryIngress := newIngress("canary", rule("foo.bar", "/api", "web-canary"))
+	canaryIngress.ParsedAnnotations.Canary = canary.Config{Enabled: true}
+
+	pcfg := &ingress.Configuration{
+		Backends: []*ingress.Backend{{Name: "default-web-80"}},
+		Servers: []*ingress.Server{
+			{Hostname: "foo.bar", Locations: []*ingress.Location{{Path: "/api", Ingress: current}}},
+			{Hostname: "bar.baz", Locations: []*ingress.Location{{Path: "/", Ingress: hostOnly}}},
+		},
+	}
+
+	n := newNGINXController(t)
+	ignored := n.getIgnoredIngresses([]*ingress.Ingress{empty, hostOnly, current, old, canaryIngress}, pcfg)
+
+	reasons := map[string]string{}
+	for _, i := range ignored {
+		reasons[i.ing.Name] = i.reason
+	}
+
+	expected := map[string]string{
+		"empty":   ignoredNoRules,
+		"current": ignoredServiceNotFound,
+		"old":     ignoredPathConflict,
+		"canary":  ignoredCanaryNotMerged,
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("expected %v but got %v", expected, reasons)
+	}
+
+	// the canary is merged into the backend of the current ingress
+	pcfg.Backends[0].AlternativeBackends = []string{"default-web-canary-80"}
+	for _, i := range n.getIgnoredIngresses([]*ingress.Ingress{canaryIngress}, pcfg) {
+		if i.reason == ignoredCanaryNotMerged {
+			t.Errorf("expected the canary ingress to be merged")
+		}
+	}
+}
@@ -0,0 +1,614 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/status"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/logging"
+)
+
+const (
+	// IntrospectionPath is the path of the endpoint that returns the running
+	// configuration of the controller
+	IntrospectionPath = "/introspection/configuration"
+	// CertificatesIntrospectionPath is the path of the endpoint that returns
+	// the certificates served by the controller
+	CertificatesIntrospectionPath = "/introspection/certificates"
+	// ConfigurationDiffPath is the path of the endpoint that returns the
+	// changes of the NGINX configuration not applied yet
+	ConfigurationDiffPath = "/introspection/configuration-diff"
+	// ConfigurationDumpPath is the path of the endpoint that returns the
+	// running NGINX configuration with its secrets redacted
+	ConfigurationDumpPath = "/introspection/nginx.conf"
+	// ConfigurationSnapshotsPath is the path of the endpoint that returns
+	// the snapshots of the configurations of the last reloads
+	ConfigurationSnapshotsPath = "/introspection/configuration-snapshots"
+	// ConfigurationSnapshotsDiffPath is the path of the endpoint that
+	// returns the diff between two snapshots
+	ConfigurationSnapshotsDiffPath = "/introspection/configuration-snapshots/diff"
+	// ConfigurationRollbackPath is the path of the endpoint that rolls back
+	// the configuration to a snapshot
+	ConfigurationRollbackPath = "/introspection/configuration-snapshots/rollback"
+	// ConfigurationReleasePath is the path of the endpoint that ends the
+	// rollback of the configuration
+	ConfigurationReleasePath = "/introspection/configuration-snapshots/release"
+	// BackendHealthPath is the path of the endpoint that returns the health
+	// and pressure scores of the backends
+	BackendHealthPath = "/introspection/backend-health"
+)
+
+// introspectionHandler returns a handler that only serves the GET requests
+// with the bearer token of the file tokenFile, read on each request to allow
+// the rotation of the token.
+func introspectionHandler(tokenFile string, serve http.HandlerFunc) http.Handler {
+	return introspectionMethodHandler(http.MethodGet, tokenFile, serve)
+}
+
+// introspectionMethodHandler returns a handler like introspectionHandler
+// that only serves the requests with the given method.
+func introspectionMethodHandler(method, tokenFile string, serve http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		token, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			logging.Sync.ErrorS(err, "Reading the token of the introspection endpoint", "file", tokenFile)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !isAuthorized(r, bytes.TrimSpace(token)) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		serve(w, r)
+	})
+}
+
+// IntrospectionHandler returns the handler of the endpoint that returns, as
+// JSON, the servers, locations and backends of the running configuration.
+// With the query parameter ingress=<namespace>/<name> it returns only the
+// effective configuration of that ingress.
+// The requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) IntrospectionHandler(tokenFile string) http.Handler {
+	return introspectionHandler(tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		var model interface{} = n.introspectionModel()
+		if key := r.URL.Query().Get("ingress"); key != "" {
+			ing := n.ingressIntrospection(key)
+			if ing == nil {
+				http.Error(w, fmt.Sprintf("ingress %v not found", key), http.StatusNotFound)
+				return
+			}
+
+			model = ing
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(model); err != nil {
+			logging.Sync.ErrorS(err, "Encoding the running configuration")
+		}
+	})
+}
+
+// CertificatesIntrospectionHandler returns the handler of the endpoint that
+// returns, as JSON, the certificates of the servers of the running
+// configuration.
+// The requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) CertificatesIntrospectionHandler(tokenFile string) http.Handler {
+	return introspectionHandler(tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(n.certificatesIntrospection()); err != nil {
+			logging.Sync.ErrorS(err, "Encoding the certificates")
+		}
+	})
+}
+
+// ConfigurationDiffHandler returns the handler of the endpoint that renders
+// the NGINX configuration of the Ingresses of the store, without testing or
+// reloading NGINX, and returns its unified diff against the running one. The
+// response is empty when both are the same.
+// The requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) ConfigurationDiffHandler(tokenFile string) http.Handler {
+	return introspectionHandler(tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		content, err := n.renderConfiguration()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("rendering the configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		var diff []byte
+		running, _ := ioutil.ReadFile(cfgPath)
+		if !bytes.Equal(running, content) {
+			diff, err = diffConfiguration(cfgPath, content)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("comparing the configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		if _, err := w.Write(diff); err != nil {
+			logging.Sync.ErrorS(err, "Writing the configuration diff")
+		}
+	})
+}
+
+// ConfigurationDumpHandler returns the handler of the endpoint that returns
+// the running NGINX configuration, followed by the include files of the
+// tenants and of the snippet fragments, with the private keys, credentials
+// and sensitive headers redacted, to be shared in bug reports.
+// The requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) ConfigurationDumpHandler(tokenFile string) http.Handler {
+	return introspectionHandler(tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		content, err := runningConfiguration(cfgPath, tenantsDir, snippetFragmentsDir)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading the configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := w.Write(redactConfiguration(content)); err != nil {
+			logging.Sync.ErrorS(err, "Writing the configuration dump")
+		}
+	})
+}
+
+// SnapshotsIntrospection describes the snapshots of the configurations of
+// the last reloads
+type SnapshotsIntrospection struct {
+	// RolledBack is the ID of the snapshot the configuration is rolled back
+	// to, empty when it is not rolled back
+	RolledBack string      `json:"rolledBack,omitempty"`
+	Snapshots  []*Snapshot `json:"snapshots"`
+}
+
+// ConfigurationSnapshotsHandler returns the handler of the endpoint that
+// returns, as JSON, the snapshots of the configurations of the last reloads
+// with the generations of their ingresses, from the oldest to the newest.
+// The requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) ConfigurationSnapshotsHandler(tokenFile string) http.Handler {
+	return introspectionHandler(tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		if n.snapshots == nil {
+			http.Error(w, "the configuration snapshots are disabled", http.StatusNotFound)
+			return
+		}
+
+		snapshots, err := n.snapshots.list()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("reading the snapshots: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(SnapshotsIntrospection{
+			RolledBack: n.snapshots.rolledBackTo(),
+			Snapshots:  snapshots,
+		})
+		if err != nil {
+			logging.Sync.ErrorS(err, "Encoding the configuration snapshots")
+		}
+	})
+}
+
+// ConfigurationSnapshotsDiffHandler returns the handler of the endpoint that
+// returns the unified diff between the configuration files of the snapshot
+// of the query parameter from and the ones of the snapshot of the query
+// parameter to or, without it, the running ones, with their secrets
+// redacted.
+// The requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) ConfigurationSnapshotsDiffHandler(tokenFile string) http.Handler {
+	return introspectionHandler(tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		if n.snapshots == nil {
+			http.Error(w, "the configuration snapshots are disabled", http.StatusNotFound)
+			return
+		}
+
+		from, err := n.snapshots.get(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var to []byte
+		if id := r.URL.Query().Get("to"); id != "" {
+			snapshot, err := n.snapshots.get(id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			to = snapshot.files()
+		} else {
+			to, err = runningConfiguration(cfgPath, tenantsDir, snippetFragmentsDir)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("reading the configuration: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// the configurations are redacted like the running one
+		diff, err := diffContents(redactConfiguration(from.files()), redactConfiguration(to))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("comparing the configuration: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		if _, err := w.Write(diff); err != nil {
+			logging.Sync.ErrorS(err, "Writing the configuration snapshots diff")
+		}
+	})
+}
+
+// ConfigurationRollbackHandler returns the handler of the endpoint that
+// rolls back the configuration to the snapshot of the query parameter id
+// or, without it, to the snapshot preceding the running configuration. The
+// reloads are suspended until the release of the rollback.
+// The POST requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) ConfigurationRollbackHandler(tokenFile string) http.Handler {
+	return introspectionMethodHandler(http.MethodPost, tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		snapshot, err := n.rollbackConfiguration(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("rolling back the configuration: %v", err), http.StatusConflict)
+			return
+		}
+
+		logging.Sync.InfoS("Configuration rolled back", "snapshot", snapshot.ID, "checksum", snapshot.Checksum)
+		if n.recorder != nil && k8s.IngressPodDetails != nil {
+			n.recorder.Eventf(k8s.IngressPodDetails, apiv1.EventTypeWarning, "RELOAD",
+				"NGINX configuration rolled back to the snapshot %v, reloads suspended until its release", snapshot.ID)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snapshot.summary()); err != nil {
+			logging.Sync.ErrorS(err, "Encoding the configuration snapshot")
+		}
+	})
+}
+
+// ConfigurationReleaseHandler returns the handler of the endpoint that ends
+// the rollback of the configuration, NGINX is reloaded with the
+// configuration of the objects of the cluster.
+// The POST requests must contain the bearer token of the file tokenFile.
+func (n *NGINXController) ConfigurationReleaseHandler(tokenFile string) http.Handler {
+	return introspectionMethodHandler(http.MethodPost, tokenFile, func(w http.ResponseWriter, r *http.Request) {
+		if err := n.releaseConfiguration(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		logging.Sync.InfoS("Configuration rollback released")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// runningConfiguration returns the content of the NGINX configuration file
+// path followed by the include files of the directories, each one preceded
+// by a comment with its path
+func runningConfiguration(path string, includeDirs ...string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(content)
+	for _, dir := range includeDirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range files {
+			include, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+
+			fmt.Fprintf(buf, "\n# %v\n", f)
+			buf.Write(include)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// CertificateIntrospection describes the certificate served for a host
+type CertificateIntrospection struct {
+	Host string `json:"host"`
+	// Secret is the namespace and name of the secret of the certificate
+	Secret  string   `json:"secret"`
+	Subject string   `json:"subject,omitempty"`
+	SANs    []string `json:"sans"`
+	Issuer  string   `json:"issuer,omitempty"`
+	// NotBefore and NotAfter are the validity period of the certificate
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  time.Time  `json:"notAfter"`
+}
+
+// certificatesIntrospection returns the certificates of the servers of the
+// running configuration, sorted by host
+func (n *NGINXController) certificatesIntrospection() []CertificateIntrospection {
+	certificates := []CertificateIntrospection{}
+
+	for _, server := range n.getRunningConfig().Servers {
+		cert := server.SSLCert
+		if cert == nil {
+			continue
+		}
+
+		ci := CertificateIntrospection{
+			Host:     server.Hostname,
+			Secret:   fmt.Sprintf("%v/%v", cert.Namespace, cert.Name),
+			SANs:     cert.CN,
+			NotAfter: cert.ExpireTime,
+		}
+
+		// without the parsed certificate only the names and the expiration are known
+		if x509Cert := cert.Certificate; x509Cert != nil {
+			notBefore := x509Cert.NotBefore
+			ci.Subject = x509Cert.Subject.String()
+			ci.Issuer = x509Cert.Issuer.String()
+			ci.NotBefore = &notBefore
+			ci.NotAfter = x509Cert.NotAfter
+
+			ci.SANs = append([]string{}, x509Cert.DNSNames...)
+			for _, ip := range x509Cert.IPAddresses {
+				ci.SANs = append(ci.SANs, ip.String())
+			}
+		}
+
+		certificates = append(certificates, ci)
+	}
+
+	sort.SliceStable(certificates, func(i, j int) bool {
+		return certificates[i].Host < certificates[j].Host
+	})
+
+	return certificates
+}
+
+// isAuthorized returns true if the request contains the bearer token
+func isAuthorized(r *http.Request, token []byte) bool {
+	if len(token) == 0 {
+		return false
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), token) == 1
+}
+
+// introspectionModel returns a copy of the running configuration without
+// the private keys of the certificates
+func (n *NGINXController) introspectionModel() *ingress.Configuration {
+	pcfg := *n.getRunningConfig()
+
+	servers := make([]*ingress.Server, 0, len(pcfg.Servers))
+	for _, server := range pcfg.Servers {
+		s := *server
+		if s.SSLCert != nil {
+			cert := *s.SSLCert
+			cert.PemCertKey = ""
+			s.SSLCert = &cert
+		}
+
+		servers = append(servers, &s)
+	}
+	pcfg.Servers = servers
+
+	return &pcfg
+}
+
+// IngressIntrospection is the effective configuration of an ingress, after
+// applying the defaults, the ConfigMap and the resolution of the conflicts
+// with other ingresses
+type IngressIntrospection struct {
+	// Ingress is the namespace and name of the ingress
+	Ingress string `json:"ingress"`
+	// ConfigurationChecksum identifies the running configuration
+	ConfigurationChecksum string `json:"configurationChecksum,omitempty"`
+	// Status is the last status of the configuration of the ingress, when
+	// the flag update-configuration-status is enabled
+	Status *status.ConfigurationStatus `json:"status,omitempty"`
+	// QuarantineReason is the reason of the exclusion of the ingress from the
+	// running configuration
+	QuarantineReason string `json:"quarantineReason,omitempty"`
+	// Annotations are the parsed annotations of the ingress
+	Annotations *annotations.Ingress `json:"annotations,omitempty"`
+	// Servers contains the servers with the locations of the ingress
+	Servers []*ingress.Server `json:"servers"`
+	// Backends used by the locations of the ingress, including the canaries
+	Backends []*ingress.Backend `json:"backends"`
+	// DroppedPaths are the paths of the ingress not present in the running
+	// configuration
+	DroppedPaths []DroppedPath `json:"droppedPaths,omitempty"`
+}
+
+// DroppedPath is a path of an ingress rule not present in the running
+// configuration
+type DroppedPath struct {
+	Host   string `json:"host"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ingressIntrospection returns the effective configuration of the ingress
+// with the given key or nil if the ingress does not exist
+func (n *NGINXController) ingressIntrospection(key string) *IngressIntrospection {
+	var ing *ingress.Ingress
+	if n.store != nil {
+		for _, candidate := range n.store.ListIngresses() {
+			if k8s.MetaNamespaceKey(candidate) == key {
+				ing = candidate
+				break
+			}
+		}
+	}
+
+	pcfg := n.introspectionModel()
+
+	n.runningConfigLock.RLock()
+	quarantineReason := n.quarantinedIngresses[key]
+	cs, hasStatus := n.configurationStatus[key]
+	n.runningConfigLock.RUnlock()
+
+	result := &IngressIntrospection{
+		Ingress:               key,
+		ConfigurationChecksum: pcfg.ConfigurationChecksum,
+		QuarantineReason:      quarantineReason,
+		Servers:               []*ingress.Server{},
+		Backends:              []*ingress.Backend{},
+	}
+
+	if hasStatus {
+		result.Status = &cs
+	}
+
+	backendNames := map[string]bool{}
+	for _, server := range pcfg.Servers {
+		var locations []*ingress.Location
+		for _, location := range server.Locations {
+			if location.Ingress == nil || k8s.MetaNamespaceKey(location.Ingress) != key {
+				continue
+			}
+
+			if ing == nil {
+				ing = location.Ingress
+			}
+
+			locations = append(locations, location)
+			backendNames[location.Backend] = true
+		}
+
+		if len(locations) == 0 {
+			continue
+		}
+
+		s := *server
+		s.Locations = locations
+		result.Servers = append(result.Servers, &s)
+	}
+
+	if ing == nil {
+		return nil
+	}
+
+	result.Annotations = ing.ParsedAnnotations
+
+	for _, backend := range pcfg.Backends {
+		if backendNames[backend.Name] {
+			for _, alternative := range backend.AlternativeBackends {
+				backendNames[alternative] = true
+			}
+		}
+	}
+
+	for _, backend := range pcfg.Backends {
+		if backendNames[backend.Name] {
+			result.Backends = append(result.Backends, backend)
+		}
+	}
+
+	result.DroppedPaths = droppedPaths(ing, key, pcfg.Servers)
+
+	return result
+}
+
+// droppedPaths returns the paths of the rules of the ingress without a
+// location of the ingress in the servers
+func droppedPaths(ing *ingress.Ingress, key string, servers []*ingress.Server) []DroppedPath {
+	var dropped []DroppedPath
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+
+		host := rule.Host
+		if host == "" {
+			host = defServerName
+		}
+
+		var server *ingress.Server
+		for _, s := range servers {
+			if s.Hostname == host {
+				server = s
+				break
+			}
+		}
+
+		for _, path := range rule.HTTP.Paths {
+			p := path.Path
+			if p == "" {
+				p = rootLocation
+			}
+
+			if server == nil {
+				dropped = append(dropped, DroppedPath{host, p, "the server is not present in the running configuration"})
+				continue
+			}
+
+			reason := "the location is not present in the running configuration"
+			for _, location := range server.Locations {
+				if location.IngressPath != p && location.Path != p {
+					continue
+				}
+
+				if location.Ingress == nil {
+					reason = "the location is used by the default backend"
+					continue
+				}
+
+				owner := k8s.MetaNamespaceKey(location.Ingress)
+				if owner == key {
+					reason = ""
+					break
+				}
+
+				reason = fmt.Sprintf("the location is defined by the ingress %v", owner)
+			}
+
+			if reason != "" {
+				dropped = append(dropped, DroppedPath{host, p, reason})
+			}
+		}
+	}
+
+	return dropped
+}
@@ -0,0 +1,330 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/net/ssl"
+)
+
+func TestIntrospectionHandler(t *testing.T) {
+	tokenFile, err := ioutil.TempFile("", "introspection-token")
+	if err != nil {
+		t.Fatalf("unexpected error creating the token file: %v", err)
+	}
+	defer os.Remove(tokenFile.Name())
+
+	if _, err := tokenFile.WriteString("s3cr3t\n"); err != nil {
+		t.Fatalf("unexpected error writing the token file: %v", err)
+	}
+	tokenFile.Close()
+
+	n := &NGINXController{
+		runningConfigLock: &sync.RWMutex{},
+		runningConfig: &ingress.Configuration{
+			Backends: []*ingress.Backend{{Name: "default-app-80"}},
+			Servers: []*ingress.Server{
+				{
+					Hostname: "example.com",
+					SSLCert:  &ingress.SSLCert{Name: "example-tls", PemCertKey: "private key"},
+					Locations: []*ingress.Location{
+						{Path: "/", Backend: "default-app-80"},
+					},
+				},
+			},
+		},
+	}
+
+	handler := n.IntrospectionHandler(tokenFile.Name())
+
+	testCases := map[string]struct {
+		method         string
+		authorization  string
+		expectedStatus int
+	}{
+		"without token":      {http.MethodGet, "", http.StatusUnauthorized},
+		"with invalid token": {http.MethodGet, "Bearer invalid", http.StatusUnauthorized},
+		"with basic auth":    {http.MethodGet, "Basic czNjcjN0", http.StatusUnauthorized},
+		"with valid token":   {http.MethodGet, "Bearer s3cr3t", http.StatusOK},
+		"with POST method":   {http.MethodPost, "Bearer s3cr3t", http.StatusMethodNotAllowed},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, IntrospectionPath, nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("expected status %v but %v returned", tc.expectedStatus, w.Code)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, IntrospectionPath, nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	pcfg := &ingress.Configuration{}
+	if err := json.Unmarshal(w.Body.Bytes(), pcfg); err != nil {
+		t.Fatalf("unexpected error decoding the response: %v", err)
+	}
+
+	if len(pcfg.Servers) != 1 || pcfg.Servers[0].Locations[0].Backend != "default-app-80" {
+		t.Errorf("expected the server example.com in the response but %v returned", w.Body.String())
+	}
+	if pcfg.Servers[0].SSLCert.PemCertKey != "" {
+		t.Errorf("expected the private key not to be in the response")
+	}
+	if n.runningConfig.Servers[0].SSLCert.PemCertKey == "" {
+		t.Errorf("expected the private key of the running configuration to be kept")
+	}
+}
+
+func TestCertificatesIntrospectionHandler(t *testing.T) {
+	tokenFile, err := ioutil.TempFile("", "introspection-token")
+	if err != nil {
+		t.Fatalf("unexpected error creating the token file: %v", err)
+	}
+	defer os.Remove(tokenFile.Name())
+
+	if _, err := tokenFile.WriteString("s3cr3t"); err != nil {
+		t.Fatalf("unexpected error writing the token file: %v", err)
+	}
+	tokenFile.Close()
+
+	fakeCert := ssl.GetFakeSSLCert()
+	fakeCert.Name = "ingress-local-tls"
+	fakeCert.Namespace = "default"
+
+	expireTime := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	n := &NGINXController{
+		runningConfigLock: &sync.RWMutex{},
+		runningConfig: &ingress.Configuration{
+			Servers: []*ingress.Server{
+				{Hostname: "without-tls.com"},
+				{Hostname: "ingress.local", SSLCert: fakeCert},
+				{
+					Hostname: "example.com",
+					SSLCert: &ingress.SSLCert{
+						Name:       "example-tls",
+						Namespace:  "other",
+						CN:         []string{"example.com", "*.example.com"},
+						ExpireTime: expireTime,
+					},
+				},
+			},
+		},
+	}
+
+	handler := n.CertificatesIntrospectionHandler(tokenFile.Name())
+
+	req := httptest.NewRequest(http.MethodGet, CertificatesIntrospectionPath, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %v without token but %v returned", http.StatusUnauthorized, w.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %v but %v returned", http.StatusOK, w.Code)
+	}
+
+	var certificates []CertificateIntrospection
+	if err := json.Unmarshal(w.Body.Bytes(), &certificates); err != nil {
+		t.Fatalf("unexpected error decoding the response: %v", err)
+	}
+
+	if len(certificates) != 2 {
+		t.Fatalf("expected two certificates but %v returned", w.Body.String())
+	}
+
+	expected := CertificateIntrospection{
+		Host:     "example.com",
+		Secret:   "other/example-tls",
+		SANs:     []string{"example.com", "*.example.com"},
+		NotAfter: expireTime,
+	}
+	if !reflect.DeepEqual(certificates[0], expected) {
+		t.Errorf("expected %v but %v returned", expected, certificates[0])
+	}
+
+	local := certificates[1]
+	if local.Host != "ingress.local" || local.Secret != "default/ingress-local-tls" {
+		t.Errorf("expected the certificate of ingress.local but %v returned", local)
+	}
+	if !reflect.DeepEqual(local.SANs, fakeCert.Certificate.DNSNames) {
+		t.Errorf("expected SANs %v but %v returned", fakeCert.Certificate.DNSNames, local.SANs)
+	}
+	if local.Subject != fakeCert.Certificate.Subject.String() || local.Issuer == "" || local.NotBefore == nil {
+		t.Errorf("expected the subject, issuer and validity of the certificate but %v returned", local)
+	}
+}
+
+func TestIngressIntrospection(t *testing.T) {
+	owner := newHostIngress("owner", "example.com")
+	owner.Spec.Rules[0].HTTP = &networking.HTTPIngressRuleValue{
+		Paths: []networking.HTTPIngressPath{{Path: "/"}},
+	}
+
+	other := newHostIngress("other", "example.com")
+	other.Spec.Rules[0].HTTP = &networking.HTTPIngressRuleValue{
+		Paths: []networking.HTTPIngressPath{{Path: "/"}, {Path: "/other"}},
+	}
+
+	n := &NGINXController{
+		store:             fakeIngressStore{ingresses: []*ingress.Ingress{owner, other}},
+		runningConfigLock: &sync.RWMutex{},
+		runningConfig: &ingress.Configuration{
+			ConfigurationChecksum: "12345",
+			Backends: []*ingress.Backend{
+				{Name: "default-owner-80", AlternativeBackends: []string{"default-canary-80"}},
+				{Name: "default-canary-80"},
+				{Name: "default-other-80"},
+				{Name: "upstream-default-backend"},
+			},
+			Servers: []*ingress.Server{
+				{
+					Hostname: "example.com",
+					Locations: []*ingress.Location{
+						{Path: "/", IngressPath: "/", Backend: "default-owner-80", Ingress: owner},
+						{Path: "/other", IngressPath: "/other", Backend: "default-other-80", Ingress: other},
+					},
+				},
+			},
+		},
+		quarantinedIngresses: map[string]string{},
+	}
+
+	if result := n.ingressIntrospection("default/missing"); result != nil {
+		t.Errorf("expected no result for a missing ingress but %v returned", result)
+	}
+
+	result := n.ingressIntrospection("default/owner")
+	if result == nil {
+		t.Fatalf("expected a result for the ingress default/owner")
+	}
+
+	if len(result.Servers) != 1 || len(result.Servers[0].Locations) != 1 || result.Servers[0].Locations[0].Path != "/" {
+		t.Errorf("expected only the location / of the ingress but %v returned", result.Servers)
+	}
+
+	var backends []string
+	for _, backend := range result.Backends {
+		backends = append(backends, backend.Name)
+	}
+	if !reflect.DeepEqual(backends, []string{"default-owner-80", "default-canary-80"}) {
+		t.Errorf("expected the backend and its canary but %v returned", backends)
+	}
+
+	if len(result.DroppedPaths) != 0 {
+		t.Errorf("expected no dropped paths but %v returned", result.DroppedPaths)
+	}
+
+	result = n.ingressIntrospection("default/other")
+	expected := []DroppedPath{{"example.com", "/", "the location is defined by the ingress default/owner"}}
+	if !reflect.DeepEqual(result.DroppedPaths, expected) {
+		t.Errorf("expected dropped paths %v but %v returned", expected, result.DroppedPaths)
+	}
+}
+
+func TestIngressIntrospectionDuringSync(t *testing.T) {
+	n := &NGINXController{
+		store:             fakeIngressStore{},
+		runningConfigLock: &sync.RWMutex{},
+		runningConfig:     &ingress.Configuration{},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			n.setRunningConfig(&ingress.Configuration{ConfigurationChecksum: fmt.Sprintf("%v", i)})
+
+			n.runningConfigLock.Lock()
+			n.quarantinedIngresses = map[string]string{"default/foo": "invalid directive"}
+			n.runningConfigLock.Unlock()
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		n.ingressIntrospection("default/foo")
+	}
+	<-done
+}
+
+func TestRunningConfiguration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "running-configuration")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tenants := filepath.Join(dir, "tenants")
+	if err := writeIncludeFiles(tenants, map[string][]byte{
+		"foo": []byte("server { server_name foo.bar; }\n"),
+		"bar": []byte("server { server_name bar.baz; }\n"),
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	path := filepath.Join(dir, "nginx.conf")
+	if err := ioutil.WriteFile(path, []byte("include tenants/*.conf;\n"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content, err := runningConfiguration(path, tenants, filepath.Join(dir, "fragments"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "include tenants/*.conf;\n" +
+		"\n# " + filepath.Join(tenants, "bar.conf") + "\nserver { server_name bar.baz; }\n" +
+		"\n# " + filepath.Join(tenants, "foo.conf") + "\nserver { server_name foo.bar; }\n"
+	if string(content) != expected {
+		t.Errorf("expected\n%v\nbut got\n%v", expected, string(content))
+	}
+
+	if _, err := runningConfiguration(filepath.Join(dir, "missing.conf")); err == nil {
+		t.Errorf("expected an error reading a missing configuration")
+	}
+}
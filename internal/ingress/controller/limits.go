@@ -0,0 +1,204 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+const (
+	// limitConfigurationSize is the limit of the size of the configuration files
+	limitConfigurationSize = "max-configuration-size"
+	// limitServers is the limit of the number of servers
+	limitServers = "max-servers"
+
+	// largestServers is the number of servers reported when a limit is exceeded
+	largestServers = 5
+
+	startServerMarker = "## start server "
+	endServerMarker   = "## end server "
+)
+
+// serverSize is the size of the server blocks of a hostname in the
+// configuration, with the ingresses defining its locations
+type serverSize struct {
+	hostname  string
+	size      int
+	ingresses []string
+}
+
+// configurationLimitError is returned when the configuration exceeds one of the
+// limits configured in the ConfigMap. The configuration is not applied and NGINX
+// keeps serving the last valid one
+type configurationLimitError struct {
+	limit   string
+	value   int
+	max     int
+	largest []serverSize
+}
+
+func (e *configurationLimitError) Error() string {
+	var msg string
+	if e.limit == limitConfigurationSize {
+		msg = fmt.Sprintf("the configuration size, %v bytes, exceeds the %v of %v bytes", e.value, e.limit, e.max)
+	} else {
+		msg = fmt.Sprintf("the configuration has %v servers, more than the %v of %v", e.value, e.limit, e.max)
+	}
+
+	if len(e.largest) == 0 {
+		return msg
+	}
+
+	servers := make([]string, 0, len(e.largest))
+	for _, s := range e.largest {
+		ingresses := "no ingress"
+		if len(s.ingresses) > 0 {
+			ingresses = strings.Join(s.ingresses, ", ")
+		}
+		servers = append(servers, fmt.Sprintf("%v (%v bytes, %v)", s.hostname, s.size, ingresses))
+	}
+
+	return fmt.Sprintf("%v. Largest servers: %v", msg, strings.Join(servers, "; "))
+}
+
+// serverSizes returns the size of the server blocks of each hostname in the
+// configuration files, from the largest to the smallest
+func serverSizes(ingressCfg ingress.Configuration, content []byte, tenants map[string][]byte) []serverSize {
+	sizes := map[string]int{}
+	files := [][]byte{content}
+	for _, tenant := range tenants {
+		files = append(files, tenant)
+	}
+
+	for _, file := range files {
+		start := map[string]int{}
+		offset := 0
+		scanner := bufio.NewScanner(bytes.NewReader(file))
+		scanner.Buffer(make([]byte, 64*1024), len(file)+1)
+		for scanner.Scan() {
+			begin := offset
+			offset += len(scanner.Bytes()) + 1
+
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, startServerMarker) {
+				start[strings.TrimPrefix(line, startServerMarker)] = begin
+			} else if strings.HasPrefix(line, endServerMarker) {
+				hostname := strings.TrimPrefix(line, endServerMarker)
+				if begin, ok := start[hostname]; ok {
+					sizes[hostname] += offset - begin
+					delete(start, hostname)
+				}
+			}
+		}
+	}
+
+	ingresses := map[string]sets.String{}
+	for _, server := range ingressCfg.Servers {
+		keys := sets.NewString()
+		for _, location := range server.Locations {
+			if location.Ingress != nil {
+				keys.Insert(k8s.MetaNamespaceKey(location.Ingress))
+			}
+		}
+		ingresses[server.Hostname] = keys
+	}
+
+	servers := make([]serverSize, 0, len(sizes))
+	for hostname, size := range sizes {
+		s := serverSize{hostname: hostname, size: size}
+		if keys, ok := ingresses[hostname]; ok {
+			s.ingresses = keys.List()
+		}
+		servers = append(servers, s)
+	}
+
+	sort.SliceStable(servers, func(i, j int) bool {
+		if servers[i].size != servers[j].size {
+			return servers[i].size > servers[j].size
+		}
+		return servers[i].hostname < servers[j].hostname
+	})
+
+	return servers
+}
+
+// checkConfigurationLimits returns a configurationLimitError when the generated
+// configuration exceeds the max-configuration-size or max-servers settings
+func (n *NGINXController) checkConfigurationLimits(cfg ngx_config.Configuration, ingressCfg ingress.Configuration, content []byte, tenants map[string][]byte) error {
+	size := len(content)
+	for _, tenant := range tenants {
+		size += len(tenant)
+	}
+	servers := len(ingressCfg.Servers)
+
+	exceeded := []string{}
+	var err *configurationLimitError
+	if cfg.MaxConfigurationSize > 0 && size > cfg.MaxConfigurationSize {
+		exceeded = append(exceeded, limitConfigurationSize)
+		err = &configurationLimitError{limit: limitConfigurationSize, value: size, max: cfg.MaxConfigurationSize}
+	}
+	if cfg.MaxServers > 0 && servers > cfg.MaxServers {
+		exceeded = append(exceeded, limitServers)
+		if err == nil {
+			err = &configurationLimitError{limit: limitServers, value: servers, max: cfg.MaxServers}
+		}
+	}
+
+	if n.metricCollector != nil {
+		n.metricCollector.SetConfigurationSize(size, servers, exceeded)
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	largest := serverSizes(ingressCfg, content, tenants)
+	if len(largest) > largestServers {
+		largest = largest[:largestServers]
+	}
+	err.largest = largest
+
+	return err
+}
+
+// recordConfigurationLimit reports the configuration exceeding a limit with
+// Events on the controller pod and on the ingresses not applied
+func (n *NGINXController) recordConfigurationLimit(err *configurationLimitError, changed []*ingress.Ingress) {
+	klog.Warningf("Keeping the last valid configuration: %v", err)
+
+	if n.recorder != nil && k8s.IngressPodDetails != nil {
+		n.recorder.Eventf(k8s.IngressPodDetails, apiv1.EventTypeWarning, "ConfigurationTooLarge",
+			"Keeping the last valid configuration, %v", err)
+	}
+
+	for _, ing := range changed {
+		n.recordIngressEvent(ing, apiv1.EventTypeWarning, "ConfigurationTooLarge",
+			fmt.Sprintf("Configuration of the Ingress not applied, %v", err))
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/ingress/metric"
+)
+
+func TestCheckConfigurationLimits(t *testing.T) {
+	server := func(hostname string, lines int) string {
+		return "    ## start server " + hostname + "\n" +
+			"    server {\n" +
+			strings.Repeat("        location / {}\n", lines) +
+			"    }\n" +
+			"    ## end server " + hostname + "\n"
+	}
+	locationOf := func(name string) *ingress.Location {
+		return &ingress.Location{
+			Path: "/",
+			Ingress: &ingress.Ingress{
+				Ingress: networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}},
+			},
+		}
+	}
+
+	content := []byte("http {\n" + server("small.com", 1) + server("large.com", 10) + "}\n")
+	tenants := map[string][]byte{"shop": []byte(server("shop.com", 5))}
+	ingressCfg := ingress.Configuration{
+		Servers: []*ingress.Server{
+			{Hostname: "small.com", Locations: []*ingress.Location{locationOf("small")}},
+			{Hostname: "large.com", Locations: []*ingress.Location{locationOf("large"), locationOf("api")}},
+			{Hostname: "shop.com", Locations: []*ingress.Location{locationOf("shop")}},
+		},
+	}
+	size := len(content) + len(tenants["shop"])
+
+	n := &NGINXController{metricCollector: metric.DummyCollector{}}
+
+	cfg := ngx_config.NewDefault()
+	if err := n.checkConfigurationLimits(cfg, ingressCfg, content, tenants); err != nil {
+		t.Errorf("unexpected error without limits: %v", err)
+	}
+
+	cfg.MaxConfigurationSize = size
+	cfg.MaxServers = 3
+	if err := n.checkConfigurationLimits(cfg, ingressCfg, content, tenants); err != nil {
+		t.Errorf("unexpected error within the limits: %v", err)
+	}
+
+	cfg.MaxConfigurationSize = size - 1
+	err := n.checkConfigurationLimits(cfg, ingressCfg, content, tenants)
+	limitErr, ok := err.(*configurationLimitError)
+	if !ok {
+		t.Fatalf("expected a configurationLimitError but got %v", err)
+	}
+	if limitErr.limit != limitConfigurationSize || limitErr.value != size {
+		t.Errorf("unexpected limit %v with value %v", limitErr.limit, limitErr.value)
+	}
+
+	hostnames := []string{}
+	for _, s := range limitErr.largest {
+		hostnames = append(hostnames, s.hostname)
+	}
+	if expected := []string{"large.com", "shop.com", "small.com"}; !reflect.DeepEqual(hostnames, expected) {
+		t.Errorf("expected the servers %v but got %v", expected, hostnames)
+	}
+	if expected := []string{"default/api", "default/large"}; !reflect.DeepEqual(limitErr.largest[0].ingresses, expected) {
+		t.Errorf("expected the ingresses %v but got %v", expected, limitErr.largest[0].ingresses)
+	}
+	if expected := len(server("large.com", 10)); limitErr.largest[0].size != expected {
+		t.Errorf("expected a size of %v but got %v", expected, limitErr.largest[0].size)
+	}
+	if !strings.Contains(err.Error(), "large.com") {
+		t.Errorf("expected the largest server in the error but got %v", err)
+	}
+
+	cfg.MaxConfigurationSize = 0
+	cfg.MaxServers = 2
+	err = n.checkConfigurationLimits(cfg, ingressCfg, content, tenants)
+	limitErr, ok = err.(*configurationLimitError)
+	if !ok || limitErr.limit != limitServers || limitErr.value != 3 {
+		t.Errorf("expected the max-servers limit to be exceeded but got %v", err)
+	}
+}
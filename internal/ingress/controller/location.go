@@ -21,7 +21,7 @@ import (
 	"strings"
 
 	"github.com/mitchellh/copystructure"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/ingress-nginx/internal/ingress"
 	"k8s.io/klog/v2"
 )
@@ -65,8 +65,11 @@ func updateServerLocations(locations []*ingress.Location) []*ingress.Location {
 			continue
 		}
 
+		// the Prefix /foo/ also matches /foo, the exact location has no trailing slash
+		exactPath := strings.TrimSuffix(location.Path, "/")
+
 		// If exists an Exact location is not possible to create a new one.
-		if _, alreadyExists := exactLocations[location.Path]; alreadyExists {
+		if _, alreadyExists := exactLocations[exactPath]; alreadyExists {
 			// normalize path. Must end in /
 			location.Path = normalizePrefixPath(location.Path)
 			newLocations = append(newLocations, location)
@@ -85,6 +88,7 @@ func updateServerLocations(locations []*ingress.Location) []*ingress.Location {
 
 		// add exact location
 		exactLocation := el.(*ingress.Location)
+		exactLocation.Path = exactPath
 		exactLocation.PathType = &pathTypeExact
 
 		newLocations = append(newLocations, exactLocation)
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+)
+
+func TestUpdateServerLocations(t *testing.T) {
+	exact := networking.PathTypeExact
+	prefix := networking.PathTypePrefix
+
+	type location struct {
+		path     string
+		pathType networking.PathType
+	}
+
+	testCases := []struct {
+		title     string
+		locations []location
+		expected  []location
+	}{
+		{
+			"Prefix adds an exact location",
+			[]location{{"/foo", prefix}},
+			[]location{{"/foo/", prefix}, {"/foo", exact}},
+		},
+		{
+			"Prefix with a trailing slash matches the path without it",
+			[]location{{"/foo/", prefix}},
+			[]location{{"/foo/", prefix}, {"/foo", exact}},
+		},
+		{
+			"Prefix with an existing Exact path",
+			[]location{{"/foo", exact}, {"/foo/", prefix}},
+			[]location{{"/foo", exact}, {"/foo/", prefix}},
+		},
+		{
+			"the root location is not modified",
+			[]location{{"/", prefix}},
+			[]location{{"/", prefix}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			locations := []*ingress.Location{}
+			for _, l := range tc.locations {
+				pathType := l.pathType
+				locations = append(locations, &ingress.Location{Path: l.path, PathType: &pathType})
+			}
+
+			actual := []location{}
+			for _, l := range updateServerLocations(locations) {
+				actual = append(actual, location{l.Path, *l.PathType})
+			}
+
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected %v but returned %v", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -18,7 +18,9 @@ package controller
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -29,6 +31,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -41,8 +44,8 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
-	"k8s.io/client-go/kubernetes/scheme"
-	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/flowcontrol"
 	"k8s.io/klog/v2"
@@ -55,8 +58,12 @@ import (
 	"k8s.io/ingress-nginx/internal/ingress/controller/process"
 	"k8s.io/ingress-nginx/internal/ingress/controller/store"
 	ngx_template "k8s.io/ingress-nginx/internal/ingress/controller/template"
+	"k8s.io/ingress-nginx/internal/ingress/events"
 	"k8s.io/ingress-nginx/internal/ingress/metric"
+	"k8s.io/ingress-nginx/internal/ingress/notifier"
 	"k8s.io/ingress-nginx/internal/ingress/status"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/logging"
 	ing_net "k8s.io/ingress-nginx/internal/net"
 	"k8s.io/ingress-nginx/internal/net/dns"
 	"k8s.io/ingress-nginx/internal/net/ssl"
@@ -68,31 +75,33 @@ import (
 const (
 	tempNginxPattern = "nginx-cfg"
 	emptyUID         = "-1"
+
+	// snippetFragmentsDir is the directory of the include files with the
+	// snippet fragments of the configuration
+	snippetFragmentsDir = "/etc/nginx/fragments"
+
+	// hstsPreloadMinMaxAge is the minimum max-age, one year, of the HSTS
+	// header of the domains in the preload list of the browsers
+	hstsPreloadMinMaxAge = 31536000
 )
 
 // NewNGINXController creates a new NGINX Ingress controller.
 func NewNGINXController(config *Configuration, mc metric.Collector) *NGINXController {
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(klog.Infof)
-	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{
-		Interface: config.Client.CoreV1().Events(config.Namespace),
-	})
-
 	h, err := dns.GetSystemNameServers()
 	if err != nil {
 		klog.Warningf("Error reading system nameservers: %v", err)
 	}
 
 	n := &NGINXController{
-		isIPV6Enabled: ing_net.IsIPv6Enabled(),
+		isIPV6Enabled:  ing_net.IsIPv6Enabled(),
+		openSSLVersion: nginx.OpenSSLVersion(),
 
 		resolver:        h,
 		cfg:             config,
 		syncRateLimiter: flowcontrol.NewTokenBucketRateLimiter(config.SyncRateLimit, 1),
 
-		recorder: eventBroadcaster.NewRecorder(scheme.Scheme, apiv1.EventSource{
-			Component: "nginx-ingress-controller",
-		}),
+		recorder: events.New(config.Client, config.Namespace),
+		notifier: notifier.New(config.Notifications),
 
 		stopCh:   make(chan struct{}),
 		updateCh: channels.NewRingChannel(1024),
@@ -100,13 +109,23 @@ func NewNGINXController(config *Configuration, mc metric.Collector) *NGINXContro
 		ngxErrCh: make(chan error),
 
 		stopLock: &sync.Mutex{},
+		syncLock: &sync.Mutex{},
 
-		runningConfig: new(ingress.Configuration),
+		runningConfig:     new(ingress.Configuration),
+		runningConfigLock: &sync.RWMutex{},
 
 		Proxy: &TCPProxy{},
 
 		metricCollector: mc,
 
+		protocolMismatches: &protocolMismatchDetector{},
+
+		globalRateLimitPeers: &globalRateLimitPeers{client: config.Client},
+
+		authJWTKeys: newAuthJWTKeyCache(),
+
+		snapshots: newSnapshotStore(snapshotsDir, config.ConfigurationSnapshots),
+
 		command: NewNginxCommand(),
 	}
 
@@ -122,27 +141,52 @@ func NewNGINXController(config *Configuration, mc metric.Collector) *NGINXContro
 		}
 	}
 
+	// the GlobalRateLimitPolicies are not watched unless their custom
+	// resource definition is installed
+	var dynamicClient dynamic.Interface
+	if config.WatchGlobalRateLimitPolicies {
+		dynamicClient = config.DynamicClient
+	}
+
 	n.store = store.New(
 		config.Namespace,
 		config.ConfigMapName,
+		config.ConfigMapOverlays,
 		config.TCPConfigMapName,
 		config.UDPConfigMapName,
 		config.DefaultSSLCertificate,
 		config.ResyncPeriod,
 		config.Client,
+		dynamicClient,
 		n.updateCh,
 		config.DisableCatchAll)
 
-	n.syncQueue = task.NewTaskQueue(n.syncIngress)
+	if config.ShadowMode {
+		n.canaryAnalyzer = &canaryAnalyzer{}
+	} else {
+		n.canaryAnalyzer = newCanaryAnalyzer(config.Client, n.electionID())
+	}
+
+	if config.ConfigMapRolloutSelector != nil && !config.ConfigMapRolloutSelector.Empty() && !config.ShadowMode {
+		n.configMapRollout = newConfigMapRollout(config.Client, n.electionID(), config.ConfigMapRolloutSelector, config.ConfigMapRolloutSoakPeriod)
+		n.store.SetConfigMapGate(n.configMapRollout.gate)
+	}
+
+	if config.ShadowMode {
+		n.syncQueue = task.NewTaskQueue(n.syncShadow)
+	} else {
+		n.syncQueue = task.NewTaskQueue(n.syncIngress)
+	}
 
-	if config.UpdateStatus {
+	if config.UpdateStatus && !config.ShadowMode {
 		n.syncStatus = status.NewStatusSyncer(status.Config{
-			Client:                 config.Client,
-			PublishService:         config.PublishService,
-			PublishStatusAddress:   config.PublishStatusAddress,
-			IngressLister:          n.store,
-			UpdateStatusOnShutdown: config.UpdateStatusOnShutdown,
-			UseNodeInternalIP:      config.UseNodeInternalIP,
+			Client:                    config.Client,
+			PublishService:            config.PublishService,
+			PublishStatusAddress:      config.PublishStatusAddress,
+			IngressLister:             n.store,
+			UpdateStatusOnShutdown:    config.UpdateStatusOnShutdown,
+			UseNodeInternalIP:         config.UseNodeInternalIP,
+			UpdateConfigurationStatus: config.UpdateConfigurationStatus,
 		})
 	} else {
 		klog.Warning("Update of Ingress status is disabled (flag --update-status)")
@@ -210,6 +254,10 @@ type NGINXController struct {
 
 	recorder record.EventRecorder
 
+	// notifier sends the events of the controller to the webhooks, nil
+	// when no webhook is configured
+	notifier *notifier.Webhook
+
 	syncQueue *task.Queue
 
 	syncStatus status.Syncer
@@ -221,14 +269,65 @@ type NGINXController struct {
 	// allowing concurrent stoppers leads to stack traces.
 	stopLock *sync.Mutex
 
+	// syncLock serializes syncIngress and the renderings of the
+	// configuration of the introspection handlers, which share the state
+	// updated by getConfiguration
+	syncLock *sync.Mutex
+
 	stopCh   chan struct{}
 	updateCh *channels.RingChannel
 
 	// ngxErrCh is used to detect errors with the NGINX processes
 	ngxErrCh chan error
 
-	// runningConfig contains the running configuration in the Backend
+	// runningConfig contains the running configuration in the Backend. It
+	// is replaced by syncIngress and never modified, the other goroutines
+	// read it with getRunningConfig.
 	runningConfig *ingress.Configuration
+	// runningConfigLock protects runningConfig, quarantinedIngresses and
+	// configurationStatus, which are replaced by syncIngress and read by the
+	// introspection handlers
+	runningConfigLock *sync.RWMutex
+
+	// quarantinedIngresses contains the reason of the exclusion of each
+	// ingress quarantined by the last reload
+	quarantinedIngresses map[string]string
+
+	// configMapRollout applies the changes of the configuration ConfigMaps
+	// to the canary replicas first, nil when disabled
+	configMapRollout *configMapRollout
+
+	// ignoredIngresses contains the reason of each ingress that does not
+	// route any request to its backends, reported by the last sync
+	ignoredIngresses map[string]string
+
+	// pathPriorityConflicts contains the path-priority conflicts reported by
+	// the last sync, their events are only recorded when they appear
+	pathPriorityConflicts map[string]bool
+
+	// configurationStatus contains the last status of the configuration of
+	// each ingress
+	configurationStatus map[string]status.ConfigurationStatus
+
+	// canaryAnalyzer rolls back the canary ingresses breaching the
+	// thresholds of their canary-analysis annotations
+	canaryAnalyzer *canaryAnalyzer
+
+	// protocolMismatches reports the ingresses whose backends fail the
+	// negotiation of the protocol of their backend-protocol annotation
+	protocolMismatches *protocolMismatchDetector
+
+	// globalRateLimitPeers contains the other pods of the controller the
+	// global rate limits are replicated to, with the local-sync mode
+	globalRateLimitPeers *globalRateLimitPeers
+
+	// authJWTKeys fetches the JSON Web Key Sets of the auth-jwt annotations
+	// for the NGINX workers
+	authJWTKeys *authJWTKeyCache
+
+	// snapshots keeps the configurations of the last reloads, nil when
+	// disabled
+	snapshots *snapshotStore
 
 	t ngx_template.TemplateWriter
 
@@ -236,6 +335,10 @@ type NGINXController struct {
 
 	isIPV6Enabled bool
 
+	// openSSLVersion is the version of the OpenSSL library used by NGINX,
+	// empty when unknown
+	openSSLVersion string
+
 	isShuttingDown bool
 
 	Proxy *TCPProxy
@@ -249,18 +352,30 @@ type NGINXController struct {
 	command NginxExecTester
 }
 
+// electionID returns the name of the leader election, with the ingress class
+// to allow multiple leaders
+func (n *NGINXController) electionID() string {
+	if class.IngressClass != "" {
+		return fmt.Sprintf("%v-%v", n.cfg.ElectionID, class.IngressClass)
+	}
+
+	return fmt.Sprintf("%v-%v", n.cfg.ElectionID, class.DefaultClass)
+}
+
 // Start starts a new NGINX master process running in the foreground.
 func (n *NGINXController) Start() {
 	klog.InfoS("Starting NGINX Ingress controller")
 
 	n.store.Run(n.stopCh)
 
+	if n.cfg.ShadowMode {
+		n.runShadow()
+		return
+	}
+
 	// we need to use the defined ingress class to allow multiple leaders
 	// in order to update information about ingress status
-	electionID := fmt.Sprintf("%v-%v", n.cfg.ElectionID, class.DefaultClass)
-	if class.IngressClass != "" {
-		electionID = fmt.Sprintf("%v-%v", n.cfg.ElectionID, class.IngressClass)
-	}
+	electionID := n.electionID()
 
 	setupLeaderElection(&leaderElectionConfig{
 		Client:     n.cfg.Client,
@@ -273,7 +388,7 @@ func (n *NGINXController) Start() {
 			n.metricCollector.OnStartedLeading(electionID)
 			// manually update SSL expiration metrics
 			// (to not wait for a reload)
-			n.metricCollector.SetSSLExpireTime(n.runningConfig.Servers)
+			n.metricCollector.SetSSLExpireTime(n.getRunningConfig().Servers)
 		},
 		OnStoppedLeading: func() {
 			n.metricCollector.OnStoppedLeading(electionID)
@@ -297,9 +412,27 @@ func (n *NGINXController) Start() {
 	n.start(cmd)
 
 	go n.syncQueue.Run(time.Second, n.stopCh)
+	if n.cfg.SyncWatchdogTimeout > 0 {
+		go newSyncWatchdog(n.syncQueue, n.cfg.SyncWatchdogTimeout, n.cfg.SyncWatchdogRestart, n.metricCollector).Run(n.stopCh)
+	}
 	// force initial sync
 	n.syncQueue.EnqueueTask(task.GetDummyObject("initial-sync"))
 
+	if n.cfg.EnableMetrics {
+		go wait.Until(n.analyzeCanaries, canaryAnalysisPeriod, n.stopCh)
+		go wait.Until(n.detectProtocolMismatches, protocolMismatchPeriod, n.stopCh)
+	}
+
+	go n.syncGlobalRateLimits(n.stopCh)
+	go n.syncAuthJWTKeys(n.stopCh)
+	go n.reportOCSPStaplingFailures(n.stopCh)
+	go n.notifier.Run(n.stopCh)
+	go n.checkExpiringCertificates(n.stopCh)
+
+	if n.configMapRollout != nil {
+		go wait.Until(n.syncConfigMapRollout, configMapRolloutPeriod, n.stopCh)
+	}
+
 	// In case of error the temporal configuration file will
 	// be available up to five minutes after the error
 	go func() {
@@ -384,6 +517,10 @@ func (n *NGINXController) Stop() error {
 		}
 	}
 
+	if n.cfg.ShadowMode {
+		return nil
+	}
+
 	// send stop signal to NGINX
 	klog.InfoS("Stopping NGINX process")
 	cmd := n.command.ExecCommand("-s", "quit")
@@ -430,8 +567,10 @@ func (n NGINXController) DefaultEndpoint() ingress.Endpoint {
 	}
 }
 
-// generateTemplate returns the nginx configuration file content
-func (n NGINXController) generateTemplate(cfg ngx_config.Configuration, ingressCfg ingress.Configuration) ([]byte, error) {
+// generateTemplate returns the nginx configuration file content and, when tenant
+// isolation is enabled, the content of the include file of each tenant located
+// in the directory tenantsDir
+func (n NGINXController) generateTemplate(cfg ngx_config.Configuration, ingressCfg ingress.Configuration, tenantsDir string) ([]byte, map[string][]byte, error) {
 
 	if n.cfg.EnableSSLPassthrough {
 		servers := []*TCPServer{}
@@ -467,6 +606,16 @@ func (n NGINXController) generateTemplate(cfg ngx_config.Configuration, ingressC
 			})
 		}
 
+		// servers with HTTP/2 disabled are served in a different port
+		for _, hostname := range http2DisabledHosts(ingressCfg.Servers, cfg) {
+			servers = append(servers, &TCPServer{
+				Hostname:      hostname,
+				IP:            "127.0.0.1",
+				Port:          n.cfg.ListenPorts.HTTP1SSLProxy,
+				ProxyProtocol: true,
+			})
+		}
+
 		n.Proxy.ServerList = servers
 	}
 
@@ -563,7 +712,9 @@ func (n NGINXController) generateTemplate(cfg ngx_config.Configuration, ingressC
 		} else {
 			nsSecName := strings.Replace(secretName, "/", "-", -1)
 			dh, ok := secret.Data["dhparam.pem"]
-			if ok {
+			if !ok {
+				klog.Warningf("Secret %q does not contain the key dhparam.pem", secretName)
+			} else {
 				pemFileName, err := ssl.AddOrUpdateDHParam(nsSecName, dh)
 				if err != nil {
 					klog.Warningf("Error adding or updating dhparam file %v: %v", nsSecName, err)
@@ -578,6 +729,10 @@ func (n NGINXController) generateTemplate(cfg ngx_config.Configuration, ingressC
 
 	cfg.DefaultSSLCertificate = n.getDefaultSSLCertificate()
 
+	isIPV6Enabled := n.isIPV6Enabled && !cfg.DisableIpv6 && cfg.ListenAddressFamily != ngx_config.ListenAddressFamilyIPv4
+	isSNIConnLimitEnabled := !n.cfg.EnableSSLPassthrough && cfg.LimitConnPerSNI > 0
+	disabledHTTP2 := http2DisabledHosts(ingressCfg.Servers, cfg)
+
 	tc := ngx_config.TemplateConfig{
 		ProxySetHeaders:          setHeaders,
 		AddHeaders:               addHeaders,
@@ -588,17 +743,25 @@ func (n NGINXController) generateTemplate(cfg ngx_config.Configuration, ingressC
 		TCPBackends:              ingressCfg.TCPEndpoints,
 		UDPBackends:              ingressCfg.UDPEndpoints,
 		Cfg:                      cfg,
-		IsIPV6Enabled:            n.isIPV6Enabled && !cfg.DisableIpv6,
+		IsIPV6Enabled:            isIPV6Enabled,
+		IsIPV6Only:               isIPV6Enabled && cfg.ListenAddressFamily == ngx_config.ListenAddressFamilyIPv6,
 		NginxStatusIpv4Whitelist: cfg.NginxStatusIpv4Whitelist,
 		NginxStatusIpv6Whitelist: cfg.NginxStatusIpv6Whitelist,
 		RedirectServers:          buildRedirects(ingressCfg.Servers),
 		IsSSLPassthroughEnabled:  n.cfg.EnableSSLPassthrough,
+		IsEchoBackendEnabled:     n.cfg.EnableEchoBackend,
+		IsEdgeFunctionsEnabled:   n.cfg.EnableEdgeFunctions,
+		SnippetFragmentsDir:      snippetFragmentsDir,
+		IsSNIConnLimitEnabled:    isSNIConnLimitEnabled,
+		IsSSLPrereadEnabled:      isSNIConnLimitEnabled || (!n.cfg.EnableSSLPassthrough && (len(disabledHTTP2) > 0 || n.cfg.ListenPorts.MixedProtocol > 0)),
+		HTTP2DisabledHosts:       disabledHTTP2,
 		ListenPorts:              n.cfg.ListenPorts,
 		PublishService:           n.GetPublishService(),
 		EnableMetrics:            n.cfg.EnableMetrics,
 		MaxmindEditionFiles:      n.cfg.MaxmindEditionFiles,
 		HealthzURI:               nginx.HealthPath,
 		MonitorMaxBatchSize:      n.cfg.MonitorMaxBatchSize,
+		OpenSSLVersion:           n.openSSLVersion,
 		PID:                      nginx.PID,
 		StatusPath:               nginx.StatusPath,
 		StatusPort:               nginx.StatusPort,
@@ -607,7 +770,25 @@ func (n NGINXController) generateTemplate(cfg ngx_config.Configuration, ingressC
 
 	tc.Cfg.Checksum = ingressCfg.ConfigurationChecksum
 
-	return n.t.Write(tc)
+	if !cfg.EnableTenantIsolation {
+		content, err := n.t.Write(tc)
+		return content, nil, err
+	}
+
+	tc.Tenants = buildTenants(ingressCfg.Servers, tenantsDir)
+
+	tenants := make(map[string][]byte, len(tc.Tenants))
+	for _, tenant := range tc.Tenants {
+		content, err := n.t.WriteTenant(tc, tenant)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tenants[tenant.Namespace] = content
+	}
+
+	content, err := n.t.Write(tc)
+	return content, tenants, err
 }
 
 // testTemplate checks if the NGINX configuration inside the byte array is valid
@@ -642,57 +823,162 @@ Error: %v
 	return nil
 }
 
+// testConfiguration checks if the NGINX configuration generated
+// from the backend Configuration is valid
+func (n NGINXController) testConfiguration(cfg ngx_config.Configuration, ingressCfg ingress.Configuration) error {
+	if cfg.EnableTenantIsolation {
+		_, err := n.testTenantTemplate(cfg, ingressCfg)
+		return err
+	}
+
+	content, _, err := n.generateTemplate(cfg, ingressCfg, "")
+	if err != nil {
+		return err
+	}
+
+	return n.testTemplate(content)
+}
+
+// diffConfiguration returns the unified diff between the NGINX configuration
+// file path and the configuration content
+func diffConfiguration(path string, content []byte) ([]byte, error) {
+	tmpfile, err := ioutil.TempFile("", "new-nginx-cfg")
+	if err != nil {
+		return nil, err
+	}
+	defer tmpfile.Close()
+	err = ioutil.WriteFile(tmpfile.Name(), content, file.ReadWriteByUser)
+	if err != nil {
+		return nil, err
+	}
+
+	diffOutput, err := exec.Command("diff", "-I", "^# Configuration.*", "-u", path, tmpfile.Name()).CombinedOutput()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			ws := exitError.Sys().(syscall.WaitStatus)
+			if ws.ExitStatus() == 2 {
+				logging.Sync.Warningf("Failed to executing diff command: %v", err)
+			}
+		}
+	}
+
+	// we do not defer the deletion of temp files in order
+	// to keep them around for inspection in case of error
+	os.Remove(tmpfile.Name())
+
+	return diffOutput, nil
+}
+
+// renderConfiguration returns the NGINX configuration of the Ingresses of the
+// store, the one the next synchronization would write. NGINX is neither tested
+// nor reloaded.
+func (n *NGINXController) renderConfiguration() ([]byte, error) {
+	n.syncLock.Lock()
+	defer n.syncLock.Unlock()
+
+	// the configuration is not applied, its conflicts are neither recorded
+	// in the Ingresses nor notified, and the servers of the SSL Passthrough
+	// proxy are updated by the template
+	dryRun := *n
+	dryRun.recorder = nil
+	dryRun.notifier = nil
+	dryRun.Proxy = &TCPProxy{}
+
+	_, _, pcfg := dryRun.getConfiguration(n.store.ListIngresses())
+
+	cfg := n.store.GetBackendConfiguration()
+	cfg.Resolver = n.resolver
+
+	content, _, err := dryRun.generateTemplate(cfg, *pcfg, tenantsDir)
+	return content, err
+}
+
 // OnUpdate is called by the synchronization loop whenever configuration
 // changes were detected. The received backend Configuration is merged with the
 // configuration ConfigMap before generating the final configuration file.
 // Returns nil in case the backend was successfully reloaded.
 func (n *NGINXController) OnUpdate(ingressCfg ingress.Configuration) error {
+	n.snapshots.lock()
+	defer n.snapshots.unlock()
+
+	if n.snapshots.rolledBackTo() != "" {
+		return errConfigurationRolledBack
+	}
+
 	cfg := n.store.GetBackendConfiguration()
 	cfg.Resolver = n.resolver
 
-	content, err := n.generateTemplate(cfg, ingressCfg)
+	err := createOpentracingCfg(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = createOpentelemetryCfg(cfg)
+	if err != nil {
+		return err
+	}
+
+	// the fragments are included by the configuration tested below
+	fragments := make(map[string][]byte, len(cfg.SnippetFragments))
+	for name, fragment := range cfg.SnippetFragments {
+		fragments[name] = []byte(fragment)
+	}
+	err = writeIncludeFiles(snippetFragmentsDir, fragments)
 	if err != nil {
 		return err
 	}
 
-	err = createOpentracingCfg(cfg)
+	if cfg.HSTS && cfg.HSTSPreload {
+		if err := checkHSTSPreload(cfg, httpsServicePort(n.GetPublishService(), n.cfg.ListenPorts.HTTPS)); err != nil {
+			klog.Warningf("Disabling the preload attribute of the HSTS header: %v", err)
+			if n.recorder != nil && k8s.IngressPodDetails != nil {
+				n.recorder.Eventf(k8s.IngressPodDetails, apiv1.EventTypeWarning, "HSTSPreload",
+					"Disabling the preload attribute of the HSTS header: %v", err)
+			}
+			cfg.HSTSPreload = false
+		}
+	}
+
+	if cfg.EnableTenantIsolation {
+		ingressCfg, err = n.quarantineTenants(cfg, ingressCfg, n.recordQuarantine)
+		if err != nil {
+			return err
+		}
+	}
+
+	content, tenants, err := n.generateTemplate(cfg, ingressCfg, tenantsDir)
 	if err != nil {
 		return err
 	}
 
-	err = n.testTemplate(content)
+	err = n.checkConfigurationLimits(cfg, ingressCfg, content, tenants)
 	if err != nil {
 		return err
 	}
 
-	if klog.V(2).Enabled() {
+	if !cfg.EnableTenantIsolation {
+		err = n.testTemplate(content)
+		if err != nil {
+			return err
+		}
+	}
+
+	if logging.Sync.V(2).Enabled() {
 		src, _ := ioutil.ReadFile(cfgPath)
 		if !bytes.Equal(src, content) {
-			tmpfile, err := ioutil.TempFile("", "new-nginx-cfg")
+			diffOutput, err := diffConfiguration(cfgPath, content)
 			if err != nil {
 				return err
 			}
-			defer tmpfile.Close()
-			err = ioutil.WriteFile(tmpfile.Name(), content, file.ReadWriteByUser)
-			if err != nil {
-				return err
-			}
-
-			diffOutput, err := exec.Command("diff", "-I", "'# Configuration.*'", "-u", cfgPath, tmpfile.Name()).CombinedOutput()
-			if err != nil {
-				if exitError, ok := err.(*exec.ExitError); ok {
-					ws := exitError.Sys().(syscall.WaitStatus)
-					if ws.ExitStatus() == 2 {
-						klog.Warningf("Failed to executing diff command: %v", err)
-					}
-				}
-			}
 
-			klog.InfoS("NGINX configuration change", "diff", string(diffOutput))
+			logging.Sync.InfoS("NGINX configuration change", "diff", string(diffOutput))
+		}
+	}
 
-			// we do not defer the deletion of temp files in order
-			// to keep them around for inspection in case of error
-			os.Remove(tmpfile.Name())
+	if cfg.EnableTenantIsolation {
+		err = writeIncludeFiles(tenantsDir, tenants)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -706,9 +992,38 @@ func (n *NGINXController) OnUpdate(ingressCfg ingress.Configuration) error {
 		return fmt.Errorf("%v\n%v", err, string(o))
 	}
 
+	if n.metricCollector != nil {
+		n.metricCollector.SetConfigurationFileHash(configurationFileHash(content, tenants))
+	}
+
+	err = n.snapshots.save(newSnapshot(ingressCfg, content, tenants, fragments))
+	if err != nil {
+		klog.Warningf("Error saving the snapshot of the configuration: %v", err)
+	}
+
 	return nil
 }
 
+// configurationFileHash returns the SHA256 checksum of the configuration
+// files, nginx.conf followed by the files of the tenants sorted by namespace.
+// The same configuration always produces the same files and checksum
+func configurationFileHash(content []byte, tenants map[string][]byte) string {
+	h := sha256.New()
+	h.Write(content)
+
+	namespaces := make([]string, 0, len(tenants))
+	for namespace := range tenants {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		h.Write(tenants[namespace])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 // nginxHashBucketSize computes the correct NGINX hash_bucket_size for a hash
 // with the given longest key.
 func nginxHashBucketSize(longestString int) int {
@@ -734,6 +1049,83 @@ func nextPowerOf2(v int) int {
 	return v
 }
 
+// checkHSTSPreload returns an error when the HSTS header does not meet the
+// requirements of the preload list of the browsers: the subdomains must be
+// included, the max-age must be of at least one year and HTTPS must be
+// served in the port 443
+func checkHSTSPreload(cfg ngx_config.Configuration, httpsPort int) error {
+	var reasons []string
+
+	if !cfg.HSTSIncludeSubdomains {
+		reasons = append(reasons, "hsts-include-subdomains is disabled")
+	}
+
+	maxAge, err := strconv.Atoi(cfg.HSTSMaxAge)
+	if err != nil || maxAge < hstsPreloadMinMaxAge {
+		reasons = append(reasons, fmt.Sprintf("hsts-max-age %v is lower than %v", cfg.HSTSMaxAge, hstsPreloadMinMaxAge))
+	}
+
+	if httpsPort != 443 {
+		reasons = append(reasons, fmt.Sprintf("HTTPS is served in the port %v instead of 443", httpsPort))
+	}
+
+	if len(reasons) > 0 {
+		return fmt.Errorf("%v", strings.Join(reasons, ", "))
+	}
+
+	return nil
+}
+
+// httpsServicePort returns the port the clients use to reach the HTTPS port
+// of the controller, the port of the publish service targeting it or the
+// HTTPS port itself without publish service
+func httpsServicePort(svc *apiv1.Service, httpsPort int) int {
+	if svc == nil {
+		return httpsPort
+	}
+
+	for _, port := range svc.Spec.Ports {
+		if port.Protocol != "" && port.Protocol != apiv1.ProtocolTCP {
+			continue
+		}
+
+		switch port.TargetPort.Type {
+		case intstr.String:
+			if port.TargetPort.StrVal == "https" {
+				return int(port.Port)
+			}
+		default:
+			if port.TargetPort.IntValue() == httpsPort ||
+				(port.TargetPort.IntValue() == 0 && int(port.Port) == httpsPort) {
+				return int(port.Port)
+			}
+		}
+	}
+
+	return httpsPort
+}
+
+// http2DisabledHosts returns the server names (hostnames and aliases) of the
+// servers with HTTP/2 disabled. nginx enables HTTP/2 per listening port,
+// connections to these servers are routed by SNI to a port without HTTP/2.
+func http2DisabledHosts(servers []*ingress.Server, cfg ngx_config.Configuration) []string {
+	hosts := []string{}
+	if !cfg.UseHTTP2 {
+		return hosts
+	}
+
+	for _, server := range servers {
+		if !server.HTTP2.Disabled || server.SSLPassthrough || server.Hostname == defServerName {
+			continue
+		}
+
+		hosts = append(hosts, server.Hostname)
+		hosts = append(hosts, server.Aliases...)
+	}
+
+	return hosts
+}
+
 func (n *NGINXController) setupSSLProxy() {
 	cfg := n.store.GetBackendConfiguration()
 	sslPort := n.cfg.ListenPorts.HTTPS
@@ -793,6 +1185,18 @@ func clearCertificates(config *ingress.Configuration) {
 	config.Servers = clearedServers
 }
 
+// Helper function to clear the content of the default certificate, served by Lua from the
+// "_" server, keeping only the file NGINX loads as fallback before the certificates are configured.
+func clearDefaultCertificate(config *ingress.Configuration) {
+	if config.DefaultSSLCertificate == nil {
+		return
+	}
+
+	config.DefaultSSLCertificate = &ingress.SSLCert{
+		PemFileName: config.DefaultSSLCertificate.PemFileName,
+	}
+}
+
 // Helper function to clear endpoints from the ingress configuration since they should be ignored when
 // checking if the new configuration changes can be applied dynamically.
 func clearL4serviceEndpoints(config *ingress.Configuration) {
@@ -820,6 +1224,23 @@ func clearL4serviceEndpoints(config *ingress.Configuration) {
 	config.UDPEndpoints = clearedUDPL4Services
 }
 
+// getRunningConfig returns the running configuration, which must not be
+// modified
+func (n *NGINXController) getRunningConfig() *ingress.Configuration {
+	n.runningConfigLock.RLock()
+	defer n.runningConfigLock.RUnlock()
+
+	return n.runningConfig
+}
+
+// setRunningConfig replaces the running configuration
+func (n *NGINXController) setRunningConfig(pcfg *ingress.Configuration) {
+	n.runningConfigLock.Lock()
+	defer n.runningConfigLock.Unlock()
+
+	n.runningConfig = pcfg
+}
+
 // IsDynamicConfigurationEnough returns whether a Configuration can be
 // dynamically applied, without reloading the backend.
 func (n *NGINXController) IsDynamicConfigurationEnough(pcfg *ingress.Configuration) bool {
@@ -835,6 +1256,33 @@ func (n *NGINXController) IsDynamicConfigurationEnough(pcfg *ingress.Configurati
 	clearCertificates(&copyOfRunningConfig)
 	clearCertificates(&copyOfPcfg)
 
+	clearDefaultCertificate(&copyOfRunningConfig)
+	clearDefaultCertificate(&copyOfPcfg)
+
+	copyOfRunningConfig.BotDetectionRules = nil
+	copyOfPcfg.BotDetectionRules = nil
+
+	copyOfRunningConfig.BotDetectionSecret = ""
+	copyOfPcfg.BotDetectionSecret = ""
+
+	copyOfRunningConfig.GlobalRateLimitRedisPassword = ""
+	copyOfPcfg.GlobalRateLimitRedisPassword = ""
+
+	copyOfRunningConfig.GlobalRateLimitKeyHashSecret = ""
+	copyOfPcfg.GlobalRateLimitKeyHashSecret = ""
+
+	copyOfRunningConfig.TimeWindows = nil
+	copyOfPcfg.TimeWindows = nil
+
+	copyOfRunningConfig.PluginFlags = nil
+	copyOfPcfg.PluginFlags = nil
+
+	copyOfRunningConfig.OpenAPISpecs = nil
+	copyOfPcfg.OpenAPISpecs = nil
+
+	copyOfRunningConfig.BodyFilterSnippets = nil
+	copyOfPcfg.BodyFilterSnippets = nil
+
 	return copyOfRunningConfig.Equal(&copyOfPcfg)
 }
 
@@ -857,7 +1305,10 @@ func (n *NGINXController) configureDynamically(pcfg *ingress.Configuration) erro
 		}
 	}
 
-	serversChanged := !reflect.DeepEqual(n.runningConfig.Servers, pcfg.Servers)
+	// the default certificate, served from the "_" server, is rotated without
+	// a reload, see IsDynamicConfigurationEnough
+	serversChanged := !reflect.DeepEqual(n.runningConfig.Servers, pcfg.Servers) ||
+		!n.runningConfig.DefaultSSLCertificate.Equal(pcfg.DefaultSSLCertificate)
 	if serversChanged {
 		err := configureCertificates(pcfg.Servers)
 		if err != nil {
@@ -865,6 +1316,61 @@ func (n *NGINXController) configureDynamically(pcfg *ingress.Configuration) erro
 		}
 	}
 
+	botDetectionChanged := !reflect.DeepEqual(n.runningConfig.BotDetectionRules, pcfg.BotDetectionRules) ||
+		n.runningConfig.BotDetectionSecret != pcfg.BotDetectionSecret
+	if botDetectionChanged {
+		err := configureBotDetection(pcfg.BotDetectionRules, pcfg.BotDetectionSecret)
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.runningConfig.GlobalRateLimitRedisPassword != pcfg.GlobalRateLimitRedisPassword {
+		err := configureGlobalRateLimitRedis(pcfg.GlobalRateLimitRedisPassword)
+		if err != nil {
+			return err
+		}
+	}
+
+	if n.runningConfig.GlobalRateLimitKeyHashSecret != pcfg.GlobalRateLimitKeyHashSecret {
+		err := configureGlobalRateLimitKeyHash(pcfg.GlobalRateLimitKeyHashSecret)
+		if err != nil {
+			return err
+		}
+	}
+
+	timeWindowsChanged := !reflect.DeepEqual(n.runningConfig.TimeWindows, pcfg.TimeWindows)
+	if timeWindowsChanged {
+		err := configureTimeWindows(pcfg.TimeWindows)
+		if err != nil {
+			return err
+		}
+	}
+
+	pluginFlagsChanged := !reflect.DeepEqual(n.runningConfig.PluginFlags, pcfg.PluginFlags)
+	if pluginFlagsChanged {
+		err := configurePluginFlags(pcfg.PluginFlags)
+		if err != nil {
+			return err
+		}
+	}
+
+	openAPISpecsChanged := !reflect.DeepEqual(n.runningConfig.OpenAPISpecs, pcfg.OpenAPISpecs)
+	if openAPISpecsChanged {
+		err := configureOpenAPISpecs(pcfg.OpenAPISpecs)
+		if err != nil {
+			return err
+		}
+	}
+
+	bodyFilterSnippetsChanged := !reflect.DeepEqual(n.runningConfig.BodyFilterSnippets, pcfg.BodyFilterSnippets)
+	if bodyFilterSnippetsChanged {
+		err := configureBodyFilterSnippets(pcfg.BodyFilterSnippets)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -942,6 +1448,7 @@ func configureBackends(rawBackends []*ingress.Backend) error {
 			NoServer:             backend.NoServer,
 			TrafficShapingPolicy: backend.TrafficShapingPolicy,
 			AlternativeBackends:  backend.AlternativeBackends,
+			FailoverEndpoints:    backend.FailoverEndpoints,
 		}
 
 		var endpoints []ingress.Endpoint
@@ -971,6 +1478,9 @@ func configureBackends(rawBackends []*ingress.Backend) error {
 type sslConfiguration struct {
 	Certificates map[string]string `json:"certificates"`
 	Servers      map[string]string `json:"servers"`
+	// MustStaple contains the UIDs of the certificates with the OCSP
+	// must-staple extension not served without a stapled OCSP response
+	MustStaple map[string]bool `json:"must_staple,omitempty"`
 }
 
 // configureCertificates JSON encodes certificates and POSTs it to an internal HTTP endpoint
@@ -979,6 +1489,7 @@ func configureCertificates(rawServers []*ingress.Server) error {
 	configuration := &sslConfiguration{
 		Certificates: map[string]string{},
 		Servers:      map[string]string{},
+		MustStaple:   map[string]bool{},
 	}
 
 	configure := func(hostname string, sslCert *ingress.SSLCert) {
@@ -998,6 +1509,10 @@ func configureCertificates(rawServers []*ingress.Server) error {
 	for _, rawServer := range rawServers {
 		configure(rawServer.Hostname, rawServer.SSLCert)
 
+		if rawServer.OCSPMustStaple && rawServer.SSLCert != nil && ssl.HasMustStaple(rawServer.SSLCert.Certificate) {
+			configuration.MustStaple[rawServer.SSLCert.UID] = true
+		}
+
 		for _, alias := range rawServer.Aliases {
 			if rawServer.SSLCert != nil && ssl.IsValidHostname(alias, rawServer.SSLCert.CN) {
 				configuration.Servers[alias] = rawServer.SSLCert.UID
@@ -1096,6 +1611,54 @@ func createOpentracingCfg(cfg ngx_config.Configuration) error {
 	return ioutil.WriteFile("/etc/nginx/opentracing.json", []byte(expanded), file.ReadWriteByUser)
 }
 
+const opentelemetryTmpl = `exporter = "otlp"
+processor = "batch"
+
+[exporters.otlp]
+host = "{{ .OtlpCollectorHost }}"
+port = {{ .OtlpCollectorPort }}
+
+[processors.batch]
+max_queue_size = 2048
+schedule_delay_millis = 5000
+max_export_batch_size = 512
+
+[service]
+name = "{{ .OtelServiceName }}"
+
+[sampler]
+name = "{{ .OtelSampler }}"
+ratio = {{ .OtelSamplerRatio }}
+parent_based = {{ .OtelSamplerParentBased }}
+`
+
+// buildOpentelemetryCfg returns the configuration of the exporter and the
+// sampler of the OpenTelemetry module
+func buildOpentelemetryCfg(cfg ngx_config.Configuration) (string, error) {
+	tmpl, err := template.New("opentelemetry").Parse(opentelemetryTmpl)
+	if err != nil {
+		return "", err
+	}
+
+	tmplBuf := bytes.NewBuffer(make([]byte, 0))
+	err = tmpl.Execute(tmplBuf, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	// Expand possible environment variables before writing the configuration to file.
+	return os.ExpandEnv(tmplBuf.String()), nil
+}
+
+func createOpentelemetryCfg(cfg ngx_config.Configuration) error {
+	content, err := buildOpentelemetryCfg(cfg)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile("/etc/nginx/opentelemetry.toml", []byte(content), file.ReadWriteByUser)
+}
+
 func cleanTempNginxCfg() error {
 	var files []string
 
@@ -17,6 +17,9 @@ limitations under the License.
 package controller
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -25,14 +28,18 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/http2"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
 	"k8s.io/ingress-nginx/internal/nginx"
 )
 
@@ -148,6 +155,45 @@ func TestIsDynamicConfigurationEnough(t *testing.T) {
 	}
 }
 
+func TestIsDynamicConfigurationEnoughDefaultCertificate(t *testing.T) {
+	defaultCertificate := &ingress.SSLCert{
+		PemFileName: "/etc/ingress-controller/ssl/default-default-cert.pem",
+		PemSHA:      "a",
+		PemCertKey:  "default-certificate",
+	}
+
+	n := &NGINXController{
+		runningConfig: &ingress.Configuration{
+			DefaultSSLCertificate: defaultCertificate,
+		},
+		cfg: &Configuration{},
+	}
+
+	newConfig := &ingress.Configuration{
+		DefaultSSLCertificate: &ingress.SSLCert{
+			PemFileName: "/etc/ingress-controller/ssl/default-default-cert.pem",
+			PemSHA:      "b",
+			PemCertKey:  "new-default-certificate",
+		},
+	}
+	if !n.IsDynamicConfigurationEnough(newConfig) {
+		t.Errorf("Expected to be dynamically configurable when only the default certificate content changes")
+	}
+
+	if n.runningConfig.DefaultSSLCertificate.PemSHA != "a" {
+		t.Errorf("Expected running config to not change")
+	}
+
+	newConfig = &ingress.Configuration{
+		DefaultSSLCertificate: &ingress.SSLCert{
+			PemFileName: "/etc/ingress-controller/ssl/default-fake-certificate.pem",
+		},
+	}
+	if n.IsDynamicConfigurationEnough(newConfig) {
+		t.Errorf("Expected to not be dynamically configurable when the default certificate file changes")
+	}
+}
+
 func TestConfigureDynamically(t *testing.T) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%v", nginx.StatusPort))
 	if err != nil {
@@ -300,6 +346,21 @@ func TestConfigureDynamically(t *testing.T) {
 			t.Errorf("Expected %v to receive %d requests but received %d.", endpoint, 0, count)
 		}
 	}
+
+	// the rotation of the default certificate is applied without a reload
+	resetEndpointStats()
+	rotatedConfig := &ingress.Configuration{
+		Backends:              backends,
+		Servers:               servers,
+		DefaultSSLCertificate: &ingress.SSLCert{PemSHA: "rotated"},
+	}
+	err = n.configureDynamically(rotatedConfig)
+	if err != nil {
+		t.Errorf("unexpected error posting dynamic configuration: %v", err)
+	}
+	if count := endpointStats["/configuration/servers"]; count != 1 {
+		t.Errorf("Expected %v to receive %d requests but received %d.", "/configuration/servers", 1, count)
+	}
 }
 
 func TestConfigureCertificates(t *testing.T) {
@@ -326,6 +387,21 @@ func TestConfigureCertificates(t *testing.T) {
 		{
 			Hostname: "myapp.nossl",
 		},
+		{
+			Hostname: "myapp.muststaple",
+			SSLCert: &ingress.SSLCert{
+				PemCertKey: "fake-must-staple-cert",
+				UID:        "5b8ec1bf-5d4b-4fd5-a21b-13bd3b1e1f3a",
+				Certificate: &x509.Certificate{
+					Extensions: []pkix.Extension{{
+						// TLS feature status_request
+						Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24},
+						Value: []byte{0x30, 0x03, 0x02, 0x01, 0x05},
+					}},
+				},
+			},
+			OCSPMustStaple: true,
+		},
 	}
 
 	server := &httptest.Server{
@@ -363,6 +439,10 @@ func TestConfigureCertificates(t *testing.T) {
 						}
 					}
 				}
+
+				if len(conf.MustStaple) != 1 || !conf.MustStaple["5b8ec1bf-5d4b-4fd5-a21b-13bd3b1e1f3a"] {
+					t.Errorf("Expected only the certificate of myapp.muststaple to require OCSP stapling but got %v", conf.MustStaple)
+				}
 			}),
 		},
 	}
@@ -471,6 +551,121 @@ func TestNextPowerOf2(t *testing.T) {
 	}
 }
 
+func TestCheckHSTSPreload(t *testing.T) {
+	cfg := ngx_config.NewDefault()
+	cfg.HSTSPreload = true
+	cfg.HSTSMaxAge = "31536000"
+
+	if err := checkHSTSPreload(cfg, 443); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	testCases := map[string]struct {
+		includeSubdomains bool
+		maxAge            string
+		httpsPort         int
+		expected          string
+	}{
+		"without subdomains":   {false, "63072000", 443, "hsts-include-subdomains is disabled"},
+		"with a short max-age": {true, "15724800", 443, "hsts-max-age 15724800 is lower than 31536000"},
+		"with another port":    {true, "31536000", 8443, "HTTPS is served in the port 8443 instead of 443"},
+		"with all the errors": {false, "invalid", 8443,
+			"hsts-include-subdomains is disabled, hsts-max-age invalid is lower than 31536000, HTTPS is served in the port 8443 instead of 443"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg.HSTSIncludeSubdomains = tc.includeSubdomains
+			cfg.HSTSMaxAge = tc.maxAge
+
+			err := checkHSTSPreload(cfg, tc.httpsPort)
+			if err == nil || err.Error() != tc.expected {
+				t.Errorf("expected error %q but %v returned", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestHTTPSServicePort(t *testing.T) {
+	newService := func(ports ...apiv1.ServicePort) *apiv1.Service {
+		return &apiv1.Service{Spec: apiv1.ServiceSpec{Ports: ports}}
+	}
+
+	testCases := map[string]struct {
+		svc      *apiv1.Service
+		expected int
+	}{
+		"without publish service": {nil, 8443},
+		"with a target port number": {newService(
+			apiv1.ServicePort{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)},
+			apiv1.ServicePort{Name: "https", Port: 443, TargetPort: intstr.FromInt(8443)},
+		), 443},
+		"with a target port name": {newService(
+			apiv1.ServicePort{Name: "https", Port: 443, TargetPort: intstr.FromString("https")},
+		), 443},
+		"without target port": {newService(
+			apiv1.ServicePort{Name: "https", Port: 8443},
+		), 8443},
+		"without the https port": {newService(
+			apiv1.ServicePort{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)},
+		), 8443},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if port := httpsServicePort(tc.svc, 8443); port != tc.expected {
+				t.Errorf("expected the port %v but got %v", tc.expected, port)
+			}
+		})
+	}
+}
+
+func TestHTTP2DisabledHosts(t *testing.T) {
+	servers := []*ingress.Server{
+		{Hostname: "_", HTTP2: http2.Config{Disabled: true}},
+		{Hostname: "example.com"},
+		{Hostname: "legacy.example.com", Aliases: []string{"old.example.com"}, HTTP2: http2.Config{Disabled: true}},
+		{Hostname: "passthrough.example.com", SSLPassthrough: true, HTTP2: http2.Config{Disabled: true}},
+	}
+
+	cfg := ngx_config.NewDefault()
+
+	expected := []string{"legacy.example.com", "old.example.com"}
+	if actual := http2DisabledHosts(servers, cfg); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but returned %v", expected, actual)
+	}
+
+	cfg.UseHTTP2 = false
+	if actual := http2DisabledHosts(servers, cfg); len(actual) != 0 {
+		t.Errorf("expected no hosts without HTTP/2 but returned %v", actual)
+	}
+}
+
+func TestBuildOpentelemetryCfg(t *testing.T) {
+	cfg := ngx_config.NewDefault()
+	cfg.OtlpCollectorHost = "otel-collector.monitoring.svc"
+	cfg.OtelSampler = ngx_config.OtelSamplerTraceIDRatioBased
+	cfg.OtelSamplerRatio = 0.5
+
+	content, err := buildOpentelemetryCfg(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		`host = "otel-collector.monitoring.svc"`,
+		`port = 4317`,
+		`name = "nginx"`,
+		`name = "TraceIdRatioBased"`,
+		`ratio = 0.5`,
+		`parent_based = false`,
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("expected %q in the configuration:\n%v", expected, content)
+		}
+	}
+}
+
 func TestCleanTempNginxCfg(t *testing.T) {
 	err := cleanTempNginxCfg()
 	if err != nil {
@@ -525,3 +720,51 @@ func TestCleanTempNginxCfg(t *testing.T) {
 		t.Errorf("expected one file but %d were found", len(files))
 	}
 }
+
+func TestDiffConfiguration(t *testing.T) {
+	running, err := ioutil.TempFile("", "nginx-cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(running.Name())
+
+	if _, err := running.WriteString("# Configuration checksum: 1\nworker_processes 1;\nevents {}\n"); err != nil {
+		t.Fatal(err)
+	}
+	running.Close()
+
+	diff, err := diffConfiguration(running.Name(), []byte("# Configuration checksum: 2\nworker_processes 1;\nevents {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff) != 0 {
+		t.Errorf("expected the change of the checksum to be ignored but the diff was\n%s", diff)
+	}
+
+	diff, err = diffConfiguration(running.Name(), []byte("# Configuration checksum: 1\nworker_processes 4;\nevents {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(diff), "-worker_processes 1;\n+worker_processes 4;") {
+		t.Errorf("expected the change of worker_processes in the diff but it was\n%s", diff)
+	}
+}
+
+func TestConfigurationFileHash(t *testing.T) {
+	content := []byte("worker_processes 1;\n")
+	tenants := map[string][]byte{"a": []byte("server {}\n"), "b": []byte("server { listen 81; }\n")}
+
+	hash := configurationFileHash(content, tenants)
+	for i := 0; i < 10; i++ {
+		if h := configurationFileHash(content, map[string][]byte{"b": tenants["b"], "a": tenants["a"]}); h != hash {
+			t.Fatalf("expected the checksum %v but got %v", hash, h)
+		}
+	}
+
+	if h := configurationFileHash(content, nil); h == hash {
+		t.Errorf("expected the files of the tenants to change the checksum")
+	}
+	if h := configurationFileHash(content, map[string][]byte{"a": tenants["b"], "b": tenants["a"]}); h == hash {
+		t.Errorf("expected the order of the tenants to change the checksum")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/notifier"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+// certificateExpiryInterval is the interval between the checks of the
+// expiration of the certificates of the running configuration
+const certificateExpiryInterval = 1 * time.Hour
+
+// checkExpiringCertificates notifies periodically the webhooks of the
+// certificates of the running configuration about to expire, until stopCh
+// is closed
+func (n *NGINXController) checkExpiringCertificates(stopCh <-chan struct{}) {
+	if !n.notifier.Enabled(notifier.CertificateExpiring) {
+		return
+	}
+
+	wait.Until(func() {
+		n.notifyExpiringCertificates(n.getRunningConfig().Servers)
+	}, certificateExpiryInterval, stopCh)
+}
+
+// notifyExpiringCertificates notifies the webhooks of the certificates of the
+// servers expiring before the configured threshold. The certificates not
+// loaded from a Secret, like the generated default certificate, are ignored.
+func (n *NGINXController) notifyExpiringCertificates(servers []*ingress.Server) {
+	if !n.notifier.Enabled(notifier.CertificateExpiring) {
+		return
+	}
+
+	threshold := time.Now().Add(n.notifier.CertificateExpiry())
+	for _, server := range servers {
+		cert := server.SSLCert
+		if cert == nil || cert.Name == "" || cert.ExpireTime.IsZero() || cert.ExpireTime.After(threshold) {
+			continue
+		}
+
+		expireTime := cert.ExpireTime
+		secret := fmt.Sprintf("%v/%v", cert.Namespace, cert.Name)
+		n.notifier.Notify(notifier.Event{
+			Type:        notifier.CertificateExpiring,
+			Message:     fmt.Sprintf("Certificate %v of host %q expires on %v", secret, server.Hostname, expireTime.UTC().Format(time.RFC3339)),
+			Host:        server.Hostname,
+			Certificate: secret,
+			ExpireTime:  &expireTime,
+			Key:         fmt.Sprintf("%v/%v/%v", server.Hostname, secret, expireTime.Unix()),
+		})
+	}
+}
+
+// notifyReloadFailed notifies the webhooks of a configuration that could not
+// be applied, with the ingresses it changes
+func (n *NGINXController) notifyReloadFailed(checksum string, changed []*ingress.Ingress, err error) {
+	var ingresses []string
+	for _, ing := range changed {
+		ingresses = append(ingresses, k8s.MetaNamespaceKey(ing))
+	}
+
+	n.notifier.Notify(notifier.Event{
+		Type:      notifier.ReloadFailed,
+		Message:   "Error reloading NGINX, the configuration was not applied",
+		Checksum:  checksum,
+		Ingresses: ingresses,
+		Error:     nginxTestError(err),
+	})
+}
+
+// reportConflict emits a Warning Event on the ingress whose configuration is
+// ignored because of a conflict with another ingress and notifies the
+// webhooks of the conflict
+func (n *NGINXController) reportConflict(ing *ingress.Ingress, reason, host, message string) {
+	n.recordIngressEvent(ing, apiv1.EventTypeWarning, reason, message)
+
+	key := k8s.MetaNamespaceKey(ing)
+	n.notifier.Notify(notifier.Event{
+		Type:    notifier.ConflictDetected,
+		Message: message,
+		Reason:  reason,
+		Ingress: key,
+		Host:    host,
+		Key:     fmt.Sprintf("%v/%v/%v", reason, key, message),
+	})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/notifier"
+)
+
+func TestNotifyExpiringCertificates(t *testing.T) {
+	received := make(chan notifier.Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var event notifier.Event
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			t.Errorf("unexpected error decoding the event: %v", err)
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	n := &NGINXController{
+		notifier: notifier.New(notifier.Config{
+			URLs:              []string{server.URL},
+			Timeout:           notifier.DefaultTimeout,
+			CertificateExpiry: 24 * time.Hour,
+		}),
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go n.notifier.Run(stopCh)
+
+	now := time.Now()
+	servers := []*ingress.Server{
+		{Hostname: "_", SSLCert: &ingress.SSLCert{ExpireTime: now.Add(time.Hour)}},
+		{Hostname: "plain.bar"},
+		{Hostname: "valid.bar", SSLCert: &ingress.SSLCert{Name: "valid", Namespace: "default", ExpireTime: now.Add(48 * time.Hour)}},
+		{Hostname: "expiring.bar", SSLCert: &ingress.SSLCert{Name: "expiring", Namespace: "default", ExpireTime: now.Add(time.Hour)}},
+	}
+
+	n.notifyExpiringCertificates(servers)
+	// the same certificate is not reported again
+	n.notifyExpiringCertificates(servers)
+
+	select {
+	case event := <-received:
+		if event.Type != notifier.CertificateExpiring || event.Host != "expiring.bar" || event.Certificate != "default/expiring" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		if event.ExpireTime == nil || !event.ExpireTime.Equal(servers[3].SSLCert.ExpireTime) {
+			t.Errorf("unexpected expiration time %v", event.ExpireTime)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expiring certificate not notified")
+	}
+
+	select {
+	case event := <-received:
+		t.Errorf("unexpected event %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
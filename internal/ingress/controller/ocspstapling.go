@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+// ocspStaplingFailuresInterval is the interval between the reports of the
+// TLS handshakes refused by the ocsp-must-staple annotation
+const ocspStaplingFailuresInterval = 1 * time.Minute
+
+// ocspStaplingFailure contains the TLS handshakes refused because no OCSP
+// response of a must-staple certificate could be stapled, with the last
+// error getting the response
+type ocspStaplingFailure struct {
+	Count int64  `json:"count"`
+	Error string `json:"error"`
+}
+
+// reportOCSPStaplingFailures emits periodically a Warning Event on the
+// Ingresses of the servers refusing TLS handshakes because no OCSP response
+// of their must-staple certificate could be stapled, until stopCh is closed
+func (n *NGINXController) reportOCSPStaplingFailures(stopCh <-chan struct{}) {
+	wait.Until(func() {
+		failures, err := takeOCSPStaplingFailures()
+		if err != nil {
+			klog.ErrorS(err, "Error getting the OCSP stapling failures")
+			return
+		}
+
+		n.recordOCSPStaplingFailures(n.getRunningConfig().Servers, failures)
+	}, ocspStaplingFailuresInterval, stopCh)
+}
+
+// takeOCSPStaplingFailures returns the failures counted by NGINX since the
+// previous call, by certificate UID
+func takeOCSPStaplingFailures() (map[string]ocspStaplingFailure, error) {
+	statusCode, body, err := nginx.NewPostStatusRequest("/configuration/ocsp-stapling-failures", "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	failures := map[string]ocspStaplingFailure{}
+	if err := json.Unmarshal(body, &failures); err != nil {
+		return nil, err
+	}
+
+	return failures, nil
+}
+
+// recordOCSPStaplingFailures emits a Warning Event on each Ingress of the
+// servers using the certificates of the failures
+func (n *NGINXController) recordOCSPStaplingFailures(servers []*ingress.Server, failures map[string]ocspStaplingFailure) {
+	if len(failures) == 0 {
+		return
+	}
+
+	for _, server := range servers {
+		if server.SSLCert == nil {
+			continue
+		}
+
+		failure, ok := failures[server.SSLCert.UID]
+		if !ok {
+			continue
+		}
+
+		message := fmt.Sprintf("%v TLS handshakes of host %v refused, no OCSP response could be stapled for the must-staple certificate %v/%v: %v",
+			failure.Count, server.Hostname, server.SSLCert.Namespace, server.SSLCert.Name, failure.Error)
+		klog.Warning(message)
+
+		ingresses := map[string]*ingress.Ingress{}
+		for _, location := range server.Locations {
+			if location.Ingress != nil {
+				ingresses[k8s.MetaNamespaceKey(location.Ingress)] = location.Ingress
+			}
+		}
+
+		keys := make([]string, 0, len(ingresses))
+		for key := range ingresses {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			n.recordIngressEvent(ingresses[key], apiv1.EventTypeWarning, "OCSPStaplingFailed", message)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+)
+
+func TestRecordOCSPStaplingFailures(t *testing.T) {
+	ing := &ingress.Ingress{
+		Ingress: networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: "default"},
+		},
+	}
+
+	servers := []*ingress.Server{
+		{
+			Hostname: "example.com",
+			SSLCert:  &ingress.SSLCert{UID: "must-staple", Name: "example-tls", Namespace: "default"},
+			Locations: []*ingress.Location{
+				{Path: "/", Ingress: ing},
+				{Path: "/api", Ingress: ing},
+			},
+		},
+		{
+			Hostname:  "other.com",
+			SSLCert:   &ingress.SSLCert{UID: "other", Name: "other-tls", Namespace: "default"},
+			Locations: []*ingress.Location{{Path: "/", Ingress: ing}},
+		},
+		{
+			Hostname: "plain.com",
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	n := &NGINXController{recorder: recorder}
+
+	n.recordOCSPStaplingFailures(servers, map[string]ocspStaplingFailure{
+		"must-staple": {Count: 3, Error: "could not get OCSP response: timeout"},
+	})
+
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected one event but %v were emitted", len(recorder.Events))
+	}
+
+	event := <-recorder.Events
+	for _, expected := range []string{"Warning", "OCSPStaplingFailed", "3 TLS handshakes of host example.com", "default/example-tls", "timeout"} {
+		if !strings.Contains(event, expected) {
+			t.Errorf("expected the event %q to contain %q", event, expected)
+		}
+	}
+
+	n.recordOCSPStaplingFailures(servers, map[string]ocspStaplingFailure{})
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event without failures")
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+// getOpenAPISpecs returns, by checksum, the operations of the OpenAPI
+// specifications referenced by the Ingresses with the
+// openapi-validation-configmap annotation
+func getOpenAPISpecs(ingresses []*ingress.Ingress) map[string]string {
+	var specs map[string]string
+
+	for _, ing := range ingresses {
+		if ing.ParsedAnnotations == nil || !ing.ParsedAnnotations.OpenAPIValidation.Enabled {
+			continue
+		}
+
+		if specs == nil {
+			specs = map[string]string{}
+		}
+
+		validation := ing.ParsedAnnotations.OpenAPIValidation
+		specs[validation.Checksum] = validation.Spec
+	}
+
+	return specs
+}
+
+// configureOpenAPISpecs JSON encodes the operations of the OpenAPI
+// specifications and POSTs them to an internal HTTP endpoint that is handled
+// by Lua. The specifications can be larger than the parameters of the NGINX
+// directives, the locations only reference them by checksum.
+func configureOpenAPISpecs(specs map[string]string) error {
+	if specs == nil {
+		specs = map[string]string{}
+	}
+
+	statusCode, _, err := nginx.NewPostStatusRequest("/configuration/openapi-specs", "application/json", specs)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+// getPluginFlags returns, by namespace and name, the flags of the Ingresses
+// with the plugin-flags annotation
+func getPluginFlags(ingresses []*ingress.Ingress) map[string]map[string]string {
+	var pluginFlags map[string]map[string]string
+
+	for _, ing := range ingresses {
+		if ing.ParsedAnnotations == nil || len(ing.ParsedAnnotations.PluginFlags) == 0 {
+			continue
+		}
+
+		if pluginFlags == nil {
+			pluginFlags = map[string]map[string]string{}
+		}
+
+		pluginFlags[fmt.Sprintf("%v/%v", ing.Namespace, ing.Name)] = ing.ParsedAnnotations.PluginFlags
+	}
+
+	return pluginFlags
+}
+
+// configurePluginFlags JSON encodes the flags of the Ingresses and POSTs
+// them to an internal HTTP endpoint that is handled by Lua
+func configurePluginFlags(pluginFlags map[string]map[string]string) error {
+	if pluginFlags == nil {
+		pluginFlags = map[string]map[string]string{}
+	}
+
+	statusCode, _, err := nginx.NewPostStatusRequest("/configuration/plugin-flags", "application/json", pluginFlags)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+)
+
+func TestGetPluginFlags(t *testing.T) {
+	flags := map[string]string{"canary-header": "true", "tier": "gold"}
+
+	ingresses := []*ingress.Ingress{
+		{
+			Ingress:           networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "admin"}},
+			ParsedAnnotations: &annotations.Ingress{PluginFlags: flags},
+		},
+		{
+			Ingress:           networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shop"}},
+			ParsedAnnotations: &annotations.Ingress{},
+		},
+	}
+
+	expected := map[string]map[string]string{"default/admin": flags}
+	if pluginFlags := getPluginFlags(ingresses); !reflect.DeepEqual(pluginFlags, expected) {
+		t.Errorf("expected %v but got %v", expected, pluginFlags)
+	}
+
+	if pluginFlags := getPluginFlags(ingresses[1:]); pluginFlags != nil {
+		t.Errorf("expected no plugin flags but got %v", pluginFlags)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+const (
+	// protocolMismatchPeriod is the period of the checks of the failures of
+	// the protocol negotiation with the upstreams
+	protocolMismatchPeriod = 30 * time.Second
+	// protocolMismatchMinFailures is the number of failures of a backend in
+	// a period after which its ingresses are reported
+	protocolMismatchMinFailures = 5
+	// protocolMismatchEventInterval is the minimum interval between the
+	// events of a mismatch of an ingress
+	protocolMismatchEventInterval = 30 * time.Minute
+)
+
+const (
+	protocolMismatchTLS   = "tls-handshake"
+	protocolMismatchHTTP2 = "http2-framing"
+)
+
+// protocolMismatchDetector contains the state of the detection of the
+// backends whose protocol does not match their backend-protocol annotation
+type protocolMismatchDetector struct {
+	mu sync.Mutex
+	// stats contains the totals of the failures at the previous check
+	stats map[collectors.ProtocolMismatch]uint64
+	// reported contains the time of the last event of each ingress and reason
+	reported map[string]time.Time
+}
+
+// protocolMismatchHint returns the fix of a failure of the protocol
+// negotiation with the upstreams of a backend with the protocol of the
+// backend-protocol annotation, an empty string when the failure is not
+// caused by the protocol
+func protocolMismatchHint(protocol, reason string) string {
+	switch {
+	case reason == protocolMismatchTLS && protocol == "HTTPS":
+		return "the upstreams do not accept TLS connections, set the annotation backend-protocol to HTTP if the service does not use TLS"
+	case reason == protocolMismatchTLS && protocol == "GRPCS":
+		return "the upstreams do not accept TLS connections, set the annotation backend-protocol to GRPC if the service does not use TLS"
+	case reason == protocolMismatchHTTP2 && protocol == "GRPC":
+		return "the upstreams do not answer with HTTP/2 frames, set the annotation backend-protocol to GRPCS if the service uses TLS or to HTTP if it does not serve gRPC"
+	case reason == protocolMismatchHTTP2 && protocol == "GRPCS":
+		return "the upstreams do not answer with HTTP/2 frames, set the annotation backend-protocol to HTTPS if the service does not serve gRPC"
+	}
+
+	return ""
+}
+
+// failingBackends returns the reason of the failures of the backends with
+// at least protocolMismatchMinFailures failures since the previous check
+func failingBackends(previous, current map[collectors.ProtocolMismatch]uint64) map[string]string {
+	failing := map[string]string{}
+	for mismatch, total := range current {
+		last := previous[mismatch]
+		// the totals are reset when the collector is restarted
+		if total < last {
+			last = 0
+		}
+
+		if total-last >= protocolMismatchMinFailures {
+			failing[mismatch.Backend] = mismatch.Reason
+		}
+	}
+
+	return failing
+}
+
+// detectProtocolMismatches emits an event on the ingresses of the backends
+// failing the protocol negotiation with their upstreams because of the
+// protocol of their backend-protocol annotation
+func (n *NGINXController) detectProtocolMismatches() {
+	stats := n.metricCollector.ProtocolMismatchStats()
+	now := time.Now()
+
+	d := n.protocolMismatches
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	failing := failingBackends(d.stats, stats)
+	d.stats = stats
+
+	reported := map[string]time.Time{}
+	for key, last := range d.reported {
+		if now.Sub(last) < protocolMismatchEventInterval {
+			reported[key] = last
+		}
+	}
+	d.reported = reported
+
+	if len(failing) == 0 {
+		return
+	}
+
+	for _, ing := range n.store.ListIngresses() {
+		anns := ing.ParsedAnnotations
+		if anns == nil {
+			continue
+		}
+
+		for _, backend := range ingressBackends(ing) {
+			reason, ok := failing[backend]
+			if !ok {
+				continue
+			}
+
+			hint := protocolMismatchHint(anns.BackendProtocol, reason)
+			if hint == "" {
+				continue
+			}
+
+			key := k8s.MetaNamespaceKey(ing) + "/" + reason
+			if _, ok := d.reported[key]; ok {
+				break
+			}
+			d.reported[key] = now
+
+			message := fmt.Sprintf("Backend %v fails the negotiation of the protocol %v (%v): %v", backend, anns.BackendProtocol, reason, hint)
+			klog.Warningf("Ingress %q: %v", k8s.MetaNamespaceKey(ing), message)
+			n.recordIngressEvent(ing, apiv1.EventTypeWarning, "BackendProtocolMismatch", message)
+			break
+		}
+	}
+}
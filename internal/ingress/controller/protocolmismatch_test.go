@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/metric"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+)
+
+type fakeProtocolMismatchCollector struct {
+	metric.DummyCollector
+	stats map[collectors.ProtocolMismatch]uint64
+}
+
+func (f *fakeProtocolMismatchCollector) ProtocolMismatchStats() map[collectors.ProtocolMismatch]uint64 {
+	return f.stats
+}
+
+func TestProtocolMismatchHint(t *testing.T) {
+	testCases := []struct {
+		protocol string
+		reason   string
+		expected string
+	}{
+		{"HTTPS", protocolMismatchTLS, "HTTP"},
+		{"GRPCS", protocolMismatchTLS, "GRPC"},
+		{"GRPC", protocolMismatchHTTP2, "GRPCS"},
+		{"GRPCS", protocolMismatchHTTP2, "HTTPS"},
+		{"HTTP", protocolMismatchTLS, ""},
+		{"HTTPS", protocolMismatchHTTP2, ""},
+	}
+
+	for _, tc := range testCases {
+		hint := protocolMismatchHint(tc.protocol, tc.reason)
+		if tc.expected == "" {
+			if hint != "" {
+				t.Errorf("%v %v: expected no hint but returned %q", tc.protocol, tc.reason, hint)
+			}
+			continue
+		}
+
+		if !strings.Contains(hint, "backend-protocol to "+tc.expected) {
+			t.Errorf("%v %v: expected a hint suggesting %v but returned %q", tc.protocol, tc.reason, tc.expected, hint)
+		}
+	}
+}
+
+func TestDetectProtocolMismatches(t *testing.T) {
+	ing := &ingress.Ingress{
+		Ingress: networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: "default",
+			},
+			Spec: networking.IngressSpec{
+				DefaultBackend: &networking.IngressBackend{
+					Service: &networking.IngressServiceBackend{
+						Name: "web",
+						Port: networking.ServiceBackendPort{
+							Number: 8080,
+						},
+					},
+				},
+			},
+		},
+		ParsedAnnotations: &annotations.Ingress{
+			BackendProtocol: "HTTPS",
+		},
+	}
+
+	mismatch := collectors.ProtocolMismatch{Backend: "default-web-8080", Reason: protocolMismatchTLS}
+	mc := &fakeProtocolMismatchCollector{stats: map[collectors.ProtocolMismatch]uint64{mismatch: 2}}
+	recorder := record.NewFakeRecorder(10)
+	n := &NGINXController{
+		store:              fakeIngressStore{ingresses: []*ingress.Ingress{ing}},
+		metricCollector:    mc,
+		recorder:           recorder,
+		protocolMismatches: &protocolMismatchDetector{},
+	}
+
+	// occasional failures are not reported
+	n.detectProtocolMismatches()
+	mc.stats = map[collectors.ProtocolMismatch]uint64{mismatch: 5}
+	n.detectProtocolMismatches()
+	if len(recorder.Events) != 0 {
+		t.Fatalf("expected no event but got %v", <-recorder.Events)
+	}
+
+	mc.stats = map[collectors.ProtocolMismatch]uint64{mismatch: 20}
+	n.detectProtocolMismatches()
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "BackendProtocolMismatch") || !strings.Contains(event, "default-web-8080") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Fatalf("expected an event")
+	}
+
+	// the events of an ingress are rate limited
+	mc.stats = map[collectors.ProtocolMismatch]uint64{mismatch: 40}
+	n.detectProtocolMismatches()
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event but got %v", <-recorder.Events)
+	}
+
+	// the failures of the backends of other protocols are ignored
+	ing.ParsedAnnotations.BackendProtocol = "HTTP"
+	n.protocolMismatches.reported = nil
+	mc.stats = map[collectors.ProtocolMismatch]uint64{mismatch: 60}
+	n.detectProtocolMismatches()
+	if len(recorder.Events) != 0 {
+		t.Errorf("expected no event but got %v", <-recorder.Events)
+	}
+}
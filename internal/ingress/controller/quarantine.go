@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+// maxQuarantinedIngresses is the maximum number of ingresses excluded
+// from the configuration before giving up looking for invalid ingresses
+const maxQuarantinedIngresses = 10
+
+// quarantinedIngress is an ingress excluded from the NGINX configuration
+type quarantinedIngress struct {
+	ing    *ingress.Ingress
+	reason string
+}
+
+// nginxTestError returns the lines with the errors reported by the command "nginx -t"
+func nginxTestError(err error) string {
+	lines := []string{}
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if strings.Contains(line, "[emerg]") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+
+	if len(lines) == 0 {
+		return strings.TrimSpace(err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// quarantineIngresses bisects the ingresses to find the ones that generate an
+// invalid NGINX configuration. Returns the valid ingresses and the excluded
+// ones or an error when the configuration is invalid even without ingresses.
+func (n *NGINXController) quarantineIngresses(cfg ngx_config.Configuration, ings []*ingress.Ingress) ([]*ingress.Ingress, []quarantinedIngress, error) {
+	// the configurations of the subsets of the ingresses are not applied,
+	// their conflicts are neither recorded in the Ingresses nor notified, and
+	// the servers of the SSL Passthrough proxy are updated by the template
+	dryRun := *n
+	dryRun.recorder = nil
+	dryRun.notifier = nil
+	dryRun.Proxy = &TCPProxy{}
+
+	test := func(ings []*ingress.Ingress) error {
+		_, _, pcfg := dryRun.getConfiguration(ings)
+		return dryRun.testConfiguration(cfg, *pcfg)
+	}
+
+	err := test([]*ingress.Ingress{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration without ingresses: %v", err)
+	}
+
+	ings = append([]*ingress.Ingress{}, ings...)
+	quarantined := []quarantinedIngress{}
+
+	for {
+		err = test(ings)
+		if err == nil {
+			return ings, quarantined, nil
+		}
+
+		if len(quarantined) == maxQuarantinedIngresses {
+			return nil, nil, fmt.Errorf("more than %v ingresses generate an invalid configuration", maxQuarantinedIngresses)
+		}
+
+		// the configuration with the first valid ingresses is valid and it is
+		// invalid with the first invalid ones, the last one is the culprit
+		valid, invalid := 0, len(ings)
+		for invalid-valid > 1 {
+			middle := (valid + invalid) / 2
+			middleErr := test(ings[:middle])
+			if middleErr == nil {
+				valid = middle
+			} else {
+				invalid, err = middle, middleErr
+			}
+		}
+
+		culprit := ings[invalid-1]
+		quarantined = append(quarantined, quarantinedIngress{ing: culprit, reason: nginxTestError(err)})
+		ings = append(ings[:invalid-1], ings[invalid:]...)
+	}
+}
+
+// updateWithoutInvalidIngresses reloads NGINX without the ingresses that
+// generate an invalid configuration, marking each of them with an Event.
+// Returns updateErr if the invalid ingresses cannot be found.
+func (n *NGINXController) updateWithoutInvalidIngresses(ings []*ingress.Ingress, checksum string, updateErr error) error {
+	cfg := n.store.GetBackendConfiguration()
+	cfg.Resolver = n.resolver
+
+	valid, quarantined, err := n.quarantineIngresses(cfg, ings)
+	if err != nil {
+		klog.Warningf("Unable to find the ingresses that generate an invalid configuration: %v", err)
+		return updateErr
+	}
+
+	if len(quarantined) == 0 {
+		return updateErr
+	}
+
+	// the map is replaced, the introspection handlers read the previous one
+	quarantinedIngresses := make(map[string]string, len(n.quarantinedIngresses)+len(quarantined))
+	for key, reason := range n.quarantinedIngresses {
+		quarantinedIngresses[key] = reason
+	}
+
+	for _, q := range quarantined {
+		quarantinedIngresses[k8s.MetaNamespaceKey(q.ing)] = q.reason
+		klog.Warningf("Ingress %v/%v generates an invalid configuration, excluding it from the NGINX configuration: %v", q.ing.Namespace, q.ing.Name, q.reason)
+		n.recordIngressEvent(q.ing, apiv1.EventTypeWarning, "Quarantined",
+			fmt.Sprintf("Ingress excluded from the NGINX configuration: %v", q.reason))
+	}
+
+	n.runningConfigLock.Lock()
+	n.quarantinedIngresses = quarantinedIngresses
+	n.runningConfigLock.Unlock()
+
+	_, _, pcfg := n.getConfiguration(valid)
+	pcfg.ConfigurationChecksum = checksum
+
+	return n.OnUpdate(*pcfg)
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/ingress/metric"
+)
+
+// brokenHostCommand fails when the configuration contains a hostname with the prefix broken
+type brokenHostCommand struct{}
+
+func (brokenHostCommand) ExecCommand(args ...string) *exec.Cmd {
+	return nil
+}
+
+func (brokenHostCommand) Test(cfg string) ([]byte, error) {
+	content, err := ioutil.ReadFile(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, host := range strings.Split(string(content), ",") {
+		if strings.HasPrefix(host, "broken") {
+			return []byte(fmt.Sprintf("nginx: [emerg] invalid server %v in %v:1\nnginx: configuration file %v test failed", host, cfg, cfg)), fmt.Errorf("exit status 1")
+		}
+	}
+
+	return nil, nil
+}
+
+func newHostIngress(name, host string) *ingress.Ingress {
+	return &ingress.Ingress{
+		Ingress: networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: networking.IngressSpec{
+				Rules: []networking.IngressRule{{Host: host}},
+			},
+		},
+		ParsedAnnotations: &annotations.Ingress{},
+	}
+}
+
+func TestNginxTestError(t *testing.T) {
+	err := fmt.Errorf("\n---\nError: exit status 1\nnginx: [emerg] unknown directive \"x\" in /tmp/nginx-cfg1:10\nnginx: configuration file /tmp/nginx-cfg1 test failed\n---\n")
+	expected := `nginx: [emerg] unknown directive "x" in /tmp/nginx-cfg1:10`
+	if reason := nginxTestError(err); reason != expected {
+		t.Errorf("expected %q but got %q", expected, reason)
+	}
+
+	if reason := nginxTestError(fmt.Errorf(" exit status 1\n")); reason != "exit status 1" {
+		t.Errorf("expected the whole error but got %q", reason)
+	}
+}
+
+func TestQuarantineIngresses(t *testing.T) {
+	nginx := newNGINXController(t)
+	nginx.metricCollector = metric.DummyCollector{}
+	nginx.t = fakeTemplate{}
+	nginx.command = brokenHostCommand{}
+	nginx.store = fakeIngressStore{}
+
+	cfg := ngx_config.NewDefault()
+
+	ings := []*ingress.Ingress{}
+	for i := 0; i < 7; i++ {
+		host := fmt.Sprintf("host-%v.example.com", i)
+		if i == 2 || i == 5 {
+			host = "broken-" + host
+		}
+		ings = append(ings, newHostIngress(fmt.Sprintf("ingress-%v", i), host))
+	}
+
+	valid, quarantined, err := nginx.quarantineIngresses(cfg, ings)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(valid) != 5 {
+		t.Errorf("expected 5 valid ingresses but got %v", len(valid))
+	}
+
+	names := []string{}
+	for _, q := range quarantined {
+		names = append(names, q.ing.Name)
+		if !strings.HasPrefix(q.reason, "nginx: [emerg] invalid server broken") {
+			t.Errorf("unexpected reason %q", q.reason)
+		}
+	}
+
+	if strings.Join(names, ",") != "ingress-2,ingress-5" {
+		t.Errorf("expected the ingresses ingress-2 and ingress-5 to be quarantined but got %v", names)
+	}
+
+	t.Run("without invalid ingresses", func(t *testing.T) {
+		valid, quarantined, err := nginx.quarantineIngresses(cfg, valid)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(valid) != 5 || len(quarantined) != 0 {
+			t.Errorf("expected no quarantined ingresses but got %v", len(quarantined))
+		}
+	})
+
+	t.Run("without recording the conflicts of the bisections", func(t *testing.T) {
+		recorder := record.NewFakeRecorder(100)
+		nginx.recorder = recorder
+		defer func() { nginx.recorder = nil }()
+
+		snippets := []*ingress.Ingress{}
+		for i, host := range []string{"shared.example.com", "shared.example.com", "broken.example.com"} {
+			ing := newHostIngress(fmt.Sprintf("snippet-%v", i), host)
+			ing.ParsedAnnotations.ServerSnippet = "return 200;"
+			snippets = append(snippets, ing)
+		}
+
+		_, quarantined, err := nginx.quarantineIngresses(cfg, snippets)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(quarantined) != 1 {
+			t.Errorf("expected 1 quarantined ingress but got %v", len(quarantined))
+		}
+
+		if len(recorder.Events) != 0 {
+			t.Errorf("expected no event but got %v", <-recorder.Events)
+		}
+	})
+
+	t.Run("with an invalid configuration without ingresses", func(t *testing.T) {
+		nginx.command = testNginxTestCommand{
+			t:        t,
+			expected: "_",
+			err:      fmt.Errorf("test error"),
+		}
+
+		_, _, err := nginx.quarantineIngresses(cfg, ings)
+		if err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
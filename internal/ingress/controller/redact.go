@@ -0,0 +1,129 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redacted replaces the sensitive values of the NGINX configuration
+const redacted = "<redacted>"
+
+// sensitiveName matches the names of the headers and variables containing
+// credentials
+const sensitiveName = `[A-Za-z0-9_-]*(?:authorization|cookie|token|secret|passw(?:or)?d|api[_-]?key|credential|private[_-]?key)[A-Za-z0-9_-]*`
+
+var (
+	// privateKeyBlock matches the PEM blocks of the private keys
+	privateKeyBlock = regexp.MustCompile(`(?s)(-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----).*?(-----END [A-Z0-9 ]*PRIVATE KEY-----)`)
+	// urlCredentials matches the user information of the URLs
+	urlCredentials = regexp.MustCompile(`(\b[a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s@'";]+@`)
+	// urlQuery matches the query strings of the URLs, like the tokens of the
+	// URLs of the external authentication
+	urlQuery = regexp.MustCompile(`(\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s'";?#]*\?)([^\s'";#]+)`)
+	// headerDirective matches the directives setting a sensitive header or
+	// parameter of the requests or responses, with its value
+	headerDirective = regexp.MustCompile(`(?i)^(\s*(?:proxy_set_header|grpc_set_header|fastcgi_param|uwsgi_param|scgi_param|add_header)\s+["']?` +
+		sensitiveName + `["']?\s+)([^;]+)(;.*)$`)
+	// moreSetHeaders matches the sensitive headers set by the directives of
+	// the headers-more module, with their value
+	moreSetHeaders = regexp.MustCompile(`(?i)(\bmore_set(?:_input)?_headers\s+(?:-[rst]\s+\S+\s+)*["']` + sensitiveName + `\s*:\s*)([^"']*)`)
+	// setVariable matches the definitions of the sensitive variables
+	setVariable = regexp.MustCompile(`(?i)^(\s*set\s+\$` + sensitiveName + `\s+)([^;]+)(;.*)$`)
+	// luaAssignment matches the sensitive string literals of the Lua code
+	luaAssignment = regexp.MustCompile(`(?i)(\b` + sensitiveName + `\s*=\s*)("[^"]*"|'[^']*')`)
+	// ignoredHeaderValue matches the values of the headers exempting the
+	// requests from the global rate limit, which act as credentials
+	ignoredHeaderValue = regexp.MustCompile(`(\bvariable\s*=\s*"http_[A-Za-z0-9_]+"\s*,\s*value\s*=\s*)("(?:[^"\\]|\\.)*")`)
+	// nginxVariable matches the NGINX variables of the values
+	nginxVariable = regexp.MustCompile(`\$\{?[A-Za-z0-9_]+\}?`)
+	// alphanumeric matches the values disclosing content
+	alphanumeric = regexp.MustCompile(`[A-Za-z0-9]`)
+	// variableValue matches the values made only of NGINX variables, which
+	// do not disclose their content
+	variableValue = regexp.MustCompile(`^["']?(\$\{?[A-Za-z0-9_]+\}?)*["']?$`)
+)
+
+// redactConfiguration returns the NGINX configuration with the private keys,
+// the credentials and the query values of the URLs, the values of the headers
+// and variables with credentials, like Authorization or Cookie, and the
+// values of the headers ignored by the global rate limit replaced by
+// <redacted>, so it can be shared. The values made only of NGINX variables
+// are kept.
+func redactConfiguration(content []byte) []byte {
+	content = privateKeyBlock.ReplaceAll(content, []byte("${1}\n"+redacted+"\n${2}"))
+	content = urlCredentials.ReplaceAll(content, []byte("${1}"+redacted+"@"))
+	content = urlQuery.ReplaceAllFunc(content, redactQuery)
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		line = redactValue(headerDirective, line)
+		line = redactValue(setVariable, line)
+		line = redactValue(moreSetHeaders, line)
+		line = redactValue(ignoredHeaderValue, line)
+		lines[i] = redactValue(luaAssignment, line)
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// redactQuery replaces the values of the parameters of the query string of
+// the URL that do not only contain NGINX variables
+func redactQuery(match []byte) []byte {
+	groups := urlQuery.FindSubmatch(match)
+
+	params := strings.Split(string(groups[2]), "&")
+	for i, param := range params {
+		parts := strings.SplitN(param, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+
+		if !alphanumeric.MatchString(nginxVariable.ReplaceAllString(parts[1], "")) {
+			continue
+		}
+
+		params[i] = parts[0] + "=" + redacted
+	}
+
+	return []byte(string(groups[1]) + strings.Join(params, "&"))
+}
+
+// redactValue replaces the values, the second group of the matches of re,
+// that are not made only of NGINX variables
+func redactValue(re *regexp.Regexp, line string) string {
+	return re.ReplaceAllStringFunc(line, func(match string) string {
+		groups := re.FindStringSubmatch(match)
+		value := strings.TrimSpace(groups[2])
+		if variableValue.MatchString(value) {
+			return match
+		}
+
+		quote := ""
+		if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, `'`) {
+			quote = value[:1]
+		}
+
+		rest := ""
+		if len(groups) > 3 {
+			rest = groups[3]
+		}
+
+		return groups[1] + quote + redacted + quote + rest
+	})
+}
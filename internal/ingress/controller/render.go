@@ -0,0 +1,49 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"k8s.io/client-go/tools/record"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/controller/store"
+	ngx_template "k8s.io/ingress-nginx/internal/ingress/controller/template"
+	"k8s.io/ingress-nginx/internal/ingress/metric"
+)
+
+// Render builds the model of the Ingresses available in the store s and
+// returns it together with the NGINX configuration the controller would
+// write for it. NGINX is neither tested nor reloaded.
+func Render(config *Configuration, s store.Storer, t ngx_template.TemplateWriter) ([]byte, *ingress.Configuration, error) {
+	n := &NGINXController{
+		cfg:             config,
+		store:           s,
+		t:               t,
+		recorder:        record.NewFakeRecorder(1024),
+		metricCollector: metric.NewDummyCollector(),
+		Proxy:           &TCPProxy{},
+	}
+
+	_, _, pcfg := n.getConfiguration(s.ListIngresses())
+
+	content, _, err := n.generateTemplate(s.GetBackendConfiguration(), *pcfg, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return content, pcfg, nil
+}
@@ -0,0 +1,333 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/hashstructure"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress/status"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+const (
+	// configMapRolloutPeriod is the period of the reports of the canary
+	// replicas and of the promotion checks of the other replicas
+	configMapRolloutPeriod = 30 * time.Second
+
+	// promotedConfigMapKey is the key of the rollout ConfigMap containing the
+	// data of the promoted configuration ConfigMaps
+	promotedConfigMapKey = "promoted"
+)
+
+// canaryStatus is the status of a canary replica with the data of the
+// configuration ConfigMaps it applied, stored in the rollout ConfigMap
+type canaryStatus struct {
+	Checksum string `json:"checksum"`
+	Healthy  bool   `json:"healthy"`
+	// Since is the time from which the replica is healthy
+	Since   time.Time `json:"since,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// configMapRollout applies the changes of the configuration ConfigMaps to
+// the canary replicas, matching the selector, first. The other replicas
+// apply them once every canary replica is healthy with the new data for the
+// soak period. The data of the promoted configuration and the status of the
+// canary replicas are stored in the rollout ConfigMap.
+type configMapRollout struct {
+	client     clientset.Interface
+	namespace  string
+	name       string
+	selector   labels.Selector
+	soakPeriod time.Duration
+
+	// canary is true when the replica matches the selector
+	canary bool
+
+	mu        sync.Mutex
+	candidate map[string]string
+	promoted  map[string]string
+	status    canaryStatus
+}
+
+func newConfigMapRollout(client clientset.Interface, electionID string, selector labels.Selector, soakPeriod time.Duration) *configMapRollout {
+	r := &configMapRollout{
+		client:     client,
+		name:       fmt.Sprintf("%v-configmap-rollout", electionID),
+		selector:   selector,
+		soakPeriod: soakPeriod,
+	}
+
+	if k8s.IngressPodDetails != nil {
+		r.namespace = k8s.IngressPodDetails.Namespace
+		r.canary = selector.Matches(labels.Set(k8s.IngressPodDetails.Labels))
+	}
+
+	if r.canary {
+		return r
+	}
+
+	// the replica restarted during a rollout keeps the promoted data
+	cm, err := client.CoreV1().ConfigMaps(r.namespace).Get(context.TODO(), r.name, metav1.GetOptions{})
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			klog.Warningf("Error reading the rollout ConfigMap %v/%v: %v", r.namespace, r.name, err)
+		}
+		return r
+	}
+
+	if raw, ok := cm.Data[promotedConfigMapKey]; ok {
+		promoted := map[string]string{}
+		if err := json.Unmarshal([]byte(raw), &promoted); err != nil {
+			klog.Warningf("Error reading the promoted configuration of the rollout ConfigMap %v/%v: %v", r.namespace, r.name, err)
+			return r
+		}
+		r.promoted = promoted
+	}
+
+	return r
+}
+
+// configMapChecksum returns the checksum of the data of the configuration ConfigMaps
+func configMapChecksum(data map[string]string) string {
+	hash, _ := hashstructure.Hash(data, nil)
+	return fmt.Sprintf("%v", hash)
+}
+
+// gate returns the data of the configuration ConfigMaps to apply: the
+// current data in the canary replicas and the promoted data in the others
+func (r *configMapRollout) gate(data map[string]string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.candidate = data
+	if r.canary {
+		return data
+	}
+
+	if r.promoted == nil {
+		r.promoted = data
+	} else if configMapChecksum(data) != configMapChecksum(r.promoted) {
+		klog.InfoS("Configuration ConfigMap changed, waiting for its promotion by the canary replicas", "selector", r.selector.String())
+	}
+
+	return r.promoted
+}
+
+// nextCanaryStatus returns the status of a canary replica with the data of
+// checksum from its previous one and the result of its health check
+func nextCanaryStatus(previous canaryStatus, checksum string, healthErr error, now time.Time) canaryStatus {
+	if healthErr != nil {
+		return canaryStatus{Checksum: checksum, Message: healthErr.Error()}
+	}
+
+	if previous.Checksum == checksum && previous.Healthy {
+		return previous
+	}
+
+	return canaryStatus{Checksum: checksum, Healthy: true, Since: now}
+}
+
+// canariesReady returns nil when every canary replica is healthy with the
+// data of checksum since the soak period, the reason to wait otherwise
+func canariesReady(canaries []apiv1.Pod, statuses map[string]string, checksum string, soakPeriod time.Duration, now time.Time) error {
+	if len(canaries) == 0 {
+		return fmt.Errorf("no running canary replica")
+	}
+
+	for _, pod := range canaries {
+		var s canaryStatus
+		if err := json.Unmarshal([]byte(statuses[pod.Name]), &s); err != nil || s.Checksum != checksum {
+			return fmt.Errorf("canary replica %v did not apply the configuration yet", pod.Name)
+		}
+
+		if !s.Healthy {
+			return fmt.Errorf("canary replica %v is not healthy: %v", pod.Name, s.Message)
+		}
+
+		if now.Sub(s.Since) < soakPeriod {
+			return fmt.Errorf("canary replica %v is healthy since %v", pod.Name, s.Since.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+// update changes the data of the rollout ConfigMap, creating it if needed
+func (r *configMapRollout) update(mutate func(data map[string]string)) error {
+	return updateConfigMap(r.client, r.namespace, r.name, mutate)
+}
+
+// updateConfigMap changes the data of a ConfigMap storing the state of the
+// controller, creating it if needed
+func updateConfigMap(client clientset.Interface, namespace, name string, mutate func(data map[string]string)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := client.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			cm = &apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+				Data:       map[string]string{},
+			}
+			mutate(cm.Data)
+			_, err = client.CoreV1().ConfigMaps(namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		mutate(cm.Data)
+
+		_, err = client.CoreV1().ConfigMaps(namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// syncConfigMapRollout reports the status of the canary replicas and
+// promotes the data of the configuration ConfigMaps in the other ones
+func (n *NGINXController) syncConfigMapRollout() {
+	r := n.configMapRollout
+
+	r.mu.Lock()
+	checksum := configMapChecksum(r.candidate)
+	r.mu.Unlock()
+
+	if r.canary {
+		n.reportCanaryStatus(checksum)
+		return
+	}
+
+	n.promoteConfigMap(checksum)
+}
+
+// reportCanaryStatus stores the status of the canary replica in the rollout
+// ConfigMap. The replica is healthy when NGINX runs the configuration of the
+// ConfigMaps and passes its health check.
+func (n *NGINXController) reportCanaryStatus(checksum string) {
+	r := n.configMapRollout
+
+	healthErr := n.Check(nil)
+	if healthErr == nil && n.getRunningConfig().BackendConfigChecksum != n.store.GetBackendConfiguration().Checksum {
+		healthErr = fmt.Errorf("the configuration is not applied, the reload of NGINX failed")
+	}
+
+	r.mu.Lock()
+	r.status = nextCanaryStatus(r.status, checksum, healthErr, time.Now())
+	raw, _ := json.Marshal(r.status)
+	r.mu.Unlock()
+
+	pod := k8s.IngressPodDetails.Name
+	err := r.update(func(data map[string]string) {
+		data[pod] = string(raw)
+	})
+	if err != nil {
+		klog.Warningf("Error reporting the status of the canary replica in the rollout ConfigMap %v/%v: %v", r.namespace, r.name, err)
+	}
+}
+
+// promoteConfigMap applies the data of the configuration ConfigMaps once the
+// canary replicas are healthy with it for the soak period
+func (n *NGINXController) promoteConfigMap(checksum string) {
+	r := n.configMapRollout
+
+	r.mu.Lock()
+	promoted := r.promoted
+	candidate := r.candidate
+	r.mu.Unlock()
+
+	cm, err := r.client.CoreV1().ConfigMaps(r.namespace).Get(context.TODO(), r.name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		cm = nil
+	} else if err != nil {
+		klog.Warningf("Error reading the rollout ConfigMap %v/%v: %v", r.namespace, r.name, err)
+		return
+	}
+
+	if configMapChecksum(promoted) == checksum {
+		// the first replica stores the data used by the others on start
+		if cm == nil || cm.Data[promotedConfigMapKey] == "" {
+			n.storePromotedConfigMap(promoted)
+		}
+		return
+	}
+
+	pods, err := status.RunningPods(r.client)
+	if err != nil {
+		klog.Warningf("Error listing the canary replicas: %v", err)
+		return
+	}
+
+	canaries := []apiv1.Pod{}
+	for _, pod := range pods {
+		if r.selector.Matches(labels.Set(pod.Labels)) {
+			canaries = append(canaries, pod)
+		}
+	}
+
+	var statuses map[string]string
+	if cm != nil {
+		statuses = cm.Data
+	}
+
+	if err := canariesReady(canaries, statuses, checksum, r.soakPeriod, time.Now()); err != nil {
+		klog.InfoS("Configuration ConfigMap not promoted", "reason", err)
+		return
+	}
+
+	klog.InfoS("Promoting the configuration ConfigMap, the canary replicas are healthy", "soakPeriod", r.soakPeriod)
+
+	r.mu.Lock()
+	r.promoted = candidate
+	r.mu.Unlock()
+
+	n.storePromotedConfigMap(candidate)
+	n.store.ApplyConfigMaps()
+}
+
+// storePromotedConfigMap stores the promoted data in the rollout ConfigMap
+func (n *NGINXController) storePromotedConfigMap(promoted map[string]string) {
+	r := n.configMapRollout
+
+	raw, err := json.Marshal(promoted)
+	if err != nil {
+		klog.Warningf("Error encoding the promoted configuration: %v", err)
+		return
+	}
+
+	err = r.update(func(data map[string]string) {
+		data[promotedConfigMapKey] = string(raw)
+	})
+	if err != nil {
+		klog.Warningf("Error storing the promoted configuration in the rollout ConfigMap %v/%v: %v", r.namespace, r.name, err)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+func TestConfigMapRolloutGate(t *testing.T) {
+	k8s.IngressPodDetails = &k8s.PodInfo{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingress-1", Namespace: "ingress", Labels: map[string]string{"track": "stable"}},
+	}
+
+	selector, _ := labels.Parse("track=canary")
+	current := map[string]string{"proxy-body-size": "1m"}
+	changed := map[string]string{"proxy-body-size": "8m"}
+
+	stable := newConfigMapRollout(fake.NewSimpleClientset(), "leader-nginx", selector, time.Minute)
+	if stable.canary {
+		t.Fatalf("expected a replica not matching the selector")
+	}
+
+	if data := stable.gate(current); data["proxy-body-size"] != "1m" {
+		t.Errorf("expected the first configuration to be applied but got %v", data)
+	}
+	if data := stable.gate(changed); data["proxy-body-size"] != "1m" {
+		t.Errorf("expected the promoted configuration to be applied but got %v", data)
+	}
+
+	k8s.IngressPodDetails.Labels = map[string]string{"track": "canary"}
+	canary := newConfigMapRollout(fake.NewSimpleClientset(), "leader-nginx", selector, time.Minute)
+	if !canary.canary {
+		t.Fatalf("expected a replica matching the selector")
+	}
+
+	canary.gate(current)
+	if data := canary.gate(changed); data["proxy-body-size"] != "8m" {
+		t.Errorf("expected the changed configuration to be applied but got %v", data)
+	}
+
+	// a restarted replica keeps the promoted configuration
+	promoted, _ := json.Marshal(current)
+	client := fake.NewSimpleClientset(&apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "leader-nginx-configmap-rollout", Namespace: "ingress"},
+		Data:       map[string]string{promotedConfigMapKey: string(promoted)},
+	})
+	k8s.IngressPodDetails.Labels = map[string]string{"track": "stable"}
+	restarted := newConfigMapRollout(client, "leader-nginx", selector, time.Minute)
+	if data := restarted.gate(changed); data["proxy-body-size"] != "1m" {
+		t.Errorf("expected the stored promoted configuration to be applied but got %v", data)
+	}
+}
+
+func TestNextCanaryStatus(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	s := nextCanaryStatus(canaryStatus{}, "1", nil, now)
+	if !s.Healthy || !s.Since.Equal(now) || s.Checksum != "1" {
+		t.Errorf("expected a replica healthy since now but got %+v", s)
+	}
+
+	if next := nextCanaryStatus(s, "1", nil, now.Add(time.Minute)); !next.Since.Equal(now) {
+		t.Errorf("expected the replica to stay healthy since %v but got %+v", now, next)
+	}
+
+	if next := nextCanaryStatus(s, "2", nil, now.Add(time.Minute)); !next.Since.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected the soak period to restart with a new configuration but got %+v", next)
+	}
+
+	unhealthy := nextCanaryStatus(s, "1", fmt.Errorf("dynamic load balancer not started"), now.Add(time.Minute))
+	if unhealthy.Healthy || unhealthy.Message == "" {
+		t.Errorf("expected an unhealthy replica but got %+v", unhealthy)
+	}
+
+	if next := nextCanaryStatus(unhealthy, "1", nil, now.Add(2*time.Minute)); !next.Since.Equal(now.Add(2 * time.Minute)) {
+		t.Errorf("expected the soak period to restart after a failure but got %+v", next)
+	}
+}
+
+func TestCanariesReady(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+	pods := []apiv1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "canary-1"}}, {ObjectMeta: metav1.ObjectMeta{Name: "canary-2"}}}
+
+	status := func(s canaryStatus) string {
+		raw, _ := json.Marshal(s)
+		return string(raw)
+	}
+	healthy := status(canaryStatus{Checksum: "2", Healthy: true, Since: now.Add(-time.Hour)})
+
+	testCases := []struct {
+		name     string
+		canaries []apiv1.Pod
+		statuses map[string]string
+		ready    bool
+	}{
+		{"without canary replicas", nil, nil, false},
+		{"with a replica without status", pods, map[string]string{"canary-1": healthy}, false},
+		{"with a replica running the previous configuration", pods, map[string]string{
+			"canary-1": healthy,
+			"canary-2": status(canaryStatus{Checksum: "1", Healthy: true, Since: now.Add(-time.Hour)}),
+		}, false},
+		{"with an unhealthy replica", pods, map[string]string{
+			"canary-1": healthy,
+			"canary-2": status(canaryStatus{Checksum: "2", Message: "the reload of NGINX failed"}),
+		}, false},
+		{"with a replica healthy for less than the soak period", pods, map[string]string{
+			"canary-1": healthy,
+			"canary-2": status(canaryStatus{Checksum: "2", Healthy: true, Since: now.Add(-time.Minute)}),
+		}, false},
+		{"with healthy replicas", pods, map[string]string{"canary-1": healthy, "canary-2": healthy}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := canariesReady(tc.canaries, tc.statuses, "2", 10*time.Minute, now)
+			if tc.ready && err != nil {
+				t.Errorf("expected the canary replicas to be ready but got %v", err)
+			}
+			if !tc.ready && err == nil {
+				t.Errorf("expected the canary replicas not to be ready")
+			}
+		})
+	}
+}
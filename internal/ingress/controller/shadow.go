@@ -0,0 +1,160 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/controller/store"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+	"k8s.io/ingress-nginx/internal/ingress/status"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/task"
+)
+
+// runShadow runs the synchronization of the shadow mode, which renders and
+// tests the NGINX configuration of the Ingresses without starting NGINX,
+// until the controller stops
+func (n *NGINXController) runShadow() {
+	klog.InfoS("Starting the shadow mode, NGINX is not started")
+
+	go n.syncQueue.Run(time.Second, n.stopCh)
+	n.syncQueue.EnqueueTask(task.GetDummyObject("initial-sync"))
+
+	for {
+		select {
+		case event := <-n.updateCh.Out():
+			if evt, ok := event.(store.Event); ok {
+				n.syncQueue.EnqueueSkippableTask(evt.Obj)
+			}
+		case <-n.stopCh:
+			return
+		}
+	}
+}
+
+// syncShadow validates the NGINX configuration of the Ingresses of the store
+// and compares the state of the configuration of each Ingress with the
+// configuration-status annotation written by the serving controllers. When
+// the configuration is invalid, the Ingresses generating the errors are
+// looked for like in the serving controllers, where they are quarantined.
+func (n *NGINXController) syncShadow(interface{}) error {
+	n.syncRateLimiter.Accept()
+
+	if n.syncQueue.IsShuttingDown() {
+		return nil
+	}
+
+	// the configuration is not applied, its conflicts are neither recorded
+	// in the Ingresses nor notified, which is left to the serving controllers
+	dryRun := *n
+	dryRun.recorder = nil
+	dryRun.notifier = nil
+	dryRun.Proxy = &TCPProxy{}
+
+	ings := n.store.ListIngresses()
+
+	cfg := n.store.GetBackendConfiguration()
+	cfg.Resolver = n.resolver
+
+	_, _, pcfg := dryRun.getConfiguration(ings)
+
+	quarantined := map[string]string{}
+	err := dryRun.testConfiguration(cfg, *pcfg)
+	if err != nil {
+		klog.Warningf("The NGINX configuration of the Ingresses is invalid: %v", err)
+
+		_, invalid, quarantineErr := dryRun.quarantineIngresses(cfg, ings)
+		if quarantineErr != nil {
+			klog.Warningf("Unable to find the ingresses that generate an invalid configuration: %v", quarantineErr)
+			quarantined = nil
+		} else {
+			for _, q := range invalid {
+				quarantined[k8s.MetaNamespaceKey(q.ing)] = q.reason
+				klog.Warningf("Ingress %v/%v generates an invalid configuration: %v", q.ing.Namespace, q.ing.Name, q.reason)
+			}
+		}
+	}
+
+	divergences := shadowDivergences(ings, quarantined)
+	for _, d := range divergences {
+		klog.V(2).InfoS("Configuration state diverging from the serving controllers", "ingress", d.Namespace+"/"+d.Name,
+			"serving", d.ServingState, "shadow", d.ShadowState)
+	}
+
+	n.metricCollector.SetShadowValidation(err == nil, divergences)
+
+	return nil
+}
+
+// shadowState returns the state of the configuration of the ingress in the
+// shadow mode. quarantined contains the reasons of the ingresses that generate
+// errors, nil when the configuration is invalid even without them
+func shadowState(ing *ingress.Ingress, quarantined map[string]string) string {
+	if quarantined == nil {
+		return status.ConfigurationFailed
+	}
+
+	if _, ok := quarantined[k8s.MetaNamespaceKey(ing)]; ok {
+		return status.ConfigurationQuarantined
+	}
+
+	if ing.ParsedAnnotations != nil && ing.ParsedAnnotations.Denied != nil {
+		return status.ConfigurationDenied
+	}
+
+	return status.ConfigurationApplied
+}
+
+// shadowDivergences returns the ingresses whose state in the shadow mode is
+// not the one of their configuration-status annotation. The ingresses without
+// the annotation for their current generation are not compared.
+func shadowDivergences(ings []*ingress.Ingress, quarantined map[string]string) []collectors.ShadowDivergence {
+	key := parser.GetAnnotationWithPrefix(status.ConfigurationStatusAnnotation)
+
+	divergences := []collectors.ShadowDivergence{}
+	for _, ing := range ings {
+		raw, ok := ing.GetAnnotations()[key]
+		if !ok {
+			continue
+		}
+
+		serving := status.ConfigurationStatus{}
+		if err := json.Unmarshal([]byte(raw), &serving); err != nil || serving.ObservedGeneration != ing.Generation {
+			continue
+		}
+
+		state := shadowState(ing, quarantined)
+		if state == serving.State {
+			continue
+		}
+
+		divergences = append(divergences, collectors.ShadowDivergence{
+			Namespace:    ing.Namespace,
+			Name:         ing.Name,
+			ServingState: serving.State,
+			ShadowState:  state,
+		})
+	}
+
+	return divergences
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
+	"k8s.io/ingress-nginx/internal/ingress/status"
+)
+
+func TestShadowDivergences(t *testing.T) {
+	newIngress := func(name string, generation int64, configurationStatus string) *ingress.Ingress {
+		ing := &ingress.Ingress{ParsedAnnotations: &annotations.Ingress{}}
+		ing.ObjectMeta = metav1.ObjectMeta{Namespace: "default", Name: name, Generation: generation}
+		if configurationStatus != "" {
+			ing.Annotations = map[string]string{parser.GetAnnotationWithPrefix(status.ConfigurationStatusAnnotation): configurationStatus}
+		}
+		return ing
+	}
+
+	denied := newIngress("denied", 1, `{"state": "Applied", "observedGeneration": 1}`)
+	reason := "invalid"
+	denied.ParsedAnnotations.Denied = &reason
+
+	ings := []*ingress.Ingress{
+		newIngress("same", 1, `{"state": "Applied", "observedGeneration": 1}`),
+		newIngress("no-status", 1, ""),
+		newIngress("old-generation", 2, `{"state": "Quarantined", "observedGeneration": 1}`),
+		newIngress("invalid-status", 1, `{`),
+		newIngress("quarantined", 3, `{"state": "Applied", "observedGeneration": 3}`),
+		denied,
+	}
+
+	divergences := shadowDivergences(ings, map[string]string{"default/quarantined": "[emerg] invalid"})
+	expected := []collectors.ShadowDivergence{
+		{Namespace: "default", Name: "quarantined", ServingState: "Applied", ShadowState: "Quarantined"},
+		{Namespace: "default", Name: "denied", ServingState: "Applied", ShadowState: "Denied"},
+	}
+	if !reflect.DeepEqual(divergences, expected) {
+		t.Errorf("expected %v but got %v", expected, divergences)
+	}
+
+	divergences = shadowDivergences(ings[:1], nil)
+	expected = []collectors.ShadowDivergence{
+		{Namespace: "default", Name: "same", ServingState: "Applied", ShadowState: "Failed"},
+	}
+	if !reflect.DeepEqual(divergences, expected) {
+		t.Errorf("expected %v but got %v", expected, divergences)
+	}
+}
@@ -0,0 +1,606 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/ingress-nginx/internal/file"
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/task"
+)
+
+const (
+	// snapshotsDir is the directory of the snapshots of the configurations
+	// applied by the last reloads
+	snapshotsDir = "/etc/nginx/snapshots"
+)
+
+// errConfigurationRolledBack is returned by the reloads while the
+// configuration is rolled back to a snapshot
+var errConfigurationRolledBack = errors.New("the configuration is rolled back to a snapshot, the reloads are suspended until its release")
+
+// Snapshot is a configuration applied by a reload of NGINX
+type Snapshot struct {
+	// ID identifies the snapshot, the IDs of newer snapshots are greater
+	ID string `json:"id"`
+	// Time of the reload
+	Time time.Time `json:"time"`
+	// Checksum is the checksum of the configuration of the controller
+	Checksum string `json:"checksum,omitempty"`
+	// Ingresses contains the generation of each ingress of the
+	// configuration, by namespace and name
+	Ingresses map[string]int64 `json:"ingresses"`
+	// Config, Tenants and Fragments are the content of nginx.conf and of the
+	// include files of the tenants and of the snippet fragments, by name
+	Config    string            `json:"config,omitempty"`
+	Tenants   map[string]string `json:"tenants,omitempty"`
+	Fragments map[string]string `json:"fragments,omitempty"`
+	// Backends, TCPEndpoints and UDPEndpoints are the upstreams of the
+	// configuration, configured dynamically in Lua
+	Backends     []*ingress.Backend  `json:"backends,omitempty"`
+	TCPEndpoints []ingress.L4Service `json:"tcpEndpoints,omitempty"`
+	UDPEndpoints []ingress.L4Service `json:"udpEndpoints,omitempty"`
+}
+
+// newSnapshot returns the snapshot of the configuration files of a reload
+func newSnapshot(ingressCfg ingress.Configuration, content []byte, tenants, fragments map[string][]byte) *Snapshot {
+	s := &Snapshot{
+		Time:      time.Now(),
+		Checksum:  ingressCfg.ConfigurationChecksum,
+		Ingresses: map[string]int64{},
+		Config:    string(content),
+		Tenants:   map[string]string{},
+		Fragments: map[string]string{},
+
+		Backends:     ingressCfg.Backends,
+		TCPEndpoints: ingressCfg.TCPEndpoints,
+		UDPEndpoints: ingressCfg.UDPEndpoints,
+	}
+
+	for _, server := range ingressCfg.Servers {
+		for _, location := range server.Locations {
+			if location.Ingress != nil {
+				s.Ingresses[k8s.MetaNamespaceKey(location.Ingress)] = location.Ingress.Generation
+			}
+		}
+	}
+
+	for name, content := range tenants {
+		s.Tenants[name] = string(content)
+	}
+
+	for name, content := range fragments {
+		s.Fragments[name] = string(content)
+	}
+
+	return s
+}
+
+// files returns the content of nginx.conf followed by the include files of
+// the tenants and of the snippet fragments, in the format of the running
+// configuration returned by runningConfiguration
+func (s *Snapshot) files() []byte {
+	buf := bytes.NewBufferString(s.Config)
+	for _, include := range []struct {
+		dir   string
+		files map[string]string
+	}{{tenantsDir, s.Tenants}, {snippetFragmentsDir, s.Fragments}} {
+		names := make([]string, 0, len(include.files))
+		for name := range include.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Fprintf(buf, "\n# %v\n", filepath.Join(include.dir, name+".conf"))
+			buf.WriteString(include.files[name])
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// snapshotStore keeps the snapshots of the last reloads in a directory, one
+// JSON file by snapshot. A nil store keeps no snapshot.
+type snapshotStore struct {
+	dir string
+	max int
+
+	// reloadLock serializes the writes of the configuration files by the
+	// reloads and the rollbacks
+	reloadLock sync.Mutex
+
+	mu sync.Mutex
+	// current is the ID of the snapshot of the running configuration
+	current string
+	// rolledBack is the snapshot the configuration is rolled back to, nil
+	// when it is not rolled back
+	rolledBack *Snapshot
+	// outdated is true when the running configuration is not the one of the
+	// objects of the cluster, after a rollback, until the next reload
+	outdated bool
+}
+
+// newSnapshotStore returns a store keeping the last max snapshots in the
+// directory dir, nil when max is not positive. The newest snapshot of the
+// directory, the configuration of the last reload before a restart, is the
+// current one until the next reload.
+func newSnapshotStore(dir string, max int) *snapshotStore {
+	if max <= 0 {
+		return nil
+	}
+
+	s := &snapshotStore{dir: dir, max: max}
+
+	ids, err := s.ids()
+	if err == nil && len(ids) > 0 {
+		s.current = strconv.FormatInt(ids[len(ids)-1], 10)
+	}
+
+	return s
+}
+
+func (s *snapshotStore) lock() {
+	if s != nil {
+		s.reloadLock.Lock()
+	}
+}
+
+func (s *snapshotStore) unlock() {
+	if s != nil {
+		s.reloadLock.Unlock()
+	}
+}
+
+// save stores the snapshot of the configuration of a successful reload and
+// removes the oldest snapshots over the maximum
+func (s *snapshotStore) save(snapshot *Snapshot) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.MkdirAll(s.dir, file.ReadWriteByUser)
+	if err != nil {
+		return err
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+
+	id := snapshot.Time.UnixNano()
+	if len(ids) > 0 && id <= ids[len(ids)-1] {
+		id = ids[len(ids)-1] + 1
+	}
+	snapshot.ID = strconv.FormatInt(id, 10)
+
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(s.path(snapshot.ID), content, file.ReadWriteByUser)
+	if err != nil {
+		return err
+	}
+
+	s.current = snapshot.ID
+	s.outdated = false
+
+	ids = append(ids, id)
+	for len(ids) > s.max {
+		err = os.Remove(s.path(strconv.FormatInt(ids[0], 10)))
+		if err != nil {
+			return err
+		}
+		ids = ids[1:]
+	}
+
+	return nil
+}
+
+func (s *snapshotStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// ids returns the IDs of the stored snapshots, from the oldest to the newest
+func (s *snapshotStore) ids() ([]int64, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(files))
+	for _, f := range files {
+		id, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(f), ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	return ids, nil
+}
+
+// get returns the snapshot with the given ID
+func (s *snapshotStore) get(id string) (*Snapshot, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid snapshot ID %q", id)
+	}
+
+	content, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot %v not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	err = json.Unmarshal(content, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("reading the snapshot %v: %v", id, err)
+	}
+
+	return snapshot, nil
+}
+
+// list returns the stored snapshots, from the oldest to the newest, without
+// the content of their files
+func (s *snapshotStore) list() ([]*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]*Snapshot, 0, len(ids))
+	for _, id := range ids {
+		snapshot, err := s.get(strconv.FormatInt(id, 10))
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, snapshot.summary())
+	}
+
+	return snapshots, nil
+}
+
+// summary returns the snapshot without the content of its files and its
+// upstreams
+func (s *Snapshot) summary() *Snapshot {
+	summary := *s
+	summary.Config = ""
+	summary.Tenants = nil
+	summary.Fragments = nil
+	summary.Backends = nil
+	summary.TCPEndpoints = nil
+	summary.UDPEndpoints = nil
+
+	return &summary
+}
+
+// rollbackTarget returns the snapshot with the given ID or, when id is
+// empty, the one preceding the running configuration
+func (s *snapshotStore) rollbackTarget(id string) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id != "" {
+		return s.get(id)
+	}
+
+	current := s.current
+	if s.rolledBack != nil {
+		current = s.rolledBack.ID
+	}
+
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	currentID, _ := strconv.ParseInt(current, 10, 64)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if ids[i] < currentID {
+			return s.get(strconv.FormatInt(ids[i], 10))
+		}
+	}
+
+	return nil, fmt.Errorf("no snapshot older than the running configuration")
+}
+
+// setRolledBack records the rollback of the configuration to a snapshot
+func (s *snapshotStore) setRolledBack(snapshot *Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rolledBack = snapshot
+	s.outdated = true
+}
+
+// release ends the rollback of the configuration, the running configuration
+// stays outdated until the next reload. Returns false if the configuration
+// is not rolled back.
+func (s *snapshotStore) release() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rolledBack == nil {
+		return false
+	}
+
+	s.rolledBack = nil
+	s.outdated = true
+	return true
+}
+
+// setOutdated records that the running configuration is not the one of the
+// objects of the cluster, to force the next reload
+func (s *snapshotStore) setOutdated() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outdated = true
+}
+
+// rolledBackTo returns the ID of the snapshot the configuration is rolled
+// back to, empty when it is not rolled back
+func (s *snapshotStore) rolledBackTo() string {
+	if s == nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rolledBack == nil {
+		return ""
+	}
+
+	return s.rolledBack.ID
+}
+
+// withRolledBackUpstreams returns the configuration with the upstreams of
+// the snapshot the configuration is rolled back to, which are the ones
+// used by its locations, with the endpoints of the upstreams of the same
+// name of pcfg, so they keep following the pods of the services. Returns
+// pcfg when the configuration is not rolled back or when the snapshot has
+// no upstreams.
+func (s *snapshotStore) withRolledBackUpstreams(pcfg *ingress.Configuration) *ingress.Configuration {
+	if s == nil {
+		return pcfg
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rolledBack == nil || len(s.rolledBack.Backends) == 0 {
+		return pcfg
+	}
+
+	endpoints := make(map[string][]ingress.Endpoint, len(pcfg.Backends))
+	for _, backend := range pcfg.Backends {
+		endpoints[backend.Name] = backend.Endpoints
+	}
+
+	cfg := *pcfg
+	cfg.Backends = make([]*ingress.Backend, 0, len(s.rolledBack.Backends))
+	for _, backend := range s.rolledBack.Backends {
+		b := *backend
+		if current, ok := endpoints[b.Name]; ok {
+			b.Endpoints = current
+		}
+		cfg.Backends = append(cfg.Backends, &b)
+	}
+
+	cfg.TCPEndpoints = withCurrentEndpoints(s.rolledBack.TCPEndpoints, pcfg.TCPEndpoints)
+	cfg.UDPEndpoints = withCurrentEndpoints(s.rolledBack.UDPEndpoints, pcfg.UDPEndpoints)
+
+	return &cfg
+}
+
+// withCurrentEndpoints returns the stream services with the endpoints of
+// the current services listening on the same port
+func withCurrentEndpoints(services, current []ingress.L4Service) []ingress.L4Service {
+	endpoints := make(map[int][]ingress.Endpoint, len(current))
+	for _, service := range current {
+		endpoints[service.Port] = service.Endpoints
+	}
+
+	result := make([]ingress.L4Service, 0, len(services))
+	for _, service := range services {
+		if current, ok := endpoints[service.Port]; ok {
+			service.Endpoints = current
+		}
+		result = append(result, service)
+	}
+
+	return result
+}
+
+// isOutdated returns true if the running configuration must be reloaded
+// even when the objects of the cluster did not change
+func (s *snapshotStore) isOutdated() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.outdated
+}
+
+// rollbackConfiguration applies the configuration of the snapshot with the
+// given ID, or of the snapshot preceding the running configuration when id
+// is empty, and suspends the reloads until the release of the rollback
+func (n *NGINXController) rollbackConfiguration(id string) (*Snapshot, error) {
+	if n.snapshots == nil {
+		return nil, fmt.Errorf("the configuration snapshots are disabled")
+	}
+
+	n.snapshots.lock()
+	defer n.snapshots.unlock()
+
+	snapshot, err := n.snapshots.rollbackTarget(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = n.applySnapshot(snapshot)
+	if err != nil {
+		// the files of the running configuration were possibly overwritten
+		n.snapshots.setOutdated()
+		n.syncQueue.EnqueueTask(task.GetDummyObject("configuration-rollback"))
+		return nil, err
+	}
+
+	n.snapshots.setRolledBack(snapshot)
+
+	// the upstreams of the snapshot, with the endpoints of the running
+	// configuration, are configured by the next synchronization
+	n.syncQueue.EnqueueTask(task.GetDummyObject("configuration-rollback"))
+	if n.metricCollector != nil {
+		n.metricCollector.SetConfigurationFileHash(configurationFileHash([]byte(snapshot.Config), stringsToBytes(snapshot.Tenants)))
+	}
+
+	return snapshot, nil
+}
+
+// applySnapshot writes the configuration files of the snapshot, tests them
+// and reloads NGINX
+func (n *NGINXController) applySnapshot(snapshot *Snapshot) error {
+	err := writeIncludeFiles(snippetFragmentsDir, stringsToBytes(snapshot.Fragments))
+	if err != nil {
+		return err
+	}
+
+	err = writeIncludeFiles(tenantsDir, stringsToBytes(snapshot.Tenants))
+	if err != nil {
+		return err
+	}
+
+	err = n.testSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(cfgPath, []byte(snapshot.Config), file.ReadWriteByUser)
+	if err != nil {
+		return err
+	}
+
+	o, err := n.command.ExecCommand("-s", "reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v\n%v", err, string(o))
+	}
+
+	return nil
+}
+
+// testSnapshot checks the configuration of the snapshot with "nginx -t",
+// including the files of its tenants from a temporary directory
+func (n *NGINXController) testSnapshot(snapshot *Snapshot) error {
+	if len(snapshot.Tenants) == 0 {
+		return n.testTemplate([]byte(snapshot.Config))
+	}
+
+	dir, err := ioutil.TempDir("", tempTenantsPattern)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	err = writeIncludeFiles(dir, stringsToBytes(snapshot.Tenants))
+	if err != nil {
+		return err
+	}
+
+	content := strings.ReplaceAll(snapshot.Config, "include "+tenantsDir+"/", "include "+dir+"/")
+	return n.testTemplate([]byte(content))
+}
+
+// releaseConfiguration ends the rollback of the configuration, the next
+// synchronization reloads NGINX with the configuration of the objects of
+// the cluster
+func (n *NGINXController) releaseConfiguration() error {
+	if !n.snapshots.release() {
+		return fmt.Errorf("the configuration is not rolled back")
+	}
+
+	n.syncQueue.EnqueueTask(task.GetDummyObject("configuration-release"))
+	return nil
+}
+
+// diffContents returns the unified diff between the contents from and to
+func diffContents(from, to []byte) ([]byte, error) {
+	if bytes.Equal(from, to) {
+		return nil, nil
+	}
+
+	tmpfile, err := ioutil.TempFile("", "snapshot-nginx-cfg")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	_, err = tmpfile.Write(from)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffConfiguration(tmpfile.Name(), to)
+}
+
+func stringsToBytes(files map[string]string) map[string][]byte {
+	result := make(map[string][]byte, len(files))
+	for name, content := range files {
+		result[name] = []byte(content)
+	}
+
+	return result
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := newSnapshotStore(dir, 2)
+	now := time.Now()
+
+	var ids []string
+	for _, config := range []string{"first", "second", "third"} {
+		snapshot := &Snapshot{Time: now, Checksum: config, Config: config}
+		if err := store.save(snapshot); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, snapshot.ID)
+	}
+
+	snapshots, err := store.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].ID != ids[1] || snapshots[1].ID != ids[2] {
+		t.Fatalf("expected the snapshots %v but got %v", ids[1:], snapshots)
+	}
+	if snapshots[0].Config != "" {
+		t.Errorf("expected the snapshots to be listed without their configuration")
+	}
+
+	if _, err := store.get(ids[0]); err == nil {
+		t.Errorf("expected the oldest snapshot to be removed")
+	}
+
+	target, err := store.rollbackTarget("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.ID != ids[1] || target.Config != "second" {
+		t.Errorf("expected the rollback to the snapshot %v but got %v", ids[1], target.ID)
+	}
+
+	store.setRolledBack(target)
+	if store.rolledBackTo() != ids[1] || !store.isOutdated() {
+		t.Errorf("expected the configuration rolled back to the snapshot %v", ids[1])
+	}
+
+	if _, err := store.rollbackTarget(""); err == nil {
+		t.Errorf("expected an error without snapshot older than the rolled back one")
+	}
+
+	if !store.release() || store.rolledBackTo() != "" || !store.isOutdated() {
+		t.Errorf("expected the release of the rollback to keep the configuration outdated")
+	}
+	if store.release() {
+		t.Errorf("expected no release without rollback")
+	}
+
+	if err := store.save(&Snapshot{Time: now}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.isOutdated() {
+		t.Errorf("expected the reload to update the configuration")
+	}
+
+	if _, err := store.get("../nginx"); err == nil {
+		t.Errorf("expected an error with an invalid snapshot ID")
+	}
+
+	// the running configuration after a restart is the last one saved
+	restarted := newSnapshotStore(dir, 2)
+	target, err = restarted.rollbackTarget("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.ID != ids[2] {
+		t.Errorf("expected the rollback to the snapshot %v after a restart but got %v", ids[2], target.ID)
+	}
+}
+
+func TestWithRolledBackUpstreams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := newSnapshotStore(dir, 2)
+
+	pcfg := &ingress.Configuration{
+		Backends: []*ingress.Backend{
+			{Name: "default-demo-80", Endpoints: []ingress.Endpoint{{Address: "10.0.0.2", Port: "8080"}}},
+			{Name: "default-new-80"},
+		},
+		TCPEndpoints: []ingress.L4Service{{Port: 5432, Endpoints: []ingress.Endpoint{{Address: "10.0.0.3", Port: "5432"}}}},
+	}
+
+	if cfg := store.withRolledBackUpstreams(pcfg); cfg != pcfg {
+		t.Errorf("expected the configuration without rollback")
+	}
+
+	store.setRolledBack(&Snapshot{
+		ID: "1",
+		Backends: []*ingress.Backend{
+			{Name: "default-demo-80", SSLPassthrough: true, Endpoints: []ingress.Endpoint{{Address: "10.0.0.1", Port: "8080"}}},
+			{Name: "default-old-80", Endpoints: []ingress.Endpoint{{Address: "10.0.0.4", Port: "8080"}}},
+		},
+		TCPEndpoints: []ingress.L4Service{{Port: 5432}},
+	})
+
+	cfg := store.withRolledBackUpstreams(pcfg)
+	if len(cfg.Backends) != 2 || cfg.Backends[0].Name != "default-demo-80" || cfg.Backends[1].Name != "default-old-80" {
+		t.Fatalf("expected the backends of the snapshot but got %v", cfg.Backends)
+	}
+	if !cfg.Backends[0].SSLPassthrough || cfg.Backends[0].Endpoints[0].Address != "10.0.0.2" {
+		t.Errorf("expected the backend of the snapshot with the current endpoints but got %+v", cfg.Backends[0])
+	}
+	if cfg.Backends[1].Endpoints[0].Address != "10.0.0.4" {
+		t.Errorf("expected the endpoints of the snapshot without current backend but got %+v", cfg.Backends[1])
+	}
+	if len(cfg.TCPEndpoints) != 1 || len(cfg.TCPEndpoints[0].Endpoints) != 1 {
+		t.Errorf("expected the stream services of the snapshot with the current endpoints but got %+v", cfg.TCPEndpoints)
+	}
+	if pcfg.Backends[0].SSLPassthrough {
+		t.Errorf("expected the configuration of the cluster not to be modified")
+	}
+}
+
+func TestNilSnapshotStore(t *testing.T) {
+	store := newSnapshotStore("", 0)
+	if store != nil {
+		t.Fatalf("expected no store without snapshots")
+	}
+
+	store.lock()
+	store.unlock()
+
+	if err := store.save(&Snapshot{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if store.rolledBackTo() != "" || store.isOutdated() || store.release() {
+		t.Errorf("expected no rollback without snapshots")
+	}
+}
+
+func TestNewSnapshot(t *testing.T) {
+	ing := &ingress.Ingress{
+		Ingress: networking.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", Generation: 3},
+		},
+	}
+
+	snapshot := newSnapshot(ingress.Configuration{
+		ConfigurationChecksum: "123",
+		Servers: []*ingress.Server{{
+			Hostname:  "demo.example.com",
+			Locations: []*ingress.Location{{Path: "/", Ingress: ing}, {Path: "/default"}},
+		}},
+	}, []byte("http {}\n"), map[string][]byte{"default": []byte("server {}\n")}, map[string][]byte{"cors": []byte("add_header a b;\n")})
+
+	if snapshot.Checksum != "123" || snapshot.Ingresses["default/demo"] != 3 || len(snapshot.Ingresses) != 1 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+
+	expected := "http {}\n" +
+		"\n# /etc/nginx/tenants/default.conf\nserver {}\n" +
+		"\n# /etc/nginx/fragments/cors.conf\nadd_header a b;\n"
+	if files := string(snapshot.files()); files != expected {
+		t.Errorf("expected\n%v\nbut got\n%v", expected, files)
+	}
+}
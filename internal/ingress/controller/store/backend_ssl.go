@@ -19,16 +19,16 @@ package store
 import (
 	"fmt"
 	"strings"
-
-	"k8s.io/klog/v2"
+	"time"
 
 	"github.com/pkg/errors"
 	apiv1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"k8s.io/ingress-nginx/internal/file"
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/logging"
 	"k8s.io/ingress-nginx/internal/net/ssl"
 )
 
@@ -38,12 +38,13 @@ func (s *k8sStore) syncSecret(key string) {
 	s.syncSecretMu.Lock()
 	defer s.syncSecretMu.Unlock()
 
-	klog.V(3).InfoS("Syncing Secret", "name", key)
+	logging.SSL.V(3).InfoS("Syncing Secret", "name", key)
 
 	cert, err := s.getPemCertificate(key)
 	if err != nil {
 		if !isErrSecretForAuth(err) {
-			klog.Warningf("Error obtaining X.509 certificate: %v", err)
+			logging.SSL.Warningf("Error obtaining X.509 certificate: %v", err)
+			s.recordInvalidSecret(key, err)
 		}
 		return
 	}
@@ -55,7 +56,7 @@ func (s *k8sStore) syncSecret(key string) {
 			// no need to update
 			return
 		}
-		klog.InfoS("Updating secret in local store", "name", key)
+		logging.SSL.InfoS("Updating secret in local store", "name", key)
 		s.sslStore.Update(key, cert)
 		// this update must trigger an update
 		// (like an update event from a change in Ingress)
@@ -63,7 +64,7 @@ func (s *k8sStore) syncSecret(key string) {
 		return
 	}
 
-	klog.InfoS("Adding secret to local store", "name", key)
+	logging.SSL.InfoS("Adding secret to local store", "name", key)
 	s.sslStore.Add(key, cert)
 	// this update must trigger an update
 	// (like an update event from a change in Ingress)
@@ -99,11 +100,23 @@ func (s *k8sStore) getPemCertificate(secretName string) (*ingress.SSLCert, error
 			return nil, fmt.Errorf("key 'tls.key' missing from Secret %q", secretName)
 		}
 
+		// the certificate is validated before writing any file, so the
+		// previous one is still served when the Secret is updated with an
+		// invalid certificate
+		cert, err = ssl.SortCertChain(cert)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate chain: %v", err)
+		}
+
 		sslCert, err = ssl.CreateSSLCert(cert, key, string(secret.UID))
 		if err != nil {
 			return nil, fmt.Errorf("unexpected error creating SSL Cert: %v", err)
 		}
 
+		if cur, err := s.GetLocalSSLCert(secretName); err == nil && isExpired(sslCert) && !isExpired(cur) {
+			return nil, fmt.Errorf("the certificate expired on %v", sslCert.ExpireTime)
+		}
+
 		if len(ca) > 0 {
 			caCert, err := ssl.CheckCACert(ca)
 			if err != nil {
@@ -142,7 +155,7 @@ func (s *k8sStore) getPemCertificate(secretName string) (*ingress.SSLCert, error
 			msg += " and CRL"
 		}
 
-		klog.V(3).InfoS(msg)
+		logging.SSL.V(3).InfoS(msg)
 	} else if len(ca) > 0 {
 		sslCert, err = ssl.CreateCACert(ca)
 		if err != nil {
@@ -162,7 +175,7 @@ func (s *k8sStore) getPemCertificate(secretName string) (*ingress.SSLCert, error
 		}
 		// makes this secret in 'syncSecret' to be used for Certificate Authentication
 		// this does not enable Certificate Authentication
-		klog.V(3).InfoS("Configuring Secret for TLS authentication", "secret", secretName)
+		logging.SSL.V(3).InfoS("Configuring Secret for TLS authentication", "secret", secretName)
 	} else {
 		if auth != nil {
 			return nil, ErrSecretForAuth
@@ -187,6 +200,27 @@ func (s *k8sStore) getPemCertificate(secretName string) (*ingress.SSLCert, error
 	return sslCert, nil
 }
 
+// recordInvalidSecret records an Event in a Secret with an invalid certificate
+// when the previous certificate of the Secret is still served
+func (s *k8sStore) recordInvalidSecret(key string, err error) {
+	if _, cerr := s.GetLocalSSLCert(key); cerr != nil {
+		return
+	}
+
+	secret, serr := s.listers.Secret.ByKey(key)
+	if serr != nil {
+		return
+	}
+
+	logging.SSL.Warningf("Keeping the previous certificate of Secret %v", key)
+	s.recorder.Eventf(secret, apiv1.EventTypeWarning, "InvalidCertificate", "Keeping the previous certificate: %v", err)
+}
+
+// isExpired returns true when a certificate is no longer valid
+func isExpired(cert *ingress.SSLCert) bool {
+	return time.Now().After(cert.ExpireTime)
+}
+
 // sendDummyEvent sends a dummy event to trigger an update
 // This is used in when a secret change
 func (s *k8sStore) sendDummyEvent() {
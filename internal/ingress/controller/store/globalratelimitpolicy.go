@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+// GlobalRateLimitPolicyResource is the resource of the GlobalRateLimitPolicy
+// custom resource, referenced by the global-rate-limit-policy annotation
+var GlobalRateLimitPolicyResource = schema.GroupVersionResource{
+	Group:    "ingress-nginx.kubernetes.io",
+	Version:  "v1alpha1",
+	Resource: "globalratelimitpolicies",
+}
+
+// GlobalRateLimitPolicyLister makes a Store that lists GlobalRateLimitPolicies.
+type GlobalRateLimitPolicyLister struct {
+	cache.Store
+}
+
+// ByKey returns the spec of the GlobalRateLimitPolicy matching key in the
+// local GlobalRateLimitPolicy Store.
+func (gl *GlobalRateLimitPolicyLister) ByKey(key string) (*resolver.GlobalRateLimitPolicy, error) {
+	if gl.Store == nil {
+		return nil, fmt.Errorf("GlobalRateLimitPolicies are not watched, see --watch-global-rate-limit-policies")
+	}
+
+	obj, exists, err := gl.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, NotExistsError(key)
+	}
+
+	return toGlobalRateLimitPolicy(obj)
+}
+
+// toGlobalRateLimitPolicy converts the spec of an unstructured
+// GlobalRateLimitPolicy
+func toGlobalRateLimitPolicy(obj interface{}) (*resolver.GlobalRateLimitPolicy, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected GlobalRateLimitPolicy object %T", obj)
+	}
+
+	spec, found, err := unstructured.NestedMap(u.Object, "spec")
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("GlobalRateLimitPolicy %v/%v has no spec", u.GetNamespace(), u.GetName())
+	}
+
+	policy := &resolver.GlobalRateLimitPolicy{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(spec, policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid spec of GlobalRateLimitPolicy %v/%v: %v", u.GetNamespace(), u.GetName(), err)
+	}
+
+	return policy, nil
+}
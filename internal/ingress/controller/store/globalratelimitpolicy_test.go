@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/ingress-nginx/internal/ingress/resolver"
+)
+
+func TestGlobalRateLimitPolicyLister(t *testing.T) {
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "ingress-nginx.kubernetes.io/v1alpha1",
+		"kind":       "GlobalRateLimitPolicy",
+		"metadata": map[string]interface{}{
+			"name":      "api",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"limit":  int64(100),
+			"window": "1m",
+			"key":    "${http_x_api_key}",
+			"exemptions": map[string]interface{}{
+				"cidrs": []interface{}{"10.0.0.0/8"},
+				"headers": []interface{}{
+					map[string]interface{}{"name": "X-Partner-Token", "value": "s3cr3t"},
+				},
+			},
+			"store": "redis",
+		},
+	}}
+
+	invalid := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":      "invalid",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"limit": "many",
+		},
+	}}
+
+	lister := &GlobalRateLimitPolicyLister{}
+	if _, err := lister.ByKey("default/api"); err == nil {
+		t.Errorf("expected an error when the policies are not watched")
+	}
+
+	lister.Store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	lister.Add(policy)
+	lister.Add(invalid)
+
+	actual, err := lister.ByKey("default/api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := &resolver.GlobalRateLimitPolicy{
+		Limit:  100,
+		Window: "1m",
+		Key:    "${http_x_api_key}",
+		Exemptions: resolver.GlobalRateLimitExemptions{
+			CIDRs:   []string{"10.0.0.0/8"},
+			Headers: []resolver.GlobalRateLimitExemptedHeader{{Name: "X-Partner-Token", Value: "s3cr3t"}},
+		},
+		Store: "redis",
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %+v but got %+v", expected, actual)
+	}
+
+	if _, err := lister.ByKey("default/invalid"); err == nil {
+		t.Errorf("expected an error with an invalid spec")
+	}
+
+	_, err = lister.ByKey("default/missing")
+	if _, ok := err.(NotExistsError); !ok {
+		t.Errorf("expected a NotExistsError but got %v", err)
+	}
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package store
 
 import (
-	networking "k8s.io/api/networking/v1beta1"
+	"fmt"
+
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/ingress-nginx/internal/ingress"
 )
@@ -36,7 +38,12 @@ func (il IngressLister) ByKey(key string) (*networking.Ingress, error) {
 	if !exists {
 		return nil, NotExistsError(key)
 	}
-	return i.(*networking.Ingress), nil
+	ing, ok := toIngress(i)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for the Ingress %v", i, key)
+	}
+
+	return ing, nil
 }
 
 // FilterIngresses returns the list of Ingresses
@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"sync"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// ServicePortMap is a cache of the named ports of Services, used to resolve
+// the Service ports referenced by name in the Ingress backends. Like in the
+// resolution of the Endpoints, the ports are also found by the name of their
+// target port.
+type ServicePortMap interface {
+	Insert(key string, svc *apiv1.Service)
+	Delete(key string)
+	Has(key string) bool
+	Get(key, name string) (apiv1.ServicePort, bool)
+	Lookup(key string, svc *apiv1.Service, name string) (apiv1.ServicePort, bool)
+	Len() int
+}
+
+// servicePorts contains the named ports of a version of a Service
+type servicePorts struct {
+	resourceVersion string
+	ports           map[string]apiv1.ServicePort
+}
+
+type servicePortMap struct {
+	sync.RWMutex
+	v map[string]servicePorts
+}
+
+// NewServicePortMap returns a new ServicePortMap.
+func NewServicePortMap() ServicePortMap {
+	return &servicePortMap{
+		v: make(map[string]servicePorts),
+	}
+}
+
+func namedPorts(svc *apiv1.Service) servicePorts {
+	ports := make(map[string]apiv1.ServicePort, len(svc.Spec.Ports))
+	for _, port := range svc.Spec.Ports {
+		if port.Name != "" {
+			ports[port.Name] = port
+		}
+	}
+
+	// port names take precedence over the names of the target ports
+	for _, port := range svc.Spec.Ports {
+		if port.TargetPort.Type != intstr.String {
+			continue
+		}
+
+		if _, ok := ports[port.TargetPort.StrVal]; !ok {
+			ports[port.TargetPort.StrVal] = port
+		}
+	}
+
+	return servicePorts{resourceVersion: svc.ResourceVersion, ports: ports}
+}
+
+// Insert caches the named ports of a Service.
+func (s *servicePortMap) Insert(key string, svc *apiv1.Service) {
+	ports := namedPorts(svc)
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.v[key] = ports
+}
+
+// Delete removes the ports of a Service from the cache.
+func (s *servicePortMap) Delete(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.v, key)
+}
+
+// Has returns whether the ports of a Service are cached.
+func (s *servicePortMap) Has(key string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.v[key]
+	return ok
+}
+
+// Get returns the port of a Service with the given name.
+func (s *servicePortMap) Get(key, name string) (apiv1.ServicePort, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	port, ok := s.v[key].ports[name]
+	return port, ok
+}
+
+// Lookup returns the port of the given Service with the given name. The
+// ports cached for another version of the Service are replaced, so the port
+// always belongs to the Service the caller has.
+func (s *servicePortMap) Lookup(key string, svc *apiv1.Service, name string) (apiv1.ServicePort, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	ports, ok := s.v[key]
+	if !ok || ports.resourceVersion != svc.ResourceVersion {
+		ports = namedPorts(svc)
+		s.v[key] = ports
+	}
+
+	port, ok := ports.ports[name]
+	return port, ok
+}
+
+// Len returns the count of cached Services.
+func (s *servicePortMap) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.v)
+}
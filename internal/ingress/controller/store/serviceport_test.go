@@ -0,0 +1,123 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestServicePortMapOperations(t *testing.T) {
+	spm := NewServicePortMap()
+
+	svc := &apiv1.Service{
+		Spec: apiv1.ServiceSpec{
+			Ports: []apiv1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)},
+				{Name: "https", Port: 443, TargetPort: intstr.FromString("tls")},
+				{Port: 9090},
+			},
+		},
+	}
+
+	spm.Insert("ns/svc", svc)
+	if l := spm.Len(); l != 1 {
+		t.Fatalf("Expected 1 cached Service (got %d)", l)
+	}
+
+	if !spm.Has("ns/svc") {
+		t.Error("Expected the \"ns/svc\" Service to be cached")
+	}
+
+	port, ok := spm.Get("ns/svc", "https")
+	if !ok {
+		t.Fatal("Expected the \"https\" port to exist")
+	}
+	if port.Port != 443 {
+		t.Errorf("Expected the \"https\" port to be 443 (got %d)", port.Port)
+	}
+
+	port, ok = spm.Get("ns/svc", "tls")
+	if !ok {
+		t.Fatal("Expected the port with the \"tls\" target port to exist")
+	}
+	if port.Port != 443 {
+		t.Errorf("Expected the \"tls\" target port to be 443 (got %d)", port.Port)
+	}
+
+	if _, ok := spm.Get("ns/svc", "grpc"); ok {
+		t.Error("Expected the \"grpc\" port not to exist")
+	}
+
+	if _, ok := spm.Get("ns/other", "http"); ok {
+		t.Error("Expected the ports of \"ns/other\" not to be cached")
+	}
+
+	// update the Service
+	svc.Spec.Ports = svc.Spec.Ports[:1]
+	spm.Insert("ns/svc", svc)
+	if _, ok := spm.Get("ns/svc", "https"); ok {
+		t.Error("Expected the \"https\" port to be removed")
+	}
+
+	spm.Delete("ns/svc")
+	if spm.Has("ns/svc") {
+		t.Error("Expected the \"ns/svc\" Service to be removed")
+	}
+	if l := spm.Len(); l != 0 {
+		t.Errorf("Expected no cached Services (got %d)", l)
+	}
+}
+
+func TestServicePortMapLookup(t *testing.T) {
+	spm := NewServicePortMap()
+
+	svc := &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{ResourceVersion: "1"},
+		Spec: apiv1.ServiceSpec{
+			Ports: []apiv1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)},
+			},
+		},
+	}
+
+	port, ok := spm.Lookup("ns/svc", svc, "http")
+	if !ok || port.Port != 80 {
+		t.Fatalf("Expected the \"http\" port to be 80 (got %v, %v)", port.Port, ok)
+	}
+	if !spm.Has("ns/svc") {
+		t.Error("Expected the \"ns/svc\" Service to be cached")
+	}
+
+	// the ports of another version of the Service are not used, even when
+	// the cache was not invalidated yet
+	updated := svc.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Spec.Ports[0].Port = 8000
+
+	port, ok = spm.Lookup("ns/svc", updated, "http")
+	if !ok || port.Port != 8000 {
+		t.Errorf("Expected the \"http\" port to be 8000 (got %v, %v)", port.Port, ok)
+	}
+
+	if _, ok := spm.Lookup("ns/svc", updated, "grpc"); ok {
+		t.Error("Expected the \"grpc\" port not to exist")
+	}
+}
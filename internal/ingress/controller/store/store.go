@@ -23,21 +23,23 @@ import (
 	"io/ioutil"
 	"reflect"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/eapache/channels"
 	corev1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
 	networkingv1beta1 "k8s.io/api/networking/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	k8sruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/kubernetes/scheme"
-	clientcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
@@ -48,12 +50,16 @@ import (
 	"k8s.io/ingress-nginx/internal/ingress/annotations"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/class"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/proxyssl"
 	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
 	ngx_template "k8s.io/ingress-nginx/internal/ingress/controller/template"
 	"k8s.io/ingress-nginx/internal/ingress/defaults"
 	"k8s.io/ingress-nginx/internal/ingress/errors"
+	"k8s.io/ingress-nginx/internal/ingress/events"
 	"k8s.io/ingress-nginx/internal/ingress/resolver"
+	"k8s.io/ingress-nginx/internal/ingress/status"
 	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/logging"
 	"k8s.io/ingress-nginx/internal/nginx"
 )
 
@@ -75,6 +81,9 @@ type Storer interface {
 	// GetService returns the Service matching key.
 	GetService(key string) (*corev1.Service, error)
 
+	// GetServicePort returns the port of the Service with the given name.
+	GetServicePort(svc *corev1.Service, name string) (*corev1.ServicePort, error)
+
 	// GetServiceEndpoints returns the Endpoints of a Service matching key.
 	GetServiceEndpoints(key string) (*corev1.Endpoints, error)
 
@@ -92,9 +101,26 @@ type Storer interface {
 	//   ca.crt: contains the certificate chain used for authentication
 	GetAuthCertificate(string) (*resolver.AuthSSLCert, error)
 
+	// GetGlobalRateLimitPolicy returns the spec of the GlobalRateLimitPolicy matching key.
+	GetGlobalRateLimitPolicy(key string) (*resolver.GlobalRateLimitPolicy, error)
+
 	// GetDefaultBackend returns the default backend configuration
 	GetDefaultBackend() defaults.Backend
 
+	// GetTLSHostSecret returns the Secret, in namespace/name format, mapped to
+	// the host in the ConfigMap of the tls-host-secrets-configmap setting
+	GetTLSHostSecret(host string) string
+
+	// SetConfigMapGate sets the function returning the data of the
+	// configuration ConfigMaps to apply from their current data, the data
+	// is applied as is by default. The function is called with the store
+	// locked and must not use it.
+	SetConfigMapGate(gate func(data map[string]string) map[string]string)
+
+	// ApplyConfigMaps applies the data of the configuration ConfigMaps again
+	// and triggers a synchronization
+	ApplyConfigMaps()
+
 	// Run initiates the synchronization of the controllers
 	Run(stopCh chan struct{})
 }
@@ -126,6 +152,12 @@ type Informer struct {
 	Service   cache.SharedIndexInformer
 	Secret    cache.SharedIndexInformer
 	ConfigMap cache.SharedIndexInformer
+	// ConfigurationConfigMaps watch the configuration ConfigMaps outside of
+	// the watched namespace, like the one of the parameters of the
+	// IngressClass
+	ConfigurationConfigMaps []cache.SharedIndexInformer
+	// GlobalRateLimitPolicy is nil unless --watch-global-rate-limit-policies is set
+	GlobalRateLimitPolicy cache.SharedIndexInformer
 }
 
 // Lister contains object listers (stores).
@@ -136,6 +168,7 @@ type Lister struct {
 	Secret                SecretLister
 	ConfigMap             ConfigMapLister
 	IngressWithAnnotation IngressWithAnnotationsLister
+	GlobalRateLimitPolicy GlobalRateLimitPolicyLister
 }
 
 // NotExistsError is returned when an object does not exist in a local store.
@@ -153,14 +186,26 @@ func (i *Informer) Run(stopCh chan struct{}) {
 	go i.Service.Run(stopCh)
 	go i.ConfigMap.Run(stopCh)
 
-	// wait for all involved caches to be synced before processing items
-	// from the queue
-	if !cache.WaitForCacheSync(stopCh,
+	hasSynced := []cache.InformerSynced{
 		i.Endpoint.HasSynced,
 		i.Service.HasSynced,
 		i.Secret.HasSynced,
 		i.ConfigMap.HasSynced,
-	) {
+	}
+
+	for _, informer := range i.ConfigurationConfigMaps {
+		go informer.Run(stopCh)
+		hasSynced = append(hasSynced, informer.HasSynced)
+	}
+
+	if i.GlobalRateLimitPolicy != nil {
+		go i.GlobalRateLimitPolicy.Run(stopCh)
+		hasSynced = append(hasSynced, i.GlobalRateLimitPolicy.HasSynced)
+	}
+
+	// wait for all involved caches to be synced before processing items
+	// from the queue
+	if !cache.WaitForCacheSync(stopCh, hasSynced...) {
 		runtime.HandleError(fmt.Errorf("timed out waiting for caches to sync"))
 	}
 
@@ -203,6 +248,22 @@ type k8sStore struct {
 	// secret in the annotations.
 	secretIngressMap ObjectRefMap
 
+	// policyIngressMap contains information about which ingress references a
+	// GlobalRateLimitPolicy in the annotations.
+	policyIngressMap ObjectRefMap
+
+	// configMapIngressMap contains information about which ingress references
+	// a ConfigMap in the annotations.
+	configMapIngressMap ObjectRefMap
+
+	// servicePorts caches the named ports of the Services referenced in
+	// Ingress backends.
+	servicePorts ServicePortMap
+
+	// tlsHostSecrets contains the mapping of the hosts to the TLS Secrets of
+	// the ConfigMap of the tls-host-secrets-configmap setting.
+	tlsHostSecrets TLSHostSecretMap
+
 	// updateCh
 	updateCh *channels.RingChannel
 
@@ -213,13 +274,28 @@ type k8sStore struct {
 	backendConfigMu *sync.RWMutex
 
 	defaultSSLCertificate string
+
+	// configMaps contains the keys of the configuration ConfigMap and of its
+	// overlays, in order of precedence
+	configMaps []string
+
+	// configMapData contains the last data of the configuration ConfigMaps
+	configMapData map[string]map[string]string
+
+	// configMapGate returns the data of the configuration ConfigMaps to apply
+	configMapGate func(data map[string]string) map[string]string
+
+	recorder record.EventRecorder
 }
 
 // New creates a new object store to be used in the ingress controller
 func New(
-	namespace, configmap, tcp, udp, defaultSSLCertificate string,
+	namespace, configmap string,
+	configmapOverlays []string,
+	tcp, udp, defaultSSLCertificate string,
 	resyncPeriod time.Duration,
 	client clientset.Interface,
+	dynamicClient dynamic.Interface,
 	updateCh *channels.RingChannel,
 	disableCatchAll bool) Storer {
 
@@ -232,17 +308,17 @@ func New(
 		syncSecretMu:          &sync.Mutex{},
 		backendConfigMu:       &sync.RWMutex{},
 		secretIngressMap:      NewObjectRefMap(),
+		policyIngressMap:      NewObjectRefMap(),
+		configMapIngressMap:   NewObjectRefMap(),
+		servicePorts:          NewServicePortMap(),
+		tlsHostSecrets:        NewTLSHostSecretMap(),
 		defaultSSLCertificate: defaultSSLCertificate,
+		configMaps:            append([]string{configmap}, configmapOverlays...),
+		configMapData:         make(map[string]map[string]string),
 	}
 
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartLogging(klog.Infof)
-	eventBroadcaster.StartRecordingToSink(&clientcorev1.EventSinkImpl{
-		Interface: client.CoreV1().Events(namespace),
-	})
-	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{
-		Component: "nginx-ingress-controller",
-	})
+	recorder := events.New(client, namespace)
+	store.recorder = recorder
 
 	// k8sStore fulfills resolver.Resolver interface
 	store.annotations = annotations.NewAnnotationExtractor(store)
@@ -293,7 +369,13 @@ func New(
 		informers.WithTweakListOptions(secretsTweakListOptionsFunc),
 	)
 
-	store.informers.Ingress = infFactory.Networking().V1beta1().Ingresses().Informer()
+	// the clusters older than v1.19 only serve networking.k8s.io/v1beta1,
+	// converted to networking.k8s.io/v1 by toIngress
+	if k8s.IsIngressV1Ready {
+		store.informers.Ingress = infFactory.Networking().V1().Ingresses().Informer()
+	} else {
+		store.informers.Ingress = infFactory.Networking().V1beta1().Ingresses().Informer()
+	}
 	store.listers.Ingress.Store = store.informers.Ingress.GetStore()
 
 	store.informers.Endpoint = infFactory.Core().V1().Endpoints().Informer()
@@ -308,18 +390,26 @@ func New(
 	store.informers.Service = infFactory.Core().V1().Services().Informer()
 	store.listers.Service.Store = store.informers.Service.GetStore()
 
+	// the GlobalRateLimitPolicy custom resource is only watched when its
+	// definition is installed in the cluster
+	if dynamicClient != nil {
+		infFactoryDynamic := dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, resyncPeriod, namespace, nil)
+		store.informers.GlobalRateLimitPolicy = infFactoryDynamic.ForResource(GlobalRateLimitPolicyResource).Informer()
+		store.listers.GlobalRateLimitPolicy.Store = store.informers.GlobalRateLimitPolicy.GetStore()
+	}
+
 	ingDeleteHandler := func(obj interface{}) {
 		ing, ok := toIngress(obj)
 		if !ok {
 			// If we reached here it means the ingress was deleted but its final state is unrecorded.
 			tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
 			if !ok {
-				klog.ErrorS(nil, "Error obtaining object from tombstone", "key", obj)
+				logging.Store.ErrorS(nil, "Error obtaining object from tombstone", "key", obj)
 				return
 			}
-			ing, ok = tombstone.Obj.(*networkingv1beta1.Ingress)
+			ing, ok = toIngress(tombstone.Obj)
 			if !ok {
-				klog.Errorf("Tombstone contained object that is not an Ingress: %#v", obj)
+				logging.Store.Errorf("Tombstone contained object that is not an Ingress: %#v", obj)
 				return
 			}
 		}
@@ -329,7 +419,7 @@ func New(
 		}
 
 		if hasCatchAllIngressRule(ing.Spec) && disableCatchAll {
-			klog.InfoS("Ignoring delete for catch-all because of --disable-catch-all", "ingress", klog.KObj(ing))
+			logging.Store.InfoS("Ignoring delete for catch-all because of --disable-catch-all", "ingress", klog.KObj(ing))
 			return
 		}
 
@@ -337,6 +427,8 @@ func New(
 
 		key := k8s.MetaNamespaceKey(ing)
 		store.secretIngressMap.Delete(key)
+		store.policyIngressMap.Delete(key)
+		store.configMapIngressMap.Delete(key)
 
 		updateCh.In() <- Event{
 			Type: DeleteEvent,
@@ -349,19 +441,22 @@ func New(
 			ing, _ := toIngress(obj)
 			if !class.IsValid(ing) {
 				ingressClass, _ := parser.GetStringAnnotation(class.IngressKey, ing)
-				klog.InfoS("Ignoring ingress", "ingress", klog.KObj(ing), "kubernetes.io/ingress.class", ingressClass, "ingressClassName", pointer.StringPtrDerefOr(ing.Spec.IngressClassName, ""))
+				logging.Store.InfoS("Ignoring ingress", "ingress", klog.KObj(ing), "kubernetes.io/ingress.class", ingressClass, "ingressClassName", pointer.StringPtrDerefOr(ing.Spec.IngressClassName, ""))
 				return
 			}
 
 			if hasCatchAllIngressRule(ing.Spec) && disableCatchAll {
-				klog.InfoS("Ignoring add for catch-all ingress because of --disable-catch-all", "ingress", klog.KObj(ing))
+				logging.Store.InfoS("Ignoring add for catch-all ingress because of --disable-catch-all", "ingress", klog.KObj(ing))
 				return
 			}
 
 			recorder.Eventf(ing, corev1.EventTypeNormal, "Sync", "Scheduled for sync")
+			recordDeprecatedAnnotations(recorder, ing)
 
 			store.syncIngress(ing)
 			store.updateSecretIngressMap(ing)
+			store.updatePolicyIngressMap(ing)
+			store.updateConfigMapIngressMap(ing)
 			store.syncSecrets(ing)
 
 			updateCh.In() <- Event{
@@ -378,31 +473,40 @@ func New(
 			validCur := class.IsValid(curIng)
 			if !validOld && validCur {
 				if hasCatchAllIngressRule(curIng.Spec) && disableCatchAll {
-					klog.InfoS("ignoring update for catch-all ingress because of --disable-catch-all", "ingress", klog.KObj(curIng))
+					logging.Store.InfoS("ignoring update for catch-all ingress because of --disable-catch-all", "ingress", klog.KObj(curIng))
 					return
 				}
 
-				klog.InfoS("creating ingress", "ingress", klog.KObj(curIng), "class", class.IngressKey)
+				logging.Store.InfoS("creating ingress", "ingress", klog.KObj(curIng), "class", class.IngressKey)
 				recorder.Eventf(curIng, corev1.EventTypeNormal, "Sync", "Scheduled for sync")
 			} else if validOld && !validCur {
-				klog.InfoS("removing ingress", "ingress", klog.KObj(curIng), "class", class.IngressKey)
+				logging.Store.InfoS("removing ingress", "ingress", klog.KObj(curIng), "class", class.IngressKey)
 				ingDeleteHandler(old)
 				return
+			} else if validCur && onlyConfigurationStatusChanged(oldIng, curIng) {
+				// the status is written by the controller, the configuration does not change
+				logging.Store.V(3).InfoS("Configuration status changed on ingress. Skipping update", "ingress", klog.KObj(curIng))
+				store.syncIngress(curIng)
+				return
 			} else if validCur && !reflect.DeepEqual(old, cur) {
 				if hasCatchAllIngressRule(curIng.Spec) && disableCatchAll {
-					klog.InfoS("ignoring update for catch-all ingress and delete old one because of --disable-catch-all", "ingress", klog.KObj(curIng))
+					logging.Store.InfoS("ignoring update for catch-all ingress and delete old one because of --disable-catch-all", "ingress", klog.KObj(curIng))
 					ingDeleteHandler(old)
 					return
 				}
 
 				recorder.Eventf(curIng, corev1.EventTypeNormal, "Sync", "Scheduled for sync")
 			} else {
-				klog.V(3).InfoS("No changes on ingress. Skipping update", "ingress", klog.KObj(curIng))
+				logging.Store.V(3).InfoS("No changes on ingress. Skipping update", "ingress", klog.KObj(curIng))
 				return
 			}
 
+			recordDeprecatedAnnotations(recorder, curIng)
+
 			store.syncIngress(curIng)
 			store.updateSecretIngressMap(curIng)
+			store.updatePolicyIngressMap(curIng)
+			store.updateConfigMapIngressMap(curIng)
 			store.syncSecrets(curIng)
 
 			updateCh.In() <- Event{
@@ -412,6 +516,19 @@ func New(
 		},
 	}
 
+	// the DH parameters are written to a file when NGINX is configured
+	syncDHParam := func(key string, obj interface{}) {
+		if key != store.GetBackendConfiguration().SSLDHParam {
+			return
+		}
+
+		logging.Store.InfoS("Secret of the ssl-dh-param setting changed", "secret", key)
+		updateCh.In() <- Event{
+			Type: ConfigurationEvent,
+			Obj:  obj,
+		}
+	}
+
 	secrEventHandler := cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			sec := obj.(*corev1.Secret)
@@ -421,13 +538,28 @@ func New(
 				store.syncSecret(store.defaultSSLCertificate)
 			}
 
+			if store.tlsHostSecrets.References(key) {
+				store.syncSecret(key)
+			}
+
+			syncDHParam(key, obj)
+
+			if key == store.GetBackendConfiguration().BotDetectionSecret ||
+				key == store.GetBackendConfiguration().GlobalRateLimitRedisPasswordSecret ||
+				key == store.GetBackendConfiguration().GlobalRateLimitKeyHashSecret {
+				updateCh.In() <- Event{
+					Type: ConfigurationEvent,
+					Obj:  obj,
+				}
+			}
+
 			// find references in ingresses and update local ssl certs
 			if ings := store.secretIngressMap.Reference(key); len(ings) > 0 {
-				klog.InfoS("Secret was added and it is used in ingress annotations. Parsing", "secret", key)
+				logging.Store.InfoS("Secret was added and it is used in ingress annotations. Parsing", "secret", key)
 				for _, ingKey := range ings {
 					ing, err := store.getIngress(ingKey)
 					if err != nil {
-						klog.Errorf("could not find Ingress %v in local store", ingKey)
+						logging.Store.Errorf("could not find Ingress %v in local store", ingKey)
 						continue
 					}
 					store.syncIngress(ing)
@@ -448,13 +580,31 @@ func New(
 					store.syncSecret(store.defaultSSLCertificate)
 				}
 
+				if store.tlsHostSecrets.References(key) {
+					store.syncSecret(key)
+				}
+
+				syncDHParam(key, cur)
+
+				// the signing key of the bot detection, the password of Redis
+				// and the key of the HMAC of the global rate limits are
+				// applied without reloading NGINX
+				if key == store.GetBackendConfiguration().BotDetectionSecret ||
+					key == store.GetBackendConfiguration().GlobalRateLimitRedisPasswordSecret ||
+					key == store.GetBackendConfiguration().GlobalRateLimitKeyHashSecret {
+					updateCh.In() <- Event{
+						Type: ConfigurationEvent,
+						Obj:  cur,
+					}
+				}
+
 				// find references in ingresses and update local ssl certs
 				if ings := store.secretIngressMap.Reference(key); len(ings) > 0 {
-					klog.InfoS("secret was updated and it is used in ingress annotations. Parsing", "secret", key)
+					logging.Store.InfoS("secret was updated and it is used in ingress annotations. Parsing", "secret", key)
 					for _, ingKey := range ings {
 						ing, err := store.getIngress(ingKey)
 						if err != nil {
-							klog.ErrorS(err, "could not find Ingress in local store", "ingress", ingKey)
+							logging.Store.ErrorS(err, "could not find Ingress in local store", "ingress", ingKey)
 							continue
 						}
 						store.syncSecrets(ing)
@@ -486,13 +636,22 @@ func New(
 
 			key := k8s.MetaNamespaceKey(sec)
 
+			syncDHParam(key, obj)
+
+			if store.tlsHostSecrets.References(key) {
+				updateCh.In() <- Event{
+					Type: DeleteEvent,
+					Obj:  obj,
+				}
+			}
+
 			// find references in ingresses
 			if ings := store.secretIngressMap.Reference(key); len(ings) > 0 {
-				klog.InfoS("secret was deleted and it is used in ingress annotations. Parsing", "secret", key)
+				logging.Store.InfoS("secret was deleted and it is used in ingress annotations. Parsing", "secret", key)
 				for _, ingKey := range ings {
 					ing, err := store.getIngress(ingKey)
 					if err != nil {
-						klog.Errorf("could not find Ingress %v in local store", ingKey)
+						logging.Store.Errorf("could not find Ingress %v in local store", ingKey)
 						continue
 					}
 					store.syncIngress(ing)
@@ -533,7 +692,7 @@ func New(
 
 	// TODO: add e2e test to verify that changes to one or more configmap trigger an update
 	changeTriggerUpdate := func(name string) bool {
-		return name == configmap || name == tcp || name == udp
+		return store.isConfigMap(name) || name == tcp || name == udp
 	}
 
 	handleCfgMapEvent := func(key string, cfgMap *corev1.ConfigMap, eventName string) {
@@ -542,8 +701,15 @@ func New(
 		if changeTriggerUpdate(key) {
 			triggerUpdate = true
 			recorder.Eventf(cfgMap, corev1.EventTypeNormal, eventName, fmt.Sprintf("ConfigMap %v", key))
-			if key == configmap {
-				store.setConfig(cfgMap)
+			if store.isConfigMap(key) {
+				// the values of a deleted configuration ConfigMap are not
+				// layered anymore
+				if eventName == "DELETE" {
+					store.deleteConfig(key)
+				} else {
+					store.setConfig(cfgMap)
+				}
+				store.syncTLSHostSecrets()
 			}
 		}
 
@@ -552,7 +718,7 @@ func New(
 			key := k8s.MetaNamespaceKey(ingKey)
 			ing, err := store.getIngress(key)
 			if err != nil {
-				klog.Errorf("could not find Ingress %v in local store: %v", key, err)
+				logging.Store.Errorf("could not find Ingress %v in local store: %v", key, err)
 				continue
 			}
 
@@ -566,6 +732,42 @@ func New(
 			}
 		}
 
+		// the Ingresses referencing the ConfigMap in their annotations use
+		// its new data without being updated
+		if ings := store.configMapIngressMap.Reference(key); len(ings) > 0 {
+			logging.Store.InfoS("configmap was updated and it is used in ingress annotations. Parsing", "configmap", key)
+			for _, ingKey := range ings {
+				ing, err := store.getIngress(ingKey)
+				if err != nil {
+					logging.Store.ErrorS(err, "could not find Ingress in local store", "ingress", ingKey)
+					continue
+				}
+				store.syncIngress(ing)
+			}
+
+			if !triggerUpdate {
+				recorder.Eventf(cfgMap, corev1.EventTypeNormal, eventName, fmt.Sprintf("ConfigMap %v", key))
+				triggerUpdate = true
+			}
+		}
+
+		// the bot detection rules are applied without reloading NGINX,
+		// the Ingresses do not need to be synced again
+		if !triggerUpdate && key == store.GetBackendConfiguration().BotDetectionConfigMap {
+			recorder.Eventf(cfgMap, corev1.EventTypeNormal, eventName, fmt.Sprintf("ConfigMap %v", key))
+			triggerUpdate = true
+		}
+
+		// the hosts of the Ingresses are mapped to the TLS Secrets when the
+		// servers are created, the Ingresses do not need to be synced again
+		if key == store.GetBackendConfiguration().TLSHostSecretsConfigMap {
+			store.syncTLSHostSecrets()
+			if !triggerUpdate {
+				recorder.Eventf(cfgMap, corev1.EventTypeNormal, eventName, fmt.Sprintf("ConfigMap %v", key))
+				triggerUpdate = true
+			}
+		}
+
 		if triggerUpdate {
 			updateCh.In() <- Event{
 				Type: ConfigurationEvent,
@@ -589,6 +791,67 @@ func New(
 			key := k8s.MetaNamespaceKey(cfgMap)
 			handleCfgMapEvent(key, cfgMap, "UPDATE")
 		},
+		DeleteFunc: func(obj interface{}) {
+			cfgMap, ok := obj.(*corev1.ConfigMap)
+			if !ok {
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+
+				cfgMap, ok = tombstone.Obj.(*corev1.ConfigMap)
+				if !ok {
+					return
+				}
+			}
+
+			key := k8s.MetaNamespaceKey(cfgMap)
+			handleCfgMapEvent(key, cfgMap, "DELETE")
+		},
+	}
+
+	// the Ingresses referencing a GlobalRateLimitPolicy are parsed again
+	// when it changes
+	handlePolicyEvent := func(obj interface{}, eventType EventType) {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return
+		}
+
+		ings := store.policyIngressMap.Reference(key)
+		if len(ings) == 0 {
+			return
+		}
+
+		logging.Store.InfoS("GlobalRateLimitPolicy changed and it is used in ingress annotations. Parsing", "policy", key)
+		for _, ingKey := range ings {
+			ing, err := store.getIngress(ingKey)
+			if err != nil {
+				logging.Store.ErrorS(err, "could not find Ingress in local store", "ingress", ingKey)
+				continue
+			}
+			store.syncIngress(ing)
+		}
+
+		updateCh.In() <- Event{
+			Type: eventType,
+			Obj:  obj,
+		}
+	}
+
+	policyEventHandler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handlePolicyEvent(obj, CreateEvent)
+		},
+		UpdateFunc: func(old, cur interface{}) {
+			if reflect.DeepEqual(old, cur) {
+				return
+			}
+			handlePolicyEvent(cur, UpdateEvent)
+		},
+		DeleteFunc: func(obj interface{}) {
+			handlePolicyEvent(obj, DeleteEvent)
+		},
 	}
 
 	serviceHandler := cache.ResourceEventHandlerFuncs{
@@ -600,11 +863,30 @@ func New(
 				return
 			}
 
+			store.servicePorts.Delete(k8s.MetaNamespaceKey(curSvc))
+
 			updateCh.In() <- Event{
 				Type: UpdateEvent,
 				Obj:  cur,
 			}
 		},
+		DeleteFunc: func(obj interface{}) {
+			svc, ok := obj.(*corev1.Service)
+			if !ok {
+				// If we reached here it means the service was deleted but its final state is unrecorded.
+				tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+				if !ok {
+					return
+				}
+
+				svc, ok = tombstone.Obj.(*corev1.Service)
+				if !ok {
+					return
+				}
+			}
+
+			store.servicePorts.Delete(k8s.MetaNamespaceKey(svc))
+		},
 	}
 
 	store.informers.Ingress.AddEventHandler(ingEventHandler)
@@ -613,30 +895,57 @@ func New(
 	store.informers.ConfigMap.AddEventHandler(cmEventHandler)
 	store.informers.Service.AddEventHandler(serviceHandler)
 
+	// the changes of the configuration ConfigMaps outside of the watched
+	// namespace, like the one of the parameters of the IngressClass, are
+	// applied like the ones of the other configuration ConfigMaps
+	for _, key := range store.configMaps {
+		ns, name, err := k8s.ParseNameNS(key)
+		if err != nil || namespace == "" || ns == namespace {
+			continue
+		}
+
+		fieldSelector := fields.OneTermEqualSelector("metadata.name", name).String()
+		informer := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.FieldSelector = fieldSelector
+			}),
+		).Core().V1().ConfigMaps().Informer()
+		informer.AddEventHandler(cmEventHandler)
+
+		store.informers.ConfigurationConfigMaps = append(store.informers.ConfigurationConfigMaps, informer)
+	}
+	if store.informers.GlobalRateLimitPolicy != nil {
+		store.informers.GlobalRateLimitPolicy.AddEventHandler(policyEventHandler)
+	}
+
 	// do not wait for informers to read the configmap configuration
-	ns, name, _ := k8s.ParseNameNS(configmap)
-	cm, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), name, metav1.GetOptions{})
-	if err != nil {
-		klog.Warningf("Unexpected error reading configuration configmap: %v", err)
+	for _, key := range store.configMaps {
+		ns, name, _ := k8s.ParseNameNS(key)
+		cm, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			logging.Store.Warningf("Unexpected error reading configuration configmap: %v", err)
+		}
+
+		store.setConfig(cm)
 	}
 
-	store.setConfig(cm)
 	return store
 }
 
 // hasCatchAllIngressRule returns whether or not an ingress produces a
 // catch-all server, and so should be ignored when --disable-catch-all is set
-func hasCatchAllIngressRule(spec networkingv1beta1.IngressSpec) bool {
-	return spec.Backend != nil
+func hasCatchAllIngressRule(spec networking.IngressSpec) bool {
+	return spec.DefaultBackend != nil
 }
 
 // syncIngress parses ingress annotations converting the value of the
 // annotation to a go struct
-func (s *k8sStore) syncIngress(ing *networkingv1beta1.Ingress) {
+func (s *k8sStore) syncIngress(ing *networking.Ingress) {
 	key := k8s.MetaNamespaceKey(ing)
-	klog.V(3).Infof("updating annotations information for ingress %v", key)
+	logging.Store.V(3).Infof("updating annotations information for ingress %v", key)
 
-	copyIng := &networkingv1beta1.Ingress{}
+	copyIng := &networking.Ingress{}
 	ing.ObjectMeta.DeepCopyInto(&copyIng.ObjectMeta)
 	ing.Spec.DeepCopyInto(&copyIng.Spec)
 	ing.Status.DeepCopyInto(&copyIng.Status)
@@ -660,19 +969,53 @@ func (s *k8sStore) syncIngress(ing *networkingv1beta1.Ingress) {
 		ParsedAnnotations: s.annotations.Extract(ing),
 	})
 	if err != nil {
-		klog.Error(err)
+		logging.Store.ErrorS(err, "could not update the ingress in the local store", "ingress", key)
+	}
+}
+
+// onlyConfigurationStatusChanged returns true when the only change of the
+// Ingress is the annotation with the status of its configuration
+func onlyConfigurationStatusChanged(old, cur *networking.Ingress) bool {
+	key := parser.GetAnnotationWithPrefix(status.ConfigurationStatusAnnotation)
+	if old.Annotations[key] == cur.Annotations[key] {
+		return false
+	}
+
+	copies := []*networking.Ingress{old.DeepCopy(), cur.DeepCopy()}
+	for _, ing := range copies {
+		delete(ing.Annotations, key)
+		ing.ResourceVersion = ""
+		ing.ManagedFields = nil
+	}
+
+	return reflect.DeepEqual(copies[0], copies[1])
+}
+
+// recordDeprecatedAnnotations emits a Warning Event for each deprecated
+// annotation of the Ingress
+func recordDeprecatedAnnotations(recorder record.EventRecorder, ing *networking.Ingress) {
+	for _, d := range parser.DeprecatedAnnotationsInUse(ing) {
+		logging.Store.Warningf("Ingress %v uses the deprecated annotation %v, use %v instead", k8s.MetaNamespaceKey(ing), d.Name, d.ReplacedBy)
+		recorder.Eventf(ing, corev1.EventTypeWarning, "DeprecatedAnnotation",
+			"Annotation %v is deprecated, use %v instead", parser.GetAnnotationWithPrefix(d.Name), parser.GetAnnotationWithPrefix(d.ReplacedBy))
 	}
 }
 
 // updateSecretIngressMap takes an Ingress and updates all Secret objects it
 // references in secretIngressMap.
-func (s *k8sStore) updateSecretIngressMap(ing *networkingv1beta1.Ingress) {
+func (s *k8sStore) updateSecretIngressMap(ing *networking.Ingress) {
 	key := k8s.MetaNamespaceKey(ing)
-	klog.V(3).Infof("updating references to secrets for ingress %v", key)
+	logging.Store.V(3).Infof("updating references to secrets for ingress %v", key)
 
 	// delete all existing references first
 	s.secretIngressMap.Delete(key)
 
+	// the secrets can also be referenced by the entries of the config annotation
+	ing, err := parser.MergeConfigAnnotation(ing)
+	if err != nil {
+		logging.Store.Errorf("error reading the config annotation of ingress %v: %s", key, err)
+	}
+
 	var refSecrets []string
 
 	for _, tls := range ing.Spec.TLS {
@@ -696,7 +1039,7 @@ func (s *k8sStore) updateSecretIngressMap(ing *networkingv1beta1.Ingress) {
 	for _, ann := range secretAnnotations {
 		secrKey, err := objectRefAnnotationNsKey(ann, ing)
 		if err != nil && !errors.IsMissingAnnotations(err) {
-			klog.Errorf("error reading secret reference in annotation %q: %s", ann, err)
+			logging.Store.Errorf("error reading secret reference in annotation %q: %s", ann, err)
 			continue
 		}
 		if secrKey != "" {
@@ -704,13 +1047,73 @@ func (s *k8sStore) updateSecretIngressMap(ing *networkingv1beta1.Ingress) {
 		}
 	}
 
+	pathSecrets, err := proxyssl.ParsePathSecrets(ing)
+	if err != nil && !errors.IsMissingAnnotations(err) {
+		logging.Store.Errorf("error reading secret references of the paths of ingress %v: %s", key, err)
+	}
+	for _, secrKey := range pathSecrets {
+		refSecrets = append(refSecrets, secrKey)
+	}
+
 	// populate map with all secret references
 	s.secretIngressMap.Insert(key, refSecrets...)
 }
 
+// updatePolicyIngressMap takes an Ingress and updates the reference to the
+// GlobalRateLimitPolicy of its global-rate-limit-policy annotation
+func (s *k8sStore) updatePolicyIngressMap(ing *networking.Ingress) {
+	key := k8s.MetaNamespaceKey(ing)
+	s.policyIngressMap.Delete(key)
+
+	name, err := parser.GetStringAnnotation("global-rate-limit-policy", ing)
+	if err != nil || name == "" {
+		return
+	}
+
+	// the policies are namespaced, referenced from the Ingresses of their namespace
+	s.policyIngressMap.Insert(key, fmt.Sprintf("%v/%v", ing.Namespace, name))
+}
+
+// configMapAnnotations are the annotations referencing a ConfigMap, by name
+// in the namespace of the Ingress or by namespace/name
+var configMapAnnotations = []string{
+	"auth-proxy-set-headers",
+	"fastcgi-params-configmap",
+	"openapi-validation-configmap",
+	"server-alias-configmap",
+	"static-response-configmap",
+}
+
+// updateConfigMapIngressMap takes an Ingress and updates all ConfigMap
+// objects it references in configMapIngressMap.
+func (s *k8sStore) updateConfigMapIngressMap(ing *networking.Ingress) {
+	key := k8s.MetaNamespaceKey(ing)
+	s.configMapIngressMap.Delete(key)
+
+	// the ConfigMaps can also be referenced by the entries of the config annotation
+	ing, err := parser.MergeConfigAnnotation(ing)
+	if err != nil {
+		logging.Store.Errorf("error reading the config annotation of ingress %v: %s", key, err)
+	}
+
+	var refConfigMaps []string
+	for _, ann := range configMapAnnotations {
+		cmKey, err := objectRefAnnotationNsKey(ann, ing)
+		if err != nil && !errors.IsMissingAnnotations(err) {
+			logging.Store.Errorf("error reading configmap reference in annotation %q: %s", ann, err)
+			continue
+		}
+		if cmKey != "" {
+			refConfigMaps = append(refConfigMaps, cmKey)
+		}
+	}
+
+	s.configMapIngressMap.Insert(key, refConfigMaps...)
+}
+
 // objectRefAnnotationNsKey returns an object reference formatted as a
 // 'namespace/name' key from the given annotation name.
-func objectRefAnnotationNsKey(ann string, ing *networkingv1beta1.Ingress) (string, error) {
+func objectRefAnnotationNsKey(ann string, ing *networking.Ingress) (string, error) {
 	annValue, err := parser.GetStringAnnotation(ann, ing)
 	if err != nil {
 		return "", err
@@ -729,7 +1132,7 @@ func objectRefAnnotationNsKey(ann string, ing *networkingv1beta1.Ingress) (strin
 
 // syncSecrets synchronizes data from all Secrets referenced by the given
 // Ingress with the local store and file system.
-func (s *k8sStore) syncSecrets(ing *networkingv1beta1.Ingress) {
+func (s *k8sStore) syncSecrets(ing *networking.Ingress) {
 	key := k8s.MetaNamespaceKey(ing)
 	for _, secrKey := range s.secretIngressMap.ReferencedBy(key) {
 		s.syncSecret(secrKey)
@@ -758,8 +1161,26 @@ func (s *k8sStore) GetService(key string) (*corev1.Service, error) {
 	return s.listers.Service.ByKey(key)
 }
 
+// GetGlobalRateLimitPolicy returns the spec of the GlobalRateLimitPolicy matching key.
+func (s *k8sStore) GetGlobalRateLimitPolicy(key string) (*resolver.GlobalRateLimitPolicy, error) {
+	return s.listers.GlobalRateLimitPolicy.ByKey(key)
+}
+
+// GetServicePort returns the port of the Service with the given name. The
+// ports are cached until the Service is updated or removed.
+func (s *k8sStore) GetServicePort(svc *corev1.Service, name string) (*corev1.ServicePort, error) {
+	key := k8s.MetaNamespaceKey(svc)
+
+	port, ok := s.servicePorts.Lookup(key, svc, name)
+	if !ok {
+		return nil, fmt.Errorf("service %q does not have a port named %q", key, name)
+	}
+
+	return &port, nil
+}
+
 // getIngress returns the Ingress matching key.
-func (s *k8sStore) getIngress(key string) (*networkingv1beta1.Ingress, error) {
+func (s *k8sStore) getIngress(key string) (*networking.Ingress, error) {
 	ing, err := s.listers.IngressWithAnnotation.ByKey(key)
 	if err != nil {
 		return nil, err
@@ -776,7 +1197,7 @@ func sortIngressSlice(ingresses []*ingress.Ingress) {
 		if ir.Equal(&jr) {
 			in := fmt.Sprintf("%v/%v", ingresses[i].Namespace, ingresses[i].Name)
 			jn := fmt.Sprintf("%v/%v", ingresses[j].Namespace, ingresses[j].Name)
-			klog.V(3).Infof("Ingress %v and %v have identical CreationTimestamp", in, jn)
+			logging.Store.V(3).Infof("Ingress %v and %v have identical CreationTimestamp", in, jn)
 			return in > jn
 		}
 		return ir.Before(&jr)
@@ -802,6 +1223,52 @@ func (s *k8sStore) GetLocalSSLCert(key string) (*ingress.SSLCert, error) {
 	return s.sslStore.ByKey(key)
 }
 
+// GetTLSHostSecret returns the Secret, in namespace/name format, mapped to
+// the host in the ConfigMap of the tls-host-secrets-configmap setting
+func (s *k8sStore) GetTLSHostSecret(host string) string {
+	return s.tlsHostSecrets.Get(host)
+}
+
+// syncTLSHostSecrets reads the mapping of the hosts to the TLS Secrets from
+// the ConfigMap of the tls-host-secrets-configmap setting and syncs the
+// Secrets it references
+func (s *k8sStore) syncTLSHostSecrets() {
+	s.tlsHostSecrets.Replace(s.getTLSHostSecrets())
+
+	for _, secret := range s.tlsHostSecrets.Secrets() {
+		if _, err := s.GetLocalSSLCert(secret); err != nil {
+			s.syncSecret(secret)
+		}
+	}
+}
+
+func (s *k8sStore) getTLSHostSecrets() map[string]string {
+	key := s.GetBackendConfiguration().TLSHostSecretsConfigMap
+	if key == "" {
+		return map[string]string{}
+	}
+
+	cm, err := s.GetConfigMap(key)
+	if err != nil {
+		logging.Store.Warningf("Error getting TLS host Secrets ConfigMap %q: %v", key, err)
+		return map[string]string{}
+	}
+
+	data, ok := cm.Data[tlsHostSecretsKey]
+	if !ok {
+		logging.Store.Warningf("TLS host Secrets ConfigMap %q does not contain the key %q", key, tlsHostSecretsKey)
+		return map[string]string{}
+	}
+
+	mapping, err := parseTLSHostSecrets(data)
+	if err != nil {
+		logging.Store.Warningf("Error reading TLS host Secrets of ConfigMap %q: %v", key, err)
+		return map[string]string{}
+	}
+
+	return mapping
+}
+
 // GetConfigMap returns the ConfigMap matching key.
 func (s *k8sStore) GetConfigMap(key string) (*corev1.ConfigMap, error) {
 	return s.listers.ConfigMap.ByKey(key)
@@ -842,18 +1309,18 @@ func (s *k8sStore) writeSSLSessionTicketKey(cmap *corev1.ConfigMap, fileName str
 
 		// 81 used instead of 80 because of padding
 		if !(ticketBytes == 48 || ticketBytes == 81) {
-			klog.Warningf("ssl-session-ticket-key must contain either 48 or 80 bytes")
+			logging.Store.Warningf("ssl-session-ticket-key must contain either 48 or 80 bytes")
 		}
 
 		decodedTicket, err := base64.StdEncoding.DecodeString(ticketString)
 		if err != nil {
-			klog.Errorf("unexpected error decoding ssl-session-ticket-key: %v", err)
+			logging.Store.Errorf("unexpected error decoding ssl-session-ticket-key: %v", err)
 			return
 		}
 
 		err = ioutil.WriteFile(fileName, decodedTicket, file.ReadWriteByUser)
 		if err != nil {
-			klog.Errorf("unexpected error writing ssl-session-ticket-key to %s: %v", fileName, err)
+			logging.Store.Errorf("unexpected error writing ssl-session-ticket-key to %s: %v", fileName, err)
 			return
 		}
 
@@ -881,13 +1348,115 @@ func (s *k8sStore) setConfig(cmap *corev1.ConfigMap) {
 		return
 	}
 
+	s.configMapData[k8s.MetaNamespaceKey(cmap)] = resolveSecretReferences(cmap)
+	s.applyConfig()
+}
+
+// deleteConfig removes the data of a deleted configuration ConfigMap
+func (s *k8sStore) deleteConfig(key string) {
+	s.backendConfigMu.Lock()
+	defer s.backendConfigMu.Unlock()
+
+	delete(s.configMapData, key)
+	s.applyConfig()
+}
+
+// applyConfig reads the configuration from the data of the configuration
+// ConfigMaps returned by the gate. Must be called with backendConfigMu locked.
+func (s *k8sStore) applyConfig() {
+	data := mergeConfigMapData(s.configMaps, s.configMapData)
+	if s.configMapGate != nil {
+		data = s.configMapGate(data)
+	}
+
+	cmap := &corev1.ConfigMap{
+		Data: data,
+	}
+
 	s.backendConfig = ngx_template.ReadConfig(cmap.Data)
 	if s.backendConfig.UseGeoIP2 && !nginx.GeoLite2DBExists() {
-		klog.Warning("The GeoIP2 feature is enabled but the databases are missing. Disabling")
+		logging.Store.Warningf("The GeoIP2 feature is enabled but the databases are missing. Disabling")
 		s.backendConfig.UseGeoIP2 = false
 	}
 
 	s.writeSSLSessionTicketKey(cmap, "/etc/nginx/tickets.key")
+
+	logging.SetLevels(s.backendConfig.LogLevelOverrides)
+}
+
+// SetConfigMapGate sets the function returning the data of the configuration
+// ConfigMaps to apply and applies it
+func (s *k8sStore) SetConfigMapGate(gate func(data map[string]string) map[string]string) {
+	s.backendConfigMu.Lock()
+	defer s.backendConfigMu.Unlock()
+
+	s.configMapGate = gate
+	s.applyConfig()
+}
+
+// ApplyConfigMaps applies the data of the configuration ConfigMaps again and
+// triggers a synchronization
+func (s *k8sStore) ApplyConfigMaps() {
+	s.backendConfigMu.Lock()
+	s.applyConfig()
+	s.backendConfigMu.Unlock()
+
+	s.syncTLSHostSecrets()
+
+	s.updateCh.In() <- Event{
+		Type: ConfigurationEvent,
+	}
+}
+
+// isConfigMap returns true if the key is the configuration ConfigMap or one
+// of its overlays
+func (s *k8sStore) isConfigMap(key string) bool {
+	for _, cm := range s.configMaps {
+		if cm == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// configMapSecretSettings are the settings of the ConfigMaps referencing a
+// Secret, in the form "namespace/name"
+var configMapSecretSettings = []string{"ssl-dh-param"}
+
+// resolveSecretReferences returns the data of the ConfigMap with the Secrets
+// referenced without a namespace resolved to the namespace of the ConfigMap,
+// so each overlay, like the one of the IngressClass, can use its own Secrets
+func resolveSecretReferences(cmap *corev1.ConfigMap) map[string]string {
+	data := make(map[string]string, len(cmap.Data))
+	for k, v := range cmap.Data {
+		data[k] = v
+	}
+
+	if cmap.Namespace == "" {
+		return data
+	}
+
+	for _, name := range configMapSecretSettings {
+		if value, ok := data[name]; ok && value != "" && !strings.Contains(value, "/") {
+			data[name] = fmt.Sprintf("%v/%v", cmap.Namespace, value)
+		}
+	}
+
+	return data
+}
+
+// mergeConfigMapData merges the data of the ConfigMaps in order, the values
+// of a ConfigMap override the values of the ConfigMaps before it
+func mergeConfigMapData(keys []string, data map[string]map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, key := range keys {
+		for k, v := range data[key] {
+			merged[k] = v
+		}
+	}
+
+	return merged
 }
 
 // Run initiates the synchronization of the informers and the initial
@@ -900,13 +1469,21 @@ func (s *k8sStore) Run(stopCh chan struct{}) {
 var runtimeScheme = k8sruntime.NewScheme()
 
 func init() {
+	utilruntime.Must(networking.AddToScheme(runtimeScheme))
 	utilruntime.Must(networkingv1beta1.AddToScheme(runtimeScheme))
 }
 
-func toIngress(obj interface{}) (*networkingv1beta1.Ingress, bool) {
-	if ing, ok := obj.(*networkingv1beta1.Ingress); ok {
+// toIngress returns the networking.k8s.io/v1 Ingress of an object of the
+// informers, converting the ones of networking.k8s.io/v1beta1
+func toIngress(obj interface{}) (*networking.Ingress, bool) {
+	switch ing := obj.(type) {
+	case *networking.Ingress:
 		k8s.SetDefaultNGINXPathType(ing)
 		return ing, true
+	case *networkingv1beta1.Ingress:
+		v1Ing := k8s.FromIngressV1Beta1(ing)
+		k8s.SetDefaultNGINXPathType(v1Ing)
+		return v1Ing, true
 	}
 
 	return nil, false
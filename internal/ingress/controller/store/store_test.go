@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -29,17 +31,21 @@ import (
 
 	"github.com/eapache/channels"
 	v1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	certutil "k8s.io/client-go/util/cert"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 
 	"k8s.io/ingress-nginx/internal/ingress"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/class"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/k8s"
 	"k8s.io/ingress-nginx/test/e2e/framework"
 )
 
@@ -60,6 +66,8 @@ func TestStore(t *testing.T) {
 		t.Fatalf("error: %v", err)
 	}
 
+	k8s.IsIngressV1Ready = true
+
 	t.Run("should return an error searching for non existing objects", func(t *testing.T) {
 		ns := createNamespace(clientSet, t)
 		defer deleteNamespace(ns, clientSet, t)
@@ -77,11 +85,13 @@ func TestStore(t *testing.T) {
 		storer := New(
 			ns,
 			fmt.Sprintf("%v/config", ns),
+			nil,
 			fmt.Sprintf("%v/tcp", ns),
 			fmt.Sprintf("%v/udp", ns),
 			"",
 			10*time.Minute,
 			clientSet,
+			nil,
 			updateCh,
 			false)
 
@@ -154,11 +164,13 @@ func TestStore(t *testing.T) {
 		storer := New(
 			ns,
 			fmt.Sprintf("%v/config", ns),
+			nil,
 			fmt.Sprintf("%v/tcp", ns),
 			fmt.Sprintf("%v/udp", ns),
 			"",
 			10*time.Minute,
 			clientSet,
+			nil,
 			updateCh,
 			false)
 
@@ -179,8 +191,12 @@ func TestStore(t *testing.T) {
 									{
 										Path: "/",
 										Backend: networking.IngressBackend{
-											ServiceName: "http-svc",
-											ServicePort: intstr.FromInt(80),
+											Service: &networking.IngressServiceBackend{
+												Name: "http-svc",
+												Port: networking.ServiceBackendPort{
+													Number: 80,
+												},
+											},
 										},
 									},
 								},
@@ -216,8 +232,12 @@ func TestStore(t *testing.T) {
 									{
 										Path: "/",
 										Backend: networking.IngressBackend{
-											ServiceName: "http-svc",
-											ServicePort: intstr.FromInt(80),
+											Service: &networking.IngressServiceBackend{
+												Name: "http-svc",
+												Port: networking.ServiceBackendPort{
+													Number: 80,
+												},
+											},
 										},
 									},
 								},
@@ -238,7 +258,7 @@ func TestStore(t *testing.T) {
 		// Secret takes a bit to update
 		time.Sleep(3 * time.Second)
 
-		err = clientSet.NetworkingV1beta1().Ingresses(ni.Namespace).Delete(context.TODO(), ni.Name, metav1.DeleteOptions{})
+		err = clientSet.NetworkingV1().Ingresses(ni.Namespace).Delete(context.TODO(), ni.Name, metav1.DeleteOptions{})
 		if err != nil {
 			t.Errorf("error creating ingress: %v", err)
 		}
@@ -301,11 +321,13 @@ func TestStore(t *testing.T) {
 		storer := New(
 			ns,
 			fmt.Sprintf("%v/config", ns),
+			nil,
 			fmt.Sprintf("%v/tcp", ns),
 			fmt.Sprintf("%v/udp", ns),
 			"",
 			10*time.Minute,
 			clientSet,
+			nil,
 			updateCh,
 			false)
 
@@ -330,8 +352,12 @@ func TestStore(t *testing.T) {
 									{
 										Path: "/",
 										Backend: networking.IngressBackend{
-											ServiceName: "http-svc",
-											ServicePort: intstr.FromInt(80),
+											Service: &networking.IngressServiceBackend{
+												Name: "http-svc",
+												Port: networking.ServiceBackendPort{
+													Number: 80,
+												},
+											},
 										},
 									},
 								},
@@ -404,11 +430,13 @@ func TestStore(t *testing.T) {
 		storer := New(
 			ns,
 			fmt.Sprintf("%v/config", ns),
+			nil,
 			fmt.Sprintf("%v/tcp", ns),
 			fmt.Sprintf("%v/udp", ns),
 			"",
 			10*time.Minute,
 			clientSet,
+			nil,
 			updateCh,
 			false)
 
@@ -490,11 +518,13 @@ func TestStore(t *testing.T) {
 		storer := New(
 			ns,
 			fmt.Sprintf("%v/config", ns),
+			nil,
 			fmt.Sprintf("%v/tcp", ns),
 			fmt.Sprintf("%v/udp", ns),
 			"",
 			10*time.Minute,
 			clientSet,
+			nil,
 			updateCh,
 			false)
 
@@ -514,9 +544,13 @@ func TestStore(t *testing.T) {
 						SecretName: secretName,
 					},
 				},
-				Backend: &networking.IngressBackend{
-					ServiceName: "http-svc",
-					ServicePort: intstr.FromInt(80),
+				DefaultBackend: &networking.IngressBackend{
+					Service: &networking.IngressServiceBackend{
+						Name: "http-svc",
+						Port: networking.ServiceBackendPort{
+							Number: 80,
+						},
+					},
 				},
 			},
 		}, clientSet, t)
@@ -598,11 +632,13 @@ func TestStore(t *testing.T) {
 		storer := New(
 			ns,
 			fmt.Sprintf("%v/config", ns),
+			nil,
 			fmt.Sprintf("%v/tcp", ns),
 			fmt.Sprintf("%v/udp", ns),
 			"",
 			10*time.Minute,
 			clientSet,
+			nil,
 			updateCh,
 			false)
 
@@ -632,8 +668,12 @@ func TestStore(t *testing.T) {
 									{
 										Path: "/",
 										Backend: networking.IngressBackend{
-											ServiceName: "http-svc",
-											ServicePort: intstr.FromInt(80),
+											Service: &networking.IngressServiceBackend{
+												Name: "http-svc",
+												Port: networking.ServiceBackendPort{
+													Number: 80,
+												},
+											},
 										},
 									},
 								},
@@ -725,13 +765,13 @@ func createConfigMap(clientSet kubernetes.Interface, ns string, t *testing.T) st
 
 func ensureIngress(ingress *networking.Ingress, clientSet kubernetes.Interface, t *testing.T) *networking.Ingress {
 	t.Helper()
-	ing, err := clientSet.NetworkingV1beta1().Ingresses(ingress.Namespace).Update(context.TODO(), ingress, metav1.UpdateOptions{})
+	ing, err := clientSet.NetworkingV1().Ingresses(ingress.Namespace).Update(context.TODO(), ingress, metav1.UpdateOptions{})
 
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
 			t.Logf("Ingress %v not found, creating", ingress)
 
-			ing, err = clientSet.NetworkingV1beta1().Ingresses(ingress.Namespace).Create(context.TODO(), ingress, metav1.CreateOptions{})
+			ing, err = clientSet.NetworkingV1().Ingresses(ingress.Namespace).Create(context.TODO(), ingress, metav1.CreateOptions{})
 			if err != nil {
 				t.Fatalf("error creating ingress %+v: %v", ingress, err)
 			}
@@ -748,7 +788,7 @@ func ensureIngress(ingress *networking.Ingress, clientSet kubernetes.Interface,
 
 func deleteIngress(ingress *networking.Ingress, clientSet kubernetes.Interface, t *testing.T) {
 	t.Helper()
-	err := clientSet.NetworkingV1beta1().Ingresses(ingress.Namespace).Delete(context.TODO(), ingress.Name, metav1.DeleteOptions{})
+	err := clientSet.NetworkingV1().Ingresses(ingress.Namespace).Delete(context.TODO(), ingress.Name, metav1.DeleteOptions{})
 
 	if err != nil {
 		t.Errorf("failed to delete ingress %+v: %v", ingress, err)
@@ -766,11 +806,12 @@ func newStore(t *testing.T) *k8sStore {
 			Ingress:               IngressLister{cache.NewStore(cache.MetaNamespaceKeyFunc)},
 			IngressWithAnnotation: IngressWithAnnotationsLister{cache.NewStore(cache.DeletionHandlingMetaNamespaceKeyFunc)},
 		},
-		sslStore:         NewSSLCertTracker(),
-		updateCh:         channels.NewRingChannel(10),
-		syncSecretMu:     new(sync.Mutex),
-		backendConfigMu:  new(sync.RWMutex),
-		secretIngressMap: NewObjectRefMap(),
+		sslStore:            NewSSLCertTracker(),
+		updateCh:            channels.NewRingChannel(10),
+		syncSecretMu:        new(sync.Mutex),
+		backendConfigMu:     new(sync.RWMutex),
+		secretIngressMap:    NewObjectRefMap(),
+		configMapIngressMap: NewObjectRefMap(),
 	}
 }
 
@@ -824,6 +865,32 @@ func TestUpdateSecretIngressMap(t *testing.T) {
 		}
 	})
 
+	t.Run("with client certificates of paths", func(t *testing.T) {
+		ing := ingTpl.DeepCopy()
+		ing.ObjectMeta.SetAnnotations(map[string]string{
+			parser.GetAnnotationWithPrefix("proxy-ssl-path-secrets"): `{"/a": "otherns/mesh-a", "/b": "otherns/mesh-b"}`,
+		})
+		s.listers.Ingress.Update(ing)
+		s.updateSecretIngressMap(ing)
+
+		if l := s.secretIngressMap.Len(); !(l == 2 && s.secretIngressMap.Has("otherns/mesh-a") && s.secretIngressMap.Has("otherns/mesh-b")) {
+			t.Errorf("Expected \"otherns/mesh-a\" and \"otherns/mesh-b\" to be the only referenced Secrets (got %d)", l)
+		}
+	})
+
+	t.Run("with annotation in the config annotation", func(t *testing.T) {
+		ing := ingTpl.DeepCopy()
+		ing.ObjectMeta.SetAnnotations(map[string]string{
+			parser.GetAnnotationWithPrefix("config"): "auth-secret: otherns/auth\nauth-tls-secret: ca",
+		})
+		s.listers.Ingress.Update(ing)
+		s.updateSecretIngressMap(ing)
+
+		if l := s.secretIngressMap.Len(); !(l == 2 && s.secretIngressMap.Has("otherns/auth") && s.secretIngressMap.Has("testns/ca")) {
+			t.Errorf("Expected \"otherns/auth\" and \"testns/ca\" to be the only referenced Secrets (got %d)", l)
+		}
+	})
+
 	t.Run("with annotation in invalid format", func(t *testing.T) {
 		ing := ingTpl.DeepCopy()
 		ing.ObjectMeta.SetAnnotations(map[string]string{
@@ -838,6 +905,36 @@ func TestUpdateSecretIngressMap(t *testing.T) {
 	})
 }
 
+func TestUpdateConfigMapIngressMap(t *testing.T) {
+	s := newStore(t)
+
+	ing := &networking.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "testns",
+			Annotations: map[string]string{
+				parser.GetAnnotationWithPrefix("server-alias-configmap"): "aliases",
+				parser.GetAnnotationWithPrefix("config"):                 "fastcgi-params-configmap: otherns/params",
+			},
+		},
+	}
+	s.updateConfigMapIngressMap(ing)
+
+	if l := s.configMapIngressMap.Len(); !(l == 2 && s.configMapIngressMap.Has("testns/aliases") && s.configMapIngressMap.Has("otherns/params")) {
+		t.Errorf("Expected \"testns/aliases\" and \"otherns/params\" to be the only referenced ConfigMaps (got %d)", l)
+	}
+	if ings := s.configMapIngressMap.Reference("testns/aliases"); len(ings) != 1 || ings[0] != "testns/test" {
+		t.Errorf("Expected \"testns/aliases\" to be referenced by \"testns/test\" (got %v)", ings)
+	}
+
+	ing.SetAnnotations(map[string]string{})
+	s.updateConfigMapIngressMap(ing)
+
+	if l := s.configMapIngressMap.Len(); l != 0 {
+		t.Errorf("Expected 0 referenced ConfigMap (got %d)", l)
+	}
+}
+
 func TestListIngresses(t *testing.T) {
 	s := newStore(t)
 
@@ -852,9 +949,13 @@ func TestListIngresses(t *testing.T) {
 				CreationTimestamp: metav1.NewTime(time.Now()),
 			},
 			Spec: networking.IngressSpec{
-				Backend: &networking.IngressBackend{
-					ServiceName: "demo",
-					ServicePort: intstr.FromInt(80),
+				DefaultBackend: &networking.IngressBackend{
+					Service: &networking.IngressServiceBackend{
+						Name: "demo",
+						Port: networking.ServiceBackendPort{
+							Number: 80,
+						},
+					},
 				},
 			},
 		},
@@ -877,8 +978,12 @@ func TestListIngresses(t *testing.T) {
 								Paths: []networking.HTTPIngressPath{
 									{
 										Backend: networking.IngressBackend{
-											ServiceName: "demo",
-											ServicePort: intstr.FromInt(80),
+											Service: &networking.IngressServiceBackend{
+												Name: "demo",
+												Port: networking.ServiceBackendPort{
+													Number: 80,
+												},
+											},
 										},
 									},
 								},
@@ -911,8 +1016,12 @@ func TestListIngresses(t *testing.T) {
 									{
 										Path: "/demo",
 										Backend: networking.IngressBackend{
-											ServiceName: "demo",
-											ServicePort: intstr.FromInt(80),
+											Service: &networking.IngressServiceBackend{
+												Name: "demo",
+												Port: networking.ServiceBackendPort{
+													Number: 80,
+												},
+											},
 										},
 									},
 								},
@@ -979,3 +1088,296 @@ func TestWriteSSLSessionTicketKey(t *testing.T) {
 		}
 	}
 }
+
+func TestSyncSecretKeepsPreviousCertificate(t *testing.T) {
+	s := newStore(t)
+	s.listers.Secret = SecretLister{cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	recorder := record.NewFakeRecorder(10)
+	s.recorder = recorder
+
+	cert, key, err := certutil.GenerateSelfSignedCertKey("example.com", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error generating certificate: %v", err)
+	}
+
+	otherCert, otherKey, err := certutil.GenerateSelfSignedCertKey("example.org", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error generating certificate: %v", err)
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+		Data:       map[string][]byte{v1.TLSCertKey: cert, v1.TLSPrivateKeyKey: key},
+	}
+	s.listers.Secret.Add(secret)
+
+	s.syncSecret("default/tls")
+	previous, err := s.GetLocalSSLCert("default/tls")
+	if err != nil {
+		t.Fatalf("expected a certificate in the local store: %v", err)
+	}
+
+	invalid := []map[string][]byte{
+		// the key of another certificate
+		{v1.TLSCertKey: otherCert, v1.TLSPrivateKeyKey: key},
+		// an intermediate not signing the certificate
+		{v1.TLSCertKey: append(append([]byte{}, cert...), otherCert...), v1.TLSPrivateKeyKey: key},
+	}
+
+	for _, data := range invalid {
+		updated := secret.DeepCopy()
+		updated.Data = data
+		s.listers.Secret.Update(updated)
+
+		s.syncSecret("default/tls")
+
+		current, err := s.GetLocalSSLCert("default/tls")
+		if err != nil {
+			t.Fatalf("expected a certificate in the local store: %v", err)
+		}
+		if !current.Equal(previous) {
+			t.Errorf("expected the previous certificate to be kept")
+		}
+
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasPrefix(event, "Warning InvalidCertificate") {
+				t.Errorf("expected an InvalidCertificate event but got %v", event)
+			}
+		default:
+			t.Errorf("expected an event for the invalid certificate")
+		}
+	}
+
+	updated := secret.DeepCopy()
+	updated.Data = map[string][]byte{v1.TLSCertKey: otherCert, v1.TLSPrivateKeyKey: otherKey}
+	s.listers.Secret.Update(updated)
+
+	s.syncSecret("default/tls")
+
+	current, err := s.GetLocalSSLCert("default/tls")
+	if err != nil {
+		t.Fatalf("expected a certificate in the local store: %v", err)
+	}
+	if current.Equal(previous) {
+		t.Errorf("expected the valid certificate to replace the previous one")
+	}
+}
+
+func TestMergeConfigMapData(t *testing.T) {
+	data := map[string]map[string]string{
+		"ns/base": {
+			"proxy-body-size": "1m",
+			"use-gzip":        "true",
+		},
+		"ns/class": {
+			"proxy-body-size": "8m",
+		},
+		"ns/baseline": {
+			"ssl-protocols":   "TLSv1.3",
+			"proxy-body-size": "4m",
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		keys     []string
+		expected map[string]string
+	}{
+		{"without overlays", []string{"ns/base"}, map[string]string{
+			"proxy-body-size": "1m",
+			"use-gzip":        "true",
+		}},
+		{"with overlays", []string{"ns/base", "ns/class"}, map[string]string{
+			"proxy-body-size": "8m",
+			"use-gzip":        "true",
+		}},
+		{"the last overlay takes precedence", []string{"ns/base", "ns/class", "ns/baseline"}, map[string]string{
+			"proxy-body-size": "4m",
+			"use-gzip":        "true",
+			"ssl-protocols":   "TLSv1.3",
+		}},
+		{"with a missing overlay", []string{"ns/base", "ns/missing"}, map[string]string{
+			"proxy-body-size": "1m",
+			"use-gzip":        "true",
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			merged := mergeConfigMapData(tc.keys, data)
+			if !reflect.DeepEqual(merged, tc.expected) {
+				t.Errorf("expected %v but returned %v", tc.expected, merged)
+			}
+		})
+	}
+}
+
+func TestDeleteConfig(t *testing.T) {
+	s := &k8sStore{
+		backendConfigMu: &sync.RWMutex{},
+		configMaps:      []string{"ns/config", "ns/overlay"},
+		configMapData:   map[string]map[string]string{},
+		tlsHostSecrets:  NewTLSHostSecretMap(),
+	}
+
+	s.setConfig(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "config"},
+		Data:       map[string]string{"proxy-body-size": "8m"},
+	})
+	s.setConfig(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "overlay"},
+		Data:       map[string]string{"proxy-body-size": "1m"},
+	})
+	if bodySize := s.GetBackendConfiguration().ProxyBodySize; bodySize != "1m" {
+		t.Errorf("expected the body size of the overlay but got %v", bodySize)
+	}
+
+	s.deleteConfig("ns/overlay")
+	if bodySize := s.GetBackendConfiguration().ProxyBodySize; bodySize != "8m" {
+		t.Errorf("expected the body size of the ConfigMap after deleting the overlay but got %v", bodySize)
+	}
+}
+
+func TestSetConfigMapGate(t *testing.T) {
+	s := &k8sStore{
+		backendConfigMu: &sync.RWMutex{},
+		updateCh:        channels.NewRingChannel(10),
+		configMaps:      []string{"ns/config"},
+		configMapData:   map[string]map[string]string{},
+		tlsHostSecrets:  NewTLSHostSecretMap(),
+	}
+
+	s.setConfig(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "config"},
+		Data:       map[string]string{"proxy-body-size": "8m"},
+	})
+	if bodySize := s.GetBackendConfiguration().ProxyBodySize; bodySize != "8m" {
+		t.Errorf("expected the body size of the ConfigMap but got %v", bodySize)
+	}
+
+	promoted := map[string]string{"proxy-body-size": "1m"}
+	s.SetConfigMapGate(func(data map[string]string) map[string]string {
+		return promoted
+	})
+	if bodySize := s.GetBackendConfiguration().ProxyBodySize; bodySize != "1m" {
+		t.Errorf("expected the body size returned by the gate but got %v", bodySize)
+	}
+
+	promoted = map[string]string{"proxy-body-size": "8m"}
+	s.ApplyConfigMaps()
+	if bodySize := s.GetBackendConfiguration().ProxyBodySize; bodySize != "8m" {
+		t.Errorf("expected the body size promoted by the gate but got %v", bodySize)
+	}
+
+	// the ring channel moves the events to its output asynchronously
+	select {
+	case event := <-s.updateCh.Out():
+		if e := event.(Event); e.Type != ConfigurationEvent {
+			t.Errorf("expected a configuration event but got %v", e.Type)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected a configuration event")
+	}
+}
+
+func TestResolveSecretReferences(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cmap     *v1.ConfigMap
+		expected map[string]string
+	}{
+		{"without namespace", &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "class"},
+			Data:       map[string]string{"ssl-dh-param": "dhparam", "proxy-body-size": "8m"},
+		}, map[string]string{"ssl-dh-param": "team-a/dhparam", "proxy-body-size": "8m"}},
+		{"with namespace", &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "class"},
+			Data:       map[string]string{"ssl-dh-param": "ingress-nginx/dhparam"},
+		}, map[string]string{"ssl-dh-param": "ingress-nginx/dhparam"}},
+		{"empty value", &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "class"},
+			Data:       map[string]string{"ssl-dh-param": ""},
+		}, map[string]string{"ssl-dh-param": ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := resolveSecretReferences(tc.cmap)
+			if !reflect.DeepEqual(data, tc.expected) {
+				t.Errorf("expected %v but returned %v", tc.expected, data)
+			}
+		})
+	}
+}
+
+func TestOnlyConfigurationStatusChanged(t *testing.T) {
+	key := parser.GetAnnotationWithPrefix("configuration-status")
+
+	old := &networking.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo",
+			Namespace:       v1.NamespaceDefault,
+			ResourceVersion: "1",
+			Annotations:     map[string]string{"a": "b"},
+		},
+	}
+
+	cur := old.DeepCopy()
+	cur.ResourceVersion = "2"
+	cur.Annotations[key] = `{"state":"Applied"}`
+	if !onlyConfigurationStatusChanged(old, cur) {
+		t.Errorf("expected a change of the configuration status only")
+	}
+
+	cur.Annotations["a"] = "c"
+	if onlyConfigurationStatusChanged(old, cur) {
+		t.Errorf("expected changes of other annotations to be detected")
+	}
+
+	cur = old.DeepCopy()
+	cur.ResourceVersion = "2"
+	if onlyConfigurationStatusChanged(old, cur) {
+		t.Errorf("expected no change of the configuration status")
+	}
+}
+
+func TestConfigurationConfigMapOutsideWatchedNamespace(t *testing.T) {
+	clientSet := fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ingress-nginx", Name: "class-parameters"},
+		Data:       map[string]string{"proxy-body-size": "8m"},
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	updateCh := channels.NewRingChannel(1024)
+	go func() {
+		for range updateCh.Out() {
+		}
+	}()
+	defer updateCh.Close()
+
+	storer := New("watched", "watched/config", []string{"ingress-nginx/class-parameters"},
+		"", "", "", 10*time.Minute, clientSet, nil, updateCh, false)
+	if informers := storer.(*k8sStore).informers.ConfigurationConfigMaps; len(informers) != 1 {
+		t.Fatalf("expected an informer for the ConfigMap outside of the watched namespace but got %v", len(informers))
+	}
+
+	storer.Run(stopCh)
+
+	_, err := clientSet.CoreV1().ConfigMaps("ingress-nginx").Update(context.TODO(), &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ingress-nginx", Name: "class-parameters"},
+		Data:       map[string]string{"proxy-body-size": "1m"},
+	}, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error updating the ConfigMap: %v", err)
+	}
+
+	err = wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return storer.GetBackendConfiguration().ProxyBodySize == "1m", nil
+	})
+	if err != nil {
+		t.Errorf("expected the body size of the updated ConfigMap but got %v", storer.GetBackendConfiguration().ProxyBodySize)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/ingress-nginx/internal/logging"
+)
+
+// tlsHostSecretsKey is the key of the ConfigMap with the mapping of the hosts
+// to the TLS secrets
+const tlsHostSecretsKey = "hosts"
+
+// TLSHostSecretMap maps hostnames, including wildcards like *.example.com,
+// to the Secrets, in namespace/name format, with the certificate of the hosts
+// listed in the TLS section of an Ingress without a secretName.
+type TLSHostSecretMap interface {
+	Replace(v map[string]string)
+	Get(host string) string
+	References(key string) bool
+	Secrets() []string
+}
+
+type tlsHostSecretMap struct {
+	sync.RWMutex
+	v map[string]string
+}
+
+// NewTLSHostSecretMap returns a new TLSHostSecretMap.
+func NewTLSHostSecretMap() TLSHostSecretMap {
+	return &tlsHostSecretMap{
+		v: make(map[string]string),
+	}
+}
+
+// Replace replaces the whole mapping.
+func (t *tlsHostSecretMap) Replace(v map[string]string) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.v = v
+}
+
+// Get returns the Secret of a host, an exact match takes precedence over a
+// wildcard, which only matches a single label.
+func (t *tlsHostSecretMap) Get(host string) string {
+	t.RLock()
+	defer t.RUnlock()
+
+	host = strings.ToLower(host)
+	if secret, ok := t.v[host]; ok {
+		return secret
+	}
+
+	i := strings.Index(host, ".")
+	if i <= 0 {
+		return ""
+	}
+
+	return t.v["*"+host[i:]]
+}
+
+// References returns whether a Secret is used by any host.
+func (t *tlsHostSecretMap) References(key string) bool {
+	t.RLock()
+	defer t.RUnlock()
+
+	for _, secret := range t.v {
+		if secret == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Secrets returns the sorted list of the Secrets used by the hosts.
+func (t *tlsHostSecretMap) Secrets() []string {
+	t.RLock()
+	defer t.RUnlock()
+
+	set := make(map[string]struct{})
+	for _, secret := range t.v {
+		set[secret] = struct{}{}
+	}
+
+	secrets := make([]string, 0, len(set))
+	for secret := range set {
+		secrets = append(secrets, secret)
+	}
+	sort.Strings(secrets)
+
+	return secrets
+}
+
+// parseTLSHostSecrets parses the YAML or JSON mapping of the hosts to the
+// Secrets, invalid entries are ignored
+func parseTLSHostSecrets(data string) (map[string]string, error) {
+	hosts := map[string]string{}
+	if err := yaml.Unmarshal([]byte(data), &hosts); err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[string]string, len(hosts))
+	for host, secret := range hosts {
+		if err := validateTLSHostSecret(host, secret); err != nil {
+			logging.Store.Warningf("Ignoring TLS Secret of host %q: %v", host, err)
+			continue
+		}
+
+		mapping[strings.ToLower(host)] = secret
+	}
+
+	return mapping, nil
+}
+
+func validateTLSHostSecret(host, secret string) error {
+	var errs []string
+	if strings.HasPrefix(host, "*") {
+		errs = validation.IsWildcardDNS1123Subdomain(strings.ToLower(host))
+	} else {
+		errs = validation.IsDNS1123Subdomain(strings.ToLower(host))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid host: %v", strings.Join(errs, ", "))
+	}
+
+	ns, name, err := cache.SplitMetaNamespaceKey(secret)
+	if err != nil || ns == "" || name == "" {
+		return fmt.Errorf("invalid Secret %q, it must be in namespace/name format", secret)
+	}
+
+	return nil
+}
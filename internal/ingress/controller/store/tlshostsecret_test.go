@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTLSHostSecrets(t *testing.T) {
+	data := `
+"*.example.com": platform/wildcard-example-com
+Shop.Example.org: platform/shop-example-org
+invalid_host.example.org: platform/invalid
+no-namespace.example.org: no-namespace
+"*": platform/catch-all
+`
+
+	mapping, err := parseTLSHostSecrets(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"*.example.com":    "platform/wildcard-example-com",
+		"shop.example.org": "platform/shop-example-org",
+	}
+	if !reflect.DeepEqual(mapping, expected) {
+		t.Errorf("expected %v but returned %v", expected, mapping)
+	}
+
+	if _, err := parseTLSHostSecrets("- not a map"); err == nil {
+		t.Error("expected an error parsing a list")
+	}
+}
+
+func TestTLSHostSecretMapOperations(t *testing.T) {
+	thsm := NewTLSHostSecretMap()
+	thsm.Replace(map[string]string{
+		"*.example.com":   "platform/wildcard",
+		"www.example.com": "platform/www",
+		"example.org":     "platform/wildcard",
+	})
+
+	testCases := map[string]string{
+		"www.example.com":     "platform/www",
+		"WWW.Example.com":     "platform/www",
+		"api.example.com":     "platform/wildcard",
+		"a.api.example.com":   "",
+		"example.com":         "",
+		"example.org":         "platform/wildcard",
+		"unknown.example.net": "",
+		"localhost":           "",
+	}
+	for host, expected := range testCases {
+		if secret := thsm.Get(host); secret != expected {
+			t.Errorf("expected %q as the Secret of %v but returned %q", expected, host, secret)
+		}
+	}
+
+	if !thsm.References("platform/www") {
+		t.Error("expected the \"platform/www\" Secret to be referenced")
+	}
+	if thsm.References("default/www") {
+		t.Error("expected the \"default/www\" Secret not to be referenced")
+	}
+
+	expected := []string{"platform/wildcard", "platform/www"}
+	if secrets := thsm.Secrets(); !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("expected %v but returned %v", expected, secrets)
+	}
+
+	thsm.Replace(map[string]string{})
+	if secret := thsm.Get("www.example.com"); secret != "" {
+		t.Errorf("expected no Secret after the replacement but returned %q", secret)
+	}
+}
@@ -19,6 +19,8 @@ package template
 import (
 	"fmt"
 	"net"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -29,9 +31,15 @@ import (
 	"github.com/mitchellh/mapstructure"
 
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/accesslogfields"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/authreq"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/requestid"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/snippetfragments"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticfiles"
 	"k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/k8s"
 	ing_net "k8s.io/ingress-nginx/internal/net"
 	"k8s.io/ingress-nginx/internal/runtime"
 )
@@ -40,8 +48,11 @@ const (
 	customHTTPErrors              = "custom-http-errors"
 	skipAccessLogUrls             = "skip-access-log-urls"
 	whitelistSourceRange          = "whitelist-source-range"
+	customEndpointsAllowedCIDRs   = "custom-endpoints-allowed-cidrs"
 	proxyRealIPCIDR               = "proxy-real-ip-cidr"
 	bindAddress                   = "bind-address"
+	additionalHTTPPorts           = "additional-http-ports"
+	additionalHTTPSPorts          = "additional-https-ports"
 	httpRedirectCode              = "http-redirect-code"
 	blockCIDRs                    = "block-cidrs"
 	blockUserAgents               = "block-user-agents"
@@ -63,10 +74,40 @@ const (
 	globalAuthCacheDuration       = "global-auth-cache-duration"
 	luaSharedDictsKey             = "lua-shared-dicts"
 	plugins                       = "plugins"
+	telemetryIngressLabels        = "telemetry-ingress-labels"
+	defaultBackendTiers           = "default-backend-tiers"
+	logLevelOverrides             = "log-level-overrides"
+	tenantIDHeader                = "tenant-id-header"
+	tenantIDJWTClaim              = "tenant-id-jwt-claim"
+	tenantIDHostRegex             = "tenant-id-host-regex"
+	tenantIDMetricsAllowlist      = "tenant-id-metrics-allowlist"
+	errorResponseHTMLTemplate     = "error-response-html-template"
+	errorResponseJSONTemplate     = "error-response-json-template"
+	globalRateLimitStore          = "global-rate-limit-store"
+	globalRateLimitMode           = "global-rate-limit-mode"
+	globalRateLimitSyncStaleness  = "global-rate-limit-sync-max-staleness"
+	globalRateLimitFailPolicy     = "global-rate-limit-fail-policy"
+	requestIDPolicy               = "request-id-policy"
+	requestIDPrefix               = "request-id-prefix"
+	logFormatJSON                 = "log-format-json"
+	logFormatJSONEscape           = "log-format-json-escape"
+	staticFiles                   = "static-files"
+	snippetFragments              = "snippet-fragments"
+	otelSampler                   = "otel-sampler"
+	sslECDHCurve                  = "ssl-ecdh-curve"
+	bodyFilterSandboxAllowlist    = "body-filter-sandbox-allowlist"
+	unixSocketBackendDirs         = "unix-socket-backend-dirs"
+	noSNIAction                   = "no-sni-action"
+	noSNIServer                   = "no-sni-server"
+	edgeContextHeader             = "edge-context-header"
+	edgeContextFields             = "edge-context-fields"
+	edgeContextFormat             = "edge-context-format"
 )
 
 var (
 	validRedirectCodes    = sets.NewInt([]int{301, 302, 307, 308}...)
+	validOtelSamplers     = sets.NewString(config.OtelSamplerAlwaysOn, config.OtelSamplerAlwaysOff, config.OtelSamplerTraceIDRatioBased)
+	validNoSNIActions     = sets.NewString(config.NoSNIActionDefaultCertificate, config.NoSNIActionReject, config.NoSNIActionServer)
 	defaultLuaSharedDicts = map[string]int{
 		"configuration_data":            20,
 		"certificate_data":              20,
@@ -75,9 +116,59 @@ var (
 		"balancer_ewma_locks":           1,
 		"certificate_servers":           5,
 		"ocsp_response_cache":           5, // keep this same as certificate_servers
+		"ocsp_must_staple":              1,
 		"global_throttle_cache":         10,
+		"global_throttle_local":         10,
+		"global_throttle_deltas":        5,
+		"upstream_keepalive_stats":      1,
+		"bot_detection":                 1,
+		"inflight_requests":             1,
+		"connections_per_key":           1,
+		"websocket_connections":         1,
+		"backend_bandwidth":             1,
+		"idempotency_responses":         10,
+		"no_sni_handshakes":             1,
+		"warm_up":                       1,
+		"circuit_breaker":               1,
+		"health_check":                  1,
+		"auth_jwt_jwks":                 1,
+		"backend_health":                1,
+		"drain":                         1,
 	}
 	defaultGlobalAuthRedirectParam = "rd"
+
+	// the names of the telemetry labels must be valid prometheus label names
+	telemetryLabelRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	// labels of the ingress_labels metric that cannot be used by the telemetry labels
+	reservedTelemetryLabels = sets.NewString("namespace", "ingress", "controller_namespace", "controller_class", "controller_pod")
+
+	tenantIDHeaderRegex   = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	tenantIDJWTClaimRegex = regexp.MustCompile(`^[a-zA-Z0-9_:-]+(\.[a-zA-Z0-9_:-]+)*$`)
+	// tenantIDRegex matches the tenants accepted by Lua
+	tenantIDRegex = regexp.MustCompile(`^[a-zA-Z0-9._:@-]{1,128}$`)
+
+	// the names of the fields of the edge context must be valid keys of
+	// structured field dictionaries
+	edgeContextFieldRegex    = regexp.MustCompile(`^[a-z*][a-z0-9_.*-]*$`)
+	edgeContextVariableRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+	// a colon separated list of curve names, like X25519:prime256v1, the
+	// optional ones prefixed with a question mark
+	sslECDHCurveRegex = regexp.MustCompile(`^\??[a-zA-Z0-9_-]+(:\??[a-zA-Z0-9_-]+)*$`)
+
+	// a hostname without wildcard, like www.example.com
+	hostnameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+	// a global or a field of a global table, like string or string.format
+	bodyFilterGlobalRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+	// globals giving access to the ngx API, the files, the environment of
+	// the functions or able to escape the limits of the sandbox
+	unsafeBodyFilterGlobals = sets.NewString(
+		"_G", "collectgarbage", "coroutine", "debug", "dofile", "ffi", "getfenv",
+		"getmetatable", "io", "jit", "load", "loadfile", "loadstring", "module",
+		"ngx", "os", "package", "pcall", "rawget", "rawset", "require", "setfenv",
+		"setmetatable", "xpcall",
+	)
 )
 
 const (
@@ -97,6 +188,7 @@ func ReadConfig(src map[string]string) config.Configuration {
 	errors := make([]int, 0)
 	skipUrls := make([]string, 0)
 	whiteList := make([]string, 0)
+	customEndpointsCIDRList := make([]string, 0)
 	proxyList := make([]string, 0)
 	hideHeadersList := make([]string, 0)
 
@@ -154,6 +246,16 @@ func ReadConfig(src map[string]string) config.Configuration {
 		}
 	}
 
+	if val, ok := conf[additionalHTTPPorts]; ok {
+		delete(conf, additionalHTTPPorts)
+		to.AdditionalHTTPPorts = parseListenPorts(val)
+	}
+
+	if val, ok := conf[additionalHTTPSPorts]; ok {
+		delete(conf, additionalHTTPSPorts)
+		to.AdditionalHTTPSPorts = parseListenPorts(val)
+	}
+
 	if val, ok := conf[hideHeaders]; ok {
 		delete(conf, hideHeaders)
 		hideHeadersList = splitAndTrimSpace(val, ",")
@@ -169,6 +271,11 @@ func ReadConfig(src map[string]string) config.Configuration {
 		whiteList = append(whiteList, splitAndTrimSpace(val, ",")...)
 	}
 
+	if val, ok := conf[customEndpointsAllowedCIDRs]; ok {
+		delete(conf, customEndpointsAllowedCIDRs)
+		customEndpointsCIDRList = splitAndTrimSpace(val, ",")
+	}
+
 	if val, ok := conf[proxyRealIPCIDR]; ok {
 		delete(conf, proxyRealIPCIDR)
 		proxyList = append(proxyList, splitAndTrimSpace(val, ",")...)
@@ -360,9 +467,265 @@ func ReadConfig(src map[string]string) config.Configuration {
 		delete(conf, plugins)
 	}
 
+	if val, ok := conf[telemetryIngressLabels]; ok {
+		delete(conf, telemetryIngressLabels)
+		to.TelemetryIngressLabels = parseTelemetryIngressLabels(val)
+	}
+
+	if val, ok := conf[defaultBackendTiers]; ok {
+		delete(conf, defaultBackendTiers)
+		to.DefaultBackendTiers = parseDefaultBackendTiers(val)
+	}
+
+	if val, ok := conf[logLevelOverrides]; ok {
+		delete(conf, logLevelOverrides)
+		to.LogLevelOverrides = parseLogLevelOverrides(val)
+	}
+
+	if val, ok := conf[tenantIDHeader]; ok {
+		delete(conf, tenantIDHeader)
+		if tenantIDHeaderRegex.MatchString(val) {
+			to.TenantIDHeader = val
+		} else {
+			klog.Warningf("%v is not a valid header name for the tenant ID", val)
+		}
+	}
+
+	if val, ok := conf[tenantIDJWTClaim]; ok {
+		delete(conf, tenantIDJWTClaim)
+		if tenantIDJWTClaimRegex.MatchString(val) {
+			to.TenantIDJWTClaim = val
+		} else {
+			klog.Warningf("%v is not a valid JWT claim for the tenant ID", val)
+		}
+	}
+
+	if val, ok := conf[tenantIDHostRegex]; ok {
+		delete(conf, tenantIDHostRegex)
+		// the regular expression is passed to Lua as a long string and
+		// matched by PCRE against the host sent by the clients
+		if err := parser.CheckPortableRegex(val); err != nil {
+			klog.Warningf("%v is not a valid regular expression for the tenant ID: %v", val, err)
+		} else if strings.Contains(val, "]=]") {
+			klog.Warningf("%v is not a valid regular expression for the tenant ID: ]=] is not allowed", val)
+		} else {
+			to.TenantIDHostRegex = val
+		}
+	}
+
+	if val, ok := conf[tenantIDMetricsAllowlist]; ok {
+		delete(conf, tenantIDMetricsAllowlist)
+		tenants := splitAndTrimSpace(val, ",")
+		for _, tenant := range tenants {
+			if tenantIDRegex.MatchString(tenant) {
+				to.TenantIDMetricsAllowlist = append(to.TenantIDMetricsAllowlist, tenant)
+			} else {
+				klog.Warningf("%v is not a valid tenant ID", tenant)
+			}
+		}
+	}
+
+	if val, ok := conf[edgeContextHeader]; ok {
+		delete(conf, edgeContextHeader)
+		if val == "" || tenantIDHeaderRegex.MatchString(val) {
+			to.EdgeContextHeader = val
+		} else {
+			klog.Warningf("%v is not a valid header name for the edge context", val)
+		}
+	}
+
+	if val, ok := conf[edgeContextFields]; ok {
+		delete(conf, edgeContextFields)
+		to.EdgeContextFields = parseEdgeContextFields(val)
+	}
+
+	if val, ok := conf[edgeContextFormat]; ok {
+		delete(conf, edgeContextFormat)
+		if val == config.EdgeContextFormatJSON || val == config.EdgeContextFormatStructuredField {
+			to.EdgeContextFormat = val
+		} else {
+			klog.Warningf("%v is not a valid format for the edge context, using %v", val, to.EdgeContextFormat)
+		}
+	}
+
+	if val, ok := conf[globalRateLimitStore]; ok {
+		delete(conf, globalRateLimitStore)
+		if val == config.GlobalRateLimitStoreMemcached || val == config.GlobalRateLimitStoreRedis {
+			to.GlobalRateLimitStore = val
+		} else {
+			klog.Warningf("%v is not a valid store for the global rate limits, using %v", val, to.GlobalRateLimitStore)
+		}
+	}
+
+	if val, ok := conf[globalRateLimitMode]; ok {
+		delete(conf, globalRateLimitMode)
+		if val == config.GlobalRateLimitModeStore || val == config.GlobalRateLimitModeLocalSync {
+			to.GlobalRateLimitMode = val
+		} else {
+			klog.Warningf("%v is not a valid mode for the global rate limits, using %v", val, to.GlobalRateLimitMode)
+		}
+	}
+
+	if val, ok := conf[globalRateLimitFailPolicy]; ok {
+		delete(conf, globalRateLimitFailPolicy)
+		if val == config.GlobalRateLimitFailPolicyAllow || val == config.GlobalRateLimitFailPolicyDeny {
+			to.GlobalRateLimitFailPolicy = val
+		} else {
+			klog.Warningf("%v is not a valid fail policy for the global rate limits, using %v", val, to.GlobalRateLimitFailPolicy)
+		}
+	}
+
+	if val, ok := conf[globalRateLimitSyncStaleness]; ok {
+		delete(conf, globalRateLimitSyncStaleness)
+		if staleness, err := strconv.Atoi(val); err == nil && staleness > 0 {
+			to.GlobalRateLimitSyncMaxStaleness = staleness
+		} else {
+			klog.Warningf("%v is not a valid staleness for the global rate limits, using %v", val, to.GlobalRateLimitSyncMaxStaleness)
+		}
+	}
+
+	// the curves are rendered in the NGINX configuration
+	if val, ok := conf[sslECDHCurve]; ok {
+		delete(conf, sslECDHCurve)
+		if sslECDHCurveRegex.MatchString(val) {
+			to.SSLECDHCurve = val
+		} else {
+			klog.Warningf("%v is not a valid list of curves for ECDHE ciphers, using %v", val, to.SSLECDHCurve)
+		}
+	}
+
+	if val, ok := conf[bodyFilterSandboxAllowlist]; ok {
+		delete(conf, bodyFilterSandboxAllowlist)
+		allowlist, err := parseBodyFilterSandboxAllowlist(val)
+		if err != nil {
+			klog.Warningf("%v is not a valid allowlist for the body filter snippets: %v", val, err)
+		} else {
+			to.BodyFilterSandboxAllowlist = allowlist
+		}
+	}
+
+	if val, ok := conf[unixSocketBackendDirs]; ok {
+		delete(conf, unixSocketBackendDirs)
+		dirs, err := parseUnixSocketBackendDirs(val)
+		if err != nil {
+			klog.Warningf("%v is not a valid list of Unix socket directories: %v", val, err)
+		} else {
+			to.UnixSocketBackendDirs = dirs
+		}
+	}
+
+	if val, ok := conf[otelSampler]; ok {
+		delete(conf, otelSampler)
+		if validOtelSamplers.Has(val) {
+			to.OtelSampler = val
+		} else {
+			klog.Warningf("%v is not a valid sampler for the OpenTelemetry traces, using %v", val, to.OtelSampler)
+		}
+	}
+
+	// the hostname is passed to Lua as a string
+	if val, ok := conf[noSNIServer]; ok {
+		delete(conf, noSNIServer)
+		if hostnameRegex.MatchString(val) {
+			to.NoSNIServer = val
+		} else {
+			klog.Warningf("%v is not a valid hostname for the clients without SNI", val)
+		}
+	}
+
+	if val, ok := conf[noSNIAction]; ok {
+		delete(conf, noSNIAction)
+		switch {
+		case !validNoSNIActions.Has(val):
+			klog.Warningf("%v is not a valid action for the clients without SNI, using %v", val, to.NoSNIAction)
+		case val == config.NoSNIActionServer && to.NoSNIServer == "":
+			klog.Warningf("%v requires %v, using %v", val, noSNIServer, to.NoSNIAction)
+		default:
+			to.NoSNIAction = val
+		}
+	}
+
+	if val, ok := conf[requestIDPolicy]; ok {
+		delete(conf, requestIDPolicy)
+		if requestid.IsValid(val) {
+			to.RequestIDPolicy = val
+		} else {
+			klog.Warningf("%v is not a valid policy for the X-Request-ID header, using %v", val, to.RequestIDPolicy)
+		}
+	}
+
+	// the prefix is rendered in the NGINX configuration
+	if val, ok := conf[requestIDPrefix]; ok {
+		delete(conf, requestIDPrefix)
+		if requestid.IsValidPrefix(val) {
+			to.RequestIDPrefix = val
+		} else {
+			klog.Warningf("%v is not a valid prefix for the X-Request-ID header, using %v", val, to.RequestIDPrefix)
+		}
+	}
+
+	// the templates of the errors are passed to Lua as long strings
+	if val, ok := conf[errorResponseHTMLTemplate]; ok {
+		delete(conf, errorResponseHTMLTemplate)
+		if strings.Contains(val, "]=]") {
+			klog.Warningf("%v is not a valid template for the HTML errors: ]=] is not allowed", val)
+		} else {
+			to.ErrorResponseHTMLTemplate = val
+		}
+	}
+
+	if val, ok := conf[errorResponseJSONTemplate]; ok {
+		delete(conf, errorResponseJSONTemplate)
+		if strings.Contains(val, "]=]") {
+			klog.Warningf("%v is not a valid template for the JSON errors: ]=] is not allowed", val)
+		} else {
+			to.ErrorResponseJSONTemplate = val
+		}
+	}
+
+	if val, ok := conf[logFormatJSON]; ok {
+		delete(conf, logFormatJSON)
+		fields, err := accesslogfields.ParseFields(val)
+		if err != nil {
+			klog.Warningf("%v is not a valid JSON log format: %v", val, err)
+		} else {
+			to.LogFormatJSON = fields
+		}
+	}
+
+	if val, ok := conf[logFormatJSONEscape]; ok {
+		delete(conf, logFormatJSONEscape)
+		if accesslogfields.IsValidEscape(val) {
+			to.LogFormatJSONEscape = val
+		} else {
+			klog.Warningf("%v is not a valid escaping of the JSON logs, using %v", val, to.LogFormatJSONEscape)
+		}
+	}
+
+	if val, ok := conf[staticFiles]; ok {
+		delete(conf, staticFiles)
+		files, err := staticfiles.ParseFiles(val)
+		if err != nil {
+			klog.Warningf("%v is not a valid list of static files: %v", val, err)
+		} else {
+			to.StaticFiles = files
+		}
+	}
+
+	if val, ok := conf[snippetFragments]; ok {
+		delete(conf, snippetFragments)
+		fragments, err := snippetfragments.ParseFragments(val)
+		if err != nil {
+			klog.Warningf("%v is not a valid list of snippet fragments: %v", val, err)
+		} else {
+			to.SnippetFragments = fragments
+		}
+	}
+
 	to.CustomHTTPErrors = filterErrors(errors)
 	to.SkipAccessLogURLs = skipUrls
 	to.WhitelistSourceRange = whiteList
+	to.CustomEndpointsAllowedCIDRs = customEndpointsCIDRList
 	to.ProxyRealIPCIDR = proxyList
 	to.BindAddressIpv4 = bindAddressIpv4List
 	to.BindAddressIpv6 = bindAddressIpv6List
@@ -415,6 +778,186 @@ func filterErrors(codes []int) []int {
 	return fa
 }
 
+// parseTelemetryIngressLabels parses a comma separated list of <label key>=<name>.
+// The name is the label key with the characters not allowed replaced by _ when omitted
+func parseTelemetryIngressLabels(s string) map[string]string {
+	labels := map[string]string{}
+	names := sets.NewString()
+
+	for _, item := range splitAndTrimSpace(s, ",") {
+		key, name := item, ""
+		if i := strings.Index(item, "="); i != -1 {
+			key, name = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		} else {
+			name = strings.Map(func(r rune) rune {
+				if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+					return r
+				}
+				return '_'
+			}, key[strings.LastIndex(key, "/")+1:])
+		}
+
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			klog.Warningf("%v is not a valid label key: %v", key, strings.Join(errs, ", "))
+			continue
+		}
+
+		if !telemetryLabelRegex.MatchString(name) || reservedTelemetryLabels.Has(name) || names.Has(name) {
+			klog.Warningf("%v is not a valid name for the telemetry label %v", name, key)
+			continue
+		}
+
+		labels[key] = name
+		names.Insert(name)
+	}
+
+	return labels
+}
+
+// parseDefaultBackendTiers parses a comma separated list of <wildcard host>=<namespace>/<service>
+func parseDefaultBackendTiers(s string) map[string]string {
+	tiers := map[string]string{}
+
+	for _, item := range splitAndTrimSpace(s, ",") {
+		i := strings.Index(item, "=")
+		if i == -1 {
+			klog.Warningf("%v is not a valid default backend tier, expected <wildcard host>=<namespace>/<service>", item)
+			continue
+		}
+
+		host, service := strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+
+		if !strings.HasPrefix(host, "*.") || len(validation.IsWildcardDNS1123Subdomain(host)) != 0 {
+			klog.Warningf("%v is not a valid wildcard host for a default backend tier", host)
+			continue
+		}
+
+		ns, name, err := k8s.ParseNameNS(service)
+		if err != nil || ns == "" || name == "" {
+			klog.Warningf("%v is not a valid service for the default backend tier %v, expected <namespace>/<service>", service, host)
+			continue
+		}
+
+		tiers[host] = service
+	}
+
+	return tiers
+}
+
+// parseListenPorts parses a comma separated list of ports, ignoring the
+// invalid and repeated ones
+func parseListenPorts(s string) []int {
+	ports := []int{}
+	seen := sets.NewInt()
+
+	for _, item := range splitAndTrimSpace(s, ",") {
+		port, err := strconv.Atoi(item)
+		if err != nil || port < 1 || port > 65535 {
+			klog.Warningf("%v is not a valid listen port", item)
+			continue
+		}
+
+		if seen.Has(port) {
+			continue
+		}
+
+		seen.Insert(port)
+		ports = append(ports, port)
+	}
+
+	return ports
+}
+
+// parseEdgeContextFields parses a comma separated list of <field>=<variable>,
+// the variables optionally prefixed with $
+func parseEdgeContextFields(s string) map[string]string {
+	fields := map[string]string{}
+
+	for _, item := range splitAndTrimSpace(s, ",") {
+		i := strings.Index(item, "=")
+		if i == -1 {
+			klog.Warningf("%v is not a valid edge context field, expected <field>=<variable>", item)
+			continue
+		}
+
+		field := strings.TrimSpace(item[:i])
+		variable := strings.TrimPrefix(strings.TrimSpace(item[i+1:]), "$")
+
+		if !edgeContextFieldRegex.MatchString(field) {
+			klog.Warningf("%v is not a valid name for an edge context field", field)
+			continue
+		}
+
+		if !edgeContextVariableRegex.MatchString(variable) {
+			klog.Warningf("%v is not a valid variable for the edge context field %v", variable, field)
+			continue
+		}
+
+		fields[field] = variable
+	}
+
+	return fields
+}
+
+// parseLogLevelOverrides parses a comma separated list of <subsystem>=<level>
+func parseLogLevelOverrides(s string) map[string]int {
+	levels := map[string]int{}
+
+	for _, item := range splitAndTrimSpace(s, ",") {
+		i := strings.Index(item, "=")
+		if i == -1 {
+			klog.Warningf("%v is not a valid log level override, expected <subsystem>=<level>", item)
+			continue
+		}
+
+		subsystem := strings.TrimSpace(item[:i])
+		level, err := strconv.Atoi(strings.TrimSpace(item[i+1:]))
+		if err != nil || level < 0 {
+			klog.Warningf("%v is not a valid log level for the subsystem %v", item[i+1:], subsystem)
+			continue
+		}
+
+		levels[subsystem] = level
+	}
+
+	return levels
+}
+
+// parseBodyFilterSandboxAllowlist returns the globals of a comma separated
+// list, rejecting the ones unsafe to expose to the snippets
+func parseBodyFilterSandboxAllowlist(val string) ([]string, error) {
+	allowlist := splitAndTrimSpace(val, ",")
+	for _, name := range allowlist {
+		if !bodyFilterGlobalRegex.MatchString(name) {
+			return nil, fmt.Errorf("%v is not a valid global name", name)
+		}
+
+		if unsafeBodyFilterGlobals.Has(strings.Split(name, ".")[0]) {
+			return nil, fmt.Errorf("%v cannot be used in the sandbox", name)
+		}
+	}
+
+	return allowlist, nil
+}
+
+// parseUnixSocketBackendDirs returns the directories of a comma separated
+// list, which must be absolute paths other than the root directory
+func parseUnixSocketBackendDirs(val string) ([]string, error) {
+	dirs := splitAndTrimSpace(val, ",")
+	for i, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			return nil, fmt.Errorf("%v is not an absolute path", dir)
+		}
+
+		dirs[i] = filepath.Clean(dir)
+		if dirs[i] == "/" {
+			return nil, fmt.Errorf("the root directory cannot be used")
+		}
+	}
+
+	return dirs, nil
+}
+
 func splitAndTrimSpace(s, sep string) []string {
 	f := func(c rune) bool {
 		return strings.EqualFold(string(c), sep)
@@ -25,7 +25,9 @@ import (
 	"github.com/kylelemons/godebug/pretty"
 	"github.com/mitchellh/hashstructure"
 
+	"k8s.io/ingress-nginx/internal/ingress/annotations/accesslogfields"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/authreq"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticfiles"
 	"k8s.io/ingress-nginx/internal/ingress/controller/config"
 )
 
@@ -383,6 +385,169 @@ func TestLuaSharedDictsParsing(t *testing.T) {
 	}
 }
 
+func TestTelemetryIngressLabelsParsing(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect map[string]string
+	}{
+		{
+			name:   "not set",
+			entry:  map[string]string{},
+			expect: nil,
+		},
+		{
+			name:   "with and without names",
+			entry:  map[string]string{"telemetry-ingress-labels": "team, app.kubernetes.io/name=service, tier-level"},
+			expect: map[string]string{"team": "team", "app.kubernetes.io/name": "service", "tier-level": "tier_level"},
+		},
+		{
+			name:   "invalid and reserved names are ignored",
+			entry:  map[string]string{"telemetry-ingress-labels": "team=namespace, owner=team.name, cost-center=team, app/=app"},
+			expect: map[string]string{"cost-center": "team"},
+		},
+		{
+			name:   "duplicated names are ignored",
+			entry:  map[string]string{"telemetry-ingress-labels": "example.com/team, team"},
+			expect: map[string]string{"example.com/team": "team"},
+		},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if !reflect.DeepEqual(cfg.TelemetryIngressLabels, tc.expect) {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.TelemetryIngressLabels)
+		}
+	}
+}
+
+func TestDefaultBackendTiers(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect map[string]string
+	}{
+		{
+			name:   "no tiers",
+			entry:  map[string]string{},
+			expect: nil,
+		},
+		{
+			name:   "tiers",
+			entry:  map[string]string{"default-backend-tiers": "*.staging.example.com=staging/default-backend, *.dev.example.com = dev/default-backend"},
+			expect: map[string]string{"*.staging.example.com": "staging/default-backend", "*.dev.example.com": "dev/default-backend"},
+		},
+		{
+			name:   "invalid hosts and services are ignored",
+			entry:  map[string]string{"default-backend-tiers": "staging.example.com=staging/backend, *.dev.example.com=backend, *.qa.example.com, *.test.example.com=test/backend"},
+			expect: map[string]string{"*.test.example.com": "test/backend"},
+		},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if !reflect.DeepEqual(cfg.DefaultBackendTiers, tc.expect) {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.DefaultBackendTiers)
+		}
+	}
+}
+
+func TestLogLevelOverrides(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect map[string]int
+	}{
+		{
+			name:   "no overrides",
+			entry:  map[string]string{},
+			expect: nil,
+		},
+		{
+			name:   "overrides",
+			entry:  map[string]string{"log-level-overrides": "store=5, ssl = 2"},
+			expect: map[string]int{"store": 5, "ssl": 2},
+		},
+		{
+			name:   "invalid levels are ignored",
+			entry:  map[string]string{"log-level-overrides": "store=high, ssl=-1, sync, webhook=3"},
+			expect: map[string]int{"webhook": 3},
+		},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if !reflect.DeepEqual(cfg.LogLevelOverrides, tc.expect) {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.LogLevelOverrides)
+		}
+	}
+}
+
+func TestAdditionalListenPorts(t *testing.T) {
+	cfg := ReadConfig(map[string]string{
+		"additional-http-ports":  "8080, 8081, 8080, http, 0",
+		"additional-https-ports": "8443,65536",
+	})
+
+	if !reflect.DeepEqual(cfg.AdditionalHTTPPorts, []int{8080, 8081}) {
+		t.Errorf("expected the HTTP ports [8080 8081] but %v was returned", cfg.AdditionalHTTPPorts)
+	}
+
+	if !reflect.DeepEqual(cfg.AdditionalHTTPSPorts, []int{8443}) {
+		t.Errorf("expected the HTTPS ports [8443] but %v was returned", cfg.AdditionalHTTPSPorts)
+	}
+}
+
+func TestEdgeContext(t *testing.T) {
+	testsCases := []struct {
+		name         string
+		entry        map[string]string
+		expectHeader string
+		expectFields map[string]string
+		expectFormat string
+	}{
+		{
+			name:         "disabled",
+			entry:        map[string]string{},
+			expectFormat: "json",
+		},
+		{
+			name: "fields",
+			entry: map[string]string{
+				"edge-context-header": "X-Edge-Context",
+				"edge-context-fields": "country=geoip2_city_country_code, tls = $ssl_protocol",
+				"edge-context-format": "structured-field",
+			},
+			expectHeader: "X-Edge-Context",
+			expectFields: map[string]string{"country": "geoip2_city_country_code", "tls": "ssl_protocol"},
+			expectFormat: "structured-field",
+		},
+		{
+			name: "invalid values are ignored",
+			entry: map[string]string{
+				"edge-context-header": "X Edge Context",
+				"edge-context-fields": "Country=geoip2_city_country_code, tls, canary=$proxy-alternative, variant=proxy_alternative_upstream_name",
+				"edge-context-format": "xml",
+			},
+			expectFields: map[string]string{"variant": "proxy_alternative_upstream_name"},
+			expectFormat: "json",
+		},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if cfg.EdgeContextHeader != tc.expectHeader {
+			t.Errorf("Testing %v. Expected header \"%v\" but \"%v\" was returned", tc.name, tc.expectHeader, cfg.EdgeContextHeader)
+		}
+		if !reflect.DeepEqual(cfg.EdgeContextFields, tc.expectFields) {
+			t.Errorf("Testing %v. Expected fields \"%v\" but \"%v\" was returned", tc.name, tc.expectFields, cfg.EdgeContextFields)
+		}
+		if cfg.EdgeContextFormat != tc.expectFormat {
+			t.Errorf("Testing %v. Expected format \"%v\" but \"%v\" was returned", tc.name, tc.expectFormat, cfg.EdgeContextFormat)
+		}
+	}
+}
+
 func TestSplitAndTrimSpace(t *testing.T) {
 	testsCases := []struct {
 		name   string
@@ -418,3 +583,370 @@ func TestSplitAndTrimSpace(t *testing.T) {
 		}
 	}
 }
+
+func TestTenantIDSources(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect [3]string
+	}{
+		{
+			name:   "not set",
+			entry:  map[string]string{},
+			expect: [3]string{"", "", ""},
+		},
+		{
+			name: "sources",
+			entry: map[string]string{
+				"tenant-id-header":     "X-Tenant-ID",
+				"tenant-id-jwt-claim":  "org.id",
+				"tenant-id-host-regex": `^([a-z0-9-]+)\.example\.com$`,
+			},
+			expect: [3]string{"X-Tenant-ID", "org.id", `^([a-z0-9-]+)\.example\.com$`},
+		},
+		{
+			name: "invalid sources are ignored",
+			entry: map[string]string{
+				"tenant-id-header":     "X-Tenant ID",
+				"tenant-id-jwt-claim":  "org..id",
+				"tenant-id-host-regex": `^([a-z0-9-]+\.example\.com$`,
+			},
+			expect: [3]string{"", "", ""},
+		},
+		{
+			name: "regular expressions backtracking in PCRE are ignored",
+			entry: map[string]string{
+				"tenant-id-host-regex": `^([a-z0-9-]+)+\.example\.com$`,
+			},
+			expect: [3]string{"", "", ""},
+		},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		actual := [3]string{cfg.TenantIDHeader, cfg.TenantIDJWTClaim, cfg.TenantIDHostRegex}
+		if actual != tc.expect {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, actual)
+		}
+	}
+}
+
+func TestTenantIDMetricsAllowlist(t *testing.T) {
+	cfg := ReadConfig(map[string]string{
+		"tenant-id-metrics-allowlist": "acme, globex,bad tenant,",
+	})
+
+	expected := []string{"acme", "globex"}
+	if !reflect.DeepEqual(cfg.TenantIDMetricsAllowlist, expected) {
+		t.Errorf("Expected %v but %v was returned", expected, cfg.TenantIDMetricsAllowlist)
+	}
+}
+
+func TestErrorResponseTemplates(t *testing.T) {
+	def := config.NewDefault()
+
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect [2]string
+	}{
+		{
+			name:   "defaults",
+			entry:  map[string]string{},
+			expect: [2]string{def.ErrorResponseHTMLTemplate, def.ErrorResponseJSONTemplate},
+		},
+		{
+			name: "templates",
+			entry: map[string]string{
+				"error-response-html-template": "<p>{status}</p>",
+				"error-response-json-template": `{"code":{status}}`,
+			},
+			expect: [2]string{"<p>{status}</p>", `{"code":{status}}`},
+		},
+		{
+			name: "templates closing the long strings are ignored",
+			entry: map[string]string{
+				"error-response-html-template": "<p>]=]</p>",
+				"error-response-json-template": `{"code":"]=]"}`,
+			},
+			expect: [2]string{def.ErrorResponseHTMLTemplate, def.ErrorResponseJSONTemplate},
+		},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		actual := [2]string{cfg.ErrorResponseHTMLTemplate, cfg.ErrorResponseJSONTemplate}
+		if actual != tc.expect {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, actual)
+		}
+	}
+}
+
+func TestGlobalRateLimitStore(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect string
+	}{
+		{"default", map[string]string{}, config.GlobalRateLimitStoreMemcached},
+		{"redis", map[string]string{"global-rate-limit-store": "redis"}, config.GlobalRateLimitStoreRedis},
+		{"invalid store", map[string]string{"global-rate-limit-store": "etcd"}, config.GlobalRateLimitStoreMemcached},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if cfg.GlobalRateLimitStore != tc.expect {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.GlobalRateLimitStore)
+		}
+	}
+}
+
+func TestGlobalRateLimitFailPolicy(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect string
+	}{
+		{"default", map[string]string{}, config.GlobalRateLimitFailPolicyAllow},
+		{"deny", map[string]string{"global-rate-limit-fail-policy": "deny"}, config.GlobalRateLimitFailPolicyDeny},
+		{"invalid policy", map[string]string{"global-rate-limit-fail-policy": `deny", status_code = 200, x = "`}, config.GlobalRateLimitFailPolicyAllow},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if cfg.GlobalRateLimitFailPolicy != tc.expect {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.GlobalRateLimitFailPolicy)
+		}
+	}
+}
+
+func TestGlobalRateLimitMode(t *testing.T) {
+	testsCases := []struct {
+		name      string
+		entry     map[string]string
+		expect    string
+		staleness int
+	}{
+		{"default", map[string]string{}, config.GlobalRateLimitModeStore, 2000},
+		{"local sync", map[string]string{"global-rate-limit-mode": "local-sync", "global-rate-limit-sync-max-staleness": "500"}, config.GlobalRateLimitModeLocalSync, 500},
+		{"invalid mode", map[string]string{"global-rate-limit-mode": "gossip"}, config.GlobalRateLimitModeStore, 2000},
+		{"invalid staleness", map[string]string{"global-rate-limit-sync-max-staleness": "0"}, config.GlobalRateLimitModeStore, 2000},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if cfg.GlobalRateLimitMode != tc.expect {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.GlobalRateLimitMode)
+		}
+		if cfg.GlobalRateLimitSyncMaxStaleness != tc.staleness {
+			t.Errorf("Testing %v. Expected %v but %v was returned", tc.name, tc.staleness, cfg.GlobalRateLimitSyncMaxStaleness)
+		}
+	}
+}
+
+func TestSSLECDHCurve(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect string
+	}{
+		{"default", map[string]string{}, "auto"},
+		{"one curve", map[string]string{"ssl-ecdh-curve": "secp384r1"}, "secp384r1"},
+		{"list of curves", map[string]string{"ssl-ecdh-curve": "X25519:prime256v1:secp384r1"}, "X25519:prime256v1:secp384r1"},
+		{"invalid list", map[string]string{"ssl-ecdh-curve": "X25519;\nssl_dhparam /etc/passwd"}, "auto"},
+		{"empty curve", map[string]string{"ssl-ecdh-curve": "X25519::secp384r1"}, "auto"},
+		{"optional curve", map[string]string{"ssl-ecdh-curve": "?X25519MLKEM768:X25519"}, "?X25519MLKEM768:X25519"},
+		{"misplaced question mark", map[string]string{"ssl-ecdh-curve": "X25519?:prime256v1"}, "auto"},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if cfg.SSLECDHCurve != tc.expect {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.SSLECDHCurve)
+		}
+	}
+}
+
+func TestBodyFilterSandboxAllowlist(t *testing.T) {
+	def := config.NewDefault().BodyFilterSandboxAllowlist
+
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect []string
+	}{
+		{"default", map[string]string{}, def},
+		{"globals", map[string]string{"body-filter-sandbox-allowlist": "pairs, string.gsub, cjson"}, []string{"pairs", "string.gsub", "cjson"}},
+		{"empty", map[string]string{"body-filter-sandbox-allowlist": ""}, []string{}},
+		{"invalid name", map[string]string{"body-filter-sandbox-allowlist": "pairs, string[1]"}, def},
+		{"unsafe global", map[string]string{"body-filter-sandbox-allowlist": "pairs, setfenv"}, def},
+		{"field of unsafe global", map[string]string{"body-filter-sandbox-allowlist": "ngx.say"}, def},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if !reflect.DeepEqual(cfg.BodyFilterSandboxAllowlist, tc.expect) {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.BodyFilterSandboxAllowlist)
+		}
+	}
+}
+
+func TestUnixSocketBackendDirs(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect []string
+	}{
+		{"default", map[string]string{}, []string{}},
+		{"directories", map[string]string{"unix-socket-backend-dirs": "/var/run/php/, /run/agent"}, []string{"/var/run/php", "/run/agent"}},
+		{"relative path", map[string]string{"unix-socket-backend-dirs": "/var/run/php, run/agent"}, []string{}},
+		{"root directory", map[string]string{"unix-socket-backend-dirs": "/var/../"}, []string{}},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if !reflect.DeepEqual(cfg.UnixSocketBackendDirs, tc.expect) {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.UnixSocketBackendDirs)
+		}
+	}
+}
+
+func TestOtelSampler(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect string
+	}{
+		{"default", map[string]string{}, config.OtelSamplerAlwaysOn},
+		{"ratio", map[string]string{"otel-sampler": "TraceIdRatioBased"}, config.OtelSamplerTraceIDRatioBased},
+		{"invalid sampler", map[string]string{"otel-sampler": "Probabilistic"}, config.OtelSamplerAlwaysOn},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if cfg.OtelSampler != tc.expect {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.OtelSampler)
+		}
+	}
+}
+
+func TestNoSNIAction(t *testing.T) {
+	testsCases := []struct {
+		name         string
+		entry        map[string]string
+		expectAction string
+		expectServer string
+	}{
+		{"default", map[string]string{}, config.NoSNIActionDefaultCertificate, ""},
+		{"reject", map[string]string{"no-sni-action": "reject"}, config.NoSNIActionReject, ""},
+		{"server", map[string]string{"no-sni-action": "server", "no-sni-server": "legacy.example.com"}, config.NoSNIActionServer, "legacy.example.com"},
+		{"server without hostname", map[string]string{"no-sni-action": "server"}, config.NoSNIActionDefaultCertificate, ""},
+		{"invalid hostname", map[string]string{"no-sni-action": "server", "no-sni-server": "legacy\"example"}, config.NoSNIActionDefaultCertificate, ""},
+		{"invalid action", map[string]string{"no-sni-action": "close"}, config.NoSNIActionDefaultCertificate, ""},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if cfg.NoSNIAction != tc.expectAction {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expectAction, cfg.NoSNIAction)
+		}
+		if cfg.NoSNIServer != tc.expectServer {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expectServer, cfg.NoSNIServer)
+		}
+	}
+}
+
+func TestRequestIDPolicy(t *testing.T) {
+	testsCases := []struct {
+		name         string
+		entry        map[string]string
+		expectPolicy string
+		expectPrefix string
+	}{
+		{"default", map[string]string{}, "trust", "client-"},
+		{"regenerate", map[string]string{"request-id-policy": "regenerate"}, "regenerate", "client-"},
+		{"prefix", map[string]string{"request-id-policy": "prefix", "request-id-prefix": "edge."}, "prefix", "edge."},
+		{"invalid policy", map[string]string{"request-id-policy": "spoof"}, "trust", "client-"},
+		{"invalid prefix", map[string]string{"request-id-policy": "prefix", "request-id-prefix": "edge $host"}, "prefix", "client-"},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if cfg.RequestIDPolicy != tc.expectPolicy {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expectPolicy, cfg.RequestIDPolicy)
+		}
+		if cfg.RequestIDPrefix != tc.expectPrefix {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expectPrefix, cfg.RequestIDPrefix)
+		}
+	}
+}
+
+func TestLogFormatJSON(t *testing.T) {
+	testsCases := []struct {
+		name         string
+		entry        map[string]string
+		expectFields []accesslogfields.Field
+		expectEscape string
+	}{
+		{"default", map[string]string{}, nil, "json"},
+		{"fields", map[string]string{
+			"log-format-json":        `{"status": {"value": "$status", "type": "number"}, "uri": "$request_uri"}`,
+			"log-format-json-escape": "default",
+		}, []accesslogfields.Field{
+			{Name: "status", Value: "$status", Type: accesslogfields.TypeNumber},
+			{Name: "uri", Value: "$request_uri", Type: accesslogfields.TypeString},
+		}, "default"},
+		{"invalid fields", map[string]string{"log-format-json": `{"uri": "$request_uri'"}`}, nil, "json"},
+		{"invalid escape", map[string]string{"log-format-json-escape": "html"}, nil, "json"},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if !reflect.DeepEqual(cfg.LogFormatJSON, tc.expectFields) {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expectFields, cfg.LogFormatJSON)
+		}
+		if cfg.LogFormatJSONEscape != tc.expectEscape {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expectEscape, cfg.LogFormatJSONEscape)
+		}
+	}
+}
+
+func TestStaticFiles(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect []staticfiles.File
+	}{
+		{"default", map[string]string{}, nil},
+		{"files", map[string]string{"static-files": `{"/robots.txt": "User-agent: *\nDisallow: /"}`}, []staticfiles.File{
+			{Path: "/robots.txt", Content: "User-agent: *\nDisallow: /", ContentType: staticfiles.DefaultContentType},
+		}},
+		{"invalid files", map[string]string{"static-files": `{"robots.txt": ""}`}, nil},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if !reflect.DeepEqual(cfg.StaticFiles, tc.expect) {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.StaticFiles)
+		}
+	}
+}
+
+func TestSnippetFragments(t *testing.T) {
+	testsCases := []struct {
+		name   string
+		entry  map[string]string
+		expect map[string]string
+	}{
+		{"default", map[string]string{}, nil},
+		{"fragments", map[string]string{"snippet-fragments": `{"no-cache": "expires -1;"}`}, map[string]string{"no-cache": "expires -1;"}},
+		{"invalid name", map[string]string{"snippet-fragments": `{"../no-cache": "expires -1;"}`}, nil},
+	}
+
+	for _, tc := range testsCases {
+		cfg := ReadConfig(tc.entry)
+		if !reflect.DeepEqual(cfg.SnippetFragments, tc.expect) {
+			t.Errorf("Testing %v. Expected \"%v\" but \"%v\" was returned", tc.name, tc.expect, cfg.SnippetFragments)
+		}
+	}
+}
@@ -29,35 +29,59 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	text_template "text/template"
 	"time"
 
 	"github.com/pkg/errors"
 
-	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/accesslogfields"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/authjwt"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/bodyfiltersnippet"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/georouting"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/globalratelimit"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/influxdb"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/proxycache"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/ratelimit"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/ratelimitexemption"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/requestid"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/routeif"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticfiles"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/trailingslash"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamkeepalive"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/urinormalization"
 	"k8s.io/ingress-nginx/internal/ingress/controller/config"
 	ing_net "k8s.io/ingress-nginx/internal/net"
+	"k8s.io/ingress-nginx/internal/nginx"
 )
 
 const (
 	slash         = "/"
 	nonIdempotent = "non_idempotent"
 	defBufferSize = 65535
+
+	// bodyFilterPlugin is the plugin running the body-filter-snippet annotation
+	bodyFilterPlugin = "body_filter"
+	// idempotencyPlugin is the plugin deduplicating the requests of the
+	// idempotency annotation
+	idempotencyPlugin = "idempotency"
 )
 
 // TemplateWriter is the interface to render a template
 type TemplateWriter interface {
 	Write(conf config.TemplateConfig) ([]byte, error)
+	WriteTenant(conf config.TemplateConfig, tenant config.Tenant) ([]byte, error)
 }
 
 // Template ...
@@ -108,6 +132,28 @@ func (t *Template) Write(conf config.TemplateConfig) ([]byte, error) {
 		return nil, err
 	}
 
+	return t.clean(tmplBuf, outCmdBuf), nil
+}
+
+// WriteTenant populates a buffer with the servers of a tenant, the content
+// of the file included in the NGINX configuration created by Write
+func (t *Template) WriteTenant(conf config.TemplateConfig, tenant config.Tenant) ([]byte, error) {
+	tmplBuf := t.bp.Get()
+	defer t.bp.Put(tmplBuf)
+
+	outCmdBuf := t.bp.Get()
+	defer t.bp.Put(outCmdBuf)
+
+	err := t.tmpl.ExecuteTemplate(tmplBuf, "TENANT", struct{ First, Second interface{} }{conf, tenant})
+	if err != nil {
+		return nil, err
+	}
+
+	return t.clean(tmplBuf, outCmdBuf), nil
+}
+
+// clean returns a copy of the rendered template without redundant empty lines
+func (t *Template) clean(tmplBuf, outCmdBuf *bytes.Buffer) []byte {
 	// squeezes multiple adjacent empty lines to be single
 	// spaced this is to avoid the use of regular expressions
 	cmd := exec.Command("/ingress-controller/clean-nginx-conf.sh")
@@ -115,10 +161,11 @@ func (t *Template) Write(conf config.TemplateConfig) ([]byte, error) {
 	cmd.Stdout = outCmdBuf
 	if err := cmd.Run(); err != nil {
 		klog.Warningf("unexpected error cleaning template: %v", err)
-		return tmplBuf.Bytes(), nil
+		return append([]byte{}, tmplBuf.Bytes()...)
 	}
 
-	return outCmdBuf.Bytes(), nil
+	// the buffers are returned to the pool once rendered
+	return append([]byte{}, outCmdBuf.Bytes()...)
 }
 
 var (
@@ -135,15 +182,24 @@ var (
 		"luaConfigurationRequestBodySize": luaConfigurationRequestBodySize,
 		"buildLocation":                   buildLocation,
 		"buildAuthLocation":               buildAuthLocation,
+		"buildAuthExcludePathsRegex":      buildAuthExcludePathsRegex,
 		"shouldApplyGlobalAuth":           shouldApplyGlobalAuth,
 		"buildAuthResponseHeaders":        buildAuthResponseHeaders,
 		"buildAuthProxySetHeaders":        buildAuthProxySetHeaders,
 		"buildProxyPass":                  buildProxyPass,
 		"filterRateLimits":                filterRateLimits,
+		"filterUpstreamKeepalives":        filterUpstreamKeepalives,
+		"buildConnectionUpgrade":          buildConnectionUpgrade,
 		"buildRateLimitZones":             buildRateLimitZones,
 		"buildRateLimit":                  buildRateLimit,
 		"configForLua":                    configForLua,
 		"locationConfigForLua":            locationConfigForLua,
+		"quoteLuaString":                  quoteLuaString,
+		"buildLuaPlugins":                 buildLuaPlugins,
+		"buildIdempotency":                buildIdempotency,
+		"buildTrailingSlashRedirect":      buildTrailingSlashRedirect,
+		"buildSSLECDHCurve":               buildSSLECDHCurve,
+		"buildBodyFilterSnippet":          buildBodyFilterSnippet,
 		"buildResolvers":                  buildResolvers,
 		"buildUpstreamName":               buildUpstreamName,
 		"isLocationInLocationList":        isLocationInLocationList,
@@ -152,6 +208,7 @@ var (
 		"getenv":                          os.Getenv,
 		"contains":                        strings.Contains,
 		"split":                           strings.Split,
+		"join":                            strings.Join,
 		"hasPrefix":                       strings.HasPrefix,
 		"hasSuffix":                       strings.HasSuffix,
 		"trimSpace":                       strings.TrimSpace,
@@ -160,11 +217,13 @@ var (
 		"formatIP":                        formatIP,
 		"quote":                           quote,
 		"buildNextUpstream":               buildNextUpstream,
+		"buildFallbackNextUpstream":       buildFallbackNextUpstream,
 		"getIngressInformation":           getIngressInformation,
 		"serverConfig": func(all config.TemplateConfig, server *ingress.Server) interface{} {
 			return struct{ First, Second interface{} }{all, server}
 		},
 		"isValidByteSize":                    isValidByteSize,
+		"proxyCookieRewrites":                proxyCookieRewrites,
 		"buildForwardedFor":                  buildForwardedFor,
 		"buildAuthSignURL":                   buildAuthSignURL,
 		"buildAuthSignURLLocation":           buildAuthSignURLLocation,
@@ -173,17 +232,38 @@ var (
 		"buildInfluxDB":                      buildInfluxDB,
 		"enforceRegexModifier":               enforceRegexModifier,
 		"buildCustomErrorDeps":               buildCustomErrorDeps,
+		"buildErrorResponseCodes":            buildErrorResponseCodes,
 		"buildCustomErrorLocationsPerServer": buildCustomErrorLocationsPerServer,
 		"shouldLoadModSecurityModule":        shouldLoadModSecurityModule,
 		"buildHTTPListener":                  buildHTTPListener,
 		"buildHTTPSListener":                 buildHTTPSListener,
+		"sslPrereadPorts":                    sslPrereadPorts,
 		"buildOpentracingForLocation":        buildOpentracingForLocation,
 		"shouldLoadOpentracingModule":        shouldLoadOpentracingModule,
+		"buildOpentelemetry":                 buildOpentelemetry,
+		"buildOpentelemetryForLocation":      buildOpentelemetryForLocation,
+		"shouldLoadOpentelemetryModule":      shouldLoadOpentelemetryModule,
 		"buildModSecurityForLocation":        buildModSecurityForLocation,
+		"buildRequestIDForLocation":          buildRequestIDForLocation,
 		"buildMirrorLocations":               buildMirrorLocations,
 		"shouldLoadAuthDigestModule":         shouldLoadAuthDigestModule,
+		"shouldLoadBrotliModule":             shouldLoadBrotliModule,
 		"shouldLoadInfluxDBModule":           shouldLoadInfluxDBModule,
 		"buildServerName":                    buildServerName,
+		"shouldConfigureProxyCache":          shouldConfigureProxyCache,
+		"buildStaleCacheControl":             buildStaleCacheControl,
+		"buildUpstreamAlias":                 buildUpstreamAlias,
+		"buildGRPCHTTP1Fallback":             buildGRPCHTTP1Fallback,
+		"filterTenantServers":                filterTenantServers,
+		"buildLogFormatJSON":                 buildLogFormatJSON,
+		"anonymizeLogFormat":                 anonymizeLogFormat,
+		"buildAccessLogFormats":              buildAccessLogFormats,
+		"buildLocationAccessLog":             buildLocationAccessLog,
+		"buildStaticFiles":                   buildStaticFiles,
+		"buildStaticFileContent":             buildStaticFileContent,
+		"buildSnippetFragments":              buildSnippetFragments,
+		"buildGeoRoutingMaps":                buildGeoRoutingMaps,
+		"geoRoutingVariable":                 geoRoutingVariable,
 	}
 )
 
@@ -283,7 +363,11 @@ func configForLua(input interface{}) string {
 		use_proxy_protocol = %t,
 		is_ssl_passthrough_enabled = %t,
 		http_redirect_code = %v,
-		listen_ports = { ssl_proxy = "%v", https = "%v" },
+		listen_ports = { ssl_proxy = "%v", http1_ssl_proxy = "%v", https = "%v" },
+
+		strict_request_parsing = %t,
+		enable_metrics = %t,
+		upstream_keepalive_connections = %d,
 
 		hsts = %t,
 		hsts_max_age = %v,
@@ -294,16 +378,54 @@ func configForLua(input interface{}) string {
 			memcached = {
 				host = "%v", port = %d, connect_timeout = %d, max_idle_timeout = %d, pool_size = %d,
 			},
+			store = "%v",
+			mode = "%v",
+			redis = {
+				host = "%v", port = %d, connect_timeout = %d, max_idle_timeout = %d, pool_size = %d,
+			},
 			status_code = %d,
-		}
+			fail_policy = "%v",
+			enable_metrics = %t,
+		},
+
+		shared_state = {
+			enabled = %t,
+			memcached = {
+				host = "%v", port = %d, connect_timeout = %d, max_idle_timeout = %d, pool_size = %d,
+			},
+			failure_timeout = %d,
+			session_timeout = %d,
+		},
+
+		tenant = { header = "%v", jwt_claim = "%v", host_regex = [=[%v]=], metrics_allowlist = { %v } },
+
+		error_response = { html = [=[%v]=], json = [=[%v]=] },
+
+		edge_function = { max_instructions = %d, max_memory = %d },
+
+		edge_context = { format = "%v", fields = { %v } },
+
+		plugins = {
+			body_filter = {
+				allowlist = { %v },
+				max_instructions = %d,
+				max_memory = %d,
+				max_body_size = %d,
+			},
+		},
 	}`,
 		all.Cfg.UseForwardedHeaders,
 		all.Cfg.UseProxyProtocol,
-		all.IsSSLPassthroughEnabled,
+		all.IsSSLPassthroughEnabled || all.IsSSLPrereadEnabled,
 		all.Cfg.HTTPRedirectCode,
 		all.ListenPorts.SSLProxy,
+		all.ListenPorts.HTTP1SSLProxy,
 		all.ListenPorts.HTTPS,
 
+		all.Cfg.StrictRequestParsing,
+		all.EnableMetrics,
+		all.Cfg.UpstreamKeepaliveConnections,
+
 		all.Cfg.HSTS,
 		all.Cfg.HSTSMaxAge,
 		all.Cfg.HSTSIncludeSubdomains,
@@ -314,10 +436,294 @@ func configForLua(input interface{}) string {
 		all.Cfg.GlobalRateLimitMemcachedConnectTimeout,
 		all.Cfg.GlobalRateLimitMemcachedMaxIdleTimeout,
 		all.Cfg.GlobalRateLimitMemcachedPoolSize,
+		all.Cfg.GlobalRateLimitStore,
+		all.Cfg.GlobalRateLimitMode,
+		all.Cfg.GlobalRateLimitRedisHost,
+		all.Cfg.GlobalRateLimitRedisPort,
+		all.Cfg.GlobalRateLimitRedisConnectTimeout,
+		all.Cfg.GlobalRateLimitRedisMaxIdleTimeout,
+		all.Cfg.GlobalRateLimitRedisPoolSize,
 		all.Cfg.GlobalRateLimitStatucCode,
+		all.Cfg.GlobalRateLimitFailPolicy,
+		all.EnableMetrics,
+
+		all.Cfg.EnableSharedState,
+		all.Cfg.GlobalRateLimitMemcachedHost,
+		all.Cfg.GlobalRateLimitMemcachedPort,
+		all.Cfg.GlobalRateLimitMemcachedConnectTimeout,
+		all.Cfg.GlobalRateLimitMemcachedMaxIdleTimeout,
+		all.Cfg.GlobalRateLimitMemcachedPoolSize,
+		all.Cfg.SharedStateFailureTimeout,
+		all.Cfg.SharedStateSessionTimeout,
+
+		all.Cfg.TenantIDHeader,
+		all.Cfg.TenantIDJWTClaim,
+		all.Cfg.TenantIDHostRegex,
+		luaStringList(all.Cfg.TenantIDMetricsAllowlist),
+
+		all.Cfg.ErrorResponseHTMLTemplate,
+		all.Cfg.ErrorResponseJSONTemplate,
+
+		all.Cfg.EdgeFunctionMaxInstructions,
+		all.Cfg.EdgeFunctionMaxMemory,
+
+		all.Cfg.EdgeContextFormat,
+		luaEdgeContextFields(all.Cfg.EdgeContextFields),
+
+		luaStringList(all.Cfg.BodyFilterSandboxAllowlist),
+		all.Cfg.BodyFilterMaxInstructions,
+		all.Cfg.BodyFilterMaxMemory,
+		all.Cfg.BodyFilterMaxBodySize,
 	)
 }
 
+// luaStringList returns the items of a Lua table with the strings
+func luaStringList(values []string) string {
+	items := make([]string, 0, len(values))
+	for _, value := range values {
+		items = append(items, quoteLuaString(value))
+	}
+
+	return strings.Join(items, ", ")
+}
+
+// luaEdgeContextFields returns the items of a Lua table with the pairs of
+// field and variable of the edge context, sorted by field
+func luaEdgeContextFields(fields map[string]string) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		items = append(items, fmt.Sprintf("{ %v, %v }", quoteLuaString(name), quoteLuaString(fields[name])))
+	}
+
+	return strings.Join(items, ", ")
+}
+
+// tlsGroups are the minimum versions of OpenSSL supporting the key exchange
+// groups, by lowercase name
+var tlsGroups = map[string][3]int{
+	"prime256v1":         {1, 1, 1},
+	"secp256r1":          {1, 1, 1},
+	"p-256":              {1, 1, 1},
+	"secp384r1":          {1, 1, 1},
+	"p-384":              {1, 1, 1},
+	"secp521r1":          {1, 1, 1},
+	"p-521":              {1, 1, 1},
+	"x25519":             {1, 1, 1},
+	"x448":               {1, 1, 1},
+	"ffdhe2048":          {3, 0, 0},
+	"ffdhe3072":          {3, 0, 0},
+	"ffdhe4096":          {3, 0, 0},
+	"ffdhe6144":          {3, 0, 0},
+	"ffdhe8192":          {3, 0, 0},
+	"mlkem512":           {3, 5, 0},
+	"mlkem768":           {3, 5, 0},
+	"mlkem1024":          {3, 5, 0},
+	"x25519mlkem768":     {3, 5, 0},
+	"secp256r1mlkem768":  {3, 5, 0},
+	"secp384r1mlkem1024": {3, 5, 0},
+}
+
+// optionalTLSGroupsVersion is the first version of OpenSSL ignoring the
+// unknown groups prefixed with a question mark
+var optionalTLSGroupsVersion = [3]int{3, 5, 0}
+
+// openSSLVersionAtLeast returns true if the version, like 3.0.8, is equal or
+// greater than min, the unknown versions are considered as old as 1.1.1
+func openSSLVersionAtLeast(version string, min [3]int) bool {
+	current := [3]int{1, 1, 1}
+	if parts := strings.Split(version, "."); len(parts) == 3 {
+		for i, part := range parts {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				current = [3]int{1, 1, 1}
+				break
+			}
+			current[i] = n
+		}
+	}
+
+	for i := range current {
+		if current[i] != min[i] {
+			return current[i] > min[i]
+		}
+	}
+
+	return true
+}
+
+// buildSSLECDHCurve returns the key exchange groups of ssl-ecdh-curve. The
+// optional groups, prefixed with a question mark, are kept as is by the
+// versions of OpenSSL ignoring the unknown ones, otherwise they are removed
+// when the version of OpenSSL used by NGINX does not support them, so the
+// post-quantum hybrid groups can be staged without breaking the older builds.
+func buildSSLECDHCurve(c interface{}, v interface{}) string {
+	cfg, ok := c.(config.Configuration)
+	if !ok {
+		klog.Errorf("expected a 'config.Configuration' type but %T was returned", c)
+		return "auto"
+	}
+
+	version, ok := v.(string)
+	if !ok {
+		klog.Errorf("expected a 'string' type but %T was returned", v)
+		return "auto"
+	}
+
+	if !strings.Contains(cfg.SSLECDHCurve, "?") || openSSLVersionAtLeast(version, optionalTLSGroupsVersion) {
+		return cfg.SSLECDHCurve
+	}
+
+	groups := []string{}
+	for _, group := range strings.Split(cfg.SSLECDHCurve, ":") {
+		if !strings.HasPrefix(group, "?") {
+			groups = append(groups, group)
+			continue
+		}
+
+		group = strings.TrimPrefix(group, "?")
+		min, ok := tlsGroups[strings.ToLower(group)]
+		if !ok || !openSSLVersionAtLeast(version, min) {
+			klog.Warningf("ignoring the key exchange group %v of ssl-ecdh-curve, not supported by OpenSSL %v", group, version)
+			continue
+		}
+		groups = append(groups, group)
+	}
+
+	if len(groups) == 0 {
+		return "auto"
+	}
+
+	return strings.Join(groups, ":")
+}
+
+// buildLuaPlugins returns the names of the plugins loaded by the workers as
+// the items of a Lua table, adding the plugins required by the annotations
+// of the locations to the ones of the configuration
+func buildLuaPlugins(c interface{}, s interface{}) string {
+	cfg, ok := c.(config.Configuration)
+	if !ok {
+		klog.Errorf("expected a 'config.Configuration' type but %T was returned", c)
+		return ""
+	}
+
+	servers, ok := s.([]*ingress.Server)
+	if !ok {
+		klog.Errorf("expected an '[]*ingress.Server' type but %T was returned", s)
+		return ""
+	}
+
+	plugins := append([]string{}, cfg.Plugins...)
+	if !sets.NewString(plugins...).Has(bodyFilterPlugin) && hasBodyFilterSnippet(servers) {
+		plugins = append(plugins, bodyFilterPlugin)
+	}
+	if !sets.NewString(plugins...).Has(idempotencyPlugin) && hasIdempotency(servers) {
+		plugins = append(plugins, idempotencyPlugin)
+	}
+
+	return luaStringList(plugins)
+}
+
+func hasBodyFilterSnippet(servers []*ingress.Server) bool {
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			if location.BodyFilterSnippet != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func hasIdempotency(servers []*ingress.Server) bool {
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			if location.Idempotency.Enabled {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// buildIdempotency returns the variables with the idempotency key of the
+// request and the time its response is replayed, read by the idempotency
+// plugin
+func buildIdempotency(l interface{}) string {
+	location, ok := l.(*ingress.Location)
+	if !ok {
+		klog.Errorf("expected an '*ingress.Location' type but %T was returned", l)
+		return ""
+	}
+
+	if !location.Idempotency.Enabled {
+		return ""
+	}
+
+	header := strings.ToLower(strings.Replace(location.Idempotency.Header, "-", "_", -1))
+	return fmt.Sprintf("set $idempotency_key $http_%v;\n            set $idempotency_ttl %v;", header, location.Idempotency.TTL)
+}
+
+// buildTrailingSlashRedirect returns the redirection of the requests of the
+// location to the path with or without trailing slash. The raw URI of the
+// request is used, so the encoding of the path and the query string are kept.
+func buildTrailingSlashRedirect(c interface{}, l interface{}) string {
+	cfg, ok := c.(config.Configuration)
+	if !ok {
+		klog.Errorf("expected a 'config.Configuration' type but %T was returned", c)
+		return ""
+	}
+
+	location, ok := l.(*ingress.Location)
+	if !ok {
+		klog.Errorf("expected an '*ingress.Location' type but %T was returned", l)
+		return ""
+	}
+
+	code := location.TrailingSlash.Code
+	if code == 0 {
+		code = cfg.HTTPRedirectCode
+	}
+
+	switch location.TrailingSlash.Policy {
+	case trailingslash.PolicyAdd:
+		// the paths whose last segment contains a dot are files
+		return fmt.Sprintf(`if ($request_uri ~ "^((?:[^?]*/)?[^?/.]+)(\?.*)?$") {
+                return %v $1/$2;
+            }`, code)
+	case trailingslash.PolicyRemove:
+		return fmt.Sprintf(`if ($request_uri ~ "^([^?]*[^?/])/+(\?.*)?$") {
+                return %v $1$2;
+            }`, code)
+	}
+
+	return ""
+}
+
+// buildBodyFilterSnippet returns the variable with the checksum of the code
+// of the body-filter-snippet annotation, read by the body_filter plugin to
+// find the code in the dynamic configuration
+func buildBodyFilterSnippet(l interface{}) string {
+	location, ok := l.(*ingress.Location)
+	if !ok {
+		klog.Errorf("expected an '*ingress.Location' type but %T was returned", l)
+		return ""
+	}
+
+	if location.BodyFilterSnippet == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("set $body_filter_snippet \"%v\";", bodyfiltersnippet.Checksum(location.BodyFilterSnippet))
+}
+
 // locationConfigForLua formats some location specific configuration into Lua table represented as string
 func locationConfigForLua(l interface{}, a interface{}) string {
 	location, ok := l.(*ingress.Location)
@@ -343,7 +749,20 @@ func locationConfigForLua(l interface{}, a interface{}) string {
 		ssl_redirect = %t,
 		force_no_ssl_redirect = %t,
 		use_port_in_redirects = %t,
-		global_throttle = { namespace = "%v", limit = %d, window_size = %d, key = %v, ignored_cidrs = %v },
+		global_throttle = { namespace = "%v", limit = %d, window_size = %d, key = %v, key_hash = %t, ignored_cidrs = %v, ignored_headers = %v, burst = %d, delay = %d, headers = %t, store = "%v", buckets = %v },
+		uri_normalization_policy = "%v",
+		bot_detection = %t,
+		max_inflight = { limit = %d, queue_size = %d, queue_timeout = %d, retry_after = %d },
+		connection_limit = { namespace = "%v", limit = %d, key = %v, status_code = %d },
+		websocket_limit = { namespace = "%v", per_client = %d, per_backend = %d, status_code = %d },
+		backend_bandwidth = { rate = %d, burst = %d },
+		adaptive_concurrency = { enabled = %t, min_limit = %d, max_limit = %d, tolerance = %v },
+		limit_upload_rate = %d,
+		auth_jwt = %v,
+		rate_limit_exemption = %v,
+		route_if = %v,
+		no_endpoints = { action = "%v", retry_after = %d, page = %v },
+		max_request_duration = { duration = %d, connect_timeout = %d, send_timeout = %d, read_timeout = %d },
 	}`,
 		location.Rewrite.ForceSSLRedirect,
 		location.Rewrite.SSLRedirect,
@@ -353,10 +772,157 @@ func locationConfigForLua(l interface{}, a interface{}) string {
 		location.GlobalRateLimit.Limit,
 		location.GlobalRateLimit.WindowSize,
 		parseComplexNginxVarIntoLuaTable(location.GlobalRateLimit.Key),
+		location.GlobalRateLimit.KeyHash,
 		ignoredCIDRs,
+		buildGlobalRateLimitIgnoredHeaders(location.GlobalRateLimit.IgnoredHeaders),
+		location.GlobalRateLimit.Burst,
+		location.GlobalRateLimit.Delay,
+		location.GlobalRateLimit.Headers,
+		location.GlobalRateLimit.Store,
+		buildGlobalRateLimitBuckets(location.GlobalRateLimit.Buckets),
+		location.URINormalizationPolicy,
+		location.BotDetection,
+		location.MaxInflight.Limit,
+		location.MaxInflight.QueueSize,
+		location.MaxInflight.QueueTimeout,
+		location.MaxInflight.RetryAfter,
+		location.ConnectionLimit.Namespace,
+		location.ConnectionLimit.Limit,
+		parseComplexNginxVarIntoLuaTable(location.ConnectionLimit.Key),
+		all.Cfg.LimitConnStatusCode,
+		location.WebSocketLimit.Namespace,
+		location.WebSocketLimit.PerClient,
+		location.WebSocketLimit.PerBackend,
+		all.Cfg.LimitConnStatusCode,
+		location.BackendBandwidth.Rate*1024,
+		location.BackendBandwidth.Burst*1024,
+		location.AdaptiveConcurrency.Enabled,
+		location.AdaptiveConcurrency.MinLimit,
+		location.AdaptiveConcurrency.MaxLimit,
+		location.AdaptiveConcurrency.Tolerance,
+		location.RateLimit.LimitUploadRate,
+		buildAuthJWTForLua(location.AuthJWT),
+		buildRateLimitExemptionForLua(location.RateLimitExemption),
+		buildRouteIfForLua(location.RouteIf),
+		location.NoEndpoints.Action,
+		location.NoEndpoints.RetryAfter,
+		quoteLuaString(location.NoEndpoints.Page),
+		location.MaxRequestDuration,
+		location.Proxy.ConnectTimeout,
+		location.Proxy.SendTimeout,
+		location.Proxy.ReadTimeout,
 	)
 }
 
+// buildAuthJWTForLua returns the settings of the validation of the JSON Web
+// Tokens of the location as Lua table, empty when it is disabled
+func buildAuthJWTForLua(config authjwt.Config) string {
+	if config.JWKSURL == "" {
+		return "{}"
+	}
+
+	audiences, err := convertGoSliceIntoLuaTable(config.Audiences, false)
+	if err != nil {
+		klog.Errorf("failed to convert %v into Lua table: %q", config.Audiences, err)
+		audiences = "{}"
+	}
+
+	var claims []string
+	for _, claim := range config.RequiredClaims {
+		claims = append(claims, fmt.Sprintf(`{ name = "%v", value = "%v" }`, claim.Name, claim.Value))
+	}
+
+	var headers []string
+	for _, header := range config.ClaimHeaders {
+		headers = append(headers, fmt.Sprintf(`{ header = "%v", claim = "%v" }`, header.Header, header.Claim))
+	}
+
+	return fmt.Sprintf(`{ jwks_url = "%v", issuer = "%v", audiences = %v, required_claims = { %v }, claim_headers = { %v } }`,
+		config.JWKSURL, config.Issuer, audiences, strings.Join(claims, ", "), strings.Join(headers, ", "))
+}
+
+// buildRateLimitExemptionForLua returns the credentials exempting the
+// requests of the location from the rate limits as Lua table, nil when there
+// is none
+func buildRateLimitExemptionForLua(config ratelimitexemption.Config) string {
+	if len(config.ClientCertCNs) == 0 && config.JWTIssuer == "" {
+		return "nil"
+	}
+
+	var cns []string
+	for _, cn := range config.ClientCertCNs {
+		cns = append(cns, quoteLuaString(cn))
+	}
+
+	return fmt.Sprintf(`{ client_cert_cns = { %v }, jwt_issuer = %v }`,
+		strings.Join(cns, ", "), quoteLuaString(config.JWTIssuer))
+}
+
+// buildRouteIfForLua returns the predicate of the route-if annotation and the
+// upstream of the requests matching it as Lua table, nil when the service has
+// no active endpoints
+func buildRouteIfForLua(config routeif.Config) string {
+	if config.Predicate == nil || config.Backend == "" {
+		return "nil"
+	}
+
+	return fmt.Sprintf(`{ backend = %v, predicate = %v }`,
+		quoteLuaString(config.Backend), buildRouteIfPredicateForLua(config.Predicate))
+}
+
+func buildRouteIfPredicateForLua(predicate *routeif.Predicate) string {
+	if len(predicate.Operands) == 0 {
+		return fmt.Sprintf(`{ op = "%v", variable = "%v", value = %v }`,
+			predicate.Op, predicate.Variable, quoteLuaString(predicate.Value))
+	}
+
+	var operands []string
+	for _, operand := range predicate.Operands {
+		operands = append(operands, buildRouteIfPredicateForLua(operand))
+	}
+
+	return fmt.Sprintf(`{ op = "%v", operands = { %v } }`, predicate.Op, strings.Join(operands, ", "))
+}
+
+// buildGlobalRateLimitIgnoredHeaders returns the headers exempting the
+// requests from the global rate limit as Lua table, with the NGINX variables
+// of the headers
+func buildGlobalRateLimitIgnoredHeaders(headers []globalratelimit.IgnoredHeader) string {
+	if len(headers) == 0 {
+		return "{}"
+	}
+
+	var out []string
+	for _, header := range headers {
+		out = append(out, fmt.Sprintf(`{ variable = "http_%v", value = %v }`,
+			strings.Replace(header.Name, "-", "_", -1), quoteLuaString(header.Value)))
+	}
+
+	return fmt.Sprintf("{ %v }", strings.Join(out, ", "))
+}
+
+// buildGlobalRateLimitBuckets returns the buckets of the global rate limit
+// as Lua table, selected by global_throttle with the path of the location
+func buildGlobalRateLimitBuckets(buckets []globalratelimit.Config) string {
+	if len(buckets) == 0 {
+		return "{}"
+	}
+
+	var out []string
+	for _, bucket := range buckets {
+		paths, err := convertGoSliceIntoLuaTable(bucket.Paths, false)
+		if err != nil {
+			klog.Errorf("failed to convert %v into Lua table: %q", bucket.Paths, err)
+			paths = "{}"
+		}
+
+		out = append(out, fmt.Sprintf(`{ name = "%v", namespace = "%v", limit = %d, window_size = %d, paths = %v }`,
+			bucket.Name, bucket.Namespace, bucket.Limit, bucket.WindowSize, paths))
+	}
+
+	return fmt.Sprintf("{ %v }", strings.Join(out, ", "))
+}
+
 // buildResolvers returns the resolvers reading the /etc/resolv.conf file
 func buildResolvers(res interface{}, disableIpv6 interface{}) string {
 	// NGINX need IPV6 addresses to be surrounded by brackets
@@ -429,11 +995,18 @@ func buildLocation(input interface{}, enforceRegex bool) string {
 	}
 
 	path := location.Path
+	isExact := location.PathType != nil && *location.PathType == networking.PathTypeExact
+
 	if enforceRegex {
+		// the regular expressions of the Exact paths are anchored at the end
+		if isExact {
+			return fmt.Sprintf(`~* "^%s$"`, path)
+		}
+
 		return fmt.Sprintf(`~* "^%s"`, path)
 	}
 
-	if location.PathType != nil && *location.PathType == networkingv1beta1.PathTypeExact {
+	if isExact {
 		return fmt.Sprintf(`= %s`, path)
 	}
 
@@ -463,6 +1036,17 @@ func buildAuthLocation(input interface{}, globalExternalAuthURL string) string {
 	return fmt.Sprintf("/_external-auth-%v-%v", str, pathType)
 }
 
+// buildAuthExcludePathsRegex returns the regular expression matching the
+// paths, and the paths below them, that skip the authentication
+func buildAuthExcludePathsRegex(paths []string) string {
+	quoted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		quoted = append(quoted, regexp.QuoteMeta(path))
+	}
+
+	return fmt.Sprintf(`"^(%s)(/|$)"`, strings.Join(quoted, "|"))
+}
+
 // shouldApplyGlobalAuth returns true only in case when ExternalAuth.URL is not set and
 // GlobalExternalAuth is set and enabled
 func shouldApplyGlobalAuth(input interface{}, globalExternalAuthURL string) bool {
@@ -547,10 +1131,19 @@ func buildProxyPass(host string, b interface{}, loc interface{}) string {
 		proxyPass = "fastcgi_pass"
 	}
 
-	upstreamName := "upstream_balancer"
+	upstreamName := ""
 
 	for _, backend := range backends {
 		if backend.Name == location.Backend {
+			// the requests are sent directly to the Unix domain socket, the
+			// colon ends the path of the socket in the URLs of proxy_pass
+			if backend.UnixSocket != "" {
+				upstreamName = "unix:" + backend.UnixSocket
+				if proxyPass == "proxy_pass" {
+					upstreamName += ":"
+				}
+			}
+
 			if backend.SSLPassthrough {
 				proto = "https://"
 
@@ -569,12 +1162,22 @@ func buildProxyPass(host string, b interface{}, loc interface{}) string {
 		proxyPass = "proxy_pass"
 	}
 
+	if upstreamName == "" {
+		upstreamName = locationUpstreamName(location, proxyPass == "grpc_pass")
+	}
+
 	// defProxyPass returns the default proxy_pass, just the name of the upstream
 	defProxyPass := fmt.Sprintf("%v %s%s;", proxyPass, proto, upstreamName)
 
+	// only proxy_pass sends a URI to the backend
+	prefix := location.UpstreamPrefix
+	if proxyPass != "proxy_pass" {
+		prefix = ""
+	}
+
 	// if the path in the ingress rule is equals to the target: no special rewrite
 	if path == location.Rewrite.Target {
-		return defProxyPass
+		return buildUpstreamPrefixProxyPass(location, prefix, defProxyPass, proto, upstreamName)
 	}
 
 	if len(location.Rewrite.Target) > 0 {
@@ -586,43 +1189,251 @@ func buildProxyPass(host string, b interface{}, loc interface{}) string {
 
 		return fmt.Sprintf(`
 rewrite "(?i)%s" %s break;
-%v%v %s%s;`, path, location.Rewrite.Target, xForwardedPrefix, proxyPass, proto, upstreamName)
+%v%v %s%s;`, path, joinUpstreamPrefix(prefix, location.Rewrite.Target), xForwardedPrefix, proxyPass, proto, upstreamName)
 	}
 
 	// default proxy_pass
-	return defProxyPass
+	return buildUpstreamPrefixProxyPass(location, prefix, defProxyPass, proto, upstreamName)
 }
 
-func filterRateLimits(input interface{}) []ratelimit.Config {
-	ratelimits := []ratelimit.Config{}
-	found := sets.String{}
-
-	servers, ok := input.([]*ingress.Server)
-	if !ok {
-		klog.Errorf("expected a '[]ratelimit.RateLimit' type but %T was returned", input)
-		return ratelimits
+// buildUpstreamPrefixProxyPass returns the proxy_pass prepending the prefix
+// of the upstream-prefix annotation to the URI of the requests, or the
+// default proxy_pass without prefix. The URI is sent as received from the
+// client, with its escaping, unless the location normalizes it.
+func buildUpstreamPrefixProxyPass(location *ingress.Location, prefix, defProxyPass, proto, upstreamName string) string {
+	if prefix == "" {
+		return defProxyPass
 	}
-	for _, server := range servers {
-		for _, loc := range server.Locations {
-			if loc.RateLimit.ID != "" && !found.Has(loc.RateLimit.ID) {
-				found.Insert(loc.RateLimit.ID)
-				ratelimits = append(ratelimits, loc.RateLimit)
-			}
-		}
+
+	// NGINX escapes the normalized URI, $uri is not escaped
+	if location.URINormalizationPolicy == urinormalization.PolicyNormalize {
+		return fmt.Sprintf(`
+rewrite ^ %s$uri break;
+%v`, prefix, defProxyPass)
 	}
-	return ratelimits
+
+	return fmt.Sprintf("proxy_pass %s%s%s$request_uri;", proto, upstreamName, prefix)
 }
 
-// buildRateLimitZones produces an array of limit_conn_zone in order to allow
-// rate limiting of request. Each Ingress rule could have up to three zones, one
-// for connection limit by IP address, one for limiting requests per minute, and
-// one for limiting requests per second.
-func buildRateLimitZones(input interface{}) []string {
-	zones := sets.String{}
+// joinUpstreamPrefix prepends the prefix of the upstream-prefix annotation
+// to the rewrite target
+func joinUpstreamPrefix(prefix, target string) string {
+	if prefix == "" {
+		return target
+	}
 
-	servers, ok := input.([]*ingress.Server)
-	if !ok {
-		klog.Errorf("expected a '[]*ingress.Server' type but %T was returned", input)
+	if strings.HasPrefix(target, "/") {
+		return prefix + target
+	}
+
+	return prefix + "/" + target
+}
+
+// buildGRPCHTTP1Fallback returns the configuration used to send the requests
+// without a gRPC content type to a gRPC backend using HTTP/1.1, so services
+// exposing gRPC and REST endpoints on the same port keep working.
+func buildGRPCHTTP1Fallback(loc interface{}) string {
+	location, ok := loc.(*ingress.Location)
+	if !ok {
+		klog.Errorf("expected a '*ingress.Location' type but %T was returned", loc)
+		return ""
+	}
+
+	if !location.GRPCHTTP1Fallback {
+		return ""
+	}
+
+	proto := ""
+	switch location.BackendProtocol {
+	case "GRPC":
+		proto = "http://"
+	case "GRPCS":
+		proto = "https://"
+	default:
+		return ""
+	}
+
+	return fmt.Sprintf(`if ($http_content_type !~* "^application/grpc") {
+    proxy_pass %v%v;
+}`, proto, locationUpstreamName(location, false))
+}
+
+// upstreamKeepalive is an upstream balanced by Lua like upstream_balancer,
+// with the keepalive pool of the upstream-keepalive-* annotations
+type upstreamKeepalive struct {
+	Name        string
+	Connections int
+	Requests    int
+	Timeout     int
+}
+
+// locationUpstreamName returns the name of the upstream the requests of the
+// location are proxied to, the gRPC requests use their own keepalive pools
+func locationUpstreamName(location *ingress.Location, grpc bool) string {
+	name := "upstream_balancer"
+	if grpc {
+		name = "upstream_balancer_grpc"
+	}
+
+	config := location.UpstreamKeepalive
+	if config == (upstreamkeepalive.Config{}) {
+		return name
+	}
+
+	return fmt.Sprintf("%v_keepalive_%v_%v_%v", name, config.Connections, config.Requests, config.Timeout)
+}
+
+// isGRPCLocation returns true if the requests of the location are proxied
+// with grpc_pass
+func isGRPCLocation(location *ingress.Location) bool {
+	return (location.BackendProtocol == "GRPC" || location.BackendProtocol == "GRPCS") &&
+		location.Backend != "upstream-default-backend"
+}
+
+// buildConnectionUpgrade returns the variable with the Connection header of
+// the requests of the location, without the close value when the upstream of
+// the location keeps the connections alive
+func buildConnectionUpgrade(c interface{}, l interface{}) string {
+	cfg, ok := c.(config.Configuration)
+	if !ok {
+		klog.Errorf("expected a 'config.Configuration' type but %T was returned", c)
+		return "$connection_upgrade"
+	}
+
+	location, ok := l.(*ingress.Location)
+	if !ok {
+		klog.Errorf("expected an '*ingress.Location' type but %T was returned", l)
+		return "$connection_upgrade"
+	}
+
+	if location.UpstreamKeepalive == (upstreamkeepalive.Config{}) {
+		return "$connection_upgrade"
+	}
+
+	connections := location.UpstreamKeepalive.Connections
+	if connections == 0 {
+		connections = cfg.UpstreamKeepaliveConnections
+	}
+	if connections > 0 {
+		return "$connection_upgrade_keepalive"
+	}
+
+	return "$connection_upgrade"
+}
+
+// filterUpstreamKeepalives returns the upstreams with the keepalive pools of
+// the locations, the settings missing in the annotations are the ones of the
+// ConfigMap, upstream-keepalive-grpc-* for the gRPC requests
+func filterUpstreamKeepalives(c interface{}, s interface{}) []upstreamKeepalive {
+	upstreams := []upstreamKeepalive{}
+
+	cfg, ok := c.(config.Configuration)
+	if !ok {
+		klog.Errorf("expected a 'config.Configuration' type but %T was returned", c)
+		return upstreams
+	}
+
+	servers, ok := s.([]*ingress.Server)
+	if !ok {
+		klog.Errorf("expected a '[]*ingress.Server' type but %T was returned", s)
+		return upstreams
+	}
+
+	found := sets.String{}
+	add := func(loc *ingress.Location, grpc bool) {
+		name := locationUpstreamName(loc, grpc)
+		if found.Has(name) {
+			return
+		}
+		found.Insert(name)
+
+		upstream := upstreamKeepalive{
+			Name:        name,
+			Connections: loc.UpstreamKeepalive.Connections,
+			Requests:    loc.UpstreamKeepalive.Requests,
+			Timeout:     loc.UpstreamKeepalive.Timeout,
+		}
+
+		defaults := upstreamKeepalive{
+			Connections: cfg.UpstreamKeepaliveConnections,
+			Requests:    cfg.UpstreamKeepaliveRequests,
+			Timeout:     cfg.UpstreamKeepaliveTimeout,
+		}
+		if grpc {
+			defaults = upstreamKeepalive{
+				Connections: cfg.UpstreamKeepaliveGRPCConnections,
+				Requests:    cfg.UpstreamKeepaliveGRPCRequests,
+				Timeout:     cfg.UpstreamKeepaliveGRPCTimeout,
+			}
+		}
+
+		if upstream.Connections == 0 {
+			upstream.Connections = defaults.Connections
+		}
+		if upstream.Requests == 0 {
+			upstream.Requests = defaults.Requests
+		}
+		if upstream.Timeout == 0 {
+			upstream.Timeout = defaults.Timeout
+		}
+
+		upstreams = append(upstreams, upstream)
+	}
+
+	for _, server := range servers {
+		for _, loc := range server.Locations {
+			if loc.UpstreamKeepalive == (upstreamkeepalive.Config{}) {
+				continue
+			}
+
+			// the requests of the gRPC-HTTP/1.1 fallback use the pools of HTTP
+			grpc := isGRPCLocation(loc)
+			if grpc {
+				add(loc, true)
+			}
+			if !grpc || loc.GRPCHTTP1Fallback {
+				add(loc, false)
+			}
+		}
+	}
+
+	sort.Slice(upstreams, func(i, j int) bool {
+		return upstreams[i].Name < upstreams[j].Name
+	})
+
+	return upstreams
+}
+
+func filterRateLimits(input interface{}) []ratelimit.Config {
+	ratelimits := []ratelimit.Config{}
+	found := sets.String{}
+
+	servers, ok := input.([]*ingress.Server)
+	if !ok {
+		klog.Errorf("expected a '[]ratelimit.RateLimit' type but %T was returned", input)
+		return ratelimits
+	}
+	for _, server := range servers {
+		for _, loc := range server.Locations {
+			if loc.RateLimit.ID != "" && !found.Has(loc.RateLimit.ID) {
+				found.Insert(loc.RateLimit.ID)
+				ratelimits = append(ratelimits, loc.RateLimit)
+			}
+		}
+	}
+	return ratelimits
+}
+
+// buildRateLimitZones produces an array of limit_conn_zone in order to allow
+// rate limiting of request. Each Ingress rule could have up to three zones, one
+// for connection limit by IP address, one for limiting requests per minute, and
+// one for limiting requests per second.
+func buildRateLimitZones(input interface{}) []string {
+	zones := sets.String{}
+
+	servers, ok := input.([]*ingress.Server)
+	if !ok {
+		klog.Errorf("expected a '[]*ingress.Server' type but %T was returned", input)
 		return zones.List()
 	}
 
@@ -776,6 +1587,45 @@ func buildUpstreamName(loc interface{}) string {
 	return upstreamName
 }
 
+// buildUpstreamAlias returns the value of the $proxy_upstream_alias variable.
+// An explicit backend-alias annotation always wins. Otherwise, in "service"
+// mode the alias is built from the service and the service port number, so
+// it does not depend on whether the ingress references the port by name or
+// number, nor on the internal upstream naming.
+func buildUpstreamAlias(loc interface{}, m interface{}) string {
+	location, ok := loc.(*ingress.Location)
+	if !ok {
+		klog.Errorf("expected a '*ingress.Location' type but %T was returned", loc)
+		return ""
+	}
+
+	mode, ok := m.(string)
+	if !ok {
+		klog.Errorf("expected a 'string' type but %T was returned", m)
+		return ""
+	}
+
+	if location.BackendAlias != "" {
+		return location.BackendAlias
+	}
+
+	if mode != config.UpstreamAliasModeService || location.Service == nil || location.Service.Name == "" {
+		return location.Backend
+	}
+
+	port := location.Port.String()
+	if location.Port.Type == intstr.String {
+		for _, sp := range location.Service.Spec.Ports {
+			if sp.Name == location.Port.StrVal {
+				port = fmt.Sprintf("%v", sp.Port)
+				break
+			}
+		}
+	}
+
+	return fmt.Sprintf("%v/%v:%v", location.Service.Namespace, location.Service.Name, port)
+}
+
 func buildNextUpstream(i, r interface{}) string {
 	nextUpstream, ok := i.(string)
 	if !ok {
@@ -805,6 +1655,44 @@ func buildNextUpstream(i, r interface{}) string {
 	return strings.Join(nextUpstreamCodes, " ")
 }
 
+// buildFallbackNextUpstream adds to the proxy_next_upstream conditions of the
+// location the ones configured to retry the request against the fallback service
+func buildFallbackNextUpstream(l interface{}) string {
+	location, ok := l.(*ingress.Location)
+	if !ok {
+		klog.Errorf("expected an '*ingress.Location' type but %T was returned", l)
+		return ""
+	}
+
+	if location.Fallback.Backend == "" {
+		return location.Proxy.NextUpstream
+	}
+
+	conditions := []string{}
+	for _, v := range strings.Fields(location.Proxy.NextUpstream) {
+		// retries are required to use the fallback service
+		if v != "off" {
+			conditions = append(conditions, v)
+		}
+	}
+
+	for _, c := range location.Fallback.NextUpstream() {
+		found := false
+		for _, v := range conditions {
+			if v == c {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			conditions = append(conditions, c)
+		}
+	}
+
+	return strings.Join(conditions, " ")
+}
+
 // refer to http://nginx.org/en/docs/syntax.html
 // Nginx differentiates between size and offset
 // offset directives support gigabytes in addition
@@ -833,6 +1721,26 @@ func isValidByteSize(input interface{}, isOffset bool) bool {
 	return nginxSizeRegex.MatchString(s)
 }
 
+// proxyCookieRewrites returns the rewrites of a comma separated list of the
+// proxy_cookie_domain or proxy_cookie_path directives
+func proxyCookieRewrites(input interface{}) []string {
+	s, ok := input.(string)
+	if !ok {
+		klog.Errorf("expected an 'string' type but %T was returned", input)
+		return []string{}
+	}
+
+	rewrites := []string{}
+	for _, rewrite := range strings.Split(s, ",") {
+		rewrite = strings.TrimSpace(rewrite)
+		if rewrite != "" {
+			rewrites = append(rewrites, rewrite)
+		}
+	}
+
+	return rewrites
+}
+
 type ingressInformation struct {
 	Namespace   string
 	Path        string
@@ -897,11 +1805,9 @@ func getIngressInformation(i, h, p interface{}) *ingressInformation {
 		info.Path = "/"
 	}
 
-	if ing.Spec.Backend != nil {
-		info.Service = ing.Spec.Backend.ServiceName
-		if ing.Spec.Backend.ServicePort.String() != "0" {
-			info.ServicePort = ing.Spec.Backend.ServicePort.String()
-		}
+	if ing.Spec.DefaultBackend != nil && ing.Spec.DefaultBackend.Service != nil {
+		info.Service = ing.Spec.DefaultBackend.Service.Name
+		info.ServicePort = serviceBackendPort(ing.Spec.DefaultBackend.Service.Port)
 	}
 
 	for _, rule := range ing.Spec.Rules {
@@ -927,14 +1833,14 @@ func getIngressInformation(i, h, p interface{}) *ingressInformation {
 				continue
 			}
 
-			if info.Service != "" && rPath.Backend.ServiceName == "" {
+			if info.Service != "" && rPath.Backend.Service == nil {
 				// empty rule. Only contains a Path and PathType
 				return info
 			}
 
-			info.Service = rPath.Backend.ServiceName
-			if rPath.Backend.ServicePort.String() != "0" {
-				info.ServicePort = rPath.Backend.ServicePort.String()
+			if rPath.Backend.Service != nil {
+				info.Service = rPath.Backend.Service.Name
+				info.ServicePort = serviceBackendPort(rPath.Backend.Service.Port)
 			}
 
 			return info
@@ -944,6 +1850,16 @@ func getIngressInformation(i, h, p interface{}) *ingressInformation {
 	return info
 }
 
+// serviceBackendPort returns the name or the number of the port of a service
+// backend, empty when it is not defined
+func serviceBackendPort(port networking.ServiceBackendPort) string {
+	if port.Number > 0 {
+		return strconv.Itoa(int(port.Number))
+	}
+
+	return port.Name
+}
+
 func buildForwardedFor(input interface{}) string {
 	s, ok := input.(string)
 	if !ok {
@@ -1034,6 +1950,37 @@ func buildOpentracing(c interface{}, s interface{}) string {
 	return buf.String()
 }
 
+func buildOpentelemetry(c interface{}, s interface{}) string {
+	cfg, ok := c.(config.Configuration)
+	if !ok {
+		klog.Errorf("expected a 'config.Configuration' type but %T was returned", c)
+		return ""
+	}
+
+	servers, ok := s.([]*ingress.Server)
+	if !ok {
+		klog.Errorf("expected an '[]*ingress.Server' type but %T was returned", s)
+		return ""
+	}
+
+	if !shouldLoadOpentelemetryModule(cfg, servers) {
+		return ""
+	}
+
+	buf := bytes.NewBufferString("opentelemetry_config /etc/nginx/opentelemetry.toml;\n")
+
+	// the locations with the enable-opentelemetry annotation turn it on
+	if !cfg.EnableOpentelemetry {
+		buf.WriteString("opentelemetry off;\n")
+	}
+
+	if cfg.OpentelemetryOperationName != "" {
+		buf.WriteString(fmt.Sprintf("opentelemetry_operation_name \"%s\";\n", cfg.OpentelemetryOperationName))
+	}
+
+	return buf.String()
+}
+
 // buildInfluxDB produces the single line configuration
 // needed by the InfluxDB module to send request's metrics
 // for the current resource
@@ -1085,6 +2032,26 @@ func buildCustomErrorDeps(upstreamName string, errorCodes []int, enableMetrics b
 	}
 }
 
+// errorResponseCodes are the status codes of the errors generated by NGINX
+// rendered by the error_response Lua module
+var errorResponseCodes = []int{400, 401, 403, 404, 405, 408, 413, 414, 429, 500, 502, 503, 504}
+
+// buildErrorResponseCodes returns the status codes of the errors rendered by
+// the error_response Lua module, except the ones sent to the default backend
+// with the custom-http-errors setting
+func buildErrorResponseCodes(customHTTPErrors []int) string {
+	custom := sets.NewInt(customHTTPErrors...)
+
+	codes := []string{}
+	for _, code := range errorResponseCodes {
+		if !custom.Has(code) {
+			codes = append(codes, fmt.Sprintf("%d", code))
+		}
+	}
+
+	return strings.Join(codes, " ")
+}
+
 type errorLocation struct {
 	UpstreamName string
 	Codes        []int
@@ -1153,6 +2120,28 @@ func opentracingPropagateContext(location *ingress.Location) string {
 	return "opentracing_propagate_context;"
 }
 
+// opentracingSpanSettings returns the operation name and the tags
+// configured for the spans of a location
+func opentracingSpanSettings(location *ingress.Location) string {
+	buf := bytes.NewBufferString("")
+
+	if location.Opentracing.OperationName != "" {
+		buf.WriteString(fmt.Sprintf("\nopentracing_operation_name \"%s\";", location.Opentracing.OperationName))
+	}
+
+	keys := make([]string, 0, len(location.Opentracing.Tags))
+	for key := range location.Opentracing.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		buf.WriteString(fmt.Sprintf("\nopentracing_tag %s \"%s\";", key, location.Opentracing.Tags[key]))
+	}
+
+	return buf.String()
+}
+
 // shouldLoadModSecurityModule determines whether or not the ModSecurity module needs to be loaded.
 // First, it checks if `enable-modsecurity` is set in the ConfigMap. If it is not, it iterates over all locations to
 // check if ModSecurity is enabled by the annotation `nginx.ingress.kubernetes.io/enable-modsecurity`.
@@ -1209,7 +2198,9 @@ func buildHTTPListener(t interface{}, s interface{}) string {
 
 	co := commonListenOptions(tc, hostname)
 
-	out = append(out, httpListener(addrV4, co, tc)...)
+	if !tc.IsIPV6Only {
+		out = append(out, httpListener(addrV4, co, tc)...)
+	}
 
 	if !tc.IsIPV6Enabled {
 		return strings.Join(out, "\n")
@@ -1242,12 +2233,23 @@ func buildHTTPSListener(t interface{}, s interface{}) string {
 
 	co := commonListenOptions(tc, hostname)
 
+	// nginx enables HTTP/2 for all the servers of a port
+	http2 := tc.Cfg.UseHTTP2
+	for _, host := range tc.HTTP2DisabledHosts {
+		if host == hostname {
+			http2 = false
+			break
+		}
+	}
+
 	addrV4 := []string{""}
 	if len(tc.Cfg.BindAddressIpv4) > 0 {
 		addrV4 = tc.Cfg.BindAddressIpv4
 	}
 
-	out = append(out, httpsListener(addrV4, co, tc)...)
+	if !tc.IsIPV6Only {
+		out = append(out, httpsListener(addrV4, co, tc, http2)...)
+	}
 
 	if !tc.IsIPV6Enabled {
 		return strings.Join(out, "\n")
@@ -1258,7 +2260,7 @@ func buildHTTPSListener(t interface{}, s interface{}) string {
 		addrV6 = tc.Cfg.BindAddressIpv6
 	}
 
-	out = append(out, httpsListener(addrV6, co, tc)...)
+	out = append(out, httpsListener(addrV6, co, tc, http2)...)
 
 	return strings.Join(out, "\n")
 }
@@ -1287,35 +2289,100 @@ func commonListenOptions(template config.TemplateConfig, hostname string) string
 	return strings.Join(out, " ")
 }
 
+// additionalListenPorts returns the ports of the ConfigMap not already used
+// by the ports of the flags or by the reserved ones
+func additionalListenPorts(ports []int, tc config.TemplateConfig, reserved ...int) []int {
+	used := sets.NewInt(tc.ListenPorts.HTTP, tc.ListenPorts.HTTPS, tc.ListenPorts.Health,
+		tc.ListenPorts.Default, tc.ListenPorts.SSLProxy, tc.ListenPorts.HTTP1SSLProxy,
+		tc.ListenPorts.MixedProtocol, tc.ListenPorts.MixedProtocolRedirect, tc.StatusPort, tc.StreamPort)
+	used.Insert(reserved...)
+
+	out := make([]int, 0, len(ports))
+	for _, port := range ports {
+		if used.Has(port) {
+			continue
+		}
+
+		used.Insert(port)
+		out = append(out, port)
+	}
+
+	return out
+}
+
+// httpsAdditionalPorts returns the additional ports NGINX listens on for HTTPS
+// requests. A port cannot serve both HTTP and HTTPS.
+func httpsAdditionalPorts(tc config.TemplateConfig) []int {
+	return additionalListenPorts(tc.Cfg.AdditionalHTTPSPorts, tc, tc.Cfg.AdditionalHTTPPorts...)
+}
+
+// sslPrereadPorts returns the ports of the stream server reading the SNI host
+// name of the connections, the HTTPS port and the additional HTTPS ports, so
+// the servers with HTTP/2 disabled are served in a different port
+func sslPrereadPorts(t interface{}) []int {
+	tc, ok := t.(config.TemplateConfig)
+	if !ok {
+		klog.Errorf("expected a 'config.TemplateConfig' type but %T was returned", t)
+		return []int{}
+	}
+
+	if !tc.IsSSLPrereadEnabled {
+		return []int{}
+	}
+
+	return append([]int{tc.ListenPorts.HTTPS}, httpsAdditionalPorts(tc)...)
+}
+
+func listenAddress(address string, port int) string {
+	if address == "" {
+		return fmt.Sprintf("%v", port)
+	}
+
+	return fmt.Sprintf("%v:%v", address, port)
+}
+
 func httpListener(addresses []string, co string, tc config.TemplateConfig) []string {
+	ports := append([]int{tc.ListenPorts.HTTP}, additionalListenPorts(tc.Cfg.AdditionalHTTPPorts, tc)...)
+
 	out := make([]string, 0)
 	for _, address := range addresses {
-		lo := []string{"listen"}
+		for _, port := range ports {
+			lo := []string{"listen", listenAddress(address, port)}
 
-		if address == "" {
-			lo = append(lo, fmt.Sprintf("%v", tc.ListenPorts.HTTP))
-		} else {
-			lo = append(lo, fmt.Sprintf("%v:%v", address, tc.ListenPorts.HTTP))
+			lo = append(lo, co)
+			lo = append(lo, ";")
+			out = append(out, strings.Join(lo, " "))
 		}
-
-		lo = append(lo, co)
-		lo = append(lo, ";")
-		out = append(out, strings.Join(lo, " "))
 	}
 
 	return out
 }
 
-func httpsListener(addresses []string, co string, tc config.TemplateConfig) []string {
+func httpsListener(addresses []string, co string, tc config.TemplateConfig, http2 bool) []string {
+	// the additional ports are served by the stream server reading the SNI
+	// host name of the connections, see sslPrereadPorts, or else by NGINX
+	// with HTTP/2 enabled only when no server disables it
+	additionalPorts := []int{}
+	if !tc.IsSSLPrereadEnabled {
+		additionalPorts = httpsAdditionalPorts(tc)
+	}
+	additionalHTTP2 := tc.Cfg.UseHTTP2 && len(tc.HTTP2DisabledHosts) == 0
+
 	out := make([]string, 0)
 	for _, address := range addresses {
 		lo := []string{"listen"}
 
-		if tc.IsSSLPassthroughEnabled {
+		// the HTTPS port is served by the TLS proxy or the stream server
+		if tc.IsSSLPassthroughEnabled || tc.IsSSLPrereadEnabled {
+			port := tc.ListenPorts.SSLProxy
+			if !http2 {
+				port = tc.ListenPorts.HTTP1SSLProxy
+			}
+
 			if address == "" {
-				lo = append(lo, fmt.Sprintf("%v", tc.ListenPorts.SSLProxy))
+				lo = append(lo, fmt.Sprintf("%v", port))
 			} else {
-				lo = append(lo, fmt.Sprintf("%v:%v", address, tc.ListenPorts.SSLProxy))
+				lo = append(lo, fmt.Sprintf("%v:%v", address, port))
 			}
 
 			if !strings.Contains(co, "proxy_protocol") {
@@ -1332,12 +2399,23 @@ func httpsListener(addresses []string, co string, tc config.TemplateConfig) []st
 		lo = append(lo, co)
 		lo = append(lo, "ssl")
 
-		if tc.Cfg.UseHTTP2 {
+		if http2 {
 			lo = append(lo, "http2")
 		}
 
 		lo = append(lo, ";")
 		out = append(out, strings.Join(lo, " "))
+
+		for _, port := range additionalPorts {
+			lo := []string{"listen", listenAddress(address, port), co, "ssl"}
+
+			if additionalHTTP2 {
+				lo = append(lo, "http2")
+			}
+
+			lo = append(lo, ";")
+			out = append(out, strings.Join(lo, " "))
+		}
 	}
 
 	return out
@@ -1354,7 +2432,7 @@ func buildOpentracingForLocation(isOTEnabled bool, location *ingress.Location) s
 
 		opc := opentracingPropagateContext(location)
 		if opc != "" {
-			opc = fmt.Sprintf("opentracing on;\n%v", opc)
+			opc = fmt.Sprintf("opentracing on;\n%v%v", opc, opentracingSpanSettings(location))
 		}
 
 		return opc
@@ -1363,7 +2441,7 @@ func buildOpentracingForLocation(isOTEnabled bool, location *ingress.Location) s
 	if isOTSetInLoc && isOTEnabledInLoc {
 		opc := opentracingPropagateContext(location)
 		if opc != "" {
-			opc = fmt.Sprintf("opentracing on;\n%v", opc)
+			opc = fmt.Sprintf("opentracing on;\n%v%v", opc, opentracingSpanSettings(location))
 		}
 
 		return opc
@@ -1372,6 +2450,77 @@ func buildOpentracingForLocation(isOTEnabled bool, location *ingress.Location) s
 	return ""
 }
 
+// buildOpentelemetryForLocation returns the OpenTelemetry directives of a
+// location. The enable-opentelemetry and opentelemetry-trust-incoming-span
+// annotations override the settings of the ConfigMap.
+func buildOpentelemetryForLocation(isOTEnabled bool, isOTTrustEnabled bool, location *ingress.Location) string {
+	if location == nil {
+		return ""
+	}
+
+	enabled := isOTEnabled
+	if location.Opentelemetry.Set {
+		enabled = location.Opentelemetry.Enabled
+	}
+
+	if !enabled {
+		if isOTEnabled {
+			return "opentelemetry off;"
+		}
+
+		return ""
+	}
+
+	trust := isOTTrustEnabled
+	if location.Opentelemetry.TrustSet {
+		trust = location.Opentelemetry.TrustEnabled
+	}
+
+	buf := bytes.NewBufferString("opentelemetry on;\nopentelemetry_propagate;")
+	if trust {
+		buf.WriteString("\nopentelemetry_trust_incoming_spans on;")
+	} else {
+		buf.WriteString("\nopentelemetry_trust_incoming_spans off;")
+	}
+
+	if location.Opentelemetry.OperationName != "" {
+		buf.WriteString(fmt.Sprintf("\nopentelemetry_operation_name \"%s\";", location.Opentelemetry.OperationName))
+	}
+
+	return buf.String()
+}
+
+// shouldLoadOpentelemetryModule determines whether or not the OpenTelemetry module needs to be loaded.
+// First, it checks if `enable-opentelemetry` is set in the ConfigMap. If it is not, it iterates over all locations to
+// check if OpenTelemetry is enabled by the annotation `nginx.ingress.kubernetes.io/enable-opentelemetry`.
+func shouldLoadOpentelemetryModule(c interface{}, s interface{}) bool {
+	cfg, ok := c.(config.Configuration)
+	if !ok {
+		klog.Errorf("expected a 'config.Configuration' type but %T was returned", c)
+		return false
+	}
+
+	servers, ok := s.([]*ingress.Server)
+	if !ok {
+		klog.Errorf("expected an '[]*ingress.Server' type but %T was returned", s)
+		return false
+	}
+
+	if cfg.EnableOpentelemetry {
+		return true
+	}
+
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			if location.Opentelemetry.Enabled {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // shouldLoadOpentracingModule determines whether or not the Opentracing module needs to be loaded.
 // First, it checks if `enable-opentracing` is set in the ConfigMap. If it is not, it iterates over all locations to
 // check if Opentracing is enabled by the annotation `nginx.ingress.kubernetes.io/enable-opentracing`.
@@ -1445,15 +2594,60 @@ func buildModSecurityForLocation(cfg config.Configuration, location *ingress.Loc
 `)
 	}
 
+	// the rules must be removed after being loaded
+	if len(location.ModSecurity.RemoveRules) > 0 {
+		buffer.WriteString(fmt.Sprintf(`modsecurity_rules '
+SecRuleRemoveById %v
+';
+`, strings.Join(location.ModSecurity.RemoveRules, " ")))
+	}
+
 	return buffer.String()
 }
 
+// buildRequestIDForLocation returns the directives overriding the $req_id
+// variable of the http block when the request ID policy of the location
+// differs from the one of the configmap
+func buildRequestIDForLocation(cfg config.Configuration, location *ingress.Location) string {
+	policy := location.RequestID.Policy
+	if policy == "" {
+		return ""
+	}
+
+	if policy == cfg.RequestIDPolicy &&
+		(policy != requestid.Prefix || location.RequestID.Prefix == cfg.RequestIDPrefix) {
+		return ""
+	}
+
+	switch policy {
+	case requestid.Regenerate:
+		return "set $req_id $request_id;"
+	case requestid.Prefix:
+		return fmt.Sprintf(`if ($http_x_request_id) {
+    set $req_id "%v$http_x_request_id";
+}`, location.RequestID.Prefix)
+	default:
+		return `if ($http_x_request_id) {
+    set $req_id $http_x_request_id;
+}`
+	}
+}
+
 func buildMirrorLocations(locs []*ingress.Location) string {
 	var buffer bytes.Buffer
 
 	mapped := sets.String{}
 
 	for _, loc := range locs {
+		for _, target := range loc.Mirror.Targets {
+			if mapped.Has(target.Source) {
+				continue
+			}
+
+			mapped.Insert(target.Source)
+			buffer.WriteString(buildMirrorLocation(target.Source, target.Target, target.Percentage))
+		}
+
 		if loc.Mirror.Source == "" || loc.Mirror.Target == "" {
 			continue
 		}
@@ -1463,15 +2657,35 @@ func buildMirrorLocations(locs []*ingress.Location) string {
 		}
 
 		mapped.Insert(loc.Mirror.Source)
-		buffer.WriteString(fmt.Sprintf(`location = %v {
+		buffer.WriteString(buildMirrorLocation(loc.Mirror.Source, loc.Mirror.Target, 100))
+	}
+
+	return buffer.String()
+}
+
+// buildMirrorLocation returns the internal location of a mirror backend. The
+// requests out of the sample end before being sent to the backend
+func buildMirrorLocation(source, target string, percentage int) string {
+	if percentage >= 100 {
+		return fmt.Sprintf(`location = %v {
 internal;
 proxy_pass %v;
 }
 
-`, loc.Mirror.Source, loc.Mirror.Target))
+`, source, target)
 	}
 
-	return buffer.String()
+	return fmt.Sprintf(`location = %v {
+internal;
+rewrite_by_lua_block {
+    if math.random(100) > %v then
+        return ngx.exit(ngx.HTTP_NO_CONTENT)
+    end
+}
+proxy_pass %v;
+}
+
+`, source, percentage, target)
 }
 
 // shouldLoadAuthDigestModule determines whether or not the ngx_http_auth_digest_module module needs to be loaded.
@@ -1497,6 +2711,26 @@ func shouldLoadAuthDigestModule(s interface{}) bool {
 	return false
 }
 
+// shouldLoadBrotliModule determines whether or not the brotli modules need to be
+// loaded for the locations serving precompressed assets.
+func shouldLoadBrotliModule(s interface{}) bool {
+	servers, ok := s.([]*ingress.Server)
+	if !ok {
+		klog.Errorf("expected an '[]*ingress.Server' type but %T was returned", s)
+		return false
+	}
+
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			if location.Precompressed.Brotli {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // shouldLoadInfluxDBModule determines whether or not the ngx_http_auth_digest_module module needs to be loaded.
 func shouldLoadInfluxDBModule(s interface{}) bool {
 	servers, ok := s.([]*ingress.Server)
@@ -1516,6 +2750,71 @@ func shouldLoadInfluxDBModule(s interface{}) bool {
 	return false
 }
 
+// shouldConfigureProxyCache determines whether or not the cache zone used
+// by the enable-proxy-cache annotation needs to be configured.
+func shouldConfigureProxyCache(s interface{}) bool {
+	servers, ok := s.([]*ingress.Server)
+	if !ok {
+		klog.Errorf("expected an '[]*ingress.Server' type but %T was returned", s)
+		return false
+	}
+
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			if location.ProxyCache.Enabled {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// buildStaleCacheControl returns the stale-while-revalidate and stale-if-error
+// extensions of the Cache-Control header of the responses of a location
+// using the cache, empty when their durations are not configured
+func buildStaleCacheControl(input interface{}) string {
+	config, ok := input.(proxycache.Config)
+	if !ok {
+		klog.Errorf("expected a 'proxycache.Config' type but %T was returned", input)
+		return ""
+	}
+
+	extensions := []string{}
+	if config.StaleWhileRevalidate > 0 {
+		extensions = append(extensions, fmt.Sprintf("stale-while-revalidate=%v", config.StaleWhileRevalidate))
+	}
+	if config.StaleIfError > 0 {
+		extensions = append(extensions, fmt.Sprintf("stale-if-error=%v", config.StaleIfError))
+	}
+
+	return strings.Join(extensions, ", ")
+}
+
+// filterTenantServers returns the servers not rendered
+// in the include file of a tenant
+func filterTenantServers(servers []*ingress.Server, tenants []config.Tenant) []*ingress.Server {
+	if len(tenants) == 0 {
+		return servers
+	}
+
+	tenantServers := make(map[*ingress.Server]bool)
+	for _, tenant := range tenants {
+		for _, server := range tenant.Servers {
+			tenantServers[server] = true
+		}
+	}
+
+	filtered := make([]*ingress.Server, 0, len(servers))
+	for _, server := range servers {
+		if !tenantServers[server] {
+			filtered = append(filtered, server)
+		}
+	}
+
+	return filtered
+}
+
 // buildServerName ensures wildcard hostnames are valid
 func buildServerName(hostname string) string {
 	if !strings.HasPrefix(hostname, "*") {
@@ -1548,6 +2847,28 @@ func parseComplexNginxVarIntoLuaTable(ngxVar string) string {
 	return luaTable
 }
 
+// quoteLuaString returns the string as a Lua string literal, with the
+// non-printable and non-ASCII bytes escaped with their decimal value
+func quoteLuaString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
 func convertGoSliceIntoLuaTable(goSliceInterface interface{}, emptyStringAsNil bool) (string, error) {
 	goSlice := reflect.ValueOf(goSliceInterface)
 	kind := goSlice.Kind()
@@ -1575,3 +2896,218 @@ func convertGoSliceIntoLuaTable(goSliceInterface interface{}, emptyStringAsNil b
 		return "", fmt.Errorf("could not process type: %s", kind)
 	}
 }
+
+// buildLogFormatJSON returns the log_format of the JSON access logs with the
+// fields
+func buildLogFormatJSON(fields []accesslogfields.Field) string {
+	var out []string
+	for _, field := range fields {
+		value := field.Value
+		if field.Type != accesslogfields.TypeNumber {
+			value = fmt.Sprintf(`"%v"`, value)
+		}
+
+		out = append(out, fmt.Sprintf(`"%v":%v`, field.Name, value))
+	}
+
+	return "{" + strings.Join(out, ",") + "}"
+}
+
+// clientAddressVariableRegex matches the NGINX variables containing the
+// address of the clients
+var clientAddressVariableRegex = regexp.MustCompile(`\$(\{(remote_addr|realip_remote_addr|proxy_protocol_addr|http_x_real_ip|http_x_forwarded_for|proxy_add_x_forwarded_for|full_x_forwarded_for)\}|(remote_addr|realip_remote_addr|proxy_protocol_addr|http_x_real_ip|http_x_forwarded_for|proxy_add_x_forwarded_for|full_x_forwarded_for)\b)`)
+
+// anonymizeLogFormat replaces the variables with the address of the clients in
+// the log_format with $remote_addr_anonymized when anonymize-client-ip-in-logs
+// is enabled
+func anonymizeLogFormat(cfg config.Configuration, format string) string {
+	if !cfg.AnonymizeClientIPInLogs {
+		return format
+	}
+
+	return clientAddressVariableRegex.ReplaceAllString(format, "$$remote_addr_anonymized")
+}
+
+// accessLogFormat returns the name and the log_format of the JSON access
+// logs of the location, empty when the location has no fields or the access
+// logs are not written in JSON
+func accessLogFormat(cfg config.Configuration, location *ingress.Location) (string, string) {
+	if len(cfg.LogFormatJSON) == 0 || len(location.AccessLogFields.Fields) == 0 {
+		return "", ""
+	}
+
+	format := buildLogFormatJSON(accesslogfields.Merge(cfg.LogFormatJSON, location.AccessLogFields.Fields))
+
+	hasher := sha1.New() // #nosec
+	hasher.Write([]byte(format))
+
+	return "upstreaminfo_" + hex.EncodeToString(hasher.Sum(nil))[:12], format
+}
+
+// buildAccessLogFormats returns the log_format of the JSON access logs of the
+// locations with the enable-access-log-fields annotation, by name
+func buildAccessLogFormats(cfg config.Configuration, servers []*ingress.Server) map[string]string {
+	formats := map[string]string{}
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			name, format := accessLogFormat(cfg, location)
+			if name != "" {
+				formats[name] = format
+			}
+		}
+	}
+
+	return formats
+}
+
+// buildLocationAccessLog returns the access_log of the location using its
+// JSON access log format, empty when the location has no fields
+func buildLocationAccessLog(cfg config.Configuration, location *ingress.Location) string {
+	if cfg.DisableAccessLog || cfg.DisableHTTPAccessLog {
+		return ""
+	}
+
+	name, _ := accessLogFormat(cfg, location)
+	if name == "" {
+		return ""
+	}
+
+	if cfg.EnableSyslog {
+		return fmt.Sprintf("access_log syslog:server=%v:%v %v if=$loggable;", cfg.SyslogHost, cfg.SyslogPort, name)
+	}
+
+	accessLogPath := cfg.HttpAccessLogPath
+	if accessLogPath == "" {
+		accessLogPath = cfg.AccessLogPath
+	}
+
+	return fmt.Sprintf("access_log %v %v %v if=$loggable;", accessLogPath, name, cfg.AccessLogParams)
+}
+
+// buildStaticFiles returns the files served from NGINX in the server, the
+// files of the configuration replaced by the ones of the server. The files
+// with the path of an exact location of the server are not served.
+func buildStaticFiles(cfg config.Configuration, server *ingress.Server) []staticfiles.File {
+	exactPaths := sets.NewString()
+	for _, location := range server.Locations {
+		if location.PathType != nil && *location.PathType == networking.PathTypeExact {
+			exactPaths.Insert(location.Path)
+		}
+	}
+
+	var files []staticfiles.File
+	for _, file := range staticfiles.Merge(cfg.StaticFiles, server.StaticFiles.Files) {
+		if exactPaths.Has(file.Path) {
+			klog.Warningf("Skipping the static file %v of the server %v, the path is an exact location", file.Path, server.Hostname)
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	return files
+}
+
+// buildStaticFileContent returns the content of a static file as a quoted
+// string of the NGINX configuration, without variables
+func buildStaticFileContent(content string) string {
+	return staticfiles.QuoteContent(content)
+}
+
+// buildSnippetFragments returns the include files of the snippet fragments of
+// the location, skipping the fragments not defined in the configuration
+func buildSnippetFragments(cfg config.Configuration, dir string, location *ingress.Location) []string {
+	var includes []string
+	for _, name := range location.SnippetFragments {
+		if _, ok := cfg.SnippetFragments[name]; !ok {
+			klog.Warningf("Snippet fragment %v of the location %v is not defined in the configuration", name, location.Path)
+			continue
+		}
+
+		includes = append(includes, filepath.Join(dir, name+".conf"))
+	}
+
+	return includes
+}
+
+// geoRoutingVariable returns the name of the variable holding the upstream
+// selected by the geo-routing annotations of the location, empty when none of
+// the services of the location has active endpoints
+func geoRoutingVariable(location *ingress.Location) string {
+	routes := []string{}
+	for _, rule := range location.GeoRouting.Rules {
+		if rule.Backend != "" {
+			routes = append(routes, fmt.Sprintf("%v:%v=%v", rule.Scope, rule.Code, rule.Backend))
+		}
+	}
+
+	if len(routes) == 0 && location.GeoRouting.DefaultBackend == "" {
+		return ""
+	}
+
+	hasher := sha1.New() // #nosec
+	hasher.Write([]byte(strings.Join(routes, ",")))
+	hasher.Write([]byte(location.GeoRouting.DefaultBackend))
+
+	return "geo_upstream_" + hex.EncodeToString(hasher.Sum(nil))[:12]
+}
+
+// buildGeoRoutingMaps returns the maps of the variables of geoRoutingVariable.
+// The upstream of the country of the client takes precedence over the one of
+// its continent, an empty value uses the backend of the location.
+func buildGeoRoutingMaps(servers []*ingress.Server, files []string) []string {
+	countryVariable, continentVariable := "$geoip2_country_code", "$geoip2_continent_code"
+	switch db := nginx.GeoIP2CountryDB(files); db {
+	case "":
+		return []string{}
+	case "GeoIP2-City.mmdb", "GeoLite2-City.mmdb":
+		countryVariable, continentVariable = "$geoip2_city_country_code", "$geoip2_city_continent_code"
+	}
+
+	maps := []string{}
+	found := sets.String{}
+
+	for _, server := range servers {
+		for _, location := range server.Locations {
+			variable := geoRoutingVariable(location)
+			if variable == "" || found.Has(variable) {
+				continue
+			}
+			found.Insert(variable)
+
+			countries := []string{}
+			continents := []string{}
+			for _, rule := range location.GeoRouting.Rules {
+				if rule.Backend == "" {
+					continue
+				}
+
+				route := fmt.Sprintf("        %v %q;", rule.Code, rule.Backend)
+				if rule.Scope == georouting.ScopeCountry {
+					countries = append(countries, route)
+				} else {
+					continents = append(continents, route)
+				}
+			}
+
+			var b strings.Builder
+			fmt.Fprintf(&b, "map %v $%v_continent {\n", continentVariable, variable)
+			fmt.Fprintf(&b, "        default %q;\n", location.GeoRouting.DefaultBackend)
+			for _, route := range continents {
+				fmt.Fprintf(&b, "%v\n", route)
+			}
+			b.WriteString("    }\n\n")
+
+			fmt.Fprintf(&b, "    map %v $%v {\n", countryVariable, variable)
+			fmt.Fprintf(&b, "        default $%v_continent;\n", variable)
+			for _, route := range countries {
+				fmt.Fprintf(&b, "%v\n", route)
+			}
+			b.WriteString("    }")
+
+			maps = append(maps, b.String())
+		}
+	}
+
+	return maps
+}
@@ -25,22 +25,42 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 
 	jsoniter "github.com/json-iterator/go"
 	apiv1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/accesslogfields"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/authjwt"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/authreq"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/bodyfiltersnippet"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/fallback"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/georouting"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/globalratelimit"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/grpcmetadata"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/idempotency"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/influxdb"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/mirror"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/modsecurity"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/opentelemetry"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/opentracing"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/precompressed"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/proxy"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/proxycache"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/ratelimit"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/ratelimitexemption"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/requestid"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/rewrite"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/routeif"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticfiles"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/trailingslash"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamkeepalive"
 	"k8s.io/ingress-nginx/internal/ingress/controller/config"
 	"k8s.io/ingress-nginx/internal/nginx"
 )
@@ -294,6 +314,37 @@ func TestBuildLocation(t *testing.T) {
 	}
 }
 
+func TestBuildLocationPathType(t *testing.T) {
+	exact := networking.PathTypeExact
+	prefix := networking.PathTypePrefix
+	implementationSpecific := networking.PathTypeImplementationSpecific
+
+	testCases := []struct {
+		pathType     *networking.PathType
+		enforceRegex bool
+		expected     string
+	}{
+		{&exact, false, "= /foo"},
+		{&exact, true, `~* "^/foo$"`},
+		{&prefix, false, "/foo"},
+		{&prefix, true, `~* "^/foo"`},
+		{&implementationSpecific, false, "/foo"},
+		{nil, false, "/foo"},
+	}
+
+	for _, tc := range testCases {
+		loc := &ingress.Location{
+			Path:     "/foo",
+			PathType: tc.pathType,
+		}
+
+		actual := buildLocation(loc, tc.enforceRegex)
+		if actual != tc.expected {
+			t.Errorf("expected '%v' but returned '%v'", tc.expected, actual)
+		}
+	}
+}
+
 func TestBuildProxyPass(t *testing.T) {
 	defaultBackend := "upstream-name"
 	defaultHost := "example.com"
@@ -334,6 +385,99 @@ func TestBuildProxyPass(t *testing.T) {
 	}
 }
 
+func TestBuildProxyPassUnixSocket(t *testing.T) {
+	backend := &ingress.Backend{
+		Name:       "upstream-name",
+		UnixSocket: "/var/run/php/php-fpm.sock",
+	}
+
+	testCases := []struct {
+		protocol string
+		expected string
+	}{
+		{"", "proxy_pass http://unix:/var/run/php/php-fpm.sock:;"},
+		{"HTTPS", "proxy_pass https://unix:/var/run/php/php-fpm.sock:;"},
+		{"GRPC", "grpc_pass grpc://unix:/var/run/php/php-fpm.sock;"},
+		{"FCGI", "fastcgi_pass unix:/var/run/php/php-fpm.sock;"},
+	}
+
+	for _, tc := range testCases {
+		loc := &ingress.Location{
+			Path:            "/",
+			Rewrite:         rewrite.Config{Target: "/"},
+			Backend:         "upstream-name",
+			BackendProtocol: tc.protocol,
+		}
+
+		pp := buildProxyPass("example.com", []*ingress.Backend{backend}, loc)
+		if pp != tc.expected {
+			t.Errorf("%q: expected '%v' but returned '%v'", tc.protocol, tc.expected, pp)
+		}
+	}
+}
+
+func TestBuildProxyPassUpstreamPrefix(t *testing.T) {
+	backends := []*ingress.Backend{
+		{Name: "upstream-name"},
+		{Name: "socket", UnixSocket: "/var/run/app.sock"},
+	}
+
+	testCases := []struct {
+		title    string
+		location *ingress.Location
+		expected string
+	}{
+		{"without prefix", &ingress.Location{Path: "/v1", Backend: "upstream-name"}, "proxy_pass http://upstream_balancer;"},
+		{"prefix", &ingress.Location{Path: "/v1", Backend: "upstream-name", UpstreamPrefix: "/api"},
+			"proxy_pass http://upstream_balancer/api$request_uri;"},
+		{"prefix with rewrite target", &ingress.Location{Path: "/v1(/|$)(.*)", Backend: "upstream-name", UpstreamPrefix: "/api",
+			Rewrite: rewrite.Config{Target: "/$2"}}, `
+rewrite "(?i)/v1(/|$)(.*)" /api/$2 break;
+proxy_pass http://upstream_balancer;`},
+		{"prefix with normalized URI", &ingress.Location{Path: "/v1", Backend: "upstream-name", UpstreamPrefix: "/api",
+			URINormalizationPolicy: "normalize"}, `
+rewrite ^ /api$uri break;
+proxy_pass http://upstream_balancer;`},
+		{"prefix with Unix socket", &ingress.Location{Path: "/v1", Backend: "socket", UpstreamPrefix: "/api"},
+			"proxy_pass http://unix:/var/run/app.sock:/api$request_uri;"},
+		{"prefix ignored by gRPC", &ingress.Location{Path: "/v1", Backend: "upstream-name", UpstreamPrefix: "/api", BackendProtocol: "GRPC"},
+			"grpc_pass grpc://upstream_balancer_grpc;"},
+	}
+
+	for _, tc := range testCases {
+		pp := buildProxyPass("example.com", backends, tc.location)
+		if pp != tc.expected {
+			t.Errorf("%v: expected '%v' but returned '%v'", tc.title, tc.expected, pp)
+		}
+	}
+}
+
+func TestBuildAuthExcludePathsRegex(t *testing.T) {
+	testCases := []struct {
+		paths    []string
+		expected string
+	}{
+		{[]string{"/healthz"}, `"^(/healthz)(/|$)"`},
+		{[]string{"/healthz", "/metrics"}, `"^(/healthz|/metrics)(/|$)"`},
+		{[]string{"/api/v1.0/status"}, `"^(/api/v1\.0/status)(/|$)"`},
+	}
+
+	for _, tc := range testCases {
+		regex := buildAuthExcludePathsRegex(tc.paths)
+		if regex != tc.expected {
+			t.Errorf("expected %v but got %v", tc.expected, regex)
+		}
+
+		matcher := regexp.MustCompile(strings.Trim(regex, `"`))
+		if !matcher.MatchString(tc.paths[0]) || !matcher.MatchString(tc.paths[0]+"/live") {
+			t.Errorf("expected %v to match %v and the paths below it", regex, tc.paths[0])
+		}
+		if matcher.MatchString(tc.paths[0] + "x") {
+			t.Errorf("expected %v to not match %v", regex, tc.paths[0]+"x")
+		}
+	}
+}
+
 func TestBuildAuthLocation(t *testing.T) {
 	invalidType := &ingress.Ingress{}
 	expected := ""
@@ -503,6 +647,111 @@ func TestTemplateWithData(t *testing.T) {
 	}
 }
 
+func TestTemplateIsDeterministic(t *testing.T) {
+	pwd, _ := os.Getwd()
+	data, err := ioutil.ReadFile(path.Join(pwd, "../../../../test/data/config.json"))
+	if err != nil {
+		t.Fatal("unexpected error reading json file: ", err)
+	}
+
+	ngxTpl, err := NewTemplate(nginx.TemplatePath)
+	if err != nil {
+		t.Fatalf("invalid NGINX template: %v", err)
+	}
+
+	var expected []byte
+	for i := 0; i < 20; i++ {
+		// the maps of the configuration are built again for each rendering
+		var dat config.TemplateConfig
+		if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &dat); err != nil {
+			t.Fatalf("unexpected error unmarshalling json: %v", err)
+		}
+		if dat.ListenPorts == nil {
+			dat.ListenPorts = &config.ListenPorts{}
+		}
+		dat.Cfg.DefaultSSLCertificate = &ingress.SSLCert{}
+
+		rt, err := ngxTpl.Write(dat)
+		if err != nil {
+			t.Fatalf("invalid NGINX template: %v", err)
+		}
+
+		if expected == nil {
+			expected = rt
+			continue
+		}
+
+		if string(rt) == string(expected) {
+			continue
+		}
+
+		expectedLines := strings.Split(string(expected), "\n")
+		lines := strings.Split(string(rt), "\n")
+		for n := 0; n < len(lines) && n < len(expectedLines); n++ {
+			if lines[n] != expectedLines[n] {
+				t.Fatalf("expected the same configuration for the same data but line %v differs: %q instead of %q", n+1, lines[n], expectedLines[n])
+			}
+		}
+		t.Fatalf("expected the same configuration for the same data but got %v lines instead of %v", len(lines), len(expectedLines))
+	}
+}
+
+func TestTemplateWithTenants(t *testing.T) {
+	pwd, _ := os.Getwd()
+	data, err := ioutil.ReadFile(path.Join(pwd, "../../../../test/data/config.json"))
+	if err != nil {
+		t.Fatal("unexpected error reading json file: ", err)
+	}
+	var dat config.TemplateConfig
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &dat); err != nil {
+		t.Fatalf("unexpected error unmarshalling json: %v", err)
+	}
+	if dat.ListenPorts == nil {
+		dat.ListenPorts = &config.ListenPorts{}
+	}
+	dat.Cfg.DefaultSSLCertificate = &ingress.SSLCert{}
+
+	ngxTpl, err := NewTemplate(nginx.TemplatePath)
+	if err != nil {
+		t.Fatalf("invalid NGINX template: %v", err)
+	}
+
+	tenant := config.Tenant{
+		Namespace: "team-a",
+		Include:   "/etc/nginx/tenants/team-a.conf",
+		Servers:   dat.Servers[1:2],
+	}
+	dat.Tenants = []config.Tenant{tenant}
+
+	rt, err := ngxTpl.Write(dat)
+	if err != nil {
+		t.Fatalf("invalid NGINX template: %v", err)
+	}
+
+	startServer := fmt.Sprintf("## start server %v", tenant.Servers[0].Hostname)
+	if strings.Contains(string(rt), startServer) {
+		t.Errorf("invalid NGINX template, unexpected server of the tenant")
+	}
+	if !strings.Contains(string(rt), "include /etc/nginx/tenants/team-a.conf;") {
+		t.Errorf("invalid NGINX template, expected include of the tenant not present")
+	}
+	if !strings.Contains(string(rt), fmt.Sprintf("## start server %v", dat.Servers[0].Hostname)) {
+		t.Errorf("invalid NGINX template, expected server not present")
+	}
+
+	rt, err = ngxTpl.WriteTenant(dat, tenant)
+	if err != nil {
+		t.Fatalf("invalid NGINX template: %v", err)
+	}
+
+	if !strings.Contains(string(rt), startServer) {
+		t.Errorf("invalid NGINX template, expected server of the tenant not present")
+	}
+	if strings.Contains(string(rt), "http {") {
+		t.Errorf("invalid NGINX template, unexpected main configuration in the include file of the tenant")
+	}
+}
+
 func BenchmarkTemplateWithData(b *testing.B) {
 	pwd, _ := os.Getwd()
 	f, err := os.Open(path.Join(pwd, "../../../../test/data/config.json"))
@@ -594,6 +843,70 @@ func TestIsLocationAllowed(t *testing.T) {
 	}
 }
 
+func TestTemplateWithGRPCMetadata(t *testing.T) {
+	pwd, _ := os.Getwd()
+	data, err := ioutil.ReadFile(path.Join(pwd, "../../../../test/data/config.json"))
+	if err != nil {
+		t.Fatal("unexpected error reading json file: ", err)
+	}
+	var dat config.TemplateConfig
+	if err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, &dat); err != nil {
+		t.Fatalf("unexpected error unmarshalling json: %v", err)
+	}
+	if dat.ListenPorts == nil {
+		dat.ListenPorts = &config.ListenPorts{}
+	}
+	dat.Cfg.DefaultSSLCertificate = &ingress.SSLCert{}
+
+	location := dat.Servers[0].Locations[0]
+	location.BackendProtocol = "GRPC"
+	location.GRPCMetadata = grpcmetadata.Config{
+		ClientIP:  "x-client-ip",
+		RequestID: "x-request-id",
+		TLSPrefix: "x-tls-",
+	}
+
+	ngxTpl, err := NewTemplate(nginx.TemplatePath)
+	if err != nil {
+		t.Fatalf("invalid NGINX template: %v", err)
+	}
+
+	rt, err := ngxTpl.Write(dat)
+	if err != nil {
+		t.Fatalf("invalid NGINX template: %v", err)
+	}
+
+	for _, directive := range []string{
+		"grpc_set_header x-client-ip $remote_addr;",
+		"grpc_set_header x-request-id $req_id;",
+		"grpc_set_header x-tls-protocol     $ssl_protocol;",
+	} {
+		if !strings.Contains(string(rt), directive) {
+			t.Errorf("invalid NGINX template, expected %q not present", directive)
+		}
+	}
+}
+
+func TestProxyCookieRewrites(t *testing.T) {
+	testCases := map[string][]string{
+		"off":                                    {"off"},
+		"":                                       {},
+		"internal.local example.com":             {"internal.local example.com"},
+		"/one/ /, ~^/two/(.*)$ /$1 , ,/three/ /": {"/one/ /", "~^/two/(.*)$ /$1", "/three/ /"},
+	}
+
+	for input, expected := range testCases {
+		rewrites := proxyCookieRewrites(input)
+		if !reflect.DeepEqual(rewrites, expected) {
+			t.Errorf("expected %v as the rewrites of %q but returned %v", expected, input, rewrites)
+		}
+	}
+
+	if rewrites := proxyCookieRewrites(1); len(rewrites) != 0 {
+		t.Errorf("expected no rewrites of an invalid input but returned %v", rewrites)
+	}
+}
+
 func TestBuildForwardedFor(t *testing.T) {
 	invalidType := &ingress.Ingress{}
 	expected := ""
@@ -694,6 +1007,97 @@ func TestBuildNextUpstream(t *testing.T) {
 	}
 }
 
+func TestBuildFallbackNextUpstream(t *testing.T) {
+	invalidType := &ingress.Ingress{}
+	expected := ""
+	actual := buildFallbackNextUpstream(invalidType)
+
+	if expected != actual {
+		t.Errorf("Expected '%v' but returned '%v'", expected, actual)
+	}
+
+	cases := map[string]struct {
+		NextUpstream string
+		Fallback     fallback.Config
+		Output       string
+	}{
+		"without fallback service": {
+			"error timeout",
+			fallback.Config{StatusCodes: []int{502}},
+			"error timeout",
+		},
+		"with fallback service": {
+			"error timeout http_500",
+			fallback.Config{StatusCodes: []int{500, 503}, Backend: "fallback-default-maintenance"},
+			"error timeout http_500 http_503",
+		},
+		"retries disabled": {
+			"off",
+			fallback.Config{StatusCodes: []int{502}, Backend: "fallback-default-maintenance"},
+			"error timeout http_502",
+		},
+	}
+
+	for k, tc := range cases {
+		location := &ingress.Location{
+			Proxy:    proxy.Config{NextUpstream: tc.NextUpstream},
+			Fallback: tc.Fallback,
+		}
+
+		nextUpstream := buildFallbackNextUpstream(location)
+		if nextUpstream != tc.Output {
+			t.Errorf("%s: expected '%v' but returned '%v'", k, tc.Output, nextUpstream)
+		}
+	}
+}
+
+func TestBuildGeoRoutingMaps(t *testing.T) {
+	location := &ingress.Location{
+		GeoRouting: georouting.Config{
+			Rules: []georouting.Rule{
+				{Scope: georouting.ScopeContinent, Code: "EU", Backend: "geo-default-eu-service"},
+				{Scope: georouting.ScopeCountry, Code: "US", Backend: "geo-default-us-service"},
+				{Scope: georouting.ScopeCountry, Code: "CA"},
+			},
+			DefaultBackend: "geo-default-global-service",
+		},
+	}
+	servers := []*ingress.Server{{Locations: []*ingress.Location{location, location, {}}}}
+
+	if variable := geoRoutingVariable(&ingress.Location{}); variable != "" {
+		t.Errorf("expected no variable without geo routing but got %v", variable)
+	}
+
+	variable := geoRoutingVariable(location)
+	if !strings.HasPrefix(variable, "geo_upstream_") {
+		t.Fatalf("unexpected variable %v", variable)
+	}
+
+	if maps := buildGeoRoutingMaps(servers, []string{"GeoLite2-ASN.mmdb"}); len(maps) != 0 {
+		t.Errorf("expected no maps without country database but got %v", maps)
+	}
+
+	expected := []string{fmt.Sprintf(`map $geoip2_city_continent_code $%[1]v_continent {
+        default "geo-default-global-service";
+        EU "geo-default-eu-service";
+    }
+
+    map $geoip2_city_country_code $%[1]v {
+        default $%[1]v_continent;
+        US "geo-default-us-service";
+    }`, variable)}
+
+	maps := buildGeoRoutingMaps(servers, []string{"GeoLite2-City.mmdb"})
+	if !reflect.DeepEqual(expected, maps) {
+		t.Errorf("expected %v but returned %v", expected, maps)
+	}
+
+	maps = buildGeoRoutingMaps(servers, []string{"GeoLite2-City.mmdb", "GeoLite2-Country.mmdb"})
+	if len(maps) != 1 || !strings.HasPrefix(maps[0], "map $geoip2_continent_code ") {
+		t.Errorf("expected the maps to use the country database but returned %v", maps)
+	}
+}
+
 func TestBuildRateLimit(t *testing.T) {
 	invalidType := &ingress.Ingress{}
 	expected := []string{}
@@ -937,8 +1341,10 @@ func TestGetIngressInformation(t *testing.T) {
 						},
 					},
 					Spec: networking.IngressSpec{
-						Backend: &networking.IngressBackend{
-							ServiceName: "a-svc",
+						DefaultBackend: &networking.IngressBackend{
+							Service: &networking.IngressServiceBackend{
+								Name: "a-svc",
+							},
 						},
 					},
 				},
@@ -974,8 +1380,12 @@ func TestGetIngressInformation(t *testing.T) {
 											{
 												Path: "/ok",
 												Backend: networking.IngressBackend{
-													ServiceName: "b-svc",
-													ServicePort: intstr.FromInt(80),
+													Service: &networking.IngressServiceBackend{
+														Name: "b-svc",
+														Port: networking.ServiceBackendPort{
+															Number: 80,
+														},
+													},
 												},
 											},
 										},
@@ -1348,6 +1758,31 @@ opentracing_propagate_context;`
 	}
 }
 
+func TestOpentracingSpanSettingsForLocation(t *testing.T) {
+	il := &ingress.Location{
+		Opentracing: opentracing.Config{
+			Set:           true,
+			Enabled:       true,
+			OperationName: "orders $request_method",
+			Tags: map[string]string{
+				"team":      "checkout",
+				"namespace": "$namespace",
+			},
+		},
+	}
+
+	expected := `opentracing on;
+opentracing_propagate_context;
+opentracing_operation_name "orders $request_method";
+opentracing_tag namespace "$namespace";
+opentracing_tag team "checkout";`
+
+	actual := buildOpentracingForLocation(false, il)
+	if expected != actual {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
 func TestShouldLoadOpentracingModule(t *testing.T) {
 	// ### Invalid argument type tests ###
 	// The first tests should return false.
@@ -1401,6 +1836,66 @@ func TestShouldLoadOpentracingModule(t *testing.T) {
 	}
 }
 
+func TestBuildOpentelemetry(t *testing.T) {
+	servers := []*ingress.Server{
+		{
+			Locations: []*ingress.Location{
+				{
+					Opentelemetry: opentelemetry.Config{Set: true, Enabled: true},
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		cfg      config.Configuration
+		servers  []*ingress.Server
+		expected string
+	}{
+		{"disabled", config.Configuration{}, []*ingress.Server{}, ""},
+		{"enabled", config.Configuration{EnableOpentelemetry: true, OpentelemetryOperationName: "$request_method $host"}, []*ingress.Server{},
+			"opentelemetry_config /etc/nginx/opentelemetry.toml;\nopentelemetry_operation_name \"$request_method $host\";\n"},
+		{"enabled in a location", config.Configuration{}, servers,
+			"opentelemetry_config /etc/nginx/opentelemetry.toml;\nopentelemetry off;\n"},
+	}
+
+	for _, tc := range testCases {
+		actual := buildOpentelemetry(tc.cfg, tc.servers)
+		if tc.expected != actual {
+			t.Errorf("%v: expected '%v' but returned '%v'", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestBuildOpentelemetryForLocation(t *testing.T) {
+	testCases := []struct {
+		name      string
+		isEnabled bool
+		isTrusted bool
+		config    opentelemetry.Config
+		expected  string
+	}{
+		{"disabled", false, true, opentelemetry.Config{}, ""},
+		{"enabled", true, true, opentelemetry.Config{},
+			"opentelemetry on;\nopentelemetry_propagate;\nopentelemetry_trust_incoming_spans on;"},
+		{"disabled in the location", true, true, opentelemetry.Config{Set: true}, "opentelemetry off;"},
+		{"enabled in the location", false, true, opentelemetry.Config{Set: true, Enabled: true, OperationName: "orders"},
+			"opentelemetry on;\nopentelemetry_propagate;\nopentelemetry_trust_incoming_spans on;\nopentelemetry_operation_name \"orders\";"},
+		{"incoming spans not trusted in the location", true, true, opentelemetry.Config{TrustSet: true},
+			"opentelemetry on;\nopentelemetry_propagate;\nopentelemetry_trust_incoming_spans off;"},
+		{"incoming spans trusted in the location", true, false, opentelemetry.Config{TrustSet: true, TrustEnabled: true},
+			"opentelemetry on;\nopentelemetry_propagate;\nopentelemetry_trust_incoming_spans on;"},
+	}
+
+	for _, tc := range testCases {
+		actual := buildOpentelemetryForLocation(tc.isEnabled, tc.isTrusted, &ingress.Location{Opentelemetry: tc.config})
+		if tc.expected != actual {
+			t.Errorf("%v: expected '%v' but returned '%v'", tc.name, tc.expected, actual)
+		}
+	}
+}
+
 func TestModSecurityForLocation(t *testing.T) {
 	loadModule := `modsecurity on;
 `
@@ -1471,53 +1966,184 @@ func TestModSecurityForLocation(t *testing.T) {
 			t.Errorf("%v: expected '%v' but returned '%v'", testCase.description, testCase.expected, actual)
 		}
 	}
+
+	il := &ingress.Location{
+		ModSecurity: modsecurity.Config{
+			Enable:      true,
+			EnableSet:   true,
+			OWASPRules:  true,
+			RemoveRules: []string{"942100", "920350"},
+		},
+	}
+	removeRules := `modsecurity_rules '
+SecRuleRemoveById 942100 920350
+';
+`
+	expected := fmt.Sprintf("%v%v%v%v", loadModule, modSecCfg, owaspRules, removeRules)
+	actual := buildModSecurityForLocation(config.Configuration{}, il)
+	if expected != actual {
+		t.Errorf("expected the rules to be removed after being loaded '%v' but returned '%v'", expected, actual)
+	}
 }
 
-func TestBuildServerName(t *testing.T) {
+func TestBuildRequestIDForLocation(t *testing.T) {
+	trust := `if ($http_x_request_id) {
+    set $req_id $http_x_request_id;
+}`
+	prefix := `if ($http_x_request_id) {
+    set $req_id "edge.$http_x_request_id";
+}`
 
 	testCases := []struct {
-		title    string
-		hostname string
-		expected string
+		description string
+		cfgPolicy   string
+		cfgPrefix   string
+		locPolicy   string
+		locPrefix   string
+		expected    string
 	}{
-		{"simple domain", "foo.bar", "foo.bar"},
-		{"simple www domain", "www.foo.bar", "www.foo.bar"},
-		{"wildcard domain", "*.foo.bar", "~^(?<subdomain>[\\w-]+)\\.foo\\.bar$"},
-		{"wildcard two levels domain", "*.sub.foo.bar", "~^(?<subdomain>[\\w-]+)\\.sub\\.foo\\.bar$"},
+		{"no policy in the location", "trust", "client-", "", "", ""},
+		{"same policy as the configmap", "regenerate", "client-", "regenerate", "client-", ""},
+		{"same prefix as the configmap", "prefix", "client-", "prefix", "client-", ""},
+		{"regenerate in the location", "trust", "client-", "regenerate", "client-", "set $req_id $request_id;"},
+		{"trust in the location", "regenerate", "client-", "trust", "client-", trust},
+		{"prefix in the location", "trust", "client-", "prefix", "edge.", prefix},
+		{"other prefix in the location", "prefix", "client-", "prefix", "edge.", prefix},
 	}
 
 	for _, testCase := range testCases {
-		result := buildServerName(testCase.hostname)
-		if result != testCase.expected {
-			t.Errorf("%v: expected '%v' but returned '%v'", testCase.title, testCase.expected, result)
+		il := &ingress.Location{
+			RequestID: requestid.Config{
+				Policy: testCase.locPolicy,
+				Prefix: testCase.locPrefix,
+			},
+		}
+
+		cfg := config.Configuration{}
+		cfg.RequestIDPolicy = testCase.cfgPolicy
+		cfg.RequestIDPrefix = testCase.cfgPrefix
+
+		actual := buildRequestIDForLocation(cfg, il)
+		if testCase.expected != actual {
+			t.Errorf("%v: expected '%v' but returned '%v'", testCase.description, testCase.expected, actual)
 		}
 	}
 }
 
-func TestParseComplexNginxVarIntoLuaTable(t *testing.T) {
-	testCases := []struct {
-		ngxVar           string
-		expectedLuaTable string
-	}{
-		{"foo", `{ { nil, nil, nil, "foo", }, }`},
-		{"$foo", `{ { nil, nil, "foo", nil, }, }`},
-		{"${foo}", `{ { nil, "foo", nil, nil, }, }`},
-		{"\\$foo", `{ { "\$foo", nil, nil, nil, }, }`},
+func TestBuildMirrorLocations(t *testing.T) {
+	locs := []*ingress.Location{
 		{
-			"foo\\$bar$baz${daz}xiyar$pomidor",
-			`{ { nil, nil, nil, "foo", }, { "\$bar", nil, nil, nil, }, { nil, nil, "baz", nil, }, ` +
-				`{ nil, "daz", nil, nil, }, { nil, nil, nil, "xiyar", }, { nil, nil, "pomidor", nil, }, }`,
+			Mirror: mirror.Config{
+				Source: "/_mirror-uid",
+				Target: "https://test.env.com$request_uri",
+				Targets: []mirror.Target{
+					{Source: "/_mirror-uid-1", Target: "https://staging.env.com$request_uri", Percentage: 100},
+					{Source: "/_mirror-uid-2", Target: "https://load-test.env.com$request_uri", Percentage: 10},
+				},
+			},
+		},
+		{
+			Mirror: mirror.Config{
+				Source: "/_mirror-uid",
+				Target: "https://test.env.com$request_uri",
+			},
 		},
+		{},
 	}
 
-	for _, testCase := range testCases {
-		actualLuaTable := parseComplexNginxVarIntoLuaTable(testCase.ngxVar)
-		if actualLuaTable != testCase.expectedLuaTable {
+	expected := `location = /_mirror-uid-1 {
+internal;
+proxy_pass https://staging.env.com$request_uri;
+}
+
+location = /_mirror-uid-2 {
+internal;
+rewrite_by_lua_block {
+    if math.random(100) > 10 then
+        return ngx.exit(ngx.HTTP_NO_CONTENT)
+    end
+}
+proxy_pass https://load-test.env.com$request_uri;
+}
+
+location = /_mirror-uid {
+internal;
+proxy_pass https://test.env.com$request_uri;
+}
+
+`
+
+	actual := buildMirrorLocations(locs)
+	if expected != actual {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildServerName(t *testing.T) {
+
+	testCases := []struct {
+		title    string
+		hostname string
+		expected string
+	}{
+		{"simple domain", "foo.bar", "foo.bar"},
+		{"simple www domain", "www.foo.bar", "www.foo.bar"},
+		{"wildcard domain", "*.foo.bar", "~^(?<subdomain>[\\w-]+)\\.foo\\.bar$"},
+		{"wildcard two levels domain", "*.sub.foo.bar", "~^(?<subdomain>[\\w-]+)\\.sub\\.foo\\.bar$"},
+	}
+
+	for _, testCase := range testCases {
+		result := buildServerName(testCase.hostname)
+		if result != testCase.expected {
+			t.Errorf("%v: expected '%v' but returned '%v'", testCase.title, testCase.expected, result)
+		}
+	}
+}
+
+func TestParseComplexNginxVarIntoLuaTable(t *testing.T) {
+	testCases := []struct {
+		ngxVar           string
+		expectedLuaTable string
+	}{
+		{"foo", `{ { nil, nil, nil, "foo", }, }`},
+		{"$foo", `{ { nil, nil, "foo", nil, }, }`},
+		{"${foo}", `{ { nil, "foo", nil, nil, }, }`},
+		{"\\$foo", `{ { "\$foo", nil, nil, nil, }, }`},
+		{
+			"foo\\$bar$baz${daz}xiyar$pomidor",
+			`{ { nil, nil, nil, "foo", }, { "\$bar", nil, nil, nil, }, { nil, nil, "baz", nil, }, ` +
+				`{ nil, "daz", nil, nil, }, { nil, nil, nil, "xiyar", }, { nil, nil, "pomidor", nil, }, }`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		actualLuaTable := parseComplexNginxVarIntoLuaTable(testCase.ngxVar)
+		if actualLuaTable != testCase.expectedLuaTable {
 			t.Errorf("expected %v but returned %v", testCase.expectedLuaTable, actualLuaTable)
 		}
 	}
 }
 
+func TestQuoteLuaString(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"", `""`},
+		{"<h1>Maintenance</h1>", `"<h1>Maintenance</h1>"`},
+		{`say "hi" \o/`, `"say \"hi\" \\o/"`},
+		{"line\nbreak }", `"line\010break }"`},
+		{"caf\u00e9", `"caf\195\169"`},
+	}
+
+	for _, testCase := range testCases {
+		actual := quoteLuaString(testCase.input)
+		if actual != testCase.expected {
+			t.Errorf("expected %v but returned %v", testCase.expected, actual)
+		}
+	}
+}
+
 func TestConvertGoSliceIntoLuaTablet(t *testing.T) {
 	testCases := []struct {
 		title            string
@@ -1576,3 +2202,759 @@ func TestConvertGoSliceIntoLuaTablet(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildGlobalRateLimitBuckets(t *testing.T) {
+	if actual := buildGlobalRateLimitBuckets(nil); actual != "{}" {
+		t.Errorf("expected an empty Lua table but returned '%v'", actual)
+	}
+
+	buckets := []globalratelimit.Config{
+		{Name: "login", Namespace: "abc", Limit: 10, WindowSize: 60, Paths: []string{"/login"}},
+		{Name: "api", Namespace: "def", Limit: 100, WindowSize: 1, Paths: []string{"/api", "/api/v2"}},
+	}
+	expected := `{ { name = "login", namespace = "abc", limit = 10, window_size = 60, paths = { "/login", } }, ` +
+		`{ name = "api", namespace = "def", limit = 100, window_size = 1, paths = { "/api", "/api/v2", } } }`
+	if actual := buildGlobalRateLimitBuckets(buckets); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildGlobalRateLimitIgnoredHeaders(t *testing.T) {
+	if actual := buildGlobalRateLimitIgnoredHeaders(nil); actual != "{}" {
+		t.Errorf("expected an empty Lua table but returned '%v'", actual)
+	}
+
+	headers := []globalratelimit.IgnoredHeader{
+		{Name: "x-partner-token", Value: "s3cr3t"},
+		{Name: "x-health-check", Value: `"quoted"`},
+	}
+	expected := `{ { variable = "http_x_partner_token", value = "s3cr3t" }, ` +
+		`{ variable = "http_x_health_check", value = "\"quoted\"" } }`
+	if actual := buildGlobalRateLimitIgnoredHeaders(headers); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildAuthJWTForLua(t *testing.T) {
+	if actual := buildAuthJWTForLua(authjwt.Config{}); actual != "{}" {
+		t.Errorf("expected an empty Lua table but returned '%v'", actual)
+	}
+
+	config := authjwt.Config{
+		JWKSURL:        "https://example.com/.well-known/jwks.json",
+		Issuer:         "https://example.com/",
+		Audiences:      []string{"orders", "payments"},
+		RequiredClaims: []authjwt.Claim{{Name: "email_verified", Value: "true"}, {Name: "sub"}},
+		ClaimHeaders:   []authjwt.ClaimHeader{{Header: "X-User-ID", Claim: "sub"}},
+	}
+	expected := `{ jwks_url = "https://example.com/.well-known/jwks.json", issuer = "https://example.com/", ` +
+		`audiences = { "orders", "payments", }, ` +
+		`required_claims = { { name = "email_verified", value = "true" }, { name = "sub", value = "" } }, ` +
+		`claim_headers = { { header = "X-User-ID", claim = "sub" } } }`
+	if actual := buildAuthJWTForLua(config); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildRateLimitExemptionForLua(t *testing.T) {
+	if actual := buildRateLimitExemptionForLua(ratelimitexemption.Config{}); actual != "nil" {
+		t.Errorf("expected nil but returned '%v'", actual)
+	}
+
+	config := ratelimitexemption.Config{
+		ClientCertCNs: []string{"batch-job", "Monitoring Agent"},
+		JWTIssuer:     "https://partner.example.com",
+	}
+	expected := `{ client_cert_cns = { "batch-job", "Monitoring Agent" }, jwt_issuer = "https://partner.example.com" }`
+	if actual := buildRateLimitExemptionForLua(config); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildRouteIfForLua(t *testing.T) {
+	predicate, err := routeif.Compile(`header('X-Env') == "q\"a" && !(cookie('beta') != '1')`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actual := buildRouteIfForLua(routeif.Config{Predicate: predicate}); actual != "nil" {
+		t.Errorf("expected nil without backend but returned '%v'", actual)
+	}
+
+	expected := `{ backend = "route-if-default-qa", predicate = { op = "and", operands = { ` +
+		`{ op = "eq", variable = "http_x_env", value = "q\"a" }, ` +
+		`{ op = "not", operands = { { op = "ne", variable = "cookie_beta", value = "1" } } } } } }`
+	if actual := buildRouteIfForLua(routeif.Config{Predicate: predicate, Backend: "route-if-default-qa"}); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildLogFormatJSON(t *testing.T) {
+	fields := []accesslogfields.Field{
+		{Name: "status", Value: "$status", Type: accesslogfields.TypeNumber},
+		{Name: "uri", Value: "$request_uri", Type: accesslogfields.TypeString},
+	}
+
+	expected := `{"status":$status,"uri":"$request_uri"}`
+	if actual := buildLogFormatJSON(fields); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestAnonymizeLogFormat(t *testing.T) {
+	format := `$remote_addr - ${realip_remote_addr} "$http_x_forwarded_for" $remote_addr_anonymized $remote_user $proxy_protocol_addr_x`
+
+	cfg := config.NewDefault()
+	if actual := anonymizeLogFormat(cfg, format); actual != format {
+		t.Errorf("expected the log format to be unchanged but returned '%v'", actual)
+	}
+
+	cfg.AnonymizeClientIPInLogs = true
+	expected := `$remote_addr_anonymized - $remote_addr_anonymized "$remote_addr_anonymized" $remote_addr_anonymized $remote_user $proxy_protocol_addr_x`
+	if actual := anonymizeLogFormat(cfg, format); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildAccessLogs(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.LogFormatJSON = []accesslogfields.Field{
+		{Name: "uri", Value: "$request_uri", Type: accesslogfields.TypeString},
+	}
+
+	tenant := &ingress.Location{
+		Path: "/",
+		AccessLogFields: accesslogfields.Config{
+			Fields: []accesslogfields.Field{{Name: "tenant", Value: "$http_x_tenant", Type: accesslogfields.TypeString}},
+		},
+	}
+	servers := []*ingress.Server{
+		{Hostname: "foo.bar", Locations: []*ingress.Location{{Path: "/"}, tenant}},
+		{Hostname: "bar.baz", Locations: []*ingress.Location{tenant}},
+	}
+
+	formats := buildAccessLogFormats(cfg, servers)
+	if len(formats) != 1 {
+		t.Fatalf("expected one log format but returned %v", formats)
+	}
+
+	var name string
+	for n, format := range formats {
+		name = n
+		expected := `{"tenant":"$http_x_tenant","uri":"$request_uri"}`
+		if format != expected {
+			t.Errorf("expected '%v' but returned '%v'", expected, format)
+		}
+	}
+
+	expected := fmt.Sprintf("access_log /var/log/nginx/access.log %v  if=$loggable;", name)
+	if actual := buildLocationAccessLog(cfg, tenant); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	if actual := buildLocationAccessLog(cfg, &ingress.Location{Path: "/"}); actual != "" {
+		t.Errorf("expected no access_log but returned '%v'", actual)
+	}
+
+	cfg.DisableAccessLog = true
+	if actual := buildLocationAccessLog(cfg, tenant); actual != "" {
+		t.Errorf("expected no access_log but returned '%v'", actual)
+	}
+}
+
+func TestBuildStaticFiles(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.StaticFiles = []staticfiles.File{
+		{Path: "/.well-known/security.txt", Content: "Contact: mailto:security@example.com", ContentType: staticfiles.DefaultContentType},
+		{Path: "/robots.txt", Content: "User-agent: *\nDisallow: /", ContentType: staticfiles.DefaultContentType},
+	}
+
+	exact := networking.PathTypeExact
+	server := &ingress.Server{
+		Hostname: "foo.bar",
+		Locations: []*ingress.Location{
+			{Path: "/"},
+			{Path: "/.well-known/security.txt", PathType: &exact},
+		},
+		StaticFiles: staticfiles.Config{
+			Files: []staticfiles.File{{Path: "/robots.txt", Content: "User-agent: *\nAllow: /", ContentType: staticfiles.DefaultContentType}},
+		},
+	}
+
+	expected := []staticfiles.File{
+		{Path: "/robots.txt", Content: "User-agent: *\nAllow: /", ContentType: staticfiles.DefaultContentType},
+	}
+	if actual := buildStaticFiles(cfg, server); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	if actual := buildStaticFiles(config.NewDefault(), &ingress.Server{Hostname: "foo.bar"}); len(actual) != 0 {
+		t.Errorf("expected no static files but returned '%v'", actual)
+	}
+}
+
+func TestBuildStaticFileContent(t *testing.T) {
+	content := "User-agent: *\nDisallow: /*.pdf$\n# \"quoted\" \\ text"
+	expected := `"User-agent: *\nDisallow: /*.pdf${literal_dollar}\n# \"quoted\" \\ text"`
+	if actual := buildStaticFileContent(content); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildSnippetFragments(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.SnippetFragments = map[string]string{
+		"cors":     "add_header Access-Control-Allow-Origin *;",
+		"no-cache": "expires -1;",
+	}
+
+	location := &ingress.Location{Path: "/", SnippetFragments: []string{"no-cache", "unknown", "cors"}}
+	expected := []string{"/etc/nginx/fragments/no-cache.conf", "/etc/nginx/fragments/cors.conf"}
+	if actual := buildSnippetFragments(cfg, "/etc/nginx/fragments", location); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	if actual := buildSnippetFragments(cfg, "/etc/nginx/fragments", &ingress.Location{Path: "/"}); len(actual) != 0 {
+		t.Errorf("expected no include files but returned '%v'", actual)
+	}
+}
+
+func TestBuildLuaPlugins(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.Plugins = []string{"hello_world"}
+
+	servers := []*ingress.Server{{Locations: []*ingress.Location{{Path: "/"}}}}
+	if actual := buildLuaPlugins(cfg, servers); actual != `"hello_world"` {
+		t.Errorf("expected '%v' but returned '%v'", `"hello_world"`, actual)
+	}
+
+	servers[0].Locations = append(servers[0].Locations, &ingress.Location{Path: "/api", BodyFilterSnippet: `body = ""`})
+	expected := `"hello_world", "body_filter"`
+	if actual := buildLuaPlugins(cfg, servers); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	cfg.Plugins = []string{"body_filter", "hello_world"}
+	expected = `"body_filter", "hello_world"`
+	if actual := buildLuaPlugins(cfg, servers); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	servers[0].Locations = append(servers[0].Locations, &ingress.Location{Path: "/charges", Idempotency: idempotency.Config{Enabled: true}})
+	expected = `"body_filter", "hello_world", "idempotency"`
+	if actual := buildLuaPlugins(cfg, servers); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildIdempotency(t *testing.T) {
+	location := &ingress.Location{Path: "/", Idempotency: idempotency.Config{Enabled: true, Header: "X-Request-Key", TTL: 600}}
+	expected := "set $idempotency_key $http_x_request_key;\n            set $idempotency_ttl 600;"
+	if actual := buildIdempotency(location); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	if actual := buildIdempotency(&ingress.Location{Path: "/"}); actual != "" {
+		t.Errorf("expected no variable but returned '%v'", actual)
+	}
+}
+
+func TestBuildBodyFilterSnippet(t *testing.T) {
+	location := &ingress.Location{Path: "/", BodyFilterSnippet: `body = string.gsub(body, "\"secret\"", "null")`}
+	expected := fmt.Sprintf(`set $body_filter_snippet "%v";`, bodyfiltersnippet.Checksum(location.BodyFilterSnippet))
+	if actual := buildBodyFilterSnippet(location); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	if actual := buildBodyFilterSnippet(&ingress.Location{Path: "/"}); actual != "" {
+		t.Errorf("expected no variable but returned '%v'", actual)
+	}
+}
+
+func TestBuildTrailingSlashRedirect(t *testing.T) {
+	cfg := config.NewDefault()
+	if actual := buildTrailingSlashRedirect(cfg, &ingress.Location{Path: "/"}); actual != "" {
+		t.Errorf("expected no redirection but returned '%v'", actual)
+	}
+
+	redirectRegex := regexp.MustCompile(`~ "(.+)"\) {\s+return (\d+) (.+);`)
+
+	tests := []struct {
+		policy   string
+		code     int
+		uri      string
+		expected string
+	}{
+		{trailingslash.PolicyAdd, 0, "/foo", "308 /foo/"},
+		{trailingslash.PolicyAdd, 301, "/foo?a=1&b=%2F", "301 /foo/?a=1&b=%2F"},
+		{trailingslash.PolicyAdd, 0, "/v1.0/foo%20bar", "308 /v1.0/foo%20bar/"},
+		{trailingslash.PolicyAdd, 0, "/foo/", ""},
+		{trailingslash.PolicyAdd, 0, "/", ""},
+		{trailingslash.PolicyAdd, 0, "/static/app.js?v=1", ""},
+		{trailingslash.PolicyRemove, 0, "/foo/", "308 /foo"},
+		{trailingslash.PolicyRemove, 0, "/foo//?a=/", "308 /foo?a=/"},
+		{trailingslash.PolicyRemove, 0, "/foo?a=/", ""},
+		{trailingslash.PolicyRemove, 0, "/", ""},
+	}
+
+	for _, test := range tests {
+		location := &ingress.Location{Path: "/", TrailingSlash: trailingslash.Config{Policy: test.policy, Code: test.code}}
+		directive := redirectRegex.FindStringSubmatch(buildTrailingSlashRedirect(cfg, location))
+		if directive == nil {
+			t.Fatalf("%v: unexpected redirection '%v'", test.policy, buildTrailingSlashRedirect(cfg, location))
+		}
+
+		actual := ""
+		if match := regexp.MustCompile(directive[1]).FindStringSubmatchIndex(test.uri); match != nil {
+			target := string(regexp.MustCompile(directive[1]).ExpandString(nil, directive[3], test.uri, match))
+			actual = directive[2] + " " + target
+		}
+		if actual != test.expected {
+			t.Errorf("%v %v: expected '%v' but returned '%v'", test.policy, test.uri, test.expected, actual)
+		}
+	}
+}
+
+func TestBuildErrorResponseCodes(t *testing.T) {
+	expected := "400 401 403 404 405 408 413 414 429 500 502 503 504"
+	if actual := buildErrorResponseCodes(nil); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	expected = "400 401 403 405 408 413 414 429 500 502 504"
+	if actual := buildErrorResponseCodes([]int{404, 503, 418}); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestShouldConfigureProxyCache(t *testing.T) {
+	if shouldConfigureProxyCache("invalid") {
+		t.Errorf("expected false for an invalid type")
+	}
+
+	servers := []*ingress.Server{
+		{
+			Hostname:  "foo.bar",
+			Locations: []*ingress.Location{{Path: "/"}},
+		},
+	}
+
+	if shouldConfigureProxyCache(servers) {
+		t.Errorf("expected false when no location enables the proxy cache")
+	}
+
+	servers[0].Locations = append(servers[0].Locations, &ingress.Location{
+		Path:       "/static",
+		ProxyCache: proxycache.Config{Enabled: true},
+	})
+
+	if !shouldConfigureProxyCache(servers) {
+		t.Errorf("expected true when a location enables the proxy cache")
+	}
+}
+
+func TestBuildStaleCacheControl(t *testing.T) {
+	if buildStaleCacheControl("invalid") != "" {
+		t.Errorf("expected an empty string for an invalid type")
+	}
+
+	testCases := []struct {
+		config   proxycache.Config
+		expected string
+	}{
+		{proxycache.Config{Enabled: true}, ""},
+		{proxycache.Config{Enabled: true, StaleWhileRevalidate: 30}, "stale-while-revalidate=30"},
+		{proxycache.Config{Enabled: true, StaleIfError: 300}, "stale-if-error=300"},
+		{proxycache.Config{Enabled: true, StaleWhileRevalidate: 30, StaleIfError: 300}, "stale-while-revalidate=30, stale-if-error=300"},
+	}
+
+	for _, tc := range testCases {
+		if cacheControl := buildStaleCacheControl(tc.config); cacheControl != tc.expected {
+			t.Errorf("expected %q but returned %q", tc.expected, cacheControl)
+		}
+	}
+}
+
+func TestBuildUpstreamAlias(t *testing.T) {
+	if buildUpstreamAlias("invalid", config.UpstreamAliasModeUpstream) != "" {
+		t.Errorf("expected empty string for an invalid location type")
+	}
+
+	svc := &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "checkout",
+			Namespace: "shop",
+		},
+		Spec: apiv1.ServiceSpec{
+			Ports: []apiv1.ServicePort{
+				{Name: "http", Port: 8080},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		location *ingress.Location
+		mode     string
+		expected string
+	}{
+		{
+			"upstream mode uses the upstream name",
+			&ingress.Location{Backend: "shop-checkout-http", Service: svc, Port: intstr.FromString("http")},
+			config.UpstreamAliasModeUpstream,
+			"shop-checkout-http",
+		},
+		{
+			"service mode resolves a named port",
+			&ingress.Location{Backend: "shop-checkout-http", Service: svc, Port: intstr.FromString("http")},
+			config.UpstreamAliasModeService,
+			"shop/checkout:8080",
+		},
+		{
+			"service mode with a port number",
+			&ingress.Location{Backend: "shop-checkout-8080", Service: svc, Port: intstr.FromInt(8080)},
+			config.UpstreamAliasModeService,
+			"shop/checkout:8080",
+		},
+		{
+			"service mode without a service",
+			&ingress.Location{Backend: "upstream-default-backend"},
+			config.UpstreamAliasModeService,
+			"upstream-default-backend",
+		},
+		{
+			"annotation overrides the mode",
+			&ingress.Location{Backend: "shop-checkout-http", Service: svc, Port: intstr.FromString("http"), BackendAlias: "checkout-api"},
+			config.UpstreamAliasModeService,
+			"checkout-api",
+		},
+	}
+
+	for _, tc := range testCases {
+		alias := buildUpstreamAlias(tc.location, tc.mode)
+		if alias != tc.expected {
+			t.Errorf("%s: expected '%v' but returned '%v'", tc.name, tc.expected, alias)
+		}
+	}
+}
+
+func TestBuildGRPCHTTP1Fallback(t *testing.T) {
+	if buildGRPCHTTP1Fallback("invalid") != "" {
+		t.Errorf("expected empty string for an invalid location type")
+	}
+
+	testCases := []struct {
+		protocol string
+		fallback bool
+		expected string
+	}{
+		{"GRPC", false, ""},
+		{"HTTP", true, ""},
+		{"GRPC", true, `if ($http_content_type !~* "^application/grpc") {
+    proxy_pass http://upstream_balancer;
+}`},
+		{"GRPCS", true, `if ($http_content_type !~* "^application/grpc") {
+    proxy_pass https://upstream_balancer;
+}`},
+	}
+
+	for _, tc := range testCases {
+		loc := &ingress.Location{BackendProtocol: tc.protocol, GRPCHTTP1Fallback: tc.fallback}
+		actual := buildGRPCHTTP1Fallback(loc)
+		if actual != tc.expected {
+			t.Errorf("%v (fallback %v): expected '%v' but returned '%v'", tc.protocol, tc.fallback, tc.expected, actual)
+		}
+	}
+}
+
+func TestFilterUpstreamKeepalives(t *testing.T) {
+	cfg := config.NewDefault()
+
+	if len(filterUpstreamKeepalives(cfg, "invalid")) != 0 {
+		t.Errorf("expected no upstream for an invalid servers type")
+	}
+
+	servers := []*ingress.Server{
+		{
+			Hostname: "foo.bar",
+			Locations: []*ingress.Location{
+				{Path: "/"},
+				{Path: "/api", UpstreamKeepalive: upstreamkeepalive.Config{Connections: 1000, Timeout: 30}},
+			},
+		},
+		{
+			Hostname: "bar.foo",
+			Locations: []*ingress.Location{
+				{Path: "/", UpstreamKeepalive: upstreamkeepalive.Config{Connections: 1000, Timeout: 30}},
+				{Path: "/static", UpstreamKeepalive: upstreamkeepalive.Config{Requests: 100}},
+			},
+		},
+		{
+			Hostname: "grpc.foo",
+			Locations: []*ingress.Location{
+				{Path: "/", BackendProtocol: "GRPC", UpstreamKeepalive: upstreamkeepalive.Config{Requests: 100}},
+				{Path: "/api", BackendProtocol: "GRPCS", GRPCHTTP1Fallback: true, UpstreamKeepalive: upstreamkeepalive.Config{Connections: 10}},
+			},
+		},
+	}
+
+	cfg.UpstreamKeepaliveGRPCConnections = 64
+	cfg.UpstreamKeepaliveGRPCTimeout = 300
+
+	expected := []upstreamKeepalive{
+		{Name: "upstream_balancer_grpc_keepalive_0_100_0", Connections: 64, Requests: 100, Timeout: 300},
+		{Name: "upstream_balancer_grpc_keepalive_10_0_0", Connections: 10, Requests: 10000, Timeout: 300},
+		{Name: "upstream_balancer_keepalive_0_100_0", Connections: 320, Requests: 100, Timeout: 60},
+		{Name: "upstream_balancer_keepalive_1000_0_30", Connections: 1000, Requests: 10000, Timeout: 30},
+		{Name: "upstream_balancer_keepalive_10_0_0", Connections: 10, Requests: 10000, Timeout: 60},
+	}
+
+	actual := filterUpstreamKeepalives(cfg, servers)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %+v but returned %+v", expected, actual)
+	}
+
+	expectedProxyPass := "proxy_pass http://upstream_balancer_keepalive_1000_0_30;"
+	if actual := buildProxyPass("foo.bar", []*ingress.Backend{}, servers[0].Locations[1]); actual != expectedProxyPass {
+		t.Errorf("expected '%v' but returned '%v'", expectedProxyPass, actual)
+	}
+
+	// only the locations with a keepalive pool keep the connections alive
+	cfg.UpstreamKeepaliveConnections = 0
+	connectionUpgrades := map[*ingress.Location]string{
+		servers[0].Locations[0]: "$connection_upgrade",
+		servers[0].Locations[1]: "$connection_upgrade_keepalive",
+		servers[1].Locations[1]: "$connection_upgrade",
+	}
+	for location, expected := range connectionUpgrades {
+		if actual := buildConnectionUpgrade(cfg, location); actual != expected {
+			t.Errorf("expected '%v' for the location %v but returned '%v'", expected, location.Path, actual)
+		}
+	}
+
+	expectedProxyPass = "grpc_pass grpcs://upstream_balancer_grpc_keepalive_10_0_0;"
+	if actual := buildProxyPass("grpc.foo", []*ingress.Backend{}, servers[2].Locations[1]); actual != expectedProxyPass {
+		t.Errorf("expected '%v' but returned '%v'", expectedProxyPass, actual)
+	}
+
+	expectedFallback := `if ($http_content_type !~* "^application/grpc") {
+    proxy_pass https://upstream_balancer_keepalive_10_0_0;
+}`
+	if actual := buildGRPCHTTP1Fallback(servers[2].Locations[1]); actual != expectedFallback {
+		t.Errorf("expected '%v' but returned '%v'", expectedFallback, actual)
+	}
+}
+
+func TestBuildProxyPassGRPCUpstream(t *testing.T) {
+	testCases := []struct {
+		title    string
+		location *ingress.Location
+		expected string
+	}{
+		{"HTTP", &ingress.Location{Path: "/", Backend: "app"}, "proxy_pass http://upstream_balancer;"},
+		{"GRPC", &ingress.Location{Path: "/", Backend: "app", BackendProtocol: "GRPC"}, "grpc_pass grpc://upstream_balancer_grpc;"},
+		{"GRPCS", &ingress.Location{Path: "/", Backend: "app", BackendProtocol: "GRPCS"}, "grpc_pass grpcs://upstream_balancer_grpc;"},
+		{"default backend", &ingress.Location{Path: "/", Backend: "upstream-default-backend", BackendProtocol: "GRPC"}, "proxy_pass http://upstream_balancer;"},
+	}
+
+	for _, tc := range testCases {
+		if actual := buildProxyPass("foo.bar", []*ingress.Backend{}, tc.location); actual != tc.expected {
+			t.Errorf("%v: expected '%v' but returned '%v'", tc.title, tc.expected, actual)
+		}
+	}
+}
+
+func TestBuildHTTPListenerAddressFamily(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.BindAddressIpv4 = []string{}
+	cfg.BindAddressIpv6 = []string{}
+
+	ports := &config.ListenPorts{HTTP: 80, HTTPS: 443}
+
+	testCases := []struct {
+		name          string
+		ipv6Enabled   bool
+		ipv6Only      bool
+		expectedHTTP  string
+		expectedHTTPS string
+	}{
+		{"ipv4", false, false, "listen 80  ;", "listen 443  ssl http2 ;"},
+		{"dual-stack", true, false, "listen 80  ;\nlisten [::]:80  ;", "listen 443  ssl http2 ;\nlisten [::]:443  ssl http2 ;"},
+		{"ipv6", true, true, "listen [::]:80  ;", "listen [::]:443  ssl http2 ;"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			templateConfig := config.TemplateConfig{
+				Cfg:           cfg,
+				ListenPorts:   ports,
+				IsIPV6Enabled: tc.ipv6Enabled,
+				IsIPV6Only:    tc.ipv6Only,
+			}
+
+			if actual := buildHTTPListener(templateConfig, "example.com"); actual != tc.expectedHTTP {
+				t.Errorf("expected HTTP listeners '%v' but returned '%v'", tc.expectedHTTP, actual)
+			}
+
+			if actual := buildHTTPSListener(templateConfig, "example.com"); actual != tc.expectedHTTPS {
+				t.Errorf("expected HTTPS listeners '%v' but returned '%v'", tc.expectedHTTPS, actual)
+			}
+		})
+	}
+}
+
+func TestBuildListenerAdditionalPorts(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.BindAddressIpv4 = []string{"10.0.0.1"}
+	cfg.BindAddressIpv6 = []string{}
+	cfg.AdditionalHTTPPorts = []int{8080, 80, 10254}
+	cfg.AdditionalHTTPSPorts = []int{8443, 8080, 10247}
+
+	templateConfig := config.TemplateConfig{
+		Cfg:         cfg,
+		ListenPorts: &config.ListenPorts{HTTP: 80, HTTPS: 443, SSLProxy: 442, HTTP1SSLProxy: 441},
+		StatusPort:  10254,
+		StreamPort:  10247,
+	}
+
+	expected := "listen 10.0.0.1:80  ;\nlisten 10.0.0.1:8080  ;"
+	if actual := buildHTTPListener(templateConfig, "example.com"); actual != expected {
+		t.Errorf("expected HTTP listeners '%v' but returned '%v'", expected, actual)
+	}
+
+	expected = "listen 10.0.0.1:443  ssl http2 ;\nlisten 10.0.0.1:8443  ssl http2 ;"
+	if actual := buildHTTPSListener(templateConfig, "example.com"); actual != expected {
+		t.Errorf("expected HTTPS listeners '%v' but returned '%v'", expected, actual)
+	}
+
+	// the additional ports are not served by the SSL passthrough proxy
+	templateConfig.IsSSLPassthroughEnabled = true
+	expected = "listen 10.0.0.1:442 proxy_protocol  ssl http2 ;\nlisten 10.0.0.1:8443  ssl http2 ;"
+	if actual := buildHTTPSListener(templateConfig, "example.com"); actual != expected {
+		t.Errorf("expected HTTPS listeners '%v' but returned '%v'", expected, actual)
+	}
+
+	// nginx enables HTTP/2 for all the servers of the additional ports
+	templateConfig.HTTP2DisabledHosts = []string{"legacy.example.com"}
+	expected = "listen 10.0.0.1:442 proxy_protocol  ssl http2 ;\nlisten 10.0.0.1:8443  ssl ;"
+	if actual := buildHTTPSListener(templateConfig, "example.com"); actual != expected {
+		t.Errorf("expected HTTPS listeners '%v' but returned '%v'", expected, actual)
+	}
+
+	// the additional ports are served by the stream server reading the SNI
+	templateConfig.IsSSLPassthroughEnabled = false
+	templateConfig.IsSSLPrereadEnabled = true
+	expected = "listen 10.0.0.1:441 proxy_protocol  ssl ;"
+	if actual := buildHTTPSListener(templateConfig, "legacy.example.com"); actual != expected {
+		t.Errorf("expected HTTPS listeners '%v' but returned '%v'", expected, actual)
+	}
+
+	if ports := sslPrereadPorts(templateConfig); !reflect.DeepEqual(ports, []int{443, 8443}) {
+		t.Errorf("expected SSL preread ports %v but returned %v", []int{443, 8443}, ports)
+	}
+}
+
+func TestBuildHTTPSListenerSNIConnLimit(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.BindAddressIpv4 = []string{}
+	cfg.LimitConnPerSNI = 100
+
+	templateConfig := config.TemplateConfig{
+		Cfg:                   cfg,
+		ListenPorts:           &config.ListenPorts{HTTPS: 443, SSLProxy: 442},
+		IsSNIConnLimitEnabled: true,
+		IsSSLPrereadEnabled:   true,
+	}
+
+	expected := "listen 442 proxy_protocol  ssl http2 ;"
+	if actual := buildHTTPSListener(templateConfig, "example.com"); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+}
+
+func TestBuildHTTPSListenerHTTP2Disabled(t *testing.T) {
+	cfg := config.NewDefault()
+	cfg.BindAddressIpv4 = []string{}
+
+	templateConfig := config.TemplateConfig{
+		Cfg:                 cfg,
+		ListenPorts:         &config.ListenPorts{HTTPS: 443, SSLProxy: 442, HTTP1SSLProxy: 441},
+		IsSSLPrereadEnabled: true,
+		HTTP2DisabledHosts:  []string{"legacy.example.com"},
+	}
+
+	testCases := map[string]string{
+		"example.com":        "listen 442 proxy_protocol  ssl http2 ;",
+		"legacy.example.com": "listen 441 proxy_protocol  ssl ;",
+	}
+
+	for hostname, expected := range testCases {
+		if actual := buildHTTPSListener(templateConfig, hostname); actual != expected {
+			t.Errorf("%v: expected '%v' but returned '%v'", hostname, expected, actual)
+		}
+	}
+}
+
+func TestBuildSSLECDHCurve(t *testing.T) {
+	tests := []struct {
+		curve    string
+		version  string
+		expected string
+	}{
+		{"auto", "", "auto"},
+		{"X25519:prime256v1", "1.1.1", "X25519:prime256v1"},
+		{"?X25519MLKEM768:X25519:prime256v1", "", "X25519:prime256v1"},
+		{"?X25519MLKEM768:X25519:prime256v1", "3.0.8", "X25519:prime256v1"},
+		{"?X25519MLKEM768:?ffdhe2048:X25519", "3.0.8", "ffdhe2048:X25519"},
+		{"?X25519MLKEM768:X25519:prime256v1", "3.5.0", "?X25519MLKEM768:X25519:prime256v1"},
+		{"?X25519MLKEM768:X25519", "3.10.1", "?X25519MLKEM768:X25519"},
+		{"?unknown:X25519", "3.0.8", "X25519"},
+		{"?X25519MLKEM768", "3.0.8", "auto"},
+	}
+
+	for _, test := range tests {
+		cfg := config.NewDefault()
+		cfg.SSLECDHCurve = test.curve
+
+		if actual := buildSSLECDHCurve(cfg, test.version); actual != test.expected {
+			t.Errorf("%v with OpenSSL '%v': expected '%v' but returned '%v'", test.curve, test.version, test.expected, actual)
+		}
+	}
+
+	if actual := buildSSLECDHCurve(nil, "3.5.0"); actual != "auto" {
+		t.Errorf("expected 'auto' but returned '%v'", actual)
+	}
+}
+
+func TestLuaEdgeContextFields(t *testing.T) {
+	fields := map[string]string{"tls": "ssl_protocol", "country": "geoip2_city_country_code"}
+
+	expected := `{ "country", "geoip2_city_country_code" }, { "tls", "ssl_protocol" }`
+	if actual := luaEdgeContextFields(fields); actual != expected {
+		t.Errorf("expected '%v' but returned '%v'", expected, actual)
+	}
+
+	if actual := luaEdgeContextFields(nil); actual != "" {
+		t.Errorf("expected an empty string but returned '%v'", actual)
+	}
+}
+
+func TestShouldLoadBrotliModule(t *testing.T) {
+	servers := []*ingress.Server{
+		{
+			Locations: []*ingress.Location{
+				{Path: "/"},
+				{Path: "/assets", Precompressed: precompressed.Config{Gzip: true}},
+			},
+		},
+	}
+
+	if shouldLoadBrotliModule(servers) {
+		t.Errorf("expected the brotli modules not to be loaded without brotli-static")
+	}
+
+	servers[0].Locations[1].Precompressed.Brotli = true
+	if !shouldLoadBrotliModule(servers) {
+		t.Errorf("expected the brotli modules to be loaded with brotli-static")
+	}
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/file"
+	"k8s.io/ingress-nginx/internal/ingress"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+)
+
+const (
+	// tenantsDir is the directory of the include files with the servers of each tenant
+	tenantsDir = "/etc/nginx/tenants"
+
+	tempTenantsPattern = "nginx-tenants"
+)
+
+// serverTenant returns the namespace of the ingresses that define the
+// locations of a server or an empty string if the server is shared between
+// namespaces and must be rendered in the main configuration file.
+func serverTenant(server *ingress.Server) string {
+	if server.Hostname == defServerName {
+		return ""
+	}
+
+	tenant := ""
+	for _, location := range server.Locations {
+		if location.Ingress == nil {
+			continue
+		}
+
+		if tenant == "" {
+			tenant = location.Ingress.Namespace
+			continue
+		}
+
+		if tenant != location.Ingress.Namespace {
+			return ""
+		}
+	}
+
+	return tenant
+}
+
+// buildTenants groups the servers by tenant. The include
+// file of each tenant is located in the directory dir.
+func buildTenants(servers []*ingress.Server, dir string) []ngx_config.Tenant {
+	tenants := []ngx_config.Tenant{}
+	index := make(map[string]int)
+
+	for _, server := range servers {
+		namespace := serverTenant(server)
+		if namespace == "" {
+			continue
+		}
+
+		i, ok := index[namespace]
+		if !ok {
+			i = len(tenants)
+			index[namespace] = i
+			tenants = append(tenants, ngx_config.Tenant{
+				Namespace: namespace,
+				Include:   filepath.Join(dir, namespace+".conf"),
+			})
+		}
+
+		tenants[i].Servers = append(tenants[i].Servers, server)
+	}
+
+	sort.SliceStable(tenants, func(i, j int) bool {
+		return tenants[i].Namespace < tenants[j].Namespace
+	})
+
+	return tenants
+}
+
+// writeIncludeFiles writes the include files, by name without the .conf
+// extension, in the directory dir and removes the ones not used anymore.
+func writeIncludeFiles(dir string, files map[string][]byte) error {
+	err := os.MkdirAll(dir, file.ReadWriteByUser)
+	if err != nil {
+		return err
+	}
+
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".conf"), content, file.ReadWriteByUser)
+		if err != nil {
+			return err
+		}
+	}
+
+	existing, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range existing {
+		if _, ok := files[strings.TrimSuffix(filepath.Base(f), ".conf")]; ok {
+			continue
+		}
+
+		err = os.Remove(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tenantFromError returns the tenant with the include file in the directory
+// dir reported by the errors of the command "nginx -t" and the line with
+// the error or empty strings if the error is not caused by a tenant.
+func tenantFromError(err error, dir string) (string, string) {
+	r := regexp.MustCompile(regexp.QuoteMeta(dir+string(filepath.Separator)) + `([a-z0-9]([-a-z0-9]*[a-z0-9])?)\.conf:\d+`)
+
+	for _, line := range strings.Split(err.Error(), "\n") {
+		match := r.FindStringSubmatch(line)
+		if match != nil {
+			return match[1], strings.TrimSpace(line)
+		}
+	}
+
+	return "", ""
+}
+
+// withoutTenant returns a copy of the configuration
+// without the servers of the tenant namespace.
+func withoutTenant(ingressCfg ingress.Configuration, namespace string) ingress.Configuration {
+	servers := make([]*ingress.Server, 0, len(ingressCfg.Servers))
+	for _, server := range ingressCfg.Servers {
+		if serverTenant(server) != namespace {
+			servers = append(servers, server)
+		}
+	}
+
+	ingressCfg.Servers = servers
+	return ingressCfg
+}
+
+// tenantIngresses returns the ingresses that define the servers of the tenant namespace.
+func tenantIngresses(servers []*ingress.Server, namespace string) []*ingress.Ingress {
+	ingresses := []*ingress.Ingress{}
+	seen := sets.NewString()
+
+	for _, server := range servers {
+		if serverTenant(server) != namespace {
+			continue
+		}
+
+		for _, location := range server.Locations {
+			if location.Ingress == nil || seen.Has(location.Ingress.Name) {
+				continue
+			}
+
+			seen.Insert(location.Ingress.Name)
+			ingresses = append(ingresses, location.Ingress)
+		}
+	}
+
+	return ingresses
+}
+
+// testTenantTemplate checks if the NGINX configuration, with the servers of
+// each tenant in a separate include file, is valid using a temporal directory.
+func (n NGINXController) testTenantTemplate(cfg ngx_config.Configuration, ingressCfg ingress.Configuration) (string, error) {
+	dir, err := ioutil.TempDir("", tempTenantsPattern)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	content, tenants, err := n.generateTemplate(cfg, ingressCfg, dir)
+	if err != nil {
+		return "", err
+	}
+
+	err = writeIncludeFiles(dir, tenants)
+	if err != nil {
+		return "", err
+	}
+
+	return dir, n.testTemplate(content)
+}
+
+// quarantineTenants returns the configuration without the servers of the
+// tenants with an invalid configuration. The function quarantine is called
+// with the ingresses of each of these tenants and returns false when the
+// tenant must not be excluded. Returns an error if the configuration is not
+// valid due to servers not isolated in the include file of a tenant.
+func (n NGINXController) quarantineTenants(cfg ngx_config.Configuration, ingressCfg ingress.Configuration,
+	quarantine func(namespace string, ingresses []*ingress.Ingress, reason string) bool) (ingress.Configuration, error) {
+	for {
+		dir, err := n.testTenantTemplate(cfg, ingressCfg)
+		if err == nil {
+			return ingressCfg, nil
+		}
+
+		namespace, reason := tenantFromError(err, dir)
+		if namespace == "" {
+			return ingressCfg, err
+		}
+
+		ingresses := tenantIngresses(ingressCfg.Servers, namespace)
+		if len(ingresses) == 0 || !quarantine(namespace, ingresses, reason) {
+			return ingressCfg, err
+		}
+
+		ingressCfg = withoutTenant(ingressCfg, namespace)
+	}
+}
+
+// recordQuarantine marks the ingresses of a tenant excluded from the NGINX configuration with an Event.
+func (n *NGINXController) recordQuarantine(namespace string, ingresses []*ingress.Ingress, reason string) bool {
+	klog.Warningf("Invalid configuration of namespace %q, excluding its servers from the NGINX configuration: %v", namespace, reason)
+	for _, ing := range ingresses {
+		n.recordIngressEvent(ing, apiv1.EventTypeWarning, "Quarantined",
+			fmt.Sprintf("Servers of namespace %v excluded from the NGINX configuration: %v", namespace, reason))
+	}
+
+	return true
+}
+
+// changedTenants returns the namespaces of the ingresses that define
+// the servers changed between the running and the new configuration.
+func changedTenants(running, pcfg *ingress.Configuration) []string {
+	namespaces := sets.NewString()
+
+	insert := func(server *ingress.Server) {
+		for _, location := range server.Locations {
+			if location.Ingress != nil {
+				namespaces.Insert(location.Ingress.Namespace)
+			}
+		}
+	}
+
+	runningServers := make(map[string]*ingress.Server, len(running.Servers))
+	for _, server := range running.Servers {
+		runningServers[server.Hostname] = server
+	}
+
+	for _, server := range pcfg.Servers {
+		runningServer, ok := runningServers[server.Hostname]
+		delete(runningServers, server.Hostname)
+
+		if ok && runningServer.Equal(server) {
+			continue
+		}
+
+		insert(server)
+		if ok {
+			insert(runningServer)
+		}
+	}
+
+	for _, server := range runningServers {
+		insert(server)
+	}
+
+	return namespaces.List()
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/controller/config"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+)
+
+// tenantTemplate renders the include directives of the tenants
+// and the hostnames of the servers of each tenant
+type tenantTemplate struct{}
+
+func (tenantTemplate) Write(conf config.TemplateConfig) ([]byte, error) {
+	r := []string{}
+	for _, tenant := range conf.Tenants {
+		r = append(r, tenant.Include)
+	}
+	return []byte(strings.Join(r, "\n")), nil
+}
+
+func (tenantTemplate) WriteTenant(conf config.TemplateConfig, tenant config.Tenant) ([]byte, error) {
+	return fakeTemplate{}.Write(config.TemplateConfig{Servers: tenant.Servers})
+}
+
+// tenantTestCommand fails when an included file contains the hostname broken
+type tenantTestCommand struct{}
+
+func (tenantTestCommand) ExecCommand(args ...string) *exec.Cmd {
+	return nil
+}
+
+func (tenantTestCommand) Test(cfg string) ([]byte, error) {
+	content, err := ioutil.ReadFile(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, include := range strings.Split(string(content), "\n") {
+		servers, err := ioutil.ReadFile(include)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.Contains(string(servers), "broken") {
+			return []byte(fmt.Sprintf(`nginx: [emerg] unknown directive "broken" in %v:1`, include)), fmt.Errorf("exit status 1")
+		}
+	}
+
+	return nil, nil
+}
+
+func newTenantServer(hostname string, namespaces ...string) *ingress.Server {
+	server := &ingress.Server{Hostname: hostname}
+	for i, namespace := range namespaces {
+		server.Locations = append(server.Locations, &ingress.Location{
+			Path: fmt.Sprintf("/%v", i),
+			Ingress: &ingress.Ingress{
+				Ingress: networking.Ingress{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      hostname,
+						Namespace: namespace,
+					},
+				},
+			},
+		})
+	}
+	return server
+}
+
+func TestBuildTenants(t *testing.T) {
+	defaultServer := newTenantServer(defServerName, "a")
+	a := newTenantServer("a.example.com", "a")
+	b := newTenantServer("b.example.com", "b", "b")
+	otherA := newTenantServer("other.a.example.com", "a")
+	shared := newTenantServer("shared.example.com", "a", "b")
+	withoutIngress := newTenantServer("none.example.com")
+
+	tenants := buildTenants([]*ingress.Server{defaultServer, b, a, shared, withoutIngress, otherA}, "/tenants")
+
+	expected := []ngx_config.Tenant{
+		{Namespace: "a", Include: "/tenants/a.conf", Servers: []*ingress.Server{a, otherA}},
+		{Namespace: "b", Include: "/tenants/b.conf", Servers: []*ingress.Server{b}},
+	}
+
+	if !reflect.DeepEqual(tenants, expected) {
+		t.Errorf("expected %+v but got %+v", expected, tenants)
+	}
+}
+
+func TestTenantFromError(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       string
+		namespace string
+		reason    string
+	}{
+		{"tenant", "Error: exit status 1\nnginx: [emerg] invalid parameter \"x\" in /tmp/tenants/team-a.conf:12\n",
+			"team-a", "nginx: [emerg] invalid parameter \"x\" in /tmp/tenants/team-a.conf:12"},
+		{"main configuration", "nginx: [emerg] invalid parameter \"x\" in /tmp/nginx-cfg01:12", "", ""},
+		{"other directory", "nginx: [emerg] invalid parameter \"x\" in /etc/nginx/tenants/team-a.conf:12", "", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			namespace, reason := tenantFromError(fmt.Errorf(tc.err), "/tmp/tenants")
+			if namespace != tc.namespace || reason != tc.reason {
+				t.Errorf("expected %q (%q) but got %q (%q)", tc.namespace, tc.reason, namespace, reason)
+			}
+		})
+	}
+}
+
+func TestWriteIncludeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", tempTenantsPattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = writeIncludeFiles(dir, map[string][]byte{"a": []byte("a"), "b": []byte("b")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = writeIncludeFiles(dir, map[string][]byte{"b": []byte("new b")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0] != filepath.Join(dir, "b.conf") {
+		t.Fatalf("expected only the include file b but got %v", files)
+	}
+
+	content, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "new b" {
+		t.Errorf("expected the content %q but got %q", "new b", content)
+	}
+}
+
+func TestQuarantineTenants(t *testing.T) {
+	nginx := newNGINXController(t)
+	nginx.t = tenantTemplate{}
+	nginx.command = tenantTestCommand{}
+
+	cfg := ngx_config.NewDefault()
+	cfg.EnableTenantIsolation = true
+
+	broken := newTenantServer("broken.a.example.com", "a")
+	b := newTenantServer("b.example.com", "b")
+	ingressCfg := ingress.Configuration{
+		Servers: []*ingress.Server{broken, newTenantServer("a.example.com", "a"), b},
+	}
+
+	quarantined := []string{}
+	result, err := nginx.quarantineTenants(cfg, ingressCfg, func(namespace string, ingresses []*ingress.Ingress, reason string) bool {
+		quarantined = append(quarantined, namespace)
+		if len(ingresses) != 2 {
+			t.Errorf("expected the two ingresses of the namespace %v but got %v", namespace, len(ingresses))
+		}
+		if !strings.Contains(reason, "unknown directive") {
+			t.Errorf("unexpected reason %q", reason)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(quarantined, []string{"a"}) {
+		t.Errorf("expected the namespace a to be quarantined but got %v", quarantined)
+	}
+
+	if !reflect.DeepEqual(result.Servers, []*ingress.Server{b}) {
+		t.Errorf("expected only the servers of the namespace b but got %v", result.Servers)
+	}
+
+	_, err = nginx.quarantineTenants(cfg, ingressCfg, func(string, []*ingress.Ingress, string) bool {
+		return false
+	})
+	if err == nil {
+		t.Errorf("expected an error when the tenant is not quarantined")
+	}
+}
+
+func TestChangedTenants(t *testing.T) {
+	a := newTenantServer("a.example.com", "a")
+	b := newTenantServer("b.example.com", "b")
+	c := newTenantServer("c.example.com", "c")
+
+	running := &ingress.Configuration{Servers: []*ingress.Server{a, b}}
+
+	changedA := newTenantServer("a.example.com", "a")
+	changedA.Aliases = []string{"alias.example.com"}
+	pcfg := &ingress.Configuration{Servers: []*ingress.Server{changedA, c}}
+
+	namespaces := changedTenants(running, pcfg)
+	expected := []string{"a", "b", "c"}
+	if !reflect.DeepEqual(namespaces, expected) {
+		t.Errorf("expected %v but got %v", expected, namespaces)
+	}
+
+	namespaces = changedTenants(running, &ingress.Configuration{Servers: []*ingress.Server{a, b}})
+	if len(namespaces) != 0 {
+		t.Errorf("expected no changes but got %v", namespaces)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/timewindows"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+// timezoneOffsetsYears is the number of years, from the beginning of the
+// current one, covered by the offsets of the timezones sent to Lua
+const timezoneOffsetsYears = 2
+
+// timezoneOffset is the offset from UTC, in seconds, of a timezone since
+// the time, in seconds since the epoch, it takes effect
+type timezoneOffset struct {
+	Since  int64 `json:"since"`
+	Offset int   `json:"offset"`
+}
+
+type timeWindowsConfiguration struct {
+	Ingresses map[string]*timewindows.Config `json:"ingresses"`
+	Timezones map[string][]timezoneOffset    `json:"timezones"`
+}
+
+// getTimeWindows returns, by namespace and name, the time windows of the
+// Ingresses with the allowed-time-windows annotation
+func getTimeWindows(ingresses []*ingress.Ingress) map[string]*timewindows.Config {
+	var timeWindows map[string]*timewindows.Config
+
+	for _, ing := range ingresses {
+		if ing.ParsedAnnotations == nil || ing.ParsedAnnotations.AllowedTimeWindows == nil {
+			continue
+		}
+
+		if timeWindows == nil {
+			timeWindows = map[string]*timewindows.Config{}
+		}
+
+		timeWindows[fmt.Sprintf("%v/%v", ing.Namespace, ing.Name)] = ing.ParsedAnnotations.AllowedTimeWindows
+	}
+
+	return timeWindows
+}
+
+// getTimezoneOffsets returns the offsets of a timezone between from and to.
+// Lua does not have access to the timezone database, the changes of offset
+// (e.g. daylight saving time) are located by the controller instead.
+func getTimezoneOffsets(location *time.Location, from, to time.Time) []timezoneOffset {
+	_, offset := from.In(location).Zone()
+	offsets := []timezoneOffset{{Since: from.Unix(), Offset: offset}}
+
+	// the offset of the timezones changes at most a few times per year
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+		if _, nextOffset := next.In(location).Zone(); nextOffset == offset {
+			continue
+		}
+
+		// the change happened during the day, look for the exact second
+		low, high := day.Unix(), next.Unix()
+		for high-low > 1 {
+			middle := low + (high-low)/2
+			if _, o := time.Unix(middle, 0).In(location).Zone(); o == offset {
+				low = middle
+			} else {
+				high = middle
+			}
+		}
+
+		_, offset = next.In(location).Zone()
+		offsets = append(offsets, timezoneOffset{Since: high, Offset: offset})
+	}
+
+	return offsets
+}
+
+// configureTimeWindows JSON encodes the time windows, with the offsets of
+// their timezones, and POSTs them to an internal HTTP endpoint that is
+// handled by Lua
+func configureTimeWindows(timeWindows map[string]*timewindows.Config) error {
+	if timeWindows == nil {
+		timeWindows = map[string]*timewindows.Config{}
+	}
+
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(timezoneOffsetsYears, 0, 0)
+
+	configuration := &timeWindowsConfiguration{
+		Ingresses: timeWindows,
+		Timezones: map[string][]timezoneOffset{},
+	}
+
+	for _, config := range timeWindows {
+		if _, ok := configuration.Timezones[config.Timezone]; ok {
+			continue
+		}
+
+		location, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			klog.Warningf("Error loading timezone %q: %v", config.Timezone, err)
+			continue
+		}
+
+		configuration.Timezones[config.Timezone] = getTimezoneOffsets(location, from, to)
+	}
+
+	statusCode, _, err := nginx.NewPostStatusRequest("/configuration/time-windows", "application/json", configuration)
+	if err != nil {
+		return err
+	}
+
+	if statusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected error code: %d", statusCode)
+	}
+
+	return nil
+}
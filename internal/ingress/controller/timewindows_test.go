@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/timewindows"
+)
+
+func TestGetTimeWindows(t *testing.T) {
+	config := &timewindows.Config{Timezone: "UTC"}
+
+	ingresses := []*ingress.Ingress{
+		{
+			Ingress:           networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "admin"}},
+			ParsedAnnotations: &annotations.Ingress{AllowedTimeWindows: config},
+		},
+		{
+			Ingress:           networking.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shop"}},
+			ParsedAnnotations: &annotations.Ingress{},
+		},
+	}
+
+	expected := map[string]*timewindows.Config{"default/admin": config}
+	if timeWindows := getTimeWindows(ingresses); !reflect.DeepEqual(timeWindows, expected) {
+		t.Errorf("expected %v but got %v", expected, timeWindows)
+	}
+
+	if timeWindows := getTimeWindows(ingresses[1:]); timeWindows != nil {
+		t.Errorf("expected no time windows but got %v", timeWindows)
+	}
+}
+
+func TestGetTimezoneOffsets(t *testing.T) {
+	from := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	location, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("unexpected error loading timezone: %v", err)
+	}
+
+	expected := []timezoneOffset{
+		{Since: 1609459200, Offset: 3600},
+		// 28 March 2021 01:00:00 UTC
+		{Since: 1616893200, Offset: 7200},
+		// 31 October 2021 01:00:00 UTC
+		{Since: 1635642000, Offset: 3600},
+	}
+	if offsets := getTimezoneOffsets(location, from, to); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected %v but got %v", expected, offsets)
+	}
+
+	expected = []timezoneOffset{{Since: 1609459200, Offset: 0}}
+	if offsets := getTimezoneOffsets(time.UTC, from, to); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("expected %v but got %v", expected, offsets)
+	}
+}
@@ -27,8 +27,9 @@ import (
 	"syscall"
 
 	api "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/k8s"
 	"k8s.io/klog/v2"
 )
 
@@ -47,8 +48,10 @@ func newUpstream(name string) *ingress.Backend {
 }
 
 // upstreamName returns a formatted upstream name based on namespace, service, and port
-func upstreamName(namespace string, service string, port intstr.IntOrString) string {
-	return fmt.Sprintf("%v-%v-%v", namespace, service, port.String())
+// of an Ingress backend
+func upstreamName(namespace string, backend *networking.IngressBackend) string {
+	port := k8s.BackendServicePort(backend)
+	return fmt.Sprintf("%v-%v-%v", namespace, k8s.BackendServiceName(backend), port.String())
 }
 
 // sysctlSomaxconn returns the maximum number of connections that can be queued
@@ -0,0 +1,162 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress/metric"
+	"k8s.io/ingress-nginx/internal/task"
+)
+
+// syncWatchdog detects the synchronizations of the configuration stalled
+// with pending events, that is when the queue was not idle and no sync
+// succeeded for longer than the timeout
+type syncWatchdog struct {
+	queue   *task.Queue
+	timeout time.Duration
+	// restart exits the controller on a stall, so the kubelet restarts the
+	// pod. The stalled sync holds syncLock, another worker of the queue
+	// would wait for it.
+	restart bool
+	// exit terminates the process, klog.Fatalf out of the tests
+	exit func(format string, args ...interface{})
+
+	metricCollector metric.Collector
+
+	// lastIdle is the last time the queue had no pending events
+	lastIdle time.Time
+	// stalled is true from the detection of a stall until the next
+	// successful sync, so each stall is reported once
+	stalled bool
+	// dumpDir is the directory of the goroutine dumps
+	dumpDir string
+}
+
+func newSyncWatchdog(queue *task.Queue, timeout time.Duration, restart bool, mc metric.Collector) *syncWatchdog {
+	return &syncWatchdog{
+		queue:           queue,
+		timeout:         timeout,
+		restart:         restart,
+		metricCollector: mc,
+		lastIdle:        time.Now(),
+		dumpDir:         os.TempDir(),
+		exit:            klog.Fatalf,
+	}
+}
+
+// period returns the interval between the checks of the watchdog
+func (w *syncWatchdog) period() time.Duration {
+	return w.timeout / 4
+}
+
+// check looks for a stall of the synchronization at the given time and
+// returns true when a new one is detected
+func (w *syncWatchdog) check(now time.Time) bool {
+	if w.queue.Len() == 0 && w.queue.SyncStart().IsZero() {
+		w.lastIdle = now
+		w.stalled = false
+		return false
+	}
+
+	progress := w.queue.LastSync()
+	if w.lastIdle.After(progress) {
+		progress = w.lastIdle
+	}
+
+	if now.Sub(progress) <= w.timeout {
+		w.stalled = false
+		return false
+	}
+
+	if w.stalled {
+		return false
+	}
+
+	w.stalled = true
+	w.report(now.Sub(progress))
+
+	return true
+}
+
+// report logs the state of the controller, dumps its goroutines and, when
+// enabled, exits the controller
+func (w *syncWatchdog) report(stalled time.Duration) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	klog.ErrorS(nil, "Synchronization of the configuration stalled",
+		"duration", stalled.Round(time.Second),
+		"pending", w.queue.Len(),
+		"lastSync", w.queue.LastSync(),
+		"runningSince", w.queue.SyncStart(),
+		"goroutines", runtime.NumGoroutine(),
+		"heapAlloc", mem.HeapAlloc,
+		"sys", mem.Sys,
+	)
+
+	if path, err := w.dumpGoroutines(); err != nil {
+		klog.ErrorS(err, "Error dumping the goroutines")
+	} else {
+		klog.InfoS("Dumped the goroutines", "path", path)
+	}
+
+	w.metricCollector.IncSyncStallCount()
+
+	if w.restart {
+		w.exit("Exiting after a stall of the synchronization of %v", stalled.Round(time.Second))
+	}
+}
+
+// dumpGoroutines writes the stacks of all the goroutines to a new file
+func (w *syncWatchdog) dumpGoroutines() (string, error) {
+	path := filepath.Join(w.dumpDir, fmt.Sprintf("ingress-nginx-goroutines-%v.txt", time.Now().Unix()))
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := pprof.Lookup("goroutine").WriteTo(f, 2); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// Run checks the synchronization periodically until stopCh is closed
+func (w *syncWatchdog) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(w.period())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			w.check(now)
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/ingress-nginx/internal/ingress/metric"
+	"k8s.io/ingress-nginx/internal/task"
+)
+
+type fakeStallCollector struct {
+	metric.DummyCollector
+	stalls int
+}
+
+func (f *fakeStallCollector) IncSyncStallCount() {
+	f.stalls++
+}
+
+func TestSyncWatchdog(t *testing.T) {
+	release := make(chan struct{})
+	q := task.NewCustomTaskQueue(func(key interface{}) error {
+		<-release
+		return nil
+	}, nil)
+	stopCh := make(chan struct{})
+	go q.Run(time.Second, stopCh)
+	defer func() {
+		close(release)
+		close(stopCh)
+		q.Shutdown()
+	}()
+
+	mc := &fakeStallCollector{}
+	w := newSyncWatchdog(q, time.Minute, false, mc)
+	w.dumpDir = t.TempDir()
+
+	now := time.Now()
+	if w.check(now) {
+		t.Errorf("expected no stall of an idle queue")
+	}
+
+	q.EnqueueTask(task.GetDummyObject("stuck"))
+	time.Sleep(10 * time.Millisecond)
+
+	if w.check(now.Add(30 * time.Second)) {
+		t.Errorf("expected no stall before the timeout")
+	}
+	if !w.check(now.Add(2 * time.Minute)) {
+		t.Errorf("expected a stall after the timeout")
+	}
+	if w.check(now.Add(3 * time.Minute)) {
+		t.Errorf("expected the stall to be reported once")
+	}
+	if mc.stalls != 1 {
+		t.Errorf("expected 1 stall in the metric but got %v", mc.stalls)
+	}
+
+	dumps, err := os.ReadDir(w.dumpDir)
+	if err != nil {
+		t.Fatalf("unexpected error reading the dumps: %v", err)
+	}
+	if len(dumps) != 1 {
+		t.Errorf("expected 1 goroutine dump but got %v", len(dumps))
+	}
+}
+
+func TestSyncWatchdogRestart(t *testing.T) {
+	n := &NGINXController{syncLock: &sync.Mutex{}}
+
+	release := make(chan struct{})
+	q := task.NewCustomTaskQueue(func(key interface{}) error {
+		n.syncLock.Lock()
+		defer n.syncLock.Unlock()
+
+		<-release
+		return nil
+	}, nil)
+	stopCh := make(chan struct{})
+	go q.Run(time.Second, stopCh)
+	defer func() {
+		close(release)
+		close(stopCh)
+		q.Shutdown()
+	}()
+
+	w := newSyncWatchdog(q, time.Minute, true, &fakeStallCollector{})
+	w.dumpDir = t.TempDir()
+
+	exits := 0
+	w.exit = func(format string, args ...interface{}) {
+		exits++
+	}
+
+	now := time.Now()
+	w.check(now)
+
+	q.EnqueueTask(task.GetDummyObject("stuck"))
+	time.Sleep(10 * time.Millisecond)
+
+	// the stalled sync still holds the lock, only a new process recovers
+	if !w.check(now.Add(2 * time.Minute)) {
+		t.Errorf("expected a stall after the timeout")
+	}
+	if exits != 1 {
+		t.Errorf("expected the controller to exit once but it exited %v times", exits)
+	}
+}
@@ -40,6 +40,10 @@ type Backend struct {
 	// http://nginx.org/en/docs/http/ngx_http_proxy_module.html#proxy_connect_timeout
 	ProxyConnectTimeout int `json:"proxy-connect-timeout"`
 
+	// Timeout in seconds for the TLS handshake with a proxied server, started once the
+	// connection is established. The handshake uses the connect timeout when it is 0.
+	ProxySSLHandshakeTimeout int `json:"proxy-ssl-handshake-timeout"`
+
 	// Timeout in seconds for reading a response from the proxied server. The timeout is set only between
 	// two successive read operations, not for the transmission of the whole response
 	// http://nginx.org/en/docs/http/ngx_http_proxy_module.html#proxy_read_timeout
@@ -136,6 +140,26 @@ type Backend struct {
 	// http://nginx.org/en/docs/http/ngx_http_access_module.html
 	WhitelistSourceRange []string `json:"whitelist-source-range"`
 
+	// CustomEndpointsAllowedCIDRs are the networks of the endpoints of the
+	// custom-endpoints annotation. All the addresses but the loopback and
+	// link-local ones are allowed when it is empty.
+	CustomEndpointsAllowedCIDRs []string `json:"custom-endpoints-allowed-cidrs"`
+
+	// Path requested to the endpoints of the backends by the active health
+	// checks. The endpoints failing the checks are removed from the load balancing
+	HealthCheckPath string `json:"health-check-path"`
+
+	// Name of the service checked with the gRPC health checking protocol
+	// instead of the HTTP checks of health-check-path
+	HealthCheckGRPCService string `json:"health-check-grpc-service"`
+
+	// Time between two active health checks of an endpoint, like 10s
+	HealthCheckInterval string `json:"health-check-interval"`
+
+	// Time, in seconds, the endpoints removed from a backend keep serving
+	// the sessions with affinity to them. The zero value disables draining
+	DrainTimeout int `json:"drain-timeout"`
+
 	// Limits the rate of response transmission to a client.
 	// The rate is specified in bytes per second. The zero value disables rate limiting.
 	// The limit is set per a request, and so if a client simultaneously opens two connections,
@@ -158,4 +182,25 @@ type Backend struct {
 	// Sets the maximum temp file size when proxy-buffers capacity is exceeded.
 	// http://nginx.org/en/docs/http/ngx_http_proxy_module.html#proxy_max_temp_file_size
 	ProxyMaxTempFileSize string `json:"proxy-max-temp-file-size"`
+
+	// Defines how the URI of the requests is handled before being sent to the upstream.
+	// "off" sends the original request URI, "reject" returns 400 for requests with
+	// encoded slashes or dots, double encoding or dot segments in the path, and
+	// "normalize" sends the URI normalized by NGINX
+	URINormalizationPolicy string `json:"uri-normalization-policy"`
+
+	// Defines the address family of the endpoints used by the backends.
+	// "any" uses all the endpoints, "ipv4" and "ipv6" only use the endpoints
+	// of that family, and "prefer-ipv4" and "prefer-ipv6" use the endpoints of
+	// that family when available, falling back to all the endpoints otherwise
+	UpstreamAddressFamily string `json:"upstream-address-family"`
+
+	// Defines how the X-Request-ID header of the requests is handled.
+	// "trust" uses the header sent by the client, "regenerate" always uses a
+	// random value and "prefix" adds RequestIDPrefix to the header sent by the client
+	RequestIDPolicy string `json:"request-id-policy"`
+
+	// Prefix added to the X-Request-ID header sent by the client when
+	// RequestIDPolicy is "prefix"
+	RequestIDPrefix string `json:"request-id-prefix"`
 }
@@ -36,14 +36,16 @@ var (
 // annotations are not correctly configured
 func NewInvalidAnnotationConfiguration(name string, reason string) error {
 	return InvalidConfiguration{
-		Name: fmt.Sprintf("the annotation %v does not contain a valid configuration: %v", name, reason),
+		Name:       fmt.Sprintf("the annotation %v does not contain a valid configuration: %v", name, reason),
+		Annotation: name,
 	}
 }
 
 // NewInvalidAnnotationContent returns a new InvalidContent error
 func NewInvalidAnnotationContent(name string, val interface{}) error {
 	return InvalidContent{
-		Name: fmt.Sprintf("the annotation %v does not contain a valid value (%v)", name, val),
+		Name:       fmt.Sprintf("the annotation %v does not contain a valid value (%v)", name, val),
+		Annotation: name,
 	}
 }
 
@@ -57,6 +59,8 @@ func NewLocationDenied(reason string) error {
 // InvalidConfiguration Error
 type InvalidConfiguration struct {
 	Name string
+	// Annotation is the name, without prefix, of the annotation
+	Annotation string
 }
 
 func (e InvalidConfiguration) Error() string {
@@ -66,6 +70,8 @@ func (e InvalidConfiguration) Error() string {
 // InvalidContent error
 type InvalidContent struct {
 	Name string
+	// Annotation is the name, without prefix, of the annotation
+	Annotation string
 }
 
 func (e InvalidContent) Error() string {
@@ -101,6 +107,21 @@ func IsInvalidContent(e error) bool {
 	return ok
 }
 
+// AnnotationName returns the name, without prefix, of the annotation with
+// the invalid value of the error, or of the reason of a denied location, an
+// empty string when the error does not name it
+func AnnotationName(e error) string {
+	switch err := e.(type) {
+	case InvalidContent:
+		return err.Annotation
+	case InvalidConfiguration:
+		return err.Annotation
+	case LocationDenied:
+		return AnnotationName(err.Reason)
+	}
+	return ""
+}
+
 // New returns a new error
 func New(m string) error {
 	return errors.New(m)
@@ -50,3 +50,15 @@ func TestInvalidContent(t *testing.T) {
 		t.Error("expected false")
 	}
 }
+
+func TestAnnotationName(t *testing.T) {
+	if name := AnnotationName(NewInvalidAnnotationContent("proxy-cookie-path", "/one/")); name != "proxy-cookie-path" {
+		t.Errorf("expected proxy-cookie-path but returned %q", name)
+	}
+	if name := AnnotationName(LocationDenied{Reason: NewInvalidAnnotationContent("proxy-cookie-path", "/one/")}); name != "proxy-cookie-path" {
+		t.Errorf("expected proxy-cookie-path for the denied location but returned %q", name)
+	}
+	if name := AnnotationName(NewLocationDenied("demo")); name != "" {
+		t.Errorf("expected no annotation but returned %q", name)
+	}
+}
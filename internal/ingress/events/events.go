@@ -0,0 +1,172 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events emits the Events of the controller, dropping the duplicated
+// ones and limiting the number of Events of each object and reason.
+package events
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultInterval is the period during which a duplicated Event is dropped
+	DefaultInterval = 5 * time.Minute
+	// DefaultBurst is the number of Events of an object with the same reason
+	// emitted in each interval
+	DefaultBurst = 5
+)
+
+// New returns a recorder of the Events of the controller, sent to the API
+// server in the given namespace
+func New(client kubernetes.Interface, namespace string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(klog.Infof)
+	broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{
+		Interface: client.CoreV1().Events(namespace),
+	})
+
+	return NewRecorder(broadcaster.NewRecorder(scheme.Scheme, apiv1.EventSource{
+		Component: "nginx-ingress-controller",
+	}), DefaultInterval, DefaultBurst)
+}
+
+// Recorder is an EventRecorder that drops the Events already emitted for the
+// same object, reason and message during the interval, and emits at most
+// burst Events for the same object and reason during the interval.
+type Recorder struct {
+	recorder record.EventRecorder
+	interval time.Duration
+	burst    int
+
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastPrune time.Time
+
+	// now returns the current time, replaced in the tests
+	now func() time.Time
+}
+
+// window contains the Events of an object and reason emitted in an interval
+type window struct {
+	start    time.Time
+	count    int
+	messages map[string]bool
+}
+
+// NewRecorder returns a Recorder that emits the Events with recorder
+func NewRecorder(recorder record.EventRecorder, interval time.Duration, burst int) *Recorder {
+	return &Recorder{
+		recorder: recorder,
+		interval: interval,
+		burst:    burst,
+		windows:  map[string]*window{},
+		now:      time.Now,
+	}
+}
+
+// Event emits the Event unless it is duplicated or rate limited
+func (r *Recorder) Event(object runtime.Object, eventType, reason, message string) {
+	if !r.allow(object, reason, message) {
+		return
+	}
+
+	r.recorder.Event(object, eventType, reason, message)
+}
+
+// Eventf is like Event, but with Sprintf for the message
+func (r *Recorder) Eventf(object runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventType, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+// AnnotatedEventf is like Eventf, but with annotations attached to the Event
+func (r *Recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventType, reason, messageFmt string, args ...interface{}) {
+	message := fmt.Sprintf(messageFmt, args...)
+	if !r.allow(object, reason, message) {
+		return
+	}
+
+	r.recorder.AnnotatedEventf(object, annotations, eventType, reason, "%v", message)
+}
+
+// allow returns true if the Event must be emitted
+func (r *Recorder) allow(object runtime.Object, reason, message string) bool {
+	key := objectKey(object, reason)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.prune(now)
+
+	w, ok := r.windows[key]
+	if !ok || now.Sub(w.start) >= r.interval {
+		w = &window{start: now, messages: map[string]bool{}}
+		r.windows[key] = w
+	}
+
+	if w.messages[message] {
+		klog.V(3).InfoS("Dropping duplicated event", "key", key, "message", message)
+		return false
+	}
+
+	if w.count >= r.burst {
+		klog.V(3).InfoS("Dropping rate limited event", "key", key, "message", message)
+		return false
+	}
+
+	w.count++
+	w.messages[message] = true
+
+	return true
+}
+
+// prune removes the windows of the previous intervals, at most once in
+// each interval
+func (r *Recorder) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < r.interval {
+		return
+	}
+
+	for key, w := range r.windows {
+		if now.Sub(w.start) >= r.interval {
+			delete(r.windows, key)
+		}
+	}
+
+	r.lastPrune = now
+}
+
+// objectKey identifies the Events of an object with the same reason
+func objectKey(object runtime.Object, reason string) string {
+	accessor, err := meta.Accessor(object)
+	if err != nil {
+		return fmt.Sprintf("%T/%v", object, reason)
+	}
+
+	return fmt.Sprintf("%T/%v/%v/%v", object, accessor.GetNamespace(), accessor.GetName(), reason)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func newIngress(name string) *networking.Ingress {
+	return &networking.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+	}
+}
+
+func emitted(fake *record.FakeRecorder) int {
+	count := 0
+	for {
+		select {
+		case <-fake.Events:
+			count++
+		default:
+			return count
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	fake := record.NewFakeRecorder(100)
+	r := NewRecorder(fake, time.Minute, 2)
+
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	demo := newIngress("demo")
+	other := newIngress("other")
+
+	r.Event(demo, apiv1.EventTypeWarning, "LocationDropped", "path / dropped")
+	r.Event(demo, apiv1.EventTypeWarning, "LocationDropped", "path / dropped")
+	if count := emitted(fake); count != 1 {
+		t.Errorf("expected the duplicated event to be dropped but %v events emitted", count)
+	}
+
+	r.Eventf(demo, apiv1.EventTypeWarning, "LocationDropped", "path %v dropped", "/a")
+	r.Eventf(demo, apiv1.EventTypeWarning, "LocationDropped", "path %v dropped", "/b")
+	if count := emitted(fake); count != 1 {
+		t.Errorf("expected the events over the burst to be dropped but %v events emitted", count)
+	}
+
+	r.Event(demo, apiv1.EventTypeWarning, "CertificateFallback", "using the default certificate")
+	r.Event(other, apiv1.EventTypeWarning, "LocationDropped", "path / dropped")
+	if count := emitted(fake); count != 2 {
+		t.Errorf("expected the events of other reasons and objects to be emitted but %v events emitted", count)
+	}
+
+	now = now.Add(time.Minute)
+
+	r.Event(demo, apiv1.EventTypeWarning, "LocationDropped", "path / dropped")
+	if count := emitted(fake); count != 1 {
+		t.Errorf("expected the event to be emitted again in the next interval but %v events emitted", count)
+	}
+
+	if len(r.windows) != 1 {
+		t.Errorf("expected the windows of the previous interval to be removed but %v found", len(r.windows))
+	}
+}
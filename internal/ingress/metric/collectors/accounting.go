@@ -0,0 +1,326 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+)
+
+// tenants of the annotation longer than 128 characters or with other
+// characters are ignored, so they cannot explode the metrics
+var accountingTenantRegex = regexp.MustCompile(`^[a-zA-Z0-9._:@-]{1,128}$`)
+
+// AccountingConfig configures the accounting of the requests by tenant
+type AccountingConfig struct {
+	// Enabled enables the accounting
+	Enabled bool
+	// TenantAnnotation is the annotation of the ingresses with the tenant
+	// of their requests. The tenant is the namespace when empty
+	TenantAnnotation string
+	// ReportPath is the path of the periodic JSON report, disabled when empty
+	ReportPath string
+	// ReportInterval is the period of time covered by each report
+	ReportInterval time.Duration
+}
+
+// AccountingUsage contains the requests and bytes of a tenant
+type AccountingUsage struct {
+	Requests      uint64 `json:"requests"`
+	RequestBytes  uint64 `json:"requestBytes"`
+	ResponseBytes uint64 `json:"responseBytes"`
+}
+
+// AccountingReport contains the usage of each tenant in a period of time
+type AccountingReport struct {
+	Start   time.Time                  `json:"start"`
+	End     time.Time                  `json:"end"`
+	Tenants map[string]AccountingUsage `json:"tenants"`
+}
+
+// AccountingCollector aggregates the number of requests and bytes by tenant
+type AccountingCollector struct {
+	prometheus.Collector
+
+	config AccountingConfig
+
+	requests      *prometheus.CounterVec
+	requestBytes  *prometheus.CounterVec
+	responseBytes *prometheus.CounterVec
+
+	mu sync.Mutex
+	// tenants contains the tenant of the ingresses with the tenant annotation
+	tenants map[string]string
+	// namespaces contains the namespaces with ingresses
+	namespaces map[string]bool
+	// series contains the tenants with metrics
+	series map[string]bool
+	// report contains the usage since the last report
+	report AccountingReport
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewAccountingCollector creates a new AccountingCollector instance
+func NewAccountingCollector(pod, namespace, class string, config AccountingConfig) *AccountingCollector {
+	constLabels := prometheus.Labels{
+		"controller_namespace": namespace,
+		"controller_class":     class,
+		"controller_pod":       pod,
+	}
+
+	return &AccountingCollector{
+		config: config,
+
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "accounting_requests",
+				Help:        "The total number of client requests by tenant.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"tenant"},
+		),
+		requestBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "accounting_request_bytes",
+				Help:        "The total number of bytes received from clients by tenant.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"tenant"},
+		),
+		responseBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "accounting_response_bytes",
+				Help:        "The total number of bytes sent to clients by tenant.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"tenant"},
+		),
+
+		tenants:    map[string]string{},
+		namespaces: map[string]bool{},
+		series:     map[string]bool{},
+		report:     newAccountingReport(time.Now()),
+
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+}
+
+func newAccountingReport(start time.Time) AccountingReport {
+	return AccountingReport{
+		Start:   start,
+		Tenants: map[string]AccountingUsage{},
+	}
+}
+
+// SetTenants updates the tenant of the ingresses using the tenant annotation
+// and removes the metrics of the tenants without ingresses
+func (ac *AccountingCollector) SetTenants(ingresses []*ingress.Ingress) {
+	tenants := map[string]string{}
+	namespaces := map[string]bool{}
+	used := map[string]bool{}
+	for _, ing := range ingresses {
+		namespaces[ing.Namespace] = true
+
+		tenant, ok := ing.Annotations[ac.config.TenantAnnotation]
+		if ac.config.TenantAnnotation == "" || !ok || tenant == "" {
+			used[ing.Namespace] = true
+			continue
+		}
+
+		if !accountingTenantRegex.MatchString(tenant) {
+			klog.Warningf("Ingress %v/%v: invalid tenant %q in annotation %v, using the namespace", ing.Namespace, ing.Name, tenant, ac.config.TenantAnnotation)
+			used[ing.Namespace] = true
+			continue
+		}
+
+		tenants[fmt.Sprintf("%v/%v", ing.Namespace, ing.Name)] = tenant
+		used[tenant] = true
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	ac.tenants = tenants
+	ac.namespaces = namespaces
+
+	for tenant := range ac.series {
+		if used[tenant] {
+			continue
+		}
+
+		ac.requests.DeleteLabelValues(tenant)
+		ac.requestBytes.DeleteLabelValues(tenant)
+		ac.responseBytes.DeleteLabelValues(tenant)
+		delete(ac.series, tenant)
+	}
+}
+
+// tenant returns the tenant of the requests of an ingress, false when the
+// namespace has no ingresses. It must be called with the lock held.
+func (ac *AccountingCollector) tenant(namespace, name string) (string, bool) {
+	tenant, ok := ac.tenants[fmt.Sprintf("%v/%v", namespace, name)]
+	if ok {
+		return tenant, true
+	}
+
+	return namespace, ac.namespaces[namespace]
+}
+
+// observe accounts a request. The requests not served by an ingress are ignored.
+func (ac *AccountingCollector) observe(stats socketData) {
+	if stats.Namespace == "" {
+		return
+	}
+
+	usage := AccountingUsage{Requests: 1}
+	if stats.RequestLength > 0 {
+		usage.RequestBytes = uint64(stats.RequestLength)
+	}
+	if stats.ResponseLength > 0 {
+		usage.ResponseBytes = uint64(stats.ResponseLength)
+	}
+
+	// the metrics are updated with the lock held so SetTenants cannot
+	// remove the tenant between the check and the update
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	tenant, ok := ac.tenant(stats.Namespace, stats.Ingress)
+	if !ok {
+		return
+	}
+
+	labels := prometheus.Labels{"tenant": tenant}
+	ac.requests.With(labels).Inc()
+	ac.requestBytes.With(labels).Add(float64(usage.RequestBytes))
+	ac.responseBytes.With(labels).Add(float64(usage.ResponseBytes))
+	ac.series[tenant] = true
+
+	if ac.config.ReportPath == "" {
+		return
+	}
+
+	total := ac.report.Tenants[tenant]
+	total.Requests += usage.Requests
+	total.RequestBytes += usage.RequestBytes
+	total.ResponseBytes += usage.ResponseBytes
+	ac.report.Tenants[tenant] = total
+}
+
+// flushReport returns the usage since the last report and starts a new one
+func (ac *AccountingCollector) flushReport(end time.Time) AccountingReport {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	report := ac.report
+	report.End = end
+	ac.report = newAccountingReport(end)
+
+	return report
+}
+
+// writeReport writes the usage since the last report in the report file
+func (ac *AccountingCollector) writeReport() error {
+	report := ac.flushReport(time.Now())
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// the report is renamed to avoid readers of partial content
+	tmpfile, err := ioutil.TempFile(filepath.Dir(ac.config.ReportPath), ".accounting")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.Write(data)
+	tmpfile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpfile.Name(), ac.config.ReportPath)
+}
+
+// Start writes the periodic report until the collector is stopped
+func (ac *AccountingCollector) Start() {
+	defer close(ac.doneCh)
+
+	if ac.config.ReportPath == "" {
+		<-ac.stopCh
+		return
+	}
+
+	ticker := time.NewTicker(ac.config.ReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := ac.writeReport()
+			if err != nil {
+				klog.ErrorS(err, "Error writing accounting report", "path", ac.config.ReportPath)
+			}
+		case <-ac.stopCh:
+			// the usage of the last period is reported before stopping
+			err := ac.writeReport()
+			if err != nil {
+				klog.ErrorS(err, "Error writing accounting report", "path", ac.config.ReportPath)
+			}
+			return
+		}
+	}
+}
+
+// Stop stops the periodic report
+func (ac *AccountingCollector) Stop() {
+	close(ac.stopCh)
+	<-ac.doneCh
+}
+
+// Describe implements prometheus.Collector
+func (ac *AccountingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ac.requests.Describe(ch)
+	ac.requestBytes.Describe(ch)
+	ac.responseBytes.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (ac *AccountingCollector) Collect(ch chan<- prometheus.Metric) {
+	ac.requests.Collect(ch)
+	ac.requestBytes.Collect(ch)
+	ac.responseBytes.Collect(ch)
+}
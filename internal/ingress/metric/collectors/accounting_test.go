@@ -0,0 +1,185 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+)
+
+func TestAccountingCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accounting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reportPath := filepath.Join(dir, "report.json")
+
+	ac := NewAccountingCollector("pod", "default", "nginx", AccountingConfig{
+		Enabled:          true,
+		TenantAnnotation: "example.com/cost-center",
+		ReportPath:       reportPath,
+		ReportInterval:   time.Hour,
+	})
+
+	ac.SetTenants([]*ingress.Ingress{
+		{
+			Ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "billing",
+					Namespace:   "team-a",
+					Annotations: map[string]string{"example.com/cost-center": "finance"},
+				},
+			},
+		},
+	})
+
+	for _, stats := range []socketData{
+		{Namespace: "team-a", Ingress: "billing", RequestLength: 100, ResponseLength: 1000},
+		{Namespace: "team-a", Ingress: "billing", RequestLength: 50, ResponseLength: -1},
+		{Namespace: "team-a", Ingress: "web", RequestLength: 10, ResponseLength: 20},
+		{Namespace: "", Ingress: "", RequestLength: 10, ResponseLength: 20},
+		{Namespace: "unknown", Ingress: "web", RequestLength: 10, ResponseLength: 20},
+	} {
+		ac.observe(stats)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(ac); err != nil {
+		t.Fatalf("registering collector failed: %s", err)
+	}
+
+	want := `
+		# HELP nginx_ingress_controller_accounting_request_bytes The total number of bytes received from clients by tenant.
+		# TYPE nginx_ingress_controller_accounting_request_bytes counter
+		nginx_ingress_controller_accounting_request_bytes{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="finance"} 150
+		nginx_ingress_controller_accounting_request_bytes{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="team-a"} 10
+		# HELP nginx_ingress_controller_accounting_requests The total number of client requests by tenant.
+		# TYPE nginx_ingress_controller_accounting_requests counter
+		nginx_ingress_controller_accounting_requests{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="finance"} 2
+		nginx_ingress_controller_accounting_requests{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="team-a"} 1
+		# HELP nginx_ingress_controller_accounting_response_bytes The total number of bytes sent to clients by tenant.
+		# TYPE nginx_ingress_controller_accounting_response_bytes counter
+		nginx_ingress_controller_accounting_response_bytes{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="finance"} 1000
+		nginx_ingress_controller_accounting_response_bytes{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="team-a"} 20
+	`
+	metrics := []string{
+		"nginx_ingress_controller_accounting_requests",
+		"nginx_ingress_controller_accounting_request_bytes",
+		"nginx_ingress_controller_accounting_response_bytes",
+	}
+	if err := GatherAndCompare(ac, want, metrics, reg); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	go ac.Start()
+	ac.Stop()
+
+	data, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("unexpected error reading the report: %v", err)
+	}
+
+	var report AccountingReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("unexpected error decoding the report: %v", err)
+	}
+
+	expected := map[string]AccountingUsage{
+		"finance": {Requests: 2, RequestBytes: 150, ResponseBytes: 1000},
+		"team-a":  {Requests: 1, RequestBytes: 10, ResponseBytes: 20},
+	}
+	if !reflect.DeepEqual(report.Tenants, expected) {
+		t.Errorf("expected %v but got %v", expected, report.Tenants)
+	}
+	if !report.End.After(report.Start) {
+		t.Errorf("expected the end of the report after the start")
+	}
+
+	if next := ac.flushReport(time.Now()); len(next.Tenants) != 0 {
+		t.Errorf("expected an empty report after writing it but got %v", next.Tenants)
+	}
+}
+
+func TestAccountingCollectorTenants(t *testing.T) {
+	ac := NewAccountingCollector("pod", "default", "nginx", AccountingConfig{
+		Enabled:          true,
+		TenantAnnotation: "example.com/cost-center",
+	})
+
+	newIngress := func(namespace, name, tenant string) *ingress.Ingress {
+		return &ingress.Ingress{
+			Ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        name,
+					Namespace:   namespace,
+					Annotations: map[string]string{"example.com/cost-center": tenant},
+				},
+			},
+		}
+	}
+
+	ac.SetTenants([]*ingress.Ingress{
+		newIngress("team-a", "billing", "finance"),
+		newIngress("team-b", "web", "bad tenant"),
+	})
+
+	ac.observe(socketData{Namespace: "team-a", Ingress: "billing"})
+	ac.observe(socketData{Namespace: "team-b", Ingress: "web"})
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(ac); err != nil {
+		t.Fatalf("registering collector failed: %s", err)
+	}
+
+	metrics := []string{"nginx_ingress_controller_accounting_requests"}
+	want := `
+		# HELP nginx_ingress_controller_accounting_requests The total number of client requests by tenant.
+		# TYPE nginx_ingress_controller_accounting_requests counter
+		nginx_ingress_controller_accounting_requests{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="finance"} 1
+		nginx_ingress_controller_accounting_requests{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="team-b"} 1
+	`
+	if err := GatherAndCompare(ac, want, metrics, reg); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	// the series of the tenants without ingresses are removed
+	ac.SetTenants([]*ingress.Ingress{
+		newIngress("team-b", "web", "bad tenant"),
+	})
+
+	want = `
+		# HELP nginx_ingress_controller_accounting_requests The total number of client requests by tenant.
+		# TYPE nginx_ingress_controller_accounting_requests counter
+		nginx_ingress_controller_accounting_requests{controller_class="nginx",controller_namespace="default",controller_pod="pod",tenant="team-b"} 1
+	`
+	if err := GatherAndCompare(ac, want, metrics, reg); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CanaryStats contains the totals of the requests served by a canary backend
+type CanaryStats struct {
+	// Requests is the number of requests
+	Requests uint64
+	// Errors is the number of requests with a 5xx response
+	Errors uint64
+	// ResponseTimeCount is the number of requests with a response time
+	ResponseTimeCount uint64
+	// ResponseTimeSum is the sum of the response times, in seconds
+	ResponseTimeSum float64
+}
+
+// CanaryCollector aggregates the requests routed to the canary backends
+type CanaryCollector struct {
+	prometheus.Collector
+
+	requests     *prometheus.CounterVec
+	responseTime *prometheus.HistogramVec
+
+	mu    sync.RWMutex
+	stats map[string]CanaryStats
+}
+
+// NewCanaryCollector creates a new CanaryCollector instance
+func NewCanaryCollector(pod, namespace, class string) *CanaryCollector {
+	constLabels := prometheus.Labels{
+		"controller_namespace": namespace,
+		"controller_class":     class,
+		"controller_pod":       pod,
+	}
+
+	return &CanaryCollector{
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "canary_requests",
+				Help:        "The total number of client requests routed to canary backends.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"backend", "status"},
+		),
+		responseTime: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        "canary_response_duration_seconds",
+				Help:        "The time spent on receiving the response from the canary backends.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"backend"},
+		),
+
+		stats: map[string]CanaryStats{},
+	}
+}
+
+// observe accounts a request. The requests not routed to a canary are ignored.
+func (cc *CanaryCollector) observe(stats socketData) {
+	if stats.CanaryUpstream == "" {
+		return
+	}
+
+	cc.requests.With(prometheus.Labels{
+		"backend": stats.CanaryUpstream,
+		"status":  stats.Status,
+	}).Inc()
+
+	if stats.ResponseTime != -1 {
+		cc.responseTime.With(prometheus.Labels{"backend": stats.CanaryUpstream}).Observe(stats.ResponseTime)
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	total := cc.stats[stats.CanaryUpstream]
+	total.Requests++
+	if status, err := strconv.Atoi(stats.Status); err == nil && status >= 500 {
+		total.Errors++
+	}
+	if stats.ResponseTime != -1 {
+		total.ResponseTimeCount++
+		total.ResponseTimeSum += stats.ResponseTime
+	}
+	cc.stats[stats.CanaryUpstream] = total
+}
+
+// Stats returns the totals of the requests by canary backend
+func (cc *CanaryCollector) Stats() map[string]CanaryStats {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+
+	stats := make(map[string]CanaryStats, len(cc.stats))
+	for backend, total := range cc.stats {
+		stats[backend] = total
+	}
+
+	return stats
+}
+
+// Describe implements prometheus.Collector
+func (cc *CanaryCollector) Describe(ch chan<- *prometheus.Desc) {
+	cc.requests.Describe(ch)
+	cc.responseTime.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (cc *CanaryCollector) Collect(ch chan<- prometheus.Metric) {
+	cc.requests.Collect(ch)
+	cc.responseTime.Collect(ch)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCanaryCollector(t *testing.T) {
+	cc := NewCanaryCollector("pod", "default", "nginx")
+
+	for _, stats := range []socketData{
+		{CanaryUpstream: "default-web-canary-80", Status: "200", upstream: upstream{ResponseTime: 0.1}},
+		{CanaryUpstream: "default-web-canary-80", Status: "503", upstream: upstream{ResponseTime: 0.3}},
+		{CanaryUpstream: "default-web-canary-80", Status: "499", upstream: upstream{ResponseTime: -1}},
+		{Status: "500", upstream: upstream{ResponseTime: 0.2}},
+	} {
+		cc.observe(stats)
+	}
+
+	expected := map[string]CanaryStats{
+		"default-web-canary-80": {Requests: 3, Errors: 1, ResponseTimeCount: 2, ResponseTimeSum: 0.4},
+	}
+	if stats := cc.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v but got %+v", expected, stats)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(cc); err != nil {
+		t.Fatalf("registering collector failed: %s", err)
+	}
+
+	want := `
+		# HELP nginx_ingress_controller_canary_requests The total number of client requests routed to canary backends.
+		# TYPE nginx_ingress_controller_canary_requests counter
+		nginx_ingress_controller_canary_requests{backend="default-web-canary-80",controller_class="nginx",controller_namespace="default",controller_pod="pod",status="200"} 1
+		nginx_ingress_controller_canary_requests{backend="default-web-canary-80",controller_class="nginx",controller_namespace="default",controller_pod="pod",status="499"} 1
+		nginx_ingress_controller_canary_requests{backend="default-web-canary-80",controller_class="nginx",controller_namespace="default",controller_pod="pod",status="503"} 1
+	`
+	if err := GatherAndCompare(cc, want, []string{"nginx_ingress_controller_canary_requests"}, reg); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
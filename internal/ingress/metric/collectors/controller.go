@@ -23,6 +23,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
 	"k8s.io/klog/v2"
 )
 
@@ -30,8 +31,34 @@ var (
 	operation        = []string{"controller_namespace", "controller_class", "controller_pod"}
 	ingressOperation = []string{"controller_namespace", "controller_class", "controller_pod", "namespace", "ingress"}
 	sslLabelHost     = []string{"namespace", "class", "host"}
+	deprecatedLabels = []string{"controller_namespace", "controller_class", "controller_pod", "namespace", "ingress", "annotation"}
+	ignoredLabels    = []string{"controller_namespace", "controller_class", "controller_pod", "namespace", "ingress", "reason"}
+	limitLabels      = []string{"controller_namespace", "controller_class", "controller_pod", "limit"}
+	fileHashLabels   = []string{"controller_namespace", "controller_class", "controller_pod", "sha256"}
+	shadowLabels     = []string{"controller_namespace", "controller_class", "controller_pod", "namespace", "ingress", "serving_state", "shadow_state"}
+
+	// configurationLimits are the limits of the configuration reported by the
+	// config_limit_exceeded metric
+	configurationLimits = []string{"max-configuration-size", "max-servers"}
 )
 
+// IgnoredIngress is an ingress of the class of the controller that does not
+// route any request to its backends
+type IgnoredIngress struct {
+	Namespace string
+	Name      string
+	Reason    string
+}
+
+// ShadowDivergence is an ingress whose configuration has a different state
+// in the shadow mode than in the serving controllers
+type ShadowDivergence struct {
+	Namespace    string
+	Name         string
+	ServingState string
+	ShadowState  string
+}
+
 // Controller defines base metrics about the ingress controller
 type Controller struct {
 	prometheus.Collector
@@ -39,12 +66,28 @@ type Controller struct {
 	configHash        prometheus.Gauge
 	configSuccess     prometheus.Gauge
 	configSuccessTime prometheus.Gauge
+	configSize        prometheus.Gauge
+	configServers     prometheus.Gauge
+
+	shadowValidation     prometheus.Gauge
+	shadowValidationTime prometheus.Gauge
 
 	reloadOperation             *prometheus.CounterVec
 	reloadOperationErrors       *prometheus.CounterVec
 	checkIngressOperation       *prometheus.CounterVec
 	checkIngressOperationErrors *prometheus.CounterVec
+	syncStalls                  *prometheus.CounterVec
 	sslExpireTime               *prometheus.GaugeVec
+	deprecatedAnnotations       *prometheus.GaugeVec
+	annotationErrors            *prometheus.CounterVec
+	ignoredIngresses            *prometheus.GaugeVec
+	configLimitExceeded         *prometheus.GaugeVec
+	configFileHash              *prometheus.GaugeVec
+	shadowDivergences           *prometheus.GaugeVec
+
+	// annotationErrorsSeen contains the errors already counted, by ingress
+	// and parser, with the version of the ingress
+	annotationErrorsSeen map[string]string
 
 	constLabels prometheus.Labels
 	labels      prometheus.Labels
@@ -91,6 +134,34 @@ func NewController(pod, namespace, class string) *Controller {
 				Help:        "Timestamp of the last successful configuration reload.",
 				ConstLabels: constLabels,
 			}),
+		configSize: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   PrometheusNamespace,
+				Name:        "config_size_bytes",
+				Help:        "Size of the last generated configuration, including the include files of the tenants",
+				ConstLabels: constLabels,
+			}),
+		configServers: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   PrometheusNamespace,
+				Name:        "config_servers",
+				Help:        "Number of servers of the last generated configuration",
+				ConstLabels: constLabels,
+			}),
+		shadowValidation: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   PrometheusNamespace,
+				Name:        "shadow_validation_successful",
+				Help:        "Whether the NGINX configuration rendered by the last validation of the shadow mode is valid",
+				ConstLabels: constLabels,
+			}),
+		shadowValidationTime: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace:   PrometheusNamespace,
+				Name:        "shadow_validation_timestamp_seconds",
+				Help:        "Timestamp of the last validation of the shadow mode",
+				ConstLabels: constLabels,
+			}),
 		reloadOperation: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: PrometheusNamespace,
@@ -107,6 +178,14 @@ func NewController(pod, namespace, class string) *Controller {
 			},
 			operation,
 		),
+		syncStalls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: PrometheusNamespace,
+				Name:      "sync_stalls",
+				Help:      `Cumulative number of times the synchronization of the configuration stalled with pending events`,
+			},
+			operation,
+		),
 		checkIngressOperationErrors: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: PrometheusNamespace,
@@ -132,6 +211,55 @@ func NewController(pod, namespace, class string) *Controller {
 			},
 			sslLabelHost,
 		),
+		deprecatedAnnotations: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: PrometheusNamespace,
+				Name:      "deprecated_annotations",
+				Help:      `Constant 1 for each deprecated annotation used by an ingress`,
+			},
+			deprecatedLabels,
+		),
+		annotationErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: PrometheusNamespace,
+				Name:      "annotation_errors_total",
+				Help:      `Cumulative number of annotation values rejected by their parser`,
+			},
+			deprecatedLabels,
+		),
+		annotationErrorsSeen: make(map[string]string),
+		ignoredIngresses: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: PrometheusNamespace,
+				Name:      "ignored_ingresses",
+				Help:      `Constant 1 for each ingress of the class of the controller that does not route any request to its backends`,
+			},
+			ignoredLabels,
+		),
+		configLimitExceeded: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: PrometheusNamespace,
+				Name:      "config_limit_exceeded",
+				Help:      `Whether the last generated configuration exceeds the limit, in which case it is not applied`,
+			},
+			limitLabels,
+		),
+		configFileHash: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: PrometheusNamespace,
+				Name:      "config_file_info",
+				Help:      `Constant 1 labeled with the SHA256 checksum of the configuration files applied by the last reload`,
+			},
+			fileHashLabels,
+		),
+		shadowDivergences: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: PrometheusNamespace,
+				Name:      "shadow_divergent_ingresses",
+				Help:      `Constant 1 for each ingress whose configuration has a different state in the shadow mode than in the serving controllers`,
+			},
+			shadowLabels,
+		),
 		leaderElection: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Namespace:   PrometheusNamespace,
@@ -156,6 +284,11 @@ func (cm *Controller) IncReloadErrorCount() {
 	cm.reloadOperationErrors.With(cm.constLabels).Inc()
 }
 
+// IncSyncStallCount increment the counter of stalled synchronizations
+func (cm *Controller) IncSyncStallCount() {
+	cm.syncStalls.With(cm.constLabels).Inc()
+}
+
 // OnStartedLeading indicates the pod was elected as the leader
 func (cm *Controller) OnStartedLeading(electionID string) {
 	cm.leaderElection.WithLabelValues(electionID).Set(1.0)
@@ -204,11 +337,22 @@ func (cm Controller) Describe(ch chan<- *prometheus.Desc) {
 	cm.configHash.Describe(ch)
 	cm.configSuccess.Describe(ch)
 	cm.configSuccessTime.Describe(ch)
+	cm.configSize.Describe(ch)
+	cm.configServers.Describe(ch)
+	cm.shadowValidation.Describe(ch)
+	cm.shadowValidationTime.Describe(ch)
 	cm.reloadOperation.Describe(ch)
 	cm.reloadOperationErrors.Describe(ch)
+	cm.syncStalls.Describe(ch)
 	cm.checkIngressOperation.Describe(ch)
 	cm.checkIngressOperationErrors.Describe(ch)
 	cm.sslExpireTime.Describe(ch)
+	cm.deprecatedAnnotations.Describe(ch)
+	cm.annotationErrors.Describe(ch)
+	cm.ignoredIngresses.Describe(ch)
+	cm.configLimitExceeded.Describe(ch)
+	cm.configFileHash.Describe(ch)
+	cm.shadowDivergences.Describe(ch)
 	cm.leaderElection.Describe(ch)
 }
 
@@ -217,11 +361,22 @@ func (cm Controller) Collect(ch chan<- prometheus.Metric) {
 	cm.configHash.Collect(ch)
 	cm.configSuccess.Collect(ch)
 	cm.configSuccessTime.Collect(ch)
+	cm.configSize.Collect(ch)
+	cm.configServers.Collect(ch)
+	cm.shadowValidation.Collect(ch)
+	cm.shadowValidationTime.Collect(ch)
 	cm.reloadOperation.Collect(ch)
 	cm.reloadOperationErrors.Collect(ch)
+	cm.syncStalls.Collect(ch)
 	cm.checkIngressOperation.Collect(ch)
 	cm.checkIngressOperationErrors.Collect(ch)
 	cm.sslExpireTime.Collect(ch)
+	cm.deprecatedAnnotations.Collect(ch)
+	cm.annotationErrors.Collect(ch)
+	cm.ignoredIngresses.Collect(ch)
+	cm.configLimitExceeded.Collect(ch)
+	cm.configFileHash.Collect(ch)
+	cm.shadowDivergences.Collect(ch)
 	cm.leaderElection.Collect(ch)
 }
 
@@ -240,6 +395,112 @@ func (cm *Controller) SetSSLExpireTime(servers []*ingress.Server) {
 	}
 }
 
+// SetDeprecatedAnnotations sets the deprecated annotations used by the ingresses
+func (cm *Controller) SetDeprecatedAnnotations(ingresses []*ingress.Ingress) {
+	cm.deprecatedAnnotations.Reset()
+
+	for _, ing := range ingresses {
+		for _, d := range parser.DeprecatedAnnotationsInUse(&ing.Ingress) {
+			labels := prometheus.Labels{
+				"namespace":  ing.Namespace,
+				"ingress":    ing.Name,
+				"annotation": parser.GetAnnotationWithPrefix(d.Name),
+			}
+			cm.deprecatedAnnotations.MustCurryWith(cm.constLabels).With(labels).Set(1)
+		}
+	}
+}
+
+// ObserveAnnotationErrors counts the annotations of the ingresses rejected by
+// their parser, once for each version of the ingresses
+func (cm *Controller) ObserveAnnotationErrors(ingresses []*ingress.Ingress) {
+	seen := make(map[string]string)
+
+	for _, ing := range ingresses {
+		if ing.ParsedAnnotations == nil {
+			continue
+		}
+
+		for name, parseError := range ing.ParsedAnnotations.Errors {
+			key := fmt.Sprintf("%v/%v/%v", ing.Namespace, ing.Name, name)
+			version := fmt.Sprintf("%v/%v", ing.ResourceVersion, parseError)
+
+			seen[key] = version
+			if cm.annotationErrorsSeen[key] == version {
+				continue
+			}
+
+			labels := prometheus.Labels{
+				"namespace":  ing.Namespace,
+				"ingress":    ing.Name,
+				"annotation": name,
+			}
+			cm.annotationErrors.MustCurryWith(cm.constLabels).With(labels).Inc()
+		}
+	}
+
+	cm.annotationErrorsSeen = seen
+}
+
+// SetIgnoredIngresses sets the ingresses that do not route any request to their backends
+func (cm *Controller) SetIgnoredIngresses(ignored []IgnoredIngress) {
+	cm.ignoredIngresses.Reset()
+
+	for _, ing := range ignored {
+		labels := prometheus.Labels{
+			"namespace": ing.Namespace,
+			"ingress":   ing.Name,
+			"reason":    ing.Reason,
+		}
+		cm.ignoredIngresses.MustCurryWith(cm.constLabels).With(labels).Set(1)
+	}
+}
+
+// SetConfigurationSize sets the size and the number of servers of the generated
+// configuration, with the limits it exceeds
+func (cm *Controller) SetConfigurationSize(size, servers int, exceeded []string) {
+	cm.configSize.Set(float64(size))
+	cm.configServers.Set(float64(servers))
+
+	limits := sets.NewString(exceeded...)
+	for _, limit := range configurationLimits {
+		value := 0.0
+		if limits.Has(limit) {
+			value = 1
+		}
+		cm.configLimitExceeded.MustCurryWith(cm.constLabels).With(prometheus.Labels{"limit": limit}).Set(value)
+	}
+}
+
+// SetConfigurationFileHash sets the checksum of the configuration files
+// applied by the last reload
+func (cm *Controller) SetConfigurationFileHash(hash string) {
+	cm.configFileHash.Reset()
+	cm.configFileHash.MustCurryWith(cm.constLabels).With(prometheus.Labels{"sha256": hash}).Set(1)
+}
+
+// SetShadowValidation sets the result of a validation of the shadow mode and
+// the ingresses whose configuration diverges from the serving controllers
+func (cm *Controller) SetShadowValidation(valid bool, divergences []ShadowDivergence) {
+	cm.shadowValidationTime.Set(float64(time.Now().Unix()))
+	if valid {
+		cm.shadowValidation.Set(1)
+	} else {
+		cm.shadowValidation.Set(0)
+	}
+
+	cm.shadowDivergences.Reset()
+	for _, d := range divergences {
+		labels := prometheus.Labels{
+			"namespace":     d.Namespace,
+			"ingress":       d.Name,
+			"serving_state": d.ServingState,
+			"shadow_state":  d.ShadowState,
+		}
+		cm.shadowDivergences.MustCurryWith(cm.constLabels).With(labels).Set(1)
+	}
+}
+
 // RemoveMetrics removes metrics for hostnames not available anymore
 func (cm *Controller) RemoveMetrics(hosts []string, registry prometheus.Gatherer) {
 	cm.removeSSLExpireMetrics(true, hosts, registry)
@@ -22,6 +22,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations"
 )
 
 func TestControllerCounters(t *testing.T) {
@@ -70,6 +71,18 @@ func TestControllerCounters(t *testing.T) {
 			`,
 			metrics: []string{"nginx_ingress_controller_errors"},
 		},
+		{
+			name: "single stalled synchronization should return 1",
+			test: func(cm *Controller) {
+				cm.IncSyncStallCount()
+			},
+			want: `
+				# HELP nginx_ingress_controller_sync_stalls Cumulative number of times the synchronization of the configuration stalled with pending events
+				# TYPE nginx_ingress_controller_sync_stalls counter
+				nginx_ingress_controller_sync_stalls{controller_class="nginx",controller_namespace="default",controller_pod="pod"} 1
+			`,
+			metrics: []string{"nginx_ingress_controller_sync_stalls"},
+		},
 		{
 			name: "should set SSL certificates metrics",
 			test: func(cm *Controller) {
@@ -100,6 +113,126 @@ func TestControllerCounters(t *testing.T) {
 			`,
 			metrics: []string{"nginx_ingress_controller_ssl_expire_time_seconds"},
 		},
+		{
+			name: "should set deprecated annotations metrics",
+			test: func(cm *Controller) {
+				deprecated := &ingress.Ingress{}
+				deprecated.Namespace = "default"
+				deprecated.Name = "legacy"
+				deprecated.Annotations = map[string]string{"nginx.ingress.kubernetes.io/secure-backends": "true"}
+
+				current := &ingress.Ingress{}
+				current.Namespace = "default"
+				current.Name = "current"
+				current.Annotations = map[string]string{"nginx.ingress.kubernetes.io/backend-protocol": "HTTPS"}
+
+				cm.SetDeprecatedAnnotations([]*ingress.Ingress{deprecated})
+				cm.SetDeprecatedAnnotations([]*ingress.Ingress{deprecated, current})
+			},
+			want: `
+				# HELP nginx_ingress_controller_deprecated_annotations Constant 1 for each deprecated annotation used by an ingress
+				# TYPE nginx_ingress_controller_deprecated_annotations gauge
+				nginx_ingress_controller_deprecated_annotations{annotation="nginx.ingress.kubernetes.io/secure-backends",controller_class="nginx",controller_namespace="default",controller_pod="pod",ingress="legacy",namespace="default"} 1
+			`,
+			metrics: []string{"nginx_ingress_controller_deprecated_annotations"},
+		},
+		{
+			name: "should count annotation errors once for each version of the ingress",
+			test: func(cm *Controller) {
+				ing := &ingress.Ingress{
+					ParsedAnnotations: &annotations.Ingress{
+						Errors: map[string]string{"nginx.ingress.kubernetes.io/global-rate-limit-window": "Location denied, reason: invalid global-rate-limit-window"},
+					},
+				}
+				ing.Namespace = "default"
+				ing.Name = "rate-limited"
+				ing.ResourceVersion = "1"
+
+				valid := &ingress.Ingress{ParsedAnnotations: &annotations.Ingress{}}
+				valid.Namespace = "default"
+				valid.Name = "valid"
+
+				cm.ObserveAnnotationErrors([]*ingress.Ingress{ing, valid})
+				cm.ObserveAnnotationErrors([]*ingress.Ingress{ing, valid})
+
+				ing.ResourceVersion = "2"
+				cm.ObserveAnnotationErrors([]*ingress.Ingress{ing, valid})
+			},
+			want: `
+				# HELP nginx_ingress_controller_annotation_errors_total Cumulative number of annotation values rejected by their parser
+				# TYPE nginx_ingress_controller_annotation_errors_total counter
+				nginx_ingress_controller_annotation_errors_total{annotation="nginx.ingress.kubernetes.io/global-rate-limit-window",controller_class="nginx",controller_namespace="default",controller_pod="pod",ingress="rate-limited",namespace="default"} 2
+			`,
+			metrics: []string{"nginx_ingress_controller_annotation_errors_total"},
+		},
+		{
+			name: "should set the ignored ingresses",
+			test: func(cm *Controller) {
+				cm.SetIgnoredIngresses([]IgnoredIngress{{Namespace: "default", Name: "old", Reason: "PathConflict"}})
+				cm.SetIgnoredIngresses([]IgnoredIngress{{Namespace: "default", Name: "shop", Reason: "ServiceNotFound"}})
+			},
+			want: `
+				# HELP nginx_ingress_controller_ignored_ingresses Constant 1 for each ingress of the class of the controller that does not route any request to its backends
+				# TYPE nginx_ingress_controller_ignored_ingresses gauge
+				nginx_ingress_controller_ignored_ingresses{controller_class="nginx",controller_namespace="default",controller_pod="pod",ingress="shop",namespace="default",reason="ServiceNotFound"} 1
+			`,
+			metrics: []string{"nginx_ingress_controller_ignored_ingresses"},
+		},
+		{
+			name: "should set the size of the configuration and the limits exceeded",
+			test: func(cm *Controller) {
+				cm.SetConfigurationSize(2048, 12, []string{"max-servers"})
+			},
+			want: `
+				# HELP nginx_ingress_controller_config_limit_exceeded Whether the last generated configuration exceeds the limit, in which case it is not applied
+				# TYPE nginx_ingress_controller_config_limit_exceeded gauge
+				nginx_ingress_controller_config_limit_exceeded{controller_class="nginx",controller_namespace="default",controller_pod="pod",limit="max-configuration-size"} 0
+				nginx_ingress_controller_config_limit_exceeded{controller_class="nginx",controller_namespace="default",controller_pod="pod",limit="max-servers"} 1
+				# HELP nginx_ingress_controller_config_servers Number of servers of the last generated configuration
+				# TYPE nginx_ingress_controller_config_servers gauge
+				nginx_ingress_controller_config_servers{controller_class="nginx",controller_namespace="default",controller_pod="pod"} 12
+				# HELP nginx_ingress_controller_config_size_bytes Size of the last generated configuration, including the include files of the tenants
+				# TYPE nginx_ingress_controller_config_size_bytes gauge
+				nginx_ingress_controller_config_size_bytes{controller_class="nginx",controller_namespace="default",controller_pod="pod"} 2048
+			`,
+			metrics: []string{
+				"nginx_ingress_controller_config_limit_exceeded",
+				"nginx_ingress_controller_config_servers",
+				"nginx_ingress_controller_config_size_bytes",
+			},
+		},
+		{
+			name: "should set the checksum of the configuration files",
+			test: func(cm *Controller) {
+				cm.SetConfigurationFileHash("0a1b")
+				cm.SetConfigurationFileHash("2c3d")
+			},
+			want: `
+				# HELP nginx_ingress_controller_config_file_info Constant 1 labeled with the SHA256 checksum of the configuration files applied by the last reload
+				# TYPE nginx_ingress_controller_config_file_info gauge
+				nginx_ingress_controller_config_file_info{controller_class="nginx",controller_namespace="default",controller_pod="pod",sha256="2c3d"} 1
+			`,
+			metrics: []string{"nginx_ingress_controller_config_file_info"},
+		},
+		{
+			name: "should set the result of the shadow validation",
+			test: func(cm *Controller) {
+				cm.SetShadowValidation(true, []ShadowDivergence{{Namespace: "default", Name: "old", ServingState: "Applied", ShadowState: "Denied"}})
+				cm.SetShadowValidation(false, []ShadowDivergence{{Namespace: "default", Name: "shop", ServingState: "Applied", ShadowState: "Quarantined"}})
+			},
+			want: `
+				# HELP nginx_ingress_controller_shadow_divergent_ingresses Constant 1 for each ingress whose configuration has a different state in the shadow mode than in the serving controllers
+				# TYPE nginx_ingress_controller_shadow_divergent_ingresses gauge
+				nginx_ingress_controller_shadow_divergent_ingresses{controller_class="nginx",controller_namespace="default",controller_pod="pod",ingress="shop",namespace="default",serving_state="Applied",shadow_state="Quarantined"} 1
+				# HELP nginx_ingress_controller_shadow_validation_successful Whether the NGINX configuration rendered by the last validation of the shadow mode is valid
+				# TYPE nginx_ingress_controller_shadow_validation_successful gauge
+				nginx_ingress_controller_shadow_validation_successful{controller_class="nginx",controller_namespace="default",controller_pod="pod"} 0
+			`,
+			metrics: []string{
+				"nginx_ingress_controller_shadow_divergent_ingresses",
+				"nginx_ingress_controller_shadow_validation_successful",
+			},
+		},
 	}
 
 	for _, c := range cases {
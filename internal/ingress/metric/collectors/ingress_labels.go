@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+)
+
+// IngressLabelsCollector exposes the labels of the ingresses selected in the
+// telemetry-ingress-labels setting, to be joined with the metrics of the requests.
+// The names of the labels can change at runtime, so the collector is unchecked
+type IngressLabelsCollector struct {
+	constLabels prometheus.Labels
+
+	mu      sync.RWMutex
+	metrics []prometheus.Metric
+}
+
+// NewIngressLabelsCollector creates a new IngressLabelsCollector instance
+func NewIngressLabelsCollector(pod, namespace, class string) *IngressLabelsCollector {
+	return &IngressLabelsCollector{
+		constLabels: prometheus.Labels{
+			"controller_namespace": namespace,
+			"controller_class":     class,
+			"controller_pod":       pod,
+		},
+	}
+}
+
+// SetIngressLabels sets the ingresses with the labels to expose, mapped to the
+// names of the metric labels. Ingresses without any of the labels are omitted
+func (c *IngressLabelsCollector) SetIngressLabels(ingresses []*ingress.Ingress, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	labelNames := []string{"namespace", "ingress"}
+	for _, key := range keys {
+		labelNames = append(labelNames, labels[key])
+	}
+
+	desc := prometheus.NewDesc(
+		prometheus.BuildFQName(PrometheusNamespace, "", "ingress_labels"),
+		"Constant 1 with the selected labels of each ingress.",
+		labelNames, c.constLabels,
+	)
+
+	metrics := []prometheus.Metric{}
+	for _, ing := range ingresses {
+		values := []string{ing.Namespace, ing.Name}
+		found := false
+		for _, key := range keys {
+			value, ok := ing.Labels[key]
+			values = append(values, value)
+			found = found || ok
+		}
+
+		if !found {
+			continue
+		}
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, values...))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metrics = metrics
+}
+
+// Describe implements prometheus.Collector, no descriptors are sent
+// because the labels of the metric are not known in advance
+func (c *IngressLabelsCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect implements prometheus.Collector
+func (c *IngressLabelsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, m := range c.metrics {
+		ch <- m
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+)
+
+func TestIngressLabelsCollector(t *testing.T) {
+	newIngress := func(name string, labels map[string]string) *ingress.Ingress {
+		return &ingress.Ingress{
+			Ingress: networking.Ingress{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "default",
+					Labels:    labels,
+				},
+			},
+		}
+	}
+
+	c := NewIngressLabelsCollector("pod", "default", "nginx")
+	c.SetIngressLabels([]*ingress.Ingress{
+		newIngress("billing", map[string]string{"team": "finance", "app.kubernetes.io/name": "billing-api"}),
+		newIngress("web", map[string]string{"team": "frontend"}),
+		newIngress("other", map[string]string{"version": "v1"}),
+	}, map[string]string{"team": "team", "app.kubernetes.io/name": "service"})
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("registering collector failed: %s", err)
+	}
+
+	want := `
+		# HELP nginx_ingress_controller_ingress_labels Constant 1 with the selected labels of each ingress.
+		# TYPE nginx_ingress_controller_ingress_labels gauge
+		nginx_ingress_controller_ingress_labels{controller_class="nginx",controller_namespace="default",controller_pod="pod",ingress="billing",namespace="default",service="billing-api",team="finance"} 1
+		nginx_ingress_controller_ingress_labels{controller_class="nginx",controller_namespace="default",controller_pod="pod",ingress="web",namespace="default",service="",team="frontend"} 1
+	`
+	if err := GatherAndCompare(c, want, []string{"nginx_ingress_controller_ingress_labels"}, reg); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	c.SetIngressLabels(nil, map[string]string{})
+	if err := GatherAndCompare(c, "", []string{"nginx_ingress_controller_ingress_labels"}, reg); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"encoding/json"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-nginx/internal/nginx"
+	"k8s.io/klog/v2"
+)
+
+// KeepaliveStatsPath defines the path used to expose the upstream keepalive statistics
+const KeepaliveStatsPath = "/configuration/keepalive"
+
+type (
+	keepaliveCollector struct {
+		scrapeChan chan scrapeRequest
+
+		data *keepaliveData
+	}
+
+	keepaliveData struct {
+		poolSize         *prometheus.Desc
+		requestsActive   *prometheus.Desc
+		connectionsTotal *prometheus.Desc
+	}
+
+	keepaliveStats struct {
+		// KeepaliveConnections maximum number of idle connections kept by each worker
+		KeepaliveConnections int `json:"keepalive_connections"`
+		// Workers number of NGINX worker processes
+		Workers int `json:"workers"`
+		// Backends statistics of each backend
+		Backends map[string]backendKeepaliveStats `json:"backends"`
+	}
+
+	backendKeepaliveStats struct {
+		// Active current number of requests proxied to the backend
+		Active int `json:"active"`
+		// Reused total number of upstream connections taken from the keepalive pool
+		Reused int `json:"reused"`
+		// New total number of upstream connections established
+		New int `json:"new"`
+	}
+)
+
+// KeepaliveCollector defines an upstream keepalive statistics collector interface
+type KeepaliveCollector interface {
+	prometheus.Collector
+
+	Start()
+	Stop()
+}
+
+// NewKeepaliveCollector returns a new prometheus collector of the upstream
+// keepalive statistics gathered by the Lua balancer
+func NewKeepaliveCollector(podName, namespace, ingressClass string) (KeepaliveCollector, error) {
+	p := keepaliveCollector{
+		scrapeChan: make(chan scrapeRequest),
+	}
+
+	constLabels := prometheus.Labels{
+		"controller_namespace": namespace,
+		"controller_class":     ingressClass,
+		"controller_pod":       podName,
+	}
+
+	p.data = &keepaliveData{
+		poolSize: prometheus.NewDesc(
+			prometheus.BuildFQName(PrometheusNamespace, "", "upstream_keepalive_pool_size"),
+			"maximum number of idle upstream connections kept in the keepalive pool of all the workers",
+			nil, constLabels),
+
+		requestsActive: prometheus.NewDesc(
+			prometheus.BuildFQName(PrometheusNamespace, "", "upstream_requests_active"),
+			"current number of requests proxied to the upstream",
+			[]string{"upstream"}, constLabels),
+
+		connectionsTotal: prometheus.NewDesc(
+			prometheus.BuildFQName(PrometheusNamespace, "", "upstream_connections_total"),
+			"total number of upstream connections with state {reused, new}",
+			[]string{"upstream", "state"}, constLabels),
+	}
+
+	return p, nil
+}
+
+// Describe implements prometheus.Collector.
+func (p keepaliveCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.data.poolSize
+	ch <- p.data.requestsActive
+	ch <- p.data.connectionsTotal
+}
+
+// Collect implements prometheus.Collector.
+func (p keepaliveCollector) Collect(ch chan<- prometheus.Metric) {
+	req := scrapeRequest{results: ch, done: make(chan struct{})}
+	p.scrapeChan <- req
+	<-req.done
+}
+
+func (p keepaliveCollector) Start() {
+	for req := range p.scrapeChan {
+		ch := req.results
+		p.scrape(ch)
+		req.done <- struct{}{}
+	}
+}
+
+func (p keepaliveCollector) Stop() {
+	close(p.scrapeChan)
+}
+
+// scrape obtains the upstream keepalive statistics from the Lua endpoint
+func (p keepaliveCollector) scrape(ch chan<- prometheus.Metric) {
+	klog.V(3).InfoS("starting scraping keepalive statistics", "path", KeepaliveStatsPath)
+	status, data, err := nginx.NewGetStatusRequest(KeepaliveStatsPath)
+	if err != nil {
+		klog.Warningf("unexpected error obtaining upstream keepalive statistics: %v", err)
+		return
+	}
+
+	if status < 200 || status >= 400 {
+		klog.Warningf("unexpected error obtaining upstream keepalive statistics (status %v)", status)
+		return
+	}
+
+	var stats keepaliveStats
+	err = json.Unmarshal(data, &stats)
+	if err != nil {
+		klog.Warningf("unexpected error decoding upstream keepalive statistics: %v", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(p.data.poolSize,
+		prometheus.GaugeValue, float64(stats.KeepaliveConnections*stats.Workers))
+
+	for upstream, s := range stats.Backends {
+		ch <- prometheus.MustNewConstMetric(p.data.requestsActive,
+			prometheus.GaugeValue, float64(s.Active), upstream)
+		ch <- prometheus.MustNewConstMetric(p.data.connectionsTotal,
+			prometheus.CounterValue, float64(s.Reused), upstream, "reused")
+		ch <- prometheus.MustNewConstMetric(p.data.connectionsTotal,
+			prometheus.CounterValue, float64(s.New), upstream, "new")
+	}
+}
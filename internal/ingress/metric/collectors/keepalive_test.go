@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+func TestKeepaliveCollector(t *testing.T) {
+	cases := []struct {
+		name    string
+		mock    string
+		metrics []string
+		want    string
+	}{
+		{
+			name: "should return the pool size without backends",
+			mock: `{"keepalive_connections": 320, "workers": 2, "backends": {}}`,
+			want: `
+				# HELP nginx_ingress_controller_upstream_keepalive_pool_size maximum number of idle upstream connections kept in the keepalive pool of all the workers
+				# TYPE nginx_ingress_controller_upstream_keepalive_pool_size gauge
+				nginx_ingress_controller_upstream_keepalive_pool_size{controller_class="nginx",controller_namespace="default",controller_pod="pod"} 640
+			`,
+			metrics: []string{"nginx_ingress_controller_upstream_keepalive_pool_size"},
+		},
+		{
+			name: "should return metrics for each backend",
+			mock: `{
+				"keepalive_connections": 320,
+				"workers": 1,
+				"backends": {
+					"default-http-svc-80": {"active": 3, "reused": 10, "new": 2},
+					"default-echo-80": {"active": 0, "reused": 0, "new": 1}
+				}
+			}`,
+			want: `
+				# HELP nginx_ingress_controller_upstream_connections_total total number of upstream connections with state {reused, new}
+				# TYPE nginx_ingress_controller_upstream_connections_total counter
+				nginx_ingress_controller_upstream_connections_total{controller_class="nginx",controller_namespace="default",controller_pod="pod",state="new",upstream="default-echo-80"} 1
+				nginx_ingress_controller_upstream_connections_total{controller_class="nginx",controller_namespace="default",controller_pod="pod",state="new",upstream="default-http-svc-80"} 2
+				nginx_ingress_controller_upstream_connections_total{controller_class="nginx",controller_namespace="default",controller_pod="pod",state="reused",upstream="default-echo-80"} 0
+				nginx_ingress_controller_upstream_connections_total{controller_class="nginx",controller_namespace="default",controller_pod="pod",state="reused",upstream="default-http-svc-80"} 10
+				# HELP nginx_ingress_controller_upstream_requests_active current number of requests proxied to the upstream
+				# TYPE nginx_ingress_controller_upstream_requests_active gauge
+				nginx_ingress_controller_upstream_requests_active{controller_class="nginx",controller_namespace="default",controller_pod="pod",upstream="default-echo-80"} 0
+				nginx_ingress_controller_upstream_requests_active{controller_class="nginx",controller_namespace="default",controller_pod="pod",upstream="default-http-svc-80"} 3
+			`,
+			metrics: []string{
+				"nginx_ingress_controller_upstream_connections_total",
+				"nginx_ingress_controller_upstream_requests_active",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%v", nginx.StatusPort))
+			if err != nil {
+				t.Fatalf("crating unix listener: %s", err)
+			}
+
+			server := &httptest.Server{
+				Listener: listener,
+				Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path == KeepaliveStatsPath {
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, c.mock)
+						return
+					}
+
+					w.WriteHeader(http.StatusNotFound)
+				})},
+			}
+			server.Start()
+
+			time.Sleep(1 * time.Second)
+
+			cm, err := NewKeepaliveCollector("pod", "default", "nginx")
+			if err != nil {
+				t.Errorf("unexpected error creating keepalive collector: %v", err)
+			}
+
+			go cm.Start()
+
+			reg := prometheus.NewPedanticRegistry()
+			if err := reg.Register(cm); err != nil {
+				t.Errorf("registering collector failed: %s", err)
+			}
+
+			if err := GatherAndCompare(cm, c.want, c.metrics, reg); err != nil {
+				t.Errorf("unexpected collecting result:\n%s", err)
+			}
+
+			reg.Unregister(cm)
+
+			server.Close()
+			cm.Stop()
+
+			listener.Close()
+		})
+	}
+}
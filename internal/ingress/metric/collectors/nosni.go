@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"encoding/json"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-nginx/internal/nginx"
+	"k8s.io/klog/v2"
+)
+
+// NoSNIHandshakesPath defines the path used to expose the number of TLS
+// handshakes without SNI
+const NoSNIHandshakesPath = "/configuration/no-sni"
+
+type noSNICollector struct {
+	scrapeChan chan scrapeRequest
+
+	handshakes *prometheus.Desc
+}
+
+// NoSNICollector defines a collector of the TLS handshakes without SNI
+type NoSNICollector interface {
+	prometheus.Collector
+
+	Start()
+	Stop()
+}
+
+// NewNoSNICollector returns a new prometheus collector of the TLS handshakes
+// of the clients without SNI counted by the Lua certificate handler
+func NewNoSNICollector(podName, namespace, ingressClass string) (NoSNICollector, error) {
+	p := noSNICollector{
+		scrapeChan: make(chan scrapeRequest),
+	}
+
+	constLabels := prometheus.Labels{
+		"controller_namespace": namespace,
+		"controller_class":     ingressClass,
+		"controller_pod":       podName,
+	}
+
+	p.handshakes = prometheus.NewDesc(
+		prometheus.BuildFQName(PrometheusNamespace, "", "ssl_handshakes_without_sni_total"),
+		"total number of TLS handshakes of clients without SNI by action {default-certificate, reject, server}",
+		[]string{"action"}, constLabels)
+
+	return p, nil
+}
+
+// Describe implements prometheus.Collector.
+func (p noSNICollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.handshakes
+}
+
+// Collect implements prometheus.Collector.
+func (p noSNICollector) Collect(ch chan<- prometheus.Metric) {
+	req := scrapeRequest{results: ch, done: make(chan struct{})}
+	p.scrapeChan <- req
+	<-req.done
+}
+
+func (p noSNICollector) Start() {
+	for req := range p.scrapeChan {
+		ch := req.results
+		p.scrape(ch)
+		req.done <- struct{}{}
+	}
+}
+
+func (p noSNICollector) Stop() {
+	close(p.scrapeChan)
+}
+
+// scrape obtains the TLS handshakes without SNI from the Lua endpoint
+func (p noSNICollector) scrape(ch chan<- prometheus.Metric) {
+	klog.V(3).InfoS("starting scraping TLS handshakes without SNI", "path", NoSNIHandshakesPath)
+	status, data, err := nginx.NewGetStatusRequest(NoSNIHandshakesPath)
+	if err != nil {
+		klog.Warningf("unexpected error obtaining TLS handshakes without SNI: %v", err)
+		return
+	}
+
+	if status < 200 || status >= 400 {
+		klog.Warningf("unexpected error obtaining TLS handshakes without SNI (status %v)", status)
+		return
+	}
+
+	handshakes := map[string]int{}
+	err = json.Unmarshal(data, &handshakes)
+	if err != nil {
+		klog.Warningf("unexpected error decoding TLS handshakes without SNI: %v", err)
+		return
+	}
+
+	for action, count := range handshakes {
+		ch <- prometheus.MustNewConstMetric(p.handshakes,
+			prometheus.CounterValue, float64(count), action)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+func TestNoSNICollector(t *testing.T) {
+	cases := []struct {
+		name    string
+		mock    string
+		metrics []string
+		want    string
+	}{
+		{
+			name:    "should return nothing without handshakes",
+			mock:    `{}`,
+			want:    ``,
+			metrics: []string{"nginx_ingress_controller_ssl_handshakes_without_sni_total"},
+		},
+		{
+			name: "should return the handshakes of each action",
+			mock: `{"default-certificate": 12, "reject": 3}`,
+			want: `
+				# HELP nginx_ingress_controller_ssl_handshakes_without_sni_total total number of TLS handshakes of clients without SNI by action {default-certificate, reject, server}
+				# TYPE nginx_ingress_controller_ssl_handshakes_without_sni_total counter
+				nginx_ingress_controller_ssl_handshakes_without_sni_total{action="default-certificate",controller_class="nginx",controller_namespace="default",controller_pod="pod"} 12
+				nginx_ingress_controller_ssl_handshakes_without_sni_total{action="reject",controller_class="nginx",controller_namespace="default",controller_pod="pod"} 3
+			`,
+			metrics: []string{"nginx_ingress_controller_ssl_handshakes_without_sni_total"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", fmt.Sprintf(":%v", nginx.StatusPort))
+			if err != nil {
+				t.Fatalf("crating unix listener: %s", err)
+			}
+
+			server := &httptest.Server{
+				Listener: listener,
+				Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path == NoSNIHandshakesPath {
+						w.WriteHeader(http.StatusOK)
+						fmt.Fprint(w, c.mock)
+						return
+					}
+
+					w.WriteHeader(http.StatusNotFound)
+				})},
+			}
+			server.Start()
+
+			time.Sleep(1 * time.Second)
+
+			cm, err := NewNoSNICollector("pod", "default", "nginx")
+			if err != nil {
+				t.Errorf("unexpected error creating no SNI collector: %v", err)
+			}
+
+			go cm.Start()
+
+			reg := prometheus.NewPedanticRegistry()
+			if err := reg.Register(cm); err != nil {
+				t.Errorf("registering collector failed: %s", err)
+			}
+
+			if err := GatherAndCompare(cm, c.want, c.metrics, reg); err != nil {
+				t.Errorf("unexpected collecting result:\n%s", err)
+			}
+
+			reg.Unregister(cm)
+
+			server.Close()
+			cm.Stop()
+
+			listener.Close()
+		})
+	}
+}
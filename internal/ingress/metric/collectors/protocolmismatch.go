@@ -0,0 +1,103 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ProtocolMismatch identifies the failures of the protocol negotiation with
+// the upstreams of a backend
+type ProtocolMismatch struct {
+	// Backend is the name of the backend
+	Backend string
+	// Reason is the error of the negotiation, tls-handshake for a TLS
+	// handshake with a plaintext upstream, http2-framing for an upstream of
+	// gRPC requests not speaking HTTP/2
+	Reason string
+}
+
+// ProtocolMismatchCollector counts the failures of the protocol negotiation
+// with the upstreams of the backends
+type ProtocolMismatchCollector struct {
+	prometheus.Collector
+
+	mismatches *prometheus.CounterVec
+
+	mu    sync.RWMutex
+	stats map[ProtocolMismatch]uint64
+}
+
+// NewProtocolMismatchCollector creates a new ProtocolMismatchCollector instance
+func NewProtocolMismatchCollector(pod, namespace, class string) *ProtocolMismatchCollector {
+	return &ProtocolMismatchCollector{
+		mismatches: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:      "backend_protocol_mismatches",
+				Help:      "The total number of failures of the protocol negotiation with the upstreams of the backends.",
+				Namespace: PrometheusNamespace,
+				ConstLabels: prometheus.Labels{
+					"controller_namespace": namespace,
+					"controller_class":     class,
+					"controller_pod":       pod,
+				},
+			},
+			[]string{"backend", "scheme", "reason"},
+		),
+
+		stats: map[ProtocolMismatch]uint64{},
+	}
+}
+
+// observe accounts a failure of the protocol negotiation
+func (pc *ProtocolMismatchCollector) observe(stats socketData) {
+	pc.mismatches.With(prometheus.Labels{
+		"backend": stats.Upstream,
+		"scheme":  stats.UpstreamScheme,
+		"reason":  stats.ProtocolMismatch,
+	}).Inc()
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.stats[ProtocolMismatch{Backend: stats.Upstream, Reason: stats.ProtocolMismatch}]++
+}
+
+// Stats returns the totals of the failures by backend and reason
+func (pc *ProtocolMismatchCollector) Stats() map[ProtocolMismatch]uint64 {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	stats := make(map[ProtocolMismatch]uint64, len(pc.stats))
+	for mismatch, total := range pc.stats {
+		stats[mismatch] = total
+	}
+
+	return stats
+}
+
+// Describe implements prometheus.Collector
+func (pc *ProtocolMismatchCollector) Describe(ch chan<- *prometheus.Desc) {
+	pc.mismatches.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (pc *ProtocolMismatchCollector) Collect(ch chan<- prometheus.Metric) {
+	pc.mismatches.Collect(ch)
+}
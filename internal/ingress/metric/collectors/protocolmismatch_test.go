@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collectors
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestProtocolMismatchCollector(t *testing.T) {
+	sc, err := NewSocketCollector("pod", "default", "nginx", true)
+	if err != nil {
+		t.Fatalf("unexpected error creating socket collector: %v", err)
+	}
+	sc.SetHosts(sets.NewString("example.com"))
+
+	pc := NewProtocolMismatchCollector("pod", "default", "nginx")
+	sc.SetProtocolMismatch(pc)
+
+	// the failures are not tied to the requests of a host
+	sc.handleMessage([]byte(`[
+		{"protocolMismatch": "tls-handshake", "upstream": "default-web-8080", "upstreamScheme": "https"},
+		{"protocolMismatch": "tls-handshake", "upstream": "default-web-8080", "upstreamScheme": "https"},
+		{"protocolMismatch": "http2-framing", "upstream": "default-grpc-50051", "upstreamScheme": "grpc"}
+	]`))
+
+	expected := map[ProtocolMismatch]uint64{
+		{Backend: "default-web-8080", Reason: "tls-handshake"}:   2,
+		{Backend: "default-grpc-50051", Reason: "http2-framing"}: 1,
+	}
+	if stats := pc.Stats(); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected %+v but got %+v", expected, stats)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(pc); err != nil {
+		t.Fatalf("registering collector failed: %s", err)
+	}
+
+	want := `
+		# HELP nginx_ingress_controller_backend_protocol_mismatches The total number of failures of the protocol negotiation with the upstreams of the backends.
+		# TYPE nginx_ingress_controller_backend_protocol_mismatches counter
+		nginx_ingress_controller_backend_protocol_mismatches{backend="default-grpc-50051",controller_class="nginx",controller_namespace="default",controller_pod="pod",reason="http2-framing",scheme="grpc"} 1
+		nginx_ingress_controller_backend_protocol_mismatches{backend="default-web-8080",controller_class="nginx",controller_namespace="default",controller_pod="pod",reason="tls-handshake",scheme="https"} 2
+	`
+	if err := GatherAndCompare(pc, want, []string{"nginx_ingress_controller_backend_protocol_mismatches"}, reg); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
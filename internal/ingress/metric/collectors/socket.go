@@ -54,6 +54,46 @@ type socketData struct {
 	Ingress   string `json:"ingress"`
 	Service   string `json:"service"`
 	Path      string `json:"path"`
+
+	// Tenant contains the tenant of the request, extracted from the sources
+	// defined in the tenant-id-* settings
+	Tenant string `json:"tenant"`
+
+	// Rejection contains the reason of the rejection of requests
+	// rejected by the strict request parsing
+	Rejection string `json:"rejection"`
+
+	// GlobalRateLimitError contains the fail policy applied to requests
+	// that could not reach the global rate limit store
+	GlobalRateLimitError string `json:"globalRateLimitError"`
+
+	// RateLimitDecision contains the decision of the global rate limit,
+	// allow or deny, for the counters in RateLimitNamespace
+	RateLimitDecision  string `json:"rateLimitDecision"`
+	RateLimitNamespace string `json:"rateLimitNamespace"`
+	// RateLimitDelay contains the time in seconds the request was delayed
+	// by the burst of the global rate limit
+	RateLimitDelay float64 `json:"rateLimitDelay"`
+
+	// CanaryUpstream contains the canary backend the request was routed to
+	CanaryUpstream string `json:"canaryUpstream"`
+
+	// Protocol contains the HTTP version of the request, like HTTP/1.1 or HTTP/2.0
+	Protocol string `json:"protocol"`
+	// Upgrade contains the protocol carried by the request, websocket for
+	// the upgraded connections, grpc or grpc-web for the gRPC streams
+	Upgrade string `json:"upgrade"`
+
+	// MaxRequestDurationExceeded is true for the requests terminated by the
+	// hard limit of the max-request-duration annotation
+	MaxRequestDurationExceeded bool `json:"maxRequestDurationExceeded"`
+
+	// ProtocolMismatch contains the reason of a failure of the protocol
+	// negotiation with an upstream of the backend Upstream, using the
+	// scheme UpstreamScheme. It is not tied to a request
+	ProtocolMismatch string `json:"protocolMismatch"`
+	Upstream         string `json:"upstream"`
+	UpstreamScheme   string `json:"upstreamScheme"`
 }
 
 // SocketCollector stores prometheus metrics and ingress meta-data
@@ -72,6 +112,20 @@ type SocketCollector struct {
 
 	requests *prometheus.CounterVec
 
+	tenantRequests *prometheus.CounterVec
+
+	rejectedRequests *prometheus.CounterVec
+
+	globalRateLimitStoreErrors *prometheus.CounterVec
+
+	rateLimitRequests *prometheus.CounterVec
+	rateLimitDelay    *prometheus.HistogramVec
+
+	protocolRequests *prometheus.CounterVec
+	protocolUpgrades *prometheus.CounterVec
+
+	maxRequestDurationExceeded *prometheus.CounterVec
+
 	listener net.Listener
 
 	metricMapping map[string]interface{}
@@ -79,6 +133,12 @@ type SocketCollector struct {
 	hosts sets.String
 
 	metricsPerHost bool
+
+	accounting *AccountingCollector
+
+	canary *CanaryCollector
+
+	protocolMismatch *ProtocolMismatchCollector
 }
 
 var (
@@ -180,6 +240,86 @@ func NewSocketCollector(pod, namespace, class string, metricsPerHost bool) (*Soc
 			[]string{"ingress", "namespace", "status", "service"},
 		),
 
+		tenantRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "tenant_requests",
+				Help:        "The total number of client requests of each tenant.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"ingress", "namespace", "tenant", "status"},
+		),
+
+		rejectedRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "rejected_requests",
+				Help:        "The total number of client requests rejected by the strict request parsing.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"ingress", "namespace", "reason"},
+		),
+
+		globalRateLimitStoreErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "global_rate_limit_store_errors",
+				Help:        "The total number of client requests that could not reach the global rate limit store.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"ingress", "namespace", "policy"},
+		),
+
+		rateLimitRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "ratelimit_requests_total",
+				Help:        "The total number of client requests allowed or denied by the global rate limit.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"ingress", "namespace", "ratelimit_namespace", "decision"},
+		),
+
+		rateLimitDelay: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        "ratelimit_delay_seconds",
+				Help:        "The time client requests were delayed by the burst of the global rate limit.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"ingress", "namespace", "ratelimit_namespace"},
+		),
+
+		protocolRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "protocol_requests",
+				Help:        "The total number of client requests of each HTTP version.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"ingress", "namespace", "protocol"},
+		),
+
+		protocolUpgrades: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "protocol_upgrades",
+				Help:        "The total number of WebSocket upgrades and gRPC streams.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"ingress", "namespace", "upgrade"},
+		),
+
+		maxRequestDurationExceeded: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "max_request_duration_exceeded",
+				Help:        "The total number of client requests terminated by their max duration.",
+				Namespace:   PrometheusNamespace,
+				ConstLabels: constLabels,
+			},
+			[]string{"ingress", "namespace", "service"},
+		),
+
 		bytesSent: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:        "bytes_sent",
@@ -213,6 +353,8 @@ func NewSocketCollector(pod, namespace, class string, metricsPerHost bool) (*Soc
 		prometheus.BuildFQName(PrometheusNamespace, "", "bytes_sent"): sc.bytesSent,
 
 		prometheus.BuildFQName(PrometheusNamespace, "", "ingress_upstream_latency_seconds"): sc.upstreamLatency,
+
+		prometheus.BuildFQName(PrometheusNamespace, "", "ratelimit_delay_seconds"): sc.rateLimitDelay,
 	}
 
 	return sc, nil
@@ -230,11 +372,63 @@ func (sc *SocketCollector) handleMessage(msg []byte) {
 	}
 
 	for _, stats := range statsBatch {
+		if stats.ProtocolMismatch != "" {
+			if sc.protocolMismatch != nil {
+				sc.protocolMismatch.observe(stats)
+			}
+
+			continue
+		}
+
 		if sc.metricsPerHost && !sc.hosts.Has(stats.Host) {
 			klog.V(3).InfoS("Skipping metric for host not being served", "host", stats.Host)
 			continue
 		}
 
+		// the request itself is reported again at the end of the request
+		if stats.GlobalRateLimitError != "" {
+			errorsMetric, err := sc.globalRateLimitStoreErrors.GetMetricWith(prometheus.Labels{
+				"namespace": stats.Namespace,
+				"ingress":   stats.Ingress,
+				"policy":    stats.GlobalRateLimitError,
+			})
+			if err != nil {
+				klog.ErrorS(err, "Error fetching global rate limit store errors metric")
+			} else {
+				errorsMetric.Inc()
+			}
+
+			continue
+		}
+
+		if stats.RateLimitDecision != "" {
+			sc.observeRateLimit(stats)
+			continue
+		}
+
+		if sc.accounting != nil {
+			sc.accounting.observe(stats)
+		}
+
+		if sc.canary != nil {
+			sc.canary.observe(stats)
+		}
+
+		if stats.Rejection != "" {
+			rejectedMetric, err := sc.rejectedRequests.GetMetricWith(prometheus.Labels{
+				"namespace": stats.Namespace,
+				"ingress":   stats.Ingress,
+				"reason":    stats.Rejection,
+			})
+			if err != nil {
+				klog.ErrorS(err, "Error fetching rejected requests metric")
+			} else {
+				rejectedMetric.Inc()
+			}
+
+			continue
+		}
+
 		// Note these must match the order in requestTags at the top
 		requestLabels := prometheus.Labels{
 			"status":    stats.Status,
@@ -268,6 +462,31 @@ func (sc *SocketCollector) handleMessage(msg []byte) {
 			requestsMetric.Inc()
 		}
 
+		sc.observeProtocol(stats)
+
+		if stats.Tenant != "" {
+			tenantMetric, err := sc.tenantRequests.GetMetricWith(prometheus.Labels{
+				"namespace": stats.Namespace,
+				"ingress":   stats.Ingress,
+				"tenant":    stats.Tenant,
+				"status":    stats.Status,
+			})
+			if err != nil {
+				klog.ErrorS(err, "Error fetching tenant requests metric")
+			} else {
+				tenantMetric.Inc()
+			}
+		}
+
+		if stats.MaxRequestDurationExceeded {
+			exceededMetric, err := sc.maxRequestDurationExceeded.GetMetricWith(latencyLabels)
+			if err != nil {
+				klog.ErrorS(err, "Error fetching max request duration metric")
+			} else {
+				exceededMetric.Inc()
+			}
+		}
+
 		if stats.Latency != -1 {
 			latencyMetric, err := sc.upstreamLatency.GetMetricWith(latencyLabels)
 			if err != nil {
@@ -322,6 +541,69 @@ func (sc *SocketCollector) handleMessage(msg []byte) {
 	}
 }
 
+// observeRateLimit counts the decision of the global rate limit and the
+// time the request was delayed
+func (sc *SocketCollector) observeRateLimit(stats socketData) {
+	labels := prometheus.Labels{
+		"namespace":           stats.Namespace,
+		"ingress":             stats.Ingress,
+		"ratelimit_namespace": stats.RateLimitNamespace,
+	}
+
+	decisionLabels := prometheus.Labels{"decision": stats.RateLimitDecision}
+	for k, v := range labels {
+		decisionLabels[k] = v
+	}
+
+	requestsMetric, err := sc.rateLimitRequests.GetMetricWith(decisionLabels)
+	if err != nil {
+		klog.ErrorS(err, "Error fetching rate limit requests metric")
+	} else {
+		requestsMetric.Inc()
+	}
+
+	if stats.RateLimitDelay <= 0 {
+		return
+	}
+
+	delayMetric, err := sc.rateLimitDelay.GetMetricWith(labels)
+	if err != nil {
+		klog.ErrorS(err, "Error fetching rate limit delay metric")
+	} else {
+		delayMetric.Observe(stats.RateLimitDelay)
+	}
+}
+
+// observeProtocol counts the HTTP version of the request and the WebSocket
+// upgrade or the gRPC stream it carried
+func (sc *SocketCollector) observeProtocol(stats socketData) {
+	if stats.Protocol != "" {
+		protocolMetric, err := sc.protocolRequests.GetMetricWith(prometheus.Labels{
+			"namespace": stats.Namespace,
+			"ingress":   stats.Ingress,
+			"protocol":  stats.Protocol,
+		})
+		if err != nil {
+			klog.ErrorS(err, "Error fetching protocol requests metric")
+		} else {
+			protocolMetric.Inc()
+		}
+	}
+
+	if stats.Upgrade != "" {
+		upgradeMetric, err := sc.protocolUpgrades.GetMetricWith(prometheus.Labels{
+			"namespace": stats.Namespace,
+			"ingress":   stats.Ingress,
+			"upgrade":   stats.Upgrade,
+		})
+		if err != nil {
+			klog.ErrorS(err, "Error fetching protocol upgrades metric")
+		} else {
+			upgradeMetric.Inc()
+		}
+	}
+}
+
 // Start listen for connections in the unix socket and spawns a goroutine to process the content
 func (sc *SocketCollector) Start() {
 	for {
@@ -409,6 +691,14 @@ func (sc SocketCollector) Describe(ch chan<- *prometheus.Desc) {
 	sc.requestLength.Describe(ch)
 
 	sc.requests.Describe(ch)
+	sc.tenantRequests.Describe(ch)
+	sc.rejectedRequests.Describe(ch)
+	sc.globalRateLimitStoreErrors.Describe(ch)
+	sc.rateLimitRequests.Describe(ch)
+	sc.rateLimitDelay.Describe(ch)
+	sc.protocolRequests.Describe(ch)
+	sc.protocolUpgrades.Describe(ch)
+	sc.maxRequestDurationExceeded.Describe(ch)
 
 	sc.upstreamLatency.Describe(ch)
 
@@ -424,6 +714,14 @@ func (sc SocketCollector) Collect(ch chan<- prometheus.Metric) {
 	sc.requestLength.Collect(ch)
 
 	sc.requests.Collect(ch)
+	sc.tenantRequests.Collect(ch)
+	sc.rejectedRequests.Collect(ch)
+	sc.globalRateLimitStoreErrors.Collect(ch)
+	sc.rateLimitRequests.Collect(ch)
+	sc.rateLimitDelay.Collect(ch)
+	sc.protocolRequests.Collect(ch)
+	sc.protocolUpgrades.Collect(ch)
+	sc.maxRequestDurationExceeded.Collect(ch)
 
 	sc.upstreamLatency.Collect(ch)
 
@@ -439,6 +737,22 @@ func (sc *SocketCollector) SetHosts(hosts sets.String) {
 	sc.hosts = hosts
 }
 
+// SetAccounting sets the collector used to account the requests by tenant
+func (sc *SocketCollector) SetAccounting(accounting *AccountingCollector) {
+	sc.accounting = accounting
+}
+
+// SetCanary sets the collector of the requests routed to the canary backends
+func (sc *SocketCollector) SetCanary(canary *CanaryCollector) {
+	sc.canary = canary
+}
+
+// SetProtocolMismatch sets the collector of the failures of the protocol
+// negotiation with the upstreams
+func (sc *SocketCollector) SetProtocolMismatch(protocolMismatch *ProtocolMismatchCollector) {
+	sc.protocolMismatch = protocolMismatch
+}
+
 // handleMessages process the content received in a network connection
 func handleMessages(conn io.ReadCloser, fn func([]byte)) {
 	defer conn.Close()
@@ -282,6 +282,201 @@ func TestCollector(t *testing.T) {
 			wantAfter: `
 			`,
 		},
+		{
+			name: "rejected requests should only increase the rejected requests metric",
+			data: []string{`[{
+				"host":"testshop.com",
+				"method":"POST",
+				"path":"/admin",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"rejection":"content_length_with_transfer_encoding"
+			}]`},
+			metrics: []string{"nginx_ingress_controller_rejected_requests", "nginx_ingress_controller_requests"},
+			wantBefore: `
+				# HELP nginx_ingress_controller_rejected_requests The total number of client requests rejected by the strict request parsing.
+				# TYPE nginx_ingress_controller_rejected_requests counter
+				nginx_ingress_controller_rejected_requests{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",reason="content_length_with_transfer_encoding"} 1
+			`,
+		},
+		{
+			name: "requests with a tenant should increase the tenant requests metric",
+			data: []string{`[{
+				"host":"testshop.com",
+				"status":"200",
+				"method":"GET",
+				"path":"/admin",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"tenant":"acme",
+				"requestLength":-1,
+				"requestTime":-1,
+				"responseLength":-1,
+				"upstreamLatency":-1,
+				"upstreamResponseTime":-1,
+				"upstreamResponseLength":-1
+			}]`},
+			metrics: []string{"nginx_ingress_controller_tenant_requests"},
+			wantBefore: `
+				# HELP nginx_ingress_controller_tenant_requests The total number of client requests of each tenant.
+				# TYPE nginx_ingress_controller_tenant_requests counter
+				nginx_ingress_controller_tenant_requests{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",status="200",tenant="acme"} 1
+			`,
+		},
+		{
+			name: "requests should increase the protocol metrics",
+			data: []string{`[{
+				"host":"testshop.com",
+				"status":"101",
+				"method":"GET",
+				"path":"/ws",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"protocol":"HTTP/1.1",
+				"upgrade":"websocket",
+				"requestLength":-1,
+				"requestTime":-1,
+				"responseLength":-1,
+				"upstreamLatency":-1,
+				"upstreamResponseTime":-1,
+				"upstreamResponseLength":-1
+			},{
+				"host":"testshop.com",
+				"status":"200",
+				"method":"POST",
+				"path":"/",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"protocol":"HTTP/2.0",
+				"upgrade":"grpc",
+				"requestLength":-1,
+				"requestTime":-1,
+				"responseLength":-1,
+				"upstreamLatency":-1,
+				"upstreamResponseTime":-1,
+				"upstreamResponseLength":-1
+			},{
+				"host":"testshop.com",
+				"status":"200",
+				"method":"GET",
+				"path":"/",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"protocol":"HTTP/2.0",
+				"requestLength":-1,
+				"requestTime":-1,
+				"responseLength":-1,
+				"upstreamLatency":-1,
+				"upstreamResponseTime":-1,
+				"upstreamResponseLength":-1
+			}]`},
+			metrics: []string{"nginx_ingress_controller_protocol_requests", "nginx_ingress_controller_protocol_upgrades"},
+			wantBefore: `
+				# HELP nginx_ingress_controller_protocol_requests The total number of client requests of each HTTP version.
+				# TYPE nginx_ingress_controller_protocol_requests counter
+				nginx_ingress_controller_protocol_requests{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",protocol="HTTP/1.1"} 1
+				nginx_ingress_controller_protocol_requests{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",protocol="HTTP/2.0"} 2
+				# HELP nginx_ingress_controller_protocol_upgrades The total number of WebSocket upgrades and gRPC streams.
+				# TYPE nginx_ingress_controller_protocol_upgrades counter
+				nginx_ingress_controller_protocol_upgrades{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",upgrade="grpc"} 1
+				nginx_ingress_controller_protocol_upgrades{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",upgrade="websocket"} 1
+			`,
+		},
+		{
+			name: "requests terminated by their max duration should increase the max request duration metric",
+			data: []string{`[{
+				"host":"testshop.com",
+				"status":"504",
+				"method":"GET",
+				"path":"/reports",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"maxRequestDurationExceeded":true,
+				"requestLength":-1,
+				"requestTime":-1,
+				"responseLength":-1,
+				"upstreamLatency":-1,
+				"upstreamResponseTime":-1,
+				"upstreamResponseLength":-1
+			}]`},
+			metrics: []string{"nginx_ingress_controller_max_request_duration_exceeded"},
+			wantBefore: `
+				# HELP nginx_ingress_controller_max_request_duration_exceeded The total number of client requests terminated by their max duration.
+				# TYPE nginx_ingress_controller_max_request_duration_exceeded counter
+				nginx_ingress_controller_max_request_duration_exceeded{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",service="test-app"} 1
+			`,
+		},
+		{
+			name: "global rate limit store errors should only increase the store errors metric",
+			data: []string{`[{
+				"host":"testshop.com",
+				"method":"GET",
+				"path":"/admin",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"globalRateLimitError":"deny"
+			}]`},
+			metrics: []string{"nginx_ingress_controller_global_rate_limit_store_errors", "nginx_ingress_controller_requests"},
+			wantBefore: `
+				# HELP nginx_ingress_controller_global_rate_limit_store_errors The total number of client requests that could not reach the global rate limit store.
+				# TYPE nginx_ingress_controller_global_rate_limit_store_errors counter
+				nginx_ingress_controller_global_rate_limit_store_errors{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",policy="deny"} 1
+			`,
+		},
+		{
+			name: "global rate limit decisions should only increase the rate limit metrics",
+			data: []string{`[{
+				"host":"testshop.com",
+				"method":"GET",
+				"path":"/admin",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"rateLimitDecision":"allow",
+				"rateLimitNamespace":"31285d47b1504dcfbd6f12c46d769f6e",
+				"rateLimitDelay":1.5
+			}, {
+				"host":"testshop.com",
+				"method":"GET",
+				"path":"/admin",
+				"namespace":"test-app-production",
+				"ingress":"web-yml",
+				"service":"test-app",
+				"rateLimitDecision":"deny",
+				"rateLimitNamespace":"31285d47b1504dcfbd6f12c46d769f6e",
+				"rateLimitDelay":0
+			}]`},
+			metrics: []string{"nginx_ingress_controller_ratelimit_requests_total", "nginx_ingress_controller_ratelimit_delay_seconds", "nginx_ingress_controller_requests"},
+			wantBefore: `
+				# HELP nginx_ingress_controller_ratelimit_delay_seconds The time client requests were delayed by the burst of the global rate limit.
+				# TYPE nginx_ingress_controller_ratelimit_delay_seconds histogram
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="0.005"} 0
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="0.01"} 0
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="0.025"} 0
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="0.05"} 0
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="0.1"} 0
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="0.25"} 0
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="0.5"} 0
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="1"} 0
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="2.5"} 1
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="5"} 1
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="10"} 1
+				nginx_ingress_controller_ratelimit_delay_seconds_bucket{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e",le="+Inf"} 1
+				nginx_ingress_controller_ratelimit_delay_seconds_sum{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e"} 1.5
+				nginx_ingress_controller_ratelimit_delay_seconds_count{controller_class="ingress",controller_namespace="default",controller_pod="pod",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e"} 1
+				# HELP nginx_ingress_controller_ratelimit_requests_total The total number of client requests allowed or denied by the global rate limit.
+				# TYPE nginx_ingress_controller_ratelimit_requests_total counter
+				nginx_ingress_controller_ratelimit_requests_total{controller_class="ingress",controller_namespace="default",controller_pod="pod",decision="allow",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e"} 1
+				nginx_ingress_controller_ratelimit_requests_total{controller_class="ingress",controller_namespace="default",controller_pod="pod",decision="deny",ingress="web-yml",namespace="test-app-production",ratelimit_namespace="31285d47b1504dcfbd6f12c46d769f6e"} 1
+			`,
+		},
 	}
 
 	for _, c := range cases {
@@ -19,6 +19,7 @@ package metric
 import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/metric/collectors"
 )
 
 // NewDummyCollector returns a dummy metric collector
@@ -38,6 +39,9 @@ func (dc DummyCollector) IncReloadCount() {}
 // IncReloadErrorCount ...
 func (dc DummyCollector) IncReloadErrorCount() {}
 
+// IncSyncStallCount ...
+func (dc DummyCollector) IncSyncStallCount() {}
+
 // IncCheckCount ...
 func (dc DummyCollector) IncCheckCount(string, string) {}
 
@@ -59,6 +63,40 @@ func (dc DummyCollector) SetSSLExpireTime([]*ingress.Server) {}
 // SetHosts ...
 func (dc DummyCollector) SetHosts(hosts sets.String) {}
 
+// SetAccountingTenants ...
+func (dc DummyCollector) SetAccountingTenants([]*ingress.Ingress) {}
+
+// SetIngressLabels ...
+func (dc DummyCollector) SetIngressLabels([]*ingress.Ingress, map[string]string) {}
+
+// SetDeprecatedAnnotations ...
+func (dc DummyCollector) SetDeprecatedAnnotations([]*ingress.Ingress) {}
+
+// ObserveAnnotationErrors ...
+func (dc DummyCollector) ObserveAnnotationErrors([]*ingress.Ingress) {}
+
+// SetIgnoredIngresses ...
+func (dc DummyCollector) SetIgnoredIngresses([]collectors.IgnoredIngress) {}
+
+// SetConfigurationSize ...
+func (dc DummyCollector) SetConfigurationSize(int, int, []string) {}
+
+// SetConfigurationFileHash ...
+func (dc DummyCollector) SetConfigurationFileHash(string) {}
+
+// SetShadowValidation ...
+func (dc DummyCollector) SetShadowValidation(bool, []collectors.ShadowDivergence) {}
+
+// CanaryStats ...
+func (dc DummyCollector) CanaryStats() map[string]collectors.CanaryStats {
+	return nil
+}
+
+// ProtocolMismatchStats ...
+func (dc DummyCollector) ProtocolMismatchStats() map[collectors.ProtocolMismatch]uint64 {
+	return nil
+}
+
 // OnStartedLeading indicates the pod is not the current leader
 func (dc DummyCollector) OnStartedLeading(electionID string) {}
 
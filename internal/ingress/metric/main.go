@@ -36,6 +36,8 @@ type Collector interface {
 
 	IncReloadCount()
 	IncReloadErrorCount()
+	// IncSyncStallCount counts the synchronizations stalled with pending events
+	IncSyncStallCount()
 
 	OnStartedLeading(string)
 	OnStoppedLeading(string)
@@ -49,6 +51,30 @@ type Collector interface {
 
 	// SetHosts sets the hostnames that are being served by the ingress controller
 	SetHosts(sets.String)
+	// SetAccountingTenants sets the ingresses used to find the tenant of the requests
+	SetAccountingTenants([]*ingress.Ingress)
+	// SetIngressLabels sets the ingresses and the labels exposed in the ingress_labels metric
+	SetIngressLabels([]*ingress.Ingress, map[string]string)
+	// SetDeprecatedAnnotations sets the ingresses to find the deprecated annotations in use
+	SetDeprecatedAnnotations([]*ingress.Ingress)
+	// ObserveAnnotationErrors counts the annotations rejected by their parser
+	ObserveAnnotationErrors([]*ingress.Ingress)
+	// SetIgnoredIngresses sets the ingresses that do not route any request to their backends
+	SetIgnoredIngresses([]collectors.IgnoredIngress)
+	// SetConfigurationSize sets the size and the number of servers of the
+	// generated configuration, with the limits it exceeds
+	SetConfigurationSize(size, servers int, exceeded []string)
+	// SetConfigurationFileHash sets the checksum of the configuration files
+	// applied by the last reload
+	SetConfigurationFileHash(hash string)
+	// SetShadowValidation sets the result of a validation of the shadow mode
+	// and the ingresses diverging from the serving controllers
+	SetShadowValidation(valid bool, divergences []collectors.ShadowDivergence)
+	// CanaryStats returns the totals of the requests by canary backend
+	CanaryStats() map[string]collectors.CanaryStats
+	// ProtocolMismatchStats returns the totals of the failures of the
+	// protocol negotiation with the upstreams by backend and reason
+	ProtocolMismatchStats() map[collectors.ProtocolMismatch]uint64
 
 	Start()
 	Stop()
@@ -57,6 +83,12 @@ type Collector interface {
 type collector struct {
 	nginxStatus  collectors.NGINXStatusCollector
 	nginxProcess collectors.NGINXProcessCollector
+	keepalive    collectors.KeepaliveCollector
+	noSNI        collectors.NoSNICollector
+	accounting   *collectors.AccountingCollector
+	labels       *collectors.IngressLabelsCollector
+	canary       *collectors.CanaryCollector
+	mismatches   *collectors.ProtocolMismatchCollector
 
 	ingressController *collectors.Controller
 
@@ -66,7 +98,7 @@ type collector struct {
 }
 
 // NewCollector creates a new metric collector the for ingress controller
-func NewCollector(metricsPerHost bool, registry *prometheus.Registry) (Collector, error) {
+func NewCollector(metricsPerHost bool, accounting collectors.AccountingConfig, registry *prometheus.Registry) (Collector, error) {
 	podNamespace := os.Getenv("POD_NAMESPACE")
 	if podNamespace == "" {
 		podNamespace = "default"
@@ -84,16 +116,46 @@ func NewCollector(metricsPerHost bool, registry *prometheus.Registry) (Collector
 		return nil, err
 	}
 
+	kc, err := collectors.NewKeepaliveCollector(podName, podNamespace, class.IngressClass)
+	if err != nil {
+		return nil, err
+	}
+
+	nsc, err := collectors.NewNoSNICollector(podName, podNamespace, class.IngressClass)
+	if err != nil {
+		return nil, err
+	}
+
 	s, err := collectors.NewSocketCollector(podName, podNamespace, class.IngressClass, metricsPerHost)
 	if err != nil {
 		return nil, err
 	}
 
+	var ac *collectors.AccountingCollector
+	if accounting.Enabled {
+		ac = collectors.NewAccountingCollector(podName, podNamespace, class.IngressClass, accounting)
+		s.SetAccounting(ac)
+	}
+
 	ic := collectors.NewController(podName, podNamespace, class.IngressClass)
 
+	lc := collectors.NewIngressLabelsCollector(podName, podNamespace, class.IngressClass)
+
+	cc := collectors.NewCanaryCollector(podName, podNamespace, class.IngressClass)
+	s.SetCanary(cc)
+
+	pmc := collectors.NewProtocolMismatchCollector(podName, podNamespace, class.IngressClass)
+	s.SetProtocolMismatch(pmc)
+
 	return Collector(&collector{
 		nginxStatus:  nc,
 		nginxProcess: pc,
+		keepalive:    kc,
+		noSNI:        nsc,
+		accounting:   ac,
+		labels:       lc,
+		canary:       cc,
+		mismatches:   pmc,
 
 		ingressController: ic,
 
@@ -123,6 +185,10 @@ func (c *collector) IncReloadErrorCount() {
 	c.ingressController.IncReloadErrorCount()
 }
 
+func (c *collector) IncSyncStallCount() {
+	c.ingressController.IncSyncStallCount()
+}
+
 func (c *collector) RemoveMetrics(ingresses, hosts []string) {
 	c.socket.RemoveMetrics(ingresses, c.registry)
 	c.ingressController.RemoveMetrics(hosts, c.registry)
@@ -131,8 +197,18 @@ func (c *collector) RemoveMetrics(ingresses, hosts []string) {
 func (c *collector) Start() {
 	c.registry.MustRegister(c.nginxStatus)
 	c.registry.MustRegister(c.nginxProcess)
+	c.registry.MustRegister(c.keepalive)
+	c.registry.MustRegister(c.noSNI)
 	c.registry.MustRegister(c.ingressController)
 	c.registry.MustRegister(c.socket)
+	c.registry.MustRegister(c.labels)
+	c.registry.MustRegister(c.canary)
+	c.registry.MustRegister(c.mismatches)
+
+	if c.accounting != nil {
+		c.registry.MustRegister(c.accounting)
+		go c.accounting.Start()
+	}
 
 	// the default nginx.conf does not contains
 	// a server section with the status port
@@ -140,6 +216,14 @@ func (c *collector) Start() {
 		time.Sleep(5 * time.Second)
 		c.nginxStatus.Start()
 	}()
+	go func() {
+		time.Sleep(5 * time.Second)
+		c.keepalive.Start()
+	}()
+	go func() {
+		time.Sleep(5 * time.Second)
+		c.noSNI.Start()
+	}()
 	go c.nginxProcess.Start()
 	go c.socket.Start()
 }
@@ -147,12 +231,24 @@ func (c *collector) Start() {
 func (c *collector) Stop() {
 	c.registry.Unregister(c.nginxStatus)
 	c.registry.Unregister(c.nginxProcess)
+	c.registry.Unregister(c.keepalive)
+	c.registry.Unregister(c.noSNI)
 	c.registry.Unregister(c.ingressController)
 	c.registry.Unregister(c.socket)
+	c.registry.Unregister(c.labels)
+	c.registry.Unregister(c.canary)
+	c.registry.Unregister(c.mismatches)
 
 	c.nginxStatus.Stop()
 	c.nginxProcess.Stop()
+	c.keepalive.Stop()
+	c.noSNI.Stop()
 	c.socket.Stop()
+
+	if c.accounting != nil {
+		c.registry.Unregister(c.accounting)
+		c.accounting.Stop()
+	}
 }
 
 func (c *collector) SetSSLExpireTime(servers []*ingress.Server) {
@@ -168,6 +264,48 @@ func (c *collector) SetHosts(hosts sets.String) {
 	c.socket.SetHosts(hosts)
 }
 
+func (c *collector) SetAccountingTenants(ingresses []*ingress.Ingress) {
+	if c.accounting != nil {
+		c.accounting.SetTenants(ingresses)
+	}
+}
+
+func (c *collector) SetIngressLabels(ingresses []*ingress.Ingress, labels map[string]string) {
+	c.labels.SetIngressLabels(ingresses, labels)
+}
+
+func (c *collector) SetDeprecatedAnnotations(ingresses []*ingress.Ingress) {
+	c.ingressController.SetDeprecatedAnnotations(ingresses)
+}
+
+func (c *collector) ObserveAnnotationErrors(ingresses []*ingress.Ingress) {
+	c.ingressController.ObserveAnnotationErrors(ingresses)
+}
+
+func (c *collector) SetIgnoredIngresses(ignored []collectors.IgnoredIngress) {
+	c.ingressController.SetIgnoredIngresses(ignored)
+}
+
+func (c *collector) SetConfigurationSize(size, servers int, exceeded []string) {
+	c.ingressController.SetConfigurationSize(size, servers, exceeded)
+}
+
+func (c *collector) SetConfigurationFileHash(hash string) {
+	c.ingressController.SetConfigurationFileHash(hash)
+}
+
+func (c *collector) SetShadowValidation(valid bool, divergences []collectors.ShadowDivergence) {
+	c.ingressController.SetShadowValidation(valid, divergences)
+}
+
+func (c *collector) CanaryStats() map[string]collectors.CanaryStats {
+	return c.canary.Stats()
+}
+
+func (c *collector) ProtocolMismatchStats() map[collectors.ProtocolMismatch]uint64 {
+	return c.mismatches.Stats()
+}
+
 // OnStartedLeading indicates the pod was elected as the leader
 func (c *collector) OnStartedLeading(electionID string) {
 	setLeader(true)
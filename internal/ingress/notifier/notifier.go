@@ -0,0 +1,364 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notifier sends the events of the controller, like the reloads of
+// NGINX or the certificates about to expire, as JSON documents in POST
+// requests to the webhooks configured by the operator.
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/version"
+)
+
+// Type is the type of an event sent to the webhooks
+type Type string
+
+const (
+	// ReloadCompleted is sent when NGINX was reloaded with a new configuration
+	ReloadCompleted Type = "ReloadCompleted"
+	// ReloadFailed is sent when a new configuration could not be applied
+	ReloadFailed Type = "ReloadFailed"
+	// CertificateExpiring is sent when the certificate of a server expires
+	// before the configured threshold
+	CertificateExpiring Type = "CertificateExpiring"
+	// ConflictDetected is sent when the configuration of an Ingress is
+	// ignored because another Ingress already defines it
+	ConflictDetected Type = "ConflictDetected"
+)
+
+// Types contains all the types of events
+var Types = []Type{ReloadCompleted, ReloadFailed, CertificateExpiring, ConflictDetected}
+
+const (
+	// DefaultTimeout is the timeout of the requests to the webhooks
+	DefaultTimeout = 10 * time.Second
+	// DefaultCertificateExpiry is the time before the expiration of a
+	// certificate from which it is reported
+	DefaultCertificateExpiry = 14 * 24 * time.Hour
+	// RepeatInterval is the period during which the events reporting the
+	// same condition are sent only once
+	RepeatInterval = 24 * time.Hour
+
+	// queueSize is the number of events waiting to be sent, the new events
+	// are dropped when the queue is full
+	queueSize = 100
+	// maxAttempts is the number of attempts to send an event to a webhook
+	maxAttempts = 3
+)
+
+// Config contains the configuration of the webhooks
+type Config struct {
+	// URLs of the webhooks, the notifications are disabled when empty
+	URLs []string
+	// Events contains the types of the events sent to the webhooks, all the
+	// types when empty
+	Events []string
+	// Timeout of each request to the webhooks
+	Timeout time.Duration
+	// CertificateExpiry is the time before the expiration of a certificate
+	// from which a CertificateExpiring event is sent
+	CertificateExpiry time.Duration
+}
+
+// Validate returns an error if the configuration is not valid
+func (cfg Config) Validate() error {
+	for _, u := range cfg.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("invalid webhook URL %q: %v", u, err)
+		}
+		if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid webhook URL %q: an absolute http or https URL is required", u)
+		}
+	}
+
+	for _, event := range cfg.Events {
+		if !isType(Type(event)) {
+			return fmt.Errorf("invalid event type %q, valid types are %v", event, Types)
+		}
+	}
+
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("the timeout of the webhooks must be greater than zero")
+	}
+
+	return nil
+}
+
+func isType(t Type) bool {
+	for _, valid := range Types {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the JSON document sent to the webhooks
+type Event struct {
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	// Controller is the namespace/name of the pod of the controller
+	Controller string `json:"controller,omitempty"`
+	Message    string `json:"message"`
+	// Reason of a conflict, the reason of the Event of the Ingress
+	Reason string `json:"reason,omitempty"`
+	// Ingress is the namespace/name of the Ingress concerned by the event
+	Ingress string `json:"ingress,omitempty"`
+	// Ingresses contains the namespace/name of the Ingresses whose
+	// configuration was not applied by a failed reload
+	Ingresses []string `json:"ingresses,omitempty"`
+	Host      string   `json:"host,omitempty"`
+	// Certificate is the namespace/name of the Secret of the certificate
+	Certificate string     `json:"certificate,omitempty"`
+	ExpireTime  *time.Time `json:"expireTime,omitempty"`
+	// Checksum of the configuration of a reload
+	Checksum string `json:"checksum,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	// Key identifies the condition reported by the event, the events with
+	// the same key are sent once per RepeatInterval
+	Key string `json:"-"`
+}
+
+// Webhook sends the events to the webhooks in the background. A nil Webhook
+// drops the events.
+type Webhook struct {
+	urls   []string
+	types  map[Type]bool
+	client *http.Client
+	queue  chan Event
+
+	certificateExpiry time.Duration
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+
+	// now returns the current time, replaced in the tests
+	now func() time.Time
+	// backoff is the delay between the attempts to send an event
+	backoff time.Duration
+}
+
+// New returns a Webhook sending the events to the webhooks of the
+// configuration, or nil if it does not contain any URL
+func New(cfg Config) *Webhook {
+	if len(cfg.URLs) == 0 {
+		return nil
+	}
+
+	types := map[Type]bool{}
+	for _, t := range Types {
+		types[t] = len(cfg.Events) == 0
+	}
+	for _, event := range cfg.Events {
+		types[Type(event)] = true
+	}
+
+	return &Webhook{
+		urls:              cfg.URLs,
+		types:             types,
+		client:            &http.Client{Timeout: cfg.Timeout},
+		queue:             make(chan Event, queueSize),
+		certificateExpiry: cfg.CertificateExpiry,
+		sent:              map[string]time.Time{},
+		now:               time.Now,
+		backoff:           time.Second,
+	}
+}
+
+// CertificateExpiry returns the time before the expiration of a certificate
+// from which it is reported
+func (w *Webhook) CertificateExpiry() time.Duration {
+	if w == nil {
+		return 0
+	}
+
+	return w.certificateExpiry
+}
+
+// Enabled returns true if the events of the type are sent
+func (w *Webhook) Enabled(t Type) bool {
+	return w != nil && w.types[t]
+}
+
+// Notify queues the event to be sent to the webhooks. The event is dropped
+// when its type is not enabled, when an event with the same key was sent
+// during the RepeatInterval or when the queue is full, in which case the
+// next event with the same key is not delayed.
+func (w *Webhook) Notify(event Event) {
+	if !w.Enabled(event.Type) {
+		return
+	}
+
+	now := w.now()
+	if event.Time.IsZero() {
+		event.Time = now
+	}
+	if event.Controller == "" && k8s.IngressPodDetails != nil {
+		event.Controller = fmt.Sprintf("%v/%v", k8s.IngressPodDetails.Namespace, k8s.IngressPodDetails.Name)
+	}
+
+	if event.Key != "" && !w.allow(event.Type, event.Key, now) {
+		return
+	}
+
+	select {
+	case w.queue <- event:
+	default:
+		klog.Warningf("Dropping %v notification, the queue of the webhooks is full", event.Type)
+		w.release(event)
+	}
+}
+
+// sentKey returns the key of the events of the type already sent
+func sentKey(t Type, key string) string {
+	return fmt.Sprintf("%v/%v", t, key)
+}
+
+// allow returns true if no event of the type and key was sent during the
+// RepeatInterval, and records the key as sent until release is called
+func (w *Webhook) allow(t Type, key string, now time.Time) bool {
+	key = sentKey(t, key)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for k, sent := range w.sent {
+		if now.Sub(sent) >= RepeatInterval {
+			delete(w.sent, k)
+		}
+	}
+
+	if _, ok := w.sent[key]; ok {
+		return false
+	}
+
+	w.sent[key] = now
+	return true
+}
+
+// release forgets the key of an event that was not sent, so the next event
+// with the same key is sent
+func (w *Webhook) release(event Event) {
+	if event.Key == "" {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.sent, sentKey(event.Type, event.Key))
+}
+
+// Run sends the queued events to the webhooks until stopCh is closed
+func (w *Webhook) Run(stopCh <-chan struct{}) {
+	if w == nil {
+		return
+	}
+
+	for {
+		select {
+		case event := <-w.queue:
+			w.deliver(event)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// deliver sends the event to the webhooks. The key of the event is released
+// when no webhook received it.
+func (w *Webhook) deliver(event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		klog.ErrorS(err, "Error encoding notification", "type", event.Type)
+		w.release(event)
+		return
+	}
+
+	delivered := false
+	for _, u := range w.urls {
+		if err := w.send(u, body); err != nil {
+			klog.Warningf("Error sending %v notification to %v: %v", event.Type, u, err)
+			continue
+		}
+
+		delivered = true
+	}
+
+	if !delivered {
+		w.release(event)
+	}
+}
+
+// send posts the body to the webhook, retrying on network errors and server
+// errors
+func (w *Webhook) send(u string, body []byte) error {
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * w.backoff)
+		}
+
+		var retry bool
+		retry, err = w.post(u, body)
+		if err == nil || !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+// post posts the body to the webhook and returns if the request can be
+// retried when it fails
+func (w *Webhook) post(u string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("ingress-nginx/%v", version.RELEASE))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	// reuse the connection in the next requests
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+		fmt.Errorf("unexpected status code %v", resp.StatusCode)
+}
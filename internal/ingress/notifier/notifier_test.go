@@ -0,0 +1,200 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		title string
+		cfg   Config
+		valid bool
+	}{
+		{"disabled", Config{Timeout: DefaultTimeout}, true},
+		{"valid", Config{URLs: []string{"https://hooks.example.com/ingress"}, Events: []string{"ReloadFailed"}, Timeout: DefaultTimeout}, true},
+		{"relative URL", Config{URLs: []string{"/ingress"}, Timeout: DefaultTimeout}, false},
+		{"invalid scheme", Config{URLs: []string{"ftp://hooks.example.com"}, Timeout: DefaultTimeout}, false},
+		{"invalid event", Config{URLs: []string{"https://hooks.example.com"}, Events: []string{"Reload"}, Timeout: DefaultTimeout}, false},
+		{"invalid timeout", Config{URLs: []string{"https://hooks.example.com"}}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestNilWebhook(t *testing.T) {
+	w := New(Config{Timeout: DefaultTimeout})
+	if w != nil {
+		t.Fatalf("expected no webhook without URLs")
+	}
+
+	// must not panic
+	w.Notify(Event{Type: ReloadCompleted})
+	w.Run(make(chan struct{}))
+	if w.Enabled(ReloadCompleted) {
+		t.Errorf("expected the events to be disabled")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	received := make(chan Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %v %v", req.Method, req.Header.Get("Content-Type"))
+		}
+
+		var event Event
+		if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+			t.Errorf("unexpected error decoding the event: %v", err)
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	w := New(Config{
+		URLs:    []string{server.URL},
+		Events:  []string{string(ReloadFailed), string(ConflictDetected)},
+		Timeout: DefaultTimeout,
+	})
+
+	now := time.Now()
+	w.now = func() time.Time { return now }
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go w.Run(stopCh)
+
+	w.Notify(Event{Type: ReloadCompleted, Message: "disabled type"})
+	w.Notify(Event{Type: ConflictDetected, Message: "conflict", Key: "default/demo"})
+	w.Notify(Event{Type: ConflictDetected, Message: "same conflict", Key: "default/demo"})
+	w.Notify(Event{Type: ReloadFailed, Message: "reload failed", Ingresses: []string{"default/demo"}})
+
+	now = now.Add(RepeatInterval)
+	w.Notify(Event{Type: ConflictDetected, Message: "conflict again", Key: "default/demo"})
+
+	expected := []string{"conflict", "reload failed", "conflict again"}
+	for _, message := range expected {
+		select {
+		case event := <-received:
+			if event.Message != message {
+				t.Errorf("expected event %q but got %q", message, event.Message)
+			}
+			if event.Time.IsZero() {
+				t.Errorf("expected the time of the event %q", event.Message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %q not received", message)
+		}
+	}
+
+	select {
+	case event := <-received:
+		t.Errorf("unexpected event %q", event.Message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			rw.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	w := New(Config{URLs: []string{server.URL}, Timeout: DefaultTimeout})
+	w.backoff = time.Millisecond
+
+	if err := w.send(server.URL, []byte("{}")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests but got %v", requests)
+	}
+
+	requests = 1
+	server.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.WriteHeader(http.StatusBadRequest)
+	})
+	if err := w.send(server.URL, []byte("{}")); err == nil {
+		t.Errorf("expected an error")
+	}
+	if requests != 2 {
+		t.Errorf("expected no retry of a client error but got %v requests", requests-1)
+	}
+}
+
+func TestNotifyNotSent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	w := New(Config{URLs: []string{server.URL}, Timeout: DefaultTimeout})
+	w.backoff = time.Millisecond
+
+	expiring := Event{Type: CertificateExpiring, Message: "certificate expiring", Key: "default/tls"}
+
+	// the event dropped with a full queue is not delayed
+	queue := w.queue
+	w.queue = make(chan Event)
+	w.Notify(expiring)
+
+	w.queue = queue
+	w.Notify(expiring)
+	if len(w.queue) != 1 {
+		t.Fatalf("expected the event dropped with a full queue to be queued again")
+	}
+
+	// the event not received by any webhook is not delayed
+	w.deliver(<-w.queue)
+	w.Notify(expiring)
+	if len(w.queue) != 1 {
+		t.Fatalf("expected the event not delivered to be queued again")
+	}
+
+	// the event received by a webhook is delayed
+	server.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	w.deliver(<-w.queue)
+	w.Notify(expiring)
+	if len(w.queue) != 0 {
+		t.Errorf("expected the event delivered not to be queued again during the repeat interval")
+	}
+}
@@ -41,6 +41,44 @@ type Resolver interface {
 
 	// GetService searches for services containing the namespace and name using a the character /
 	GetService(string) (*apiv1.Service, error)
+
+	// GetGlobalRateLimitPolicy searches for GlobalRateLimitPolicies containing the namespace and name using the character /
+	GetGlobalRateLimitPolicy(string) (*GlobalRateLimitPolicy, error)
+}
+
+// GlobalRateLimitPolicy contains the spec of a GlobalRateLimitPolicy, the
+// global rate limit of the Ingresses referencing it with the
+// global-rate-limit-policy annotation
+type GlobalRateLimitPolicy struct {
+	// Limit is the number of requests allowed in the window
+	Limit int `json:"limit"`
+	// Window is the duration of the window, like 1m
+	Window string `json:"window"`
+	// Key contains the NGINX variables identifying the clients of the
+	// limit, $remote_addr by default
+	Key string `json:"key,omitempty"`
+	// Exemptions contains the requests not counted in the limit
+	Exemptions GlobalRateLimitExemptions `json:"exemptions,omitempty"`
+	// Store overrides the store of the counters of the global-rate-limit-store
+	// setting, memcached or redis
+	Store string `json:"store,omitempty"`
+}
+
+// GlobalRateLimitExemptions contains the requests not counted in a global
+// rate limit
+type GlobalRateLimitExemptions struct {
+	// CIDRs contains the client addresses exempted from the limit
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Headers contains the request headers exempting the requests with
+	// their value from the limit
+	Headers []GlobalRateLimitExemptedHeader `json:"headers,omitempty"`
+}
+
+// GlobalRateLimitExemptedHeader is a request header exempting the requests
+// with its value from a global rate limit
+type GlobalRateLimitExemptedHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // AuthSSLCert contains the necessary information to do certificate based
@@ -26,7 +26,8 @@ import (
 
 // Mock implements the Resolver interface
 type Mock struct {
-	ConfigMaps map[string]*apiv1.ConfigMap
+	ConfigMaps              map[string]*apiv1.ConfigMap
+	GlobalRateLimitPolicies map[string]*GlobalRateLimitPolicy
 }
 
 // GetDefaultBackend returns the backend that must be used as default
@@ -58,3 +59,11 @@ func (m Mock) GetConfigMap(name string) (*apiv1.ConfigMap, error) {
 	}
 	return nil, errors.New("no configmap")
 }
+
+// GetGlobalRateLimitPolicy searches for GlobalRateLimitPolicies containing the namespace and name using the character /
+func (m Mock) GetGlobalRateLimitPolicy(name string) (*GlobalRateLimitPolicy, error) {
+	if v, ok := m.GlobalRateLimitPolicies[name]; ok {
+		return v, nil
+	}
+	return nil, errors.New("no global rate limit policy")
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	pool "gopkg.in/go-playground/pool.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+// ConfigurationStatusAnnotation is the name, without prefix, of the annotation
+// with the status of the configuration of the Ingress
+const ConfigurationStatusAnnotation = "configuration-status"
+
+// ConfigurationStatusInterval defines the time interval in which the
+// configuration status annotations are updated, when they changed
+var ConfigurationStatusInterval = 5 * time.Second
+
+// states of the configuration of an Ingress
+const (
+	// ConfigurationApplied indicates the configuration of the Ingress is live
+	ConfigurationApplied = "Applied"
+	// ConfigurationDenied indicates the locations of the Ingress return 503
+	// because of invalid annotations
+	ConfigurationDenied = "Denied"
+	// ConfigurationQuarantined indicates the Ingress was excluded from the
+	// configuration because it generates an invalid NGINX configuration
+	ConfigurationQuarantined = "Quarantined"
+	// ConfigurationFailed indicates the last change of the Ingress has not
+	// been applied because the configuration update failed
+	ConfigurationFailed = "Failed"
+)
+
+// ConfigurationStatus describes whether the configuration of an Ingress is live
+type ConfigurationStatus struct {
+	State string `json:"state"`
+	// ObservedGeneration is the generation of the Ingress the state refers to
+	ObservedGeneration int64 `json:"observedGeneration"`
+	// ConfigurationChecksum identifies the NGINX configuration that contains the Ingress
+	ConfigurationChecksum string `json:"configurationChecksum,omitempty"`
+	// LastTransitionTime is the last time the state or the generation changed
+	LastTransitionTime string `json:"lastTransitionTime"`
+	// Warnings found in the Ingress, like deprecated annotations
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Equal tests for equality between two ConfigurationStatus types, ignoring
+// the transition time
+func (s1 ConfigurationStatus) Equal(s2 ConfigurationStatus) bool {
+	s1.LastTransitionTime = ""
+	s2.LastTransitionTime = ""
+
+	return reflect.DeepEqual(s1, s2)
+}
+
+// configurationStatuses contains the last status of each Ingress, by key
+type configurationStatuses struct {
+	mu       sync.Mutex
+	statuses map[string]ConfigurationStatus
+	changed  bool
+}
+
+func (c *configurationStatuses) set(statuses map[string]ConfigurationStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.statuses = statuses
+	c.changed = true
+}
+
+// take returns the statuses when they changed since the last call
+func (c *configurationStatuses) take() (map[string]ConfigurationStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := c.changed
+	c.changed = false
+
+	return c.statuses, changed
+}
+
+func (c *configurationStatuses) retry() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.changed = true
+}
+
+// SetConfigurationStatus sets the status of the configuration of the
+// Ingresses, written to their annotations by the leader
+func (s statusSync) SetConfigurationStatus(statuses map[string]ConfigurationStatus) {
+	s.configurationStatus.set(statuses)
+}
+
+// syncConfigurationStatus updates the annotations of the Ingresses with a
+// different status
+func (s statusSync) syncConfigurationStatus() {
+	statuses, changed := s.configurationStatus.take()
+	if !changed {
+		return
+	}
+
+	key := parser.GetAnnotationWithPrefix(ConfigurationStatusAnnotation)
+
+	p := pool.NewLimited(10)
+	defer p.Close()
+
+	batch := p.Batch()
+
+	for _, ing := range s.IngressLister.ListIngresses() {
+		cs, ok := statuses[k8s.MetaNamespaceKey(ing)]
+		if !ok {
+			continue
+		}
+
+		value, err := json.Marshal(cs)
+		if err != nil {
+			klog.ErrorS(err, "unexpected error encoding configuration status", "ingress", klog.KObj(ing))
+			continue
+		}
+
+		if ing.GetAnnotations()[key] == string(value) {
+			continue
+		}
+
+		batch.Queue(runConfigurationStatusUpdate(ing, key, string(value), s.Client))
+	}
+
+	batch.QueueComplete()
+
+	for result := range batch.Results() {
+		if result.Error() != nil {
+			klog.Warningf("error updating configuration status: %v", result.Error())
+			s.configurationStatus.retry()
+		}
+	}
+}
+
+func runConfigurationStatusUpdate(ing *ingress.Ingress, key, value string, client clientset.Interface) pool.WorkFunc {
+	return func(wu pool.WorkUnit) (interface{}, error) {
+		if wu.IsCancelled() {
+			return nil, nil
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{key: value},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		klog.V(2).InfoS("updating Ingress configuration status", "namespace", ing.Namespace, "ingress", ing.Name, "value", value)
+		if k8s.IsIngressV1Ready {
+			_, err = client.NetworkingV1().Ingresses(ing.Namespace).Patch(context.TODO(), ing.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		} else {
+			_, err = client.NetworkingV1beta1().Ingresses(ing.Namespace).Patch(context.TODO(), ing.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unexpected error updating Ingress %v/%v: %v", ing.Namespace, ing.Name, err)
+		}
+
+		return true, nil
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testclient "k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/parser"
+	"k8s.io/ingress-nginx/internal/k8s"
+)
+
+type fixedIngressLister struct {
+	ingresses []*ingress.Ingress
+}
+
+func (l *fixedIngressLister) ListIngresses() []*ingress.Ingress {
+	return l.ingresses
+}
+
+func TestConfigurationStatusEqual(t *testing.T) {
+	s1 := ConfigurationStatus{State: ConfigurationApplied, ObservedGeneration: 1, LastTransitionTime: "2021-01-01T00:00:00Z"}
+	s2 := ConfigurationStatus{State: ConfigurationApplied, ObservedGeneration: 1, LastTransitionTime: "2021-01-02T00:00:00Z"}
+	if !s1.Equal(s2) {
+		t.Errorf("expected statuses with different transition times to be equal")
+	}
+
+	s2.Warnings = []string{"warning"}
+	if s1.Equal(s2) {
+		t.Errorf("expected statuses with different warnings to be different")
+	}
+}
+
+func TestSyncConfigurationStatus(t *testing.T) {
+	key := parser.GetAnnotationWithPrefix(ConfigurationStatusAnnotation)
+
+	applied := ConfigurationStatus{State: ConfigurationApplied, ObservedGeneration: 2, LastTransitionTime: "2021-01-01T00:00:00Z"}
+	value, _ := json.Marshal(applied)
+
+	ings := []networking.Ingress{
+		{ObjectMeta: metav1.ObjectMeta{Name: "changed", Namespace: apiv1.NamespaceDefault}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unchanged", Namespace: apiv1.NamespaceDefault, Annotations: map[string]string{key: string(value)}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unknown", Namespace: apiv1.NamespaceDefault}},
+	}
+
+	client := testclient.NewSimpleClientset(&networking.IngressList{Items: ings})
+	k8s.IsIngressV1Ready = true
+
+	lister := &fixedIngressLister{}
+	for i := range ings {
+		lister.ingresses = append(lister.ingresses, &ingress.Ingress{Ingress: ings[i]})
+	}
+
+	st := NewStatusSyncer(Config{
+		Client:                    client,
+		IngressLister:             lister,
+		UpdateConfigurationStatus: true,
+	}).(statusSync)
+
+	st.SetConfigurationStatus(map[string]ConfigurationStatus{
+		"default/changed":   applied,
+		"default/unchanged": applied,
+	})
+	st.syncConfigurationStatus()
+
+	patches := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	if patches != 1 {
+		t.Errorf("expected 1 patch but got %v", patches)
+	}
+
+	ing, err := client.NetworkingV1().Ingresses(apiv1.NamespaceDefault).Get(context.TODO(), "changed", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ing.Annotations[key] != string(value) {
+		t.Errorf("expected annotation %v but got %v", string(value), ing.Annotations[key])
+	}
+
+	ing, err = client.NetworkingV1().Ingresses(apiv1.NamespaceDefault).Get(context.TODO(), "unknown", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := ing.Annotations[key]; ok {
+		t.Errorf("expected no annotation in an ingress without status")
+	}
+
+	// nothing is written when the statuses did not change
+	client.ClearActions()
+	st.syncConfigurationStatus()
+	if len(client.Actions()) != 0 {
+		t.Errorf("expected no actions but got %v", client.Actions())
+	}
+}
@@ -50,6 +50,9 @@ type Syncer interface {
 	Run(chan struct{})
 
 	Shutdown()
+
+	// SetConfigurationStatus sets the status of the configuration of the Ingresses
+	SetConfigurationStatus(map[string]ConfigurationStatus)
 }
 
 type ingressLister interface {
@@ -69,6 +72,10 @@ type Config struct {
 
 	UseNodeInternalIP bool
 
+	// UpdateConfigurationStatus enables the annotation with the status of
+	// the configuration of each Ingress
+	UpdateConfigurationStatus bool
+
 	IngressLister ingressLister
 }
 
@@ -85,6 +92,8 @@ type statusSync struct {
 	// workqueue used to keep in sync the status IP/s
 	// in the Ingress rules
 	syncQueue *task.Queue
+
+	configurationStatus *configurationStatuses
 }
 
 // Start starts the loop to keep the status in sync
@@ -94,6 +103,12 @@ func (s statusSync) Run(stopCh chan struct{}) {
 	// trigger initial sync
 	s.syncQueue.EnqueueTask(task.GetDummyObject("sync status"))
 
+	if s.UpdateConfigurationStatus {
+		// statuses set before the instance was elected are written as well
+		s.configurationStatus.retry()
+		go wait.Until(s.syncConfigurationStatus, ConfigurationStatusInterval, stopCh)
+	}
+
 	// when this instance is the leader we need to enqueue
 	// an item to trigger the update of the Ingress status.
 	wait.PollUntil(time.Duration(UpdateInterval)*time.Second, func() (bool, error) {
@@ -155,7 +170,8 @@ func (s statusSync) keyfunc(input interface{}) (interface{}, error) {
 // NewStatusSyncer returns a new Syncer instance
 func NewStatusSyncer(config Config) Syncer {
 	st := statusSync{
-		Config: config,
+		Config:              config,
+		configurationStatus: &configurationStatuses{},
 	}
 	st.syncQueue = task.NewCustomTaskQueue(st.sync, st.keyfunc)
 
@@ -175,15 +191,33 @@ func (s *statusSync) runningAddresses() ([]string, error) {
 		return statusAddressFromService(s.PublishService, s.Client)
 	}
 
-	// get information about all the pods running the ingress controller
-	pods, err := s.Client.CoreV1().Pods(k8s.IngressPodDetails.Namespace).List(context.TODO(), metav1.ListOptions{
+	pods, err := RunningPods(s.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0)
+	for _, pod := range pods {
+		name := k8s.GetNodeIPOrName(s.Client, pod.Spec.NodeName, s.UseNodeInternalIP)
+		if !stringInSlice(name, addrs) {
+			addrs = append(addrs, name)
+		}
+	}
+
+	return addrs, nil
+}
+
+// RunningPods returns the Running and Ready pods of the ingress controller,
+// the pods with the labels of the current one in its namespace
+func RunningPods(client clientset.Interface) ([]apiv1.Pod, error) {
+	pods, err := client.CoreV1().Pods(k8s.IngressPodDetails.Namespace).List(context.TODO(), metav1.ListOptions{
 		LabelSelector: labels.SelectorFromSet(k8s.IngressPodDetails.Labels).String(),
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	addrs := make([]string, 0)
+	running := make([]apiv1.Pod, 0)
 	for i := range pods.Items {
 		pod := pods.Items[i]
 		// only Running pods are valid
@@ -205,13 +239,10 @@ func (s *statusSync) runningAddresses() ([]string, error) {
 			continue
 		}
 
-		name := k8s.GetNodeIPOrName(s.Client, pod.Spec.NodeName, s.UseNodeInternalIP)
-		if !stringInSlice(name, addrs) {
-			addrs = append(addrs, name)
-		}
+		running = append(running, pod)
 	}
 
-	return addrs, nil
+	return running, nil
 }
 
 func (s *statusSync) isRunningMultiplePods() bool {
@@ -275,7 +306,25 @@ func runUpdate(ing *ingress.Ingress, status []apiv1.LoadBalancerIngress,
 			return nil, nil
 		}
 
-		ingClient := client.NetworkingV1beta1().Ingresses(ing.Namespace)
+		// the clusters older than v1.19 only serve networking.k8s.io/v1beta1
+		if !k8s.IsIngressV1Ready {
+			ingClient := client.NetworkingV1beta1().Ingresses(ing.Namespace)
+			currIng, err := ingClient.Get(context.TODO(), ing.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("unexpected error searching Ingress %v/%v", ing.Namespace, ing.Name))
+			}
+
+			klog.InfoS("updating Ingress status", "namespace", currIng.Namespace, "ingress", currIng.Name, "currentValue", currIng.Status.LoadBalancer.Ingress, "newValue", status)
+			currIng.Status.LoadBalancer.Ingress = status
+			_, err = ingClient.UpdateStatus(context.TODO(), currIng, metav1.UpdateOptions{})
+			if err != nil {
+				klog.Warningf("error updating ingress rule: %v", err)
+			}
+
+			return true, nil
+		}
+
+		ingClient := client.NetworkingV1().Ingresses(ing.Namespace)
 		currIng, err := ingClient.Get(context.TODO(), ing.Name, metav1.GetOptions{})
 		if err != nil {
 			return nil, errors.Wrap(err, fmt.Sprintf("unexpected error searching Ingress %v/%v", ing.Namespace, ing.Name))
@@ -18,28 +18,61 @@ package ingress
 
 import (
 	apiv1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	"k8s.io/ingress-nginx/internal/ingress/annotations"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/accesslogfields"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/adaptiveconcurrency"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/auth"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/authjwt"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/authreq"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/authtls"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/backendbandwidth"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/circuitbreaker"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/connection"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/connectionlimit"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/cors"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/cspnonce"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/echobackend"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/failover"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/fallback"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/fastcgi"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/georouting"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/globalratelimit"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/grpcmetadata"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/healthcheck"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/http2"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/idempotency"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/inflight"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/influxdb"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/ipwhitelist"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/log"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/mirror"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/modsecurity"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/noendpoints"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/openapivalidation"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/opentelemetry"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/opentracing"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/precompressed"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/proxy"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/proxycache"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/proxyssl"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/ratelimit"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/ratelimitexemption"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/redirect"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/requestheaders"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/requestid"
 	"k8s.io/ingress-nginx/internal/ingress/annotations/rewrite"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/routeif"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/setvariables"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticfiles"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/staticresponse"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/timewindows"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/trailingslash"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/upstreamkeepalive"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/warmup"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/websocketlimit"
 )
 
 var (
@@ -75,7 +108,69 @@ type Configuration struct {
 	// ConfigurationChecksum contains the particular checksum of a Configuration object
 	ConfigurationChecksum string `json:"configurationChecksum,omitempty"`
 
+	// SSLDHParamChecksum contains the checksum of the DH parameters of the
+	// Secret of the ssl-dh-param setting
+	SSLDHParamChecksum string `json:"sslDHParamChecksum,omitempty"`
+
 	DefaultSSLCertificate *SSLCert `json:"-"`
+
+	// BotDetectionRules contains the rules of the ConfigMap configured in the
+	// bot-detection-configmap setting, applied dynamically.
+	// +optional
+	BotDetectionRules []BotDetectionRule `json:"botDetectionRules,omitempty"`
+
+	// BotDetectionSecret is the key signing the cookies of the challenge
+	// action of the bot detection rules, applied dynamically.
+	BotDetectionSecret string `json:"-"`
+
+	// GlobalRateLimitRedisPassword is the password of Redis of the Secret
+	// configured in the global-rate-limit-redis-password-secret setting,
+	// applied dynamically.
+	GlobalRateLimitRedisPassword string `json:"-"`
+
+	// GlobalRateLimitKeyHashSecret is the key of the HMAC of the keys of the
+	// global rate limits, applied dynamically.
+	GlobalRateLimitKeyHashSecret string `json:"-"`
+
+	// TimeWindows contains, by namespace and name of the Ingress, the time
+	// windows during which the requests are allowed, applied dynamically.
+	// +optional
+	TimeWindows map[string]*timewindows.Config `json:"timeWindows,omitempty"`
+
+	// PluginFlags contains, by namespace and name of the Ingress, the flags
+	// of the plugin-flags annotation delivered to the Lua plugins, applied
+	// dynamically.
+	// +optional
+	PluginFlags map[string]map[string]string `json:"pluginFlags,omitempty"`
+
+	// OpenAPISpecs contains, by checksum, the operations of the OpenAPI
+	// specifications used to validate the requests, applied dynamically.
+	// +optional
+	OpenAPISpecs map[string]string `json:"openapiSpecs,omitempty"`
+
+	// BodyFilterSnippets contains, by checksum, the code of the
+	// body-filter-snippet annotations, applied dynamically.
+	// +optional
+	BodyFilterSnippets map[string]string `json:"bodyFilterSnippets,omitempty"`
+}
+
+// BotDetectionRule describes the requests sent by bots and the action applied to them.
+// A request matches the rule when all the conditions of the rule match
+type BotDetectionRule struct {
+	// Name identifies the rule in the logs and in the header of the tag action
+	Name string `json:"name"`
+	// UserAgent is a regular expression matching the User-Agent header
+	UserAgent string `json:"userAgent,omitempty"`
+	// Headers maps lowercase header names to regular expressions matching their values
+	Headers map[string]string `json:"headers,omitempty"`
+	// MissingHeaders are lowercase header names not present in the request
+	MissingHeaders []string `json:"missingHeaders,omitempty"`
+	// Action is one of block, tag, rate-limit or challenge
+	Action string `json:"action"`
+	// Limit is the number of requests of each client allowed by the rate-limit action per Window
+	Limit int `json:"limit,omitempty"`
+	// Window is the duration, in seconds, of the rate-limit action
+	Window int `json:"window,omitempty"`
 }
 
 // Backend describes one or more remote server/s (endpoints) associated with a service
@@ -105,6 +200,33 @@ type Backend struct {
 	// Contains a list of backends without servers that are associated with this backend.
 	// +optional
 	AlternativeBackends []string `json:"alternativeBackends,omitempty"`
+	// FailoverEndpoints contains the endpoints outside of the cluster used only
+	// when none of the Endpoints are available.
+	// +optional
+	FailoverEndpoints []failover.Endpoint `json:"failoverEndpoints,omitempty"`
+	// WarmUp contains the check new endpoints must pass before receiving traffic
+	// +optional
+	WarmUp warmup.Config `json:"warmUp"`
+	// CircuitBreaker contains the thresholds used to eject the unhealthy
+	// endpoints from the load balancing for a while
+	// +optional
+	CircuitBreaker circuitbreaker.Config `json:"circuitBreaker"`
+	// HealthCheck contains the active health check removing the failing
+	// endpoints from the load balancing
+	// +optional
+	HealthCheck healthcheck.Config `json:"healthCheck,omitempty"`
+	// ExternalNameSRV resolves the ExternalName of the service as SRV
+	// records, with the targets and the ports of the records as endpoints
+	// +optional
+	ExternalNameSRV bool `json:"externalNameSRV,omitempty"`
+	// UnixSocket is the path of the Unix domain socket, on the node, the
+	// requests are proxied to instead of the endpoints of the service
+	// +optional
+	UnixSocket string `json:"unixSocket,omitempty"`
+	// DrainTimeout is the time, in seconds, the endpoints removed from the
+	// backend stay in the balancer to serve the sessions with affinity to them
+	// +optional
+	DrainTimeout int `json:"drainTimeout,omitempty"`
 }
 
 // TrafficShapingPolicy describes the policies to put in place when a backend has no server and is used as an
@@ -119,10 +241,25 @@ type TrafficShapingPolicy struct {
 	Header string `json:"header"`
 	// HeaderValue on which to redirect requests to this backend
 	HeaderValue string `json:"headerValue"`
+	// HeaderValues are the values of the header, any of them redirects the
+	// requests to this backend
+	HeaderValues []string `json:"headerValues,omitempty"`
 	// HeaderPattern the header value match pattern, support exact, regex.
 	HeaderPattern string `json:"headerPattern"`
 	// Cookie on which to redirect requests to this backend
 	Cookie string `json:"cookie"`
+	// CookieValue is the regular expression the value of the cookie must
+	// match to redirect requests to this backend, instead of "always"
+	CookieValue string `json:"cookieValue"`
+	// GRPCMethods are the gRPC methods, like /helloworld.Greeter/SayHello or
+	// /helloworld.Greeter/*, of the requests to redirect to this backend
+	GRPCMethods []string `json:"grpcMethods,omitempty"`
+	// ContentTypes are the media types, like application/grpc or application/*,
+	// of the requests to redirect to this backend
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// MatchMode defines if the requests must match any ("or") or all ("and")
+	// of the header, cookie, gRPC method and content type rules
+	MatchMode string `json:"matchMode"`
 }
 
 // HashInclude defines if a field should be used or not to calculate the hash
@@ -159,13 +296,19 @@ type CookieSessionAffinity struct {
 	SameSite                string              `json:"samesite,omitempty"`
 	ConditionalSameSiteNone bool                `json:"conditional_samesite_none,omitempty"`
 	ChangeOnFailure         bool                `json:"change_on_failure,omitempty"`
+	Secure                  bool                `json:"secure,omitempty"`
+	HTTPOnly                bool                `json:"httponly"`
+	Domain                  string              `json:"domain,omitempty"`
+	ConditionalSet          bool                `json:"conditional_set,omitempty"`
 }
 
 // UpstreamHashByConfig described setting from the upstream-hash-by* annotations.
 type UpstreamHashByConfig struct {
-	UpstreamHashBy           string `json:"upstream-hash-by,omitempty"`
-	UpstreamHashBySubset     bool   `json:"upstream-hash-by-subset,omitempty"`
-	UpstreamHashBySubsetSize int    `json:"upstream-hash-by-subset-size,omitempty"`
+	UpstreamHashBy              string  `json:"upstream-hash-by,omitempty"`
+	UpstreamHashBySubset        bool    `json:"upstream-hash-by-subset,omitempty"`
+	UpstreamHashBySubsetSize    int     `json:"upstream-hash-by-subset-size,omitempty"`
+	UpstreamHashByFallback      string  `json:"upstream-hash-by-fallback,omitempty"`
+	UpstreamHashByBalanceFactor float64 `json:"upstream-hash-by-balance-factor,omitempty"`
 }
 
 // Endpoint describes a kubernetes endpoint in a backend
@@ -203,6 +346,10 @@ type Server struct {
 	// ServerSnippet returns the snippet of server
 	// +optional
 	ServerSnippet string `json:"serverSnippet"`
+	// TopSnippet contains the snippets rendered at the beginning of the
+	// server, sorted by their order
+	// +optional
+	TopSnippet string `json:"topSnippet,omitempty"`
 	// SSLCiphers returns list of ciphers to be enabled
 	SSLCiphers string `json:"sslCiphers,omitempty"`
 	// SSLPreferServerCiphers indicates that server ciphers should be preferred
@@ -210,6 +357,19 @@ type Server struct {
 	SSLPreferServerCiphers string `json:"sslPreferServerCiphers,omitempty"`
 	// AuthTLSError contains the reason why the access to a server should be denied
 	AuthTLSError string `json:"authTLSError,omitempty"`
+	// HTTP2 contains the HTTP/2 configuration of the server
+	// +optional
+	HTTP2 http2.Config `json:"http2"`
+	// StaticFiles contains the files served from NGINX in the server
+	// +optional
+	StaticFiles staticfiles.Config `json:"staticFiles,omitempty"`
+	// RequestHeaders contains the limits of the request headers of the server
+	// +optional
+	RequestHeaders requestheaders.Config `json:"requestHeaders,omitempty"`
+	// OCSPMustStaple indicates that the TLS handshakes are refused when the
+	// certificate of the server has the OCSP must-staple extension and no
+	// valid OCSP response can be stapled
+	OCSPMustStaple bool `json:"ocspMustStaple,omitempty"`
 }
 
 // Location describes an URI inside a server.
@@ -282,6 +442,22 @@ type Location struct {
 	// but this is applied globally across multiple replicas.
 	// +optional
 	GlobalRateLimit globalratelimit.Config `json:"globalRateLimit,omitempty"`
+	// RateLimitExemption exempts the requests with a valid client
+	// certificate or JSON Web Token from RateLimit and GlobalRateLimit
+	// +optional
+	RateLimitExemption ratelimitexemption.Config `json:"rateLimitExemption,omitempty"`
+	// ConnectionLimit limits the concurrent connections of each key, like
+	// the client address, to the location
+	// +optional
+	ConnectionLimit connectionlimit.Config `json:"connectionLimit,omitempty"`
+	// WebSocketLimit limits the concurrent upgraded (WebSocket) connections
+	// to the location, per client and per backend
+	// +optional
+	WebSocketLimit websocketlimit.Config `json:"webSocketLimit,omitempty"`
+	// BackendBandwidth caps the aggregate bandwidth of the responses of the
+	// backend of the location, across all the requests to the backend
+	// +optional
+	BackendBandwidth backendbandwidth.Config `json:"backendBandwidth,omitempty"`
 	// Redirect describes a temporal o permanent redirection this location.
 	// +optional
 	Redirect redirect.Config `json:"redirect,omitempty"`
@@ -306,6 +482,18 @@ type Location struct {
 	// ConfigurationSnippet contains additional configuration for the backend
 	// to be considered in the configuration of the location
 	ConfigurationSnippet string `json:"configurationSnippet"`
+	// PreProxySnippet contains the snippet rendered before the directives
+	// generated for the proxied requests
+	// +optional
+	PreProxySnippet string `json:"preProxySnippet,omitempty"`
+	// PostProxySnippet contains the snippet rendered at the end of the
+	// location, after the directive passing the requests to the backend
+	// +optional
+	PostProxySnippet string `json:"postProxySnippet,omitempty"`
+	// SnippetFragments contains the names of the snippet fragments of the
+	// configuration included in the location
+	// +optional
+	SnippetFragments []string `json:"snippetFragments,omitempty"`
 	// Connection contains connection header to override the default Connection header
 	// to the request.
 	// +optional
@@ -324,6 +512,10 @@ type Location struct {
 	// original location.
 	// +optional
 	XForwardedPrefix string `json:"xForwardedPrefix,omitempty"`
+	// UpstreamPrefix is a path prepended to the URI of the requests sent to
+	// the backend
+	// +optional
+	UpstreamPrefix string `json:"upstreamPrefix,omitempty"`
 	// Logs allows to enable or disable the nginx logs
 	// By default access logs are enabled and rewrite logs are disabled
 	Logs log.Config `json:"logs,omitempty"`
@@ -350,6 +542,133 @@ type Location struct {
 	// Opentracing allows the global opentracing setting to be overridden for a location
 	// +optional
 	Opentracing opentracing.Config `json:"opentracing"`
+	// Opentelemetry allows the global opentelemetry setting to be overridden for a location
+	// +optional
+	Opentelemetry opentelemetry.Config `json:"opentelemetry"`
+	// CSPNonce generates a per-request nonce that is injected into the
+	// Content-Security-Policy header and passed to the backend
+	// +optional
+	CSPNonce cspnonce.Config `json:"cspNonce"`
+	// ProxyCache allows caching of the responses returned by the backend
+	// +optional
+	ProxyCache proxycache.Config `json:"proxyCache"`
+	// BackendAlias is an explicit name of the backend exposed in the
+	// $proxy_upstream_alias variable for log processors and APM tools
+	// +optional
+	BackendAlias string `json:"backendAlias"`
+	// AllowedMethods is the list of HTTP methods accepted by the location.
+	// Other methods are rejected with a 405 status code.
+	// +optional
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+	// URINormalizationPolicy defines how the URI of the requests is handled
+	// before being sent to the upstream
+	URINormalizationPolicy string `json:"uriNormalizationPolicy"`
+	// TrailingSlash redirects the requests to the paths with or without
+	// trailing slash
+	// +optional
+	TrailingSlash trailingslash.Config `json:"trailingSlash,omitempty"`
+	// UpstreamHostHeader is the Host header sent to the upstream.
+	// It can contain some NGINX variables, like $best_http_host or $service_name.
+	// +optional
+	UpstreamHostHeader string `json:"upstreamHostHeader"`
+	// UpstreamCompression controls the compression of the responses of the
+	// upstream: passthrough, strip or gzip
+	// +optional
+	UpstreamCompression string `json:"upstreamCompression,omitempty"`
+	// GRPCHTTP1Fallback sends the requests without a gRPC content type
+	// to the backend using HTTP/1.1 when the backend protocol is GRPC or GRPCS
+	// +optional
+	GRPCHTTP1Fallback bool `json:"grpcHTTP1Fallback"`
+	// AnonymizeClientIP masks the address of the client in the headers
+	// sent to the upstream
+	// +optional
+	AnonymizeClientIP bool `json:"anonymizeClientIP,omitempty"`
+	// OpenAPIValidation describes the OpenAPI specification used to validate
+	// the requests before they are sent to the upstream
+	// +optional
+	OpenAPIValidation openapivalidation.Config `json:"openapiValidation"`
+	// SetVariables nginx variables set in the location from
+	// attributes of the request
+	// +optional
+	SetVariables setvariables.Config `json:"setVariables"`
+	// Fallback is the service used to retry the requests that failed
+	// against the backend of the location
+	Fallback fallback.Config `json:"fallback"`
+	// GeoRouting routes the requests to services depending on the country
+	// or the continent of the client
+	GeoRouting georouting.Config `json:"geoRouting"`
+	// RouteIf routes the requests matching a predicate on their headers,
+	// cookies or arguments to another service
+	// +optional
+	RouteIf routeif.Config `json:"routeIf"`
+	// GRPCMetadata contains the names of the gRPC metadata used to send
+	// information about the client to gRPC backends
+	GRPCMetadata grpcmetadata.Config `json:"grpcMetadata"`
+	// BotDetection applies the bot detection rules of the ConfigMap
+	// configured in the bot-detection-configmap setting
+	BotDetection bool `json:"botDetection"`
+	// MaxInflight limits the requests in flight to the backend with a bounded queue
+	MaxInflight inflight.Config `json:"maxInflight"`
+	// AdaptiveConcurrency adapts the limit of requests in flight to the backend
+	// to its latency
+	AdaptiveConcurrency adaptiveconcurrency.Config `json:"adaptiveConcurrency"`
+	// Precompressed serves the precompressed variants of the assets
+	// instead of compressing the responses in NGINX
+	Precompressed precompressed.Config `json:"precompressed"`
+	// PreloadLinks contains the links of the assets the clients can preload,
+	// sent in the Link headers of the responses
+	// +optional
+	PreloadLinks []string `json:"preloadLinks,omitempty"`
+	// RequestID defines how the X-Request-ID header of the requests is handled
+	RequestID requestid.Config `json:"requestID"`
+	// AuthJWT contains the settings used to validate the JSON Web Tokens
+	// of the requests
+	// +optional
+	AuthJWT authjwt.Config `json:"authJWT,omitempty"`
+	// EchoBackend answers the requests with the built-in echo backend
+	// instead of the service, when the flag --enable-echo-backend is set
+	// +optional
+	EchoBackend echobackend.Config `json:"echoBackend,omitempty"`
+	// StaticResponse answers the requests with a static response instead
+	// of the service
+	// +optional
+	StaticResponse staticresponse.Config `json:"staticResponse,omitempty"`
+	// EdgeFunction is the Lua code run in a sandbox to change the requests
+	// and the responses, when the flag --enable-edge-functions is set
+	// +optional
+	EdgeFunction string `json:"edgeFunction,omitempty"`
+	// BodyFilterSnippet is the Lua code run in a sandbox by the body_filter
+	// plugin to transform the response bodies
+	// +optional
+	BodyFilterSnippet string `json:"bodyFilterSnippet,omitempty"`
+	// Idempotency deduplicates the requests with the same idempotency key,
+	// replaying the response of the first one, with the idempotency plugin
+	// +optional
+	Idempotency idempotency.Config `json:"idempotency,omitempty"`
+	// AccessLogFields contains the fields added to the JSON access logs of
+	// the location
+	// +optional
+	AccessLogFields accesslogfields.Config `json:"accessLogFields,omitempty"`
+	// UpstreamKeepalive contains the size of the keepalive pool of the
+	// backend, the location uses a dedicated upstream when it is set
+	// +optional
+	UpstreamKeepalive upstreamkeepalive.Config `json:"upstreamKeepalive,omitempty"`
+	// NoEndpoints defines the response of the location when the backend
+	// has no ready endpoints
+	// +optional
+	NoEndpoints noendpoints.Config `json:"noEndpoints,omitempty"`
+	// PathPriority orders the locations of a server, the locations with a
+	// higher priority are written first and win the regular expression matching
+	// +optional
+	PathPriority int `json:"pathPriority,omitempty"`
+	// MaxRequestDuration is the hard limit, in seconds, of the duration of
+	// the requests, from their reception to the end of the response
+	// +optional
+	MaxRequestDuration int `json:"maxRequestDuration,omitempty"`
+	// AuthExcludePaths are the paths, and the paths below them, that skip
+	// the basic and the external authentication of the location
+	// +optional
+	AuthExcludePaths []string `json:"authExcludePaths,omitempty"`
 }
 
 // SSLPassthroughBackend describes a SSL upstream server configured
@@ -385,12 +704,22 @@ type L4Backend struct {
 	Protocol  apiv1.Protocol     `json:"protocol"`
 	// +optional
 	ProxyProtocol ProxyProtocol `json:"proxyProtocol"`
+	// UnixSocket is the path of the Unix domain socket, on the node, the
+	// connections are proxied to instead of the endpoints of the service
+	// +optional
+	UnixSocket string `json:"unixSocket,omitempty"`
 }
 
 // ProxyProtocol describes the proxy protocol configuration
 type ProxyProtocol struct {
 	Decode bool `json:"decode"`
 	Encode bool `json:"encode"`
+	// EncodeVersion is the version of the PROXY protocol sent to the upstream
+	// servers, 1 or 2
+	EncodeVersion int `json:"encodeVersion,omitempty"`
+	// EncodeTLVs forwards the TLVs of the PROXY protocol v2 header received
+	// from the client in the header sent to the upstream servers
+	EncodeTLVs bool `json:"encodeTLVs,omitempty"`
 }
 
 // Ingress holds the definition of an Ingress plus its annotations
@@ -17,6 +17,8 @@ limitations under the License.
 package ingress
 
 import (
+	"reflect"
+
 	"k8s.io/ingress-nginx/internal/sets"
 )
 
@@ -80,6 +82,42 @@ func (c1 *Configuration) Equal(c2 *Configuration) bool {
 		return false
 	}
 
+	if c1.SSLDHParamChecksum != c2.SSLDHParamChecksum {
+		return false
+	}
+
+	if !reflect.DeepEqual(c1.BotDetectionRules, c2.BotDetectionRules) {
+		return false
+	}
+
+	if c1.BotDetectionSecret != c2.BotDetectionSecret {
+		return false
+	}
+
+	if c1.GlobalRateLimitRedisPassword != c2.GlobalRateLimitRedisPassword {
+		return false
+	}
+
+	if c1.GlobalRateLimitKeyHashSecret != c2.GlobalRateLimitKeyHashSecret {
+		return false
+	}
+
+	if !reflect.DeepEqual(c1.TimeWindows, c2.TimeWindows) {
+		return false
+	}
+
+	if !reflect.DeepEqual(c1.PluginFlags, c2.PluginFlags) {
+		return false
+	}
+
+	if !reflect.DeepEqual(c1.OpenAPISpecs, c2.OpenAPISpecs) {
+		return false
+	}
+
+	if !reflect.DeepEqual(c1.BodyFilterSnippets, c2.BodyFilterSnippets) {
+		return false
+	}
+
 	return true
 }
 
@@ -135,6 +173,38 @@ func (b1 *Backend) Equal(b2 *Backend) bool {
 		return false
 	}
 
+	if len(b1.FailoverEndpoints) != len(b2.FailoverEndpoints) {
+		return false
+	}
+	for i := range b1.FailoverEndpoints {
+		if !(&b1.FailoverEndpoints[i]).Equal(&b2.FailoverEndpoints[i]) {
+			return false
+		}
+	}
+
+	if !(&b1.WarmUp).Equal(&b2.WarmUp) {
+		return false
+	}
+
+	if !(&b1.CircuitBreaker).Equal(&b2.CircuitBreaker) {
+		return false
+	}
+
+	if !(&b1.HealthCheck).Equal(&b2.HealthCheck) {
+		return false
+	}
+
+	if b1.ExternalNameSRV != b2.ExternalNameSRV {
+		return false
+	}
+
+	if b1.UnixSocket != b2.UnixSocket {
+		return false
+	}
+	if b1.DrainTimeout != b2.DrainTimeout {
+		return false
+	}
+
 	return sets.StringElementsMatch(b1.AlternativeBackends, b2.AlternativeBackends)
 }
 
@@ -185,6 +255,18 @@ func (csa1 *CookieSessionAffinity) Equal(csa2 *CookieSessionAffinity) bool {
 	if csa1.ConditionalSameSiteNone != csa2.ConditionalSameSiteNone {
 		return false
 	}
+	if csa1.Secure != csa2.Secure {
+		return false
+	}
+	if csa1.HTTPOnly != csa2.HTTPOnly {
+		return false
+	}
+	if csa1.Domain != csa2.Domain {
+		return false
+	}
+	if csa1.ConditionalSet != csa2.ConditionalSet {
+		return false
+	}
 
 	return true
 }
@@ -206,6 +288,12 @@ func (u1 *UpstreamHashByConfig) Equal(u2 *UpstreamHashByConfig) bool {
 	if u1.UpstreamHashBySubsetSize != u2.UpstreamHashBySubsetSize {
 		return false
 	}
+	if u1.UpstreamHashByFallback != u2.UpstreamHashByFallback {
+		return false
+	}
+	if u1.UpstreamHashByBalanceFactor != u2.UpstreamHashByBalanceFactor {
+		return false
+	}
 
 	return true
 }
@@ -251,12 +339,27 @@ func (tsp1 TrafficShapingPolicy) Equal(tsp2 TrafficShapingPolicy) bool {
 	if tsp1.HeaderValue != tsp2.HeaderValue {
 		return false
 	}
+	if !sets.StringElementsMatch(tsp1.HeaderValues, tsp2.HeaderValues) {
+		return false
+	}
 	if tsp1.HeaderPattern != tsp2.HeaderPattern {
 		return false
 	}
 	if tsp1.Cookie != tsp2.Cookie {
 		return false
 	}
+	if tsp1.CookieValue != tsp2.CookieValue {
+		return false
+	}
+	if tsp1.MatchMode != tsp2.MatchMode {
+		return false
+	}
+	if !sets.StringElementsMatch(tsp1.GRPCMethods, tsp2.GRPCMethods) {
+		return false
+	}
+	if !sets.StringElementsMatch(tsp1.ContentTypes, tsp2.ContentTypes) {
+		return false
+	}
 
 	return true
 }
@@ -305,6 +408,9 @@ func (s1 *Server) Equal(s2 *Server) bool {
 	if s1.ServerSnippet != s2.ServerSnippet {
 		return false
 	}
+	if s1.TopSnippet != s2.TopSnippet {
+		return false
+	}
 	if s1.SSLCiphers != s2.SSLCiphers {
 		return false
 	}
@@ -314,6 +420,18 @@ func (s1 *Server) Equal(s2 *Server) bool {
 	if s1.AuthTLSError != s2.AuthTLSError {
 		return false
 	}
+	if !(&s1.HTTP2).Equal(&s2.HTTP2) {
+		return false
+	}
+	if !(&s1.StaticFiles).Equal(&s2.StaticFiles) {
+		return false
+	}
+	if !(&s1.RequestHeaders).Equal(&s2.RequestHeaders) {
+		return false
+	}
+	if s1.OCSPMustStaple != s2.OCSPMustStaple {
+		return false
+	}
 
 	if len(s1.Locations) != len(s2.Locations) {
 		return false
@@ -386,6 +504,19 @@ func (l1 *Location) Equal(l2 *Location) bool {
 	if !(&l1.GlobalRateLimit).Equal(&l2.GlobalRateLimit) {
 		return false
 	}
+	if !(&l1.RateLimitExemption).Equal(&l2.RateLimitExemption) {
+		return false
+	}
+
+	if !(&l1.ConnectionLimit).Equal(&l2.ConnectionLimit) {
+		return false
+	}
+	if !(&l1.WebSocketLimit).Equal(&l2.WebSocketLimit) {
+		return false
+	}
+	if !(&l1.BackendBandwidth).Equal(&l2.BackendBandwidth) {
+		return false
+	}
 	if !(&l1.Redirect).Equal(&l2.Redirect) {
 		return false
 	}
@@ -404,6 +535,20 @@ func (l1 *Location) Equal(l2 *Location) bool {
 	if l1.ConfigurationSnippet != l2.ConfigurationSnippet {
 		return false
 	}
+	if l1.PreProxySnippet != l2.PreProxySnippet {
+		return false
+	}
+	if l1.PostProxySnippet != l2.PostProxySnippet {
+		return false
+	}
+	if len(l1.SnippetFragments) != len(l2.SnippetFragments) {
+		return false
+	}
+	for i := range l1.SnippetFragments {
+		if l1.SnippetFragments[i] != l2.SnippetFragments[i] {
+			return false
+		}
+	}
 	if l1.ClientBodyBufferSize != l2.ClientBodyBufferSize {
 		return false
 	}
@@ -413,6 +558,9 @@ func (l1 *Location) Equal(l2 *Location) bool {
 	if l1.XForwardedPrefix != l2.XForwardedPrefix {
 		return false
 	}
+	if l1.UpstreamPrefix != l2.UpstreamPrefix {
+		return false
+	}
 	if !(&l1.Connection).Equal(&l2.Connection) {
 		return false
 	}
@@ -453,10 +601,148 @@ func (l1 *Location) Equal(l2 *Location) bool {
 		return false
 	}
 
+	if !l1.Opentelemetry.Equal(&l2.Opentelemetry) {
+		return false
+	}
+
 	if !l1.Mirror.Equal(&l2.Mirror) {
 		return false
 	}
 
+	if !(&l1.CSPNonce).Equal(&l2.CSPNonce) {
+		return false
+	}
+
+	if !(&l1.ProxyCache).Equal(&l2.ProxyCache) {
+		return false
+	}
+
+	if l1.BackendAlias != l2.BackendAlias {
+		return false
+	}
+
+	if !sets.StringElementsMatch(l1.AllowedMethods, l2.AllowedMethods) {
+		return false
+	}
+
+	if l1.URINormalizationPolicy != l2.URINormalizationPolicy {
+		return false
+	}
+
+	if !(&l1.TrailingSlash).Equal(&l2.TrailingSlash) {
+		return false
+	}
+
+	if l1.UpstreamHostHeader != l2.UpstreamHostHeader {
+		return false
+	}
+
+	if l1.UpstreamCompression != l2.UpstreamCompression {
+		return false
+	}
+
+	if l1.GRPCHTTP1Fallback != l2.GRPCHTTP1Fallback {
+		return false
+	}
+
+	if l1.AnonymizeClientIP != l2.AnonymizeClientIP {
+		return false
+	}
+
+	if !(&l1.OpenAPIValidation).Equal(&l2.OpenAPIValidation) {
+		return false
+	}
+
+	if !(&l1.SetVariables).Equal(&l2.SetVariables) {
+		return false
+	}
+
+	if !(&l1.Fallback).Equal(&l2.Fallback) {
+		return false
+	}
+	if !(&l1.GeoRouting).Equal(&l2.GeoRouting) {
+		return false
+	}
+	if !(&l1.RouteIf).Equal(&l2.RouteIf) {
+		return false
+	}
+
+	if l1.GRPCMetadata != l2.GRPCMetadata {
+		return false
+	}
+
+	if l1.BotDetection != l2.BotDetection {
+		return false
+	}
+
+	if !(&l1.MaxInflight).Equal(&l2.MaxInflight) {
+		return false
+	}
+
+	if !(&l1.AdaptiveConcurrency).Equal(&l2.AdaptiveConcurrency) {
+		return false
+	}
+
+	if !(&l1.Precompressed).Equal(&l2.Precompressed) {
+		return false
+	}
+
+	if !sets.StringElementsMatch(l1.PreloadLinks, l2.PreloadLinks) {
+		return false
+	}
+
+	if !(&l1.RequestID).Equal(&l2.RequestID) {
+		return false
+	}
+
+	if !(&l1.AuthJWT).Equal(&l2.AuthJWT) {
+		return false
+	}
+
+	if !(&l1.EchoBackend).Equal(&l2.EchoBackend) {
+		return false
+	}
+
+	if !(&l1.StaticResponse).Equal(&l2.StaticResponse) {
+		return false
+	}
+
+	if l1.EdgeFunction != l2.EdgeFunction {
+		return false
+	}
+
+	if l1.BodyFilterSnippet != l2.BodyFilterSnippet {
+		return false
+	}
+
+	if !(&l1.Idempotency).Equal(&l2.Idempotency) {
+		return false
+	}
+
+	if !(&l1.AccessLogFields).Equal(&l2.AccessLogFields) {
+		return false
+	}
+
+	if !(&l1.UpstreamKeepalive).Equal(&l2.UpstreamKeepalive) {
+		return false
+	}
+
+	if !(&l1.NoEndpoints).Equal(&l2.NoEndpoints) {
+		return false
+	}
+
+	if l1.PathPriority != l2.PathPriority {
+		return false
+	}
+
+	if l1.MaxRequestDuration != l2.MaxRequestDuration {
+		return false
+	}
+
+	if !sets.StringElementsMatch(l1.AuthExcludePaths, l2.AuthExcludePaths) {
+		return false
+	}
+
 	return true
 }
 
@@ -534,6 +820,9 @@ func (l4b1 *L4Backend) Equal(l4b2 *L4Backend) bool {
 	if l4b1.ProxyProtocol != l4b2.ProxyProtocol {
 		return false
 	}
+	if l4b1.UnixSocket != l4b2.UnixSocket {
+		return false
+	}
 
 	return true
 }
@@ -555,6 +844,9 @@ func (s1 *SSLCert) Equal(s2 *SSLCert) bool {
 	if s1.PemSHA != s2.PemSHA {
 		return false
 	}
+	if s1.PemFileName != s2.PemFileName {
+		return false
+	}
 	if !s1.ExpireTime.Equal(s2.ExpireTime) {
 		return false
 	}
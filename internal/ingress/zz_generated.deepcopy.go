@@ -22,6 +22,7 @@ package ingress
 
 import (
 	v1 "k8s.io/api/core/v1"
+	failover "k8s.io/ingress-nginx/internal/ingress/annotations/failover"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -42,12 +43,17 @@ func (in *Backend) DeepCopyInto(out *Backend) {
 	}
 	in.SessionAffinity.DeepCopyInto(&out.SessionAffinity)
 	out.UpstreamHashBy = in.UpstreamHashBy
-	out.TrafficShapingPolicy = in.TrafficShapingPolicy
+	in.TrafficShapingPolicy.DeepCopyInto(&out.TrafficShapingPolicy)
 	if in.AlternativeBackends != nil {
 		in, out := &in.AlternativeBackends, &out.AlternativeBackends
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.FailoverEndpoints != nil {
+		in, out := &in.FailoverEndpoints, &out.FailoverEndpoints
+		*out = make([]failover.Endpoint, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -133,6 +139,21 @@ func (in *SessionAffinityConfig) DeepCopy() *SessionAffinityConfig {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TrafficShapingPolicy) DeepCopyInto(out *TrafficShapingPolicy) {
 	*out = *in
+	if in.HeaderValues != nil {
+		in, out := &in.HeaderValues, &out.HeaderValues
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.GRPCMethods != nil {
+		in, out := &in.GRPCMethods, &out.GRPCMethods
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ContentTypes != nil {
+		in, out := &in.ContentTypes, &out.ContentTypes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
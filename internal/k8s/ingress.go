@@ -0,0 +1,230 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	networking "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// FromIngressV1Beta1 converts an Ingress of networking.k8s.io/v1beta1, the
+// version served by the clusters older than v1.19, to networking.k8s.io/v1
+func FromIngressV1Beta1(in *networkingv1beta1.Ingress) *networking.Ingress {
+	out := &networking.Ingress{
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec: networking.IngressSpec{
+			IngressClassName: in.Spec.IngressClassName,
+			DefaultBackend:   fromIngressBackendV1Beta1(in.Spec.Backend),
+		},
+		Status: networking.IngressStatus{
+			LoadBalancer: *in.Status.LoadBalancer.DeepCopy(),
+		},
+	}
+
+	out.SetGroupVersionKind(networking.SchemeGroupVersion.WithKind("Ingress"))
+
+	for _, tls := range in.Spec.TLS {
+		out.Spec.TLS = append(out.Spec.TLS, networking.IngressTLS{
+			Hosts:      tls.Hosts,
+			SecretName: tls.SecretName,
+		})
+	}
+
+	for _, rule := range in.Spec.Rules {
+		r := networking.IngressRule{Host: rule.Host}
+
+		if rule.HTTP != nil {
+			r.HTTP = &networking.HTTPIngressRuleValue{}
+			for _, path := range rule.HTTP.Paths {
+				p := networking.HTTPIngressPath{Path: path.Path}
+				if path.PathType != nil {
+					pathType := networking.PathType(*path.PathType)
+					p.PathType = &pathType
+				}
+				if backend := fromIngressBackendV1Beta1(&path.Backend); backend != nil {
+					p.Backend = *backend
+				}
+
+				r.HTTP.Paths = append(r.HTTP.Paths, p)
+			}
+		}
+
+		out.Spec.Rules = append(out.Spec.Rules, r)
+	}
+
+	return out
+}
+
+func fromIngressBackendV1Beta1(in *networkingv1beta1.IngressBackend) *networking.IngressBackend {
+	if in == nil {
+		return nil
+	}
+
+	out := &networking.IngressBackend{
+		Resource: in.Resource,
+	}
+
+	if in.ServiceName != "" {
+		out.Service = &networking.IngressServiceBackend{Name: in.ServiceName}
+		if in.ServicePort.Type == intstr.Int {
+			out.Service.Port.Number = in.ServicePort.IntVal
+		} else {
+			out.Service.Port.Name = in.ServicePort.StrVal
+		}
+	}
+
+	return out
+}
+
+// ToIngressV1Beta1 converts an Ingress of networking.k8s.io/v1 to
+// networking.k8s.io/v1beta1, the version served by the clusters older than v1.19
+func ToIngressV1Beta1(in *networking.Ingress) *networkingv1beta1.Ingress {
+	out := &networkingv1beta1.Ingress{
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec: networkingv1beta1.IngressSpec{
+			IngressClassName: in.Spec.IngressClassName,
+			Backend:          toIngressBackendV1Beta1(in.Spec.DefaultBackend),
+		},
+		Status: networkingv1beta1.IngressStatus{
+			LoadBalancer: *in.Status.LoadBalancer.DeepCopy(),
+		},
+	}
+
+	out.SetGroupVersionKind(networkingv1beta1.SchemeGroupVersion.WithKind("Ingress"))
+
+	for _, tls := range in.Spec.TLS {
+		out.Spec.TLS = append(out.Spec.TLS, networkingv1beta1.IngressTLS{
+			Hosts:      tls.Hosts,
+			SecretName: tls.SecretName,
+		})
+	}
+
+	for _, rule := range in.Spec.Rules {
+		r := networkingv1beta1.IngressRule{Host: rule.Host}
+
+		if rule.HTTP != nil {
+			r.HTTP = &networkingv1beta1.HTTPIngressRuleValue{}
+			for _, path := range rule.HTTP.Paths {
+				p := networkingv1beta1.HTTPIngressPath{Path: path.Path}
+				if path.PathType != nil {
+					pathType := networkingv1beta1.PathType(*path.PathType)
+					p.PathType = &pathType
+				}
+				if backend := toIngressBackendV1Beta1(&path.Backend); backend != nil {
+					p.Backend = *backend
+				}
+
+				r.HTTP.Paths = append(r.HTTP.Paths, p)
+			}
+		}
+
+		out.Spec.Rules = append(out.Spec.Rules, r)
+	}
+
+	return out
+}
+
+func toIngressBackendV1Beta1(in *networking.IngressBackend) *networkingv1beta1.IngressBackend {
+	if in == nil {
+		return nil
+	}
+
+	out := &networkingv1beta1.IngressBackend{
+		Resource: in.Resource,
+	}
+
+	if in.Service != nil {
+		out.ServiceName = in.Service.Name
+		if in.Service.Port.Name != "" {
+			out.ServicePort = intstr.FromString(in.Service.Port.Name)
+		} else {
+			out.ServicePort = intstr.FromInt(int(in.Service.Port.Number))
+		}
+	}
+
+	return out
+}
+
+// FromIngressClassV1Beta1 converts an IngressClass of
+// networking.k8s.io/v1beta1 to networking.k8s.io/v1
+func FromIngressClassV1Beta1(in *networkingv1beta1.IngressClass) *networking.IngressClass {
+	out := &networking.IngressClass{
+		ObjectMeta: *in.ObjectMeta.DeepCopy(),
+		Spec: networking.IngressClassSpec{
+			Controller: in.Spec.Controller,
+			Parameters: in.Spec.Parameters.DeepCopy(),
+		},
+	}
+
+	out.SetGroupVersionKind(networking.SchemeGroupVersion.WithKind("IngressClass"))
+
+	return out
+}
+
+// BackendServiceName returns the name of the service of an Ingress backend,
+// empty for the backends referencing a resource
+func BackendServiceName(backend *networking.IngressBackend) string {
+	if backend == nil || backend.Service == nil {
+		return ""
+	}
+
+	return backend.Service.Name
+}
+
+// BackendServicePort returns the number or the name of the port of the service
+// of an Ingress backend, zero when it is not defined
+func BackendServicePort(backend *networking.IngressBackend) intstr.IntOrString {
+	if backend == nil || backend.Service == nil {
+		return intstr.FromInt(0)
+	}
+
+	if backend.Service.Port.Name != "" {
+		return intstr.FromString(backend.Service.Port.Name)
+	}
+
+	return intstr.FromInt(int(backend.Service.Port.Number))
+}
+
+// IngressClassParametersConfigMap returns the namespace/name key of the
+// ConfigMap referenced by the parameters of an IngressClass, empty when it has
+// no parameters. The parameters are a local reference of the cluster scoped
+// IngressClass, the ConfigMap is searched in the namespace given as default
+// unless its name has the form namespace/name.
+func IngressClassParametersConfigMap(ic *networking.IngressClass, namespace string) (string, error) {
+	params := ic.Spec.Parameters
+	if params == nil {
+		return "", nil
+	}
+
+	if (params.APIGroup != nil && *params.APIGroup != "") || params.Kind != "ConfigMap" {
+		return "", fmt.Errorf("unsupported parameters of kind %q in IngressClass %v, only ConfigMaps are supported", params.Kind, ic.Name)
+	}
+
+	if strings.Contains(params.Name, "/") {
+		if _, _, err := ParseNameNS(params.Name); err != nil {
+			return "", err
+		}
+
+		return params.Name, nil
+	}
+
+	return fmt.Sprintf("%v/%v", namespace, params.Name), nil
+}
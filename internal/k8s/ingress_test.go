@@ -0,0 +1,186 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestFromIngressV1Beta1(t *testing.T) {
+	exact := networkingv1beta1.PathTypeExact
+	className := "nginx"
+
+	in := &networkingv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: networkingv1beta1.IngressSpec{
+			IngressClassName: &className,
+			Backend: &networkingv1beta1.IngressBackend{
+				ServiceName: "default-backend",
+				ServicePort: intstr.FromString("http"),
+			},
+			TLS: []networkingv1beta1.IngressTLS{
+				{Hosts: []string{"foo.bar"}, SecretName: "foo-tls"},
+			},
+			Rules: []networkingv1beta1.IngressRule{
+				{
+					Host: "foo.bar",
+					IngressRuleValue: networkingv1beta1.IngressRuleValue{
+						HTTP: &networkingv1beta1.HTTPIngressRuleValue{
+							Paths: []networkingv1beta1.HTTPIngressPath{
+								{
+									Path:     "/exact",
+									PathType: &exact,
+									Backend: networkingv1beta1.IngressBackend{
+										ServiceName: "foo",
+										ServicePort: intstr.FromInt(80),
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Status: networkingv1beta1.IngressStatus{
+			LoadBalancer: apiv1.LoadBalancerStatus{
+				Ingress: []apiv1.LoadBalancerIngress{{IP: "10.0.0.1"}},
+			},
+		},
+	}
+
+	out := FromIngressV1Beta1(in)
+
+	if out.Name != "foo" || out.Namespace != "default" {
+		t.Errorf("expected the metadata to be kept but returned %v/%v", out.Namespace, out.Name)
+	}
+
+	if out.APIVersion != "networking.k8s.io/v1" || out.Kind != "Ingress" {
+		t.Errorf("unexpected kind %v/%v", out.APIVersion, out.Kind)
+	}
+
+	if out.Spec.IngressClassName == nil || *out.Spec.IngressClassName != className {
+		t.Errorf("expected the class %v but returned %v", className, out.Spec.IngressClassName)
+	}
+
+	expectedDefaultBackend := &networking.IngressBackend{
+		Service: &networking.IngressServiceBackend{
+			Name: "default-backend",
+			Port: networking.ServiceBackendPort{Name: "http"},
+		},
+	}
+	if !reflect.DeepEqual(out.Spec.DefaultBackend, expectedDefaultBackend) {
+		t.Errorf("expected the default backend %v but returned %v", expectedDefaultBackend, out.Spec.DefaultBackend)
+	}
+
+	if len(out.Spec.TLS) != 1 || out.Spec.TLS[0].SecretName != "foo-tls" {
+		t.Errorf("unexpected TLS %v", out.Spec.TLS)
+	}
+
+	path := out.Spec.Rules[0].HTTP.Paths[0]
+	if *path.PathType != networking.PathTypeExact {
+		t.Errorf("expected the path type Exact but returned %v", *path.PathType)
+	}
+
+	expectedBackend := networking.IngressBackend{
+		Service: &networking.IngressServiceBackend{
+			Name: "foo",
+			Port: networking.ServiceBackendPort{Number: 80},
+		},
+	}
+	if !reflect.DeepEqual(path.Backend, expectedBackend) {
+		t.Errorf("expected the backend %v but returned %v", expectedBackend, path.Backend)
+	}
+
+	if len(out.Status.LoadBalancer.Ingress) != 1 {
+		t.Errorf("expected the status to be kept but returned %v", out.Status)
+	}
+
+	back := ToIngressV1Beta1(out)
+	if back.APIVersion != "networking.k8s.io/v1beta1" || back.Kind != "Ingress" {
+		t.Errorf("unexpected kind %v/%v", back.APIVersion, back.Kind)
+	}
+	if !reflect.DeepEqual(back.Spec, in.Spec) {
+		t.Errorf("expected the spec %v to be kept but returned %v", in.Spec, back.Spec)
+	}
+	if !reflect.DeepEqual(back.Status, in.Status) {
+		t.Errorf("expected the status %v to be kept but returned %v", in.Status, back.Status)
+	}
+}
+
+func TestBackendServicePort(t *testing.T) {
+	testCases := []struct {
+		backend  *networking.IngressBackend
+		expected intstr.IntOrString
+	}{
+		{nil, intstr.FromInt(0)},
+		{&networking.IngressBackend{}, intstr.FromInt(0)},
+		{&networking.IngressBackend{Service: &networking.IngressServiceBackend{Port: networking.ServiceBackendPort{Number: 8080}}}, intstr.FromInt(8080)},
+		{&networking.IngressBackend{Service: &networking.IngressServiceBackend{Port: networking.ServiceBackendPort{Name: "http"}}}, intstr.FromString("http")},
+	}
+
+	for _, tc := range testCases {
+		actual := BackendServicePort(tc.backend)
+		if actual != tc.expected {
+			t.Errorf("expected %v but returned %v", tc.expected, actual)
+		}
+	}
+}
+
+func TestIngressClassParametersConfigMap(t *testing.T) {
+	apps := "apps"
+
+	testCases := []struct {
+		title     string
+		params    *apiv1.TypedLocalObjectReference
+		expected  string
+		expectErr bool
+	}{
+		{"without parameters", nil, "", false},
+		{"ConfigMap in the namespace of the controller", &apiv1.TypedLocalObjectReference{Kind: "ConfigMap", Name: "class-config"}, "ingress-nginx/class-config", false},
+		{"ConfigMap in another namespace", &apiv1.TypedLocalObjectReference{Kind: "ConfigMap", Name: "team/class-config"}, "team/class-config", false},
+		{"invalid name", &apiv1.TypedLocalObjectReference{Kind: "ConfigMap", Name: "a/b/c"}, "", true},
+		{"unsupported kind", &apiv1.TypedLocalObjectReference{Kind: "Secret", Name: "class-config"}, "", true},
+		{"unsupported group", &apiv1.TypedLocalObjectReference{APIGroup: &apps, Kind: "ConfigMap", Name: "class-config"}, "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			ic := &networking.IngressClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "nginx"},
+				Spec: networking.IngressClassSpec{
+					Controller: IngressNGINXController,
+					Parameters: tc.params,
+				},
+			}
+
+			actual, err := IngressClassParametersConfigMap(ic, "ingress-nginx")
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %v but returned %v", tc.expectErr, err)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected %q but returned %q", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -25,7 +25,7 @@ import (
 	"k8s.io/klog/v2"
 
 	apiv1 "k8s.io/api/core/v1"
-	networkingv1beta1 "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/version"
 	clientset "k8s.io/client-go/kubernetes"
@@ -128,14 +128,15 @@ var IsIngressV1Beta1Ready bool
 var IsIngressV1Ready bool
 
 // IngressClass indicates the class of the Ingress to use as filter
-var IngressClass *networkingv1beta1.IngressClass
+var IngressClass *networking.IngressClass
 
 // IngressNGINXController defines the valid value of IngressClass
 // Controller field for ingress-nginx
 const IngressNGINXController = "k8s.io/ingress-nginx"
 
 // NetworkingIngressAvailable checks if the package "k8s.io/api/networking/v1beta1"
-// is available or not and if Ingress V1 is supported (k8s >= v1.18.0)
+// is available or not, if IngressClass is supported (k8s >= v1.18.0) and if
+// Ingress V1 is supported (k8s >= v1.19.0)
 func NetworkingIngressAvailable(client clientset.Interface) (bool, bool, bool) {
 	// check kubernetes version to use new ingress package or not
 	version114, _ := version.ParseGeneric("v1.14.0")
@@ -157,10 +158,11 @@ func NetworkingIngressAvailable(client clientset.Interface) (bool, bool, bool) {
 }
 
 // default path type is Prefix to not break existing definitions
-var defaultPathType = networkingv1beta1.PathTypePrefix
+var defaultPathType = networking.PathTypePrefix
 
-// SetDefaultNGINXPathType sets a default PathType when is not defined.
-func SetDefaultNGINXPathType(ing *networkingv1beta1.Ingress) {
+// SetDefaultNGINXPathType sets a default PathType when is not defined. The
+// ImplementationSpecific paths are handled like the Prefix ones.
+func SetDefaultNGINXPathType(ing *networking.Ingress) {
 	for _, rule := range ing.Spec.Rules {
 		if rule.IngressRuleValue.HTTP == nil {
 			continue
@@ -172,7 +174,7 @@ func SetDefaultNGINXPathType(ing *networkingv1beta1.Ingress) {
 				p.PathType = &defaultPathType
 			}
 
-			if *p.PathType == networkingv1beta1.PathTypeImplementationSpecific {
+			if *p.PathType == networking.PathTypeImplementationSpecific {
 				p.PathType = &defaultPathType
 			}
 		}
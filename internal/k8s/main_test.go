@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	testclient "k8s.io/client-go/kubernetes/fake"
 )
@@ -282,3 +283,35 @@ func TestGetIngressPod(t *testing.T) {
 		return
 	}
 }
+
+func TestSetDefaultNGINXPathType(t *testing.T) {
+	exact := networking.PathTypeExact
+	implementationSpecific := networking.PathTypeImplementationSpecific
+
+	ing := &networking.Ingress{
+		Spec: networking.IngressSpec{
+			Rules: []networking.IngressRule{
+				{
+					IngressRuleValue: networking.IngressRuleValue{
+						HTTP: &networking.HTTPIngressRuleValue{
+							Paths: []networking.HTTPIngressPath{
+								{Path: "/default"},
+								{Path: "/exact", PathType: &exact},
+								{Path: "/implementation-specific", PathType: &implementationSpecific},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	SetDefaultNGINXPathType(ing)
+
+	expected := []networking.PathType{networking.PathTypePrefix, networking.PathTypeExact, networking.PathTypePrefix}
+	for i, path := range ing.Spec.Rules[0].HTTP.Paths {
+		if *path.PathType != expected[i] {
+			t.Errorf("expected the pathType %v for the path %v but got %v", expected[i], path.Path, *path.PathType)
+		}
+	}
+}
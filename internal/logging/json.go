@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"github.com/go-logr/logr"
+)
+
+// jsonLogger is the logr.Logger used by klog when the logs are in JSON
+// format, for the messages not logged by a subsystem
+type jsonLogger struct {
+	name   string
+	values []interface{}
+}
+
+func (l jsonLogger) Enabled() bool {
+	return true
+}
+
+func (l jsonLogger) Info(msg string, keysAndValues ...interface{}) {
+	writeJSON(infoLevel, nil, msg, l.keysAndValues(keysAndValues))
+}
+
+func (l jsonLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	writeJSON(errorLevel, err, msg, l.keysAndValues(keysAndValues))
+}
+
+// V returns the same logger, klog filters the entries by verbosity
+func (l jsonLogger) V(level int) logr.Logger {
+	return l
+}
+
+func (l jsonLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return jsonLogger{name: l.name, values: append(append([]interface{}{}, l.values...), keysAndValues...)}
+}
+
+func (l jsonLogger) WithName(name string) logr.Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+
+	return jsonLogger{name: name, values: l.values}
+}
+
+func (l jsonLogger) keysAndValues(keysAndValues []interface{}) []interface{} {
+	kv := append(append([]interface{}{}, l.values...), keysAndValues...)
+	if l.name != "" {
+		kv = append([]interface{}{"logger", l.name}, kv...)
+	}
+
+	return kv
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logging provides the loggers of the subsystems of the controller,
+// with verbosity levels that can be changed at runtime, and the JSON format
+// of the logs.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// TextFormat is the default format of klog
+	TextFormat = "text"
+	// JSONFormat writes each log entry as a JSON object
+	JSONFormat = "json"
+
+	// noOverride means the verbosity of the subsystem is the global one
+	noOverride = -1
+)
+
+var (
+	subsystemsMu sync.RWMutex
+	subsystems   = map[string]*Subsystem{}
+
+	// Store logs the synchronization of the Kubernetes objects
+	Store = NewSubsystem("store")
+	// Sync logs the generation of the configuration and the reloads of NGINX
+	Sync = NewSubsystem("sync")
+	// SSL logs the processing of the certificates
+	SSL = NewSubsystem("ssl")
+	// Webhook logs the validation of the admission webhook
+	Webhook = NewSubsystem("webhook")
+
+	jsonEnabled int32
+
+	outputMu sync.Mutex
+	output   io.Writer = os.Stderr
+)
+
+// SetFormat configures the format of the logs, text or json
+func SetFormat(format string) error {
+	switch format {
+	case TextFormat:
+		atomic.StoreInt32(&jsonEnabled, 0)
+	case JSONFormat:
+		atomic.StoreInt32(&jsonEnabled, 1)
+		klog.SetLogger(jsonLogger{})
+	default:
+		return fmt.Errorf("invalid log format %q, expected %v or %v", format, TextFormat, JSONFormat)
+	}
+
+	return nil
+}
+
+func isJSON() bool {
+	return atomic.LoadInt32(&jsonEnabled) == 1
+}
+
+// SetLevels replaces the verbosity of the subsystems. The subsystems not
+// present in levels use the verbosity of the flag -v
+func SetLevels(levels map[string]int) {
+	subsystemsMu.RLock()
+	defer subsystemsMu.RUnlock()
+
+	for name := range levels {
+		if _, ok := subsystems[name]; !ok {
+			klog.Warningf("Ignoring the log level of the unknown subsystem %q", name)
+		}
+	}
+
+	for name, s := range subsystems {
+		level, ok := levels[name]
+		if !ok {
+			level = noOverride
+		}
+
+		if atomic.SwapInt32(&s.level, int32(level)) != int32(level) {
+			klog.InfoS("Log level changed", "subsystem", name, "level", level)
+		}
+	}
+}
+
+// Subsystem is the logger of a part of the controller
+type Subsystem struct {
+	name  string
+	level int32
+}
+
+// NewSubsystem returns the logger of the subsystem with the given name
+func NewSubsystem(name string) *Subsystem {
+	subsystemsMu.Lock()
+	defer subsystemsMu.Unlock()
+
+	s := &Subsystem{name: name, level: noOverride}
+	subsystems[name] = s
+
+	return s
+}
+
+// Verbose logs only when the verbosity of the subsystem is at least the
+// level passed to V
+type Verbose struct {
+	s       *Subsystem
+	enabled bool
+}
+
+// V returns a Verbose enabled when the verbosity of the subsystem is at
+// least level
+func (s *Subsystem) V(level int) Verbose {
+	override := atomic.LoadInt32(&s.level)
+	if override == noOverride {
+		return Verbose{s, klog.V(klog.Level(level)).Enabled()}
+	}
+
+	return Verbose{s, int32(level) <= override}
+}
+
+// Enabled returns true if the entries of this verbosity are logged
+func (v Verbose) Enabled() bool {
+	return v.enabled
+}
+
+// Infof logs a formatted message when the verbosity is enabled
+func (v Verbose) Infof(format string, args ...interface{}) {
+	if v.enabled {
+		v.s.print(infoLevel, nil, fmt.Sprintf(format, args...), nil)
+	}
+}
+
+// InfoS logs a structured message when the verbosity is enabled
+func (v Verbose) InfoS(msg string, keysAndValues ...interface{}) {
+	if v.enabled {
+		v.s.print(infoLevel, nil, msg, keysAndValues)
+	}
+}
+
+// Infof logs a formatted message
+func (s *Subsystem) Infof(format string, args ...interface{}) {
+	s.print(infoLevel, nil, fmt.Sprintf(format, args...), nil)
+}
+
+// InfoS logs a structured message
+func (s *Subsystem) InfoS(msg string, keysAndValues ...interface{}) {
+	s.print(infoLevel, nil, msg, keysAndValues)
+}
+
+// Warningf logs a formatted warning
+func (s *Subsystem) Warningf(format string, args ...interface{}) {
+	s.print(warningLevel, nil, fmt.Sprintf(format, args...), nil)
+}
+
+// Errorf logs a formatted error
+func (s *Subsystem) Errorf(format string, args ...interface{}) {
+	s.print(errorLevel, nil, fmt.Sprintf(format, args...), nil)
+}
+
+// ErrorS logs a structured error
+func (s *Subsystem) ErrorS(err error, msg string, keysAndValues ...interface{}) {
+	s.print(errorLevel, err, msg, keysAndValues)
+}
+
+const (
+	infoLevel    = "info"
+	warningLevel = "warning"
+	errorLevel   = "error"
+
+	// depth of the caller of the methods of Subsystem and Verbose
+	callerDepth = 2
+)
+
+func (s *Subsystem) print(level string, err error, msg string, keysAndValues []interface{}) {
+	keysAndValues = append([]interface{}{"subsystem", s.name}, keysAndValues...)
+
+	if isJSON() {
+		writeJSON(level, err, msg, keysAndValues)
+		return
+	}
+
+	line := formatText(err, msg, keysAndValues)
+	switch level {
+	case errorLevel:
+		klog.ErrorDepth(callerDepth, line)
+	case warningLevel:
+		klog.WarningDepth(callerDepth, line)
+	default:
+		klog.InfoDepth(callerDepth, line)
+	}
+}
+
+// formatText returns the message followed by the key="value" pairs, like the
+// structured logs of klog
+func formatText(err error, msg string, keysAndValues []interface{}) string {
+	b := &bytes.Buffer{}
+	b.WriteString(strings.TrimSuffix(msg, "\n"))
+
+	if err != nil {
+		fmt.Fprintf(b, " err=%q", err.Error())
+	}
+
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var v interface{} = "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		}
+
+		fmt.Fprintf(b, " %v=%q", keysAndValues[i], fmt.Sprint(v))
+	}
+
+	return b.String()
+}
+
+func writeJSON(level string, err error, msg string, keysAndValues []interface{}) {
+	entry := map[string]interface{}{}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var v interface{} = "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			v = keysAndValues[i+1]
+		}
+
+		entry[fmt.Sprint(keysAndValues[i])] = jsonValue(v)
+	}
+
+	entry["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["msg"] = strings.TrimSuffix(msg, "\n")
+	if err != nil {
+		entry["err"] = err.Error()
+	}
+
+	b, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		b = []byte(fmt.Sprintf(`{"level":"error","msg":"could not encode log entry: %v"}`, jsonErr))
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	output.Write(append(b, '\n'))
+}
+
+// jsonValue returns the value as is when it can be encoded and its string
+// representation otherwise
+func jsonValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case fmt.Stringer:
+		return value.String()
+	}
+
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+
+	return v
+}
+
+// Subsystems returns the names of the subsystems
+func Subsystems() []string {
+	subsystemsMu.RLock()
+	defer subsystemsMu.RUnlock()
+
+	names := make([]string, 0, len(subsystems))
+	for name := range subsystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestSetLevels(t *testing.T) {
+	defer SetLevels(nil)
+
+	SetLevels(map[string]int{"store": 5, "ssl": 0})
+
+	if !Store.V(5).Enabled() {
+		t.Errorf("expected verbosity 5 of the store subsystem to be enabled")
+	}
+	if Store.V(6).Enabled() {
+		t.Errorf("expected verbosity 6 of the store subsystem to be disabled")
+	}
+	if SSL.V(1).Enabled() {
+		t.Errorf("expected verbosity 1 of the ssl subsystem to be disabled")
+	}
+
+	SetLevels(nil)
+
+	if Store.V(5).Enabled() {
+		t.Errorf("expected verbosity 5 of the store subsystem to use the global verbosity")
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	defer SetFormat(TextFormat)
+
+	if err := SetFormat("yaml"); err == nil {
+		t.Errorf("expected an error with an invalid format")
+	}
+
+	for _, format := range []string{TextFormat, JSONFormat} {
+		if err := SetFormat(format); err != nil {
+			t.Errorf("unexpected error with format %v: %v", format, err)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	b := &bytes.Buffer{}
+	output = b
+	defer func() { output = os.Stderr }()
+
+	writeJSON(errorLevel, fmt.Errorf("boom"), "failed\n", []interface{}{"subsystem", "sync", "ingress", "default/demo", "odd"})
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(b.Bytes(), &entry); err != nil {
+		t.Fatalf("unexpected error decoding %q: %v", b.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"level":     "error",
+		"msg":       "failed",
+		"err":       "boom",
+		"subsystem": "sync",
+		"ingress":   "default/demo",
+		"odd":       "(MISSING)",
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("expected %v to be %q but %v returned", k, v, entry[k])
+		}
+	}
+}
+
+func TestFormatText(t *testing.T) {
+	line := formatText(fmt.Errorf("boom"), "failed", []interface{}{"subsystem", "ssl", "port", 443})
+	expected := `failed err="boom" subsystem="ssl" port="443"`
+
+	if line != expected {
+		t.Errorf("expected %v but %v returned", expected, line)
+	}
+}
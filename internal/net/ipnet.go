@@ -46,6 +46,7 @@ func ParseIPNets(specs ...string) (IPNet, IP, error) {
 			continue
 		}
 
+		ipnet = unmapIPNet(ipnet)
 		k := ipnet.String()
 		ipnetset[k] = ipnet
 	}
@@ -53,6 +54,22 @@ func ParseIPNets(specs ...string) (IPNet, IP, error) {
 	return ipnetset, ipset, nil
 }
 
+// unmapIPNet converts the networks of IPv4-mapped IPv6 addresses, like
+// ::ffff:10.0.0.0/104, to IPv4 networks. Their string representation would
+// otherwise use an IPv4 address with an IPv6 prefix length (10.0.0.0/104)
+// NGINX does not accept.
+func unmapIPNet(ipnet *net.IPNet) *net.IPNet {
+	ones, bits := ipnet.Mask.Size()
+	if bits != 8*net.IPv6len || ones < 96 || ipnet.IP.To4() == nil {
+		return ipnet
+	}
+
+	return &net.IPNet{
+		IP:   ipnet.IP.To4(),
+		Mask: net.CIDRMask(ones-96, 8*net.IPv4len),
+	}
+}
+
 // ParseCIDRs parses comma separated CIDRs into a sorted string array
 func ParseCIDRs(s string) ([]string, error) {
 	if s == "" {
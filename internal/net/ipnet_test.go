@@ -35,6 +35,30 @@ func TestNewIPSet(t *testing.T) {
 	}
 }
 
+func TestParseIPNetsMixedFamilies(t *testing.T) {
+	ipnets, ips, err := ParseIPNets("10.0.0.0/8", "2001:db8::/32", "::ffff:192.168.0.0/112", "2001:DB8::1", "::ffff:172.16.0.1")
+	if err != nil {
+		t.Fatalf("error parsing IPNets: %v", err)
+	}
+
+	for _, expected := range []string{"10.0.0.0/8", "2001:db8::/32", "192.168.0.0/16"} {
+		if _, ok := ipnets[expected]; !ok {
+			t.Errorf("expected network %v in %v", expected, ipnets)
+		}
+	}
+	for _, expected := range []string{"2001:db8::1", "172.16.0.1"} {
+		if _, ok := ips[expected]; !ok {
+			t.Errorf("expected address %v in %v", expected, ips)
+		}
+	}
+
+	for _, invalid := range []string{"2001:db8::/129", "2001:db8:::1", "fe80::1%eth0", "10.0.0.0/33"} {
+		if _, _, err := ParseIPNets("10.0.0.0/8", invalid); err == nil {
+			t.Errorf("expected an error parsing %v", invalid)
+		}
+	}
+}
+
 func TestParseCIDRs(t *testing.T) {
 	cidr, _ := ParseCIDRs("invalid.com")
 	if cidr != nil {
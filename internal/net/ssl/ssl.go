@@ -43,6 +43,7 @@ import (
 	"k8s.io/ingress-nginx/internal/file"
 	"k8s.io/ingress-nginx/internal/ingress"
 	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/logging"
 	"k8s.io/ingress-nginx/internal/watch"
 	"k8s.io/klog/v2"
 )
@@ -53,8 +54,13 @@ var FakeSSLCertificateUID = "00000000-0000-0000-0000-000000000000"
 
 var (
 	oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionTLSFeature     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
 )
 
+// tlsFeatureStatusRequest is the status_request TLS feature (RFC 7633)
+// required by the certificates with the OCSP must-staple extension
+const tlsFeatureStatusRequest = 5
+
 const (
 	fakeCertificateName = "default-fake-certificate"
 )
@@ -73,7 +79,7 @@ func CreateSSLCert(cert, key []byte, uid string) (*ingress.SSLCert, error) {
 	if ngx_config.EnableSSLChainCompletion {
 		data, err := fullChainCert(cert)
 		if err != nil {
-			klog.ErrorS(err, "Error generating certificate chain for Secret")
+			logging.SSL.ErrorS(err, "Error generating certificate chain for Secret")
 		} else {
 			pemCertBuffer.Reset()
 			pemCertBuffer.Write(data)
@@ -109,11 +115,11 @@ func CreateSSLCert(cert, key []byte, uid string) (*ingress.SSLCert, error) {
 	}
 
 	if len(pemCert.Extensions) > 0 {
-		klog.V(3).InfoS("parsing ssl certificate extensions")
+		logging.SSL.V(3).InfoS("parsing ssl certificate extensions")
 		for _, ext := range getExtension(pemCert, oidExtensionSubjectAltName) {
 			dns, _, _, err := parseSANExtension(ext.Value)
 			if err != nil {
-				klog.Warningf("unexpected error parsing certificate extensions: %v", err)
+				logging.SSL.Warningf("unexpected error parsing certificate extensions: %v", err)
 				continue
 			}
 
@@ -176,6 +182,68 @@ func CheckCACert(caBytes []byte) ([]*x509.Certificate, error) {
 	return certs, nil
 }
 
+// SortCertChain validates the certificates of a PEM encoded chain and
+// returns them sorted from the leaf, the first certificate, to the
+// intermediates, each one followed by the certificate signing it. The
+// intermediates can be in any order but each one must sign a certificate of
+// the chain.
+func SortCertChain(chain []byte) ([]byte, error) {
+	certs, err := CheckCACert(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := []*x509.Certificate{certs[0]}
+	remaining := append([]*x509.Certificate{}, certs[1:]...)
+
+	for len(remaining) > 0 {
+		last := sorted[len(sorted)-1]
+
+		issuer := -1
+		for i, cert := range remaining {
+			if last.CheckSignatureFrom(cert) == nil {
+				issuer = i
+				break
+			}
+		}
+
+		if issuer == -1 {
+			break
+		}
+
+		sorted = append(sorted, remaining[issuer])
+		remaining = append(remaining[:issuer], remaining[issuer+1:]...)
+	}
+
+	// the alternative issuers, like cross-signed intermediates, are kept
+	// after the path from the leaf
+	for _, cert := range remaining {
+		signed := false
+		for _, c := range sorted {
+			if c.CheckSignatureFrom(cert) == nil {
+				signed = true
+				break
+			}
+		}
+
+		if !signed {
+			return nil, fmt.Errorf("certificate %q does not sign any certificate of the chain", cert.Subject.CommonName)
+		}
+
+		sorted = append(sorted, cert)
+	}
+
+	var buf bytes.Buffer
+	for _, cert := range sorted {
+		err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
 // StoreSSLCertOnDisk creates a .pem file with content PemCertKey from the given sslCert
 // and sets relevant remaining fields of sslCert object
 func StoreSSLCertOnDisk(name string, sslCert *ingress.SSLCert) (string, error) {
@@ -257,7 +325,7 @@ func ConfigureCACert(name string, ca []byte, sslCert *ingress.SSLCert) error {
 
 	sslCert.CAFileName = fileName
 
-	klog.V(3).InfoS("Created CA Certificate for Authentication", "path", fileName)
+	logging.SSL.V(3).InfoS("Created CA Certificate for Authentication", "path", fileName)
 
 	return nil
 }
@@ -272,6 +340,31 @@ func getExtension(c *x509.Certificate, id asn1.ObjectIdentifier) []pkix.Extensio
 	return exts
 }
 
+// HasMustStaple checks if the certificate requires a stapled OCSP response,
+// with the status_request TLS feature extension (RFC 7633)
+func HasMustStaple(c *x509.Certificate) bool {
+	if c == nil {
+		return false
+	}
+
+	for _, ext := range getExtension(c, oidExtensionTLSFeature) {
+		// Features ::= SEQUENCE OF INTEGER
+		var features []int
+		if _, err := asn1.Unmarshal(ext.Value, &features); err != nil {
+			logging.SSL.Warningf("unexpected error parsing the TLS feature extension: %v", err)
+			continue
+		}
+
+		for _, feature := range features {
+			if feature == tlsFeatureStatusRequest {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func parseSANExtension(value []byte) (dnsNames, emailAddresses []string, ipAddresses []net.IP, err error) {
 	// RFC 5280, 4.2.1.6
 
@@ -334,7 +427,7 @@ func AddOrUpdateDHParam(name string, dh []byte) (string, error) {
 
 	tempPemFile, err := ioutil.TempFile(file.DefaultSSLDirectory, pemName)
 
-	klog.V(3).InfoS("Creating temporal file for DH", "path", tempPemFile.Name(), "name", pemName)
+	logging.SSL.V(3).InfoS("Creating temporal file for DH", "path", tempPemFile.Name(), "name", pemName)
 	if err != nil {
 		return "", fmt.Errorf("could not create temp pem file %v: %v", pemFileName, err)
 	}
@@ -395,6 +488,13 @@ func GetFakeSSLCert() *ingress.SSLCert {
 	return sslCert
 }
 
+// FakeSSLCertPath returns the path of the file of the certificate created
+// by GetFakeSSLCert
+func FakeSSLCertPath() string {
+	path, _ := getPemFileName(fakeCertificateName)
+	return path
+}
+
 func getFakeHostSSLCert(host string) ([]byte, []byte) {
 	var priv interface{}
 	var err error
@@ -529,7 +629,7 @@ func (tl *TLSListener) TLSConfig() *tls.Config {
 }
 
 func (tl *TLSListener) load() {
-	klog.InfoS("loading tls certificate", "path", tl.certificatePath, "key", tl.keyPath)
+	logging.SSL.InfoS("loading tls certificate", "path", tl.certificatePath, "key", tl.keyPath)
 	certBytes, err := ioutil.ReadFile(tl.certificatePath)
 	if err != nil {
 		tl.certificate = nil
@@ -270,6 +270,80 @@ func TestCreateSSLCert(t *testing.T) {
 	}
 }
 
+func TestSortCertChain(t *testing.T) {
+	root, err := newCA("root-ca")
+	if err != nil {
+		t.Fatalf("unexpected error creating CA: %v", err)
+	}
+
+	caKey, err := newPrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error creating private key: %v", err)
+	}
+
+	caTmpl := x509.Certificate{
+		Subject:               pkix.Name{CommonName: "intermediate-ca"},
+		SerialNumber:          big.NewInt(2),
+		NotBefore:             root.Cert.NotBefore,
+		NotAfter:              time.Now().Add(duration365d).UTC(),
+		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDERBytes, err := x509.CreateCertificate(cryptorand.Reader, &caTmpl, root.Cert, caKey.Public(), root.Key)
+	if err != nil {
+		t.Fatalf("unexpected error signing certificate: %v", err)
+	}
+	caCert, err := x509.ParseCertificate(caDERBytes)
+	if err != nil {
+		t.Fatalf("unexpected error parsing certificate: %v", err)
+	}
+
+	key, err := newPrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error creating private key: %v", err)
+	}
+
+	leaf, err := newSignedCert(certutil.Config{CommonName: "echoheaders", Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}, key, caCert, caKey)
+	if err != nil {
+		t.Fatalf("unexpected error signing certificate: %v", err)
+	}
+
+	other, err := newCA("other-ca")
+	if err != nil {
+		t.Fatalf("unexpected error creating CA: %v", err)
+	}
+
+	expected := bytes.Join([][]byte{encodeCertPEM(leaf), encodeCertPEM(caCert), encodeCertPEM(root.Cert)}, nil)
+
+	chains := [][]byte{
+		expected,
+		bytes.Join([][]byte{encodeCertPEM(leaf), encodeCertPEM(root.Cert), encodeCertPEM(caCert)}, nil),
+	}
+	for _, chain := range chains {
+		sorted, err := SortCertChain(chain)
+		if err != nil {
+			t.Errorf("unexpected error sorting a valid chain: %v", err)
+		}
+		if !bytes.Equal(sorted, expected) {
+			t.Errorf("expected the chain sorted from the leaf to the root")
+		}
+	}
+
+	if _, err := SortCertChain(encodeCertPEM(leaf)); err != nil {
+		t.Errorf("unexpected error sorting a certificate without intermediates: %v", err)
+	}
+
+	chain := append(encodeCertPEM(leaf), encodeCertPEM(other.Cert)...)
+	if _, err := SortCertChain(chain); err == nil {
+		t.Errorf("expected an error sorting a chain with a wrong intermediate")
+	}
+
+	if _, err := SortCertChain([]byte("invalid")); err == nil {
+		t.Errorf("expected an error sorting an invalid chain")
+	}
+}
+
 type keyPair struct {
 	Key  *rsa.PrivateKey
 	Cert *x509.Certificate
@@ -335,6 +409,38 @@ const (
 )
 
 // newPrivateKey creates an RSA private key
+func TestHasMustStaple(t *testing.T) {
+	tlsFeature := func(value []byte) *x509.Certificate {
+		return &x509.Certificate{
+			Extensions: []pkix.Extension{{Id: oidExtensionTLSFeature, Value: value}},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		cert     *x509.Certificate
+		expected bool
+	}{
+		{"nil certificate", nil, false},
+		{"no extension", &x509.Certificate{}, false},
+		// SEQUENCE { INTEGER 5 }
+		{"status request", tlsFeature([]byte{0x30, 0x03, 0x02, 0x01, 0x05}), true},
+		// SEQUENCE { INTEGER 17, INTEGER 5 }
+		{"status request v2 and status request", tlsFeature([]byte{0x30, 0x06, 0x02, 0x01, 0x11, 0x02, 0x01, 0x05}), true},
+		// SEQUENCE { INTEGER 17 }
+		{"other feature", tlsFeature([]byte{0x30, 0x03, 0x02, 0x01, 0x11}), false},
+		{"invalid extension", tlsFeature([]byte{0x05}), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := HasMustStaple(tc.cert); got != tc.expected {
+				t.Errorf("expected %v but returned %v", tc.expected, got)
+			}
+		})
+	}
+}
+
 func newPrivateKey() (*rsa.PrivateKey, error) {
 	return rsa.GenerateKey(cryptorand.Reader, rsaKeySize)
 }
@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"time"
 
@@ -58,6 +59,9 @@ var StatusPath = "/nginx_status"
 // StreamPort defines the port used by NGINX for the NGINX stream configuration socket
 var StreamPort = 10247
 
+// HealthzPort port used by the ingress controller for the healthz endpoint and the metrics
+var HealthzPort = 10254
+
 // NewGetStatusRequest creates a new GET request to the internal NGINX status server
 func NewGetStatusRequest(path string) (int, []byte, error) {
 	url := fmt.Sprintf("http://127.0.0.1:%v%v", StatusPort, path)
@@ -158,6 +162,34 @@ func Version() string {
 	return string(out)
 }
 
+// openSSLVersionRegex matches the version of the OpenSSL library in the
+// output of nginx -V, the library NGINX runs with takes precedence over the
+// one it was built with
+var openSSLVersionRegex = regexp.MustCompile(`(built|running) with OpenSSL (\d+\.\d+\.\d+)`)
+
+// OpenSSLVersion returns the version of the OpenSSL library used by NGINX,
+// like 3.0.8, or an empty string when it cannot be obtained
+func OpenSSLVersion() string {
+	out, err := exec.Command("nginx", "-V").CombinedOutput()
+	if err != nil {
+		klog.Warningf("unexpected error obtaining the OpenSSL version of NGINX: %v", err)
+		return ""
+	}
+
+	return parseOpenSSLVersion(string(out))
+}
+
+func parseOpenSSLVersion(out string) string {
+	version := ""
+	for _, match := range openSSLVersionRegex.FindAllStringSubmatch(out, -1) {
+		if version == "" || match[1] == "running" {
+			version = match[2]
+		}
+	}
+
+	return version
+}
+
 // IsRunning returns true if a process with the name 'nginx' is found
 func IsRunning() bool {
 	processes, _ := ps.Processes()
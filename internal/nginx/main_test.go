@@ -0,0 +1,38 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import "testing"
+
+func TestParseOpenSSLVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		expected string
+	}{
+		{"built with", "nginx version: nginx/1.19.9\nbuilt by gcc 10.2.1\nbuilt with OpenSSL 3.0.8 7 Feb 2023\nTLS SNI support enabled", "3.0.8"},
+		{"running with another version", "built with OpenSSL 1.1.1k  25 Mar 2021 (running with OpenSSL 3.5.0 8 Apr 2025)", "3.5.0"},
+		{"LibreSSL", "built with LibreSSL 3.3.3", ""},
+		{"no output", "", ""},
+	}
+
+	for _, test := range tests {
+		if actual := parseOpenSSLVersion(test.out); actual != test.expected {
+			t.Errorf("%v: expected '%v' but returned '%v'", test.name, test.expected, actual)
+		}
+	}
+}
@@ -58,6 +58,21 @@ func GeoLite2DBExists() bool {
 	return true
 }
 
+// GeoIP2CountryDB returns the database of files used to determine the country
+// and the continent of the clients, preferring the Country databases to the
+// City ones, or an empty string when none of them is available
+func GeoIP2CountryDB(files []string) string {
+	for _, dbName := range []string{"GeoIP2-Country", "GeoLite2-Country", "GeoIP2-City", "GeoLite2-City"} {
+		for _, file := range files {
+			if file == dbName+dbExtension {
+				return file
+			}
+		}
+	}
+
+	return ""
+}
+
 // DownloadGeoLite2DB downloads the required databases by the
 // GeoIP2 NGINX module using a license key from MaxMind.
 func DownloadGeoLite2DB() error {
@@ -18,6 +18,7 @@ package task
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/klog/v2"
@@ -47,6 +48,9 @@ type Queue struct {
 	fn func(obj interface{}) (interface{}, error)
 	// lastSync is the Unix epoch time of the last execution of 'sync'
 	lastSync int64
+	// syncStart is the Unix epoch time of the start of the running
+	// execution of 'sync', 0 when the worker is idle
+	syncStart int64
 }
 
 // Element represents one item of the queue
@@ -118,15 +122,19 @@ func (t *Queue) worker() {
 		ts := time.Now().UnixNano()
 
 		item := key.(Element)
-		if t.lastSync > item.Timestamp {
-			klog.V(3).InfoS("skipping sync", "key", item.Key, "last", t.lastSync, "now", item.Timestamp)
+		lastSync := atomic.LoadInt64(&t.lastSync)
+		if lastSync > item.Timestamp {
+			klog.V(3).InfoS("skipping sync", "key", item.Key, "last", lastSync, "now", item.Timestamp)
 			t.queue.Forget(key)
 			t.queue.Done(key)
 			continue
 		}
 
 		klog.V(3).InfoS("syncing", "key", item.Key)
-		if err := t.sync(key); err != nil {
+		atomic.StoreInt64(&t.syncStart, ts)
+		err := t.sync(key)
+		atomic.StoreInt64(&t.syncStart, 0)
+		if err != nil {
 			klog.ErrorS(err, "requeuing", "key", item.Key)
 			t.queue.AddRateLimited(Element{
 				Key:       item.Key,
@@ -134,7 +142,7 @@ func (t *Queue) worker() {
 			})
 		} else {
 			t.queue.Forget(key)
-			t.lastSync = ts
+			atomic.StoreInt64(&t.lastSync, ts)
 		}
 
 		t.queue.Done(key)
@@ -151,6 +159,31 @@ func isClosed(ch <-chan bool) bool {
 	return false
 }
 
+// Len returns the number of items waiting in the queue
+func (t *Queue) Len() int {
+	return t.queue.Len()
+}
+
+// LastSync returns the start time of the last successful execution of sync,
+// the zero time when there was none
+func (t *Queue) LastSync() time.Time {
+	return unixNano(atomic.LoadInt64(&t.lastSync))
+}
+
+// SyncStart returns the start time of the running execution of sync, the
+// zero time when the worker is idle
+func (t *Queue) SyncStart() time.Time {
+	return unixNano(atomic.LoadInt64(&t.syncStart))
+}
+
+func unixNano(ts int64) time.Time {
+	if ts == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, ts)
+}
+
 // Shutdown shuts down the work queue and waits for the worker to ACK
 func (t *Queue) Shutdown() {
 	t.queue.ShutDown()
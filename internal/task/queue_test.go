@@ -157,3 +157,47 @@ func TestSkipEnqueue(t *testing.T) {
 	// shutdown queue before exit
 	q.Shutdown()
 }
+
+func TestSyncState(t *testing.T) {
+	release := make(chan struct{})
+	var syncs uint32
+	q := NewCustomTaskQueue(func(key interface{}) error {
+		// the first sync never returns until released
+		if atomic.AddUint32(&syncs, 1) == 1 {
+			<-release
+		}
+		return nil
+	}, mockKeyFn)
+	stopCh := make(chan struct{})
+	go q.Run(time.Second, stopCh)
+
+	q.EnqueueTask(mockEnqueueObj{k: "first"})
+	time.Sleep(time.Millisecond * 10)
+	if q.SyncStart().IsZero() {
+		t.Errorf("expected a sync in progress")
+	}
+	if !q.LastSync().IsZero() {
+		t.Errorf("expected no successful sync but the last one started at %v", q.LastSync())
+	}
+
+	q.EnqueueTask(mockEnqueueObj{k: "second"})
+	time.Sleep(time.Millisecond * 10)
+	if q.Len() != 1 {
+		t.Errorf("expected the second item to wait in the queue but its length is %d", q.Len())
+	}
+
+	close(release)
+	time.Sleep(time.Millisecond * 10)
+	if atomic.LoadUint32(&syncs) != 2 {
+		t.Errorf("expected the second item to be synced but %d syncs were run", syncs)
+	}
+	if q.LastSync().IsZero() {
+		t.Errorf("expected a successful sync")
+	}
+	if !q.SyncStart().IsZero() {
+		t.Errorf("expected no sync in progress but one started at %v", q.SyncStart())
+	}
+
+	close(stopCh)
+	q.Shutdown()
+}
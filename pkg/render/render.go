@@ -0,0 +1,187 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render predicts the NGINX configuration the ingress controller
+// generates for a set of Kubernetes objects, without a cluster and without
+// running NGINX. It is meant to be used by tools like CI pipelines that want
+// to review the nginx.conf produced by a change in the Ingress rules.
+package render
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eapache/channels"
+	apiv1 "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/ingress-nginx/internal/ingress"
+	"k8s.io/ingress-nginx/internal/ingress/annotations/class"
+	"k8s.io/ingress-nginx/internal/ingress/controller"
+	ngx_config "k8s.io/ingress-nginx/internal/ingress/controller/config"
+	"k8s.io/ingress-nginx/internal/ingress/controller/store"
+	ngx_template "k8s.io/ingress-nginx/internal/ingress/controller/template"
+	"k8s.io/ingress-nginx/internal/k8s"
+	"k8s.io/ingress-nginx/internal/net/ssl"
+	"k8s.io/ingress-nginx/internal/nginx"
+)
+
+const (
+	configMapNamespace = "ingress-nginx"
+	configMapName      = "ingress-nginx-controller"
+
+	syncTimeout = 10 * time.Second
+)
+
+// Options defines the input of the rendering of the NGINX configuration
+type Options struct {
+	// TemplatePath is the path of the nginx.tmpl file. The template of
+	// the controller image is used when empty.
+	TemplatePath string
+
+	// ConfigMap contains the settings of the configuration ConfigMap of the
+	// controller.
+	ConfigMap map[string]string
+
+	// Objects contains the Ingresses, Services, Endpoints, Secrets and
+	// ConfigMaps used to build the configuration.
+	Objects []runtime.Object
+
+	// ListenPorts contains the ports the controller listens on. The default
+	// ports of the controller are used when nil.
+	ListenPorts *ngx_config.ListenPorts
+
+	// DisableCatchAll ignores Ingresses with a default backend, like the
+	// flag --disable-catch-all of the controller.
+	DisableCatchAll bool
+}
+
+// Result contains the rendered NGINX configuration
+type Result struct {
+	// Configuration is the content of the nginx.conf file
+	Configuration []byte
+
+	// Hosts contains the server names of the configuration
+	Hosts []string
+}
+
+// Render returns the NGINX configuration the controller generates for the
+// objects and settings defined in opts
+func Render(opts Options) (*Result, error) {
+	templatePath := opts.TemplatePath
+	if templatePath == "" {
+		templatePath = nginx.TemplatePath
+	}
+
+	t, err := ngx_template.NewTemplate(templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	listenPorts := opts.ListenPorts
+	if listenPorts == nil {
+		listenPorts = &ngx_config.ListenPorts{
+			Default:       8181,
+			Health:        10254,
+			HTTP:          80,
+			HTTPS:         443,
+			SSLProxy:      442,
+			HTTP1SSLProxy: ngx_config.DefaultHTTP1SSLProxyPort,
+		}
+	}
+
+	objects := []runtime.Object{&apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMapName,
+			Namespace: configMapNamespace,
+		},
+		Data: opts.ConfigMap,
+	}}
+	for _, obj := range opts.Objects {
+		// the store watches the Ingresses of networking.k8s.io/v1beta1 when
+		// the version of the cluster does not serve networking.k8s.io/v1
+		if ing, ok := obj.(*networking.Ingress); ok && !k8s.IsIngressV1Ready {
+			obj = k8s.ToIngressV1Beta1(ing)
+		}
+		objects = append(objects, obj)
+	}
+
+	client := fake.NewSimpleClientset(objects...)
+
+	s := store.New(
+		"",
+		fmt.Sprintf("%v/%v", configMapNamespace, configMapName),
+		nil,
+		"", "", "",
+		0,
+		client,
+		nil,
+		channels.NewRingChannel(1024),
+		opts.DisableCatchAll)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	s.Run(stopCh)
+
+	// the Ingresses are added to the store by the handlers of the informer
+	// after the cache is synced
+	expected := countIngresses(opts.Objects)
+	err = wait.PollImmediate(100*time.Millisecond, syncTimeout, func() (bool, error) {
+		return len(s.ListIngresses()) >= expected, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("timed out waiting for %v Ingresses to be synced", expected)
+	}
+
+	content, pcfg, err := controller.Render(&controller.Configuration{
+		ListenPorts:     listenPorts,
+		DisableCatchAll: opts.DisableCatchAll,
+		// the certificate is not created, only its path is rendered
+		FakeCertificate: &ingress.SSLCert{
+			UID:         ssl.FakeSSLCertificateUID,
+			PemFileName: ssl.FakeSSLCertPath(),
+		},
+	}, s, t)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]string, 0, len(pcfg.Servers))
+	for _, server := range pcfg.Servers {
+		hosts = append(hosts, server.Hostname)
+	}
+
+	return &Result{
+		Configuration: content,
+		Hosts:         hosts,
+	}, nil
+}
+
+func countIngresses(objects []runtime.Object) int {
+	count := 0
+	for _, obj := range objects {
+		if ing, ok := obj.(*networking.Ingress); ok && class.IsValid(ing) {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,105 @@
+-- Adapts the limit of requests in flight to each backend, configured with
+-- the annotation nginx.ingress.kubernetes.io/adaptive-concurrency, to its
+-- latency. Every window the average latency is compared with the baseline
+-- latency of the backend: the limit is decreased proportionally to the
+-- gradient when the latency degrades over the tolerance (multiplicative
+-- decrease) and increased, while the limit is reached, otherwise (additive
+-- increase).
+local ngx = ngx
+
+local math_max = math.max
+local math_min = math.min
+local math_sqrt = math.sqrt
+local tonumber = tonumber
+local string_match = string.match
+
+local data = ngx.shared.inflight_requests
+
+-- duration, in seconds, of the windows used to sample the latency
+local WINDOW = 1
+-- the windows with less samples are accumulated with the next one
+local MIN_SAMPLES = 10
+-- weight of the latency of each window in the baseline latency, so the
+-- baseline follows persistent changes of the latency of the backend
+local BASELINE_WEIGHT = 0.05
+-- lowest factor applied to the limit in a decrease
+local MAX_DECREASE = 0.5
+
+local _M = {}
+
+local function key(name, backend)
+  return name .. "|" .. backend
+end
+
+local function update(backend, config)
+  local count = data:get(key("count", backend))
+  local average = (data:get(key("sum", backend)) or 0) / count
+  data:set(key("sum", backend), 0)
+  data:set(key("count", backend), 0)
+
+  local baseline = data:get(key("baseline", backend))
+  if not baseline or average < baseline then
+    baseline = average
+  else
+    baseline = baseline + (average - baseline) * BASELINE_WEIGHT
+  end
+  data:set(key("baseline", backend), baseline)
+
+  local limit = _M.get_limit(backend, config)
+  local saturated = data:get(key("saturated", backend))
+  data:delete(key("saturated", backend))
+
+  local gradient = 1
+  if average > 0 then
+    gradient = baseline * config.tolerance / average
+  end
+
+  if gradient < 1 then
+    limit = limit * math_max(MAX_DECREASE, gradient)
+  elseif saturated then
+    limit = limit + math_sqrt(limit)
+  end
+
+  limit = math_min(config.max_limit, math_max(config.min_limit, limit))
+  data:set(key("limit", backend), limit)
+end
+
+function _M.is_enabled(config)
+  return config ~= nil and config.enabled == true
+end
+
+-- get_limit returns the current limit of the backend, the limit starts at
+-- the minimum and increases while the latency is stable.
+function _M.get_limit(backend, config)
+  local limit = data:get(key("limit", backend)) or config.min_limit
+  return math_min(config.max_limit, math_max(config.min_limit, limit))
+end
+
+-- saturated must be called when the requests in flight reach the limit
+function _M.saturated(backend)
+  data:set(key("saturated", backend), true, WINDOW * 2)
+end
+
+-- record adds the latency of the last try of the request to the current
+-- window and, once the window is over, updates the limit of the backend.
+function _M.record(backend, config)
+  local upstream_response_time = ngx.var.upstream_response_time
+  if not upstream_response_time then
+    return
+  end
+
+  local latency = tonumber(string_match(upstream_response_time, "([%d.]+)%s*$"))
+  if not latency then
+    return
+  end
+
+  data:incr(key("sum", backend), latency, 0)
+  local count = data:incr(key("count", backend), 1, 0)
+
+  -- only one worker updates the limit in each window
+  if count and count >= MIN_SAMPLES and data:add(key("window", backend), true, WINDOW) then
+    update(backend, config)
+  end
+end
+
+return _M
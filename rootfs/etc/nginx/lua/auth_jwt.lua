@@ -0,0 +1,384 @@
+-- Validates the JSON Web Tokens of the requests to the locations with the
+-- auth-jwt annotations, without an external authentication service. The
+-- signatures are verified with the public keys of a JSON Web Key Set,
+-- fetched by the controller and shared by the workers.
+local cjson = require("cjson.safe")
+local decode_base64url = require("ngx.base64").decode_base64url
+
+local ngx = ngx
+local ipairs = ipairs
+local pairs = pairs
+local pcall = pcall
+local require = require
+local setmetatable = setmetatable
+local type = type
+local tostring = tostring
+local string_byte = string.byte
+local string_char = string.char
+local string_format = string.format
+local string_match = string.match
+local string_sub = string.sub
+local table_concat = table.concat
+local math_floor = math.floor
+
+local jwks_data = ngx.shared.auth_jwt_jwks
+
+-- prefix of the flags of the key sets the controller must fetch again
+local REFRESH_PREFIX = "refresh|"
+
+-- prefix of the locks of the refresh requests. A single worker requests
+-- the refresh of a key set every REFRESH_LOCK_TTL seconds, the minimum time
+-- between two fetches of the controller, instead of every request with an
+-- unknown key or without key set
+local REFRESH_LOCK_PREFIX = "refresh_lock|"
+local REFRESH_LOCK_TTL = 10
+
+-- only asymmetric algorithms are allowed, a token signed with HS256 and
+-- the public key as secret must not be accepted
+local ALGORITHMS = {
+  RS256 = "RSA", RS384 = "RSA", RS512 = "RSA",
+  ES256 = "EC", ES384 = "EC", ES512 = "EC",
+}
+
+-- DER encoded object identifiers of the public keys
+local OID_RSA_ENCRYPTION = "\6\9\42\134\72\134\247\13\1\1\1"
+local OID_EC_PUBLIC_KEY = "\6\7\42\134\72\206\61\2\1"
+local OID_CURVES = {
+  ["P-256"] = "\6\8\42\134\72\206\61\3\1\7",
+  ["P-384"] = "\6\5\43\129\4\0\34",
+  ["P-521"] = "\6\5\43\129\4\0\35",
+}
+
+-- lua-resty-jwt is only required by the locations with the annotations,
+-- the images built without it keep working
+local has_jwt, jwt = pcall(require, "resty.jwt")
+local has_validators, validators = pcall(require, "resty.jwt-validators")
+
+local _M = {}
+
+-- decoded key sets of the worker, by URL
+local decoded_jwks = {}
+
+-- time before which the worker does not request again the refresh of the
+-- key sets, by URL
+local refresh_locked_until = {}
+
+local function der_length(length)
+  if length < 128 then
+    return string_char(length)
+  end
+
+  local bytes = ""
+  while length > 0 do
+    bytes = string_char(length % 256) .. bytes
+    length = math_floor(length / 256)
+  end
+
+  return string_char(128 + #bytes) .. bytes
+end
+
+local function der(tag, value)
+  return string_char(tag) .. der_length(#value) .. value
+end
+
+local function der_integer(value)
+  -- the integers are signed, a leading zero keeps them positive
+  if string_byte(value, 1) >= 128 then
+    value = "\0" .. value
+  end
+
+  return der(0x02, value)
+end
+
+local function public_key_der(jwk)
+  if jwk.kty == "RSA" then
+    local n = jwk.n and decode_base64url(jwk.n)
+    local e = jwk.e and decode_base64url(jwk.e)
+    if not n or not e then
+      return nil
+    end
+
+    local algorithm = der(0x30, OID_RSA_ENCRYPTION .. "\5\0")
+    local key = der(0x30, der_integer(n) .. der_integer(e))
+    return der(0x30, algorithm .. der(0x03, "\0" .. key))
+  end
+
+  if jwk.kty == "EC" then
+    local curve = OID_CURVES[jwk.crv]
+    local x = jwk.x and decode_base64url(jwk.x)
+    local y = jwk.y and decode_base64url(jwk.y)
+    if not curve or not x or not y then
+      return nil
+    end
+
+    local algorithm = der(0x30, OID_EC_PUBLIC_KEY .. curve)
+    return der(0x30, algorithm .. der(0x03, "\0\4" .. x .. y))
+  end
+
+  return nil
+end
+
+-- jwk_to_pem returns the public key of the JSON Web Key in PEM format
+function _M.jwk_to_pem(jwk)
+  local key = public_key_der(jwk)
+  if not key then
+    return nil
+  end
+
+  local encoded = ngx.encode_base64(key)
+  local lines = {}
+  for i = 1, #encoded, 64 do
+    lines[#lines + 1] = string_sub(encoded, i, i + 63)
+  end
+
+  return string_format("-----BEGIN PUBLIC KEY-----\n%s\n-----END PUBLIC KEY-----\n",
+    table_concat(lines, "\n"))
+end
+
+-- request_refresh asks the controller to fetch the key set again, when
+-- its keys were rotated or when it is missing
+local function request_refresh(url)
+  local now = ngx.now()
+  if (refresh_locked_until[url] or 0) > now then
+    return
+  end
+  refresh_locked_until[url] = now + REFRESH_LOCK_TTL
+
+  -- the other workers requested it already
+  local ok = jwks_data:add(REFRESH_LOCK_PREFIX .. url, true, REFRESH_LOCK_TTL)
+  if not ok then
+    return
+  end
+
+  jwks_data:set(REFRESH_PREFIX .. url, true)
+end
+
+local function decode_jwks(url, body)
+  local cached = decoded_jwks[url]
+  if cached and cached.body == body then
+    return cached.jwks
+  end
+
+  local jwks = cjson.decode(body)
+  decoded_jwks[url] = { body = body, jwks = jwks }
+
+  return jwks
+end
+
+local function get_jwks(url)
+  local body = jwks_data:get(url)
+  if not body then
+    request_refresh(url)
+    return nil
+  end
+
+  return decode_jwks(url, body)
+end
+
+local function find_key(jwks, kid, kty)
+  for _, key in ipairs(jwks.keys or {}) do
+    if key.kty == kty and (not kid or key.kid == kid) and (not key.use or key.use == "sig") then
+      return key
+    end
+  end
+
+  return nil
+end
+
+local function get_key(config, header)
+  local kty = ALGORITHMS[header.alg]
+  if not kty then
+    return nil
+  end
+
+  local jwks = get_jwks(config.jwks_url)
+  if not jwks then
+    return nil
+  end
+
+  local key = find_key(jwks, header.kid, kty)
+  if not key and header.kid then
+    -- the controller limits the fetches of the key sets with unknown keys
+    request_refresh(config.jwks_url)
+  end
+
+  if not key or (key.alg and key.alg ~= header.alg) then
+    return nil
+  end
+
+  return _M.jwk_to_pem(key)
+end
+
+local function contains(value, expected)
+  if type(value) == "table" then
+    for _, v in ipairs(value) do
+      if tostring(v) == expected then
+        return true
+      end
+    end
+    return false
+  end
+
+  return tostring(value) == expected
+end
+
+local function claim_spec(config)
+  local spec = {
+    exp = validators.is_not_expired(),
+    nbf = validators.opt_is_not_before(),
+  }
+
+  if config.issuer ~= "" then
+    spec.iss = validators.equals(config.issuer)
+  end
+
+  if #config.audiences > 0 then
+    spec.aud = function(value)
+      for _, audience in ipairs(config.audiences) do
+        if value and contains(value, audience) then
+          return true
+        end
+      end
+      return false
+    end
+  end
+
+  return spec
+end
+
+local function has_required_claims(config, payload)
+  for _, claim in ipairs(config.required_claims) do
+    local value = payload[claim.name]
+    if value == nil or (claim.value ~= "" and not contains(value, claim.value)) then
+      return false
+    end
+  end
+
+  return true
+end
+
+local function reject(status, description)
+  ngx.header["WWW-Authenticate"] = string_format('Bearer error="invalid_token", error_description="%s"',
+    description)
+  return ngx.exit(status)
+end
+
+-- verify returns the claims of the token of the request, or nil with the
+-- error description when it is not valid, or without description when the
+-- request has no token
+local function verify(config)
+  local token = string_match(ngx.var.http_authorization or "", "^[Bb]earer%s+(%S+)$")
+  if not token then
+    return nil
+  end
+
+  local jwt_obj = jwt:load_jwt(token)
+  if not jwt_obj.valid then
+    return nil, "malformed token"
+  end
+
+  local key = get_key(config, jwt_obj.header)
+  if not key then
+    return nil, "unknown signing key"
+  end
+
+  jwt_obj = jwt:verify_jwt_obj(key, jwt_obj, claim_spec(config))
+  if not jwt_obj.verified then
+    ngx.log(ngx.INFO, "invalid JSON Web Token: ", jwt_obj.reason)
+    return nil, "invalid token"
+  end
+
+  return jwt_obj.payload
+end
+
+-- payload returns the claims of the valid token of the request, like
+-- verify, the token is only verified once per request and configuration
+function _M.payload(config)
+  if not config or not config.jwks_url or not has_jwt or not has_validators then
+    return nil
+  end
+
+  local verified = ngx.ctx.auth_jwt_verified
+  if not verified or verified.config ~= config then
+    local payload, description = verify(config)
+    verified = { config = config, payload = payload, description = description }
+    ngx.ctx.auth_jwt_verified = verified
+  end
+
+  return verified.payload, verified.description
+end
+
+function _M.rewrite(config)
+  if not config or not config.jwks_url then
+    return
+  end
+
+  if not has_jwt or not has_validators then
+    ngx.log(ngx.ERR, "lua-resty-jwt is not available to validate the JSON Web Tokens")
+    return ngx.exit(ngx.HTTP_INTERNAL_SERVER_ERROR)
+  end
+
+  -- the headers with the claims cannot be sent by the clients
+  for _, header in ipairs(config.claim_headers) do
+    ngx.req.clear_header(header.header)
+  end
+
+  local payload, description = _M.payload(config)
+  if not payload then
+    if description then
+      return reject(ngx.HTTP_UNAUTHORIZED, description)
+    end
+    ngx.header["WWW-Authenticate"] = "Bearer"
+    return ngx.exit(ngx.HTTP_UNAUTHORIZED)
+  end
+
+  if not has_required_claims(config, payload) then
+    return ngx.exit(ngx.HTTP_FORBIDDEN)
+  end
+
+  for _, header in ipairs(config.claim_headers) do
+    local value = payload[header.claim]
+    if type(value) == "table" then
+      local ok, joined = pcall(table_concat, value, ",")
+      value = ok and joined or nil
+    end
+    if value ~= nil then
+      ngx.req.set_header(header.header, tostring(value))
+    end
+  end
+end
+
+-- set_keys stores the key sets sent by the controller, by URL, and deletes
+-- the ones with a null value
+function _M.set_keys(keys)
+  for url, jwks in pairs(keys) do
+    if jwks == cjson.null then
+      jwks_data:delete(url)
+    else
+      local ok, err, forcible = jwks_data:set(url, cjson.encode(jwks))
+      if not ok then
+        ngx.log(ngx.ERR, "error storing the JSON Web Key Set ", url, ": ", err)
+      elseif forcible then
+        ngx.log(ngx.WARN, "auth_jwt_jwks shared dictionary is full, consider increasing its size")
+      end
+    end
+  end
+end
+
+-- take_refresh_requests returns the URLs of the key sets the controller
+-- must fetch again or send again, because a token was signed with an
+-- unknown key or because the key set is missing
+function _M.take_refresh_requests(urls)
+  local requested = setmetatable({}, cjson.array_mt)
+  for _, url in ipairs(urls) do
+    local refresh = jwks_data:get(REFRESH_PREFIX .. url)
+    if refresh or not jwks_data:get(url) then
+      jwks_data:delete(REFRESH_PREFIX .. url)
+      requested[#requested + 1] = url
+    end
+  end
+
+  return requested
+end
+
+return _M
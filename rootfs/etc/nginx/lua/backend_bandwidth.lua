@@ -0,0 +1,98 @@
+-- Caps the aggregate bandwidth of the responses of the backends of the
+-- locations with the annotation nginx.ingress.kubernetes.io/limit-backend-bandwidth,
+-- across all the requests and workers. The bytes of the responses are
+-- taken from a token bucket of the backend, when it is empty the responses
+-- are slowed down with the limit_rate of their request until the backend is
+-- back to its rate. With proxy buffering disabled, the backend is then read
+-- at the pace of the clients.
+local ngx = ngx
+local math_floor = math.floor
+local math_max = math.max
+local math_min = math.min
+local tonumber = tonumber
+
+local buckets = ngx.shared.backend_bandwidth
+
+local _M = {}
+
+-- reserve takes the bytes from the bucket of the backend and returns the
+-- number of seconds they must be delayed to keep the rate of the backend.
+-- The bucket stores the time at which the backend is back to its rate.
+local function reserve(key, bytes, rate, burst)
+  local now = ngx.now()
+  local cost = bytes / rate
+
+  local tat, err, forcible = buckets:incr(key, cost, now)
+  if not tat then
+    -- do not slow down the responses when the buckets are not available
+    ngx.log(ngx.WARN, "error updating the bandwidth of the backend ", key, ": ", err)
+    return 0
+  end
+  if forcible then
+    ngx.log(ngx.WARN, "backend_bandwidth shared dictionary is full, consider increasing its size")
+  end
+
+  if tat - cost < now then
+    -- the backend was idle, its bucket is full again
+    tat = now + cost
+    buckets:set(key, tat)
+  end
+
+  return tat - now - burst / rate
+end
+
+-- rewrite enables the limit of the backend of the location for the response
+function _M.rewrite(config)
+  if not config or config.rate <= 0 then
+    return
+  end
+
+  ngx.ctx.backend_bandwidth = {
+    key = ngx.var.proxy_upstream_name or "",
+    rate = config.rate,
+    burst = config.burst,
+    -- the limit_rate of the location, restored when the backend is under
+    -- its rate
+    limit_rate = tonumber(ngx.var.limit_rate) or 0,
+    sent = 0,
+  }
+end
+
+-- body_filter takes the bytes of each chunk of the response from the bucket
+-- of the backend and sets the limit_rate of the request to delay them when
+-- the bucket is empty
+function _M.body_filter()
+  local state = ngx.ctx.backend_bandwidth
+  if not state then
+    return
+  end
+
+  local chunk = ngx.arg[1]
+  if not chunk or #chunk == 0 then
+    return
+  end
+
+  state.sent = state.sent + #chunk
+
+  local delay = reserve(state.key, #chunk, state.rate, state.burst)
+  if delay <= 0 then
+    if state.limited then
+      state.limited = false
+      ngx.var.limit_rate = state.limit_rate
+    end
+    return
+  end
+
+  -- NGINX keeps the average rate since the start of the request under
+  -- limit_rate, the one sending the bytes received so far after the delay
+  local elapsed = math_floor(ngx.now()) - math_floor(ngx.req.start_time())
+  local limit_rate = math_max(math_floor(state.sent / (elapsed + delay + 1)), 1)
+  if state.limit_rate > 0 then
+    limit_rate = math_min(limit_rate, state.limit_rate)
+  end
+
+  state.limited = true
+  ngx.var.limit_rate = limit_rate
+end
+
+return _M
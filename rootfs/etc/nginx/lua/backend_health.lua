@@ -0,0 +1,124 @@
+-- Tracks the load of the backends observed by NGINX, the requests in flight
+-- and the 5xx responses, across all the workers, and reports it with the
+-- endpoints ejected by the circuit breaker and the health checks, for the
+-- autoscalers to scale the backends on the load they actually receive.
+local ngx = ngx
+local ipairs = ipairs
+local tonumber = tonumber
+local math_floor = math.floor
+local string_format = string.format
+
+local circuit_breaker = require("circuit_breaker")
+local health_check = require("health_check")
+local request_state = require("request_state")
+
+local backend_health_data = ngx.shared.backend_health
+
+-- duration, in seconds, of the window of the requests and errors, the
+-- previous window is weighted by its overlap with the last WINDOW seconds
+local WINDOW = 60
+
+-- seconds the counters of the requests in flight are kept after the last
+-- request to their backend, the requests never reaching the log phase, like
+-- the ones handled by a crashed worker, are not counted once the backend is
+-- idle
+local INFLIGHT_TTL = 600
+
+local _M = {}
+
+local function incr(key, value, ttl)
+  local count, err, forcible = backend_health_data:incr(key, value, 0, ttl)
+  if not count then
+    ngx.log(ngx.WARN, "error updating the backend health of ", key, ": ", err)
+    return nil
+  end
+  if forcible then
+    ngx.log(ngx.WARN, "backend_health shared dictionary is full, consider increasing its size")
+  end
+
+  return count
+end
+
+local function window_key(name, backend_name, window_id)
+  return string_format("%s|%s|%s", name, backend_name, window_id)
+end
+
+-- start counts the request in flight to the backend, must be called in the
+-- balancer phase and is only counted by the first try
+function _M.start(backend_name)
+  if request_state.get("backend_health") then
+    return
+  end
+
+  -- the request is counted until the log phase across the internal
+  -- redirects, which reset ngx.ctx
+  request_state.set("backend_health", backend_name)
+
+  local key = "inflight|" .. backend_name
+  incr(key, 1, INFLIGHT_TTL)
+  backend_health_data:expire(key, INFLIGHT_TTL)
+end
+
+-- finish ends the request in flight and counts its response, must be called
+-- in the log phase
+function _M.finish()
+  local backend_name = request_state.take("backend_health")
+  if not backend_name then
+    return
+  end
+
+  local key = "inflight|" .. backend_name
+  local count = incr(key, -1, INFLIGHT_TTL)
+  if count and count < 0 then
+    -- the counter expired while the request was in flight
+    incr(key, -count, INFLIGHT_TTL)
+  end
+
+  local window_id = math_floor(ngx.now() / WINDOW)
+  incr(window_key("requests", backend_name, window_id), 1, 2 * WINDOW)
+
+  local status = tonumber(ngx.var.status)
+  if status and status >= 500 then
+    incr(window_key("errors", backend_name, window_id), 1, 2 * WINDOW)
+  end
+end
+
+local function window_count(name, backend_name, now)
+  local window_id = math_floor(now / WINDOW)
+  local current = backend_health_data:get(window_key(name, backend_name, window_id)) or 0
+  local previous = backend_health_data:get(window_key(name, backend_name, window_id - 1)) or 0
+
+  local overlap = 1 - (now % WINDOW) / WINDOW
+  return current + previous * overlap
+end
+
+-- get returns the load of the backends, the requests and errors are counted
+-- in the last WINDOW seconds
+function _M.get(backends)
+  local now = ngx.now()
+  local loads = {}
+
+  for _, backend in ipairs(backends or {}) do
+    local endpoints = backend.endpoints or {}
+
+    local ejected = 0
+    for _, endpoint in ipairs(endpoints) do
+      if circuit_breaker.is_ejected(backend.name, endpoint) or
+          health_check.is_unhealthy(backend.name, endpoint) then
+        ejected = ejected + 1
+      end
+    end
+
+    loads[backend.name] = {
+      inFlight = backend_health_data:get("inflight|" .. backend.name) or 0,
+      requests = window_count("requests", backend.name, now),
+      errors = window_count("errors", backend.name, now),
+      endpoints = #endpoints,
+      ejectedEndpoints = ejected,
+    }
+  end
+
+  return { window = WINDOW, backends = loads }
+end
+
+return _M
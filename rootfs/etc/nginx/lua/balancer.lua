@@ -2,13 +2,27 @@ local ngx_balancer = require("ngx.balancer")
 local cjson = require("cjson.safe")
 local util = require("util")
 local dns_lookup = require("util.dns").lookup
+local dns_lookup_srv = require("util.dns").lookup_srv
 local configuration = require("configuration")
 local round_robin = require("balancer.round_robin")
 local chash = require("balancer.chash")
 local chashsubset = require("balancer.chashsubset")
+local chash_common = require("balancer.chash_common")
 local sticky_balanced = require("balancer.sticky_balanced")
 local sticky_persistent = require("balancer.sticky_persistent")
 local ewma = require("balancer.ewma")
+local shared_state = require("shared_state")
+local keepalive_stats = require("keepalive_stats")
+local inflight = require("inflight")
+local connection_limit = require("connection_limit")
+local websocket_limit = require("websocket_limit")
+local warm_up = require("warm_up")
+local drain = require("drain")
+local max_request_duration = require("max_request_duration")
+local circuit_breaker = require("circuit_breaker")
+local health_check = require("health_check")
+local backend_health = require("backend_health")
+local request_state = require("request_state")
 local string = string
 local ipairs = ipairs
 local table = table
@@ -77,9 +91,20 @@ local function resolve_external_names(original_backend)
   local backend = util.deepcopy(original_backend)
   local endpoints = {}
   for _, endpoint in ipairs(backend.endpoints) do
-    local ips = dns_lookup(endpoint.address)
-    for _, ip in ipairs(ips) do
-      table.insert(endpoints, { address = ip, port = endpoint.port })
+    -- the SRV records define the ports of the endpoints, the port of the
+    -- service is only used when the name has no SRV record
+    local srv_endpoints = backend.externalNameSRV and dns_lookup_srv(endpoint.address)
+    if srv_endpoints then
+      -- the endpoints are copied as the cached ones must not be formatted
+      for _, srv_endpoint in ipairs(srv_endpoints) do
+        table.insert(endpoints, { address = srv_endpoint.address, port = srv_endpoint.port,
+          weight = srv_endpoint.weight })
+      end
+    else
+      local ips = dns_lookup(endpoint.address)
+      for _, ip in ipairs(ips) do
+        table.insert(endpoints, { address = ip, port = endpoint.port })
+      end
     end
   end
   backend.endpoints = endpoints
@@ -104,9 +129,42 @@ local function is_backend_with_external_name(backend)
   return serv_type == "ExternalName"
 end
 
+-- the failover endpoints, outside of the cluster, are used only when
+-- none of the endpoints of the service are available
+local function uses_failover_endpoints(backend)
+  return (not backend.endpoints or #backend.endpoints == 0) and
+    backend.failoverEndpoints ~= nil and #backend.failoverEndpoints > 0
+end
+
+local function resolve_failover_endpoints(original_backend)
+  local backend = util.deepcopy(original_backend)
+  local endpoints = {}
+  for _, endpoint in ipairs(backend.failoverEndpoints) do
+    local ips = { endpoint.address }
+    if not endpoint.address:match("^%d+%.%d+%.%d+%.%d+$") and
+        not endpoint.address:find(":", 1, true) then
+      ips = dns_lookup(endpoint.address)
+    end
+
+    for _, ip in ipairs(ips) do
+      table.insert(endpoints, { address = ip, port = endpoint.port, weight = endpoint.weight })
+    end
+  end
+  backend.endpoints = endpoints
+  return backend
+end
+
 local function sync_backend(backend)
+  if uses_failover_endpoints(backend) then
+    backend = resolve_failover_endpoints(backend)
+  end
+
+  backend = drain.filter(backend)
+  backend = warm_up.filter(backend)
+
   if not backend.endpoints or #backend.endpoints == 0 then
     balancers[backend.name] = nil
+    health_check.remove(backend.name)
     return
   end
 
@@ -115,27 +173,39 @@ local function sync_backend(backend)
   end
 
   backend.endpoints = format_ipv6_endpoints(backend.endpoints)
+  if backend.drainingEndpoints then
+    backend.drainingEndpoints = format_ipv6_endpoints(backend.drainingEndpoints)
+    for _, endpoint in ipairs(backend.drainingEndpoints) do
+      endpoint.ring = format_ipv6_endpoints(endpoint.ring)
+    end
+  end
+
+  -- the ejected endpoints are compared with $upstream_addr, formatted
+  -- like the endpoints above
+  backend = circuit_breaker.filter(backend)
+  backend = health_check.filter(backend)
 
   local implementation = get_implementation(backend)
   local balancer = balancers[backend.name]
 
   if not balancer then
-    balancers[backend.name] = implementation:new(backend)
-    return
-  end
-
+    balancer = implementation:new(backend)
+    balancers[backend.name] = balancer
   -- every implementation is the metatable of its instances (see .new(...) functions)
   -- here we check if `balancer` is the instance of `implementation`
   -- if it is not then we deduce LB algorithm has changed for the backend
-  if getmetatable(balancer) ~= implementation then
+  elseif getmetatable(balancer) ~= implementation then
     ngx.log(ngx.INFO,
         string.format("LB algorithm changed from %s to %s, resetting the instance",
                       balancer.name, implementation.name))
-    balancers[backend.name] = implementation:new(backend)
-    return
+    balancer = implementation:new(backend)
+    balancers[backend.name] = balancer
+  else
+    balancer:sync(backend)
   end
 
-  balancer:sync(backend)
+  -- the sessions with affinity to the draining endpoints stay on them
+  drain.attach(balancer, backend)
 end
 
 local function sync_backends_with_external_name()
@@ -148,10 +218,22 @@ local function sync_backends()
   local raw_backends_last_synced_at = configuration.get_raw_backends_last_synced_at()
   ngx.update_time()
   local current_timestamp = ngx.time()
+  warm_up.check_pending()
+  -- the backends with endpoints passing the warm-up check, draining,
+  -- ejected by the circuit breaker or failing the health checks are synced
+  -- in the next interval
   if current_timestamp - backends_last_synced_at < BACKENDS_FORCE_SYNC_INTERVAL
-      and raw_backends_last_synced_at <= backends_last_synced_at then
+      and raw_backends_last_synced_at <= backends_last_synced_at
+      and not warm_up.has_changed()
+      and not drain.has_pending()
+      and not circuit_breaker.has_changed()
+      and not health_check.has_changed() then
     return
   end
+  warm_up.reset_changed()
+  drain.reset_pending()
+  circuit_breaker.reset_changed()
+  health_check.reset_changed()
 
   local backends_data = configuration.get_backends_data()
   if not backends_data then
@@ -167,10 +249,12 @@ local function sync_backends()
 
   local balancers_to_keep = {}
   for _, new_backend in ipairs(new_backends) do
-    if is_backend_with_external_name(new_backend) then
+    -- the failover endpoints can be DNS names, resolved like external names
+    if is_backend_with_external_name(new_backend) or uses_failover_endpoints(new_backend) then
       local backend_with_external_name = util.deepcopy(new_backend)
       backends_with_external_name[backend_with_external_name.name] = backend_with_external_name
     else
+      backends_with_external_name[new_backend.name] = nil
       sync_backend(new_backend)
     end
     balancers_to_keep[new_backend.name] = true
@@ -180,11 +264,201 @@ local function sync_backends()
     if not balancers_to_keep[backend_name] then
       balancers[backend_name] = nil
       backends_with_external_name[backend_name] = nil
+      health_check.remove(backend_name)
+      drain.remove(backend_name)
+    end
+  end
+  for backend_name, _ in pairs(backends_with_external_name) do
+    if not balancers_to_keep[backend_name] then
+      backends_with_external_name[backend_name] = nil
     end
   end
   backends_last_synced_at = raw_backends_last_synced_at
 end
 
+-- matches_grpc_method returns true when the gRPC method of the request, the
+-- :path pseudo-header like /helloworld.Greeter/SayHello, is one of the
+-- methods. A method ending with /* matches all the methods of the service.
+local function matches_grpc_method(methods)
+  if not methods or #methods == 0 then
+    return false
+  end
+
+  local path = ngx.var.uri
+  for _, method in ipairs(methods) do
+    if path == method then
+      return true
+    end
+
+    if string.sub(method, -2) == "/*" and
+        string.sub(path, 1, #method - 1) == string.sub(method, 1, -2) then
+      return true
+    end
+  end
+
+  return false
+end
+
+-- matches_content_type returns true when the media type of the Content-Type
+-- header of the request is one of the content types. A content type ending
+-- with /* matches all the subtypes of the type.
+local function matches_content_type(content_types)
+  if not content_types or #content_types == 0 then
+    return false
+  end
+
+  local content_type = ngx.var.http_content_type
+  if not content_type then
+    return false
+  end
+
+  local media_type = string.lower(string.match(content_type, "^%s*([^;%s]+)") or "")
+  for _, expected in ipairs(content_types) do
+    if media_type == expected then
+      return true
+    end
+
+    if string.sub(expected, -2) == "/*" and
+        string.sub(media_type, 1, #expected - 1) == string.sub(expected, 1, -2) then
+      return true
+    end
+  end
+
+  return false
+end
+
+-- header_decision returns true when the canary header of the request
+-- redirects it to the canary, false when it keeps it in the main backend and
+-- nil when the header does not decide
+local function header_decision(traffic_shaping_policy)
+  local target_header = util.replace_special_char(traffic_shaping_policy.header,
+                                                  "-", "_")
+  local header = ngx.var["http_" .. target_header]
+  if not header then
+    return nil
+  end
+
+  local header_values = traffic_shaping_policy.headerValues
+  if header_values and #header_values > 0 then
+    for _, value in ipairs(header_values) do
+      if value == header then
+        return true
+      end
+    end
+  elseif traffic_shaping_policy.headerValue
+     and #traffic_shaping_policy.headerValue > 0 then
+    if traffic_shaping_policy.headerValue == header then
+      return true
+    end
+  elseif traffic_shaping_policy.headerPattern
+     and #traffic_shaping_policy.headerPattern > 0 then
+    local m, err = ngx.re.match(header, traffic_shaping_policy.headerPattern)
+    if m then
+      return true
+    elseif err then
+      ngx.log(ngx.ERR, "error when matching canary-by-header-pattern: '",
+              traffic_shaping_policy.headerPattern, "', error: ", err)
+      return false
+    end
+  elseif header == "always" then
+    return true
+  elseif header == "never" then
+    return false
+  end
+
+  return nil
+end
+
+-- cookie_decision returns true when the canary cookie of the request
+-- redirects it to the canary, false when it keeps it in the main backend and
+-- nil when the cookie does not decide
+local function cookie_decision(traffic_shaping_policy)
+  local target_cookie = traffic_shaping_policy.cookie
+  local cookie = ngx.var["cookie_" .. target_cookie]
+  if not cookie then
+    return nil
+  end
+
+  local cookie_value = traffic_shaping_policy.cookieValue
+  if cookie_value and #cookie_value > 0 then
+    local m, err = ngx.re.match(cookie, cookie_value, "jo")
+    if m then
+      return true
+    elseif err then
+      ngx.log(ngx.ERR, "error when matching canary-by-cookie-value: '",
+              cookie_value, "', error: ", err)
+      return false
+    end
+  elseif cookie == "always" then
+    return true
+  elseif cookie == "never" then
+    return false
+  end
+
+  return nil
+end
+
+-- match_any_rule returns the decision of the first rule deciding, in order
+-- the header, the gRPC method, the content type and the cookie
+local function match_any_rule(traffic_shaping_policy)
+  local decision = header_decision(traffic_shaping_policy)
+  if decision ~= nil then
+    return decision
+  end
+
+  if matches_grpc_method(traffic_shaping_policy.grpcMethods) then
+    return true
+  end
+
+  if matches_content_type(traffic_shaping_policy.contentTypes) then
+    return true
+  end
+
+  return cookie_decision(traffic_shaping_policy)
+end
+
+-- match_all_rules returns true when the request matches all the configured
+-- rules and false when one of them keeps it in the main backend. It returns
+-- nil when a rule does not match, for the weight to decide.
+local function match_all_rules(traffic_shaping_policy)
+  local configured = false
+  local matches = true
+
+  local function check(decision)
+    configured = true
+    if decision ~= true then
+      matches = false
+    end
+    return decision
+  end
+
+  local header = traffic_shaping_policy.header
+  if header and #header > 0 and check(header_decision(traffic_shaping_policy)) == false then
+    return false
+  end
+
+  local methods = traffic_shaping_policy.grpcMethods
+  if methods and #methods > 0 then
+    check(matches_grpc_method(methods))
+  end
+
+  local content_types = traffic_shaping_policy.contentTypes
+  if content_types and #content_types > 0 then
+    check(matches_content_type(content_types))
+  end
+
+  local cookie = traffic_shaping_policy.cookie
+  if cookie and #cookie > 0 and check(cookie_decision(traffic_shaping_policy)) == false then
+    return false
+  end
+
+  if configured and matches then
+    return true
+  end
+
+  return nil
+end
+
 local function route_to_alternative_balancer(balancer)
   if not balancer.alternative_backends then
     return false
@@ -211,40 +485,14 @@ local function route_to_alternative_balancer(balancer)
     return false
   end
 
-  local target_header = util.replace_special_char(traffic_shaping_policy.header,
-                                                  "-", "_")
-  local header = ngx.var["http_" .. target_header]
-  if header then
-    if traffic_shaping_policy.headerValue
-	   and #traffic_shaping_policy.headerValue > 0 then
-      if traffic_shaping_policy.headerValue == header then
-        return true
-      end
-    elseif traffic_shaping_policy.headerPattern
-       and #traffic_shaping_policy.headerPattern > 0 then
-      local m, err = ngx.re.match(header, traffic_shaping_policy.headerPattern)
-      if m then
-        return true
-      elseif  err then
-          ngx.log(ngx.ERR, "error when matching canary-by-header-pattern: '",
-                  traffic_shaping_policy.headerPattern, "', error: ", err)
-          return false
-      end
-    elseif header == "always" then
-      return true
-    elseif header == "never" then
-      return false
-    end
+  local decision
+  if traffic_shaping_policy.matchMode == "and" then
+    decision = match_all_rules(traffic_shaping_policy)
+  else
+    decision = match_any_rule(traffic_shaping_policy)
   end
-
-  local target_cookie = traffic_shaping_policy.cookie
-  local cookie = ngx.var["cookie_" .. target_cookie]
-  if cookie then
-    if cookie == "always" then
-      return true
-    elseif cookie == "never" then
-      return false
-    end
+  if decision ~= nil then
+    return decision
   end
 
   if math.random(100) <= traffic_shaping_policy.weight then
@@ -254,21 +502,81 @@ local function route_to_alternative_balancer(balancer)
   return false
 end
 
+-- get_fallback_balancer returns the balancer of the backend configured with
+-- the annotation nginx.ingress.kubernetes.io/fallback-service, if any.
+local function get_fallback_balancer()
+  local backend_name = ngx.var.fallback_upstream_name
+  if not backend_name or backend_name == "" then
+    return
+  end
+
+  return balancers[backend_name]
+end
+
+-- get_geo_balancer returns the balancer of the backend selected by the
+-- annotation nginx.ingress.kubernetes.io/geo-routing for the country or the
+-- continent of the client, if any.
+local function get_geo_balancer()
+  local backend_name = ngx.var.geo_upstream_name
+  if not backend_name or backend_name == "" then
+    return
+  end
+
+  return balancers[backend_name]
+end
+
+-- get_route_if_balancer returns the balancer of the backend of the annotation
+-- nginx.ingress.kubernetes.io/route-if-service, when the request matches
+-- the predicate of nginx.ingress.kubernetes.io/route-if.
+local function get_route_if_balancer()
+  local backend_name = ngx.var.route_if_upstream_name
+  if not backend_name or backend_name == "" then
+    return
+  end
+
+  return balancers[backend_name]
+end
+
 local function get_balancer()
   if ngx.ctx.balancer then
     return ngx.ctx.balancer
   end
 
+  -- the backend of the requests matching the predicate of the location
+  -- takes precedence over the other routing annotations
+  local route_if_balancer = get_route_if_balancer()
+  if route_if_balancer then
+    ngx.ctx.balancer = route_if_balancer
+    ngx.var.proxy_alternative_upstream_name = route_if_balancer.name
+    return route_if_balancer
+  end
+
+  -- the backend of the region of the client replaces the one of the location
+  local geo_balancer = get_geo_balancer()
+  if geo_balancer then
+    ngx.ctx.balancer = geo_balancer
+    ngx.var.proxy_alternative_upstream_name = geo_balancer.name
+    return geo_balancer
+  end
+
   local backend_name = ngx.var.proxy_upstream_name
 
   local balancer = balancers[backend_name]
   if not balancer then
-    return
+    balancer = get_fallback_balancer()
+    if balancer then
+      ngx.ctx.balancer = balancer
+      ngx.var.proxy_alternative_upstream_name = balancer.name
+    end
+    return balancer
   end
 
   if route_to_alternative_balancer(balancer) then
     local alternative_backend_name = balancer.alternative_backends[1]
     ngx.var.proxy_alternative_upstream_name = alternative_backend_name
+    -- unlike the fallback backend, the requests of the canary are analyzed
+    -- by the controller
+    ngx.ctx.canary_upstream_name = alternative_backend_name
 
     balancer = balancers[alternative_backend_name]
   end
@@ -298,13 +606,42 @@ function _M.init_worker()
     ngx.log(ngx.ERR, "error when setting up timer.every for sync_backends_with_external_name: ",
             err)
   end
+
+  health_check.init_worker()
 end
 
-function _M.rewrite()
+-- respond_without_endpoints answers the requests of the locations whose
+-- backend has no ready endpoints, according to the no-endpoints-action
+-- annotation. The fallback action is handled by get_balancer and responds
+-- with 503 when the fallback service has no ready endpoints either.
+local function respond_without_endpoints(config)
+  config = config or {}
+
+  local status = ngx.HTTP_SERVICE_UNAVAILABLE
+  if config.action == "502" then
+    status = ngx.HTTP_BAD_GATEWAY
+  elseif (config.retry_after or 0) > 0 then
+    ngx.header["Retry-After"] = config.retry_after
+  end
+
+  ngx.status = status
+  if config.action == "page" then
+    ngx.header["Content-Type"] = "text/html"
+    ngx.print(config.page)
+    return ngx.exit(ngx.HTTP_OK)
+  end
+
+  return ngx.exit(status)
+end
+
+function _M.rewrite(location_config)
   local balancer = get_balancer()
   if not balancer then
-    ngx.status = ngx.HTTP_SERVICE_UNAVAILABLE
-    return ngx.exit(ngx.status)
+    return respond_without_endpoints(location_config and location_config.no_endpoints)
+  end
+
+  if balancer.load_shared_state and shared_state.is_enabled() then
+    balancer:load_shared_state()
   end
 end
 
@@ -314,7 +651,19 @@ function _M.balance()
     return
   end
 
-  local peer = balancer:balance()
+  -- the previous try failed with one of the conditions of proxy_next_upstream,
+  -- the remaining tries go to the fallback backend
+  if not ngx.ctx.fallback and ngx_balancer.get_last_failure() then
+    local fallback_balancer = get_fallback_balancer()
+    if fallback_balancer and fallback_balancer ~= balancer then
+      ngx.ctx.fallback = true
+      ngx.ctx.balancer = fallback_balancer
+      ngx.var.proxy_alternative_upstream_name = fallback_balancer.name
+      balancer = fallback_balancer
+    end
+  end
+
+  local peer = drain.balance(balancer) or balancer:balance()
   if not peer then
     ngx.log(ngx.WARN, "no peer was returned, balancer: " .. balancer.name)
     return
@@ -327,19 +676,43 @@ function _M.balance()
 
   ngx_balancer.set_more_tries(1)
 
+  max_request_duration.balance()
+
   local ok, err = ngx_balancer.set_current_peer(peer)
   if not ok then
     ngx.log(ngx.ERR, "error while setting current upstream peer ", peer,
             ": ", err)
+    return
   end
+
+  keepalive_stats.start(balancer.name)
+  backend_health.start(balancer.name)
+end
+
+-- release gives back what the request took in the locations it went
+-- through, it must be called in the log phase of the locations the requests
+-- can be redirected to, like the error pages
+function _M.release()
+  keepalive_stats.finish()
+  backend_health.finish()
+  inflight.release()
+  connection_limit.release()
+  websocket_limit.release()
+  chash_common.release()
+
+  request_state.clear()
 end
 
 function _M.log()
+  _M.release()
+
   local balancer = get_balancer()
   if not balancer then
     return
   end
 
+  circuit_breaker.record(balancer.name)
+
   if not balancer.after_balance then
     return
   end
@@ -352,6 +725,9 @@ setmetatable(_M, {__index = {
   sync_backend = sync_backend,
   route_to_alternative_balancer = route_to_alternative_balancer,
   get_balancer = get_balancer,
+  get_fallback_balancer = get_fallback_balancer,
+  get_geo_balancer = get_geo_balancer,
+  get_route_if_balancer = get_route_if_balancer,
 }})
 
 return _M
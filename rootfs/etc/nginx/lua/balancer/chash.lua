@@ -1,4 +1,5 @@
 local balancer_resty = require("balancer.resty")
+local chash_common = require("balancer.chash_common")
 local resty_chash = require("resty.chash")
 local util = require("util")
 local ngx_log = ngx.log
@@ -21,14 +22,35 @@ function _M.new(self, backend)
     traffic_shaping_policy = backend.trafficShapingPolicy,
     alternative_backends = backend.alternativeBackends,
   }
+  chash_common.init(o, backend, nodes)
   setmetatable(o, self)
   self.__index = self
   return o
 end
 
+function _M.sync(self, backend)
+  balancer_resty.sync(self, backend)
+  chash_common.init(self, backend, util.get_nodes(backend.endpoints))
+end
+
+function _M.new_instance(self, nodes)
+  return self.factory:new(nodes)
+end
+
+-- affinity_key returns the hash key of the request, used to find the
+-- draining endpoint it was hashed to
+function _M.affinity_key(self)
+  local key = util.generate_hash_key(self.hash_by, self.hash_by_fallback)
+  if key == "" then
+    return nil
+  end
+  return key
+end
+
 function _M.balance(self)
-  local key = util.generate_var_value(self.hash_by)
-  return self.instance:find(key)
+  local key = util.generate_hash_key(self.hash_by, self.hash_by_fallback)
+  local node, peer = chash_common.find(self, key)
+  return node or peer
 end
 
 return _M
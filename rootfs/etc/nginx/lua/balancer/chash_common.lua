@@ -0,0 +1,187 @@
+-- Fallback and bounded load of the consistent hashing balancers, chash and
+-- chashsubset.
+--
+-- The upstream-hash-by-fallback setting is either the name of a balancer,
+-- round_robin or ewma, picking the endpoints of the requests with an empty
+-- key, or a secondary key with the syntax of upstream-hash-by.
+--
+-- With upstream-hash-by-balance-factor the nodes of the ring, endpoints or
+-- subsets, do not get more than the factor times the average number of
+-- in-flight requests of the worker: the keys of a busy node go to the next
+-- nodes of the ring instead. The load taken by a request is kept in
+-- request_state, across the internal redirects, until its log phase.
+local round_robin = require("balancer.round_robin")
+local ewma = require("balancer.ewma")
+local request_state = require("request_state")
+local util = require("util")
+
+local ngx = ngx
+local ngx_log = ngx.log
+local ngx_ERR = ngx.ERR
+local ngx_now = ngx.now
+local math_ceil = math.ceil
+local ipairs = ipairs
+local pairs = pairs
+local table_insert = table.insert
+
+-- seconds the load of a request is kept, the load of the requests never
+-- reaching the log phase, like the ones evicted from request_state, is
+-- given back after it
+local LOAD_TTL = 600
+-- seconds between two lookups of the expired loads of a balancer
+local SWEEP_INTERVAL = 60
+
+local FALLBACK_BALANCERS = {
+  round_robin = round_robin,
+  ewma = ewma,
+}
+
+local _M = {}
+
+local function count(t)
+  local n = 0
+  for _ in pairs(t) do
+    n = n + 1
+  end
+  return n
+end
+
+local function request_id()
+  return ngx.var.request_id or ""
+end
+
+local function give_back(balancer, nodes)
+  for _, node in ipairs(nodes) do
+    if (balancer.load[node] or 0) > 0 then
+      balancer.load[node] = balancer.load[node] - 1
+      balancer.total_load = balancer.total_load - 1
+    end
+  end
+end
+
+-- sweep gives back the loads of the requests older than LOAD_TTL
+local function sweep(balancer, now)
+  if balancer.swept_at and now - balancer.swept_at < SWEEP_INTERVAL then
+    return
+  end
+  balancer.swept_at = now
+
+  for id, pending in pairs(balancer.pending) do
+    if now - pending.time > LOAD_TTL then
+      give_back(balancer, pending.nodes)
+      balancer.pending[id] = nil
+    end
+  end
+end
+
+-- take_load adds the node to the load of the balancer and of the request
+local function take_load(balancer, node)
+  local now = ngx_now()
+  sweep(balancer, now)
+
+  balancer.load[node] = (balancer.load[node] or 0) + 1
+  balancer.total_load = balancer.total_load + 1
+
+  local id = request_id()
+  local pending = balancer.pending[id]
+  if not pending then
+    pending = { time = now, nodes = {} }
+    balancer.pending[id] = pending
+
+    local balancers = request_state.get("chash_load") or {}
+    table_insert(balancers, balancer)
+    request_state.set("chash_load", balancers)
+  end
+
+  table_insert(pending.nodes, node)
+end
+
+-- init sets the fallback and the bounded load of a balancer from its backend,
+-- nodes being the nodes of its ring
+function _M.init(balancer, backend, nodes)
+  local config = backend["upstreamHashByConfig"]
+  local fallback = config["upstream-hash-by-fallback"]
+
+  if fallback ~= balancer.fallback then
+    balancer.fallback = fallback
+    balancer.hash_by_fallback = nil
+    balancer.fallback_balancer = nil
+
+    if FALLBACK_BALANCERS[fallback] then
+      balancer.fallback_balancer = FALLBACK_BALANCERS[fallback]:new(backend)
+    elseif fallback then
+      local fallback_val, err = util.parse_complex_value(fallback)
+      if err ~= nil then
+        ngx_log(ngx_ERR, "could not parse the value of the upstream-hash-by-fallback: ", err)
+      end
+      balancer.hash_by_fallback = fallback_val
+    end
+  elseif balancer.fallback_balancer then
+    balancer.fallback_balancer:sync(backend)
+  end
+
+  local balance_factor = config["upstream-hash-by-balance-factor"]
+  if balance_factor and balance_factor > 1 then
+    balancer.balance_factor = balance_factor
+  else
+    balancer.balance_factor = nil
+  end
+
+  balancer.nodes_count = count(nodes)
+  balancer.load = balancer.load or {}
+  balancer.total_load = balancer.total_load or 0
+  -- nodes picked by request ID, with the time of the first one
+  balancer.pending = balancer.pending or {}
+end
+
+-- find returns the node of the key or, when the key is empty and the fallback
+-- is a balancer, nil and the peer picked by the fallback balancer
+function _M.find(balancer, key)
+  if key == "" and balancer.fallback_balancer then
+    ngx.ctx.chash_fallback_balancer = balancer.fallback_balancer
+    return nil, balancer.fallback_balancer:balance()
+  end
+
+  local node, index = balancer.instance:find(key)
+  if not balancer.balance_factor or not index then
+    return node
+  end
+
+  local capacity = math_ceil(balancer.balance_factor * (balancer.total_load + 1) / balancer.nodes_count)
+
+  -- the capacity is above the average load, so a node of the ring has room
+  -- for the request
+  for _ = 1, balancer.instance.npoints do
+    if (balancer.load[node] or 0) < capacity then
+      break
+    end
+    node, index = balancer.instance:next(index)
+  end
+
+  take_load(balancer, node)
+
+  return node
+end
+
+-- release gives back the load of the nodes picked for the request and
+-- updates the statistics of the fallback balancer
+function _M.release()
+  local balancers = request_state.take("chash_load")
+  if balancers then
+    local id = request_id()
+    for _, balancer in ipairs(balancers) do
+      local pending = balancer.pending[id]
+      if pending then
+        give_back(balancer, pending.nodes)
+        balancer.pending[id] = nil
+      end
+    end
+  end
+
+  local fallback_balancer = ngx.ctx.chash_fallback_balancer
+  if fallback_balancer and fallback_balancer.after_balance then
+    fallback_balancer:after_balance()
+  end
+end
+
+return _M
@@ -2,6 +2,7 @@
 -- always, we return the same subset always.
 
 local resty_chash = require("resty.chash")
+local chash_common = require("balancer.chash_common")
 local util = require("util")
 local ngx_log = ngx.log
 local ngx_ERR = ngx.ERR
@@ -61,16 +62,22 @@ function _M.new(self, backend)
     instance = resty_chash:new(subset_map),
     hash_by = complex_val,
     subsets = subsets,
+    subset_map = subset_map,
     current_endpoints = backend.endpoints
   }
+  chash_common.init(o, backend, subset_map)
   setmetatable(o, self)
   self.__index = self
   return o
 end
 
 function _M.balance(self)
-  local key = util.generate_var_value(self.hash_by)
-  local subset_id = self.instance:find(key)
+  local key = util.generate_hash_key(self.hash_by, self.hash_by_fallback)
+  local subset_id, peer = chash_common.find(self, key)
+  if not subset_id then
+    return peer
+  end
+
   local endpoints = self.subsets[subset_id]
   local endpoint = endpoints[math.random(#endpoints)]
   return endpoint.address .. ":" .. endpoint.port
@@ -81,14 +88,17 @@ function _M.sync(self, backend)
 
   local changed = not util.deep_compare(self.current_endpoints, backend.endpoints)
   if not changed then
+    chash_common.init(self, backend, self.subset_map)
     return
   end
 
   self.current_endpoints = backend.endpoints
 
   subset_map, self.subsets = build_subset_map(backend)
+  self.subset_map = subset_map
 
   self.instance:reinit(subset_map)
+  chash_common.init(self, backend, subset_map)
 
   return
 end
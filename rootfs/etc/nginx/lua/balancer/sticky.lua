@@ -3,11 +3,13 @@ local ck = require("resty.cookie")
 local ngx_balancer = require("ngx.balancer")
 local split = require("util.split")
 local same_site = require("util.same_site")
+local shared_state = require("shared_state")
 
 local ngx = ngx
 local pairs = pairs
 local ipairs = ipairs
 local string = string
+local table = table
 local tonumber = tonumber
 local setmetatable = setmetatable
 
@@ -65,11 +67,15 @@ function _M.set_cookie(self, value)
     key = self:cookie_name(),
     value = value,
     path = cookie_path,
-    httponly = true,
+    httponly = self.cookie_session_affinity.httponly ~= false,
     samesite = cookie_samesite,
-    secure = ngx.var.https == "on",
+    secure = ngx.var.https == "on" or self.cookie_session_affinity.secure == true,
   }
 
+  if self.cookie_session_affinity.domain and self.cookie_session_affinity.domain ~= "" then
+    cookie_data.domain = self.cookie_session_affinity.domain
+  end
+
   if self.cookie_session_affinity.expires and self.cookie_session_affinity.expires ~= "" then
       cookie_data.expires = ngx.cookie_time(ngx.time() +
         tonumber(self.cookie_session_affinity.expires))
@@ -101,7 +107,65 @@ local function get_failed_upstreams()
   return indexed_upstream_addrs
 end
 
+-- load_shared_state reads the endpoint of the session and the endpoints
+-- marked as failed by other replicas. It has to be called before the
+-- balancer phase, as memcached can not be accessed from there.
+function _M.load_shared_state(self)
+  local keys = {}
+  local session_key
+  local failed_keys = {}
+
+  local key = self:get_cookie()
+  if key then
+    session_key = shared_state.key(self.backend_name, "session", key)
+    table.insert(keys, session_key)
+  end
+
+  for endpoint, _ in pairs(self.instance.nodes) do
+    failed_keys[endpoint] = shared_state.key(self.backend_name, "failed", endpoint)
+    table.insert(keys, failed_keys[endpoint])
+  end
+
+  local values = shared_state.get(keys)
+
+  local state = { failed_upstreams = {} }
+  if session_key then
+    state.upstream = values[session_key]
+  end
+  for endpoint, failed_key in pairs(failed_keys) do
+    if values[failed_key] then
+      state.failed_upstreams[endpoint] = true
+    end
+  end
+
+  ngx.ctx.sticky_shared_state = state
+end
+
+local function mark_failed_upstreams(self, failed_upstreams)
+  for addr, _ in pairs(failed_upstreams) do
+    shared_state.set_async(shared_state.key(self.backend_name, "failed", addr),
+      "1", shared_state.failure_timeout())
+  end
+end
+
+-- has_multiple_endpoints returns true if the balancer has more than one endpoint
+local function has_multiple_endpoints(self)
+  local count = 0
+  for _, _ in pairs(self.instance.nodes) do
+    count = count + 1
+    if count > 1 then
+      return true
+    end
+  end
+
+  return false
+end
+
 local function should_set_cookie(self)
+  if self.cookie_session_affinity.conditional_set and not has_multiple_endpoints(self) then
+    return false
+  end
+
   local host = ngx.var.host
   if ngx.var.server_name == '_' then
     host = ngx.var.server_name
@@ -131,29 +195,57 @@ local function should_set_cookie(self)
   return false
 end
 
+-- affinity_key returns the key of the session of the request and the
+-- upstream shared with the other balancers, used to find the draining
+-- endpoint of the session
+function _M.affinity_key(self)
+  local shared = ngx.ctx.sticky_shared_state
+  return self:get_cookie(), shared and shared.upstream
+end
+
 function _M.balance(self)
   local upstream_from_cookie
 
+  local shared = ngx.ctx.sticky_shared_state
+
   local key = self:get_cookie()
   if key then
     upstream_from_cookie = self.instance:find(key)
+    if shared and shared.upstream and self.instance.nodes[shared.upstream] then
+      upstream_from_cookie = shared.upstream
+    end
   end
 
   local last_failure = self.get_last_failure()
-  local should_pick_new_upstream = last_failure ~= nil and
+  local failed_upstreams = get_failed_upstreams()
+  if last_failure ~= nil then
+    mark_failed_upstreams(self, failed_upstreams)
+  end
+
+  local marked_as_failed = shared and upstream_from_cookie and
+    shared.failed_upstreams[upstream_from_cookie]
+  local should_pick_new_upstream = (last_failure ~= nil or marked_as_failed) and
     self.cookie_session_affinity.change_on_failure or upstream_from_cookie == nil
 
   if not should_pick_new_upstream then
     return upstream_from_cookie
   end
 
+  if shared then
+    for addr, _ in pairs(shared.failed_upstreams) do
+      failed_upstreams[addr] = true
+    end
+  end
+
   local new_upstream
 
-  new_upstream, key = self:pick_new_upstream(get_failed_upstreams())
+  new_upstream, key = self:pick_new_upstream(failed_upstreams)
   if not new_upstream then
     ngx.log(ngx.WARN, string.format("failed to get new upstream; using upstream %s", new_upstream))
   elseif should_set_cookie(self) then
     self:set_cookie(key)
+    shared_state.set_async(shared_state.key(self.backend_name, "session", key),
+      new_upstream, shared_state.session_timeout())
   end
 
   return new_upstream
@@ -163,6 +255,7 @@ function _M.sync(self, backend)
   -- reload balancer nodes
   balancer_resty.sync(self, backend)
 
+  self.backend_name = backend.name
   self.traffic_shaping_policy = backend.trafficShapingPolicy
   self.alternative_backends = backend.alternativeBackends
   self.cookie_session_affinity = backend.sessionAffinityConfig.cookieSessionAffinity
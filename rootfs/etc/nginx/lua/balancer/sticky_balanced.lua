@@ -7,6 +7,7 @@
 local balancer_sticky = require("balancer.sticky")
 local math_random = require("math").random
 local resty_chash = require("resty.chash")
+local drain = require("drain")
 local util_get_nodes = require("util").get_nodes
 
 local ngx = ngx
@@ -37,12 +38,18 @@ function _M.new(self, backend)
   return o
 end
 
+function _M.new_instance(_, nodes)
+  return resty_chash:new(nodes)
+end
+
 function _M.pick_new_upstream(self, failed_upstreams)
   for i = 1, MAX_UPSTREAM_CHECKS_COUNT do
     local key = string.format("%s.%s.%s", ngx.now() + i, ngx.worker.pid(), math_random(999999))
     local new_upstream = self.instance:find(key)
 
-    if not failed_upstreams[new_upstream] then
+    -- the keys of the sessions of the draining endpoints are not given to
+    -- new sessions, they would stay on the draining endpoints
+    if not failed_upstreams[new_upstream] and not drain.find(self, key) then
       return new_upstream, key
     end
   end
@@ -27,6 +27,10 @@ function _M.new(self, backend)
   return o
 end
 
+function _M.new_instance(_, nodes, backend)
+  return util_nodemap:new(nodes, backend["name"])
+end
+
 function _M.pick_new_upstream(self, failed_upstreams)
   return self.instance:random_except(failed_upstreams)
 end
@@ -0,0 +1,179 @@
+-- Evaluates the bot detection rules of the ConfigMap configured in the
+-- bot-detection-configmap setting in the locations with the annotation
+-- nginx.ingress.kubernetes.io/enable-bot-detection. The rules are pushed by
+-- the controller to the configuration endpoint, no reload is required.
+local ngx = ngx
+local cjson = require("cjson.safe")
+local configuration = require("configuration")
+local resty_str = require("resty.string")
+
+local ipairs = ipairs
+local pairs = pairs
+local type = type
+local math_floor = math.floor
+local string_format = string.format
+local table_concat = table.concat
+local ngx_re_find = ngx.re.find
+
+local counters = ngx.shared.bot_detection
+
+local CHALLENGE_COOKIE = "ingress_bot_challenge"
+local DETECTED_HEADER = "X-Bot-Detected"
+local SECONDS_PER_DAY = 86400
+
+local CHALLENGE_PAGE = [[<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Checking your browser</title></head>
+<body><noscript>JavaScript is required to access this site.</noscript>
+<script>document.cookie = "%s=%s; path=/; max-age=%d; SameSite=Lax"; window.location.reload();</script>
+</body></html>
+]]
+
+local _M = {}
+
+-- rules decoded by this worker and the version of the configuration
+local rules = {}
+local secret = ""
+local current_version
+
+local function sync_rules()
+  local data, version = configuration.get_bot_detection_data()
+  if version == current_version then
+    return
+  end
+
+  current_version = version
+
+  if not data then
+    rules, secret = {}, ""
+    return
+  end
+
+  local new_config, err = cjson.decode(data)
+  if not new_config then
+    ngx.log(ngx.ERR, "could not parse bot detection rules: ", err)
+    return
+  end
+
+  rules = new_config.rules or {}
+  secret = new_config.secret or ""
+end
+
+local function header_value(headers, name)
+  local value = headers[name]
+  if type(value) == "table" then
+    return table_concat(value, ", ")
+  end
+  return value
+end
+
+local function matches(rule, headers)
+  if rule.userAgent and rule.userAgent ~= "" then
+    local user_agent = header_value(headers, "user-agent") or ""
+    if not ngx_re_find(user_agent, rule.userAgent, "jo") then
+      return false
+    end
+  end
+
+  if type(rule.headers) == "table" then
+    for name, regex in pairs(rule.headers) do
+      local value = header_value(headers, name)
+      if not value or not ngx_re_find(value, regex, "jo") then
+        return false
+      end
+    end
+  end
+
+  if type(rule.missingHeaders) == "table" then
+    for _, name in ipairs(rule.missingHeaders) do
+      if headers[name] ~= nil then
+        return false
+      end
+    end
+  end
+
+  return true
+end
+
+local function challenge_token(day)
+  local user_agent = ngx.var.http_user_agent or ""
+  local payload = string_format("%s|%s|%d", ngx.var.remote_addr, user_agent, day)
+  return resty_str.to_hex(ngx.hmac_sha1(secret, payload))
+end
+
+-- tokens of the previous day are accepted to avoid challenging the
+-- clients again at midnight
+local function passed_challenge()
+  local cookie = ngx.var["cookie_" .. CHALLENGE_COOKIE]
+  if not cookie then
+    return false
+  end
+
+  local day = math_floor(ngx.time() / SECONDS_PER_DAY)
+  return cookie == challenge_token(day) or cookie == challenge_token(day - 1)
+end
+
+local function challenge()
+  if passed_challenge() then
+    return
+  end
+
+  local method = ngx.req.get_method()
+  if method ~= "GET" and method ~= "HEAD" then
+    return ngx.exit(ngx.HTTP_FORBIDDEN)
+  end
+
+  local token = challenge_token(math_floor(ngx.time() / SECONDS_PER_DAY))
+
+  ngx.status = ngx.HTTP_FORBIDDEN
+  ngx.header["Content-Type"] = "text/html"
+  ngx.header["Cache-Control"] = "no-store"
+  ngx.print(string_format(CHALLENGE_PAGE, CHALLENGE_COOKIE, token, SECONDS_PER_DAY))
+  return ngx.exit(ngx.HTTP_FORBIDDEN)
+end
+
+local function rate_limit(rule)
+  local key = rule.name .. "|" .. ngx.var.remote_addr
+  local count, err, forcible = counters:incr(key, 1, 0, rule.window)
+  if not count then
+    ngx.log(ngx.WARN, "error updating the bot detection counter of ", rule.name, ": ", err)
+    return
+  end
+  if forcible then
+    ngx.log(ngx.WARN, "bot_detection shared dictionary is full, consider increasing its size")
+  end
+
+  if count > rule.limit then
+    return ngx.exit(ngx.HTTP_TOO_MANY_REQUESTS)
+  end
+end
+
+-- rewrite applies the action of the first rule matching the request
+function _M.rewrite()
+  sync_rules()
+
+  if #rules == 0 then
+    return
+  end
+
+  local headers = ngx.req.get_headers()
+
+  for _, rule in ipairs(rules) do
+    if matches(rule, headers) then
+      ngx.log(ngx.INFO, "request matched the bot detection rule ", rule.name)
+
+      if rule.action == "block" then
+        return ngx.exit(ngx.HTTP_FORBIDDEN)
+      elseif rule.action == "tag" then
+        ngx.req.set_header(DETECTED_HEADER, rule.name)
+      elseif rule.action == "rate-limit" then
+        return rate_limit(rule)
+      elseif rule.action == "challenge" then
+        return challenge()
+      end
+
+      return
+    end
+  end
+end
+
+return _M
@@ -4,13 +4,17 @@ local ocsp = require("ngx.ocsp")
 local ngx = ngx
 local string = string
 local tostring = tostring
+local ipairs = ipairs
 local re_sub = ngx.re.sub
 local unpack = unpack
 
 local dns_lookup = require("util.dns").lookup
 
 local _M = {
-  is_ocsp_stapling_enabled = false
+  is_ocsp_stapling_enabled = false,
+  -- handling of the TLS clients without SNI, action is default-certificate,
+  -- reject or server, to serve the certificate of the server hostname
+  no_sni = { action = "default-certificate", server = "" },
 }
 
 local DEFAULT_CERT_HOSTNAME = "_"
@@ -18,6 +22,15 @@ local DEFAULT_CERT_HOSTNAME = "_"
 local certificate_data = ngx.shared.certificate_data
 local certificate_servers = ngx.shared.certificate_servers
 local ocsp_response_cache = ngx.shared.ocsp_response_cache
+-- UIDs of the must-staple certificates not served without an OCSP response,
+-- with the failures to staple it, prefixed with "f:", and the last error
+-- getting it, prefixed with "e:"
+local ocsp_must_staple = ngx.shared.ocsp_must_staple
+-- TLS handshakes without SNI by action
+local no_sni_handshakes = ngx.shared.no_sni_handshakes
+
+local FAILURES_PREFIX = "f:"
+local ERROR_PREFIX = "e:"
 
 local function get_der_cert_and_priv_key(pem_cert_key)
   local der_cert, der_cert_err = ssl.cert_pem_to_der(pem_cert_key)
@@ -78,6 +91,18 @@ local function is_ocsp_stapling_enabled_for(_)
   return _M.is_ocsp_stapling_enabled
 end
 
+local function is_ocsp_must_staple_enforced_for(uid)
+  return ocsp_must_staple:get(uid) == true
+end
+
+-- record_ocsp_error keeps the last error getting the OCSP response of a
+-- must-staple certificate, reported with its stapling failures
+local function record_ocsp_error(uid, err)
+  if is_ocsp_must_staple_enforced_for(uid) then
+    ocsp_must_staple:set(ERROR_PREFIX .. uid, err)
+  end
+end
+
 local function get_resolved_url(parsed_url)
   local scheme, host, port, path = unpack(parsed_url)
   local ip = dns_lookup(host)[1]
@@ -122,6 +147,7 @@ local function fetch_and_cache_ocsp_response(uid, der_cert)
   local url, err = ocsp.get_ocsp_responder_from_der_chain(der_cert)
   if not url then
     ngx.log(ngx.ERR, "could not extract OCSP responder URL: ", err)
+    record_ocsp_error(uid, "could not extract OCSP responder URL: " .. tostring(err))
     return
   end
 
@@ -129,6 +155,7 @@ local function fetch_and_cache_ocsp_response(uid, der_cert)
   request, err = ocsp.create_ocsp_request(der_cert)
   if not request then
     ngx.log(ngx.ERR, "could not create OCSP request: ", err)
+    record_ocsp_error(uid, "could not create OCSP request: " .. tostring(err))
     return
   end
 
@@ -136,10 +163,12 @@ local function fetch_and_cache_ocsp_response(uid, der_cert)
   ocsp_response, err = do_ocsp_request(url, request)
   if err then
     ngx.log(ngx.ERR, "could not get OCSP response: ", err)
+    record_ocsp_error(uid, "could not get OCSP response: " .. tostring(err))
     return
   end
   if not ocsp_response or #ocsp_response == 0 then
     ngx.log(ngx.ERR, "OCSP responder returned an empty response")
+    record_ocsp_error(uid, "OCSP responder returned an empty response")
     return
   end
 
@@ -169,6 +198,7 @@ local function fetch_and_cache_ocsp_response(uid, der_cert)
     -- and we keep sending request. It might make things worse for the responder.
 
     ngx.log(ngx.NOTICE, "OCSP response validation failed: ", err)
+    record_ocsp_error(uid, "OCSP response validation failed: " .. tostring(err))
     return
   end
 
@@ -184,6 +214,8 @@ local function fetch_and_cache_ocsp_response(uid, der_cert)
     ngx.log(ngx.NOTICE, "removed an existing item when saving OCSP response, ",
       "consider increasing shared dictionary size for 'ocsp_response_cache'")
   end
+
+  ocsp_must_staple:delete(ERROR_PREFIX .. uid)
 end
 
 -- ocsp_staple looks at the cache and staples response from cache if it exists
@@ -209,6 +241,95 @@ local function ocsp_staple(uid, der_cert)
   return true, nil
 end
 
+-- record_ocsp_stapling_failure counts a TLS handshake refused because no
+-- OCSP response of the must-staple certificate could be stapled
+local function record_ocsp_stapling_failure(uid, err)
+  local _, incr_err = ocsp_must_staple:incr(FAILURES_PREFIX .. uid, 1, 0)
+  if incr_err then
+    ngx.log(ngx.ERR, "failed to count the OCSP stapling failures: ", incr_err)
+  end
+
+  if err then
+    ocsp_must_staple:set(ERROR_PREFIX .. uid, err)
+  end
+end
+
+-- prefetch_ocsp_response fetches the OCSP response of a must-staple
+-- certificate when it is configured, instead of refusing its first TLS
+-- handshakes while the response is missing
+function _M.prefetch_ocsp_response(uid, pem_cert)
+  local response, _, is_stale = ocsp_response_cache:get_stale(uid)
+  if response and not is_stale then
+    return
+  end
+
+  local der_cert, err = ssl.cert_pem_to_der(pem_cert)
+  if not der_cert then
+    ngx.log(ngx.ERR, "failed to convert certificate chain from PEM to DER: ", err)
+    return
+  end
+
+  ngx.timer.at(0, function() fetch_and_cache_ocsp_response(uid, der_cert) end)
+end
+
+-- take_ocsp_stapling_failures returns the TLS handshakes refused since the
+-- previous call by certificate UID, with the last error getting the OCSP
+-- response of the certificate
+function _M.take_ocsp_stapling_failures()
+  local failures = {}
+
+  for _, key in ipairs(ocsp_must_staple:get_keys(0)) do
+    if string.sub(key, 1, #FAILURES_PREFIX) == FAILURES_PREFIX then
+      local count = ocsp_must_staple:get(key)
+      if count and count > 0 then
+        -- the failures counted in the meantime are left for the next call
+        ocsp_must_staple:incr(key, -count)
+
+        local uid = string.sub(key, #FAILURES_PREFIX + 1)
+        failures[uid] = {
+          count = count,
+          error = ocsp_must_staple:get(ERROR_PREFIX .. uid) or "no OCSP response available",
+        }
+      end
+    end
+  end
+
+  return failures
+end
+
+-- get_no_sni_handshakes returns the number of TLS handshakes without SNI
+-- handled by each action
+function _M.get_no_sni_handshakes()
+  local handshakes = {}
+
+  for _, action in ipairs(no_sni_handshakes:get_keys(0)) do
+    handshakes[action] = no_sni_handshakes:get(action)
+  end
+
+  return handshakes
+end
+
+-- no_sni_hostname returns the hostname of the certificate served to the
+-- clients without SNI, or nil when the handshake is refused
+local function no_sni_hostname()
+  local action = _M.no_sni.action
+
+  local _, err = no_sni_handshakes:incr(action, 1, 0)
+  if err then
+    ngx.log(ngx.WARN, "error counting the TLS handshakes without SNI: ", err)
+  end
+
+  if action == "reject" then
+    return nil
+  end
+
+  if action == "server" and _M.no_sni.server ~= "" then
+    return _M.no_sni.server
+  end
+
+  return DEFAULT_CERT_HOSTNAME
+end
+
 function _M.configured_for_current_request()
   if ngx.ctx.cert_configured_for_current_request == nil then
     ngx.ctx.cert_configured_for_current_request = get_pem_cert_uid(ngx.var.host) ~= nil
@@ -223,9 +344,13 @@ function _M.call()
     ngx.log(ngx.ERR, "error while obtaining hostname: " .. hostname_err)
   end
   if not hostname then
+    hostname = no_sni_hostname()
+    if not hostname then
+      ngx.log(ngx.INFO, "refusing TLS handshake without SNI")
+      return ngx.exit(ngx.ERROR)
+    end
     ngx.log(ngx.INFO, "obtained hostname is nil (the client does "
-      .. "not support SNI?), falling back to default certificate")
-    hostname = DEFAULT_CERT_HOSTNAME
+      .. "not support SNI?), falling back to the certificate of ", hostname)
   end
 
   local pem_cert
@@ -236,6 +361,14 @@ function _M.call()
   if pem_cert_uid then
     pem_cert = certificate_data:get(pem_cert_uid)
   end
+  if not pem_cert and pem_cert_uid ~= get_pem_cert_uid(DEFAULT_CERT_HOSTNAME) then
+    -- the servers without certificate use the default one from the dictionary
+    -- instead of the file loaded by NGINX, so it can be rotated without a reload
+    pem_cert_uid = get_pem_cert_uid(DEFAULT_CERT_HOSTNAME)
+    if pem_cert_uid then
+      pem_cert = certificate_data:get(pem_cert_uid)
+    end
+  end
   if not pem_cert then
     ngx.log(ngx.ERR, "certificate not found, falling back to fake certificate for hostname: "
       .. tostring(hostname))
@@ -260,11 +393,21 @@ function _M.call()
     return ngx.exit(ngx.ERROR)
   end
 
-  if is_ocsp_stapling_enabled_for(pem_cert_uid) then
-    local _, err = ocsp_staple(pem_cert_uid, der_cert)
+  local must_staple = is_ocsp_must_staple_enforced_for(pem_cert_uid)
+  if must_staple or is_ocsp_stapling_enabled_for(pem_cert_uid) then
+    local ok, err = ocsp_staple(pem_cert_uid, der_cert)
     if err then
       ngx.log(ngx.ERR, "error during OCSP stapling: ", err)
     end
+
+    -- clients reject the must-staple certificates served without an OCSP
+    -- response, refuse the handshake instead of violating the policy silently
+    if must_staple and not ok then
+      ngx.log(ngx.WARN, "refusing TLS handshake for ", tostring(hostname),
+        ", no OCSP response available for its must-staple certificate")
+      record_ocsp_stapling_failure(pem_cert_uid, err)
+      return ngx.exit(ngx.ERROR)
+    end
   end
 end
 
@@ -0,0 +1,176 @@
+-- Ejects the endpoints of the backends with the circuit-breaker annotations
+-- from the balancers for a while when their responses are failing, based on
+-- the consecutive 5xx responses and on the rate of 5xx responses in a window.
+-- The counters and the ejections are shared by the workers.
+local ngx = ngx
+local ipairs = ipairs
+local pairs = pairs
+local tonumber = tonumber
+local string_format = string.format
+local math_floor = math.floor
+
+local circuit_breaker_data = ngx.shared.circuit_breaker
+
+-- incremented on each ejection for the workers to sync their balancers
+local GENERATION_KEY = "generation"
+
+local _M = {}
+
+-- configuration of the circuit breaker of the synced backends
+local configs = {}
+-- time at which the first ejection of the last synced backends ends, the
+-- backends are synced again then to add the endpoint back
+local readd_at = nil
+local synced_generation = 0
+
+local function endpoint_key(backend_name, peer)
+  return string_format("%s|%s", backend_name, peer)
+end
+
+local function is_enabled(config)
+  return config and ((config.consecutiveErrors or 0) > 0 or (config.errorRate or 0) > 0)
+end
+
+local function eject(key, config)
+  local ok = circuit_breaker_data:add(key .. "|ejected", true, config.cooldown)
+  if not ok then
+    return
+  end
+
+  circuit_breaker_data:delete(key .. "|consecutive")
+  circuit_breaker_data:incr(GENERATION_KEY, 1, 0)
+  ngx.log(ngx.WARN, "ejecting ", key, " from the load balancing for ", config.cooldown, " seconds")
+end
+
+local function exceeds_error_rate(key, config, failed)
+  if (config.errorRate or 0) == 0 then
+    return false
+  end
+
+  local window_id = math_floor(ngx.now() / config.window)
+  local window_key = string_format("%s|%s", key, window_id)
+
+  local total = circuit_breaker_data:incr(window_key .. "|total", 1, 0, config.window)
+  local errors = circuit_breaker_data:get(window_key .. "|errors") or 0
+  if failed then
+    errors = circuit_breaker_data:incr(window_key .. "|errors", 1, 0, config.window)
+  end
+
+  if not total or not errors or total < config.minRequests then
+    return false
+  end
+
+  return errors * 100 >= total * config.errorRate
+end
+
+local function exceeds_consecutive_errors(key, config, failed)
+  if (config.consecutiveErrors or 0) == 0 then
+    return false
+  end
+
+  if not failed then
+    circuit_breaker_data:delete(key .. "|consecutive")
+    return false
+  end
+
+  local consecutive = circuit_breaker_data:incr(key .. "|consecutive", 1, 0, config.cooldown)
+  return consecutive and consecutive >= config.consecutiveErrors
+end
+
+-- last_value returns the last value of a variable of the upstream module,
+-- like $upstream_addr, that contains one value per try
+local function last_value(value)
+  if not value then
+    return nil
+  end
+
+  return value:match("([^,:%s][^,%s]*)%s*$")
+end
+
+-- filter returns the backend without the ejected endpoints. All the
+-- endpoints are returned when all of them are ejected to keep the backend
+-- available.
+function _M.filter(backend)
+  local config = backend.circuitBreaker
+  if not is_enabled(config) then
+    configs[backend.name] = nil
+    return backend
+  end
+  configs[backend.name] = config
+
+  if not backend.endpoints or #backend.endpoints == 0 then
+    return backend
+  end
+
+  local available = {}
+  for _, endpoint in ipairs(backend.endpoints) do
+    local peer = string_format("%s:%s", endpoint.address, endpoint.port)
+    local ttl = circuit_breaker_data:ttl(endpoint_key(backend.name, peer) .. "|ejected")
+    if ttl then
+      if ttl > 0 and (not readd_at or ngx.now() + ttl < readd_at) then
+        readd_at = ngx.now() + ttl
+      end
+    else
+      available[#available + 1] = endpoint
+    end
+  end
+
+  if #available == 0 or #available == #backend.endpoints then
+    return backend
+  end
+
+  local filtered = {}
+  for k, v in pairs(backend) do
+    filtered[k] = v
+  end
+  filtered.endpoints = available
+
+  return filtered
+end
+
+-- is_ejected returns true when the endpoint of the backend is ejected
+function _M.is_ejected(backend_name, endpoint)
+  local peer = string_format("%s:%s", endpoint.address, endpoint.port)
+  return circuit_breaker_data:get(endpoint_key(backend_name, peer) .. "|ejected") ~= nil
+end
+
+-- record counts the response of the last try of the request to the backend
+-- and ejects the endpoint when it exceeds one of the thresholds
+function _M.record(backend_name)
+  local config = configs[backend_name]
+  if not config then
+    return
+  end
+
+  local peer = last_value(ngx.var.upstream_addr)
+  local status = tonumber(last_value(ngx.var.upstream_status))
+  if not peer or not status then
+    return
+  end
+
+  local key = endpoint_key(backend_name, peer)
+  local failed = status >= 500
+
+  local exceeds_rate = exceeds_error_rate(key, config, failed)
+  local exceeds_consecutive = exceeds_consecutive_errors(key, config, failed)
+  if exceeds_rate or exceeds_consecutive then
+    eject(key, config)
+  end
+end
+
+-- has_changed returns true when the backends must be synced again to remove
+-- the ejected endpoints or to add them back after the cooldown
+function _M.has_changed()
+  if readd_at and ngx.now() >= readd_at then
+    return true
+  end
+
+  return (circuit_breaker_data:get(GENERATION_KEY) or 0) ~= synced_generation
+end
+
+function _M.reset_changed()
+  readd_at = nil
+  synced_generation = circuit_breaker_data:get(GENERATION_KEY) or 0
+end
+
+return _M
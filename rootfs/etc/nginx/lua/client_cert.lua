@@ -0,0 +1,188 @@
+-- Formats the client certificate of mutual TLS connections for the
+-- auth-tls-pass-certificate-format annotation.
+local resty_sha256 = require("resty.sha256")
+local resty_str = require("resty.string")
+
+local ngx = ngx
+local ipairs = ipairs
+local string = string
+local table = table
+
+local _M = {}
+
+-- DER encoded OID 2.5.29.17 (subjectAltName)
+local SUBJECT_ALT_NAME_OID = string.char(0x55, 0x1d, 0x11)
+
+local TAG_SEQUENCE = 0x30
+local TAG_OID = 0x06
+local TAG_OCTET_STRING = 0x04
+local TAG_EXTENSIONS = 0xa3
+local TAG_DNS_NAME = 0x82
+local TAG_URI = 0x86
+
+-- read_tlv reads the DER element starting at pos and returns its tag
+-- and the first and last positions of its value
+local function read_tlv(der, pos)
+  local tag, len = string.byte(der, pos, pos + 1)
+  if not tag or not len then
+    return nil
+  end
+
+  local start = pos + 2
+  if len >= 0x80 then
+    local n = len - 0x80
+    if n == 0 or n > 4 then
+      return nil
+    end
+
+    len = 0
+    for i = 0, n - 1 do
+      local b = string.byte(der, start + i)
+      if not b then
+        return nil
+      end
+      len = len * 256 + b
+    end
+    start = start + n
+  end
+
+  local stop = start + len - 1
+  if stop > #der then
+    return nil
+  end
+
+  return tag, start, stop
+end
+
+local function children(der, start, stop)
+  local list = {}
+
+  local pos = start
+  while pos <= stop do
+    local tag, s, e = read_tlv(der, pos)
+    if not tag or e > stop then
+      return {}
+    end
+    table.insert(list, { tag = tag, start = s, stop = e })
+    pos = e + 1
+  end
+
+  return list
+end
+
+local function find_child(list, tag)
+  for _, element in ipairs(list) do
+    if element.tag == tag then
+      return element
+    end
+  end
+end
+
+-- subject_alt_names returns the DNS and URI entries of the
+-- subjectAltName extension of a DER encoded certificate
+function _M.subject_alt_names(der)
+  local names = { dns = {}, uri = {} }
+
+  local tag, start, stop = read_tlv(der, 1)
+  if tag ~= TAG_SEQUENCE then
+    return names
+  end
+
+  local tbs = children(der, start, stop)[1]
+  if not tbs or tbs.tag ~= TAG_SEQUENCE then
+    return names
+  end
+
+  local extensions = find_child(children(der, tbs.start, tbs.stop), TAG_EXTENSIONS)
+  if not extensions then
+    return names
+  end
+
+  local sequence = find_child(children(der, extensions.start, extensions.stop), TAG_SEQUENCE)
+  if not sequence then
+    return names
+  end
+
+  for _, extension in ipairs(children(der, sequence.start, sequence.stop)) do
+    local parts = children(der, extension.start, extension.stop)
+    local oid = parts[1]
+    local value = parts[#parts]
+
+    if oid and oid.tag == TAG_OID and value.tag == TAG_OCTET_STRING and
+        string.sub(der, oid.start, oid.stop) == SUBJECT_ALT_NAME_OID then
+      local t, s, e = read_tlv(der, value.start)
+      if t == TAG_SEQUENCE then
+        for _, name in ipairs(children(der, s, e)) do
+          if name.tag == TAG_DNS_NAME then
+            table.insert(names.dns, string.sub(der, name.start, name.stop))
+          elseif name.tag == TAG_URI then
+            table.insert(names.uri, string.sub(der, name.start, name.stop))
+          end
+        end
+      end
+    end
+  end
+
+  return names
+end
+
+-- pem_body returns the base64 encoded DER certificate contained in a PEM
+local function pem_body(pem)
+  local body = string.gsub(pem, "%-%-%-%-%-[^%-]+%-%-%-%-%-", "")
+  body = string.gsub(body, "%s", "")
+  return body
+end
+
+-- der returns the client certificate as base64 encoded DER
+function _M.der(pem)
+  if not pem or pem == "" then
+    return ""
+  end
+
+  return pem_body(pem)
+end
+
+-- quote quotes the value of a XFCC element when it contains
+-- characters with a special meaning in the header
+local function quote(value, always)
+  if not always and not string.find(value, '[,;="]') then
+    return value
+  end
+
+  return '"' .. string.gsub(value, '"', '\\"') .. '"'
+end
+
+-- xfcc returns the client certificate formatted as the
+-- X-Forwarded-Client-Cert header used by Envoy
+function _M.xfcc(pem, escaped_pem, subject)
+  if not pem or pem == "" then
+    return ""
+  end
+
+  local der = ngx.decode_base64(pem_body(pem))
+  if not der then
+    ngx.log(ngx.ERR, "failed to decode client certificate")
+    return ""
+  end
+
+  local sha256 = resty_sha256:new()
+  sha256:update(der)
+
+  local elements = {
+    "Hash=" .. resty_str.to_hex(sha256:final()),
+    "Cert=" .. quote(escaped_pem or "", true),
+    "Subject=" .. quote(subject or "", true),
+  }
+
+  local names = _M.subject_alt_names(der)
+  for _, uri in ipairs(names.uri) do
+    table.insert(elements, "URI=" .. quote(uri))
+  end
+  for _, dns in ipairs(names.dns) do
+    table.insert(elements, "DNS=" .. quote(dns))
+  end
+
+  return table.concat(elements, ";")
+end
+
+return _M
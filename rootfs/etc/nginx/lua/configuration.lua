@@ -1,4 +1,9 @@
 local cjson = require("cjson.safe")
+local certificate = require("certificate")
+local keepalive_stats = require("keepalive_stats")
+local backend_health = require("backend_health")
+local auth_jwt = require("auth_jwt")
+local local_sync_throttle = require("util.local_sync_throttle")
 
 local io = io
 local ngx = ngx
@@ -6,12 +11,14 @@ local tostring = tostring
 local string = string
 local table = table
 local pairs = pairs
+local type = type
 
 -- this is the Lua representation of Configuration struct in internal/ingress/types.go
 local configuration_data = ngx.shared.configuration_data
 local certificate_data = ngx.shared.certificate_data
 local certificate_servers = ngx.shared.certificate_servers
 local ocsp_response_cache = ngx.shared.ocsp_response_cache
+local ocsp_must_staple = ngx.shared.ocsp_must_staple
 
 local EMPTY_UID = "-1"
 
@@ -25,6 +32,34 @@ function _M.get_general_data()
   return configuration_data:get("general")
 end
 
+function _M.get_bot_detection_data()
+  return configuration_data:get("bot_detection"), configuration_data:get("bot_detection_version")
+end
+
+function _M.get_global_rate_limit_redis_password()
+  return configuration_data:get("global_rate_limit_redis_password")
+end
+
+function _M.get_global_rate_limit_key_hash_secret()
+  return configuration_data:get("global_rate_limit_key_hash_secret")
+end
+
+function _M.get_time_windows_data()
+  return configuration_data:get("time_windows"), configuration_data:get("time_windows_version")
+end
+
+function _M.get_plugin_flags_data()
+  return configuration_data:get("plugin_flags"), configuration_data:get("plugin_flags_version")
+end
+
+function _M.get_openapi_specs_data()
+  return configuration_data:get("openapi_specs"), configuration_data:get("openapi_specs_version")
+end
+
+function _M.get_body_filter_snippets_data()
+  return configuration_data:get("body_filter_snippets"), configuration_data:get("body_filter_snippets_version")
+end
+
 function _M.get_raw_backends_last_synced_at()
   local raw_backends_last_synced_at = configuration_data:get("raw_backends_last_synced_at")
   if raw_backends_last_synced_at == nil then
@@ -123,6 +158,13 @@ local function handle_servers()
         .. "LRU entry has been removed to store %s", uid)
       ngx.log(ngx.WARN, msg)
     end
+
+    if configuration.must_staple and configuration.must_staple[uid] then
+      ocsp_must_staple:set(uid, true)
+      certificate.prefetch_ocsp_response(uid, cert)
+    else
+      ocsp_must_staple:delete(uid)
+    end
   end
 
   if #err_buf > 0 then
@@ -220,6 +262,366 @@ local function handle_backends()
   ngx.status = ngx.HTTP_CREATED
 end
 
+local function handle_bot_detection()
+  if ngx.var.request_method == "GET" then
+    ngx.status = ngx.HTTP_OK
+    ngx.print(_M.get_bot_detection_data())
+    return
+  end
+
+  local rules = fetch_request_body()
+  if not rules then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  local success, err = configuration_data:set("bot_detection", rules)
+  if not success then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating bot detection rules: " .. tostring(err))
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  -- the workers decode the rules again when the version changes
+  local _
+  _, err = configuration_data:incr("bot_detection_version", 1, 0)
+  if err then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating bot detection version: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_CREATED
+end
+
+local function handle_global_rate_limit_redis()
+  if ngx.var.request_method ~= "POST" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only POST requests are allowed!")
+    return
+  end
+
+  local body = fetch_request_body()
+  local data = body and cjson.decode(body)
+  if type(data) ~= "table" or type(data.password) ~= "string" then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  -- the password is never logged nor returned
+  local success, err = configuration_data:set("global_rate_limit_redis_password", data.password)
+  if not success then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating the Redis password: " .. tostring(err))
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  ngx.status = ngx.HTTP_CREATED
+end
+
+local function handle_global_rate_limit_key_hash()
+  if ngx.var.request_method ~= "POST" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only POST requests are allowed!")
+    return
+  end
+
+  local body = fetch_request_body()
+  local data = body and cjson.decode(body)
+  if type(data) ~= "table" or type(data.secret) ~= "string" then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  -- the key is never logged nor returned
+  local success, err = configuration_data:set("global_rate_limit_key_hash_secret", data.secret)
+  if not success then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating the key hash secret: " .. tostring(err))
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  ngx.status = ngx.HTTP_CREATED
+end
+
+local function handle_time_windows()
+  if ngx.var.request_method == "GET" then
+    ngx.status = ngx.HTTP_OK
+    ngx.print(_M.get_time_windows_data())
+    return
+  end
+
+  local windows = fetch_request_body()
+  if not windows then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  local success, err = configuration_data:set("time_windows", windows)
+  if not success then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating time windows: " .. tostring(err))
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  -- the workers decode the windows again when the version changes
+  local _
+  _, err = configuration_data:incr("time_windows_version", 1, 0)
+  if err then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating time windows version: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_CREATED
+end
+
+local function handle_plugin_flags()
+  if ngx.var.request_method == "GET" then
+    ngx.status = ngx.HTTP_OK
+    ngx.print(_M.get_plugin_flags_data())
+    return
+  end
+
+  local flags = fetch_request_body()
+  if not flags then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  local success, err = configuration_data:set("plugin_flags", flags)
+  if not success then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating plugin flags: " .. tostring(err))
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  -- the workers decode the flags again when the version changes
+  local _
+  _, err = configuration_data:incr("plugin_flags_version", 1, 0)
+  if err then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating plugin flags version: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_CREATED
+end
+
+local function handle_openapi_specs()
+  if ngx.var.request_method == "GET" then
+    ngx.status = ngx.HTTP_OK
+    ngx.print(_M.get_openapi_specs_data())
+    return
+  end
+
+  local specs = fetch_request_body()
+  if not specs then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  local success, err = configuration_data:set("openapi_specs", specs)
+  if not success then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating OpenAPI specifications: " .. tostring(err))
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  -- the workers decode the specifications again when the version changes
+  local _
+  _, err = configuration_data:incr("openapi_specs_version", 1, 0)
+  if err then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating OpenAPI specifications version: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_CREATED
+end
+
+local function handle_body_filter_snippets()
+  if ngx.var.request_method == "GET" then
+    ngx.status = ngx.HTTP_OK
+    ngx.print(_M.get_body_filter_snippets_data())
+    return
+  end
+
+  local snippets = fetch_request_body()
+  if not snippets then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  local success, err = configuration_data:set("body_filter_snippets", snippets)
+  if not success then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating body filter snippets: " .. tostring(err))
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  -- the workers decode the snippets again when the version changes
+  local _
+  _, err = configuration_data:incr("body_filter_snippets_version", 1, 0)
+  if err then
+    ngx.log(ngx.ERR, "dynamic-configuration: error updating body filter snippets version: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_CREATED
+end
+
+local function handle_keepalive_stats()
+  if ngx.var.request_method ~= "GET" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only GET requests are allowed!")
+    return
+  end
+
+  keepalive_stats.call()
+end
+
+-- handle_backend_health returns the load of the synced backends
+local function handle_backend_health()
+  if ngx.var.request_method ~= "GET" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only GET requests are allowed!")
+    return
+  end
+
+  local backends = cjson.decode(_M.get_backends_data() or "[]")
+  local loads, err = cjson.encode(backend_health.get(backends))
+  if not loads then
+    ngx.log(ngx.ERR, "dynamic-configuration: error encoding backend health: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_OK
+  ngx.print(loads)
+end
+
+-- handle_no_sni_handshakes returns the number of TLS handshakes without SNI
+-- handled by each action
+local function handle_no_sni_handshakes()
+  if ngx.var.request_method ~= "GET" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only GET requests are allowed!")
+    return
+  end
+
+  local handshakes, err = cjson.encode(certificate.get_no_sni_handshakes())
+  if not handshakes then
+    ngx.log(ngx.ERR, "dynamic-configuration: error encoding TLS handshakes without SNI: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_OK
+  ngx.print(handshakes)
+end
+
+-- handle_global_rate_limit_deltas returns the requests of the global rate
+-- limits counted since the previous call, to be sent to the other pods
+local function handle_global_rate_limit_deltas()
+  if ngx.var.request_method ~= "POST" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only POST requests are allowed!")
+    return
+  end
+
+  local deltas, err = cjson.encode(local_sync_throttle.take())
+  if not deltas then
+    ngx.log(ngx.ERR, "dynamic-configuration: error encoding global rate limit deltas: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_OK
+  ngx.print(deltas)
+end
+
+-- handle_global_rate_limit_peers adds the requests of the global rate limits
+-- counted by another pod
+local function handle_global_rate_limit_peers()
+  if ngx.var.request_method ~= "POST" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only POST requests are allowed!")
+    return
+  end
+
+  local body = fetch_request_body()
+  local deltas = body and cjson.decode(body)
+  if type(deltas) ~= "table" then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  local_sync_throttle.add(deltas)
+
+  ngx.status = ngx.HTTP_CREATED
+end
+
+-- handle_auth_jwt_keys stores the JSON Web Key Sets fetched by the
+-- controller and returns the URLs of the key sets to fetch again
+local function handle_auth_jwt_keys()
+  if ngx.var.request_method ~= "POST" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only POST requests are allowed!")
+    return
+  end
+
+  local body = fetch_request_body()
+  local update = body and cjson.decode(body)
+  if type(update) ~= "table" or type(update.keys) ~= "table" or type(update.urls) ~= "table" then
+    ngx.log(ngx.ERR, "dynamic-configuration: unable to read valid request body")
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    return
+  end
+
+  auth_jwt.set_keys(update.keys)
+
+  local requested, err = cjson.encode(auth_jwt.take_refresh_requests(update.urls))
+  if not requested then
+    ngx.log(ngx.ERR, "dynamic-configuration: error encoding JSON Web Key Set requests: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_OK
+  ngx.print(requested)
+end
+
+-- handle_ocsp_stapling_failures returns the TLS handshakes refused since the
+-- previous call because no OCSP response of a must-staple certificate could
+-- be stapled
+local function handle_ocsp_stapling_failures()
+  if ngx.var.request_method ~= "POST" then
+    ngx.status = ngx.HTTP_BAD_REQUEST
+    ngx.print("Only POST requests are allowed!")
+    return
+  end
+
+  local failures, err = cjson.encode(certificate.take_ocsp_stapling_failures())
+  if not failures then
+    ngx.log(ngx.ERR, "dynamic-configuration: error encoding OCSP stapling failures: " .. tostring(err))
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_OK
+  ngx.print(failures)
+end
+
 function _M.call()
   if ngx.var.request_method ~= "POST" and ngx.var.request_method ~= "GET" then
     ngx.status = ngx.HTTP_BAD_REQUEST
@@ -247,6 +649,76 @@ function _M.call()
     return
   end
 
+  if ngx.var.request_uri == "/configuration/bot-detection" then
+    handle_bot_detection()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/global-rate-limit-redis" then
+    handle_global_rate_limit_redis()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/global-rate-limit-key-hash" then
+    handle_global_rate_limit_key_hash()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/time-windows" then
+    handle_time_windows()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/plugin-flags" then
+    handle_plugin_flags()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/openapi-specs" then
+    handle_openapi_specs()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/body-filter-snippets" then
+    handle_body_filter_snippets()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/keepalive" then
+    handle_keepalive_stats()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/backend-health" then
+    handle_backend_health()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/no-sni" then
+    handle_no_sni_handshakes()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/global-rate-limit/deltas" then
+    handle_global_rate_limit_deltas()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/global-rate-limit/peers" then
+    handle_global_rate_limit_peers()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/auth-jwt-keys" then
+    handle_auth_jwt_keys()
+    return
+  end
+
+  if ngx.var.request_uri == "/configuration/ocsp-stapling-failures" then
+    handle_ocsp_stapling_failures()
+    return
+  end
+
   ngx.status = ngx.HTTP_NOT_FOUND
   ngx.print("Not found!")
 end
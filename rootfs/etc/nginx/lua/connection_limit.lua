@@ -0,0 +1,85 @@
+-- Limits the concurrent connections of each key, like the client address,
+-- to the locations configured with the annotation
+-- nginx.ingress.kubernetes.io/limit-connections-per-key, across all the
+-- workers. A connection is counted from the rewrite phase of its request to
+-- the log phase, so a WebSocket holds its slot until the session ends.
+local ngx = ngx
+local request_state = require("request_state")
+local util = require("util")
+
+local counters = ngx.shared.connections_per_key
+
+local DEFAULT_RAW_KEY = "remote_addr"
+-- seconds the counters of a key are kept after its last connection, the
+-- slots of the connections never reaching the log phase, like the ones
+-- handled by a crashed worker, are recovered once the key is idle
+local COUNTER_TTL = 600
+
+local _M = {}
+
+local function incr(key, value)
+  local count, err, forcible = counters:incr(key, value, 0, COUNTER_TTL)
+  if not count then
+    ngx.log(ngx.WARN, "error updating the connections of ", key, ": ", err)
+    return nil
+  end
+  if forcible then
+    ngx.log(ngx.WARN, "connections_per_key shared dictionary is full, consider increasing its size")
+  end
+
+  return count
+end
+
+-- acquire must be called in the rewrite phase, the slot is released by the
+-- log phase of the request
+function _M.acquire(config)
+  if not config or config.limit == 0 or request_state.get("connection_limit") then
+    return
+  end
+
+  local key_value = util.generate_var_value(config.key)
+  if not key_value or key_value == "" then
+    key_value = ngx.var[DEFAULT_RAW_KEY]
+  end
+
+  -- the paths of an Ingress have their own budget
+  local key = config.namespace .. "|" .. (ngx.var.location_path or "") .. "|" .. key_value
+
+  local count = incr(key, 1)
+  if not count then
+    -- do not reject connections when the counters are not available
+    return
+  end
+
+  counters:expire(key, COUNTER_TTL)
+
+  if count > config.limit then
+    incr(key, -1)
+    ngx.log(ngx.INFO, "too many connections of ", key_value, " to ", ngx.var.location_path)
+    return ngx.exit(config.status_code)
+  end
+
+  -- the slot is kept until the log phase across the internal redirects,
+  -- which reset ngx.ctx
+  request_state.set("connection_limit", key)
+end
+
+function _M.release()
+  local key = request_state.take("connection_limit")
+  if not key then
+    return
+  end
+
+  local count = incr(key, -1)
+  if count and count < 0 then
+    -- the counter expired while the connection was open
+    incr(key, -count)
+  end
+end
+
+-- get returns the number of connections of the key
+function _M.get(key)
+  return counters:get(key) or 0
+end
+
+return _M
@@ -0,0 +1,36 @@
+-- Nonce of the Content-Security-Policy header of the locations with the
+-- nginx.ingress.kubernetes.io/csp-nonce annotation, a random value of each
+-- request allowing its inline scripts and styles.
+--
+-- A predictable nonce, like an empty one, allows the injected scripts, so
+-- the request fails when no random bytes are available.
+local random = require("resty.random")
+
+local ngx = ngx
+local error = error
+
+-- number of random bytes of the nonce
+local NONCE_BYTES = 16
+
+local _M = {}
+
+-- generate returns the base64 encoded nonce of the request. The bytes come
+-- from the cryptographically strong generator, or else from the pseudo-random
+-- one of OpenSSL, which is still unpredictable once seeded.
+function _M.generate()
+  local bytes = random.bytes(NONCE_BYTES, true)
+  if not bytes then
+    ngx.log(ngx.WARN, "strong random bytes unavailable for the CSP nonce, using pseudo-random bytes")
+    bytes = random.bytes(NONCE_BYTES)
+  end
+
+  -- set_by_lua fails the request with a 500 status code on errors, which
+  -- are logged
+  if not bytes then
+    error("random bytes unavailable for the CSP nonce")
+  end
+
+  return ngx.encode_base64(bytes)
+end
+
+return _M
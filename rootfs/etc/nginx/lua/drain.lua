@@ -0,0 +1,284 @@
+-- Keeps the endpoints removed from the backends with a drain timeout, set
+-- with the annotation nginx.ingress.kubernetes.io/drain-timeout or the
+-- drain-timeout setting of the ConfigMap, as draining endpoints of the
+-- balancers. Draining endpoints receive no new requests, the sessions with
+-- affinity to them, with a cookie or a hash key, stay on them until the end
+-- of the timeout.
+--
+-- The state is kept in the drain shared dictionary, so all the workers drain
+-- the same endpoints until the same deadline, also across reloads. The
+-- affinity of a session is found with the ring of the endpoints of the
+-- backend when the endpoint was removed, built by the balancer.
+local ngx = ngx
+local cjson = require("cjson.safe")
+local resty_lock = require("resty.lock")
+local ngx_balancer = require("ngx.balancer")
+local util = require("util")
+
+local ipairs = ipairs
+local pairs = pairs
+local next = next
+local tostring = tostring
+local string_format = string.format
+
+local state = ngx.shared.drain
+
+-- the state is updated by the worker holding the lock of the backend, the
+-- other workers only read it, the locks are not waited for as the backends
+-- are also synced in the init_worker phase
+local LOCK_OPTIONS = { timeout = 0, exptime = 1 }
+
+local _M = {}
+
+-- true when an endpoint of the last synced backends is draining
+local pending = false
+
+local function endpoint_key(endpoint)
+  return string_format("%s:%s", endpoint.address, endpoint.port)
+end
+
+local function copy_endpoints(endpoints)
+  local copy = {}
+  for _, endpoint in ipairs(endpoints or {}) do
+    copy[#copy + 1] = { address = endpoint.address, port = endpoint.port, weight = endpoint.weight }
+  end
+  return copy
+end
+
+local function get(key)
+  local value = state:get(key)
+  if not value then
+    return nil
+  end
+
+  local decoded, err = cjson.decode(value)
+  if not decoded then
+    ngx.log(ngx.ERR, "could not parse the draining endpoints: ", err)
+    return nil
+  end
+
+  return decoded
+end
+
+local function set(key, value)
+  local encoded, err = cjson.encode(value)
+  if not encoded then
+    ngx.log(ngx.ERR, "could not encode the draining endpoints: ", err)
+    return
+  end
+
+  local ok, forcible
+  ok, err, forcible = state:set(key, encoded)
+  if not ok then
+    ngx.log(ngx.WARN, "error updating the draining endpoints of ", key, ": ", err)
+  end
+  if forcible then
+    ngx.log(ngx.WARN, "drain shared dictionary is full, consider increasing its size")
+  end
+end
+
+-- update adds the endpoints of the backend removed since the last sync of
+-- any worker to its draining endpoints and removes the expired ones. The
+-- draining endpoints reference the ring, the endpoints of the backend before
+-- their removal, in rings.
+local function update(backend, current, timeout, now)
+  local endpoints_key = "endpoints|" .. backend.name
+  local draining_key = "draining|" .. backend.name
+
+  local previous = get(endpoints_key)
+  local draining = get(draining_key) or { sequence = 0, rings = {}, endpoints = {} }
+
+  local draining_keys = {}
+  for _, entry in ipairs(draining.endpoints) do
+    draining_keys[endpoint_key(entry)] = true
+  end
+
+  local ring
+  for _, endpoint in ipairs(previous or {}) do
+    local key = endpoint_key(endpoint)
+    if not current[key] and not draining_keys[key] then
+      if not ring then
+        draining.sequence = draining.sequence + 1
+        ring = tostring(draining.sequence)
+        draining.rings[ring] = previous
+      end
+
+      ngx.log(ngx.INFO, "draining endpoint ", key, " of backend ", backend.name,
+        " for ", timeout, " seconds")
+      draining.endpoints[#draining.endpoints + 1] = {
+        address = endpoint.address,
+        port = endpoint.port,
+        deadline = now + timeout,
+        ring = ring,
+      }
+    end
+  end
+
+  -- the endpoints added back are not draining anymore
+  local kept = {}
+  local rings = {}
+  for _, entry in ipairs(draining.endpoints) do
+    if not current[endpoint_key(entry)] and entry.deadline > now then
+      kept[#kept + 1] = entry
+      rings[entry.ring] = draining.rings[entry.ring]
+    end
+  end
+  draining.endpoints = kept
+  draining.rings = rings
+
+  set(endpoints_key, copy_endpoints(backend.endpoints))
+  if next(kept) then
+    set(draining_key, draining)
+  else
+    state:delete(draining_key)
+  end
+
+  return draining
+end
+
+-- filter returns the backend with the draining endpoints in the field
+-- drainingEndpoints, each one with the ring of the endpoints of the backend
+-- before its removal in the field ring, shared by the endpoints removed by
+-- the same sync, identified by ring_id
+function _M.filter(backend)
+  local timeout = backend.drainTimeout or 0
+  if timeout == 0 then
+    state:delete("endpoints|" .. backend.name)
+    state:delete("draining|" .. backend.name)
+    return backend
+  end
+
+  local now = ngx.now()
+
+  local current = {}
+  for _, endpoint in ipairs(backend.endpoints or {}) do
+    current[endpoint_key(endpoint)] = true
+  end
+
+  local draining
+  local lock, err = resty_lock:new("drain", LOCK_OPTIONS)
+  if not lock then
+    ngx.log(ngx.ERR, "failed to create the lock of the draining endpoints: ", err)
+    return backend
+  end
+
+  if lock:lock("lock|" .. backend.name) then
+    draining = update(backend, current, timeout, now)
+    lock:unlock()
+  else
+    -- the state is being updated by another worker, the backend is synced
+    -- again in the next interval
+    draining = get("draining|" .. backend.name)
+    pending = true
+  end
+
+  local endpoints = {}
+  for _, entry in ipairs(draining and draining.endpoints or {}) do
+    if not current[endpoint_key(entry)] and entry.deadline > now then
+      endpoints[#endpoints + 1] = {
+        address = entry.address,
+        port = entry.port,
+        ring_id = entry.ring,
+        ring = copy_endpoints(draining.rings[entry.ring]),
+      }
+    end
+  end
+
+  if not next(endpoints) then
+    return backend
+  end
+
+  pending = true
+
+  local filtered = {}
+  for k, v in pairs(backend) do
+    filtered[k] = v
+  end
+  filtered.drainingEndpoints = endpoints
+
+  return filtered
+end
+
+-- attach sets the draining endpoints of the backend in the balancer, for
+-- the balancers with affinity, which implement the affinity_key and
+-- new_instance functions
+function _M.attach(balancer, backend)
+  balancer.draining = nil
+
+  if not backend.drainingEndpoints or not balancer.affinity_key or not balancer.new_instance then
+    return
+  end
+
+  local nodes = {}
+  local instances = {}
+  for _, endpoint in ipairs(backend.drainingEndpoints) do
+    nodes[endpoint_key(endpoint)] = true
+
+    if not instances[endpoint.ring_id] then
+      instances[endpoint.ring_id] = balancer:new_instance(util.get_nodes(endpoint.ring), backend)
+    end
+  end
+
+  local rings = {}
+  for _, instance in pairs(instances) do
+    rings[#rings + 1] = instance
+  end
+
+  balancer.draining = { nodes = nodes, rings = rings }
+end
+
+-- find returns the draining endpoint the key, or the upstream, of a session
+-- had affinity to, nil when the session has no affinity to a draining
+-- endpoint
+function _M.find(balancer, key, upstream)
+  local draining = balancer.draining
+  if not draining then
+    return nil
+  end
+
+  if upstream and draining.nodes[upstream] then
+    return upstream
+  end
+
+  if not key or key == "" then
+    return nil
+  end
+
+  for _, ring in ipairs(draining.rings) do
+    local peer = ring:find(key)
+    if peer and draining.nodes[peer] then
+      return peer
+    end
+  end
+
+  return nil
+end
+
+-- balance returns the draining endpoint of the session of the request, nil
+-- when the request has no affinity to a draining endpoint or when a try to
+-- it failed
+function _M.balance(balancer)
+  if not balancer.draining or ngx_balancer.get_last_failure() then
+    return nil
+  end
+
+  return _M.find(balancer, balancer:affinity_key())
+end
+
+-- remove forgets the endpoints of a backend removed from the configuration
+function _M.remove(backend_name)
+  state:delete("endpoints|" .. backend_name)
+  state:delete("draining|" .. backend_name)
+end
+
+-- has_pending returns true when the backends must be synced again to remove
+-- the draining endpoints at the end of their timeout
+function _M.has_pending()
+  return pending
+end
+
+function _M.reset_pending()
+  pending = false
+end
+
+return _M
@@ -0,0 +1,81 @@
+-- Answers the requests of the locations with the echo-backend annotation
+-- with the details of the request as seen by NGINX, after the configured
+-- latency. Used to test the routing, the TLS settings and the headers
+-- without deploying an application.
+local cjson = require("cjson.safe")
+
+local ngx = ngx
+local math_random = math.random
+
+local _M = {}
+
+local function delay(config)
+  local latency = config.latency or 0
+  if (config.latency_jitter or 0) > 0 then
+    latency = latency + math_random(0, config.latency_jitter)
+  end
+
+  return latency / 1000
+end
+
+local function request_body()
+  ngx.req.read_body()
+
+  local body = ngx.req.get_body_data()
+  if not body and ngx.req.get_body_file() then
+    -- the bodies larger than client_body_buffer_size are not echoed
+    return nil, true
+  end
+
+  return body, false
+end
+
+-- content sends the details of the current request as JSON
+function _M.content(config)
+  local latency = delay(config)
+  if latency > 0 then
+    ngx.sleep(latency)
+  end
+
+  local body, truncated = request_body()
+  local response = {
+    method = ngx.req.get_method(),
+    scheme = ngx.var.scheme,
+    host = ngx.var.host,
+    uri = ngx.var.request_uri,
+    path = ngx.var.uri,
+    args = ngx.req.get_uri_args(),
+    http_version = ngx.req.http_version(),
+    headers = ngx.req.get_headers(),
+    body = body,
+    body_truncated = truncated,
+    remote_addr = ngx.var.remote_addr,
+    tls = {
+      protocol = ngx.var.ssl_protocol,
+      cipher = ngx.var.ssl_cipher,
+      server_name = ngx.var.ssl_server_name,
+      client_verify = ngx.var.ssl_client_verify,
+    },
+    ingress = {
+      namespace = ngx.var.namespace,
+      name = ngx.var.ingress_name,
+      service = ngx.var.service_name,
+      location = ngx.var.location_path,
+    },
+    latency = latency,
+  }
+
+  local status = config.status or ngx.HTTP_OK
+  ngx.status = status
+  -- the responses with these status codes cannot contain a body
+  if status == ngx.HTTP_NO_CONTENT or status == ngx.HTTP_NOT_MODIFIED then
+    return ngx.exit(status)
+  end
+
+  ngx.header["Content-Type"] = "application/json"
+  ngx.say(cjson.encode(response))
+
+  return ngx.exit(ngx.HTTP_OK)
+end
+
+return _M
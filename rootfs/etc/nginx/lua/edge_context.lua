@@ -0,0 +1,87 @@
+-- Builds the $edge_context variable, sent to the upstreams in the header
+-- configured with the setting edge-context-header of the ConfigMap. It
+-- contains the values of the NGINX variables mapped by the setting
+-- edge-context-fields, like the country of the client, the TLS version or
+-- the canary backend of the request, encoded as a JSON object or as a
+-- structured field dictionary (RFC 8941).
+local ngx = ngx
+local cjson = require("cjson.safe")
+
+local ipairs = ipairs
+local next = next
+local table_concat = table.concat
+local string_find = string.find
+local string_gsub = string.gsub
+
+local _M = {}
+
+local config = { format = "json", fields = {} }
+
+function _M.set_config(new_config)
+  config = new_config or { format = "json", fields = {} }
+end
+
+-- only the printable ASCII characters are allowed in the strings of the
+-- structured fields
+local function sf_string(value)
+  if string_find(value, "[^\32-\126]") then
+    return nil
+  end
+
+  return '"' .. string_gsub(value, '(["\\])', "\\%1") .. '"'
+end
+
+local function encode_structured_field(values)
+  local members = {}
+  for _, field in ipairs(config.fields) do
+    local value = values[field[1]]
+    if value then
+      local item = sf_string(value)
+      if item then
+        members[#members + 1] = field[1] .. "=" .. item
+      end
+    end
+  end
+
+  return table_concat(members, ", ")
+end
+
+local function encode_json(values)
+  if not next(values) then
+    return ""
+  end
+
+  local value, err = cjson.encode(values)
+  if not value then
+    ngx.log(ngx.ERR, "error encoding the edge context: ", err)
+    return ""
+  end
+
+  return value
+end
+
+-- get returns the edge context of the current request, an empty string when
+-- none of the variables has a value
+function _M.get()
+  local values = {}
+  for _, field in ipairs(config.fields) do
+    local value = ngx.var[field[2]]
+    if value and value ~= "" then
+      values[field[1]] = value
+    end
+  end
+
+  if config.format == "structured-field" then
+    return encode_structured_field(values)
+  end
+
+  return encode_json(values)
+end
+
+-- rewrite sets the $edge_context variable of the current request, it must
+-- be called after the balancer chose the canary backend of the request
+function _M.rewrite()
+  ngx.var.edge_context = _M.get()
+end
+
+return _M
@@ -0,0 +1,151 @@
+-- Runs the functions of the lua-edge-function annotation in a sandbox. The
+-- code only reaches a small API to read and change the requests and the
+-- responses, without access to the sockets, the files, the shared
+-- dictionaries or the ngx API, and is stopped after a number of instructions
+-- or when it allocates too much memory, see sandbox.lua.
+local ngx = ngx
+local sandbox = require("sandbox")
+
+local setfenv = setfenv
+local pairs = pairs
+local tonumber = tonumber
+local tostring = tostring
+local type = type
+local string_gsub = string.gsub
+local string_lower = string.lower
+
+local _M = {}
+
+local DEFAULT_CONFIG = {
+  max_instructions = 100000,
+  -- in kilobytes
+  max_memory = 1024,
+}
+
+local config = DEFAULT_CONFIG
+
+-- compiled chunks of the worker by code, or the compilation error
+local chunks = {}
+
+local function compile(code)
+  local chunk = chunks[code]
+  if chunk ~= nil then
+    return chunk
+  end
+
+  local fn, err = sandbox.compile(code, "edge_function")
+  if not fn then
+    chunk = { err = err }
+  else
+    chunk = { fn = fn }
+  end
+
+  chunks[code] = chunk
+  return chunk
+end
+
+-- run calls the handler of the code with the API, stopping it when it exceeds
+-- the limits
+local function run(code, handler, api, arg)
+  local chunk = compile(code)
+  if chunk.err then
+    return false, chunk.err
+  end
+
+  local env = sandbox.new_env(api)
+  env.log = sandbox.unsandboxed(function(...)
+    ngx.log(ngx.NOTICE, "edge function: ", ...)
+  end)
+  setfenv(chunk.fn, env)
+
+  return sandbox.run(config, function()
+    chunk.fn()
+
+    local fn = env[handler]
+    if type(fn) == "function" then
+      fn(arg)
+    end
+  end)
+end
+
+-- unsandboxed returns the functions of the API calling the ngx API with the
+-- methods of the whole string library
+local function unsandboxed(api)
+  for name, fn in pairs(api) do
+    api[name] = sandbox.unsandboxed(fn)
+  end
+
+  return api
+end
+
+local function request_api(response)
+  return unsandboxed({
+    get_method = function() return ngx.req.get_method() end,
+    get_path = function() return ngx.var.uri end,
+    set_path = function(path) ngx.req.set_uri(tostring(path)) end,
+    get_query_args = function() return ngx.req.get_uri_args(100) end,
+    set_query_args = function(args) ngx.req.set_uri_args(args) end,
+    get_remote_addr = function() return ngx.var.remote_addr end,
+    get_header = function(name)
+      return ngx.var["http_" .. string_gsub(string_lower(tostring(name)), "-", "_")]
+    end,
+    set_header = function(name, value) ngx.req.set_header(tostring(name), tostring(value)) end,
+    clear_header = function(name) ngx.req.clear_header(tostring(name)) end,
+    -- respond answers the request instead of the backend
+    respond = function(status, body)
+      response.status = tonumber(status) or ngx.HTTP_OK
+      response.body = body and tostring(body)
+    end,
+  })
+end
+
+local function response_api()
+  return unsandboxed({
+    get_status = function() return ngx.status end,
+    get_header = function(name) return ngx.header[tostring(name)] end,
+    set_header = function(name, value) ngx.header[tostring(name)] = tostring(value) end,
+    clear_header = function(name) ngx.header[tostring(name)] = nil end,
+  })
+end
+
+function _M.set_config(new_config)
+  config = new_config or DEFAULT_CONFIG
+end
+
+-- on_request runs the on_request function of the code in the rewrite phase.
+-- The request fails with 500 when the function fails.
+function _M.on_request(code)
+  local response = {}
+  local api = request_api(response)
+
+  local ok, err = run(code, "on_request", api, api)
+  if not ok then
+    ngx.log(ngx.ERR, "edge function failed: ", err)
+    return ngx.exit(ngx.HTTP_INTERNAL_SERVER_ERROR)
+  end
+
+  if not response.status then
+    return
+  end
+
+  ngx.status = response.status
+  if response.body then
+    ngx.print(response.body)
+    return ngx.exit(ngx.HTTP_OK)
+  end
+
+  return ngx.exit(response.status)
+end
+
+-- on_response runs the on_response function of the code in the header filter
+-- phase. The response is sent unchanged when the function fails.
+function _M.on_response(code)
+  local api = response_api()
+
+  local ok, err = run(code, "on_response", api, api)
+  if not ok then
+    ngx.log(ngx.ERR, "edge function failed: ", err)
+  end
+end
+
+return _M
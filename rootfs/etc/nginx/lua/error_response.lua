@@ -0,0 +1,75 @@
+-- Renders the errors generated by NGINX with the templates of the
+-- error-response-* settings of the ConfigMap: JSON when the client accepts
+-- application/json and HTML otherwise.
+local ngx = ngx
+
+local tonumber = tonumber
+local tostring = tostring
+local string_find = string.find
+local string_gsub = string.gsub
+
+local _M = {}
+
+local REASONS = {
+  [400] = "Bad Request",
+  [401] = "Unauthorized",
+  [403] = "Forbidden",
+  [404] = "Not Found",
+  [405] = "Not Allowed",
+  [408] = "Request Timeout",
+  [413] = "Request Entity Too Large",
+  [414] = "Request-URI Too Large",
+  [429] = "Too Many Requests",
+  [431] = "Request Header Fields Too Large",
+  [500] = "Internal Server Error",
+  [502] = "Bad Gateway",
+  [503] = "Service Temporarily Unavailable",
+  [504] = "Gateway Timeout",
+}
+
+local config = { html = "", json = "" }
+
+function _M.set_config(new_config)
+  config = new_config or { html = "", json = "" }
+end
+
+local function accepts_json()
+  local accept = ngx.var.http_accept
+  if not accept then
+    return false
+  end
+
+  return string_find(accept, "application/json", 1, true) ~= nil
+end
+
+local function render_template(template, values)
+  return (string_gsub(template, "{([%w_]+)}", function(name)
+    local value = values[name]
+    if value == nil then
+      return nil
+    end
+    return tostring(value)
+  end))
+end
+
+-- render sends the body of the error of the current request. NGINX keeps
+-- the status code of the original error unless status is given
+function _M.render(status)
+  status = status or tonumber(ngx.var.status) or ngx.HTTP_INTERNAL_SERVER_ERROR
+  local values = {
+    status = status,
+    reason = REASONS[status] or "Error",
+    request_id = ngx.var.req_id or "",
+  }
+
+  local template = config.html
+  ngx.header.content_type = "text/html"
+  if accepts_json() then
+    template = config.json
+    ngx.header.content_type = "application/json"
+  end
+
+  ngx.print(render_template(template, values))
+end
+
+return _M
@@ -1,9 +1,19 @@
 local resty_global_throttle = require("resty.global_throttle")
 local resty_ipmatcher = require("resty.ipmatcher")
+local resty_str = require("resty.string")
+local redis_throttle = require("util.redis_throttle")
+local local_sync_throttle = require("util.local_sync_throttle")
 local util = require("util")
+local monitor = require("monitor")
+local configuration = require("configuration")
 
 local ngx = ngx
+local ipairs = ipairs
+local math_ceil = math.ceil
+local math_max = math.max
+local math_min = math.min
 local ngx_exit = ngx.exit
+local ngx_sleep = ngx.sleep
 local ngx_log = ngx.log
 local ngx_ERR = ngx.ERR
 local ngx_INFO = ngx.INFO
@@ -19,7 +29,30 @@ local CACHE_THRESHOLD = 0.001
 
 local DEFAULT_RAW_KEY = "remote_addr"
 
-local function should_ignore_request(ignored_cidrs)
+local MODE_LOCAL_SYNC = "local-sync"
+
+-- has_ignored_header returns true when the request has one of the headers
+-- of global-rate-limit-ignored-headers with its value. The values are
+-- secrets shared with the partners, compared in constant time
+local function has_ignored_header(ignored_headers)
+  if not ignored_headers then
+    return false
+  end
+
+  for _, header in ipairs(ignored_headers) do
+    if util.constant_time_equals(ngx.var[header.variable], header.value) then
+      return true
+    end
+  end
+
+  return false
+end
+
+local function should_ignore_request(ignored_cidrs, ignored_headers)
+  if has_ignored_header(ignored_headers) then
+    return true
+  end
+
   if not ignored_cidrs or #ignored_cidrs == 0 then
     return false
   end
@@ -41,48 +74,167 @@ local function should_ignore_request(ignored_cidrs)
   return is_ignored
 end
 
+-- store_name returns the store of the counters of the location, the one
+-- of its GlobalRateLimitPolicy or global-rate-limit-store
+local function store_name(config, location_config)
+  if location_config.store and location_config.store ~= "" then
+    return location_config.store
+  end
+  return config.store
+end
+
+-- store_config returns the configuration of the client of the store of
+-- the counters, memcached unless the store is "redis"
+local function store_config(config, location_config)
+  if store_name(config, location_config) == "redis" then
+    return config.redis
+  end
+  return config.memcached
+end
+
 local function is_enabled(config, location_config)
-  if config.memcached.host == "" or config.memcached.port == 0 then
-    return false
+  -- the local-sync mode does not need a store
+  if config.mode ~= MODE_LOCAL_SYNC then
+    local store = store_config(config, location_config)
+    if not store or store.host == "" or store.port == 0 then
+      return false
+    end
   end
   if location_config.limit == 0 or
     location_config.window_size == 0 then
     return false
   end
 
-  if should_ignore_request(location_config.ignored_cidrs) then
+  if should_ignore_request(location_config.ignored_cidrs, location_config.ignored_headers) then
     return false
   end
 
   return true
 end
 
+-- select_bucket returns the configuration of the bucket of the path of the
+-- location, or the configuration of the location when there is none
+local function select_bucket(location_config)
+  local buckets = location_config.buckets
+  if not buckets or #buckets == 0 then
+    return location_config
+  end
+
+  local path = ngx.var.location_path
+  for _, bucket in ipairs(buckets) do
+    for _, bucket_path in ipairs(bucket.paths) do
+      if bucket_path == path then
+        return {
+          namespace = bucket.namespace,
+          limit = bucket.limit,
+          window_size = bucket.window_size,
+          key = location_config.key,
+          key_hash = location_config.key_hash,
+          ignored_cidrs = location_config.ignored_cidrs,
+          ignored_headers = location_config.ignored_headers,
+          burst = location_config.burst,
+          delay = location_config.delay,
+          headers = location_config.headers,
+          store = location_config.store,
+        }
+      end
+    end
+  end
+
+  return location_config
+end
+
+-- hash_key_value avoids sending personal data like the client addresses or
+-- the API keys in plain text to the store. The HMAC is keyed by the secret
+-- of the controller, so the values cannot be recovered by hashing all the
+-- client addresses
+local function hash_key_value(key_value)
+  local secret = configuration.get_global_rate_limit_key_hash_secret()
+  if not secret then
+    return nil, "the key hash secret is not configured yet"
+  end
+
+  return resty_str.to_hex(ngx.hmac_sha1(secret, key_value))
+end
+
 local function get_namespaced_key_value(namespace, key_value)
   return namespace .. key_value
 end
 
-function _M.throttle(config, location_config)
-  if not is_enabled(config, location_config) then
+-- set_decision exposes the decision in the $global_rate_limit_* variables
+-- and, when enabled in the location, in the X-RateLimit-Limit,
+-- X-RateLimit-Remaining and Retry-After response headers
+local function set_decision(location_config, status, remaining, retry_after)
+  ngx.var.global_rate_limit_status = status
+  ngx.var.global_rate_limit_limit = location_config.limit
+  if remaining then
+    ngx.var.global_rate_limit_remaining = remaining
+  end
+  if retry_after then
+    retry_after = math_max(math_ceil(retry_after), 1)
+    ngx.var.global_rate_limit_retry_after = retry_after
+  end
+
+  if not location_config.headers then
     return
   end
 
-  local key_value = util.generate_var_value(location_config.key)
-  if not key_value or key_value == "" then
-    key_value = ngx.var[DEFAULT_RAW_KEY]
+  ngx.header["X-RateLimit-Limit"] = location_config.limit
+  if remaining then
+    ngx.header["X-RateLimit-Remaining"] = remaining
   end
+  if retry_after then
+    ngx.header["Retry-After"] = retry_after
+  end
+end
 
-  local namespaced_key_value =
-    get_namespaced_key_value(location_config.namespace, key_value)
+-- record_decision counts the decision in the metrics, when enabled
+local function record_decision(config, location_config, decision, delay)
+  if config.enable_metrics then
+    monitor.record_rate_limit(decision, location_config.namespace, delay)
+  end
+end
 
-  local is_limit_exceeding = DECISION_CACHE:get(namespaced_key_value)
-  if is_limit_exceeding then
-    ngx.var.global_rate_limit_exceeding = "c"
+-- handle_store_error applies the fail policy when the store cannot be
+-- reached: the request is rejected with "deny" and let through otherwise
+local function handle_store_error(config, location_config)
+  set_decision(location_config, "error")
+
+  if config.enable_metrics then
+    monitor.record_global_rate_limit_error(config.fail_policy)
+  end
+
+  if config.fail_policy == "deny" then
+    ngx.var.global_rate_limit_exceeding = "e"
     return ngx_exit(config.status_code)
   end
+end
+
+-- the requests of the burst are counted by the store as part of the limit,
+-- only the ones over the limit and the burst are rejected
+local function new_throttle(config, location_config)
+  local limit = location_config.limit + (location_config.burst or 0)
+
+  if config.mode == MODE_LOCAL_SYNC then
+    return local_sync_throttle.new(
+      location_config.namespace,
+      limit,
+      location_config.window_size
+    )
+  end
 
-  local my_throttle, err = resty_global_throttle.new(
+  if store_name(config, location_config) == "redis" then
+    return redis_throttle.new(
+      location_config.namespace,
+      limit,
+      location_config.window_size,
+      config.redis
+    )
+  end
+
+  return resty_global_throttle.new(
     location_config.namespace,
-    location_config.limit,
+    limit,
     location_config.window_size,
     {
       provider = "memcached",
@@ -93,9 +245,47 @@ function _M.throttle(config, location_config)
       pool_size = config.memcached.pool_size,
     }
   )
+end
+
+function _M.throttle(config, location_config)
+  location_config = select_bucket(location_config)
+
+  if not is_enabled(config, location_config) then
+    return
+  end
+
+  local key_value = util.generate_var_value(location_config.key)
+  if not key_value or key_value == "" then
+    key_value = ngx.var[DEFAULT_RAW_KEY]
+  end
+  if location_config.key_hash then
+    local err
+    key_value, err = hash_key_value(key_value)
+    if not key_value then
+      ngx.log(ngx.ERR, "failed to hash key: ", err)
+      -- fail open
+      set_decision(location_config, "error")
+      return
+    end
+  end
+
+  local namespaced_key_value =
+    get_namespaced_key_value(location_config.namespace, key_value)
+
+  local is_limit_exceeding = DECISION_CACHE:get(namespaced_key_value)
+  if is_limit_exceeding then
+    ngx.var.global_rate_limit_exceeding = "c"
+    set_decision(location_config, "rejected", 0,
+      DECISION_CACHE:ttl(namespaced_key_value))
+    record_decision(config, location_config, "deny")
+    return ngx_exit(config.status_code)
+  end
+
+  local my_throttle, err = new_throttle(config, location_config)
   if err then
     ngx.log(ngx.ERR, "faled to initialize resty_global_throttle: ", err)
     -- fail open
+    set_decision(location_config, "error")
     return
   end
 
@@ -103,8 +293,7 @@ function _M.throttle(config, location_config)
   estimated_final_count, desired_delay, err = my_throttle:process(key_value)
   if err then
     ngx.log(ngx.ERR, "error while processing key: ", err)
-    -- fail open
-    return
+    return handle_store_error(config, location_config)
   end
 
   if desired_delay then
@@ -120,12 +309,30 @@ function _M.throttle(config, location_config)
     end
 
     ngx.var.global_rate_limit_exceeding = "y"
+    set_decision(location_config, "rejected", 0, desired_delay)
     ngx_log(ngx_INFO, "limit is exceeding for ",
       location_config.namespace, "/", key_value,
       " with estimated_final_count: ", estimated_final_count)
 
+    record_decision(config, location_config, "deny")
     return ngx_exit(config.status_code)
   end
+
+  -- like limit_req, the requests of the burst after the first delay ones are
+  -- delayed to the rate of the limit, leaky bucket style
+  local excess = estimated_final_count - location_config.limit - (location_config.delay or 0)
+  if excess > 0 then
+    local delay = math_min(excess * location_config.window_size / location_config.limit,
+      location_config.window_size)
+    set_decision(location_config, "delayed", 0)
+    record_decision(config, location_config, "allow", delay)
+    ngx_sleep(delay)
+    return
+  end
+
+  set_decision(location_config, "allowed",
+    math_max(location_config.limit - estimated_final_count, 0))
+  record_decision(config, location_config, "allow")
 end
 
 return _M
@@ -0,0 +1,257 @@
+-- Checks in the background the endpoints of the backends with the
+-- health-check-path or health-check-grpc-service settings and removes the
+-- failing ones from the balancers, without waiting for the endpoints of the
+-- services to be updated. The results of the checks are shared by the workers.
+local http = require("resty.http")
+
+local ngx = ngx
+local ipairs = ipairs
+local pairs = pairs
+local math_floor = math.floor
+local string_char = string.char
+local string_format = string.format
+local table_concat = table.concat
+
+local health_check_data = ngx.shared.health_check
+
+-- incremented when an endpoint becomes unhealthy or healthy again for the
+-- workers to sync their balancers
+local GENERATION_KEY = "generation"
+-- number of consecutive failed checks marking an endpoint as unhealthy
+local UNHEALTHY_THRESHOLD = 2
+-- the state of the endpoints expires after this number of intervals
+-- without check, when the endpoint was removed from the backend
+local STATE_TTL_INTERVALS = 5
+-- interval, in seconds, of the timer scheduling the checks
+local RUN_INTERVAL = 1
+
+-- HealthCheckResponse message of the gRPC health checking protocol with
+-- the status SERVING
+local GRPC_SERVING = string_char(0, 0, 0, 0, 2, 0x08, 0x01)
+
+local _M = {
+  -- port of the internal server proxying the gRPC checks, set in nginx.tmpl
+  status_port = nil,
+}
+
+-- configuration and endpoints of the synced backends with a health check
+local targets = {}
+local synced_generation = 0
+
+local function endpoint_key(backend_name, endpoint)
+  return string_format("%s|%s:%s", backend_name, endpoint.address, endpoint.port)
+end
+
+local function is_enabled(config)
+  return config and (config.grpc or (config.path or "") ~= "")
+end
+
+-- has_crlf returns true when the value would end the request line or a
+-- header of the checks
+local function has_crlf(value)
+  return value:find("[\r\n]") ~= nil
+end
+
+local function host(address)
+  if address:find(":", 1, true) and address:sub(1, 1) ~= "[" then
+    return string_format("[%s]", address)
+  end
+
+  return address
+end
+
+local function varint(n)
+  local bytes = {}
+  repeat
+    local b = n % 128
+    n = math_floor(n / 128)
+    if n > 0 then
+      b = b + 128
+    end
+    bytes[#bytes + 1] = string_char(b)
+  until n == 0
+
+  return table_concat(bytes)
+end
+
+-- grpc_request returns the length-prefixed HealthCheckRequest message of
+-- the service, the empty service checks the overall health of the server
+local function grpc_request(service)
+  local message = ""
+  if service and #service > 0 then
+    message = string_char(0x0a) .. varint(#service) .. service
+  end
+
+  local len = #message
+  return string_char(0,
+    math_floor(len / 16777216) % 256, math_floor(len / 65536) % 256,
+    math_floor(len / 256) % 256, len % 256) .. message
+end
+
+local function probe(config, endpoint)
+  local target = string_format("%s:%s", host(endpoint.address), endpoint.port)
+  if has_crlf(target) or has_crlf(config.path or "") then
+    return false, "invalid endpoint or path"
+  end
+
+  local httpc = http.new()
+  httpc:set_timeout(config.timeout)
+
+  if config.grpc then
+    -- the checks are proxied by NGINX, lua-resty-http does not speak HTTP/2,
+    -- with TLS for the GRPCS backends
+    local res, err = httpc:request_uri(
+      string_format("http://127.0.0.1:%s/grpc.health.v1.Health/Check", _M.status_port), {
+        method = "POST",
+        headers = {
+          ["Content-Type"] = "application/grpc",
+          ["X-Health-Check-Target"] = target,
+          ["X-Health-Check-Scheme"] = config.grpcTLS and "grpcs" or "grpc",
+        },
+        body = grpc_request(config.grpcService),
+      })
+    if not res then
+      return false, err
+    end
+
+    if res.status ~= ngx.HTTP_OK or res.body ~= GRPC_SERVING then
+      return false, string_format("status %s, grpc-status %s", res.status, res.headers["grpc-status"])
+    end
+
+    return true
+  end
+
+  -- the endpoints of the HTTPS backends are checked with TLS, their
+  -- certificates are not verified like the ones of the proxied requests
+  local res, err = httpc:request_uri(
+    string_format("%s://%s%s", config.tls and "https" or "http", target, config.path),
+    { method = "GET", ssl_verify = false })
+  if not res then
+    return false, err
+  end
+
+  if res.status < 200 or res.status >= 400 then
+    return false, string_format("status %s", res.status)
+  end
+
+  return true
+end
+
+local function check(premature, key, config, endpoint)
+  if premature then
+    return
+  end
+
+  local ttl = config.interval * STATE_TTL_INTERVALS
+
+  local ok, err = probe(config, endpoint)
+  if ok then
+    health_check_data:delete(key .. "|failures")
+    if health_check_data:get(key .. "|unhealthy") then
+      health_check_data:delete(key .. "|unhealthy")
+      health_check_data:incr(GENERATION_KEY, 1, 0)
+      ngx.log(ngx.NOTICE, "health check of ", key, " succeeded, adding it back to the load balancing")
+    end
+    return
+  end
+
+  ngx.log(ngx.INFO, "health check of ", key, " failed: ", err)
+
+  local failures = health_check_data:incr(key .. "|failures", 1, 0, ttl)
+  if not failures or failures < UNHEALTHY_THRESHOLD then
+    return
+  end
+
+  local unhealthy = health_check_data:get(key .. "|unhealthy")
+  health_check_data:set(key .. "|unhealthy", true, ttl)
+  if not unhealthy then
+    health_check_data:incr(GENERATION_KEY, 1, 0)
+    ngx.log(ngx.WARN, "removing ", key, " from the load balancing after ", failures, " failed health checks")
+  end
+end
+
+local function run(premature)
+  if premature then
+    return
+  end
+
+  for backend_name, target in pairs(targets) do
+    for _, endpoint in ipairs(target.endpoints) do
+      local key = endpoint_key(backend_name, endpoint)
+      -- only one worker checks the endpoint in each interval
+      if health_check_data:add(key .. "|check", true, target.config.interval) then
+        local _, err = ngx.timer.at(0, check, key, target.config, endpoint)
+        if err then
+          ngx.log(ngx.ERR, "failed to create health check timer: ", err)
+        end
+      end
+    end
+  end
+end
+
+-- filter returns the backend without the unhealthy endpoints. All the
+-- endpoints are returned when none of them is healthy to keep the backend
+-- available.
+function _M.filter(backend)
+  local config = backend.healthCheck
+  if not is_enabled(config) or not backend.endpoints or #backend.endpoints == 0 then
+    targets[backend.name] = nil
+    return backend
+  end
+  targets[backend.name] = { config = config, endpoints = backend.endpoints }
+
+  local healthy = {}
+  for _, endpoint in ipairs(backend.endpoints) do
+    if not health_check_data:get(endpoint_key(backend.name, endpoint) .. "|unhealthy") then
+      healthy[#healthy + 1] = endpoint
+    end
+  end
+
+  if #healthy == 0 or #healthy == #backend.endpoints then
+    return backend
+  end
+
+  local filtered = {}
+  for k, v in pairs(backend) do
+    filtered[k] = v
+  end
+  filtered.endpoints = healthy
+
+  return filtered
+end
+
+-- is_unhealthy returns true when the endpoint of the backend failed its
+-- health checks
+function _M.is_unhealthy(backend_name, endpoint)
+  return health_check_data:get(endpoint_key(backend_name, endpoint) .. "|unhealthy") ~= nil
+end
+
+-- remove stops the checks of the endpoints of a backend
+function _M.remove(backend_name)
+  targets[backend_name] = nil
+end
+
+-- has_changed returns true when the backends must be synced again to remove
+-- the unhealthy endpoints or to add them back
+function _M.has_changed()
+  return (health_check_data:get(GENERATION_KEY) or 0) ~= synced_generation
+end
+
+function _M.reset_changed()
+  synced_generation = health_check_data:get(GENERATION_KEY) or 0
+end
+
+function _M.init_worker()
+  local ok, err = ngx.timer.every(RUN_INTERVAL, run)
+  if not ok then
+    ngx.log(ngx.ERR, "error when setting up timer.every for the health checks: ", err)
+  end
+end
+
+if _TEST then
+  _M.check = check
+  _M.grpc_request = grpc_request
+  _M.run = run
+end
+
+return _M
@@ -0,0 +1,176 @@
+-- Limits the requests in flight to each backend across all the workers,
+-- configured with the annotation nginx.ingress.kubernetes.io/max-inflight-requests.
+-- The requests over the limit wait in a bounded queue for a free slot and
+-- are rejected with 503 when the queue is full or the wait times out.
+local ngx = ngx
+local adaptive_concurrency = require("adaptive_concurrency")
+local request_state = require("request_state")
+
+local math_floor = math.floor
+local math_min = math.min
+local ngx_now = ngx.now
+local ngx_sleep = ngx.sleep
+
+local counters = ngx.shared.inflight_requests
+
+local MIN_WAIT = 0.005
+local MAX_WAIT = 0.05
+-- Retry-After of the requests rejected by the adaptive concurrency limit
+-- when max-inflight-requests is not configured
+local DEFAULT_RETRY_AFTER = 1
+-- seconds the counters of a backend are kept after its last request, the
+-- slots of the requests never reaching the log phase, like the ones handled
+-- by a crashed worker, are recovered once the backend is idle
+local COUNTER_TTL = 600
+
+local _M = {}
+
+local function incr(key, value)
+  local count, err, forcible = counters:incr(key, value, 0, COUNTER_TTL)
+  if not count then
+    ngx.log(ngx.WARN, "error updating the in-flight requests of ", key, ": ", err)
+    return nil
+  end
+  if forcible then
+    ngx.log(ngx.WARN, "inflight_requests shared dictionary is full, consider increasing its size")
+  end
+
+  return count
+end
+
+-- try_acquire takes a slot when the backend is under the limit
+local function try_acquire(key, limit)
+  local count = incr(key, 1)
+  if not count then
+    -- do not reject requests when the counters are not available
+    return true, false
+  end
+
+  counters:expire(key, COUNTER_TTL)
+
+  if count >= limit then
+    adaptive_concurrency.saturated(key)
+  end
+
+  if count > limit then
+    incr(key, -1)
+    return false
+  end
+
+  return true, true
+end
+
+local function reject(retry_after)
+  if retry_after > 0 then
+    ngx.header["Retry-After"] = retry_after
+  end
+  return ngx.exit(ngx.HTTP_SERVICE_UNAVAILABLE)
+end
+
+local function wait_in_queue(key, limit, config)
+  local queue_key = "queue|" .. key
+
+  local queued = incr(queue_key, 1)
+  if not queued then
+    return false
+  end
+
+  if queued > config.queue_size then
+    incr(queue_key, -1)
+    return false
+  end
+
+  -- the queue is not ordered, the waiting requests take the slots as soon
+  -- as they are released
+  local deadline = ngx_now() + config.queue_timeout / 1000
+  local wait = MIN_WAIT
+  local acquired, counted = false, false
+
+  while ngx_now() < deadline do
+    ngx_sleep(math_min(wait, deadline - ngx_now()))
+    wait = math_min(wait * 2, MAX_WAIT)
+
+    acquired, counted = try_acquire(key, limit)
+    if acquired then
+      break
+    end
+  end
+
+  incr(queue_key, -1)
+
+  return acquired, counted
+end
+
+-- acquire must be called in the rewrite phase, the slot is released by the
+-- log phase of the request. The limit is the lowest of the max-inflight-requests
+-- and the adaptive concurrency limit.
+function _M.acquire(config, adaptive_config)
+  if request_state.get("inflight") then
+    return
+  end
+
+  local limit = config and config.limit or 0
+  local adaptive = adaptive_concurrency.is_enabled(adaptive_config)
+  if limit == 0 and not adaptive then
+    return
+  end
+
+  local key = ngx.var.proxy_upstream_name
+  if not key or key == "" then
+    return
+  end
+
+  if adaptive then
+    local adaptive_limit = math_floor(adaptive_concurrency.get_limit(key, adaptive_config))
+    if limit == 0 or adaptive_limit < limit then
+      limit = adaptive_limit
+    end
+  end
+
+  local acquired, counted = try_acquire(key, limit)
+  if not acquired and config and config.queue_size > 0 then
+    acquired, counted = wait_in_queue(key, limit, config)
+  end
+
+  if not acquired then
+    ngx.log(ngx.INFO, "too many requests in flight to ", key)
+    local retry_after = DEFAULT_RETRY_AFTER
+    if config and config.limit > 0 then
+      retry_after = config.retry_after
+    end
+    return reject(retry_after)
+  end
+
+  if counted then
+    -- the slot is kept until the log phase across the internal redirects,
+    -- which reset ngx.ctx
+    request_state.set("inflight", {
+      key = key,
+      adaptive_config = adaptive and adaptive_config or nil,
+    })
+  end
+end
+
+function _M.release()
+  local slot = request_state.take("inflight")
+  if not slot then
+    return
+  end
+
+  local count = incr(slot.key, -1)
+  if count and count < 0 then
+    -- the counter expired while the request was in flight
+    incr(slot.key, -count)
+  end
+
+  if slot.adaptive_config then
+    adaptive_concurrency.record(slot.key, slot.adaptive_config)
+  end
+end
+
+-- get returns the number of requests in flight to the backend
+function _M.get(key)
+  return counters:get(key) or 0
+end
+
+return _M
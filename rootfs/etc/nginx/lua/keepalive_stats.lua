@@ -0,0 +1,169 @@
+-- Keeps track, per backend, of the requests in flight and of the number of
+-- upstream connections reused from the keepalive pool or newly established,
+-- to help right-sizing the upstream keepalive settings.
+local ngx = ngx
+local cjson = require("cjson.safe")
+local request_state = require("request_state")
+
+local ipairs = ipairs
+local pairs = pairs
+local tonumber = tonumber
+local string_gmatch = string.gmatch
+local string_match = string.match
+
+local stats = ngx.shared.upstream_keepalive_stats
+
+local ACTIVE = "active"
+local REUSED = "reused"
+local NEW = "new"
+
+local _M = {}
+
+local config = { enabled = false, keepalive_connections = 0 }
+
+local function key(backend, name)
+  return name .. "|" .. backend
+end
+
+local function incr(backend, name, value)
+  local _, err, forcible = stats:incr(key(backend, name), value, 0)
+  if err then
+    ngx.log(ngx.WARN, "error updating keepalive stats of ", backend, ": ", err)
+  elseif forcible then
+    ngx.log(ngx.WARN, "upstream_keepalive_stats shared dictionary is full, consider increasing its size")
+  end
+end
+
+function _M.set_config(new_config)
+  config = {
+    enabled = new_config.enable_metrics == true,
+    keepalive_connections = new_config.upstream_keepalive_connections or 0,
+  }
+end
+
+function _M.is_enabled()
+  return config.enabled and stats ~= nil
+end
+
+-- start is called by the balancer for every try, only the first one of a
+-- location is accounted so retries do not count as additional requests in
+-- flight. The backends are kept until the log phase across the internal
+-- redirects, like the error pages proxied to the default backend.
+function _M.start(backend)
+  if not _M.is_enabled() or ngx.ctx.keepalive_stats_started then
+    return
+  end
+
+  ngx.ctx.keepalive_stats_started = true
+
+  local backends = request_state.get("keepalive_stats")
+  if not backends then
+    backends = {}
+    request_state.set("keepalive_stats", backends)
+  end
+  backends[#backends + 1] = backend
+
+  incr(backend, ACTIVE, 1)
+end
+
+local function count_connections(backend, connect_times)
+  local reused, new = 0, 0
+  -- multiple tries are separated by commas
+  for connect_time in string_gmatch(connect_times, "[^%s,]+") do
+    local seconds = tonumber(connect_time)
+    if seconds == 0 then
+      reused = reused + 1
+    elseif seconds then
+      new = new + 1
+    end
+  end
+
+  if reused > 0 then
+    incr(backend, REUSED, reused)
+  end
+  if new > 0 then
+    incr(backend, NEW, new)
+  end
+end
+
+-- finish must be called in the log phase. nginx does not tell whether the
+-- upstream connection came from the keepalive pool, a connection is
+-- considered reused when no time was spent establishing it.
+function _M.finish()
+  local backends = request_state.take("keepalive_stats")
+  if not backends then
+    return
+  end
+
+  for _, backend in ipairs(backends) do
+    incr(backend, ACTIVE, -1)
+  end
+
+  local connect_times = ngx.var.upstream_connect_time
+  if not connect_times then
+    return
+  end
+
+  -- the tries of every location the request was redirected to are separated
+  -- by colons, the last ones belong to the last backend
+  local groups = {}
+  for group in string_gmatch(connect_times, "[^:]+") do
+    groups[#groups + 1] = group
+  end
+
+  local offset = #groups - #backends
+  for i, backend in ipairs(backends) do
+    local group = groups[offset + i]
+    if group then
+      count_connections(backend, group)
+    end
+  end
+end
+
+-- get returns the statistics of all the backends and the configured size
+-- of the keepalive pool of each worker.
+function _M.get()
+  local backends = {}
+
+  for _, k in pairs(stats:get_keys(0)) do
+    local name, backend = string_match(k, "^(%a+)|(.+)$")
+    if name then
+      local backend_stats = backends[backend]
+      if not backend_stats then
+        backend_stats = { active = 0, reused = 0, new = 0 }
+        backends[backend] = backend_stats
+      end
+
+      local value = stats:get(k)
+      if value then
+        backend_stats[name] = value
+      end
+    end
+  end
+
+  return {
+    keepalive_connections = config.keepalive_connections,
+    workers = ngx.worker.count(),
+    backends = backends,
+  }
+end
+
+function _M.call()
+  if not _M.is_enabled() then
+    ngx.status = ngx.HTTP_NOT_FOUND
+    ngx.print("keepalive statistics are disabled")
+    return
+  end
+
+  local data, err = cjson.encode(_M.get())
+  if not data then
+    ngx.log(ngx.ERR, "error encoding keepalive stats: ", err)
+    ngx.status = ngx.HTTP_INTERNAL_SERVER_ERROR
+    return
+  end
+
+  ngx.status = ngx.HTTP_OK
+  ngx.print(data)
+end
+
+return _M
@@ -3,9 +3,25 @@ local ngx_re_split = require("ngx.re").split
 local certificate_configured_for_current_request =
   require("certificate").configured_for_current_request
 local global_throttle = require("global_throttle")
+local bot_detection = require("bot_detection")
+local time_windows = require("time_windows")
+local inflight = require("inflight")
+local connection_limit = require("connection_limit")
+local websocket_limit = require("websocket_limit")
+local upload_rate = require("upload_rate")
+local backend_bandwidth = require("backend_bandwidth")
+local max_request_duration = require("max_request_duration")
+local auth_jwt = require("auth_jwt")
+local rate_limit_exemption = require("rate_limit_exemption")
+local route_if = require("route_if")
+local strict_parsing = require("strict_parsing")
+local tenant = require("tenant")
+local monitor = require("monitor")
+local error_response = require("error_response")
 
 local ngx = ngx
 local io = io
+local tonumber = tonumber
 local math = math
 local string = string
 local original_randomseed = math.randomseed
@@ -14,6 +30,10 @@ local ngx_redirect = ngx.redirect
 
 local _M = {}
 
+-- matches encoded slashes and dots, double encoding and dot segments
+-- in the path of the original request
+local SUSPICIOUS_PATH_REGEX = [[^[^?]*(%2f|%5c|%2e|%25[0-9a-f]{2}|/\.\.?(/|\?|$))]]
+
 local seeds = {}
 -- general Nginx configuration passed by controller to be used in this module
 local config
@@ -62,6 +82,28 @@ local function randomseed()
   math.randomseed(seed)
 end
 
+local function has_suspicious_path()
+  local from, _, err = ngx.re.find(ngx.var.request_uri, SUSPICIOUS_PATH_REGEX, "ijo")
+  if err then
+    ngx.log(ngx.ERR, "failed to match request uri: ", err)
+    return false
+  end
+
+  return from ~= nil
+end
+
+-- has_too_many_headers returns true when the request has more headers than
+-- the limit of the annotation max-header-count of the server
+local function has_too_many_headers()
+  local max_header_count = tonumber(ngx.var.max_header_count)
+  if not max_header_count then
+    return false
+  end
+
+  local _, err = ngx.req.get_headers(max_header_count)
+  return err == "truncated"
+end
+
 local function redirect_to_https(location_config)
   if location_config.force_no_ssl_redirect then
     return false
@@ -104,12 +146,33 @@ end
 
 function _M.set_config(new_config)
   config = new_config
+  tenant.set_config(config.tenant)
 end
 
 -- rewrite gets called in every location context.
 -- This is where we do variable assignments to be used in subsequent
 -- phases or redirection
 function _M.rewrite(location_config)
+  if config.strict_request_parsing then
+    local reason = strict_parsing.check()
+    if reason then
+      ngx.log(ngx.INFO, "request rejected by the strict request parsing: ", reason)
+      if config.enable_metrics then
+        monitor.record_rejection(reason)
+      end
+      return ngx.exit(ngx.HTTP_BAD_REQUEST)
+    end
+  end
+
+  if has_too_many_headers() then
+    ngx.log(ngx.INFO, "request rejected, it has more than ", ngx.var.max_header_count, " headers")
+    ngx.status = 431
+    error_response.render(431)
+    return ngx.exit(431)
+  end
+
+  tenant.rewrite(config.tenant)
+
   ngx.var.pass_access_scheme = ngx.var.scheme
 
   ngx.var.best_http_host = ngx.var.http_host or ngx.var.host
@@ -138,13 +201,21 @@ function _M.rewrite(location_config)
 
   ngx.var.pass_port = ngx.var.pass_server_port
   if config.is_ssl_passthrough_enabled then
-    if ngx.var.pass_server_port == config.listen_ports.ssl_proxy then
+    if ngx.var.pass_server_port == config.listen_ports.ssl_proxy or
+        ngx.var.pass_server_port == config.listen_ports.http1_ssl_proxy then
       ngx.var.pass_port = 443
     end
   elseif ngx.var.pass_server_port == config.listen_ports.https then
     ngx.var.pass_port = 443
   end
 
+  if location_config.uri_normalization_policy == "reject" and has_suspicious_path() then
+    return ngx.exit(ngx.HTTP_BAD_REQUEST)
+  elseif location_config.uri_normalization_policy == "normalize" then
+    -- send the normalized $uri to the upstream instead of the original request uri
+    ngx.req.set_uri(ngx.var.uri)
+  end
+
   if redirect_to_https(location_config) then
     local request_uri = ngx.var.request_uri
     -- do not append a trailing slash on redirects
@@ -162,7 +233,31 @@ function _M.rewrite(location_config)
     return ngx_redirect(uri, config.http_redirect_code)
   end
 
-  global_throttle.throttle(config.global_throttle, location_config.global_throttle)
+  time_windows.rewrite()
+
+  if location_config.bot_detection then
+    bot_detection.rewrite()
+  end
+
+  if not rate_limit_exemption.rewrite(location_config.rate_limit_exemption, location_config.auth_jwt) then
+    global_throttle.throttle(config.global_throttle, location_config.global_throttle)
+  end
+
+  upload_rate.throttle(location_config.limit_upload_rate)
+
+  backend_bandwidth.rewrite(location_config.backend_bandwidth)
+
+  max_request_duration.rewrite(location_config.max_request_duration)
+
+  auth_jwt.rewrite(location_config.auth_jwt)
+
+  route_if.rewrite(location_config.route_if)
+
+  connection_limit.acquire(location_config.connection_limit)
+
+  websocket_limit.acquire(location_config.websocket_limit)
+
+  inflight.acquire(location_config.max_inflight, location_config.adaptive_concurrency)
 end
 
 function _M.header()
@@ -178,4 +273,11 @@ function _M.header()
   end
 end
 
+-- body_filter returns ngx.ERROR when the response has to be aborted
+function _M.body_filter()
+  backend_bandwidth.body_filter()
+
+  return max_request_duration.body_filter()
+end
+
 return _M
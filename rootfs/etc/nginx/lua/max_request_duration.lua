@@ -0,0 +1,103 @@
+-- Enforces a hard limit on the duration of the requests of the locations with
+-- the annotation nginx.ingress.kubernetes.io/max-request-duration, from the
+-- reception of the request to the end of the response. The proxy timeouts
+-- of NGINX restart on every read and write, so the timeouts of each attempt
+-- to the upstream are reduced to the time left before the deadline, and a
+-- response still streamed at the deadline is aborted.
+local ngx = ngx
+local ngx_balancer = require("ngx.balancer")
+local math_min = math.min
+
+-- the balancer does not accept null timeouts
+local MIN_TIMEOUT = 0.001
+
+local _M = {}
+
+-- remaining returns the time left before the deadline of the request, in
+-- seconds, or nil when its duration is not limited
+local function remaining()
+  local config = ngx.ctx.max_request_duration
+  if not config then
+    return nil
+  end
+
+  return config.deadline - ngx.now()
+end
+
+local function timeout(configured, left)
+  if configured and configured > 0 then
+    return math_min(configured, left)
+  end
+  return left
+end
+
+-- rewrite starts the enforcement of the limit and rejects the request when
+-- the reception of its body already exceeded it
+function _M.rewrite(config)
+  if not config or not config.duration or config.duration <= 0 then
+    return
+  end
+
+  ngx.ctx.max_request_duration = {
+    deadline = ngx.req.start_time() + config.duration,
+    connect_timeout = config.connect_timeout,
+    send_timeout = config.send_timeout,
+    read_timeout = config.read_timeout,
+  }
+
+  if remaining() <= 0 then
+    ngx.ctx.max_request_duration_exceeded = true
+    ngx.log(ngx.INFO, "request rejected, it exceeded its max duration of ", config.duration, "s")
+    return ngx.exit(ngx.HTTP_GATEWAY_TIMEOUT)
+  end
+end
+
+-- balance reduces the timeouts of the current attempt to the upstream to
+-- the time left before the deadline, NGINX replies with 504 when they expire
+function _M.balance()
+  local left = remaining()
+  if not left then
+    return
+  end
+
+  if left < MIN_TIMEOUT then
+    left = MIN_TIMEOUT
+  end
+
+  local config = ngx.ctx.max_request_duration
+  local ok, err = ngx_balancer.set_timeouts(timeout(config.connect_timeout, left),
+    timeout(config.send_timeout, left), timeout(config.read_timeout, left))
+  if not ok then
+    ngx.log(ngx.ERR, "error while setting the timeouts of the max request duration: ", err)
+  end
+end
+
+-- body_filter returns ngx.ERROR, to abort the response, when the request
+-- exceeded its deadline
+function _M.body_filter()
+  local left = remaining()
+  if not left or left > 0 then
+    return nil
+  end
+
+  if not ngx.ctx.max_request_duration_exceeded then
+    ngx.ctx.max_request_duration_exceeded = true
+    ngx.log(ngx.INFO, "response aborted, the request exceeded its max duration")
+  end
+
+  return ngx.ERROR
+end
+
+-- exceeded returns true if the request was terminated by the limit, must be
+-- called in the log phase
+function _M.exceeded()
+  if ngx.ctx.max_request_duration_exceeded then
+    return true
+  end
+
+  -- the timeouts of the upstream expired at the deadline
+  local left = remaining()
+  return left ~= nil and left <= MIN_TIMEOUT and ngx.var.status == "504"
+end
+
+return _M
@@ -8,6 +8,8 @@ local cjson = require("cjson.safe")
 local new_tab = require "table.new"
 local clear_tab = require "table.clear"
 local clone_tab = require "table.clone"
+local max_request_duration = require("max_request_duration")
+local tenant = require("tenant")
 
 
 -- if an Nginx worker processes more than (MAX_BATCH_SIZE/FLUSH_INTERVAL) RPS
@@ -27,6 +29,28 @@ local function send(payload)
   assert(s:close())
 end
 
+-- upgrade returns the protocol carried by the request: websocket for the
+-- upgraded connections, grpc or grpc-web for the gRPC streams
+local function upgrade()
+  if ngx.var.status == "101" and string.lower(ngx.var.http_upgrade or "") == "websocket" then
+    return "websocket"
+  end
+
+  local content_type = ngx.var.content_type
+  if not content_type then
+    return nil
+  end
+
+  if string.find(content_type, "application/grpc-web", 1, true) == 1 then
+    return "grpc-web"
+  end
+  if string.find(content_type, "application/grpc", 1, true) == 1 then
+    return "grpc"
+  end
+
+  return nil
+end
+
 local function metrics()
   return {
     host = ngx.var.host or "-",
@@ -34,6 +58,11 @@ local function metrics()
     ingress = ngx.var.ingress_name or "-",
     service = ngx.var.service_name or "-",
     path = ngx.var.location_path or "-",
+    tenant = tenant.metric_label(ngx.var.tenant_id),
+    canaryUpstream = ngx.ctx.canary_upstream_name,
+    protocol = ngx.var.server_protocol,
+    upgrade = upgrade(),
+    maxRequestDurationExceeded = max_request_duration.exceeded() or nil,
 
     method = ngx.var.request_method or "-",
     status = ngx.var.status or "-",
@@ -94,6 +123,85 @@ function _M.call()
   metrics_batch[metrics_count] = metrics()
 end
 
+-- record_rejection adds the rejection of the current request by the
+-- strict request parsing to the batch
+function _M.record_rejection(reason)
+  if metrics_count >= MAX_BATCH_SIZE then
+    ngx.log(ngx.WARN, "omitting rejection metric for the request, current batch is full")
+    return
+  end
+
+  metrics_count = metrics_count + 1
+  metrics_batch[metrics_count] = {
+    host = ngx.var.host or "-",
+    namespace = ngx.var.namespace or "-",
+    ingress = ngx.var.ingress_name or "-",
+    service = ngx.var.service_name or "-",
+    path = ngx.var.location_path or "-",
+    method = ngx.var.request_method or "-",
+    rejection = reason,
+  }
+end
+
+-- record_global_rate_limit_error adds the error of the global rate limit
+-- store seen by the current request to the batch
+function _M.record_global_rate_limit_error(policy)
+  if metrics_count >= MAX_BATCH_SIZE then
+    ngx.log(ngx.WARN, "omitting global rate limit error metric for the request, current batch is full")
+    return
+  end
+
+  metrics_count = metrics_count + 1
+  metrics_batch[metrics_count] = {
+    host = ngx.var.host or "-",
+    namespace = ngx.var.namespace or "-",
+    ingress = ngx.var.ingress_name or "-",
+    service = ngx.var.service_name or "-",
+    path = ngx.var.location_path or "-",
+    method = ngx.var.request_method or "-",
+    globalRateLimitError = policy or "allow",
+  }
+end
+
+-- record_rate_limit adds the decision of the global rate limit for the
+-- current request to the batch, "allow" or "deny", with the namespace of
+-- its counters and the time the request was delayed, in seconds
+function _M.record_rate_limit(decision, rate_limit_namespace, delay)
+  if metrics_count >= MAX_BATCH_SIZE then
+    ngx.log(ngx.WARN, "omitting rate limit metric for the request, current batch is full")
+    return
+  end
+
+  metrics_count = metrics_count + 1
+  metrics_batch[metrics_count] = {
+    host = ngx.var.host or "-",
+    namespace = ngx.var.namespace or "-",
+    ingress = ngx.var.ingress_name or "-",
+    service = ngx.var.service_name or "-",
+    path = ngx.var.location_path or "-",
+    method = ngx.var.request_method or "-",
+    rateLimitDecision = decision,
+    rateLimitNamespace = rate_limit_namespace,
+    rateLimitDelay = delay or 0,
+  }
+end
+
+-- record_protocol_mismatch adds a failure of the protocol negotiation with
+-- an upstream of the backend to the batch, it is not tied to a request
+function _M.record_protocol_mismatch(backend, scheme, reason)
+  if metrics_count >= MAX_BATCH_SIZE then
+    ngx.log(ngx.WARN, "omitting protocol mismatch metric, current batch is full")
+    return
+  end
+
+  metrics_count = metrics_count + 1
+  metrics_batch[metrics_count] = {
+    protocolMismatch = reason,
+    upstream = backend,
+    upstreamScheme = scheme,
+  }
+end
+
 setmetatable(_M, {__index = {
   flush = flush,
   set_metrics_max_batch_size = set_metrics_max_batch_size,
@@ -1,5 +1,7 @@
 local require = require
 local ngx = ngx
+local cjson = require("cjson.safe")
+local configuration = require("configuration")
 local pairs = pairs
 local ipairs = ipairs
 local string_format = string.format
@@ -12,7 +14,35 @@ local _M = {}
 local MAX_NUMBER_OF_PLUGINS = 20
 local plugins = {}
 
-local function load_plugin(name)
+-- flags of the plugin-flags annotation decoded by this worker, by namespace
+-- and name of the Ingress, and the version of the configuration
+local EMPTY_FLAGS = {}
+local flags_by_ingress = {}
+local flags_version
+
+local function sync_flags()
+  local data, version = configuration.get_plugin_flags_data()
+  if version == flags_version then
+    return
+  end
+
+  flags_version = version
+
+  if not data then
+    flags_by_ingress = {}
+    return
+  end
+
+  local new_flags, err = cjson.decode(data)
+  if not new_flags then
+    ngx_log(ERR, "could not parse plugin flags: ", err)
+    return
+  end
+
+  flags_by_ingress = new_flags
+end
+
+local function load_plugin(name, config)
   local path = string_format("plugins.%s.main", name)
 
   local ok, plugin = pcall(require, path)
@@ -21,17 +51,25 @@ local function load_plugin(name)
     return
   end
 
+  if plugin.set_config then
+    plugin.set_config(config)
+  end
+
   plugins[name] = plugin
 end
 
-function _M.init(names)
+-- init loads the plugins of the names, passing to their set_config function
+-- the configuration of the same name in configs
+function _M.init(names, configs)
+  configs = configs or {}
+
   local count = 0
   for _, name in ipairs(names) do
     if count >= MAX_NUMBER_OF_PLUGINS then
       ngx_log(ERR, "the total number of plugins exceed the maximum number: ", MAX_NUMBER_OF_PLUGINS)
       break
     end
-    load_plugin(name)
+    load_plugin(name, configs[name])
     count = count + 1 -- ignore loading failure, just count the total
   end
 end
@@ -56,4 +94,14 @@ function _M.run()
   end
 end
 
+-- flags returns the flags of the plugin-flags annotation of the Ingress of
+-- the current request, by name. Flags without value are "true". The table
+-- is shared by the requests and must not be modified.
+function _M.flags()
+  sync_flags()
+
+  local ingress = (ngx.var.namespace or "") .. "/" .. (ngx.var.ingress_name or "")
+  return flags_by_ingress[ingress] or EMPTY_FLAGS
+end
+
 return _M
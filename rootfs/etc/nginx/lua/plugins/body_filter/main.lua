@@ -0,0 +1,300 @@
+-- Transforms the response bodies of the locations configured with the
+-- annotation nginx.ingress.kubernetes.io/body-filter-snippet. The body is
+-- buffered until the last chunk and the snippet, delivered with the dynamic
+-- configuration and referenced by the locations by checksum, is run on it in
+-- the sandbox exposing only the globals of the allowlist of the ConfigMap.
+-- The snippet reads the body from the global variable body and the value of
+-- the variable after its execution is sent to the client.
+local ngx = ngx
+local cjson = require("cjson.safe")
+local lrucache = require("resty.lrucache")
+local configuration = require("configuration")
+local sandbox = require("sandbox")
+
+local setfenv = setfenv
+local pairs = pairs
+local ipairs = ipairs
+local type = type
+local tostring = tostring
+local string_gmatch = string.gmatch
+local string_gsub = string.gsub
+local string_lower = string.lower
+local string_match = string.match
+local table_concat = table.concat
+local table_insert = table.insert
+local ngx_log = ngx.log
+local ngx_INFO = ngx.INFO
+local ngx_WARN = ngx.WARN
+local ngx_ERR = ngx.ERR
+local ngx_NOTICE = ngx.NOTICE
+
+local CACHE_SIZE = 64
+
+local DEFAULT_CONFIG = {
+  allowlist = {
+    "assert", "error", "ipairs", "next", "pairs", "select", "tonumber",
+    "tostring", "type", "unpack", "string", "table", "math", "cjson",
+  },
+  max_instructions = 1000000,
+  -- in kilobytes
+  max_memory = 4096,
+  -- in bytes
+  max_body_size = 1048576,
+}
+
+local _M = {}
+
+local config
+-- globals of the allowlist, copied for each execution
+local globals
+
+-- functions of the string library the snippets can call, the others run in
+-- C without being interrupted by the limits of the sandbox
+local sandbox_string = {}
+for _, name in ipairs(sandbox.STRING) do
+  sandbox_string[name] = true
+end
+
+-- snippets delivered with the dynamic configuration by checksum and the
+-- version of the configuration
+local snippets = {}
+local snippets_version
+
+-- compiled snippets of the worker by checksum, or the compilation error
+local chunks, cache_err = lrucache.new(CACHE_SIZE)
+if not chunks then
+  error("failed to create the cache: " .. (cache_err or "unknown"))
+end
+
+local function sync_snippets()
+  local data, version = configuration.get_body_filter_snippets_data()
+  if version == snippets_version then
+    return
+  end
+
+  snippets_version = version
+  chunks:flush_all()
+
+  if not data then
+    snippets = {}
+    return
+  end
+
+  local new_snippets, err = cjson.decode(data)
+  if not new_snippets then
+    ngx_log(ngx_ERR, "could not parse the body filter snippets: ", err)
+    return
+  end
+
+  snippets = new_snippets
+end
+
+-- lookup returns the value of a global name like string or string.format
+local function lookup(name)
+  if name == "cjson" then
+    return { encode = cjson.encode, decode = cjson.decode, null = cjson.null }
+  end
+
+  if name == "string" then
+    local t = {}
+    for field in pairs(sandbox_string) do
+      t[field] = string[field]
+    end
+    return t
+  end
+
+  local field = string_match(name, "^string%.(.+)$")
+  if field and not sandbox_string[field] then
+    return nil
+  end
+
+  local value = _G
+  for part in string_gmatch(name, "[^.]+") do
+    if type(value) ~= "table" then
+      return nil
+    end
+    value = value[part]
+  end
+
+  return value
+end
+
+local function build_globals(allowlist)
+  local t = {}
+
+  for _, name in ipairs(allowlist) do
+    local value = lookup(name)
+    if value == nil then
+      ngx_log(ngx_WARN, "body filter: ignoring unknown or unsafe global ", name)
+    else
+      local module, field = string_match(name, "^([^.]+)%.(.+)$")
+      if module then
+        t[module] = t[module] or {}
+        t[module][field] = value
+      elseif type(value) == "table" then
+        local copy = {}
+        for k, v in pairs(value) do
+          copy[k] = v
+        end
+        t[name] = copy
+      else
+        t[name] = value
+      end
+    end
+  end
+
+  return t
+end
+
+function _M.set_config(new_config)
+  config = new_config or DEFAULT_CONFIG
+  globals = build_globals(config.allowlist or DEFAULT_CONFIG.allowlist)
+end
+
+local get_header = sandbox.unsandboxed(function(name)
+  return ngx.var["http_" .. string_gsub(string_lower(tostring(name)), "-", "_")]
+end)
+
+local get_response_header = sandbox.unsandboxed(function(name)
+  return ngx.header[tostring(name)]
+end)
+
+local log = sandbox.unsandboxed(function(...)
+  ngx_log(ngx_NOTICE, "body filter: ", ...)
+end)
+
+-- new_env returns the globals of an execution. A new table is used for each
+-- response so the snippets cannot keep state between responses.
+local function new_env(body)
+  local env = {}
+
+  for name, value in pairs(globals) do
+    if type(value) == "table" then
+      local copy = {}
+      for k, v in pairs(value) do
+        copy[k] = v
+      end
+      env[name] = copy
+    else
+      env[name] = value
+    end
+  end
+
+  env.body = body
+  env.status = ngx.status
+  env.get_header = get_header
+  env.get_response_header = get_response_header
+  env.log = log
+
+  return env
+end
+
+local function compile(checksum)
+  local chunk = chunks:get(checksum)
+  if chunk then
+    return chunk
+  end
+
+  local fn, err = sandbox.compile(snippets[checksum], "body_filter_snippet")
+  if not fn then
+    chunk = { err = err }
+  else
+    chunk = { fn = fn }
+  end
+
+  chunks:set(checksum, chunk)
+  return chunk
+end
+
+-- run executes the snippet with the body, stopping it when it exceeds the
+-- limits, and returns the new body
+local function run(checksum, body)
+  local chunk = compile(checksum)
+  if chunk.err then
+    return nil, chunk.err
+  end
+
+  local env = new_env(body)
+  setfenv(chunk.fn, env)
+
+  local ok, err = sandbox.run(config, chunk.fn)
+  if not ok then
+    return nil, err
+  end
+
+  if env.body == nil then
+    return ""
+  end
+
+  return tostring(env.body)
+end
+
+function _M.header_filter()
+  local checksum = ngx.var.body_filter_snippet
+  if not checksum or checksum == "" then
+    return
+  end
+
+  if ngx.req.get_method() == "HEAD" then
+    return
+  end
+
+  sync_snippets()
+  if not snippets[checksum] then
+    ngx_log(ngx_ERR, "body filter snippet ", checksum, " not found")
+    return
+  end
+
+  -- the snippets work on the decoded bodies only
+  if ngx.header["Content-Encoding"] then
+    ngx_log(ngx_INFO, "body filter: skipping the encoded response")
+    return
+  end
+
+  -- the length changes with the body
+  ngx.header["Content-Length"] = nil
+
+  ngx.ctx.body_filter = { snippet = checksum, chunks = {}, size = 0 }
+end
+
+function _M.body_filter()
+  local ctx = ngx.ctx.body_filter
+  if not ctx or ctx.skip then
+    return
+  end
+
+  local chunk, eof = ngx.arg[1], ngx.arg[2]
+
+  table_insert(ctx.chunks, chunk)
+  ctx.size = ctx.size + #chunk
+
+  if ctx.size > config.max_body_size then
+    ngx_log(ngx_WARN, "body filter: the body is larger than ", config.max_body_size,
+      " bytes, sending it unchanged")
+    ctx.skip = true
+    ngx.arg[1] = table_concat(ctx.chunks)
+    ctx.chunks = nil
+    return
+  end
+
+  if not eof then
+    ngx.arg[1] = ""
+    return
+  end
+
+  local body = table_concat(ctx.chunks)
+  ctx.chunks = nil
+
+  local new_body, err = run(ctx.snippet, body)
+  if not new_body then
+    ngx_log(ngx_ERR, "body filter snippet failed: ", err)
+    ngx.arg[1] = body
+    return
+  end
+
+  ngx.arg[1] = new_body
+end
+
+_M.set_config()
+
+return _M
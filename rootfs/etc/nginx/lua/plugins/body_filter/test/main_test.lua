@@ -0,0 +1,142 @@
+local cjson = require("cjson")
+
+local snippets_version = 0
+
+local function response(snippet, chunks)
+  snippets_version = snippets_version + 1
+  local configuration = require("configuration")
+  stub(configuration, "get_body_filter_snippets_data", function()
+    return cjson.encode({ checksum = snippet }), snippets_version
+  end)
+
+  ngx.var = {
+    body_filter_snippet = "checksum",
+    http_x_request_id = "abc",
+  }
+  ngx.status = 200
+  ngx.header = { ["Content-Length"] = "100", ["Content-Type"] = "application/json" }
+  ngx.ctx = {}
+
+  stub(ngx.req, "get_method", function() return "GET" end)
+
+  return chunks
+end
+
+describe("body_filter", function()
+  local main
+  local header
+  local arg
+
+  local function filter(chunks)
+    local sent = {}
+    for i, chunk in ipairs(chunks) do
+      ngx.arg = { chunk, i == #chunks }
+      main.body_filter()
+      table.insert(sent, ngx.arg[1])
+    end
+    return table.concat(sent)
+  end
+
+  before_each(function()
+    main = require_without_cache("plugins.body_filter.main")
+    main.set_config({
+      allowlist = { "pairs", "string", "string.gsub", "cjson" },
+      max_instructions = 100000,
+      max_memory = 1024,
+      max_body_size = 1024,
+    })
+    stub(ngx, "log")
+    header = ngx.header
+    arg = ngx.arg
+  end)
+
+  after_each(function()
+    ngx.header = header
+    ngx.arg = arg
+    ngx.status = nil
+  end)
+
+  it("does nothing in locations without snippet", function()
+    ngx.var = {}
+    ngx.ctx = {}
+    main.header_filter()
+    assert.is_nil(ngx.ctx.body_filter)
+  end)
+
+  it("transforms the body", function()
+    local chunks = response([[
+      local data = cjson.decode(body)
+      data.password = nil
+      data.request_id = get_header("X-Request-ID")
+      body = cjson.encode(data)
+    ]], { '{"user":', '"joe","password":"secret"}' })
+
+    main.header_filter()
+    assert.is_nil(ngx.header["Content-Length"])
+
+    local body = filter(chunks)
+    assert.are.same({ user = "joe", request_id = "abc" }, cjson.decode(body))
+  end)
+
+  it("runs the snippets larger than the parameters of the NGINX directives", function()
+    local chunks = response('body = "' .. string.rep("b", 8192) .. '"', { "a" })
+
+    main.header_filter()
+
+    assert.are.equal(string.rep("b", 8192), filter(chunks))
+  end)
+
+  it("sends the body unchanged when the snippet is not found", function()
+    local chunks = response('body = "changed"', { "unchanged" })
+    ngx.var.body_filter_snippet = "other"
+
+    main.header_filter()
+
+    assert.is_nil(ngx.ctx.body_filter)
+    assert.are.equal("100", ngx.header["Content-Length"])
+    assert.are.equal("unchanged", filter(chunks))
+  end)
+
+  it("exposes only the globals of the allowlist", function()
+    local chunks = response([[
+      if ngx or io or os or require or debug or setfenv or load then
+        body = "escaped"
+      elseif string.rep or string.gsub or string.find or body.gsub then
+        body = "unsafe"
+      else
+        body = string.upper(body) .. body:sub(1, 1)
+      end
+    ]], { "aaa" })
+
+    main.header_filter()
+
+    assert.are.equal("AAAa", filter(chunks))
+  end)
+
+  it("sends the body unchanged when the snippet fails", function()
+    local chunks = response("while true do end", { "first", "second" })
+
+    main.header_filter()
+
+    assert.are.equal("firstsecond", filter(chunks))
+    assert.stub(ngx.log).was_called_with(ngx.ERR, "body filter snippet failed: ", "instruction limit exceeded")
+  end)
+
+  it("sends the bodies larger than the limit unchanged", function()
+    local chunks = response('body = "changed"', { string.rep("a", 1000), string.rep("b", 1000), "c" })
+
+    main.header_filter()
+
+    assert.are.equal(string.rep("a", 1000) .. string.rep("b", 1000) .. "c", filter(chunks))
+  end)
+
+  it("skips the encoded responses", function()
+    response('body = "changed"', { "gzip" })
+    ngx.header["Content-Encoding"] = "gzip"
+
+    main.header_filter()
+
+    assert.is_nil(ngx.ctx.body_filter)
+    assert.are.equal("100", ngx.header["Content-Length"])
+  end)
+end)
@@ -0,0 +1,277 @@
+-- Deduplicates the requests of the locations configured with the annotation
+-- nginx.ingress.kubernetes.io/idempotency by their idempotency key, so the
+-- retries of the clients are not processed twice by the backend. The response
+-- of the first completed request of a key is stored in a shared dictionary
+-- and replayed to the duplicates until it expires. A duplicate received while
+-- the first request is in flight is rejected with 409, and a key reused for
+-- another method, URI or body with 422. The 5xx responses are not stored, so
+-- the requests that failed can be retried.
+--
+-- The keys are scoped by the credential of the client, the Authorization
+-- header, the cookies or the client address, so a client cannot receive the
+-- responses of another one by reusing its key.
+local ngx = ngx
+local cjson = require("cjson.safe")
+local resty_sha256 = require("resty.sha256")
+local resty_str = require("resty.string")
+
+local io = io
+local pairs = pairs
+local type = type
+local tonumber = tonumber
+local table_concat = table.concat
+local table_insert = table.insert
+local string_lower = string.lower
+local ngx_log = ngx.log
+local ngx_INFO = ngx.INFO
+local ngx_WARN = ngx.WARN
+
+local responses = ngx.shared.idempotency_responses
+
+local DEFAULT_CONFIG = {
+  -- in bytes, the larger responses are not replayed
+  max_body_size = 1048576,
+  -- in seconds, time the key of a request in flight is reserved
+  lock_timeout = 60,
+}
+
+-- size of the chunks of the request bodies buffered to a file hashed at once
+local BODY_CHUNK_SIZE = 65536
+
+-- the methods of the requests deduplicated, the other ones are idempotent
+local METHODS = { POST = true, PATCH = true }
+
+-- headers of the responses not replayed
+local SKIPPED_HEADERS = {
+  ["connection"] = true,
+  ["content-length"] = true,
+  ["transfer-encoding"] = true,
+  ["keep-alive"] = true,
+  ["set-cookie"] = true,
+}
+
+local _M = {}
+
+local config
+
+function _M.set_config(new_config)
+  config = new_config or DEFAULT_CONFIG
+end
+
+-- credential returns the hash of the credential of the client, the
+-- Authorization header, the cookies or the client address
+local function credential()
+  local value = ngx.var.http_authorization
+  if not value or value == "" then
+    value = ngx.var.http_cookie
+  end
+  if not value or value == "" then
+    value = ngx.var.remote_addr or ""
+  end
+
+  local sha256 = resty_sha256:new()
+  sha256:update(value)
+  return resty_str.to_hex(sha256:final())
+end
+
+-- update_body adds the body of the request to the hash, the bodies larger
+-- than client_body_buffer_size are read from their file
+local function update_body(sha256)
+  ngx.req.read_body()
+
+  local body = ngx.req.get_body_data()
+  if body then
+    sha256:update(body)
+    return true
+  end
+
+  local file_name = ngx.req.get_body_file()
+  if not file_name then
+    return true
+  end
+
+  local file, err = io.open(file_name, "rb")
+  if not file then
+    ngx_log(ngx_WARN, "error reading the request body: ", err)
+    return false
+  end
+
+  while true do
+    local chunk = file:read(BODY_CHUNK_SIZE)
+    if not chunk then
+      break
+    end
+    sha256:update(chunk)
+  end
+  file:close()
+
+  return true
+end
+
+-- fingerprint identifies the request of a key, its method, URI and body, a
+-- key is not valid for other requests
+local function fingerprint()
+  local sha256 = resty_sha256:new()
+  sha256:update(ngx.req.get_method() .. " " .. (ngx.var.request_uri or "") .. "\n")
+  if not update_body(sha256) then
+    return nil
+  end
+
+  return resty_str.to_hex(sha256:final())
+end
+
+local function replay(response)
+  ngx.status = response.status
+  for name, value in pairs(response.headers) do
+    ngx.header[name] = value
+  end
+  ngx.header["Idempotent-Replayed"] = "true"
+
+  ngx.print(response.body)
+  return ngx.exit(response.status)
+end
+
+local function check(entry, request)
+  local stored = cjson.decode(entry)
+  if not stored then
+    return
+  end
+
+  if stored.fingerprint ~= request then
+    ngx_log(ngx_INFO, "idempotency key reused for another request")
+    return ngx.exit(422)
+  end
+
+  if not stored.status then
+    ngx_log(ngx_INFO, "idempotency key of a request in flight")
+    return ngx.exit(ngx.HTTP_CONFLICT)
+  end
+
+  return replay(stored)
+end
+
+function _M.rewrite()
+  local value = ngx.var.idempotency_key
+  if not value or value == "" or not METHODS[ngx.req.get_method()] then
+    return
+  end
+
+  local request = fingerprint()
+  if not request then
+    return
+  end
+
+  local key = (ngx.var.namespace or "") .. "/" .. (ngx.var.ingress_name or "") .. "|" ..
+    credential() .. "|" .. value
+
+  local entry = responses:get(key)
+  if entry then
+    return check(entry, request)
+  end
+
+  local ok, err, forcible = responses:add(key, cjson.encode({ fingerprint = request }), config.lock_timeout)
+  if not ok then
+    if err == "exists" then
+      entry = responses:get(key)
+      if entry then
+        return check(entry, request)
+      end
+    end
+    ngx_log(ngx_WARN, "error reserving the idempotency key ", key, ": ", err)
+    return
+  end
+  if forcible then
+    ngx_log(ngx_WARN, "idempotency_responses shared dictionary is full, consider increasing its size")
+  end
+
+  ngx.ctx.idempotency = {
+    key = key,
+    fingerprint = request,
+    ttl = tonumber(ngx.var.idempotency_ttl),
+    chunks = {},
+    size = 0,
+  }
+end
+
+function _M.header_filter()
+  local ctx = ngx.ctx.idempotency
+  if not ctx then
+    return
+  end
+
+  if ngx.status >= 500 then
+    ctx.skip = true
+    return
+  end
+
+  local headers = {}
+  for name, value in pairs(ngx.resp.get_headers()) do
+    if not SKIPPED_HEADERS[string_lower(name)] then
+      headers[name] = value
+    end
+  end
+
+  ctx.status = ngx.status
+  ctx.headers = headers
+end
+
+function _M.body_filter()
+  local ctx = ngx.ctx.idempotency
+  if not ctx or ctx.skip then
+    return
+  end
+
+  local chunk, eof = ngx.arg[1], ngx.arg[2]
+  if type(chunk) == "string" then
+    table_insert(ctx.chunks, chunk)
+    ctx.size = ctx.size + #chunk
+  end
+
+  if ctx.size > config.max_body_size then
+    ngx_log(ngx_INFO, "the response is larger than ", config.max_body_size,
+      " bytes, it will not be replayed")
+    ctx.skip = true
+    ctx.chunks = nil
+    return
+  end
+
+  if eof then
+    ctx.complete = true
+  end
+end
+
+function _M.log()
+  local ctx = ngx.ctx.idempotency
+  if not ctx then
+    return
+  end
+
+  ngx.ctx.idempotency = nil
+
+  -- release the key so the request can be retried
+  if ctx.skip or not ctx.complete then
+    responses:delete(ctx.key)
+    return
+  end
+
+  local entry = cjson.encode({
+    fingerprint = ctx.fingerprint,
+    status = ctx.status,
+    headers = ctx.headers,
+    body = table_concat(ctx.chunks),
+  })
+
+  local ok, err, forcible = responses:set(ctx.key, entry, ctx.ttl)
+  if not ok then
+    ngx_log(ngx_WARN, "error storing the response of the idempotency key ", ctx.key, ": ", err)
+    responses:delete(ctx.key)
+    return
+  end
+  if forcible then
+    ngx_log(ngx_WARN, "idempotency_responses shared dictionary is full, consider increasing its size")
+  end
+end
+
+_M.set_config()
+
+return _M
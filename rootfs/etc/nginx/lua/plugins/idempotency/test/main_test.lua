@@ -0,0 +1,153 @@
+local cjson = require("cjson.safe")
+
+describe("idempotency", function()
+  local main
+  local header
+  local arg
+  local resty_sha256 = require("resty.sha256")
+  local resty_str = require("resty.string")
+
+  local function sha256_hex(value)
+    local sha256 = resty_sha256:new()
+    sha256:update(value)
+    return resty_str.to_hex(sha256:final())
+  end
+
+  local key = "default/payments|" .. sha256_hex("Bearer alice") .. "|abc"
+
+  local function request(method, uri, value, body, authorization)
+    ngx.var = {
+      idempotency_key = value,
+      idempotency_ttl = "60",
+      namespace = "default",
+      ingress_name = "payments",
+      request_uri = uri,
+      http_authorization = authorization or "Bearer alice",
+      remote_addr = "10.0.0.1",
+    }
+    ngx.ctx = {}
+    ngx.header = {}
+    stub(ngx.req, "get_method", function() return method end)
+    stub(ngx.req, "read_body")
+    stub(ngx.req, "get_body_data", function() return body or "{\"amount\":10}" end)
+    stub(ngx.req, "get_body_file", function() return nil end)
+  end
+
+  local function respond(status, body)
+    ngx.status = status
+    stub(ngx.resp, "get_headers", function()
+      return { ["Content-Type"] = "application/json", ["Content-Length"] = tostring(#body) }
+    end)
+    main.header_filter()
+    ngx.arg = { body, true }
+    main.body_filter()
+    main.log()
+  end
+
+  before_each(function()
+    main = require_without_cache("plugins.idempotency.main")
+    ngx.shared.idempotency_responses:flush_all()
+    stub(ngx, "log")
+    stub(ngx, "print")
+    stub(ngx, "exit")
+    header = ngx.header
+    arg = ngx.arg
+  end)
+
+  after_each(function()
+    ngx.header = header
+    ngx.arg = arg
+    ngx.status = nil
+  end)
+
+  it("does nothing in locations without idempotency", function()
+    request("POST", "/charges", nil)
+    main.rewrite()
+    assert.is_nil(ngx.ctx.idempotency)
+  end)
+
+  it("does nothing for idempotent methods", function()
+    request("GET", "/charges", "abc")
+    main.rewrite()
+    assert.is_nil(ngx.ctx.idempotency)
+  end)
+
+  it("replays the response of the first request", function()
+    request("POST", "/charges", "abc")
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+    respond(201, "{\"id\":1}")
+
+    local stored = cjson.decode(ngx.shared.idempotency_responses:get(key))
+    assert.are.equal(201, stored.status)
+    assert.is_nil(stored.headers["Content-Length"])
+
+    request("POST", "/charges", "abc")
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(201)
+    assert.stub(ngx.print).was_called_with("{\"id\":1}")
+    assert.are.equal("true", ngx.header["Idempotent-Replayed"])
+    assert.are.equal("application/json", ngx.header["Content-Type"])
+  end)
+
+  it("rejects the duplicates of a request in flight", function()
+    request("POST", "/charges", "abc")
+    main.rewrite()
+
+    request("POST", "/charges", "abc")
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_CONFLICT)
+  end)
+
+  it("rejects a key reused for another request", function()
+    request("POST", "/charges", "abc")
+    main.rewrite()
+
+    request("POST", "/refunds", "abc")
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(422)
+  end)
+
+  it("rejects a key reused with another body", function()
+    request("POST", "/charges", "abc")
+    main.rewrite()
+    respond(201, "{\"id\":1}")
+
+    request("POST", "/charges", "abc", "{\"amount\":1000}")
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(422)
+    assert.stub(ngx.print).was_not_called()
+  end)
+
+  it("scopes the keys by the credential of the client", function()
+    request("POST", "/charges", "abc")
+    main.rewrite()
+    respond(201, "{\"id\":1}")
+
+    request("POST", "/charges", "abc", nil, "Bearer mallory")
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+    assert.stub(ngx.print).was_not_called()
+    assert.is_not_nil(ngx.ctx.idempotency)
+  end)
+
+  it("releases the key of the failed requests", function()
+    request("POST", "/charges", "abc")
+    main.rewrite()
+    respond(502, "bad gateway")
+    assert.is_nil(ngx.shared.idempotency_responses:get(key))
+
+    request("POST", "/charges", "abc")
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+
+  it("does not replay the responses larger than the limit", function()
+    main.set_config({ max_body_size = 4, lock_timeout = 60 })
+
+    request("POST", "/charges", "abc")
+    main.rewrite()
+    respond(200, "too large")
+    assert.is_nil(ngx.shared.idempotency_responses:get(key))
+  end)
+end)
@@ -0,0 +1,185 @@
+-- Validates the requests of the locations configured with the annotation
+-- nginx.ingress.kubernetes.io/openapi-validation-configmap against the
+-- operations of the OpenAPI specification extracted by the controller.
+local ngx = ngx
+local cjson = require("cjson.safe")
+local configuration = require("configuration")
+local schema = require("plugins.openapi_validation.schema")
+
+local ipairs = ipairs
+local string_lower = string.lower
+local string_match = string.match
+local string_sub = string.sub
+local table_concat = table.concat
+local table_insert = table.insert
+local ngx_re_find = ngx.re.find
+local ngx_log = ngx.log
+local ngx_INFO = ngx.INFO
+local ngx_ERR = ngx.ERR
+
+local _M = {}
+
+local decoder = cjson.new()
+-- keep track of arrays to tell apart empty arrays and objects in the schemas
+decoder.decode_array_with_array_mt(true)
+
+-- specifications delivered with the dynamic configuration by checksum, the
+-- operations decoded by this worker and the version of the configuration
+local specs = {}
+local operations_by_checksum = {}
+local specs_version
+
+local function sync_specs()
+  local data, version = configuration.get_openapi_specs_data()
+  if version == specs_version then
+    return
+  end
+
+  specs_version = version
+  operations_by_checksum = {}
+
+  if not data then
+    specs = {}
+    return
+  end
+
+  local new_specs, err = cjson.decode(data)
+  if not new_specs then
+    ngx_log(ngx_ERR, "could not parse the OpenAPI specifications: ", err)
+    return
+  end
+
+  specs = new_specs
+end
+
+local function get_operations(checksum)
+  sync_specs()
+
+  local operations = operations_by_checksum[checksum]
+  if operations then
+    return operations
+  end
+
+  local data = specs[checksum]
+  if not data then
+    return nil, "specification not found"
+  end
+
+  local err
+  operations, err = decoder.decode(data)
+  if not operations then
+    return nil, err
+  end
+
+  operations_by_checksum[checksum] = operations
+
+  return operations
+end
+
+local function find_operation(operations, uri, method)
+  local path
+  local allowed = {}
+
+  -- operations are sorted by the controller, concrete paths first
+  for _, operation in ipairs(operations) do
+    if path == nil and ngx_re_find(uri, operation.path, "jo") then
+      path = operation.path
+    end
+
+    if path ~= nil and operation.path == path then
+      if operation.method == method or (method == "HEAD" and operation.method == "GET") then
+        return operation
+      end
+      table_insert(allowed, operation.method)
+    end
+  end
+
+  return nil, path ~= nil, allowed
+end
+
+local function content_type_allowed(content_types, media_type)
+  for _, content_type in ipairs(content_types) do
+    if content_type == media_type or content_type == "*/*" then
+      return true
+    end
+
+    if string_sub(content_type, -2) == "/*" and
+        string_sub(media_type, 1, #content_type - 1) == string_sub(content_type, 1, -2) then
+      return true
+    end
+  end
+
+  return false
+end
+
+local function is_json(media_type)
+  return media_type == "application/json" or string_sub(media_type, -5) == "+json"
+end
+
+local function reject(status, message, ...)
+  ngx_log(ngx_INFO, "request rejected by the OpenAPI validation: ", message, ...)
+  return ngx.exit(status)
+end
+
+function _M.rewrite()
+  local checksum = ngx.var.openapi_validation_checksum
+  if not checksum or checksum == "" then
+    return
+  end
+
+  local operations, err = get_operations(checksum)
+  if not operations then
+    ngx_log(ngx_ERR, "error decoding the OpenAPI specification: ", err)
+    return ngx.exit(ngx.HTTP_INTERNAL_SERVER_ERROR)
+  end
+
+  local method = ngx.req.get_method()
+  local operation, path_found, allowed = find_operation(operations, ngx.var.uri, method)
+  if not operation then
+    if not path_found then
+      return reject(ngx.HTTP_NOT_FOUND, "path not defined: ", ngx.var.uri)
+    end
+
+    ngx.header["Allow"] = table_concat(allowed, ", ")
+    return reject(ngx.HTTP_NOT_ALLOWED, "method not allowed: ", method)
+  end
+
+  local content_length = ngx.var.http_content_length
+  local has_body = (content_length ~= nil and content_length ~= "0") or
+    ngx.var.http_transfer_encoding ~= nil
+
+  if not has_body then
+    if operation.body_required then
+      return reject(ngx.HTTP_BAD_REQUEST, "missing request body")
+    end
+    return
+  end
+
+  local media_type = string_lower(string_match(ngx.var.content_type or "", "^%s*([^;%s]+)") or "")
+  if operation.content_types and not content_type_allowed(operation.content_types, media_type) then
+    return reject(415, "content type not allowed: ", media_type)
+  end
+
+  if ngx.var.openapi_validation_body ~= "on" or operation.schema == nil or not is_json(media_type) then
+    return
+  end
+
+  ngx.req.read_body()
+  local body = ngx.req.get_body_data()
+  if not body then
+    -- the body was buffered to a temporary file, only small payloads are validated
+    return
+  end
+
+  local value, decode_err = decoder.decode(body)
+  if value == nil then
+    return reject(ngx.HTTP_BAD_REQUEST, "invalid JSON body: ", decode_err)
+  end
+
+  local ok, validation_err = schema.validate(operation.schema, value)
+  if not ok then
+    return reject(ngx.HTTP_BAD_REQUEST, validation_err)
+  end
+end
+
+return _M
@@ -0,0 +1,271 @@
+-- Validates decoded JSON values against the subset of JSON Schema used by
+-- OpenAPI 3 request bodies. References are resolved by the controller.
+local cjson = require("cjson.safe")
+
+local ngx_re_find = ngx.re.find
+local type = type
+local ipairs = ipairs
+local pairs = pairs
+local tostring = tostring
+local getmetatable = getmetatable
+local string_format = string.format
+local string_gsub = string.gsub
+local table_concat = table.concat
+local math_floor = math.floor
+local math_huge = math.huge
+
+local _M = {}
+
+local function json_type(value)
+  if value == cjson.null then
+    return "null"
+  end
+
+  local t = type(value)
+  if t == "table" then
+    if getmetatable(value) == cjson.array_mt then
+      return "array"
+    end
+    return "object"
+  end
+
+  if t == "number" then
+    if value > -math_huge and value < math_huge and value == math_floor(value) then
+      return "integer"
+    end
+    return "number"
+  end
+
+  return t
+end
+
+local function type_matches(expected, actual)
+  return expected == actual or (expected == "number" and actual == "integer")
+end
+
+local function check_type(schema, actual)
+  local expected = schema.type
+  if expected == nil then
+    return true
+  end
+
+  if actual == "null" and schema.nullable == true then
+    return true
+  end
+
+  if type(expected) ~= "table" then
+    return type_matches(expected, actual)
+  end
+
+  for _, t in ipairs(expected) do
+    if type_matches(t, actual) then
+      return true
+    end
+  end
+
+  return false
+end
+
+local function utf8_length(value)
+  local _, count = string_gsub(value, "[^\128-\191]", "")
+  return count
+end
+
+local function fail(path, message, ...)
+  return false, path .. ": " .. string_format(message, ...)
+end
+
+local validate
+
+local function validate_number(schema, value, path)
+  local minimum, maximum = schema.minimum, schema.maximum
+
+  if type(schema.exclusiveMinimum) == "number" and value <= schema.exclusiveMinimum then
+    return fail(path, "must be greater than %s", tostring(schema.exclusiveMinimum))
+  end
+  if type(schema.exclusiveMaximum) == "number" and value >= schema.exclusiveMaximum then
+    return fail(path, "must be less than %s", tostring(schema.exclusiveMaximum))
+  end
+
+  if minimum then
+    if schema.exclusiveMinimum == true and value <= minimum then
+      return fail(path, "must be greater than %s", tostring(minimum))
+    elseif value < minimum then
+      return fail(path, "must be greater than or equal to %s", tostring(minimum))
+    end
+  end
+
+  if maximum then
+    if schema.exclusiveMaximum == true and value >= maximum then
+      return fail(path, "must be less than %s", tostring(maximum))
+    elseif value > maximum then
+      return fail(path, "must be less than or equal to %s", tostring(maximum))
+    end
+  end
+
+  return true
+end
+
+local function validate_string(schema, value, path)
+  if schema.minLength and utf8_length(value) < schema.minLength then
+    return fail(path, "must be at least %d characters long", schema.minLength)
+  end
+  if schema.maxLength and utf8_length(value) > schema.maxLength then
+    return fail(path, "must be at most %d characters long", schema.maxLength)
+  end
+
+  if schema.pattern then
+    local from, _, err = ngx_re_find(value, schema.pattern, "jo")
+    if err then
+      return fail(path, "invalid pattern %s: %s", schema.pattern, err)
+    end
+    if not from then
+      return fail(path, "must match the pattern %s", schema.pattern)
+    end
+  end
+
+  return true
+end
+
+local function validate_array(schema, value, path)
+  if schema.minItems and #value < schema.minItems then
+    return fail(path, "must contain at least %d items", schema.minItems)
+  end
+  if schema.maxItems and #value > schema.maxItems then
+    return fail(path, "must contain at most %d items", schema.maxItems)
+  end
+
+  if schema.items then
+    for i, item in ipairs(value) do
+      local ok, err = validate(schema.items, item, string_format("%s[%d]", path, i - 1))
+      if not ok then
+        return false, err
+      end
+    end
+  end
+
+  return true
+end
+
+local function validate_object(schema, value, path)
+  if schema.required then
+    for _, name in ipairs(schema.required) do
+      if value[name] == nil then
+        return fail(path, "missing required property %s", name)
+      end
+    end
+  end
+
+  local properties = schema.properties or {}
+  for name, property in pairs(value) do
+    local property_path = path .. "." .. tostring(name)
+    local property_schema = properties[name]
+
+    if property_schema == nil then
+      if schema.additionalProperties == false then
+        return fail(path, "property %s is not allowed", tostring(name))
+      elseif type(schema.additionalProperties) == "table" then
+        property_schema = schema.additionalProperties
+      end
+    end
+
+    if property_schema then
+      local ok, err = validate(property_schema, property, property_path)
+      if not ok then
+        return false, err
+      end
+    end
+  end
+
+  return true
+end
+
+local function validate_combinations(schema, value, path)
+  if schema.allOf then
+    for _, s in ipairs(schema.allOf) do
+      local ok, err = validate(s, value, path)
+      if not ok then
+        return false, err
+      end
+    end
+  end
+
+  if schema.anyOf then
+    local matched = false
+    for _, s in ipairs(schema.anyOf) do
+      if validate(s, value, path) then
+        matched = true
+        break
+      end
+    end
+    if not matched then
+      return fail(path, "must match at least one schema of anyOf")
+    end
+  end
+
+  if schema.oneOf then
+    local matches = 0
+    for _, s in ipairs(schema.oneOf) do
+      if validate(s, value, path) then
+        matches = matches + 1
+      end
+    end
+    if matches ~= 1 then
+      return fail(path, "must match exactly one schema of oneOf")
+    end
+  end
+
+  return true
+end
+
+validate = function(schema, value, path)
+  if type(schema) ~= "table" then
+    return true
+  end
+
+  local actual = json_type(value)
+  if not check_type(schema, actual) then
+    return fail(path, "must be of type %s, got %s",
+      type(schema.type) == "table" and table_concat(schema.type, ", ") or schema.type, actual)
+  end
+
+  if schema.enum then
+    local found = false
+    for _, v in ipairs(schema.enum) do
+      if v == value then
+        found = true
+        break
+      end
+    end
+    if not found then
+      return fail(path, "must be one of the allowed values")
+    end
+  end
+
+  local ok, err
+  if actual == "integer" or actual == "number" then
+    ok, err = validate_number(schema, value, path)
+  elseif actual == "string" then
+    ok, err = validate_string(schema, value, path)
+  elseif actual == "array" then
+    ok, err = validate_array(schema, value, path)
+  elseif actual == "object" then
+    ok, err = validate_object(schema, value, path)
+  else
+    ok = true
+  end
+
+  if not ok then
+    return false, err
+  end
+
+  return validate_combinations(schema, value, path)
+end
+
+-- validate returns true when the value matches the schema, or false and
+-- the reason of the failure otherwise
+function _M.validate(schema, value)
+  return validate(schema, value, "body")
+end
+
+return _M
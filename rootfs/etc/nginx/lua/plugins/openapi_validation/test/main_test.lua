@@ -0,0 +1,180 @@
+local cjson = require("cjson.safe")
+
+local operations = [[
+[
+  { "method": "GET", "path": "^/pets$", "body_required": false },
+  {
+    "method": "POST", "path": "^/pets$", "body_required": true,
+    "content_types": ["application/json"],
+    "schema": {
+      "type": "object", "required": ["name"], "additionalProperties": false,
+      "properties": {
+        "name": { "type": "string", "minLength": 1 },
+        "tags": { "type": "array", "items": { "type": "string" } },
+        "age": { "type": "integer", "minimum": 0 }
+      }
+    }
+  },
+  { "method": "DELETE", "path": "^/pets/mine$", "body_required": false },
+  { "method": "GET", "path": "^/pets/[^/]+$", "body_required": false }
+]
+]]
+
+local function request(method, uri, headers, body)
+  headers = headers or {}
+
+  ngx.var = {
+    uri = uri,
+    openapi_validation_checksum = "petstore",
+    openapi_validation_body = "on",
+    content_type = headers["Content-Type"],
+    http_content_length = body and tostring(#body),
+    http_transfer_encoding = nil,
+  }
+
+  stub(ngx.req, "get_method", function() return method end)
+  stub(ngx.req, "read_body")
+  stub(ngx.req, "get_body_data", function() return body end)
+end
+
+describe("openapi_validation", function()
+  local main
+  local header
+
+  before_each(function()
+    local configuration = require("configuration")
+    stub(configuration, "get_openapi_specs_data", function()
+      return cjson.encode({ petstore = operations }), 1
+    end)
+    main = require_without_cache("plugins.openapi_validation.main")
+    stub(ngx, "exit")
+    header = ngx.header
+    ngx.header = {}
+  end)
+
+  after_each(function()
+    ngx.header = header
+  end)
+
+  it("does nothing in locations without specification", function()
+    ngx.var = {}
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+
+  it("accepts defined operations", function()
+    request("GET", "/pets")
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+
+    request("HEAD", "/pets/1")
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+
+  it("rejects paths not defined with 404", function()
+    request("GET", "/owners")
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_NOT_FOUND)
+  end)
+
+  it("rejects methods not defined with 405", function()
+    request("PUT", "/pets")
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_NOT_ALLOWED)
+    assert.are.same("GET, POST", ngx.header["Allow"])
+  end)
+
+  it("gives precedence to concrete paths", function()
+    request("GET", "/pets/mine")
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_NOT_ALLOWED)
+    assert.are.same("DELETE", ngx.header["Allow"])
+  end)
+
+  it("rejects requests without a required body", function()
+    request("POST", "/pets", { ["Content-Type"] = "application/json" })
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_BAD_REQUEST)
+  end)
+
+  it("rejects content types not defined with 415", function()
+    request("POST", "/pets", { ["Content-Type"] = "text/plain" }, "name=cat")
+    main.rewrite()
+    assert.stub(ngx.exit).was_called_with(415)
+  end)
+
+  it("accepts bodies matching the schema", function()
+    request("POST", "/pets", { ["Content-Type"] = "application/json; charset=utf-8" },
+      '{"name": "cat", "tags": [], "age": 2}')
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+
+  it("rejects bodies not matching the schema", function()
+    local bodies = {
+      '{"tags": []}',
+      '{"name": ""}',
+      '{"name": "cat", "age": 1.5}',
+      '{"name": "cat", "tags": [1]}',
+      '{"name": "cat", "color": "black"}',
+      '["cat"]',
+      '{"name": ',
+    }
+
+    for _, body in ipairs(bodies) do
+      request("POST", "/pets", { ["Content-Type"] = "application/json" }, body)
+      main.rewrite()
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_BAD_REQUEST)
+      ngx.exit:clear()
+    end
+  end)
+
+  it("does not validate the body when disabled", function()
+    request("POST", "/pets", { ["Content-Type"] = "application/json" }, '{"tags": []}')
+    ngx.var.openapi_validation_body = "off"
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+
+  it("does not validate bodies buffered to a file", function()
+    request("POST", "/pets", { ["Content-Type"] = "application/json" }, '{"tags": []}')
+    stub(ngx.req, "get_body_data", function() return nil end)
+    main.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+end)
+
+describe("openapi_validation schema", function()
+  local schema = require("plugins.openapi_validation.schema")
+  local decoder = cjson.new()
+  decoder.decode_array_with_array_mt(true)
+
+  local function validate(s, value)
+    return schema.validate(decoder.decode(s), decoder.decode(value))
+  end
+
+  it("validates combinations", function()
+    local s = '{"oneOf": [{"type": "string"}, {"type": "integer"}]}'
+    assert.is_true(validate(s, '"a"'))
+    assert.is_true(validate(s, '1'))
+    assert.is_false(validate(s, '1.5'))
+
+    s = '{"anyOf": [{"type": "string", "maxLength": 1}, {"type": "string", "pattern": "^b"}]}'
+    assert.is_true(validate(s, '"bcd"'))
+    assert.is_false(validate(s, '"cde"'))
+  end)
+
+  it("validates enums and nullable values", function()
+    local s = '{"type": "string", "enum": ["a", "b"], "nullable": true}'
+    assert.is_true(validate(s, '"a"'))
+    assert.is_true(validate(s, 'null'))
+    assert.is_false(validate(s, '"c"'))
+  end)
+
+  it("tells apart empty arrays and objects", function()
+    assert.is_true(validate('{"type": "array"}', '[]'))
+    assert.is_false(validate('{"type": "array"}', '{}'))
+    assert.is_true(validate('{"type": "object"}', '{}'))
+  end)
+end)
@@ -0,0 +1,152 @@
+-- Detects the backends whose protocol does not match their annotation
+-- nginx.ingress.kubernetes.io/backend-protocol, like a plaintext upstream of
+-- a backend annotated as HTTPS or GRPCS, or an upstream not speaking HTTP/2
+-- of a backend annotated as GRPC. NGINX only reports these failures in the
+-- error log, so the error messages are captured with lua_capture_error_log
+-- and the backends of their upstream addresses are sent to the controller
+-- with the metrics, which emits an Event on the Ingresses of the backends.
+local ngx = ngx
+local ngx_errlog = require("ngx.errlog")
+local cjson = require("cjson.safe")
+local configuration = require("configuration")
+local monitor = require("monitor")
+
+local ipairs = ipairs
+local tostring = tostring
+local string_find = string.find
+local string_match = string.match
+
+local CHECK_INTERVAL = 1 -- second
+-- maximum number of messages read from the captured error log per check
+local MAX_LOGS = 1000
+
+-- REASON_TLS is the failure of the TLS handshake with an upstream answering
+-- in plaintext, REASON_HTTP2 is an upstream answering the gRPC requests
+-- with something else than HTTP/2 frames
+local REASON_TLS = "tls-handshake"
+local REASON_HTTP2 = "http2-framing"
+
+local TLS_ERRORS = {
+  "wrong version number",
+  "packet length too long",
+  "unknown protocol",
+  "http request",
+}
+
+local HTTP2_ERRORS = {
+  "upstream sent frame with invalid length",
+  "upstream sent unexpected http2 frame",
+  "upstream sent invalid http2",
+  "upstream sent frame for unknown stream",
+}
+
+-- capturing is true when the error log is captured, lua_capture_error_log is
+-- only configured with the metrics enabled
+local capturing = false
+
+local _M = {}
+
+local function contains_any(msg, patterns)
+  for _, pattern in ipairs(patterns) do
+    if string_find(msg, pattern, 1, true) then
+      return true
+    end
+  end
+  return false
+end
+
+-- match returns the reason of the protocol mismatch reported by an error
+-- message, with the scheme and the address of the upstream, nil when the
+-- message is not about a protocol mismatch
+function _M.match(msg)
+  local scheme, address = string_match(msg, [[upstream: "(%a+)://([^/"]+)]])
+  if not scheme then
+    return nil
+  end
+
+  if (scheme == "https" or scheme == "grpcs") and string_find(msg, "SSL_do_handshake() failed", 1, true) and
+      contains_any(msg, TLS_ERRORS) then
+    return REASON_TLS, scheme, address
+  end
+
+  if (scheme == "grpc" or scheme == "grpcs") and contains_any(msg, HTTP2_ERRORS) then
+    return REASON_HTTP2, scheme, address
+  end
+
+  return nil
+end
+
+-- backends_by_address returns the names of the backends of each endpoint
+local function backends_by_address()
+  local backends = cjson.decode(configuration.get_backends_data() or "[]") or {}
+
+  local names = {}
+  for _, backend in ipairs(backends) do
+    for _, endpoint in ipairs(backend.endpoints or {}) do
+      local address = endpoint.address .. ":" .. endpoint.port
+      if string_find(endpoint.address, ":", 1, true) then
+        address = "[" .. endpoint.address .. "]:" .. endpoint.port
+      end
+
+      local list = names[address]
+      if not list then
+        list = {}
+        names[address] = list
+      end
+      list[#list + 1] = backend.name
+    end
+  end
+
+  return names
+end
+
+-- check reads the messages captured since the previous check and reports
+-- the protocol mismatches to the controller
+function _M.check(premature)
+  if premature then
+    return
+  end
+
+  local logs, err = ngx_errlog.get_logs(MAX_LOGS)
+  if not logs then
+    ngx.log(ngx.WARN, "error reading the captured error log: ", tostring(err))
+    return
+  end
+
+  local names
+  -- the entries are level, time and message
+  for i = 3, #logs, 3 do
+    local reason, scheme, address = _M.match(logs[i])
+    if reason then
+      names = names or backends_by_address()
+      for _, backend in ipairs(names[address] or {}) do
+        monitor.record_protocol_mismatch(backend, scheme, reason)
+      end
+    end
+  end
+end
+
+function _M.init()
+  local ok, err = ngx_errlog.set_filter_level(ngx.ERR)
+  if not ok then
+    ngx.log(ngx.WARN, "error setting the level of the captured error log, ",
+      "the backend protocol mismatches are not detected: ", tostring(err))
+    return
+  end
+
+  capturing = true
+end
+
+function _M.init_worker()
+  -- the captured messages are shared by the workers
+  if not capturing or ngx.worker.id() ~= 0 then
+    return
+  end
+
+  local _, err = ngx.timer.every(CHECK_INTERVAL, _M.check)
+  if err then
+    ngx.log(ngx.ERR, "error when setting up the protocol mismatch timer: ", tostring(err))
+  end
+end
+
+return _M
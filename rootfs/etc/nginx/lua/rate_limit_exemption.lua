@@ -0,0 +1,72 @@
+-- Exempts the requests with a valid credential from the rate limits of the
+-- locations with the limit-exempt-* annotations: a client certificate
+-- verified by auth-tls with an allowed common name, or a JSON Web Token of
+-- the given issuer verified by auth-jwt. The global rate limit is skipped,
+-- and $rate_limit_exempt empties the keys of limit-req and limit-conn.
+local auth_jwt = require("auth_jwt")
+
+local ngx = ngx
+local ipairs = ipairs
+local string_gsub = string.gsub
+local string_match = string.match
+
+local _M = {}
+
+-- common_name returns the common name of the subject of the client
+-- certificate, in the RFC 2253 format of $ssl_client_s_dn
+function _M.common_name(dn)
+  if not dn or dn == "" then
+    return nil
+  end
+
+  -- an escaped comma in another attribute must not start a CN attribute,
+  -- the common names with escaped characters are never allowed
+  local unescaped = string_gsub(dn, "\\.", "")
+  return string_match("," .. unescaped, ",CN=([^,+]*)")
+end
+
+local function has_allowed_client_cert(common_names)
+  if not common_names or #common_names == 0 or ngx.var.ssl_client_verify ~= "SUCCESS" then
+    return false
+  end
+
+  local cn = _M.common_name(ngx.var.ssl_client_s_dn)
+  if not cn then
+    return false
+  end
+
+  for _, allowed in ipairs(common_names) do
+    if cn == allowed then
+      return true
+    end
+  end
+
+  return false
+end
+
+local function has_issuer_token(issuer, auth_jwt_config)
+  if not issuer or issuer == "" then
+    return false
+  end
+
+  local payload = auth_jwt.payload(auth_jwt_config)
+  return payload ~= nil and payload.iss == issuer
+end
+
+-- rewrite returns true if the request is exempted from the rate limits,
+-- must be called in the rewrite phase before the rate limits
+function _M.rewrite(config, auth_jwt_config)
+  if not config then
+    return false
+  end
+
+  if not has_allowed_client_cert(config.client_cert_cns) and
+    not has_issuer_token(config.jwt_issuer, auth_jwt_config) then
+    return false
+  end
+
+  ngx.var.rate_limit_exempt = "1"
+  return true
+end
+
+return _M
@@ -0,0 +1,66 @@
+-- State of the requests kept from the rewrite and balancer phases to the log
+-- phase, like the slots taken by the concurrency limits.
+--
+-- ngx.ctx is reset by error_page and the internal redirects, so the state of
+-- a location is lost before the log phase of the location the request was
+-- redirected to. The state is instead kept by the worker handling the
+-- request, indexed by $request_id, which does not change across internal
+-- redirects. The number of requests kept is bounded, the state of requests
+-- never reaching the log phase of a location calling clear is evicted.
+local lrucache = require("resty.lrucache")
+
+local ngx = ngx
+
+-- maximum number of requests with a state in a worker
+local MAX_REQUESTS = 20000
+
+local _M = {}
+
+local states, err = lrucache.new(MAX_REQUESTS)
+if not states then
+  error("failed to create the cache of the request states: " .. (err or "unknown"))
+end
+
+local function request_id()
+  return ngx.var.request_id or ""
+end
+
+-- get returns the value of the state name of the current request
+function _M.get(name)
+  local state = states:get(request_id())
+  return state and state[name]
+end
+
+-- set sets the value of the state name of the current request
+function _M.set(name, value)
+  local id = request_id()
+  local state = states:get(id)
+  if not state then
+    state = {}
+    states:set(id, state)
+  end
+
+  state[name] = value
+end
+
+-- take returns the value of the state name of the current request and
+-- removes it
+function _M.take(name)
+  local state = states:get(request_id())
+  if not state then
+    return nil
+  end
+
+  local value = state[name]
+  state[name] = nil
+
+  return value
+end
+
+-- clear removes the state of the current request, it must be called at the
+-- end of the log phase
+function _M.clear()
+  states:delete(request_id())
+end
+
+return _M
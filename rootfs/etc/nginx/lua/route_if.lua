@@ -0,0 +1,78 @@
+-- Routes the requests matching the predicate of the annotation
+-- nginx.ingress.kubernetes.io/route-if to the backend of the annotation
+-- nginx.ingress.kubernetes.io/route-if-service. The predicates are compiled
+-- and validated by the controller, as trees of logical operators and
+-- comparisons of NGINX variables.
+local ngx = ngx
+local ipairs = ipairs
+local ngx_re_find = ngx.re.find
+
+local _M = {}
+
+local evaluate
+
+local operators = {
+  ["and"] = function(predicate)
+    for _, operand in ipairs(predicate.operands) do
+      if not evaluate(operand) then
+        return false
+      end
+    end
+    return true
+  end,
+  ["or"] = function(predicate)
+    for _, operand in ipairs(predicate.operands) do
+      if evaluate(operand) then
+        return true
+      end
+    end
+    return false
+  end,
+  ["not"] = function(predicate)
+    return not evaluate(predicate.operands[1])
+  end,
+  eq = function(predicate)
+    return ngx.var[predicate.variable] == predicate.value
+  end,
+  ne = function(predicate)
+    return ngx.var[predicate.variable] ~= predicate.value
+  end,
+  match = function(predicate)
+    local value = ngx.var[predicate.variable]
+    if not value then
+      return false
+    end
+
+    local from, _, err = ngx_re_find(value, predicate.value, "jo")
+    if err then
+      ngx.log(ngx.ERR, "error matching the route-if regular expression ", predicate.value, ": ", err)
+      return false
+    end
+    return from ~= nil
+  end,
+}
+
+evaluate = function(predicate)
+  local operator = operators[predicate.op]
+  if not operator then
+    ngx.log(ngx.ERR, "unknown route-if operator ", predicate.op)
+    return false
+  end
+
+  return operator(predicate)
+end
+
+-- evaluate returns true if the request matches the predicate
+_M.evaluate = evaluate
+
+-- rewrite selects the backend of the requests matching the predicate, used
+-- by the balancer instead of the one of the location
+function _M.rewrite(config)
+  if not config or not evaluate(config.predicate) then
+    return
+  end
+
+  ngx.var.route_if_upstream_name = config.backend
+end
+
+return _M
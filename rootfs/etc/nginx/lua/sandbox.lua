@@ -0,0 +1,124 @@
+-- Runs the Lua code of the annotations, like lua-edge-function, in a sandbox.
+-- The code only reaches the globals given to it and is stopped after a
+-- number of instructions or when it allocates too much memory.
+--
+-- The limits are checked by a hook between the Lua instructions, so the
+-- library functions running in C without calling back to Lua, like
+-- string.rep or the pattern functions of the string library, cannot be
+-- interrupted and are not available to the code, neither as functions nor
+-- as methods of the strings.
+local jit = jit
+local debug_sethook = debug.sethook
+local collectgarbage = collectgarbage
+local getmetatable = getmetatable
+local pairs = pairs
+local pcall = pcall
+local load = load
+local error = error
+local ipairs = ipairs
+local string = string
+
+local _M = {}
+
+-- the limits are checked every HOOK_INTERVAL instructions, often enough to
+-- stop the code doubling a string in a loop before it allocates too much
+local HOOK_INTERVAL = 100
+
+local function copy(source, names)
+  local t = {}
+  for _, name in ipairs(names) do
+    t[name] = source[name]
+  end
+  return t
+end
+
+-- BASE are the basic functions available to the code
+_M.BASE = {
+  "assert", "error", "ipairs", "next", "pairs", "select",
+  "tonumber", "tostring", "type", "unpack",
+}
+
+-- STRING are the functions of the string library available to the code,
+-- also reached by the methods of the strings while the code runs
+_M.STRING = { "byte", "char", "format", "len", "lower", "reverse", "sub", "upper" }
+
+-- TABLE are the functions of the table library available to the code
+_M.TABLE = { "concat", "insert", "remove", "sort" }
+
+-- MATH are the functions of the math library available to the code
+_M.MATH = { "abs", "ceil", "floor", "fmod", "huge", "max", "min", "pi", "random" }
+
+local string_mt = getmetatable("")
+local sandbox_string = copy(string, _M.STRING)
+
+-- new_env returns the globals of an execution with the basic functions and
+-- the subset of the string, table and math libraries, plus the given API. A
+-- new table has to be used for each execution so the code cannot keep state
+-- between executions.
+function _M.new_env(api)
+  local env = copy(_G, _M.BASE)
+
+  env.string = copy(string, _M.STRING)
+  env.table = copy(table, _M.TABLE)
+  env.math = copy(math, _M.MATH)
+
+  for name, value in pairs(api or {}) do
+    env[name] = value
+  end
+
+  return env
+end
+
+-- compile returns the function of the code, named name in the errors. Only
+-- the text chunks are accepted, the bytecode is not verified by LuaJIT.
+function _M.compile(code, name)
+  local fn, err = load(code, "=" .. name, "t")
+  if not fn then
+    return nil, err
+  end
+
+  -- the instruction hook is not called by the compiled traces
+  jit.off(fn, true)
+
+  return fn
+end
+
+-- unsandboxed returns a function calling fn with the methods of the strings
+-- of the whole string library, for the functions of the API given to the
+-- code, calling the ngx API. fn must return at most one value.
+function _M.unsandboxed(fn)
+  return function(...)
+    string_mt.__index = string
+    local value = fn(...)
+    string_mt.__index = sandbox_string
+    return value
+  end
+end
+
+-- run calls fn with the arguments, the compiled code it calls must have an
+-- environment of new_env set with setfenv. It is stopped when it runs more
+-- than max_instructions instructions or allocates more than max_memory
+-- kilobytes.
+function _M.run(limits, fn, ...)
+  local instructions = 0
+  local memory = collectgarbage("count")
+  debug_sethook(function()
+    instructions = instructions + HOOK_INTERVAL
+    if instructions > limits.max_instructions then
+      error("instruction limit exceeded", 0)
+    end
+    if collectgarbage("count") - memory > limits.max_memory then
+      error("memory limit exceeded", 0)
+    end
+  end, "", HOOK_INTERVAL)
+
+  string_mt.__index = sandbox_string
+  local ok, err = pcall(fn, ...)
+  string_mt.__index = string
+
+  debug_sethook()
+
+  return ok, err
+end
+
+return _M
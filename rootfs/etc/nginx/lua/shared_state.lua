@@ -0,0 +1,124 @@
+-- Optional state shared between all the ingress-nginx replicas, stored in
+-- the memcached server also used for global rate limiting.
+-- It is used to keep sticky sessions and passive failure marks of endpoints
+-- consistent when requests of the same client land on different replicas.
+--
+-- memcached can not be accessed from the balancer phase, so values are read
+-- in the rewrite phase and written in a timer.
+local memcached = require("resty.memcached")
+
+local ngx = ngx
+local ngx_log = ngx.log
+local ngx_ERR = ngx.ERR
+local ipairs = ipairs
+local string_format = string.format
+local table_concat = table.concat
+
+local _M = {}
+
+local KEY_PREFIX = "ingress-nginx:"
+
+local config = { enabled = false }
+
+local function with_client(fn)
+  local memc, err = memcached:new()
+  if not memc then
+    return nil, string_format("failed to instantiate memcached client: %s", err)
+  end
+
+  memc:set_timeout(config.memcached.connect_timeout)
+
+  local ok
+  ok, err = memc:connect(config.memcached.host, config.memcached.port)
+  if not ok then
+    return nil, string_format("failed to connect to memcached: %s", err)
+  end
+
+  local res
+  res, err = fn(memc)
+
+  local keepalive_err
+  ok, keepalive_err = memc:set_keepalive(config.memcached.max_idle_timeout, config.memcached.pool_size)
+  if not ok then
+    ngx_log(ngx_ERR, "failed to set memcached keepalive: ", keepalive_err)
+  end
+
+  return res, err
+end
+
+function _M.set_config(new_config)
+  config = new_config or { enabled = false }
+end
+
+function _M.is_enabled()
+  return config.enabled and config.memcached ~= nil and
+    config.memcached.host ~= "" and config.memcached.port ~= 0
+end
+
+function _M.failure_timeout()
+  return config.failure_timeout
+end
+
+function _M.session_timeout()
+  return config.session_timeout
+end
+
+-- key returns a namespaced memcached key for the given parts.
+-- The parts are hashed as memcached does not allow spaces nor keys
+-- longer than 250 characters.
+function _M.key(...)
+  return KEY_PREFIX .. ngx.md5(table_concat({...}, ":"))
+end
+
+-- get returns a table with the values found for the given keys.
+-- Errors are logged and an empty table is returned so the callers fail open.
+function _M.get(keys)
+  if not _M.is_enabled() or #keys == 0 then
+    return {}
+  end
+
+  local res, err = with_client(function(memc)
+    return memc:get(keys)
+  end)
+  if not res then
+    ngx_log(ngx_ERR, "failed to read shared state: ", err)
+    return {}
+  end
+
+  local values = {}
+  for _, key in ipairs(keys) do
+    if res[key] then
+      values[key] = res[key][1]
+    end
+  end
+
+  return values
+end
+
+local function set(premature, key, value, ttl)
+  if premature then
+    return
+  end
+
+  local _, err = with_client(function(memc)
+    return memc:set(key, value, ttl)
+  end)
+  if err then
+    ngx_log(ngx_ERR, "failed to write shared state: ", err)
+  end
+end
+
+-- set_async stores a value in a timer, as memcached can not be accessed
+-- from every phase.
+function _M.set_async(key, value, ttl)
+  if not _M.is_enabled() then
+    return
+  end
+
+  local ok, err = ngx.timer.at(0, set, key, value, ttl)
+  if not ok then
+    ngx_log(ngx_ERR, "failed to create timer: ", err)
+  end
+end
+
+return _M
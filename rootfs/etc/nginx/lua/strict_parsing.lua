@@ -0,0 +1,79 @@
+local ngx = ngx
+local type = type
+local pairs = pairs
+local ipairs = ipairs
+local string_find = string.find
+local string_lower = string.lower
+local string_match = string.match
+
+local _M = {}
+
+-- characters allowed in header names (RFC 7230, token)
+local INVALID_HEADER_NAME = "[^%w!#%$%%&'%*%+%-%.%^_`|~]"
+-- control characters other than horizontal tab are not allowed in header values
+local INVALID_HEADER_VALUE = "[%z\1-\8\10-\31\127]"
+
+local function has_invalid_value(value)
+  if type(value) == "table" then
+    for _, v in ipairs(value) do
+      if string_find(v, INVALID_HEADER_VALUE) then
+        return true
+      end
+    end
+    return false
+  end
+
+  return string_find(value, INVALID_HEADER_VALUE) ~= nil
+end
+
+-- check returns the reason to reject requests with ambiguous framing
+-- (the combinations of Transfer-Encoding and Content-Length used to smuggle
+-- requests) or abnormal headers, nil if the request is valid.
+function _M.check()
+  local headers = ngx.req.get_headers(0)
+
+  for name, value in pairs(headers) do
+    if string_find(name, INVALID_HEADER_NAME) then
+      return "invalid_header_name"
+    end
+
+    if has_invalid_value(value) then
+      return "invalid_header_value"
+    end
+  end
+
+  local content_length = headers["content-length"]
+  local transfer_encoding = headers["transfer-encoding"]
+
+  if type(content_length) == "table" then
+    return "duplicate_content_length"
+  end
+
+  if content_length and not string_match(content_length, "^%d+$") then
+    return "invalid_content_length"
+  end
+
+  if transfer_encoding == nil then
+    return nil
+  end
+
+  if type(transfer_encoding) == "table" then
+    return "duplicate_transfer_encoding"
+  end
+
+  if content_length then
+    return "content_length_with_transfer_encoding"
+  end
+
+  if ngx.req.http_version() < 1.1 then
+    return "transfer_encoding_http10"
+  end
+
+  if string_lower(string_match(transfer_encoding, "^%s*(.-)%s*$")) ~= "chunked" then
+    return "invalid_transfer_encoding"
+  end
+
+  return nil
+end
+
+return _M
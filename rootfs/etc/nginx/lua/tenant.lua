@@ -0,0 +1,148 @@
+-- Extracts the tenant of the requests into the $tenant_id variable, used by
+-- the log formats, the metrics and the rate limit keys. The sources are
+-- configured with the tenant-id-* settings of the ConfigMap and the first
+-- one with a value is used: the header, the claim of the bearer token and
+-- the host, in this order.
+local ngx = ngx
+local cjson = require("cjson.safe")
+
+local ipairs = ipairs
+local type = type
+local tostring = tostring
+local string_gsub = string.gsub
+local string_gmatch = string.gmatch
+local string_lower = string.lower
+local string_match = string.match
+local string_rep = string.rep
+local ngx_re_match = ngx.re.match
+
+local _M = {}
+
+-- tenants counted on their own in the metrics, the others are counted as
+-- OTHER_TENANT to bound the number of series
+local metrics_tenants = {}
+local OTHER_TENANT = "other"
+
+-- tenants longer than this or with other characters are ignored, so they
+-- cannot be used to inject data in the logs or to explode the metrics
+local MAX_TENANT_LENGTH = 128
+local VALID_TENANT = "^[%w%-%._:@]+$"
+
+local function valid(tenant)
+  return tenant ~= nil and #tenant <= MAX_TENANT_LENGTH and
+    string_match(tenant, VALID_TENANT) ~= nil
+end
+
+local function from_header(name)
+  local variable = string_gsub(string_lower(name), "%-", "_")
+  return ngx.var["http_" .. variable]
+end
+
+local function decode_base64url(value)
+  value = string_gsub((string_gsub(value, "%-", "+")), "_", "/")
+  local padding = #value % 4
+  if padding > 0 then
+    value = value .. string_rep("=", 4 - padding)
+  end
+  return ngx.decode_base64(value)
+end
+
+-- the signature of the token is not verified
+local function from_jwt_claim(claim)
+  local authorization = ngx.var.http_authorization
+  if not authorization then
+    return nil
+  end
+
+  local payload = string_match(authorization, "^[Bb]earer%s+[^.%s]+%.([^.%s]+)%.")
+  if not payload then
+    return nil
+  end
+
+  local decoded = decode_base64url(payload)
+  if not decoded then
+    return nil
+  end
+
+  local value = cjson.decode(decoded)
+  for name in string_gmatch(claim, "[^.]+") do
+    if type(value) ~= "table" then
+      return nil
+    end
+    value = value[name]
+  end
+
+  if type(value) == "string" or type(value) == "number" then
+    return tostring(value)
+  end
+
+  return nil
+end
+
+local function from_host(regex)
+  local m, err = ngx_re_match(ngx.var.host, regex, "jo")
+  if err then
+    ngx.log(ngx.ERR, "error matching the host with the tenant regular expression: ", err)
+    return nil
+  end
+  if not m then
+    return nil
+  end
+
+  return m[1] or m[0]
+end
+
+function _M.set_config(config)
+  metrics_tenants = {}
+  for _, tenant in ipairs(config and config.metrics_allowlist or {}) do
+    metrics_tenants[tenant] = true
+  end
+end
+
+-- metric_label returns the tenant label of the metrics of the tenant, nil
+-- when it is unknown
+function _M.metric_label(tenant)
+  if not tenant or tenant == "" then
+    return nil
+  end
+
+  if metrics_tenants[tenant] then
+    return tenant
+  end
+
+  return OTHER_TENANT
+end
+
+-- get returns the tenant of the current request, nil when it is unknown
+function _M.get(config)
+  if not config then
+    return nil
+  end
+
+  local tenant
+  if config.header ~= "" then
+    tenant = from_header(config.header)
+  end
+  if not valid(tenant) and config.jwt_claim ~= "" then
+    tenant = from_jwt_claim(config.jwt_claim)
+  end
+  if not valid(tenant) and config.host_regex ~= "" then
+    tenant = from_host(config.host_regex)
+  end
+
+  if not valid(tenant) then
+    return nil
+  end
+
+  return tenant
+end
+
+-- rewrite sets the $tenant_id variable of the current request
+function _M.rewrite(config)
+  local tenant = _M.get(config)
+  if tenant then
+    ngx.var.tenant_id = tenant
+  end
+end
+
+return _M
@@ -0,0 +1,73 @@
+describe("adaptive_concurrency", function()
+  local adaptive_concurrency
+  local config = { enabled = true, min_limit = 10, max_limit = 100, tolerance = 1.5 }
+  local backend = "default-app-80"
+
+  local function record(latency, samples)
+    for _ = 1, samples do
+      ngx.var = { upstream_response_time = latency }
+      adaptive_concurrency.record(backend, config)
+    end
+  end
+
+  -- starts a new window, the limit is updated with the next sample
+  local function next_window()
+    ngx.shared.inflight_requests:delete("window|" .. backend)
+  end
+
+  before_each(function()
+    adaptive_concurrency = require_without_cache("adaptive_concurrency")
+    ngx.shared.inflight_requests:flush_all()
+  end)
+
+  it("is disabled without configuration", function()
+    assert.is_false(adaptive_concurrency.is_enabled(nil))
+    assert.is_false(adaptive_concurrency.is_enabled({ enabled = false }))
+    assert.is_true(adaptive_concurrency.is_enabled(config))
+  end)
+
+  it("starts at the minimum limit", function()
+    assert.are.equal(10, adaptive_concurrency.get_limit(backend, config))
+  end)
+
+  it("increases the limit while it is reached and the latency is stable", function()
+    record("0.100", 10)
+    next_window()
+    adaptive_concurrency.saturated(backend)
+    record("0.100", 10)
+
+    local limit = adaptive_concurrency.get_limit(backend, config)
+    assert.is_true(limit > 10)
+
+    next_window()
+    record("0.100", 10)
+    assert.are.equal(limit, adaptive_concurrency.get_limit(backend, config))
+  end)
+
+  it("decreases the limit when the latency degrades", function()
+    ngx.shared.inflight_requests:set("limit|" .. backend, 80)
+    record("0.100", 10)
+    next_window()
+    record("0.300", 10)
+
+    local limit = adaptive_concurrency.get_limit(backend, config)
+    assert.is_true(limit < 80)
+    assert.is_true(limit >= 40)
+  end)
+
+  it("keeps the limit within the bounds", function()
+    ngx.shared.inflight_requests:set("limit|" .. backend, 12)
+    record("0.100", 10)
+    next_window()
+    record("1.000", 10)
+    assert.are.equal(10, adaptive_concurrency.get_limit(backend, config))
+
+    ngx.shared.inflight_requests:set("limit|" .. backend, 1000)
+    assert.are.equal(100, adaptive_concurrency.get_limit(backend, config))
+  end)
+
+  it("uses the latency of the last try", function()
+    record("5.000, 0.500", 10)
+    assert.are.equal(0.5, ngx.shared.inflight_requests:get("baseline|" .. backend))
+  end)
+end)
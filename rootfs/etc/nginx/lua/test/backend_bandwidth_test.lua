@@ -0,0 +1,78 @@
+describe("backend_bandwidth", function()
+  local backend_bandwidth
+  local now
+  local config = { rate = 1000, burst = 1000 }
+
+  local function send(bytes)
+    ngx.arg = { string.rep("a", bytes), false }
+    backend_bandwidth.body_filter()
+  end
+
+  before_each(function()
+    backend_bandwidth = require_without_cache("backend_bandwidth")
+    ngx.shared.backend_bandwidth:flush_all()
+    now = 1000
+    stub(ngx, "now", function() return now end)
+    stub(ngx.req, "start_time", function() return 1000 end)
+    ngx.ctx = {}
+    ngx.var = { proxy_upstream_name = "default-storage-80", limit_rate = "0" }
+  end)
+
+  it("does nothing when the bandwidth is not limited", function()
+    backend_bandwidth.rewrite({ rate = 0, burst = 0 })
+    send(5000)
+
+    assert.is_nil(ngx.ctx.backend_bandwidth)
+    assert.are.equal("0", ngx.var.limit_rate)
+  end)
+
+  it("does not slow down the responses within the burst", function()
+    backend_bandwidth.rewrite(config)
+    send(1000)
+
+    assert.are.equal("0", ngx.var.limit_rate)
+  end)
+
+  it("slows down the responses over the rate of the backend", function()
+    backend_bandwidth.rewrite(config)
+    send(1000)
+    send(2000)
+
+    -- the 3000 bytes are sent after 2 seconds, the backend is at its rate
+    assert.are.equal(1000, ngx.var.limit_rate)
+
+    now = now + 3
+    send(100)
+    assert.are.equal(0, ngx.var.limit_rate)
+  end)
+
+  it("shares the bucket between the requests to the backend", function()
+    backend_bandwidth.rewrite(config)
+    send(1500)
+    local first = ngx.ctx
+
+    ngx.ctx = {}
+    backend_bandwidth.rewrite(config)
+    send(500)
+    assert.are.equal(500 / 2, ngx.var.limit_rate)
+
+    ngx.ctx = {}
+    ngx.var = { proxy_upstream_name = "default-other-80", limit_rate = "0" }
+    backend_bandwidth.rewrite(config)
+    send(500)
+    assert.are.equal("0", ngx.var.limit_rate)
+
+    assert.is_true(first.backend_bandwidth.limited)
+  end)
+
+  it("keeps the limit rate of the location", function()
+    ngx.var.limit_rate = "100"
+    backend_bandwidth.rewrite(config)
+    send(3000)
+    assert.are.equal(100, ngx.var.limit_rate)
+
+    now = now + 10
+    send(100)
+    assert.are.equal(100, ngx.var.limit_rate)
+  end)
+end)
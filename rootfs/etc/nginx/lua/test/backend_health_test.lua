@@ -0,0 +1,94 @@
+local BACKENDS = {
+  {
+    name = "default-app-80",
+    endpoints = {
+      { address = "10.0.0.1", port = "8080" },
+      { address = "10.0.0.2", port = "8080" },
+      { address = "10.0.0.3", port = "8080" },
+    },
+  },
+}
+
+describe("backend_health", function()
+  local backend_health
+  local request_state = require("request_state")
+  local now
+
+  local function respond(status)
+    ngx.ctx = {}
+    ngx.var = { request_id = "7e6d5c4b" }
+    backend_health.start("default-app-80")
+    ngx.var.status = status
+    backend_health.finish()
+  end
+
+  before_each(function()
+    backend_health = require_without_cache("backend_health")
+    ngx.shared.backend_health:flush_all()
+    ngx.shared.circuit_breaker:flush_all()
+    ngx.shared.health_check:flush_all()
+    now = 1200
+    stub(ngx, "now", function() return now end)
+    ngx.ctx = {}
+    ngx.var = { request_id = "7e6d5c4b" }
+    request_state.clear()
+  end)
+
+  it("counts the requests in flight once per request", function()
+    backend_health.start("default-app-80")
+    backend_health.start("default-app-80")
+    assert.are.equal(1, backend_health.get(BACKENDS).backends["default-app-80"].inFlight)
+
+    ngx.var.status = "200"
+    backend_health.finish()
+    backend_health.finish()
+    assert.are.equal(0, backend_health.get(BACKENDS).backends["default-app-80"].inFlight)
+  end)
+
+  it("ends the requests in flight after the internal redirects", function()
+    backend_health.start("default-app-80")
+
+    -- error_page resets ngx.ctx before the log phase
+    ngx.ctx = {}
+    ngx.var.status = "502"
+    backend_health.finish()
+    assert.are.equal(0, backend_health.get(BACKENDS).backends["default-app-80"].inFlight)
+  end)
+
+  it("does not count below zero when the counter expired", function()
+    backend_health.start("default-app-80")
+    ngx.shared.backend_health:delete("inflight|default-app-80")
+
+    ngx.var.status = "200"
+    backend_health.finish()
+    assert.are.equal(0, backend_health.get(BACKENDS).backends["default-app-80"].inFlight)
+  end)
+
+  it("counts the requests and the errors of the last window", function()
+    respond("200")
+    respond("200")
+    respond("502")
+
+    local load = backend_health.get(BACKENDS).backends["default-app-80"]
+    assert.are.equal(3, load.requests)
+    assert.are.equal(1, load.errors)
+
+    -- half of the previous window overlaps the last minute
+    now = now + 90
+    respond("200")
+
+    load = backend_health.get(BACKENDS).backends["default-app-80"]
+    assert.are.equal(2.5, load.requests)
+    assert.are.equal(0.5, load.errors)
+  end)
+
+  it("counts the ejected and unhealthy endpoints", function()
+    ngx.shared.circuit_breaker:set("default-app-80|10.0.0.1:8080|ejected", true)
+    ngx.shared.health_check:set("default-app-80|10.0.0.2:8080|unhealthy", true)
+
+    local load = backend_health.get(BACKENDS).backends["default-app-80"]
+    assert.are.equal(3, load.endpoints)
+    assert.are.equal(2, load.ejectedEndpoints)
+    assert.are.equal(60, backend_health.get(BACKENDS).window)
+  end)
+end)
@@ -1,8 +1,24 @@
 describe("Balancer chash", function()
+  local resty_chash = require("resty.chash")
+  local resty_chash_new = resty_chash.new
+
   after_each(function()
     reset_ngx()
+    resty_chash.new = resty_chash_new
   end)
 
+  local function get_test_backend(n_endpoints, hash_by_config)
+    local backend = {
+      name = "my-dummy-backend", upstreamHashByConfig = hash_by_config, endpoints = {}
+    }
+
+    for i = 1, n_endpoints do
+      backend.endpoints[i] = { address = "10.184.7." .. tostring(i), port = "8080", maxFails = 0, failTimeout = 0 }
+    end
+
+    return backend
+  end
+
   describe("balance()", function()
     it("uses correct key for given backend", function()
       ngx.var = { request_uri = "/alma/armud"}
@@ -27,5 +43,156 @@ describe("Balancer chash", function()
       local peer = instance:balance()
       assert.equal("10.184.7.40:8080", peer)
     end)
+
+    it("uses the fallback key when the key is empty", function()
+      ngx.var = { http_x_user_id = "", remote_addr = "10.0.0.1" }
+      local balancer_chash = require_without_cache("balancer.chash")
+
+      local keys = {}
+      local resty_chash = package.loaded["resty.chash"]
+      local original_new = resty_chash.new
+      finally(function()
+        resty_chash.new = original_new
+      end)
+      resty_chash.new = function(self, nodes)
+        return {
+          find = function(self, key)
+            table.insert(keys, key)
+            return "10.184.7.40:8080"
+          end
+        }
+      end
+
+      local backend = {
+        name = "my-dummy-backend",
+        upstreamHashByConfig = {
+          ["upstream-hash-by"] = "$http_x_user_id",
+          ["upstream-hash-by-fallback"] = "$remote_addr",
+        },
+        endpoints = { { address = "10.184.7.40", port = "8080", maxFails = 0, failTimeout = 0 } }
+      }
+      local instance = balancer_chash:new(backend)
+
+      instance:balance()
+      ngx.var.http_x_user_id = "alice"
+      instance:balance()
+
+      assert.are.same({ "10.0.0.1", "alice" }, keys)
+    end)
+
+    it("uses the fallback balancer when the key is empty", function()
+      ngx.var = { http_x_user_id = "" }
+      local balancer_chash = require_without_cache("balancer.chash")
+
+      local backend = get_test_backend(2, {
+        ["upstream-hash-by"] = "$http_x_user_id",
+        ["upstream-hash-by-fallback"] = "round_robin",
+      })
+      local instance = balancer_chash:new(backend)
+
+      local peers = { [instance:balance()] = true, [instance:balance()] = true }
+      assert.are.same({ ["10.184.7.1:8080"] = true, ["10.184.7.2:8080"] = true }, peers)
+
+      ngx.var.http_x_user_id = "alice"
+      assert.are.equal(instance:balance(), instance:balance())
+    end)
+
+    it("bounds the load of the endpoints with the balance factor", function()
+      ngx.var = { http_x_user_id = "alice" }
+      ngx.ctx = {}
+      local balancer_chash = require_without_cache("balancer.chash")
+      local chash_common = require("balancer.chash_common")
+
+      local backend = get_test_backend(4, {
+        ["upstream-hash-by"] = "$http_x_user_id",
+        ["upstream-hash-by-balance-factor"] = 1.25,
+      })
+      local instance = balancer_chash:new(backend)
+
+      local loads = {}
+      for _ = 1, 8 do
+        local peer = instance:balance()
+        loads[peer] = (loads[peer] or 0) + 1
+      end
+
+      local peers = 0
+      for _, load in pairs(loads) do
+        peers = peers + 1
+        assert.is_true(load <= 3)
+      end
+      assert.is_true(peers > 1)
+
+      chash_common.release()
+      assert.are.equal(0, instance.total_load)
+    end)
+
+    it("releases the load of the requests after the internal redirects", function()
+      ngx.var = { http_x_user_id = "alice", request_id = "redirected" }
+      ngx.ctx = {}
+      local balancer_chash = require_without_cache("balancer.chash")
+      local chash_common = require("balancer.chash_common")
+
+      local backend = get_test_backend(4, {
+        ["upstream-hash-by"] = "$http_x_user_id",
+        ["upstream-hash-by-balance-factor"] = 1.25,
+      })
+      local instance = balancer_chash:new(backend)
+
+      instance:balance()
+      assert.are.equal(1, instance.total_load)
+
+      -- error_page resets ngx.ctx before the log phase
+      ngx.ctx = {}
+      chash_common.release()
+      assert.are.equal(0, instance.total_load)
+    end)
+
+    it("gives back the load of the requests never released", function()
+      ngx.var = { http_x_user_id = "alice", request_id = "lost" }
+      local now = 1000
+      stub(ngx, "now", function() return now end)
+      require_without_cache("balancer.chash_common")
+      local balancer_chash = require_without_cache("balancer.chash")
+
+      local backend = get_test_backend(4, {
+        ["upstream-hash-by"] = "$http_x_user_id",
+        ["upstream-hash-by-balance-factor"] = 1.25,
+      })
+      local instance = balancer_chash:new(backend)
+
+      instance:balance()
+      require("request_state").clear()
+
+      now = now + 601
+      ngx.var.request_id = "next"
+      instance:balance()
+      assert.are.equal(1, instance.total_load)
+    end)
+
+    it("keeps the keys of the draining endpoints on them", function()
+      ngx.var = { http_x_user_id = "alice" }
+      local balancer_chash = require_without_cache("balancer.chash")
+      local drain = require("drain")
+
+      local backend = get_test_backend(2, { ["upstream-hash-by"] = "$http_x_user_id" })
+      local endpoints = backend.endpoints
+      local instance = balancer_chash:new(backend)
+      local peer = instance:balance()
+
+      local removed, kept = endpoints[1], endpoints[2]
+      if peer == kept.address .. ":" .. kept.port then
+        removed, kept = kept, removed
+      end
+
+      backend.endpoints = { kept }
+      backend.drainingEndpoints = {
+        { address = removed.address, port = removed.port, ring_id = "1", ring = endpoints },
+      }
+      instance:sync(backend)
+      drain.attach(instance, backend)
+
+      assert.equal(peer, drain.balance(instance))
+      assert.equal(kept.address .. ":" .. kept.port, instance:balance())
+    end)
   end)
 end)
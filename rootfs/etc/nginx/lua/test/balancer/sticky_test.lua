@@ -364,6 +364,139 @@ describe("Sticky", function()
     end)
   end)
 
+  describe("balance() with shared state", function()
+    local mocked_cookie_new = cookie.new
+
+    before_each(function()
+      mock_ngx({ var = { location_path = "/", host = "test.com" }, ctx = {} })
+      reset_sticky_balancer()
+      cookie.new = function(self)
+        return { get = function(self, n) return "session-key" end, set = function(self, c) return true, nil end }
+      end
+    end)
+
+    after_each(function()
+      cookie.new = mocked_cookie_new
+      reset_ngx()
+    end)
+
+    local function test_session_endpoint(sticky)
+      local sticky_balancer_instance = sticky:new(get_several_test_backends(true))
+
+      ngx.ctx.sticky_shared_state = { upstream = "10.184.7.41:8080", failed_upstreams = {} }
+      assert.equal("10.184.7.41:8080", sticky_balancer_instance:balance())
+
+      ngx.ctx.sticky_shared_state = { upstream = "10.184.7.40:8080", failed_upstreams = {} }
+      assert.equal("10.184.7.40:8080", sticky_balancer_instance:balance())
+    end
+
+    it("uses the endpoint of the session stored in the shared state", function()
+      test_session_endpoint(sticky_balanced)
+    end)
+    it("uses the endpoint of the session stored in the shared state", function()
+      test_session_endpoint(sticky_persistent)
+    end)
+
+    local function test_failed_endpoint(sticky)
+      local sticky_balancer_instance = sticky:new(get_several_test_backends(true))
+
+      ngx.ctx.sticky_shared_state = {
+        upstream = "10.184.7.40:8080",
+        failed_upstreams = { ["10.184.7.40:8080"] = true },
+      }
+      for _ = 1, 100 do
+        assert.equal("10.184.7.41:8080", sticky_balancer_instance:balance())
+      end
+    end
+
+    it("changes upstream when the shared state marks it as failed", function()
+      test_failed_endpoint(sticky_balanced)
+    end)
+    it("changes upstream when the shared state marks it as failed", function()
+      test_failed_endpoint(sticky_persistent)
+    end)
+  end)
+
+  describe("balance() with draining endpoints", function()
+    local mocked_cookie_new = cookie.new
+    local drain = require("drain")
+    local session_key
+    local new_keys
+
+    before_each(function()
+      mock_ngx({ var = { location_path = "/", host = "test.com" }, ctx = {} })
+      reset_sticky_balancer()
+      session_key = nil
+      new_keys = {}
+      cookie.new = function(self)
+        return {
+          get = function(self, n) return session_key end,
+          set = function(self, c)
+            table.insert(new_keys, c.value)
+            return true, nil
+          end,
+        }
+      end
+    end)
+
+    after_each(function()
+      cookie.new = mocked_cookie_new
+      reset_ngx()
+    end)
+
+    local function test(sticky)
+      local backend = get_several_test_backends(true)
+      local sticky_balancer_instance = sticky:new(backend)
+
+      -- a session of the endpoint removed from the backend
+      for i = 1, 1000 do
+        local key = ngx.md5(backend.name .. "10.184.7.41:8080")
+        if sticky == sticky_balanced then
+          key = "session-" .. i
+        end
+        if sticky_balancer_instance.instance:find(key) == "10.184.7.41:8080" then
+          session_key = key
+          break
+        end
+      end
+      assert.is.Not.Nil(session_key)
+
+      local endpoints = backend.endpoints
+      backend.endpoints = { endpoints[1] }
+      backend.drainingEndpoints = {
+        { address = endpoints[2].address, port = endpoints[2].port, ring_id = "1", ring = endpoints },
+      }
+      sticky_balancer_instance:sync(backend)
+      drain.attach(sticky_balancer_instance, backend)
+
+      assert.equal("10.184.7.41:8080", drain.balance(sticky_balancer_instance))
+
+      -- new sessions only go to the endpoints of the backend, with keys not
+      -- kept by the draining endpoints
+      local key = session_key
+      session_key = nil
+      for _ = 1, 100 do
+        assert.is_nil(drain.balance(sticky_balancer_instance))
+        assert.equal("10.184.7.40:8080", sticky_balancer_instance:balance())
+      end
+      assert.is_true(#new_keys > 0)
+      for _, new_key in ipairs(new_keys) do
+        assert.is_nil(drain.find(sticky_balancer_instance, new_key))
+      end
+
+      -- the session moves at the end of the drain timeout
+      session_key = key
+      backend.drainingEndpoints = nil
+      sticky_balancer_instance:sync(backend)
+      drain.attach(sticky_balancer_instance, backend)
+      assert.is_nil(drain.balance(sticky_balancer_instance))
+      assert.equal("10.184.7.40:8080", sticky_balancer_instance:balance())
+    end
+
+    it("keeps the sessions of the draining endpoints", function() test(sticky_balanced) end)
+    it("keeps the sessions of the draining endpoints", function() test(sticky_persistent) end)
+  end)
+
   context("when client doesn't have a cookie set and no host header, matching default server '_'",
   function()
     before_each(function ()
@@ -469,4 +602,65 @@ describe("Sticky", function()
       test_set_cookie(sticky_balanced, "None", true, "/", nil)
     end)
   end)
+
+  describe("cookie attributes", function()
+    local mocked_cookie_new = cookie.new
+
+    after_each(function()
+      cookie.new = mocked_cookie_new
+    end)
+
+    local function balance_with_cookie(sticky, attributes, endpoints)
+      local payloads = {}
+      cookie.new = function(self)
+        return {
+          set = function(self, payload)
+            table.insert(payloads, payload)
+            return true, nil
+          end,
+          get = function(k) return false end,
+        }, false
+      end
+
+      local b = get_test_backend()
+      b.sessionAffinityConfig.cookieSessionAffinity.locations = { ["test.com"] = {"/"} }
+      for k, v in pairs(attributes) do
+        b.sessionAffinityConfig.cookieSessionAffinity[k] = v
+      end
+      if endpoints then
+        b.endpoints = endpoints
+      end
+
+      local sticky_balancer_instance = sticky:new(b)
+      assert.has_no.errors(function() sticky_balancer_instance:balance() end)
+
+      return payloads
+    end
+
+    it("sets the secure, httponly and domain attributes", function()
+      local payloads = balance_with_cookie(sticky_balanced,
+        { secure = true, httponly = false, domain = ".test.com" })
+
+      assert.equal(1, #payloads)
+      assert.equal(true, payloads[1].secure)
+      assert.equal(false, payloads[1].httponly)
+      assert.equal(".test.com", payloads[1].domain)
+    end)
+
+    it("does not set the cookie with one endpoint when conditional set is enabled", function()
+      local payloads = balance_with_cookie(sticky_persistent, { conditional_set = true })
+
+      assert.equal(0, #payloads)
+    end)
+
+    it("sets the cookie with multiple endpoints when conditional set is enabled", function()
+      local payloads = balance_with_cookie(sticky_persistent, { conditional_set = true }, {
+        { address = "10.184.7.40", port = "8080", maxFails = 0, failTimeout = 0 },
+        { address = "10.184.7.41", port = "8080", maxFails = 0, failTimeout = 0 },
+      })
+
+      assert.equal(1, #payloads)
+      assert.equal(true, payloads[1].httponly)
+    end)
+  end)
 end)
@@ -123,6 +123,162 @@ describe("Balancer", function()
         assert.are.same(expected, balancer.get_balancer())
       end
     end)
+
+    it("records the canary backend of the request", function()
+      local backend = {
+        name = "my-dummy-app-8", ["load-balance"] = "round_robin",
+        alternativeBackends = { "my-dummy-canary-app-8" },
+        endpoints = { { address = "10.184.7.40", port = "8080", maxFails = 0, failTimeout = 0 } },
+      }
+      local canary_backend = {
+        name = "my-dummy-canary-app-8", ["load-balance"] = "round_robin",
+        endpoints = { { address = "11.184.7.40", port = "8080", maxFails = 0, failTimeout = 0 } },
+        trafficShapingPolicy = { weight = 100, header = "", headerValue = "", cookie = "" },
+      }
+
+      mock_ngx({ var = { proxy_upstream_name = backend.name, request_uri = "/" }, ctx = {} })
+      reset_balancer()
+
+      balancer.sync_backend(backend)
+      balancer.sync_backend(canary_backend)
+
+      assert.are.same(canary_backend.name, balancer.get_balancer().name)
+      assert.are.same(canary_backend.name, ngx.ctx.canary_upstream_name)
+    end)
+  end)
+
+  describe("get_fallback_balancer()", function()
+    local fallback_backend = {
+      name = "my-dummy-fallback-app", ["load-balance"] = "round_robin",
+      endpoints = { { address = "10.184.7.41", port = "8080", maxFails = 0, failTimeout = 0 } },
+    }
+
+    it("returns nil when no fallback backend is configured", function()
+      mock_ngx({ var = { fallback_upstream_name = "" } })
+      reset_balancer()
+      balancer.sync_backend(fallback_backend)
+
+      assert.is_nil(balancer.get_fallback_balancer())
+    end)
+
+    it("returns the balancer of the fallback backend", function()
+      mock_ngx({ var = { fallback_upstream_name = fallback_backend.name } })
+      reset_balancer()
+      balancer.sync_backend(fallback_backend)
+
+      local fallback_balancer = balancer.get_fallback_balancer()
+      assert.are.same(fallback_backend.name, fallback_balancer.name)
+    end)
+
+    it("is used when the backend has no balancer", function()
+      mock_ngx({ var = { proxy_upstream_name = "my-dummy-app-7", fallback_upstream_name = fallback_backend.name }, ctx = {} })
+      reset_balancer()
+      balancer.sync_backend(fallback_backend)
+
+      assert.are.same(fallback_backend.name, balancer.get_balancer().name)
+      assert.are.same(fallback_backend.name, ngx.var.proxy_alternative_upstream_name)
+      assert.is_nil(ngx.ctx.canary_upstream_name)
+    end)
+  end)
+
+  describe("get_geo_balancer()", function()
+    local geo_backend = {
+      name = "geo-default-eu-service", ["load-balance"] = "round_robin",
+      endpoints = { { address = "10.184.7.42", port = "8080", maxFails = 0, failTimeout = 0 } },
+    }
+
+    it("returns nil when the client matches no region", function()
+      mock_ngx({ var = { geo_upstream_name = "" } })
+      reset_balancer()
+      balancer.sync_backend(geo_backend)
+
+      assert.is_nil(balancer.get_geo_balancer())
+    end)
+
+    it("replaces the backend of the location", function()
+      mock_ngx({ var = { proxy_upstream_name = "access-router-production-web-80", geo_upstream_name = geo_backend.name }, ctx = {} })
+      reset_balancer()
+      balancer.sync_backend(geo_backend)
+
+      assert.are.same(geo_backend.name, balancer.get_balancer().name)
+      assert.are.same(geo_backend.name, ngx.var.proxy_alternative_upstream_name)
+    end)
+
+    it("is ignored when the backend has no balancer", function()
+      mock_ngx({ var = { proxy_upstream_name = "access-router-production-web-80", geo_upstream_name = "geo-default-us-service" }, ctx = {} })
+      reset_balancer()
+      balancer.sync_backend(backends[1])
+
+      assert.are.same(backends[1].name, balancer.get_balancer().name)
+    end)
+  end)
+
+  describe("get_route_if_balancer()", function()
+    local route_if_backend = {
+      name = "route-if-default-qa", ["load-balance"] = "round_robin",
+      endpoints = { { address = "10.184.7.43", port = "8080", maxFails = 0, failTimeout = 0 } },
+    }
+
+    it("returns nil when the request does not match the predicate", function()
+      mock_ngx({ var = { route_if_upstream_name = "" } })
+      reset_balancer()
+      balancer.sync_backend(route_if_backend)
+
+      assert.is_nil(balancer.get_route_if_balancer())
+    end)
+
+    it("takes precedence over the geo routing", function()
+      mock_ngx({ var = { proxy_upstream_name = "access-router-production-web-80",
+        geo_upstream_name = "geo-default-eu-service", route_if_upstream_name = route_if_backend.name }, ctx = {} })
+      reset_balancer()
+      balancer.sync_backend(route_if_backend)
+
+      assert.are.same(route_if_backend.name, balancer.get_balancer().name)
+      assert.are.same(route_if_backend.name, ngx.var.proxy_alternative_upstream_name)
+    end)
+  end)
+
+  describe("rewrite()", function()
+    local function rewrite(no_endpoints)
+      mock_ngx({ var = { proxy_upstream_name = "my-dummy-app-7" }, ctx = {}, header = {} })
+      stub(ngx, "exit")
+      stub(ngx, "print")
+      reset_balancer()
+
+      balancer.rewrite({ no_endpoints = no_endpoints })
+    end
+
+    it("responds with 503 when the backend has no endpoints", function()
+      rewrite({ action = "" })
+
+      assert.are.equal(ngx.HTTP_SERVICE_UNAVAILABLE, ngx.status)
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_SERVICE_UNAVAILABLE)
+      assert.is_nil(ngx.header["Retry-After"])
+    end)
+
+    it("adds the Retry-After header", function()
+      rewrite({ action = "503", retry_after = 30 })
+
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_SERVICE_UNAVAILABLE)
+      assert.are.equal(30, ngx.header["Retry-After"])
+    end)
+
+    it("responds with 502 when configured", function()
+      rewrite({ action = "502", retry_after = 30 })
+
+      assert.are.equal(ngx.HTTP_BAD_GATEWAY, ngx.status)
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_BAD_GATEWAY)
+      assert.is_nil(ngx.header["Retry-After"])
+    end)
+
+    it("serves the page when configured", function()
+      rewrite({ action = "page", retry_after = 0, page = "<h1>Maintenance</h1>" })
+
+      assert.are.equal(ngx.HTTP_SERVICE_UNAVAILABLE, ngx.status)
+      assert.are.equal("text/html", ngx.header["Content-Type"])
+      assert.stub(ngx.print).was_called_with("<h1>Maintenance</h1>")
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_OK)
+    end)
   end)
 
   describe("route_to_alternative_balancer()", function()
@@ -293,6 +449,175 @@ describe("Balancer", function()
         end
       end)
     end)
+
+    context("canary by grpc method", function()
+      after_each(function()
+        backend.trafficShapingPolicy.grpcMethods = nil
+      end)
+
+      it("returns correct result for given gRPC methods", function()
+        local test_patterns = {
+          {
+            case_title = "method matches",
+            uri = "/helloworld.Greeter/SayHello",
+            expected_result = true,
+          },
+          {
+            case_title = "method of a service with wildcard matches",
+            uri = "/helloworld.Farewell/SayGoodbye",
+            expected_result = true,
+          },
+          {
+            case_title = "method does not match",
+            uri = "/helloworld.Greeter/SayHelloAgain",
+            expected_result = false,
+          },
+          {
+            case_title = "service with the same prefix does not match",
+            uri = "/helloworld.FarewellV2/SayGoodbye",
+            expected_result = false,
+          },
+        }
+
+        for _, test_pattern in pairs(test_patterns) do
+          mock_ngx({ var = { uri = test_pattern.uri, request_uri = test_pattern.uri } })
+          reset_balancer()
+          backend.trafficShapingPolicy.grpcMethods = {
+            "/helloworld.Greeter/SayHello",
+            "/helloworld.Farewell/*",
+          }
+          balancer.sync_backend(backend)
+          assert.message("\nTest data pattern: " .. test_pattern.case_title)
+            .equal(test_pattern.expected_result, balancer.route_to_alternative_balancer(_balancer))
+          reset_ngx()
+        end
+      end)
+    end)
+
+    context("canary by content type", function()
+      after_each(function()
+        backend.trafficShapingPolicy.contentTypes = nil
+      end)
+
+      it("returns correct result for given content types", function()
+        local test_patterns = {
+          {
+            case_title = "media type matches",
+            content_type = "application/grpc",
+            expected_result = true,
+          },
+          {
+            case_title = "media type with parameters and other case matches",
+            content_type = "Application/GRPC; charset=utf-8",
+            expected_result = true,
+          },
+          {
+            case_title = "subtype of a type with wildcard matches",
+            content_type = "text/csv",
+            expected_result = true,
+          },
+          {
+            case_title = "media type does not match",
+            content_type = "application/grpc+proto",
+            expected_result = false,
+          },
+          {
+            case_title = "content type is undefined",
+            expected_result = false,
+          },
+        }
+
+        for _, test_pattern in pairs(test_patterns) do
+          mock_ngx({ var = { http_content_type = test_pattern.content_type, request_uri = "/" } })
+          reset_balancer()
+          backend.trafficShapingPolicy.contentTypes = { "application/grpc", "text/*" }
+          balancer.sync_backend(backend)
+          assert.message("\nTest data pattern: " .. test_pattern.case_title)
+            .equal(test_pattern.expected_result, balancer.route_to_alternative_balancer(_balancer))
+          reset_ngx()
+        end
+      end)
+    end)
+
+    context("canary by list of header values", function()
+      it("returns true when the header matches one of the values", function()
+        local test_patterns = {
+          { case_title = "first value", request_header_value = "foo", expected_result = true },
+          { case_title = "second value", request_header_value = "bar", expected_result = true },
+          { case_title = "other value", request_header_value = "baz", expected_result = false },
+          { case_title = "'always' is not a value", request_header_value = "always", expected_result = false },
+        }
+
+        for _, test_pattern in pairs(test_patterns) do
+          mock_ngx({ var = { http_canaryHeader = test_pattern.request_header_value, request_uri = "/" } })
+          reset_balancer()
+          backend.trafficShapingPolicy.header = "canaryHeader"
+          backend.trafficShapingPolicy.headerValue = "foo,bar"
+          backend.trafficShapingPolicy.headerValues = { "foo", "bar" }
+          balancer.sync_backend(backend)
+          assert.message("\nTest data pattern: " .. test_pattern.case_title)
+            .equal(test_pattern.expected_result, balancer.route_to_alternative_balancer(_balancer))
+          reset_ngx()
+        end
+      end)
+    end)
+
+    context("canary by cookie value", function()
+      it("returns true when the cookie matches the regular expression", function()
+        local test_patterns = {
+          { case_title = "value matches", request_cookie_value = "beta-tester", expected_result = true },
+          { case_title = "value does not match", request_cookie_value = "stable", expected_result = false },
+          { case_title = "'always' does not match", request_cookie_value = "always", expected_result = false },
+        }
+
+        for _, test_pattern in pairs(test_patterns) do
+          mock_ngx({ var = { cookie_canaryCookie = test_pattern.request_cookie_value, request_uri = "/" } })
+          reset_balancer()
+          backend.trafficShapingPolicy.cookie = "canaryCookie"
+          backend.trafficShapingPolicy.cookieValue = "^beta-"
+          balancer.sync_backend(backend)
+          assert.message("\nTest data pattern: " .. test_pattern.case_title)
+            .equal(test_pattern.expected_result, balancer.route_to_alternative_balancer(_balancer))
+          reset_ngx()
+        end
+      end)
+    end)
+
+    context("canary match mode", function()
+      local test_patterns = {
+        { case_title = "header and cookie match", header = "always", cookie = "beta-tester", any = true, all = true },
+        { case_title = "only the header matches", header = "always", cookie = "stable", any = true, all = false },
+        { case_title = "only the cookie matches", header = "foo", cookie = "beta-tester", any = true, all = false },
+        { case_title = "header is 'never'", header = "never", cookie = "beta-tester", any = false, all = false },
+        { case_title = "nothing matches", cookie = "stable", any = false, all = false },
+      }
+
+      for _, mode in ipairs({ "or", "and" }) do
+        it("returns correct result in " .. mode .. " mode", function()
+          for _, test_pattern in pairs(test_patterns) do
+            mock_ngx({ var = {
+              http_canaryHeader = test_pattern.header,
+              cookie_canaryCookie = test_pattern.cookie,
+              request_uri = "/",
+            }})
+            reset_balancer()
+            backend.trafficShapingPolicy.header = "canaryHeader"
+            backend.trafficShapingPolicy.cookie = "canaryCookie"
+            backend.trafficShapingPolicy.cookieValue = "^beta-"
+            backend.trafficShapingPolicy.matchMode = mode
+            balancer.sync_backend(backend)
+
+            local expected_result = test_pattern.any
+            if mode == "and" then
+              expected_result = test_pattern.all
+            end
+            assert.message("\nTest data pattern: " .. test_pattern.case_title)
+              .equal(expected_result, balancer.route_to_alternative_balancer(_balancer))
+            reset_ngx()
+          end
+        end)
+      end
+    end)
   end)
 
   describe("sync_backend()", function()
@@ -349,6 +674,89 @@ describe("Balancer", function()
       assert.stub(mock_instance.sync).was_called_with(mock_instance, expected_backend)
     end)
 
+    it("resolves external name to the targets of its SRV records", function()
+      backend = {
+        name = "consul-api", service = { spec = { ["type"] = "ExternalName" } },
+        externalNameSRV = true,
+        endpoints = {
+          { address = "api.service.consul", port = "80", maxFails = 0, failTimeout = 0 }
+        }
+      }
+
+      local resolver = require("resty.dns.resolver")
+      helpers.mock_resty_dns_new(function(self, options)
+        return {
+          query = function(_, host, options)
+            if options.qtype == resolver.TYPE_SRV then
+              return { { name = host, target = "node-1.node.consul", port = 21000, priority = 1, weight = 5, ttl = 30 } }
+            end
+            return { { name = host, address = "10.0.0.1", ttl = 60 } }
+          end,
+        }
+      end)
+      local expected_backend = {
+        name = "consul-api", service = { spec = { ["type"] = "ExternalName" } },
+        externalNameSRV = true,
+        endpoints = {
+          { address = "10.0.0.1", port = "21000", weight = 5 },
+        }
+      }
+
+      local mock_instance = { sync = function(backend) end }
+      setmetatable(mock_instance, implementation)
+      implementation.new = function(self, backend) return mock_instance end
+      local s = spy.on(implementation, "new")
+      assert.has_no.errors(function() balancer.sync_backend(backend) end)
+      assert.spy(s).was_called_with(implementation, expected_backend)
+    end)
+
+    it("uses the failover endpoints when the backend has no endpoints", function()
+      backend = {
+        name = "my-dummy-app-8", endpoints = {},
+        failoverEndpoints = {
+          { address = "backup.example.com", port = "443", weight = 3 },
+          { address = "10.0.0.1", port = "8080", weight = 1 },
+        }
+      }
+
+      helpers.mock_resty_dns_query(nil, {
+        {
+          name = "backup.example.com",
+          address = "192.168.1.2",
+          ttl = 60,
+        },
+      })
+      local expected_backend = {
+        name = "my-dummy-app-8",
+        failoverEndpoints = {
+          { address = "backup.example.com", port = "443", weight = 3 },
+          { address = "10.0.0.1", port = "8080", weight = 1 },
+        },
+        endpoints = {
+          { address = "192.168.1.2", port = "443", weight = 3 },
+          { address = "10.0.0.1", port = "8080", weight = 1 },
+        }
+      }
+
+      local mock_instance = { sync = function(backend) end }
+      setmetatable(mock_instance, implementation)
+      implementation.new = function(self, backend) return mock_instance end
+      local s = spy.on(implementation, "new")
+      assert.has_no.errors(function() balancer.sync_backend(backend) end)
+      assert.spy(s).was_called_with(implementation, expected_backend)
+    end)
+
+    it("ignores the failover endpoints when the backend has endpoints", function()
+      local backend_with_failover = util.deepcopy(backend)
+      backend_with_failover.failoverEndpoints = {
+        { address = "10.0.0.1", port = "8080", weight = 1 },
+      }
+
+      local s = spy.on(implementation, "new")
+      assert.has_no.errors(function() balancer.sync_backend(backend_with_failover) end)
+      assert.spy(s).was_called_with(implementation, backend_with_failover)
+    end)
+
     it("wraps IPv6 addresses into square brackets", function()
       local backend = {
         name = "example-com",
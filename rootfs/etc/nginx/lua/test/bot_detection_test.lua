@@ -0,0 +1,93 @@
+local cjson = require("cjson.safe")
+
+local rules = {
+  { name = "bad-crawler", userAgent = "(?i)badcrawler", action = "block" },
+  { name = "headless", headers = { ["user-agent"] = "HeadlessChrome" }, action = "challenge" },
+  { name = "scraper", userAgent = "python-requests", action = "rate-limit", limit = 2, window = 60 },
+  { name = "no-accept", missingHeaders = { "accept" }, action = "tag" },
+}
+
+local function set_rules(new_rules)
+  ngx.shared.configuration_data:set("bot_detection", cjson.encode({ rules = new_rules, secret = "secret" }))
+  ngx.shared.configuration_data:incr("bot_detection_version", 1, 0)
+end
+
+local function mock_request(headers, method)
+  stub(ngx.req, "get_headers", function() return headers end)
+  stub(ngx.req, "get_method", function() return method or "GET" end)
+  ngx.var = { remote_addr = "10.10.10.10", http_user_agent = headers["user-agent"] }
+end
+
+describe("bot_detection", function()
+  local bot_detection
+  local header
+
+  before_each(function()
+    bot_detection = require_without_cache("bot_detection")
+    ngx.shared.bot_detection:flush_all()
+    set_rules(rules)
+    stub(ngx, "exit")
+    stub(ngx, "print")
+    stub(ngx.req, "set_header")
+    header = ngx.header
+    ngx.header = {}
+  end)
+
+  after_each(function()
+    ngx.header = header
+  end)
+
+  it("allows requests not matching any rule", function()
+    mock_request({ ["user-agent"] = "Mozilla/5.0", accept = "*/*" })
+    bot_detection.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+    assert.stub(ngx.req.set_header).was_not_called()
+  end)
+
+  it("blocks requests with the block action", function()
+    mock_request({ ["user-agent"] = "BadCrawler/1.0", accept = "*/*" })
+    bot_detection.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_FORBIDDEN)
+  end)
+
+  it("tags requests with the tag action", function()
+    mock_request({ ["user-agent"] = "Mozilla/5.0" })
+    bot_detection.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+    assert.stub(ngx.req.set_header).was_called_with("X-Bot-Detected", "no-accept")
+  end)
+
+  it("limits the requests of each client with the rate-limit action", function()
+    mock_request({ ["user-agent"] = "python-requests/2.25", accept = "*/*" })
+    bot_detection.rewrite()
+    bot_detection.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+
+    bot_detection.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_TOO_MANY_REQUESTS)
+  end)
+
+  it("challenges clients without a valid cookie", function()
+    mock_request({ ["user-agent"] = "HeadlessChrome/90", accept = "*/*" })
+    bot_detection.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_FORBIDDEN)
+    assert.stub(ngx.print).was_called()
+
+    local printed = ngx.print.calls[1].vals[1]
+    local token = string.match(printed, "ingress_bot_challenge=(%x+)")
+    assert.is_not_nil(token)
+
+    ngx.exit:clear()
+    mock_request({ ["user-agent"] = "HeadlessChrome/90", accept = "*/*" })
+    ngx.var.cookie_ingress_bot_challenge = token
+    bot_detection.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+
+  it("applies new rules without reloading", function()
+    mock_request({ ["user-agent"] = "BadCrawler/1.0", accept = "*/*" })
+    set_rules({})
+    bot_detection.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+end)
@@ -1,5 +1,6 @@
 local certificate = require("certificate")
 local ssl = require("ngx.ssl")
+local ocsp = require("ngx.ocsp")
 
 local function read_file(path)
   local file = assert(io.open(path, "rb"))
@@ -113,6 +114,12 @@ describe("Certificate", function()
       assert_certificate_is_set(DEFAULT_CERT)
     end)
 
+    it("uses default certificate when the server has no certificate", function()
+      set_certificate("hostname", nil, "-1")
+
+      assert_certificate_is_set(DEFAULT_CERT)
+    end)
+
     it("uses default certificate when hostname can not be obtained", function()
       ssl.server_name = function() return nil, "crazy hostname error" end
 
@@ -156,6 +163,82 @@ describe("Certificate", function()
       it("does negative caching when the request to OCSP responder fails", function()
       end)
     end)
+
+    describe("without SNI", function()
+      before_each(function()
+        ssl.server_name = function() return nil, nil end
+        set_certificate("hostname", EXAMPLE_CERT, UUID)
+        spy.on(ngx, "exit")
+      end)
+
+      after_each(function()
+        certificate.no_sni = { action = "default-certificate", server = "" }
+        ngx.shared.no_sni_handshakes:flush_all()
+      end)
+
+      it("uses the default certificate", function()
+        assert_certificate_is_set(DEFAULT_CERT)
+        assert.are.same({ ["default-certificate"] = 1 }, certificate.get_no_sni_handshakes())
+      end)
+
+      it("refuses the handshake", function()
+        certificate.no_sni = { action = "reject", server = "" }
+
+        refute_certificate_is_set()
+        assert.spy(ngx.exit).was_called_with(ngx.ERROR)
+        assert.are.same({ reject = 1 }, certificate.get_no_sni_handshakes())
+      end)
+
+      it("uses the certificate of the configured server", function()
+        certificate.no_sni = { action = "server", server = "hostname" }
+
+        assert_certificate_is_set(EXAMPLE_CERT)
+        assert.are.same({ server = 1 }, certificate.get_no_sni_handshakes())
+      end)
+    end)
+
+    describe("OCSP must-staple", function()
+      before_each(function()
+        set_certificate("hostname", EXAMPLE_CERT, UUID)
+        ngx.shared.ocsp_must_staple:set(UUID, true)
+        stub(ngx.timer, "at")
+        spy.on(ngx, "exit")
+      end)
+
+      after_each(function()
+        ngx.shared.ocsp_must_staple:flush_all()
+        ngx.shared.ocsp_response_cache:flush_all()
+      end)
+
+      it("refuses the handshake when there is no OCSP response", function()
+        assert.has_no.errors(certificate.call)
+        assert.spy(ngx.exit).was_called_with(ngx.ERROR)
+        assert.stub(ngx.timer.at).was_called()
+
+        local failures = certificate.take_ocsp_stapling_failures()
+        assert.are.equal(1, failures[UUID].count)
+        assert.are.equal("no OCSP response available", failures[UUID].error)
+
+        assert.are.same({}, certificate.take_ocsp_stapling_failures())
+      end)
+
+      it("staples the cached OCSP response even when OCSP stapling is disabled", function()
+        ngx.shared.ocsp_response_cache:set(UUID, "ocsp response")
+        stub(ocsp, "set_ocsp_status_resp", function() return true, nil end)
+
+        assert.has_no.errors(certificate.call)
+        assert.stub(ocsp.set_ocsp_status_resp).was_called_with("ocsp response")
+        assert.spy(ngx.exit).was_not_called()
+        assert.are.same({}, certificate.take_ocsp_stapling_failures())
+      end)
+
+      it("does not refuse the handshakes of the other certificates", function()
+        ngx.shared.ocsp_must_staple:delete(UUID)
+
+        assert.has_no.errors(certificate.call)
+        assert.spy(ngx.exit).was_not_called()
+      end)
+    end)
   end)
 
   describe("configured_for_current_request", function()
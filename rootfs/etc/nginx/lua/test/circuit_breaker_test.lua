@@ -0,0 +1,124 @@
+local function backend(config)
+  return {
+    name = "default-app-80",
+    circuitBreaker = config,
+    endpoints = {
+      { address = "10.0.0.1", port = "8080" },
+      { address = "10.0.0.2", port = "8080" },
+    },
+  }
+end
+
+local CONSECUTIVE = { consecutiveErrors = 3, errorRate = 0, window = 10, minRequests = 10, cooldown = 30 }
+local RATE = { consecutiveErrors = 0, errorRate = 50, window = 10, minRequests = 4, cooldown = 30 }
+
+describe("circuit_breaker", function()
+  local circuit_breaker
+  local now
+
+  local function respond(peer, status)
+    ngx.var = { upstream_addr = peer, upstream_status = status }
+    circuit_breaker.record("default-app-80")
+  end
+
+  before_each(function()
+    circuit_breaker = require_without_cache("circuit_breaker")
+    ngx.shared.circuit_breaker:flush_all()
+    stub(ngx, "log")
+    now = 1000
+    stub(ngx, "now", function() return now end)
+  end)
+
+  after_each(function()
+    ngx.var = {}
+  end)
+
+  it("returns the backend when the circuit breaker is not configured", function()
+    local b = backend(nil)
+
+    assert.are.same(b, circuit_breaker.filter(b))
+
+    respond("10.0.0.1:8080", "500")
+    assert.is_nil(ngx.shared.circuit_breaker:get("default-app-80|10.0.0.1:8080|consecutive"))
+    assert.is_false(circuit_breaker.has_changed())
+  end)
+
+  it("ejects an endpoint after consecutive errors", function()
+    circuit_breaker.filter(backend(CONSECUTIVE))
+
+    respond("10.0.0.1:8080", "500")
+    respond("10.0.0.1:8080", "502")
+    assert.is_false(circuit_breaker.has_changed())
+
+    respond("10.0.0.2:8080, 10.0.0.1:8080", "502, 503")
+    assert.is_true(circuit_breaker.has_changed())
+
+    circuit_breaker.reset_changed()
+    local filtered = circuit_breaker.filter(backend(CONSECUTIVE))
+    assert.are.same({ { address = "10.0.0.2", port = "8080" } }, filtered.endpoints)
+    -- the backends are synced again only when the cooldown ends
+    assert.is_false(circuit_breaker.has_changed())
+
+    now = now + CONSECUTIVE.cooldown
+    assert.is_true(circuit_breaker.has_changed())
+  end)
+
+  it("resets the consecutive errors after a successful response", function()
+    circuit_breaker.filter(backend(CONSECUTIVE))
+
+    respond("10.0.0.1:8080", "500")
+    respond("10.0.0.1:8080", "500")
+    respond("10.0.0.1:8080", "200")
+    respond("10.0.0.1:8080", "500")
+
+    assert.is_false(circuit_breaker.has_changed())
+    assert.are.equal(2, #circuit_breaker.filter(backend(CONSECUTIVE)).endpoints)
+  end)
+
+  it("ejects an endpoint over the error rate of the window", function()
+    circuit_breaker.filter(backend(RATE))
+
+    respond("10.0.0.1:8080", "500")
+    respond("10.0.0.1:8080", "200")
+    respond("10.0.0.1:8080", "500")
+    assert.is_false(circuit_breaker.has_changed())
+
+    respond("10.0.0.1:8080", "200")
+    assert.is_true(circuit_breaker.has_changed())
+    assert.is_true(ngx.shared.circuit_breaker:get("default-app-80|10.0.0.1:8080|ejected"))
+  end)
+
+  it("does not eject an endpoint under the error rate", function()
+    circuit_breaker.filter(backend(RATE))
+
+    respond("10.0.0.1:8080", "500")
+    for _ = 1, 4 do
+      respond("10.0.0.1:8080", "200")
+    end
+
+    assert.is_false(circuit_breaker.has_changed())
+  end)
+
+  it("returns all the endpoints when all of them are ejected", function()
+    ngx.shared.circuit_breaker:set("default-app-80|10.0.0.1:8080|ejected", true, 30)
+    ngx.shared.circuit_breaker:set("default-app-80|10.0.0.2:8080|ejected", true, 10)
+    local b = backend(CONSECUTIVE)
+
+    assert.are.same(b.endpoints, circuit_breaker.filter(b).endpoints)
+    assert.is_false(circuit_breaker.has_changed())
+
+    -- the first ejection that ends adds its endpoint back
+    now = now + 10
+    assert.is_true(circuit_breaker.has_changed())
+  end)
+
+  it("ignores the requests without response of the backend", function()
+    circuit_breaker.filter(backend(CONSECUTIVE))
+
+    for _ = 1, 3 do
+      respond(nil, nil)
+    end
+
+    assert.is_false(circuit_breaker.has_changed())
+  end)
+end)
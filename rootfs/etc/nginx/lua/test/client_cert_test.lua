@@ -0,0 +1,55 @@
+local client_cert = require("client_cert")
+
+local function read_file(path)
+  local file = assert(io.open(path, "rb"))
+  local content = file:read("*a")
+  file:close()
+  return content
+end
+
+local CLIENT_CERT = read_file("rootfs/etc/nginx/lua/test/fixtures/client-cert.pem")
+local CLIENT_CERT_HASH = "ae3f0f548779862b2c195580785c75694f98859b123ccf8175ecc257f88c6209"
+local CLIENT_CERT_SUBJECT = "O=Example,CN=client.example.com"
+
+describe("client_cert", function()
+  describe("der()", function()
+    it("returns an empty string without certificate", function()
+      assert.are.same("", client_cert.der(nil))
+      assert.are.same("", client_cert.der(""))
+    end)
+
+    it("returns the base64 encoded DER certificate", function()
+      local der = client_cert.der(CLIENT_CERT)
+      assert.is_nil(string.find(der, "[%s%-]"))
+      assert.is_not_nil(ngx.decode_base64(der))
+    end)
+  end)
+
+  describe("subject_alt_names()", function()
+    it("returns the DNS and URI entries", function()
+      local der = ngx.decode_base64(client_cert.der(CLIENT_CERT))
+      local names = client_cert.subject_alt_names(der)
+      assert.are.same({ "client.example.com", "api.example.com" }, names.dns)
+      assert.are.same({ "spiffe://cluster.local/ns/default/sa/client" }, names.uri)
+    end)
+
+    it("returns no entries for invalid certificates", function()
+      assert.are.same({ dns = {}, uri = {} }, client_cert.subject_alt_names("invalid"))
+    end)
+  end)
+
+  describe("xfcc()", function()
+    it("returns an empty string without certificate", function()
+      assert.are.same("", client_cert.xfcc("", "", ""))
+    end)
+
+    it("returns the certificate formatted as XFCC header", function()
+      local xfcc = client_cert.xfcc(CLIENT_CERT, "escaped-pem", CLIENT_CERT_SUBJECT)
+      assert.are.same("Hash=" .. CLIENT_CERT_HASH ..
+        ';Cert="escaped-pem"' ..
+        ';Subject="' .. CLIENT_CERT_SUBJECT .. '"' ..
+        ";URI=spiffe://cluster.local/ns/default/sa/client" ..
+        ";DNS=client.example.com;DNS=api.example.com", xfcc)
+    end)
+  end)
+end)
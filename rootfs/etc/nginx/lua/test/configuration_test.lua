@@ -1,5 +1,6 @@
 local cjson = require("cjson")
 local configuration = require("configuration")
+local certificate = require("certificate")
 
 local unmocked_ngx = _G.ngx
 local certificate_data = ngx.shared.certificate_data
@@ -268,6 +269,26 @@ describe("Configuration", function()
       assert.same(ngx.HTTP_CREATED, ngx.status)
     end)
 
+    it("enforces OCSP stapling for the must-staple certificates", function()
+      local uuid2 = "8ea8adb5-8ebb-4b14-a79b-0cdcd892e999"
+      ngx.shared.ocsp_must_staple:set(uuid2, true)
+      local s = stub(certificate, "prefetch_ocsp_response")
+
+      mock_ssl_configuration({
+        servers = { ["hostname"] = UUID, ["hostname2"] = uuid2 },
+        certificates = { [UUID] = "pemCertKey", [uuid2] = "pemCertKey2" },
+        must_staple = { [UUID] = true },
+      })
+
+      assert.has_no.errors(configuration.handle_servers)
+      assert.is_true(ngx.shared.ocsp_must_staple:get(UUID))
+      assert.is_nil(ngx.shared.ocsp_must_staple:get(uuid2))
+      assert.stub(s).was_called_with(UUID, "pemCertKey")
+      assert.same(ngx.HTTP_CREATED, ngx.status)
+
+      ngx.shared.ocsp_must_staple:flush_all()
+    end)
+
     it("should log an err and set status to Internal Server Error when a certificate cannot be set", function()
       local uuid2 = "8ea8adb5-8ebb-4b14-a79b-0cdcd892e999"
       ngx.shared.certificate_data.set = function(self, uuid, certificate)
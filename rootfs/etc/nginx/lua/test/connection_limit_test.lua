@@ -0,0 +1,77 @@
+describe("connection_limit", function()
+  local connection_limit
+  local request_state = require("request_state")
+  local config = {
+    namespace = "31285d47b1504dcfbd6f12c46d769f6e",
+    limit = 1,
+    key = { { "", "", "remote_addr", "" } },
+    status_code = 503,
+  }
+  local key = "31285d47b1504dcfbd6f12c46d769f6e|/ws|10.0.0.1"
+
+  before_each(function()
+    connection_limit = require_without_cache("connection_limit")
+    ngx.shared.connections_per_key:flush_all()
+    ngx.var = { remote_addr = "10.0.0.1", location_path = "/ws", request_id = "4b3a2e1f" }
+    ngx.ctx = {}
+    request_state.clear()
+    stub(ngx, "exit")
+  end)
+
+  it("does nothing when the limit is not configured", function()
+    connection_limit.acquire({ namespace = "", limit = 0, key = {}, status_code = 503 })
+    assert.is_nil(request_state.get("connection_limit"))
+  end)
+
+  it("takes and releases slots", function()
+    connection_limit.acquire(config)
+    assert.stub(ngx.exit).was_not_called()
+    assert.are.equal(1, connection_limit.get(key))
+
+    connection_limit.release()
+    assert.are.equal(0, connection_limit.get(key))
+
+    -- releasing twice does not free additional slots
+    connection_limit.release()
+    assert.are.equal(0, connection_limit.get(key))
+  end)
+
+  it("releases the slots after the internal redirects", function()
+    connection_limit.acquire(config)
+    assert.are.equal(1, connection_limit.get(key))
+
+    -- error_page resets ngx.ctx before the log phase
+    ngx.ctx = {}
+    connection_limit.release()
+    assert.are.equal(0, connection_limit.get(key))
+  end)
+
+  it("does not count below zero when the counter expired", function()
+    connection_limit.acquire(config)
+    ngx.shared.connections_per_key:delete(key)
+
+    connection_limit.release()
+    assert.are.equal(0, connection_limit.get(key))
+  end)
+
+  it("rejects the connections of a key over the limit", function()
+    ngx.shared.connections_per_key:set(key, 1)
+
+    connection_limit.acquire(config)
+    assert.stub(ngx.exit).was_called_with(503)
+    assert.are.equal(1, connection_limit.get(key))
+    assert.is_nil(request_state.get("connection_limit"))
+  end)
+
+  it("counts the keys and the paths separately", function()
+    ngx.shared.connections_per_key:set(key, 1)
+
+    ngx.var = { remote_addr = "10.0.0.2", location_path = "/ws", request_id = "5c4b3f2a" }
+    connection_limit.acquire(config)
+    assert.stub(ngx.exit).was_not_called()
+
+    ngx.var = { remote_addr = "10.0.0.1", location_path = "/events", request_id = "6d5c4a3b" }
+    connection_limit.acquire(config)
+    assert.stub(ngx.exit).was_not_called()
+  end)
+end)
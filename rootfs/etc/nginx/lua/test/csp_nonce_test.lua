@@ -0,0 +1,39 @@
+describe("csp_nonce", function()
+  local csp_nonce
+  local random = require("resty.random")
+
+  before_each(function()
+    csp_nonce = require_without_cache("csp_nonce")
+  end)
+
+  after_each(function()
+    random.bytes:revert()
+  end)
+
+  it("encodes strong random bytes", function()
+    stub(random, "bytes", function(len, strong)
+      assert.are.equal(16, len)
+      assert.is_true(strong)
+      return string.rep("a", len)
+    end)
+
+    assert.are.equal(ngx.encode_base64(string.rep("a", 16)), csp_nonce.generate())
+  end)
+
+  it("falls back to pseudo-random bytes", function()
+    stub(random, "bytes", function(len, strong)
+      if strong then
+        return nil
+      end
+      return string.rep("b", len)
+    end)
+
+    assert.are.equal(ngx.encode_base64(string.rep("b", 16)), csp_nonce.generate())
+  end)
+
+  it("never returns an empty nonce", function()
+    stub(random, "bytes", function() return nil end)
+
+    assert.has_error(function() csp_nonce.generate() end, "random bytes unavailable for the CSP nonce")
+  end)
+end)
@@ -0,0 +1,153 @@
+local function backend(drain_timeout, endpoints)
+  return {
+    name = "default-app-80",
+    drainTimeout = drain_timeout,
+    endpoints = endpoints,
+  }
+end
+
+local endpoint1 = { address = "10.0.0.1", port = "8080" }
+local endpoint2 = { address = "10.0.0.2", port = "8080" }
+
+local function draining(endpoint, ring_id, ring)
+  return { address = endpoint.address, port = endpoint.port, ring_id = ring_id, ring = ring }
+end
+
+describe("drain", function()
+  local drain
+  local now
+
+  before_each(function()
+    ngx.shared.drain:flush_all()
+    drain = require_without_cache("drain")
+    now = 1000
+    stub(ngx, "now", function() return now end)
+  end)
+
+  it("returns the backend when the drain timeout is not configured", function()
+    drain.filter(backend(0, { endpoint1, endpoint2 }))
+
+    local b = backend(0, { endpoint1 })
+    assert.are.same(b, drain.filter(b))
+    assert.is_false(drain.has_pending())
+  end)
+
+  it("drains the removed endpoints until the timeout", function()
+    drain.filter(backend(30, { endpoint1, endpoint2 }))
+    assert.is_false(drain.has_pending())
+
+    local filtered = drain.filter(backend(30, { endpoint1 }))
+    assert.are.same({ endpoint1 }, filtered.endpoints)
+    assert.are.same({ draining(endpoint2, "1", { endpoint1, endpoint2 }) }, filtered.drainingEndpoints)
+    assert.is_true(drain.has_pending())
+
+    now = now + 29
+    assert.are.same({ draining(endpoint2, "1", { endpoint1, endpoint2 }) },
+      drain.filter(backend(30, { endpoint1 })).drainingEndpoints)
+
+    drain.reset_pending()
+    now = now + 1
+    assert.is_nil(drain.filter(backend(30, { endpoint1 })).drainingEndpoints)
+    assert.is_false(drain.has_pending())
+  end)
+
+  it("stops draining the endpoints added back", function()
+    drain.filter(backend(30, { endpoint1, endpoint2 }))
+    drain.filter(backend(30, { endpoint1 }))
+
+    local filtered = drain.filter(backend(30, { endpoint1, endpoint2 }))
+    assert.is_nil(filtered.drainingEndpoints)
+    assert.are.same({ endpoint1, endpoint2 }, filtered.endpoints)
+  end)
+
+  it("shares the draining endpoints with the other workers", function()
+    drain.filter(backend(30, { endpoint1, endpoint2 }))
+    drain.filter(backend(30, { endpoint1 }))
+
+    -- a worker started by a reload, after the removal
+    local other = require_without_cache("drain")
+    now = now + 10
+    assert.are.same({ draining(endpoint2, "1", { endpoint1, endpoint2 }) },
+      other.filter(backend(30, { endpoint1 })).drainingEndpoints)
+    assert.is_true(other.has_pending())
+
+    now = now + 20
+    assert.is_nil(other.filter(backend(30, { endpoint1 })).drainingEndpoints)
+  end)
+
+  it("reads the draining endpoints while another worker updates them", function()
+    drain.filter(backend(30, { endpoint1, endpoint2 }))
+    drain.filter(backend(30, { endpoint1 }))
+    drain.reset_pending()
+
+    local lock = require("resty.lock"):new("drain")
+    assert.is_truthy(lock:lock("lock|default-app-80"))
+    finally(function() lock:unlock() end)
+
+    assert.are.same({ draining(endpoint2, "1", { endpoint1, endpoint2 }) },
+      drain.filter(backend(30, { endpoint1 })).drainingEndpoints)
+    assert.is_true(drain.has_pending())
+  end)
+
+  it("forgets the removed backends", function()
+    drain.filter(backend(30, { endpoint1, endpoint2 }))
+    drain.remove("default-app-80")
+
+    assert.is_nil(drain.filter(backend(30, { endpoint1 })).drainingEndpoints)
+  end)
+
+  describe("balance()", function()
+    local nodes = { ["10.0.0.1:8080"] = 1, ["10.0.0.2:8080"] = 1 }
+
+    local function balancer(key, upstream)
+      return {
+        affinity_key = function() return key, upstream end,
+        new_instance = function(_, ring_nodes)
+          assert.are.same(nodes, ring_nodes)
+          return { find = function(_, k) return k end }
+        end,
+      }
+    end
+
+    local b = backend(30, { endpoint1 })
+    b.drainingEndpoints = { draining(endpoint2, "1", { endpoint1, endpoint2 }) }
+
+    it("returns the draining endpoint of the session", function()
+      local instance = balancer("10.0.0.2:8080")
+      drain.attach(instance, b)
+      assert.equal("10.0.0.2:8080", drain.balance(instance))
+    end)
+
+    it("returns the shared upstream when it is draining", function()
+      local instance = balancer("10.0.0.1:8080", "10.0.0.2:8080")
+      drain.attach(instance, b)
+      assert.equal("10.0.0.2:8080", drain.balance(instance))
+    end)
+
+    it("returns nil for the sessions of the other endpoints", function()
+      local instance = balancer("10.0.0.1:8080")
+      drain.attach(instance, b)
+      assert.is_nil(drain.balance(instance))
+
+      instance = balancer(nil)
+      drain.attach(instance, b)
+      assert.is_nil(drain.balance(instance))
+    end)
+
+    it("returns nil when the previous try failed", function()
+      local ngx_balancer = require("ngx.balancer")
+      stub(ngx_balancer, "get_last_failure", function() return "failed" end)
+
+      local instance = balancer("10.0.0.2:8080")
+      drain.attach(instance, b)
+      assert.is_nil(drain.balance(instance))
+    end)
+
+    it("ignores the balancers without affinity", function()
+      local instance = {}
+      drain.attach(instance, b)
+      assert.is_nil(instance.draining)
+      assert.is_nil(drain.balance(instance))
+    end)
+  end)
+end)
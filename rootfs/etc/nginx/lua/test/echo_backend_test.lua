@@ -0,0 +1,105 @@
+local cjson = require("cjson.safe")
+
+describe("echo_backend", function()
+  local echo_backend
+  local header
+  local body_data
+  local body_file
+  local output
+
+  before_each(function()
+    body_data = nil
+    body_file = nil
+    output = nil
+
+    ngx.var = {
+      scheme = "https",
+      host = "echo.example.com",
+      request_uri = "/echo?a=1",
+      uri = "/echo",
+      remote_addr = "10.0.0.1",
+      ssl_protocol = "TLSv1.3",
+      ssl_server_name = "echo.example.com",
+      namespace = "default",
+      ingress_name = "echo",
+      service_name = "app",
+      location_path = "/",
+    }
+    header = ngx.header
+    ngx.header = {}
+
+    stub(ngx, "sleep")
+    stub(ngx, "exit")
+    stub(ngx, "say", function(data) output = data end)
+    stub(ngx.req, "read_body")
+    stub(ngx.req, "get_body_data", function() return body_data end)
+    stub(ngx.req, "get_body_file", function() return body_file end)
+    stub(ngx.req, "get_method", function() return "POST" end)
+    stub(ngx.req, "get_uri_args", function() return { a = "1" } end)
+    stub(ngx.req, "http_version", function() return 1.1 end)
+    stub(ngx.req, "get_headers", function() return { ["x-test"] = "yes" } end)
+
+    echo_backend = require_without_cache("echo_backend")
+  end)
+
+  after_each(function()
+    ngx.var = {}
+    ngx.header = header
+  end)
+
+  it("echoes the request", function()
+    body_data = "hello"
+
+    echo_backend.content({ status = 200, latency = 0, latency_jitter = 0 })
+
+    assert.stub(ngx.sleep).was_not_called()
+    assert.are.equal(200, ngx.status)
+    assert.are.equal("application/json", ngx.header["Content-Type"])
+
+    local response = cjson.decode(output)
+    assert.are.equal("POST", response.method)
+    assert.are.equal("/echo?a=1", response.uri)
+    assert.are.equal("hello", response.body)
+    assert.is_false(response.body_truncated)
+    assert.are.same({ ["x-test"] = "yes" }, response.headers)
+    assert.are.equal("TLSv1.3", response.tls.protocol)
+    assert.are.equal("app", response.ingress.service)
+  end)
+
+  it("adds the latency", function()
+    echo_backend.content({ status = 200, latency = 250, latency_jitter = 0 })
+
+    assert.stub(ngx.sleep).was_called_with(0.25)
+  end)
+
+  it("adds the jitter to the latency", function()
+    stub(math, "random", function(_, max) return max end)
+    echo_backend = require_without_cache("echo_backend")
+
+    echo_backend.content({ status = 200, latency = 100, latency_jitter = 50 })
+
+    assert.stub(ngx.sleep).was_called_with(0.15)
+    math.random:revert()
+  end)
+
+  it("does not echo the bodies buffered to a file", function()
+    body_file = "/tmp/body"
+
+    echo_backend.content({ status = 200, latency = 0, latency_jitter = 0 })
+
+    local response = cjson.decode(output)
+    assert.is_nil(response.body)
+    assert.is_true(response.body_truncated)
+  end)
+
+  it("responds with the configured status", function()
+    echo_backend.content({ status = 503, latency = 0, latency_jitter = 0 })
+    assert.are.equal(503, ngx.status)
+    assert.is_not_nil(output)
+
+    output = nil
+    echo_backend.content({ status = 204, latency = 0, latency_jitter = 0 })
+    assert.are.equal(204, ngx.status)
+    assert.is_nil(output)
+  end)
+end)
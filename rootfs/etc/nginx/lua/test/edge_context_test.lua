@@ -0,0 +1,47 @@
+local cjson = require("cjson.safe")
+
+describe("edge_context", function()
+  local edge_context
+  local fields = {
+    { "country", "geoip2_city_country_code" },
+    { "canary", "proxy_alternative_upstream_name" },
+    { "tls", "ssl_protocol" },
+  }
+
+  before_each(function()
+    edge_context = require_without_cache("edge_context")
+    ngx.var = {
+      geoip2_city_country_code = "FR",
+      proxy_alternative_upstream_name = "",
+      ssl_protocol = "TLSv1.3",
+    }
+  end)
+
+  it("encodes the variables with a value as a JSON object", function()
+    edge_context.set_config({ format = "json", fields = fields })
+
+    edge_context.rewrite()
+
+    assert.are.same({ country = "FR", tls = "TLSv1.3" }, cjson.decode(ngx.var.edge_context))
+  end)
+
+  it("encodes the variables with a value as a structured field dictionary", function()
+    edge_context.set_config({ format = "structured-field", fields = fields })
+    ngx.var.proxy_alternative_upstream_name = [[default-app-"canary"-80]]
+
+    assert.are.equal([[country="FR", canary="default-app-\"canary\"-80", tls="TLSv1.3"]], edge_context.get())
+  end)
+
+  it("skips the values that are not valid structured field strings", function()
+    edge_context.set_config({ format = "structured-field", fields = fields })
+    ngx.var.geoip2_city_country_code = "\n"
+
+    assert.are.equal([[tls="TLSv1.3"]], edge_context.get())
+  end)
+
+  it("returns an empty string when no variable has a value", function()
+    edge_context.set_config({ format = "json", fields = { { "variant", "unknown" } } })
+
+    assert.are.equal("", edge_context.get())
+  end)
+end)
@@ -0,0 +1,162 @@
+describe("edge_function", function()
+  local edge_function
+  local header
+
+  before_each(function()
+    edge_function = require_without_cache("edge_function")
+    edge_function.set_config({ max_instructions = 100000, max_memory = 1024 })
+    ngx.var = { uri = "/app", remote_addr = "10.0.0.1", http_x_tenant = "acme" }
+    stub(ngx, "exit")
+    stub(ngx, "print")
+    stub(ngx, "log")
+    stub(ngx.req, "set_header")
+    stub(ngx.req, "set_uri")
+    header = ngx.header
+    ngx.header = {}
+  end)
+
+  after_each(function()
+    ngx.header = header
+    ngx.status = nil
+  end)
+
+  describe("on_request()", function()
+    it("changes the request", function()
+      edge_function.on_request([[
+        function on_request(req)
+          req.set_header("X-Tenant-Path", req.get_header("X-Tenant") .. req.get_path())
+          req.set_path("/v2" .. req.get_path())
+        end
+      ]])
+
+      assert.stub(ngx.req.set_header).was_called_with("X-Tenant-Path", "acme/app")
+      assert.stub(ngx.req.set_uri).was_called_with("/v2/app")
+      assert.stub(ngx.exit).was_not_called()
+    end)
+
+    it("answers the request", function()
+      edge_function.on_request([[
+        function on_request(req)
+          if req.get_remote_addr() == "10.0.0.1" then
+            req.respond(403, "forbidden")
+          end
+        end
+      ]])
+
+      assert.are.equal(403, ngx.status)
+      assert.stub(ngx.print).was_called_with("forbidden")
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_OK)
+    end)
+
+    it("does not expose the ngx API and the unsafe globals", function()
+      edge_function.on_request([[
+        function on_request(req)
+          if ngx or io or os or require or debug or pcall or setmetatable or load then
+            req.respond(200, "escaped")
+          end
+        end
+      ]])
+
+      assert.stub(ngx.print).was_not_called()
+      assert.stub(ngx.exit).was_not_called()
+    end)
+
+    it("does not expose rep and the pattern functions", function()
+      edge_function.on_request([[
+        function on_request(req)
+          if string.rep or string.find or string.gsub or string.gmatch or string.match then
+            req.respond(200, "escaped")
+          end
+        end
+      ]])
+
+      assert.stub(ngx.print).was_not_called()
+      assert.stub(ngx.exit).was_not_called()
+    end)
+
+    it("does not expose rep and the pattern functions as methods of the strings", function()
+      edge_function.on_request([[
+        function on_request(req)
+          req.set_header("X-Tenant", req.get_header("X-Tenant"):upper())
+          local s = ("x"):rep(1e9)
+        end
+      ]])
+
+      assert.stub(ngx.req.set_header).was_called_with("X-Tenant", "ACME")
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_INTERNAL_SERVER_ERROR)
+      -- the methods of the strings are restored after the execution
+      assert.are.equal("xx", ("x"):rep(2))
+    end)
+
+    it("does not keep state between the requests", function()
+      local code = [[
+        function on_request(req)
+          if seen then
+            req.respond(200, "state")
+          end
+          seen = true
+        end
+      ]]
+
+      edge_function.on_request(code)
+      edge_function.on_request(code)
+
+      assert.stub(ngx.print).was_not_called()
+    end)
+
+    it("stops the functions exceeding the instruction limit", function()
+      edge_function.on_request("function on_request() while true do end end")
+
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_INTERNAL_SERVER_ERROR)
+      assert.stub(ngx.log).was_called_with(ngx.ERR, "edge function failed: ", "instruction limit exceeded")
+    end)
+
+    it("stops the functions exceeding the memory limit", function()
+      edge_function.set_config({ max_instructions = 100000000, max_memory = 64 })
+
+      edge_function.on_request([[
+        function on_request()
+          local t = {}
+          for i = 1, 1000000 do
+            t[i] = { i }
+          end
+        end
+      ]])
+
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_INTERNAL_SERVER_ERROR)
+      assert.stub(ngx.log).was_called_with(ngx.ERR, "edge function failed: ", "memory limit exceeded")
+    end)
+
+    it("rejects the precompiled chunks", function()
+      edge_function.on_request(string.dump(function() end))
+
+      assert.stub(ngx.exit).was_called_with(ngx.HTTP_INTERNAL_SERVER_ERROR)
+    end)
+  end)
+
+  describe("on_response()", function()
+    it("changes the response headers", function()
+      ngx.status = 200
+      ngx.header["Server"] = "backend"
+
+      edge_function.on_response([[
+        function on_response(res)
+          if res.get_status() == 200 then
+            res.set_header("X-Edge", "1")
+            res.clear_header("Server")
+          end
+        end
+      ]])
+
+      assert.are.equal("1", ngx.header["X-Edge"])
+      assert.is_nil(ngx.header["Server"])
+    end)
+
+    it("sends the response unchanged when the function fails", function()
+      edge_function.on_response("function on_response() error('failed') end")
+
+      assert.stub(ngx.exit).was_not_called()
+      assert.stub(ngx.log).was_called()
+    end)
+  end)
+end)
@@ -0,0 +1,54 @@
+describe("error_response", function()
+  local error_response
+  local header
+
+  before_each(function()
+    error_response = require_without_cache("error_response")
+    error_response.set_config({
+      html = "<h1>{status} {reason}</h1>",
+      json = [[{"status":{status},"error":"{reason}","request_id":"{request_id}","other":"{other}"}]],
+    })
+    ngx.var = { status = "404", req_id = "abc" }
+    stub(ngx, "print")
+    header = ngx.header
+    ngx.header = {}
+  end)
+
+  after_each(function()
+    ngx.header = header
+  end)
+
+  it("renders HTML by default", function()
+    error_response.render()
+
+    assert.are.equal("text/html", ngx.header.content_type)
+    assert.stub(ngx.print).was_called_with("<h1>404 Not Found</h1>")
+  end)
+
+  it("renders JSON when the client accepts it", function()
+    ngx.var.status = "429"
+    ngx.var.http_accept = "application/json, text/plain, */*"
+
+    error_response.render()
+
+    assert.are.equal("application/json", ngx.header.content_type)
+    assert.stub(ngx.print).was_called_with(
+      [[{"status":429,"error":"Too Many Requests","request_id":"abc","other":"{other}"}]])
+  end)
+
+  it("renders unknown status codes", function()
+    ngx.var.status = "418"
+
+    error_response.render()
+
+    assert.stub(ngx.print).was_called_with("<h1>418 Error</h1>")
+  end)
+
+  it("renders the given status code", function()
+    ngx.var.status = "000"
+
+    error_response.render(431)
+
+    assert.stub(ngx.print).was_called_with("<h1>431 Request Header Fields Too Large</h1>")
+  end)
+end)
@@ -81,6 +81,7 @@ end
 
 describe("global_throttle", function()
   local snapshot
+  local header
 
   local NAMESPACE = "31285d47b1504dcfbd6f12c46d769f6e"
   local LOCATION_CONFIG = {
@@ -96,16 +97,20 @@ describe("global_throttle", function()
       connect_timeout = 50, max_idle_timeout = 10000, pool_size = 50,
     },
     status_code = 429,
+    fail_policy = "allow",
   }
 
   before_each(function()
     snapshot = assert:snapshot()
 
     ngx.var = { remote_addr = "127.0.0.1", global_rate_limit_exceeding = nil }
+    header = ngx.header
+    ngx.header = {}
   end)
 
   after_each(function()
     snapshot:revert()
+    ngx.header = header
 
     ngx.shared.global_throttle_cache:flush_all()
     reset_ngx()
@@ -148,6 +153,27 @@ describe("global_throttle", function()
     end)
   end)
 
+  it("short circuits when the request has an ignored header", function()
+    local location_config = util.deepcopy(LOCATION_CONFIG)
+    location_config.ignored_headers = { { variable = "http_x_partner_token", value = "s3cr3t" } }
+    ngx.var.http_x_partner_token = "s3cr3t"
+    assert_short_circuits(function(global_throttle)
+      assert.has_no.errors(function()
+        global_throttle.throttle(CONFIG, location_config)
+      end)
+    end)
+  end)
+
+  it("does not short circuit when the ignored header has another value", function()
+    local location_config = util.deepcopy(LOCATION_CONFIG)
+    location_config.ignored_headers = { { variable = "http_x_partner_token", value = "s3cr3t" } }
+    ngx.var.http_x_partner_token = "guess"
+
+    stub_resty_global_throttle_process(LOCATION_CONFIG.limit - 3, nil, nil, function()
+      assert_request_not_rejected(CONFIG, location_config)
+    end)
+  end)
+
   it("rejects when exceeding limit has already been cached", function()
     local key_value = "foo"
     local location_config = util.deepcopy(LOCATION_CONFIG)
@@ -157,6 +183,26 @@ describe("global_throttle", function()
     assert_request_rejected(CONFIG, location_config, { with_cache = true })
   end)
 
+  it("hashes the key with the secret when key_hash is enabled", function()
+    local configuration = require("configuration")
+    stub(configuration, "get_global_rate_limit_key_hash_secret", function() return "secret" end)
+
+    local location_config = util.deepcopy(LOCATION_CONFIG)
+    location_config.key = { { nil, nil, nil, "foo" } }
+    location_config.key_hash = true
+    -- HMAC-SHA1 of foo with the key secret
+    cache_rejection_decision(NAMESPACE, "9baed91be7f58b57c824b60da7cb262b2ecafbd2", 0.5)
+
+    assert_request_rejected(CONFIG, location_config, { with_cache = true })
+  end)
+
+  it("fails open when key_hash is enabled without a secret", function()
+    local location_config = util.deepcopy(LOCATION_CONFIG)
+    location_config.key_hash = true
+
+    assert_fails_open(CONFIG, location_config, "failed to hash key: ", "the key hash secret is not configured yet")
+  end)
+
   describe("when resty_global_throttle fails", function()
     it("fails open in case of initialization error", function()
       local too_long_namespace = ""
@@ -175,6 +221,81 @@ describe("global_throttle", function()
         assert_fails_open(CONFIG, LOCATION_CONFIG, "error while processing key: ", "failed to process")
       end)
     end)
+
+    it("rejects in case of key processing error when the fail policy is deny", function()
+      local config = util.deepcopy(CONFIG)
+      config.fail_policy = "deny"
+
+      stub_resty_global_throttle_process(nil, nil, "failed to process", function()
+        stub(ngx, "exit")
+
+        local global_throttle = require_without_cache("global_throttle")
+        assert.has_no.errors(function()
+          global_throttle.throttle(config, LOCATION_CONFIG)
+        end)
+
+        assert.stub(ngx.exit).was_called_with(config.status_code)
+        assert.are.same("e", ngx.var.global_rate_limit_exceeding)
+      end)
+    end)
+
+    it("records the error when metrics are enabled", function()
+      local config = util.deepcopy(CONFIG)
+      config.enable_metrics = true
+
+      stub_resty_global_throttle_process(nil, nil, "failed to process", function()
+        local monitor = require("monitor")
+        stub(monitor, "record_global_rate_limit_error")
+
+        assert_fails_open(config, LOCATION_CONFIG, "error while processing key: ", "failed to process")
+        assert.stub(monitor.record_global_rate_limit_error).was_called_with("allow")
+      end)
+    end)
+  end)
+
+  describe("metrics", function()
+    local config
+    local monitor
+
+    before_each(function()
+      config = util.deepcopy(CONFIG)
+      config.enable_metrics = true
+
+      monitor = require("monitor")
+      stub(monitor, "record_rate_limit")
+    end)
+
+    it("records the allowed requests", function()
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit - 3, nil, nil, function()
+        assert_request_not_rejected(config, LOCATION_CONFIG)
+      end)
+
+      assert.stub(monitor.record_rate_limit).was_called_with("allow", NAMESPACE, nil)
+    end)
+
+    it("records the rejected requests", function()
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit + 1, 0.0009, nil, function()
+        assert_request_rejected(config, LOCATION_CONFIG, { with_cache = false })
+      end)
+
+      assert.stub(monitor.record_rate_limit).was_called_with("deny", NAMESPACE, nil)
+    end)
+
+    it("records the requests rejected with the cache", function()
+      cache_rejection_decision(NAMESPACE, ngx.var.remote_addr, 0.3)
+
+      assert_request_rejected(config, LOCATION_CONFIG, { with_cache = true })
+
+      assert.stub(monitor.record_rate_limit).was_called_with("deny", NAMESPACE, nil)
+    end)
+
+    it("does not record the decisions when metrics are disabled", function()
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit - 3, nil, nil, function()
+        assert_request_not_rejected(CONFIG, LOCATION_CONFIG)
+      end)
+
+      assert.stub(monitor.record_rate_limit).was_not_called()
+    end)
   end)
 
   it("initializes resty_global_throttle with the right parameters", function()
@@ -249,6 +370,230 @@ describe("global_throttle", function()
     )
   end)
 
+  describe("decision", function()
+    local location_config
+
+    before_each(function()
+      location_config = util.deepcopy(LOCATION_CONFIG)
+      location_config.headers = true
+    end)
+
+    it("exposes the remaining requests when the request is allowed", function()
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit - 3, nil, nil, function()
+        assert_request_not_rejected(CONFIG, location_config)
+      end)
+
+      assert.are.same("allowed", ngx.var.global_rate_limit_status)
+      assert.are.same(10, ngx.var.global_rate_limit_limit)
+      assert.are.same(3, ngx.var.global_rate_limit_remaining)
+      assert.is_nil(ngx.var.global_rate_limit_retry_after)
+
+      assert.are.same(10, ngx.header["X-RateLimit-Limit"])
+      assert.are.same(3, ngx.header["X-RateLimit-Remaining"])
+      assert.is_nil(ngx.header["Retry-After"])
+    end)
+
+    it("exposes when to retry when the request is rejected", function()
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit + 1, 1.5, nil, function()
+        assert_request_rejected(CONFIG, location_config, { with_cache = false })
+      end)
+
+      assert.are.same("rejected", ngx.var.global_rate_limit_status)
+      assert.are.same(0, ngx.var.global_rate_limit_remaining)
+      assert.are.same(2, ngx.var.global_rate_limit_retry_after)
+
+      assert.are.same(10, ngx.header["X-RateLimit-Limit"])
+      assert.are.same(0, ngx.header["X-RateLimit-Remaining"])
+      assert.are.same(2, ngx.header["Retry-After"])
+    end)
+
+    it("exposes when to retry when the request is rejected with the cache", function()
+      cache_rejection_decision(NAMESPACE, ngx.var.remote_addr, 0.3)
+
+      assert_request_rejected(CONFIG, location_config, { with_cache = true })
+
+      assert.are.same("rejected", ngx.var.global_rate_limit_status)
+      assert.are.same(1, ngx.var.global_rate_limit_retry_after)
+      assert.are.same(1, ngx.header["Retry-After"])
+    end)
+
+    it("exposes the errors of the store", function()
+      stub_resty_global_throttle_process(nil, nil, "failed to process", function()
+        assert_fails_open(CONFIG, location_config, "error while processing key: ", "failed to process")
+      end)
+
+      assert.are.same("error", ngx.var.global_rate_limit_status)
+      assert.is_nil(ngx.var.global_rate_limit_remaining)
+      assert.is_nil(ngx.header["X-RateLimit-Remaining"])
+    end)
+
+    it("does not add the headers when they are not enabled", function()
+      location_config.headers = false
+
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit - 3, nil, nil, function()
+        assert_request_not_rejected(CONFIG, location_config)
+      end)
+
+      assert.are.same("allowed", ngx.var.global_rate_limit_status)
+      assert.is_nil(ngx.header["X-RateLimit-Limit"])
+      assert.is_nil(ngx.header["X-RateLimit-Remaining"])
+    end)
+  end)
+
+  describe("with burst", function()
+    local location_config
+
+    before_each(function()
+      location_config = util.deepcopy(LOCATION_CONFIG)
+      location_config.burst = 5
+      location_config.delay = 1
+      stub(ngx, "sleep")
+    end)
+
+    it("counts the burst as part of the limit of the store", function()
+      local resty_global_throttle = require_without_cache("resty.global_throttle")
+      stub(resty_global_throttle, "new", {
+        process = function(self, key) return 1, nil, nil end
+      })
+
+      assert_request_not_rejected(CONFIG, location_config)
+
+      assert.stub(resty_global_throttle.new).was_called_with(LOCATION_CONFIG.namespace,
+        LOCATION_CONFIG.limit + 5, LOCATION_CONFIG.window_size, match.is_table())
+      assert.stub(ngx.sleep).was_not_called()
+    end)
+
+    it("does not delay the first requests of the burst", function()
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit + 1, nil, nil, function()
+        assert_request_not_rejected(CONFIG, location_config)
+      end)
+
+      assert.stub(ngx.sleep).was_not_called()
+      assert.are.same("allowed", ngx.var.global_rate_limit_status)
+    end)
+
+    it("delays the next requests of the burst to the rate of the limit", function()
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit + 4, nil, nil, function()
+        assert_request_not_rejected(CONFIG, location_config)
+      end)
+
+      -- 3 requests over the limit and the delay, at 10 requests per 60 seconds
+      assert.stub(ngx.sleep).was_called_with(18)
+      assert.are.same("delayed", ngx.var.global_rate_limit_status)
+    end)
+
+    it("records the time the requests are delayed", function()
+      local config = util.deepcopy(CONFIG)
+      config.enable_metrics = true
+      local monitor = require("monitor")
+      stub(monitor, "record_rate_limit")
+
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit + 4, nil, nil, function()
+        assert_request_not_rejected(config, location_config)
+      end)
+
+      assert.stub(monitor.record_rate_limit).was_called_with("allow", NAMESPACE, 18)
+    end)
+
+    it("rejects the requests over the burst", function()
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit + 6, 1, nil, function()
+        assert_request_rejected(CONFIG, location_config, { with_cache = false })
+      end)
+
+      assert.stub(ngx.sleep).was_not_called()
+    end)
+  end)
+
+  describe("with redis", function()
+    local config
+
+    before_each(function()
+      config = util.deepcopy(CONFIG)
+      config.store = "redis"
+      config.redis = {
+        host = "redis.default.svc.cluster.local", port = 6379,
+        connect_timeout = 50, max_idle_timeout = 10000, pool_size = 50,
+      }
+    end)
+
+    it("short circuits when redis is not configured", function()
+      config.redis.host = ""
+
+      assert_short_circuits(function(global_throttle)
+        assert.has_no.errors(function()
+          global_throttle.throttle(config, LOCATION_CONFIG)
+        end)
+      end)
+    end)
+
+    it("counts the requests in redis", function()
+      local redis_throttle = require_without_cache("util.redis_throttle")
+      stub(redis_throttle, "new", {
+        process = function(self, key) return LOCATION_CONFIG.limit + 1, 0.5, nil end
+      })
+
+      assert_request_rejected(config, LOCATION_CONFIG, { with_cache = false })
+
+      assert.stub(redis_throttle.new).was_called_with(LOCATION_CONFIG.namespace,
+        LOCATION_CONFIG.limit, LOCATION_CONFIG.window_size, config.redis)
+    end)
+
+    it("uses the store of the location", function()
+      config.store = "memcached"
+      local location_config = util.deepcopy(LOCATION_CONFIG)
+      location_config.store = "redis"
+
+      local redis_throttle = require_without_cache("util.redis_throttle")
+      stub(redis_throttle, "new", {
+        process = function(self, key) return LOCATION_CONFIG.limit + 1, 0.5, nil end
+      })
+
+      assert_request_rejected(config, location_config, { with_cache = false })
+
+      assert.stub(redis_throttle.new).was_called_with(LOCATION_CONFIG.namespace,
+        LOCATION_CONFIG.limit, LOCATION_CONFIG.window_size, config.redis)
+    end)
+  end)
+
+  describe("with buckets", function()
+    local BUCKET_NAMESPACE = "9a1c7e0d5b1d4e6fa0b2c3d4e5f60718"
+    local location_config
+
+    before_each(function()
+      location_config = util.deepcopy(LOCATION_CONFIG)
+      location_config.buckets = {
+        { name = "login", namespace = BUCKET_NAMESPACE, limit = 1, window_size = 60, paths = { "/login" } },
+      }
+    end)
+
+    it("uses the bucket of the path of the location", function()
+      ngx.var.location_path = "/login"
+      cache_rejection_decision(BUCKET_NAMESPACE, ngx.var.remote_addr, 0.3)
+
+      assert_request_rejected(CONFIG, location_config, { with_cache = true })
+    end)
+
+    it("uses the limit of the location for the paths without bucket", function()
+      ngx.var.location_path = "/"
+      cache_rejection_decision(BUCKET_NAMESPACE, ngx.var.remote_addr, 0.3)
+
+      stub_resty_global_throttle_process(LOCATION_CONFIG.limit - 3, nil, nil, function()
+        assert_request_not_rejected(CONFIG, location_config)
+      end)
+    end)
+
+    it("short circuits for the paths without bucket when the location has no limit", function()
+      ngx.var.location_path = "/"
+      location_config.limit = 0
+
+      assert_short_circuits(function(global_throttle)
+        assert.has_no.errors(function()
+          global_throttle.throttle(CONFIG, location_config)
+        end)
+      end)
+    end)
+  end)
+
   it("rejects with custom status code", function()
     cache_rejection_decision(NAMESPACE, ngx.var.remote_addr, 0.3)
     local config = util.deepcopy(CONFIG)
@@ -0,0 +1,171 @@
+local function backend(config)
+  return {
+    name = "default-app-80",
+    healthCheck = config,
+    endpoints = {
+      { address = "10.0.0.1", port = "8080" },
+      { address = "10.0.0.2", port = "8080" },
+    },
+  }
+end
+
+local HTTP = { path = "/healthz", interval = 10, timeout = 5000 }
+local GRPC = { grpc = true, grpcService = "app.v1.App", interval = 10, timeout = 5000 }
+
+describe("health_check", function()
+  local health_check
+  local http
+  local requests
+  local response
+
+  before_each(function()
+    requests = {}
+    response = { status = 200, body = "", headers = {} }
+
+    http = package.loaded["resty.http"]
+    package.loaded["resty.http"] = {
+      new = function()
+        return {
+          set_timeout = function() end,
+          request_uri = function(_, uri, params)
+            table.insert(requests, { uri = uri, params = params })
+            return response
+          end,
+        }
+      end,
+    }
+
+    health_check = require_without_cache("health_check")
+    health_check.status_port = "10246"
+    ngx.shared.health_check:flush_all()
+    stub(ngx, "log")
+    stub(ngx.timer, "at", function() return true end)
+  end)
+
+  after_each(function()
+    package.loaded["resty.http"] = http
+  end)
+
+  it("returns the backend when the check is not configured", function()
+    local b = backend({ path = "", interval = 10 })
+
+    assert.are.same(b, health_check.filter(b))
+
+    health_check.run(false)
+    assert.stub(ngx.timer.at).was_not_called()
+  end)
+
+  it("checks each endpoint once in each interval", function()
+    health_check.filter(backend(HTTP))
+
+    health_check.run(false)
+    health_check.run(false)
+
+    assert.stub(ngx.timer.at).was_called(2)
+  end)
+
+  it("stops the checks of the removed backends", function()
+    health_check.filter(backend(HTTP))
+    health_check.remove("default-app-80")
+
+    health_check.run(false)
+
+    assert.stub(ngx.timer.at).was_not_called()
+  end)
+
+  it("removes an endpoint after consecutive failed checks", function()
+    local endpoint = { address = "10.0.0.1", port = "8080" }
+    response.status = 503
+
+    health_check.check(false, "default-app-80|10.0.0.1:8080", HTTP, endpoint)
+    assert.is_false(health_check.has_changed())
+    assert.are.equal("http://10.0.0.1:8080/healthz", requests[1].uri)
+
+    health_check.check(false, "default-app-80|10.0.0.1:8080", HTTP, endpoint)
+    assert.is_true(health_check.has_changed())
+
+    health_check.reset_changed()
+    local filtered = health_check.filter(backend(HTTP))
+    assert.are.same({ { address = "10.0.0.2", port = "8080" } }, filtered.endpoints)
+  end)
+
+  it("adds an endpoint back after a successful check", function()
+    local endpoint = { address = "10.0.0.1", port = "8080" }
+    ngx.shared.health_check:set("default-app-80|10.0.0.1:8080|unhealthy", true)
+
+    health_check.check(false, "default-app-80|10.0.0.1:8080", HTTP, endpoint)
+
+    assert.is_true(health_check.has_changed())
+    assert.are.equal(2, #health_check.filter(backend(HTTP)).endpoints)
+  end)
+
+  it("returns all the endpoints when none of them is healthy", function()
+    ngx.shared.health_check:set("default-app-80|10.0.0.1:8080|unhealthy", true)
+    ngx.shared.health_check:set("default-app-80|10.0.0.2:8080|unhealthy", true)
+    local b = backend(HTTP)
+
+    assert.are.same(b.endpoints, health_check.filter(b).endpoints)
+  end)
+
+  it("checks the endpoints of the HTTPS backends with TLS", function()
+    local endpoint = { address = "10.0.0.1", port = "8443" }
+
+    health_check.check(false, "default-app-443|10.0.0.1:8443",
+      { path = "/healthz", tls = true, interval = 10, timeout = 5000 }, endpoint)
+
+    assert.are.equal("https://10.0.0.1:8443/healthz", requests[1].uri)
+    assert.is_false(requests[1].params.ssl_verify)
+  end)
+
+  it("does not send the checks with CR or LF in the request line", function()
+    local endpoint = { address = "10.0.0.1", port = "8080" }
+
+    health_check.check(false, "default-app-80|10.0.0.1:8080",
+      { path = "/healthz\r\nX-Injected: true", interval = 10, timeout = 5000 }, endpoint)
+
+    assert.are.equal(0, #requests)
+    assert.are.equal(1, ngx.shared.health_check:get("default-app-80|10.0.0.1:8080|failures"))
+  end)
+
+  it("sends the gRPC checks through the status server", function()
+    local endpoint = { address = "10.0.0.1", port = "50051" }
+    response.body = string.char(0, 0, 0, 0, 2, 0x08, 0x01)
+
+    health_check.check(false, "default-app-80|10.0.0.1:50051", GRPC, endpoint)
+
+    assert.are.equal("http://127.0.0.1:10246/grpc.health.v1.Health/Check", requests[1].uri)
+    assert.are.equal("10.0.0.1:50051", requests[1].params.headers["X-Health-Check-Target"])
+    assert.are.equal("grpc", requests[1].params.headers["X-Health-Check-Scheme"])
+    assert.are.equal(health_check.grpc_request("app.v1.App"), requests[1].params.body)
+    assert.is_nil(ngx.shared.health_check:get("default-app-80|10.0.0.1:50051|failures"))
+  end)
+
+  it("sends the gRPC checks of the GRPCS backends with TLS", function()
+    local endpoint = { address = "10.0.0.1", port = "50051" }
+    response.body = string.char(0, 0, 0, 0, 2, 0x08, 0x01)
+
+    health_check.check(false, "default-app-80|10.0.0.1:50051",
+      { grpc = true, grpcService = "", grpcTLS = true, interval = 10, timeout = 5000 }, endpoint)
+
+    assert.are.equal("grpcs", requests[1].params.headers["X-Health-Check-Scheme"])
+  end)
+
+  it("fails the gRPC checks of the services not serving", function()
+    local endpoint = { address = "10.0.0.1", port = "50051" }
+    -- status NOT_SERVING
+    response.body = string.char(0, 0, 0, 0, 2, 0x08, 0x02)
+
+    health_check.check(false, "default-app-80|10.0.0.1:50051", GRPC, endpoint)
+
+    assert.are.equal(1, ngx.shared.health_check:get("default-app-80|10.0.0.1:50051|failures"))
+  end)
+
+  it("encodes the gRPC health check requests", function()
+    assert.are.equal(string.char(0, 0, 0, 0, 0), health_check.grpc_request(""))
+    assert.are.equal(string.char(0, 0, 0, 0, 5, 0x0a, 3) .. "app", health_check.grpc_request("app"))
+
+    local service = string.rep("a", 200)
+    assert.are.equal(string.char(0, 0, 0, 0, 203, 0x0a, 0xc8, 0x01) .. service,
+      health_check.grpc_request(service))
+  end)
+end)
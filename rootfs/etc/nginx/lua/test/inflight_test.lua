@@ -0,0 +1,110 @@
+describe("inflight", function()
+  local inflight
+  local header
+  local config = { limit = 1, queue_size = 0, queue_timeout = 100, retry_after = 2 }
+
+  before_each(function()
+    inflight = require_without_cache("inflight")
+    ngx.shared.inflight_requests:flush_all()
+    ngx.var = { proxy_upstream_name = "default-app-80", request_id = "4b3a2e1f" }
+    ngx.ctx = {}
+    require("request_state").clear()
+    stub(ngx, "exit")
+    header = ngx.header
+    ngx.header = {}
+  end)
+
+  after_each(function()
+    ngx.header = header
+  end)
+
+  it("does nothing when the limit is not configured", function()
+    inflight.acquire({ limit = 0, queue_size = 0, queue_timeout = 0, retry_after = 0 })
+    assert.are.equal(0, inflight.get("default-app-80"))
+
+    inflight.release()
+    assert.are.equal(0, inflight.get("default-app-80"))
+  end)
+
+  it("takes and releases slots", function()
+    inflight.acquire(config)
+    assert.stub(ngx.exit).was_not_called()
+    assert.are.equal(1, inflight.get("default-app-80"))
+
+    inflight.release()
+    assert.are.equal(0, inflight.get("default-app-80"))
+
+    -- releasing twice does not free additional slots
+    inflight.release()
+    assert.are.equal(0, inflight.get("default-app-80"))
+  end)
+
+  it("releases the slot of internally redirected requests", function()
+    inflight.acquire(config)
+    assert.are.equal(1, inflight.get("default-app-80"))
+
+    -- error_page resets ngx.ctx and runs the rewrite phase of the error location
+    ngx.ctx = {}
+    inflight.acquire(config)
+    assert.stub(ngx.exit).was_not_called()
+    assert.are.equal(1, inflight.get("default-app-80"))
+
+    inflight.release()
+    assert.are.equal(0, inflight.get("default-app-80"))
+  end)
+
+  it("does not count below zero when the counter expired", function()
+    inflight.acquire(config)
+    ngx.shared.inflight_requests:delete("default-app-80")
+
+    inflight.release()
+    assert.are.equal(0, inflight.get("default-app-80"))
+  end)
+
+  it("rejects requests over the limit with Retry-After", function()
+    ngx.shared.inflight_requests:set("default-app-80", 1)
+
+    inflight.acquire(config)
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_SERVICE_UNAVAILABLE)
+    assert.are.equal(2, ngx.header["Retry-After"])
+    assert.are.equal(1, inflight.get("default-app-80"))
+
+    -- the rejected request does not release the slot of another one
+    inflight.release()
+    assert.are.equal(1, inflight.get("default-app-80"))
+  end)
+
+  it("queues requests until a slot is released", function()
+    ngx.shared.inflight_requests:set("default-app-80", 1)
+    stub(ngx, "sleep", function()
+      ngx.shared.inflight_requests:set("default-app-80", 0)
+    end)
+    inflight = require_without_cache("inflight")
+
+    inflight.acquire({ limit = 1, queue_size = 1, queue_timeout = 1000, retry_after = 1 })
+    assert.stub(ngx.exit).was_not_called()
+    assert.are.equal(1, inflight.get("default-app-80"))
+    assert.are.equal(0, inflight.get("queue|default-app-80"))
+  end)
+
+  it("rejects requests when the queue is full", function()
+    ngx.shared.inflight_requests:set("default-app-80", 1)
+    ngx.shared.inflight_requests:set("queue|default-app-80", 1)
+
+    inflight.acquire({ limit = 1, queue_size = 1, queue_timeout = 1000, retry_after = 1 })
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_SERVICE_UNAVAILABLE)
+    assert.are.equal(1, inflight.get("queue|default-app-80"))
+  end)
+
+  it("rejects queued requests when the wait times out", function()
+    ngx.shared.inflight_requests:set("default-app-80", 1)
+    local now = 1000
+    stub(ngx, "now", function() return now end)
+    stub(ngx, "sleep", function(seconds) now = now + seconds end)
+    inflight = require_without_cache("inflight")
+
+    inflight.acquire({ limit = 1, queue_size = 1, queue_timeout = 200, retry_after = 1 })
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_SERVICE_UNAVAILABLE)
+    assert.are.equal(0, inflight.get("queue|default-app-80"))
+  end)
+end)
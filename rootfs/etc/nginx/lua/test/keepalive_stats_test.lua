@@ -0,0 +1,77 @@
+local keepalive_stats = require("keepalive_stats")
+
+local function request(backend, connect_times)
+  ngx.ctx = {}
+  ngx.var = { request_id = "4b3a2e1f", upstream_connect_time = connect_times }
+
+  keepalive_stats.start(backend)
+  -- retries must not be accounted as new requests
+  keepalive_stats.start(backend)
+end
+
+describe("keepalive_stats", function()
+  before_each(function()
+    ngx.shared.upstream_keepalive_stats:flush_all()
+    keepalive_stats.set_config({ enable_metrics = true, upstream_keepalive_connections = 320 })
+  end)
+
+  after_each(function()
+    ngx.ctx = {}
+  end)
+
+  it("does nothing when metrics are disabled", function()
+    keepalive_stats.set_config({ enable_metrics = false })
+
+    request("default-http-svc-80", "0.000")
+    keepalive_stats.finish()
+
+    assert.are.same({}, ngx.shared.upstream_keepalive_stats:get_keys(0))
+  end)
+
+  it("counts the requests in flight", function()
+    request("default-http-svc-80", "0.001")
+    assert.are.same({ active = 1, reused = 0, new = 0 },
+      keepalive_stats.get().backends["default-http-svc-80"])
+
+    keepalive_stats.finish()
+    assert.are.same({ active = 0, reused = 0, new = 1 },
+      keepalive_stats.get().backends["default-http-svc-80"])
+
+    -- the log phase runs only once per request
+    keepalive_stats.finish()
+    assert.are.same({ active = 0, reused = 0, new = 1 },
+      keepalive_stats.get().backends["default-http-svc-80"])
+  end)
+
+  it("tells apart reused and new connections of every try", function()
+    request("default-http-svc-80", "0.000, 0.002, -, 0.000")
+    keepalive_stats.finish()
+
+    request("default-echo-80", "-")
+    keepalive_stats.finish()
+
+    local stats = keepalive_stats.get()
+    assert.are.equal(320, stats.keepalive_connections)
+    assert.are.same({
+      ["default-http-svc-80"] = { active = 0, reused = 2, new = 1 },
+      ["default-echo-80"] = { active = 0, reused = 0, new = 0 },
+    }, stats.backends)
+  end)
+
+  it("accounts the tries of every location of internally redirected requests", function()
+    request("default-http-svc-80", "0.002, 0.000 : 0.000")
+    -- the error page is proxied to the default backend, ngx.ctx is reset
+    ngx.ctx = {}
+    keepalive_stats.start("upstream-default-backend")
+    assert.are.same({ active = 1, reused = 0, new = 0 },
+      keepalive_stats.get().backends["default-http-svc-80"])
+
+    keepalive_stats.finish()
+
+    local stats = keepalive_stats.get()
+    assert.are.same({
+      ["default-http-svc-80"] = { active = 0, reused = 1, new = 1 },
+      ["upstream-default-backend"] = { active = 0, reused = 1, new = 0 },
+    }, stats.backends)
+  end)
+end)
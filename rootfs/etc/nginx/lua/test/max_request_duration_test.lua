@@ -0,0 +1,71 @@
+local ngx_balancer = require("ngx.balancer")
+
+describe("max_request_duration", function()
+  local max_request_duration
+  local now
+  local config = { duration = 30, connect_timeout = 5, send_timeout = 60, read_timeout = 60 }
+
+  before_each(function()
+    max_request_duration = require_without_cache("max_request_duration")
+    now = 1000
+    stub(ngx, "now", function() return now end)
+    stub(ngx.req, "start_time", function() return 1000 end)
+    stub(ngx, "exit")
+    stub(ngx_balancer, "set_timeouts", function() return true end)
+    ngx.ctx = {}
+    ngx.var = { status = "200" }
+  end)
+
+  it("does nothing when the duration is not limited", function()
+    max_request_duration.rewrite({ duration = 0 })
+    max_request_duration.balance()
+
+    assert.is_nil(ngx.ctx.max_request_duration)
+    assert.stub(ngx_balancer.set_timeouts).was_not_called()
+    assert.is_nil(max_request_duration.body_filter())
+    assert.is_false(max_request_duration.exceeded())
+  end)
+
+  it("reduces the timeouts of the upstream to the time left", function()
+    max_request_duration.rewrite(config)
+    assert.stub(ngx.exit).was_not_called()
+
+    now = now + 10
+    max_request_duration.balance()
+    assert.stub(ngx_balancer.set_timeouts).was_called_with(5, 20, 20)
+
+    now = now + 19.5
+    max_request_duration.balance()
+    assert.stub(ngx_balancer.set_timeouts).was_called_with(0.5, 0.5, 0.5)
+  end)
+
+  it("rejects the requests whose body was received after the deadline", function()
+    now = now + 31
+    max_request_duration.rewrite(config)
+
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_GATEWAY_TIMEOUT)
+    assert.is_true(max_request_duration.exceeded())
+  end)
+
+  it("aborts the responses streamed after the deadline", function()
+    max_request_duration.rewrite(config)
+
+    now = now + 29
+    assert.is_nil(max_request_duration.body_filter())
+    assert.is_false(max_request_duration.exceeded())
+
+    now = now + 1
+    assert.are.equal(ngx.ERROR, max_request_duration.body_filter())
+    assert.is_true(max_request_duration.exceeded())
+  end)
+
+  it("counts the upstream timeouts at the deadline", function()
+    max_request_duration.rewrite(config)
+
+    ngx.var.status = "504"
+    assert.is_false(max_request_duration.exceeded())
+
+    now = now + 30
+    assert.is_true(max_request_duration.exceeded())
+  end)
+end)
@@ -53,6 +53,66 @@ describe("Monitor", function()
     assert.equal(10, #monitor.get_metrics_batch())
   end)
 
+  it("batches the protocol of the requests", function()
+    local ngx_var_mock = { server_protocol = "HTTP/1.1", status = "101", http_upgrade = "WebSocket" }
+    mock_ngx({ var = ngx_var_mock })
+    local monitor = require("monitor")
+    monitor.call()
+
+    ngx_var_mock.server_protocol = "HTTP/2.0"
+    ngx_var_mock.status = "200"
+    ngx_var_mock.http_upgrade = nil
+    ngx_var_mock.content_type = "application/grpc+proto"
+    monitor.call()
+
+    ngx_var_mock.server_protocol = "HTTP/1.1"
+    ngx_var_mock.content_type = "application/grpc-web-text"
+    monitor.call()
+
+    ngx_var_mock.status = "426"
+    ngx_var_mock.http_upgrade = "websocket"
+    ngx_var_mock.content_type = nil
+    monitor.call()
+
+    local batch = monitor.get_metrics_batch()
+    assert.equal(4, #batch)
+    assert.equal("HTTP/1.1", batch[1].protocol)
+    assert.equal("websocket", batch[1].upgrade)
+    assert.equal("HTTP/2.0", batch[2].protocol)
+    assert.equal("grpc", batch[2].upgrade)
+    assert.equal("grpc-web", batch[3].upgrade)
+    assert.is_nil(batch[4].upgrade)
+  end)
+
+  it("batches rejections", function()
+    mock_ngx({ var = { namespace = "default", ingress_name = "example" } })
+    local monitor = require("monitor")
+
+    monitor.record_rejection("invalid_transfer_encoding")
+
+    local batch = monitor.get_metrics_batch()
+    assert.equal(1, #batch)
+    assert.equal("invalid_transfer_encoding", batch[1].rejection)
+    assert.equal("default", batch[1].namespace)
+    assert.equal("example", batch[1].ingress)
+  end)
+
+  it("batches rate limit decisions", function()
+    mock_ngx({ var = { namespace = "default", ingress_name = "example" } })
+    local monitor = require("monitor")
+
+    monitor.record_rate_limit("allow", "31285d47b1504dcfbd6f12c46d769f6e", 1.5)
+    monitor.record_rate_limit("deny", "31285d47b1504dcfbd6f12c46d769f6e")
+
+    local batch = monitor.get_metrics_batch()
+    assert.equal(2, #batch)
+    assert.equal("allow", batch[1].rateLimitDecision)
+    assert.equal("31285d47b1504dcfbd6f12c46d769f6e", batch[1].rateLimitNamespace)
+    assert.equal(1.5, batch[1].rateLimitDelay)
+    assert.equal("deny", batch[2].rateLimitDecision)
+    assert.equal(0, batch[2].rateLimitDelay)
+  end)
+
   describe("flush", function()
     it("short circuits when premature is true (when worker is shutting down)", function()
       local tcp_mock = mock_ngx_socket_tcp()
@@ -85,6 +145,7 @@ describe("Monitor", function()
         location_path = "/",
 
         request_method = "GET",
+        server_protocol = "HTTP/1.1",
         status = "200",
         request_length = "256",
         request_time = "0.04",
@@ -118,6 +179,7 @@ describe("Monitor", function()
 
           method = "GET",
           status = "200",
+          protocol = "HTTP/1.1",
           requestLength = 256,
           requestTime = 0.04,
           responseLength = 512,
@@ -135,6 +197,7 @@ describe("Monitor", function()
 
           method = "POST",
           status = "201",
+          protocol = "HTTP/1.1",
           requestLength = 256,
           requestTime = 0.04,
           responseLength = 512,
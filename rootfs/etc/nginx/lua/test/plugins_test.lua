@@ -0,0 +1,49 @@
+local cjson = require("cjson.safe")
+
+local function set_flags(flags)
+  ngx.shared.configuration_data:set("plugin_flags", cjson.encode(flags))
+  ngx.shared.configuration_data:incr("plugin_flags_version", 1, 0)
+end
+
+describe("plugins", function()
+  local plugins
+
+  before_each(function()
+    plugins = require_without_cache("plugins")
+    ngx.var = { namespace = "default", ingress_name = "shop" }
+  end)
+
+  after_each(function()
+    ngx.shared.configuration_data:delete("plugin_flags")
+    ngx.shared.configuration_data:delete("plugin_flags_version")
+  end)
+
+  describe("flags()", function()
+    it("returns no flag when none is configured", function()
+      assert.are.same({}, plugins.flags())
+    end)
+
+    it("returns the flags of the Ingress of the request", function()
+      set_flags({
+        ["default/shop"] = { ["new-checkout"] = "true", tier = "gold" },
+        ["default/admin"] = { tier = "silver" },
+      })
+
+      assert.are.same({ ["new-checkout"] = "true", tier = "gold" }, plugins.flags())
+
+      ngx.var = { namespace = "default", ingress_name = "blog" }
+      assert.are.same({}, plugins.flags())
+    end)
+
+    it("picks up the flags updated by the controller", function()
+      set_flags({ ["default/shop"] = { tier = "gold" } })
+      assert.are.same({ tier = "gold" }, plugins.flags())
+
+      set_flags({ ["default/shop"] = { tier = "platinum" } })
+      assert.are.same({ tier = "platinum" }, plugins.flags())
+
+      set_flags({})
+      assert.are.same({}, plugins.flags())
+    end)
+  end)
+end)
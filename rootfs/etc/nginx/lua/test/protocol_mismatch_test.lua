@@ -0,0 +1,98 @@
+local cjson = require("cjson.safe")
+
+describe("protocol_mismatch", function()
+  local protocol_mismatch
+  local ngx_errlog = require("ngx.errlog")
+  local configuration = require("configuration")
+  local monitor = require("monitor")
+
+  local TLS_ERROR = [[SSL_do_handshake() failed (SSL: error:1408F10B:SSL routines:ssl3_get_record:wrong version number) ]] ..
+    [[while SSL handshaking to upstream, client: 10.0.0.1, server: example.com, request: "GET / HTTP/1.1", ]] ..
+    [[upstream: "https://10.244.0.5:8080/", host: "example.com"]]
+  local HTTP2_ERROR = [[upstream sent frame with invalid length: 4740180 while reading response header from upstream, ]] ..
+    [[client: 10.0.0.1, server: grpc.example.com, request: "POST /helloworld.Greeter/SayHello HTTP/2.0", ]] ..
+    [[upstream: "grpc://[fd00::5]:50051", host: "grpc.example.com"]]
+
+  before_each(function()
+    protocol_mismatch = require_without_cache("protocol_mismatch")
+    stub(monitor, "record_protocol_mismatch")
+  end)
+
+  after_each(function()
+    monitor.record_protocol_mismatch:revert()
+  end)
+
+  describe("match()", function()
+    it("detects the TLS handshakes with plaintext upstreams", function()
+      local reason, scheme, address = protocol_mismatch.match(TLS_ERROR)
+      assert.are.same({ "tls-handshake", "https", "10.244.0.5:8080" }, { reason, scheme, address })
+    end)
+
+    it("detects the gRPC upstreams not speaking HTTP/2", function()
+      local reason, scheme, address = protocol_mismatch.match(HTTP2_ERROR)
+      assert.are.same({ "http2-framing", "grpc", "[fd00::5]:50051" }, { reason, scheme, address })
+    end)
+
+    it("ignores the other errors", function()
+      assert.is_nil(protocol_mismatch.match([[connect() failed (111: Connection refused) while connecting to upstream, ]] ..
+        [[client: 10.0.0.1, server: example.com, upstream: "https://10.244.0.5:8443/", host: "example.com"]]))
+      assert.is_nil(protocol_mismatch.match("upstream sent frame with invalid length, upstream: \"http://10.244.0.5:80/\""))
+      assert.is_nil(protocol_mismatch.match("SSL_do_handshake() failed (wrong version number) while SSL handshaking"))
+    end)
+  end)
+
+  describe("init_worker()", function()
+    before_each(function()
+      stub(ngx.timer, "every", function() return true end)
+      stub(ngx.worker, "id", function() return 0 end)
+    end)
+
+    after_each(function()
+      ngx.timer.every:revert()
+      ngx.worker.id:revert()
+    end)
+
+    it("checks the captured error log", function()
+      stub(ngx_errlog, "set_filter_level", function() return true end)
+
+      protocol_mismatch.init()
+      protocol_mismatch.init_worker()
+
+      assert.stub(ngx.timer.every).was_called(1)
+      ngx_errlog.set_filter_level:revert()
+    end)
+
+    it("does not check the error log when it is not captured", function()
+      stub(ngx_errlog, "set_filter_level", function() return nil, "directive \"lua_capture_error_log\" is not set" end)
+
+      protocol_mismatch.init()
+      protocol_mismatch.init_worker()
+
+      assert.stub(ngx.timer.every).was_not_called()
+      ngx_errlog.set_filter_level:revert()
+    end)
+  end)
+
+  describe("check()", function()
+    it("reports the backends of the upstreams", function()
+      stub(ngx_errlog, "get_logs", function()
+        return { ngx.ERR, 1, TLS_ERROR, ngx.ERR, 2, "unrelated", ngx.ERR, 3, HTTP2_ERROR }
+      end)
+      stub(configuration, "get_backends_data", function()
+        return cjson.encode({
+          { name = "default-web-8080", endpoints = { { address = "10.244.0.5", port = "8080" } } },
+          { name = "default-grpc-50051", endpoints = { { address = "fd00::5", port = "50051" } } },
+        })
+      end)
+
+      protocol_mismatch.check()
+
+      assert.stub(monitor.record_protocol_mismatch).was_called(2)
+      assert.stub(monitor.record_protocol_mismatch).was_called_with("default-web-8080", "https", "tls-handshake")
+      assert.stub(monitor.record_protocol_mismatch).was_called_with("default-grpc-50051", "grpc", "http2-framing")
+
+      ngx_errlog.get_logs:revert()
+      configuration.get_backends_data:revert()
+    end)
+  end)
+end)
@@ -0,0 +1,58 @@
+describe("rate_limit_exemption", function()
+  local rate_limit_exemption
+  local payload
+
+  before_each(function()
+    payload = nil
+    package.loaded["auth_jwt"] = { payload = function() return payload end }
+    rate_limit_exemption = require_without_cache("rate_limit_exemption")
+    ngx.var = {
+      rate_limit_exempt = "",
+      ssl_client_verify = "SUCCESS",
+      ssl_client_s_dn = "CN=batch-job,OU=platform,O=example",
+    }
+  end)
+
+  after_each(function()
+    package.loaded["auth_jwt"] = nil
+  end)
+
+  it("reads the common name of the subject", function()
+    assert.are.equal("batch-job", rate_limit_exemption.common_name("CN=batch-job,OU=platform,O=example"))
+    assert.are.equal("batch-job", rate_limit_exemption.common_name("O=example,CN=batch-job"))
+    assert.is_nil(rate_limit_exemption.common_name("O=example\\,CN=batch-job"))
+    assert.is_nil(rate_limit_exemption.common_name(""))
+  end)
+
+  it("does nothing without configuration", function()
+    assert.is_false(rate_limit_exemption.rewrite(nil))
+    assert.is_false(rate_limit_exemption.rewrite({ client_cert_cns = {}, jwt_issuer = "" }))
+    assert.are.equal("", ngx.var.rate_limit_exempt)
+  end)
+
+  it("exempts the verified client certificates with an allowed common name", function()
+    assert.is_true(rate_limit_exemption.rewrite({ client_cert_cns = { "batch-job" }, jwt_issuer = "" }))
+    assert.are.equal("1", ngx.var.rate_limit_exempt)
+  end)
+
+  it("does not exempt the other client certificates", function()
+    assert.is_false(rate_limit_exemption.rewrite({ client_cert_cns = { "other" }, jwt_issuer = "" }))
+
+    ngx.var.ssl_client_verify = "FAILED:certificate has expired"
+    assert.is_false(rate_limit_exemption.rewrite({ client_cert_cns = { "batch-job" }, jwt_issuer = "" }))
+    assert.are.equal("", ngx.var.rate_limit_exempt)
+  end)
+
+  it("exempts the valid tokens of the issuer", function()
+    local config = { client_cert_cns = {}, jwt_issuer = "https://partner.example.com" }
+
+    assert.is_false(rate_limit_exemption.rewrite(config, {}))
+
+    payload = { iss = "https://other.example.com" }
+    assert.is_false(rate_limit_exemption.rewrite(config, {}))
+
+    payload = { iss = "https://partner.example.com" }
+    assert.is_true(rate_limit_exemption.rewrite(config, {}))
+    assert.are.equal("1", ngx.var.rate_limit_exempt)
+  end)
+end)
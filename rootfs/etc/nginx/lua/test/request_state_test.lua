@@ -0,0 +1,36 @@
+local request_state = require("request_state")
+
+describe("request_state", function()
+  before_each(function()
+    ngx.var = { request_id = "4b3a2e1f" }
+    request_state.clear()
+  end)
+
+  it("keeps the state of the request across internal redirects", function()
+    ngx.ctx = { connection_limit = "default|/|10.0.0.1" }
+    request_state.set("connection_limit", ngx.ctx.connection_limit)
+
+    -- ngx.ctx is reset by the internal redirects, $request_id is not
+    ngx.ctx = {}
+    assert.are.equal("default|/|10.0.0.1", request_state.get("connection_limit"))
+
+    assert.are.equal("default|/|10.0.0.1", request_state.take("connection_limit"))
+    assert.is_nil(request_state.take("connection_limit"))
+  end)
+
+  it("separates the state of the requests", function()
+    request_state.set("connection_limit", "default|/|10.0.0.1")
+
+    ngx.var = { request_id = "9c8d7e6f" }
+    assert.is_nil(request_state.get("connection_limit"))
+  end)
+
+  it("clears the state of the request", function()
+    request_state.set("connection_limit", "default|/|10.0.0.1")
+    request_state.set("keepalive_stats", { "default-http-svc-80" })
+
+    request_state.clear()
+    assert.is_nil(request_state.get("connection_limit"))
+    assert.is_nil(request_state.get("keepalive_stats"))
+  end)
+end)
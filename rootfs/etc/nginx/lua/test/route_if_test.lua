@@ -0,0 +1,49 @@
+describe("route_if", function()
+  local route_if
+
+  local function eq(variable, value)
+    return { op = "eq", variable = variable, value = value }
+  end
+
+  before_each(function()
+    route_if = require_without_cache("route_if")
+    ngx.var = {
+      route_if_upstream_name = "",
+      http_x_env = "qa",
+      cookie_beta = "1",
+      request_method = "POST",
+      uri = "/api/orders",
+    }
+  end)
+
+  it("compares the variables", function()
+    assert.is_true(route_if.evaluate(eq("http_x_env", "qa")))
+    assert.is_false(route_if.evaluate(eq("http_x_env", "prod")))
+    assert.is_false(route_if.evaluate(eq("http_x_missing", "qa")))
+    assert.is_true(route_if.evaluate({ op = "ne", variable = "http_x_missing", value = "qa" }))
+    assert.is_true(route_if.evaluate({ op = "match", variable = "uri", value = "^/api/" }))
+    assert.is_false(route_if.evaluate({ op = "match", variable = "http_x_missing", value = ".*" }))
+  end)
+
+  it("combines the comparisons", function()
+    local both = { op = "and", operands = { eq("http_x_env", "qa"), eq("cookie_beta", "1") } }
+    assert.is_true(route_if.evaluate(both))
+
+    ngx.var.cookie_beta = nil
+    assert.is_false(route_if.evaluate(both))
+    assert.is_true(route_if.evaluate({ op = "or", operands = { eq("cookie_beta", "1"), eq("request_method", "POST") } }))
+    assert.is_true(route_if.evaluate({ op = "not", operands = { both } }))
+  end)
+
+  it("selects the backend of the matching requests", function()
+    local config = { backend = "route-if-default-qa", predicate = eq("http_x_env", "qa") }
+
+    route_if.rewrite(config)
+    assert.are.equal("route-if-default-qa", ngx.var.route_if_upstream_name)
+
+    ngx.var.route_if_upstream_name = ""
+    ngx.var.http_x_env = "prod"
+    route_if.rewrite(config)
+    assert.are.equal("", ngx.var.route_if_upstream_name)
+  end)
+end)
@@ -0,0 +1,72 @@
+local memcached = require("resty.memcached")
+
+local CONFIG = {
+  enabled = true,
+  memcached = {
+    host = "memc.default.svc.cluster.local", port = 11211,
+    connect_timeout = 50, max_idle_timeout = 10000, pool_size = 50,
+  },
+  failure_timeout = 10,
+  session_timeout = 3600,
+}
+
+describe("shared_state", function()
+  local shared_state
+
+  before_each(function()
+    shared_state = require_without_cache("shared_state")
+  end)
+
+  describe("is_enabled()", function()
+    it("is disabled by default", function()
+      assert.is_false(shared_state.is_enabled())
+    end)
+
+    it("is disabled when memcached is not configured", function()
+      shared_state.set_config({ enabled = true, memcached = { host = "", port = 0 } })
+      assert.is_false(shared_state.is_enabled())
+    end)
+
+    it("is enabled when memcached is configured", function()
+      shared_state.set_config(CONFIG)
+      assert.is_true(shared_state.is_enabled())
+    end)
+  end)
+
+  describe("key()", function()
+    it("returns a namespaced key without spaces", function()
+      local key = shared_state.key("default-web-80", "session", "a key with spaces")
+      assert.are.same("ingress-nginx:" .. ngx.md5("default-web-80:session:a key with spaces"), key)
+    end)
+  end)
+
+  describe("get()", function()
+    it("short circuits when disabled", function()
+      local memcached_new_spy = spy.on(memcached, "new")
+      assert.are.same({}, shared_state.get({ "key" }))
+      assert.spy(memcached_new_spy).was_not_called()
+    end)
+
+    it("fails open when memcached is not reachable", function()
+      shared_state.set_config(CONFIG)
+      stub(memcached, "new", function() return nil, "no memory" end)
+      assert.are.same({}, shared_state.get({ "key" }))
+      memcached.new:revert()
+    end)
+  end)
+
+  describe("set_async()", function()
+    it("short circuits when disabled", function()
+      local timer_spy = spy.on(ngx.timer, "at")
+      shared_state.set_async("key", "value", 10)
+      assert.spy(timer_spy).was_not_called()
+    end)
+
+    it("writes in a timer", function()
+      shared_state.set_config(CONFIG)
+      local timer_spy = spy.on(ngx.timer, "at")
+      shared_state.set_async("key", "value", 10)
+      assert.spy(timer_spy).was_called()
+    end)
+  end)
+end)
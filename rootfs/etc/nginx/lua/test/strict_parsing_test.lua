@@ -0,0 +1,54 @@
+local strict_parsing = require("strict_parsing")
+
+local function mock_request(headers, http_version)
+  stub(ngx.req, "get_headers", function() return headers end)
+  stub(ngx.req, "http_version", function() return http_version or 1.1 end)
+end
+
+describe("strict_parsing", function()
+  describe("check()", function()
+    it("accepts valid requests", function()
+      mock_request({ host = "example.com", ["content-length"] = "10" })
+      assert.is_nil(strict_parsing.check())
+
+      mock_request({ host = "example.com", ["transfer-encoding"] = " Chunked " })
+      assert.is_nil(strict_parsing.check())
+
+      mock_request({ host = "example.com", ["user-agent"] = "curl\t7.0" })
+      assert.is_nil(strict_parsing.check())
+    end)
+
+    it("rejects ambiguous message framing", function()
+      local cases = {
+        { { ["content-length"] = { "10", "11" } }, "duplicate_content_length" },
+        { { ["content-length"] = "10, 10" }, "invalid_content_length" },
+        { { ["content-length"] = "-1" }, "invalid_content_length" },
+        { { ["transfer-encoding"] = { "chunked", "chunked" } }, "duplicate_transfer_encoding" },
+        { { ["transfer-encoding"] = "chunked", ["content-length"] = "10" }, "content_length_with_transfer_encoding" },
+        { { ["transfer-encoding"] = "gzip, chunked" }, "invalid_transfer_encoding" },
+        { { ["transfer-encoding"] = "xchunked" }, "invalid_transfer_encoding" },
+      }
+
+      for _, case in ipairs(cases) do
+        mock_request(case[1])
+        assert.are.equal(case[2], strict_parsing.check())
+      end
+    end)
+
+    it("rejects Transfer-Encoding in HTTP/1.0 requests", function()
+      mock_request({ ["transfer-encoding"] = "chunked" }, 1.0)
+      assert.are.equal("transfer_encoding_http10", strict_parsing.check())
+    end)
+
+    it("rejects abnormal headers", function()
+      mock_request({ ["x-custom header"] = "value" })
+      assert.are.equal("invalid_header_name", strict_parsing.check())
+
+      mock_request({ ["x-custom"] = "value\r\nx-injected: 1" })
+      assert.are.equal("invalid_header_value", strict_parsing.check())
+
+      mock_request({ ["x-custom"] = { "value", "other\0" } })
+      assert.are.equal("invalid_header_value", strict_parsing.check())
+    end)
+  end)
+end)
@@ -0,0 +1,103 @@
+local cjson = require("cjson.safe")
+
+-- Monday, 1 March 2021 10:00:00 UTC
+local MONDAY = 1614592800
+local HOUR = 3600
+local DAY = 24 * HOUR
+
+local function range(first, last)
+  local values = {}
+  for value = first, last do
+    values[#values + 1] = value
+  end
+  return values
+end
+
+local function office_hours()
+  return {
+    minutes = range(0, 59),
+    hours = range(9, 17),
+    days = range(1, 31),
+    months = range(1, 12),
+    weekdays = range(1, 5),
+  }
+end
+
+local function set_windows(ingresses)
+  ngx.shared.configuration_data:set("time_windows", cjson.encode({
+    ingresses = ingresses,
+    timezones = {
+      ["Europe/Berlin"] = {
+        { since = 1609459200, offset = HOUR },
+        { since = 1616893200, offset = 2 * HOUR },
+        { since = 1635642000, offset = HOUR },
+      },
+    },
+  }))
+  ngx.shared.configuration_data:incr("time_windows_version", 1, 0)
+end
+
+local function mock_request(namespace, ingress_name, now)
+  ngx.var = { namespace = namespace, ingress_name = ingress_name }
+  stub(ngx, "time", function() return now end)
+end
+
+describe("time_windows", function()
+  local time_windows
+
+  before_each(function()
+    time_windows = require_without_cache("time_windows")
+    set_windows({
+      ["default/admin"] = { timezone = "Europe/Berlin", windows = { office_hours() } },
+    })
+    stub(ngx, "exit")
+  end)
+
+  it("allows requests to Ingresses without time windows", function()
+    mock_request("default", "shop", MONDAY + 12 * HOUR)
+    time_windows.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+
+  it("allows requests inside the time windows", function()
+    mock_request("default", "admin", MONDAY)
+    time_windows.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+
+  it("rejects requests outside the time windows", function()
+    -- 18:00 in Berlin
+    mock_request("default", "admin", MONDAY + 7 * HOUR)
+    time_windows.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_FORBIDDEN)
+
+    ngx.exit:clear()
+
+    -- Saturday
+    mock_request("default", "admin", MONDAY + 5 * DAY)
+    time_windows.rewrite()
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_FORBIDDEN)
+  end)
+
+  it("applies the daylight saving time of the timezone", function()
+    local window = {}
+    for name, values in pairs(office_hours()) do
+      window[name] = {}
+      for _, value in ipairs(values) do
+        window[name][value] = true
+      end
+    end
+    local config = { timezone = "Europe/Berlin", windows = { window } }
+
+    -- 16:30 UTC is 17:30 in winter and 18:30 in summer in Berlin
+    assert.is_true(time_windows.allowed(config, MONDAY + 6 * HOUR + 1800))
+    assert.is_false(time_windows.allowed(config, MONDAY + 28 * DAY + 6 * HOUR + 1800))
+  end)
+
+  it("stops rejecting requests when the windows are removed", function()
+    mock_request("default", "admin", MONDAY + 7 * HOUR)
+    set_windows({})
+    time_windows.rewrite()
+    assert.stub(ngx.exit).was_not_called()
+  end)
+end)
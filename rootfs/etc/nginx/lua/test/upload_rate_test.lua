@@ -0,0 +1,91 @@
+local function mock_socket(body, chunk)
+  local offset = 0
+  return {
+    receive = function(_, size)
+      if offset >= #body then
+        return nil, "closed"
+      end
+      local data = string.sub(body, offset + 1, offset + math.min(size, chunk or size))
+      offset = offset + #data
+      return data
+    end,
+  }
+end
+
+describe("upload_rate", function()
+  local upload_rate
+  local now
+
+  before_each(function()
+    upload_rate = require_without_cache("upload_rate")
+    now = 1000
+    stub(ngx, "now", function() return now end)
+    stub(ngx, "sleep", function(delay) now = now + delay end)
+    stub(ngx, "exit")
+    stub(ngx.req, "init_body")
+    stub(ngx.req, "append_body")
+    stub(ngx.req, "finish_body")
+    stub(ngx.req, "http_version", function() return 1.1 end)
+  end)
+
+  it("does nothing when the rate is not configured", function()
+    stub(ngx.req, "socket")
+
+    upload_rate.throttle(0)
+
+    assert.stub(ngx.req.socket).was_not_called()
+  end)
+
+  it("does nothing when the request has no body", function()
+    stub(ngx.req, "socket")
+    ngx.var = { http_content_length = "0" }
+
+    upload_rate.throttle(1)
+
+    assert.stub(ngx.req.socket).was_not_called()
+  end)
+
+  it("reads the body at the configured rate", function()
+    local body = string.rep("a", 4096)
+    stub(ngx.req, "socket", function() return mock_socket(body, 1024) end)
+    ngx.var = { http_content_length = tostring(#body) }
+
+    upload_rate.throttle(1)
+
+    assert.are.equal(1004, now)
+    -- the body is not buffered in memory
+    assert.stub(ngx.req.append_body).was_called(4)
+    assert.stub(ngx.req.append_body).was_called_with(string.rep("a", 1024))
+    assert.stub(ngx.req.finish_body).was_called()
+  end)
+
+  it("rejects chunked request bodies", function()
+    stub(ngx.req, "socket")
+    ngx.var = { http_transfer_encoding = "chunked" }
+
+    upload_rate.throttle(1)
+
+    assert.stub(ngx.exit).was_called_with(411)
+    assert.stub(ngx.req.socket).was_not_called()
+  end)
+
+  it("rejects request bodies sent over HTTP/2", function()
+    stub(ngx.req, "socket")
+    stub(ngx.req, "http_version", function() return 2 end)
+    ngx.var = { http_content_length = "10" }
+
+    upload_rate.throttle(1)
+
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_VERSION_NOT_SUPPORTED)
+    assert.stub(ngx.req.socket).was_not_called()
+  end)
+
+  it("rejects the request when the body is incomplete", function()
+    stub(ngx.req, "socket", function() return mock_socket("abc") end)
+    ngx.var = { http_content_length = "10" }
+
+    upload_rate.throttle(1)
+
+    assert.stub(ngx.exit).was_called_with(ngx.HTTP_BAD_REQUEST)
+  end)
+end)
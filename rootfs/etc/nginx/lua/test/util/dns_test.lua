@@ -134,3 +134,70 @@ describe("dns.lookup", function()
     assert.spy(spy_cache_set).was_called_with(match.is_table(), "example.com.", { "192.168.1.1", "1.2.3.4" }, 60)
   end)
 end)
+
+describe("dns.lookup_srv", function()
+  local dns, spy_ngx_log
+
+  local SRV_ANSWERS = {
+    { name = "api.service.consul.", target = "node-1.node.consul.", port = 21000, priority = 1, weight = 10, ttl = 30 },
+    { name = "api.service.consul.", target = "node-2.node.consul.", port = 21001, priority = 1, weight = 0, ttl = 10 },
+    { name = "api.service.consul.", target = "node-3.node.consul.", port = 21002, priority = 2, weight = 10, ttl = 30 },
+  }
+
+  local function mock_resolver(answers_by_qtype)
+    helpers.mock_resty_dns_new(function(self, options)
+      return {
+        query = function(_, host, options)
+          local answers = answers_by_qtype[options.qtype]
+          if type(answers) == "function" then
+            return answers(host)
+          end
+          return answers
+        end,
+      }
+    end)
+  end
+
+  before_each(function()
+    spy_ngx_log = spy.on(ngx, "log")
+    dns = require("util.dns")
+  end)
+
+  after_each(function()
+    package.loaded["util.dns"] = nil
+  end)
+
+  it("returns the targets of the lowest priority with their ports and weights", function()
+    local resolver = require("resty.dns.resolver")
+    mock_resolver({
+      [resolver.TYPE_SRV] = SRV_ANSWERS,
+      [resolver.TYPE_A] = function(host)
+        local addresses = { ["node-1.node.consul."] = "10.0.0.1", ["node-2.node.consul."] = "10.0.0.2" }
+        return { { name = host, address = addresses[host], ttl = 60 } }
+      end,
+    })
+
+    local expected = {
+      { address = "10.0.0.1", port = "21000", weight = 10 },
+      { address = "10.0.0.2", port = "21001", weight = 1 },
+    }
+    assert.are.same(expected, dns.lookup_srv("api.service.consul."))
+    assert.are.same(expected, dns._cache:get("SRV api.service.consul."))
+  end)
+
+  it("returns nil when the host has no SRV record", function()
+    local resolver = require("resty.dns.resolver")
+    mock_resolver({ [resolver.TYPE_SRV] = {} })
+
+    assert.is_nil(dns.lookup_srv("api.service.consul."))
+    assert.spy(spy_ngx_log).was_called_with(ngx.ERR, "failed to query the DNS server for the SRV records of ",
+      "api.service.consul.", ": ", "no SRV record resolved")
+  end)
+
+  it("returns the endpoints from cache if they exist without doing actual DNS query", function()
+    local endpoints = { { address = "10.0.0.1", port = "21000", weight = 1 } }
+    dns._cache:set("SRV api.service.consul.", endpoints)
+
+    assert.are.same(endpoints, dns.lookup_srv("api.service.consul."))
+  end)
+end)
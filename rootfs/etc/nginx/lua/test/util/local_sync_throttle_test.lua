@@ -0,0 +1,77 @@
+describe("local_sync_throttle", function()
+  local local_sync_throttle
+
+  before_each(function()
+    ngx.shared.global_throttle_local:flush_all()
+    ngx.shared.global_throttle_deltas:flush_all()
+    local_sync_throttle = require_without_cache("util.local_sync_throttle")
+  end)
+
+  it("validates the parameters", function()
+    local _, err = local_sync_throttle.new("", 10, 60)
+    assert.are.equal("'namespace' param is missing", err)
+
+    _, err = local_sync_throttle.new("ns", 0, 60)
+    assert.are.equal("'limit' param has to be a positive number", err)
+
+    _, err = local_sync_throttle.new("ns", 10, 0)
+    assert.are.equal("'window_size' param has to be a positive number", err)
+  end)
+
+  it("allows the requests under the limit", function()
+    stub(ngx, "now", function() return 6000 end)
+    local throttle = local_sync_throttle.new("ns", 2, 60)
+
+    local count, delay, err = throttle:process("client")
+    assert.is_nil(err)
+    assert.is_nil(delay)
+    assert.are.equal(1, count)
+
+    count, delay = throttle:process("client")
+    assert.is_nil(delay)
+    assert.are.equal(2, count)
+
+    count, delay = throttle:process("client")
+    assert.are.equal(3, count)
+    assert.are.equal(60, delay)
+  end)
+
+  it("counts the requests of the peers", function()
+    stub(ngx, "now", function() return 6015 end)
+    local_sync_throttle.add({
+      ["{ns:client}:99"] = { count = 8, ttl = 60 },
+      ["{ns:client}:100"] = { count = 2, ttl = 120 },
+    })
+    local throttle = local_sync_throttle.new("ns", 10, 60)
+
+    local count, delay = throttle:process("client")
+    assert.is_nil(delay)
+    assert.are.equal(8 * 45 / 60 + 3, count)
+  end)
+
+  it("ignores the invalid deltas of the peers", function()
+    local_sync_throttle.add({
+      ["l:{ns:client}:100"] = { count = 8, ttl = 60 },
+      ["{ns:client}:100"] = { count = -8, ttl = 60 },
+    })
+
+    assert.are.same({}, ngx.shared.global_throttle_local:get_keys(0))
+  end)
+
+  it("returns the requests counted since the previous call", function()
+    stub(ngx, "now", function() return 6000 end)
+    local throttle = local_sync_throttle.new("ns", 10, 60)
+
+    throttle:process("client")
+    throttle:process("client")
+
+    local deltas = local_sync_throttle.take()
+    assert.are.equal(2, deltas["{ns:client}:100"].count)
+    assert.is_true(deltas["{ns:client}:100"].ttl > 0)
+
+    assert.are.same({}, local_sync_throttle.take())
+
+    throttle:process("client")
+    assert.are.equal(1, local_sync_throttle.take()["{ns:client}:100"].count)
+  end)
+end)
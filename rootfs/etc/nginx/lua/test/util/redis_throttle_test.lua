@@ -0,0 +1,144 @@
+local OPTIONS = {
+  host = "redis.default.svc.cluster.local", port = 6379,
+  connect_timeout = 50, max_idle_timeout = 10000, pool_size = 50,
+}
+
+describe("redis_throttle", function()
+  local original_redis
+  local counters
+  local pipeline_error
+  local auth_password
+  local reused_times
+  local redis_throttle
+
+  local function mock_redis()
+    local client = {}
+    local commands
+
+    function client.set_timeout() end
+    function client.connect() return true end
+    function client.set_keepalive() return true end
+    function client.close() return true end
+    function client.get_reused_times() return reused_times end
+    function client.auth(_, password)
+      auth_password = password
+      if password ~= "secret" then
+        return nil, "WRONGPASS invalid username-password pair"
+      end
+      return "OK"
+    end
+    function client.init_pipeline() commands = {} end
+    function client.incr(_, key)
+      counters[key] = (counters[key] or 0) + 1
+      table.insert(commands, counters[key])
+    end
+    function client.expire() table.insert(commands, 1) end
+    function client.get(_, key)
+      table.insert(commands, counters[key] and tostring(counters[key]) or ngx.null)
+    end
+    function client.commit_pipeline()
+      if pipeline_error then
+        return nil, pipeline_error
+      end
+      return commands
+    end
+
+    return { new = function() return client end }
+  end
+
+  before_each(function()
+    counters = {}
+    pipeline_error = nil
+    auth_password = nil
+    reused_times = 0
+    ngx.shared.configuration_data:delete("global_rate_limit_redis_password")
+    original_redis = package.loaded["resty.redis"]
+    package.loaded["resty.redis"] = mock_redis()
+    redis_throttle = require_without_cache("util.redis_throttle")
+  end)
+
+  after_each(function()
+    package.loaded["resty.redis"] = original_redis
+  end)
+
+  it("validates the parameters", function()
+    local _, err = redis_throttle.new("", 10, 60, OPTIONS)
+    assert.are.equal("'namespace' param is missing", err)
+
+    _, err = redis_throttle.new("ns", 0, 60, OPTIONS)
+    assert.are.equal("'limit' param has to be a positive number", err)
+
+    _, err = redis_throttle.new("ns", 10, 60, { host = "" })
+    assert.are.equal("'host' option is missing", err)
+  end)
+
+  it("allows the requests under the limit", function()
+    stub(ngx, "now", function() return 6000 end)
+    local throttle = redis_throttle.new("ns", 2, 60, OPTIONS)
+
+    local count, delay, err = throttle:process("client")
+    assert.is_nil(err)
+    assert.is_nil(delay)
+    assert.are.equal(1, count)
+
+    count, delay = throttle:process("client")
+    assert.is_nil(delay)
+    assert.are.equal(2, count)
+
+    count, delay = throttle:process("client")
+    assert.are.equal(3, count)
+    assert.are.equal(60, delay)
+  end)
+
+  it("weights the requests of the previous window", function()
+    -- 15 seconds in the window 100, with 8 requests in the window 99
+    stub(ngx, "now", function() return 6015 end)
+    counters["{ns:client}:99"] = 8
+    local throttle = redis_throttle.new("ns", 8, 60, OPTIONS)
+
+    local count, delay = throttle:process("client")
+    assert.is_nil(delay)
+    assert.are.equal(8 * 45 / 60 + 1, count)
+
+    count, delay = throttle:process("client")
+    assert.is_nil(delay)
+    assert.are.equal(8 * 45 / 60 + 2, count)
+
+    count, delay = throttle:process("client")
+    assert.are.equal(8 * 45 / 60 + 3, count)
+    -- 8 * (60 - 15 - delay) / 60 + 3 = 8
+    assert.are.equal(7.5, delay)
+  end)
+
+  it("authenticates the new connections", function()
+    local throttle = redis_throttle.new("ns", 2, 60, OPTIONS)
+
+    throttle:process("client")
+    assert.is_nil(auth_password)
+
+    ngx.shared.configuration_data:set("global_rate_limit_redis_password", "secret")
+    local _, _, err = throttle:process("client")
+    assert.is_nil(err)
+    assert.are.equal("secret", auth_password)
+
+    auth_password = nil
+    reused_times = 1
+    throttle:process("client")
+    assert.is_nil(auth_password)
+
+    reused_times = 0
+    ngx.shared.configuration_data:set("global_rate_limit_redis_password", "wrong")
+    _, _, err = throttle:process("client")
+    assert.are.equal("failed to authenticate to redis: WRONGPASS invalid username-password pair", err)
+  end)
+
+  it("returns the errors of redis", function()
+    pipeline_error = "timeout"
+    local throttle = redis_throttle.new("ns", 2, 60, OPTIONS)
+
+    local count, delay, err = throttle:process("client")
+    assert.is_nil(count)
+    assert.is_nil(delay)
+    assert.are.equal("timeout", err)
+  end)
+end)
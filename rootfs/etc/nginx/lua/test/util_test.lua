@@ -102,4 +102,17 @@ describe("utility", function()
       assert.are.same({ "10.10.10.2:8080" }, removed)
     end)
   end)
+
+  describe("constant_time_equals", function()
+    it("returns true for the same strings", function()
+      assert.is_true(util.constant_time_equals("s3cr3t", "s3cr3t"))
+      assert.is_true(util.constant_time_equals("", ""))
+    end)
+
+    it("returns false for different strings", function()
+      assert.is_false(util.constant_time_equals("s3cr3t", "s3cr3T"))
+      assert.is_false(util.constant_time_equals("s3cr3t", "s3cr3"))
+      assert.is_false(util.constant_time_equals(nil, "s3cr3t"))
+    end)
+  end)
 end)
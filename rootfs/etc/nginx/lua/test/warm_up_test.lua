@@ -0,0 +1,81 @@
+local function backend(path)
+  return {
+    name = "default-app-80",
+    warmUp = { path = path, status = 200, timeout = 1000 },
+    endpoints = {
+      { address = "10.0.0.1", port = "8080" },
+      { address = "10.0.0.2", port = "8080" },
+    },
+  }
+end
+
+describe("warm_up", function()
+  local warm_up
+
+  before_each(function()
+    warm_up = require_without_cache("warm_up")
+    ngx.shared.warm_up:flush_all()
+    stub(ngx.timer, "at", function() return true end)
+  end)
+
+  it("returns the backend when the check is not configured", function()
+    local b = backend("")
+
+    assert.are.same(b, warm_up.filter(b))
+    assert.stub(ngx.timer.at).was_not_called()
+    assert.is_false(warm_up.has_changed())
+  end)
+
+  it("returns all the endpoints when none of them passed the check", function()
+    local b = backend("/warmup")
+
+    assert.are.same(b.endpoints, warm_up.filter(b).endpoints)
+    assert.stub(ngx.timer.at).was_called(2)
+    -- the backends are synced again only when an endpoint passes the check
+    assert.is_false(warm_up.has_changed())
+  end)
+
+  it("returns only the endpoints that passed the check", function()
+    ngx.shared.warm_up:set("default-app-80|10.0.0.2:8080", true)
+    local b = backend("/warmup")
+
+    local filtered = warm_up.filter(b)
+
+    assert.are.same({ { address = "10.0.0.2", port = "8080" } }, filtered.endpoints)
+    assert.are.equal(2, #b.endpoints)
+    assert.stub(ngx.timer.at).was_called(1)
+    assert.is_true(ngx.shared.warm_up:ttl("default-app-80|10.0.0.2:8080") > 0)
+  end)
+
+  it("checks each endpoint once in each interval", function()
+    local b = backend("/warmup")
+
+    warm_up.filter(b)
+    warm_up.filter(b)
+
+    assert.stub(ngx.timer.at).was_called(2)
+  end)
+
+  it("checks again the pending endpoints without syncing the backends", function()
+    warm_up.filter(backend("/warmup"))
+    ngx.shared.warm_up:flush_all()
+
+    warm_up.check_pending()
+    assert.stub(ngx.timer.at).was_called(4)
+
+    warm_up.reset_changed()
+    warm_up.check_pending()
+    assert.stub(ngx.timer.at).was_called(4)
+  end)
+
+  it("has changed when an endpoint passed the check", function()
+    warm_up.reset_changed()
+    assert.is_false(warm_up.has_changed())
+
+    ngx.shared.warm_up:incr("generation", 1, 0)
+    assert.is_true(warm_up.has_changed())
+
+    warm_up.reset_changed()
+    assert.is_false(warm_up.has_changed())
+  end)
+end)
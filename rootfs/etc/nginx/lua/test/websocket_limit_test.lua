@@ -0,0 +1,100 @@
+describe("websocket_limit", function()
+  local websocket_limit
+  local request_state = require("request_state")
+  local config = {
+    namespace = "31285d47b1504dcfbd6f12c46d769f6e",
+    per_client = 1,
+    per_backend = 2,
+    status_code = 503,
+  }
+  local client_key = "31285d47b1504dcfbd6f12c46d769f6e|client|10.0.0.1"
+  local backend_key = "31285d47b1504dcfbd6f12c46d769f6e|backend|default-chat-80"
+
+  local function request(remote_addr, upgrade)
+    ngx.ctx = {}
+    ngx.var = {
+      remote_addr = remote_addr,
+      proxy_upstream_name = "default-chat-80",
+      http_upgrade = upgrade,
+      request_id = "req-" .. remote_addr,
+    }
+  end
+
+  before_each(function()
+    websocket_limit = require_without_cache("websocket_limit")
+    ngx.shared.websocket_connections:flush_all()
+    request_state.clear()
+    request("10.0.0.1", "websocket")
+    stub(ngx, "exit")
+  end)
+
+  it("does nothing when the limits are not configured", function()
+    websocket_limit.acquire({ namespace = "", per_client = 0, per_backend = 0, status_code = 503 })
+    assert.is_nil(request_state.get("websocket_limit"))
+  end)
+
+  it("does not count the regular requests", function()
+    request("10.0.0.1", nil)
+    websocket_limit.acquire(config)
+    assert.is_nil(request_state.get("websocket_limit"))
+    assert.are.equal(0, websocket_limit.get(client_key))
+  end)
+
+  it("takes and releases slots", function()
+    request("10.0.0.1", "WebSocket")
+    websocket_limit.acquire(config)
+    assert.stub(ngx.exit).was_not_called()
+    assert.are.equal(1, websocket_limit.get(client_key))
+    assert.are.equal(1, websocket_limit.get(backend_key))
+
+    websocket_limit.release()
+    assert.are.equal(0, websocket_limit.get(client_key))
+    assert.are.equal(0, websocket_limit.get(backend_key))
+
+    -- releasing twice does not free additional slots
+    websocket_limit.release()
+    assert.are.equal(0, websocket_limit.get(client_key))
+  end)
+
+  it("releases the slots after the internal redirects", function()
+    websocket_limit.acquire(config)
+    assert.are.equal(1, websocket_limit.get(client_key))
+
+    -- error_page resets ngx.ctx before the log phase
+    ngx.ctx = {}
+    websocket_limit.release()
+    assert.are.equal(0, websocket_limit.get(client_key))
+    assert.are.equal(0, websocket_limit.get(backend_key))
+  end)
+
+  it("does not count below zero when the counter expired", function()
+    websocket_limit.acquire(config)
+    ngx.shared.websocket_connections:delete(client_key)
+
+    websocket_limit.release()
+    assert.are.equal(0, websocket_limit.get(client_key))
+  end)
+
+  it("rejects the connections of a client over its limit", function()
+    ngx.shared.websocket_connections:set(client_key, 1)
+
+    websocket_limit.acquire(config)
+    assert.stub(ngx.exit).was_called_with(503)
+    assert.are.equal(1, websocket_limit.get(client_key))
+    assert.are.equal(0, websocket_limit.get(backend_key))
+    assert.is_nil(request_state.get("websocket_limit"))
+  end)
+
+  it("rejects the connections over the limit of the backend", function()
+    websocket_limit.acquire(config)
+    request("10.0.0.2", "websocket")
+    websocket_limit.acquire(config)
+    assert.stub(ngx.exit).was_not_called()
+
+    request("10.0.0.3", "websocket")
+    websocket_limit.acquire(config)
+    assert.stub(ngx.exit).was_called_with(503)
+    assert.are.equal(2, websocket_limit.get(backend_key))
+    assert.are.equal(0, websocket_limit.get("31285d47b1504dcfbd6f12c46d769f6e|client|10.0.0.3"))
+  end)
+end)
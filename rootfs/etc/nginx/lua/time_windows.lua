@@ -0,0 +1,118 @@
+-- Restricts the access to the Ingresses with the annotation
+-- nginx.ingress.kubernetes.io/allowed-time-windows to the time windows
+-- defined in it. The windows are pushed by the controller to the
+-- configuration endpoint, no reload is required.
+local ngx = ngx
+local cjson = require("cjson.safe")
+local configuration = require("configuration")
+
+local ipairs = ipairs
+local next = next
+local pairs = pairs
+local os_date = os.date
+
+local _M = {}
+
+-- windows decoded by this worker, by namespace and name of the Ingress,
+-- and the version of the configuration
+local ingresses = {}
+local timezones = {}
+local current_version
+
+local function to_set(values)
+  local set = {}
+  for _, value in ipairs(values or {}) do
+    set[value] = true
+  end
+  return set
+end
+
+local function sync_windows()
+  local data, version = configuration.get_time_windows_data()
+  if version == current_version then
+    return
+  end
+
+  current_version = version
+
+  if not data then
+    ingresses, timezones = {}, {}
+    return
+  end
+
+  local new_config, err = cjson.decode(data)
+  if not new_config then
+    ngx.log(ngx.ERR, "could not parse time windows: ", err)
+    return
+  end
+
+  local new_ingresses = {}
+  for name, config in pairs(new_config.ingresses or {}) do
+    local windows = {}
+    for _, window in ipairs(config.windows or {}) do
+      windows[#windows + 1] = {
+        minutes = to_set(window.minutes),
+        hours = to_set(window.hours),
+        days = to_set(window.days),
+        months = to_set(window.months),
+        weekdays = to_set(window.weekdays),
+      }
+    end
+    new_ingresses[name] = { timezone = config.timezone, windows = windows }
+  end
+
+  ingresses = new_ingresses
+  timezones = new_config.timezones or {}
+end
+
+-- the offsets are sorted, the last one in effect applies
+local function get_offset(timezone, now)
+  local offset = 0
+  for _, o in ipairs(timezones[timezone] or {}) do
+    if o.since > now then
+      break
+    end
+    offset = o.offset
+  end
+  return offset
+end
+
+local function in_window(window, t)
+  return window.minutes[t.min] and window.hours[t.hour] and window.days[t.day] and
+    window.months[t.month] and window.weekdays[t.wday - 1]
+end
+
+-- allowed returns whether the time windows of the Ingress contain the
+-- time now, in seconds since the epoch
+function _M.allowed(config, now)
+  local t = os_date("!*t", now + get_offset(config.timezone, now))
+
+  for _, window in ipairs(config.windows) do
+    if in_window(window, t) then
+      return true
+    end
+  end
+
+  return false
+end
+
+-- rewrite rejects the requests received outside the time windows
+function _M.rewrite()
+  sync_windows()
+
+  if next(ingresses) == nil then
+    return
+  end
+
+  local config = ingresses[(ngx.var.namespace or "") .. "/" .. (ngx.var.ingress_name or "")]
+  if not config then
+    return
+  end
+
+  if not _M.allowed(config, ngx.time()) then
+    ngx.log(ngx.INFO, "request received outside the allowed time windows")
+    return ngx.exit(ngx.HTTP_FORBIDDEN)
+  end
+end
+
+return _M
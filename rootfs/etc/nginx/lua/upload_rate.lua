@@ -0,0 +1,84 @@
+-- Limits the rate at which the request body is received from the client in
+-- the locations with the annotation nginx.ingress.kubernetes.io/limit-upload-rate.
+-- NGINX only provides limit_rate for responses, so the body is read from the
+-- downstream socket in chunks, sleeping between them to keep the configured
+-- number of kilobytes per second. The chunks are appended to the request body
+-- as they are received, which is written to a temporary file once larger than
+-- client_body_buffer_size.
+--
+-- Only the HTTP/1.x bodies with a Content-Length can be read from the
+-- socket: the chunked bodies are rejected with 411 and the bodies sent over
+-- HTTP/2 or HTTP/3 with 505, so the limit cannot be bypassed.
+local ngx = ngx
+local math_min = math.min
+local tonumber = tonumber
+
+local CHUNK_SIZE = 8192
+local HTTP_LENGTH_REQUIRED = 411
+
+local _M = {}
+
+local function sleep_time(received, rate, started)
+  local expected = received / (rate * 1024)
+  local elapsed = ngx.now() - started
+  if expected > elapsed then
+    return expected - elapsed
+  end
+  return 0
+end
+
+function _M.throttle(rate)
+  if not rate or rate <= 0 then
+    return
+  end
+
+  local length = tonumber(ngx.var.http_content_length)
+  if not length then
+    if ngx.var.http_transfer_encoding then
+      ngx.log(ngx.INFO, "chunked request bodies are not supported with limit-upload-rate")
+      return ngx.exit(HTTP_LENGTH_REQUIRED)
+    end
+    return
+  end
+
+  if length == 0 then
+    return
+  end
+
+  if ngx.req.http_version() >= 2 then
+    ngx.log(ngx.INFO, "request bodies over HTTP/2 and HTTP/3 are not supported with limit-upload-rate")
+    return ngx.exit(ngx.HTTP_VERSION_NOT_SUPPORTED)
+  end
+
+  local sock, err = ngx.req.socket()
+  if not sock then
+    ngx.log(ngx.WARN, "could not get the request socket to limit the upload rate: ", err)
+    return
+  end
+
+  ngx.req.init_body()
+
+  local received = 0
+  local started = ngx.now()
+
+  while received < length do
+    local data
+    data, err = sock:receive(math_min(CHUNK_SIZE, length - received))
+    if not data then
+      ngx.log(ngx.INFO, "could not read the request body: ", err)
+      return ngx.exit(ngx.HTTP_BAD_REQUEST)
+    end
+
+    ngx.req.append_body(data)
+    received = received + #data
+
+    local delay = sleep_time(received, rate, started)
+    if delay > 0 then
+      ngx.sleep(delay)
+    end
+  end
+
+  ngx.req.finish_body()
+end
+
+return _M
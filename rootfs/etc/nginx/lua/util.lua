@@ -2,6 +2,9 @@ local ngx           = ngx
 local string        = string
 local string_len    = string.len
 local string_format = string.format
+local string_byte   = string.byte
+local bit_bor       = bit.bor
+local bit_bxor      = bit.bxor
 local pairs         = pairs
 local ipairs        = ipairs
 local tonumber      = tonumber
@@ -15,11 +18,11 @@ local _M = {}
 
 function _M.get_nodes(endpoints)
   local nodes = {}
-  local weight = 1
+  local default_weight = 1
 
   for _, endpoint in pairs(endpoints) do
     local endpoint_string = endpoint.address .. ":" .. endpoint.port
-    nodes[endpoint_string] = weight
+    nodes[endpoint_string] = endpoint.weight or default_weight
   end
 
   return nodes
@@ -78,6 +81,17 @@ function _M.generate_var_value(data)
   return table.concat(t, "")
 end
 
+-- Generates the key of the consistent hashing from the return values of
+-- parse_complex_value, the fallback is used when the key is empty
+function _M.generate_hash_key(hash_by, hash_by_fallback)
+  local key = _M.generate_var_value(hash_by)
+  if key == "" and hash_by_fallback then
+    key = _M.generate_var_value(hash_by_fallback)
+  end
+
+  return key
+end
+
 -- normalize_endpoints takes endpoints as an array of endpoint objects
 -- and returns a table where keys are string that's
 -- endpoint.address .. ":" .. endpoint.port and values are all true
@@ -146,6 +160,22 @@ function _M.is_blank(str)
   return str == nil or string_len(str) == 0
 end
 
+-- constant_time_equals compares two strings in a time depending only on
+-- their length, like subtle.ConstantTimeCompare, to compare the secrets
+-- sent by the clients
+function _M.constant_time_equals(a, b)
+  if type(a) ~= "string" or type(b) ~= "string" or string_len(a) ~= string_len(b) then
+    return false
+  end
+
+  local result = 0
+  for i = 1, string_len(a) do
+    result = bit_bor(result, bit_bxor(string_byte(a, i), string_byte(b, i)))
+  end
+
+  return result == 0
+end
+
 -- this implementation is taken from:
 -- https://github.com/luafun/luafun/blob/master/fun.lua#L33
 -- SHA: 04c99f9c393e54a604adde4b25b794f48104e0d0
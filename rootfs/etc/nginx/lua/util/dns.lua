@@ -10,6 +10,7 @@ local table_concat = table.concat
 local table_insert = table.insert
 local ipairs = ipairs
 local tostring = tostring
+local math_max = math.max
 
 local _M = {}
 local CACHE_SIZE = 10000
@@ -88,39 +89,65 @@ local function resolve_host(r, host)
   return nil, nil, dns_errors
 end
 
-function _M.lookup(host)
-  local cached_addresses = cache:get(host)
-  if cached_addresses then
-    return cached_addresses
+-- srv_records_and_min_ttl returns the SRV records of the lowest priority,
+-- the only ones used while their targets are available
+local function srv_records_and_min_ttl(answers)
+  local records = {}
+  local ttl = MAXIMUM_TTL_VALUE
+  local priority
+
+  for _, ans in ipairs(answers) do
+    if ans.target and ans.target ~= "" and ans.port then
+      if not priority or ans.priority < priority then
+        priority = ans.priority
+        records = {}
+      end
+      if ans.priority == priority then
+        table_insert(records, ans)
+      end
+      if ans.ttl < ttl then
+        ttl = ans.ttl
+      end
+    end
   end
 
-  local r, err = resolver:new{
+  return records, ttl
+end
+
+local function resolve_srv(r, host)
+  local answers, err = r:query(host, { qtype = resolver.TYPE_SRV }, {})
+  if not answers then
+    return nil, -1, err
+  end
+
+  if answers.errcode then
+    return nil, -1, string_format("server returned error code: %s: %s",
+      answers.errcode, answers.errstr)
+  end
+
+  local records, ttl = srv_records_and_min_ttl(answers)
+  if #records == 0 then
+    return nil, -1, "no SRV record resolved"
+  end
+
+  return records, ttl, nil
+end
+
+local function new_resolver()
+  return resolver:new{
     nameservers = resolv_conf.nameservers,
     retrans = 5,
     timeout = 2000,  -- 2 sec
   }
+end
 
-  if not r then
-    ngx_log(ngx_ERR, string_format("failed to instantiate the resolver: %s", err))
-    return { host }
-  end
-
-  local addresses, ttl, dns_errors
-
+-- search_hosts returns the names queried for the host, in order
+local function search_hosts(host)
   -- when the queried domain is fully qualified
   -- then we don't go through resolv_conf.search
   -- NOTE(elvinefendi): currently FQDN as externalName will be supported starting
   -- with K8s 1.15: https://github.com/kubernetes/kubernetes/pull/78385
   if is_fully_qualified(host) then
-    addresses, ttl, dns_errors = resolve_host(r, host)
-    if addresses then
-      cache_set(host, addresses, ttl)
-      return addresses
-    end
-
-    ngx_log(ngx_ERR, "failed to query the DNS server for ",
-      host, ":\n", table_concat(dns_errors, "\n"))
-
     return { host }
   end
 
@@ -137,10 +164,30 @@ function _M.lookup(host)
     search_end = #resolv_conf.search + 1
   end
 
+  local hosts = {}
   for i = search_start, search_end, 1 do
     local new_host = resolv_conf.search[i] and
       string_format("%s.%s", host, resolv_conf.search[i]) or host
+    table_insert(hosts, new_host)
+  end
 
+  return hosts
+end
+
+function _M.lookup(host)
+  local cached_addresses = cache:get(host)
+  if cached_addresses then
+    return cached_addresses
+  end
+
+  local r, err = new_resolver()
+  if not r then
+    ngx_log(ngx_ERR, string_format("failed to instantiate the resolver: %s", err))
+    return { host }
+  end
+
+  local addresses, ttl, dns_errors
+  for _, new_host in ipairs(search_hosts(host)) do
     addresses, ttl, dns_errors = resolve_host(r, new_host)
     if addresses then
       cache_set(host, addresses, ttl)
@@ -148,14 +195,58 @@ function _M.lookup(host)
     end
   end
 
-  if #dns_errors > 0 then
-    ngx_log(ngx_ERR, "failed to query the DNS server for ",
-      host, ":\n", table_concat(dns_errors, "\n"))
-  end
+  ngx_log(ngx_ERR, "failed to query the DNS server for ",
+    host, ":\n", table_concat(dns_errors, "\n"))
 
   return { host }
 end
 
+-- lookup_srv returns the endpoints of the SRV records of the host, with the
+-- addresses of their targets, their ports and their weights. It returns nil
+-- when the host has no SRV record.
+function _M.lookup_srv(host)
+  local cache_key = "SRV " .. host
+  local cached_endpoints = cache:get(cache_key)
+  if cached_endpoints then
+    return cached_endpoints
+  end
+
+  local r, err = new_resolver()
+  if not r then
+    ngx_log(ngx_ERR, string_format("failed to instantiate the resolver: %s", err))
+    return nil
+  end
+
+  local records, ttl
+  for _, new_host in ipairs(search_hosts(host)) do
+    records, ttl, err = resolve_srv(r, new_host)
+    if records then
+      break
+    end
+  end
+
+  if not records then
+    ngx_log(ngx_ERR, "failed to query the DNS server for the SRV records of ",
+      host, ": ", tostring(err))
+    return nil
+  end
+
+  local endpoints = {}
+  for _, record in ipairs(records) do
+    -- a weight of 0 is the lowest weight, not a disabled target
+    local weight = math_max(record.weight or 1, 1)
+    for _, address in ipairs(_M.lookup(record.target)) do
+      table_insert(endpoints, { address = address, port = tostring(record.port), weight = weight })
+    end
+  end
+
+  cache:set(cache_key, endpoints, ttl)
+  ngx_log(ngx_INFO, string_format("cache set for the SRV records of '%s' with %s endpoints and ttl of %s.",
+    host, #endpoints, ttl))
+
+  return endpoints
+end
+
 setmetatable(_M, {__index = { _cache = cache }})
 
 return _M
@@ -0,0 +1,135 @@
+-- Sliding window rate limiter keeping its counters in the shared dictionaries
+-- of the controller pod, used by global_throttle when global-rate-limit-mode
+-- is "local-sync". The requests counted by the pod are recorded as deltas as
+-- well, the controller takes them periodically and sends them to the other
+-- pods of the controller, which add them to their counters of the peers.
+-- The limit is approximate: the requests of the peers are only known after
+-- the replication, up to global-rate-limit-sync-max-staleness later.
+local redis_throttle = require("util.redis_throttle")
+
+local ngx = ngx
+local ngx_log = ngx.log
+local ngx_ERR = ngx.ERR
+local ngx_WARN = ngx.WARN
+local math_floor = math.floor
+local setmetatable = setmetatable
+local string_format = string.format
+local string_sub = string.sub
+local tonumber = tonumber
+local type = type
+local pairs = pairs
+local ipairs = ipairs
+
+-- counters of the pod, prefixed with "l:", and of its peers, prefixed
+-- with "p:"
+local COUNTERS = ngx.shared.global_throttle_local
+-- requests of the pod not sent to the peers yet
+local DELTAS = ngx.shared.global_throttle_deltas
+
+local LOCAL_PREFIX = "l:"
+local PEERS_PREFIX = "p:"
+
+local _M = {}
+local mt = { __index = _M }
+
+function _M.new(namespace, limit, window_size)
+  if not namespace or namespace == "" then
+    return nil, "'namespace' param is missing"
+  end
+  if not limit or limit <= 0 then
+    return nil, "'limit' param has to be a positive number"
+  end
+  if not window_size or window_size <= 0 then
+    return nil, "'window_size' param has to be a positive number"
+  end
+
+  return setmetatable({
+    namespace = namespace,
+    limit = limit,
+    window_size = window_size,
+  }, mt), nil
+end
+
+local function incr(dict, key, value, ttl)
+  local newval, err, forcible = dict:incr(key, value, 0, ttl)
+  if err then
+    return nil, err
+  end
+  if forcible then
+    ngx_log(ngx_WARN, "global rate limit counters shared dictionary is full, consider increasing its size")
+  end
+  return newval, nil
+end
+
+-- count returns the requests of the counter of a window, from the pod and
+-- from its peers
+local function count(counter)
+  return (COUNTERS:get(LOCAL_PREFIX .. counter) or 0) + (COUNTERS:get(PEERS_PREFIX .. counter) or 0)
+end
+
+-- process counts a request of the key and returns the estimated number of
+-- requests in the window and, when it exceeds the limit, how long the
+-- client has to wait in seconds
+function _M.process(self, key)
+  local now = ngx.now()
+  local window_size = self.window_size
+  local window_id = math_floor(now / window_size)
+  local elapsed = now - window_id * window_size
+
+  local current = string_format("{%s:%s}:%d", self.namespace, key, window_id)
+  local previous = string_format("{%s:%s}:%d", self.namespace, key, window_id - 1)
+
+  -- the counters are used during the next window as previous ones
+  local ttl = window_size * 2
+
+  local _, err = incr(COUNTERS, LOCAL_PREFIX .. current, 1, ttl)
+  if err then
+    return nil, nil, string_format("failed to count the request: %s", err)
+  end
+
+  _, err = incr(DELTAS, current, 1, ttl)
+  if err then
+    ngx_log(ngx_ERR, "failed to record the request for the peers: ", err)
+  end
+
+  local estimated_count, desired_delay =
+    redis_throttle.estimate(self.limit, window_size, elapsed, count(current), count(previous))
+  return estimated_count, desired_delay, nil
+end
+
+-- take returns the requests counted by the pod since the previous call, as
+-- the increment and the remaining time to live of each counter
+function _M.take()
+  local deltas = {}
+
+  for _, counter in ipairs(DELTAS:get_keys(0)) do
+    local value = DELTAS:get(counter)
+    if value and value > 0 then
+      local ttl = DELTAS:ttl(counter)
+      -- the requests counted in the meantime are left for the next call
+      DELTAS:incr(counter, -value)
+      if ttl and ttl > 0 then
+        deltas[counter] = { count = value, ttl = ttl }
+      end
+    end
+  end
+
+  return deltas
+end
+
+-- add adds the requests counted by a peer, as returned by take, to the
+-- counters of the peers
+function _M.add(deltas)
+  for counter, delta in pairs(deltas) do
+    local value, ttl = tonumber(delta.count), tonumber(delta.ttl)
+    if type(counter) == "string" and string_sub(counter, 1, 1) == "{" and
+        value and value > 0 and ttl and ttl > 0 then
+      local _, err = incr(COUNTERS, PEERS_PREFIX .. counter, value, ttl)
+      if err then
+        ngx_log(ngx_ERR, "failed to add the requests of a peer: ", err)
+      end
+    end
+  end
+end
+
+return _M
@@ -0,0 +1,142 @@
+-- Sliding window rate limiter keeping its counters in Redis, used by
+-- global_throttle when global-rate-limit-store is "redis". It follows the
+-- interface and the algorithm of lua-resty-global-throttle: the number of
+-- requests of the current window is added to the ones of the previous window,
+-- weighted by the time left in the current window.
+local redis = require("resty.redis")
+local configuration = require("configuration")
+
+local ngx = ngx
+local ngx_log = ngx.log
+local ngx_ERR = ngx.ERR
+local math_floor = math.floor
+local setmetatable = setmetatable
+local string_format = string.format
+local tonumber = tonumber
+local type = type
+local ipairs = ipairs
+
+local _M = {}
+local mt = { __index = _M }
+
+function _M.new(namespace, limit, window_size, options)
+  if not namespace or namespace == "" then
+    return nil, "'namespace' param is missing"
+  end
+  if not limit or limit <= 0 then
+    return nil, "'limit' param has to be a positive number"
+  end
+  if not window_size or window_size <= 0 then
+    return nil, "'window_size' param has to be a positive number"
+  end
+  if not options or not options.host or options.host == "" then
+    return nil, "'host' option is missing"
+  end
+
+  return setmetatable({
+    namespace = namespace,
+    limit = limit,
+    window_size = window_size,
+    options = options,
+  }, mt), nil
+end
+
+local function with_client(options, fn)
+  local red = redis:new()
+  red:set_timeout(options.connect_timeout)
+
+  local ok, err = red:connect(options.host, options.port)
+  if not ok then
+    return nil, string_format("failed to connect to redis: %s", err)
+  end
+
+  -- the connections of the pool are already authenticated
+  local password = configuration.get_global_rate_limit_redis_password()
+  if password and password ~= "" and red:get_reused_times() == 0 then
+    ok, err = red:auth(password)
+    if not ok then
+      red:close()
+      return nil, string_format("failed to authenticate to redis: %s", err)
+    end
+  end
+
+  local res
+  res, err = fn(red)
+
+  local keepalive_err
+  ok, keepalive_err = red:set_keepalive(options.max_idle_timeout, options.pool_size)
+  if not ok then
+    ngx_log(ngx_ERR, "failed to set redis keepalive: ", keepalive_err)
+  end
+
+  return res, err
+end
+
+-- counts increments the counter of the current window and returns it with
+-- the counter of the previous window. The hash tag keeps both counters in
+-- the same slot of Redis Cluster
+local function counts(self, key, window_id)
+  local current_key = string_format("{%s:%s}:%d", self.namespace, key, window_id)
+  local previous_key = string_format("{%s:%s}:%d", self.namespace, key, window_id - 1)
+
+  local results, err = with_client(self.options, function(red)
+    red:init_pipeline()
+    red:incr(current_key)
+    red:expire(current_key, self.window_size * 2)
+    red:get(previous_key)
+    return red:commit_pipeline()
+  end)
+  if not results then
+    return nil, nil, err
+  end
+
+  for _, result in ipairs(results) do
+    if type(result) == "table" and result[1] == false then
+      return nil, nil, string_format("failed to process redis command: %s", result[2])
+    end
+  end
+
+  return tonumber(results[1]), tonumber(results[3]) or 0, nil
+end
+
+-- estimate returns the estimated number of requests in the window from the
+-- counters of the current and the previous windows and, when it exceeds the
+-- limit, how long the client has to wait in seconds. It is shared with
+-- local_sync_throttle.
+function _M.estimate(limit, window_size, elapsed, count, previous_count)
+  local remaining_ratio = (window_size - elapsed) / window_size
+  local estimated_count = previous_count * remaining_ratio + count
+  if estimated_count <= limit then
+    return estimated_count, nil
+  end
+
+  if previous_count == 0 or count > limit then
+    return estimated_count, window_size - elapsed
+  end
+
+  -- the time until the weight of the previous window makes the estimation
+  -- go back to the limit
+  local desired_delay = window_size - elapsed - (limit - count) * window_size / previous_count
+  return estimated_count, desired_delay
+end
+
+-- process counts a request of the key and returns the estimated number of
+-- requests in the window and, when it exceeds the limit, how long the
+-- client has to wait in seconds
+function _M.process(self, key)
+  local now = ngx.now()
+  local window_size = self.window_size
+  local window_id = math_floor(now / window_size)
+  local elapsed = now - window_id * window_size
+
+  local count, previous_count, err = counts(self, key, window_id)
+  if err then
+    return nil, nil, err
+  end
+
+  local estimated_count, desired_delay =
+    _M.estimate(self.limit, window_size, elapsed, count, previous_count)
+  return estimated_count, desired_delay, nil
+end
+
+return _M
@@ -0,0 +1,134 @@
+-- Keeps the new endpoints of the backends with the annotation
+-- nginx.ingress.kubernetes.io/warm-up-path out of the balancers until a
+-- request to the warm-up path returns the expected status code. The result
+-- of the checks is shared by the workers and survives reloads.
+local http = require("resty.http")
+
+local ngx = ngx
+local ipairs = ipairs
+local pairs = pairs
+local string_format = string.format
+
+local warm_up_data = ngx.shared.warm_up
+
+-- minimum time, in seconds, between two checks of the same endpoint
+local CHECK_INTERVAL = 1
+-- time, in seconds, an endpoint passing the check is kept ready after the
+-- last sync of its backend, the endpoints removed from the backends expire
+local READY_TTL = 3600
+-- incremented when an endpoint passes the check for the workers to sync
+-- their balancers
+local GENERATION_KEY = "generation"
+
+local _M = {}
+
+-- endpoints of the last synced backends that are not ready yet, checked
+-- until they pass the check
+local pending = {}
+local synced_generation = 0
+
+local function endpoint_key(backend, endpoint)
+  return string_format("%s|%s:%s", backend.name, endpoint.address, endpoint.port)
+end
+
+local function check(premature, key, config, endpoint)
+  if premature then
+    return
+  end
+
+  local httpc = http.new()
+  httpc:set_timeout(config.timeout)
+
+  local address = endpoint.address
+  if address:find(":", 1, true) and address:sub(1, 1) ~= "[" then
+    address = string_format("[%s]", address)
+  end
+
+  local res, err = httpc:request_uri(
+    string_format("http://%s:%s%s", address, endpoint.port, config.path),
+    { method = "GET" })
+  if not res then
+    ngx.log(ngx.INFO, "warm-up check of ", key, " failed: ", err)
+    return
+  end
+
+  if res.status ~= config.status then
+    ngx.log(ngx.INFO, "warm-up check of ", key, " returned status ", res.status)
+    return
+  end
+
+  warm_up_data:set(key, true, READY_TTL)
+  warm_up_data:incr(GENERATION_KEY, 1, 0)
+end
+
+local function schedule_check(key, config, endpoint)
+  -- only one worker checks the endpoint in each interval
+  local ok = warm_up_data:add(key .. "|check", true, CHECK_INTERVAL + config.timeout / 1000)
+  if not ok then
+    return
+  end
+
+  local _, err = ngx.timer.at(0, check, key, config, endpoint)
+  if err then
+    ngx.log(ngx.ERR, "failed to create warm-up check timer: ", err)
+  end
+end
+
+-- filter returns the backend with only the endpoints that passed the
+-- warm-up check. All the endpoints are returned when none of them is ready
+-- to keep the backend available.
+function _M.filter(backend)
+  local config = backend.warmUp
+  if not config or not config.path or config.path == "" then
+    return backend
+  end
+
+  if not backend.endpoints or #backend.endpoints == 0 then
+    return backend
+  end
+
+  local ready = {}
+  for _, endpoint in ipairs(backend.endpoints) do
+    local key = endpoint_key(backend, endpoint)
+    if warm_up_data:get(key) then
+      warm_up_data:expire(key, READY_TTL)
+      ready[#ready + 1] = endpoint
+    else
+      pending[key] = { config = config, endpoint = endpoint }
+      schedule_check(key, config, endpoint)
+    end
+  end
+
+  if #ready == 0 or #ready == #backend.endpoints then
+    return backend
+  end
+
+  local filtered = {}
+  for k, v in pairs(backend) do
+    filtered[k] = v
+  end
+  filtered.endpoints = ready
+
+  return filtered
+end
+
+-- check_pending checks again the endpoints that are not ready yet, it is
+-- called in every interval of the sync of the backends
+function _M.check_pending()
+  for key, check_config in pairs(pending) do
+    schedule_check(key, check_config.config, check_config.endpoint)
+  end
+end
+
+-- has_changed returns true when the backends must be synced again to add
+-- the endpoints that passed the warm-up check
+function _M.has_changed()
+  return (warm_up_data:get(GENERATION_KEY) or 0) ~= synced_generation
+end
+
+function _M.reset_changed()
+  pending = {}
+  synced_generation = warm_up_data:get(GENERATION_KEY) or 0
+end
+
+return _M
@@ -0,0 +1,122 @@
+-- Limits the concurrent upgraded (WebSocket) connections to the locations
+-- configured with the annotations
+-- nginx.ingress.kubernetes.io/limit-websocket-connections-per-client and
+-- nginx.ingress.kubernetes.io/limit-websocket-connections-per-backend, across
+-- all the workers. The regular requests are not counted, so they cannot be
+-- starved by long-lived sessions and the other way around. A WebSocket holds
+-- its slots from the rewrite phase of its upgrade request to the log phase,
+-- when the session ends.
+local ngx = ngx
+local request_state = require("request_state")
+
+local ipairs = ipairs
+local string_lower = string.lower
+
+local counters = ngx.shared.websocket_connections
+
+-- seconds the counters of a key are kept after its last connection, the
+-- slots of the sessions never reaching the log phase, like the ones handled
+-- by a crashed worker, are recovered once the key is idle
+local COUNTER_TTL = 600
+
+local _M = {}
+
+local function incr(key, value)
+  local count, err, forcible = counters:incr(key, value, 0, COUNTER_TTL)
+  if not count then
+    ngx.log(ngx.WARN, "error updating the WebSocket connections of ", key, ": ", err)
+    return nil
+  end
+  if forcible then
+    ngx.log(ngx.WARN, "websocket_connections shared dictionary is full, consider increasing its size")
+  end
+
+  return count
+end
+
+local function is_upgrade()
+  local upgrade = ngx.var.http_upgrade
+  return upgrade ~= nil and string_lower(upgrade) == "websocket"
+end
+
+-- take returns true when the key has a slot left, or when its counter is
+-- not available
+local function take(key, limit)
+  local count = incr(key, 1)
+  if not count then
+    return true, false
+  end
+
+  counters:expire(key, COUNTER_TTL)
+
+  if count > limit then
+    incr(key, -1)
+    return false, false
+  end
+
+  return true, true
+end
+
+-- acquire must be called in the rewrite phase, the slots are released by the
+-- log phase of the request
+function _M.acquire(config)
+  if not config or (config.per_client == 0 and config.per_backend == 0) or
+      request_state.get("websocket_limit") or not is_upgrade() then
+    return
+  end
+
+  local keys = {}
+
+  if config.per_client > 0 then
+    local key = config.namespace .. "|client|" .. (ngx.var.remote_addr or "")
+    local ok, taken = take(key, config.per_client)
+    if not ok then
+      ngx.log(ngx.INFO, "too many WebSocket connections of ", ngx.var.remote_addr)
+      return ngx.exit(config.status_code)
+    end
+    if taken then
+      keys[#keys + 1] = key
+    end
+  end
+
+  if config.per_backend > 0 then
+    local key = config.namespace .. "|backend|" .. (ngx.var.proxy_upstream_name or "")
+    local ok, taken = take(key, config.per_backend)
+    if not ok then
+      for _, k in ipairs(keys) do
+        incr(k, -1)
+      end
+      ngx.log(ngx.INFO, "too many WebSocket connections to ", ngx.var.proxy_upstream_name)
+      return ngx.exit(config.status_code)
+    end
+    if taken then
+      keys[#keys + 1] = key
+    end
+  end
+
+  -- the slots are kept until the log phase across the internal redirects,
+  -- which reset ngx.ctx
+  request_state.set("websocket_limit", keys)
+end
+
+function _M.release()
+  local keys = request_state.take("websocket_limit")
+  if not keys then
+    return
+  end
+
+  for _, key in ipairs(keys) do
+    local count = incr(key, -1)
+    if count and count < 0 then
+      -- the counter expired while the session was open
+      incr(key, -count)
+    end
+  end
+end
+
+-- get returns the number of WebSocket connections of the key
+function _M.get(key)
+  return counters:get(key) or 0
+end
+
+return _M
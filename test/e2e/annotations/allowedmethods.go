@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package annotations
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+
+	"k8s.io/ingress-nginx/test/e2e/framework"
+)
+
+var _ = framework.DescribeAnnotation("allowed-methods", func() {
+	f := framework.NewDefaultFramework("allowedmethods")
+
+	ginkgo.BeforeEach(func() {
+		f.NewEchoDeployment()
+	})
+
+	ginkgo.It("should reject methods not in the allowed list", func() {
+		host := "allowedmethods.foo.com"
+		annotations := map[string]string{
+			"nginx.ingress.kubernetes.io/allowed-methods": "GET,POST",
+		}
+
+		f.EnsureIngress(framework.NewSingleIngress(host, "/", host, f.Namespace, framework.EchoService, 80, annotations))
+		f.WaitForNginxServer(host,
+			func(server string) bool {
+				return strings.Contains(server, "if ($request_method !~ ^(GET|POST|HEAD)$) {")
+			})
+
+		f.HTTPTestClient().
+			GET("/").
+			WithHeader("Host", host).
+			Expect().
+			Status(http.StatusOK)
+
+		f.HTTPTestClient().
+			POST("/").
+			WithHeader("Host", host).
+			Expect().
+			Status(http.StatusOK)
+
+		f.HTTPTestClient().
+			DELETE("/").
+			WithHeader("Host", host).
+			Expect().
+			Status(http.StatusMethodNotAllowed).
+			Header("Allow").Equal("GET, POST, HEAD")
+	})
+})
@@ -57,7 +57,7 @@ var _ = framework.DescribeAnnotation("backend-protocol", func() {
 
 		f.WaitForNginxServer(host,
 			func(server string) bool {
-				return strings.Contains(server, "grpc_pass grpc://upstream_balancer;")
+				return strings.Contains(server, "grpc_pass grpc://upstream_balancer_grpc;")
 			})
 	})
 
@@ -72,7 +72,7 @@ var _ = framework.DescribeAnnotation("backend-protocol", func() {
 
 		f.WaitForNginxServer(host,
 			func(server string) bool {
-				return strings.Contains(server, "grpc_pass grpcs://upstream_balancer;")
+				return strings.Contains(server, "grpc_pass grpcs://upstream_balancer_grpc;")
 			})
 	})
 
@@ -102,7 +102,9 @@ var _ = framework.DescribeAnnotation("backend-protocol", func() {
 
 		f.WaitForNginxServer(host,
 			func(server string) bool {
-				return strings.Contains(server, "ajp_pass upstream_balancer;")
+				return strings.Contains(server, "ajp_pass upstream_balancer;") &&
+					strings.Contains(server, `more_set_input_headers                  "X-Real-IP: $remote_addr";`) &&
+					strings.Contains(server, "ajp_keep_conn                           on;")
 			})
 	})
 })
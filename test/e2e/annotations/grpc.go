@@ -98,7 +98,7 @@ var _ = framework.DescribeAnnotation("backend-protocol - GRPC", func() {
 
 		f.WaitForNginxServer(host,
 			func(server string) bool {
-				return strings.Contains(server, "grpc_pass grpc://upstream_balancer;")
+				return strings.Contains(server, "grpc_pass grpc://upstream_balancer_grpc;")
 			})
 
 		conn, _ := grpc.Dial(f.GetNginxIP()+":443",
@@ -161,7 +161,7 @@ var _ = framework.DescribeAnnotation("backend-protocol - GRPC", func() {
 
 		f.WaitForNginxServer(host,
 			func(server string) bool {
-				return strings.Contains(server, "grpc_pass grpcs://upstream_balancer;")
+				return strings.Contains(server, "grpc_pass grpcs://upstream_balancer_grpc;")
 			})
 
 		conn, _ := grpc.Dial(f.GetNginxIP()+":443",
@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package annotations
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/onsi/ginkgo"
+
+	"k8s.io/ingress-nginx/test/e2e/framework"
+)
+
+var _ = framework.DescribeAnnotation("uri-normalization-policy", func() {
+	f := framework.NewDefaultFramework("urinormalization")
+
+	ginkgo.BeforeEach(func() {
+		f.NewEchoDeployment()
+	})
+
+	ginkgo.It("should reject requests with encoded slashes", func() {
+		host := "urinormalization.foo.com"
+		annotations := map[string]string{
+			"nginx.ingress.kubernetes.io/uri-normalization-policy": "reject",
+		}
+
+		f.EnsureIngress(framework.NewSingleIngress(host, "/", host, f.Namespace, framework.EchoService, 80, annotations))
+		f.WaitForNginxServer(host,
+			func(server string) bool {
+				return strings.Contains(server, `uri_normalization_policy = "reject"`)
+			})
+
+		f.HTTPTestClient().
+			GET("/foo/bar").
+			WithHeader("Host", host).
+			Expect().
+			Status(http.StatusOK)
+
+		f.HTTPTestClient().
+			GET("/foo%2Fbar").
+			WithHeader("Host", host).
+			Expect().
+			Status(http.StatusBadRequest)
+	})
+})
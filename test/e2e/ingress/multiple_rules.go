@@ -22,8 +22,7 @@ import (
 
 	"github.com/onsi/ginkgo"
 	"github.com/stretchr/testify/assert"
-	networkingv1beta1 "k8s.io/api/networking/v1beta1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	networking "k8s.io/api/networking/v1"
 
 	"k8s.io/ingress-nginx/test/e2e/framework"
 )
@@ -43,16 +42,20 @@ var _ = framework.IngressNginxDescribe("single ingress - multiple hosts", func()
 
 		ing := framework.NewSingleIngress("simh", "/", "first.host", f.Namespace, "first-service", 80, annotations)
 
-		ing.Spec.Rules = append(ing.Spec.Rules, networkingv1beta1.IngressRule{
+		ing.Spec.Rules = append(ing.Spec.Rules, networking.IngressRule{
 			Host: "second.host",
-			IngressRuleValue: networkingv1beta1.IngressRuleValue{
-				HTTP: &networkingv1beta1.HTTPIngressRuleValue{
-					Paths: []networkingv1beta1.HTTPIngressPath{
+			IngressRuleValue: networking.IngressRuleValue{
+				HTTP: &networking.HTTPIngressRuleValue{
+					Paths: []networking.HTTPIngressPath{
 						{
 							Path: "/",
-							Backend: networkingv1beta1.IngressBackend{
-								ServiceName: "second-service",
-								ServicePort: intstr.FromInt(80),
+							Backend: networking.IngressBackend{
+								Service: &networking.IngressServiceBackend{
+									Name: "second-service",
+									Port: networking.ServiceBackendPort{
+										Number: 80,
+									},
+								},
 							},
 						},
 					},
@@ -22,7 +22,7 @@ import (
 
 	"github.com/onsi/ginkgo"
 	corev1 "k8s.io/api/core/v1"
-	networking "k8s.io/api/networking/v1beta1"
+	networking "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
@@ -88,8 +88,12 @@ func buildIngressWithNonexistentService(host, namespace, path string) *networkin
 								{
 									Path: path,
 									Backend: networking.IngressBackend{
-										ServiceName: backendService,
-										ServicePort: intstr.FromInt(80),
+										Service: &networking.IngressServiceBackend{
+											Name: backendService,
+											Port: networking.ServiceBackendPort{
+												Number: 80,
+											},
+										},
 									},
 								},
 							},
@@ -104,22 +108,25 @@ func buildIngressWithNonexistentService(host, namespace, path string) *networkin
 func buildIngressWithUnavailableServiceEndpoints(host, namespace, path string) (*networking.Ingress, *corev1.Service) {
 	backendService := "unavailable-svc"
 	return &networking.Ingress{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      host,
-				Namespace: namespace,
-			},
-			Spec: networking.IngressSpec{
-				Rules: []networking.IngressRule{
-					{
-						Host: host,
-						IngressRuleValue: networking.IngressRuleValue{
-							HTTP: &networking.HTTPIngressRuleValue{
-								Paths: []networking.HTTPIngressPath{
-									{
-										Path: path,
-										Backend: networking.IngressBackend{
-											ServiceName: backendService,
-											ServicePort: intstr.FromInt(80),
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      host,
+			Namespace: namespace,
+		},
+		Spec: networking.IngressSpec{
+			Rules: []networking.IngressRule{
+				{
+					Host: host,
+					IngressRuleValue: networking.IngressRuleValue{
+						HTTP: &networking.HTTPIngressRuleValue{
+							Paths: []networking.HTTPIngressPath{
+								{
+									Path: path,
+									Backend: networking.IngressBackend{
+										Service: &networking.IngressServiceBackend{
+											Name: backendService,
+											Port: networking.ServiceBackendPort{
+												Number: 80,
+											},
 										},
 									},
 								},
@@ -128,22 +135,23 @@ func buildIngressWithUnavailableServiceEndpoints(host, namespace, path string) (
 					},
 				},
 			},
-		}, &corev1.Service{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      backendService,
-				Namespace: namespace,
-			},
-			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
-				{
-					Name:       "tcp",
-					Port:       80,
-					TargetPort: intstr.FromInt(80),
-					Protocol:   "TCP",
-				},
+		},
+	}, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backendService,
+			Namespace: namespace,
+		},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+			{
+				Name:       "tcp",
+				Port:       80,
+				TargetPort: intstr.FromInt(80),
+				Protocol:   "TCP",
 			},
-				Selector: map[string]string{
-					"app": backendService,
-				},
+		},
+			Selector: map[string]string{
+				"app": backendService,
 			},
-		}
+		},
+	}
 }